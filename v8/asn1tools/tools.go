@@ -16,17 +16,17 @@ func MarshalLengthBytes(l int) []byte {
 	if l <= 127 {
 		return []byte{byte(l)}
 	}
-	var b []byte
-	p := 1
-	for i := 1; i < 127; {
-		b = append([]byte{byte((l % (p * 256)) / p)}, b...)
-		p = p * 256
-		l = l - l%p
-		if l <= 0 {
-			break
-		}
+	var n int
+	for i := l; i > 0; i >>= 8 {
+		n++
 	}
-	return append([]byte{byte(128 + len(b))}, b...)
+	b := make([]byte, n+1)
+	b[0] = byte(128 + n)
+	for i := n; i > 0; i-- {
+		b[i] = byte(l)
+		l >>= 8
+	}
+	return b
 }
 
 // GetLengthFromASN returns the length of a slice of ASN1 encoded bytes from the ASN1 length header it contains.
@@ -56,6 +56,15 @@ func GetNumberBytesInLengthHeader(b []byte) int {
 
 // AddASNAppTag adds an ASN1 encoding application tag value to the raw bytes provided.
 func AddASNAppTag(b []byte, tag int) []byte {
+	if tag < 31 {
+		// The identifier is a single octet so the header can be written without marshaling a RawValue.
+		l := MarshalLengthBytes(len(b))
+		ab := make([]byte, 1+len(l)+len(b))
+		ab[0] = byte(asn1.ClassApplication<<6|0x20) | byte(tag)
+		copy(ab[1:], l)
+		copy(ab[1+len(l):], b)
+		return ab
+	}
 	r := asn1.RawValue{
 		Class:      asn1.ClassApplication,
 		IsCompound: true,
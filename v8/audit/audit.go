@@ -0,0 +1,65 @@
+// Package audit provides structured events for the authentications performed by services and formatters rendering
+// them as JSON lines or ArcSight Common Event Format (CEF) so that they can be ingested by tools such as Splunk and
+// Elastic without custom glue code.
+//
+//	f, _ := os.OpenFile("/var/log/krb5-audit.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+//	h := spnego.SPNEGOKRB5Authenticate(inner, kt, service.AuditHook(audit.NewWriterHook(f, audit.JSON)))
+package audit
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Outcome of an authentication.
+type Outcome string
+
+// Outcomes.
+const (
+	Success Outcome = "success"
+	Failure Outcome = "failure"
+)
+
+// EventAuthentication is the type of the event emitted when a service verifies a client's AP_REQ.
+const EventAuthentication = "authentication"
+
+// Event describes an authentication performed by a service.
+type Event struct {
+	Time    time.Time
+	Type    string
+	Outcome Outcome
+	// ClientPrincipal and ClientRealm identify the client, if known.
+	ClientPrincipal string
+	ClientRealm     string
+	// ServicePrincipal is the name of the service the ticket was issued for.
+	ServicePrincipal string
+	ServiceRealm     string
+	// ClientAddress is the network address of the client, if known.
+	ClientAddress string
+	// EType is the name of the encryption type of the ticket.
+	EType string
+	// Reason describes why the authentication failed.
+	Reason string
+	// CorrelationID of the request, if it has one.
+	CorrelationID string
+}
+
+// Hook is called with each event emitted. It is called synchronously on the goroutine performing the authentication so
+// it should not block.
+type Hook func(Event)
+
+// Formatter renders an event as a single line, without the line terminator.
+type Formatter func(Event) []byte
+
+// NewWriterHook returns a hook writing each event on its own line to the writer in the format provided. Writes are
+// serialised so the hook can be shared by concurrent authentications. Write errors are ignored.
+func NewWriterHook(w io.Writer, f Formatter) Hook {
+	var mux sync.Mutex
+	return func(e Event) {
+		b := append(f(e), '\n')
+		mux.Lock()
+		defer mux.Unlock()
+		w.Write(b)
+	}
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jsonEvent holds the stable field names of the JSON format.
+type jsonEvent struct {
+	Time             string  `json:"time"`
+	Type             string  `json:"event"`
+	Outcome          Outcome `json:"outcome"`
+	ClientPrincipal  string  `json:"client_principal,omitempty"`
+	ClientRealm      string  `json:"client_realm,omitempty"`
+	ServicePrincipal string  `json:"service_principal,omitempty"`
+	ServiceRealm     string  `json:"service_realm,omitempty"`
+	ClientAddress    string  `json:"client_address,omitempty"`
+	EType            string  `json:"etype,omitempty"`
+	Reason           string  `json:"reason,omitempty"`
+	CorrelationID    string  `json:"correlation_id,omitempty"`
+}
+
+// JSON formats the event as a JSON object, for JSON lines output. The time is in RFC 3339 format with nanoseconds in UTC.
+func JSON(e Event) []byte {
+	b, _ := json.Marshal(jsonEvent{
+		Time:             e.Time.UTC().Format(time.RFC3339Nano),
+		Type:             e.Type,
+		Outcome:          e.Outcome,
+		ClientPrincipal:  e.ClientPrincipal,
+		ClientRealm:      e.ClientRealm,
+		ServicePrincipal: e.ServicePrincipal,
+		ServiceRealm:     e.ServiceRealm,
+		ClientAddress:    e.ClientAddress,
+		EType:            e.EType,
+		Reason:           e.Reason,
+		CorrelationID:    e.CorrelationID,
+	})
+	return b
+}
+
+// CEF header values.
+const (
+	cefVendor  = "gokrb5"
+	cefProduct = "gokrb5"
+	cefVersion = "8"
+)
+
+// CEF formats the event in ArcSight Common Event Format. Successful authentications have a severity of 3 and
+// failures 7. The extension uses the standard keys rt, outcome, suser, sntdom, dntdom, src and reason, with the
+// service principal, encryption type and correlation ID in the custom strings cs1, cs2 and cs3.
+func CEF(e Event) []byte {
+	sev := 3
+	if e.Outcome != Success {
+		sev = 7
+	}
+	name := e.Type
+	if name == "" {
+		name = EventAuthentication
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|", cefHeader(cefVendor), cefHeader(cefProduct), cefHeader(cefVersion),
+		cefHeader(name+":"+string(e.Outcome)), cefHeader("Kerberos "+name+" "+string(e.Outcome)), sev)
+	ext := [][2]string{
+		{"rt", fmt.Sprintf("%d", e.Time.UnixNano()/int64(time.Millisecond))},
+		{"outcome", string(e.Outcome)},
+		{"suser", e.ClientPrincipal},
+		{"sntdom", e.ClientRealm},
+		{"dntdom", e.ServiceRealm},
+		{"src", e.ClientAddress},
+		{"reason", e.Reason},
+	}
+	for i, cs := range [][2]string{
+		{"servicePrincipal", e.ServicePrincipal},
+		{"etype", e.EType},
+		{"correlationID", e.CorrelationID},
+	} {
+		if cs[1] != "" {
+			ext = append(ext, [2]string{fmt.Sprintf("cs%dLabel", i+1), cs[0]}, [2]string{fmt.Sprintf("cs%d", i+1), cs[1]})
+		}
+	}
+	var sep string
+	for _, kv := range ext {
+		if kv[1] == "" {
+			continue
+		}
+		b.WriteString(sep + kv[0] + "=" + cefExtension(kv[1]))
+		sep = " "
+	}
+	return []byte(b.String())
+}
+
+var (
+	cefHeaderReplacer    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionReplacer = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// cefHeader escapes a CEF header field.
+func cefHeader(s string) string {
+	return cefHeaderReplacer.Replace(s)
+}
+
+// cefExtension escapes a CEF extension value.
+func cefExtension(s string) string {
+	return cefExtensionReplacer.Replace(s)
+}
@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testEvent() Event {
+	return Event{
+		Time:             time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC),
+		Type:             EventAuthentication,
+		Outcome:          Failure,
+		ClientPrincipal:  "testuser1",
+		ClientRealm:      "TEST.GOKRB5",
+		ServicePrincipal: "HTTP/host.test.gokrb5",
+		ServiceRealm:     "TEST.GOKRB5",
+		ClientAddress:    "10.0.0.1",
+		EType:            "aes256-cts-hmac-sha1-96",
+		Reason:           "clock skew = too great\nretry",
+	}
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, `{"time":"2020-01-02T03:04:05.006Z","event":"authentication","outcome":"failure",`+
+		`"client_principal":"testuser1","client_realm":"TEST.GOKRB5","service_principal":"HTTP/host.test.gokrb5",`+
+		`"service_realm":"TEST.GOKRB5","client_address":"10.0.0.1","etype":"aes256-cts-hmac-sha1-96",`+
+		`"reason":"clock skew = too great\nretry"}`, string(JSON(testEvent())), "JSON not as expected")
+}
+
+func TestCEF(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, `CEF:0|gokrb5|gokrb5|8|authentication:failure|Kerberos authentication failure|7|`+
+		`rt=1577934245006 outcome=failure suser=testuser1 sntdom=TEST.GOKRB5 dntdom=TEST.GOKRB5 src=10.0.0.1 `+
+		`reason=clock skew \= too great\nretry cs1Label=servicePrincipal cs1=HTTP/host.test.gokrb5 `+
+		`cs2Label=etype cs2=aes256-cts-hmac-sha1-96`, string(CEF(testEvent())), "CEF not as expected")
+}
+
+func TestNewWriterHook(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	h := NewWriterHook(&b, JSON)
+	h(testEvent())
+	h(Event{Type: EventAuthentication, Outcome: Success})
+	assert.Equal(t, 2, bytes.Count(b.Bytes(), []byte("\n")), "each event should be written on its own line")
+}
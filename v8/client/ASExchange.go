@@ -1,37 +1,95 @@
 package client
 
 import (
+	"context"
+	"strings"
+
 	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/fast"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/pkinit"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
 
 // ASExchange performs an AS exchange for the client to retrieve a TGT.
 func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	return cl.asExchange(context.Background(), realm, ASReq, referral)
+}
+
+// GetInitialServiceTicket makes an AS exchange to get a ticket for the SPN of the client's realm with the client's
+// password, keytab or other secret rather than with its TGT, as services such as MIT's kadmin/admin only accept initial
+// tickets. The ticket is not added to the client's ticket cache.
+func (cl *Client) GetInitialServiceTicket(spn string) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, key, err := cl.getInitialServiceTicket(spn)
+	return tkt, key, cl.correlate(err)
+}
+
+func (cl *Client) getInitialServiceTicket(spn string) (messages.Ticket, types.EncryptionKey, error) {
+	if !cl.hasSecret() {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.New(krberror.ConfigError, "an initial ticket cannot be obtained without the client's password, keytab or other secret")
+	}
+	realm := cl.Credentials.Domain()
+	ASReq, err := messages.NewASReq(realm, cl.Config, cl.Credentials.CName(), types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn))
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	ASReq.ReqBody.SetTimes(cl.now(), cl.Config)
+	ASRep, err := cl.ASExchange(realm, ASReq, 0)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	return ASRep.Ticket, ASRep.DecryptedEncPart.Key, nil
+}
+
+func (cl *Client) asExchange(ctx context.Context, realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
 	if ok, err := cl.IsConfigured(); !ok {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.ConfigError, "AS Exchange cannot be performed")
 	}
 
+	fa, err := cl.asArmor(ctx, realm)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed to get FAST armor for AS_REQ")
+	}
+	if err := cl.addPACRequest(&ASReq.PAData); err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: issue with setting PA-PAC-REQUEST on AS_REQ")
+	}
+	// The PAData of the request before pre-authentication is added, to be used if the client is referred to another realm.
+	pa := ASReq.PAData
 	// Set PAData if required
-	err := setPAData(cl, nil, &ASReq)
+	err = setPAData(ctx, cl, nil, &ASReq, fa)
 	if err != nil {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: issue with setting PAData on AS_REQ")
 	}
+	pk, err := cl.setPKINITPAData(&ASReq)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: issue with setting PKINIT PAData on AS_REQ")
+	}
 
-	b, err := ASReq.Marshal()
+	b, err := marshalASReq(ASReq, fa)
 	if err != nil {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
 	}
 	var ASRep messages.ASRep
 
-	rb, err := cl.sendToKDC(b, realm)
+	rb, err := cl.sendToKDC(ctx, b, realm)
 	if err != nil {
 		if e, ok := err.(messages.KRBError); ok {
+			if e, err = fastError(fa, e); err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: failed to process the KDC's FAST error response")
+			}
+			err = e
+			if rctx, ok := cl.retryForSkew(ctx, realm, e); ok {
+				// Retry with the pre-authentication timestamped with the corrected clock.
+				ASReq.PAData = append(types.PADataSequence(nil), pa...)
+				return cl.asExchange(rctx, realm, ASReq, referral)
+			}
 			switch e.ErrorCode {
 			case errorcode.KDC_ERR_PREAUTH_FAILED:
 				// Custom (kerbrute) handling for failed pre-authentication
@@ -47,18 +105,31 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 			case errorcode.KDC_ERR_PREAUTH_REQUIRED:
 				// From now on assume this client will need to do this pre-auth and set the PAData
 				cl.settings.assumePreAuthentication = true
-				err = setPAData(cl, &e, &ASReq)
+				var otp bool
+				if otp, err = cl.setOTPPAData(ctx, &e, &ASReq, fa); err != nil {
+					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting AS_REQ OTP PAData")
+				}
+				if !otp {
+					err = setPAData(ctx, cl, &e, &ASReq, fa)
+				}
 				if err != nil {
 					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting AS_REQ PAData for pre-authentication required")
 				}
-				b, err := ASReq.Marshal()
+				b, err := marshalASReq(ASReq, fa)
 				if err != nil {
 					return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ with PAData")
 				}
-				rb, err = cl.sendToKDC(b, realm)
+				rb, err = cl.sendToKDC(ctx, b, realm)
 				if err != nil {
-					if _, ok := err.(messages.KRBError); ok {
-						return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+					if e, ok := err.(messages.KRBError); ok {
+						if fe, ferr := fastError(fa, e); ferr == nil {
+							e = fe
+						}
+						if rctx, ok := cl.retryForSkew(ctx, realm, e); ok {
+							ASReq.PAData = append(types.PADataSequence(nil), pa...)
+							return cl.asExchange(rctx, realm, ASReq, referral)
+						}
+						return messages.ASRep{}, krberror.Errorf(e, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
 					}
 					return messages.ASRep{}, krberror.Errorf(err, krberror.NetworkingError, "AS Exchange Error: failed sending AS_REQ to KDC")
 				}
@@ -67,8 +138,14 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 				if referral > 5 {
 					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "maximum number of client referrals exceeded")
 				}
+				if e.CRealm == "" || e.CRealm == realm {
+					return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: KDC referred the client to an invalid realm %q", e.CRealm)
+				}
 				referral++
-				return cl.ASExchange(e.CRealm, ASReq, referral)
+				// The client's realm is the realm it was referred to, whose KDC's salt for its keys is then used.
+				cl.Log("client %s referred from realm %s to %s", cl.Credentials.CName().PrincipalNameString(), realm, e.CRealm)
+				cl.Credentials.SetRealm(e.CRealm)
+				return cl.asExchange(ctx, e.CRealm, referredASReq(ASReq, pa, realm, e.CRealm), referral)
 			default:
 				return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
 			}
@@ -80,19 +157,126 @@ func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (
 	if err != nil {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed to process the AS_REP")
 	}
-	if ok, err := ASRep.Verify(cl.Config, cl.Credentials, ASReq); !ok {
+	if ok, err := cl.verifyASRep(ctx, &ASRep, ASReq, pk, fa); !ok {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid or client password/keytab incorrect")
 	}
+	// The authentication time of the verified reply is the KDC's time.
+	cl.syncClock(ASRep.DecryptedEncPart.AuthTime, realm)
+	cl.warnWeakETypes(ASRep.KDCRepFields)
 	return ASRep, nil
 }
 
-// setPAData adds pre-authentication data to the AS_REQ.
-func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) error {
-	if !cl.settings.DisablePAFXFAST() {
+// referredASReq returns the AS_REQ, with its PAData before pre-authentication was added, to send to the realm the
+// client was referred to. A request for the TGT of the realm the client was referred from is for that of the new realm.
+func referredASReq(ASReq messages.ASReq, pa types.PADataSequence, from, to string) messages.ASReq {
+	ASReq.PAData = append(types.PADataSequence(nil), pa...)
+	ASReq.ReqBody.Realm = to
+	sname := ASReq.ReqBody.SName
+	if len(sname.NameString) == 2 && strings.ToLower(sname.NameString[0]) == "krbtgt" && sname.NameString[1] == from {
+		ASReq.ReqBody.SName = types.PrincipalName{
+			NameType:   sname.NameType,
+			NameString: []string{sname.NameString[0], to},
+		}
+	}
+	return ASReq
+}
+
+// verifyASRep verifies the AS_REP taking into account the client's interoperability profile and, if the request asked
+// for the names to be canonicalized, that the client principal name of the reply may be the canonical one. If the PKINIT request
+// is not nil the AS_REP is decrypted with the reply key agreed with its PKINIT pre-authentication data. If the FAST
+// armor is not nil the KDC's FAST response is verified first and the reply key strengthened as the KDC requires. The
+// KDC's encrypted challenge is verified if the AS_REQ was pre-authenticated with one, and the reply to a request
+// pre-authenticated with a one-time password is encrypted with the armor key. The reply to an anonymous request
+// must be for the anonymous realm and include the KDC's contribution to the session key.
+func (cl *Client) verifyASRep(ctx context.Context, ASRep *messages.ASRep, ASReq messages.ASReq, pk *pkinit.Request, fa *fast.Armor) (bool, error) {
+	c := cl.exchangeClock(ctx, ASReq.ReqBody.Realm)
+	if fa != nil {
+		err := fa.Reply(&ASRep.KDCRepFields)
+		if err != nil {
+			return false, krberror.Errorf(err, krberror.KRBMsgError, "error verifying the KDC's FAST response")
+		}
+	}
+	verify := func() (bool, error) {
+		if pk == nil && fa == nil {
+			return ASRep.VerifyWithClock(cl.Config, cl.Credentials, ASReq, c)
+		}
+		var key types.EncryptionKey
+		var err error
+		if pk != nil {
+			key, err = pk.ReplyKey(ASRep)
+			if err != nil {
+				return false, krberror.Errorf(err, krberror.DecryptingError, "error getting the PKINIT reply key")
+			}
+		} else if fa != nil && ASReq.PAData.Contains(patype.PA_OTP_REQUEST) {
+			key, err = fa.OTPReplyKey()
+			if err != nil {
+				return false, krberror.Errorf(err, krberror.KRBMsgError, "error getting the OTP reply key")
+			}
+		} else if fa != nil && ASReq.PAData.Contains(patype.PA_ENCRYPTED_CHALLENGE) {
+			key, err = fa.ChallengeReplyKey(ASRep.PAData, c.Now().UTC(), cl.Config.LibDefaults.Clockskew)
+			if err != nil {
+				return false, krberror.Errorf(err, krberror.KRBMsgError, "error verifying the KDC's encrypted challenge")
+			}
+		} else {
+			key, err = ASRep.ClientKey(cl.Credentials)
+			if err != nil {
+				return false, err
+			}
+			defer cl.zeroDerivedKey(key)
+		}
+		if fa != nil {
+			key, err = fa.ReplyKey(key)
+			if err != nil {
+				return false, err
+			}
+		}
+		ok, err := ASRep.VerifyWithReplyKey(cl.Config, key, ASReq, c)
+		if ok && pk != nil && pk.Anonymous() {
+			if err := pkinit.VerifyKeyExchange(ASRep, key); err != nil {
+				return false, err
+			}
+		}
+		return ok, err
+	}
+	if pk != nil && pk.Anonymous() {
+		// The KDC issues the ticket to the anonymous realm rather than that requested, RFC 8062 section 4.1.
+		if ASRep.CRealm != pkinit.AnonymousRealm {
+			return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response to anonymous request is not the anonymous realm: %s", ASRep.CRealm)
+		}
+		ASRep.CRealm = ASReq.ReqBody.Realm
+		ok, err := verify()
+		ASRep.CRealm = pkinit.AnonymousRealm
+		return ok, err
+	}
+	if (cl.settings.InteropProfileForRealm(ASReq.ReqBody.Realm) != ProfileFreeIPA && !canonicalize(ASReq.ReqBody)) ||
+		ASRep.CName.Equal(ASReq.ReqBody.CName) {
+		return verify()
+	}
+	// The KDC has replied with the canonical name of the principal alias requested. The reply is still bound to
+	// the request by the nonce and the client's key, so verify it against the name requested.
+	cname := ASRep.CName
+	ASRep.CName = ASReq.ReqBody.CName
+	ok, err := verify()
+	ASRep.CName = cname
+	if ok {
+		cl.Log("principal alias %s resolved to %s", ASReq.ReqBody.CName.PrincipalNameString(), cname.PrincipalNameString())
+	}
+	return ok, err
+}
+
+// setPAData adds pre-authentication data to the AS_REQ. If the FAST armor is not nil and the KDC has advertised the
+// encrypted challenge mechanism, a PA-ENCRYPTED-CHALLENGE is used in preference to the encrypted timestamp. The
+// timestamp is that of the clock for the exchange of the context.
+func setPAData(ctx context.Context, cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq, fa *fast.Armor) error {
+	// FAST negotiation is not needed when the request is armored
+	if !cl.settings.DisablePAFXFAST() && cl.settings.FASTArmor() == nil {
 		pa := types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}
 		ASReq.PAData = append(ASReq.PAData, pa)
 	}
-	if cl.settings.AssumePreAuthentication() {
+	// PKINIT pre-authentication data is added separately as the client has no key from which to encrypt a timestamp.
+	// A client pre-authenticating with a one-time password waits for the KDC's challenge rather than sending a timestamp.
+	if cl.settings.AssumePreAuthentication() && !cl.Credentials.HasCertificate() && !cl.anonymous() &&
+		!(krberr == nil && fa != nil && cl.settings.OTP() != nil) {
 		// Identify the etype to use to encrypt the PA Data
 		var et etype.EType
 		var err error
@@ -109,28 +293,47 @@ func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) err
 			if err != nil {
 				return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
 			}
-			key, kvno, err = cl.Key(et, 0, nil)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
-			}
 		} else {
 			// Get the etype to use from the PA data in the KRBError e-data
-			et, err = preAuthEType(krberr)
+			pas, err := cl.kdcPAData(krberr)
+			if err != nil {
+				return krberror.Errorf(err, krberror.EncodingError, "error unmashalling KRBError data")
+			}
+			if cl.settings.InteropProfileForRealm(krberr.Realm).lenientEData() &&
+				!pas.Contains(patype.PA_ETYPE_INFO2) && !pas.Contains(patype.PA_ETYPE_INFO) {
+				// The KDC has not indicated the etype to use so resort to config
+				et, err = crypto.GetEtype(int32(cl.Config.LibDefaults.PreferredPreauthTypes[0]))
+			} else {
+				et, err = preAuthEType(pas)
+			}
 			if err != nil {
 				return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
 			}
 			cl.settings.preAuthEType = et.GetETypeID() // Set the etype that has been defined for potential future use
-			key, kvno, err = cl.Key(et, 0, krberr)
+			cl.settings.preAuthEncChallenge = pas.Contains(patype.PA_ENCRYPTED_CHALLENGE)
+		}
+		if cl.Credentials.HasKeyHandles() {
+			return setPADataWithKeyHandle(ctx, cl, ASReq, et, fa)
+		}
+		key, kvno, err = cl.Key(et, 0, krberr)
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+		}
+		if fa != nil && cl.settings.preAuthEncChallenge {
+			pa, err := fa.EncryptedChallengeAt(key, cl.exchangeClock(ctx, ASReq.ReqBody.Realm).Now().UTC())
 			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+				return krberror.Errorf(err, krberror.EncryptingError, "error creating encrypted challenge for pre-authentication")
 			}
+			replacePAData(ASReq, pa)
+			return nil
 		}
 		// Generate the PA data
-		paTSb, err := types.GetPAEncTSEncAsnMarshalled()
+		paTSb, err := types.GetPAEncTSEncAsnMarshalledAt(cl.exchangeClock(ctx, ASReq.ReqBody.Realm).Now().UTC())
 		if err != nil {
 			return krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for Pre-Authentication")
 		}
 		paEncTS, err := crypto.GetEncryptedData(paTSb, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP, kvno)
+		cl.zeroDerivedKey(key)
 		if err != nil {
 			return krberror.Errorf(err, krberror.EncryptingError, "error encrypting pre-authentication timestamp")
 		}
@@ -142,28 +345,66 @@ func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) err
 			PADataType:  patype.PA_ENC_TIMESTAMP,
 			PADataValue: pb,
 		}
-		// Look for and delete any exiting patype.PA_ENC_TIMESTAMP
-		for i, pa := range ASReq.PAData {
-			if pa.PADataType == patype.PA_ENC_TIMESTAMP {
-				ASReq.PAData[i] = ASReq.PAData[len(ASReq.PAData)-1]
-				ASReq.PAData = ASReq.PAData[:len(ASReq.PAData)-1]
-			}
-		}
-		ASReq.PAData = append(ASReq.PAData, pa)
+		replacePAData(ASReq, pa)
 	}
 	return nil
 }
 
-// preAuthEType establishes what encryption type to use for pre-authentication from the KRBError returned from the KDC.
-func preAuthEType(krberr *messages.KRBError) (etype etype.EType, err error) {
+// setPADataWithKeyHandle adds a PA_ENC_TIMESTAMP encrypted with the handle to the client's key of the etype to the
+// AS_REQ. The encrypted challenge mechanism is not supported as the FAST reply key cannot be derived without the
+// client's key value.
+func setPADataWithKeyHandle(ctx context.Context, cl *Client, ASReq *messages.ASReq, et etype.EType, fa *fast.Armor) error {
+	if fa != nil && cl.settings.preAuthEncChallenge {
+		return krberror.Errorf(keytab.ErrKeyNotExtractable, krberror.EncryptingError, "encrypted challenge pre-authentication requires the client's key")
+	}
+	h, err := cl.Credentials.KeyHandles().GetKeyHandle(cl.Credentials.CName(), cl.Credentials.Domain(), 0, et.GetETypeID())
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error getting key handle from credentials")
+	}
+	paTSb, err := types.GetPAEncTSEncAsnMarshalledAt(cl.exchangeClock(ctx, ASReq.ReqBody.Realm).Now().UTC())
+	if err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for Pre-Authentication")
+	}
+	b, err := h.Encrypt(paTSb, keyusage.AS_REQ_PA_ENC_TIMESTAMP)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error encrypting pre-authentication timestamp")
+	}
+	paEncTS := types.EncryptedData{
+		EType:  h.KeyType(),
+		KVNO:   h.KVNO(),
+		Cipher: b,
+	}
+	pb, err := paEncTS.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling the PAEncTSEnc encrypted data")
+	}
+	replacePAData(ASReq, types.PAData{
+		PADataType:  patype.PA_ENC_TIMESTAMP,
+		PADataValue: pb,
+	})
+	return nil
+}
+
+// replacePAData adds the pre-authentication data to the AS_REQ, deleting any existing PA_ENC_TIMESTAMP,
+// PA_ENCRYPTED_CHALLENGE or PA_OTP_REQUEST.
+func replacePAData(ASReq *messages.ASReq, pa types.PAData) {
+	for i := 0; i < len(ASReq.PAData); i++ {
+		if t := ASReq.PAData[i].PADataType; t == patype.PA_ENC_TIMESTAMP || t == patype.PA_ENCRYPTED_CHALLENGE ||
+			t == patype.PA_OTP_REQUEST {
+			ASReq.PAData[i] = ASReq.PAData[len(ASReq.PAData)-1]
+			ASReq.PAData = ASReq.PAData[:len(ASReq.PAData)-1]
+			i--
+		}
+	}
+	ASReq.PAData = append(ASReq.PAData, pa)
+}
+
+// preAuthEType establishes what encryption type to use for pre-authentication from the PA data in the KRBError
+// returned from the KDC.
+func preAuthEType(pas types.PADataSequence) (etype etype.EType, err error) {
 	// RFC 4120 5.2.7.5 covers the preference order of ETYPE-INFO2 and ETYPE-INFO.
 	var etypeID int32
-	var pas types.PADataSequence
-	e := pas.Unmarshal(krberr.EData)
-	if e != nil {
-		err = krberror.Errorf(e, krberror.EncodingError, "error unmashalling KRBError data")
-		return
-	}
+	var e error
 Loop:
 	for _, pa := range pas {
 		switch pa.PADataType {
@@ -1,6 +1,9 @@
 package client
 
 import (
+	"context"
+
+	"github.com/jcmturner/gokrb5/v8/fast"
 	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
@@ -10,49 +13,76 @@ import (
 
 // TGSREQGenerateAndExchange generates the TGS_REQ and performs a TGS exchange to retrieve a ticket to the specified SPN.
 func (cl *Client) TGSREQGenerateAndExchange(spn types.PrincipalName, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, renewal bool) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	return cl.TGSREQGenerateAndExchangeContext(context.Background(), spn, kdcRealm, tgt, sessionKey, renewal)
+}
+
+// TGSREQGenerateAndExchangeContext generates the TGS_REQ and performs a TGS exchange to retrieve a ticket to the
+// specified SPN. The exchanges with the KDC are abandoned if the context is done before they complete.
+func (cl *Client) TGSREQGenerateAndExchangeContext(ctx context.Context, spn types.PrincipalName, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, renewal bool) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
 	tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), kdcRealm, cl.Config, tgt, sessionKey, spn, renewal)
+	if err == nil {
+		err = cl.timeTGSReq(&tgsReq, tgt, sessionKey)
+	}
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")
 	}
-	return cl.TGSExchange(tgsReq, kdcRealm, tgsRep.Ticket, sessionKey, 0)
+	return cl.tgsExchange(ctx, tgsReq, kdcRealm, tgt, sessionKey, 0)
 }
 
 // TGSExchange exchanges the provided TGS_REQ with the KDC to retrieve a TGS_REP.
 // Referrals are automatically handled.
 // The client's cache is updated with the ticket received.
 func (cl *Client) TGSExchange(tgsReq messages.TGSReq, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int) (messages.TGSReq, messages.TGSRep, error) {
+	return cl.tgsExchange(context.Background(), tgsReq, kdcRealm, tgt, sessionKey, referral)
+}
+
+func (cl *Client) tgsExchange(ctx context.Context, tgsReq messages.TGSReq, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int) (messages.TGSReq, messages.TGSRep, error) {
 	var tgsRep messages.TGSRep
-	b, err := tgsReq.Marshal()
+	b, fa, err := cl.marshalTGSReq(ctx, &tgsReq, tgt, sessionKey)
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal TGS_REQ")
 	}
-	r, err := cl.sendToKDC(b, kdcRealm)
+	r, err := cl.sendToKDC(ctx, b, kdcRealm)
 	if err != nil {
-		if _, ok := err.(messages.KRBError); ok {
-			return tgsReq, tgsRep, krberror.Errorf(err, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting for %s", tgsReq.ReqBody.SName.PrincipalNameString())
+		if e, ok := err.(messages.KRBError); ok {
+			if fe, ferr := fastError(fa, e); ferr == nil {
+				e = fe
+			}
+			if rctx, ok := cl.retryForSkew(ctx, kdcRealm, e); ok {
+				// Retry with the authenticator timed with the corrected clock.
+				return cl.tgsExchange(rctx, tgsReq, kdcRealm, tgt, sessionKey, referral)
+			}
+			return tgsReq, tgsRep, krberror.Errorf(e, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting for %s", tgsReq.ReqBody.SName.PrincipalNameString())
 		}
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ to KDC")
 	}
-	err = tgsRep.Unmarshal(r)
-	if err != nil {
-		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
-	}
-	err = tgsRep.DecryptEncPart(sessionKey)
+	return cl.processTGSRep(ctx, tgsReq, r, kdcRealm, tgt, sessionKey, referral, fa)
+}
+
+// processTGSRep processes the bytes of the KDC's response to the TGS_REQ.
+// Referrals are followed and the client's cache is updated with the ticket received.
+func (cl *Client) processTGSRep(ctx context.Context, tgsReq messages.TGSReq, r []byte, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int, fa *fast.Armor) (messages.TGSReq, messages.TGSRep, error) {
+	tgsRep, err := cl.decodeTGSRep(ctx, tgsReq, r, sessionKey, fa)
 	if err != nil {
-		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+		return tgsReq, tgsRep, err
 	}
-	if ok, err := tgsRep.Verify(cl.Config, tgsReq); !ok {
-		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: TGS_REP is not valid")
-	}
-
 	if tgsRep.Ticket.SName.NameString[0] == "krbtgt" && !tgsRep.Ticket.SName.Equal(tgsReq.ReqBody.SName) {
 		if referral > 5 {
 			return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: maximum number of referrals exceeded")
 		}
 		// Server referral https://tools.ietf.org/html/rfc6806.html#section-8
 		// The TGS Rep contains a TGT for another domain as the service resides in that domain.
-		cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+		if cl.settings.InteropProfileForRealm(kdcRealm) == ProfileFreeIPA && tgsRep.Ticket.EncPart.KVNO == 0 {
+			// kvno 0 referral TGTs cannot be renewed so are only used to follow this referral.
+			cl.Log("referral TGT %s with kvno 0 not added as a session", tgsRep.Ticket.SName.PrincipalNameString())
+		} else {
+			cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+		}
 		realm := tgsRep.Ticket.SName.NameString[len(tgsRep.Ticket.SName.NameString)-1]
+		if realm == kdcRealm {
+			return tgsReq, tgsRep, krberror.NewErrorf(krberror.KRBMsgError, "TGS Exchange Error: KDC for %s referred the request for %s to its own realm", kdcRealm, tgsReq.ReqBody.SName.PrincipalNameString())
+		}
+		cl.Log("request for %s referred from realm %s to %s", tgsReq.ReqBody.SName.PrincipalNameString(), kdcRealm, realm)
 		referral++
 		if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.EncTktInSkey) && len(tgsReq.ReqBody.AdditionalTickets) > 0 {
 			tgsReq, err = messages.NewUser2UserTGSReq(cl.Credentials.CName(), kdcRealm, cl.Config, tgt, sessionKey, tgsReq.ReqBody.SName, tgsReq.Renewal, tgsReq.ReqBody.AdditionalTickets[0])
@@ -60,44 +90,311 @@ func (cl *Client) TGSExchange(tgsReq messages.TGSReq, kdcRealm string, tgt messa
 				return tgsReq, tgsRep, err
 			}
 		}
+		body := tgsReq.ReqBody
 		tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), realm, cl.Config, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, tgsReq.ReqBody.SName, tgsReq.Renewal)
 		if err != nil {
 			return tgsReq, tgsRep, err
 		}
-		return cl.TGSExchange(tgsReq, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, referral)
+		// The referred request keeps the KDC options and times of the original, which may have been overridden.
+		err = tgsReq.UpdateBody(func(b *messages.KDCReqBody) {
+			b.KDCOptions, b.From, b.Till, b.RTime = body.KDCOptions, body.From, body.Till, body.RTime
+		}, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key)
+		if err != nil {
+			return tgsReq, tgsRep, err
+		}
+		return cl.tgsExchange(ctx, tgsReq, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, referral)
+	}
+	if types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, flags.Invalid) {
+		// A postdated ticket is not valid until the KDC validates it so is not cached.
+		return tgsReq, tgsRep, err
 	}
-	cl.cache.addEntry(
+	cl.cacheTicket(
 		tgsRep.Ticket,
 		tgsRep.DecryptedEncPart.AuthTime,
 		tgsRep.DecryptedEncPart.StartTime,
 		tgsRep.DecryptedEncPart.EndTime,
 		tgsRep.DecryptedEncPart.RenewTill,
 		tgsRep.DecryptedEncPart.Key,
+		tgsRep.DecryptedEncPart.Flags,
 	)
 	cl.Log("ticket added to cache for %s (EndTime: %v)", tgsRep.Ticket.SName.PrincipalNameString(), tgsRep.DecryptedEncPart.EndTime)
+	cl.onServiceTicket(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+	cl.sweepCache()
+	cl.scheduleRenewal()
 	return tgsReq, tgsRep, err
 }
 
+// decodeTGSRep unmarshals, decrypts and verifies the bytes of the KDC's response to the TGS_REQ.
+// If the request was armored the KDC's FAST response is verified and the reply decrypted with the armored request's
+// subkey.
+func (cl *Client) decodeTGSRep(ctx context.Context, tgsReq messages.TGSReq, r []byte, sessionKey types.EncryptionKey, fa *fast.Armor) (messages.TGSRep, error) {
+	var tgsRep messages.TGSRep
+	err := tgsRep.Unmarshal(r)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	if fa != nil {
+		err = fa.Reply(&tgsRep.KDCRepFields)
+		if err != nil {
+			return tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to verify the KDC's FAST response")
+		}
+		var key types.EncryptionKey
+		key, err = fa.ReplyKey(fa.SubKey())
+		if err == nil {
+			err = tgsRep.DecryptEncPartWithSubKey(key)
+		}
+	} else {
+		err = tgsRep.DecryptEncPart(sessionKey)
+	}
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
+	}
+	if ok, err := cl.verifyTGSRep(ctx, &tgsRep, tgsReq); !ok {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: TGS_REP is not valid")
+	}
+	cl.warnWeakETypes(tgsRep.KDCRepFields)
+	return tgsRep, nil
+}
+
+// canonicalize indicates if the request asked the KDC to canonicalize the principal names, RFC 6806 section 3, in
+// which case the client principal name of the reply may be the canonical name of the one requested.
+func canonicalize(body messages.KDCReqBody) bool {
+	return len(body.KDCOptions.Bytes) > flags.Canonicalize/8 && types.IsFlagSet(&body.KDCOptions, flags.Canonicalize)
+}
+
+// verifyTGSRep verifies the TGS_REP taking into account the client's interoperability profile and whether the names
+// were canonicalized. The times of the reply are checked against the clock for the exchange of the context.
+func (cl *Client) verifyTGSRep(ctx context.Context, tgsRep *messages.TGSRep, tgsReq messages.TGSReq) (bool, error) {
+	c := cl.exchangeClock(ctx, tgsReq.ReqBody.Realm)
+	if (cl.settings.InteropProfileForRealm(tgsReq.ReqBody.Realm) != ProfileFreeIPA && !canonicalize(tgsReq.ReqBody)) ||
+		tgsRep.CName.Equal(tgsReq.ReqBody.CName) {
+		return tgsRep.VerifyWithClock(cl.Config, tgsReq, c)
+	}
+	// The TGT was issued to the canonical name of the principal alias the client logged in with.
+	cname := tgsRep.CName
+	tgsRep.CName = tgsReq.ReqBody.CName
+	ok, err := tgsRep.VerifyWithClock(cl.Config, tgsReq, c)
+	tgsRep.CName = cname
+	return ok, err
+}
+
 // GetServiceTicket makes a request to get a service ticket for the SPN specified
 // SPN format: <SERVICE>/<FQDN> Eg. HTTP/www.example.com
 // The ticket will be added to the client's ticket cache
 func (cl *Client) GetServiceTicket(spn string) (messages.Ticket, types.EncryptionKey, error) {
-	var tkt messages.Ticket
-	var skey types.EncryptionKey
-	if tkt, skey, ok := cl.GetCachedTicket(spn); ok {
+	return cl.GetServiceTicketContext(context.Background(), spn)
+}
+
+// GetServiceTicketContext makes a request to get a service ticket for the SPN specified, as GetServiceTicket does.
+// The exchanges with the KDC, including any to obtain or renew the TGT, are abandoned if the context is done before
+// they complete.
+func (cl *Client) GetServiceTicketContext(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, skey, err := cl.getServiceTicket(ctx, spn)
+	return tkt, skey, cl.correlate(err)
+}
+
+func (cl *Client) getServiceTicket(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, skey, ok := cl.GetCachedTicket(spn)
+	cl.recordCacheLookup(spn, ok)
+	if ok {
 		// Already a valid ticket in the cache
 		return tkt, skey, nil
 	}
+	if err := cl.cachedFailure(ctx, spn); err != nil {
+		return tkt, skey, err
+	}
+	princ, realm := cl.servicePrincipal(spn)
+	if r, ok := cl.sessions.referral(spn); ok && r != realm {
+		// The KDC of the realm the service was referred to is asked directly with the client's TGT for that realm,
+		// falling back on the referrals should that fail.
+		tkt, skey, err := cl.realmServiceTicket(ctx, spn, princ, r)
+		if err == nil {
+			return tkt, skey, nil
+		}
+		cl.Log("could not get service ticket for %s from %s, the realm it was referred to: %v", spn, r, err)
+	}
+	tkt, skey, err := cl.realmServiceTicket(ctx, spn, princ, realm)
+	cl.recordOutcome(spn, err)
+	return tkt, skey, err
+}
+
+// servicePrincipal returns the principal name requested for the SPN and the realm of its service.
+func (cl *Client) servicePrincipal(spn string) (types.PrincipalName, string) {
 	princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
-	realm := cl.Config.ResolveRealm(princ.NameString[len(princ.NameString)-1])
+	if cl.Config.LibDefaults.Canonicalize && len(princ.NameString) == 2 {
+		// KDCs refer requests for host-based service names to the realm of the host, RFC 6806 section 8.
+		princ.NameType = nametype.KRB_NT_SRV_HST
+	}
+	return princ, cl.Config.ResolveRealm(princ.NameString[len(princ.NameString)-1])
+}
 
-	tgt, skey, err := cl.sessionTGT(realm)
+// realmServiceTicket requests a service ticket for the SPN from the KDC of the realm. If the request is referred to
+// another realm the client keeps a session for, the realm is recorded so that the next request for the SPN is sent to
+// its KDC directly.
+func (cl *Client) realmServiceTicket(ctx context.Context, spn string, princ types.PrincipalName, realm string) (messages.Ticket, types.EncryptionKey, error) {
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
 	if err != nil {
-		return tkt, skey, err
+		return messages.Ticket{}, types.EncryptionKey{}, err
 	}
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(princ, realm, tgt, skey, false)
+	_, tgsRep, err := cl.TGSREQGenerateAndExchangeContext(ctx, princ, realm, tgt, skey, false)
 	if err != nil {
-		return tkt, skey, err
+		return messages.Ticket{}, types.EncryptionKey{}, err
 	}
+	cl.recordReferral(spn, realm, tgsRep)
+	cl.cacheServiceAlias(spn, princ, realm, tgsRep)
 	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
 }
+
+// recordReferral records the realm the request for the SPN to the KDC of the realm was referred to, if the client
+// keeps a session for it, so that the next request for the SPN is sent to its KDC directly.
+func (cl *Client) recordReferral(spn, realm string, tgsRep messages.TGSRep) {
+	if r := tgsRep.Ticket.Realm; r != realm {
+		if _, ok := cl.sessions.get(r); ok {
+			cl.sessions.referred(spn, r)
+		}
+	}
+}
+
+// cacheServiceAlias caches the ticket received for the SPN requested if it was issued for a different name.
+func (cl *Client) cacheServiceAlias(spn string, princ types.PrincipalName, realm string, tgsRep messages.TGSRep) {
+	if (cl.settings.InteropProfileForRealm(realm) == ProfileFreeIPA || cl.Config.LibDefaults.Canonicalize) &&
+		!tgsRep.Ticket.SName.Equal(princ) {
+		// The ticket was issued for the canonical name of the service alias requested.
+		// Also cache it under the SPN requested so that it is found for subsequent requests.
+		cl.cacheAlias(spn, tgsRep.Ticket.SName.PrincipalNameString())
+	}
+}
+
+// ServiceTicketResult is the outcome of requesting a service ticket for an SPN with GetServiceTickets.
+type ServiceTicketResult struct {
+	Ticket     messages.Ticket
+	SessionKey types.EncryptionKey
+	Err        error
+}
+
+// GetServiceTickets gets service tickets for each of the SPNs specified, for example to warm the client's ticket cache
+// at the start up of a service with many downstream dependencies.
+// Tickets already in the cache are not requested again and duplicate SPNs are requested once. The TGS_REQs for each
+// realm are sent over a single TCP connection to a KDC without waiting for each response. Requests that the KDC does
+// not respond to over that connection, such as once MIT krb5kdc closes it after its first reply, are made individually
+// as GetServiceTicketContext does, as are those of realms whose KDCs have closed such a connection before. Requests
+// for SPNs last referred to another realm and those rejected for clock skew are also made individually.
+// The results are returned keyed by SPN and the tickets are added to the client's ticket cache.
+func (cl *Client) GetServiceTickets(ctx context.Context, spns []string) map[string]ServiceTicketResult {
+	type request struct {
+		spn    string
+		princ  types.PrincipalName
+		tgsReq messages.TGSReq
+		fa     *fast.Armor
+	}
+	results := make(map[string]ServiceTicketResult, len(spns))
+	pending := make(map[string][]request)
+	var realms []string
+	var serial []string // the SPNs requested individually
+	for _, spn := range spns {
+		if _, ok := results[spn]; ok {
+			continue
+		}
+		tkt, skey, ok := cl.GetCachedTicket(spn)
+		cl.recordCacheLookup(spn, ok)
+		if ok {
+			results[spn] = ServiceTicketResult{Ticket: tkt, SessionKey: skey}
+			continue
+		}
+		if err := cl.cachedFailure(ctx, spn); err != nil {
+			results[spn] = ServiceTicketResult{Err: err}
+			continue
+		}
+		// Mark the SPN as seen. The result is set once the ticket has been requested.
+		results[spn] = ServiceTicketResult{}
+		princ, realm := cl.servicePrincipal(spn)
+		if r, ok := cl.sessions.referral(spn); (ok && r != realm) || cl.kdcHealth.serialPreferred(realm) {
+			serial = append(serial, spn)
+			continue
+		}
+		if _, ok := pending[realm]; !ok {
+			realms = append(realms, realm)
+		}
+		pending[realm] = append(pending[realm], request{spn: spn, princ: princ})
+	}
+	for _, realm := range realms {
+		tgt, skey, err := cl.sessionTGT(ctx, realm)
+		if err != nil {
+			for _, r := range pending[realm] {
+				results[r.spn] = ServiceTicketResult{Err: err}
+			}
+			continue
+		}
+		var reqs []request
+		var bs [][]byte
+		for _, r := range pending[realm] {
+			r.tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), realm, cl.Config, tgt, skey, r.princ, false)
+			if err == nil {
+				err = cl.timeTGSReq(&r.tgsReq, tgt, skey)
+			}
+			if err != nil {
+				results[r.spn] = ServiceTicketResult{Err: krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")}
+				continue
+			}
+			var b []byte
+			b, r.fa, err = cl.marshalTGSReq(ctx, &r.tgsReq, tgt, skey)
+			if err != nil {
+				results[r.spn] = ServiceTicketResult{Err: krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal TGS_REQ")}
+				continue
+			}
+			reqs = append(reqs, r)
+			bs = append(bs, b)
+		}
+		if len(reqs) < 1 {
+			continue
+		}
+		rbs, err := cl.sendKDCTCPPipelined(ctx, realm, bs)
+		if err != nil {
+			cl.Log("pipelined TGS exchange with KDC for %s received %d of %d responses: %v", realm, len(rbs), len(bs), err)
+		}
+		for i, r := range reqs {
+			if i >= len(rbs) {
+				if cerr := contextErr(ctx); cerr != nil {
+					results[r.spn] = ServiceTicketResult{Err: krberror.Errorf(cerr, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ to KDC")}
+					continue
+				}
+				serial = append(serial, r.spn)
+				continue
+			}
+			if _, err := checkForKRBError(rbs[i]); err != nil {
+				e := err.(messages.KRBError)
+				if fe, ferr := fastError(r.fa, e); ferr == nil {
+					e = fe
+				}
+				if _, ok := cl.retryForSkew(ctx, realm, e); ok {
+					// The individual request is retried with the client's time corrected.
+					serial = append(serial, r.spn)
+					continue
+				}
+				results[r.spn] = ServiceTicketResult{Err: krberror.Errorf(e, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting for %s", r.tgsReq.ReqBody.SName.PrincipalNameString())}
+				cl.recordOutcome(r.spn, results[r.spn].Err)
+				continue
+			}
+			_, tgsRep, err := cl.processTGSRep(ctx, r.tgsReq, rbs[i], realm, tgt, skey, 0, r.fa)
+			cl.recordOutcome(r.spn, err)
+			if err != nil {
+				results[r.spn] = ServiceTicketResult{Err: err}
+				continue
+			}
+			cl.recordReferral(r.spn, realm, tgsRep)
+			cl.cacheServiceAlias(r.spn, r.princ, realm, tgsRep)
+			results[r.spn] = ServiceTicketResult{Ticket: tgsRep.Ticket, SessionKey: tgsRep.DecryptedEncPart.Key}
+		}
+	}
+	for _, spn := range serial {
+		tkt, key, err := cl.getServiceTicket(ctx, spn)
+		results[spn] = ServiceTicketResult{Ticket: tkt, SessionKey: key, Err: err}
+	}
+	for spn, r := range results {
+		if r.Err != nil {
+			r.Err = cl.correlate(r.Err)
+			results[spn] = r
+		}
+	}
+	return results
+}
@@ -0,0 +1,306 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/jcmturner/gokrb5/v8/warning"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTCPKDC starts a TCP server that replies to the TGS_REQs received on each connection with a TGS_REP encrypted
+// with the session key provided, or a KRB_ERROR for the SPN HTTP/unknown.test.gokrb5. If limit is greater than zero
+// the connection is closed after that many responses. The number of connections accepted is returned.
+func testTCPKDC(t *testing.T, skey types.EncryptionKey, limit int) (net.Listener, *int32) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting TCP server: %v", err)
+	}
+	var conns int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&conns, 1)
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for n := 0; limit < 1 || n < limit; n++ {
+					b, err := readTCPResponse(conn)
+					if err != nil {
+						return
+					}
+					rb, err := testTGSRep(b, skey)
+					if err != nil {
+						t.Errorf("error creating response: %v", err)
+						return
+					}
+					hb := make([]byte, 4)
+					binary.BigEndian.PutUint32(hb, uint32(len(rb)))
+					conn.Write(append(hb, rb...))
+				}
+			}(conn)
+		}
+	}()
+	return l, &conns
+}
+
+func testTGSRep(b []byte, skey types.EncryptionKey) ([]byte, error) {
+	var tgsReq messages.TGSReq
+	err := tgsReq.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	sname := tgsReq.ReqBody.SName
+	if sname.PrincipalNameString() == "HTTP/unknown.test.gokrb5" {
+		krberr := messages.NewKRBError(sname, tgsReq.ReqBody.Realm, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "server not found")
+		return krberr.Marshal()
+	}
+	if sname.PrincipalNameString() == "HTTP/nodelegation.test.gokrb5" {
+		krberr := messages.NewKRBError(sname, tgsReq.ReqBody.Realm, errorcode.KDC_ERR_BADOPTION, "delegation not permitted")
+		return krberr.Marshal()
+	}
+	now := time.Now().UTC()
+	encPart := messages.EncKDCRepPart{
+		Key:       types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)},
+		LastReqs:  []messages.LastReq{},
+		Nonce:     tgsReq.ReqBody.Nonce,
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+		SRealm:    tgsReq.ReqBody.Realm,
+		SName:     sname,
+	}
+	eb, err := encPart.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	ed, err := crypto.GetEncryptedData(eb, skey, keyusage.TGS_REP_ENCPART_SESSION_KEY, 1)
+	if err != nil {
+		return nil, err
+	}
+	tgsRep := messages.TGSRep{
+		KDCRepFields: messages.KDCRepFields{
+			PVNO:    iana.PVNO,
+			MsgType: msgtype.KRB_TGS_REP,
+			CRealm:  tgsReq.ReqBody.Realm,
+			CName:   tgsReq.ReqBody.CName,
+			Ticket: messages.Ticket{
+				TktVNO:  iana.PVNO,
+				Realm:   tgsReq.ReqBody.Realm,
+				SName:   sname,
+				EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte{0}},
+			},
+			EncPart: ed,
+		},
+	}
+	return tgsRep.Marshal()
+}
+
+// testTGSClient returns a client with a TGT session for the realm of the KDC listening on addr.
+func testTGSClient(t *testing.T, addr string, skey types.EncryptionKey, settings ...func(*Settings)) *Client {
+	c, err := config.NewFromString(fmt.Sprintf(`[libdefaults]
+  default_realm = TEST.GOKRB5
+  udp_preference_limit = 1
+
+[realms]
+  TEST.GOKRB5 = {
+    kdc = %s
+  }
+
+[domain_realm]
+  .test.gokrb5 = TEST.GOKRB5
+`, addr))
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, settings...)
+	now := time.Now().UTC()
+	cl.addSession(messages.Ticket{
+		TktVNO:  iana.PVNO,
+		Realm:   "TEST.GOKRB5",
+		SName:   types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte{0}},
+	}, messages.EncKDCRepPart{
+		Key:       skey,
+		AuthTime:  now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+	})
+	return cl
+}
+
+func TestClient_GetServiceTickets(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, conns := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+
+	spns := []string{"HTTP/host1.test.gokrb5", "HTTP/host2.test.gokrb5", "HTTP/unknown.test.gokrb5", "HTTP/host1.test.gokrb5", "HTTP/host3.test.gokrb5"}
+	results := cl.GetServiceTickets(context.Background(), spns)
+	assert.Len(t, results, 4, "duplicate SPNs should be requested once")
+	for _, spn := range []string{"HTTP/host1.test.gokrb5", "HTTP/host2.test.gokrb5", "HTTP/host3.test.gokrb5"} {
+		r := results[spn]
+		if !assert.NoError(t, r.Err, "error getting ticket for %s", spn) {
+			continue
+		}
+		assert.Equal(t, spn, r.Ticket.SName.PrincipalNameString(), "ticket not as expected")
+		_, _, ok := cl.GetCachedTicket(spn)
+		assert.True(t, ok, "ticket for %s not cached", spn)
+	}
+	assert.Error(t, results["HTTP/unknown.test.gokrb5"].Err, "expected error for unknown SPN")
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns), "requests should be sent over one connection")
+	assert.False(t, cl.kdcHealth.serialPreferred("TEST.GOKRB5"), "KDC answering each request should be pipelined to")
+
+	// Cached tickets are not requested again
+	results = cl.GetServiceTickets(context.Background(), []string{"HTTP/host2.test.gokrb5"})
+	assert.NoError(t, results["HTTP/host2.test.gokrb5"].Err, "error getting cached ticket")
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns), "cached ticket should not be requested")
+
+	// Host based service names are requested as GetServiceTicketContext does.
+	cl.Config.LibDefaults.Canonicalize = true
+	results = cl.GetServiceTickets(context.Background(), []string{"HTTP/host4.test.gokrb5", "HTTP/host5.test.gokrb5"})
+	if assert.NoError(t, results["HTTP/host4.test.gokrb5"].Err, "error getting ticket") {
+		assert.Equal(t, int32(nametype.KRB_NT_SRV_HST), results["HTTP/host4.test.gokrb5"].Ticket.SName.NameType,
+			"host based service name should be requested")
+	}
+}
+
+func TestClient_GetServiceTickets_Fallback(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	// The KDC closes the connection after each response
+	kdc, conns := testTCPKDC(t, skey, 1)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+
+	spns := []string{"HTTP/host1.test.gokrb5", "HTTP/host2.test.gokrb5", "HTTP/host3.test.gokrb5"}
+	results := cl.GetServiceTickets(context.Background(), spns)
+	for _, spn := range spns {
+		assert.NoError(t, results[spn].Err, "error getting ticket for %s", spn)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(conns), "unanswered requests should be retried individually")
+	assert.True(t, cl.kdcHealth.serialPreferred("TEST.GOKRB5"), "KDC closing the connection after its first reply should be recorded")
+
+	// Requests to the realm are no longer pipelined.
+	spns = []string{"HTTP/host6.test.gokrb5", "HTTP/host7.test.gokrb5"}
+	results = cl.GetServiceTickets(context.Background(), spns)
+	for _, spn := range spns {
+		assert.NoError(t, results[spn].Err, "error getting ticket for %s", spn)
+	}
+	assert.Equal(t, int32(5), atomic.LoadInt32(conns), "requests should be sent individually")
+
+	// The requests are not retried once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = cl.GetServiceTickets(ctx, []string{"HTTP/host4.test.gokrb5", "HTTP/host5.test.gokrb5"})
+	assert.True(t, errors.Is(results["HTTP/host5.test.gokrb5"].Err, context.Canceled), "error should wrap the context error")
+}
+
+func TestClient_GetServiceTickets_Errors(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+
+	results := cl.GetServiceTickets(context.Background(), []string{"HTTP/unknown.test.gokrb5"})
+	err := results["HTTP/unknown.test.gokrb5"].Err
+	assert.True(t, errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN}), "error should match the KDC error code")
+
+	// A KDC that accepts connections but never replies
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting TCP server: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	cl = testTGSClient(t, l.Addr().String(), skey)
+	defer cl.Destroy()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	results = cl.GetServiceTickets(ctx, []string{"HTTP/host1.test.gokrb5"})
+	assert.True(t, errors.Is(results["HTTP/host1.test.gokrb5"].Err, context.DeadlineExceeded), "error should wrap the context deadline")
+}
+
+func TestClient_PacketDump(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+	var buf bytes.Buffer
+	cl.settings.packetDump = &buf
+
+	_, _, err := cl.GetServiceTicket("HTTP/host1.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	_, _, err = cl.WithCorrelationID("attempt-1").GetServiceTicket("HTTP/unknown.test.gokrb5")
+	assert.Error(t, err, "expected error for unknown SPN")
+	d := buf.String()
+	assert.Contains(t, d, "--> sent to KDC for TEST.GOKRB5 over TCP", "sent message not dumped")
+	assert.Contains(t, d, "TGS-REQ cname=testuser1 realm=TEST.GOKRB5 sname=HTTP/host1.test.gokrb5", "summary of sent message not as expected")
+	assert.Contains(t, d, "<-- received from KDC for TEST.GOKRB5 over TCP", "received message not dumped")
+	assert.Contains(t, d, "TGS-REP cname=testuser1 crealm=TEST.GOKRB5 sname=HTTP/host1.test.gokrb5", "summary of received message not as expected")
+	assert.Contains(t, d, "[Correlation ID: attempt-1] <-- received from KDC for TEST.GOKRB5 over TCP", "correlation ID not in dump")
+	assert.Contains(t, d, "KRB-ERROR (7) KDC_ERR_S_PRINCIPAL_UNKNOWN", "summary of KRB_ERROR not as expected")
+	assert.Contains(t, d, "base64: ", "base64 encoding not dumped")
+}
+
+func TestClient_WarningHook(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.RC4_HMAC, KeyValue: []byte("0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	var ws []warning.Warning
+	cl.settings.warningHook = func(w warning.Warning) {
+		ws = append(ws, w)
+	}
+	cl = cl.WithCorrelationID("warn-test")
+	_, _, err := cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	if assert.Len(t, ws, 1, "number of warnings not as expected") {
+		assert.Equal(t, warning.WeakEType, ws[0].Code, "warning code not as expected")
+		assert.Equal(t, "testuser1", ws[0].Principal, "warning principal not as expected")
+		assert.Equal(t, "TEST.GOKRB5", ws[0].Realm, "warning realm not as expected")
+		assert.Equal(t, "reply for HTTP/host.test.gokrb5 uses deprecated encryption type arcfour-hmac", ws[0].Message, "warning message not as expected")
+		assert.Equal(t, "warn-test", ws[0].CorrelationID, "warning correlation ID not as expected")
+	}
+}
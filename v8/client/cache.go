@@ -3,20 +3,45 @@ package client
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
 
-// Cache for service tickets held by the client.
+// Cache for service tickets held by the client. It is the default TicketStore of a client.
+//
+// The Entries map is copied on write so that tickets can be looked up without taking a lock. Entries must only be
+// modified through the methods of the Cache.
+// Entries are keyed on the SPN string so that looking up a ticket does not need to construct a key or allocate.
+//
+// Entries for tickets that have expired and can no longer be renewed are swept from the cache as tickets are obtained,
+// at most once every cacheSweepInterval. The number of entries can also be bounded with the CacheMaxEntries setting,
+// in which case the least recently used entries are evicted.
+//
+// The session keys of entries swept, evicted or removed, and of all the entries when the client is destroyed or closed,
+// are zeroed so that they do not remain in memory. A session key obtained from the cache must not be used once its
+// entry has been removed.
 type Cache struct {
-	Entries map[string]CacheEntry
-	mux     sync.RWMutex
+	Entries   map[string]CacheEntry
+	snapshot  atomic.Value // map[string]CacheEntry
+	mux       sync.Mutex
+	lastSweep time.Time   // when expired entries were last swept
+	clock     clock.Clock // the clock imported entries are checked against, that of the first client using the cache
 }
 
+// cacheSweepInterval is the least time between the sweeps of expired entries from the cache.
+const cacheSweepInterval = time.Minute
+
 // CacheEntry holds details for a cache entry.
 type CacheEntry struct {
 	SPN        string
@@ -26,36 +51,144 @@ type CacheEntry struct {
 	EndTime    time.Time
 	RenewTill  time.Time
 	SessionKey types.EncryptionKey `json:"-"`
+	// Flags are the ticket flags from the encrypted part of the KDC's reply, such as ok-as-delegate.
+	Flags asn1.BitString `json:"-"`
+	used  *int64         // when the entry was last used in Unix nanoseconds, accessed atomically
+}
+
+// HasFlag indicates if the ticket flag, one of the iana/flags constants, is set on the ticket.
+func (e CacheEntry) HasFlag(flag int) bool {
+	return types.IsFlagSet(&e.Flags, flag)
+}
+
+// OKAsDelegate indicates if the KDC's policy trusts the service the ticket is for to be delegated credentials to,
+// RFC 4120 section 2.8.
+func (e CacheEntry) OKAsDelegate() bool {
+	return e.HasFlag(flags.OKAsDelegate)
+}
+
+// FlagNames returns the names of the ticket flags set, such as "forwardable" and "ok-as-delegate".
+func (e CacheEntry) FlagNames() []string {
+	return ticketFlagNames(e.Flags)
+}
+
+// TicketEType returns the encryption type of the ticket's encrypted part.
+func (e CacheEntry) TicketEType() int32 {
+	return e.Ticket.EncPart.EType
+}
+
+// SessionKeyEType returns the encryption type of the ticket's session key.
+func (e CacheEntry) SessionKeyEType() int32 {
+	return e.SessionKey.KeyType
+}
+
+// MarshalJSON marshals the entry with the names of its flags and encryption types and the kvno of its ticket. The
+// ticket and session key are not included.
+func (e CacheEntry) MarshalJSON() ([]byte, error) {
+	// entry has the fields of a CacheEntry without its methods, so that it is marshaled by default.
+	type entry CacheEntry
+	js := struct {
+		entry
+		Flags           []string `json:",omitempty"`
+		TicketEType     string   `json:",omitempty"`
+		SessionKeyEType string   `json:",omitempty"`
+		KVNO            int      `json:",omitempty"`
+	}{
+		entry: entry(e),
+		Flags: e.FlagNames(),
+		KVNO:  e.Ticket.EncPart.KVNO,
+	}
+	if et := e.TicketEType(); et != 0 {
+		js.TicketEType = etypeID.Name(et)
+	}
+	if et := e.SessionKeyEType(); et != 0 {
+		js.SessionKeyEType = etypeID.Name(et)
+	}
+	return json.Marshal(js)
+}
+
+// String returns a description of the CacheEntry with the session key redacted so that it can be logged safely.
+func (e CacheEntry) String() string {
+	return e.format(e.SessionKey.String())
+}
+
+// DebugDump returns a description of the CacheEntry including the session key if the types.DebugDumpEnvVar
+// environment variable is set to "1". Otherwise the session key is redacted as for String.
+func (e CacheEntry) DebugDump() string {
+	return e.format(e.SessionKey.DebugDump())
+}
+
+func (e CacheEntry) format(key string) string {
+	return fmt.Sprintf("{SPN: %s AuthTime: %v StartTime: %v EndTime: %v RenewTill: %v SessionKey: %s}",
+		e.SPN, e.AuthTime, e.StartTime, e.EndTime, e.RenewTill, key)
 }
 
 // NewCache creates a new client ticket cache instance.
 func NewCache() *Cache {
-	return &Cache{
+	c := &Cache{
 		Entries: map[string]CacheEntry{},
 	}
+	c.snapshot.Store(c.Entries)
+	return c
+}
+
+// all returns a snapshot of the cache entries keyed on SPN. The map returned must not be modified.
+func (c *Cache) all() map[string]CacheEntry {
+	if m, ok := c.snapshot.Load().(map[string]CacheEntry); ok {
+		return m
+	}
+	// The cache was not created with NewCache
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	m := c.copyEntries()
+	c.snapshot.Store(m)
+	return m
+}
+
+// copyEntries returns a copy of the entries. The caller must hold the lock.
+func (c *Cache) copyEntries() map[string]CacheEntry {
+	m := make(map[string]CacheEntry, len(c.Entries)+1)
+	for k, e := range c.Entries {
+		m[k] = e
+	}
+	return m
+}
+
+// store replaces the entries with the map provided. The caller must hold the lock.
+func (c *Cache) store(m map[string]CacheEntry) {
+	c.Entries = m
+	c.snapshot.Store(m)
 }
 
 // getEntry returns a cache entry that matches the SPN.
 func (c *Cache) getEntry(spn string) (CacheEntry, bool) {
-	c.mux.RLock()
-	defer c.mux.RUnlock()
-	e, ok := (*c).Entries[spn]
+	e, ok := c.all()[spn]
 	return e, ok
 }
 
-// JSON returns information about the cached service tickets in a JSON format.
-func (c *Cache) JSON() (string, error) {
-	c.mux.RLock()
-	defer c.mux.RUnlock()
+// sorted returns the cache entries sorted by SPN.
+func (c *Cache) sorted() []CacheEntry {
+	entries := c.all()
 	var es []CacheEntry
-	keys := make([]string, 0, len(c.Entries))
-	for k := range c.Entries {
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
 	for _, k := range keys {
-		es = append(es, c.Entries[k])
+		es = append(es, entries[k])
 	}
+	return es
+}
+
+// JSON returns information about the cached service tickets in a JSON format. The tickets and session keys are not
+// included, Export serializes the entries with them.
+func (c *Cache) JSON() (string, error) {
+	return entriesJSON(c.sorted())
+}
+
+// entriesJSON returns information about the cache entries in a JSON format.
+func entriesJSON(es []CacheEntry) (string, error) {
 	b, err := json.MarshalIndent(&es, "", "  ")
 	if err != nil {
 		return "", err
@@ -63,12 +196,103 @@ func (c *Cache) JSON() (string, error) {
 	return string(b), nil
 }
 
-// addEntry adds a ticket to the cache.
-func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey) CacheEntry {
-	spn := tkt.SName.PrincipalNameString()
+// Export returns the cache entries, including their tickets and session keys, encrypted with the key so that they
+// can be saved and restored with Import, for example across restarts of a process. The entries are encoded as a
+// KRB_CRED with the credential information of each entry recorded against its SPN.
+func (c *Cache) Export(key types.EncryptionKey) ([]byte, error) {
+	if key.KeyType == 0 {
+		return nil, krberror.WithKind(errors.New("a key is required to export the cache"), krberror.KindConfig)
+	}
+	es := c.sorted()
+	tkts := make([]messages.Ticket, 0, len(es))
+	info := make([]messages.KrbCredInfo, 0, len(es))
+	for _, e := range es {
+		tkts = append(tkts, e.Ticket)
+		info = append(info, messages.KrbCredInfo{
+			Key:       e.SessionKey,
+			Flags:     e.Flags,
+			AuthTime:  e.AuthTime,
+			StartTime: e.StartTime,
+			EndTime:   e.EndTime,
+			RenewTill: e.RenewTill,
+			SRealm:    e.Ticket.Realm,
+			SName:     types.NewPrincipalName(e.Ticket.SName.NameType, e.SPN),
+		})
+	}
+	k := messages.NewKRBCred(tkts, info)
+	if err := k.EncryptEncPart(key); err != nil {
+		return nil, err
+	}
+	return k.Marshal()
+}
+
+// Import adds the cache entries exported with Export to the cache. The key must be the one the entries were exported
+// with. Entries for tickets that have expired and can no longer be renewed at the time of the clock of the client
+// using the cache, or of the system clock if no client uses it yet, are not imported, nor are entries for which the
+// cache already holds a ticket that is valid for as long.
+func (c *Cache) Import(b []byte, key types.EncryptionKey) error {
+	if key.KeyType == 0 {
+		return krberror.WithKind(errors.New("a key is required to import the cache"), krberror.KindConfig)
+	}
+	var k messages.KRBCred
+	if err := k.Unmarshal(b); err != nil {
+		return err
+	}
+	if k.EncPart.EType == 0 {
+		return krberror.New(krberror.KRBMsgError, "exported cache is not encrypted")
+	}
+	if err := k.DecryptEncPart(key); err != nil {
+		return err
+	}
+	if len(k.Tickets) != len(k.DecryptedEncPart.TicketInfo) {
+		return krberror.New(krberror.KRBMsgError, "exported cache does not hold credential information for each of its tickets")
+	}
+	now := c.now()
+	for i, tkt := range k.Tickets {
+		info := k.DecryptedEncPart.TicketInfo[i]
+		if !now.Before(info.EndTime) && !now.Before(info.RenewTill) {
+			continue
+		}
+		spn := info.SName.PrincipalNameString()
+		if e, ok := c.getEntry(spn); ok && !e.EndTime.Before(info.EndTime) {
+			continue
+		}
+		c.put(CacheEntry{
+			SPN:        spn,
+			Ticket:     tkt,
+			AuthTime:   info.AuthTime,
+			StartTime:  info.StartTime,
+			EndTime:    info.EndTime,
+			RenewTill:  info.RenewTill,
+			SessionKey: info.Key,
+			Flags:      info.Flags,
+		})
+	}
+	return nil
+}
+
+// useClock sets the clock the cache checks imported entries against, unless it already uses one. A client uses its
+// own clock for its cache and for a Cache configured as its TicketStore.
+func (c *Cache) useClock(clk clock.Clock) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	(*c).Entries[spn] = CacheEntry{
+	if c.clock == nil {
+		c.clock = clk
+	}
+}
+
+// now returns the time of the cache's clock.
+func (c *Cache) now() time.Time {
+	c.mux.Lock()
+	clk := c.clock
+	c.mux.Unlock()
+	return clock.OrReal(clk).Now().UTC()
+}
+
+// addEntry adds a ticket to the cache.
+func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey, flags asn1.BitString) CacheEntry {
+	spn := tkt.SName.PrincipalNameString()
+	e := CacheEntry{
 		SPN:        spn,
 		Ticket:     tkt,
 		AuthTime:   authTime,
@@ -76,45 +300,171 @@ func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, rene
 		EndTime:    endTime,
 		RenewTill:  renewTill,
 		SessionKey: sessionKey,
+		Flags:      flags,
+	}
+	return c.put(e)
+}
+
+// put adds the entry to the cache for its SPN and returns it as stored.
+func (c *Cache) put(e CacheEntry) CacheEntry {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if old, ok := c.Entries[e.SPN]; ok && old.used != nil {
+		// A renewed or replaced ticket keeps the last use of the entry.
+		e.used = old.used
+	} else {
+		e.used = newUse()
+	}
+	m := c.copyEntries()
+	m[e.SPN] = e
+	c.store(m)
+	return e
+}
+
+// addAlias adds an entry for the alias SPN that is a copy of the entry for the SPN, if there is one.
+func (c *Cache) addAlias(alias, spn string) {
+	if e, ok := c.getEntry(spn); ok {
+		e.SPN = alias
+		c.put(e)
+	}
+}
+
+// newUse returns the last use of a new entry, which is now.
+func newUse() *int64 {
+	u := time.Now().UnixNano()
+	return &u
+}
+
+// touch records the use of the entry for the least recently used eviction.
+func (e CacheEntry) touch() {
+	if e.used != nil {
+		atomic.StoreInt64(e.used, time.Now().UnixNano())
+	}
+}
+
+// lastUsed returns when the entry was last used in Unix nanoseconds.
+func (e CacheEntry) lastUsed() int64 {
+	if e.used == nil {
+		return 0
+	}
+	return atomic.LoadInt64(e.used)
+}
+
+// sweep removes the entries of tickets that have expired and can no longer be renewed, at most once every
+// cacheSweepInterval, and then, if there are more than max entries, the least recently used entries until there are
+// max. If max is zero or less the number of entries is not bounded. The SPNs of the entries removed are returned.
+func (c *Cache) sweep(now time.Time, max int) []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	expired := now.Sub(c.lastSweep) >= cacheSweepInterval
+	full := max > 0 && len(c.Entries) > max
+	if !expired && !full {
+		return nil
+	}
+	m := c.copyEntries()
+	var removed []string
+	if expired {
+		c.lastSweep = now
+		for spn, e := range m {
+			if !now.Before(e.EndTime) && !now.Before(e.RenewTill) {
+				delete(m, spn)
+				removed = append(removed, spn)
+			}
+		}
+	}
+	if max > 0 && len(m) > max {
+		es := make([]CacheEntry, 0, len(m))
+		for _, e := range m {
+			es = append(es, e)
+		}
+		sort.Slice(es, func(i, j int) bool {
+			return es[i].lastUsed() < es[j].lastUsed()
+		})
+		for _, e := range es[:len(es)-max] {
+			delete(m, e.SPN)
+			removed = append(removed, e.SPN)
+		}
 	}
-	return c.Entries[spn]
+	if len(removed) > 0 {
+		zeroRemoved(c.Entries, m)
+		c.store(m)
+	}
+	return removed
 }
 
-// clear deletes all the cache entries
+// clear deletes all the cache entries, zeroing their session keys.
 func (c *Cache) clear() {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	for k := range c.Entries {
-		delete(c.Entries, k)
+	for _, e := range c.Entries {
+		e.SessionKey.Zero()
 	}
+	c.store(map[string]CacheEntry{})
 }
 
-// RemoveEntry removes the cache entry for the defined SPN.
+// RemoveEntry removes the cache entry for the defined SPN, zeroing its session key unless it is shared with the entry
+// of an alias of the SPN.
 func (c *Cache) RemoveEntry(spn string) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	delete(c.Entries, spn)
+	if _, ok := c.Entries[spn]; ok {
+		m := c.copyEntries()
+		delete(m, spn)
+		zeroRemoved(c.Entries, m)
+		c.store(m)
+	}
+}
+
+// zeroRemoved zeroes the session keys of the entries that are not in the remaining entries, other than those shared
+// with a remaining entry such as that of an alias.
+func zeroRemoved(entries, remaining map[string]CacheEntry) {
+	for spn, e := range entries {
+		if _, ok := remaining[spn]; ok || len(e.SessionKey.KeyValue) < 1 {
+			continue
+		}
+		shared := false
+		for _, r := range remaining {
+			if len(r.SessionKey.KeyValue) > 0 && &r.SessionKey.KeyValue[0] == &e.SessionKey.KeyValue[0] {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			e.SessionKey.Zero()
+		}
+	}
 }
 
 // GetCachedTicket returns a ticket from the cache for the SPN.
 // Only a ticket that is currently valid will be returned.
 func (cl *Client) GetCachedTicket(spn string) (messages.Ticket, types.EncryptionKey, bool) {
-	if e, ok := cl.cache.getEntry(spn); ok {
+	e, ok := cl.GetCachedEntry(spn)
+	return e.Ticket, e.SessionKey, ok
+}
+
+// GetCachedEntry returns the cache entry of a ticket for the SPN, with the ticket's flags, such as ok-as-delegate, and
+// times, as GetCachedTicket returns its ticket. Only a ticket that is currently valid will be returned.
+func (cl *Client) GetCachedEntry(spn string) (CacheEntry, bool) {
+	if e, ok := cl.cachedEntry(spn); ok {
 		//If within time window of ticket return it
-		if time.Now().UTC().After(e.StartTime) && time.Now().UTC().Before(e.EndTime) {
+		if cl.now().After(e.StartTime) && cl.now().Before(e.EndTime) {
 			cl.Log("ticket received from cache for %s", spn)
-			return e.Ticket, e.SessionKey, true
-		} else if time.Now().UTC().Before(e.RenewTill) {
+			if cl.settings.CacheMaxEntries() > 0 {
+				e.touch()
+			}
+			return e, true
+		} else if cl.now().Before(e.RenewTill) {
 			e, err := cl.renewTicket(e)
 			if err != nil {
-				return e.Ticket, e.SessionKey, false
+				return CacheEntry{}, false
 			}
-			return e.Ticket, e.SessionKey, true
+			if cl.settings.CacheMaxEntries() > 0 {
+				e.touch()
+			}
+			return e, true
 		}
 	}
-	var tkt messages.Ticket
-	var key types.EncryptionKey
-	return tkt, key, false
+	return CacheEntry{}, false
 }
 
 // renewTicket renews a cache entry ticket.
@@ -125,10 +475,23 @@ func (cl *Client) renewTicket(e CacheEntry) (CacheEntry, error) {
 	if err != nil {
 		return e, err
 	}
-	e, ok := cl.cache.getEntry(e.Ticket.SName.PrincipalNameString())
+	e, ok := cl.cachedEntry(e.Ticket.SName.PrincipalNameString())
 	if !ok {
 		return e, errors.New("ticket was not added to cache")
 	}
 	cl.Log("ticket renewed for %s (EndTime: %v)", spn.PrincipalNameString(), e.EndTime)
 	return e, nil
 }
+
+// sweepCache removes stale entries from the service ticket cache: expired tickets that can no longer be renewed and,
+// if the CacheMaxEntries setting bounds the cache, the least recently used tickets beyond the bound. A TicketStore
+// other than a Cache is responsible for removing its own entries.
+func (cl *Client) sweepCache() {
+	c, ok := cl.tickets().(*Cache)
+	if !ok {
+		return
+	}
+	for _, spn := range c.sweep(cl.now(), cl.settings.CacheMaxEntries()) {
+		cl.Log("ticket for %s removed from cache", spn)
+	}
+}
@@ -1,11 +1,20 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/common"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
@@ -29,7 +38,7 @@ func TestCache_addEntry_getEntry_remove_clear(t *testing.T) {
 			KeyValue: []byte{byte(i)},
 		}
 		go func(i int) {
-			e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key)
+			e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key, types.NewKrbFlags())
 			assert.Equal(t, fmt.Sprintf("%d/test.cache", i), e.SPN, "SPN cache key not as expected")
 			wg.Done()
 		}(i)
@@ -112,7 +121,7 @@ func TestCache_JSON(t *testing.T) {
 			KeyType:  1,
 			KeyValue: []byte{byte(i)},
 		}
-		e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key)
+		e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key, types.NewKrbFlags())
 		assert.Equal(t, fmt.Sprintf("%d/test.cache", i), e.SPN, "SPN cache key not as expected")
 	}
 	expected := `[
@@ -121,21 +130,24 @@ func TestCache_JSON(t *testing.T) {
     "AuthTime": "1970-01-01T00:00:00Z",
     "StartTime": "1970-01-01T00:00:10Z",
     "EndTime": "1970-01-01T00:00:20Z",
-    "RenewTill": "1970-01-01T00:00:30Z"
+    "RenewTill": "1970-01-01T00:00:30Z",
+    "SessionKeyEType": "des-cbc-crc"
   },
   {
     "SPN": "1/test.cache",
     "AuthTime": "1970-01-01T00:00:01Z",
     "StartTime": "1970-01-01T00:00:11Z",
     "EndTime": "1970-01-01T00:00:21Z",
-    "RenewTill": "1970-01-01T00:00:31Z"
+    "RenewTill": "1970-01-01T00:00:31Z",
+    "SessionKeyEType": "des-cbc-crc"
   },
   {
     "SPN": "2/test.cache",
     "AuthTime": "1970-01-01T00:00:02Z",
     "StartTime": "1970-01-01T00:00:12Z",
     "EndTime": "1970-01-01T00:00:22Z",
-    "RenewTill": "1970-01-01T00:00:32Z"
+    "RenewTill": "1970-01-01T00:00:32Z",
+    "SessionKeyEType": "des-cbc-crc"
   }
 ]`
 	j, err := c.JSON()
@@ -144,3 +156,353 @@ func TestCache_JSON(t *testing.T) {
 	}
 	assert.Equal(t, expected, j, "json output not as expected")
 }
+
+func TestCache_addAlias(t *testing.T) {
+	t.Parallel()
+	c := NewCache()
+	tkt := messages.Ticket{
+		SName: types.PrincipalName{
+			NameType:   1,
+			NameString: []string{"HTTP", "canonical.test.cache"},
+		},
+	}
+	key := types.EncryptionKey{
+		KeyType:  1,
+		KeyValue: []byte{1},
+	}
+	c.addEntry(tkt, time.Unix(0, 0).UTC(), time.Unix(10, 0).UTC(), time.Unix(20, 0).UTC(), time.Unix(30, 0).UTC(), key, types.NewKrbFlags())
+	c.addAlias("HTTP/alias.test.cache", "HTTP/canonical.test.cache")
+	e, ok := c.getEntry("HTTP/alias.test.cache")
+	assert.True(t, ok, "alias entry was not found")
+	assert.Equal(t, "HTTP/alias.test.cache", e.SPN, "SPN of alias entry not as expected")
+	assert.Equal(t, tkt.SName, e.Ticket.SName, "ticket of alias entry not as expected")
+	c.addAlias("HTTP/other.test.cache", "HTTP/missing.test.cache")
+	_, ok = c.getEntry("HTTP/other.test.cache")
+	assert.False(t, ok, "alias entry should not be added when there is no entry for the SPN")
+}
+
+func BenchmarkCache_getEntry(b *testing.B) {
+	c := NewCache()
+	for i := 0; i < 100; i++ {
+		tkt := messages.Ticket{
+			SName: types.PrincipalName{
+				NameType:   1,
+				NameString: []string{fmt.Sprintf("%d", i), "test.cache"},
+			},
+		}
+		c.addEntry(tkt, time.Now().UTC(), time.Now().UTC(), time.Now().UTC().Add(time.Hour), time.Now().UTC().Add(time.Hour), types.EncryptionKey{}, types.NewKrbFlags())
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, ok := c.getEntry("50/test.cache"); !ok {
+				b.Fatal("entry not found")
+			}
+		}
+	})
+}
+
+func TestCache_getEntry_Allocs(t *testing.T) {
+	c := NewCache()
+	tkt := messages.Ticket{
+		SName: types.PrincipalName{
+			NameType:   1,
+			NameString: []string{"HTTP", "host.test.cache"},
+		},
+	}
+	c.addEntry(tkt, time.Now().UTC(), time.Now().UTC(), time.Now().UTC().Add(time.Hour), time.Now().UTC().Add(time.Hour), types.EncryptionKey{}, types.NewKrbFlags())
+	a := testing.AllocsPerRun(100, func() {
+		c.getEntry("HTTP/host.test.cache")
+	})
+	assert.Equal(t, float64(0), a, "cache lookup should not allocate")
+}
+
+func TestCacheEntry_String(t *testing.T) {
+	key := types.EncryptionKey{KeyType: 18, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	tkt := messages.Ticket{}
+	tkt.DecryptedEncPart.Key = key
+	e := CacheEntry{SPN: "HTTP/host.test.gokrb5", Ticket: tkt, SessionKey: key}
+	hexKey := fmt.Sprintf("%x", key.KeyValue)
+	for _, f := range []string{"%v", "%+v", "%#v"} {
+		s := fmt.Sprintf(f, e)
+		assert.NotContains(t, s, "0123456789abcdef", "session key in %s output", f)
+		assert.NotContains(t, s, hexKey, "session key in %s output", f)
+	}
+	assert.Contains(t, e.String(), "HTTP/host.test.gokrb5", "SPN not in output")
+
+	os.Unsetenv(types.DebugDumpEnvVar)
+	assert.Equal(t, e.String(), e.DebugDump(), "session key should be redacted unless enabled")
+	os.Setenv(types.DebugDumpEnvVar, "1")
+	defer os.Unsetenv(types.DebugDumpEnvVar)
+	assert.Contains(t, e.DebugDump(), hexKey, "session key not in debug dump")
+}
+
+func TestClient_GetCachedEntry(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New())
+	now := time.Now().UTC()
+	f := types.NewKrbFlags()
+	types.SetFlags(&f, []int{flags.Forwardable, flags.OKAsDelegate})
+	tkt := messages.Ticket{SName: types.NewPrincipalName(2, "HTTP/host.test.gokrb5"), EncPart: types.EncryptedData{EType: etypeID.AES128_CTS_HMAC_SHA1_96, KVNO: 3}}
+	cl.cache.addEntry(tkt, now, now, now.Add(time.Hour), now.Add(time.Hour), types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte{1}}, f)
+
+	e, ok := cl.GetCachedEntry("HTTP/host.test.gokrb5")
+	if !assert.True(t, ok, "entry should be returned from the cache") {
+		return
+	}
+	assert.True(t, e.OKAsDelegate(), "ticket should be ok-as-delegate")
+	assert.True(t, e.HasFlag(flags.Forwardable), "ticket should be forwardable")
+	assert.False(t, e.HasFlag(flags.Renewable), "ticket should not be renewable")
+	assert.Equal(t, []string{"forwardable", "ok-as-delegate"}, e.FlagNames(), "flag names not as expected")
+	assert.Equal(t, etypeID.AES128_CTS_HMAC_SHA1_96, e.TicketEType(), "ticket etype not as expected")
+	assert.Equal(t, etypeID.AES256_CTS_HMAC_SHA1_96, e.SessionKeyEType(), "session key etype not as expected")
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("error marshaling entry: %v", err)
+	}
+	assert.Contains(t, string(b), `"Flags":["forwardable","ok-as-delegate"],"TicketEType":"aes128-cts-hmac-sha1-96","SessionKeyEType":"aes256-cts-hmac-sha1-96","KVNO":3`, "JSON not as expected")
+	assert.NotContains(t, string(b), "KeyValue", "JSON should not include the session key")
+
+	_, ok = cl.GetCachedEntry("HTTP/unknown.test.gokrb5")
+	assert.False(t, ok, "entry should not be returned for an SPN not cached")
+}
+
+func TestClient_GetCachedTicket_Clock(t *testing.T) {
+	t.Parallel()
+	st := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(st.Add(time.Minute))
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), Clock(c))
+	tkt := messages.Ticket{SName: types.NewPrincipalName(2, "HTTP/host.test.gokrb5")}
+	cl.cache.addEntry(tkt, st, st, st.Add(time.Hour), st.Add(time.Hour), types.EncryptionKey{KeyType: 18, KeyValue: []byte{1}}, types.NewKrbFlags())
+	_, _, ok := cl.GetCachedTicket("HTTP/host.test.gokrb5")
+	assert.True(t, ok, "ticket should be returned from the cache while valid")
+	c.Advance(2 * time.Hour)
+	_, _, ok = cl.GetCachedTicket("HTTP/host.test.gokrb5")
+	assert.False(t, ok, "expired ticket should not be returned from the cache")
+}
+
+func TestCache_sweep(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCache()
+	add := func(spn string, end, renewTill time.Time, used int64) {
+		tkt := messages.Ticket{SName: types.NewPrincipalName(2, spn)}
+		e := c.addEntry(tkt, now.Add(-time.Hour), now.Add(-time.Hour), end, renewTill, types.EncryptionKey{}, types.NewKrbFlags())
+		*e.used = used
+	}
+	add("HTTP/expired.test.gokrb5", now, now, 1)
+	add("HTTP/renewable.test.gokrb5", now.Add(-time.Minute), now.Add(time.Hour), 2)
+	add("HTTP/host1.test.gokrb5", now.Add(time.Hour), now.Add(time.Hour), 3)
+	add("HTTP/host2.test.gokrb5", now.Add(time.Hour), now.Add(time.Hour), 4)
+
+	assert.Equal(t, []string{"HTTP/expired.test.gokrb5"}, c.sweep(now, 0), "expired entries not removed")
+	_, ok := c.getEntry("HTTP/renewable.test.gokrb5")
+	assert.True(t, ok, "expired entry that can be renewed should not be removed")
+
+	add("HTTP/expired.test.gokrb5", now, now, 1)
+	assert.Nil(t, c.sweep(now.Add(time.Second), 0), "expired entries should not be swept again within the interval")
+	assert.Nil(t, c.sweep(now.Add(time.Second), 4), "entries should not be removed within the bound")
+	_, ok = c.getEntry("HTTP/expired.test.gokrb5")
+	assert.True(t, ok, "expired entry should not be removed within the interval")
+
+	// Over the bound the least recently used entries are removed whether or not they have expired.
+	e, _ := c.getEntry("HTTP/renewable.test.gokrb5")
+	*e.used = 5
+	removed := c.sweep(now.Add(time.Second), 2)
+	assert.ElementsMatch(t, []string{"HTTP/expired.test.gokrb5", "HTTP/host1.test.gokrb5"}, removed, "least recently used entries not removed")
+	assert.Len(t, c.all(), 2, "number of entries not as expected")
+
+	// A replaced entry keeps its last use.
+	tkt := messages.Ticket{SName: types.NewPrincipalName(2, "HTTP/host2.test.gokrb5")}
+	e = c.addEntry(tkt, now, now, now.Add(2*time.Hour), now.Add(2*time.Hour), types.EncryptionKey{}, types.NewKrbFlags())
+	assert.Equal(t, int64(4), e.lastUsed(), "last use of the replaced entry not as expected")
+}
+
+func TestCache_ZeroSessionKeys(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCache()
+	add := func(spn string, end time.Time) types.EncryptionKey {
+		tkt := messages.Ticket{SName: types.NewPrincipalName(2, spn)}
+		key := types.EncryptionKey{KeyType: 18, KeyValue: []byte{1, 2, 3, 4}}
+		c.addEntry(tkt, now.Add(-time.Hour), now.Add(-time.Hour), end, end, key, types.NewKrbFlags())
+		return key
+	}
+	zeroed := []byte{0, 0, 0, 0}
+	canonical := add("HTTP/canonical.test.gokrb5", now.Add(time.Hour))
+	c.addAlias("HTTP/alias.test.gokrb5", "HTTP/canonical.test.gokrb5")
+	c.RemoveEntry("HTTP/canonical.test.gokrb5")
+	assert.NotEqual(t, zeroed, canonical.KeyValue, "session key shared with an alias entry should not be zeroed")
+	c.RemoveEntry("HTTP/alias.test.gokrb5")
+	assert.Equal(t, zeroed, canonical.KeyValue, "session key of removed entry not zeroed")
+
+	expired := add("HTTP/expired.test.gokrb5", now)
+	valid := add("HTTP/valid.test.gokrb5", now.Add(time.Hour))
+	c.sweep(now, 0)
+	assert.Equal(t, zeroed, expired.KeyValue, "session key of swept entry not zeroed")
+	assert.NotEqual(t, zeroed, valid.KeyValue, "session key of remaining entry should not be zeroed")
+
+	evicted := add("HTTP/evicted.test.gokrb5", now.Add(time.Hour))
+	e, _ := c.getEntry("HTTP/valid.test.gokrb5")
+	*e.used = time.Now().Add(time.Hour).UnixNano()
+	c.sweep(now, 1)
+	assert.Equal(t, zeroed, evicted.KeyValue, "session key of evicted entry not zeroed")
+
+	c.clear()
+	assert.Equal(t, zeroed, valid.KeyValue, "session key of cleared entry not zeroed")
+}
+
+func TestCache_KeyHandedOutBeforeEviction(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), CacheMaxEntries(1))
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	skey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	value := append([]byte(nil), skey.KeyValue...)
+	tkt := messages.Ticket{SName: types.NewPrincipalName(2, "HTTP/host1.test.gokrb5")}
+	cl.cacheTicket(tkt, now, now.Add(-time.Minute), now.Add(time.Hour), now.Add(time.Hour), skey, types.NewKrbFlags())
+	_, key, ok := cl.GetCachedTicket("HTTP/host1.test.gokrb5")
+	if !ok {
+		t.Fatal("ticket not found in cache")
+	}
+	// Use the key, as a security context would, so that its derived keys are cached.
+	ed, err := crypto.GetEncryptedData([]byte("data"), key, keyusage.GSSAPI_INITIATOR_SEAL, 0)
+	if err != nil {
+		t.Fatalf("error encrypting with session key: %v", err)
+	}
+	held := cl.cache.all()["HTTP/host1.test.gokrb5"].SessionKey
+
+	// The entry is evicted, zeroing the cache's copy of the key and its derived keys.
+	tkt = messages.Ticket{SName: types.NewPrincipalName(2, "HTTP/host2.test.gokrb5")}
+	cl.cacheTicket(tkt, now, now.Add(-time.Minute), now.Add(time.Hour), now.Add(time.Hour), types.EncryptionKey{KeyType: 18, KeyValue: []byte{1}}, types.NewKrbFlags())
+	cl.cache.sweep(now, 1)
+	_, ok = cl.cache.getEntry("HTTP/host1.test.gokrb5")
+	assert.False(t, ok, "entry should be evicted")
+	assert.Equal(t, make([]byte, len(held.KeyValue)), held.KeyValue, "cache's session key should be zeroed")
+	_, ok = common.GetDerivedKey(key.KeyType, value, common.GetUsageKe(keyusage.GSSAPI_INITIATOR_SEAL))
+	assert.False(t, ok, "keys derived from the zeroed session key should be removed from the derived key cache")
+
+	// The key handed out still works.
+	assert.Equal(t, value, key.KeyValue, "session key handed out should not be zeroed")
+	b, err := crypto.DecryptEncPart(ed, key, keyusage.GSSAPI_INITIATOR_SEAL)
+	if err != nil {
+		t.Fatalf("error decrypting with session key handed out before eviction: %v", err)
+	}
+	assert.Equal(t, []byte("data"), b, "decrypted data not as expected")
+}
+
+func TestClient_GetCachedTicket_MaxEntries(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), CacheMaxEntries(2))
+	now := time.Now().UTC()
+	for _, spn := range []string{"HTTP/host1.test.gokrb5", "HTTP/host2.test.gokrb5", "HTTP/host3.test.gokrb5"} {
+		tkt := messages.Ticket{SName: types.NewPrincipalName(2, spn)}
+		cl.cache.addEntry(tkt, now, now.Add(-time.Minute), now.Add(time.Hour), now.Add(time.Hour), types.EncryptionKey{KeyType: 18, KeyValue: []byte{1}}, types.NewKrbFlags())
+		time.Sleep(time.Millisecond)
+	}
+	_, _, ok := cl.GetCachedTicket("HTTP/host1.test.gokrb5")
+	assert.True(t, ok, "ticket should be returned from the cache")
+	cl.sweepCache()
+	_, ok = cl.cache.getEntry("HTTP/host2.test.gokrb5")
+	assert.False(t, ok, "least recently used ticket should be removed")
+	_, _, ok = cl.GetCachedTicket("HTTP/host1.test.gokrb5")
+	assert.True(t, ok, "recently used ticket should not be removed")
+	assert.Len(t, cl.cache.all(), 2, "number of entries not as expected")
+}
+
+func TestCache_Export_Import(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("abcdef0123456789abcdef0123456789")}
+	now := time.Now().UTC().Truncate(time.Second)
+	tkt := func(spn string) messages.Ticket {
+		return messages.Ticket{
+			TktVNO:  5,
+			Realm:   "TEST.GOKRB5",
+			SName:   types.NewPrincipalName(2, spn),
+			EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte(spn)},
+		}
+	}
+	c := NewCache()
+	c.addEntry(tkt("HTTP/host1.test.gokrb5"), now, now, now.Add(time.Hour), now.Add(2*time.Hour), skey, types.NewKrbFlags())
+	c.addAlias("HTTP/alias.test.gokrb5", "HTTP/host1.test.gokrb5")
+	c.addEntry(tkt("HTTP/expired.test.gokrb5"), now.Add(-2*time.Hour), now.Add(-2*time.Hour), now.Add(-time.Hour), now.Add(-time.Hour), skey, types.NewKrbFlags())
+
+	_, err := c.Export(types.EncryptionKey{})
+	assert.Error(t, err, "export without a key should fail")
+	b, err := c.Export(key)
+	if err != nil {
+		t.Fatalf("error exporting cache: %v", err)
+	}
+	assert.NotContains(t, string(b), string(skey.KeyValue), "session key should be encrypted")
+
+	r := NewCache()
+	assert.Error(t, r.Import(b, types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}), "import with the wrong key should fail")
+	if err := r.Import(b, key); err != nil {
+		t.Fatalf("error importing cache: %v", err)
+	}
+	assert.Len(t, r.all(), 2, "number of entries not as expected")
+	_, ok := r.getEntry("HTTP/expired.test.gokrb5")
+	assert.False(t, ok, "expired entry should not be imported")
+	for _, spn := range []string{"HTTP/host1.test.gokrb5", "HTTP/alias.test.gokrb5"} {
+		e, ok := r.getEntry(spn)
+		if !ok {
+			t.Fatalf("entry for %s not imported", spn)
+		}
+		assert.Equal(t, spn, e.SPN, "SPN not as expected")
+		assert.Equal(t, tkt("HTTP/host1.test.gokrb5"), e.Ticket, "ticket not as expected")
+		assert.Equal(t, skey, e.SessionKey, "session key not as expected")
+		assert.Equal(t, now.Add(time.Hour), e.EndTime, "end time not as expected")
+		assert.Equal(t, now.Add(2*time.Hour), e.RenewTill, "renew till not as expected")
+	}
+
+	// An entry valid for longer is not replaced.
+	c.addEntry(tkt("HTTP/host2.test.gokrb5"), now, now, now.Add(time.Hour), now.Add(time.Hour), skey, types.NewKrbFlags())
+	r.addEntry(tkt("HTTP/host2.test.gokrb5"), now, now, now.Add(2*time.Hour), now.Add(2*time.Hour), skey, types.NewKrbFlags())
+	b, _ = c.Export(key)
+	assert.NoError(t, r.Import(b, key), "error importing cache")
+	e, _ := r.getEntry("HTTP/host2.test.gokrb5")
+	assert.Equal(t, now.Add(2*time.Hour), e.EndTime, "entry valid for longer should not be replaced")
+
+	b, err = NewCache().Export(key)
+	if err != nil {
+		t.Fatalf("error exporting empty cache: %v", err)
+	}
+	assert.NoError(t, NewCache().Import(b, key), "error importing empty cache")
+}
+
+func TestCache_Import_Clock(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("abcdef0123456789abcdef0123456789")}
+	st := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewCache()
+	c.addEntry(messages.Ticket{
+		TktVNO:  5,
+		Realm:   "TEST.GOKRB5",
+		SName:   types.NewPrincipalName(2, "HTTP/host1.test.gokrb5"),
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte("ticket")},
+	}, st, st, st.Add(time.Hour), st.Add(time.Hour), skey, types.NewKrbFlags())
+	b, err := c.Export(key)
+	if err != nil {
+		t.Fatalf("error exporting cache: %v", err)
+	}
+
+	// The ticket expired on the system clock.
+	r := NewCache()
+	assert.NoError(t, r.Import(b, key), "error importing cache")
+	assert.Len(t, r.all(), 0, "expired entry should not be imported")
+
+	// The ticket is valid on the clock of the client using the cache.
+	store := NewCache()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), Clock(clock.NewFake(st.Add(time.Minute))), ServiceTicketStore(store))
+	for _, r := range []*Cache{store, cl.cache} {
+		assert.NoError(t, r.Import(b, key), "error importing cache")
+		_, ok := r.getEntry("HTTP/host1.test.gokrb5")
+		assert.True(t, ok, "entry valid on the client's clock should be imported")
+	}
+}
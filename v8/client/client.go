@@ -2,19 +2,22 @@
 package client
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
-	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/credentials"
 	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/krberror"
@@ -29,65 +32,69 @@ type Client struct {
 	settings    *Settings
 	sessions    *sessions
 	cache       *Cache
+	udpConns    *udpPool
+	tcpConns    *tcpPool
+	kdcHealth   *kdcHealth
+	renewer     *ticketRenewer
+	failures    *negativeCache
+	principals  *principals
+}
+
+// newClient returns a client for the credentials with the configuration and settings provided, and its own sessions,
+// caches and KDC connections.
+func newClient(creds *credentials.Credentials, krb5conf *config.Config, settings *Settings) *Client {
+	cl := &Client{
+		Credentials: creds,
+		Config:      krb5conf,
+		settings:    settings,
+		sessions:    newSessions(),
+		cache:       NewCache(),
+		udpConns:    new(udpPool),
+		tcpConns:    new(tcpPool),
+		kdcHealth:   new(kdcHealth),
+		renewer:     new(ticketRenewer),
+		failures:    new(negativeCache),
+	}
+	clk := clock.Func(cl.now)
+	cl.cache.useClock(clk)
+	if c, ok := settings.ServiceTicketStore().(*Cache); ok {
+		c.useClock(clk)
+	}
+	return cl
 }
 
 // NewWithPassword creates a new client from a password credential.
 // Set the realm to empty string to use the default realm from config.
 func NewWithPassword(username, realm, password string, krb5conf *config.Config, settings ...func(*Settings)) *Client {
 	creds := credentials.New(username, realm)
-	return &Client{
-		Credentials: creds.WithPassword(password),
-		Config:      krb5conf,
-		settings:    NewSettings(settings...),
-		sessions: &sessions{
-			Entries: make(map[string]*session),
-		},
-		cache: NewCache(),
-	}
+	return newClient(creds.WithPassword(password), krb5conf, NewSettings(settings...))
 }
 
 // NewWithNTHash creates a new client from a password's nt hash credential.
 // Set the realm to empty string to use the default realm from config.
 func NewWithNTHash(username, realm, hash string, krb5conf *config.Config, settings ...func(*Settings)) *Client {
 	creds := credentials.New(username, realm)
-	return &Client{
-		Credentials: creds.WithNTHash(hash),
-		Config:      krb5conf,
-		settings:    NewSettings(settings...),
-		sessions: &sessions{
-			Entries: make(map[string]*session),
-		},
-		cache: NewCache(),
-	}
+	return newClient(creds.WithNTHash(hash), krb5conf, NewSettings(settings...))
 }
 
 // NewWithKeytab creates a new client from a keytab credential.
 func NewWithKeytab(username, realm string, kt *keytab.Keytab, krb5conf *config.Config, settings ...func(*Settings)) *Client {
 	creds := credentials.New(username, realm)
-	return &Client{
-		Credentials: creds.WithKeytab(kt),
-		Config:      krb5conf,
-		settings:    NewSettings(settings...),
-		sessions: &sessions{
-			Entries: make(map[string]*session),
-		},
-		cache: NewCache(),
-	}
+	return newClient(creds.WithKeytab(kt), krb5conf, NewSettings(settings...))
+}
+
+// NewWithKeyHandles creates a new client from a credential of handles to long-term keys held outside of the process,
+// for example in an HSM, so that the client's key values are never in its memory.
+func NewWithKeyHandles(username, realm string, hp keytab.KeyHandleProvider, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	creds := credentials.New(username, realm)
+	return newClient(creds.WithKeyHandles(hp), krb5conf, NewSettings(settings...))
 }
 
 // NewFromCCache create a client from a populated client cache.
 //
 // WARNING: A client created from CCache does not automatically renew TGTs and a failure will occur after the TGT expires.
 func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
-	cl := &Client{
-		Credentials: c.GetClientCredentials(),
-		Config:      krb5conf,
-		settings:    NewSettings(settings...),
-		sessions: &sessions{
-			Entries: make(map[string]*session),
-		},
-		cache: NewCache(),
-	}
+	cl := newClient(c.GetClientCredentials(), krb5conf, NewSettings(settings...))
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
 		NameString: []string{"krbtgt", c.DefaultPrincipal.Realm},
@@ -99,46 +106,158 @@ func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...f
 	var tgt messages.Ticket
 	err := tgt.Unmarshal(cred.Ticket)
 	if err != nil {
-		return cl, fmt.Errorf("TGT bytes in cache are not valid: %v", err)
+		return cl, fmt.Errorf("TGT bytes in cache are not valid: %w", err)
 	}
-	cl.sessions.Entries[c.DefaultPrincipal.Realm] = &session{
-		realm:      c.DefaultPrincipal.Realm,
+	cl.sessions.update(newSession(c.DefaultPrincipal.Realm, &sessionState{
 		authTime:   cred.AuthTime,
+		startTime:  cred.StartTime,
 		endTime:    cred.EndTime,
 		renewTill:  cred.RenewTill,
 		tgt:        tgt,
 		sessionKey: cred.Key,
+		flags:      cred.TicketFlags,
+	}))
+	return cl, cl.ImportCCache(c)
+}
+
+// ImportCCache loads the tickets held in the credential cache into the client so that they are used rather than
+// requesting them from the KDC again. Service tickets are added to the client's service ticket cache and TGTs,
+// including cross realm TGTs, are added as sessions for their realm. A ticket is not imported if the client already
+// holds one for the same principal that does not expire before it.
+//
+// The credential cache must be for the client's principal.
+//
+// WARNING: TGTs imported from a CCache are not automatically renewed.
+func (cl *Client) ImportCCache(c *credentials.CCache) error {
+	if !c.GetClientPrincipalName().Equal(cl.Credentials.CName()) || c.GetClientRealm() != cl.Credentials.Domain() {
+		return krberror.WithKind(fmt.Errorf("credential cache is for %s@%s not the client's principal %s@%s",
+			c.GetClientPrincipalName().PrincipalNameString(), c.GetClientRealm(),
+			cl.Credentials.CName().PrincipalNameString(), cl.Credentials.Domain()), krberror.KindCredentials)
 	}
 	for _, cred := range c.GetEntries() {
 		var tkt messages.Ticket
-		err = tkt.Unmarshal(cred.Ticket)
+		err := tkt.Unmarshal(cred.Ticket)
 		if err != nil {
-			return cl, fmt.Errorf("cache entry ticket bytes are not valid: %v", err)
+			return fmt.Errorf("cache entry ticket bytes are not valid: %w", err)
+		}
+		if isTGT(tkt) {
+			cl.importTGT(tkt, cred)
+			continue
+		}
+		if e, ok := cl.cachedEntry(tkt.SName.PrincipalNameString()); ok && !e.EndTime.Before(cred.EndTime) {
+			continue
 		}
-		cl.cache.addEntry(
+		cl.cacheTicket(
 			tkt,
 			cred.AuthTime,
 			cred.StartTime,
 			cred.EndTime,
 			cred.RenewTill,
 			cred.Key,
+			cred.TicketFlags,
 		)
+		// The cache entry may be stored against the principal requested rather than the one in the ticket, for
+		// example when the KDC has canonicalized an alias.
+		if spn := cred.Server.PrincipalName.PrincipalNameString(); spn != tkt.SName.PrincipalNameString() {
+			cl.cacheAlias(spn, tkt.SName.PrincipalNameString())
+		}
+	}
+	cl.scheduleRenewal()
+	return nil
+}
+
+// isTGT informs if the ticket is a TGT.
+func isTGT(tkt messages.Ticket) bool {
+	return len(tkt.SName.NameString) == 2 && strings.ToLower(tkt.SName.NameString[0]) == "krbtgt"
+}
+
+// importTGT adds a session for the realm of the TGT from the credential cache unless the client already has a
+// session for that realm that expires later.
+func (cl *Client) importTGT(tgt messages.Ticket, cred *credentials.Credential) {
+	realm := tgt.SName.NameString[1]
+	if s, ok := cl.sessions.get(realm); ok && !s.snapshot().endTime.Before(cred.EndTime) {
+		return
 	}
-	return cl, nil
+	cl.sessions.update(newSession(realm, &sessionState{
+		authTime:   cred.AuthTime,
+		startTime:  cred.StartTime,
+		endTime:    cred.EndTime,
+		renewTill:  cred.RenewTill,
+		tgt:        tgt,
+		sessionKey: cred.Key,
+		flags:      cred.TicketFlags,
+	}))
+}
+
+// CCache returns a credential cache holding the client's TGT sessions and cached service tickets.
+// The credential cache can be saved to file for use by other Kerberos applications. The session keys are copied so
+// they remain valid once the client is destroyed.
+func (cl *Client) CCache() (*credentials.CCache, error) {
+	cname := cl.Credentials.CName()
+	crealm := cl.Credentials.Domain()
+	c := credentials.NewCCache(cname, crealm)
+	for _, s := range cl.sessions.all() {
+		st := s.snapshot()
+		b, err := st.tgt.Marshal()
+		if err != nil {
+			return c, krberror.Errorf(err, krberror.EncodingError, "error marshaling TGT for credential cache")
+		}
+		cred := credentials.NewCredential(cname, crealm, st.tgt.SName, st.tgt.Realm)
+		cred.Key = copyKey(st.sessionKey)
+		cred.AuthTime = st.authTime
+		cred.StartTime = st.startTime
+		if cred.StartTime.IsZero() {
+			cred.StartTime = st.authTime
+		}
+		cred.EndTime = st.endTime
+		cred.RenewTill = st.renewTill
+		setTicketFlags(cred, st.flags)
+		cred.Ticket = b
+		c.AddCredential(cred)
+	}
+	for _, e := range cl.cachedEntries() {
+		b, err := e.Ticket.Marshal()
+		if err != nil {
+			return c, krberror.Errorf(err, krberror.EncodingError, "error marshaling service ticket for credential cache")
+		}
+		cred := credentials.NewCredential(cname, crealm, e.Ticket.SName, e.Ticket.Realm)
+		cred.Key = copyKey(e.SessionKey)
+		cred.AuthTime = e.AuthTime
+		cred.StartTime = e.StartTime
+		cred.EndTime = e.EndTime
+		cred.RenewTill = e.RenewTill
+		setTicketFlags(cred, e.Flags)
+		cred.Ticket = b
+		c.AddCredential(cred)
+	}
+	return c, nil
+}
+
+// setTicketFlags copies the ticket flags onto the credential, keeping the credential's empty flags when none were
+// recorded for the ticket.
+func setTicketFlags(cred *credentials.Credential, flags asn1.BitString) {
+	if len(flags.Bytes) == 0 {
+		return
+	}
+	cred.TicketFlags.Bytes = append([]byte{}, flags.Bytes...)
+	cred.TicketFlags.BitLength = flags.BitLength
 }
 
 // Key returns the client's encryption key for the specified encryption type and its kvno (kvno of zero will find latest).
-// The key can be retrieved either from the keytab or generated from the client's password.
+// The key can be retrieved either from the keytab or generated from the client's password. If the client's keys are
+// held by key handles an error wrapping keytab.ErrKeyNotExtractable is returned.
 // If the client has both a keytab and a password defined the keytab is favoured as the source for the key
 // A KRBError can be passed in the event the KDC returns one of type KDC_ERR_PREAUTH_REQUIRED and is required to derive
 // the key for pre-authentication from the client's password. If a KRBError is not available, pass nil to this argument.
 func (cl *Client) Key(etype etype.EType, kvno int, krberr *messages.KRBError) (types.EncryptionKey, int, error) {
-	if cl.Credentials.HasKeytab() && etype != nil {
+	if cl.Credentials.HasKeyHandles() {
+		return types.EncryptionKey{}, 0, krberror.WithKind(keytab.ErrKeyNotExtractable, krberror.KindCredentials)
+	} else if cl.Credentials.HasKeytab() && etype != nil {
 		return cl.Credentials.Keytab().GetEncryptionKey(cl.Credentials.CName(), cl.Credentials.Domain(), kvno, etype.GetETypeID())
 	} else if cl.Credentials.HasNTHash() {
 		hash, err := hex.DecodeString(cl.Credentials.NTHash())
 		if err != nil {
-			return types.EncryptionKey{}, 0, fmt.Errorf("failed to parse nt hash as key: %v", err)
+			return types.EncryptionKey{}, 0, krberror.WithKind(fmt.Errorf("failed to parse nt hash as key: %w", err), krberror.KindCredentials)
 		}
 		key := types.EncryptionKey{
 			KeyType:  etype.GetETypeID(),
@@ -147,10 +266,9 @@ func (cl *Client) Key(etype etype.EType, kvno int, krberr *messages.KRBError) (t
 		return key, 0, nil
 	} else if cl.Credentials.HasPassword() {
 		if krberr != nil && krberr.ErrorCode == errorcode.KDC_ERR_PREAUTH_REQUIRED {
-			var pas types.PADataSequence
-			err := pas.Unmarshal(krberr.EData)
+			pas, err := cl.kdcPAData(krberr)
 			if err != nil {
-				return types.EncryptionKey{}, 0, fmt.Errorf("could not get PAData from KRBError to generate key from password: %v", err)
+				return types.EncryptionKey{}, 0, fmt.Errorf("could not get PAData from KRBError to generate key from password: %w", err)
 			}
 			key, _, err := crypto.GetKeyFromPassword(cl.Credentials.Password(), krberr.CName, krberr.CRealm, etype.GetETypeID(), pas)
 			return key, 0, err
@@ -158,22 +276,23 @@ func (cl *Client) Key(etype etype.EType, kvno int, krberr *messages.KRBError) (t
 		key, _, err := crypto.GetKeyFromPassword(cl.Credentials.Password(), cl.Credentials.CName(), cl.Credentials.Domain(), etype.GetETypeID(), types.PADataSequence{})
 		return key, 0, err
 	}
-	return types.EncryptionKey{}, 0, errors.New("credential has neither keytab or password to generate key")
+	return types.EncryptionKey{}, 0, krberror.WithKind(errors.New("credential has neither keytab or password to generate key"), krberror.KindCredentials)
 }
 
 // IsConfigured indicates if the client has the values required set.
 func (cl *Client) IsConfigured() (bool, error) {
 	if cl.Credentials.UserName() == "" {
-		return false, errors.New("client does not have a username")
+		return false, krberror.WithKind(errors.New("client does not have a username"), krberror.KindConfig)
 	}
 	if cl.Credentials.Domain() == "" {
-		return false, errors.New("client does not have a define realm")
+		return false, krberror.WithKind(errors.New("client does not have a define realm"), krberror.KindConfig)
 	}
-	// Client needs to have either a password, password hash, keytab or a session already (later when loading from CCache)
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasNTHash() && !cl.Credentials.HasKeytab() {
+	// Client needs to have either a password, password hash, keytab, certificate or a session already (later when
+	// loading from CCache)
+	if !cl.hasSecret() {
 		authTime, _, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
 		if err != nil || authTime.IsZero() {
-			return false, errors.New("client has neither a keytab nor a password set and no session")
+			return false, krberror.WithKind(errors.New("client has neither a keytab nor a password set and no session"), krberror.KindCredentials)
 		}
 	}
 	if !cl.Config.LibDefaults.DNSLookupKDC {
@@ -182,93 +301,288 @@ func (cl *Client) IsConfigured() (bool, error) {
 				if len(r.KDC) > 0 {
 					return true, nil
 				}
-				return false, errors.New("client krb5 config does not have any defined KDCs for the default realm")
+				return false, krberror.WithKind(errors.New("client krb5 config does not have any defined KDCs for the default realm"), krberror.KindConfig)
 			}
 		}
 	}
 	return true, nil
 }
 
+// hasSecret informs if the client's credentials can be used to perform an AS exchange.
+func (cl *Client) hasSecret() bool {
+	return cl.Credentials.HasPassword() || cl.Credentials.HasNTHash() || cl.Credentials.HasKeytab() || cl.Credentials.HasCertificate() ||
+		cl.Credentials.HasKeyHandles() || cl.anonymous() || cl.settings.OTP() != nil
+}
+
 // Login the client with the KDC via an AS exchange.
 func (cl *Client) Login() error {
+	return cl.LoginContext(context.Background())
+}
+
+// LoginContext logs the client in with the KDC via an AS exchange, as Login does. The exchanges with the KDC are
+// abandoned if the context is done before they complete.
+func (cl *Client) LoginContext(ctx context.Context) error {
+	return cl.correlate(cl.login(ctx))
+}
+
+func (cl *Client) login(ctx context.Context, opts ...TicketOption) error {
 	if ok, err := cl.IsConfigured(); !ok {
 		return err
 	}
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasNTHash() && !cl.Credentials.HasKeytab() {
+	if len(opts) > 0 && !cl.hasSecret() {
+		return krberror.New(krberror.ConfigError, "a TGT with ticket options cannot be obtained without the client's password, keytab or other secret")
+	}
+	if !cl.hasSecret() {
 		_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
 		if err != nil {
-			return krberror.Errorf(err, krberror.KRBMsgError, "no user credentials available and error getting any existing session")
+			return krberror.WithKind(krberror.Errorf(err, krberror.KRBMsgError, "no user credentials available and error getting any existing session"), krberror.KindCredentials)
 		}
-		if time.Now().UTC().After(endTime) {
-			return krberror.New(krberror.KRBMsgError, "cannot login, no user credentials available and no valid existing session")
+		if cl.now().After(endTime) {
+			return krberror.WithKind(krberror.New(krberror.KRBMsgError, "cannot login, no user credentials available and no valid existing session"), krberror.KindCredentials)
 		}
 		// no credentials but there is a session with tgt already
 		return nil
 	}
-	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	enterprise := cl.enterpriseLogin()
+	cname := cl.Credentials.CName()
+	if enterprise {
+		cname = types.NewEnterprisePrincipalName(cl.Credentials.UserName())
+	}
+	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cname)
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new AS_REQ")
 	}
-	ASRep, err := cl.ASExchange(cl.Credentials.Domain(), ASReq, 0)
+	if enterprise {
+		// Enterprise names are resolved by the KDC so it must be allowed to canonicalize them, RFC 6806 section 5.
+		types.SetFlag(&ASReq.ReqBody.KDCOptions, flags.Canonicalize)
+	}
+	now := cl.now()
+	ASReq.ReqBody.SetTimes(now, cl.Config)
+	for _, o := range opts {
+		o(&ASReq.ReqBody, now)
+	}
+	ASRep, err := cl.asExchange(ctx, cl.Credentials.Domain(), ASReq, 0)
 	if err != nil {
 		return err
 	}
+	if enterprise {
+		// Subsequent requests, including later logins, are made with the canonical principal name.
+		cl.Log("enterprise principal %s resolved to %s@%s", cname.PrincipalNameString(), ASRep.CName.PrincipalNameString(), ASRep.CRealm)
+		cl.Credentials.SetCName(ASRep.CName)
+		cl.Credentials.SetUserName(ASRep.CName.PrincipalNameString())
+		cl.Credentials.SetRealm(ASRep.CRealm)
+	}
 	cl.addSession(ASRep.Ticket, ASRep.DecryptedEncPart)
+	cl.onLogin(ASRep.Ticket, ASRep.DecryptedEncPart)
 	return nil
 }
 
+// enterpriseLogin indicates if the client's username is to be sent to the KDC as an enterprise principal name. Once the
+// KDC has resolved the name the username is the canonical name, which cannot contain an unescaped @, and is sent as is.
+func (cl *Client) enterpriseLogin() bool {
+	return cl.settings.EnterprisePrincipal() && strings.Contains(cl.Credentials.UserName(), "@")
+}
+
 // AffirmLogin will only perform an AS exchange with the KDC if the client does not already have a TGT.
 func (cl *Client) AffirmLogin() error {
+	return cl.AffirmLoginContext(context.Background())
+}
+
+// AffirmLoginContext will only perform an AS exchange with the KDC if the client does not already have a TGT, as
+// AffirmLogin does. The exchanges with the KDC are abandoned if the context is done before they complete.
+func (cl *Client) AffirmLoginContext(ctx context.Context) error {
 	_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
-	if err != nil || time.Now().UTC().After(endTime) {
-		err := cl.Login()
+	if err != nil || cl.now().After(endTime) {
+		err := cl.LoginContext(ctx)
 		if err != nil {
-			return fmt.Errorf("could not get valid TGT for client's realm: %v", err)
+			return fmt.Errorf("could not get valid TGT for client's realm: %w", err)
 		}
 	}
 	return nil
 }
 
 // realmLogin obtains or renews a TGT and establishes a session for the realm specified.
-func (cl *Client) realmLogin(realm string) error {
+//
+// A TGT for another realm is obtained by traversing the authentication path from the client's realm, taken from the
+// [capaths] section of the configuration or the hierarchy of the realms, as MIT krb5 does. From each realm of the path,
+// starting with the furthest one the client already has a valid session for, the TGT for the realm specified is
+// requested first and then those for the realms closer along the path. The cross-realm TGTs obtained for the
+// intermediate realms are kept as sessions to be used for later traversals.
+//
+// A TGT for a realm the client was referred to, such as another forest, is obtained again from the KDC of the realm
+// that issued the client's previous TGT for it, as the realm may not be on the authentication path.
+func (cl *Client) realmLogin(ctx context.Context, realm string) error {
 	if realm == cl.Credentials.Domain() {
-		return cl.Login()
+		return cl.LoginContext(ctx)
 	}
-	_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
-	if err != nil || time.Now().UTC().After(endTime) {
-		err := cl.Login()
-		if err != nil {
-			return fmt.Errorf("could not get valid TGT for client's realm: %v", err)
+	path := cl.Config.CAPath(cl.Credentials.Domain(), realm)
+	if ok, err := cl.issuerLogin(ctx, realm, path); ok {
+		if err == nil {
+			return nil
 		}
+		cl.Log("could not get a TGT for %s from the realm that issued the previous one: %v", realm, err)
 	}
-	tgt, skey, err := cl.sessionTGT(cl.Credentials.Domain())
+	cur := 0
+	for i := len(path) - 2; i > 0; i-- {
+		if s, ok := cl.sessions.get(path[i]); ok && s.valid(cl.now()) {
+			cur = i
+			break
+		}
+	}
+	if cur == 0 {
+		if err := cl.AffirmLoginContext(ctx); err != nil {
+			return err
+		}
+	}
+	tgt, skey, err := cl.sessionTGT(ctx, path[cur])
 	if err != nil {
 		return err
 	}
+	for cur < len(path)-1 {
+		var tgsRep messages.TGSRep
+		var first error
+		next := len(path) - 1
+		for ; next > cur; next-- {
+			spn := types.PrincipalName{
+				NameType:   nametype.KRB_NT_SRV_INST,
+				NameString: []string{"krbtgt", path[next]},
+			}
+			_, tgsRep, err = cl.TGSREQGenerateAndExchangeContext(ctx, spn, path[cur], tgt, skey, false)
+			if err == nil {
+				break
+			}
+			if first == nil {
+				first = err
+			}
+			var e messages.KRBError
+			if !errors.As(err, &e) || e.ErrorCode != errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN {
+				return err
+			}
+			cl.Log("KDC for %s has no TGT for %s: %v", path[cur], path[next], err)
+		}
+		if next == cur {
+			return krberror.Errorf(first, krberror.KRBMsgError, "could not get a TGT for %s along the path %s",
+				realm, strings.Join(path, ", "))
+		}
+		cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+		tgt, skey = tgsRep.Ticket, tgsRep.DecryptedEncPart.Key
+		cur = next
+	}
+	return nil
+}
+
+// realmLoginsKey is the context key of the realms whose TGTs are being obtained from the realms that issued their
+// previous TGTs.
+type realmLoginsKey struct{}
 
+// issuerLogin obtains a TGT for the realm from the KDC of the realm that issued the client's previous TGT for it, if
+// that realm is not on the authentication path, obtaining a TGT for the issuing realm in the same way if required.
+// The boolean indicates if the TGT was requested.
+func (cl *Client) issuerLogin(ctx context.Context, realm string, path []string) (bool, error) {
+	s, ok := cl.sessions.get(realm)
+	if !ok {
+		return false, nil
+	}
+	_, tgt, _ := s.tgtDetails()
+	issuer := tgt.Realm
+	if issuer == "" || issuer == realm {
+		return false, nil
+	}
+	for _, r := range path {
+		if r == issuer {
+			return false, nil
+		}
+	}
+	logins, _ := ctx.Value(realmLoginsKey{}).([]string)
+	for _, r := range logins {
+		if r == issuer || r == realm {
+			// The issuing realms refer back to a realm already being logged in to.
+			return false, nil
+		}
+	}
+	ctx = context.WithValue(ctx, realmLoginsKey{}, append(logins[:len(logins):len(logins)], realm))
+	itgt, iskey, err := cl.sessionTGT(ctx, issuer)
+	if err != nil {
+		return true, err
+	}
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
 		NameString: []string{"krbtgt", realm},
 	}
-
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, cl.Credentials.Domain(), tgt, skey, false)
+	_, tgsRep, err := cl.TGSREQGenerateAndExchangeContext(ctx, spn, issuer, itgt, iskey, false)
 	if err != nil {
-		return err
+		return true, krberror.Errorf(err, krberror.KRBMsgError, "could not get a TGT for %s from %s", realm, issuer)
 	}
 	cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+	return true, nil
+}
 
-	return nil
+// RealmTGT returns the client's TGT for the realm and the TGT's session key, obtaining a cross-realm TGT for a realm
+// other than the client's own if the client does not hold a valid one, as it does when getting a service ticket for a
+// service of the realm. The TGT is then kept as a session of the client and renewed automatically, independently of
+// the client's TGTs for other realms.
+// The session key must not be disclosed.
+func (cl *Client) RealmTGT(ctx context.Context, realm string) (messages.Ticket, types.EncryptionKey, error) {
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	return tgt, skey, cl.correlate(err)
 }
 
-// Destroy stops the auto-renewal of all sessions and removes the sessions and cache entries from the client.
+// Destroy stops the auto-renewal of all sessions and removes the sessions and cache entries from the client, zeroing
+// their session keys. Keys obtained from the client are copies, so they remain usable by security contexts established
+// before the client is destroyed and should be zeroed by their holders once no longer needed. A TicketStore
+// configured with the ServiceTicketStore setting is not cleared.
 func (cl *Client) Destroy() {
 	creds := credentials.New("", "")
-	cl.sessions.destroy()
+	cl.closePrincipals()
+	cl.renewer.close()
+	cl.sessions.destroy(cl.now())
 	cl.cache.clear()
+	cl.failures.remove()
+	cl.udpConns.close()
+	cl.tcpConns.close()
 	cl.Credentials = creds
 	cl.Log("client destroyed")
 }
 
+// Close releases the resources held by the client so that an application can shut down cleanly. The auto-renewal of
+// sessions is stopped and Close waits for any renewal in progress to complete. The sessions and cache entries are
+// removed, with their session keys zeroed, and the pooled KDC connections are closed.
+// Keys obtained from the client before it is closed are copies so they are not zeroed, as with Destroy.
+// The client cannot be used once closed. Close always returns nil so that the client implements io.Closer.
+func (cl *Client) Close() error {
+	cl.closePrincipals()
+	cl.renewer.close()
+	cl.sessions.close(cl.now())
+	cl.cache.clear()
+	cl.failures.remove()
+	cl.udpConns.close()
+	cl.tcpConns.close()
+	cl.Credentials = credentials.New("", "")
+	cl.Log("client closed")
+	return nil
+}
+
+// zeroDerivedKey zeroes a key the client derived from its password or password hash once it is no longer needed.
+// Keys from the client's keytab are not zeroed as they are held by the keytab.
+func (cl *Client) zeroDerivedKey(key types.EncryptionKey) {
+	if !cl.Credentials.HasKeytab() {
+		key.Zero()
+	}
+}
+
+// copyKey returns a copy of the key that does not share its key value.
+func copyKey(key types.EncryptionKey) types.EncryptionKey {
+	key.KeyValue = append([]byte(nil), key.KeyValue...)
+	return key
+}
+
+// zero overwrites the bytes with zeros.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 // Diagnostics runs a set of checks that the client is properly configured and writes details to the io.Writer provided.
 func (cl *Client) Diagnostics(w io.Writer) error {
 	cl.Print(w)
@@ -341,7 +655,7 @@ func (cl *Client) Print(w io.Writer) {
 	s, _ := cl.sessions.JSON()
 	fmt.Fprintf(w, "TGT Sessions:\n%s\n", s)
 
-	c, _ = cl.cache.JSON()
+	c, _ = entriesJSON(cl.cachedEntries())
 	fmt.Fprintf(w, "Service ticket cache:\n%s\n", c)
 
 	s, _ = cl.settings.JSON()
@@ -1,10 +1,21 @@
 package client
 
 import (
+	"context"
+	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAssumePreauthentication(t *testing.T) {
@@ -18,3 +29,216 @@ func TestAssumePreauthentication(t *testing.T) {
 		t.Fatal("AssumePreAuthentication() should be true")
 	}
 }
+
+func TestClient_CCache(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.CCACHE_TEST)
+	cc := new(credentials.CCache)
+	err := cc.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling test ccache: %v", err)
+	}
+	cl, err := NewFromCCache(cc, config.New())
+	if err != nil {
+		t.Fatalf("error creating client from ccache: %v", err)
+	}
+	c, err := cl.CCache()
+	if err != nil {
+		t.Fatalf("error getting client ccache: %v", err)
+	}
+	assert.Equal(t, cc.GetClientPrincipalName(), c.GetClientPrincipalName(), "client principal name not as expected")
+	assert.Equal(t, cc.GetClientRealm(), c.GetClientRealm(), "client realm not as expected")
+	assert.Equal(t, len(cc.GetEntries()), len(c.GetEntries()), "number of entries not as expected")
+	for _, e := range cc.GetEntries() {
+		ce, ok := c.GetEntry(e.Server.PrincipalName)
+		if !ok {
+			t.Errorf("entry for %s not found in client ccache", e.Server.PrincipalName.PrincipalNameString())
+			continue
+		}
+		assert.Equal(t, e.Ticket, ce.Ticket, "ticket not as expected")
+		assert.Equal(t, e.Key, ce.Key, "session key not as expected")
+		assert.Equal(t, e.EndTime, ce.EndTime, "end time not as expected")
+		assert.Equal(t, e.StartTime, ce.StartTime, "start time not as expected")
+		assert.Equal(t, e.TicketFlags.Bytes, ce.TicketFlags.Bytes, "ticket flags not as expected")
+	}
+}
+
+func testCCacheCredential(t *testing.T, cname types.PrincipalName, sname, server types.PrincipalName, srealm string, endTime time.Time) *credentials.Credential {
+	tkt := messages.Ticket{
+		TktVNO:  5,
+		Realm:   srealm,
+		SName:   sname,
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte(sname.PrincipalNameString())},
+	}
+	b, err := tkt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling ticket: %v", err)
+	}
+	cred := credentials.NewCredential(cname, "TEST.GOKRB5", server, srealm)
+	cred.Key = types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte(sname.PrincipalNameString())}
+	cred.AuthTime = endTime.Add(-time.Hour)
+	cred.StartTime = cred.AuthTime
+	cred.EndTime = endTime
+	cred.RenewTill = endTime
+	cred.Ticket = b
+	return cred
+}
+
+func TestClient_ImportCCache(t *testing.T) {
+	t.Parallel()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	end := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	tgtpn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5")
+	xtgtpn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/RESDOM.GOKRB5")
+	httppn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	aliaspn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/alias.test.gokrb5")
+	cc := credentials.NewCCache(cname, "TEST.GOKRB5")
+	cc.AddCredential(testCCacheCredential(t, cname, tgtpn, tgtpn, "TEST.GOKRB5", end))
+	cc.AddCredential(testCCacheCredential(t, cname, xtgtpn, xtgtpn, "TEST.GOKRB5", end))
+	cc.AddCredential(testCCacheCredential(t, cname, httppn, aliaspn, "TEST.GOKRB5", end))
+
+	cl, err := NewFromCCache(cc, config.New())
+	if err != nil {
+		t.Fatalf("error creating client from ccache: %v", err)
+	}
+	_, ok := cl.sessions.get("RESDOM.GOKRB5")
+	assert.True(t, ok, "cross realm TGT not loaded as a session")
+	_, ok = cl.cache.getEntry("krbtgt/TEST.GOKRB5")
+	assert.False(t, ok, "TGT should not be in the service ticket cache")
+	tkt, key, ok := cl.GetCachedTicket("HTTP/host.test.gokrb5")
+	assert.True(t, ok, "service ticket not loaded from the ccache")
+	assert.Equal(t, "HTTP/host.test.gokrb5", tkt.SName.PrincipalNameString(), "service ticket not as expected")
+	assert.Equal(t, []byte("HTTP/host.test.gokrb5"), key.KeyValue, "session key not as expected")
+	_, _, ok = cl.GetCachedTicket("HTTP/alias.test.gokrb5")
+	assert.True(t, ok, "service ticket not cached under the principal from the ccache")
+
+	// A ticket expiring earlier than the one held does not replace it.
+	cc2 := credentials.NewCCache(cname, "TEST.GOKRB5")
+	older := testCCacheCredential(t, cname, httppn, httppn, "TEST.GOKRB5", end.Add(-time.Minute))
+	cc2.AddCredential(older)
+	err = cl.ImportCCache(cc2)
+	if err != nil {
+		t.Fatalf("error importing ccache: %v", err)
+	}
+	e, _ := cl.cache.getEntry("HTTP/host.test.gokrb5")
+	assert.Equal(t, end, e.EndTime, "cache entry should not have been replaced by one expiring earlier")
+
+	other := credentials.NewCCache(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), "TEST.GOKRB5")
+	err = cl.ImportCCache(other)
+	assert.Equal(t, krberror.KindCredentials, krberror.ErrorKind(err), "importing a ccache for another principal should fail: %v", err)
+}
+
+func TestClient_InteropProfile_FreeIPAAlias(t *testing.T) {
+	t.Parallel()
+	alias := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "alias")
+	canonical := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "canonical")
+	now := time.Now().UTC()
+	var tgsReq messages.TGSReq
+	tgsReq.ReqBody.CName = alias
+	tgsReq.ReqBody.Realm = "TEST.GOKRB5"
+	tgsReq.ReqBody.Nonce = 12345
+	tgsRep := messages.TGSRep{
+		KDCRepFields: messages.KDCRepFields{
+			CName:  canonical,
+			CRealm: "TEST.GOKRB5",
+			Ticket: messages.Ticket{Realm: "TEST.GOKRB5"},
+			DecryptedEncPart: messages.EncKDCRepPart{
+				Nonce:     12345,
+				SRealm:    "TEST.GOKRB5",
+				AuthTime:  now,
+				StartTime: now,
+			},
+		},
+	}
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+
+	cl := NewWithPassword("alias", "TEST.GOKRB5", "pass", c)
+	ok, err := cl.verifyTGSRep(context.Background(), &tgsRep, tgsReq)
+	assert.False(t, ok, "TGS_REP for canonical name should not be valid with the default profile")
+	assert.Error(t, err, "expected error with the default profile")
+
+	cl = NewWithPassword("alias", "TEST.GOKRB5", "pass", c, InteropProfile(ProfileFreeIPA))
+	ok, err = cl.verifyTGSRep(context.Background(), &tgsRep, tgsReq)
+	if !ok || err != nil {
+		t.Fatalf("TGS_REP for canonical name should be valid with the FreeIPA profile: %v", err)
+	}
+	assert.Equal(t, canonical, tgsRep.CName, "CName of the TGS_REP should not be changed by verification")
+}
+
+func TestClient_ErrorKind(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	cl := NewWithPassword("", "TEST.GOKRB5", "passwordvalue", c)
+	_, err := cl.IsConfigured()
+	assert.Equal(t, krberror.KindConfig, krberror.ErrorKind(err), "kind of missing username error not as expected")
+
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl = testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+	_, err = cl.sendToKDC(context.Background(), []byte{0}, "UNKNOWN.GOKRB5")
+	assert.Equal(t, krberror.KindConfig, krberror.ErrorKind(err), "kind of missing KDCs error not as expected")
+	_, _, err = cl.GetServiceTicket("HTTP/unknown.test.gokrb5")
+	assert.Equal(t, krberror.KindConfig, krberror.ErrorKind(err), "kind of unknown SPN error not as expected")
+}
+
+func TestClient_Close(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	_, key, err := cl.GetServiceTicket("HTTP/host1.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	_, tgt, tgtKey := cl.sessions.all()["TEST.GOKRB5"].tgtDetails()
+	heldKey := cl.cache.all()["HTTP/host1.test.gokrb5"].SessionKey
+	heldTGTKey := cl.sessions.all()["TEST.GOKRB5"].snapshot().sessionKey
+	wantKey, wantTGTKey := append([]byte(nil), key.KeyValue...), append([]byte(nil), tgtKey.KeyValue...)
+
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, cl.Close(), "error closing client")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close did not return")
+	}
+	assert.Len(t, cl.sessions.all(), 0, "sessions should be removed")
+	assert.Len(t, cl.cache.all(), 0, "cache entries should be removed")
+	assert.Equal(t, make([]byte, len(heldKey.KeyValue)), heldKey.KeyValue, "service ticket session key should be zeroed")
+	assert.Equal(t, make([]byte, len(heldTGTKey.KeyValue)), heldTGTKey.KeyValue, "TGT session key should be zeroed")
+	assert.Equal(t, wantKey, key.KeyValue, "service ticket session key obtained should not be zeroed")
+	assert.Equal(t, wantTGTKey, tgtKey.KeyValue, "TGT session key obtained should not be zeroed")
+
+	// No sessions are added once closed.
+	cl.addSession(tgt, messages.EncKDCRepPart{})
+	assert.Len(t, cl.sessions.all(), 0, "sessions should not be added once closed")
+}
+
+func TestClient_Destroy(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	_, key, err := cl.GetServiceTicket("HTTP/host1.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	_, _, tgtKey := cl.sessions.all()["TEST.GOKRB5"].tgtDetails()
+	heldKey := cl.cache.all()["HTTP/host1.test.gokrb5"].SessionKey
+	heldTGTKey := cl.sessions.all()["TEST.GOKRB5"].snapshot().sessionKey
+	wantKey, wantTGTKey := append([]byte(nil), key.KeyValue...), append([]byte(nil), tgtKey.KeyValue...)
+	cl.Destroy()
+	assert.Len(t, cl.sessions.all(), 0, "sessions should be removed")
+	assert.Len(t, cl.cache.all(), 0, "cache entries should be removed")
+	assert.Equal(t, make([]byte, len(heldKey.KeyValue)), heldKey.KeyValue, "service ticket session key should be zeroed")
+	assert.Equal(t, make([]byte, len(heldTGTKey.KeyValue)), heldTGTKey.KeyValue, "TGT session key should be zeroed")
+	assert.Equal(t, wantKey, key.KeyValue, "service ticket session key obtained should not be zeroed")
+	assert.Equal(t, wantTGTKey, tgtKey.KeyValue, "TGT session key obtained should not be zeroed")
+}
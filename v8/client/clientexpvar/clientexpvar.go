@@ -0,0 +1,26 @@
+// Package clientexpvar publishes the DebugSnapshot of a client as an expvar variable.
+//
+// It is a separate package as importing expvar registers the /debug/vars endpoint, which includes the command line
+// and memory statistics of the process, with the default HTTP request multiplexer.
+package clientexpvar
+
+import (
+	"expvar"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+)
+
+// Var returns an expvar variable of the client's DebugSnapshot, to be set in an expvar.Map or published by the caller.
+func Var(cl *client.Client) expvar.Var {
+	return expvar.Func(func() interface{} {
+		return cl.DebugSnapshot()
+	})
+}
+
+// Publish publishes the client's DebugSnapshot as an expvar variable with the name provided so that it is included in
+// the /debug/vars endpoint.
+//
+// As with expvar.Publish, this panics if a variable with the name is already published.
+func Publish(name string, cl *client.Client) {
+	expvar.Publish(name, Var(cl))
+}
@@ -0,0 +1,26 @@
+package clientexpvar
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVar(t *testing.T) {
+	t.Parallel()
+	cl := client.NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), client.CorrelationID("abc"))
+	m := new(expvar.Map)
+	m.Set("kerberos", Var(cl))
+	var v map[string]client.DebugSnapshot
+	if err := json.Unmarshal([]byte(m.String()), &v); err != nil {
+		t.Fatalf("error unmarshaling expvar map: %v", err)
+	}
+	assert.Equal(t, "abc", v["kerberos"].CorrelationID, "snapshot not as expected")
+
+	Publish("gokrb5test.client", cl)
+	assert.NotNil(t, expvar.Get("gokrb5test.client"), "snapshot not published")
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// minClockCorrection is the smallest offset of the KDC's clock from the client's that the client corrects its time
+// for, so that the latency of the KDC's replies is not taken to be skew.
+const minClockCorrection = time.Second
+
+// skewRetry is the context value of an exchange with the KDCs of the realm being retried with the client's time
+// corrected by the offset of the KDC's time given by its KRB_ERROR.
+type skewRetry struct {
+	realm  string
+	offset time.Duration
+}
+
+// skewRetryKey is the context key of the skewRetry.
+type skewRetryKey struct{}
+
+// skewRetryOffset returns the offset of the KDC's time from the client's clock, and true, if the context is that of an
+// exchange with the KDCs of the realm being retried for clock skew.
+func skewRetryOffset(ctx context.Context, realm string) (time.Duration, bool) {
+	r, ok := ctx.Value(skewRetryKey{}).(skewRetry)
+	if !ok || r.realm != realm {
+		return 0, false
+	}
+	return r.offset, true
+}
+
+// offsetClock returns the clock offset by the duration.
+func offsetClock(c clock.Clock, d time.Duration) clock.Clock {
+	if d == 0 {
+		return c
+	}
+	return clock.Func(func() time.Time {
+		return c.Now().Add(d)
+	})
+}
+
+// clock returns the client's clock corrected for the offset of the KDCs' clock recorded from their authenticated
+// replies, kdc_timesync.
+func (cl *Client) clock() clock.Clock {
+	return offsetClock(cl.settings.Clock(), cl.kdcHealth.clockOffset())
+}
+
+// systemTimed returns whether the client's time is that of the system clock, which the messages package times the
+// requests it generates with, as no clock is configured and no offset of the KDCs' clock is corrected for.
+func (cl *Client) systemTimed() bool {
+	return cl.settings.clock == nil && cl.kdcHealth.clockOffset() == 0
+}
+
+// timeTGSReq sets the end and renew till times requested by the TGS_REQ from the client's clock, regenerating its
+// PA-TGS-REQ, unless the client's time is that of the system clock the request was generated with.
+func (cl *Client) timeTGSReq(tgsReq *messages.TGSReq, tgt messages.Ticket, sessionKey types.EncryptionKey) error {
+	if cl.systemTimed() {
+		return nil
+	}
+	return tgsReq.UpdateBody(func(b *messages.KDCReqBody) {
+		b.SetTimes(cl.now(), cl.Config)
+	}, tgt, sessionKey)
+}
+
+// exchangeClock returns the clock for an exchange with the KDCs of the realm. If the exchange is being retried for
+// clock skew this is the client's clock corrected by the KDC's time given in its error, which is only used for that
+// retry as the error is not authenticated.
+func (cl *Client) exchangeClock(ctx context.Context, realm string) clock.Clock {
+	if d, ok := skewRetryOffset(ctx, realm); ok {
+		return offsetClock(cl.settings.Clock(), d)
+	}
+	return cl.clock()
+}
+
+// retryForSkew returns the context with which to retry the exchange with the KDCs of the realm, and true, if the
+// KRB_ERROR reports that the client's time is too far from the KDC's. The retry uses the KDC's time given by the error
+// but the offset is not recorded for other exchanges, as the error is not authenticated. An exchange is only retried
+// once. A KDC_ERR_PREAUTH_FAILED is only taken to be due to the client's clock if the KDC's time is beyond the
+// configured clock skew of the client's corrected time, as some KDCs report a skewed pre-authentication timestamp as
+// such. Exchanges are not retried if kdc_timesync is disabled in the krb5.conf.
+func (cl *Client) retryForSkew(ctx context.Context, realm string, e messages.KRBError) (context.Context, bool) {
+	if cl.Config.LibDefaults.KDCTimeSync == 0 {
+		return ctx, false
+	}
+	if _, ok := skewRetryOffset(ctx, realm); ok {
+		return ctx, false
+	}
+	var min time.Duration
+	switch e.ErrorCode {
+	case errorcode.KRB_AP_ERR_SKEW:
+		min = minClockCorrection
+	case errorcode.KDC_ERR_PREAUTH_FAILED:
+		min = cl.Config.LibDefaults.Clockskew
+	default:
+		return ctx, false
+	}
+	kdc := e.STime.Add(time.Duration(e.Susec) * time.Microsecond)
+	skew := kdc.Sub(cl.now())
+	if skew < min && skew > -min {
+		return ctx, false
+	}
+	d := kdc.Sub(cl.settings.Clock().Now())
+	cl.Log("clock skew of %v with the KDC of realm %s, retrying with the client's time corrected by %v", skew, realm, d)
+	return context.WithValue(ctx, skewRetryKey{}, skewRetry{realm: realm, offset: d}), true
+}
+
+// syncClock records the offset of the KDC's clock from the client's given by the KDC's time in an authenticated reply,
+// which is then applied to the times of the client's requests and those it checks tickets against. Offsets smaller
+// than minClockCorrection are not corrected for. The offset is not recorded if kdc_timesync is disabled in the
+// krb5.conf.
+func (cl *Client) syncClock(kdc time.Time, realm string) {
+	if cl.Config.LibDefaults.KDCTimeSync == 0 {
+		return
+	}
+	d := kdc.Sub(cl.settings.Clock().Now())
+	if d < minClockCorrection && d > -minClockCorrection {
+		d = 0
+	}
+	if d != cl.kdcHealth.clockOffset() {
+		cl.Log("clock offset of %v from the KDC of realm %s, correcting the client's time", d, realm)
+	}
+	cl.kdcHealth.setClockOffset(d)
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_RetryForSkew(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), Clock(clock.NewFake(now)))
+	krbError := func(code int32, t time.Time) messages.KRBError {
+		e := messages.NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", code, "")
+		e.STime = t
+		e.Susec = 0
+		return e
+	}
+	ctx := context.Background()
+
+	_, ok := cl.retryForSkew(ctx, "TEST.GOKRB5", krbError(errorcode.KDC_ERR_PREAUTH_FAILED, now.Add(time.Minute)))
+	assert.False(t, ok, "pre-authentication failure within the clock skew should not be retried")
+	_, ok = cl.retryForSkew(ctx, "TEST.GOKRB5", krbError(errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, now.Add(time.Hour)))
+	assert.False(t, ok, "errors other than for skew should not be retried")
+
+	rctx, ok := cl.retryForSkew(ctx, "TEST.GOKRB5", krbError(errorcode.KRB_AP_ERR_SKEW, now.Add(time.Hour)))
+	assert.True(t, ok, "skew should be retried")
+	assert.Equal(t, now.Add(time.Hour), cl.exchangeClock(rctx, "TEST.GOKRB5").Now(), "retry not timed with the KDC's time")
+	assert.Equal(t, now, cl.exchangeClock(rctx, "OTHER.GOKRB5").Now(), "retry time should only apply to the realm's KDCs")
+	assert.Equal(t, now, cl.now(), "time of the unauthenticated error should not be recorded")
+	_, ok = cl.retryForSkew(rctx, "TEST.GOKRB5", krbError(errorcode.KRB_AP_ERR_SKEW, now.Add(2*time.Hour)))
+	assert.False(t, ok, "exchange should only be retried once")
+
+	rctx, ok = cl.retryForSkew(ctx, "TEST.GOKRB5", krbError(errorcode.KDC_ERR_PREAUTH_FAILED, now.Add(-time.Hour)))
+	assert.True(t, ok, "pre-authentication failure beyond the clock skew should be retried")
+	assert.Equal(t, now.Add(-time.Hour), cl.exchangeClock(rctx, "TEST.GOKRB5").Now(), "retry not timed with the KDC's time")
+
+	c := config.New()
+	c.LibDefaults.KDCTimeSync = 0
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, Clock(clock.NewFake(now)))
+	_, ok = cl.retryForSkew(ctx, "TEST.GOKRB5", krbError(errorcode.KRB_AP_ERR_SKEW, now.Add(time.Hour)))
+	assert.False(t, ok, "skew should not be retried without kdc_timesync")
+}
+
+func TestClient_SyncClock(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), Clock(clock.NewFake(now)))
+
+	cl.syncClock(now.Add(500*time.Millisecond), "TEST.GOKRB5")
+	assert.Equal(t, now, cl.now(), "offset below the minimum correction should not be corrected for")
+	cl.syncClock(now.Add(time.Hour), "TEST.GOKRB5")
+	assert.Equal(t, now.Add(time.Hour), cl.now(), "time not corrected by the KDC's offset")
+	assert.Equal(t, now.Add(time.Hour), cl.exchangeClock(context.Background(), "TEST.GOKRB5").Now(),
+		"exchanges not timed with the corrected time")
+	cl.syncClock(now, "TEST.GOKRB5")
+	assert.Equal(t, now, cl.now(), "offset should be reset once the clocks agree")
+
+	c := config.New()
+	c.LibDefaults.KDCTimeSync = 0
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, Clock(clock.NewFake(now)))
+	cl.syncClock(now.Add(time.Hour), "TEST.GOKRB5")
+	assert.Equal(t, now, cl.now(), "time should not be corrected without kdc_timesync")
+}
+
+func TestClient_TimeTGSReq(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := config.New()
+	c.LibDefaults.TicketLifetime = 10 * time.Hour
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, Clock(clock.NewFake(now)))
+	tgt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(2, "krbtgt/TEST.GOKRB5"),
+	}
+	sessionKey := types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)}
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName(), "TEST.GOKRB5", cl.Config, tgt, sessionKey,
+		types.NewPrincipalName(2, "HTTP/host.test.gokrb5"), false)
+	if err != nil {
+		t.Fatalf("error creating TGS_REQ: %v", err)
+	}
+	if err := cl.timeTGSReq(&tgsReq, tgt, sessionKey); err != nil {
+		t.Fatalf("error timing TGS_REQ: %v", err)
+	}
+	assert.Equal(t, now.Add(10*time.Hour), tgsReq.ReqBody.Till, "end time should be relative to the client's clock")
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+)
+
+// NewCorrelationID returns a random correlation ID for an authentication attempt.
+func NewCorrelationID() string {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return id
+}
+
+// WithCorrelationID returns a client for a single authentication attempt that adds the correlation ID to its log lines
+// and to the errors returned from Login, AffirmLogin, GetServiceTicket, GetServiceTickets and ChangePasswd, and from
+// the SPNEGO functions using the client. If the ID is empty a random one is generated.
+//
+// The client returned shares its credentials, configuration, sessions and ticket cache with cl, so it should not be
+// destroyed while cl is still in use.
+func (cl *Client) WithCorrelationID(id string) *Client {
+	if id == "" {
+		id = NewCorrelationID()
+	}
+	s := *cl.settings
+	s.correlationID = id
+	c := *cl
+	c.settings = &s
+	return &c
+}
+
+// CorrelationID returns the correlation ID of the client or an empty string if it has none.
+func (cl *Client) CorrelationID() string {
+	return cl.settings.CorrelationID()
+}
+
+// correlate annotates the error with the client's correlation ID.
+func (cl *Client) correlate(err error) error {
+	return krberror.WithCorrelationID(err, cl.settings.CorrelationID())
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/logging"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/metrics"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_WithCorrelationID(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+	var buf bytes.Buffer
+	cl.settings.logger = log.New(&buf, "", 0)
+	var exchanges []metrics.Exchange
+	var requests []metrics.KDCRequest
+	cl.settings.metrics = metrics.Hooks{
+		Exchange:   func(e metrics.Exchange) { exchanges = append(exchanges, e) },
+		KDCRequest: func(r metrics.KDCRequest) { requests = append(requests, r) },
+	}
+
+	acl := cl.WithCorrelationID("attempt-1")
+	assert.Equal(t, "attempt-1", acl.CorrelationID(), "correlation ID not as expected")
+	assert.Equal(t, "", cl.CorrelationID(), "original client should not have a correlation ID")
+	assert.NotEqual(t, "", cl.WithCorrelationID("").CorrelationID(), "correlation ID should be generated")
+
+	_, _, err := acl.GetServiceTicket("HTTP/host1.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	assert.Contains(t, buf.String(), "[Correlation ID: attempt-1] ticket added to cache for HTTP/host1.test.gokrb5", "log line not annotated")
+	_, _, ok := cl.GetCachedTicket("HTTP/host1.test.gokrb5")
+	assert.True(t, ok, "ticket cache should be shared with the original client")
+	if assert.Len(t, exchanges, 1, "exchanges not as expected") && assert.Len(t, requests, 1, "KDC requests not as expected") {
+		assert.Equal(t, "attempt-1", exchanges[0].CorrelationID, "exchange correlation ID not as expected")
+		assert.Equal(t, "attempt-1", requests[0].CorrelationID, "KDC request correlation ID not as expected")
+	}
+
+	_, _, err = acl.GetServiceTicket("HTTP/unknown.test.gokrb5")
+	assert.Equal(t, "attempt-1", krberror.CorrelationID(err), "error not annotated")
+	assert.True(t, errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN}), "error should still match the KDC error code")
+	_, _, err = cl.GetServiceTicket("HTTP/unknown.test.gokrb5")
+	assert.Equal(t, "", krberror.CorrelationID(err), "error of the original client should not be annotated")
+
+	results := acl.GetServiceTickets(context.Background(), []string{"HTTP/unknown.test.gokrb5"})
+	assert.Equal(t, "attempt-1", krberror.CorrelationID(results["HTTP/unknown.test.gokrb5"].Err), "error not annotated")
+}
+
+func TestClient_StructuredLogger(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+	var buf bytes.Buffer
+	cl.settings.structuredLogger = logging.NewTextLogger(log.New(&buf, "", 0), logging.LevelTrace)
+
+	_, _, err := cl.WithCorrelationID("attempt-2").GetServiceTicket("HTTP/host1.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	out := buf.String()
+	assert.Contains(t, out, "[Correlation ID: attempt-2] TRACE: sent to KDC realm=TEST.GOKRB5 transport=TCP", "sent message not traced")
+	assert.Contains(t, out, "krb_message=\"TGS-REQ", "message summary not traced")
+	assert.Contains(t, out, "[Correlation ID: attempt-2] DEBUG: KDC exchange realm=TEST.GOKRB5 kdc="+kdc.Addr().String()+" transport=TCP duration=", "exchange not logged")
+	assert.Contains(t, out, "[Correlation ID: attempt-2] ticket added to cache for HTTP/host1.test.gokrb5", "info message not logged")
+
+	buf.Reset()
+	cl.settings.structuredLogger = logging.NewTextLogger(log.New(&buf, "", 0), logging.LevelInfo)
+	_, _, err = cl.GetServiceTicket("HTTP/host2.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	assert.NotContains(t, buf.String(), "DEBUG", "debug messages should not be logged at info level")
+	assert.NotContains(t, buf.String(), "TRACE", "trace messages should not be logged at info level")
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// DebugSnapshot is a point in time view of the internal state of a client for operators investigating a client in
+// production. It does not include any tickets or keys so it can be exposed on a debug endpoint.
+type DebugSnapshot struct {
+	// CorrelationID of the client, if it has one.
+	CorrelationID string `json:",omitempty"`
+	// Sessions holds the TGT sessions of the client sorted by realm.
+	Sessions []SessionInfo
+	// Tickets holds the service ticket cache entries sorted by SPN. The tickets and session keys are not marshaled.
+	Tickets []CacheEntry
+	// Credentials lists the TGTs and cached service tickets as ListCredentials does.
+	Credentials []CredentialInfo
+	// IdleKDCConnections is the number of idle UDP sockets held open for reuse for each KDC address.
+	IdleKDCConnections map[string]int
+	// IdleKDCTCPConnections is the number of idle TCP connections held open for reuse for each KDC address.
+	IdleKDCTCPConnections map[string]int
+}
+
+// DebugSnapshot returns a snapshot of the client's sessions, cached service tickets and KDC connection pool.
+func (cl *Client) DebugSnapshot() DebugSnapshot {
+	return DebugSnapshot{
+		CorrelationID:         cl.settings.CorrelationID(),
+		Sessions:              cl.sessions.info(),
+		Tickets:               cl.cachedEntries(),
+		Credentials:           cl.ListCredentials(),
+		IdleKDCConnections:    cl.udpConns.idle(),
+		IdleKDCTCPConnections: cl.tcpConns.idle(),
+	}
+}
+
+// DebugHandler returns a http.Handler that responds with the client's DebugSnapshot in a JSON format.
+//
+// The handler should only be served on an endpoint restricted to operators. While keys are not included, the snapshot
+// reveals the services the client has authenticated to.
+func (cl *Client) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.MarshalIndent(cl.DebugSnapshot(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
+
+// CredentialInfo describes a TGT or service ticket held by a client, as klist lists the credentials of a cache. The
+// ticket and session key are not included.
+type CredentialInfo struct {
+	// Client is the client principal name of the ticket with its realm.
+	Client string
+	// Server is the service principal name of the ticket with its realm.
+	Server string
+	// SPN is the name the ticket is cached under, which differs from the Server of a ticket cached for an alias.
+	SPN string `json:",omitempty"`
+	// TGT indicates if the ticket is a TGT session.
+	TGT       bool
+	AuthTime  time.Time
+	StartTime time.Time
+	EndTime   time.Time
+	RenewTill time.Time
+	// Flags are the names of the ticket flags set, such as "forwardable" and "ok-as-delegate".
+	Flags []string
+	// TicketEType is the encryption type of the ticket's encrypted part.
+	TicketEType string
+	// SessionKeyEType is the encryption type of the session key.
+	SessionKeyEType string
+	// KVNO is the key version number of the service key the ticket is encrypted with.
+	KVNO int
+	// Expired indicates if the ticket has expired by the client's clock.
+	Expired bool
+}
+
+// ListCredentials returns the details of the client's TGT sessions, sorted by realm, followed by those of its cached
+// service tickets, sorted by SPN.
+func (cl *Client) ListCredentials() []CredentialInfo {
+	now := cl.now()
+	sessions := cl.sessions.all()
+	realms := make([]string, 0, len(sessions))
+	for realm := range sessions {
+		realms = append(realms, realm)
+	}
+	sort.Strings(realms)
+	var cs []CredentialInfo
+	for _, realm := range realms {
+		st := sessions[realm].snapshot()
+		c := cl.credentialInfo(st.tgt, st.sessionKey, st.flags)
+		c.TGT = true
+		c.AuthTime, c.StartTime, c.EndTime, c.RenewTill = st.authTime, st.startTime, st.endTime, st.renewTill
+		c.Expired = now.After(st.endTime)
+		cs = append(cs, c)
+	}
+	for _, e := range cl.cachedEntries() {
+		c := cl.credentialInfo(e.Ticket, e.SessionKey, e.Flags)
+		if e.SPN != e.Ticket.SName.PrincipalNameString() {
+			c.SPN = e.SPN
+		}
+		c.AuthTime, c.StartTime, c.EndTime, c.RenewTill = e.AuthTime, e.StartTime, e.EndTime, e.RenewTill
+		c.Expired = now.After(e.EndTime)
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+// credentialInfo returns the details of the ticket and session key that do not depend on where it is held.
+func (cl *Client) credentialInfo(tkt messages.Ticket, key types.EncryptionKey, f asn1.BitString) CredentialInfo {
+	return CredentialInfo{
+		Client:          cl.Credentials.CName().PrincipalNameString() + "@" + cl.Credentials.Domain(),
+		Server:          tkt.SName.PrincipalNameString() + "@" + tkt.Realm,
+		Flags:           ticketFlagNames(f),
+		TicketEType:     etypeID.Name(tkt.EncPart.EType),
+		SessionKeyEType: etypeID.Name(key.KeyType),
+		KVNO:            tkt.EncPart.KVNO,
+	}
+}
+
+// ticketFlagNamesByBit are the names of the ticket flags, RFC 4120 section 5.3, as MIT krb5 names them.
+var ticketFlagNamesByBit = map[int]string{
+	flags.Forwardable:            "forwardable",
+	flags.Forwarded:              "forwarded",
+	flags.Proxiable:              "proxiable",
+	flags.Proxy:                  "proxy",
+	flags.MayPostDate:            "may-postdate",
+	flags.PostDated:              "postdated",
+	flags.Invalid:                "invalid",
+	flags.Renewable:              "renewable",
+	flags.Initial:                "initial",
+	flags.PreAuthent:             "pre-authent",
+	flags.HWAuthent:              "hw-authent",
+	flags.TransitedPolicyChecked: "transit-policy-checked",
+	flags.OKAsDelegate:           "ok-as-delegate",
+	flags.Anonymous:              "anonymous",
+	flags.EncPARep:               "enc-pa-rep",
+}
+
+// ticketFlagNames returns the names of the ticket flags set, in order of their bits.
+func ticketFlagNames(f asn1.BitString) []string {
+	var names []string
+	for i := 0; i < f.BitLength; i++ {
+		if f.At(i) != 1 {
+			continue
+		}
+		if n, ok := ticketFlagNamesByBit[i]; ok {
+			names = append(names, n)
+		} else {
+			names = append(names, fmt.Sprintf("bit %d", i))
+		}
+	}
+	return names
+}
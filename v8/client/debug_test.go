@@ -0,0 +1,115 @@
+package client
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_DebugSnapshot(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("user", "TEST.GOKRB5", "passwordvalue", config.New(), CorrelationID("debug-test"))
+	cl.sessions.update(newSession("TEST.GOKRB5", &sessionState{
+		authTime:   time.Unix(0, 0).UTC(),
+		endTime:    time.Unix(10, 0).UTC(),
+		sessionKey: types.EncryptionKey{KeyType: 18, KeyValue: []byte("tgtsessionkey")},
+	}))
+	tkt := messages.Ticket{SName: types.NewPrincipalName(2, "HTTP/host.test.gokrb5")}
+	cl.cache.addEntry(tkt, time.Unix(0, 0).UTC(), time.Unix(0, 0).UTC(), time.Unix(10, 0).UTC(), time.Unix(20, 0).UTC(),
+		types.EncryptionKey{KeyType: 18, KeyValue: []byte("servicesessionkey")}, types.NewKrbFlags())
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	cl.udpConns.put("127.0.0.1:88", conn)
+	defer cl.udpConns.close()
+
+	s := cl.DebugSnapshot()
+	assert.Equal(t, "debug-test", s.CorrelationID, "correlation ID not as expected")
+	if assert.Len(t, s.Sessions, 1, "number of sessions not as expected") {
+		assert.Equal(t, "TEST.GOKRB5", s.Sessions[0].Realm, "session realm not as expected")
+	}
+	if assert.Len(t, s.Tickets, 1, "number of tickets not as expected") {
+		assert.Equal(t, "HTTP/host.test.gokrb5", s.Tickets[0].SPN, "ticket SPN not as expected")
+	}
+	assert.Equal(t, map[string]int{"127.0.0.1:88": 1}, s.IdleKDCConnections, "idle KDC connections not as expected")
+
+	w := httptest.NewRecorder()
+	cl.DebugHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/kerberos", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "content type not as expected")
+	body := w.Body.String()
+	assert.False(t, strings.Contains(body, "sessionkey"), "snapshot should not include keys: %s", body)
+	var js DebugSnapshot
+	err = json.Unmarshal(w.Body.Bytes(), &js)
+	if err != nil {
+		t.Fatalf("error unmarshaling snapshot: %v", err)
+	}
+	assert.Equal(t, s.Sessions, js.Sessions, "sessions in handler response not as expected")
+	assert.Equal(t, s.IdleKDCConnections, js.IdleKDCConnections, "idle KDC connections in handler response not as expected")
+}
+
+func TestClient_ListCredentials(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("user", "TEST.GOKRB5", "passwordvalue", config.New())
+	now := time.Now().UTC()
+	tgtFlags := types.NewKrbFlags()
+	types.SetFlags(&tgtFlags, []int{flags.Forwardable, flags.Renewable, flags.Initial, flags.PreAuthent})
+	cl.sessions.update(newSession("TEST.GOKRB5", &sessionState{
+		authTime:   now,
+		startTime:  now,
+		endTime:    now.Add(time.Hour),
+		renewTill:  now.Add(24 * time.Hour),
+		tgt:        messages.Ticket{Realm: "TEST.GOKRB5", SName: types.NewPrincipalName(2, "krbtgt/TEST.GOKRB5"), EncPart: types.EncryptedData{EType: 18, KVNO: 2}},
+		sessionKey: types.EncryptionKey{KeyType: 18, KeyValue: []byte("tgtsessionkey")},
+		flags:      tgtFlags,
+	}))
+	tktFlags := types.NewKrbFlags()
+	types.SetFlags(&tktFlags, []int{flags.Forwardable, flags.OKAsDelegate})
+	tkt := messages.Ticket{Realm: "TEST.GOKRB5", SName: types.NewPrincipalName(2, "HTTP/host.test.gokrb5"), EncPart: types.EncryptedData{EType: 17, KVNO: 5}}
+	cl.cache.addEntry(tkt, now.Add(-2*time.Hour), now.Add(-2*time.Hour), now.Add(-time.Hour), now.Add(-time.Hour),
+		types.EncryptionKey{KeyType: 23, KeyValue: []byte("servicesessionkey")}, tktFlags)
+	cl.cache.addAlias("HTTP/alias.test.gokrb5", "HTTP/host.test.gokrb5")
+
+	cs := cl.ListCredentials()
+	if !assert.Len(t, cs, 3, "number of credentials not as expected") {
+		return
+	}
+	assert.Equal(t, CredentialInfo{
+		Client:          "user@TEST.GOKRB5",
+		Server:          "krbtgt/TEST.GOKRB5@TEST.GOKRB5",
+		TGT:             true,
+		AuthTime:        now,
+		StartTime:       now,
+		EndTime:         now.Add(time.Hour),
+		RenewTill:       now.Add(24 * time.Hour),
+		Flags:           []string{"forwardable", "renewable", "initial", "pre-authent"},
+		TicketEType:     "aes256-cts-hmac-sha1-96",
+		SessionKeyEType: "aes256-cts-hmac-sha1-96",
+		KVNO:            2,
+	}, cs[0], "TGT not as expected")
+	assert.Equal(t, "HTTP/alias.test.gokrb5", cs[1].SPN, "alias SPN not as expected")
+	assert.Equal(t, "HTTP/host.test.gokrb5@TEST.GOKRB5", cs[1].Server, "alias server not as expected")
+	assert.Equal(t, "", cs[2].SPN, "SPN of ticket not cached under an alias should be empty")
+	assert.Equal(t, []string{"forwardable", "ok-as-delegate"}, cs[2].Flags, "flags not as expected")
+	assert.Equal(t, "aes128-cts-hmac-sha1-96", cs[2].TicketEType, "ticket etype not as expected")
+	assert.Equal(t, "arcfour-hmac", cs[2].SessionKeyEType, "session key etype not as expected")
+	assert.Equal(t, 5, cs[2].KVNO, "kvno not as expected")
+	assert.True(t, cs[2].Expired, "ticket should be expired")
+	assert.False(t, cs[0].Expired, "TGT should not be expired")
+
+	b, err := json.Marshal(cl.DebugSnapshot())
+	if err != nil {
+		t.Fatalf("error marshaling snapshot: %v", err)
+	}
+	assert.Contains(t, string(b), `"Flags":["forwardable","ok-as-delegate"]`, "snapshot should include the credentials")
+	assert.NotContains(t, string(b), "sessionkey", "snapshot should not include keys")
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+// NewFromEnvironment creates a client as programs linked with MIT krb5 would, from the standard Kerberos environment
+// variables. The configuration is loaded with config.LoadDefault, from the krb5.conf files of KRB5_CONFIG. The client
+// uses the credential cache of KRB5CCNAME if it holds a TGT, otherwise it logs in with the first principal of the
+// client keytab of KRB5_CLIENT_KTNAME, or of the krb5.conf default_client_keytab_name. The default locations are used
+// for the variables not set.
+func NewFromEnvironment(settings ...func(*Settings)) (*Client, error) {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return nil, err
+	}
+	cc, err := credentials.LoadDefaultCCache()
+	if err == nil {
+		var cl *Client
+		cl, err = NewFromCCache(cc, cfg, settings...)
+		if err == nil {
+			return cl, nil
+		}
+	}
+	name := os.Getenv(keytab.ClientKeytabEnvVar)
+	if name == "" {
+		name = cfg.LibDefaults.DefaultClientKeytabName
+	}
+	kt, kerr := keytab.LoadName(name)
+	if kerr != nil {
+		return nil, fmt.Errorf("no credential cache (%v) or client keytab (%v) in the environment", err, kerr)
+	}
+	if len(kt.Entries) < 1 {
+		return nil, fmt.Errorf("no credential cache (%v) in the environment and client keytab %s is empty", err, name)
+	}
+	p := kt.Entries[0].Principal
+	return NewWithKeytab(strings.Join(p.Components, "/"), p.Realm, kt, cfg, settings...), nil
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// LifecycleEvents are the callbacks a client calls with the events of the lifecycle of its tickets, so that applications can
+// alert when credentials are about to lapse or a KDC starts failing rather than discovering it through the errors of
+// requests. Any of them may be nil. They are called synchronously, including on the client's renewal goroutines, so
+// must be safe for concurrent use and should not block.
+type LifecycleEvents struct {
+	// OnLogin is called when the client obtains a TGT for its realm with an AS exchange.
+	OnLogin func(TicketEvent)
+	// OnTGTRenewed is called when a TGT session is renewed.
+	OnTGTRenewed func(TicketEvent)
+	// OnRenewalFailed is called when the background renewal of a TGT session or cached service ticket fails. The
+	// renewal is retried while the ticket is valid, until the EndTime of the event.
+	OnRenewalFailed func(TicketEvent)
+	// OnServiceTicket is called when a service ticket is obtained from the KDC and added to the cache.
+	OnServiceTicket func(TicketEvent)
+}
+
+// TicketEvent describes the ticket of a lifecycle event.
+type TicketEvent struct {
+	// SPN is the name of the ticket, krbtgt/REALM for a TGT.
+	SPN       string
+	Realm     string
+	AuthTime  time.Time
+	EndTime   time.Time
+	RenewTill time.Time
+	// Err is the error of a failed renewal.
+	Err error
+	// CorrelationID of the client, if it has one.
+	CorrelationID string
+}
+
+// ticketEvent returns the event of the ticket issued with the encrypted part of the KDC's reply.
+func (cl *Client) ticketEvent(tkt messages.Ticket, dep messages.EncKDCRepPart) TicketEvent {
+	return TicketEvent{
+		SPN:           tkt.SName.PrincipalNameString(),
+		Realm:         tkt.Realm,
+		AuthTime:      dep.AuthTime,
+		EndTime:       dep.EndTime,
+		RenewTill:     dep.RenewTill,
+		CorrelationID: cl.settings.CorrelationID(),
+	}
+}
+
+// onLogin calls the login callback, if one is configured.
+func (cl *Client) onLogin(tkt messages.Ticket, dep messages.EncKDCRepPart) {
+	if f := cl.settings.Events().OnLogin; f != nil {
+		f(cl.ticketEvent(tkt, dep))
+	}
+}
+
+// onTGTRenewed calls the TGT renewal callback, if one is configured.
+func (cl *Client) onTGTRenewed(tkt messages.Ticket, dep messages.EncKDCRepPart) {
+	if f := cl.settings.Events().OnTGTRenewed; f != nil {
+		f(cl.ticketEvent(tkt, dep))
+	}
+}
+
+// onRenewalFailed calls the renewal failure callback, if one is configured, with the error of renewing the ticket of
+// the SPN that is valid until the end time.
+func (cl *Client) onRenewalFailed(spn, realm string, endTime time.Time, err error) {
+	if f := cl.settings.Events().OnRenewalFailed; f != nil {
+		f(TicketEvent{SPN: spn, Realm: realm, EndTime: endTime, Err: err, CorrelationID: cl.settings.CorrelationID()})
+	}
+}
+
+// onServiceTicket calls the service ticket callback, if one is configured and the ticket is not a TGT.
+func (cl *Client) onServiceTicket(tkt messages.Ticket, dep messages.EncKDCRepPart) {
+	f := cl.settings.Events().OnServiceTicket
+	if f == nil || len(tkt.SName.NameString) < 1 || strings.EqualFold(tkt.SName.NameString[0], "krbtgt") {
+		return
+	}
+	f(cl.ticketEvent(tkt, dep))
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Events(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	var mux sync.Mutex
+	var tickets, renewed []TicketEvent
+	failures := make(chan TicketEvent, 10)
+	cl := testTGSClient(t, kdc.Addr().String(), skey, CorrelationID("events-test"), AutoRenewal(RenewalPolicy{}), Events(LifecycleEvents{
+		OnServiceTicket: func(e TicketEvent) {
+			mux.Lock()
+			defer mux.Unlock()
+			tickets = append(tickets, e)
+		},
+		OnTGTRenewed: func(e TicketEvent) {
+			mux.Lock()
+			defer mux.Unlock()
+			renewed = append(renewed, e)
+		},
+		OnRenewalFailed: func(e TicketEvent) {
+			failures <- e
+		},
+	}))
+	defer cl.Destroy()
+
+	if _, _, err := cl.GetServiceTicket("HTTP/host1.test.gokrb5"); err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	if _, _, err := cl.GetServiceTicket("HTTP/host1.test.gokrb5"); err != nil {
+		t.Fatalf("error getting cached service ticket: %v", err)
+	}
+	s, _ := cl.sessions.get("TEST.GOKRB5")
+	assert.NoError(t, cl.renewTGT(context.Background(), s), "error renewing TGT")
+	mux.Lock()
+	if assert.Len(t, tickets, 1, "service ticket events not as expected") {
+		assert.Equal(t, "HTTP/host1.test.gokrb5", tickets[0].SPN, "SPN not as expected")
+		assert.Equal(t, "TEST.GOKRB5", tickets[0].Realm, "realm not as expected")
+		assert.Equal(t, "events-test", tickets[0].CorrelationID, "correlation ID not as expected")
+		assert.False(t, tickets[0].EndTime.IsZero(), "end time not set")
+	}
+	if assert.Len(t, renewed, 1, "TGT renewal events not as expected") {
+		assert.Equal(t, "krbtgt/TEST.GOKRB5", renewed[0].SPN, "SPN not as expected")
+	}
+	mux.Unlock()
+
+	// The background renewal of a ticket the KDC does not issue fails.
+	now := time.Now().UTC()
+	start, end := now.Add(-50*time.Minute), now.Add(10*time.Minute)
+	tkt := messages.Ticket{Realm: "TEST.GOKRB5", SName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/unknown.test.gokrb5")}
+	cl.cache.addEntry(tkt, start, start, end, end, skey, types.NewKrbFlags())
+	cl.scheduleRenewal()
+	select {
+	case e := <-failures:
+		assert.Equal(t, "HTTP/unknown.test.gokrb5", e.SPN, "SPN not as expected")
+		assert.Equal(t, end, e.EndTime, "end time not as expected")
+		assert.Error(t, e.Err, "error not set")
+	case <-time.After(5 * time.Second):
+		t.Fatal("renewal failure callback not called")
+	}
+}
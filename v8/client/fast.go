@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/fast"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/pkinit"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// asArmor returns the FAST armor for an AS exchange with the realm from the armor client's TGT. It is nil if the
+// client is not configured with FAST armor.
+func (cl *Client) asArmor(ctx context.Context, realm string) (*fast.Armor, error) {
+	armor := cl.settings.FASTArmor()
+	if armor == nil {
+		return nil, nil
+	}
+	tgt, sessionKey, err := armor.sessionTGT(ctx, realm)
+	if err != nil {
+		return nil, fmt.Errorf("could not get armor TGT for %s: %w", realm, err)
+	}
+	crealm := armor.Credentials.Domain()
+	if armor.anonymous() {
+		// An anonymous armor TGT is issued to the anonymous realm.
+		crealm = pkinit.AnonymousRealm
+	}
+	return fast.NewASArmor(tgt, sessionKey, crealm, armor.Credentials.CName())
+}
+
+// marshalASReq marshals the AS_REQ, armoring it first if the armor is not nil.
+func marshalASReq(ASReq messages.ASReq, fa *fast.Armor) ([]byte, error) {
+	if fa != nil {
+		var err error
+		ASReq.KDCReqFields, err = fa.Request(ASReq.KDCReqFields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ASReq.Marshal()
+}
+
+// marshalTGSReq marshals the TGS_REQ, armoring it first with the TGT if the client is configured with FAST armor.
+// The armor returned is nil if the request is not armored.
+func (cl *Client) marshalTGSReq(ctx context.Context, tgsReq *messages.TGSReq, tgt messages.Ticket, sessionKey types.EncryptionKey) ([]byte, *fast.Armor, error) {
+	// The PA data other than the PA-TGS-REQ is not covered by the authenticator's checksum.
+	if err := cl.addPACRequest(&tgsReq.PAData); err != nil {
+		return nil, nil, err
+	}
+	if _, retry := skewRetryOffset(ctx, tgsReq.ReqBody.Realm); retry || !cl.systemTimed() {
+		// Time the authenticator with the client's clock corrected for its skew from the KDCs' clock.
+		if err := tgsReq.SetClock(cl.exchangeClock(ctx, tgsReq.ReqBody.Realm), tgt, sessionKey); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cl.settings.FASTArmor() == nil {
+		b, err := tgsReq.Marshal()
+		return b, nil, err
+	}
+	fa, err := fast.NewTGSArmor(tgsReq, tgt, sessionKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	req := *tgsReq
+	req.KDCReqFields, err = fa.Request(tgsReq.KDCReqFields)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := req.Marshal()
+	return b, fa, err
+}
+
+// fastError returns the KRB_ERROR within the KDC's FAST response if the request was armored.
+func fastError(fa *fast.Armor, e messages.KRBError) (messages.KRBError, error) {
+	if fa == nil {
+		return e, nil
+	}
+	return fa.Error(e)
+}
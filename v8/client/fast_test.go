@@ -0,0 +1,194 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/fast"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_FASTArmor(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.DNSLookupKDC = true
+	armor := NewWithPassword("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", c)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, FASTArmor(armor))
+	assert.Equal(t, armor, cl.settings.FASTArmor(), "FAST armor client not as expected")
+
+	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	err = setPAData(context.Background(), cl, nil, &ASReq, nil)
+	if err != nil {
+		t.Fatalf("error setting PA data: %v", err)
+	}
+	assert.False(t, ASReq.PAData.Contains(patype.PA_REQ_ENC_PA_REP), "FAST negotiation should not be requested when armored")
+
+	sessionKey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	tgt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		EncPart: types.EncryptedData{
+			EType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+			Cipher: []byte{1, 2, 3, 4},
+		},
+	}
+	spn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName(), "TEST.GOKRB5", cl.Config, tgt, sessionKey, spn, false)
+	if err != nil {
+		t.Fatalf("error creating TGS_REQ: %v", err)
+	}
+	b, fa, err := cl.marshalTGSReq(context.Background(), &tgsReq, tgt, sessionKey)
+	if err != nil {
+		t.Fatalf("error marshaling armored TGS_REQ: %v", err)
+	}
+	if assert.NotNil(t, fa, "FAST armor not returned") {
+		assert.NotEmpty(t, fa.SubKey().KeyValue, "armored TGS_REQ should have a subkey")
+	}
+	var req messages.TGSReq
+	err = req.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling armored TGS_REQ: %v", err)
+	}
+	if assert.Len(t, req.PAData, 2, "armored TGS_REQ PA data not as expected") {
+		assert.Equal(t, patype.PA_TGS_REQ, req.PAData[0].PADataType, "first PA data should be the PA-TGS-REQ")
+		assert.Equal(t, patype.PA_FX_FAST, req.PAData[1].PADataType, "second PA data should be the PA-FX-FAST")
+	}
+
+	pcl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c)
+	_, fa, err = pcl.marshalTGSReq(context.Background(), &tgsReq, tgt, sessionKey)
+	assert.NoError(t, err)
+	assert.Nil(t, fa, "TGS_REQ should not be armored without a FAST armor client")
+}
+
+func TestClient_setPAData_EncryptedChallenge(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.DNSLookupKDC = true
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, AssumePreAuthentication(true))
+	sessionKey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	tgt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		EncPart: types.EncryptedData{
+			EType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+			Cipher: []byte{1, 2, 3, 4},
+		},
+	}
+	fa, err := fast.NewASArmor(tgt, sessionKey, "TEST.GOKRB5", types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"))
+	if err != nil {
+		t.Fatalf("error creating FAST armor: %v", err)
+	}
+	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	info := testETypeInfo2PAData(t, types.ETypeInfo2Entry{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: "TEST.GOKRB5testuser1"})
+
+	// The encrypted timestamp is used if the KDC does not advertise the encrypted challenge
+	err = setPAData(context.Background(), cl, testKRBError(t, "TEST.GOKRB5", types.MethodData{{PADataType: patype.PA_ENC_TIMESTAMP}, info}), &ASReq, fa)
+	if err != nil {
+		t.Fatalf("error setting PA data: %v", err)
+	}
+	assert.True(t, ASReq.PAData.Contains(patype.PA_ENC_TIMESTAMP), "encrypted timestamp should be used")
+	assert.False(t, ASReq.PAData.Contains(patype.PA_ENCRYPTED_CHALLENGE), "encrypted challenge should not be used")
+
+	md := types.MethodData{{PADataType: patype.PA_ENC_TIMESTAMP}, {PADataType: patype.PA_ENCRYPTED_CHALLENGE}, info}
+	err = setPAData(context.Background(), cl, testKRBError(t, "TEST.GOKRB5", md), &ASReq, fa)
+	if err != nil {
+		t.Fatalf("error setting PA data: %v", err)
+	}
+	assert.True(t, ASReq.PAData.Contains(patype.PA_ENCRYPTED_CHALLENGE), "encrypted challenge should be preferred")
+	assert.False(t, ASReq.PAData.Contains(patype.PA_ENC_TIMESTAMP), "encrypted timestamp should be replaced")
+
+	// The encrypted challenge requires FAST armor
+	err = setPAData(context.Background(), cl, testKRBError(t, "TEST.GOKRB5", md), &ASReq, nil)
+	if err != nil {
+		t.Fatalf("error setting PA data: %v", err)
+	}
+	assert.True(t, ASReq.PAData.Contains(patype.PA_ENC_TIMESTAMP), "encrypted timestamp should be used without FAST armor")
+	assert.False(t, ASReq.PAData.Contains(patype.PA_ENCRYPTED_CHALLENGE), "encrypted challenge should be replaced")
+}
+
+func TestClient_setOTPPAData(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.DNSLookupKDC = true
+	var prompted fast.OTPChallenge
+	prompter := OTPPrompterFunc(func(ctx context.Context, challenge fast.OTPChallenge) (OTPResponse, error) {
+		prompted = challenge
+		return OTPResponse{Value: "123456"}, nil
+	})
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "", c, AssumePreAuthentication(true), OTP(prompter))
+	assert.True(t, cl.hasSecret(), "a client with an OTP prompter should be able to log in")
+	sessionKey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	tgt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		EncPart: types.EncryptedData{
+			EType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+			Cipher: []byte{1, 2, 3, 4},
+		},
+	}
+	fa, err := fast.NewASArmor(tgt, sessionKey, "TEST.GOKRB5", types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"))
+	if err != nil {
+		t.Fatalf("error creating FAST armor: %v", err)
+	}
+	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	ctx := context.Background()
+
+	// No timestamp is sent preemptively as the KDC's challenge is needed.
+	err = setPAData(context.Background(), cl, nil, &ASReq, fa)
+	if err != nil {
+		t.Fatalf("error setting PA data: %v", err)
+	}
+	assert.False(t, ASReq.PAData.Contains(patype.PA_ENC_TIMESTAMP), "encrypted timestamp should not be sent preemptively")
+
+	// The one-time password is not collected if the KDC does not offer OTP pre-authentication.
+	info := testETypeInfo2PAData(t, types.ETypeInfo2Entry{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: "TEST.GOKRB5testuser1"})
+	ok, err := cl.setOTPPAData(ctx, testKRBError(t, "TEST.GOKRB5", types.MethodData{{PADataType: patype.PA_ENC_TIMESTAMP}, info}), &ASReq, fa)
+	assert.NoError(t, err)
+	assert.False(t, ok, "OTP PA data should not be set without the KDC's challenge")
+
+	token := fast.OTPTokenInfo{Flags: types.NewKrbFlags(), TokenID: []byte("token1")}
+	ch := fast.OTPChallenge{Nonce: []byte("kdcnonce"), TokenInfo: []fast.OTPTokenInfo{token}}
+	b, err := ch.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling OTP challenge: %v", err)
+	}
+	md := types.MethodData{{PADataType: patype.PA_OTP_CHALLENGE, PADataValue: b}, info}
+	ok, err = cl.setOTPPAData(ctx, testKRBError(t, "TEST.GOKRB5", md), &ASReq, nil)
+	assert.NoError(t, err)
+	assert.False(t, ok, "OTP PA data should not be set without FAST armor")
+
+	ok, err = cl.setOTPPAData(ctx, testKRBError(t, "TEST.GOKRB5", md), &ASReq, fa)
+	if err != nil {
+		t.Fatalf("error setting OTP PA data: %v", err)
+	}
+	assert.True(t, ok, "OTP PA data should be set")
+	assert.Equal(t, ch.Nonce, prompted.Nonce, "prompter should be passed the KDC's challenge")
+	assert.True(t, ASReq.PAData.Contains(patype.PA_OTP_REQUEST), "PA-OTP-REQUEST should be added")
+	rk, err := fa.OTPReplyKey()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, rk.KeyValue, "reply key should be the armor key")
+
+	bad := NewWithPassword("testuser1", "TEST.GOKRB5", "", c, OTP(OTPPrompterFunc(func(ctx context.Context, challenge fast.OTPChallenge) (OTPResponse, error) {
+		return OTPResponse{Token: 1, Value: "123456"}, nil
+	})))
+	_, err = bad.setOTPPAData(ctx, testKRBError(t, "TEST.GOKRB5", md), &ASReq, fa)
+	assert.Error(t, err, "a one-time password for a token not in the challenge should be rejected")
+}
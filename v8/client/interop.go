@@ -0,0 +1,76 @@
+package client
+
+import (
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// lenientEData indicates if the profile tolerates the e-data and ETYPE-INFO variations of Samba and Heimdal KDCs.
+func (p Profile) lenientEData() bool {
+	return p == ProfileSamba || p == ProfileHeimdal
+}
+
+// kdcPAData returns the pre-authentication data from the e-data of a KRB_ERROR taking into account the
+// interoperability profile of the KDC's realm.
+func (cl *Client) kdcPAData(krberr *messages.KRBError) (types.PADataSequence, error) {
+	var pas types.PADataSequence
+	if !cl.settings.InteropProfileForRealm(krberr.Realm).lenientEData() {
+		err := pas.Unmarshal(krberr.EData)
+		return pas, err
+	}
+	// The METHOD-DATA may be wrapped in TYPED-DATA
+	md, err := krberr.MethodData()
+	if err != nil {
+		return pas, err
+	}
+	return supportedETypeInfo(types.PADataSequence(md)), nil
+}
+
+// supportedETypeInfo removes entries for encryption types that are not supported from the ETYPE-INFO2 and
+// ETYPE-INFO in the pre-authentication data. If no supported entries remain the PA-DATA is removed altogether.
+func supportedETypeInfo(pas types.PADataSequence) types.PADataSequence {
+	spas := make(types.PADataSequence, 0, len(pas))
+	for _, pa := range pas {
+		switch pa.PADataType {
+		case patype.PA_ETYPE_INFO2:
+			info, err := pa.GetETypeInfo2()
+			if err != nil {
+				break
+			}
+			var sinfo types.ETypeInfo2
+			for _, e := range info {
+				if _, err := crypto.GetEtype(e.EType); err == nil {
+					sinfo = append(sinfo, e)
+				}
+			}
+			if len(sinfo) < 1 {
+				continue
+			}
+			if b, err := asn1.Marshal(sinfo); err == nil {
+				pa.PADataValue = b
+			}
+		case patype.PA_ETYPE_INFO:
+			info, err := pa.GetETypeInfo()
+			if err != nil {
+				break
+			}
+			var sinfo types.ETypeInfo
+			for _, e := range info {
+				if _, err := crypto.GetEtype(e.EType); err == nil {
+					sinfo = append(sinfo, e)
+				}
+			}
+			if len(sinfo) < 1 {
+				continue
+			}
+			if b, err := asn1.Marshal(sinfo); err == nil {
+				pa.PADataValue = b
+			}
+		}
+		spas = append(spas, pa)
+	}
+	return spas
+}
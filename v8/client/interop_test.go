@@ -0,0 +1,116 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testETypeInfo2PAData(t *testing.T, entries ...types.ETypeInfo2Entry) types.PAData {
+	b, err := asn1.Marshal(types.ETypeInfo2(entries))
+	if err != nil {
+		t.Fatalf("error marshaling ETYPE-INFO2: %v", err)
+	}
+	return types.PAData{PADataType: patype.PA_ETYPE_INFO2, PADataValue: b}
+}
+
+func testKRBError(t *testing.T, realm string, v interface{}) *messages.KRBError {
+	krberr := messages.KRBError{ErrorCode: errorcode.KDC_ERR_PREAUTH_REQUIRED, Realm: realm}
+	if v != nil {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatalf("error marshaling e-data: %v", err)
+		}
+		krberr.EData = b
+	}
+	return &krberr
+}
+
+func TestSettings_RealmInteropProfile(t *testing.T) {
+	t.Parallel()
+	s := NewSettings(InteropProfile(ProfileFreeIPA), RealmInteropProfile("SAMBA.GOKRB5", ProfileSamba))
+	assert.Equal(t, ProfileSamba, s.InteropProfileForRealm("SAMBA.GOKRB5"), "profile for realm not as expected")
+	assert.Equal(t, ProfileFreeIPA, s.InteropProfileForRealm("TEST.GOKRB5"), "profile should default to the client's profile")
+	j, err := s.JSON()
+	if err != nil {
+		t.Fatalf("error marshaling settings: %v", err)
+	}
+	assert.Contains(t, j, `"SAMBA.GOKRB5": "Samba"`, "JSON not as expected")
+}
+
+func TestClient_kdcPAData(t *testing.T) {
+	t.Parallel()
+	cl := NewWithKeytab("username", "TEST.GOKRB5", &keytab.Keytab{}, config.New(),
+		RealmInteropProfile("SAMBA.GOKRB5", ProfileSamba),
+		RealmInteropProfile("HEIMDAL.GOKRB5", ProfileHeimdal))
+	des := types.ETypeInfo2Entry{EType: etypeID.DES_CBC_CRC, Salt: "SAMBA.GOKRB5username"}
+	aes := types.ETypeInfo2Entry{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: "SAMBA.GOKRB5username"}
+	md := types.MethodData{
+		{PADataType: patype.PA_ENC_TIMESTAMP},
+		testETypeInfo2PAData(t, des, aes),
+	}
+
+	// The first ETYPE-INFO2 entry is for an unsupported etype
+	pas, err := cl.kdcPAData(testKRBError(t, "TEST.GOKRB5", md))
+	if err != nil {
+		t.Fatalf("error getting PA data: %v", err)
+	}
+	_, err = preAuthEType(pas)
+	assert.Error(t, err, "expected error for the unsupported etype without a lenient profile")
+	pas, err = cl.kdcPAData(testKRBError(t, "SAMBA.GOKRB5", md))
+	if err != nil {
+		t.Fatalf("error getting PA data: %v", err)
+	}
+	et, err := preAuthEType(pas)
+	if err != nil {
+		t.Fatalf("error getting pre-auth etype: %v", err)
+	}
+	assert.Equal(t, etypeID.AES256_CTS_HMAC_SHA1_96, et.GetETypeID(), "pre-auth etype not as expected")
+	info, err := pas[1].GetETypeInfo2()
+	if err != nil {
+		t.Fatalf("error getting ETYPE-INFO2: %v", err)
+	}
+	assert.Equal(t, types.ETypeInfo2{aes}, info, "ETYPE-INFO2 not as expected")
+
+	// METHOD-DATA wrapped in TYPED-DATA
+	mdb, _ := asn1.Marshal(md)
+	td := types.TypedDataSequence{{DataType: patype.TD_PADATA, DataValue: mdb}}
+	_, err = cl.kdcPAData(testKRBError(t, "TEST.GOKRB5", td))
+	assert.Error(t, err, "expected error for TYPED-DATA without a lenient profile")
+	pas, err = cl.kdcPAData(testKRBError(t, "HEIMDAL.GOKRB5", td))
+	if err != nil {
+		t.Fatalf("error getting PA data from TYPED-DATA: %v", err)
+	}
+	assert.True(t, pas.Contains(patype.PA_ETYPE_INFO2), "ETYPE-INFO2 not found in TYPED-DATA")
+
+	// No e-data
+	_, err = cl.kdcPAData(testKRBError(t, "TEST.GOKRB5", nil))
+	assert.Error(t, err, "expected error for absent e-data without a lenient profile")
+	pas, err = cl.kdcPAData(testKRBError(t, "SAMBA.GOKRB5", nil))
+	if err != nil {
+		t.Fatalf("error getting PA data: %v", err)
+	}
+	assert.Len(t, pas, 0, "PA data not as expected")
+}
+
+func TestClient_KeyFromPassword_HeimdalPWSalt(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("username", "HEIMDAL.GOKRB5", "passwordvalue", config.New(), InteropProfile(ProfileHeimdal))
+	et, _ := preAuthEType(types.PADataSequence{testETypeInfo2PAData(t, types.ETypeInfo2Entry{EType: etypeID.AES256_CTS_HMAC_SHA1_96})})
+	// The salt is only provided as PA-PW-SALT
+	md := types.MethodData{{PADataType: patype.PA_PW_SALT, PADataValue: []byte("HEIMDAL.GOKRB5other")}}
+	key, _, err := cl.Key(et, 0, testKRBError(t, "HEIMDAL.GOKRB5", md))
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	want, _ := et.StringToKey("passwordvalue", "HEIMDAL.GOKRB5other", et.GetDefaultStringToKeyParams())
+	assert.Equal(t, want, key.KeyValue, "key not as expected")
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// KDCExchange exchanges a message with a KDC of the realm, returning the KDC's reply, by other means than the
+// client's network configuration, such as by tunnelling it through the context tokens of the IAKERB mechanism to a
+// service that proxies it to the KDC.
+type KDCExchange func(ctx context.Context, realm string, b []byte) ([]byte, error)
+
+type kdcExchangeKey struct{}
+
+// WithKDCExchange returns a context with which the messages the client sends to KDCs during the calls the context is
+// passed to are exchanged with the function, rather than sent to the KDCs or KDC proxies of the client's
+// configuration, for clients without a route to the KDCs.
+func WithKDCExchange(ctx context.Context, x KDCExchange) context.Context {
+	return context.WithValue(ctx, kdcExchangeKey{}, x)
+}
+
+// kdcExchange returns the KDC exchange function of the context, or nil if it has none.
+func kdcExchange(ctx context.Context) KDCExchange {
+	x, _ := ctx.Value(kdcExchangeKey{}).(KDCExchange)
+	return x
+}
+
+// exchangeKDC exchanges the bytes for a KDC of the realm with the KDC exchange function.
+func (cl *Client) exchangeKDC(ctx context.Context, x KDCExchange, b []byte, realm string) ([]byte, error) {
+	cl.dumpPacket(true, realm, "exchange", b)
+	rb, err := x(ctx, realm, b)
+	if err != nil {
+		if cerr := contextErr(ctx); cerr != nil {
+			return nil, cerr
+		}
+		return nil, fmt.Errorf("communication error with KDC via KDC exchange: %w", err)
+	}
+	cl.dumpPacket(false, realm, "exchange", rb)
+	return checkForKRBError(rb)
+}
+
+// ProxyToKDC sends the KDC request of another client, an AS_REQ or TGS_REQ, to the KDCs of the realm as the client
+// sends its own and returns the KDC's reply, as a KDC proxy such as an IAKERB acceptor does. A KRB_ERROR replied by
+// the KDC is returned as the reply rather than as an error, to be passed on to the other client.
+func (cl *Client) ProxyToKDC(ctx context.Context, realm string, b []byte) ([]byte, error) {
+	if len(b) < 1 || (b[0] != asn1AppTag(msgtype.KRB_AS_REQ) && b[0] != asn1AppTag(msgtype.KRB_TGS_REQ)) {
+		return nil, errors.New("message to proxy is not a KDC request")
+	}
+	rb, err := cl.sendToKDC(ctx, b, realm)
+	var krberr messages.KRBError
+	if errors.As(err, &krberr) && len(rb) > 0 {
+		return rb, nil
+	}
+	return rb, err
+}
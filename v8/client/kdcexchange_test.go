@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_WithKDCExchange(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	// The configured KDC is not reachable so the exchanges must use the function.
+	cl := testTGSClient(t, "127.0.0.1:1", skey)
+	defer cl.Destroy()
+	var realms []string
+	ctx := WithKDCExchange(context.Background(), func(ctx context.Context, realm string, b []byte) ([]byte, error) {
+		realms = append(realms, realm)
+		return testTGSRep(b, skey)
+	})
+	tkt, _, err := cl.GetServiceTicketContext(ctx, "HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket via KDC exchange: %v", err)
+	}
+	assert.Equal(t, "HTTP/host.test.gokrb5", tkt.SName.PrincipalNameString(), "ticket not as expected")
+	assert.Equal(t, []string{"TEST.GOKRB5"}, realms, "TGS_REQ should have been exchanged with the function")
+
+	_, _, err = cl.GetServiceTicketContext(ctx, "HTTP/unknown.test.gokrb5")
+	assert.True(t, errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN}), "KDC error should be returned via the KDC exchange: %v", err)
+
+	results := cl.GetServiceTickets(ctx, []string{"HTTP/host1.test.gokrb5", "HTTP/host2.test.gokrb5"})
+	for spn, r := range results {
+		assert.NoError(t, r.Err, "error getting service ticket for %s via KDC exchange", spn)
+	}
+
+	failed := WithKDCExchange(context.Background(), func(ctx context.Context, realm string, b []byte) ([]byte, error) {
+		return nil, errors.New("tunnel closed")
+	})
+	_, _, err = cl.GetServiceTicketContext(failed, "HTTP/other.test.gokrb5")
+	assert.Error(t, err, "error of the KDC exchange should be returned")
+}
+
+func TestClient_ProxyToKDC(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	s, _ := testKDCProxy(t, skey)
+	defer s.Close()
+	cl := testTGSClient(t, s.URL+"/KdcProxy", skey)
+	defer cl.Destroy()
+	KDCProxyHTTPClient(s.Client())(cl.settings)
+
+	proxied := testTGSClient(t, "127.0.0.1:1", skey)
+	defer proxied.Destroy()
+	tgt, key, err := proxied.sessionTGT(context.Background(), "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error getting TGT: %v", err)
+	}
+	for spn, code := range map[string]int32{"HTTP/host.test.gokrb5": 0, "HTTP/unknown.test.gokrb5": errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN} {
+		req, err := messages.NewTGSReq(proxied.Credentials.CName(), "TEST.GOKRB5", proxied.Config, tgt, key, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn), false)
+		if err != nil {
+			t.Fatalf("error creating TGS_REQ: %v", err)
+		}
+		b, _ := req.Marshal()
+		rb, err := cl.ProxyToKDC(context.Background(), "TEST.GOKRB5", b)
+		if err != nil {
+			t.Fatalf("error proxying TGS_REQ for %s: %v", spn, err)
+		}
+		if code == 0 {
+			var rep messages.TGSRep
+			assert.NoError(t, rep.Unmarshal(rb), "reply should be a TGS_REP")
+			continue
+		}
+		var krberr messages.KRBError
+		if assert.NoError(t, krberr.Unmarshal(rb), "reply should be a KRB_ERROR") {
+			assert.Equal(t, code, krberr.ErrorCode, "error code not as expected")
+		}
+	}
+	_, err = cl.ProxyToKDC(context.Background(), "TEST.GOKRB5", []byte{0x30, 0x00})
+	assert.Error(t, err, "message that is not a KDC request should not be proxied")
+}
@@ -0,0 +1,164 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// kdcBackoff is how long a KDC that failed to answer is tried after the others. It doubles with each consecutive
+// failure up to kdcMaxBackoff.
+const kdcBackoff = 30 * time.Second
+
+// kdcMaxBackoff is the longest a KDC that keeps failing is tried after the others.
+const kdcMaxBackoff = 10 * time.Minute
+
+// kdcHealth tracks the KDCs that recently failed to answer and the last KDC of each realm that answered, for each of
+// UDP and TCP, so that the KDCs of a realm are tried in the order most likely to get a response without first waiting
+// for a dead KDC to time out. It also tracks the realms whose KDCs replied that a response was too big for UDP so that
+// TCP is used for them, the realms whose KDCs close a TCP connection after its first reply so that requests to them
+// are not pipelined, and the offset of the KDCs' clock from the client's. A nil kdcHealth does not track the KDCs and
+// leaves their order unchanged.
+type kdcHealth struct {
+	mux      sync.Mutex
+	failures map[string]kdcFailure
+	last     map[string]string
+	tcp      map[string]bool
+	serial   map[string]bool
+	offset   time.Duration
+}
+
+// kdcFailure records the consecutive failures of a KDC and until when it is tried after the others.
+type kdcFailure struct {
+	count int
+	until time.Time
+}
+
+// order returns the KDCs of the realm for the protocol, keyed on the order they should be tried in from 1, with the KDC
+// that last answered first and those that recently failed last. The order of the other KDCs, such as that of their SRV
+// records' priority and weight, is kept.
+func (h *kdcHealth) order(realm, proto string, kdcs map[int]string) map[int]string {
+	if h == nil || len(kdcs) < 2 {
+		return kdcs
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	now := time.Now()
+	var first, healthy, failed []string
+	for i := 1; i <= len(kdcs); i++ {
+		addr := kdcs[i]
+		switch {
+		case now.Before(h.failures[proto+"/"+addr].until):
+			failed = append(failed, addr)
+		case addr == h.last[proto+"/"+realm]:
+			first = append(first, addr)
+		default:
+			healthy = append(healthy, addr)
+		}
+	}
+	o := make(map[int]string, len(kdcs))
+	for _, addr := range append(append(first, healthy...), failed...) {
+		o[len(o)+1] = addr
+	}
+	return o
+}
+
+// report returns a function recording the result of an attempt to exchange with a KDC of the realm over the protocol.
+func (h *kdcHealth) report(realm, proto string) func(addr string, err error) {
+	if h == nil {
+		return nil
+	}
+	return func(addr string, err error) {
+		h.mux.Lock()
+		defer h.mux.Unlock()
+		if err == nil {
+			delete(h.failures, proto+"/"+addr)
+			if h.last == nil {
+				h.last = make(map[string]string)
+			}
+			h.last[proto+"/"+realm] = addr
+			return
+		}
+		if h.failures == nil {
+			h.failures = make(map[string]kdcFailure)
+		}
+		f := h.failures[proto+"/"+addr]
+		f.count++
+		d := kdcBackoff << uint(f.count-1)
+		if d > kdcMaxBackoff || d <= 0 {
+			d = kdcMaxBackoff
+		}
+		f.until = time.Now().Add(d)
+		h.failures[proto+"/"+addr] = f
+		if h.last[proto+"/"+realm] == addr {
+			delete(h.last, proto+"/"+realm)
+		}
+	}
+}
+
+// preferTCP records that a KDC of the realm replied that a response was too big for UDP.
+func (h *kdcHealth) preferTCP(realm string) {
+	if h == nil {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.tcp == nil {
+		h.tcp = make(map[string]bool)
+	}
+	h.tcp[realm] = true
+}
+
+// tcpPreferred indicates if a KDC of the realm has replied that a response was too big for UDP.
+func (h *kdcHealth) tcpPreferred(realm string) bool {
+	if h == nil {
+		return false
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.tcp[realm]
+}
+
+// preferSerial records that a KDC of the realm closed a TCP connection without answering each of the requests
+// pipelined over it, as MIT krb5kdc does after its first reply.
+func (h *kdcHealth) preferSerial(realm string) {
+	if h == nil {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.serial == nil {
+		h.serial = make(map[string]bool)
+	}
+	h.serial[realm] = true
+}
+
+// serialPreferred indicates if a KDC of the realm has closed a TCP connection without answering each of the requests
+// pipelined over it.
+func (h *kdcHealth) serialPreferred(realm string) bool {
+	if h == nil {
+		return false
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.serial[realm]
+}
+
+// setClockOffset records the offset of the KDCs' clock from the client's.
+func (h *kdcHealth) setClockOffset(d time.Duration) {
+	if h == nil {
+		return
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.offset = d
+}
+
+// clockOffset returns the offset of the KDCs' clock from the client's, zero if it has not been recorded.
+func (h *kdcHealth) clockOffset() time.Duration {
+	if h == nil {
+		return 0
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.offset
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKDCHealth(t *testing.T) {
+	t.Parallel()
+	kdcs := map[int]string{1: "kdc1:88", 2: "kdc2:88", 3: "kdc3:88"}
+	h := new(kdcHealth)
+	assert.Equal(t, kdcs, h.order("TEST.GOKRB5", "udp", kdcs), "order should be kept without results")
+
+	report := h.report("TEST.GOKRB5", "udp")
+	report("kdc1:88", errors.New("timeout"))
+	report("kdc2:88", nil)
+	assert.Equal(t, map[int]string{1: "kdc2:88", 2: "kdc3:88", 3: "kdc1:88"}, h.order("TEST.GOKRB5", "udp", kdcs),
+		"KDC that answered should be first and the one that failed last")
+	assert.Equal(t, kdcs, h.order("TEST.GOKRB5", "tcp", kdcs), "results over UDP should not change the order for TCP")
+	assert.Equal(t, map[int]string{1: "kdc2:88", 2: "kdc3:88", 3: "kdc1:88"}, h.order("OTHER.GOKRB5", "udp", kdcs),
+		"a KDC that failed should be last for any realm")
+
+	// The KDC that last answered is no longer preferred once it fails.
+	report("kdc2:88", errors.New("timeout"))
+	assert.Equal(t, map[int]string{1: "kdc3:88", 2: "kdc1:88", 3: "kdc2:88"}, h.order("TEST.GOKRB5", "udp", kdcs),
+		"order not as expected after the preferred KDC failed")
+
+	// Once the backoff has passed the KDC is tried in its place again.
+	h.mux.Lock()
+	h.failures["udp/kdc1:88"] = kdcFailure{count: 1, until: time.Now().Add(-time.Second)}
+	h.mux.Unlock()
+	assert.Equal(t, map[int]string{1: "kdc1:88", 2: "kdc3:88", 3: "kdc2:88"}, h.order("TEST.GOKRB5", "udp", kdcs),
+		"KDC should be tried in its place once the backoff has passed")
+	report("kdc1:88", nil)
+	h.mux.Lock()
+	_, ok := h.failures["udp/kdc1:88"]
+	h.mux.Unlock()
+	assert.False(t, ok, "failures should be cleared once the KDC answers")
+
+	var nh *kdcHealth
+	assert.Equal(t, kdcs, nh.order("TEST.GOKRB5", "udp", kdcs), "nil kdcHealth should not change the order")
+	assert.Nil(t, nh.report("TEST.GOKRB5", "udp"), "nil kdcHealth should not report")
+}
+
+func TestKDCHealth_Backoff(t *testing.T) {
+	t.Parallel()
+	h := new(kdcHealth)
+	report := h.report("TEST.GOKRB5", "tcp")
+	var last time.Duration
+	for i := 1; i <= 100; i++ {
+		report("kdc1:88", errors.New("refused"))
+		h.mux.Lock()
+		d := time.Until(h.failures["tcp/kdc1:88"].until)
+		h.mux.Unlock()
+		assert.True(t, d <= kdcMaxBackoff, "backoff %v greater than the maximum after %d failures", d, i)
+		if i == 1 {
+			assert.True(t, d > kdcBackoff-time.Second, "first backoff %v not as expected", d)
+		}
+		if i > 1 && i < 6 {
+			assert.True(t, d > last, "backoff should increase with consecutive failures")
+		}
+		last = d
+	}
+}
@@ -0,0 +1,226 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ExportTicket returns a KRB_CRED holding the cached service ticket for the SPN and its session key, as kgetcred
+// writes, so that the ticket can be handed to a cooperating process without sharing the client's TGT or other
+// tickets. The receiving process imports the ticket with ImportTicket or NewFromKRBCred.
+//
+// The encrypted part of the KRB_CRED is encrypted with the key, which must be shared with the receiving process. If the
+// key has no encryption type the KRB_CRED is not encrypted and must be protected as a credential cache would be.
+func (cl *Client) ExportTicket(spn string, key types.EncryptionKey) ([]byte, error) {
+	e, ok := cl.cachedEntry(spn)
+	if !ok || !cl.now().Before(e.EndTime) {
+		return nil, krberror.WithKind(fmt.Errorf("no valid ticket cached for %s", spn), krberror.KindCredentials)
+	}
+	k := messages.NewKRBCred([]messages.Ticket{e.Ticket}, []messages.KrbCredInfo{{
+		Key:       e.SessionKey,
+		PRealm:    cl.Credentials.Domain(),
+		PName:     cl.Credentials.CName(),
+		AuthTime:  e.AuthTime,
+		StartTime: e.StartTime,
+		EndTime:   e.EndTime,
+		RenewTill: e.RenewTill,
+		SRealm:    e.Ticket.Realm,
+		SName:     e.Ticket.SName,
+	}})
+	if err := k.EncryptEncPart(key); err != nil {
+		return nil, err
+	}
+	return k.Marshal()
+}
+
+// ForwardTGT returns a KRB_CRED holding a forwarded TGT for the client's realm and its session key, RFC 4120 section
+// 2.6, so that a service the client has authenticated to can act on the client's behalf. The client's TGT must be
+// forwardable, as requested with the forwardable option of the krb5.conf libdefaults. The forwarded TGT is issued for
+// the addresses, those of the hosts it may be used from, or with no addresses if there are none.
+//
+// The encrypted part of the KRB_CRED is encrypted with the key, the session key or subkey of the AP exchange with the
+// service. The service creates a client from the KRB_CRED with NewFromKRBCred or gets a credential cache from it with
+// the CCache method of the decrypted messages.KRBCred.
+func (cl *Client) ForwardTGT(key types.EncryptionKey, addresses types.HostAddresses) ([]byte, error) {
+	b, err := cl.forwardTGT(key, addresses)
+	return b, cl.correlate(err)
+}
+
+func (cl *Client) forwardTGT(key types.EncryptionKey, addresses types.HostAddresses) ([]byte, error) {
+	realm := cl.Credentials.Domain()
+	tgt, sessionKey, err := cl.sessionTGT(context.Background(), realm)
+	if err != nil {
+		return nil, err
+	}
+	s, _ := cl.sessions.get(realm)
+	if f := s.snapshot().flags; !types.IsFlagSet(&f, flags.Forwardable) {
+		return nil, krberror.WithKind(fmt.Errorf("TGT for %s is not forwardable", realm), krberror.KindCredentials)
+	}
+	tgsReq, err := messages.NewForwardTGSReq(cl.Credentials.CName(), realm, cl.Config, tgt, sessionKey, addresses)
+	if err == nil {
+		err = cl.timeTGSReq(&tgsReq, tgt, sessionKey)
+	}
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ for a forwarded TGT")
+	}
+	b, fa, err := cl.marshalTGSReq(context.Background(), &tgsReq, tgt, sessionKey)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal TGS_REQ for a forwarded TGT")
+	}
+	r, err := cl.sendToKDC(context.Background(), b, realm)
+	if err != nil {
+		if e, ok := err.(messages.KRBError); ok {
+			if fe, ferr := fastError(fa, e); ferr == nil {
+				e = fe
+			}
+			return nil, krberror.Errorf(e, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting a forwarded TGT")
+		}
+		return nil, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ for a forwarded TGT to KDC")
+	}
+	tgsRep, err := cl.decodeTGSRep(context.Background(), tgsReq, r, sessionKey, fa)
+	if err != nil {
+		return nil, err
+	}
+	if !types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, flags.Forwarded) {
+		return nil, krberror.NewErrorf(krberror.KRBMsgError, "TGT issued by the KDC for %s is not forwarded", realm)
+	}
+	cl.Log("forwarded TGT obtained for %s (EndTime: %v)", realm, tgsRep.DecryptedEncPart.EndTime)
+	k := messages.NewKRBCred([]messages.Ticket{tgsRep.Ticket}, []messages.KrbCredInfo{
+		messages.NewKrbCredInfo(cl.Credentials.CName(), realm, tgsRep.DecryptedEncPart),
+	})
+	t := cl.now()
+	k.DecryptedEncPart.Timestamp = t.Truncate(time.Second)
+	k.DecryptedEncPart.Usec = t.Nanosecond() / int(time.Microsecond)
+	if err := k.EncryptEncPart(key); err != nil {
+		return nil, err
+	}
+	return k.Marshal()
+}
+
+// ShouldDelegate indicates if the client's credentials are to be delegated to the service with the SPN when
+// authenticating to it with GSS-API, according to the client's Delegation policy and the flags of its cached ticket
+// for the service.
+func (cl *Client) ShouldDelegate(spn string) bool {
+	switch cl.settings.Delegation() {
+	case DelegateAlways:
+		return true
+	case DelegateIfOKAsDelegate:
+		e, ok := cl.cachedEntry(spn)
+		return ok && e.OKAsDelegate()
+	case DelegateAllowlist:
+		return cl.settings.delegationAllowed(spn)
+	}
+	return false
+}
+
+// ImportTicket adds the service tickets held in the KRB_CRED, as returned by ExportTicket, to the client's cache and
+// any TGT held, as returned by ForwardTGT, as a session. The
+// key decrypts the encrypted part of the KRB_CRED and is not used if it is not encrypted. The tickets must have been
+// issued to the client's principal.
+func (cl *Client) ImportTicket(b []byte, key types.EncryptionKey) error {
+	k, err := decodeKRBCred(b, key)
+	if err != nil {
+		return err
+	}
+	return cl.importKRBCred(k)
+}
+
+// importKRBCred adds the tickets of the decrypted KRB_CRED to the client's cache.
+func (cl *Client) importKRBCred(k messages.KRBCred) error {
+	for _, info := range k.DecryptedEncPart.TicketInfo {
+		if (info.PRealm != "" && info.PRealm != cl.Credentials.Domain()) ||
+			(len(info.PName.NameString) > 0 && !info.PName.Equal(cl.Credentials.CName())) {
+			return krberror.WithKind(fmt.Errorf("ticket for %s was issued to %s@%s rather than %s@%s",
+				info.SName.PrincipalNameString(), info.PName.PrincipalNameString(), info.PRealm,
+				cl.Credentials.CName().PrincipalNameString(), cl.Credentials.Domain()), krberror.KindCredentials)
+		}
+	}
+	for i, tkt := range k.Tickets {
+		info := k.DecryptedEncPart.TicketInfo[i]
+		if len(tkt.SName.NameString) > 1 && strings.ToLower(tkt.SName.NameString[0]) == "krbtgt" {
+			// A TGT, such as a forwarded TGT, is added as the session for its realm.
+			cl.addSession(tkt, messages.EncKDCRepPart{
+				Key:       info.Key,
+				Flags:     info.Flags,
+				AuthTime:  info.AuthTime,
+				StartTime: info.StartTime,
+				EndTime:   info.EndTime,
+				RenewTill: info.RenewTill,
+				SRealm:    info.SRealm,
+				SName:     info.SName,
+				CAddr:     info.CAddr,
+			})
+			continue
+		}
+		cl.cacheTicket(tkt, info.AuthTime, info.StartTime, info.EndTime, info.RenewTill, info.Key, info.Flags)
+	}
+	cl.scheduleRenewal()
+	return nil
+}
+
+// NewFromKRBCred creates a client for the principal the tickets held in the KRB_CRED were issued to, with the service
+// tickets in its cache and the TGTs, such as a TGT forwarded with ForwardTGT, as its sessions. The key decrypts the
+// encrypted part of the KRB_CRED and is not used if it is not encrypted.
+//
+// WARNING: A client created from a KRB_CRED without a TGT can only use the imported tickets, which cannot be renewed.
+func NewFromKRBCred(b []byte, key types.EncryptionKey, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
+	k, err := decodeKRBCred(b, key)
+	if err != nil {
+		return nil, err
+	}
+	info := k.DecryptedEncPart.TicketInfo[0]
+	if len(info.PName.NameString) < 1 || info.PRealm == "" {
+		return nil, errors.New("KRB_CRED does not identify the principal the tickets were issued to")
+	}
+	cl := newClient(credentials.New(info.PName.PrincipalNameString(), info.PRealm), krb5conf, NewSettings(settings...))
+	if err := cl.importKRBCred(k); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// NewFromDelegatedCredentials creates a client from the credentials a client delegated to the service, as returned in
+// the credentials of a verified AP_REQ, so that the service can act as the user towards other services with the
+// delegated TGT.
+func NewFromDelegatedCredentials(creds *credentials.Credentials, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
+	d, ok := creds.DelegatedCredentials()
+	if !ok {
+		return nil, krberror.WithKind(fmt.Errorf("no credentials were delegated by %s@%s",
+			creds.CName().PrincipalNameString(), creds.Domain()), krberror.KindCredentials)
+	}
+	cl, err := NewFromKRBCred(d.KRBCred, d.Key, krb5conf, settings...)
+	if err != nil {
+		return nil, err
+	}
+	if cl.Credentials.Domain() != creds.Domain() || !cl.Credentials.CName().Equal(creds.CName()) {
+		return nil, krberror.WithKind(fmt.Errorf("credentials delegated by %s@%s were issued to %s@%s",
+			creds.CName().PrincipalNameString(), creds.Domain(), cl.Credentials.CName().PrincipalNameString(),
+			cl.Credentials.Domain()), krberror.KindCredentials)
+	}
+	return cl, nil
+}
+
+// decodeKRBCred unmarshals and decrypts a KRB_CRED, checking it holds credential information for each of its tickets.
+func decodeKRBCred(b []byte, key types.EncryptionKey) (messages.KRBCred, error) {
+	var k messages.KRBCred
+	if err := k.Unmarshal(b); err != nil {
+		return k, err
+	}
+	if err := k.DecryptEncPart(key); err != nil {
+		return k, err
+	}
+	if len(k.Tickets) < 1 || len(k.Tickets) != len(k.DecryptedEncPart.TicketInfo) {
+		return k, krberror.New(krberror.KRBMsgError, "KRB_CRED does not hold credential information for each of its tickets")
+	}
+	return k, nil
+}
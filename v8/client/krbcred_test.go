@@ -0,0 +1,107 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_ExportImportTicket(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New())
+	tkt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5"),
+		EncPart: types.EncryptedData{
+			EType:  18,
+			KVNO:   1,
+			Cipher: []byte{1, 2, 3, 4},
+		},
+	}
+	key := types.EncryptionKey{
+		KeyType:  18,
+		KeyValue: []byte("12345678901234567890123456789012"),
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	cl.cache.addEntry(tkt, now, now, now.Add(time.Hour), now.Add(2*time.Hour), key, types.NewKrbFlags())
+	spn := "HTTP/host.test.gokrb5"
+
+	_, err := cl.ExportTicket("HTTP/other.test.gokrb5", types.EncryptionKey{})
+	assert.Error(t, err, "exporting a ticket that is not cached should fail")
+
+	credKey := types.EncryptionKey{
+		KeyType:  17,
+		KeyValue: []byte("1234567890123456"),
+	}
+	for _, k := range []types.EncryptionKey{{}, credKey} {
+		b, err := cl.ExportTicket(spn, k)
+		if err != nil {
+			t.Fatalf("error exporting ticket with etype %d: %v", k.KeyType, err)
+		}
+		icl, err := NewFromKRBCred(b, k, config.New())
+		if err != nil {
+			t.Fatalf("error creating client from KRB_CRED with etype %d: %v", k.KeyType, err)
+		}
+		assert.Equal(t, "testuser1", icl.Credentials.UserName(), "imported client's user not as expected")
+		assert.Equal(t, "TEST.GOKRB5", icl.Credentials.Domain(), "imported client's realm not as expected")
+		e, ok := icl.cache.getEntry(spn)
+		if !ok {
+			t.Fatalf("imported ticket not found in cache")
+		}
+		assert.Equal(t, tkt.EncPart.Cipher, e.Ticket.EncPart.Cipher, "imported ticket not as expected")
+		assert.Equal(t, key, e.SessionKey, "imported session key not as expected")
+		assert.True(t, now.Equal(e.AuthTime), "imported auth time not as expected")
+		assert.True(t, now.Add(time.Hour).Equal(e.EndTime), "imported end time not as expected")
+		assert.True(t, now.Add(2*time.Hour).Equal(e.RenewTill), "imported renew till not as expected")
+		_, _, ok = icl.GetCachedTicket(spn)
+		assert.True(t, ok, "imported ticket not returned from the cache")
+	}
+
+	b, err := cl.ExportTicket(spn, credKey)
+	if err != nil {
+		t.Fatalf("error exporting ticket: %v", err)
+	}
+	_, err = NewFromKRBCred(b, types.EncryptionKey{KeyType: 17, KeyValue: []byte("6543210987654321")}, config.New())
+	assert.Error(t, err, "importing with the wrong key should fail")
+	other := NewWithPassword("testuser2", "TEST.GOKRB5", "passwordvalue", config.New())
+	assert.Error(t, other.ImportTicket(b, credKey), "importing a ticket issued to another principal should fail")
+	assert.NoError(t, NewWithPassword("testuser1", "TEST.GOKRB5", "", config.New()).ImportTicket(b, credKey), "importing into a client for the principal should succeed")
+}
+
+func TestClient_ShouldDelegate(t *testing.T) {
+	t.Parallel()
+	tkt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5"),
+	}
+	f := types.NewKrbFlags()
+	types.SetFlag(&f, flags.OKAsDelegate)
+	now := time.Now().UTC()
+	for _, test := range []struct {
+		policy DelegationPolicy
+		spn    string
+		want   bool
+	}{
+		{DelegateNever, "HTTP/host.test.gokrb5", false},
+		{DelegateIfOKAsDelegate, "HTTP/host.test.gokrb5", true},
+		{DelegateIfOKAsDelegate, "HTTP/other.test.gokrb5", false},
+		{DelegateAlways, "HTTP/other.test.gokrb5", true},
+		{DelegateAllowlist, "HTTP/host.test.gokrb5", false},
+		{DelegateAllowlist, "HTTP/allowed.test.gokrb5", true},
+		{DelegateAllowlist, "http/App.Web.Gokrb5", true},
+		{DelegateAllowlist, "HTTP/web.other.gokrb5", false},
+	} {
+		cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), Delegation(test.policy),
+			DelegationAllowlist("HTTP/allowed.test.gokrb5", "HTTP/*.web.gokrb5", "HTTP/[invalid"))
+		cl.cache.addEntry(tkt, now, now, now.Add(time.Hour), now.Add(time.Hour), types.EncryptionKey{}, f)
+		assert.Equal(t, test.want, cl.ShouldDelegate(test.spn), "delegation to %s with policy %v not as expected", test.spn, test.policy)
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// KVNOInfo reports the key of a service a ticket was issued with, as the kvno tool does: the key version and
+// encryption type the service's keytab must have a key for to decrypt the ticket.
+type KVNOInfo struct {
+	// Server is the principal of the ticket in the form name@REALM.
+	Server string
+	KVNO   int
+	EType  int32
+}
+
+// ETypeName returns the name of the ticket's encryption type, such as "aes256-cts-hmac-sha1-96".
+func (k KVNOInfo) ETypeName() string {
+	return etypeID.Name(k.EType)
+}
+
+// String returns the key version and encryption type of the ticket in the form of the kvno tool's output.
+func (k KVNOInfo) String() string {
+	return fmt.Sprintf("%s: kvno = %d, etype = %s", k.Server, k.KVNO, k.ETypeName())
+}
+
+// TicketKVNO returns the key version and encryption type of the service key the ticket is encrypted with, which are
+// not themselves encrypted so the service key is not needed.
+func TicketKVNO(tkt messages.Ticket) KVNOInfo {
+	return KVNOInfo{
+		Server: tkt.SName.PrincipalNameString() + "@" + tkt.Realm,
+		KVNO:   tkt.EncPart.KVNO,
+		EType:  tkt.EncPart.EType,
+	}
+}
+
+// GetKVNO gets a service ticket for the SPN from the KDC and returns the key version and encryption type of the
+// service key it is encrypted with, for example to check that a service's keytab holds the key the KDC currently
+// issues tickets with after a key rotation. The ticket is always requested from the KDC, rather than taken from the
+// cache, and replaces any cached for the SPN.
+func (cl *Client) GetKVNO(spn string) (KVNOInfo, error) {
+	return cl.GetKVNOContext(context.Background(), spn)
+}
+
+// GetKVNOContext returns the key version and encryption type of the service key of the SPN, as GetKVNO does. The
+// exchanges with the KDC are abandoned if the context is done before they complete.
+func (cl *Client) GetKVNOContext(ctx context.Context, spn string) (KVNOInfo, error) {
+	tkt, _, err := cl.GetServiceTicketWithOptions(ctx, spn)
+	if err != nil {
+		return KVNOInfo{}, err
+	}
+	return TicketKVNO(tkt), nil
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTicketKVNO(t *testing.T) {
+	t.Parallel()
+	tkt := messages.Ticket{
+		Realm:   "TEST.GOKRB5",
+		SName:   types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5"),
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, KVNO: 4},
+	}
+	k := TicketKVNO(tkt)
+	assert.Equal(t, KVNOInfo{Server: "HTTP/host.test.gokrb5@TEST.GOKRB5", KVNO: 4, EType: etypeID.AES256_CTS_HMAC_SHA1_96}, k, "kvno info not as expected")
+	assert.Equal(t, "HTTP/host.test.gokrb5@TEST.GOKRB5: kvno = 4, etype = aes256-cts-hmac-sha1-96", k.String(), "string not as expected")
+}
+
+func TestClient_GetKVNO(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+
+	k, err := cl.GetKVNO("HTTP/host1.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting kvno: %v", err)
+	}
+	assert.Equal(t, "HTTP/host1.test.gokrb5@TEST.GOKRB5", k.Server, "server not as expected")
+	assert.Equal(t, etypeID.AES256_CTS_HMAC_SHA1_96, k.EType, "encryption type not as expected")
+	_, ok := cl.GetCachedEntry("HTTP/host1.test.gokrb5")
+	assert.True(t, ok, "ticket should be cached")
+
+	_, err = cl.GetKVNO("HTTP/unknown.test.gokrb5")
+	assert.Error(t, err, "kvno of an unknown service should be an error")
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/metrics"
+)
+
+// recordExchange calls the exchange metrics hook, if one is configured, with the result of sending the AS_REQ or
+// TGS_REQ to the KDCs of the realm. Other requests are not reported.
+func (cl *Client) recordExchange(req []byte, realm string, d time.Duration, err error) {
+	h := cl.settings.Metrics().Exchange
+	if h == nil || len(req) < 1 {
+		return
+	}
+	e := metrics.Exchange{Realm: realm, Duration: d, Err: err, CorrelationID: cl.settings.CorrelationID()}
+	switch int(req[0] & 0x1f) {
+	case asnAppTag.ASREQ:
+		e.Type = metrics.AS
+	case asnAppTag.TGSREQ:
+		e.Type = metrics.TGS
+	default:
+		return
+	}
+	e.ErrorCode, _ = krberror.ErrorCode(err)
+	h(e)
+}
+
+// recordKDCRequest calls the KDC request metrics hook, if one is configured.
+func (cl *Client) recordKDCRequest(realm, kdc, transport string, d time.Duration, err error) {
+	if h := cl.settings.Metrics().KDCRequest; h != nil {
+		h(metrics.KDCRequest{Realm: realm, KDC: kdc, Transport: transport, Duration: d, Err: err, CorrelationID: cl.settings.CorrelationID()})
+	}
+}
+
+// recordCacheLookup calls the cache lookup metrics hook, if one is configured.
+func (cl *Client) recordCacheLookup(spn string, hit bool) {
+	if h := cl.settings.Metrics().CacheLookup; h != nil {
+		h(metrics.CacheLookup{SPN: spn, Hit: hit})
+	}
+}
+
+// recordRenewal calls the renewal metrics hook, if one is configured.
+func (cl *Client) recordRenewal(spn, realm string, d time.Duration, err error) {
+	if h := cl.settings.Metrics().Renewal; h != nil {
+		h(metrics.Renewal{SPN: spn, Realm: realm, Duration: d, Err: err})
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/metrics"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Metrics(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	var mux sync.Mutex
+	var exchanges []metrics.Exchange
+	var requests []metrics.KDCRequest
+	var lookups []metrics.CacheLookup
+	var renewals []metrics.Renewal
+	cl := testTGSClient(t, kdc.Addr().String(), skey, Metrics(metrics.Hooks{
+		Exchange: func(e metrics.Exchange) {
+			mux.Lock()
+			defer mux.Unlock()
+			exchanges = append(exchanges, e)
+		},
+		KDCRequest: func(r metrics.KDCRequest) {
+			mux.Lock()
+			defer mux.Unlock()
+			requests = append(requests, r)
+		},
+		CacheLookup: func(l metrics.CacheLookup) {
+			mux.Lock()
+			defer mux.Unlock()
+			lookups = append(lookups, l)
+		},
+		Renewal: func(r metrics.Renewal) {
+			mux.Lock()
+			defer mux.Unlock()
+			renewals = append(renewals, r)
+		},
+	}))
+	defer cl.Destroy()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := cl.GetServiceTicket("HTTP/host1.test.gokrb5"); err != nil {
+			t.Fatalf("error getting service ticket: %v", err)
+		}
+	}
+	_, _, err := cl.GetServiceTicket("HTTP/unknown.test.gokrb5")
+	assert.Error(t, err, "service ticket for unknown SPN should not be issued")
+	s, _ := cl.sessions.get("TEST.GOKRB5")
+	assert.NoError(t, cl.renewTGT(context.Background(), s), "error renewing TGT")
+
+	mux.Lock()
+	defer mux.Unlock()
+	assert.Equal(t, []metrics.CacheLookup{
+		{SPN: "HTTP/host1.test.gokrb5", Hit: false},
+		{SPN: "HTTP/host1.test.gokrb5", Hit: true},
+		{SPN: "HTTP/unknown.test.gokrb5", Hit: false},
+	}, lookups, "cache lookups not as expected")
+	if assert.Len(t, exchanges, 3, "exchanges not as expected") {
+		for _, e := range exchanges {
+			assert.Equal(t, metrics.TGS, e.Type, "exchange type not as expected")
+			assert.Equal(t, "TEST.GOKRB5", e.Realm, "exchange realm not as expected")
+			assert.True(t, e.Duration > 0, "exchange duration not recorded")
+		}
+		assert.NoError(t, exchanges[0].Err, "first exchange should succeed")
+		assert.Equal(t, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, exchanges[1].ErrorCode, "error code not as expected")
+		assert.Equal(t, metrics.ResultKRBError, metrics.Result(exchanges[1].Err), "result not as expected")
+	}
+	if assert.Len(t, requests, 3, "KDC requests not as expected") {
+		assert.Equal(t, kdc.Addr().String(), requests[0].KDC, "KDC not as expected")
+		assert.Equal(t, "TCP", requests[0].Transport, "transport not as expected")
+	}
+	if assert.Len(t, renewals, 1, "renewals not as expected") {
+		assert.Equal(t, metrics.Renewal{SPN: "krbtgt/TEST.GOKRB5", Realm: "TEST.GOKRB5", Duration: renewals[0].Duration}, renewals[0], "renewal not as expected")
+	}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// negativeCacheErrors are the error codes of the KDC replies to requests for service tickets whose failures are
+// cached with the NegativeCacheTTL setting, as the requests fail in the same way until the KDC's database changes.
+var negativeCacheErrors = map[int32]bool{
+	errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN: true,
+	errorcode.KDC_ERR_POLICY:              true,
+	errorcode.KDC_ERR_SERVICE_REVOKED:     true,
+	errorcode.KDC_ERR_MUST_USE_USER2USER:  true,
+}
+
+// negativeCache holds the failures of requests for service tickets, keyed on SPN, so that the tickets are not
+// requested from the KDC again until the failures expire.
+type negativeCache struct {
+	mux     sync.Mutex
+	entries map[string]negativeEntry
+}
+
+// negativeEntry is a cached failure of a request for a service ticket.
+type negativeEntry struct {
+	err   error
+	at    time.Time
+	until time.Time
+}
+
+// get returns the failure cached for the SPN if it has not expired at the time provided.
+func (c *negativeCache) get(spn string, now time.Time) (negativeEntry, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	e, ok := c.entries[spn]
+	if !ok {
+		return e, false
+	}
+	if !now.Before(e.until) {
+		delete(c.entries, spn)
+		return e, false
+	}
+	return e, true
+}
+
+// add caches the failure of the request for the SPN until the time provided.
+func (c *negativeCache) add(spn string, e negativeEntry) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]negativeEntry)
+	}
+	c.entries[spn] = e
+}
+
+// remove the failures cached for the SPNs, or all of them if none are specified.
+func (c *negativeCache) remove(spns ...string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if len(spns) == 0 {
+		c.entries = nil
+		return
+	}
+	for _, spn := range spns {
+		delete(c.entries, spn)
+	}
+}
+
+// negativeCacheBypassKey is the key of the context value indicating that cached failures are ignored.
+type negativeCacheBypassKey struct{}
+
+// BypassNegativeCache returns a context with which the requests for service tickets are sent to the KDC even if a
+// failure of an earlier request is cached for the SPN, for example to check whether a misconfigured service has been
+// fixed. The outcome of the request replaces the cached failure.
+func BypassNegativeCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, negativeCacheBypassKey{}, true)
+}
+
+// cachedFailure returns the failure of an earlier request for a ticket to the SPN if one is cached and the context
+// does not bypass the cache, or nil otherwise.
+func (cl *Client) cachedFailure(ctx context.Context, spn string) error {
+	if cl.settings.NegativeCacheTTL() <= 0 {
+		return nil
+	}
+	if b, _ := ctx.Value(negativeCacheBypassKey{}).(bool); b {
+		return nil
+	}
+	now := cl.now()
+	e, ok := cl.failures.get(spn, now)
+	if !ok {
+		return nil
+	}
+	cl.Log("service ticket for %s not requested as the request failed %v ago", spn, now.Sub(e.at).Truncate(time.Second))
+	return fmt.Errorf("the request for a service ticket for %s failed %v ago and is not sent again until %v: %w",
+		spn, now.Sub(e.at).Truncate(time.Second), e.until, e.err)
+}
+
+// recordOutcome caches the failure of the request for a ticket to the SPN if it is a failure the KDC would reply to
+// the request with again, or removes any failure cached for the SPN if the request succeeded.
+func (cl *Client) recordOutcome(spn string, err error) {
+	ttl := cl.settings.NegativeCacheTTL()
+	if ttl <= 0 {
+		return
+	}
+	var e messages.KRBError
+	if err == nil || !errors.As(err, &e) || !negativeCacheErrors[e.ErrorCode] {
+		cl.failures.remove(spn)
+		return
+	}
+	now := cl.now()
+	cl.failures.add(spn, negativeEntry{err: err, at: now, until: now.Add(ttl)})
+}
+
+// InvalidateNegativeCache removes the failures cached with the NegativeCacheTTL setting for the SPNs, or all of them
+// if none are specified, so that the next requests for the tickets are sent to the KDC.
+func (cl *Client) InvalidateNegativeCache(spns ...string) {
+	cl.failures.remove(spns...)
+}
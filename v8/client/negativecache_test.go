@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_NegativeCache(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := clock.NewFake(now)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), Clock(c), NegativeCacheTTL(time.Minute))
+	ctx := context.Background()
+	unknown := krberror.Errorf(messages.NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, ""),
+		krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting for HTTP/unknown")
+
+	cl.recordOutcome("HTTP/unknown", unknown)
+	cl.recordOutcome("HTTP/skew", messages.NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", errorcode.KRB_AP_ERR_SKEW, ""))
+	cl.recordOutcome("HTTP/network", krberror.New(krberror.NetworkingError, "no KDC responded"))
+	err := cl.cachedFailure(ctx, "HTTP/unknown")
+	if assert.Error(t, err, "failure should be cached") {
+		var e messages.KRBError
+		assert.True(t, errors.As(err, &e), "cached failure should be the KDC's error")
+		assert.Equal(t, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, e.ErrorCode, "error code not as expected")
+	}
+	assert.NoError(t, cl.cachedFailure(ctx, "HTTP/skew"), "failures that may not be repeated should not be cached")
+	assert.NoError(t, cl.cachedFailure(ctx, "HTTP/network"), "failures to reach the KDC should not be cached")
+	assert.NoError(t, cl.cachedFailure(BypassNegativeCache(ctx), "HTTP/unknown"), "the cache should be bypassed")
+
+	// A success replaces the failure.
+	cl.recordOutcome("HTTP/unknown", nil)
+	assert.NoError(t, cl.cachedFailure(ctx, "HTTP/unknown"), "failure should be removed once the request succeeds")
+
+	// Failures expire once the TTL has passed.
+	cl.recordOutcome("HTTP/unknown", unknown)
+	c.Advance(59 * time.Second)
+	assert.Error(t, cl.cachedFailure(ctx, "HTTP/unknown"), "failure should be cached until the TTL has passed")
+	c.Advance(time.Second)
+	assert.NoError(t, cl.cachedFailure(ctx, "HTTP/unknown"), "failure should expire after the TTL")
+
+	// Failures are invalidated for the SPNs specified or all of them.
+	cl.recordOutcome("HTTP/unknown", unknown)
+	cl.recordOutcome("HTTP/other", unknown)
+	cl.InvalidateNegativeCache("HTTP/other")
+	assert.Error(t, cl.cachedFailure(ctx, "HTTP/unknown"), "failure for other SPNs should not be invalidated")
+	assert.NoError(t, cl.cachedFailure(ctx, "HTTP/other"), "failure should be invalidated")
+	cl.InvalidateNegativeCache()
+	assert.NoError(t, cl.cachedFailure(ctx, "HTTP/unknown"), "all failures should be invalidated")
+
+	// Without the setting no failures are cached.
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), Clock(c))
+	cl.recordOutcome("HTTP/unknown", unknown)
+	assert.NoError(t, cl.cachedFailure(ctx, "HTTP/unknown"), "failures should not be cached by default")
+}
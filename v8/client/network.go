@@ -1,209 +1,865 @@
 package client
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/kkdcp"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/logging"
 	"github.com/jcmturner/gokrb5/v8/messages"
 )
 
+// defaultKDCTimeout is the time to wait for each KDC to respond if none is configured.
+const defaultKDCTimeout = 5 * time.Second
+
+// kdcTimeoutKey is the key of the context value of the time to wait for each KDC to respond.
+type kdcTimeoutKey struct{}
+
+// withKDCTimeout returns a context with the time to wait for each KDC to respond.
+func withKDCTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, kdcTimeoutKey{}, d)
+}
+
+// kdcTimeout returns the time to wait for each KDC to respond of the context, or the default if it has none.
+func kdcTimeout(ctx context.Context) time.Duration {
+	if d, ok := ctx.Value(kdcTimeoutKey{}).(time.Duration); ok && d > 0 {
+		return d
+	}
+	return defaultKDCTimeout
+}
+
+// kdcTimeout returns the time to wait for each KDC to respond from the client's settings or the krb5.conf.
+func (cl *Client) kdcTimeout() time.Duration {
+	if d := cl.settings.KDCTimeout(); d > 0 {
+		return d
+	}
+	return cl.Config.LibDefaults.KDCTimeout
+}
+
+// kdcMaxRetries returns the number of times the KDCs of a realm are each tried from the client's settings or the
+// krb5.conf.
+func (cl *Client) kdcMaxRetries() int {
+	if n := cl.settings.KDCMaxRetries(); n > 0 {
+		return n
+	}
+	if n := cl.Config.LibDefaults.MaxRetries; n > 0 {
+		return n
+	}
+	return 1
+}
+
 // SendToKDC performs network actions to send data to the KDC.
-func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
+// If none of the KDCs respond they are tried again, after a backoff that doubles with each retry, up to the maximum
+// number of retries and within the client's exchange budget. If the context is done before a response is received the
+// context's error is returned and no further KDCs are tried. The error of none of the KDCs responding matches
+// krberror.ErrKDCUnreachable. If the context has a KDC exchange function the data is exchanged with it instead.
+func (cl *Client) sendToKDC(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	start := time.Now()
+	var rb []byte
+	var err error
+	if x := kdcExchange(ctx); x != nil {
+		rb, err = cl.exchangeKDC(ctx, x, b, realm)
+	} else {
+		rb, err = cl.sendToKDCRetrying(ctx, b, realm)
+	}
+	cl.recordExchange(b, realm, time.Since(start), err)
+	return rb, err
+}
+
+// sendToKDCRetrying sends the bytes to the KDCs of the realm, retrying as sendToKDC describes.
+func (cl *Client) sendToKDCRetrying(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if d := cl.settings.KDCExchangeBudget(); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	ctx = withKDCTimeout(ctx, cl.kdcTimeout())
+	backoff := cl.settings.KDCRetryBackoff()
+	for i := 1; ; i++ {
+		rb, err := cl.sendToKDCOnce(ctx, b, realm)
+		var krberr messages.KRBError
+		if err == nil || errors.As(err, &krberr) || krberror.ErrorKind(err) == krberror.KindConfig || contextErr(ctx) != nil {
+			return rb, err
+		}
+		if i >= cl.kdcMaxRetries() {
+			return rb, krberror.KDCUnreachable(err)
+		}
+		cl.logf(logging.LevelWarn, fmt.Sprintf("no KDC of realm %s responded, retrying in %v: %v", realm, backoff, err),
+			logging.F(logging.KeyRealm, realm), logging.F(logging.KeyError, err))
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return rb, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// sendToKDCOnce tries each of the KDCs of the realm in turn until one responds.
+func (cl *Client) sendToKDCOnce(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	if proxies := cl.kdcProxies(realm); len(proxies) > 0 {
+		rb, err := cl.sendKDCHTTPS(ctx, realm, proxies, b)
+		if err != nil {
+			if e, ok := err.(messages.KRBError); ok {
+				return rb, e
+			}
+			return rb, fmt.Errorf("communication error with KDC via KDC proxy: %w", err)
+		}
+		return rb, nil
+	}
 	var rb []byte
-	if cl.Config.LibDefaults.UDPPreferenceLimit == 1 {
+	if cl.Config.LibDefaults.UDPPreferenceLimit == 1 || cl.settings.TCPOnly() {
 		//1 means we should always use TCP
-		rb, errtcp := cl.sendKDCTCP(realm, b)
+		rb, errtcp := cl.sendKDCTCP(ctx, realm, b)
 		if errtcp != nil {
 			if e, ok := errtcp.(messages.KRBError); ok {
 				return rb, e
 			}
-			return rb, fmt.Errorf("communication error with KDC via TCP: %v", errtcp)
+			return rb, fmt.Errorf("communication error with KDC via TCP: %w", errtcp)
 		}
 		return rb, nil
 	}
-	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
+	// Once a KDC of the realm has replied that a response is too big for UDP, as AD KDCs do for tickets with large
+	// PACs, TCP is used first for all the requests to the realm rather than each costing a round trip over UDP.
+	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit && !cl.kdcHealth.tcpPreferred(realm) {
 		//Try UDP first, TCP second
-		rb, errudp := cl.sendKDCUDP(realm, b)
+		rb, errudp := cl.sendKDCUDP(ctx, realm, b)
 		if errudp != nil {
-			if e, ok := errudp.(messages.KRBError); ok && e.ErrorCode != errorcode.KRB_ERR_RESPONSE_TOO_BIG {
+			if e, ok := errudp.(messages.KRBError); ok {
 				// Got a KRBError from KDC
 				// If this is not a KRB_ERR_RESPONSE_TOO_BIG we will return immediately otherwise will try TCP.
-				return rb, e
+				if e.ErrorCode != errorcode.KRB_ERR_RESPONSE_TOO_BIG {
+					return rb, e
+				}
+				cl.Log("response from KDC of realm %s too big for UDP, using TCP for the realm", realm)
+				cl.kdcHealth.preferTCP(realm)
+			}
+			if err := contextErr(ctx); err != nil {
+				return rb, err
 			}
 			// Try TCP
-			r, errtcp := cl.sendKDCTCP(realm, b)
+			r, errtcp := cl.sendKDCTCP(ctx, realm, b)
 			if errtcp != nil {
 				if e, ok := errtcp.(messages.KRBError); ok {
 					// Got a KRBError
 					return r, e
 				}
-				return r, fmt.Errorf("failed to communicate with KDC. Attempts made with UDP (%v) and then TCP (%v)", errudp, errtcp)
+				return r, fmt.Errorf("failed to communicate with KDC. Attempts made with UDP (%v) and then TCP (%w)", errudp, errtcp)
 			}
 			rb = r
 		}
 		return rb, nil
 	}
 	//Try TCP first, UDP second
-	rb, errtcp := cl.sendKDCTCP(realm, b)
+	rb, errtcp := cl.sendKDCTCP(ctx, realm, b)
 	if errtcp != nil {
 		if e, ok := errtcp.(messages.KRBError); ok {
 			// Got a KRBError from KDC so returning and not trying UDP.
 			return rb, e
 		}
-		rb, errudp := cl.sendKDCUDP(realm, b)
+		if err := contextErr(ctx); err != nil {
+			return rb, err
+		}
+		rb, errudp := cl.sendKDCUDP(ctx, realm, b)
 		if errudp != nil {
 			if e, ok := errudp.(messages.KRBError); ok {
 				// Got a KRBError
 				return rb, e
 			}
-			return rb, fmt.Errorf("failed to communicate with KDC. Attempts made with TCP (%v) and then UDP (%v)", errtcp, errudp)
+			return rb, fmt.Errorf("failed to communicate with KDC. Attempts made with TCP (%v) and then UDP (%w)", errtcp, errudp)
 		}
 	}
 	return rb, nil
 }
 
+// reportKDC returns a function recording the result of each attempt to exchange with a KDC of the realm over the
+// protocol in the KDC health and logging it with the time the attempt took.
+func (cl *Client) reportKDC(realm, proto string) func(addr string, err error) {
+	report := cl.kdcHealth.report(realm, proto)
+	start := time.Now()
+	return func(addr string, err error) {
+		if report != nil {
+			report(addr, err)
+		}
+		d := time.Since(start)
+		start = time.Now()
+		cl.recordKDCRequest(realm, addr, strings.ToUpper(proto), d, err)
+		fields := []logging.Field{logging.F(logging.KeyRealm, realm), logging.F(logging.KeyKDC, addr),
+			logging.F(logging.KeyTransport, strings.ToUpper(proto)), logging.F(logging.KeyDuration, d)}
+		if err != nil {
+			cl.logf(logging.LevelDebug, "KDC exchange failed", append(fields, logging.F(logging.KeyError, err))...)
+			return
+		}
+		cl.logf(logging.LevelDebug, "KDC exchange", fields...)
+	}
+}
+
+// kdcProxies returns the URLs of the KDC proxies to send messages for the realm's KDCs to, if any.
+func (cl *Client) kdcProxies(realm string) []string {
+	if u := cl.settings.KDCProxy(); u != "" {
+		return []string{u}
+	}
+	return cl.Config.GetKDCProxies(realm)
+}
+
+// sendKDCHTTPS sends bytes to the KDC via the first of the KDC proxies that responds.
+func (cl *Client) sendKDCHTTPS(ctx context.Context, realm string, proxies []string, b []byte) ([]byte, error) {
+	cl.dumpPacket(true, realm, "HTTPS", b)
+	r, err := dialSendHTTPS(ctx, cl.settings.KDCProxyHTTPClient(), proxies, realm, b)
+	if err != nil {
+		return r, err
+	}
+	cl.dumpPacket(false, realm, "HTTPS", r)
+	return checkForKRBError(r)
+}
+
+// dialSendHTTPS sends the bytes to each of the KDC proxies in turn until one responds.
+func dialSendHTTPS(ctx context.Context, c *http.Client, proxies []string, realm string, b []byte) ([]byte, error) {
+	var errs []error
+	for _, u := range proxies {
+		rb, err := kkdcp.SendContext(ctx, c, u, realm, b)
+		if err != nil {
+			if cerr := contextErr(ctx); cerr != nil {
+				return nil, cerr
+			}
+			errs = append(errs, err)
+			continue
+		}
+		return rb, nil
+	}
+	return nil, kdcErrors("error sending to any of the KDC proxies", errs)
+}
+
 // sendKDCUDP sends bytes to the KDC via UDP.
-func (cl *Client) sendKDCUDP(realm string, b []byte) ([]byte, error) {
+func (cl *Client) sendKDCUDP(ctx context.Context, realm string, b []byte) ([]byte, error) {
 	var r []byte
 	_, kdcs, err := cl.Config.GetKDCs(realm, false)
 	if err != nil {
 		return r, err
 	}
-	r, err = dialSendUDP(kdcs, b)
+	cl.dumpPacket(true, realm, "UDP", b)
+	r, err = cl.udpConns.dialSendUDP(ctx, cl.kdcHealth.order(realm, "udp", kdcs), b, cl.reportKDC(realm, "udp"))
 	if err != nil {
 		return r, err
 	}
+	cl.dumpPacket(false, realm, "UDP", r)
 	return checkForKRBError(r)
 }
 
-// dialSendUDP establishes a UDP connection to a KDC.
-func dialSendUDP(kdcs map[int]string, b []byte) ([]byte, error) {
-	var errs []string
+// udpPoolSize is the maximum number of idle UDP sockets held open for each KDC.
+const udpPoolSize = 4
+
+// udpPool holds idle UDP sockets connected to KDCs so that they can be reused for subsequent exchanges rather than
+// dialing a new socket for each message.
+//
+// A socket is only returned to the pool after a successful exchange. A socket on which an exchange timed out or failed
+// is closed so that a late response cannot be read as the response to a later request.
+// A nil udpPool dials a new socket for each exchange.
+type udpPool struct {
+	conns map[string][]*net.UDPConn
+	mux   sync.Mutex
+}
+
+// get returns an idle socket connected to the address or dials a new one.
+func (p *udpPool) get(ctx context.Context, addr string) (*net.UDPConn, error) {
+	if p != nil {
+		p.mux.Lock()
+		if cs := p.conns[addr]; len(cs) > 0 {
+			conn := cs[len(cs)-1]
+			p.conns[addr] = cs[:len(cs)-1]
+			p.mux.Unlock()
+			return conn, nil
+		}
+		p.mux.Unlock()
+	}
+	d := net.Dialer{Timeout: kdcTimeout(ctx)}
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error setting dial timeout on connection to %s: %w", addr, err)
+	}
+	// conn is guaranteed to be a UDPConn
+	return conn.(*net.UDPConn), nil
+}
+
+// put returns the socket to the pool for reuse. The socket is closed if the pool is full.
+func (p *udpPool) put(addr string, conn *net.UDPConn) {
+	if p == nil {
+		conn.Close()
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if len(p.conns[addr]) >= udpPoolSize {
+		conn.Close()
+		return
+	}
+	if p.conns == nil {
+		p.conns = make(map[string][]*net.UDPConn)
+	}
+	p.conns[addr] = append(p.conns[addr], conn)
+}
+
+// idle returns the number of idle sockets held for each KDC address.
+func (p *udpPool) idle() map[string]int {
+	m := make(map[string]int)
+	if p == nil {
+		return m
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for addr, cs := range p.conns {
+		if len(cs) > 0 {
+			m[addr] = len(cs)
+		}
+	}
+	return m
+}
+
+// close closes all the idle sockets in the pool.
+func (p *udpPool) close() {
+	if p == nil {
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, cs := range p.conns {
+		for _, conn := range cs {
+			conn.Close()
+		}
+	}
+	p.conns = nil
+}
+
+// dialSendUDP sends the bytes to a KDC over UDP reusing a socket from the pool if one is available. If the report
+// function is not nil it is called with the result of the attempt with each KDC, other than for the context being done.
+func (p *udpPool) dialSendUDP(ctx context.Context, kdcs map[int]string, b []byte, report func(string, error)) ([]byte, error) {
+	var errs []error
+	fail := func(i int, err error) {
+		if report != nil {
+			report(kdcs[i], err)
+		}
+		errs = append(errs, err)
+	}
 	for i := 1; i <= len(kdcs); i++ {
+		if err := contextErr(ctx); err != nil {
+			return nil, err
+		}
 		udpAddr, err := net.ResolveUDPAddr("udp", kdcs[i])
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error resolving KDC address: %v", err))
+			fail(i, fmt.Errorf("error resolving KDC address: %w", err))
 			continue
 		}
-
-		conn, err := net.DialTimeout("udp", udpAddr.String(), 5*time.Second)
+		addr := udpAddr.String()
+		conn, err := p.get(ctx, addr)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error setting dial timeout on connection to %s: %v", kdcs[i], err))
+			if cerr := contextErr(ctx); cerr != nil {
+				return nil, cerr
+			}
+			fail(i, err)
 			continue
 		}
-		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			errs = append(errs, fmt.Sprintf("error setting deadline on connection to %s: %v", kdcs[i], err))
+		if err := conn.SetDeadline(connDeadline(ctx)); err != nil {
+			conn.Close()
+			fail(i, fmt.Errorf("error setting deadline on connection to %s: %w", kdcs[i], err))
 			continue
 		}
-		// conn is guaranteed to be a UDPConn
-		rb, err := sendUDP(conn.(*net.UDPConn), b)
+		stop := closeOnDone(ctx, conn)
+		rb, err := sendUDP(conn, b)
+		stop()
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error sneding to %s: %v", kdcs[i], err))
+			conn.Close()
+			if cerr := contextErr(ctx); cerr != nil {
+				return nil, cerr
+			}
+			fail(i, fmt.Errorf("error sending to %s: %w", kdcs[i], err))
 			continue
 		}
+		if report != nil {
+			report(kdcs[i], nil)
+		}
+		if ctx.Err() != nil {
+			// The socket may have been closed as the context was done once the response was received.
+			conn.Close()
+			return rb, nil
+		}
+		p.put(addr, conn)
 		return rb, nil
 	}
-	return nil, fmt.Errorf("error sending to a KDC: %s", strings.Join(errs, "; "))
+	return nil, kdcErrors("error sending to a KDC", errs)
+}
+
+// dialSendUDP establishes a UDP connection to a KDC.
+func dialSendUDP(ctx context.Context, kdcs map[int]string, b []byte) ([]byte, error) {
+	var p *udpPool
+	return p.dialSendUDP(ctx, kdcs, b, nil)
 }
 
 // sendUDP sends bytes to connection over UDP.
+// Datagrams that are not a response to the type of request sent are discarded.
 func sendUDP(conn *net.UDPConn, b []byte) ([]byte, error) {
 	var r []byte
-	defer conn.Close()
 	_, err := conn.Write(b)
 	if err != nil {
-		return r, fmt.Errorf("error sending to (%s): %v", conn.RemoteAddr().String(), err)
+		return r, fmt.Errorf("error sending to (%s): %w", conn.RemoteAddr().String(), err)
 	}
 	udpbuf := make([]byte, 4096)
-	n, _, err := conn.ReadFrom(udpbuf)
-	r = udpbuf[:n]
-	if err != nil {
-		return r, fmt.Errorf("sending over UDP failed to %s: %v", conn.RemoteAddr().String(), err)
+	for {
+		n, _, err := conn.ReadFrom(udpbuf)
+		r = udpbuf[:n]
+		if err != nil {
+			return r, fmt.Errorf("sending over UDP failed to %s: %w", conn.RemoteAddr().String(), err)
+		}
+		if len(r) < 1 {
+			return r, fmt.Errorf("no response data from %s", conn.RemoteAddr().String())
+		}
+		if isResponseTo(b, r) {
+			return r, nil
+		}
+	}
+}
+
+// isResponseTo indicates if the response bytes could be a response to the request bytes based on their ASN.1
+// application tags. A KDC_REQ is answered with the corresponding KDC_REP or a KRB_ERROR.
+func isResponseTo(req, resp []byte) bool {
+	if len(req) < 1 {
+		return true
 	}
-	if len(r) < 1 {
-		return r, fmt.Errorf("no response data from %s", conn.RemoteAddr().String())
+	switch req[0] {
+	case asn1AppTag(msgtype.KRB_AS_REQ), asn1AppTag(msgtype.KRB_TGS_REQ):
+		return resp[0] == req[0]+1 || resp[0] == asn1AppTag(msgtype.KRB_ERROR)
 	}
-	return r, nil
+	return true
+}
+
+// asn1AppTag returns the first byte of the ASN.1 encoding of a constructed application tag.
+func asn1AppTag(tag int) byte {
+	return byte(0x60 | tag)
 }
 
 // sendKDCTCP sends bytes to the KDC via TCP.
-func (cl *Client) sendKDCTCP(realm string, b []byte) ([]byte, error) {
+func (cl *Client) sendKDCTCP(ctx context.Context, realm string, b []byte) ([]byte, error) {
 	var r []byte
 	_, kdcs, err := cl.Config.GetKDCs(realm, true)
 	if err != nil {
 		return r, err
 	}
-	r, err = dialSendTCP(kdcs, b)
+	cl.dumpPacket(true, realm, "TCP", b)
+	r, err = cl.tcpConns.dialSendTCP(ctx, cl.kdcHealth.order(realm, "tcp", kdcs), b, cl.reportKDC(realm, "tcp"))
 	if err != nil {
 		return r, err
 	}
+	cl.dumpPacket(false, realm, "TCP", r)
 	return checkForKRBError(r)
 }
 
-// dialKDCTCP establishes a TCP connection to a KDC.
-func dialSendTCP(kdcs map[int]string, b []byte) ([]byte, error) {
-	var errs []string
-	for i := 1; i <= len(kdcs); i++ {
-		tcpAddr, err := net.ResolveTCPAddr("tcp", kdcs[i])
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error resolving KDC address: %v", err))
-			continue
+// tcpPoolSize is the maximum number of idle TCP connections held open for each KDC.
+const tcpPoolSize = 4
+
+// tcpIdleTimeout is how long an idle TCP connection is held for reuse. KDCs close connections that have been idle for
+// a while so connections idle for longer are closed rather than reused.
+const tcpIdleTimeout = 30 * time.Second
+
+// tcpPool holds idle TCP connections to KDCs so that they can be reused for subsequent exchanges rather than dialing a
+// new connection for each message.
+//
+// As with the udpPool a connection is only returned to the pool after a successful exchange. A KDC may close an idle
+// connection at any time so an exchange that fails on a reused connection is retried on a new connection.
+// A nil tcpPool dials a new connection for each exchange.
+type tcpPool struct {
+	conns map[string][]idleTCPConn
+	mux   sync.Mutex
+}
+
+// idleTCPConn is a connection held in the tcpPool and the time it was returned to the pool.
+type idleTCPConn struct {
+	conn  *net.TCPConn
+	since time.Time
+}
+
+// get returns an idle connection to the address or dials a new one. The boolean indicates if the connection was reused.
+func (p *tcpPool) get(ctx context.Context, addr string) (*net.TCPConn, bool, error) {
+	if p != nil {
+		p.mux.Lock()
+		if cs := p.conns[addr]; len(cs) > 0 {
+			c := cs[len(cs)-1]
+			p.conns[addr] = cs[:len(cs)-1]
+			if time.Since(c.since) < tcpIdleTimeout {
+				p.mux.Unlock()
+				return c.conn, true, nil
+			}
+			// The most recently used connection has expired so all of the older ones have too.
+			for _, c := range cs {
+				c.conn.Close()
+			}
+			delete(p.conns, addr)
+		}
+		p.mux.Unlock()
+	}
+	conn, err := dialTCP(ctx, addr)
+	return conn, false, err
+}
+
+// put returns the connection to the pool for reuse. The connection is closed if the pool is full.
+func (p *tcpPool) put(addr string, conn *net.TCPConn) {
+	if p == nil {
+		conn.Close()
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if len(p.conns[addr]) >= tcpPoolSize {
+		conn.Close()
+		return
+	}
+	if p.conns == nil {
+		p.conns = make(map[string][]idleTCPConn)
+	}
+	p.conns[addr] = append(p.conns[addr], idleTCPConn{conn: conn, since: time.Now()})
+}
+
+// idle returns the number of idle connections held for each KDC address.
+func (p *tcpPool) idle() map[string]int {
+	m := make(map[string]int)
+	if p == nil {
+		return m
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for addr, cs := range p.conns {
+		if len(cs) > 0 {
+			m[addr] = len(cs)
+		}
+	}
+	return m
+}
+
+// close closes all the idle connections in the pool.
+func (p *tcpPool) close() {
+	if p == nil {
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, cs := range p.conns {
+		for _, c := range cs {
+			c.conn.Close()
 		}
+	}
+	p.conns = nil
+}
 
-		conn, err := net.DialTimeout("tcp", tcpAddr.String(), 5*time.Second)
+// dialSendTCP sends the bytes to a KDC over TCP reusing a connection from the pool if one is available. If the report
+// function is not nil it is called with the result of the attempt with each KDC, other than for the context being done.
+func (p *tcpPool) dialSendTCP(ctx context.Context, kdcs map[int]string, b []byte, report func(string, error)) ([]byte, error) {
+	var errs []error
+	for i := 1; i <= len(kdcs); i++ {
+		if err := contextErr(ctx); err != nil {
+			return nil, err
+		}
+		rb, err := p.exchange(ctx, kdcs[i], b)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error setting dial timeout on connection to %s: %v", kdcs[i], err))
+			if cerr := contextErr(ctx); cerr != nil {
+				return nil, cerr
+			}
+			if report != nil {
+				report(kdcs[i], err)
+			}
+			errs = append(errs, err)
 			continue
 		}
-		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			errs = append(errs, fmt.Sprintf("error setting deadline on connection to %s: %v", kdcs[i], err))
-			continue
+		if report != nil {
+			report(kdcs[i], nil)
 		}
-		// conn is guaranteed to be a TCPConn
-		rb, err := sendTCP(conn.(*net.TCPConn), b)
+		return rb, nil
+	}
+	return nil, kdcErrors("error in getting a TCP connection to any of the KDCs", errs)
+}
+
+// exchange sends the bytes to the KDC at the address and returns the response. If the exchange fails on a reused
+// connection, which the KDC may have closed while it was idle, it is retried once on a new connection.
+func (p *tcpPool) exchange(ctx context.Context, addr string, b []byte) ([]byte, error) {
+	conn, reused, err := p.get(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	rb, err := sendTCP(ctx, conn, b)
+	if err != nil && reused && contextErr(ctx) == nil {
+		conn, err = dialTCP(ctx, addr)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error sneding to %s: %v", kdcs[i], err))
-			continue
+			return nil, err
 		}
+		rb, err = sendTCP(ctx, conn, b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error sending to %s: %w", addr, err)
+	}
+	if ctx.Err() != nil {
+		// The connection may have been closed as the context was done once the response was received.
+		conn.Close()
 		return rb, nil
 	}
-	return nil, errors.New("error in getting a TCP connection to any of the KDCs")
+	p.put(addr, conn)
+	return rb, nil
+}
+
+// dialSendTCP establishes a TCP connection to a KDC and sends the bytes.
+func dialSendTCP(ctx context.Context, kdcs map[int]string, b []byte) ([]byte, error) {
+	var p *tcpPool
+	return p.dialSendTCP(ctx, kdcs, b, nil)
+}
+
+// kdcErrors returns an error with the message provided listing the errors from each of the KDCs tried. The error from
+// the last KDC tried is wrapped so that it can be inspected with errors.Is and errors.As.
+func kdcErrors(msg string, errs []error) error {
+	if len(errs) < 1 {
+		return errors.New(msg)
+	}
+	var s string
+	for _, err := range errs[:len(errs)-1] {
+		s += err.Error() + "; "
+	}
+	return fmt.Errorf("%s: %s%w", msg, s, errs[len(errs)-1])
+}
+
+// dialTCP establishes a TCP connection to the KDC address.
+func dialTCP(ctx context.Context, addr string) (*net.TCPConn, error) {
+	if err := contextErr(ctx); err != nil {
+		return nil, err
+	}
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving KDC address: %w", err)
+	}
+	d := net.Dialer{Timeout: kdcTimeout(ctx)}
+	conn, err := d.DialContext(ctx, "tcp", tcpAddr.String())
+	if err != nil {
+		return nil, fmt.Errorf("error setting dial timeout on connection to %s: %w", addr, err)
+	}
+	if err := conn.SetDeadline(connDeadline(ctx)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error setting deadline on connection to %s: %w", addr, err)
+	}
+	// conn is guaranteed to be a TCPConn
+	return conn.(*net.TCPConn), nil
 }
 
-// sendTCP sends bytes to connection over TCP.
-func sendTCP(conn *net.TCPConn, b []byte) ([]byte, error) {
+// sendKDCTCPPipelined sends each of the requests to a KDC of the realm over a single TCP connection and returns the
+// responses in the order of the requests. If an error occurs the responses received before it are returned with the
+// error so that the remaining requests can be retried. If the KDC closes the connection before answering each request,
+// as MIT krb5kdc does after its first reply, requests to the realm are no longer pipelined.
+func (cl *Client) sendKDCTCPPipelined(ctx context.Context, realm string, reqs [][]byte) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cl.kdcHealth.serialPreferred(realm) {
+		return nil, errors.New("the KDCs of the realm do not answer pipelined requests")
+	}
+	if len(cl.kdcProxies(realm)) > 0 {
+		// Each request to a KDC proxy is a separate HTTP request so there is nothing to pipeline.
+		return nil, errors.New("pipelining is not supported via a KDC proxy")
+	}
+	if kdcExchange(ctx) != nil {
+		return nil, errors.New("pipelining is not supported via a KDC exchange")
+	}
+	ctx = withKDCTimeout(ctx, cl.kdcTimeout())
+	_, kdcs, err := cl.Config.GetKDCs(realm, true)
+	if err != nil {
+		return nil, err
+	}
+	kdcs = cl.kdcHealth.order(realm, "tcp", kdcs)
+	report := cl.reportKDC(realm, "tcp")
+	var conn *net.TCPConn
+	for i := 1; i <= len(kdcs); i++ {
+		conn, err = dialTCP(ctx, kdcs[i])
+		if err == nil {
+			break
+		}
+		if cerr := contextErr(ctx); cerr != nil {
+			return nil, cerr
+		}
+		if report != nil {
+			report(kdcs[i], err)
+		}
+	}
+	if conn == nil {
+		return nil, fmt.Errorf("error in getting a TCP connection to any of the KDCs: %w", err)
+	}
 	defer conn.Close()
-	var r []byte
-	// RFC 4120 7.2.2 specifies the first 4 bytes indicate the length of the message in big endian order.
-	hb := make([]byte, 4, 4)
-	binary.BigEndian.PutUint32(hb, uint32(len(b)))
-	b = append(hb, b...)
+	defer closeOnDone(ctx, conn)()
+	for _, b := range reqs {
+		cl.dumpPacket(true, realm, "TCP", b)
+	}
+	start := time.Now()
+	if err := writeTCPRequests(conn, reqs...); err != nil {
+		return nil, err
+	}
+	rbs := make([][]byte, 0, len(reqs))
+	for range reqs {
+		// Each response is given the same time as a single exchange.
+		if err := conn.SetDeadline(connDeadline(ctx)); err != nil {
+			return rbs, fmt.Errorf("error setting deadline on connection to %s: %w", conn.RemoteAddr().String(), err)
+		}
+		rb, err := readTCPResponse(conn)
+		if err != nil {
+			if cerr := contextErr(ctx); cerr != nil {
+				return rbs, cerr
+			}
+			var nerr net.Error
+			if len(reqs) > 1 && (!errors.As(err, &nerr) || !nerr.Timeout()) {
+				cl.Log("KDC %s of realm %s closed the connection after %d of %d pipelined requests, requests will be sent individually", conn.RemoteAddr().String(), realm, len(rbs), len(reqs))
+				cl.kdcHealth.preferSerial(realm)
+			}
+			return rbs, err
+		}
+		cl.dumpPacket(false, realm, "TCP", rb)
+		_, kerr := checkForKRBError(rb)
+		cl.recordExchange(reqs[len(rbs)], realm, time.Since(start), kerr)
+		rbs = append(rbs, rb)
+	}
+	return rbs, nil
+}
 
-	_, err := conn.Write(b)
+// contextErr returns the context's error. As the deadline of a connection set from the context's deadline can be
+// reached before the context is done, context.DeadlineExceeded is also returned once the deadline has passed.
+func contextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// connDeadline returns the deadline for an exchange on a connection to a KDC, after the KDC timeout of the context and
+// limited by the context's deadline.
+func connDeadline(ctx context.Context) time.Time {
+	d := time.Now().Add(kdcTimeout(ctx))
+	if cd, ok := ctx.Deadline(); ok && cd.Before(d) {
+		return cd
+	}
+	return d
+}
+
+// closeOnDone closes the connection if the context is done before the returned function is called so that a blocked
+// read or write on it returns. The returned function waits for this to be resolved so that once it returns the
+// connection is no longer closed asynchronously.
+func closeOnDone(ctx context.Context, c io.Closer) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+		<-exited
+	}
+}
+
+// maxTCPResponseSize is the largest response that will be accepted from a KDC over TCP.
+const maxTCPResponseSize = 16 << 20
+
+// tcpReadChunkSize is the size of the buffer initially allocated for a response.
+// Larger responses grow the buffer as the data is received rather than allocating the advertised size upfront.
+const tcpReadChunkSize = 64 << 10
+
+// sendTCP sends bytes to connection over TCP and reads the response. The connection is closed if the exchange fails.
+func sendTCP(ctx context.Context, conn *net.TCPConn, b []byte) ([]byte, error) {
+	if err := conn.SetDeadline(connDeadline(ctx)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error setting deadline on connection to %s: %w", conn.RemoteAddr().String(), err)
+	}
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+	err := writeTCPRequests(conn, b)
 	if err != nil {
-		return r, fmt.Errorf("error sending to KDC (%s): %v", conn.RemoteAddr().String(), err)
+		conn.Close()
+		return nil, err
 	}
+	rb, err := readTCPResponse(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return rb, nil
+}
 
-	sh := make([]byte, 4, 4)
-	_, err = conn.Read(sh)
+// writeTCPRequests writes each of the requests to the connection.
+func writeTCPRequests(conn *net.TCPConn, reqs ...[]byte) error {
+	// RFC 4120 7.2.2 specifies the first 4 bytes indicate the length of the message in big endian order.
+	hb := make([]byte, 4*len(reqs))
+	bufs := make(net.Buffers, 0, 2*len(reqs))
+	for i, b := range reqs {
+		binary.BigEndian.PutUint32(hb[4*i:], uint32(len(b)))
+		bufs = append(bufs, hb[4*i:4*i+4], b)
+	}
+	_, err := bufs.WriteTo(conn)
 	if err != nil {
-		return r, fmt.Errorf("error reading response size header: %v", err)
+		return fmt.Errorf("error sending to KDC (%s): %w", conn.RemoteAddr().String(), err)
 	}
-	s := binary.BigEndian.Uint32(sh)
+	return nil
+}
 
-	rb := make([]byte, s, s)
-	_, err = io.ReadFull(conn, rb)
+// readTCPResponse reads a length prefixed response from the reader.
+func readTCPResponse(rd io.Reader) ([]byte, error) {
+	var r []byte
+	sh := make([]byte, 4, 4)
+	_, err := io.ReadFull(rd, sh)
 	if err != nil {
-		return r, fmt.Errorf("error reading response: %v", err)
+		return r, fmt.Errorf("error reading response size header: %w", err)
+	}
+	s := int(binary.BigEndian.Uint32(sh))
+	if s < 1 {
+		return r, errors.New("no response data from KDC")
 	}
-	if len(rb) < 1 {
-		return r, fmt.Errorf("no response data from KDC %s", conn.RemoteAddr().String())
+	if s > maxTCPResponseSize {
+		return r, fmt.Errorf("response size of %d bytes is greater than the maximum of %d bytes", s, maxTCPResponseSize)
+	}
+	c := s
+	if c > tcpReadChunkSize {
+		c = tcpReadChunkSize
+	}
+	rb := make([]byte, 0, c)
+	for len(rb) < s {
+		if len(rb) == cap(rb) {
+			// Grow the buffer only once the data to fill it has been received
+			n := 2 * cap(rb)
+			if n > s {
+				n = s
+			}
+			nb := make([]byte, len(rb), n)
+			copy(nb, rb)
+			rb = nb
+		}
+		n, err := io.ReadFull(rd, rb[len(rb):cap(rb)])
+		rb = rb[:len(rb)+n]
+		if err != nil {
+			return r, fmt.Errorf("error reading response: %w", err)
+		}
 	}
 	return rb, nil
 }
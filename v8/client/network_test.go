@@ -0,0 +1,518 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/kkdcp"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testUDPKDC starts a UDP server that replies to each request with a stray datagram followed by the response.
+// The source addresses of the requests received are sent on the channel returned.
+func testUDPKDC(t *testing.T, stray, resp []byte) (*net.UDPConn, chan string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("error starting UDP server: %v", err)
+	}
+	srcs := make(chan string, 10)
+	go func() {
+		b := make([]byte, 4096)
+		for {
+			_, addr, err := conn.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			srcs <- addr.String()
+			conn.WriteToUDP(stray, addr)
+			conn.WriteToUDP(resp, addr)
+		}
+	}()
+	return conn, srcs
+}
+
+func TestUDPPool_dialSendUDP(t *testing.T) {
+	t.Parallel()
+	req := []byte{asn1AppTag(msgtype.KRB_AS_REQ), 0x00}
+	resp := []byte{asn1AppTag(msgtype.KRB_AS_REP), 0x01}
+	stray := []byte{asn1AppTag(msgtype.KRB_TGS_REP), 0x02}
+	kdc, srcs := testUDPKDC(t, stray, resp)
+	defer kdc.Close()
+	kdcs := map[int]string{1: kdc.LocalAddr().String()}
+
+	p := new(udpPool)
+	rb, err := p.dialSendUDP(context.Background(), kdcs, req, nil)
+	if err != nil {
+		t.Fatalf("error sending to KDC: %v", err)
+	}
+	assert.Equal(t, resp, rb, "response not as expected")
+	assert.Len(t, p.conns[kdc.LocalAddr().String()], 1, "socket not returned to the pool")
+	rb, err = p.dialSendUDP(context.Background(), kdcs, req, nil)
+	if err != nil {
+		t.Fatalf("error sending to KDC: %v", err)
+	}
+	assert.Equal(t, resp, rb, "response not as expected")
+	assert.Equal(t, <-srcs, <-srcs, "socket was not reused")
+
+	// A nil pool does not reuse sockets
+	var np *udpPool
+	np.dialSendUDP(context.Background(), kdcs, req, nil)
+	np.dialSendUDP(context.Background(), kdcs, req, nil)
+	assert.NotEqual(t, <-srcs, <-srcs, "socket should not have been reused")
+
+	p.close()
+	assert.Len(t, p.conns, 0, "sockets not closed")
+}
+
+func TestUDPPool_dialSendUDP_Failure(t *testing.T) {
+	t.Parallel()
+	kdc, _ := testUDPKDC(t, nil, nil)
+	addr := kdc.LocalAddr().String()
+	kdc.Close()
+
+	p := new(udpPool)
+	_, err := p.dialSendUDP(context.Background(), map[int]string{1: addr}, []byte{asn1AppTag(msgtype.KRB_AS_REQ), 0x00}, nil)
+	assert.Error(t, err, "expected error sending to a closed port")
+	assert.Len(t, p.conns[addr], 0, "failed socket should not be returned to the pool")
+}
+
+func TestIsResponseTo(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		req, resp int
+		expected  bool
+	}{
+		{msgtype.KRB_AS_REQ, msgtype.KRB_AS_REP, true},
+		{msgtype.KRB_AS_REQ, msgtype.KRB_ERROR, true},
+		{msgtype.KRB_AS_REQ, msgtype.KRB_TGS_REP, false},
+		{msgtype.KRB_TGS_REQ, msgtype.KRB_TGS_REP, true},
+		{msgtype.KRB_TGS_REQ, msgtype.KRB_AS_REP, false},
+		{msgtype.KRB_AP_REQ, msgtype.KRB_AP_REP, true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, isResponseTo([]byte{asn1AppTag(test.req)}, []byte{asn1AppTag(test.resp)}),
+			"response %d to request %d not as expected", test.resp, test.req)
+	}
+}
+
+func testTCPResponse(s int, b []byte) []byte {
+	hb := make([]byte, 4)
+	binary.BigEndian.PutUint32(hb, uint32(s))
+	return append(hb, b...)
+}
+
+func TestReadTCPResponse(t *testing.T) {
+	t.Parallel()
+	small := []byte{0x6b, 0x01, 0x02}
+	large := bytes.Repeat([]byte{0x01, 0x02, 0x03}, 100000)
+	var tests = []struct {
+		name string
+		b    []byte
+		want []byte
+	}{
+		{"small", testTCPResponse(len(small), small), small},
+		{"large", testTCPResponse(len(large), large), large},
+		// Data after the advertised length is not read
+		{"trailing", testTCPResponse(len(small), append(small, 0xff)), small},
+	}
+	for _, test := range tests {
+		rb, err := readTCPResponse(iotest.HalfReader(bytes.NewReader(test.b)))
+		if err != nil {
+			t.Errorf("%s: error reading response: %v", test.name, err)
+			continue
+		}
+		assert.Equal(t, test.want, rb, "%s: response not as expected", test.name)
+	}
+
+	var errTests = []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", testTCPResponse(0, nil)},
+		{"oversized", testTCPResponse(maxTCPResponseSize+1, small)},
+		{"truncated", testTCPResponse(len(large), large[:1000])},
+		{"no header", []byte{0x00, 0x01}},
+	}
+	for _, test := range errTests {
+		_, err := readTCPResponse(bytes.NewReader(test.b))
+		assert.Error(t, err, "%s: expected error", test.name)
+	}
+}
+
+// testKDCProxy starts a KDC proxy that replies to each TGS_REQ for the realm with a TGS_REP.
+func testKDCProxy(t *testing.T, skey types.EncryptionKey) (*httptest.Server, *int32) {
+	var reqs int32
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		b, _ := ioutil.ReadAll(r.Body)
+		var m kkdcp.KDCProxyMessage
+		if err := m.Unmarshal(b); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		kb, err := m.Message()
+		if err != nil || m.TargetDomain != "TEST.GOKRB5" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		rb, err := testTGSRep(kb, skey)
+		if err != nil {
+			t.Errorf("error creating response: %v", err)
+			http.Error(w, "error", http.StatusInternalServerError)
+			return
+		}
+		rm := kkdcp.NewKDCProxyMessage("", rb)
+		mb, _ := rm.Marshal()
+		w.Header().Set("Content-Type", kkdcp.ContentType)
+		w.Write(mb)
+	}))
+	return s, &reqs
+}
+
+func TestClient_KDCProxy(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	s, reqs := testKDCProxy(t, skey)
+	defer s.Close()
+
+	// KDC proxy configured as the realm's KDC
+	cl := testTGSClient(t, s.URL+"/KdcProxy", skey)
+	defer cl.Destroy()
+	KDCProxyHTTPClient(s.Client())(cl.settings)
+	tkt, _, err := cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket via KDC proxy: %v", err)
+	}
+	assert.Equal(t, "HTTP/host.test.gokrb5", tkt.SName.PrincipalNameString(), "ticket not as expected")
+	assert.Equal(t, int32(1), atomic.LoadInt32(reqs), "request should have been sent to the KDC proxy")
+
+	_, _, err = cl.GetServiceTicket("HTTP/unknown.test.gokrb5")
+	assert.True(t, errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN}), "KDC error should be returned via the KDC proxy: %v", err)
+
+	// Pipelined requests fall back to a request per ticket
+	results := cl.GetServiceTickets(context.Background(), []string{"HTTP/host1.test.gokrb5", "HTTP/host2.test.gokrb5"})
+	for spn, r := range results {
+		assert.NoError(t, r.Err, "error getting service ticket for %s via KDC proxy", spn)
+	}
+
+	// KDC proxy configured in the settings overrides the realm's KDCs
+	pcl := testTGSClient(t, "127.0.0.1:1", skey)
+	defer pcl.Destroy()
+	KDCProxy(s.URL + "/KdcProxy")(pcl.settings)
+	KDCProxyHTTPClient(s.Client())(pcl.settings)
+	_, _, err = pcl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket via KDC proxy setting")
+
+	// The KDC proxy's certificate must be trusted
+	ucl := testTGSClient(t, s.URL+"/KdcProxy", skey)
+	defer ucl.Destroy()
+	_, _, err = ucl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.Error(t, err, "KDC proxy with an untrusted certificate should not be used")
+}
+
+// testSilentKDC starts a TCP server that accepts connections but never responds.
+func testSilentKDC(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting TCP server: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ioutil.ReadAll(conn)
+			}()
+		}
+	}()
+	return l
+}
+
+func TestClient_Context(t *testing.T) {
+	t.Parallel()
+	l := testSilentKDC(t)
+	defer l.Close()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	cl := testTGSClient(t, l.Addr().String(), skey)
+	defer cl.Destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := cl.GetServiceTicketContext(ctx, "HTTP/host.test.gokrb5")
+	assert.True(t, errors.Is(err, context.Canceled), "cancelled context error should be returned: %v", err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = cl.GetServiceTicketContext(ctx, "HTTP/host.test.gokrb5")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "deadline exceeded error should be returned: %v", err)
+	assert.True(t, time.Since(start) < 2*time.Second, "TGS exchange should be abandoned at the context's deadline")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start = time.Now()
+	err = cl.LoginContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled), "cancelled context error should be returned: %v", err)
+	assert.True(t, time.Since(start) < 2*time.Second, "AS exchange should be abandoned when the context is cancelled")
+}
+
+func TestUDPPool_dialSendUDP_Context(t *testing.T) {
+	t.Parallel()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("error starting UDP server: %v", err)
+	}
+	defer conn.Close()
+	p := new(udpPool)
+	defer p.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = p.dialSendUDP(ctx, map[int]string{1: conn.LocalAddr().String()}, []byte{asn1AppTag(msgtype.KRB_AS_REQ), 0x00}, nil)
+	assert.True(t, errors.Is(err, context.Canceled), "cancelled context error should be returned: %v", err)
+	assert.True(t, time.Since(start) < 2*time.Second, "UDP exchange should be abandoned when the context is cancelled")
+	assert.Empty(t, p.idle(), "socket of an abandoned exchange should not be returned to the pool")
+}
+
+func TestTCPPool_dialSendTCP(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	l, conns := testTCPKDC(t, skey, 0)
+	defer l.Close()
+	addr := l.Addr().String()
+	cl := testTGSClient(t, addr, skey)
+	defer cl.Destroy()
+
+	for i := 0; i < 3; i++ {
+		_, _, err := cl.GetServiceTicket(fmt.Sprintf("HTTP/host%d.test.gokrb5", i))
+		if err != nil {
+			t.Fatalf("error getting service ticket: %v", err)
+		}
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns), "connection should be reused for each exchange")
+	assert.Equal(t, map[string]int{addr: 1}, cl.tcpConns.idle(), "connection should be returned to the pool")
+
+	// Connections idle for longer than the timeout are not reused
+	p := cl.tcpConns
+	p.mux.Lock()
+	p.conns[addr][0].since = time.Now().Add(-tcpIdleTimeout)
+	p.mux.Unlock()
+	_, _, err := cl.GetServiceTicket("HTTP/host3.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket")
+	assert.Equal(t, int32(2), atomic.LoadInt32(conns), "expired connection should not be reused")
+	assert.Equal(t, map[string]int{addr: 1}, cl.tcpConns.idle(), "expired connection should be closed")
+
+	cl.Destroy()
+	assert.Empty(t, cl.tcpConns.idle(), "idle connections should be closed when the client is destroyed")
+}
+
+func TestTCPPool_dialSendTCP_ClosedByKDC(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	l, conns := testTCPKDC(t, skey, 1)
+	defer l.Close()
+	cl := testTGSClient(t, l.Addr().String(), skey)
+	defer cl.Destroy()
+
+	for i := 0; i < 2; i++ {
+		_, _, err := cl.GetServiceTicket(fmt.Sprintf("HTTP/host%d.test.gokrb5", i))
+		if err != nil {
+			t.Fatalf("exchange on a connection closed by the KDC should be retried: %v", err)
+		}
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(conns), "a new connection should be dialed once the KDC closed the idle one")
+}
+
+// testFlakyKDC starts a TCP server that closes the first connections, up to the number given, without responding and
+// then replies to each request with the response. The number of connections accepted is also returned.
+func testFlakyKDC(t *testing.T, fail int32, resp []byte) (net.Listener, *int32) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting TCP server: %v", err)
+	}
+	var conns int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if atomic.AddInt32(&conns, 1) <= fail {
+				conn.Close()
+				continue
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					if _, err := readTCPResponse(conn); err != nil {
+						return
+					}
+					hb := make([]byte, 4)
+					binary.BigEndian.PutUint32(hb, uint32(len(resp)))
+					conn.Write(append(hb, resp...))
+				}
+			}()
+		}
+	}()
+	return l, &conns
+}
+
+func TestClient_KDCMaxRetries(t *testing.T) {
+	t.Parallel()
+	req := []byte{asn1AppTag(msgtype.KRB_AS_REQ), 0x00}
+	resp := []byte{asn1AppTag(msgtype.KRB_AS_REP), 0x01}
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	l, conns := testFlakyKDC(t, 2, resp)
+	defer l.Close()
+
+	cl := testTGSClient(t, l.Addr().String(), skey)
+	defer cl.Destroy()
+	_, err := cl.sendToKDC(context.Background(), req, "TEST.GOKRB5")
+	assert.Error(t, err, "exchange should fail without retries")
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns), "KDC should be tried once by default")
+	assert.True(t, errors.Is(err, krberror.ErrKDCUnreachable), "error should match ErrKDCUnreachable")
+	assert.Equal(t, krberror.KindNetwork, krberror.ErrorKind(err), "error kind not as expected")
+
+	cl = testTGSClient(t, l.Addr().String(), skey, KDCMaxRetries(2), KDCRetryBackoff(10*time.Millisecond))
+	defer cl.Destroy()
+	rb, err := cl.sendToKDC(context.Background(), req, "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("exchange should succeed once retried: %v", err)
+	}
+	assert.Equal(t, resp, rb, "response not as expected")
+	assert.Equal(t, int32(3), atomic.LoadInt32(conns), "KDC should be tried again with max_retries")
+
+	// A KRBError is a response from the KDC so the exchange is not retried.
+	e := messages.NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, "unknown")
+	eb, _ := e.Marshal()
+	el, econns := testFlakyKDC(t, 0, eb)
+	defer el.Close()
+	cl = testTGSClient(t, el.Addr().String(), skey, KDCMaxRetries(3), KDCRetryBackoff(10*time.Millisecond))
+	defer cl.Destroy()
+	_, err = cl.sendToKDC(context.Background(), req, "TEST.GOKRB5")
+	assert.Error(t, err, "KRBError should be returned")
+	assert.Equal(t, int32(1), atomic.LoadInt32(econns), "a KRBError should not be retried")
+	assert.True(t, errors.Is(err, krberror.ErrClientUnknown), "error should match its error code")
+	assert.False(t, errors.Is(err, krberror.ErrKDCUnreachable), "KRBError should not match ErrKDCUnreachable")
+}
+
+func TestClient_KDCTimeout(t *testing.T) {
+	t.Parallel()
+	req := []byte{asn1AppTag(msgtype.KRB_AS_REQ), 0x00}
+	l := testSilentKDC(t)
+	defer l.Close()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+
+	cl := testTGSClient(t, l.Addr().String(), skey, KDCTimeout(100*time.Millisecond))
+	defer cl.Destroy()
+	start := time.Now()
+	_, err := cl.sendToKDC(context.Background(), req, "TEST.GOKRB5")
+	assert.Error(t, err, "exchange with a silent KDC should fail")
+	assert.True(t, time.Since(start) < 2*time.Second, "exchange should time out after the KDC timeout set")
+
+	cl = testTGSClient(t, l.Addr().String(), skey, KDCTimeout(100*time.Millisecond), KDCMaxRetries(3), KDCRetryBackoff(50*time.Millisecond))
+	defer cl.Destroy()
+	start = time.Now()
+	_, err = cl.sendToKDC(context.Background(), req, "TEST.GOKRB5")
+	d := time.Since(start)
+	assert.Error(t, err, "exchange with a silent KDC should fail")
+	// Three timeouts and backoffs of 50 and 100 milliseconds.
+	assert.True(t, d >= 450*time.Millisecond && d < 3*time.Second, "time of the exchange with retries, %v, not as expected", d)
+
+	cl = testTGSClient(t, l.Addr().String(), skey, KDCTimeout(100*time.Millisecond), KDCMaxRetries(100),
+		KDCRetryBackoff(10*time.Millisecond), KDCExchangeBudget(300*time.Millisecond))
+	defer cl.Destroy()
+	start = time.Now()
+	_, err = cl.sendToKDC(context.Background(), req, "TEST.GOKRB5")
+	d = time.Since(start)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "exchange should fail at the end of its budget: %v", err)
+	assert.True(t, d < 2*time.Second, "exchange should be abandoned at the end of its budget, took %v", d)
+}
+
+func TestClient_KDCTimeoutSettings(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewFromString("[libdefaults]\n kdc_timeout = 3\n max_retries = 2\n")
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c)
+	assert.Equal(t, 3*time.Second, cl.kdcTimeout(), "KDC timeout of the krb5.conf not used")
+	assert.Equal(t, 2, cl.kdcMaxRetries(), "max retries of the krb5.conf not used")
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, KDCTimeout(time.Second), KDCMaxRetries(4))
+	assert.Equal(t, time.Second, cl.kdcTimeout(), "KDC timeout set should override the krb5.conf")
+	assert.Equal(t, 4, cl.kdcMaxRetries(), "max retries set should override the krb5.conf")
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", &config.Config{})
+	assert.Equal(t, 1, cl.kdcMaxRetries(), "KDCs should be tried once without configuration")
+	assert.Equal(t, defaultKDCTimeout, kdcTimeout(withKDCTimeout(context.Background(), cl.kdcTimeout())),
+		"default KDC timeout should be used without configuration")
+}
+
+func TestClient_ResponseTooBig(t *testing.T) {
+	t.Parallel()
+	req := []byte{asn1AppTag(msgtype.KRB_AS_REQ), 0x00}
+	resp := []byte{asn1AppTag(msgtype.KRB_AS_REP), 0x01}
+	l, _ := testFlakyKDC(t, 0, resp)
+	defer l.Close()
+	// The UDP KDC on the same port replies that responses are too big for UDP.
+	e := messages.NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", errorcode.KRB_ERR_RESPONSE_TOO_BIG, "too big")
+	eb, _ := e.Marshal()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: l.Addr().(*net.TCPAddr).Port})
+	if err != nil {
+		t.Skipf("UDP port of the TCP KDC not available: %v", err)
+	}
+	defer conn.Close()
+	var udpReqs int32
+	go func() {
+		b := make([]byte, 4096)
+		for {
+			_, addr, err := conn.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&udpReqs, 1)
+			conn.WriteToUDP(eb, addr)
+		}
+	}()
+
+	c, err := config.NewFromString(fmt.Sprintf("[libdefaults]\n default_realm = TEST.GOKRB5\n[realms]\n TEST.GOKRB5 = {\n  kdc = %s\n }\n", l.Addr().String()))
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c)
+	defer cl.Destroy()
+	for i := 0; i < 3; i++ {
+		rb, err := cl.sendToKDC(context.Background(), req, "TEST.GOKRB5")
+		if err != nil {
+			t.Fatalf("error sending to KDC: %v", err)
+		}
+		assert.Equal(t, resp, rb, "response not as expected")
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&udpReqs), "TCP should be used once a response was too big for UDP")
+
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, TCPOnly(true))
+	defer cl.Destroy()
+	_, err = cl.sendToKDC(context.Background(), req, "TEST.GOKRB5")
+	assert.NoError(t, err, "error sending to KDC over TCP")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&udpReqs), "UDP should not be used with TCPOnly")
+}
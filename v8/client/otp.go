@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/fast"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// OTPResponse is the one-time password collected for the KDC's OTP challenge.
+type OTPResponse struct {
+	// Token is the index of the token of the challenge's TokenInfo the one-time password is from.
+	Token int
+	// Value is the one-time password, combined with the PIN if the token requires.
+	Value string
+	// PIN is the token's PIN if it is collected separately from the one-time password, or empty.
+	PIN string
+}
+
+// OTPPrompter is implemented by sources of the one-time passwords the client pre-authenticates with, typically by
+// prompting the user for the code of their token.
+type OTPPrompter interface {
+	// PromptOTP returns the one-time password for one of the tokens the KDC's challenge describes. The KDC's
+	// challenge is abandoned if an error is returned.
+	PromptOTP(ctx context.Context, challenge fast.OTPChallenge) (OTPResponse, error)
+}
+
+// OTPPrompterFunc is an adapter to allow the use of ordinary functions as an OTPPrompter.
+type OTPPrompterFunc func(ctx context.Context, challenge fast.OTPChallenge) (OTPResponse, error)
+
+// PromptOTP calls f(ctx, challenge).
+func (f OTPPrompterFunc) PromptOTP(ctx context.Context, challenge fast.OTPChallenge) (OTPResponse, error) {
+	return f(ctx, challenge)
+}
+
+// setOTPPAData adds a PA-OTP-REQUEST with the one-time password collected by the client's OTP prompter to the AS_REQ
+// if the KDC's error offers OTP pre-authentication over the FAST armor. It returns whether the PA data was added.
+func (cl *Client) setOTPPAData(ctx context.Context, krberr *messages.KRBError, ASReq *messages.ASReq, fa *fast.Armor) (bool, error) {
+	if fa == nil || cl.settings.OTP() == nil {
+		return false, nil
+	}
+	pas, err := cl.kdcPAData(krberr)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.EncodingError, "error unmashalling KRBError data")
+	}
+	c, ok, err := fast.OTPChallengeFromPAData(pas)
+	if err != nil || !ok {
+		return false, err
+	}
+	r, err := cl.settings.OTP().PromptOTP(ctx, c)
+	if err != nil {
+		return false, fmt.Errorf("error collecting one-time password: %w", err)
+	}
+	if r.Token < 0 || r.Token >= len(c.TokenInfo) {
+		return false, fmt.Errorf("one-time password is for token %d but the KDC's challenge describes %d", r.Token, len(c.TokenInfo))
+	}
+	pa, err := fa.OTPRequest(c, c.TokenInfo[r.Token], []byte(r.Value), r.PIN)
+	if err != nil {
+		return false, err
+	}
+	cl.Log("pre-authenticating %s with a one-time password", cl.Credentials.CName().PrincipalNameString())
+	replacePAData(ASReq, pa)
+	return true, nil
+}
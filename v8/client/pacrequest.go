@@ -0,0 +1,28 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// addPACRequest adds the PA-PAC-REQUEST of the IncludePAC setting to the PA data of a request, replacing any present.
+func (cl *Client) addPACRequest(pas *types.PADataSequence) error {
+	include, ok := cl.settings.IncludePAC()
+	if !ok {
+		return nil
+	}
+	pr := types.PAPACRequest{IncludePAC: include}
+	b, err := pr.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PAC-REQUEST")
+	}
+	for i := 0; i < len(*pas); i++ {
+		if (*pas)[i].PADataType == patype.PA_PAC_REQUEST {
+			*pas = append((*pas)[:i], (*pas)[i+1:]...)
+			i--
+		}
+	}
+	*pas = append(*pas, types.PAData{PADataType: patype.PA_PAC_REQUEST, PADataValue: b})
+	return nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// pacRequest returns the include-pac value of the PA-PAC-REQUEST of the PA data and whether there is one.
+func pacRequest(t *testing.T, pas types.PADataSequence) (bool, bool) {
+	var found, include bool
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_PAC_REQUEST {
+			continue
+		}
+		assert.False(t, found, "there should be one PA-PAC-REQUEST")
+		var pr types.PAPACRequest
+		if err := pr.Unmarshal(pa.PADataValue); err != nil {
+			t.Fatalf("error unmarshaling PA-PAC-REQUEST: %v", err)
+		}
+		found, include = true, pr.IncludePAC
+	}
+	return include, found
+}
+
+func TestClient_IncludePAC(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New())
+	var pas types.PADataSequence
+	assert.NoError(t, cl.addPACRequest(&pas), "error adding PA-PAC-REQUEST")
+	assert.Empty(t, pas, "no PA-PAC-REQUEST should be sent by default")
+
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), IncludePAC(true))
+	pas = types.PADataSequence{{PADataType: patype.PA_PAC_REQUEST, PADataValue: []byte{0}}}
+	assert.NoError(t, cl.addPACRequest(&pas), "error adding PA-PAC-REQUEST")
+	include, ok := pacRequest(t, pas)
+	assert.True(t, ok && include, "PA-PAC-REQUEST should ask for the PAC")
+
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	cl = testTGSClient(t, "127.0.0.1:88", skey, IncludePAC(false))
+	defer cl.Destroy()
+	tgt, _, err := cl.sessionTGT(context.Background(), "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error getting TGT: %v", err)
+	}
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName(), "TEST.GOKRB5", cl.Config, tgt, skey,
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"), false)
+	if err != nil {
+		t.Fatalf("error creating TGS_REQ: %v", err)
+	}
+	b, _, err := cl.marshalTGSReq(context.Background(), &tgsReq, tgt, skey)
+	if err != nil {
+		t.Fatalf("error marshaling TGS_REQ: %v", err)
+	}
+	var sent messages.TGSReq
+	if err := sent.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling TGS_REQ: %v", err)
+	}
+	include, ok = pacRequest(t, sent.PAData)
+	assert.True(t, ok, "TGS_REQ should have a PA-PAC-REQUEST")
+	assert.False(t, include, "PA-PAC-REQUEST should ask for the PAC to be omitted")
+	assert.True(t, sent.PAData.Contains(patype.PA_TGS_REQ), "PA-TGS-REQ should be kept")
+}
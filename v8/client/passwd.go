@@ -1,10 +1,13 @@
 package client
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/kadmin"
 	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
 )
 
 // Kpasswd server response codes.
@@ -21,51 +24,126 @@ const (
 
 // ChangePasswd changes the password of the client to the value provided.
 func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
-	ASReq, err := messages.NewASReqForChgPasswd(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	ok, err := cl.changePasswd(newPasswd)
+	return ok, cl.correlate(err)
+}
+
+func (cl *Client) changePasswd(newPasswd string) (bool, error) {
+	tkt, key, err := cl.kpasswdTicket(true)
 	if err != nil {
 		return false, err
 	}
-	ASRep, err := cl.ASExchange(cl.Credentials.Domain(), ASReq, 0)
+	msg, key, err := kadmin.ChangePasswdMsg(cl.Credentials.CName(), cl.Credentials.Domain(), newPasswd, tkt, key)
 	if err != nil {
 		return false, err
 	}
+	if err := cl.kpasswd(msg, key); err != nil {
+		return false, err
+	}
+	cl.Credentials.WithPassword(newPasswd)
+	return true, nil
+}
+
+// SetPasswd sets the password of the target principal of the realm to the value provided with the RFC 3244 set
+// password operation, such as for an administrator to reset the password of another principal. The kpasswd server of
+// the client's realm must authorise the client to set the target principal's password. The client's realm is used if
+// the realm is empty.
+func (cl *Client) SetPasswd(target types.PrincipalName, realm, newPasswd string) (bool, error) {
+	ok, err := cl.setPasswd(target, realm, newPasswd)
+	return ok, cl.correlate(err)
+}
 
-	msg, key, err := kadmin.ChangePasswdMsg(cl.Credentials.CName(), cl.Credentials.Domain(), newPasswd, ASRep.Ticket, ASRep.DecryptedEncPart.Key)
+func (cl *Client) setPasswd(target types.PrincipalName, realm, newPasswd string) (bool, error) {
+	if realm == "" {
+		realm = cl.Credentials.Domain()
+	}
+	tkt, key, err := cl.kpasswdTicket(cl.hasSecret())
 	if err != nil {
 		return false, err
 	}
-	r, err := cl.sendToKPasswd(msg)
+	msg, key, err := kadmin.SetPasswdMsg(cl.Credentials.CName(), cl.Credentials.Domain(), target, realm, newPasswd, tkt, key)
 	if err != nil {
 		return false, err
 	}
+	if err := cl.kpasswd(msg, key); err != nil {
+		return false, err
+	}
+	if target.Equal(cl.Credentials.CName()) && realm == cl.Credentials.Domain() {
+		cl.Credentials.WithPassword(newPasswd)
+	}
+	return true, nil
+}
+
+// kpasswdTicket returns a kadmin/changepw ticket of the client's realm and its session key. With initial true the
+// ticket is obtained with an AS exchange, as kpasswd servers require to change the client's own password, otherwise it
+// is obtained with a TGS exchange using the client's TGT.
+func (cl *Client) kpasswdTicket(initial bool) (messages.Ticket, types.EncryptionKey, error) {
+	realm := cl.Credentials.Domain()
+	if initial {
+		ASReq, err := messages.NewASReqForChgPasswd(realm, cl.Config, cl.Credentials.CName())
+		if err != nil {
+			return messages.Ticket{}, types.EncryptionKey{}, err
+		}
+		ASReq.ReqBody.SetTimes(cl.now(), cl.Config)
+		ASRep, err := cl.ASExchange(realm, ASReq, 0)
+		if err != nil {
+			return messages.Ticket{}, types.EncryptionKey{}, err
+		}
+		return ASRep.Ticket, ASRep.DecryptedEncPart.Key, nil
+	}
+	tgt, skey, err := cl.sessionTGT(context.Background(), realm)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	spn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "kadmin/changepw")
+	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, realm, tgt, skey, false)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// kpasswd sends the kpasswd request to the kpasswd server and checks its reply, decrypted with the key, is a success.
+func (cl *Client) kpasswd(msg kadmin.Request, key types.EncryptionKey) error {
+	r, err := cl.sendToKPasswd(msg)
+	if err != nil {
+		return err
+	}
 	err = r.Decrypt(key)
 	if err != nil {
-		return false, err
+		return err
 	}
 	if r.ResultCode != KRB5_KPASSWD_SUCCESS {
-		return false, fmt.Errorf("error response from kadmin: code: %d; result: %s; krberror: %v", r.ResultCode, r.Result, r.KRBError)
+		return fmt.Errorf("error response from kadmin: code: %d; result: %s; krberror: %v", r.ResultCode, r.Result, r.KRBError)
 	}
-	cl.Credentials.WithPassword(newPasswd)
-	return true, nil
+	return nil
 }
 
 func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error) {
-	_, kps, err := cl.Config.GetKpasswdServers(cl.Credentials.Domain(), true)
+	b, err := msg.Marshal()
 	if err != nil {
 		return
 	}
-	b, err := msg.Marshal()
+	var rb []byte
+	if proxies := cl.kpasswdProxies(); len(proxies) > 0 {
+		rb, err = dialSendHTTPS(context.Background(), cl.settings.KDCProxyHTTPClient(), proxies, cl.Credentials.Domain(), b)
+		if err != nil {
+			return
+		}
+		err = r.Unmarshal(rb)
+		return
+	}
+	_, kps, err := cl.Config.GetKpasswdServers(cl.Credentials.Domain(), true)
 	if err != nil {
 		return
 	}
-	var rb []byte
 	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
-		rb, err = dialSendUDP(kps, b)
+		rb, err = dialSendUDP(withKDCTimeout(context.Background(), cl.kdcTimeout()), kps, b)
 		if err != nil {
 			return
 		}
 	} else {
-		rb, err = dialSendTCP(kps, b)
+		rb, err = dialSendTCP(withKDCTimeout(context.Background(), cl.kdcTimeout()), kps, b)
 		if err != nil {
 			return
 		}
@@ -73,3 +151,11 @@ func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error)
 	err = r.Unmarshal(rb)
 	return
 }
+
+// kpasswdProxies returns the URLs of the KDC proxies to send kpasswd messages for the client's realm to, if any.
+func (cl *Client) kpasswdProxies() []string {
+	if u := cl.settings.KDCProxy(); u != "" {
+		return []string{u}
+	}
+	return cl.Config.GetKpasswdProxies(cl.Credentials.Domain())
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/pkinit"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// NewWithCertificate creates a new client that authenticates with the X.509 certificate and its private key using
+// PKINIT pre-authentication, such as for smartcard logins. The trust anchors for the KDC's certificate can be
+// configured with the PKINITAnchors setting.
+func NewWithCertificate(username, realm string, cert *x509.Certificate, key crypto.Signer, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	creds := credentials.New(username, realm)
+	return newClient(creds.WithCertificate(cert, key), krb5conf, NewSettings(settings...))
+}
+
+// NewAnonymous creates a new client that obtains anonymous tickets for the realm using anonymous PKINIT, RFC 8062,
+// such as a TGT to use as FAST armor when the client has no keytab. The KDC is authenticated by its certificate so the
+// trust anchors for the KDC's certificate should be configured with the PKINITAnchors setting.
+func NewAnonymous(realm string, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	return newClient(credentials.NewFromPrincipalName(pkinit.AnonymousPrincipalName(), realm), krb5conf, NewSettings(settings...))
+}
+
+// anonymous reports if the client is for the anonymous principal.
+func (cl *Client) anonymous() bool {
+	return cl.Credentials.CName().Equal(pkinit.AnonymousPrincipalName())
+}
+
+// setPKINITPAData adds the PKINIT pre-authentication data to the AS_REQ if the client has a certificate or is
+// anonymous. The request returned is used to derive the key of the AS_REP and is nil if PKINIT is not used.
+func (cl *Client) setPKINITPAData(ASReq *messages.ASReq) (*pkinit.Request, error) {
+	var r *pkinit.Request
+	switch {
+	case cl.Credentials.HasCertificate():
+		r = pkinit.NewRequest(cl.Credentials.Certificate(), cl.Credentials.PrivateKey(), cl.settings.PKINITAnchors())
+	case cl.anonymous():
+		// The option is set before the PA data as the PKINIT checksum is over the request body.
+		types.SetFlag(&ASReq.ReqBody.KDCOptions, flags.RequestAnonymous)
+		r = pkinit.NewAnonymousRequest(cl.settings.PKINITAnchors())
+	default:
+		return nil, nil
+	}
+	pa, err := r.PAData(ASReq)
+	if err != nil {
+		return nil, err
+	}
+	// Replace any PA-PK-AS-REQ from a previous attempt
+	for i := range ASReq.PAData {
+		if ASReq.PAData[i].PADataType == patype.PA_PK_AS_REQ {
+			ASReq.PAData[i] = pa
+			return r, nil
+		}
+	}
+	ASReq.PAData = append(ASReq.PAData, pa)
+	return r, nil
+}
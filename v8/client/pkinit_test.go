@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_setPKINITPAData(t *testing.T) {
+	t.Parallel()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "testuser1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(b)
+	c := config.New()
+	c.LibDefaults.DNSLookupKDC = true
+	cl := NewWithCertificate("testuser1", "TEST.GOKRB5", cert, key, c, AssumePreAuthentication(true))
+	ok, err := cl.IsConfigured()
+	assert.True(t, ok, "client with a certificate should be configured: %v", err)
+
+	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	err = setPAData(context.Background(), cl, nil, &ASReq, nil)
+	if err != nil {
+		t.Fatalf("error setting PA data: %v", err)
+	}
+	assert.False(t, ASReq.PAData.Contains(patype.PA_ENC_TIMESTAMP), "encrypted timestamp should not be added for a certificate")
+	r, err := cl.setPKINITPAData(&ASReq)
+	if err != nil {
+		t.Fatalf("error setting PKINIT PA data: %v", err)
+	}
+	assert.NotNil(t, r, "PKINIT request not returned")
+	_, err = cl.setPKINITPAData(&ASReq)
+	if err != nil {
+		t.Fatalf("error setting PKINIT PA data: %v", err)
+	}
+	var n int
+	for _, pa := range ASReq.PAData {
+		if pa.PADataType == patype.PA_PK_AS_REQ {
+			n++
+		}
+	}
+	assert.Equal(t, 1, n, "AS_REQ should have one PA-PK-AS-REQ")
+
+	pcl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c)
+	r, err = pcl.setPKINITPAData(&ASReq)
+	assert.Nil(t, r, "PKINIT should not be used without a certificate")
+	assert.NoError(t, err)
+}
+
+func TestClient_Anonymous(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.DNSLookupKDC = true
+	cl := NewAnonymous("TEST.GOKRB5", c, AssumePreAuthentication(true))
+	ok, err := cl.IsConfigured()
+	assert.True(t, ok, "anonymous client should be configured: %v", err)
+	assert.Equal(t, "WELLKNOWN/ANONYMOUS", cl.Credentials.CName().PrincipalNameString(), "client name not as expected")
+
+	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	err = setPAData(context.Background(), cl, nil, &ASReq, nil)
+	if err != nil {
+		t.Fatalf("error setting PA data: %v", err)
+	}
+	assert.False(t, ASReq.PAData.Contains(patype.PA_ENC_TIMESTAMP), "encrypted timestamp should not be added for an anonymous client")
+	r, err := cl.setPKINITPAData(&ASReq)
+	if err != nil {
+		t.Fatalf("error setting PKINIT PA data: %v", err)
+	}
+	if assert.NotNil(t, r, "PKINIT request not returned") {
+		assert.True(t, r.Anonymous(), "PKINIT request should be anonymous")
+	}
+	assert.True(t, ASReq.PAData.Contains(patype.PA_PK_AS_REQ), "AS_REQ should have a PA-PK-AS-REQ")
+	assert.True(t, types.IsFlagSet(&ASReq.ReqBody.KDCOptions, flags.RequestAnonymous), "request-anonymous option should be set")
+
+	// The reply must be for the anonymous realm.
+	ASRep := messages.ASRep{KDCRepFields: messages.KDCRepFields{CName: ASReq.ReqBody.CName, CRealm: "TEST.GOKRB5"}}
+	ok, err = cl.verifyASRep(context.Background(), &ASRep, ASReq, r, nil)
+	assert.False(t, ok, "reply for the requested realm should not be valid")
+	assert.Error(t, err)
+}
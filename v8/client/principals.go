@@ -0,0 +1,153 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+)
+
+// principals is the collection of the clients of the principals a client holds credentials for, shared by the client
+// and the clients of the collection.
+type principals struct {
+	mux     sync.Mutex
+	owner   *Client
+	clients map[string]*Client
+}
+
+// principalKey returns the key of the principal in the collection.
+func principalKey(name, realm string) string {
+	return name + "@" + realm
+}
+
+// AddPrincipal adds the credentials of another principal to the client's collection of principals and returns the
+// client for them, replacing any client the collection has for the principal. The client returned is selected with
+// WithPrincipal, logs in with the credentials and obtains its own TGTs and service tickets while sharing the
+// configuration, settings, pooled KDC connections and KDC health of cl. The ServiceTicketStore setting is not shared
+// as its entries are keyed on the SPN only: the tickets of the principal are held in its own Cache.
+func (cl *Client) AddPrincipal(creds *credentials.Credentials) *Client {
+	p := cl.collection()
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	c := p.newClient(creds)
+	key := principalKey(creds.CName().PrincipalNameString(), creds.Domain())
+	if old, ok := p.clients[key]; ok {
+		old.close()
+	}
+	p.clients[key] = c
+	return c
+}
+
+// WithPrincipal returns the client of the collection of principals for the principal name@realm, so that one process
+// can act as several principals, such as a gateway authenticating as many service accounts, without a client per
+// principal. If the realm is empty the realm of cl is used. The client of the collection's first principal, the one
+// the collection was created for, is returned for its own principal.
+//
+// The clients of the collection are those added with AddPrincipal. If the collection has no client for the principal
+// and the first principal's credentials are a keytab with keys for the principal, a client for the principal using
+// the keytab is added to the collection.
+func (cl *Client) WithPrincipal(name, realm string) (*Client, error) {
+	p := cl.collection()
+	if realm == "" {
+		realm = cl.Credentials.Domain()
+	}
+	creds := credentials.New(name, realm)
+	key := principalKey(creds.CName().PrincipalNameString(), realm)
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if principalKey(p.owner.Credentials.CName().PrincipalNameString(), p.owner.Credentials.Domain()) == key {
+		return p.owner, nil
+	}
+	if c, ok := p.clients[key]; ok {
+		return c, nil
+	}
+	if p.owner.Credentials.HasKeytab() {
+		for _, e := range p.owner.Credentials.Keytab().Entries {
+			if e.Principal.String() == key {
+				c := p.newClient(creds.WithKeytab(p.owner.Credentials.Keytab()))
+				p.clients[key] = c
+				return c, nil
+			}
+		}
+	}
+	return nil, krberror.WithKind(fmt.Errorf("client has no credentials for principal %s", key), krberror.KindCredentials)
+}
+
+// Principals returns the clients of the collection of principals other than that of the collection's first principal.
+func (cl *Client) Principals() []*Client {
+	p := cl.collection()
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	clients := make([]*Client, 0, len(p.clients))
+	for _, c := range p.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// collection returns the collection of principals of the client, creating it if the client does not have one yet.
+func (cl *Client) collection() *principals {
+	principalsMux.Lock()
+	defer principalsMux.Unlock()
+	if cl.principals == nil {
+		cl.principals = &principals{owner: cl, clients: make(map[string]*Client)}
+	}
+	return cl.principals
+}
+
+// principalsMux guards the creation of the collections of principals of clients.
+var principalsMux sync.Mutex
+
+// newClient returns a client for the credentials that shares the resources of the collection's first principal.
+func (p *principals) newClient(creds *credentials.Credentials) *Client {
+	s := *p.owner.settings
+	s.ticketStore = nil
+	cl := newClient(creds, p.owner.Config, &s)
+	cl.udpConns = p.owner.udpConns
+	cl.tcpConns = p.owner.tcpConns
+	cl.kdcHealth = p.owner.kdcHealth
+	cl.principals = p
+	return cl
+}
+
+// closePrincipals closes the clients of the collection of principals when the client of its first principal is
+// closed, or removes the client from its collection.
+func (cl *Client) closePrincipals() {
+	principalsMux.Lock()
+	p := cl.principals
+	principalsMux.Unlock()
+	if p == nil {
+		return
+	}
+	if p.owner == cl {
+		p.closeClients()
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for key, c := range p.clients {
+		if c == cl {
+			delete(p.clients, key)
+		}
+	}
+}
+
+// closeClients stops the renewals of the clients of the collection and removes their sessions and cache entries, as
+// when the client of the collection's first principal is closed.
+func (p *principals) closeClients() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for key, c := range p.clients {
+		c.close()
+		delete(p.clients, key)
+	}
+}
+
+// close stops the renewals of the client of the collection and removes its sessions and cache entries, with their
+// session keys zeroed. The pooled KDC connections, which are shared with the collection, are left open.
+func (cl *Client) close() {
+	cl.renewer.close()
+	cl.sessions.close(cl.now())
+	cl.cache.clear()
+}
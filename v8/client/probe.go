@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+)
+
+// KDCProbe is the result of probing a KDC with ProbeKDCs.
+type KDCProbe struct {
+	// Address of the KDC probed.
+	Address string
+	// Preference is the preference order of the KDC, starting at 1.
+	Preference int
+	// ConnectLatency is the time taken to establish a TCP connection to the KDC.
+	ConnectLatency time.Duration
+	// ResponseLatency is the time taken for the KDC to respond to an AS_REQ once connected.
+	ResponseLatency time.Duration
+	// Err is the reason the KDC is not healthy, or nil if it responded.
+	Err error
+}
+
+// Healthy indicates if the KDC responded to the probe.
+func (p KDCProbe) Healthy() bool {
+	return p.Err == nil
+}
+
+// ProbeKDCs checks the reachability of each KDC of the realm and returns their latencies in preference order, for
+// example for use in health endpoints or to weight the selection of KDCs.
+//
+// The KDCs are probed concurrently over TCP. Each is sent an AS_REQ for the client's principal without
+// pre-authentication and is healthy if it responds with either an AS_REP or a KRB_ERROR, such as one requiring
+// pre-authentication. No session is established with the responses. Each probe is limited to the lesser of 5 seconds
+// and the context's deadline.
+func (cl *Client) ProbeKDCs(ctx context.Context, realm string) ([]KDCProbe, error) {
+	if realm == "" {
+		realm = cl.Credentials.Domain()
+	}
+	_, kdcs, err := cl.Config.GetKDCs(realm, true)
+	if err != nil {
+		return nil, err
+	}
+	asReq, err := messages.NewASReqForTGT(realm, cl.Config, cl.Credentials.CName())
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error generating new AS_REQ")
+	}
+	asReq.ReqBody.SetTimes(cl.now(), cl.Config)
+	b, err := asReq.Marshal()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ")
+	}
+	probes := make([]KDCProbe, len(kdcs))
+	var wg sync.WaitGroup
+	for i := range probes {
+		probes[i] = KDCProbe{Address: kdcs[i+1], Preference: i + 1}
+		wg.Add(1)
+		go func(p *KDCProbe) {
+			defer wg.Done()
+			p.probe(ctx, b)
+		}(&probes[i])
+	}
+	wg.Wait()
+	return probes, nil
+}
+
+// probe sends the AS_REQ to the KDC and records the latencies or the error.
+func (p *KDCProbe) probe(ctx context.Context, req []byte) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", p.Address)
+	if err != nil {
+		p.Err = fmt.Errorf("error connecting to KDC %s: %w", p.Address, err)
+		return
+	}
+	p.ConnectLatency = time.Since(start)
+	defer c.Close()
+	// The deadline of the context is always set as the timeout is applied above.
+	dl, _ := ctx.Deadline()
+	if err := c.SetDeadline(dl); err != nil {
+		p.Err = fmt.Errorf("error setting deadline on connection to %s: %w", p.Address, err)
+		return
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-stop:
+		}
+	}()
+	start = time.Now()
+	// c is guaranteed to be a TCPConn
+	if err := writeTCPRequests(c.(*net.TCPConn), req); err != nil {
+		p.Err = p.ctxErr(ctx, err)
+		return
+	}
+	rb, err := readTCPResponse(c)
+	if err != nil {
+		p.Err = p.ctxErr(ctx, err)
+		return
+	}
+	p.ResponseLatency = time.Since(start)
+	if len(rb) < 1 || !isResponseTo(req, rb) {
+		p.Err = krberror.WithKind(fmt.Errorf("response from KDC %s is not a response to an AS_REQ", p.Address), krberror.KindProtocol)
+	}
+}
+
+// ctxErr returns the error probing the KDC. The context's error is used if it is done as the connection is closed
+// when it is. The connection's deadline is the context's deadline so a timeout on the connection may be reported
+// before the context is marked as done; this is also reported as the context's deadline being exceeded.
+func (p *KDCProbe) ctxErr(ctx context.Context, err error) error {
+	var nerr net.Error
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	} else if errors.As(err, &nerr) && nerr.Timeout() {
+		err = context.DeadlineExceeded
+	}
+	return fmt.Errorf("error probing KDC %s: %w", p.Address, err)
+}
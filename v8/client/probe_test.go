@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testProbeKDC starts a TCP server that replies to each request with a KRB_ERROR requiring pre-authentication, or
+// never replies if silent is true.
+func testProbeKDC(t *testing.T, silent bool) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting TCP server: %v", err)
+	}
+	krberr := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_REQUIRED, "")
+	rb, err := krberr.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB_ERROR: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if _, err := readTCPResponse(conn); err != nil || silent {
+					// Wait for the client to close the connection
+					conn.Read(make([]byte, 1))
+					return
+				}
+				hb := make([]byte, 4)
+				binary.BigEndian.PutUint32(hb, uint32(len(rb)))
+				conn.Write(append(hb, rb...))
+			}(conn)
+		}
+	}()
+	return l
+}
+
+func TestClient_ProbeKDCs(t *testing.T) {
+	t.Parallel()
+	healthy := testProbeKDC(t, false)
+	defer healthy.Close()
+	silent := testProbeKDC(t, true)
+	defer silent.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error starting TCP server: %v", err)
+	}
+	closed.Close()
+
+	c, err := config.NewFromString(fmt.Sprintf(`[libdefaults]
+  default_realm = TEST.GOKRB5
+
+[realms]
+  TEST.GOKRB5 = {
+    kdc = %s
+    kdc = %s
+    kdc = %s
+  }
+`, healthy.Addr().String(), closed.Addr().String(), silent.Addr().String()))
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	probes, err := cl.ProbeKDCs(ctx, "")
+	if err != nil {
+		t.Fatalf("error probing KDCs: %v", err)
+	}
+	if !assert.Len(t, probes, 3, "number of probes not as expected") {
+		return
+	}
+	byAddr := make(map[string]KDCProbe)
+	for i, p := range probes {
+		assert.Equal(t, i+1, p.Preference, "probes should be in preference order")
+		byAddr[p.Address] = p
+	}
+	p := byAddr[healthy.Addr().String()]
+	assert.True(t, p.Healthy(), "KDC should be healthy: %v", p.Err)
+	assert.True(t, p.ConnectLatency > 0, "connect latency not recorded")
+	assert.True(t, p.ResponseLatency > 0, "response latency not recorded")
+	p = byAddr[closed.Addr().String()]
+	assert.False(t, p.Healthy(), "unreachable KDC should not be healthy")
+	p = byAddr[silent.Addr().String()]
+	assert.False(t, p.Healthy(), "KDC that does not respond should not be healthy")
+	assert.True(t, p.ConnectLatency > 0, "connect latency not recorded")
+	assert.True(t, errors.Is(p.Err, context.DeadlineExceeded), "error should be the context deadline: %v", p.Err)
+}
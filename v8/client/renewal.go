@@ -0,0 +1,269 @@
+package client
+
+import (
+	"context"
+	"errors"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// defaultRenewalThreshold is the fraction of a ticket's lifetime after which it is renewed if the RenewalPolicy does
+// not set a valid threshold.
+const defaultRenewalThreshold = 0.8
+
+// minRenewalRetry is the shortest wait before a failed renewal is retried.
+const minRenewalRetry = time.Second
+
+// RenewalPolicy configures the background renewal of the client's TGTs and cached service tickets enabled with the
+// AutoRenewal setting.
+type RenewalPolicy struct {
+	// Threshold is the fraction of a ticket's lifetime after which it is renewed. If it is not greater than 0 and
+	// less than 1 then 0.8 is used.
+	Threshold float64
+	// Jitter is the largest fraction of a ticket's lifetime by which its renewal is randomly brought forward so that
+	// the renewals of clients started together are spread out. For example a threshold of 0.8 with a jitter of 0.1
+	// renews tickets between 70% and 80% of their lifetime.
+	Jitter float64
+	// OnFailure is called, if set, with the SPN of a ticket and the error when its renewal fails. The SPN of a TGT is
+	// krbtgt/REALM. The renewal is retried while the ticket is valid.
+	OnFailure func(spn string, err error)
+}
+
+// renewAt returns the time that a ticket valid from start until end is due to be renewed.
+func (p *RenewalPolicy) renewAt(start, end time.Time) time.Time {
+	t := p.Threshold
+	if t <= 0 || t >= 1 {
+		t = defaultRenewalThreshold
+	}
+	if p.Jitter > 0 {
+		t -= p.Jitter * mrand.Float64()
+	}
+	if t < 0 {
+		t = 0
+	}
+	return start.Add(time.Duration(float64(end.Sub(start)) * t))
+}
+
+// failed calls the failure callback of the policy, if it has one.
+func (p *RenewalPolicy) failed(spn string, err error) {
+	if p.OnFailure != nil {
+		p.OnFailure(spn, err)
+	}
+}
+
+// retryAt returns when the renewal of a ticket that expires at end is retried after it failed at now. As for the
+// automatic renewal of sessions, the renewal is retried with increasing frequency as the ticket's expiry approaches.
+func retryAt(end, now time.Time) time.Time {
+	w := end.Sub(now) / 6
+	if w < minRenewalRetry {
+		w = minRenewalRetry
+	}
+	return now.Add(w)
+}
+
+// startTime returns the start of the lifetime of a ticket, which is its auth time if it has no start time.
+func startTime(start, auth time.Time) time.Time {
+	if start.IsZero() {
+		return auth
+	}
+	return start
+}
+
+// ticketRenewer renews the client's cached service tickets in the background when the AutoRenewal setting is
+// configured. It is started once the first ticket is cached.
+type ticketRenewer struct {
+	mux     sync.Mutex
+	wake    chan struct{} // signals tickets have been added to the cache so they are scheduled
+	stop    chan struct{}
+	done    chan struct{}
+	stopped bool // set once closed so that the renewer is not started again
+}
+
+// scheduleRenewal starts the background renewal of the cached service tickets if the AutoRenewal setting is
+// configured, or wakes it to schedule the renewal of tickets added to the cache.
+func (cl *Client) scheduleRenewal() {
+	p := cl.settings.AutoRenewal()
+	r := cl.renewer
+	if p == nil || r == nil {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.stopped {
+		return
+	}
+	if r.wake == nil {
+		r.wake = make(chan struct{}, 1)
+		r.stop = make(chan struct{})
+		r.done = make(chan struct{})
+		go cl.renewTickets(r, p)
+		return
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the background renewal, abandoning any renewal in progress, and waits for it to exit.
+func (r *ticketRenewer) close() {
+	if r == nil {
+		return
+	}
+	r.mux.Lock()
+	stopped := r.stopped
+	r.stopped = true
+	r.mux.Unlock()
+	if r.stop == nil {
+		return
+	}
+	if !stopped {
+		close(r.stop)
+	}
+	<-r.done
+}
+
+// renewTickets renews the cached service tickets as they become due until the renewer is stopped.
+func (cl *Client) renewTickets(r *ticketRenewer, p *RenewalPolicy) {
+	defer close(r.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	schedule := make(map[string]scheduledRenewal)
+	for {
+		next := cl.renewDueTickets(ctx, p, schedule)
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(next.Sub(cl.now()))
+			due = timer.C
+		}
+		select {
+		case <-due:
+		case <-r.wake:
+		case <-r.stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// scheduledRenewal is when the renewal of a cached service ticket is due.
+type scheduledRenewal struct {
+	endTime time.Time // end time of the ticket the renewal is scheduled for
+	at      time.Time
+}
+
+// renewDueTickets renews the cached service tickets that are due and returns when the next renewal is due. The time
+// returned is zero if there are no valid tickets to renew.
+func (cl *Client) renewDueTickets(ctx context.Context, p *RenewalPolicy, schedule map[string]scheduledRenewal) time.Time {
+	var next time.Time
+	earliest := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	entries := cl.cachedEntries()
+	cached := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		cached[e.SPN] = true
+	}
+	for spn := range schedule {
+		if !cached[spn] {
+			delete(schedule, spn)
+		}
+	}
+	for _, e := range entries {
+		spn := e.SPN
+		if ctx.Err() != nil {
+			return next
+		}
+		now := cl.now()
+		if !now.Before(e.EndTime) {
+			// Expired tickets are renewed when they are next requested, if they can be.
+			continue
+		}
+		sr, ok := schedule[spn]
+		if !ok || !sr.endTime.Equal(e.EndTime) {
+			sr = scheduledRenewal{endTime: e.EndTime, at: p.renewAt(startTime(e.StartTime, e.AuthTime), e.EndTime)}
+			schedule[spn] = sr
+		}
+		if sr.at.After(now) {
+			earliest(sr.at)
+			continue
+		}
+		start := time.Now()
+		ne, err := cl.renewCachedTicket(ctx, e)
+		if err != nil {
+			if ctx.Err() != nil {
+				return next
+			}
+			cl.recordRenewal(spn, e.Ticket.Realm, time.Since(start), err)
+			cl.Log("error renewing ticket for %s: %v", spn, err)
+			p.failed(spn, err)
+			cl.onRenewalFailed(spn, e.Ticket.Realm, e.EndTime, err)
+			sr.at = retryAt(e.EndTime, now)
+			schedule[spn] = sr
+			earliest(sr.at)
+			continue
+		}
+		cl.recordRenewal(spn, e.Ticket.Realm, time.Since(start), nil)
+		sr = scheduledRenewal{endTime: ne.EndTime, at: p.renewAt(startTime(ne.StartTime, ne.AuthTime), ne.EndTime)}
+		schedule[spn] = sr
+		earliest(sr.at)
+	}
+	return next
+}
+
+// renewCachedTicket renews the cached service ticket or, if it cannot be renewed beyond its current end time, gets a
+// new ticket for the service. The updated cache entry is returned.
+func (cl *Client) renewCachedTicket(ctx context.Context, e CacheEntry) (CacheEntry, error) {
+	spn := e.Ticket.SName.PrincipalNameString()
+	if spn != e.SPN {
+		// The entry is an alias of the entry for the ticket's SPN, which may have already been renewed.
+		if re, ok := cl.cachedEntry(spn); ok && re.EndTime.After(e.EndTime) {
+			cl.cacheAlias(e.SPN, spn)
+			re.SPN = e.SPN
+			return re, nil
+		}
+	}
+	if types.IsFlagSet(&e.Flags, flags.Renewable) && e.RenewTill.After(e.EndTime) {
+		_, _, err := cl.TGSREQGenerateAndExchangeContext(ctx, e.Ticket.SName, e.Ticket.Realm, e.Ticket, e.SessionKey, true)
+		if err != nil {
+			return e, err
+		}
+	} else {
+		tgt, skey, err := cl.sessionTGT(ctx, e.Ticket.Realm)
+		if err != nil {
+			return e, err
+		}
+		_, _, err = cl.TGSREQGenerateAndExchangeContext(ctx, e.Ticket.SName, e.Ticket.Realm, tgt, skey, false)
+		if err != nil {
+			return e, err
+		}
+	}
+	ne, ok := cl.cachedEntry(spn)
+	if !ok {
+		return e, errors.New("ticket was not added to cache")
+	}
+	if spn != e.SPN {
+		cl.cacheAlias(e.SPN, spn)
+		ne.SPN = e.SPN
+	}
+	cl.Log("ticket renewed in the background for %s (EndTime: %v)", e.SPN, ne.EndTime)
+	return ne, nil
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenewalPolicy_renewAt(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	var p RenewalPolicy
+	assert.Equal(t, start.Add(8*time.Hour), p.renewAt(start, end), "default threshold not as expected")
+	p.Threshold = 1.5
+	assert.Equal(t, start.Add(8*time.Hour), p.renewAt(start, end), "default threshold should be used for an invalid threshold")
+	p.Threshold = 0.5
+	assert.Equal(t, start.Add(5*time.Hour), p.renewAt(start, end), "threshold not as expected")
+	p.Jitter = 0.1
+	for i := 0; i < 100; i++ {
+		at := p.renewAt(start, end)
+		assert.False(t, at.After(start.Add(5*time.Hour)), "jitter should not delay renewal: %v", at)
+		assert.False(t, at.Before(start.Add(4*time.Hour)), "jitter should be within the fraction of the lifetime: %v", at)
+	}
+
+	now := start.Add(9 * time.Hour)
+	assert.Equal(t, now.Add(10*time.Minute), retryAt(end, now), "retry not as expected")
+	assert.Equal(t, end.Add(minRenewalRetry), retryAt(end, end), "retry should wait at least the minimum")
+}
+
+func TestClient_AutoRenewal(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	l, _ := testTCPKDC(t, skey, 0)
+	defer l.Close()
+	failures := make(chan string, 10)
+	cl := testTGSClient(t, l.Addr().String(), skey, AutoRenewal(RenewalPolicy{Jitter: 0.1, OnFailure: func(spn string, err error) {
+		failures <- spn
+	}}))
+	defer cl.Destroy()
+
+	// Tickets past 80% of their lifetime are due for renewal
+	now := time.Now().UTC()
+	start, end := now.Add(-50*time.Minute), now.Add(10*time.Minute)
+	tkt := func(spn string) messages.Ticket {
+		return messages.Ticket{Realm: "TEST.GOKRB5", SName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)}
+	}
+	renewable := types.NewKrbFlags()
+	types.SetFlag(&renewable, flags.Renewable)
+	cl.cache.addEntry(tkt("HTTP/host1.test.gokrb5"), start, start, end, end, skey, types.NewKrbFlags())
+	cl.cache.addEntry(tkt("HTTP/host2.test.gokrb5"), start, start, end, end.Add(time.Hour), skey, renewable)
+	cl.cache.addEntry(tkt("HTTP/host3.test.gokrb5"), now, now, now.Add(time.Hour), now.Add(time.Hour), skey, types.NewKrbFlags())
+	cl.cache.addEntry(tkt("HTTP/unknown.test.gokrb5"), start, start, end, end, skey, types.NewKrbFlags())
+	cl.scheduleRenewal()
+
+	select {
+	case spn := <-failures:
+		assert.Equal(t, "HTTP/unknown.test.gokrb5", spn, "failure callback SPN not as expected")
+	case <-time.After(5 * time.Second):
+		t.Fatal("failure callback not called")
+	}
+	for _, spn := range []string{"HTTP/host1.test.gokrb5", "HTTP/host2.test.gokrb5"} {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			e, _ := cl.cache.getEntry(spn)
+			if e.EndTime.After(end) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("ticket for %s not renewed in the background", spn)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	e, _ := cl.cache.getEntry("HTTP/host3.test.gokrb5")
+	assert.Equal(t, now.Add(time.Hour), e.EndTime, "ticket that is not due should not be renewed")
+
+	cl.Close()
+	assert.True(t, cl.renewer.stopped, "renewer should be stopped when the client is closed")
+	cl.scheduleRenewal()
+}
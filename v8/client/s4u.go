@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// GetServiceTicketForUser obtains a ticket to the client's own service on behalf of the user using the MS-SFU
+// S4U2Self protocol transition extension, such as for a gateway that has authenticated the user by other means.
+// The user is of the form "username" or "username@REALM" and must be in the client's realm. The SPN is that of the
+// client's service; if it is an empty string the client's principal name is used.
+// The ticket is issued to the user so it is not added to the client's ticket cache. It can be used as the evidence
+// ticket for GetDelegatedServiceTicket.
+func (cl *Client) GetServiceTicketForUser(user, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, skey, err := cl.getServiceTicketForUser(user, spn)
+	return tkt, skey, cl.correlate(err)
+}
+
+func (cl *Client) getServiceTicketForUser(user, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	var tkt messages.Ticket
+	var skey types.EncryptionKey
+	uname, urealm, err := cl.s4uUser(user)
+	if err != nil {
+		return tkt, skey, err
+	}
+	sname := cl.Credentials.CName()
+	if spn != "" {
+		sname = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+	}
+	realm := cl.Credentials.Domain()
+	tgt, sessionKey, err := cl.sessionTGT(context.Background(), realm)
+	if err != nil {
+		return tkt, skey, err
+	}
+	tgsReq, err := messages.NewS4U2SelfTGSReq(uname, urealm, realm, cl.Config, tgt, sessionKey, sname)
+	if err == nil {
+		err = cl.timeTGSReq(&tgsReq, tgt, sessionKey)
+	}
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new S4U2Self TGS_REQ")
+	}
+	tgsRep, err := cl.s4uExchange(tgsReq, tgt, sessionKey, "S4U2Self", user)
+	if err != nil {
+		return tkt, skey, err
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// GetDelegatedServiceTicket obtains a ticket to the service on behalf of the user using the MS-SFU S4U2Proxy
+// constrained delegation extension. The evidence ticket is the user's ticket to the client's service, either from
+// GetServiceTicketForUser or presented by the user to the service. The user is of the form "username" or
+// "username@REALM" and must be the client of the evidence ticket.
+// Resource-based constrained delegation is requested so delegation is permitted if the target service allows the
+// client's service in its msDS-AllowedToActOnBehalfOfOtherIdentity as well as if the client's service is allowed
+// classic constrained delegation to the SPN. The target service must be in the client's realm.
+// The ticket is issued to the user so it is not added to the client's ticket cache.
+func (cl *Client) GetDelegatedServiceTicket(user string, evidence messages.Ticket, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, skey, err := cl.getDelegatedServiceTicket(user, evidence, spn)
+	return tkt, skey, cl.correlate(err)
+}
+
+func (cl *Client) getDelegatedServiceTicket(user string, evidence messages.Ticket, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	var tkt messages.Ticket
+	var skey types.EncryptionKey
+	uname, _, err := cl.s4uUser(user)
+	if err != nil {
+		return tkt, skey, err
+	}
+	realm := cl.Credentials.Domain()
+	tgt, sessionKey, err := cl.sessionTGT(context.Background(), realm)
+	if err != nil {
+		return tkt, skey, err
+	}
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+	tgsReq, err := messages.NewS4U2ProxyTGSReq(uname, realm, cl.Config, tgt, sessionKey, sname, evidence)
+	if err == nil {
+		err = cl.timeTGSReq(&tgsReq, tgt, sessionKey)
+	}
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new S4U2Proxy TGS_REQ")
+	}
+	tgsRep, err := cl.s4uExchange(tgsReq, tgt, sessionKey, "S4U2Proxy", user)
+	if err != nil {
+		return tkt, skey, err
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// s4uUser returns the principal name and realm of the user of an S4U exchange, which must be in the client's realm.
+func (cl *Client) s4uUser(user string) (types.PrincipalName, string, error) {
+	uname, urealm := types.ParseSPNString(user)
+	realm := cl.Credentials.Domain()
+	if urealm == "" {
+		urealm = realm
+	}
+	if urealm != realm {
+		return uname, urealm, krberror.WithKind(fmt.Errorf("S4U for user %s in realm %s other than the client's realm %s is not supported", user, urealm, realm), krberror.KindConfig)
+	}
+	return uname, urealm, nil
+}
+
+// s4uExchange sends the S4U TGS_REQ to the KDC and returns the verified TGS_REP for a ticket to the service requested.
+func (cl *Client) s4uExchange(tgsReq messages.TGSReq, tgt messages.Ticket, sessionKey types.EncryptionKey, ext, user string) (messages.TGSRep, error) {
+	var tgsRep messages.TGSRep
+	sname := tgsReq.ReqBody.SName
+	b, fa, err := cl.marshalTGSReq(context.Background(), &tgsReq, tgt, sessionKey)
+	if err != nil {
+		return tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal %s TGS_REQ", ext)
+	}
+	r, err := cl.sendToKDC(context.Background(), b, tgsReq.ReqBody.Realm)
+	if err != nil {
+		if e, ok := err.(messages.KRBError); ok {
+			if fe, ferr := fastError(fa, e); ferr == nil {
+				e = fe
+			}
+			return tgsRep, krberror.Errorf(e, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting %s ticket for %s to %s%s",
+				ext, user, sname.PrincipalNameString(), s4uErrorHint(e))
+		}
+		return tgsRep, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending %s TGS_REQ to KDC", ext)
+	}
+	tgsRep, err = cl.decodeTGSRep(context.Background(), tgsReq, r, sessionKey, fa)
+	if err != nil {
+		return tgsRep, err
+	}
+	if !tgsRep.Ticket.SName.Equal(sname) {
+		return tgsRep, krberror.NewErrorf(krberror.KRBMsgError, "%s ticket is for %s rather than the service %s", ext, tgsRep.Ticket.SName.PrincipalNameString(), sname.PrincipalNameString())
+	}
+	cl.Log("%s ticket obtained for %s to %s (EndTime: %v)", ext, user, sname.PrincipalNameString(), tgsRep.DecryptedEncPart.EndTime)
+	return tgsRep, nil
+}
+
+// s4uErrorHint returns the likely reason for the KDC rejecting an S4U TGS_REQ with the error.
+func s4uErrorHint(e messages.KRBError) string {
+	switch e.ErrorCode {
+	case errorcode.KDC_ERR_BADOPTION:
+		return ": delegation is not permitted, check the target service's msDS-AllowedToActOnBehalfOfOtherIdentity" +
+			" includes the client's service and the user is not sensitive or a member of Protected Users"
+	case errorcode.KDC_ERR_POLICY:
+		return ": the KDC's policy does not permit the client's service to obtain tickets on behalf of users"
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_GetServiceTicketForUser(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+
+	tkt, key, err := cl.GetServiceTicketForUser("user1@TEST.GOKRB5", "")
+	if err != nil {
+		t.Fatalf("error getting S4U2Self ticket: %v", err)
+	}
+	assert.Equal(t, "testuser1", tkt.SName.PrincipalNameString(), "ticket should be for the client's own service")
+	assert.NotEmpty(t, key.KeyValue, "session key not returned")
+	_, _, ok := cl.GetCachedTicket("testuser1")
+	assert.False(t, ok, "ticket issued to the user should not be cached")
+
+	tkt, _, err = cl.GetServiceTicketForUser("user1", "HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting S4U2Self ticket for SPN: %v", err)
+	}
+	assert.Equal(t, "HTTP/host.test.gokrb5", tkt.SName.PrincipalNameString(), "ticket should be for the SPN")
+
+	_, _, err = cl.GetServiceTicketForUser("user1@OTHER.GOKRB5", "")
+	assert.Equal(t, krberror.KindConfig, krberror.ErrorKind(err), "user in another realm should not be supported: %v", err)
+}
+
+func TestClient_GetDelegatedServiceTicket(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+
+	evidence, _, err := cl.GetServiceTicketForUser("user1", "")
+	if err != nil {
+		t.Fatalf("error getting S4U2Self ticket: %v", err)
+	}
+	tkt, key, err := cl.GetDelegatedServiceTicket("user1", evidence, "HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting S4U2Proxy ticket: %v", err)
+	}
+	assert.Equal(t, "HTTP/host.test.gokrb5", tkt.SName.PrincipalNameString(), "ticket should be for the target service")
+	assert.NotEmpty(t, key.KeyValue, "session key not returned")
+	_, _, ok := cl.GetCachedTicket("HTTP/host.test.gokrb5")
+	assert.False(t, ok, "ticket issued to the user should not be cached")
+
+	_, _, err = cl.GetDelegatedServiceTicket("user1", evidence, "HTTP/nodelegation.test.gokrb5")
+	assert.True(t, errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_BADOPTION}), "KDC error should be returned: %v", err)
+	assert.Equal(t, krberror.KindAuthorization, krberror.ErrorKind(err), "rejected delegation should be an authorization error: %v", err)
+	assert.Contains(t, err.Error(), "msDS-AllowedToActOnBehalfOfOtherIdentity", "error should explain the likely cause")
+}
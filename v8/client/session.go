@@ -1,78 +1,185 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
 
-// sessions hold TGTs and are keyed on the realm name
+// sessions hold TGTs and are keyed on the realm name.
+//
+// The map of sessions is copied on write so that the session for a realm can be looked up without taking a lock.
 type sessions struct {
-	Entries map[string]*session
-	mux     sync.RWMutex
+	entries  atomic.Value   // map[string]*session
+	mux      sync.Mutex     // serialises updates to the entries
+	renewals sync.WaitGroup // tracks the goroutines automatically renewing sessions
+	closed   bool           // set once closed so that no further sessions are added
+	// referrals are the realms the requests for services were last referred to, keyed on SPN.
+	referrals map[string]string
 }
 
-// destroy erases all sessions
-func (s *sessions) destroy() {
+// newSessions creates an empty set of sessions
+func newSessions() *sessions {
+	s := new(sessions)
+	s.entries.Store(make(map[string]*session))
+	return s
+}
+
+// all returns a snapshot of the sessions keyed on realm. The map returned must not be modified.
+func (s *sessions) all() map[string]*session {
+	m, _ := s.entries.Load().(map[string]*session)
+	return m
+}
+
+// destroy erases all sessions, expiring them at the time provided, and zeroes their session keys once their auto
+// renewal has stopped.
+func (s *sessions) destroy(now time.Time) {
 	s.mux.Lock()
-	defer s.mux.Unlock()
-	for k, e := range s.Entries {
-		e.destroy()
-		delete(s.Entries, k)
+	all := s.all()
+	for _, e := range all {
+		e.destroy(now)
+	}
+	s.entries.Store(make(map[string]*session))
+	s.referrals = nil
+	s.mux.Unlock()
+	// The lock is not held while waiting as a renewal in progress may update the sessions.
+	for _, e := range all {
+		if done := e.renewalDone(); done != nil {
+			<-done
+		}
+		e.snapshot().sessionKey.Zero()
 	}
 }
 
-// update replaces a session with the one provided or adds it as a new one
-func (s *sessions) update(sess *session) {
+// close erases all sessions, zeroing their session keys and expiring them at the time provided, and waits for their
+// auto renewal to stop.
+func (s *sessions) close(now time.Time) {
+	s.mux.Lock()
+	s.closed = true
+	all := s.all()
+	for _, e := range all {
+		e.destroy(now)
+	}
+	s.entries.Store(make(map[string]*session))
+	s.referrals = nil
+	s.mux.Unlock()
+	s.renewals.Wait()
+	for _, e := range all {
+		e.snapshot().sessionKey.Zero()
+	}
+}
+
+// update replaces a session with the one provided or adds it as a new one. It returns false if the sessions have been
+// closed, in which case the session is not added.
+func (s *sessions) update(sess *session) bool {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	if s.closed {
+		return false
+	}
+	cur := s.all()
 	// if a session already exists for this, cancel its auto renew.
-	if i, ok := s.Entries[sess.realm]; ok {
-		if i != sess {
-			// Session in the sessions cache is not the same as one provided.
-			// Cancel the one in the cache and add this one.
-			i.mux.Lock()
-			defer i.mux.Unlock()
-			i.cancel <- true
-			s.Entries[sess.realm] = sess
-			return
+	if i, ok := cur[sess.realm]; ok {
+		if i == sess {
+			return true
 		}
+		// Session in the sessions cache is not the same as one provided.
+		// Cancel the one in the cache and add this one.
+		i.cancelRenewal()
+	}
+	m := make(map[string]*session, len(cur)+1)
+	for k, v := range cur {
+		m[k] = v
 	}
-	// No session for this realm was found so just add it
-	s.Entries[sess.realm] = sess
+	m[sess.realm] = sess
+	s.entries.Store(m)
+	return true
 }
 
 // get returns the session for the realm specified
 func (s *sessions) get(realm string) (*session, bool) {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-	sess, ok := s.Entries[realm]
+	sess, ok := s.all()[realm]
 	return sess, ok
 }
 
-// session holds the TGT details for a realm
+// referred records that the request for the SPN was referred to the realm, which the client holds a session for.
+func (s *sessions) referred(spn, realm string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.referrals == nil {
+		s.referrals = make(map[string]string)
+	}
+	s.referrals[spn] = realm
+}
+
+// referral returns the realm the last request for the SPN was referred to.
+func (s *sessions) referral(spn string) (string, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	realm, ok := s.referrals[spn]
+	return realm, ok
+}
+
+// session holds the TGT details for a realm.
+//
+// The details are held in an immutable sessionState that is replaced when the TGT is renewed so that they can be read
+// without taking a lock.
 type session struct {
-	realm                string
+	realm  string
+	state  atomic.Value // *sessionState
+	cancel chan bool
+	done   chan struct{} // closed once the auto renewal goroutine has stopped
+	mux    sync.Mutex    // serialises updates to the state and auto renewal
+}
+
+// sessionState is a snapshot of the TGT details of a session. It must not be modified once stored in a session.
+type sessionState struct {
 	authTime             time.Time
+	startTime            time.Time
 	endTime              time.Time
 	renewTill            time.Time
 	tgt                  messages.Ticket
 	sessionKey           types.EncryptionKey
 	sessionKeyExpiration time.Time
-	cancel               chan bool
-	mux                  sync.RWMutex
+	flags                asn1.BitString
+}
+
+// invalid indicates if the session's TGT is a postdated ticket the KDC has not yet validated.
+func (st *sessionState) invalid() bool {
+	return len(st.flags.Bytes) > 0 && types.IsFlagSet(&st.flags, flags.Invalid)
+}
+
+// newSession creates a session for the realm with the state provided
+func newSession(realm string, st *sessionState) *session {
+	s := &session{realm: realm}
+	s.state.Store(st)
+	return s
+}
+
+// snapshot returns the current state of the session
+func (s *session) snapshot() *sessionState {
+	st, _ := s.state.Load().(*sessionState)
+	if st == nil {
+		return new(sessionState)
+	}
+	return st
 }
 
-// jsonSession is used to enable marshaling some information of a session in a JSON format
-type jsonSession struct {
+// SessionInfo holds the details of a session that can be shared, such as in a JSON format or a DebugSnapshot. The TGT
+// and session key are not included.
+type SessionInfo struct {
 	Realm                string
 	AuthTime             time.Time
 	EndTime              time.Time
@@ -88,16 +195,19 @@ func (cl *Client) addSession(tgt messages.Ticket, dep messages.EncKDCRepPart) {
 		return
 	}
 	realm := tgt.SName.NameString[len(tgt.SName.NameString)-1]
-	s := &session{
-		realm:                realm,
+	s := newSession(realm, &sessionState{
 		authTime:             dep.AuthTime,
+		startTime:            dep.StartTime,
 		endTime:              dep.EndTime,
 		renewTill:            dep.RenewTill,
 		tgt:                  tgt,
 		sessionKey:           dep.Key,
 		sessionKeyExpiration: dep.KeyExpiration,
+		flags:                dep.Flags,
+	})
+	if !cl.sessions.update(s) {
+		return
 	}
-	cl.sessions.update(s)
 	cl.enableAutoSessionRenewal(s)
 	cl.Log("TGT session added for %s (EndTime: %v)", realm, dep.EndTime)
 }
@@ -106,72 +216,99 @@ func (cl *Client) addSession(tgt messages.Ticket, dep messages.EncKDCRepPart) {
 func (s *session) update(tgt messages.Ticket, dep messages.EncKDCRepPart) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	s.authTime = dep.AuthTime
-	s.endTime = dep.EndTime
-	s.renewTill = dep.RenewTill
-	s.tgt = tgt
-	s.sessionKey = dep.Key
-	s.sessionKeyExpiration = dep.KeyExpiration
+	s.state.Store(&sessionState{
+		authTime:             dep.AuthTime,
+		startTime:            dep.StartTime,
+		endTime:              dep.EndTime,
+		renewTill:            dep.RenewTill,
+		tgt:                  tgt,
+		sessionKey:           dep.Key,
+		sessionKeyExpiration: dep.KeyExpiration,
+		flags:                dep.Flags,
+	})
 }
 
-// destroy will cancel any auto renewal of the session and set the expiration times to the current time
-func (s *session) destroy() {
+// cancelRenewal stops any auto renewal of the session
+func (s *session) cancelRenewal() {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 	if s.cancel != nil {
-		s.cancel <- true
+		select {
+		case s.cancel <- true:
+		default:
+		}
 	}
-	s.endTime = time.Now().UTC()
-	s.renewTill = s.endTime
-	s.sessionKeyExpiration = s.endTime
 }
 
-// valid informs if the TGT is still within the valid time window
-func (s *session) valid() bool {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-	t := time.Now().UTC()
-	if t.Before(s.endTime) && s.authTime.Before(t) {
+// renewalDone returns the channel closed once the auto renewal of the session has stopped, or nil if the session has
+// not been auto renewed.
+func (s *session) renewalDone() <-chan struct{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.done
+}
+
+// destroy will cancel any auto renewal of the session and set the expiration times to the time provided, the current
+// time of the client's clock.
+func (s *session) destroy(now time.Time) {
+	s.cancelRenewal()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	st := *s.snapshot()
+	st.endTime = now.UTC()
+	st.renewTill = st.endTime
+	st.sessionKeyExpiration = st.endTime
+	s.state.Store(&st)
+}
+
+// valid informs if the TGT is still within the valid time window at the time provided, the current time of the
+// client's clock.
+func (s *session) valid(t time.Time) bool {
+	st := s.snapshot()
+	if t.Before(st.endTime) && st.authTime.Before(t) {
 		return true
 	}
 	return false
 }
 
-// tgtDetails is a thread safe way to get the session's realm, TGT and session key values
+// tgtDetails is a thread safe way to get the session's realm, TGT and session key values. The session key is a copy so
+// that it is not zeroed when the session is destroyed.
 func (s *session) tgtDetails() (string, messages.Ticket, types.EncryptionKey) {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-	return s.realm, s.tgt, s.sessionKey
+	st := s.snapshot()
+	return s.realm, st.tgt, copyKey(st.sessionKey)
 }
 
 // timeDetails is a thread safe way to get the session's validity time values
 func (s *session) timeDetails() (string, time.Time, time.Time, time.Time, time.Time) {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-	return s.realm, s.authTime, s.endTime, s.renewTill, s.sessionKeyExpiration
+	st := s.snapshot()
+	return s.realm, st.authTime, st.endTime, st.renewTill, st.sessionKeyExpiration
 }
 
-// JSON return information about the held sessions in a JSON format.
-func (s *sessions) JSON() (string, error) {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
-	var js []jsonSession
-	keys := make([]string, 0, len(s.Entries))
-	for k := range s.Entries {
+// info returns the details of the held sessions sorted by realm.
+func (s *sessions) info() []SessionInfo {
+	entries := s.all()
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
+	var js []SessionInfo
 	for _, k := range keys {
-		r, at, et, rt, kt := s.Entries[k].timeDetails()
-		j := jsonSession{
+		r, at, et, rt, kt := entries[k].timeDetails()
+		js = append(js, SessionInfo{
 			Realm:                r,
 			AuthTime:             at,
 			EndTime:              et,
 			RenewTill:            rt,
 			SessionKeyExpiration: kt,
-		}
-		js = append(js, j)
+		})
 	}
+	return js
+}
+
+// JSON return information about the held sessions in a JSON format.
+func (s *sessions) JSON() (string, error) {
+	js := s.info()
 	b, err := json.MarshalIndent(js, "", "  ")
 	if err != nil {
 		return "", err
@@ -184,27 +321,51 @@ func (cl *Client) enableAutoSessionRenewal(s *session) {
 	var timer *time.Timer
 	s.mux.Lock()
 	s.cancel = make(chan bool, 1)
+	cancel := s.cancel
+	s.done = make(chan struct{})
+	done := s.done
 	s.mux.Unlock()
+	cl.sessions.renewals.Add(1)
 	go func(s *session) {
+		defer cl.sessions.renewals.Done()
+		defer close(done)
+		var failed bool
 		for {
-			s.mux.RLock()
-			w := (s.endTime.Sub(time.Now().UTC()) * 5) / 6
-			s.mux.RUnlock()
+			st := s.snapshot()
+			now := cl.now()
+			w := (st.endTime.Sub(now) * 5) / 6
 			if w < 0 {
 				return
 			}
+			if p := cl.settings.AutoRenewal(); p != nil {
+				// Renew at the policy's threshold of the TGT's lifetime, retrying with increasing frequency if it fails.
+				at := p.renewAt(startTime(st.startTime, st.authTime), st.endTime)
+				if failed {
+					at = retryAt(st.endTime, now)
+				}
+				w = at.Sub(now)
+			}
+			if st.invalid() && !failed {
+				// A postdated TGT is validated once its start time has passed.
+				w = st.startTime.Sub(now)
+			}
 			timer = time.NewTimer(w)
 			select {
 			case <-timer.C:
-				renewal, err := cl.refreshSession(s)
+				renewal, err := cl.refreshSession(context.Background(), s)
+				failed = err != nil
 				if err != nil {
 					cl.Log("error refreshing session: %v", err)
+					if p := cl.settings.AutoRenewal(); p != nil {
+						p.failed("krbtgt/"+s.realm, err)
+					}
+					cl.onRenewalFailed("krbtgt/"+s.realm, s.realm, st.endTime, err)
 				}
 				if !renewal && err == nil {
 					// end this goroutine as there will have been a new login and new auto renewal goroutine created.
 					return
 				}
-			case <-s.cancel:
+			case <-cancel:
 				// cancel has been called. Stop the timer and exit.
 				timer.Stop()
 				return
@@ -214,64 +375,74 @@ func (cl *Client) enableAutoSessionRenewal(s *session) {
 }
 
 // renewTGT renews the client's TGT session.
-func (cl *Client) renewTGT(s *session) error {
+func (cl *Client) renewTGT(ctx context.Context, s *session) error {
 	realm, tgt, skey := s.tgtDetails()
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
 		NameString: []string{"krbtgt", realm},
 	}
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, cl.Credentials.Domain(), tgt, skey, true)
+	// A cross-realm TGT is renewed by the KDC of the realm that issued it.
+	start := time.Now()
+	_, tgsRep, err := cl.TGSREQGenerateAndExchangeContext(ctx, spn, tgt.Realm, tgt, skey, true)
+	cl.recordRenewal("krbtgt/"+realm, realm, time.Since(start), err)
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error renewing TGT for %s", realm)
 	}
 	s.update(tgsRep.Ticket, tgsRep.DecryptedEncPart)
 	cl.sessions.update(s)
+	cl.onTGTRenewed(tgsRep.Ticket, tgsRep.DecryptedEncPart)
 	cl.Log("TGT session renewed for %s (EndTime: %v)", realm, tgsRep.DecryptedEncPart.EndTime)
 	return nil
 }
 
 // refreshSession updates either through renewal or creating a new login.
 // The boolean indicates if the update was a renewal.
-func (cl *Client) refreshSession(s *session) (bool, error) {
-	s.mux.RLock()
+func (cl *Client) refreshSession(ctx context.Context, s *session) (bool, error) {
 	realm := s.realm
-	renewTill := s.renewTill
-	s.mux.RUnlock()
+	st := s.snapshot()
+	renewTill := st.renewTill
 	cl.Log("refreshing TGT session for %s", realm)
-	if time.Now().UTC().Before(renewTill) {
-		err := cl.renewTGT(s)
+	if st.invalid() && cl.now().Before(st.endTime) {
+		// A postdated TGT is validated rather than renewed.
+		err := cl.validateTGT(ctx, s)
+		return true, err
+	}
+	if cl.now().Before(renewTill) && cl.now().Before(st.endTime) {
+		err := cl.renewTGT(ctx, s)
 		return true, err
 	}
-	err := cl.realmLogin(realm)
+	// An expired TGT cannot be renewed so a new one is obtained for the realm, without affecting the other sessions.
+	err := cl.realmLogin(ctx, realm)
 	return false, err
 }
 
 // ensureValidSession makes sure there is a valid session for the realm
-func (cl *Client) ensureValidSession(realm string) error {
+func (cl *Client) ensureValidSession(ctx context.Context, realm string) error {
 	s, ok := cl.sessions.get(realm)
 	if ok {
-		s.mux.RLock()
-		d := s.endTime.Sub(s.authTime) / 6
-		if s.endTime.Sub(time.Now().UTC()) > d {
-			s.mux.RUnlock()
+		st := s.snapshot()
+		if st.invalid() && cl.now().Before(st.startTime) {
+			return krberror.WithKind(fmt.Errorf("TGT for %s is postdated and not valid until %v", realm, st.startTime), krberror.KindCredentials)
+		}
+		d := st.endTime.Sub(st.authTime) / 6
+		if st.endTime.Sub(cl.now()) > d && !st.invalid() {
 			return nil
 		}
-		s.mux.RUnlock()
-		_, err := cl.refreshSession(s)
+		_, err := cl.refreshSession(ctx, s)
 		return err
 	}
-	return cl.realmLogin(realm)
+	return cl.realmLogin(ctx, realm)
 }
 
 // sessionTGTDetails is a thread safe way to get the TGT and session key values for a realm
-func (cl *Client) sessionTGT(realm string) (tgt messages.Ticket, sessionKey types.EncryptionKey, err error) {
-	err = cl.ensureValidSession(realm)
+func (cl *Client) sessionTGT(ctx context.Context, realm string) (tgt messages.Ticket, sessionKey types.EncryptionKey, err error) {
+	err = cl.ensureValidSession(ctx, realm)
 	if err != nil {
 		return
 	}
 	s, ok := cl.sessions.get(realm)
 	if !ok {
-		err = fmt.Errorf("could not find TGT session for %s", realm)
+		err = krberror.WithKind(fmt.Errorf("could not find TGT session for %s", realm), krberror.KindCredentials)
 		return
 	}
 	_, tgt, sessionKey = s.tgtDetails()
@@ -282,7 +453,7 @@ func (cl *Client) sessionTGT(realm string) (tgt messages.Ticket, sessionKey type
 func (cl *Client) sessionTimes(realm string) (authTime, endTime, renewTime, sessionExp time.Time, err error) {
 	s, ok := cl.sessions.get(realm)
 	if !ok {
-		err = fmt.Errorf("could not find TGT session for %s", realm)
+		err = krberror.WithKind(fmt.Errorf("could not find TGT session for %s", realm), krberror.KindCredentials)
 		return
 	}
 	_, authTime, endTime, renewTime, sessionExp = s.timeDetails()
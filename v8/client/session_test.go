@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
@@ -10,11 +11,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
 	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/test"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -42,7 +46,7 @@ func TestMultiThreadedClientSession(t *testing.T) {
 	}
 	go func() {
 		for {
-			err := cl.renewTGT(s)
+			err := cl.renewTGT(context.Background(), s)
 			if err != nil {
 				t.Logf("error renewing TGT: %v", err)
 			}
@@ -55,7 +59,7 @@ func TestMultiThreadedClientSession(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		go func() {
 			defer wg.Done()
-			tgt, _, err := cl.sessionTGT("TEST.GOKRB5")
+			tgt, _, err := cl.sessionTGT(context.Background(), "TEST.GOKRB5")
 			if err != nil || tgt.Realm != "TEST.GOKRB5" {
 				t.Logf("error getting session: %v", err)
 			}
@@ -115,19 +119,16 @@ func TestClient_AutoRenew_Goroutine(t *testing.T) {
 }
 
 func TestSessions_JSON(t *testing.T) {
-	s := &sessions{
-		Entries: make(map[string]*session),
-	}
+	s := newSessions()
 	for i := 0; i < 3; i++ {
 		realm := fmt.Sprintf("test%d", i)
-		e := &session{
-			realm:                realm,
+		e := newSession(realm, &sessionState{
 			authTime:             time.Unix(int64(0+i), 0).UTC(),
 			endTime:              time.Unix(int64(10+i), 0).UTC(),
 			renewTill:            time.Unix(int64(20+i), 0).UTC(),
 			sessionKeyExpiration: time.Unix(int64(30+i), 0).UTC(),
-		}
-		s.Entries[realm] = e
+		})
+		s.update(e)
 	}
 	j, err := s.JSON()
 	if err != nil {
@@ -158,3 +159,108 @@ func TestSessions_JSON(t *testing.T) {
 ]`
 	assert.Equal(t, expected, j, "json output not as expected")
 }
+
+func TestSessions_ConcurrentUpdate(t *testing.T) {
+	t.Parallel()
+	s := newSessions()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			realm := fmt.Sprintf("test%d", i%3)
+			e := newSession(realm, &sessionState{
+				authTime: time.Unix(int64(i), 0).UTC(),
+				endTime:  time.Unix(int64(10+i), 0).UTC(),
+			})
+			s.update(e)
+			e.update(messages.Ticket{Realm: realm}, messages.EncKDCRepPart{EndTime: time.Unix(int64(20+i), 0).UTC()})
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			if e, ok := s.get(fmt.Sprintf("test%d", i%3)); ok {
+				e.tgtDetails()
+				e.valid(time.Now())
+			}
+			s.JSON()
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, s.all(), 3, "number of sessions not as expected")
+	s.destroy(time.Now())
+	assert.Len(t, s.all(), 0, "sessions not destroyed")
+}
+
+func TestSession_Valid_Clock(t *testing.T) {
+	t.Parallel()
+	st := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(st.Add(time.Minute))
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New(), Clock(c))
+	s := newSession("TEST.GOKRB5", &sessionState{
+		authTime: st,
+		endTime:  st.Add(time.Hour),
+	})
+	cl.sessions.update(s)
+	assert.True(t, s.valid(cl.now()), "session should be valid before its end time on the client's clock")
+	c.Advance(2 * time.Hour)
+	assert.False(t, s.valid(cl.now()), "session should have expired on the client's clock")
+
+	c.Set(st.Add(time.Minute))
+	cl.Destroy()
+	_, _, endTime, renewTill, _ := s.timeDetails()
+	assert.Equal(t, st.Add(time.Minute), endTime, "destroyed session should expire at the time of the client's clock")
+	assert.Equal(t, st.Add(time.Minute), renewTill, "destroyed session renew till not as expected")
+}
+
+func TestSessions_Destroy_WaitsForRenewal(t *testing.T) {
+	t.Parallel()
+	s := newSessions()
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	e := newSession("TEST.GOKRB5", &sessionState{
+		authTime:   time.Now().UTC(),
+		endTime:    time.Now().UTC().Add(time.Hour),
+		sessionKey: key,
+	})
+	s.update(e)
+	// A renewal in progress, which has not yet seen the cancellation.
+	renewing := make(chan struct{})
+	e.mux.Lock()
+	e.done = renewing
+	e.mux.Unlock()
+
+	destroyed := make(chan struct{})
+	go func() {
+		s.destroy(time.Now())
+		close(destroyed)
+	}()
+	select {
+	case <-destroyed:
+		t.Fatal("destroy returned before the renewal stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), key.KeyValue, "session key should not be zeroed while the renewal is running")
+	close(renewing)
+	select {
+	case <-destroyed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("destroy did not return once the renewal stopped")
+	}
+	assert.Equal(t, make([]byte, 32), key.KeyValue, "session key should be zeroed")
+}
+
+func TestClient_Destroy_StopsRenewal(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New())
+	s := newSession("TEST.GOKRB5", &sessionState{
+		authTime: time.Now().UTC(),
+		endTime:  time.Now().UTC().Add(time.Hour),
+	})
+	cl.sessions.update(s)
+	cl.enableAutoSessionRenewal(s)
+	cl.Destroy()
+	select {
+	case <-s.renewalDone():
+	default:
+		t.Fatal("auto renewal should have stopped once the client is destroyed")
+	}
+}
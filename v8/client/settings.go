@@ -1,23 +1,142 @@
 package client
 
 import (
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/logging"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/metrics"
+	"github.com/jcmturner/gokrb5/v8/warning"
 )
 
 // Settings holds optional client settings.
 type Settings struct {
 	disablePAFXFast         bool
 	assumePreAuthentication bool
+	enterprisePrincipal     bool
 	preAuthEType            int32
+	preAuthEncChallenge     bool
+	profile                 Profile
+	realmProfiles           map[string]Profile
 	logger                  *log.Logger
+	structuredLogger        logging.Logger
+	correlationID           string
+	packetDump              io.Writer
+	warningHook             warning.Hook
+	metrics                 metrics.Hooks
+	events                  LifecycleEvents
+	clock                   clock.Clock
+	spnResolver             SPNResolver
+	pkinitAnchors           *x509.CertPool
+	fastArmor               *Client
+	otpPrompter             OTPPrompter
+	kdcProxy                string
+	kdcProxyClient          *http.Client
+	kdcTimeout              time.Duration
+	tcpOnly                 bool
+	kdcMaxRetries           int
+	kdcRetryBackoff         time.Duration
+	kdcExchangeBudget       time.Duration
+	autoRenewal             *RenewalPolicy
+	cacheMaxEntries         int
+	negativeCacheTTL        time.Duration
+	ticketStore             TicketStore
+	delegation              DelegationPolicy
+	delegationAllowlist     []string
+	pacRequest              bool
+	includePAC              bool
+}
+
+// Profile identifies a set of KDC implementation specific interoperability behaviours.
+type Profile int
+
+// Interoperability profiles.
+const (
+	// ProfileDefault follows RFC 4120 strictly, which is the behaviour expected of Active Directory.
+	ProfileDefault Profile = iota
+	// ProfileFreeIPA tolerates the behaviour of FreeIPA and MIT KDCs:
+	//
+	// - The KDC may return the canonical client name in replies when a principal alias was requested.
+	//
+	// - Service tickets may be issued for the canonical name of a service alias. They are cached under the requested SPN too.
+	//
+	// - Referral TGTs with a kvno of zero are used for the referral only and are not kept as TGT sessions,
+	// as they cannot be renewed.
+	ProfileFreeIPA
+	// ProfileSamba tolerates the behaviour of Samba AD domain controllers:
+	//
+	// - The e-data of a KRB_ERROR may be absent or carry the METHOD-DATA within a TD-PADATA TYPED-DATA element.
+	//
+	// - ETYPE-INFO2 may list the salts of all the account's keys with the first for an encryption type the client
+	// does not support. Entries for unsupported encryption types are ignored.
+	//
+	// - If the KDC does not indicate the pre-authentication encryption type the configured preference is used.
+	ProfileSamba
+	// ProfileHeimdal tolerates the behaviour of Heimdal KDCs, which is the same as that of Samba as its KDC is
+	// derived from Heimdal. Heimdal may also send the salt only as PA-PW-SALT or ETYPE-INFO, which are always accepted.
+	ProfileHeimdal
+)
+
+// String returns the name of the profile.
+func (p Profile) String() string {
+	switch p {
+	case ProfileFreeIPA:
+		return "FreeIPA"
+	case ProfileSamba:
+		return "Samba"
+	case ProfileHeimdal:
+		return "Heimdal"
+	}
+	return "Default"
+}
+
+// DelegationPolicy determines when the client delegates its credentials, a forwarded TGT, to the services it
+// authenticates to with GSS-API.
+type DelegationPolicy int
+
+// Delegation policies.
+const (
+	// DelegateNever does not delegate credentials.
+	DelegateNever DelegationPolicy = iota
+	// DelegateIfOKAsDelegate delegates credentials to services whose ticket has the ok-as-delegate flag, which the KDC
+	// sets for services trusted for delegation, as browsers do.
+	DelegateIfOKAsDelegate
+	// DelegateAlways delegates credentials to all services.
+	DelegateAlways
+	// DelegateAllowlist delegates credentials only to the services whose SPN matches an entry of the
+	// DelegationAllowlist setting, whatever the flags of their ticket.
+	DelegateAllowlist
+)
+
+// String returns the name of the delegation policy.
+func (p DelegationPolicy) String() string {
+	switch p {
+	case DelegateIfOKAsDelegate:
+		return "IfOKAsDelegate"
+	case DelegateAlways:
+		return "Always"
+	case DelegateAllowlist:
+		return "Allowlist"
+	}
+	return "Never"
 }
 
 // jsonSettings is used when marshaling the Settings details to JSON format.
 type jsonSettings struct {
 	DisablePAFXFast         bool
 	AssumePreAuthentication bool
+	InteropProfile          string
+	RealmInteropProfiles    map[string]string `json:",omitempty"`
 }
 
 // NewSettings creates a new client settings struct.
@@ -57,6 +176,22 @@ func (s *Settings) AssumePreAuthentication() bool {
 	return s.assumePreAuthentication
 }
 
+// EnterprisePrincipal used to configure the client to log in with its username as an enterprise principal name,
+// RFC 6806 section 5, such as the userPrincipalName user@corp.example.com of an Active Directory user. The KDC is asked
+// to canonicalize the name and the client's principal name and realm are then updated to those it replies with.
+//
+// s := NewSettings(EnterprisePrincipal(true))
+func EnterprisePrincipal(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.enterprisePrincipal = b
+	}
+}
+
+// EnterprisePrincipal indicates if the client logs in with its username as an enterprise principal name.
+func (s *Settings) EnterprisePrincipal() bool {
+	return s.enterprisePrincipal
+}
+
 // PreAuthEType used to configure the preauthentication encryption type.
 //
 // s := NewSettings(PreAuthEType(true))
@@ -71,6 +206,41 @@ func (s *Settings) PreAuthEType() int32 {
 	return s.preAuthEType
 }
 
+// InteropProfile used to configure the client's KDC interoperability profile.
+//
+// s := NewSettings(InteropProfile(ProfileFreeIPA))
+func InteropProfile(p Profile) func(*Settings) {
+	return func(s *Settings) {
+		s.profile = p
+	}
+}
+
+// InteropProfile returns the client's KDC interoperability profile.
+func (s *Settings) InteropProfile() Profile {
+	return s.profile
+}
+
+// RealmInteropProfile used to configure the KDC interoperability profile for a specific realm.
+// This overrides the profile configured with InteropProfile for that realm.
+//
+// s := NewSettings(RealmInteropProfile("SAMBA.EXAMPLE.COM", ProfileSamba))
+func RealmInteropProfile(realm string, p Profile) func(*Settings) {
+	return func(s *Settings) {
+		if s.realmProfiles == nil {
+			s.realmProfiles = make(map[string]Profile)
+		}
+		s.realmProfiles[realm] = p
+	}
+}
+
+// InteropProfileForRealm returns the KDC interoperability profile to use for the realm provided.
+func (s *Settings) InteropProfileForRealm(realm string) Profile {
+	if p, ok := s.realmProfiles[realm]; ok {
+		return p
+	}
+	return s.profile
+}
+
 // Logger used to configure client with a logger.
 //
 // s := NewSettings(kt, Logger(l))
@@ -85,11 +255,512 @@ func (s *Settings) Logger() *log.Logger {
 	return s.logger
 }
 
-// Log will write to the service's logger if it is configured.
+// StructuredLogger used to configure the client with a leveled logger of structured fields, such as the realm and KDC
+// address of each exchange and its duration at logging.LevelDebug, and the summaries of the messages exchanged with
+// KDCs at logging.LevelTrace. It is used instead of the Logger if both are configured.
+//
+// s := NewSettings(StructuredLogger(logging.NewJSONLogger(os.Stderr, logging.LevelDebug)))
+func StructuredLogger(l logging.Logger) func(*Settings) {
+	return func(s *Settings) {
+		s.structuredLogger = l
+	}
+}
+
+// StructuredLogger returns the client's structured logger. If none is configured it is a logger writing the messages
+// of logging.LevelInfo and above to the Logger, or nil if there is no Logger either.
+func (s *Settings) StructuredLogger() logging.Logger {
+	if s.structuredLogger != nil {
+		return s.structuredLogger
+	}
+	if s.logger != nil {
+		return logging.NewTextLogger(s.logger, logging.LevelInfo)
+	}
+	return nil
+}
+
+// CorrelationID used to configure the client with the correlation ID added to its log lines and errors.
+//
+// s := NewSettings(CorrelationID(id))
+func CorrelationID(id string) func(*Settings) {
+	return func(s *Settings) {
+		s.correlationID = id
+	}
+}
+
+// CorrelationID returns the correlation ID configured for the client.
+func (s *Settings) CorrelationID() string {
+	return s.correlationID
+}
+
+// PacketDump used to configure the client to write the Kerberos messages exchanged with KDCs to the writer provided,
+// for example to provide the messages in an interoperability issue report. Each message is written with a summary of
+// its contents, its base64 encoding and a hex dump. The messages are not redacted.
+//
+// s := NewSettings(PacketDump(os.Stderr))
+func PacketDump(w io.Writer) func(*Settings) {
+	return func(s *Settings) {
+		s.packetDump = w
+	}
+}
+
+// PacketDump returns the writer the client writes the Kerberos messages exchanged with KDCs to, or nil if none is
+// configured.
+func (s *Settings) PacketDump() io.Writer {
+	return s.packetDump
+}
+
+// dumpPacket writes the message sent to or received from a KDC of the realm to the packet dump writer if one is configured
+// and logs its summary at logging.LevelTrace.
+func (cl *Client) dumpPacket(sent bool, realm, network string, b []byte) {
+	if l := cl.settings.StructuredLogger(); l != nil && l.Enabled(logging.LevelTrace) {
+		msg := "received from KDC"
+		if sent {
+			msg = "sent to KDC"
+		}
+		cl.logf(logging.LevelTrace, msg, logging.F(logging.KeyRealm, realm), logging.F(logging.KeyTransport, network),
+			logging.F(logging.KeyBytes, len(b)), logging.F(logging.KeyMessage, messages.Summary(b)))
+	}
+	w := cl.settings.PacketDump()
+	if w == nil {
+		return
+	}
+	h := fmt.Sprintf("<-- received from KDC for %s over %s", realm, network)
+	if sent {
+		h = fmt.Sprintf("--> sent to KDC for %s over %s", realm, network)
+	}
+	if id := cl.settings.CorrelationID(); id != "" {
+		h = "[Correlation ID: " + id + "] " + h
+	}
+	if err := messages.WriteDump(w, h, b); err != nil {
+		cl.Log("error writing packet dump: %v", err)
+	}
+}
+
+// WarningHook used to configure the client with a hook called with warnings of weak or deprecated usage, such as a
+// deprecated encryption type being negotiated with a KDC, so that hardening can be monitored before it is enforced.
+//
+// s := NewSettings(WarningHook(h))
+func WarningHook(h warning.Hook) func(*Settings) {
+	return func(s *Settings) {
+		s.warningHook = h
+	}
+}
+
+// WarningHook returns the hook the client calls with warnings, or nil if none is configured.
+func (s *Settings) WarningHook() warning.Hook {
+	return s.warningHook
+}
+
+// Metrics used to configure the client with hooks reporting its AS and TGS exchanges, its requests to each KDC, its
+// ticket cache lookups and its TGT renewals, for example to maintain Prometheus counters and histograms.
+//
+// s := NewSettings(Metrics(h))
+func Metrics(h metrics.Hooks) func(*Settings) {
+	return func(s *Settings) {
+		s.metrics = h
+	}
+}
+
+// Metrics returns the metrics hooks of the client, which are nil if none are configured.
+func (s *Settings) Metrics() metrics.Hooks {
+	return s.metrics
+}
+
+// Events used to configure the client with callbacks of the lifecycle of its tickets, such as logins, renewals of
+// TGTs and failures of background renewals.
+//
+// s := NewSettings(Events(e))
+func Events(e LifecycleEvents) func(*Settings) {
+	return func(s *Settings) {
+		s.events = e
+	}
+}
+
+// Events returns the lifecycle callbacks of the client, which are nil if none are configured.
+func (s *Settings) Events() LifecycleEvents {
+	return s.events
+}
+
+// warn calls the warning hook if one is configured.
+func (cl *Client) warn(code warning.Code, principal, realm, format string, v ...interface{}) {
+	h := cl.settings.WarningHook()
+	if h == nil {
+		return
+	}
+	h(warning.Warning{
+		Code:          code,
+		Principal:     principal,
+		Realm:         realm,
+		Message:       fmt.Sprintf(format, v...),
+		CorrelationID: cl.settings.CorrelationID(),
+	})
+}
+
+// warnWeakETypes emits a warning for each deprecated encryption type used in the reply from the KDC.
+func (cl *Client) warnWeakETypes(rep messages.KDCRepFields) {
+	if cl.settings.WarningHook() == nil {
+		return
+	}
+	sname := rep.Ticket.SName.PrincipalNameString()
+	for _, et := range []struct {
+		part  string
+		etype int32
+	}{
+		{"reply", rep.EncPart.EType},
+		{"session key", rep.DecryptedEncPart.Key.KeyType},
+		{"ticket", rep.Ticket.EncPart.EType},
+	} {
+		if etypeID.Deprecated(et.etype) {
+			cl.warn(warning.WeakEType, rep.CName.PrincipalNameString(), rep.CRealm,
+				"%s for %s uses deprecated encryption type %s", et.part, sname, etypeID.Name(et.etype))
+		}
+	}
+}
+
+// Clock used to configure the client with the clock used to check the validity of tickets and sessions and the
+// clock skew with KDCs, for example a clock.Fake to test expiry and renewal without sleeping.
+// The timers scheduling the automatic renewal of sessions wait in real time.
+//
+// s := NewSettings(Clock(c))
+func Clock(c clock.Clock) func(*Settings) {
+	return func(s *Settings) {
+		s.clock = c
+	}
+}
+
+// Clock returns the clock used by the client. If none is configured the system clock is returned.
+func (s *Settings) Clock() clock.Clock {
+	return clock.OrReal(s.clock)
+}
+
+// SPNDiscovery used to configure the client with a resolver of the candidate SPNs tried by GetServiceTicketForHost,
+// for example a DNSSPNResolver.
+//
+// s := NewSettings(SPNDiscovery(&DNSSPNResolver{Reverse: true}))
+func SPNDiscovery(r SPNResolver) func(*Settings) {
+	return func(s *Settings) {
+		s.spnResolver = r
+	}
+}
+
+// SPNDiscovery returns the resolver of candidate SPNs configured, or nil if there is none.
+func (s *Settings) SPNDiscovery() SPNResolver {
+	return s.spnResolver
+}
+
+// PKINITAnchors used to configure the client with the trust anchors the KDC's certificate must chain to when the
+// client authenticates with an X.509 certificate. If not set the system's trust anchors are used.
+//
+// s := NewSettings(PKINITAnchors(pool))
+func PKINITAnchors(pool *x509.CertPool) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitAnchors = pool
+	}
+}
+
+// PKINITAnchors returns the trust anchors for the KDC's certificate configured, or nil if the system's trust anchors
+// are used.
+func (s *Settings) PKINITAnchors() *x509.CertPool {
+	return s.pkinitAnchors
+}
+
+// FASTArmor used to configure the client to armor its exchanges with the KDC using FAST (RFC 6113), as required by
+// realms that only accept FAST pre-authentication. AS exchanges are armored with the TGT of the armor client, such as
+// one created with the host's keytab, and TGS exchanges with the client's own TGT.
+//
+// s := NewSettings(FASTArmor(armor))
+func FASTArmor(armor *Client) func(*Settings) {
+	return func(s *Settings) {
+		s.fastArmor = armor
+	}
+}
+
+// FASTArmor returns the client whose TGT armors the client's AS exchanges, or nil if FAST armoring is not used.
+func (s *Settings) FASTArmor() *Client {
+	return s.fastArmor
+}
+
+// OTP used to configure the client to pre-authenticate with a one-time password (RFC 6560) collected by the prompter
+// when the KDC offers OTP pre-authentication, as realms such as FreeIPA's do for principals that require a token.
+// OTP pre-authentication is only offered over FAST so the FASTArmor setting is also needed.
+//
+// s := NewSettings(OTP(prompter))
+func OTP(prompter OTPPrompter) func(*Settings) {
+	return func(s *Settings) {
+		s.otpPrompter = prompter
+	}
+}
+
+// OTP returns the prompter collecting the one-time passwords the client pre-authenticates with, or nil if OTP
+// pre-authentication is not used.
+func (s *Settings) OTP() OTPPrompter {
+	return s.otpPrompter
+}
+
+// KDCProxy used to configure the client to send its KDC and kpasswd exchanges over HTTPS to the MS-KKDCP KDC proxy
+// at the URL, such as https://proxy.test.gokrb5/KdcProxy, rather than to the KDCs in the configuration.
+// KDC proxies can also be configured per realm with kdc and kpasswd_server entries that are HTTPS URLs.
+//
+// s := NewSettings(KDCProxy("https://proxy.test.gokrb5/KdcProxy"))
+func KDCProxy(url string) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcProxy = url
+	}
+}
+
+// KDCProxy returns the URL of the KDC proxy configured, or an empty string if there is none.
+func (s *Settings) KDCProxy() string {
+	return s.kdcProxy
+}
+
+// KDCProxyHTTPClient used to configure the HTTP client used to send messages to KDC proxies, for example to trust
+// the proxy's certificate authority. If not set http.DefaultClient is used.
+//
+// s := NewSettings(KDCProxyHTTPClient(httpClient))
+func KDCProxyHTTPClient(c *http.Client) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcProxyClient = c
+	}
+}
+
+// KDCProxyHTTPClient returns the HTTP client used to send messages to KDC proxies, or nil if http.DefaultClient is
+// used.
+func (s *Settings) KDCProxyHTTPClient() *http.Client {
+	return s.kdcProxyClient
+}
+
+// KDCTimeout used to configure the time to wait for each KDC to respond, overriding kdc_timeout of the krb5.conf
+// libdefaults.
+//
+// s := NewSettings(KDCTimeout(2 * time.Second))
+func KDCTimeout(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcTimeout = d
+	}
+}
+
+// KDCTimeout returns the time to wait for each KDC to respond, or zero if that of the krb5.conf is used.
+func (s *Settings) KDCTimeout() time.Duration {
+	return s.kdcTimeout
+}
+
+// TCPOnly used to configure the client to only use TCP to exchange with KDCs, whatever the udp_preference_limit of the
+// krb5.conf libdefaults, for example where UDP is blocked or requests are known to be large.
+//
+// s := NewSettings(TCPOnly(true))
+func TCPOnly(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.tcpOnly = b
+	}
+}
+
+// TCPOnly indicates if the client only uses TCP to exchange with KDCs.
+func (s *Settings) TCPOnly() bool {
+	return s.tcpOnly
+}
+
+// KDCMaxRetries used to configure the number of times the KDCs of a realm are each tried before an exchange fails
+// for want of a response, overriding max_retries of the krb5.conf libdefaults.
+//
+// s := NewSettings(KDCMaxRetries(3))
+func KDCMaxRetries(n int) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcMaxRetries = n
+	}
+}
+
+// KDCMaxRetries returns the number of times the KDCs of a realm are each tried, or zero if that of the krb5.conf is
+// used.
+func (s *Settings) KDCMaxRetries() int {
+	return s.kdcMaxRetries
+}
+
+// KDCRetryBackoff used to configure the time waited before the KDCs of a realm are tried again after none responded,
+// which doubles for each further retry. The default is one second.
+//
+// s := NewSettings(KDCRetryBackoff(500 * time.Millisecond))
+func KDCRetryBackoff(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcRetryBackoff = d
+	}
+}
+
+// KDCRetryBackoff returns the time waited before the KDCs of a realm are first tried again.
+func (s *Settings) KDCRetryBackoff() time.Duration {
+	if s.kdcRetryBackoff <= 0 {
+		return time.Second
+	}
+	return s.kdcRetryBackoff
+}
+
+// KDCExchangeBudget used to configure the total time an exchange with the KDCs of a realm may take, including its
+// retries, after which it fails even if KDCs remain to be tried. Zero, the default, does not limit the time other
+// than by the context of the exchange.
+//
+// s := NewSettings(KDCExchangeBudget(10 * time.Second))
+func KDCExchangeBudget(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcExchangeBudget = d
+	}
+}
+
+// KDCExchangeBudget returns the total time an exchange with the KDCs of a realm may take, or zero if it is not limited.
+func (s *Settings) KDCExchangeBudget() time.Duration {
+	return s.kdcExchangeBudget
+}
+
+// AutoRenewal used to configure the client to renew its TGTs and cached service tickets in a background goroutine
+// once the fraction of their lifetime set by the policy has passed, so that they are not renewed when next used or
+// found to have expired. Without this setting TGTs are renewed when five sixths of their remaining lifetime has passed
+// and service tickets are only renewed when they are requested after they have expired.
+//
+// s := NewSettings(AutoRenewal(RenewalPolicy{Threshold: 0.8, Jitter: 0.1}))
+func AutoRenewal(p RenewalPolicy) func(*Settings) {
+	return func(s *Settings) {
+		s.autoRenewal = &p
+	}
+}
+
+// AutoRenewal returns the policy for the background renewal of tickets, or nil if it is not configured.
+func (s *Settings) AutoRenewal() *RenewalPolicy {
+	return s.autoRenewal
+}
+
+// CacheMaxEntries used to configure the maximum number of service tickets held in the client's cache. Once the cache
+// holds more tickets the least recently used are removed. By default the number of tickets is not bounded, though
+// expired tickets that can no longer be renewed are always removed.
+//
+// s := NewSettings(CacheMaxEntries(1000))
+func CacheMaxEntries(n int) func(*Settings) {
+	return func(s *Settings) {
+		s.cacheMaxEntries = n
+	}
+}
+
+// CacheMaxEntries returns the maximum number of service tickets held in the client's cache, or zero if it is not
+// bounded.
+func (s *Settings) CacheMaxEntries() int {
+	return s.cacheMaxEntries
+}
+
+// NegativeCacheTTL used to configure how long the failures of requests for service tickets that the KDC would reply to
+// in the same way, such as KDC_ERR_S_PRINCIPAL_UNKNOWN for an SPN that is not registered, are cached for. Until the
+// failure expires the requests for the SPN fail with it without being sent to the KDC, so that a misconfigured
+// service does not have every request to it sent to the KDC. By default failures are not cached.
+//
+// s := NewSettings(NegativeCacheTTL(time.Minute))
+func NegativeCacheTTL(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.negativeCacheTTL = d
+	}
+}
+
+// NegativeCacheTTL returns how long the failures of requests for service tickets are cached for, or zero if they are
+// not cached.
+func (s *Settings) NegativeCacheTTL() time.Duration {
+	return s.negativeCacheTTL
+}
+
+// ServiceTicketStore used to configure the store of the service tickets obtained by the client in place of the
+// client's own cache, for example to share tickets between the replicas of a service. The store is not cleared when
+// the client is destroyed or closed and the CacheMaxEntries setting does not apply to it unless it is a Cache.
+//
+// s := NewSettings(ServiceTicketStore(store))
+func ServiceTicketStore(store TicketStore) func(*Settings) {
+	return func(s *Settings) {
+		s.ticketStore = store
+	}
+}
+
+// ServiceTicketStore returns the store of the service tickets obtained by the client, or nil if the client's own
+// cache is used.
+func (s *Settings) ServiceTicketStore() TicketStore {
+	return s.ticketStore
+}
+
+// Delegation used to configure when the client delegates its credentials to the services it authenticates to with
+// GSS-API, such as SPNEGO HTTP services. The client's TGT must be forwardable for credentials to be delegated. By
+// default credentials are never delegated.
+//
+// s := NewSettings(Delegation(DelegateIfOKAsDelegate))
+func Delegation(p DelegationPolicy) func(*Settings) {
+	return func(s *Settings) {
+		s.delegation = p
+	}
+}
+
+// Delegation returns when the client delegates its credentials to services.
+func (s *Settings) Delegation() DelegationPolicy {
+	return s.delegation
+}
+
+// DelegationAllowlist used to configure the SPNs of the services the client delegates its credentials to with the
+// DelegateAllowlist policy. An entry may be a pattern of the path.Match syntax, such as "HTTP/*.test.gokrb5", and
+// is matched without regard to case.
+//
+// s := NewSettings(Delegation(DelegateAllowlist), DelegationAllowlist("HTTP/host.test.gokrb5"))
+func DelegationAllowlist(spns ...string) func(*Settings) {
+	return func(s *Settings) {
+		s.delegationAllowlist = append([]string(nil), spns...)
+	}
+}
+
+// DelegationAllowlist returns the SPNs of the services the client delegates its credentials to with the
+// DelegateAllowlist policy.
+func (s *Settings) DelegationAllowlist() []string {
+	return s.delegationAllowlist
+}
+
+// delegationAllowed indicates if the SPN matches an entry of the delegation allowlist.
+func (s *Settings) delegationAllowed(spn string) bool {
+	spn = strings.ToLower(spn)
+	for _, p := range s.delegationAllowlist {
+		if ok, err := path.Match(strings.ToLower(p), spn); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludePAC used to configure the client to ask the KDC, with a PA-PAC-REQUEST in its AS_REQs and TGS_REQs, to
+// include or omit the PAC of the tickets it obtains. Tickets without a PAC are much smaller for users that are members
+// of many groups, but can only be used with services that do not need the authorization data. If not set no
+// PA-PAC-REQUEST is sent and the KDC's default applies, Active Directory including the PAC.
+//
+// s := NewSettings(IncludePAC(false))
+func IncludePAC(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.pacRequest = true
+		s.includePAC = b
+	}
+}
+
+// IncludePAC returns whether the client asks the KDC to include the PAC in its tickets, and whether it asks at all.
+func (s *Settings) IncludePAC() (include bool, requested bool) {
+	return s.includePAC, s.pacRequest
+}
+
+// now returns the current time in UTC of the client's clock, corrected for its skew from the KDCs' clock.
+func (cl *Client) now() time.Time {
+	return cl.clock().Now().UTC()
+}
+
+// Log will write to the client's logger, at logging.LevelInfo, if it is configured.
 func (cl *Client) Log(format string, v ...interface{}) {
-	if cl.settings.Logger() != nil {
-		cl.settings.Logger().Output(2, fmt.Sprintf(format, v...))
+	cl.logf(logging.LevelInfo, fmt.Sprintf(format, v...))
+}
+
+// logf writes the message with the fields and the client's correlation ID to the client's structured logger if it is
+// configured.
+func (cl *Client) logf(level logging.Level, msg string, fields ...logging.Field) {
+	l := cl.settings.StructuredLogger()
+	if l == nil || !l.Enabled(level) {
+		return
+	}
+	if id := cl.settings.CorrelationID(); id != "" {
+		fields = append([]logging.Field{logging.F(logging.KeyCorrelationID, id)}, fields...)
 	}
+	l.Log(level, msg, fields...)
 }
 
 // JSON returns a JSON representation of the settings.
@@ -97,6 +768,13 @@ func (s *Settings) JSON() (string, error) {
 	js := jsonSettings{
 		DisablePAFXFast:         s.disablePAFXFast,
 		AssumePreAuthentication: s.assumePreAuthentication,
+		InteropProfile:          s.profile.String(),
+	}
+	for realm, p := range s.realmProfiles {
+		if js.RealmInteropProfiles == nil {
+			js.RealmInteropProfiles = make(map[string]string)
+		}
+		js.RealmInteropProfiles[realm] = p.String()
 	}
 	b, err := json.MarshalIndent(js, "", "  ")
 	if err != nil {
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// SPNResolver discovers the candidate SPNs for a service on a host, in the order they should be tried.
+type SPNResolver interface {
+	ResolveSPNs(ctx context.Context, service, host string) ([]string, error)
+}
+
+// DNSSPNResolver is an SPNResolver that discovers the names a host is known by from DNS and, optionally, the SPNs
+// registered for it in a directory such as Active Directory. If Overrides has an SPN for the host it is the only
+// candidate. Otherwise the candidates are, in order and without duplicates:
+//
+// - the SPN formed from the host as given;
+//
+// - unless IgnoreCNAME is set, the SPN formed from the canonical name of the host if it is an alias (CNAME record);
+//
+// - if Reverse is set, the SPNs formed from the names the host's addresses resolve to (PTR records);
+//
+// - the SPNs for the service returned by LDAPLookup, if set.
+type DNSSPNResolver struct {
+	// Resolver used for the DNS lookups. If nil net.DefaultResolver is used.
+	Resolver *net.Resolver
+	// Reverse enables reverse lookups of the host's addresses.
+	Reverse bool
+	// IgnoreCNAME disables following the CNAME record of the host.
+	IgnoreCNAME bool
+	// Overrides maps host names, in lower case, to the SPN to use for them, for example the SPN of the account of the
+	// servers behind a load balancer alias.
+	Overrides map[string]string
+	// LDAPLookup returns the servicePrincipalName values of the account for the host, for example from a search of
+	// Active Directory for the computer object with the dNSHostName of the host. Values for other services are ignored.
+	LDAPLookup func(ctx context.Context, host string) ([]string, error)
+
+	lookupCNAME func(ctx context.Context, host string) (string, error)
+	lookupHost  func(ctx context.Context, host string) ([]string, error)
+	lookupAddr  func(ctx context.Context, addr string) ([]string, error)
+}
+
+// NewConfigSPNResolver returns a DNSSPNResolver that canonicalizes host names as the dns_canonicalize_hostname and
+// rdns libdefaults of the krb5.conf specify: CNAME records are followed unless dns_canonicalize_hostname is false,
+// in which case the host's addresses are not looked up in reverse either, and reverse lookups are made if rdns is true.
+func NewConfigSPNResolver(cfg *config.Config) *DNSSPNResolver {
+	return &DNSSPNResolver{
+		IgnoreCNAME: !cfg.LibDefaults.DNSCanonicalizeHostname,
+		Reverse:     cfg.LibDefaults.DNSCanonicalizeHostname && cfg.LibDefaults.RDNS,
+	}
+}
+
+// ResolveSPNs returns the candidate SPNs for the service on the host. Failed lookups are skipped so that the SPN
+// formed from the host as given is always returned.
+func (r *DNSSPNResolver) ResolveSPNs(ctx context.Context, service, host string) ([]string, error) {
+	if spn, ok := r.Overrides[strings.ToLower(strings.TrimSuffix(host, "."))]; ok {
+		return []string{spn}, nil
+	}
+	res := r.Resolver
+	if res == nil {
+		res = net.DefaultResolver
+	}
+	lookupCNAME, lookupHost, lookupAddr := r.lookupCNAME, r.lookupHost, r.lookupAddr
+	if lookupCNAME == nil {
+		lookupCNAME = res.LookupCNAME
+	}
+	if lookupHost == nil {
+		lookupHost = res.LookupHost
+	}
+	if lookupAddr == nil {
+		lookupAddr = res.LookupAddr
+	}
+
+	var spns []string
+	seen := make(map[string]bool)
+	add := func(h string) {
+		h = strings.TrimSuffix(h, ".")
+		if h == "" {
+			return
+		}
+		spn := service + "/" + h
+		if k := strings.ToLower(spn); !seen[k] {
+			seen[k] = true
+			spns = append(spns, spn)
+		}
+	}
+	add(host)
+	if !r.IgnoreCNAME && net.ParseIP(host) == nil {
+		if cname, err := lookupCNAME(ctx, host); err == nil {
+			add(cname)
+		}
+	}
+	if r.Reverse {
+		addrs := []string{host}
+		if net.ParseIP(host) == nil {
+			addrs, _ = lookupHost(ctx, host)
+		}
+		for _, a := range addrs {
+			names, err := lookupAddr(ctx, a)
+			if err != nil {
+				continue
+			}
+			for _, n := range names {
+				add(n)
+			}
+		}
+	}
+	if r.LDAPLookup != nil {
+		vals, err := r.LDAPLookup(ctx, host)
+		if err != nil {
+			return spns, err
+		}
+		prefix := strings.ToLower(service + "/")
+		for _, v := range vals {
+			if strings.HasPrefix(strings.ToLower(v), prefix) {
+				// Strip any port or service name component, e.g. MSSQLSvc/host:1433.
+				h := v[len(prefix):]
+				if i := strings.IndexAny(h, ":/"); i > 0 {
+					h = h[:i]
+				}
+				add(h)
+			}
+		}
+	}
+	return spns, nil
+}
+
+// SPNDiscovery returns the resolver of candidate SPNs of the client's SPNDiscovery setting, or nil if it has none.
+func (cl *Client) SPNDiscovery() SPNResolver {
+	return cl.settings.SPNDiscovery()
+}
+
+// GetServiceTicketForHost gets a service ticket for the service on the host trying the candidate SPNs discovered by
+// the client's SPNDiscovery setting in turn until the KDC knows one of them. If no resolver is configured only the SPN
+// <service>/<host> is tried. The SPN the ticket was issued for is returned with the ticket.
+func (cl *Client) GetServiceTicketForHost(ctx context.Context, service, host string) (messages.Ticket, types.EncryptionKey, string, error) {
+	tkt, skey, spn, err := cl.getServiceTicketForHost(ctx, service, host)
+	return tkt, skey, spn, cl.correlate(err)
+}
+
+func (cl *Client) getServiceTicketForHost(ctx context.Context, service, host string) (messages.Ticket, types.EncryptionKey, string, error) {
+	spns := []string{service + "/" + host}
+	if r := cl.settings.SPNDiscovery(); r != nil {
+		s, err := r.ResolveSPNs(ctx, service, host)
+		if err != nil {
+			cl.Log("error resolving SPNs for %s on %s: %v", service, host, err)
+		}
+		if len(s) > 0 {
+			spns = s
+		}
+	}
+	var err error
+	for _, spn := range spns {
+		var tkt messages.Ticket
+		var skey types.EncryptionKey
+		tkt, skey, err = cl.getServiceTicket(ctx, spn)
+		if err == nil {
+			return tkt, skey, spn, nil
+		}
+		if !errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN}) {
+			return tkt, skey, spn, err
+		}
+		cl.Log("SPN %s unknown to the KDC, trying the next candidate", spn)
+	}
+	return messages.Ticket{}, types.EncryptionKey{}, "", err
+}
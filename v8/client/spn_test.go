@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSSPNResolver(t *testing.T) {
+	t.Parallel()
+	r := &DNSSPNResolver{
+		Reverse: true,
+		LDAPLookup: func(ctx context.Context, host string) ([]string, error) {
+			return []string{"HOST/web01", "http/WEB01.test.gokrb5", "HTTP/web01.test.gokrb5:8080", "HTTP/alias.test.gokrb5"}, nil
+		},
+		lookupCNAME: func(ctx context.Context, host string) (string, error) {
+			return "web01.test.gokrb5.", nil
+		},
+		lookupHost: func(ctx context.Context, host string) ([]string, error) {
+			return []string{"10.0.0.1", "10.0.0.2"}, nil
+		},
+		lookupAddr: func(ctx context.Context, addr string) ([]string, error) {
+			if addr == "10.0.0.2" {
+				return nil, errors.New("no PTR record")
+			}
+			return []string{"web01.test.gokrb5.", "web01-eth0.test.gokrb5."}, nil
+		},
+	}
+	spns, err := r.ResolveSPNs(context.Background(), "HTTP", "www.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error resolving SPNs: %v", err)
+	}
+	assert.Equal(t, []string{
+		"HTTP/www.test.gokrb5",
+		"HTTP/web01.test.gokrb5",
+		"HTTP/web01-eth0.test.gokrb5",
+		"HTTP/alias.test.gokrb5",
+	}, spns, "candidate SPNs not as expected")
+}
+
+func TestDNSSPNResolver_Canonicalization(t *testing.T) {
+	t.Parallel()
+	lookups := 0
+	r := &DNSSPNResolver{
+		IgnoreCNAME: true,
+		Overrides:   map[string]string{"lb.test.gokrb5": "HTTP/web.test.gokrb5"},
+		lookupCNAME: func(ctx context.Context, host string) (string, error) {
+			lookups++
+			return "web01.test.gokrb5.", nil
+		},
+	}
+	spns, err := r.ResolveSPNs(context.Background(), "HTTP", "www.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error resolving SPNs: %v", err)
+	}
+	assert.Equal(t, []string{"HTTP/www.test.gokrb5"}, spns, "CNAME should not be followed")
+	assert.Equal(t, 0, lookups, "CNAME should not be looked up")
+	spns, err = r.ResolveSPNs(context.Background(), "HTTP", "LB.test.gokrb5.")
+	if err != nil {
+		t.Fatalf("error resolving SPNs: %v", err)
+	}
+	assert.Equal(t, []string{"HTTP/web.test.gokrb5"}, spns, "SPN of the override not returned")
+
+	cfg := config.New()
+	r = NewConfigSPNResolver(cfg)
+	assert.False(t, r.IgnoreCNAME, "CNAMEs should be followed by default")
+	assert.True(t, r.Reverse, "reverse lookups should be made by default")
+	cfg.LibDefaults.RDNS = false
+	assert.False(t, NewConfigSPNResolver(cfg).Reverse, "reverse lookups should not be made without rdns")
+	cfg.LibDefaults.RDNS = true
+	cfg.LibDefaults.DNSCanonicalizeHostname = false
+	r = NewConfigSPNResolver(cfg)
+	assert.True(t, r.IgnoreCNAME, "CNAMEs should not be followed without dns_canonicalize_hostname")
+	assert.False(t, r.Reverse, "reverse lookups should not be made without dns_canonicalize_hostname")
+}
+
+type testSPNResolver []string
+
+func (r testSPNResolver) ResolveSPNs(ctx context.Context, service, host string) ([]string, error) {
+	return r, nil
+}
+
+func TestClient_GetServiceTicketForHost(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	kdc, _ := testTCPKDC(t, skey, 0)
+	defer kdc.Close()
+	cl := testTGSClient(t, kdc.Addr().String(), skey)
+	defer cl.Destroy()
+
+	_, _, _, err := cl.GetServiceTicketForHost(context.Background(), "HTTP", "unknown.test.gokrb5")
+	assert.True(t, errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN}), "error should match the KDC error code")
+
+	cl.settings.spnResolver = testSPNResolver{"HTTP/unknown.test.gokrb5", "HTTP/host1.test.gokrb5"}
+	tkt, _, spn, err := cl.GetServiceTicketForHost(context.Background(), "HTTP", "unknown.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	assert.Equal(t, "HTTP/host1.test.gokrb5", spn, "SPN not as expected")
+	assert.Equal(t, "HTTP/host1.test.gokrb5", tkt.SName.PrincipalNameString(), "ticket SName not as expected")
+}
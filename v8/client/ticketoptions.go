@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// TicketOption overrides, for a single request, the KDC options or times of the ticket requested, which are
+// otherwise taken from the [libdefaults] of the client's configuration. The time provided is the current time of the
+// client's clock, which times relative to now are taken from.
+type TicketOption func(b *messages.KDCReqBody, now time.Time)
+
+// setKDCOption sets or clears the KDC option.
+func setKDCOption(b *messages.KDCReqBody, option int, set bool) {
+	if set {
+		types.SetFlag(&b.KDCOptions, option)
+		return
+	}
+	types.UnsetFlag(&b.KDCOptions, option)
+}
+
+// TicketForwardable requests a ticket that is, or is not, forwardable.
+func TicketForwardable(forwardable bool) TicketOption {
+	return func(b *messages.KDCReqBody, _ time.Time) {
+		setKDCOption(b, flags.Forwardable, forwardable)
+	}
+}
+
+// TicketProxiable requests a ticket that is, or is not, proxiable.
+func TicketProxiable(proxiable bool) TicketOption {
+	return func(b *messages.KDCReqBody, _ time.Time) {
+		setKDCOption(b, flags.Proxiable, proxiable)
+	}
+}
+
+// TicketLifetime requests a ticket valid for the duration from now.
+func TicketLifetime(d time.Duration) TicketOption {
+	return func(b *messages.KDCReqBody, now time.Time) {
+		b.Till = now.UTC().Add(d)
+	}
+}
+
+// TicketEndTime requests a ticket valid until the time.
+func TicketEndTime(t time.Time) TicketOption {
+	return func(b *messages.KDCReqBody, _ time.Time) {
+		b.Till = t.UTC()
+	}
+}
+
+// TicketRenewLifetime requests a ticket renewable for the duration from now, or a ticket that is not renewable if the
+// duration is zero.
+func TicketRenewLifetime(d time.Duration) TicketOption {
+	return func(b *messages.KDCReqBody, now time.Time) {
+		setKDCOption(b, flags.Renewable, d > 0)
+		b.RTime = time.Time{}
+		if d > 0 {
+			b.RTime = now.UTC().Add(d)
+		}
+	}
+}
+
+// TicketPostdated requests a postdated ticket valid from the start time, RFC 4120 section 2.4. The KDC issues the
+// ticket as invalid so it is not cached and must be validated with ValidateTicket once its start time has passed. A
+// postdated TGT obtained with LoginWithOptions is validated by the client when it is first used after its start time.
+func TicketPostdated(start time.Time) TicketOption {
+	return func(b *messages.KDCReqBody, _ time.Time) {
+		setKDCOption(b, flags.AllowPostDate, true)
+		setKDCOption(b, flags.PostDated, true)
+		b.From = start.UTC()
+	}
+}
+
+// LoginWithOptions logs the client in with the KDC via an AS exchange, as LoginContext does, with the KDC options and
+// times of the AS_REQ for the TGT overridden by the options, for example for a postdated TGT for a batch job that is to
+// run later. The client's password, keytab or other secret is required.
+func (cl *Client) LoginWithOptions(ctx context.Context, opts ...TicketOption) error {
+	return cl.correlate(cl.login(ctx, opts...))
+}
+
+// GetServiceTicketWithOptions requests a service ticket for the SPN, as GetServiceTicketContext does, with the KDC
+// options and times of the request overridden by the options, for example for a forwardable ticket to one service and
+// one that is not to another. The ticket is always requested from the KDC, rather than taken from the cache, and
+// replaces any cached for the SPN.
+func (cl *Client) GetServiceTicketWithOptions(ctx context.Context, spn string, opts ...TicketOption) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, skey, err := cl.getServiceTicketWithOptions(ctx, spn, opts)
+	return tkt, skey, cl.correlate(err)
+}
+
+func (cl *Client) getServiceTicketWithOptions(ctx context.Context, spn string, opts []TicketOption) (messages.Ticket, types.EncryptionKey, error) {
+	princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+	if cl.Config.LibDefaults.Canonicalize && len(princ.NameString) == 2 {
+		princ.NameType = nametype.KRB_NT_SRV_HST
+	}
+	realm := cl.Config.ResolveRealm(princ.NameString[len(princ.NameString)-1])
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName(), realm, cl.Config, tgt, skey, princ, false)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")
+	}
+	err = tgsReq.UpdateBody(func(b *messages.KDCReqBody) {
+		now := cl.now()
+		b.SetTimes(now, cl.Config)
+		for _, o := range opts {
+			o(b, now)
+		}
+	}, tgt, skey)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to apply the ticket options to the TGS_REQ")
+	}
+	_, tgsRep, err := cl.tgsExchange(ctx, tgsReq, realm, tgt, skey, 0)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	cl.cacheServiceAlias(spn, princ, realm, tgsRep)
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTicketOptions(t *testing.T) {
+	t.Parallel()
+	b := messages.KDCReqBody{KDCOptions: types.NewKrbFlags(), RTime: time.Now().Add(time.Hour)}
+	types.SetFlags(&b.KDCOptions, []int{flags.Forwardable, flags.Renewable})
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, o := range []TicketOption{TicketForwardable(false), TicketProxiable(true), TicketRenewLifetime(0),
+		TicketEndTime(start.Add(time.Hour)), TicketPostdated(start)} {
+		o(&b, start)
+	}
+	assert.False(t, types.IsFlagSet(&b.KDCOptions, flags.Forwardable), "forwardable should be cleared")
+	assert.True(t, types.IsFlagSet(&b.KDCOptions, flags.Proxiable), "proxiable should be set")
+	assert.False(t, types.IsFlagSet(&b.KDCOptions, flags.Renewable), "renewable should be cleared")
+	assert.True(t, b.RTime.IsZero(), "renew till should be cleared")
+	assert.True(t, types.IsFlagSet(&b.KDCOptions, flags.AllowPostDate), "allow-postdate should be set")
+	assert.True(t, types.IsFlagSet(&b.KDCOptions, flags.PostDated), "postdated should be set")
+	assert.Equal(t, start, b.From, "start time not as expected")
+	assert.Equal(t, start.Add(time.Hour), b.Till, "end time not as expected")
+
+	TicketRenewLifetime(time.Hour)(&b, start)
+	assert.True(t, types.IsFlagSet(&b.KDCOptions, flags.Renewable), "renewable should be set")
+	assert.Equal(t, start.Add(time.Hour), b.RTime, "renew till should be relative to the client's time")
+	TicketLifetime(2*time.Hour)(&b, start)
+	assert.Equal(t, start.Add(2*time.Hour), b.Till, "end time should be relative to the client's time")
+}
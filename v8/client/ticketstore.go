@@ -0,0 +1,128 @@
+package client
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// TicketStore holds the service tickets obtained by a client, keyed on the SPN of the CacheEntry.
+//
+// The client's in memory Cache is the default store. Another implementation, for example backed by Redis, memcached or
+// bolt, can be configured with the ServiceTicketStore setting so that service tickets are shared between the replicas
+// of a horizontally scaled service. Such a store must persist the ticket and session key of each entry, which are
+// credentials and must be protected accordingly, and is responsible for removing expired entries, such as with a time
+// to live of the entry's RenewTill or EndTime.
+//
+// The methods of a TicketStore must be safe for concurrent use. Get is called each time a client needs a service
+// ticket so it should be fast.
+type TicketStore interface {
+	// Get returns the entry for the SPN and whether there is one.
+	Get(spn string) (CacheEntry, bool, error)
+	// Put adds the entry for its SPN, replacing any existing entry.
+	Put(e CacheEntry) error
+	// Remove removes the entry for the SPN, if there is one.
+	Remove(spn string) error
+	// List returns all the entries.
+	List() ([]CacheEntry, error)
+}
+
+// Get returns the cache entry for the SPN and whether there is one. The entry's session key is a copy so that it is
+// not zeroed when the entry is removed from the cache. It never returns an error.
+func (c *Cache) Get(spn string) (CacheEntry, bool, error) {
+	e, ok := c.getEntry(spn)
+	e.SessionKey = copyKey(e.SessionKey)
+	return e, ok, nil
+}
+
+// Put adds the entry to the cache for its SPN, replacing any existing entry. The cache holds a copy of the entry's
+// session key. It never returns an error.
+func (c *Cache) Put(e CacheEntry) error {
+	e.SessionKey = copyKey(e.SessionKey)
+	c.put(e)
+	return nil
+}
+
+// Remove removes the cache entry for the SPN. It never returns an error.
+func (c *Cache) Remove(spn string) error {
+	c.RemoveEntry(spn)
+	return nil
+}
+
+// List returns the cache entries sorted by SPN, with copies of their session keys as Get returns. It never returns an
+// error.
+func (c *Cache) List() ([]CacheEntry, error) {
+	es := c.sorted()
+	for i := range es {
+		es[i].SessionKey = copyKey(es[i].SessionKey)
+	}
+	return es, nil
+}
+
+// tickets returns the store of the client's service tickets, which is the client's cache unless the
+// ServiceTicketStore setting is configured.
+func (cl *Client) tickets() TicketStore {
+	if s := cl.settings.ServiceTicketStore(); s != nil {
+		return s
+	}
+	return cl.cache
+}
+
+// cachedEntry returns the entry for the SPN from the client's ticket store. An error from the store is logged and the
+// ticket treated as not cached.
+func (cl *Client) cachedEntry(spn string) (CacheEntry, bool) {
+	e, ok, err := cl.tickets().Get(spn)
+	if err != nil {
+		cl.Log("error getting ticket for %s from ticket store: %v", spn, err)
+		return e, false
+	}
+	return e, ok
+}
+
+// cachedEntries returns the entries of the client's ticket store sorted by SPN. An error from the store is logged and
+// no entries are returned.
+func (cl *Client) cachedEntries() []CacheEntry {
+	es, err := cl.tickets().List()
+	if err != nil {
+		cl.Log("error listing tickets in ticket store: %v", err)
+		return nil
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return es[i].SPN < es[j].SPN
+	})
+	return es
+}
+
+// cacheTicket adds a ticket to the client's ticket store. An error from the store is logged as the ticket is still
+// usable by the caller.
+func (cl *Client) cacheTicket(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey, flags asn1.BitString) {
+	e := CacheEntry{
+		SPN:        tkt.SName.PrincipalNameString(),
+		Ticket:     tkt,
+		AuthTime:   authTime,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		RenewTill:  renewTill,
+		SessionKey: sessionKey,
+		Flags:      flags,
+	}
+	if err := cl.tickets().Put(e); err != nil {
+		cl.Log("error adding ticket for %s to ticket store: %v", e.SPN, err)
+	}
+}
+
+// cacheAlias adds an entry for the alias SPN to the client's ticket store that is a copy of the entry for the SPN, if
+// there is one.
+func (cl *Client) cacheAlias(alias, spn string) {
+	e, ok := cl.cachedEntry(spn)
+	if !ok {
+		return
+	}
+	e.SPN = alias
+	if err := cl.tickets().Put(e); err != nil {
+		cl.Log("error adding ticket for %s to ticket store: %v", alias, err)
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTicketStore is a TicketStore such as one that would be shared between replicas of a service.
+type testTicketStore struct {
+	mux     sync.Mutex
+	entries map[string]CacheEntry
+	err     error
+}
+
+func (s *testTicketStore) Get(spn string) (CacheEntry, bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	e, ok := s.entries[spn]
+	return e, ok, s.err
+}
+
+func (s *testTicketStore) Put(e CacheEntry) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.entries[e.SPN] = e
+	return nil
+}
+
+func (s *testTicketStore) Remove(spn string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.entries, spn)
+	return s.err
+}
+
+func (s *testTicketStore) List() ([]CacheEntry, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var es []CacheEntry
+	for _, e := range s.entries {
+		es = append(es, e)
+	}
+	return es, s.err
+}
+
+func TestClient_ServiceTicketStore(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	l, conns := testTCPKDC(t, skey, 0)
+	defer l.Close()
+	store := &testTicketStore{entries: make(map[string]CacheEntry)}
+	cl1 := testTGSClient(t, l.Addr().String(), skey, ServiceTicketStore(store))
+	defer cl1.Destroy()
+	cl2 := testTGSClient(t, l.Addr().String(), skey, ServiceTicketStore(store))
+
+	tkt, _, err := cl1.GetServiceTicket("HTTP/host1.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	_, ok := store.entries["HTTP/host1.test.gokrb5"]
+	assert.True(t, ok, "ticket should be added to the store")
+	assert.Len(t, cl1.cache.all(), 0, "ticket should not be added to the client's cache")
+	assert.Len(t, cl1.DebugSnapshot().Tickets, 1, "tickets in the store should be in the snapshot")
+
+	// The ticket is shared with the other client so it does not contact the KDC.
+	tkt2, _, err := cl2.GetServiceTicket("HTTP/host1.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket from the store: %v", err)
+	}
+	assert.Equal(t, tkt, tkt2, "ticket from the store not as expected")
+	assert.Equal(t, int32(1), atomic.LoadInt32(conns), "the KDC should not be contacted for a ticket in the store")
+	cl2.Destroy()
+	assert.Len(t, store.entries, 1, "the store should not be cleared when the client is destroyed")
+
+	// Errors from the store are treated as the ticket not being cached.
+	store.mux.Lock()
+	store.err = errors.New("store unavailable")
+	store.mux.Unlock()
+	_, _, err = cl1.GetServiceTicket("HTTP/host1.test.gokrb5")
+	assert.NoError(t, err, "ticket should be obtained from the KDC when the store fails")
+}
+
+func TestCache_TicketStore(t *testing.T) {
+	t.Parallel()
+	var s TicketStore = NewCache()
+	e := CacheEntry{SPN: "HTTP/host.test.gokrb5"}
+	assert.NoError(t, s.Put(e), "error adding entry")
+	got, ok, err := s.Get("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "error getting entry")
+	assert.True(t, ok, "entry should be found")
+	assert.Equal(t, e.SPN, got.SPN, "entry not as expected")
+	es, err := s.List()
+	assert.NoError(t, err, "error listing entries")
+	assert.Len(t, es, 1, "number of entries not as expected")
+	assert.NoError(t, s.Remove("HTTP/host.test.gokrb5"), "error removing entry")
+	_, ok, _ = s.Get("HTTP/host.test.gokrb5")
+	assert.False(t, ok, "entry should be removed")
+}
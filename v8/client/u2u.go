@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// TGT returns the client's TGT for its realm and the TGT's session key, logging in or renewing the TGT if required.
+// For user-to-user authentication, RFC 4120 section 3.7, the TGT is sent to the peer so that it can obtain a ticket
+// to the client with GetUser2UserServiceTicket, which the client accepts with the session key rather than a service
+// key. The session key must not be disclosed.
+func (cl *Client) TGT() (messages.Ticket, types.EncryptionKey, error) {
+	tgt, skey, err := cl.sessionTGT(context.Background(), cl.Credentials.Domain())
+	return tgt, skey, cl.correlate(err)
+}
+
+// GetUser2UserServiceTicket obtains a user-to-user ticket, RFC 4120 section 3.7, to the peer principal whose TGT is
+// given, such as a peer-to-peer service that has no service key registered with the KDC. The peer is of the form
+// "username" or "username@REALM" and must be the client of the TGT, which it obtains with TGT. The ticket is
+// encrypted with the session key of the peer's TGT, ENC-TKT-IN-SKEY, so that the peer validates it with its TGT
+// rather than a keytab.
+// The ticket is only valid while the peer holds the TGT so it is not added to the client's ticket cache.
+func (cl *Client) GetUser2UserServiceTicket(peer string, tgt messages.Ticket) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, skey, err := cl.getUser2UserServiceTicket(peer, tgt)
+	return tkt, skey, cl.correlate(err)
+}
+
+func (cl *Client) getUser2UserServiceTicket(peer string, peerTGT messages.Ticket) (messages.Ticket, types.EncryptionKey, error) {
+	var tkt messages.Ticket
+	var skey types.EncryptionKey
+	sname, _ := types.ParseSPNString(peer)
+	sname.NameType = nametype.KRB_NT_PRINCIPAL
+	// The ticket is issued by the KDC of the realm of the peer's TGT, the only KDC able to decrypt it.
+	realm := peerTGT.Realm
+	tgt, sessionKey, err := cl.sessionTGT(context.Background(), realm)
+	if err != nil {
+		return tkt, skey, err
+	}
+	tgsReq, err := messages.NewUser2UserTGSReq(cl.Credentials.CName(), realm, cl.Config, tgt, sessionKey, sname, false, peerTGT)
+	if err == nil {
+		err = cl.timeTGSReq(&tgsReq, tgt, sessionKey)
+	}
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new user-to-user TGS_REQ")
+	}
+	b, fa, err := cl.marshalTGSReq(context.Background(), &tgsReq, tgt, sessionKey)
+	if err != nil {
+		return tkt, skey, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal user-to-user TGS_REQ")
+	}
+	r, err := cl.sendToKDC(context.Background(), b, realm)
+	if err != nil {
+		if e, ok := err.(messages.KRBError); ok {
+			if fe, ferr := fastError(fa, e); ferr == nil {
+				e = fe
+			}
+			return tkt, skey, krberror.Errorf(e, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting user-to-user ticket for %s", peer)
+		}
+		return tkt, skey, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending user-to-user TGS_REQ to KDC")
+	}
+	tgsRep, err := cl.decodeTGSRep(context.Background(), tgsReq, r, sessionKey, fa)
+	if err != nil {
+		return tkt, skey, err
+	}
+	cl.Log("user-to-user ticket obtained for %s (EndTime: %v)", tgsRep.Ticket.SName.PrincipalNameString(), tgsRep.DecryptedEncPart.EndTime)
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ValidateTicket exchanges a postdated ticket, issued as invalid, for the valid ticket with the VALIDATE KDC option,
+// RFC 4120 section 2.4, once its start time has passed. The ticket is validated by the KDC of the realm that issued it
+// and the valid ticket and its session key are returned. A validated TGT replaces the client's session for its realm
+// and a validated service ticket is added to the client's cache.
+func (cl *Client) ValidateTicket(ctx context.Context, tkt messages.Ticket, key types.EncryptionKey) (messages.Ticket, types.EncryptionKey, error) {
+	tkt, key, err := cl.validateTicket(ctx, tkt, key)
+	return tkt, key, cl.correlate(err)
+}
+
+func (cl *Client) validateTicket(ctx context.Context, tkt messages.Ticket, key types.EncryptionKey) (messages.Ticket, types.EncryptionKey, error) {
+	if ok, err := cl.IsConfigured(); !ok {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	spn := tkt.SName.PrincipalNameString()
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName(), tkt.Realm, cl.Config, tkt, key, tkt.SName, false)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")
+	}
+	err = tgsReq.UpdateBody(func(b *messages.KDCReqBody) {
+		b.SetTimes(cl.now(), cl.Config)
+		b.KDCOptions = types.NewKrbFlags()
+		types.SetFlag(&b.KDCOptions, flags.Validate)
+	}, tkt, key)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	_, tgsRep, err := cl.tgsExchange(ctx, tgsReq, tkt.Realm, tkt, key, 0)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "error validating ticket for %s", spn)
+	}
+	if types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, flags.Invalid) {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.New(krberror.KRBMsgError, fmt.Sprintf("ticket for %s returned by the KDC is still invalid", spn))
+	}
+	if strings.ToLower(tgsRep.Ticket.SName.NameString[0]) == "krbtgt" {
+		realm := tgsRep.Ticket.SName.NameString[len(tgsRep.Ticket.SName.NameString)-1]
+		// The validated TGT is held as the realm's session rather than in the ticket store.
+		if err := cl.tickets().Remove(tgsRep.Ticket.SName.PrincipalNameString()); err != nil {
+			cl.Log("error removing TGT for %s from ticket store: %v", realm, err)
+		}
+		if s, ok := cl.sessions.get(realm); ok {
+			s.update(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+			cl.sessions.update(s)
+			cl.Log("TGT session validated for %s (EndTime: %v)", realm, tgsRep.DecryptedEncPart.EndTime)
+		} else {
+			cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+		}
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// validateTGT validates the client's postdated TGT session.
+func (cl *Client) validateTGT(ctx context.Context, s *session) error {
+	_, tgt, skey := s.tgtDetails()
+	_, _, err := cl.validateTicket(ctx, tgt, skey)
+	return err
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPostdatedSession replaces the client's session with one for a postdated TGT valid from the start time.
+func testPostdatedSession(cl *Client, skey types.EncryptionKey, start time.Time) {
+	f := types.NewKrbFlags()
+	types.SetFlags(&f, []int{flags.PostDated, flags.Invalid})
+	cl.sessions.update(newSession("TEST.GOKRB5", &sessionState{
+		authTime:  time.Now().UTC(),
+		startTime: start,
+		endTime:   start.Add(time.Hour),
+		tgt: messages.Ticket{
+			TktVNO:  iana.PVNO,
+			Realm:   "TEST.GOKRB5",
+			SName:   types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+			EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte{0}},
+		},
+		sessionKey: skey,
+		flags:      f,
+	}))
+}
+
+// testValidateExchange returns a context exchanging the client's TGS_REQs with a function recording whether each
+// requested validation.
+func testValidateExchange(t *testing.T, skey types.EncryptionKey, validates *[]bool) context.Context {
+	return WithKDCExchange(context.Background(), func(ctx context.Context, realm string, b []byte) ([]byte, error) {
+		var req messages.TGSReq
+		if err := req.Unmarshal(b); err != nil {
+			t.Errorf("KDC message is not a TGS_REQ: %v", err)
+			return nil, err
+		}
+		*validates = append(*validates, types.IsFlagSet(&req.ReqBody.KDCOptions, flags.Validate))
+		return testTGSRep(b, skey)
+	})
+}
+
+func TestClient_ValidateTicket(t *testing.T) {
+	t.Parallel()
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	cl := testTGSClient(t, "127.0.0.1:1", skey)
+	defer cl.Destroy()
+	testPostdatedSession(cl, skey, time.Now().UTC().Add(time.Hour))
+	var validates []bool
+	ctx := testValidateExchange(t, skey, &validates)
+
+	_, _, err := cl.GetServiceTicketContext(ctx, "HTTP/host.test.gokrb5")
+	assert.Equal(t, krberror.KindCredentials, krberror.ErrorKind(err), "postdated TGT should not be used before its start time: %v", err)
+	assert.Empty(t, validates, "no TGS_REQ should be sent before the start time")
+
+	_, tgt, key := func() (string, messages.Ticket, types.EncryptionKey) {
+		s, _ := cl.sessions.get("TEST.GOKRB5")
+		return s.tgtDetails()
+	}()
+	tkt, _, err := cl.ValidateTicket(ctx, tgt, key)
+	if err != nil {
+		t.Fatalf("error validating TGT: %v", err)
+	}
+	assert.Equal(t, []bool{true}, validates, "TGS_REQ should request validation")
+	assert.Equal(t, "krbtgt/TEST.GOKRB5", tkt.SName.PrincipalNameString(), "validated ticket not as expected")
+	s, _ := cl.sessions.get("TEST.GOKRB5")
+	st := s.snapshot()
+	assert.False(t, st.invalid(), "session should hold the validated TGT")
+	_, ok := cl.cachedEntry("krbtgt/TEST.GOKRB5")
+	assert.False(t, ok, "validated TGT should not be in the ticket store")
+}
+
+func TestClient_ValidateTicket_Session(t *testing.T) {
+	t.Parallel()
+	// The validated TGT has the session key of the test TGS_REPs.
+	skey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	cl := testTGSClient(t, "127.0.0.1:1", skey)
+	defer cl.Destroy()
+	testPostdatedSession(cl, skey, time.Now().UTC().Add(-time.Minute))
+	var validates []bool
+	ctx := testValidateExchange(t, skey, &validates)
+
+	_, _, err := cl.GetServiceTicketContext(ctx, "HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket with postdated TGT: %v", err)
+	}
+	assert.Equal(t, []bool{true, false}, validates, "postdated TGT should be validated before the service ticket is requested")
+}
+
+func TestClient_LoginWithOptions(t *testing.T) {
+	t.Parallel()
+	cl := testTGSClient(t, "127.0.0.1:1", types.EncryptionKey{})
+	defer cl.Destroy()
+	start := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	var req messages.ASReq
+	ctx := WithKDCExchange(context.Background(), func(ctx context.Context, realm string, b []byte) ([]byte, error) {
+		if err := req.Unmarshal(b); err != nil {
+			return nil, err
+		}
+		krberr := messages.NewKRBError(req.ReqBody.SName, realm, errorcode.KDC_ERR_BADOPTION, "postdating not permitted")
+		return krberr.Marshal()
+	})
+	err := cl.LoginWithOptions(ctx, TicketPostdated(start))
+	assert.True(t, errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_BADOPTION}), "KDC error should be returned: %v", err)
+	assert.True(t, types.IsFlagSet(&req.ReqBody.KDCOptions, flags.PostDated), "AS_REQ should request a postdated TGT")
+	assert.True(t, types.IsFlagSet(&req.ReqBody.KDCOptions, flags.AllowPostDate), "AS_REQ should allow postdating")
+	assert.True(t, start.Equal(req.ReqBody.From), "AS_REQ start time not as expected")
+}
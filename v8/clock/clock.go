@@ -0,0 +1,72 @@
+// Package clock provides the source of the current time used by gokrb5 so that the expiry, renewal and clock skew
+// behaviour of clients and services can be tested without sleeping.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the system clock.
+type realClock struct{}
+
+// Now returns the current time of the system clock.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Real is the system clock. It is the clock used if none is configured.
+var Real Clock = realClock{}
+
+// Func is an adapter to allow the use of ordinary functions as a Clock.
+type Func func() time.Time
+
+// Now calls f().
+func (f Func) Now() time.Time {
+	return f()
+}
+
+// OrReal returns the clock provided or Real if it is nil.
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+// Fake is a Clock for tests whose time only changes when it is set or advanced. It is safe for concurrent use.
+type Fake struct {
+	t   time.Time
+	mux sync.RWMutex
+}
+
+// NewFake returns a Fake clock set to the time provided.
+func NewFake(t time.Time) *Fake {
+	return &Fake{t: t}
+}
+
+// Now returns the time of the Fake clock.
+func (f *Fake) Now() time.Time {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	return f.t
+}
+
+// Set sets the time of the Fake clock.
+func (f *Fake) Set(t time.Time) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.t = t
+}
+
+// Advance moves the time of the Fake clock forward by the duration provided.
+func (f *Fake) Advance(d time.Duration) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.t = f.t.Add(d)
+}
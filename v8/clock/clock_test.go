@@ -0,0 +1,26 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	t.Parallel()
+	st := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(st)
+	assert.Equal(t, st, f.Now(), "fake time not as expected")
+	f.Advance(time.Hour)
+	assert.Equal(t, st.Add(time.Hour), f.Now(), "advanced time not as expected")
+	f.Set(st)
+	assert.Equal(t, st, f.Now(), "set time not as expected")
+}
+
+func TestOrReal(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, Real, OrReal(nil), "nil clock should default to the real clock")
+	f := Func(func() time.Time { return time.Unix(0, 0) })
+	assert.Equal(t, time.Unix(0, 0), OrReal(f).Now(), "clock provided should be returned")
+}
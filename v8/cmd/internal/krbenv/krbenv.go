@@ -0,0 +1,102 @@
+// Package krbenv resolves the Kerberos environment shared by the command line tools.
+package krbenv
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+const (
+	dirPrefix = "DIR:"
+	kcmPrefix = "KCM:"
+)
+
+// ErrNotCollection is returned by Collection if the credential cache name is not that of a DIR collection.
+var ErrNotCollection = errors.New("credential cache is not a DIR collection")
+
+// Config loads the krb5.conf files defined by the KRB5_CONFIG environment variable or the default location.
+func Config() (*config.Config, error) {
+	return config.LoadDefault()
+}
+
+// CCachePath returns the path of the file credential cache to use.
+// If the path is not provided the KRB5CCNAME environment variable or the default location is used.
+// For a DIR collection the path of its primary cache is returned.
+func CCachePath(p string) (string, error) {
+	return credentials.CCachePath(p)
+}
+
+// CCacheName returns the credential cache name, or that of the KRB5CCNAME environment variable or the default
+// location if it is not provided.
+func CCacheName(p string) string {
+	if p == "" {
+		return credentials.DefaultCCacheName()
+	}
+	return p
+}
+
+// KCMCache returns the name of the cache of the KCM daemon named and whether the name is of the KCM type. The name
+// returned is empty for the name KCM:, that of the user's default cache. If the name is not provided the KRB5CCNAME
+// environment variable or the default location is used.
+func KCMCache(p string) (string, bool) {
+	p = CCacheName(p)
+	if !strings.HasPrefix(p, kcmPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(p, kcmPrefix), true
+}
+
+// CheckCCacheName returns an error if the credential cache type of the name is not supported.
+func CheckCCacheName(p string) error {
+	if _, ok := KCMCache(p); ok {
+		return nil
+	}
+	_, err := CCachePath(p)
+	return err
+}
+
+// Collection returns the DIR credential cache collection named, or by the KRB5CCNAME environment variable if the
+// name is not provided. A name of the form DIR:directory names the collection while DIR::path names a specific cache
+// within it, in which case the path of the cache is also returned. ErrNotCollection is returned for other names.
+func Collection(p string) (*credentials.CCacheCollection, string, error) {
+	if p == "" {
+		p = os.Getenv("KRB5CCNAME")
+	}
+	if !strings.HasPrefix(p, dirPrefix) {
+		return nil, "", ErrNotCollection
+	}
+	p = strings.TrimPrefix(p, dirPrefix)
+	if strings.HasPrefix(p, ":") {
+		cpath := strings.TrimPrefix(p, ":")
+		return &credentials.CCacheCollection{Dir: filepath.Dir(cpath)}, cpath, nil
+	}
+	c, err := credentials.NewCCacheCollection(p)
+	return c, "", err
+}
+
+// KeytabPath returns the path of the keytab to use.
+// If the path is not provided the KRB5_KTNAME environment variable or the default location is used.
+func KeytabPath(p string) (string, error) {
+	if p == "" {
+		p = os.Getenv(keytab.KeytabEnvVar)
+	}
+	if p == "" {
+		return keytab.DefaultKeytabPath, nil
+	}
+	return keytab.Path(p)
+}
+
+// ParsePrincipal splits a principal of the form name@REALM.
+// If there is no realm component the default realm is returned.
+func ParsePrincipal(s, defaultRealm string) (string, string) {
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, defaultRealm
+}
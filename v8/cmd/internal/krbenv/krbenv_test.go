@@ -0,0 +1,82 @@
+package krbenv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCCachePath(t *testing.T) {
+	p, err := CCachePath("FILE:/tmp/krb5cc_test")
+	if err != nil {
+		t.Fatalf("error getting ccache path: %v", err)
+	}
+	assert.Equal(t, "/tmp/krb5cc_test", p, "ccache path not as expected")
+	p, err = CCachePath("/tmp/krb5cc_test")
+	if err != nil {
+		t.Fatalf("error getting ccache path: %v", err)
+	}
+	assert.Equal(t, "/tmp/krb5cc_test", p, "ccache path not as expected")
+	_, err = CCachePath("KEYRING:persistent:1000")
+	assert.Error(t, err, "expected error for unsupported ccache type")
+}
+
+func TestKCMCache(t *testing.T) {
+	name, ok := KCMCache("KCM:1000:1")
+	assert.True(t, ok, "KCM name should be recognised")
+	assert.Equal(t, "1000:1", name, "KCM cache name not as expected")
+	name, ok = KCMCache("KCM:")
+	assert.True(t, ok, "KCM name of the default cache should be recognised")
+	assert.Equal(t, "", name, "KCM default cache name should be empty")
+	_, ok = KCMCache("FILE:/tmp/krb5cc_test")
+	assert.False(t, ok, "file cache should not be a KCM cache")
+	assert.NoError(t, CheckCCacheName("KCM:"), "KCM cache names should be supported")
+	assert.NoError(t, CheckCCacheName("DIR::/tmp/tkt"), "DIR cache names should be supported")
+	assert.Error(t, CheckCCacheName("KEYRING:persistent:1000"), "expected error for unsupported ccache type")
+}
+
+func TestParsePrincipal(t *testing.T) {
+	n, r := ParsePrincipal("testuser1@TEST.GOKRB5", "OTHER")
+	assert.Equal(t, "testuser1", n, "name not as expected")
+	assert.Equal(t, "TEST.GOKRB5", r, "realm not as expected")
+	n, r = ParsePrincipal("HTTP/host.test.gokrb5", "TEST.GOKRB5")
+	assert.Equal(t, "HTTP/host.test.gokrb5", n, "name not as expected")
+	assert.Equal(t, "TEST.GOKRB5", r, "realm not as expected")
+}
+
+func TestCollection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gokrb5-krbenv")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	c, cpath, err := Collection("DIR:" + dir)
+	if err != nil {
+		t.Fatalf("error getting collection: %v", err)
+	}
+	assert.Equal(t, dir, c.Dir, "collection directory not as expected")
+	assert.Equal(t, "", cpath, "cache path should not be returned for a collection")
+	c, cpath, err = Collection("DIR::" + filepath.Join(dir, "tkt1"))
+	if err != nil {
+		t.Fatalf("error getting collection: %v", err)
+	}
+	assert.Equal(t, dir, c.Dir, "collection directory not as expected")
+	assert.Equal(t, filepath.Join(dir, "tkt1"), cpath, "cache path not as expected")
+	_, _, err = Collection("FILE:/tmp/krb5cc_test")
+	assert.Equal(t, ErrNotCollection, err, "error for a file cache not as expected")
+
+	// The primary cache of a collection is used.
+	p, err := CCachePath("DIR:" + dir)
+	if err != nil {
+		t.Fatalf("error getting ccache path: %v", err)
+	}
+	assert.Equal(t, filepath.Join(dir, "tkt"), p, "ccache path not as expected")
+	p, err = CCachePath("DIR::" + filepath.Join(dir, "tkt1"))
+	if err != nil {
+		t.Fatalf("error getting ccache path: %v", err)
+	}
+	assert.Equal(t, filepath.Join(dir, "tkt1"), p, "ccache path not as expected")
+}
@@ -0,0 +1,78 @@
+// Command kdestroy destroys a credential cache, overwriting the contents of a cache file before it is removed.
+//
+//	kdestroy [-q] [-c ccache]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/krbenv"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+)
+
+func main() {
+	quiet := flag.Bool("q", false, "do not print an error if there is no credential cache to destroy")
+	ccName := flag.String("c", "", "credential cache to destroy (default KRB5CCNAME or /tmp/krb5cc_<uid>)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-q] [-c ccache]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	var err error
+	if name, ok := krbenv.KCMCache(*ccName); ok {
+		err = destroyKCM(name)
+	} else {
+		var ccPath string
+		ccPath, err = krbenv.CCachePath(*ccName)
+		if err == nil {
+			err = destroy(ccPath)
+		}
+	}
+	if err != nil {
+		if (os.IsNotExist(err) || errors.Is(err, credentials.ErrKCMCacheNotFound)) && *quiet {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "kdestroy: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// destroy overwrites the credential cache file with zeros and then removes it.
+func destroy(ccPath string) error {
+	f, err := os.OpenFile(ccPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	_, err = f.Write(make([]byte, fi.Size()))
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("could not overwrite credential cache %s: %w", ccPath, err)
+	}
+	return os.Remove(ccPath)
+}
+
+// destroyKCM removes the cache from the KCM daemon, the user's default cache if the name is empty.
+func destroyKCM(name string) error {
+	k := credentials.NewKCM("")
+	if name == "" {
+		var err error
+		if name, err = k.DefaultCache(); err != nil {
+			return err
+		}
+	}
+	if err := k.Destroy(name); err != nil {
+		return fmt.Errorf("could not destroy KCM credential cache %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Command kinit obtains a TGT for a principal and stores it in a credential cache. With -s the TGT is postdated, valid
+// from the time given, and with -v the postdated TGT of the credential cache is validated once that time has passed.
+//
+//	kinit [-k [-t keytab]] [-s start] [-c ccache] [principal]
+//	kinit -v [-c ccache]
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/krbenv"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"golang.org/x/term"
+)
+
+func main() {
+	useKeytab := flag.Bool("k", false, "obtain the TGT using a key from the keytab")
+	ktName := flag.String("t", "", "keytab to use with -k (default KRB5_KTNAME or /etc/krb5.keytab)")
+	ccName := flag.String("c", "", "credential cache, DIR collection or KCM cache to write (default KRB5CCNAME or /tmp/krb5cc_<uid>)")
+	start := flag.Duration("s", 0, "request a postdated TGT valid from this long from now")
+	validate := flag.Bool("v", false, "validate the postdated TGT of the credential cache")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-k [-t keytab]] [-s start] [-c ccache] [principal]\n       %s -v [-c ccache]\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	var err error
+	if *validate {
+		err = runValidate(*ccName, flag.Args())
+	} else {
+		err = run(*useKeytab, *ktName, *ccName, *start, flag.Args())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kinit: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(useKeytab bool, ktName, ccName string, start time.Duration, args []string) error {
+	if len(args) > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg, err := krbenv.Config()
+	if err != nil {
+		return err
+	}
+	if err := krbenv.CheckCCacheName(ccName); err != nil {
+		return err
+	}
+	var princ string
+	if len(args) == 1 {
+		princ = args[0]
+	} else if u := os.Getenv("USER"); u != "" && !useKeytab {
+		princ = u
+	} else {
+		return fmt.Errorf("a principal must be specified")
+	}
+	name, realm := krbenv.ParsePrincipal(princ, cfg.LibDefaults.DefaultRealm)
+
+	var cl *client.Client
+	if useKeytab {
+		ktPath, err := krbenv.KeytabPath(ktName)
+		if err != nil {
+			return err
+		}
+		kt, err := keytab.Load(ktPath)
+		if err != nil {
+			return fmt.Errorf("could not load keytab %s: %w", ktPath, err)
+		}
+		cl = client.NewWithKeytab(name, realm, kt, cfg, client.DisablePAFXFAST(true))
+	} else {
+		fmt.Fprintf(os.Stderr, "Password for %s@%s: ", name, realm)
+		pw, err := readPassword()
+		if err != nil {
+			return err
+		}
+		cl = client.NewWithPassword(name, realm, pw, cfg, client.DisablePAFXFAST(true))
+	}
+	defer cl.Destroy()
+	if start > 0 {
+		err = cl.LoginWithOptions(context.Background(), client.TicketPostdated(time.Now().Add(start)))
+	} else {
+		err = cl.Login()
+	}
+	if err != nil {
+		return err
+	}
+	cc, err := cl.CCache()
+	if err != nil {
+		return err
+	}
+	// As with MIT kinit, the credentials are saved to the principal's cache in a DIR collection, which becomes the
+	// primary cache.
+	if coll, cpath, err := krbenv.Collection(ccName); err == nil && cpath == "" {
+		ccPath, err := coll.Save(cc)
+		if err != nil {
+			return err
+		}
+		return coll.SetPrimary(ccPath)
+	}
+	return credentials.SaveCCacheName(ccName, cc)
+}
+
+// runValidate validates the postdated TGT of the credential cache and writes the valid TGT back to it.
+func runValidate(ccName string, args []string) error {
+	if len(args) > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cfg, err := krbenv.Config()
+	if err != nil {
+		return err
+	}
+	if err := krbenv.CheckCCacheName(ccName); err != nil {
+		return err
+	}
+	ccName = krbenv.CCacheName(ccName)
+	cc, err := credentials.LoadCCacheName(ccName)
+	if err != nil {
+		return fmt.Errorf("could not load credential cache %s: %w", ccName, err)
+	}
+	realm := cc.GetClientRealm()
+	cred, ok := cc.GetEntry(types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", realm},
+	})
+	if !ok {
+		return fmt.Errorf("no TGT for realm %s in cache %s", realm, ccName)
+	}
+	cl, err := client.NewFromCCache(cc, cfg, client.DisablePAFXFAST(true))
+	if err != nil {
+		return err
+	}
+	defer cl.Destroy()
+	var tgt messages.Ticket
+	if err := tgt.Unmarshal(cred.Ticket); err != nil {
+		return fmt.Errorf("TGT bytes in cache are not valid: %w", err)
+	}
+	if _, _, err := cl.ValidateTicket(context.Background(), tgt, cred.Key); err != nil {
+		return err
+	}
+	c, err := cl.CCache()
+	if err != nil {
+		return err
+	}
+	return credentials.SaveCCacheName(ccName, c)
+}
+
+// readPassword reads the password from standard input, without echoing it if standard input is a terminal. Piped
+// input is read up to the end of its first line.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("could not read password: %w", err)
+		}
+		return string(b), nil
+	}
+	pw, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && pw == "" {
+		return "", fmt.Errorf("could not read password: %w", err)
+	}
+	return strings.TrimRight(pw, "\r\n"), nil
+}
@@ -0,0 +1,179 @@
+// Command klist lists the credentials held in a credential cache or the entries of a keytab.
+//
+//	klist [-e] [-c ccache]
+//	klist -l [-c ccache]
+//	klist -k [-t] [-e] [keytab]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/krbenv"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+const timeFormat = "01/02/06 15:04:05"
+
+func main() {
+	listKeytab := flag.Bool("k", false, "list the entries of a keytab rather than a credential cache")
+	listCaches := flag.Bool("l", false, "list the credential caches of a DIR collection or of the KCM daemon")
+	showTime := flag.Bool("t", false, "show keytab entry timestamps")
+	showEType := flag.Bool("e", false, "show encryption types")
+	ccName := flag.String("c", "", "credential cache to list (default KRB5CCNAME or /tmp/krb5cc_<uid>)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-e] [-c ccache]\n       %s -l [-c ccache]\n       %s -k [-t] [-e] [keytab]\n",
+			os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	var err error
+	if *listKeytab {
+		err = listKT(os.Stdout, flag.Arg(0), *showTime, *showEType)
+	} else {
+		ccPath := *ccName
+		if ccPath == "" {
+			ccPath = flag.Arg(0)
+		}
+		if *listCaches {
+			err = listCollection(os.Stdout, ccPath)
+		} else {
+			err = listCCache(os.Stdout, ccPath, *showEType)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "klist: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadCCache loads the credential cache named and returns it with its name of the FILE or KCM type.
+func loadCCache(ccName string) (*credentials.CCache, string, error) {
+	if name, ok := krbenv.KCMCache(ccName); ok {
+		k := credentials.NewKCM("")
+		if name == "" {
+			var err error
+			if name, err = k.DefaultCache(); err != nil {
+				return nil, "", err
+			}
+		}
+		cc, err := k.Load(name)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not load KCM credential cache %s: %w", name, err)
+		}
+		return cc, "KCM:" + name, nil
+	}
+	ccPath, err := krbenv.CCachePath(ccName)
+	if err != nil {
+		return nil, "", err
+	}
+	cc, err := credentials.LoadCCache(ccPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not load credential cache %s: %w", ccPath, err)
+	}
+	return cc, "FILE:" + ccPath, nil
+}
+
+func listCCache(w io.Writer, ccName string, showEType bool) error {
+	cc, name, err := loadCCache(ccName)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Ticket cache: %s\n", name)
+	fmt.Fprintf(w, "Default principal: %s@%s\n\n", cc.GetClientPrincipalName().PrincipalNameString(), cc.GetClientRealm())
+	fmt.Fprintf(w, "%-19s  %-19s  %s\n", "Valid starting", "Expires", "Service principal")
+	now := time.Now()
+	for _, cred := range cc.GetEntries() {
+		start := cred.StartTime
+		if start.Unix() == 0 {
+			start = cred.AuthTime
+		}
+		fmt.Fprintf(w, "%-19s  %-19s  %s@%s", start.Local().Format(timeFormat), cred.EndTime.Local().Format(timeFormat),
+			cred.Server.PrincipalName.PrincipalNameString(), cred.Server.Realm)
+		if now.After(cred.EndTime) {
+			fmt.Fprint(w, " (expired)")
+		}
+		fmt.Fprintln(w)
+		if cred.RenewTill.Unix() > 0 {
+			fmt.Fprintf(w, "\trenew until %s\n", cred.RenewTill.Local().Format(timeFormat))
+		}
+		if showEType {
+			fmt.Fprintf(w, "\tEtype (skey): %s\n", etypeID.Name(cred.Key.KeyType))
+		}
+	}
+	return nil
+}
+
+// listCollection lists the default principal of each credential cache of the DIR collection or KCM daemon named, or
+// of the credential cache if the name is of another type, as klist -l does.
+func listCollection(w io.Writer, ccName string) error {
+	fmt.Fprintf(w, "%-30s %s\n", "Principal name", "Cache name")
+	fmt.Fprintf(w, "%-30s %s\n", "--------------", "----------")
+	var caches []string
+	if _, ok := krbenv.KCMCache(ccName); ok {
+		names, err := credentials.NewKCM("").Caches()
+		if err != nil {
+			return err
+		}
+		for _, n := range names {
+			caches = append(caches, "KCM:"+n)
+		}
+	} else if coll, _, err := krbenv.Collection(ccName); err == nil {
+		paths, err := coll.Caches()
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			caches = append(caches, "DIR::"+p)
+		}
+	} else {
+		caches = []string{krbenv.CCacheName(ccName)}
+	}
+	for _, name := range caches {
+		cc, err := credentials.LoadCCacheName(name)
+		if err != nil {
+			// Caches that have not been initialized have no principal.
+			continue
+		}
+		fmt.Fprintf(w, "%-30s %s\n", cc.GetClientPrincipalName().PrincipalNameString()+"@"+cc.GetClientRealm(), name)
+	}
+	return nil
+}
+
+func listKT(w io.Writer, ktName string, showTime, showEType bool) error {
+	ktPath, err := krbenv.KeytabPath(ktName)
+	if err != nil {
+		return err
+	}
+	kt, err := keytab.Load(ktPath)
+	if err != nil {
+		return fmt.Errorf("could not load keytab %s: %w", ktPath, err)
+	}
+	fmt.Fprintf(w, "Keytab name: FILE:%s\n", ktPath)
+	if showTime {
+		fmt.Fprintf(w, "KVNO %-19s Principal\n", "Timestamp")
+		fmt.Fprintf(w, "---- %s %s\n", strings.Repeat("-", 19), strings.Repeat("-", 56))
+	} else {
+		fmt.Fprintln(w, "KVNO Principal")
+		fmt.Fprintf(w, "---- %s\n", strings.Repeat("-", 76))
+	}
+	kt.Range(func(e keytab.Entry) bool {
+		fmt.Fprintf(w, "%4d ", e.KVNO)
+		if showTime {
+			fmt.Fprintf(w, "%-19s ", e.Timestamp.Local().Format(timeFormat))
+		}
+		fmt.Fprint(w, e.PrincipalString())
+		if showEType {
+			fmt.Fprintf(w, " (%s)", etypeID.Name(e.Key.KeyType))
+		}
+		fmt.Fprintln(w)
+		return true
+	})
+	return nil
+}
@@ -0,0 +1,90 @@
+// Command krbdecode decodes raw Kerberos 5 and SPNEGO messages into annotated JSON.
+//
+// Messages can be given as hex or base64 encoded arguments, one per line on stdin, or read as raw bytes from a file
+// such as a payload exported from a packet capture. The -http flag decodes arguments as HTTP Negotiate header values.
+//
+//	krbdecode [-http] [message ...]
+//	krbdecode -f payload.bin
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/inspect"
+)
+
+func main() {
+	file := flag.String("f", "", "file containing a raw message (- for stdin)")
+	http := flag.Bool("http", false, "decode messages as HTTP Authorization or WWW-Authenticate header values")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-http] [message ...]\n       %s -f file\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := run(*file, *http, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "krbdecode: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(file string, http bool, args []string) error {
+	if file != "" {
+		var b []byte
+		var err error
+		if file == "-" {
+			b, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			b, err = ioutil.ReadFile(file)
+		}
+		if err != nil {
+			return err
+		}
+		m, err := inspect.Decode(b)
+		if err != nil {
+			return err
+		}
+		return output(m)
+	}
+	if len(args) < 1 {
+		s := bufio.NewScanner(os.Stdin)
+		s.Buffer(nil, 1<<20)
+		for s.Scan() {
+			if l := strings.TrimSpace(s.Text()); l != "" {
+				args = append(args, l)
+			}
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+	for _, a := range args {
+		var m *inspect.Message
+		var err error
+		if http {
+			m, err = inspect.DecodeHTTPHeader(a)
+		} else {
+			m, err = inspect.DecodeString(a)
+		}
+		if err != nil {
+			return err
+		}
+		if err := output(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func output(m *inspect.Message) error {
+	b, err := m.JSON()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,68 @@
+// Command kswitch makes a credential cache of a DIR collection the primary cache, switching the default identity
+// used by other Kerberos tools.
+//
+//	kswitch -c cache_name
+//	kswitch -p principal
+//
+// The collection is that named by KRB5CCNAME, of the form DIR:directory, unless the cache name given is of the form
+// DIR::path.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/krbenv"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+func main() {
+	ccName := flag.String("c", "", "credential cache to make primary, as DIR::path or a path within the collection")
+	princ := flag.String("p", "", "principal whose credential cache to make primary")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s {-c cache_name | -p principal}\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if (*ccName == "") == (*princ == "") || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*ccName, *princ); err != nil {
+		fmt.Fprintf(os.Stderr, "kswitch: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ccName, princ string) error {
+	if ccName != "" {
+		if strings.HasPrefix(ccName, "DIR::") {
+			coll, cpath, err := krbenv.Collection(ccName)
+			if err != nil {
+				return err
+			}
+			return coll.SetPrimary(cpath)
+		}
+		coll, _, err := krbenv.Collection("")
+		if err != nil {
+			return fmt.Errorf("KRB5CCNAME: %w", err)
+		}
+		return coll.SetPrimary(strings.TrimPrefix(ccName, "FILE:"))
+	}
+	coll, _, err := krbenv.Collection("")
+	if err != nil {
+		return fmt.Errorf("KRB5CCNAME: %w", err)
+	}
+	name, realm := krbenv.ParsePrincipal(princ, "")
+	if realm == "" {
+		cfg, err := krbenv.Config()
+		if err != nil {
+			return err
+		}
+		realm = cfg.LibDefaults.DefaultRealm
+	}
+	return coll.Switch(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, name), realm)
+}
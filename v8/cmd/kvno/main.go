@@ -0,0 +1,74 @@
+// Command kvno obtains service tickets for the principals specified and prints their key version numbers.
+// The service tickets are added to the credential cache.
+//
+//	kvno [-c ccache] service1 service2 ...
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/cmd/internal/krbenv"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+)
+
+func main() {
+	ccName := flag.String("c", "", "credential cache to use (default KRB5CCNAME or /tmp/krb5cc_<uid>)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-c ccache] service1 service2 ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*ccName, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "kvno: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ccName string, spns []string) error {
+	cfg, err := krbenv.Config()
+	if err != nil {
+		return err
+	}
+	ccName = krbenv.CCacheName(ccName)
+	cc, err := credentials.LoadCCacheName(ccName)
+	if err != nil {
+		return fmt.Errorf("could not load credential cache %s: %w", ccName, err)
+	}
+	cl, err := client.NewFromCCache(cc, cfg, client.DisablePAFXFAST(true))
+	if err != nil {
+		return err
+	}
+	defer cl.Destroy()
+	var failed bool
+	for _, s := range spns {
+		// The realm of the service is resolved from the krb5.conf domain_realm mappings.
+		spn, _ := krbenv.ParsePrincipal(s, "")
+		tkt, _, err := cl.GetServiceTicket(spn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "kvno: %s: %v\n", s, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s@%s: kvno = %d\n", tkt.SName.PrincipalNameString(), tkt.Realm, tkt.EncPart.KVNO)
+	}
+	c, err := cl.CCache()
+	if err != nil {
+		return err
+	}
+	err = credentials.SaveCCacheName(ccName, c)
+	if err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("could not obtain all the service tickets requested")
+	}
+	return nil
+}
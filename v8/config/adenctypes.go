@@ -0,0 +1,121 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+)
+
+// ADSupportedEncTypes is the value of an Active Directory account's msDS-SupportedEncryptionTypes attribute.
+// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kile/6cfc7b50-11ed-4b4d-846d-6f08f0812919
+type ADSupportedEncTypes uint32
+
+// msDS-SupportedEncryptionTypes flags.
+const (
+	ADEncTypeDESCBCCRC         ADSupportedEncTypes = 0x00000001
+	ADEncTypeDESCBCMD5         ADSupportedEncTypes = 0x00000002
+	ADEncTypeRC4HMAC           ADSupportedEncTypes = 0x00000004
+	ADEncTypeAES128CTSHMACSHA1 ADSupportedEncTypes = 0x00000008
+	ADEncTypeAES256CTSHMACSHA1 ADSupportedEncTypes = 0x00000010
+	// ADEncTypeAES256SessionKey indicates AES256 session keys are supported even if the account's keys are not AES.
+	ADEncTypeAES256SessionKey ADSupportedEncTypes = 0x00000020
+	// ADDefaultSupportedEncTypes is the DefaultDomainSupportedEncTypes used by domain controllers for accounts
+	// without the msDS-SupportedEncryptionTypes attribute set.
+	ADDefaultSupportedEncTypes = ADEncTypeDESCBCCRC | ADEncTypeDESCBCMD5 | ADEncTypeRC4HMAC | ADEncTypeAES256SessionKey
+)
+
+// ETypeIDs returns the IDs of the encryption types the account has keys for, strongest first.
+// A value of zero is treated as ADDefaultSupportedEncTypes.
+func (s ADSupportedEncTypes) ETypeIDs() []int32 {
+	s = s.orDefault()
+	var ids []int32
+	if s&ADEncTypeAES256CTSHMACSHA1 != 0 {
+		ids = append(ids, etypeID.AES256_CTS_HMAC_SHA1_96)
+	}
+	if s&ADEncTypeAES128CTSHMACSHA1 != 0 {
+		ids = append(ids, etypeID.AES128_CTS_HMAC_SHA1_96)
+	}
+	if s&ADEncTypeRC4HMAC != 0 {
+		ids = append(ids, etypeID.RC4_HMAC)
+	}
+	if s&ADEncTypeDESCBCMD5 != 0 {
+		ids = append(ids, etypeID.DES_CBC_MD5)
+	}
+	if s&ADEncTypeDESCBCCRC != 0 {
+		ids = append(ids, etypeID.DES_CBC_CRC)
+	}
+	return ids
+}
+
+// SessionKeyETypeIDs returns the IDs of the encryption types the KDC may select for session keys of tickets
+// issued for the account, strongest first.
+func (s ADSupportedEncTypes) SessionKeyETypeIDs() []int32 {
+	s = s.orDefault()
+	ids := s.ETypeIDs()
+	if s&ADEncTypeAES256SessionKey != 0 && s&ADEncTypeAES256CTSHMACSHA1 == 0 {
+		ids = append([]int32{etypeID.AES256_CTS_HMAC_SHA1_96}, ids...)
+	}
+	return ids
+}
+
+// Restrict returns the encryption types from those offered that can be used for the session key of a ticket
+// for the account, in the order offered.
+//
+// If there is no encryption type in common an error is returned explaining the mismatch and how it may be resolved.
+// The result can be used as the etypes of a TGS_REQ for the account, for example:
+//
+//	ids, err := config.ADSupportedEncTypes(v).Restrict(cfg.LibDefaults.DefaultTGSEnctypeIDs)
+func (s ADSupportedEncTypes) Restrict(offered []int32) ([]int32, error) {
+	supported := s.SessionKeyETypeIDs()
+	var ids []int32
+	for _, o := range offered {
+		for _, id := range supported {
+			if o == id {
+				ids = append(ids, o)
+				break
+			}
+		}
+	}
+	if len(ids) > 0 {
+		return ids, nil
+	}
+	msg := fmt.Sprintf("no common encryption type: offered [%s], account supports [%s] (msDS-SupportedEncryptionTypes 0x%x)",
+		etypeNames(offered), etypeNames(supported), uint32(s))
+	switch {
+	case s.orDefault()&(ADEncTypeAES128CTSHMACSHA1|ADEncTypeAES256CTSHMACSHA1|ADEncTypeAES256SessionKey) == 0:
+		msg += "; the account does not support AES: enable AES for the account (msDS-SupportedEncryptionTypes 0x18) " +
+			"or permit arcfour-hmac in default_tgs_enctypes"
+	case !containsETypeID(offered, etypeID.AES256_CTS_HMAC_SHA1_96) && !containsETypeID(offered, etypeID.AES128_CTS_HMAC_SHA1_96):
+		// Active Directory does not support the RFC 8009 AES encryption types.
+		msg += "; add aes256-cts-hmac-sha1-96 to default_tgs_enctypes"
+	default:
+		msg += "; ensure the encryption types supported by the account are in default_tgs_enctypes"
+	}
+	return ids, errors.New(msg)
+}
+
+func (s ADSupportedEncTypes) orDefault() ADSupportedEncTypes {
+	if s == 0 {
+		return ADDefaultSupportedEncTypes
+	}
+	return s
+}
+
+func etypeNames(ids []int32) string {
+	n := make([]string, len(ids))
+	for i, id := range ids {
+		n[i] = etypeID.Name(id)
+	}
+	return strings.Join(n, " ")
+}
+
+func containsETypeID(ids []int32, id int32) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
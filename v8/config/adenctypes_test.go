@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestADSupportedEncTypes_ETypeIDs(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96},
+		ADSupportedEncTypes(0x18).ETypeIDs(), "etype IDs not as expected")
+	assert.Equal(t, []int32{etypeID.RC4_HMAC, etypeID.DES_CBC_MD5, etypeID.DES_CBC_CRC},
+		ADSupportedEncTypes(0).ETypeIDs(), "default etype IDs not as expected")
+	assert.Equal(t, []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC},
+		ADSupportedEncTypes(0x24).SessionKeyETypeIDs(), "session key etype IDs not as expected")
+}
+
+func TestADSupportedEncTypes_Restrict(t *testing.T) {
+	t.Parallel()
+	offered := []int32{etypeID.AES256_CTS_HMAC_SHA384_192, etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC}
+
+	ids, err := ADSupportedEncTypes(0x1c).Restrict(offered)
+	if err != nil {
+		t.Fatalf("error restricting etypes: %v", err)
+	}
+	assert.Equal(t, []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC}, ids, "restricted etypes not as expected")
+
+	ids, err = ADSupportedEncTypes(0x04).Restrict(offered)
+	if err != nil {
+		t.Fatalf("error restricting etypes: %v", err)
+	}
+	assert.Equal(t, []int32{etypeID.RC4_HMAC}, ids, "restricted etypes not as expected")
+
+	// RC4 only account with RC4 not permitted
+	_, err = ADSupportedEncTypes(0x04).Restrict(offered[:3])
+	if assert.Error(t, err, "expected error for RC4 only account") {
+		assert.Contains(t, err.Error(), "does not support AES", "error explanation not as expected")
+	}
+
+	// AES only account with only RC4 offered
+	_, err = ADSupportedEncTypes(0x18).Restrict([]int32{etypeID.RC4_HMAC})
+	if assert.Error(t, err, "expected error for AES only account") {
+		assert.Contains(t, err.Error(), "add aes256-cts-hmac-sha1-96", "error explanation not as expected")
+		assert.Contains(t, err.Error(), "offered [arcfour-hmac]", "error explanation not as expected")
+	}
+}
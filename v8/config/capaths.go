@@ -0,0 +1,106 @@
+package config
+
+import (
+	"strings"
+)
+
+// CAPaths represents the [capaths] section of the configuration. It maps a client realm and a server realm to the
+// intermediate realms, in the order they are traversed, of the cross-realm authentication path between them. A path
+// with no intermediate realms, given as "." in the configuration, means the realms share a direct trust.
+type CAPaths map[string]map[string][]string
+
+// Parse the lines of the [capaths] section of the configuration and add to the paths.
+func (p *CAPaths) parseLines(lines []string) error {
+	var client string
+	for _, line := range lines {
+		//Remove comments after the values
+		if idx := strings.IndexAny(line, "#;"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line == "}" {
+			if client == "" {
+				return InvalidErrorf("unpaired curly brackets")
+			}
+			client = ""
+			continue
+		}
+		if !strings.Contains(line, "=") {
+			return InvalidErrorf("capaths section line (%s)", line)
+		}
+		s := strings.SplitN(line, "=", 2)
+		k := strings.TrimSpace(s[0])
+		v := strings.TrimSpace(s[1])
+		if v == "{" {
+			if client != "" {
+				return InvalidErrorf("capaths nested deeper than a client realm (%s)", line)
+			}
+			client = k
+			if (*p)[client] == nil {
+				(*p)[client] = make(map[string][]string)
+			}
+			continue
+		}
+		if client == "" {
+			return InvalidErrorf("capaths line not within a client realm (%s)", line)
+		}
+		path := (*p)[client][k]
+		for _, r := range strings.Fields(v) {
+			if r != "." {
+				path = append(path, r)
+			}
+		}
+		if path == nil {
+			path = []string{}
+		}
+		(*p)[client][k] = path
+	}
+	if client != "" {
+		return InvalidErrorf("unpaired curly brackets")
+	}
+	return nil
+}
+
+// CAPath returns the realms traversed to authenticate a client of the client realm to a service of the server realm,
+// starting with the client realm and ending with the server realm. The path is taken from the [capaths] section of the
+// configuration if it has one for the realms, otherwise it is the hierarchical path, RFC 4120 section 1.2, up the
+// client realm's domain hierarchy to the realm that is common to both and then down to the server realm. For example
+// the path from A.EXAMPLE.COM to B.EXAMPLE.COM is A.EXAMPLE.COM, EXAMPLE.COM, B.EXAMPLE.COM.
+func (c *Config) CAPath(client, server string) []string {
+	if client == server {
+		return []string{client}
+	}
+	if p, ok := c.CAPaths[client][server]; ok {
+		path := append([]string{client}, p...)
+		return append(path, server)
+	}
+	return hierarchicalPath(client, server)
+}
+
+// hierarchicalPath returns the path between the realms through their common ancestor in the domain hierarchy. If they
+// have none, the path is up to the root of the client realm's hierarchy and down from the root of the server realm's.
+func hierarchicalPath(client, server string) []string {
+	cp := strings.Split(client, ".")
+	sp := strings.Split(server, ".")
+	// The number of trailing components common to both realms.
+	var n int
+	for n < len(cp) && n < len(sp) && cp[len(cp)-1-n] == sp[len(sp)-1-n] {
+		n++
+	}
+	var path []string
+	// The client realm and its ancestors below the common ancestor.
+	for i := 0; i < len(cp)-n; i++ {
+		path = append(path, strings.Join(cp[i:], "."))
+	}
+	if n > 0 {
+		path = append(path, strings.Join(cp[len(cp)-n:], "."))
+	}
+	// The ancestors of the server realm below the common ancestor and the server realm.
+	for i := len(sp) - n - 1; i >= 0; i-- {
+		path = append(path, strings.Join(sp[i:], "."))
+	}
+	return path
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const capathsConf = `
+[libdefaults]
+ default_realm = ANL.GOV
+
+[capaths]
+ ANL.GOV = {
+   TEST.ANL.GOV = .
+   PNL.GOV = ES.NET
+   NERSC.GOV = ES.NET
+   DOE.GOV = ES.NET ; comment to be ignored
+   FAR.ORG = ES.NET
+   FAR.ORG = INTER.ORG
+ }
+ TEST.ANL.GOV = {
+   PNL.GOV = ANL.GOV ES.NET
+ }
+`
+
+func TestLoadCAPaths(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(capathsConf)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	assert.Equal(t, []string{}, c.CAPaths["ANL.GOV"]["TEST.ANL.GOV"], "direct path not as expected")
+	assert.Equal(t, []string{"ES.NET"}, c.CAPaths["ANL.GOV"]["DOE.GOV"], "path not as expected")
+	assert.Equal(t, []string{"ES.NET", "INTER.ORG"}, c.CAPaths["ANL.GOV"]["FAR.ORG"], "path over several lines not as expected")
+	assert.Equal(t, []string{"ANL.GOV", "ES.NET"}, c.CAPaths["TEST.ANL.GOV"]["PNL.GOV"], "path on one line not as expected")
+}
+
+func TestLoadCAPaths_Invalid(t *testing.T) {
+	t.Parallel()
+	for _, s := range []string{
+		"[capaths]\n PNL.GOV = ES.NET\n",
+		"[capaths]\n ANL.GOV = {\n PNL.GOV = ES.NET\n",
+		"[capaths]\n ANL.GOV = {\n PNL.GOV = {\n }\n }\n",
+		"[capaths]\n }\n",
+	} {
+		_, err := NewFromString(s)
+		assert.Error(t, err, "invalid capaths should not be loaded: %s", s)
+	}
+}
+
+func TestConfig_CAPath(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(capathsConf)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	var tests = []struct {
+		client string
+		server string
+		want   []string
+	}{
+		{"ANL.GOV", "ANL.GOV", []string{"ANL.GOV"}},
+		{"ANL.GOV", "TEST.ANL.GOV", []string{"ANL.GOV", "TEST.ANL.GOV"}},
+		{"ANL.GOV", "FAR.ORG", []string{"ANL.GOV", "ES.NET", "INTER.ORG", "FAR.ORG"}},
+		{"TEST.ANL.GOV", "PNL.GOV", []string{"TEST.ANL.GOV", "ANL.GOV", "ES.NET", "PNL.GOV"}},
+		// Hierarchical paths for realms without capaths.
+		{"A.EXAMPLE.COM", "B.EXAMPLE.COM", []string{"A.EXAMPLE.COM", "EXAMPLE.COM", "B.EXAMPLE.COM"}},
+		{"A.B.EXAMPLE.COM", "C.EXAMPLE.COM", []string{"A.B.EXAMPLE.COM", "B.EXAMPLE.COM", "EXAMPLE.COM", "C.EXAMPLE.COM"}},
+		{"EXAMPLE.COM", "A.B.EXAMPLE.COM", []string{"EXAMPLE.COM", "B.EXAMPLE.COM", "A.B.EXAMPLE.COM"}},
+		{"A.B.EXAMPLE.COM", "EXAMPLE.COM", []string{"A.B.EXAMPLE.COM", "B.EXAMPLE.COM", "EXAMPLE.COM"}},
+		{"EXAMPLE.COM", "EXAMPLE.ORG", []string{"EXAMPLE.COM", "COM", "ORG", "EXAMPLE.ORG"}},
+		{"TEST", "OTHER", []string{"TEST", "OTHER"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, c.CAPath(test.client, test.server), "path from %s to %s not as expected", test.client, test.server)
+	}
+}
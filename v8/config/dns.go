@@ -0,0 +1,162 @@
+package config
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Resolver performs the DNS lookups of the configuration: the SRV records of the KDCs and kpasswd servers of realms,
+// with dns_lookup_kdc, and the TXT records of the realms of hosts, with dns_lookup_realm. *net.Resolver implements it,
+// so that the lookups can be directed at a specific DNS server.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// dnsLookup holds the resolver of a configuration and its cache of SRV records.
+type dnsLookup struct {
+	mux      sync.Mutex
+	resolver Resolver
+	ttl      time.Duration
+	srv      map[string]srvEntry
+}
+
+// srvEntry is a cached SRV lookup result.
+type srvEntry struct {
+	addrs   []*net.SRV
+	expires time.Time
+}
+
+// SetResolver sets the resolver used for the DNS lookups of the configuration instead of the default resolver.
+// Cached SRV records are discarded.
+func (c *Config) SetResolver(r Resolver) {
+	if c.dns == nil {
+		c.dns = new(dnsLookup)
+	}
+	d := c.dns
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.resolver = r
+	d.srv = nil
+}
+
+// SetSRVCacheTTL sets how long the SRV records of KDCs and kpasswd servers looked up are cached for, so that they are
+// not looked up again for each exchange. Each lookup result is kept for the duration given, as the TTLs of the records
+// are not available from the resolver. The default of zero disables caching.
+func (c *Config) SetSRVCacheTTL(d time.Duration) {
+	if c.dns == nil {
+		c.dns = new(dnsLookup)
+	}
+	l := c.dns
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.ttl = d
+	l.srv = nil
+}
+
+// dnsLookup returns the DNS lookup state of the configuration. Configurations not created with New, and without a
+// resolver or SRV cache TTL set, look up DNS records with the default resolver and do not cache them.
+func (c *Config) dnsLookup() *dnsLookup {
+	if c.dns == nil {
+		return new(dnsLookup)
+	}
+	return c.dns
+}
+
+// lookupSRV returns the count of the SRV records of the service and a map of them keyed on the order they should be
+// used in, from 1, based on their priority and a random selection weighted by their weight, RFC 2782.
+func (c *Config) lookupSRV(service, proto, name string) (int, map[int]*net.SRV, error) {
+	addrs, err := c.dnsLookup().lookupSRV(service, proto, name)
+	if err != nil {
+		return 0, make(map[int]*net.SRV), err
+	}
+	n, osrv := orderSRV(addrs)
+	return n, osrv, nil
+}
+
+// lookupSRV returns the SRV records of the service, from the cache if they have been looked up within the TTL.
+func (d *dnsLookup) lookupSRV(service, proto, name string) ([]*net.SRV, error) {
+	d.mux.Lock()
+	r, ttl := d.resolver, d.ttl
+	key := service + "/" + proto + "/" + name
+	if e, ok := d.srv[key]; ok && time.Now().Before(e.expires) {
+		d.mux.Unlock()
+		return e.addrs, nil
+	}
+	d.mux.Unlock()
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	_, addrs, err := r.LookupSRV(context.Background(), service, proto, name)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		d.mux.Lock()
+		if d.srv == nil {
+			d.srv = make(map[string]srvEntry)
+		}
+		d.srv[key] = srvEntry{addrs: addrs, expires: time.Now().Add(ttl)}
+		d.mux.Unlock()
+	}
+	return addrs, nil
+}
+
+// lookupTXT returns the TXT records of the name.
+func (d *dnsLookup) lookupTXT(name string) ([]string, error) {
+	d.mux.Lock()
+	r := d.resolver
+	d.mux.Unlock()
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return r.LookupTXT(context.Background(), name)
+}
+
+// orderSRV orders the SRV records by priority and, within a priority, by a random selection weighted by their weight.
+func orderSRV(addrs []*net.SRV) (int, map[int]*net.SRV) {
+	prio := make(map[uint16][]*net.SRV)
+	var priorities []int
+	for _, srv := range addrs {
+		if _, ok := prio[srv.Priority]; !ok {
+			priorities = append(priorities, int(srv.Priority))
+		}
+		prio[srv.Priority] = append(prio[srv.Priority], srv)
+	}
+	sort.Ints(priorities)
+	osrv := make(map[int]*net.SRV)
+	i := 1
+	for _, p := range priorities {
+		// Copy the records, which may be those cached, before removing them as they are selected.
+		srvs := append([]*net.SRV(nil), prio[uint16(p)]...)
+		var tw int
+		for _, s := range srvs {
+			tw += int(s.Weight)
+		}
+		for len(srvs) > 0 {
+			n := 0
+			if tw > 0 {
+				// Select the first record whose running sum of weights reaches a random number, RFC 2782.
+				rw := rand.Intn(tw + 1)
+				var sum int
+				for n = range srvs {
+					sum += int(srvs[n].Weight)
+					if sum >= rw {
+						break
+					}
+				}
+			} else {
+				n = rand.Intn(len(srvs))
+			}
+			osrv[i] = srvs[n]
+			i++
+			tw -= int(srvs[n].Weight)
+			srvs = append(srvs[:n], srvs[n+1:]...)
+		}
+	}
+	return len(osrv), osrv
+}
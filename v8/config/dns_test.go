@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testResolver answers DNS lookups from its records and records the names looked up.
+type testResolver struct {
+	srv     map[string][]*net.SRV
+	txt     map[string][]string
+	lookups []string
+}
+
+func (r *testResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	n := "_" + service + "._" + proto + "." + name
+	r.lookups = append(r.lookups, n)
+	if addrs, ok := r.srv[n]; ok {
+		return n, addrs, nil
+	}
+	return "", nil, errors.New("no such host")
+}
+
+func (r *testResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.lookups = append(r.lookups, name)
+	if txt, ok := r.txt[name]; ok {
+		return txt, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestConfig_SetResolver(t *testing.T) {
+	t.Parallel()
+	r := &testResolver{srv: map[string][]*net.SRV{
+		"_kerberos._tcp.TEST.GOKRB5": {
+			{Target: "kdc2.test.gokrb5.", Port: 88, Priority: 2},
+			{Target: "kdc1.test.gokrb5.", Port: 88, Priority: 1},
+		},
+		"_kpasswd._udp.TEST.GOKRB5": {{Target: "kpasswd.test.gokrb5.", Port: 464}},
+	}}
+	c, err := NewFromString("[libdefaults]\n dns_lookup_kdc = true\n")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	c.SetResolver(r)
+
+	n, kdcs, err := c.GetKDCs("TEST.GOKRB5", true)
+	if err != nil {
+		t.Fatalf("error getting KDCs: %v", err)
+	}
+	assert.Equal(t, 2, n, "number of KDCs not as expected")
+	assert.Equal(t, map[int]string{1: "kdc1.test.gokrb5:88", 2: "kdc2.test.gokrb5:88"}, kdcs, "KDCs not in the order of their priority")
+	n, kdcs, err = c.GetKpasswdServers("TEST.GOKRB5", false)
+	if err != nil {
+		t.Fatalf("error getting kpasswd servers: %v", err)
+	}
+	assert.Equal(t, map[int]string{1: "kpasswd.test.gokrb5:464"}, kdcs, "kpasswd servers not as expected")
+	assert.Equal(t, []string{"_kerberos._tcp.TEST.GOKRB5", "_kpasswd._udp.TEST.GOKRB5"}, r.lookups,
+		"lookups not made with the resolver set")
+
+	// Without a cache TTL each call looks the records up again.
+	r.lookups = nil
+	c.GetKDCs("TEST.GOKRB5", true)
+	assert.Len(t, r.lookups, 1, "SRV records should be looked up again without caching")
+}
+
+func TestConfig_SetSRVCacheTTL(t *testing.T) {
+	t.Parallel()
+	r := &testResolver{srv: map[string][]*net.SRV{
+		"_kerberos._udp.TEST.GOKRB5": {{Target: "kdc1.test.gokrb5.", Port: 88}},
+	}}
+	c := &Config{LibDefaults: newLibDefaults()}
+	c.LibDefaults.DNSLookupKDC = true
+	c.SetResolver(r)
+	c.SetSRVCacheTTL(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		_, kdcs, err := c.GetKDCs("TEST.GOKRB5", false)
+		if err != nil {
+			t.Fatalf("error getting KDCs: %v", err)
+		}
+		assert.Equal(t, map[int]string{1: "kdc1.test.gokrb5:88"}, kdcs, "KDCs not as expected")
+	}
+	assert.Len(t, r.lookups, 1, "SRV records should be cached")
+	_, _, err := c.GetKDCs("OTHER.GOKRB5", false)
+	assert.Error(t, err, "failed lookup should be an error")
+	assert.Len(t, r.lookups, 2, "records of other realms should be looked up")
+
+	time.Sleep(60 * time.Millisecond)
+	c.GetKDCs("TEST.GOKRB5", false)
+	assert.Len(t, r.lookups, 3, "SRV records should be looked up again once the cache TTL has passed")
+}
+
+func TestOrderSRV(t *testing.T) {
+	t.Parallel()
+	addrs := []*net.SRV{
+		{Target: "c", Priority: 20, Weight: 0},
+		{Target: "a", Priority: 10, Weight: 100},
+		{Target: "b", Priority: 10, Weight: 0},
+		{Target: "d", Priority: 20, Weight: 5},
+	}
+	var first int
+	for i := 0; i < 100; i++ {
+		n, o := orderSRV(addrs)
+		assert.Equal(t, 4, n, "count of records not as expected")
+		assert.ElementsMatch(t, []string{"a", "b"}, []string{o[1].Target, o[2].Target}, "records of the lowest priority not first")
+		assert.ElementsMatch(t, []string{"c", "d"}, []string{o[3].Target, o[4].Target}, "records of the highest priority not last")
+		if o[1].Target == "a" {
+			first++
+		}
+	}
+	assert.True(t, first > 80, "record with the greater weight should be selected first most of the time, was %d times", first)
+	assert.Equal(t, "c", addrs[0].Target, "records ordered should not be modified")
+}
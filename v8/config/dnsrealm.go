@@ -0,0 +1,23 @@
+package config
+
+import (
+	"strings"
+)
+
+// lookupRealm looks up the realm of the host or domain name in the TXT record of _kerberos.<name>, as MIT krb5 does
+// for dns_lookup_realm, and then in those of its parent domains. Top level domains are not looked up.
+func (c *Config) lookupRealm(name string) (string, bool) {
+	name = strings.TrimPrefix(name, ".")
+	for strings.Contains(name, ".") {
+		txt, err := c.dnsLookup().lookupTXT("_kerberos." + name + ".")
+		if err == nil {
+			for _, r := range txt {
+				if r = strings.TrimSpace(r); r != "" {
+					return r, true
+				}
+			}
+		}
+		name = name[strings.Index(name, ".")+1:]
+	}
+	return "", false
+}
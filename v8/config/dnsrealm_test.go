@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRealm_DNS(t *testing.T) {
+	t.Parallel()
+	r := &testResolver{txt: map[string][]string{
+		"_kerberos.host.example.com.": {"HOST.EXAMPLE.COM"},
+		"_kerberos.example.com.":      {"", " EXAMPLE.COM "},
+		"_kerberos.com.":              {"COM"},
+	}}
+	c, err := NewFromString("[libdefaults]\n default_realm = DEFAULT.GOKRB5\n dns_lookup_realm = true\n[domain_realm]\n .mapped.example.com = MAPPED.EXAMPLE.COM\n")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	c.SetResolver(r)
+
+	assert.Equal(t, "HOST.EXAMPLE.COM", c.ResolveRealm("host.example.com"), "realm of the host's TXT record not as expected")
+	r.lookups = nil
+	assert.Equal(t, "EXAMPLE.COM", c.ResolveRealm("www.sub.example.com"), "realm of the parent domain's TXT record not as expected")
+	assert.Equal(t, []string{"_kerberos.www.sub.example.com.", "_kerberos.sub.example.com.", "_kerberos.example.com."}, r.lookups,
+		"TXT records looked up not as expected")
+	r.lookups = nil
+	assert.Equal(t, "MAPPED.EXAMPLE.COM", c.ResolveRealm("www.mapped.example.com"), "domain_realm should be used before DNS")
+	assert.Empty(t, r.lookups, "DNS should not be used when domain_realm has a mapping")
+	assert.Equal(t, "DEFAULT.GOKRB5", c.ResolveRealm("www.example.org"), "default realm should be used without a TXT record")
+	assert.NotContains(t, r.lookups, "_kerberos.org.", "top level domains should not be looked up")
+
+	c.LibDefaults.DNSLookupRealm = false
+	r.lookups = nil
+	assert.Equal(t, "DEFAULT.GOKRB5", c.ResolveRealm("host.example.com"), "DNS should not be used unless enabled")
+	assert.Empty(t, r.lookups, "DNS should not be used unless enabled")
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ConfigEnvVar is the environment variable of the locations of the krb5.conf files, a colon separated list.
+const ConfigEnvVar = "KRB5_CONFIG"
+
+// DefaultConfigPath is the location of the krb5.conf used if the ConfigEnvVar environment variable is not set.
+const DefaultConfigPath = "/etc/krb5.conf"
+
+// LoadDefault loads the krb5.conf files of the KRB5_CONFIG environment variable or, if it is not set, the default
+// location. As with MIT krb5 the files present are all loaded, as if each were included in turn, and those missing are
+// skipped. An error is returned if none of the files are present.
+func LoadDefault() (*Config, error) {
+	p := os.Getenv(ConfigEnvVar)
+	if p == "" {
+		p = DefaultConfigPath
+	}
+	var s strings.Builder
+	for _, f := range strings.Split(p, ":") {
+		if fi, err := os.Stat(f); err == nil && !fi.IsDir() {
+			s.WriteString("include " + f + "\n")
+		}
+	}
+	if s.Len() < 1 {
+		return nil, fmt.Errorf("no krb5.conf found at %s", p)
+	}
+	return NewFromString(s.String())
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TEST-gokrb5-env")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	first := filepath.Join(dir, "krb5.conf")
+	second := filepath.Join(dir, "local.conf")
+	if err := ioutil.WriteFile(first, []byte("[libdefaults]\n default_realm = TEST.GOKRB5\n"), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	if err := ioutil.WriteFile(second, []byte("[libdefaults]\n forwardable = true\n"), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	defer os.Unsetenv(ConfigEnvVar)
+
+	os.Setenv(ConfigEnvVar, filepath.Join(dir, "missing.conf")+":"+first+":"+second)
+	c, err := LoadDefault()
+	if err != nil {
+		t.Fatalf("error loading default config: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "default_realm of the first file not as expected")
+	assert.True(t, c.LibDefaults.Forwardable, "forwardable of the second file not as expected")
+
+	os.Setenv(ConfigEnvVar, filepath.Join(dir, "missing.conf"))
+	_, err = LoadDefault()
+	assert.Error(t, err, "loading should fail without any of the files present")
+}
@@ -7,7 +7,7 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/jcmturner/dnsutils/v2"
+	"github.com/jcmturner/gokrb5/v8/krberror"
 )
 
 // GetKDCs returns the count of KDCs available and a map of KDC host names keyed on preference order.
@@ -24,7 +24,7 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 		if r.Realm != realm {
 			continue
 		}
-		ks = r.KDC
+		ks = serverAddrs(r.KDC)
 	}
 	count = len(ks)
 
@@ -35,7 +35,7 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 	}
 
 	if !c.LibDefaults.DNSLookupKDC {
-		return count, kdcs, fmt.Errorf("no KDCs defined in configuration for realm %s", realm)
+		return count, kdcs, krberror.WithKind(fmt.Errorf("no KDCs defined in configuration for realm %s", realm), krberror.KindConfig)
 	}
 
 	// Use DNS to resolve kerberos SRV records.
@@ -43,12 +43,12 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 	if tcp {
 		proto = "tcp"
 	}
-	index, addrs, err := dnsutils.OrderedSRV("kerberos", proto, realm)
+	index, addrs, err := c.lookupSRV("kerberos", proto, realm)
 	if err != nil {
 		return count, kdcs, err
 	}
 	if len(addrs) < 1 {
-		return count, kdcs, fmt.Errorf("no KDC SRV records found for realm %s", realm)
+		return count, kdcs, krberror.WithKind(fmt.Errorf("no KDC SRV records found for realm %s", realm), krberror.KindConfig)
 	}
 	count = index
 	for k, v := range addrs {
@@ -69,12 +69,12 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 		if tcp {
 			proto = "tcp"
 		}
-		c, addrs, err := dnsutils.OrderedSRV("kpasswd", proto, realm)
+		n, addrs, err := c.lookupSRV("kpasswd", proto, realm)
 		if err != nil {
 			return count, kdcs, err
 		}
-		if c < 1 {
-			c, addrs, err = dnsutils.OrderedSRV("kerberos-adm", proto, realm)
+		if n < 1 {
+			n, addrs, err = c.lookupSRV("kerberos-adm", proto, realm)
 			if err != nil {
 				return count, kdcs, err
 			}
@@ -82,7 +82,7 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 		if len(addrs) < 1 {
 			return count, kdcs, fmt.Errorf("no kpasswd or kadmin SRV records found for realm %s", realm)
 		}
-		count = c
+		count = n
 		for k, v := range addrs {
 			kdcs[k] = strings.TrimRight(v.Target, ".") + ":" + strconv.Itoa(int(v.Port))
 		}
@@ -92,8 +92,8 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 		var ka []string
 		for _, r := range c.Realms {
 			if r.Realm == realm {
-				ks = r.KPasswdServer
-				ka = r.AdminServer
+				ks = serverAddrs(r.KPasswdServer)
+				ka = serverAddrs(r.AdminServer)
 				break
 			}
 		}
@@ -115,6 +115,97 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 	return count, kdcs, nil
 }
 
+// GetAdminServers returns the count of kadmin servers available and a map of kadmin addresses keyed on preference
+// order, from the admin_server entries of the realm or, with dns_lookup_kdc, the _kerberos-adm._tcp SRV records. Entries
+// without a port use the kadmin port 749.
+func (c *Config) GetAdminServers(realm string) (int, map[int]string, error) {
+	if realm == "" {
+		realm = c.LibDefaults.DefaultRealm
+	}
+	var ks []string
+	for _, r := range c.Realms {
+		if r.Realm != realm {
+			continue
+		}
+		for _, a := range serverAddrs(r.AdminServer) {
+			if _, _, err := net.SplitHostPort(a); err != nil {
+				a = net.JoinHostPort(a, "749")
+			}
+			ks = append(ks, a)
+		}
+	}
+	if len(ks) > 0 {
+		return len(ks), randServOrder(ks), nil
+	}
+	servers := make(map[int]string)
+	if !c.LibDefaults.DNSLookupKDC {
+		return 0, servers, krberror.WithKind(fmt.Errorf("no kadmin servers defined in configuration for realm %s", realm), krberror.KindConfig)
+	}
+	n, addrs, err := c.lookupSRV("kerberos-adm", "tcp", realm)
+	if err != nil {
+		return 0, servers, err
+	}
+	if len(addrs) < 1 {
+		return 0, servers, krberror.WithKind(fmt.Errorf("no kadmin SRV records found for realm %s", realm), krberror.KindConfig)
+	}
+	for k, v := range addrs {
+		servers[k] = strings.TrimRight(v.Target, ".") + ":" + strconv.Itoa(int(v.Port))
+	}
+	return n, servers, nil
+}
+
+// GetKDCProxies returns the URLs of the MS-KKDCP KDC proxies configured for the realm, given as kdc entries of the form
+// https://host/path, in the order they are configured.
+func (c *Config) GetKDCProxies(realm string) []string {
+	if realm == "" {
+		realm = c.LibDefaults.DefaultRealm
+	}
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			return proxyURLs(r.KDC)
+		}
+	}
+	return nil
+}
+
+// GetKpasswdProxies returns the URLs of the MS-KKDCP KDC proxies configured for the realm's kpasswd service, given as
+// kpasswd_server entries of the form https://host/path, in the order they are configured.
+func (c *Config) GetKpasswdProxies(realm string) []string {
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			return proxyURLs(r.KPasswdServer)
+		}
+	}
+	return nil
+}
+
+// IsProxyURL reports if the server entry is the URL of an MS-KKDCP KDC proxy rather than a host and port.
+func IsProxyURL(s string) bool {
+	return strings.HasPrefix(strings.ToLower(s), "https://")
+}
+
+// serverAddrs returns the entries that are a host and port rather than a KDC proxy URL.
+func serverAddrs(ss []string) []string {
+	var a []string
+	for _, s := range ss {
+		if !IsProxyURL(s) {
+			a = append(a, s)
+		}
+	}
+	return a
+}
+
+// proxyURLs returns the entries that are KDC proxy URLs.
+func proxyURLs(ss []string) []string {
+	var u []string
+	for _, s := range ss {
+		if IsProxyURL(s) {
+			u = append(u, s)
+		}
+	}
+	return u
+}
+
 func randServOrder(ks []string) map[int]string {
 	kdcs := make(map[int]string)
 	count := len(ks)
@@ -89,3 +89,71 @@ func TestResolveKDC(t *testing.T) {
 	}
 	assert.Equal(t, "127.0.0.1:88", res[1], "KDC not read from config as expected")
 }
+
+func TestConfig_GetKDCProxies(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`
+[libdefaults]
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = https://proxy1.test.gokrb5/KdcProxy
+  kdc = kdc.test.gokrb5:88
+  kdc = HTTPS://proxy2.test.gokrb5:8443/KdcProxy
+  kpasswd_server = https://proxy1.test.gokrb5/KdcProxy
+ }
+ OTHER.GOKRB5 = {
+  kdc = kdc.other.gokrb5
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, []string{"https://proxy1.test.gokrb5/KdcProxy", "HTTPS://proxy2.test.gokrb5:8443/KdcProxy"}, c.GetKDCProxies("TEST.GOKRB5"), "KDC proxies not as expected")
+	assert.Equal(t, c.GetKDCProxies("TEST.GOKRB5"), c.GetKDCProxies(""), "KDC proxies of the default realm not as expected")
+	assert.Equal(t, []string{"https://proxy1.test.gokrb5/KdcProxy"}, c.GetKpasswdProxies("TEST.GOKRB5"), "kpasswd proxies not as expected")
+	assert.Len(t, c.GetKDCProxies("OTHER.GOKRB5"), 0, "there should not be KDC proxies for the realm")
+
+	// The KDC proxies are not returned as KDC addresses.
+	count, kdcs, err := c.GetKDCs("TEST.GOKRB5", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count, "count of KDCs not as expected")
+	assert.Equal(t, "kdc.test.gokrb5:88", kdcs[1], "KDC not as expected")
+	_, _, err = c.GetKpasswdServers("TEST.GOKRB5", true)
+	assert.Error(t, err, "there should not be kpasswd servers other than the KDC proxy")
+}
+
+func TestConfig_GetAdminServers(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`
+[libdefaults]
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  admin_server = kdc.test.gokrb5
+ }
+ OTHER.GOKRB5 = {
+  admin_server = kdc.other.gokrb5:7749
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	count, servers, err := c.GetAdminServers("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count, "count of kadmin servers not as expected")
+	assert.Equal(t, "kdc.test.gokrb5:749", servers[1], "kadmin server without a port should use the kadmin port")
+	_, servers, err = c.GetAdminServers("OTHER.GOKRB5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "kdc.other.gokrb5:7749", servers[1], "kadmin server not as expected")
+	_, _, err = c.GetAdminServers("NONE.GOKRB5")
+	assert.Error(t, err, "there should not be kadmin servers for a realm not configured")
+}
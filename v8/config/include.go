@@ -0,0 +1,148 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeDepth is the maximum nesting of included files, which stops a file that includes itself from being
+// included indefinitely.
+const maxIncludeDepth = 16
+
+// confLines holds the lines of the sections of a krb5.conf, including those of the files it includes, and the index
+// of the line each section starts at.
+type confLines struct {
+	sections       map[int]string
+	sectionLineNum []int
+	lines          []string
+}
+
+// scan reads the lines of the configuration from the scanner, processing its include and includedir directives.
+func (l *confLines) scan(scanner *bufio.Scanner, depth int) error {
+	var section string
+	for scanner.Scan() {
+		// Skip comments and blank lines
+		if matched, _ := regexp.MatchString(`^\s*(#|;|\n)`, scanner.Text()); matched {
+			continue
+		}
+		if path, ok := directive(scanner.Text(), "includedir"); ok {
+			if err := l.includeDir(path, depth); err != nil {
+				return err
+			}
+			l.resume(section)
+			continue
+		}
+		if path, ok := directive(scanner.Text(), "include"); ok {
+			if err := l.include(path, depth); err != nil {
+				return err
+			}
+			l.resume(section)
+			continue
+		}
+		if matched, _ := regexp.MatchString(`^\s*\[libdefaults\]\s*`, scanner.Text()); matched {
+			section = "libdefaults"
+			l.start(section)
+			continue
+		}
+		if matched, _ := regexp.MatchString(`^\s*\[realms\]\s*`, scanner.Text()); matched {
+			section = "realms"
+			l.start(section)
+			continue
+		}
+		if matched, _ := regexp.MatchString(`^\s*\[domain_realm\]\s*`, scanner.Text()); matched {
+			section = "domain_realm"
+			l.start(section)
+			continue
+		}
+		if matched, _ := regexp.MatchString(`^\s*\[capaths\]\s*`, scanner.Text()); matched {
+			section = "capaths"
+			l.start(section)
+			continue
+		}
+		if matched, _ := regexp.MatchString(`^\s*\[.*\]\s*`, scanner.Text()); matched {
+			section = "unknown_section"
+			l.start(section)
+			continue
+		}
+		l.lines = append(l.lines, scanner.Text())
+	}
+	return nil
+}
+
+// start records that a section starts at the next line.
+func (l *confLines) start(section string) {
+	l.sections[len(l.lines)] = section
+	l.sectionLineNum = append(l.sectionLineNum, len(l.lines))
+}
+
+// resume restarts the section of the including file after an included file has started another section, as included
+// files are syntactically independent of the file including them.
+func (l *confLines) resume(section string) {
+	if section == "" || len(l.sectionLineNum) < 1 {
+		return
+	}
+	if l.sections[l.sectionLineNum[len(l.sectionLineNum)-1]] != section {
+		l.start(section)
+	}
+}
+
+// include reads the lines of the file of an include directive.
+func (l *confLines) include(path string, depth int) error {
+	if depth >= maxIncludeDepth {
+		return fmt.Errorf("configuration file %s exceeds the maximum depth of included files", path)
+	}
+	fh, err := os.Open(path)
+	if err != nil {
+		return errors.New("included configuration file could not be opened: " + path + " " + err.Error())
+	}
+	defer fh.Close()
+	return l.scan(bufio.NewScanner(fh), depth+1)
+}
+
+// includeDir reads the lines of the files of the directory of an includedir directive, in the order of their names.
+// As with MIT krb5 only files whose names end in .conf, or consist solely of alphanumeric characters, dashes and
+// underscores, are included so that editor backups and package manager files are ignored.
+func (l *confLines) includeDir(path string, depth int) error {
+	fis, err := ioutil.ReadDir(path)
+	if err != nil {
+		return errors.New("included configuration directory could not be read: " + path + " " + err.Error())
+	}
+	for _, fi := range fis {
+		if fi.IsDir() || !includedName(fi.Name()) {
+			continue
+		}
+		if err := l.include(filepath.Join(path, fi.Name()), depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includedName indicates if the file of the name is included by an includedir directive.
+func includedName(name string) bool {
+	if strings.HasSuffix(name, ".conf") {
+		return true
+	}
+	matched, _ := regexp.MatchString(`^[a-zA-Z0-9_-]+$`, name)
+	return matched
+}
+
+// directive returns the path of the line if it is the directive, which must be at the beginning of the line.
+func directive(line, name string) (string, bool) {
+	if !strings.HasPrefix(line, name) {
+		return "", false
+	}
+	p := strings.TrimLeft(line[len(name):], " \t")
+	if len(p) == len(line)-len(name) {
+		// The name is not followed by whitespace, such as "include" of "includedir".
+		return "", false
+	}
+	p = strings.TrimSpace(p)
+	return p, p != ""
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Include(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "TEST-gokrb5-include")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	confd := filepath.Join(dir, "krb5.conf.d")
+	if err := os.Mkdir(confd, 0700); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	files := map[string]string{
+		filepath.Join(confd, "crypto-policies"):        "[libdefaults]\n ticket_lifetime = 8h\n",
+		filepath.Join(confd, "domain_realm_test.conf"): "[domain_realm]\n .res.gokrb5 = RES.GOKRB5\n",
+		filepath.Join(confd, "crypto-policies~"):       "[libdefaults]\n ticket_lifetime = 1h\n",
+		filepath.Join(confd, "README.txt"):             "[libdefaults]\n ticket_lifetime = 2h\n",
+		filepath.Join(dir, "realms"):                   "[realms]\n RES.GOKRB5 = {\n  kdc = kdc.res.gokrb5:88\n }\n",
+		filepath.Join(dir, "krb5.conf"): "includedir " + confd + "\n" +
+			"[libdefaults]\n default_realm = TEST.GOKRB5\n" +
+			"include " + filepath.Join(dir, "realms") + "\n" +
+			" forwardable = true\n" +
+			"[realms]\n TEST.GOKRB5 = {\n  kdc = kdc.test.gokrb5:88\n }\n",
+	}
+	for name, s := range files {
+		if err := ioutil.WriteFile(name, []byte(s), 0600); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+
+	c, err := Load(filepath.Join(dir, "krb5.conf"))
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "default_realm not as expected")
+	assert.Equal(t, 8*time.Hour, c.LibDefaults.TicketLifetime, "ticket_lifetime of the included directory not as expected")
+	assert.True(t, c.LibDefaults.Forwardable, "libdefaults after the include directive should be parsed")
+	assert.Equal(t, "RES.GOKRB5", c.ResolveRealm("host.res.gokrb5"), "domain_realm of the included directory not as expected")
+	if assert.Len(t, c.Realms, 2, "realms of the configuration and the included file should be parsed") {
+		assert.Equal(t, "RES.GOKRB5", c.Realms[0].Realm, "realm of the included file not as expected")
+		assert.Equal(t, "TEST.GOKRB5", c.Realms[1].Realm, "realm of the configuration not as expected")
+	}
+
+	// A file including itself is rejected rather than included indefinitely.
+	loop := filepath.Join(dir, "loop")
+	if err := ioutil.WriteFile(loop, []byte("include "+loop+"\n"), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	_, err = Load(loop)
+	assert.Error(t, err, "recursive include should be rejected")
+	_, err = NewFromString("include " + filepath.Join(dir, "missing") + "\n")
+	assert.Error(t, err, "missing included file should be an error")
+}
+
+func TestIncludedName(t *testing.T) {
+	t.Parallel()
+	for name, ok := range map[string]bool{
+		"crypto-policies": true,
+		"freeipa_1":       true,
+		"sssd.conf":       true,
+		"sssd.conf~":      false,
+		".sssd.swp":       false,
+		"krb5.rpmnew":     false,
+	} {
+		assert.Equal(t, ok, includedName(name), "inclusion of %s not as expected", name)
+	}
+}
@@ -11,10 +11,10 @@ import (
 	"net"
 	"os"
 	"os/user"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
@@ -25,9 +25,10 @@ type Config struct {
 	LibDefaults LibDefaults
 	Realms      []Realm
 	DomainRealm DomainRealm
-	//CaPaths
+	CAPaths     CAPaths `json:",omitempty"`
 	//AppDefaults
 	//Plugins
+	dns *dnsLookup
 }
 
 // WeakETypeList is a list of encryption types that have been deemed weak.
@@ -39,6 +40,8 @@ func New() *Config {
 	return &Config{
 		LibDefaults: newLibDefaults(),
 		DomainRealm: d,
+		CAPaths:     make(CAPaths),
+		dns:         new(dnsLookup),
 	}
 }
 
@@ -53,23 +56,25 @@ type LibDefaults struct {
 	DefaultClientKeytabName string //default /usr/local/var/krb5/user/%{euid}/client.keytab
 	DefaultKeytabName       string //default /etc/krb5.keytab
 	DefaultRealm            string
-	DefaultTGSEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
-	DefaultTktEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
-	DefaultTGSEnctypeIDs    []int32  //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
-	DefaultTktEnctypeIDs    []int32  //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	DefaultTGSEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	DefaultTktEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	DefaultTGSEnctypeIDs    []int32  //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	DefaultTktEnctypeIDs    []int32  //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	DNSCanonicalizeHostname bool     //default true
 	DNSLookupKDC            bool     //default false
 	DNSLookupRealm          bool
-	ExtraAddresses          []net.IP       //Not implementing yet
+	ExtraAddresses          []net.IP       //added to the local addresses in requests when noaddresses is false
 	Forwardable             bool           //default false
 	IgnoreAcceptorHostname  bool           //default false
 	K5LoginAuthoritative    bool           //default false
 	K5LoginDirectory        string         //default user's home directory. Must be owned by the user or root
 	KDCDefaultOptions       asn1.BitString //default 0x00000010 (KDC_OPT_RENEWABLE_OK)
+	KDCTimeout              time.Duration  //default 5 seconds, the time to wait for each KDC to respond
 	KDCTimeSync             int            //default 1
+	MaxRetries              int            //default 1, the number of times the KDCs of a realm are each tried
 	//kdc_req_checksum_type int //unlikely to implement as for very old KDCs
 	NoAddresses         bool     //default true
-	PermittedEnctypes   []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	PermittedEnctypes   []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	PermittedEnctypeIDs []int32
 	//plugin_base_dir string //not supporting plugins
 	PreferredPreauthTypes []int         //default “17, 16, 15, 14”, which forces libkrb5 to attempt to use PKINIT if it is supported
@@ -100,14 +105,16 @@ func newLibDefaults() LibDefaults {
 		Clockskew:               time.Duration(300) * time.Second,
 		DefaultClientKeytabName: fmt.Sprintf("/usr/local/var/krb5/user/%s/client.keytab", uid),
 		DefaultKeytabName:       "/etc/krb5.keytab",
-		DefaultTGSEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
-		DefaultTktEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
+		DefaultTGSEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "aes256-cts-hmac-sha384-192", "aes128-cts-hmac-sha256-128", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
+		DefaultTktEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "aes256-cts-hmac-sha384-192", "aes128-cts-hmac-sha256-128", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
 		DNSCanonicalizeHostname: true,
 		K5LoginDirectory:        hdir,
 		KDCDefaultOptions:       opts,
+		KDCTimeout:              5 * time.Second,
 		KDCTimeSync:             1,
+		MaxRetries:              1,
 		NoAddresses:             true,
-		PermittedEnctypes:       []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
+		PermittedEnctypes:       []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "aes256-cts-hmac-sha384-192", "aes128-cts-hmac-sha256-128", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
 		RDNS:                    true,
 		RealmTryDomains:         -1,
 		SafeChecksumType:        8,
@@ -189,8 +196,8 @@ func (l *LibDefaults) parseLines(lines []string) error {
 			}
 			l.DNSLookupRealm = v
 		case "extra_addresses":
-			ipStr := strings.TrimSpace(p[1])
-			for _, ip := range strings.Split(ipStr, ",") {
+			// The addresses are separated by commas and/or whitespace.
+			for _, ip := range strings.FieldsFunc(p[1], func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
 				if eip := net.ParseIP(ip); eip != nil {
 					l.ExtraAddresses = append(l.ExtraAddresses, eip)
 				}
@@ -224,6 +231,12 @@ func (l *LibDefaults) parseLines(lines []string) error {
 			}
 			l.KDCDefaultOptions.Bytes = b
 			l.KDCDefaultOptions.BitLength = len(b) * 8
+		case "kdc_timeout":
+			d, err := parseDuration(p[1])
+			if err != nil || d <= 0 {
+				return InvalidErrorf("libdefaults section line (%s)", line)
+			}
+			l.KDCTimeout = d
 		case "kdc_timesync":
 			p[1] = strings.TrimSpace(p[1])
 			v, err := strconv.ParseInt(p[1], 10, 32)
@@ -231,6 +244,13 @@ func (l *LibDefaults) parseLines(lines []string) error {
 				return InvalidErrorf("libdefaults section line (%s)", line)
 			}
 			l.KDCTimeSync = int(v)
+		case "max_retries":
+			p[1] = strings.TrimSpace(p[1])
+			v, err := strconv.ParseInt(p[1], 10, 32)
+			if err != nil || v < 1 {
+				return InvalidErrorf("libdefaults section line (%s)", line)
+			}
+			l.MaxRetries = int(v)
 		case "noaddresses":
 			v, err := parseBoolean(p[1])
 			if err != nil {
@@ -484,26 +504,42 @@ func (d *DomainRealm) addMapping(domain, realm string) {
 	(*d)[domain] = realm
 }
 
+// realm returns the realm of the most specific mapping for the name.
+func (d DomainRealm) realm(name string) (string, bool) {
+	// Try to match the entire hostname first
+	if r, ok := d[name]; ok {
+		return r, true
+	}
+	// Try to match all DNS domain parts, the longest first
+	for i := strings.Index(name, "."); i != -1; i = strings.Index(name, ".") {
+		name = name[i+1:]
+		if r, ok := d["."+name]; ok {
+			return r, true
+		}
+		if r, ok := d["*."+name]; ok {
+			return r, true
+		}
+	}
+	return "", false
+}
+
 // Delete a domain to realm mapping.
 func (d *DomainRealm) deleteMapping(domain, realm string) {
 	delete(*d, domain)
 }
 
-// ResolveRealm resolves the kerberos realm for the specified domain name from the domain to realm mapping.
-// The most specific mapping is returned.
+// ResolveRealm resolves the kerberos realm for the specified host or domain name, such as the host of a service
+// principal name. The most specific mapping of the [domain_realm] section is used: that of the name itself and then
+// those of its parent domains, from the longest, given as .example.com or *.example.com. If none matches and
+// dns_lookup_realm is enabled, the realm is looked up in the TXT records of _kerberos.<name> and then of its parent
+// domains. Otherwise the default realm is returned.
 func (c *Config) ResolveRealm(domainName string) string {
-	domainName = strings.TrimSuffix(domainName, ".")
-
-	// Try to match the entire hostname first
-	if r, ok := c.DomainRealm[domainName]; ok {
+	domainName = strings.ToLower(strings.TrimSuffix(domainName, "."))
+	if r, ok := c.DomainRealm.realm(domainName); ok {
 		return r
 	}
-
-	// Try to match all DNS domain parts
-	periods := strings.Count(domainName, ".") + 1
-	for i := 2; i <= periods; i++ {
-		z := strings.SplitN(domainName, ".", i)
-		if r, ok := c.DomainRealm["."+z[len(z)-1]]; ok {
+	if c.LibDefaults.DNSLookupRealm {
+		if r, ok := c.lookupRealm(domainName); ok {
 			return r
 		}
 	}
@@ -534,39 +570,15 @@ func NewFromReader(r io.Reader) (*Config, error) {
 }
 
 // NewFromScanner creates a new Config struct from a bufio.Scanner.
+// The files of include and includedir directives are parsed as if they were part of the configuration.
 func NewFromScanner(scanner *bufio.Scanner) (*Config, error) {
 	c := New()
 	var e error
-	sections := make(map[int]string)
-	var sectionLineNum []int
-	var lines []string
-	for scanner.Scan() {
-		// Skip comments and blank lines
-		if matched, _ := regexp.MatchString(`^\s*(#|;|\n)`, scanner.Text()); matched {
-			continue
-		}
-		if matched, _ := regexp.MatchString(`^\s*\[libdefaults\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "libdefaults"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
-		}
-		if matched, _ := regexp.MatchString(`^\s*\[realms\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "realms"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
-		}
-		if matched, _ := regexp.MatchString(`^\s*\[domain_realm\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "domain_realm"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
-		}
-		if matched, _ := regexp.MatchString(`^\s*\[.*\]\s*`, scanner.Text()); matched {
-			sections[len(lines)] = "unknown_section"
-			sectionLineNum = append(sectionLineNum, len(lines))
-			continue
-		}
-		lines = append(lines, scanner.Text())
+	cl := confLines{sections: make(map[int]string)}
+	if err := cl.scan(scanner, 0); err != nil {
+		return nil, err
 	}
+	sections, sectionLineNum, lines := cl.sections, cl.sectionLineNum, cl.lines
 	for i, start := range sectionLineNum {
 		var end int
 		if i+1 >= len(sectionLineNum) {
@@ -579,7 +591,7 @@ func NewFromScanner(scanner *bufio.Scanner) (*Config, error) {
 			err := c.LibDefaults.parseLines(lines[start:end])
 			if err != nil {
 				if _, ok := err.(UnsupportedDirective); !ok {
-					return nil, fmt.Errorf("error processing libdefaults section: %v", err)
+					return nil, fmt.Errorf("error processing libdefaults section: %w", err)
 				}
 				e = err
 			}
@@ -587,19 +599,24 @@ func NewFromScanner(scanner *bufio.Scanner) (*Config, error) {
 			realms, err := parseRealms(lines[start:end])
 			if err != nil {
 				if _, ok := err.(UnsupportedDirective); !ok {
-					return nil, fmt.Errorf("error processing realms section: %v", err)
+					return nil, fmt.Errorf("error processing realms section: %w", err)
 				}
 				e = err
 			}
-			c.Realms = realms
+			c.Realms = append(c.Realms, realms...)
 		case "domain_realm":
 			err := c.DomainRealm.parseLines(lines[start:end])
 			if err != nil {
 				if _, ok := err.(UnsupportedDirective); !ok {
-					return nil, fmt.Errorf("error processing domaain_realm section: %v", err)
+					return nil, fmt.Errorf("error processing domaain_realm section: %w", err)
 				}
 				e = err
 			}
+		case "capaths":
+			err := c.CAPaths.parseLines(lines[start:end])
+			if err != nil {
+				return nil, fmt.Errorf("error processing capaths section: %w", err)
+			}
 		}
 	}
 	return c, e
@@ -2,6 +2,7 @@ package config
 
 import (
 	"io/ioutil"
+	"net"
 	"os"
 	"testing"
 	"time"
@@ -91,6 +92,8 @@ const (
     "DefaultTGSEnctypes": [
       "aes256-cts-hmac-sha1-96",
       "aes128-cts-hmac-sha1-96",
+      "aes256-cts-hmac-sha384-192",
+      "aes128-cts-hmac-sha256-128",
       "des3-cbc-sha1",
       "arcfour-hmac-md5",
       "camellia256-cts-cmac",
@@ -106,6 +109,8 @@ const (
     "DefaultTGSEnctypeIDs": [
       18,
       17,
+      20,
+      19,
       23
     ],
     "DefaultTktEnctypeIDs": [
@@ -124,11 +129,15 @@ const (
       "Bytes": "AAAAEA==",
       "BitLength": 32
     },
+    "KDCTimeout": 5000000000,
     "KDCTimeSync": 1,
+    "MaxRetries": 1,
     "NoAddresses": true,
     "PermittedEnctypes": [
       "aes256-cts-hmac-sha1-96",
       "aes128-cts-hmac-sha1-96",
+      "aes256-cts-hmac-sha384-192",
+      "aes128-cts-hmac-sha256-128",
       "des3-cbc-sha1",
       "arcfour-hmac-md5",
       "camellia256-cts-cmac",
@@ -140,6 +149,8 @@ const (
     "PermittedEnctypeIDs": [
       18,
       17,
+      20,
+      19,
       23
     ],
     "PreferredPreauthTypes": [
@@ -664,6 +675,37 @@ func TestResolveRealm(t *testing.T) {
 	}
 }
 
+func TestResolveRealm_MostSpecific(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[libdefaults]
+ default_realm = DEFAULT.GOKRB5
+[domain_realm]
+ *.example.com = EXAMPLE.COM
+ .eu.example.com = EU.EXAMPLE.COM
+ *.lab.eu.example.com = LAB.EXAMPLE.COM
+ Host.Lab.EU.example.com = HOST.EXAMPLE.COM
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	tests := []struct {
+		domainName string
+		want       string
+	}{
+		{"www.example.com", "EXAMPLE.COM"},
+		{"a.b.example.com", "EXAMPLE.COM"},
+		{"www.eu.example.com", "EU.EXAMPLE.COM"},
+		{"a.b.lab.eu.example.com", "LAB.EXAMPLE.COM"},
+		{"HOST.lab.eu.example.com.", "HOST.EXAMPLE.COM"},
+		{"WWW.EU.Example.COM", "EU.EXAMPLE.COM"},
+		{"example.com", "DEFAULT.GOKRB5"},
+		{"example.org", "DEFAULT.GOKRB5"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, c.ResolveRealm(tt.domainName), "realm of %s not as expected", tt.domainName)
+	}
+}
+
 func TestJSON(t *testing.T) {
 	t.Parallel()
 	c, err := NewFromString(krb5Conf)
@@ -679,3 +721,31 @@ func TestJSON(t *testing.T) {
 
 	t.Log(j)
 }
+
+func TestLoad_KDCTimeout(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString("[libdefaults]\n kdc_timeout = 2s\n max_retries = 3\n")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, 2*time.Second, c.LibDefaults.KDCTimeout, "[libdefaults] kdc_timeout not as expected")
+	assert.Equal(t, 3, c.LibDefaults.MaxRetries, "[libdefaults] max_retries not as expected")
+	c = New()
+	assert.Equal(t, 5*time.Second, c.LibDefaults.KDCTimeout, "default kdc_timeout not as expected")
+	assert.Equal(t, 1, c.LibDefaults.MaxRetries, "default max_retries not as expected")
+	for _, s := range []string{"kdc_timeout = 0", "kdc_timeout = soon", "max_retries = 0", "max_retries = many"} {
+		_, err := NewFromString("[libdefaults]\n " + s + "\n")
+		assert.Error(t, err, "invalid value should not be loaded: %s", s)
+	}
+}
+
+func TestLoad_Addresses(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString("[libdefaults]\n noaddresses = false\n extra_addresses = 10.1.2.3, 2001:db8::1 192.0.2.1\n")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.False(t, c.LibDefaults.NoAddresses, "[libdefaults] noaddresses not as expected")
+	assert.Equal(t, []net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")},
+		c.LibDefaults.ExtraAddresses, "[libdefaults] extra_addresses not as expected")
+}
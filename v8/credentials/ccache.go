@@ -1,15 +1,19 @@
 package credentials
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 	"unsafe"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
 
@@ -71,8 +75,138 @@ func LoadCCache(cpath string) (*CCache, error) {
 	return c, err
 }
 
+// NewCCache returns a new, empty, version 4 credential cache for the client principal provided.
+func NewCCache(cname types.PrincipalName, realm string) *CCache {
+	return &CCache{
+		Version: 4,
+		DefaultPrincipal: principal{
+			Realm:         realm,
+			PrincipalName: cname,
+		},
+	}
+}
+
+// NewCredential returns a new credential cache entry for a ticket issued to the client for the server principal.
+func NewCredential(cname types.PrincipalName, crealm string, sname types.PrincipalName, srealm string) *Credential {
+	return &Credential{
+		Client: principal{
+			Realm:         crealm,
+			PrincipalName: cname,
+		},
+		Server: principal{
+			Realm:         srealm,
+			PrincipalName: sname,
+		},
+		TicketFlags: types.NewKrbFlags(),
+	}
+}
+
+// AddCredential adds the credential to the cache replacing any existing credential for the same server principal.
+func (c *CCache) AddCredential(cred *Credential) {
+	for i := range c.Credentials {
+		if c.Credentials[i].Server.Realm == cred.Server.Realm && c.Credentials[i].Server.PrincipalName.Equal(cred.Server.PrincipalName) {
+			c.Credentials[i] = cred
+			return
+		}
+	}
+	c.Credentials = append(c.Credentials, cred)
+}
+
+// Marshal the CCache into a byte slice in the file credential cache format.
+// Only versions 3 and 4 of the format can be marshaled.
+func (c *CCache) Marshal() ([]byte, error) {
+	if c.Version != 3 && c.Version != 4 {
+		return []byte{}, fmt.Errorf("marshaling of credential cache version %d is not supported", c.Version)
+	}
+	var endian binary.ByteOrder
+	endian = binary.BigEndian
+	b := []byte{5, c.Version}
+	if c.Version == 4 {
+		b = append(b, c.Header.marshal(&endian)...)
+	}
+	b = append(b, c.DefaultPrincipal.marshal(&endian)...)
+	for _, cred := range c.Credentials {
+		b = append(b, cred.marshal(c, &endian)...)
+	}
+	return b, nil
+}
+
+// JavaCompatible returns a copy of the credential cache containing only the fields and entries that Java's
+// Krb5LoginModule can read, for use when a cache is to be shared with Java applications:
+//
+// * Version 3 of the format is used, as written by Java itself.
+//
+// * Configuration entries are removed. Older Java releases try to parse their data as tickets and fail.
+//
+// * Addresses other than well formed IPv4 and IPv6 addresses are removed as Java does not read them.
+//
+// The credentials are shallow copies so modifying their other fields also modifies those of the original cache.
+func (c *CCache) JavaCompatible() *CCache {
+	jc := &CCache{
+		Version:          3,
+		DefaultPrincipal: c.DefaultPrincipal,
+		Path:             c.Path,
+	}
+	for _, cred := range c.GetEntries() {
+		jcred := *cred
+		jcred.Addresses = nil
+		for _, a := range cred.Addresses {
+			if (a.AddrType == addrtype.IPv4 && len(a.Address) == 4) || (a.AddrType == addrtype.IPv6 && len(a.Address) == 16) {
+				jcred.Addresses = append(jcred.Addresses, a)
+			}
+		}
+		jc.Credentials = append(jc.Credentials, &jcred)
+	}
+	return jc
+}
+
+// Write the credential cache bytes to io.Writer.
+// Returns the number of bytes written
+func (c *CCache) Write(w io.Writer) (int, error) {
+	b, err := c.Marshal()
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling credential cache: %w", err)
+	}
+	return w.Write(b)
+}
+
+// Save writes the credential cache to the file path provided, which is created with permissions that only allow
+// access by the current user. The data is written to a temporary file in the same directory which then replaces
+// cpath, so a process reading the cache never sees a partially written file.
+func (c *CCache) Save(cpath string) error {
+	b, err := c.Marshal()
+	if err != nil {
+		return fmt.Errorf("error marshaling credential cache: %w", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(cpath), "."+filepath.Base(cpath)+".")
+	if err != nil {
+		return fmt.Errorf("error creating temporary credential cache file: %w", err)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if err = f.Chmod(0600); err == nil {
+		if _, err = f.Write(b); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing credential cache: %w", err)
+	}
+	if err = os.Rename(tmp, cpath); err != nil {
+		return fmt.Errorf("error replacing credential cache file: %w", err)
+	}
+	c.Path = cpath
+	return nil
+}
+
 // Unmarshal a byte slice of credential cache data into CCache type.
 func (c *CCache) Unmarshal(b []byte) error {
+	if len(b) < 2 {
+		return fmt.Errorf("credential cache data is less than 2 bytes: %d", len(b))
+	}
 	p := 0
 	//The first byte of the file always has the value 5
 	if int8(b[p]) != 5 {
@@ -98,7 +232,11 @@ func (c *CCache) Unmarshal(b []byte) error {
 			return err
 		}
 	}
-	c.DefaultPrincipal = parsePrincipal(b, &p, c, &endian)
+	var err error
+	c.DefaultPrincipal, err = parsePrincipal(b, &p, c, &endian)
+	if err != nil {
+		return fmt.Errorf("error parsing default principal: %w", err)
+	}
 	for p < len(b) {
 		cred, err := parseCredential(b, &p, c, &endian)
 		if err != nil {
@@ -114,13 +252,27 @@ func parseHeader(b []byte, p *int, c *CCache, e *binary.ByteOrder) error {
 		return errors.New("Credentials cache version is not 4 so there is no header to parse.")
 	}
 	h := header{}
-	h.length = uint16(readInt16(b, p, e))
+	l, err := readInt16(b, p, e)
+	if err != nil {
+		return err
+	}
+	h.length = uint16(l)
 	for *p <= int(h.length) {
 		f := headerField{}
-		f.tag = uint16(readInt16(b, p, e))
-		f.length = uint16(readInt16(b, p, e))
-		f.value = b[*p : *p+int(f.length)]
-		*p += int(f.length)
+		tag, err := readInt16(b, p, e)
+		if err != nil {
+			return err
+		}
+		f.tag = uint16(tag)
+		l, err := readInt16(b, p, e)
+		if err != nil {
+			return err
+		}
+		f.length = uint16(l)
+		f.value, err = readBytes(b, p, int(f.length), e)
+		if err != nil {
+			return err
+		}
 		if !f.valid() {
 			return errors.New("Invalid credential cache header found")
 		}
@@ -131,63 +283,175 @@ func parseHeader(b []byte, p *int, c *CCache, e *binary.ByteOrder) error {
 }
 
 // Parse the Keytab bytes of a principal into a Keytab entry's principal.
-func parsePrincipal(b []byte, p *int, c *CCache, e *binary.ByteOrder) (princ principal) {
+func parsePrincipal(b []byte, p *int, c *CCache, e *binary.ByteOrder) (princ principal, err error) {
 	if c.Version != 1 {
 		//Name Type is omitted in version 1
-		princ.PrincipalName.NameType = readInt32(b, p, e)
+		princ.PrincipalName.NameType, err = readInt32(b, p, e)
+		if err != nil {
+			return
+		}
 	}
-	nc := int(readInt32(b, p, e))
+	i, err := readInt32(b, p, e)
+	if err != nil {
+		return
+	}
+	nc := int(i)
 	if c.Version == 1 {
 		//In version 1 the number of components includes the realm. Minus 1 to make consistent with version 2
 		nc--
 	}
-	lenRealm := readInt32(b, p, e)
-	princ.Realm = string(readBytes(b, p, int(lenRealm), e))
+	realm, err := readData(b, p, e)
+	if err != nil {
+		return
+	}
+	princ.Realm = string(realm)
 	for i := 0; i < nc; i++ {
-		l := readInt32(b, p, e)
-		princ.PrincipalName.NameString = append(princ.PrincipalName.NameString, string(readBytes(b, p, int(l), e)))
+		var n []byte
+		n, err = readData(b, p, e)
+		if err != nil {
+			return
+		}
+		princ.PrincipalName.NameString = append(princ.PrincipalName.NameString, string(n))
 	}
-	return princ
+	return princ, nil
 }
 
 func parseCredential(b []byte, p *int, c *CCache, e *binary.ByteOrder) (cred *Credential, err error) {
 	cred = new(Credential)
-	cred.Client = parsePrincipal(b, p, c, e)
-	cred.Server = parsePrincipal(b, p, c, e)
+	cred.Client, err = parsePrincipal(b, p, c, e)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing client principal: %w", err)
+	}
+	cred.Server, err = parsePrincipal(b, p, c, e)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing server principal: %w", err)
+	}
 	key := types.EncryptionKey{}
-	key.KeyType = int32(readInt16(b, p, e))
+	kt, err := readInt16(b, p, e)
+	if err != nil {
+		return nil, err
+	}
 	if c.Version == 3 {
 		//repeated twice in version 3
-		key.KeyType = int32(readInt16(b, p, e))
+		kt, err = readInt16(b, p, e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	key.KeyType = int32(kt)
+	key.KeyValue, err = readData(b, p, e)
+	if err != nil {
+		return nil, err
 	}
-	key.KeyValue = readData(b, p, e)
 	cred.Key = key
-	cred.AuthTime = readTimestamp(b, p, e)
-	cred.StartTime = readTimestamp(b, p, e)
-	cred.EndTime = readTimestamp(b, p, e)
-	cred.RenewTill = readTimestamp(b, p, e)
-	if ik := readInt8(b, p, e); ik == 0 {
-		cred.IsSKey = false
-	} else {
-		cred.IsSKey = true
+	for _, t := range []*time.Time{&cred.AuthTime, &cred.StartTime, &cred.EndTime, &cred.RenewTill} {
+		*t, err = readTimestamp(b, p, e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ik, err := readInt8(b, p, e)
+	if err != nil {
+		return nil, err
 	}
+	cred.IsSKey = ik != 0
 	cred.TicketFlags = types.NewKrbFlags()
-	cred.TicketFlags.Bytes = readBytes(b, p, 4, e)
-	l := int(readInt32(b, p, e))
+	cred.TicketFlags.Bytes, err = readBytes(b, p, 4, e)
+	if err != nil {
+		return nil, err
+	}
+	l, err := readCount(b, p, e)
+	if err != nil {
+		return nil, err
+	}
 	cred.Addresses = make([]types.HostAddress, l, l)
 	for i := range cred.Addresses {
-		cred.Addresses[i] = readAddress(b, p, e)
+		cred.Addresses[i], err = readAddress(b, p, e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	l, err = readCount(b, p, e)
+	if err != nil {
+		return nil, err
 	}
-	l = int(readInt32(b, p, e))
 	cred.AuthData = make([]types.AuthorizationDataEntry, l, l)
 	for i := range cred.AuthData {
-		cred.AuthData[i] = readAuthDataEntry(b, p, e)
+		cred.AuthData[i], err = readAuthDataEntry(b, p, e)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cred.Ticket, err = readData(b, p, e)
+	if err != nil {
+		return nil, err
+	}
+	cred.SecondTicket, err = readData(b, p, e)
+	if err != nil {
+		return nil, err
 	}
-	cred.Ticket = readData(b, p, e)
-	cred.SecondTicket = readData(b, p, e)
 	return
 }
 
+func (h header) marshal(e *binary.ByteOrder) []byte {
+	var fb []byte
+	for _, f := range h.fields {
+		fb = appendInt16(fb, int16(f.tag), e)
+		fb = appendInt16(fb, int16(len(f.value)), e)
+		fb = append(fb, f.value...)
+	}
+	b := appendInt16([]byte{}, int16(len(fb)), e)
+	return append(b, fb...)
+}
+
+func (princ principal) marshal(e *binary.ByteOrder) []byte {
+	var b []byte
+	b = appendInt32(b, princ.PrincipalName.NameType, e)
+	b = appendInt32(b, int32(len(princ.PrincipalName.NameString)), e)
+	b = appendData(b, []byte(princ.Realm), e)
+	for _, n := range princ.PrincipalName.NameString {
+		b = appendData(b, []byte(n), e)
+	}
+	return b
+}
+
+func (cred *Credential) marshal(c *CCache, e *binary.ByteOrder) []byte {
+	var b []byte
+	b = append(b, cred.Client.marshal(e)...)
+	b = append(b, cred.Server.marshal(e)...)
+	b = appendInt16(b, int16(cred.Key.KeyType), e)
+	if c.Version == 3 {
+		//repeated twice in version 3
+		b = appendInt16(b, int16(cred.Key.KeyType), e)
+	}
+	b = appendData(b, cred.Key.KeyValue, e)
+	b = appendTimestamp(b, cred.AuthTime, e)
+	b = appendTimestamp(b, cred.StartTime, e)
+	b = appendTimestamp(b, cred.EndTime, e)
+	b = appendTimestamp(b, cred.RenewTill, e)
+	if cred.IsSKey {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	f := make([]byte, 4)
+	copy(f, cred.TicketFlags.Bytes)
+	b = append(b, f...)
+	b = appendInt32(b, int32(len(cred.Addresses)), e)
+	for _, a := range cred.Addresses {
+		b = appendInt16(b, int16(a.AddrType), e)
+		b = appendData(b, a.Address, e)
+	}
+	b = appendInt32(b, int32(len(cred.AuthData)), e)
+	for _, a := range cred.AuthData {
+		b = appendInt16(b, int16(a.ADType), e)
+		b = appendData(b, a.ADData, e)
+	}
+	b = appendData(b, cred.Ticket, e)
+	b = appendData(b, cred.SecondTicket, e)
+	return b
+}
+
 // GetClientPrincipalName returns a PrincipalName type for the client the credentials cache is for.
 func (c *CCache) GetClientPrincipalName() types.PrincipalName {
 	return c.DefaultPrincipal.PrincipalName
@@ -259,60 +523,116 @@ func (h *headerField) valid() bool {
 	return false
 }
 
-func readData(b []byte, p *int, e *binary.ByteOrder) []byte {
-	l := readInt32(b, p, e)
+func appendInt16(b []byte, i int16, e *binary.ByteOrder) []byte {
+	t := make([]byte, 2)
+	(*e).PutUint16(t, uint16(i))
+	return append(b, t...)
+}
+
+func appendInt32(b []byte, i int32, e *binary.ByteOrder) []byte {
+	t := make([]byte, 4)
+	(*e).PutUint32(t, uint32(i))
+	return append(b, t...)
+}
+
+func appendData(b, d []byte, e *binary.ByteOrder) []byte {
+	b = appendInt32(b, int32(len(d)), e)
+	return append(b, d...)
+}
+
+// Append the bytes representing a timestamp. A zero time is represented as zero.
+func appendTimestamp(b []byte, t time.Time, e *binary.ByteOrder) []byte {
+	if t.IsZero() {
+		return appendInt32(b, 0, e)
+	}
+	return appendInt32(b, int32(t.Unix()), e)
+}
+
+func readData(b []byte, p *int, e *binary.ByteOrder) ([]byte, error) {
+	l, err := readInt32(b, p, e)
+	if err != nil {
+		return nil, err
+	}
 	return readBytes(b, p, int(l), e)
 }
 
-func readAddress(b []byte, p *int, e *binary.ByteOrder) types.HostAddress {
-	a := types.HostAddress{}
-	a.AddrType = int32(readInt16(b, p, e))
-	a.Address = readData(b, p, e)
-	return a
+// Read the number of addresses or authorization data entries that follow. Each takes at least 6 bytes so a count
+// that exceeds the data remaining is rejected before allocating.
+func readCount(b []byte, p *int, e *binary.ByteOrder) (int, error) {
+	l, err := readInt32(b, p, e)
+	if err != nil {
+		return 0, err
+	}
+	if l < 0 || int(l) > (len(b)-*p)/6 {
+		return 0, fmt.Errorf("count of %d exceeds the credential cache data remaining", l)
+	}
+	return int(l), nil
 }
 
-func readAuthDataEntry(b []byte, p *int, e *binary.ByteOrder) types.AuthorizationDataEntry {
-	a := types.AuthorizationDataEntry{}
-	a.ADType = int32(readInt16(b, p, e))
-	a.ADData = readData(b, p, e)
-	return a
+func readAddress(b []byte, p *int, e *binary.ByteOrder) (a types.HostAddress, err error) {
+	t, err := readInt16(b, p, e)
+	if err != nil {
+		return
+	}
+	a.AddrType = int32(t)
+	a.Address, err = readData(b, p, e)
+	return
+}
+
+func readAuthDataEntry(b []byte, p *int, e *binary.ByteOrder) (a types.AuthorizationDataEntry, err error) {
+	t, err := readInt16(b, p, e)
+	if err != nil {
+		return
+	}
+	a.ADType = int32(t)
+	a.ADData, err = readData(b, p, e)
+	return
 }
 
 // Read bytes representing a timestamp.
-func readTimestamp(b []byte, p *int, e *binary.ByteOrder) time.Time {
-	return time.Unix(int64(readInt32(b, p, e)), 0)
+func readTimestamp(b []byte, p *int, e *binary.ByteOrder) (time.Time, error) {
+	i, err := readInt32(b, p, e)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(i), 0), nil
 }
 
 // Read bytes representing an eight bit integer.
-func readInt8(b []byte, p *int, e *binary.ByteOrder) (i int8) {
-	buf := bytes.NewBuffer(b[*p : *p+1])
-	binary.Read(buf, *e, &i)
-	*p++
-	return
+func readInt8(b []byte, p *int, e *binary.ByteOrder) (i int8, err error) {
+	buf, err := readBytes(b, p, 1, e)
+	if err != nil {
+		return
+	}
+	return int8(buf[0]), nil
 }
 
 // Read bytes representing a sixteen bit integer.
-func readInt16(b []byte, p *int, e *binary.ByteOrder) (i int16) {
-	buf := bytes.NewBuffer(b[*p : *p+2])
-	binary.Read(buf, *e, &i)
-	*p += 2
-	return
+func readInt16(b []byte, p *int, e *binary.ByteOrder) (i int16, err error) {
+	buf, err := readBytes(b, p, 2, e)
+	if err != nil {
+		return
+	}
+	return int16((*e).Uint16(buf)), nil
 }
 
 // Read bytes representing a thirty two bit integer.
-func readInt32(b []byte, p *int, e *binary.ByteOrder) (i int32) {
-	buf := bytes.NewBuffer(b[*p : *p+4])
-	binary.Read(buf, *e, &i)
-	*p += 4
-	return
+func readInt32(b []byte, p *int, e *binary.ByteOrder) (i int32, err error) {
+	buf, err := readBytes(b, p, 4, e)
+	if err != nil {
+		return
+	}
+	return int32((*e).Uint32(buf)), nil
 }
 
-func readBytes(b []byte, p *int, s int, e *binary.ByteOrder) []byte {
-	buf := bytes.NewBuffer(b[*p : *p+s])
+func readBytes(b []byte, p *int, s int, e *binary.ByteOrder) ([]byte, error) {
+	if s < 0 || *p < 0 || s > len(b)-*p {
+		return nil, fmt.Errorf("credential cache data too short: %d bytes needed at offset %d of %d", s, *p, len(b))
+	}
 	r := make([]byte, s)
-	binary.Read(buf, *e, &r)
+	copy(r, b[*p:*p+s])
 	*p += s
-	return r
+	return r, nil
 }
 
 func isNativeEndianLittle() bool {
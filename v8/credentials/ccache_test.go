@@ -2,8 +2,13 @@ package credentials
 
 import (
 	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -129,3 +134,188 @@ func TestCCache_GetEntries(t *testing.T) {
 	creds := c.GetEntries()
 	assert.Equal(t, 2, len(creds), "Number of credentials entries not as expected")
 }
+
+func TestCCache_Marshal(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	mb, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshaled bytes not the same as the original")
+}
+
+func TestNewCCache(t *testing.T) {
+	t.Parallel()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	c := NewCCache(cname, "TEST.GOKRB5")
+	tgtpn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5")
+	cred := NewCredential(cname, "TEST.GOKRB5", tgtpn, "TEST.GOKRB5")
+	cred.Key = types.EncryptionKey{KeyType: 18, KeyValue: []byte{1, 2, 3, 4}}
+	cred.AuthTime = time.Unix(1505669592, 0)
+	cred.StartTime = cred.AuthTime
+	cred.EndTime = cred.AuthTime.Add(time.Hour)
+	cred.Ticket = []byte{5, 6, 7}
+	c.AddCredential(cred)
+	// Adding a credential for the same server should replace the existing one.
+	cred2 := NewCredential(cname, "TEST.GOKRB5", tgtpn, "TEST.GOKRB5")
+	*cred2 = *cred
+	cred2.Ticket = []byte{8, 9}
+	c.AddCredential(cred2)
+	assert.Equal(t, 1, len(c.Credentials), "Number of credentials not as expected")
+
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	c2 := new(CCache)
+	err = c2.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing marshaled cache: %v", err)
+	}
+	assert.Equal(t, uint8(4), c2.Version, "Version not as expected")
+	assert.Equal(t, cname, c2.GetClientPrincipalName(), "Client PrincipalName not as expected")
+	assert.Equal(t, "TEST.GOKRB5", c2.GetClientRealm(), "Client realm not as expected")
+	e, ok := c2.GetEntry(tgtpn)
+	if !ok {
+		t.Fatal("TGT credential not found in marshaled cache")
+	}
+	assert.Equal(t, cred2.Key, e.Key, "Key not as expected")
+	assert.Equal(t, cred2.EndTime, e.EndTime, "EndTime not as expected")
+	assert.Equal(t, []byte{8, 9}, e.Ticket, "Ticket not as expected")
+}
+
+func TestCCache_Save(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "krb5cc")
+	// An existing file is replaced.
+	err = ioutil.WriteFile(cpath, []byte("stale"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing existing file: %v", err)
+	}
+	err = c.Save(cpath)
+	if err != nil {
+		t.Fatalf("Error saving cache: %v", err)
+	}
+	assert.Equal(t, cpath, c.Path, "Path not as expected")
+	fi, err := os.Stat(cpath)
+	if err != nil {
+		t.Fatalf("Error getting file info: %v", err)
+	}
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "File permissions not as expected")
+	fb, err := ioutil.ReadFile(cpath)
+	if err != nil {
+		t.Fatalf("Error reading saved cache: %v", err)
+	}
+	assert.Equal(t, b, fb, "Saved bytes not the same as the original")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Error reading temp dir: %v", err)
+	}
+	assert.Equal(t, 1, len(files), "Temporary files left in the cache directory")
+}
+
+func TestCCache_JavaCompatible(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	creds := c.GetEntries()
+	creds[0].Addresses = []types.HostAddress{
+		{AddrType: addrtype.IPv4, Address: []byte{10, 80, 88, 88}},
+		{AddrType: addrtype.NetBios, Address: []byte("HOST")},
+		{AddrType: addrtype.IPv6, Address: []byte{1, 2, 3}},
+	}
+
+	jc := c.JavaCompatible()
+	assert.Equal(t, uint8(3), jc.Version, "Version not as expected")
+	assert.Equal(t, len(creds), len(jc.Credentials), "Configuration entries should have been removed")
+	assert.Equal(t, []types.HostAddress{{AddrType: addrtype.IPv4, Address: []byte{10, 80, 88, 88}}}, jc.Credentials[0].Addresses, "Addresses not as expected")
+	assert.Equal(t, uint8(4), c.Version, "Original cache should not be modified")
+	assert.Equal(t, 3, len(creds[0].Addresses), "Original credential should not be modified")
+
+	jb, err := jc.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	assert.Equal(t, []byte{5, 3}, jb[:2], "Marshaled version not as expected")
+	c2 := new(CCache)
+	err = c2.Unmarshal(jb)
+	if err != nil {
+		t.Fatalf("Error parsing marshaled cache: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, c2.DefaultPrincipal, "Default principal not as expected")
+	for i, cred := range c2.Credentials {
+		assert.Equal(t, jc.Credentials[i].Server, cred.Server, "Server not as expected")
+		assert.Equal(t, jc.Credentials[i].Key, cred.Key, "Key not as expected")
+		assert.Equal(t, jc.Credentials[i].TicketFlags.Bytes, cred.TicketFlags.Bytes, "Ticket flags not as expected")
+		assert.Equal(t, jc.Credentials[i].Ticket, cred.Ticket, "Ticket not as expected")
+	}
+	// A version 3 cache, as written by Java, must round trip unchanged.
+	mb, err := c2.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	assert.Equal(t, jb, mb, "Marshaled bytes not the same as the original")
+}
+
+func BenchmarkCCache_Unmarshal(b *testing.B) {
+	v, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		b.Fatal("Error decoding test data")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := new(CCache)
+		err = c.Unmarshal(v)
+		if err != nil {
+			b.Fatalf("Error parsing cache: %v", err)
+		}
+	}
+}
+
+func BenchmarkCCache_Marshal(b *testing.B) {
+	v, _ := hex.DecodeString(testdata.CCACHE_TEST)
+	c := new(CCache)
+	err := c.Unmarshal(v)
+	if err != nil {
+		b.Fatalf("Error parsing cache: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = c.Marshal()
+		if err != nil {
+			b.Fatalf("Error marshaling cache: %v", err)
+		}
+	}
+}
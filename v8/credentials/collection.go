@@ -0,0 +1,159 @@
+package credentials
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Names used within a credential cache collection directory.
+const (
+	collectionPrimaryFile = "primary"
+	collectionCachePrefix = "tkt"
+)
+
+// CCacheCollection is a directory of credential caches, one per principal, with one of them designated as the
+// primary cache. It is compatible with the DIR credential cache type of MIT Kerberos so that switching the primary
+// cache mirrors kswitch: the caches are the files in the directory whose names begin with "tkt" and the name of the
+// primary cache is held in the file named "primary".
+type CCacheCollection struct {
+	Dir string
+}
+
+// NewCCacheCollection returns the credential cache collection in the directory, which is created with permissions
+// that only allow access by the current user if it does not exist.
+func NewCCacheCollection(dir string) (*CCacheCollection, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create credential cache collection directory: %w", err)
+	}
+	return &CCacheCollection{Dir: dir}, nil
+}
+
+// Caches returns the paths of the credential caches in the collection sorted by name.
+func (c *CCacheCollection) Caches() ([]string, error) {
+	fis, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var p []string
+	for _, fi := range fis {
+		if fi.Mode().IsRegular() && strings.HasPrefix(fi.Name(), collectionCachePrefix) {
+			p = append(p, filepath.Join(c.Dir, fi.Name()))
+		}
+	}
+	sort.Strings(p)
+	return p, nil
+}
+
+// Primary returns the path of the primary credential cache of the collection. If a primary cache has not been set the
+// path of the cache named "tkt" is returned, which may not exist.
+func (c *CCacheCollection) Primary() (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(c.Dir, collectionPrimaryFile))
+	if os.IsNotExist(err) {
+		return filepath.Join(c.Dir, collectionCachePrefix), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read primary credential cache of collection: %w", err)
+	}
+	name := strings.TrimRight(string(b), "\r\n")
+	if !validCacheName(name) {
+		return "", fmt.Errorf("invalid primary credential cache name in collection: %q", name)
+	}
+	return filepath.Join(c.Dir, name), nil
+}
+
+// SetPrimary makes the credential cache at the path, which must be in the collection, the primary cache.
+func (c *CCacheCollection) SetPrimary(cpath string) error {
+	dir, name := filepath.Split(cpath)
+	if filepath.Clean(dir) != filepath.Clean(c.Dir) || !validCacheName(name) {
+		return fmt.Errorf("credential cache %s is not in the collection %s", cpath, c.Dir)
+	}
+	if _, err := os.Stat(cpath); err != nil {
+		return err
+	}
+	// The primary file is replaced atomically so that it is never read partially written.
+	f, err := ioutil.TempFile(c.Dir, collectionPrimaryFile)
+	if err != nil {
+		return fmt.Errorf("could not set primary credential cache: %w", err)
+	}
+	_, err = f.WriteString(name + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(c.Dir, collectionPrimaryFile))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("could not set primary credential cache: %w", err)
+	}
+	return nil
+}
+
+// Find returns the path of the credential cache in the collection for the principal. Caches that cannot be loaded
+// are ignored.
+func (c *CCacheCollection) Find(cname types.PrincipalName, realm string) (string, bool, error) {
+	caches, err := c.Caches()
+	if err != nil {
+		return "", false, err
+	}
+	for _, p := range caches {
+		cc, err := LoadCCache(p)
+		if err != nil {
+			continue
+		}
+		if cc.DefaultPrincipal.Realm == realm && cc.DefaultPrincipal.PrincipalName.Equal(cname) {
+			return p, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Switch makes the credential cache for the principal the primary cache, as kswitch -p does.
+func (c *CCacheCollection) Switch(cname types.PrincipalName, realm string) error {
+	p, ok, err := c.Find(cname, realm)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("no credential cache found for %s@%s in collection %s", cname.PrincipalNameString(), realm, c.Dir)
+	}
+	return c.SetPrimary(p)
+}
+
+// Save writes the credential cache to the collection, replacing the cache for its default principal if there is one.
+// Otherwise the cache is written to the primary cache if that does not exist, or to a new cache. The path the cache
+// is written to is returned. The primary cache is not changed.
+func (c *CCacheCollection) Save(cc *CCache) (string, error) {
+	p, ok, err := c.Find(cc.DefaultPrincipal.PrincipalName, cc.DefaultPrincipal.Realm)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		if p, err = c.Primary(); err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			f, err := ioutil.TempFile(c.Dir, collectionCachePrefix)
+			if err != nil {
+				return "", fmt.Errorf("could not create credential cache in collection: %w", err)
+			}
+			f.Close()
+			p = f.Name()
+		}
+	}
+	if err := cc.Save(p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// validCacheName indicates if the name is that of a credential cache file in a collection.
+func validCacheName(name string) bool {
+	return strings.HasPrefix(name, collectionCachePrefix) && !strings.ContainsAny(name, `/\`)
+}
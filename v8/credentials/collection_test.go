@@ -0,0 +1,81 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCollectionCCache(username string) *CCache {
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, username)
+	c := NewCCache(cname, "TEST.GOKRB5")
+	cred := NewCredential(cname, "TEST.GOKRB5", types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5")
+	cred.AuthTime = time.Unix(1505669592, 0)
+	cred.EndTime = cred.AuthTime.Add(time.Hour)
+	cred.Ticket = []byte{1, 2, 3}
+	c.AddCredential(cred)
+	return c
+}
+
+func TestCCacheCollection(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "gokrb5-collection")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewCCacheCollection(filepath.Join(dir, "cc"))
+	if err != nil {
+		t.Fatalf("error creating collection: %v", err)
+	}
+	p, err := c.Primary()
+	if err != nil {
+		t.Fatalf("error getting primary: %v", err)
+	}
+	assert.Equal(t, filepath.Join(c.Dir, "tkt"), p, "default primary not as expected")
+
+	// The first cache is saved to the default primary and subsequent principals to new caches.
+	p1, err := c.Save(testCollectionCCache("testuser1"))
+	if err != nil {
+		t.Fatalf("error saving cache: %v", err)
+	}
+	assert.Equal(t, filepath.Join(c.Dir, "tkt"), p1, "path of first cache not as expected")
+	p2, err := c.Save(testCollectionCCache("testuser2"))
+	if err != nil {
+		t.Fatalf("error saving cache: %v", err)
+	}
+	assert.NotEqual(t, p1, p2, "second principal should be saved to a new cache")
+	p, err = c.Save(testCollectionCCache("testuser2"))
+	if err != nil {
+		t.Fatalf("error saving cache: %v", err)
+	}
+	assert.Equal(t, p2, p, "cache for an existing principal should be replaced")
+	caches, err := c.Caches()
+	if err != nil {
+		t.Fatalf("error listing caches: %v", err)
+	}
+	assert.Equal(t, 2, len(caches), "number of caches not as expected")
+
+	if err := c.Switch(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), "TEST.GOKRB5"); err != nil {
+		t.Fatalf("error switching principal: %v", err)
+	}
+	p, _ = c.Primary()
+	assert.Equal(t, p2, p, "primary not switched")
+	b, _ := ioutil.ReadFile(filepath.Join(c.Dir, "primary"))
+	assert.Equal(t, filepath.Base(p2)+"\n", string(b), "primary file contents not as expected")
+	if err := c.SetPrimary(p1); err != nil {
+		t.Fatalf("error setting primary: %v", err)
+	}
+	p, _ = c.Primary()
+	assert.Equal(t, p1, p, "primary not set")
+
+	err = c.Switch(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser3"), "TEST.GOKRB5")
+	assert.Error(t, err, "switching to a principal without a cache should fail")
+	assert.Error(t, c.SetPrimary(filepath.Join(dir, "tkt")), "setting a cache outside the collection as primary should fail")
+}
@@ -3,8 +3,12 @@ package credentials
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/x509"
 	"encoding/gob"
 	"encoding/json"
+	"fmt"
+	"sort"
 	"time"
 
 	"github.com/hashicorp/go-uuid"
@@ -17,6 +21,8 @@ import (
 const (
 	// AttributeKeyADCredentials assigned number for AD credentials.
 	AttributeKeyADCredentials = "gokrb5AttributeKeyADCredentials"
+	// AttributeKeyDelegatedCredentials assigned number for delegated credentials.
+	AttributeKeyDelegatedCredentials = "gokrb5AttributeKeyDelegatedCredentials"
 )
 
 // Credentials struct for a user.
@@ -28,8 +34,11 @@ type Credentials struct {
 	realm           string
 	cname           types.PrincipalName
 	keytab          *keytab.Keytab
+	keyHandles      keytab.KeyHandleProvider
 	password        string
 	nthash          string
+	certificate     *x509.Certificate
+	privateKey      crypto.Signer
 	attributes      map[string]interface{}
 	validUntil      time.Time
 	authenticated   bool
@@ -45,19 +54,39 @@ type marshalCredentials struct {
 	Username        string
 	DisplayName     string
 	Realm           string
-	CName           types.PrincipalName `json:"-"`
+	CName           types.PrincipalName
 	Keytab          bool
 	Password        bool
 	NTHash          bool
-	Attributes      map[string]interface{} `json:"-"`
+	Attributes      map[string]interface{}
 	ValidUntil      time.Time
 	Authenticated   bool
 	Human           bool
 	AuthTime        time.Time
-	GroupMembership map[string]bool `json:"-"`
+	GroupMembership map[string]bool
 	SessionID       string
 }
 
+// jsonCredentials is the JSON representation of credentials. The ADCredentials are held in their own field so that
+// they are unmarshaled with their types, while other attributes are unmarshaled as the generic JSON values.
+type jsonCredentials struct {
+	Username        string
+	DisplayName     string
+	Realm           string
+	CName           types.PrincipalName
+	Keytab          bool
+	Password        bool
+	NTHash          bool
+	ValidUntil      time.Time
+	Authenticated   bool
+	Human           bool
+	AuthTime        time.Time
+	GroupMembership map[string]bool `json:",omitempty"`
+	SessionID       string
+	ADCredentials   *ADCredentials         `json:",omitempty"`
+	Attributes      map[string]interface{} `json:",omitempty"`
+}
+
 // ADCredentials contains information obtained from the PAC.
 type ADCredentials struct {
 	EffectiveName       string
@@ -71,6 +100,96 @@ type ADCredentials struct {
 	LogonDomainName     string
 	LogonDomainID       string
 	LogonServer         string
+	// S4U2ProxyTarget and S4UTransitedServices are set from the PAC's S4U_DELEGATION_INFO if the ticket was obtained
+	// by a service on behalf of the user with S4U2Proxy.
+	S4U2ProxyTarget      string
+	S4UTransitedServices []string
+	// UPN and DNSDomainName are set from the PAC's UPN_DNS_INFO, as are SAMAccountName and UserSID if the KDC extended
+	// it with them as KDCs with the November 2021 Windows updates do.
+	UPN            string
+	DNSDomainName  string
+	SAMAccountName string
+	UserSID        string
+	// UserClaims and DeviceClaims are the claims of the user and of the device it authenticated from, set from the
+	// PAC's CLIENT_CLAIMS_INFO and DEVICE_CLAIMS_INFO if the KDC issued claims.
+	UserClaims   []ADClaim
+	DeviceClaims []ADClaim
+	// SIDNames holds the names of the user's SID and group membership SIDs resolved by ResolveSIDs.
+	SIDNames map[string]string
+}
+
+// SIDResolver resolves the names of SIDs, such as the DOMAIN\name of accounts and groups looked up in a directory,
+// returning the names of the SIDs it resolved. SIDs it does not know are left out of the map returned.
+type SIDResolver func(sids []string) (map[string]string, error)
+
+// ResolveSIDs sets the SIDNames of the user's SID and group membership SIDs with the resolver.
+func (a *ADCredentials) ResolveSIDs(r SIDResolver) error {
+	sids := make([]string, 0, len(a.GroupMembershipSIDs)+1)
+	if sid := a.SID(); sid != "" {
+		sids = append(sids, sid)
+	}
+	sids = append(sids, a.GroupMembershipSIDs...)
+	if len(sids) == 0 {
+		return nil
+	}
+	names, err := r(sids)
+	if err != nil {
+		return fmt.Errorf("error resolving SIDs: %w", err)
+	}
+	a.SIDNames = names
+	return nil
+}
+
+// SID returns the user's SID, from the UPN_DNS_INFO if the KDC extended it or otherwise from the logon domain SID and
+// user's RID.
+func (a ADCredentials) SID() string {
+	if a.UserSID != "" {
+		return a.UserSID
+	}
+	if a.LogonDomainID == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%d", a.LogonDomainID, a.UserID)
+}
+
+// GroupNames returns the resolved names of the user's groups, in the order of the GroupMembershipSIDs. Groups whose
+// SIDs were not resolved are left out.
+func (a ADCredentials) GroupNames() []string {
+	var names []string
+	for _, sid := range a.GroupMembershipSIDs {
+		if n, ok := a.SIDNames[sid]; ok {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// ADClaim is a claim of an Active Directory claims set, [MS-ADTS] section 2.2.18. Only the values of the claim's type
+// are set.
+type ADClaim struct {
+	ID           string
+	Int64Values  []int64
+	Uint64Values []uint64
+	StringValues []string
+	BoolValues   []bool
+}
+
+// Claim returns the claim with the ID from the claims.
+func Claim(claims []ADClaim, id string) (ADClaim, bool) {
+	for _, c := range claims {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return ADClaim{}, false
+}
+
+// DelegatedCredentials contains the credentials the client delegated to the service in the GSS-API authenticator
+// checksum of its AP_REQ, RFC 4121 section 4.1.1. KRBCred is the marshaled KRB_CRED, which holds the client's forwarded
+// TGT, and Key is the key of the AP exchange which decrypts it.
+type DelegatedCredentials struct {
+	KRBCred []byte
+	Key     types.EncryptionKey
 }
 
 // New creates a new Credentials instance.
@@ -103,6 +222,7 @@ func NewFromPrincipalName(cname types.PrincipalName, realm string) *Credentials
 func (c *Credentials) WithKeytab(kt *keytab.Keytab) *Credentials {
 	c.keytab = kt
 	c.password = ""
+	c.keyHandles = nil
 	return c
 }
 
@@ -123,6 +243,7 @@ func (c *Credentials) HasKeytab() bool {
 func (c *Credentials) WithPassword(password string) *Credentials {
 	c.password = password
 	c.keytab = keytab.New() // clear any keytab
+	c.keyHandles = nil
 	return c
 }
 
@@ -144,6 +265,7 @@ func (c *Credentials) WithNTHash(hash string) *Credentials {
 	c.nthash = hash
 	c.password = ""
 	c.keytab = keytab.New() // clear any keytab
+	c.keyHandles = nil
 	return c
 }
 
@@ -160,6 +282,54 @@ func (c *Credentials) HasNTHash() bool {
 	return false
 }
 
+// WithCertificate sets the X.509 certificate and its private key in the Credentials struct for PKINIT
+// pre-authentication.
+func (c *Credentials) WithCertificate(cert *x509.Certificate, key crypto.Signer) *Credentials {
+	c.certificate = cert
+	c.privateKey = key
+	c.password = ""
+	c.nthash = ""
+	c.keytab = keytab.New() // clear any keytab
+	c.keyHandles = nil
+	return c
+}
+
+// WithKeyHandles sets the provider of handles to the client's long-term keys in the Credentials struct, for keys held
+// outside of the process such as in an HSM. The AS exchange pre-authenticates and decrypts the AS_REP with the key
+// handles rather than the key values.
+func (c *Credentials) WithKeyHandles(hp keytab.KeyHandleProvider) *Credentials {
+	c.keyHandles = hp
+	c.password = ""
+	c.nthash = ""
+	c.keytab = keytab.New() // clear any keytab
+	return c
+}
+
+// KeyHandles returns the credential's provider of key handles.
+func (c *Credentials) KeyHandles() keytab.KeyHandleProvider {
+	return c.keyHandles
+}
+
+// HasKeyHandles queries if the Credentials has a provider of key handles defined.
+func (c *Credentials) HasKeyHandles() bool {
+	return c.keyHandles != nil
+}
+
+// Certificate returns the credential's X.509 certificate.
+func (c *Credentials) Certificate() *x509.Certificate {
+	return c.certificate
+}
+
+// PrivateKey returns the private key of the credential's X.509 certificate.
+func (c *Credentials) PrivateKey() crypto.Signer {
+	return c.privateKey
+}
+
+// HasCertificate queries if the Credentials has an X.509 certificate and its private key defined.
+func (c *Credentials) HasCertificate() bool {
+	return c.certificate != nil && c.privateKey != nil
+}
+
 // SetValidUntil sets the expiry time of the credentials
 func (c *Credentials) SetValidUntil(t time.Time) {
 	c.validUntil = t
@@ -177,6 +347,9 @@ func (c *Credentials) SetADCredentials(a ADCredentials) {
 	for i := range a.GroupMembershipSIDs {
 		c.AddAuthzAttribute(a.GroupMembershipSIDs[i])
 	}
+	for _, n := range a.GroupNames() {
+		c.AddAuthzAttribute(n)
+	}
 }
 
 // GetADCredentials returns ADCredentials attributes sorted in the credential
@@ -187,6 +360,17 @@ func (c *Credentials) GetADCredentials() ADCredentials {
 	return ADCredentials{}
 }
 
+// SetDelegatedCredentials adds the credentials delegated by the client to the credentials.
+func (c *Credentials) SetDelegatedCredentials(d DelegatedCredentials) {
+	c.SetAttribute(AttributeKeyDelegatedCredentials, d)
+}
+
+// DelegatedCredentials returns the credentials delegated by the client and whether there are any.
+func (c *Credentials) DelegatedCredentials() (DelegatedCredentials, bool) {
+	d, ok := c.attributes[AttributeKeyDelegatedCredentials].(DelegatedCredentials)
+	return d, ok
+}
+
 // Methods to implement goidentity.Identity interface
 
 // UserName returns the credential's username.
@@ -259,7 +443,7 @@ func (c *Credentials) SetAuthTime(t time.Time) {
 	c.authTime = t
 }
 
-// AuthzAttributes returns the credentials authorizing attributes.
+// AuthzAttributes returns the credentials authorizing attributes, sorted.
 func (c *Credentials) AuthzAttributes() []string {
 	s := make([]string, len(c.groupMembership))
 	i := 0
@@ -267,6 +451,7 @@ func (c *Credentials) AuthzAttributes() []string {
 		s[i] = a
 		i++
 	}
+	sort.Strings(s)
 	return s
 }
 
@@ -357,6 +542,16 @@ func (c *Credentials) RemoveAttribute(k string) {
 func (c *Credentials) Marshal() ([]byte, error) {
 	gob.Register(map[string]interface{}{})
 	gob.Register(ADCredentials{})
+	// The delegated credentials hold the key of the AP exchange and are not marshaled.
+	attributes := c.attributes
+	if _, ok := attributes[AttributeKeyDelegatedCredentials]; ok {
+		attributes = make(map[string]interface{}, len(c.attributes))
+		for k, v := range c.attributes {
+			if k != AttributeKeyDelegatedCredentials {
+				attributes[k] = v
+			}
+		}
+	}
 	buf := new(bytes.Buffer)
 	enc := gob.NewEncoder(buf)
 	mc := marshalCredentials{
@@ -367,7 +562,7 @@ func (c *Credentials) Marshal() ([]byte, error) {
 		Keytab:          c.HasKeytab(),
 		Password:        c.HasPassword(),
 		NTHash:          c.HasNTHash(),
-		Attributes:      c.attributes,
+		Attributes:      attributes,
 		ValidUntil:      c.validUntil,
 		Authenticated:   c.authenticated,
 		Human:           c.human,
@@ -404,28 +599,113 @@ func (c *Credentials) Unmarshal(b []byte) error {
 	c.authTime = mc.AuthTime
 	c.groupMembership = mc.GroupMembership
 	c.sessionID = mc.SessionID
+	c.initMaps()
 	return nil
 }
 
+// initMaps creates the attributes and group membership maps if they are nil, as they are when empty maps have been
+// marshaled.
+func (c *Credentials) initMaps() {
+	if c.attributes == nil {
+		c.attributes = make(map[string]interface{})
+	}
+	if c.groupMembership == nil {
+		c.groupMembership = make(map[string]bool)
+	}
+}
+
+// String returns a description of the Credentials that does not include the password, NT hash or keytab keys so that
+// it can be logged safely.
+func (c *Credentials) String() string {
+	return fmt.Sprintf("{Username: %s Realm: %s CName: %s Keytab: %t Password: %t NTHash: %t Authenticated: %t ValidUntil: %v SessionID: %s}",
+		c.username, c.realm, c.cname.PrincipalNameString(), c.HasKeytab(), c.HasPassword(), c.HasNTHash(), c.authenticated, c.validUntil, c.sessionID)
+}
+
+// GoString returns the same description as String so that the password, NT hash and keytab keys are not included when
+// the Credentials are formatted with %#v.
+func (c *Credentials) GoString() string {
+	return c.String()
+}
+
+// DebugDump returns a description of the Credentials including the password, NT hash and keytab keys if the
+// types.DebugDumpEnvVar environment variable is set to "1". Otherwise the secrets are not included as for String.
+func (c *Credentials) DebugDump() string {
+	if !types.DebugDumpEnabled() {
+		return c.String()
+	}
+	s := fmt.Sprintf("{Username: %s Realm: %s CName: %s Password: %q NTHash: %q Authenticated: %t ValidUntil: %v SessionID: %s}",
+		c.username, c.realm, c.cname.PrincipalNameString(), c.password, c.nthash, c.authenticated, c.validUntil, c.sessionID)
+	if c.HasKeytab() {
+		s += "\n" + c.keytab.DebugDump()
+	}
+	return s
+}
+
 // JSON return details of the Credentials in a JSON format.
 func (c *Credentials) JSON() (string, error) {
-	mc := marshalCredentials{
-		Username:      c.username,
-		DisplayName:   c.displayName,
-		Realm:         c.realm,
-		CName:         c.cname,
-		Keytab:        c.HasKeytab(),
-		Password:      c.HasPassword(),
-		NTHash:        c.HasNTHash(),
-		ValidUntil:    c.validUntil,
-		Authenticated: c.authenticated,
-		Human:         c.human,
-		AuthTime:      c.authTime,
-		SessionID:     c.sessionID,
-	}
-	b, err := json.MarshalIndent(mc, "", "  ")
+	b, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return "", err
 	}
 	return string(b), nil
 }
+
+// MarshalJSON marshals the Credentials into JSON, including their ADCredentials and other attributes. As with
+// Marshal, the password, NT hash, keys and delegated credentials are not included.
+func (c *Credentials) MarshalJSON() ([]byte, error) {
+	jc := jsonCredentials{
+		Username:        c.username,
+		DisplayName:     c.displayName,
+		Realm:           c.realm,
+		CName:           c.cname,
+		Keytab:          c.HasKeytab(),
+		Password:        c.HasPassword(),
+		NTHash:          c.HasNTHash(),
+		ValidUntil:      c.validUntil,
+		Authenticated:   c.authenticated,
+		Human:           c.human,
+		AuthTime:        c.authTime,
+		GroupMembership: c.groupMembership,
+		SessionID:       c.sessionID,
+	}
+	for k, v := range c.attributes {
+		switch k {
+		case AttributeKeyDelegatedCredentials:
+		case AttributeKeyADCredentials:
+			if a, ok := v.(ADCredentials); ok {
+				jc.ADCredentials = &a
+			}
+		default:
+			if jc.Attributes == nil {
+				jc.Attributes = make(map[string]interface{})
+			}
+			jc.Attributes[k] = v
+		}
+	}
+	return json.Marshal(jc)
+}
+
+// UnmarshalJSON unmarshals the JSON of Credentials marshaled with MarshalJSON. Attributes other than the ADCredentials
+// are unmarshaled as the generic JSON values.
+func (c *Credentials) UnmarshalJSON(b []byte) error {
+	var jc jsonCredentials
+	if err := json.Unmarshal(b, &jc); err != nil {
+		return err
+	}
+	c.username = jc.Username
+	c.displayName = jc.DisplayName
+	c.realm = jc.Realm
+	c.cname = jc.CName
+	c.validUntil = jc.ValidUntil
+	c.authenticated = jc.Authenticated
+	c.human = jc.Human
+	c.authTime = jc.AuthTime
+	c.groupMembership = jc.GroupMembership
+	c.sessionID = jc.SessionID
+	c.attributes = jc.Attributes
+	c.initMaps()
+	if jc.ADCredentials != nil {
+		c.attributes[AttributeKeyADCredentials] = *jc.ADCredentials
+	}
+	return nil
+}
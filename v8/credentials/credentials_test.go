@@ -1,9 +1,17 @@
 package credentials
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,4 +33,178 @@ func TestCredentials_Marshal(t *testing.T) {
 	if err != nil {
 		t.Fatalf("could not unmarshal credetials: %v", err)
 	}
+	// The maps of unmarshaled credentials can be added to.
+	credum.AddAuthzAttribute("group1")
+	credum.SetAttribute("key", "value")
+}
+
+// testIdentity returns authenticated credentials with ADCredentials.
+func testIdentity() *Credentials {
+	c := New("testuser1", "TEST.GOKRB5")
+	c.SetAuthenticated(true)
+	c.SetAuthTime(time.Date(2021, 11, 9, 10, 30, 0, 123000000, time.UTC))
+	c.SetValidUntil(time.Date(2021, 11, 9, 20, 30, 0, 0, time.UTC))
+	c.SetADCredentials(ADCredentials{
+		EffectiveName:       "testuser1",
+		FullName:            "Test User1",
+		UserID:              1105,
+		PrimaryGroupID:      513,
+		LogOnTime:           time.Date(2021, 11, 9, 10, 29, 58, 0, time.UTC),
+		GroupMembershipSIDs: []string{"S-1-5-21-1-2-3-513", "S-1-5-21-1-2-3-1108"},
+		LogonDomainName:     "TEST",
+		LogonDomainID:       "S-1-5-21-1-2-3",
+		UserClaims:          []ADClaim{{ID: "ad://ext/department", StringValues: []string{"Engineering"}}},
+		SIDNames:            map[string]string{"S-1-5-21-1-2-3-1108": `TEST\engineers`},
+	})
+	c.SetAttribute("custom", "value")
+	return c
+}
+
+// assertIdentity asserts the unmarshaled credentials are those of testIdentity.
+func assertIdentity(t *testing.T, c *Credentials) {
+	exp := testIdentity()
+	assert.Equal(t, exp.UserName(), c.UserName(), "username not as expected")
+	assert.Equal(t, exp.DisplayName(), c.DisplayName(), "display name not as expected")
+	assert.Equal(t, exp.Realm(), c.Realm(), "realm not as expected")
+	assert.Equal(t, exp.CName(), c.CName(), "cname not as expected")
+	assert.Equal(t, exp.SessionID() != "", c.SessionID() != "", "session ID not as expected")
+	assert.True(t, c.Authenticated(), "credentials not authenticated")
+	assert.True(t, exp.AuthTime().Equal(c.AuthTime()), "auth time not as expected")
+	assert.True(t, exp.ValidUntil().Equal(c.ValidUntil()), "valid until not as expected")
+	assert.Equal(t, exp.AuthzAttributes(), c.AuthzAttributes(), "authz attributes not as expected")
+	ad := c.GetADCredentials()
+	assert.Equal(t, "Test User1", ad.FullName, "AD credentials not as expected")
+	assert.True(t, exp.GetADCredentials().LogOnTime.Equal(ad.LogOnTime), "logon time not as expected")
+	assert.Equal(t, exp.GetADCredentials().GroupMembershipSIDs, ad.GroupMembershipSIDs, "group SIDs not as expected")
+	assert.Equal(t, exp.GetADCredentials().UserClaims, ad.UserClaims, "claims not as expected")
+	assert.Equal(t, []string{`TEST\engineers`}, ad.GroupNames(), "group names not as expected")
+	assert.Equal(t, "value", c.Attributes()["custom"], "attribute not as expected")
+}
+
+func TestCredentials_MarshalIdentity(t *testing.T) {
+	t.Parallel()
+	c := testIdentity()
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("could not marshal credentials: %v", err)
+	}
+	var cu Credentials
+	if err := cu.Unmarshal(b); err != nil {
+		t.Fatalf("could not unmarshal credentials: %v", err)
+	}
+	assertIdentity(t, &cu)
+}
+
+func TestCredentials_JSON(t *testing.T) {
+	t.Parallel()
+	c := testIdentity()
+	c.SetDelegatedCredentials(DelegatedCredentials{
+		KRBCred: []byte{0x76, 0x00},
+		Key:     types.EncryptionKey{KeyType: 18, KeyValue: []byte("0123456789abcdef0123456789abcdef")},
+	})
+	c.WithPassword("passwordvalue")
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("could not marshal credentials: %v", err)
+	}
+	assert.NotContains(t, string(b), "passwordvalue", "password marshaled")
+	assert.NotContains(t, string(b), "KRBCred", "delegated credentials marshaled")
+	var cu Credentials
+	if err := json.Unmarshal(b, &cu); err != nil {
+		t.Fatalf("could not unmarshal credentials: %v", err)
+	}
+	assertIdentity(t, &cu)
+	_, ok := cu.DelegatedCredentials()
+	assert.False(t, ok, "delegated credentials unmarshaled")
+	assert.False(t, cu.HasPassword(), "password unmarshaled")
+
+	j, err := c.JSON()
+	if err != nil {
+		t.Fatalf("could not get JSON of credentials: %v", err)
+	}
+	assert.Contains(t, j, `"Password": true`, "JSON not as expected")
+}
+
+func TestADCredentials_ResolveSIDs(t *testing.T) {
+	t.Parallel()
+	ad := ADCredentials{
+		UserID:              1105,
+		LogonDomainID:       "S-1-5-21-1-2-3",
+		GroupMembershipSIDs: []string{"S-1-5-21-1-2-3-513", "S-1-5-21-1-2-3-1108", "S-1-5-21-1-2-3-1109"},
+	}
+	assert.Equal(t, "S-1-5-21-1-2-3-1105", ad.SID(), "SID not as expected")
+	var resolved []string
+	err := ad.ResolveSIDs(func(sids []string) (map[string]string, error) {
+		resolved = sids
+		return map[string]string{
+			"S-1-5-21-1-2-3-1105": `TEST\testuser1`,
+			"S-1-5-21-1-2-3-1109": `TEST\admins`,
+			"S-1-5-21-1-2-3-513":  `TEST\Domain Users`,
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("error resolving SIDs: %v", err)
+	}
+	assert.Equal(t, []string{"S-1-5-21-1-2-3-1105", "S-1-5-21-1-2-3-513", "S-1-5-21-1-2-3-1108", "S-1-5-21-1-2-3-1109"}, resolved, "SIDs resolved not as expected")
+	assert.Equal(t, []string{`TEST\Domain Users`, `TEST\admins`}, ad.GroupNames(), "group names not as expected")
+
+	c := New("testuser1", "TEST")
+	c.SetADCredentials(ad)
+	assert.True(t, c.Authorized(`TEST\admins`), "group name not an authz attribute")
+	assert.Equal(t, []string{"S-1-5-21-1-2-3-1108", "S-1-5-21-1-2-3-1109", "S-1-5-21-1-2-3-513", `TEST\Domain Users`, `TEST\admins`}, c.AuthzAttributes(), "authz attributes not as expected")
+
+	ad.UserSID = "S-1-5-21-1-2-3-1199"
+	assert.Equal(t, "S-1-5-21-1-2-3-1199", ad.SID(), "SID from UPN_DNS_INFO not used")
+	err = ad.ResolveSIDs(func(sids []string) (map[string]string, error) {
+		return nil, errors.New("directory unavailable")
+	})
+	assert.Error(t, err, "resolver error not returned")
+}
+
+func TestCredentials_MarshalDelegatedCredentials(t *testing.T) {
+	t.Parallel()
+	cred := New("testuser1", "TEST.GOKRB5")
+	cred.SetDelegatedCredentials(DelegatedCredentials{
+		KRBCred: []byte{0x76, 0x00},
+		Key:     types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)},
+	})
+	_, ok := cred.DelegatedCredentials()
+	assert.True(t, ok, "delegated credentials not returned")
+	b, err := cred.Marshal()
+	if err != nil {
+		t.Fatalf("could not marshal credentials: %v", err)
+	}
+	_, ok = cred.DelegatedCredentials()
+	assert.True(t, ok, "delegated credentials removed by marshaling")
+	var credum Credentials
+	err = credum.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("could not unmarshal credentials: %v", err)
+	}
+	_, ok = credum.DelegatedCredentials()
+	assert.False(t, ok, "delegated credentials should not be marshaled")
+}
+
+func TestCredentials_String(t *testing.T) {
+	kt := keytab.New()
+	err := kt.AddEntry("testuser1", "TEST.GOKRB5", "passwordvalue", time.Unix(1600000000, 0), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding keytab entry: %v", err)
+	}
+	key := fmt.Sprintf("%x", kt.Entries[0].Key.KeyValue)
+	c := New("testuser1", "TEST.GOKRB5").WithPassword("passwordvalue")
+	for _, f := range []string{"%v", "%+v", "%#v", "%s"} {
+		assert.NotContains(t, fmt.Sprintf(f, c), "passwordvalue", "password in %s output", f)
+	}
+	assert.Contains(t, c.String(), "Username: testuser1", "username not in output")
+	c.WithKeytab(kt)
+	for _, f := range []string{"%v", "%+v", "%#v"} {
+		assert.NotContains(t, fmt.Sprintf(f, c), key, "keytab key in %s output", f)
+	}
+
+	os.Unsetenv(types.DebugDumpEnvVar)
+	assert.Equal(t, c.String(), c.DebugDump(), "secrets should not be included unless enabled")
+	os.Setenv(types.DebugDumpEnvVar, "1")
+	defer os.Unsetenv(types.DebugDumpEnvVar)
+	assert.Contains(t, c.DebugDump(), key, "keytab key not in debug dump")
 }
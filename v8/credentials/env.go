@@ -0,0 +1,98 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CCacheEnvVar is the environment variable of the name of the credential cache.
+const CCacheEnvVar = "KRB5CCNAME"
+
+// Prefixes of the names of the credential cache types supported.
+const (
+	fileCCachePrefix = "FILE:"
+	dirCCachePrefix  = "DIR:"
+	kcmCCachePrefix  = "KCM:"
+)
+
+// DefaultCCacheName returns the name of the credential cache of the KRB5CCNAME environment variable or, if it is not
+// set, the default of MIT krb5, the file /tmp/krb5cc_<uid> of the user.
+func DefaultCCacheName() string {
+	if n := os.Getenv(CCacheEnvVar); n != "" {
+		return n
+	}
+	return fmt.Sprintf("%s/tmp/krb5cc_%d", fileCCachePrefix, os.Getuid())
+}
+
+// CCachePath returns the path of the file of the credential cache named, a path or a name of the FILE or DIR types. A
+// name of the form DIR:directory is that of the primary cache of the collection in the directory while DIR::path names
+// a specific cache of a collection. The name of DefaultCCacheName is used if the name is empty.
+func CCachePath(name string) (string, error) {
+	if name == "" {
+		name = DefaultCCacheName()
+	}
+	switch {
+	case strings.HasPrefix(name, dirCCachePrefix+":"):
+		return strings.TrimPrefix(name, dirCCachePrefix+":"), nil
+	case strings.HasPrefix(name, dirCCachePrefix):
+		c := &CCacheCollection{Dir: strings.TrimPrefix(name, dirCCachePrefix)}
+		return c.Primary()
+	case strings.HasPrefix(name, fileCCachePrefix):
+		return strings.TrimPrefix(name, fileCCachePrefix), nil
+	case strings.HasPrefix(name, kcmCCachePrefix):
+		return "", fmt.Errorf("KCM credential cache %s is not a file, it is loaded with LoadCCacheName", name)
+	case strings.Index(name, ":") > 0 && !filepath.IsAbs(name):
+		return "", fmt.Errorf("only FILE, DIR and KCM credential cache types are supported: %s", name)
+	}
+	return name, nil
+}
+
+// LoadCCacheName loads the credential cache named, a path or a name of the FILE, DIR or KCM types, or that of
+// DefaultCCacheName if the name is empty. A name of the form KCM: is that of the user's default cache held by the KCM
+// daemon listening on DefaultKCMSocket while KCM:name names a specific cache.
+func LoadCCacheName(name string) (*CCache, error) {
+	if name == "" {
+		name = DefaultCCacheName()
+	}
+	if strings.HasPrefix(name, kcmCCachePrefix) {
+		return NewKCM("").Load(strings.TrimPrefix(name, kcmCCachePrefix))
+	}
+	p, err := CCachePath(name)
+	if err != nil {
+		return nil, err
+	}
+	return LoadCCache(p)
+}
+
+// SaveCCacheName writes the credential cache to the cache named, of the same forms as those of LoadCCacheName. For a
+// name of the form DIR:directory the cache is written to the collection in the directory, which is created if it does
+// not exist, replacing the cache of its default principal or adding a new cache as CCacheCollection.Save does.
+func SaveCCacheName(name string, c *CCache) error {
+	if name == "" {
+		name = DefaultCCacheName()
+	}
+	switch {
+	case strings.HasPrefix(name, kcmCCachePrefix):
+		return NewKCM("").Save(strings.TrimPrefix(name, kcmCCachePrefix), c)
+	case strings.HasPrefix(name, dirCCachePrefix) && !strings.HasPrefix(name, dirCCachePrefix+":"):
+		col, err := NewCCacheCollection(strings.TrimPrefix(name, dirCCachePrefix))
+		if err != nil {
+			return err
+		}
+		_, err = col.Save(c)
+		return err
+	}
+	p, err := CCachePath(name)
+	if err != nil {
+		return err
+	}
+	return c.Save(p)
+}
+
+// LoadDefaultCCache loads the credential cache of the KRB5CCNAME environment variable or, if it is not set, the default
+// location.
+func LoadDefaultCCache() (*CCache, error) {
+	return LoadCCacheName("")
+}
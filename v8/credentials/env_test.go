@@ -0,0 +1,102 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCCachePath(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "TEST-gokrb5-env")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	for name, want := range map[string]string{
+		"/tmp/krb5cc_test":                   "/tmp/krb5cc_test",
+		"FILE:/tmp/krb5cc_test":              "/tmp/krb5cc_test",
+		"DIR:" + dir:                         filepath.Join(dir, "tkt"),
+		"DIR::" + filepath.Join(dir, "tkt1"): filepath.Join(dir, "tkt1"),
+	} {
+		p, err := CCachePath(name)
+		if err != nil {
+			t.Errorf("error getting path of %s: %v", name, err)
+			continue
+		}
+		assert.Equal(t, want, p, "path of %s not as expected", name)
+	}
+	_, err = CCachePath("KCM:1000")
+	assert.Error(t, err, "KCM credential cache should not have a path")
+	_, err = CCachePath("KEYRING:persistent:1000")
+	assert.Error(t, err, "unsupported credential cache type should be an error")
+}
+
+func TestLoadDefaultCCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TEST-gokrb5-env")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatalf("error decoding test data: %v", err)
+	}
+	cpath := filepath.Join(dir, "krb5cc")
+	if err := ioutil.WriteFile(cpath, b, 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	defer os.Unsetenv(CCacheEnvVar)
+
+	os.Unsetenv(CCacheEnvVar)
+	assert.Equal(t, fmt.Sprintf("FILE:/tmp/krb5cc_%d", os.Getuid()), DefaultCCacheName(), "default name not as expected")
+	os.Setenv(CCacheEnvVar, "FILE:"+cpath)
+	assert.Equal(t, "FILE:"+cpath, DefaultCCacheName(), "name of the environment variable not as expected")
+	c, err := LoadDefaultCCache()
+	if err != nil {
+		t.Fatalf("error loading default credential cache: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.DefaultPrincipal.Realm, "credential cache not as expected")
+}
+
+func TestSaveCCacheName(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "TEST-gokrb5-env")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	coll := filepath.Join(dir, "collection")
+	for _, user := range []string{"testuser1", "testuser2", "testuser1"} {
+		if err := SaveCCacheName("DIR:"+coll, testCollectionCCache(user)); err != nil {
+			t.Fatalf("error saving credential cache of %s to collection: %v", user, err)
+		}
+	}
+	caches, err := (&CCacheCollection{Dir: coll}).Caches()
+	if err != nil {
+		t.Fatalf("error listing collection: %v", err)
+	}
+	assert.Equal(t, 2, len(caches), "a cache per principal should be written to the collection")
+	c, err := LoadCCacheName("DIR:" + coll)
+	if err != nil {
+		t.Fatalf("error loading primary cache: %v", err)
+	}
+	assert.Equal(t, "testuser1", c.DefaultPrincipal.PrincipalName.PrincipalNameString(), "primary cache not as expected")
+
+	cpath := filepath.Join(dir, "krb5cc")
+	if err := SaveCCacheName("FILE:"+cpath, testCollectionCCache("testuser2")); err != nil {
+		t.Fatalf("error saving credential cache file: %v", err)
+	}
+	c, err = LoadCCacheName(cpath)
+	if err != nil {
+		t.Fatalf("error loading credential cache file: %v", err)
+	}
+	assert.Equal(t, "testuser2", c.DefaultPrincipal.PrincipalName.PrincipalNameString(), "credential cache not as expected")
+	assert.Error(t, SaveCCacheName("KEYRING:persistent:1000", c), "unsupported credential cache type should be an error")
+}
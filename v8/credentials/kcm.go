@@ -0,0 +1,270 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultKCMSocket is the default path of the unix socket of the KCM daemon, as used by MIT krb5 and sssd-kcm.
+const DefaultKCMSocket = "/var/run/.heim_org.h5l.kcm-socket"
+
+// KCM protocol version and operation codes, as defined by Heimdal and MIT krb5.
+const (
+	kcmProtocolVersionMajor = 2
+	kcmProtocolVersionMinor = 0
+
+	kcmOpGenNew           = 3
+	kcmOpInitialize       = 4
+	kcmOpDestroy          = 5
+	kcmOpStore            = 6
+	kcmOpGetPrincipal     = 8
+	kcmOpGetCredUUIDList  = 9
+	kcmOpGetCredByUUID    = 10
+	kcmOpGetCacheUUIDList = 18
+	kcmOpGetCacheByUUID   = 19
+	kcmOpGetDefaultCache  = 20
+	kcmOpSetDefaultCache  = 21
+
+	kcmUUIDLength     = 16
+	kcmMaxReplySize   = 10 * 1024 * 1024
+	kcmDefaultTimeout = 5 * time.Second
+)
+
+// Error codes of KCM replies, those of the MIT krb5 error table.
+const (
+	kcmErrCCacheNotFound = -1765328243 // KRB5_CC_NOTFOUND
+	kcmErrCCacheEnd      = -1765328242 // KRB5_CC_END
+	kcmErrCCacheNoFile   = -1765328189 // KRB5_FCC_NOFILE
+)
+
+// ErrKCMCacheNotFound is matched with errors.Is by the errors of the KCM daemon reporting that a cache does not exist.
+var ErrKCMCacheNotFound = errors.New("KCM credential cache not found")
+
+// KCMError is an error code returned by the KCM daemon.
+type KCMError struct {
+	Code int32
+}
+
+// Error implements the error interface.
+func (e KCMError) Error() string {
+	return fmt.Sprintf("KCM daemon returned error code %d", e.Code)
+}
+
+// Is reports whether the target is ErrKCMCacheNotFound and the error code that of a cache that does not exist.
+func (e KCMError) Is(target error) bool {
+	return target == ErrKCMCacheNotFound && (e.Code == kcmErrCCacheNotFound || e.Code == kcmErrCCacheNoFile)
+}
+
+// KCM is a client of a KCM credential cache daemon, such as sssd-kcm or Heimdal's kcm, which holds the credential
+// caches of the KCM type, named KCM:<name>, on behalf of the users of the host. Each request is made over a new
+// connection to the daemon's unix socket, which identifies the user by the credentials of the connection.
+type KCM struct {
+	Socket  string
+	Timeout time.Duration
+}
+
+// NewKCM returns a client of the KCM daemon listening on the unix socket at the path, or DefaultKCMSocket if it is
+// empty.
+func NewKCM(socket string) *KCM {
+	if socket == "" {
+		socket = DefaultKCMSocket
+	}
+	return &KCM{Socket: socket, Timeout: kcmDefaultTimeout}
+}
+
+// DefaultCache returns the name of the user's default cache, as used for the name KCM: without a cache name.
+func (k *KCM) DefaultCache() (string, error) {
+	r, err := k.call(kcmOpGetDefaultCache, nil)
+	if err != nil {
+		return "", err
+	}
+	return readKCMString(r)
+}
+
+// SetDefaultCache makes the named cache the user's default cache, as kswitch does.
+func (k *KCM) SetDefaultCache(name string) error {
+	_, err := k.call(kcmOpSetDefaultCache, kcmString(name))
+	return err
+}
+
+// NewCache returns the name of a new, empty, cache of the user.
+func (k *KCM) NewCache() (string, error) {
+	r, err := k.call(kcmOpGenNew, nil)
+	if err != nil {
+		return "", err
+	}
+	return readKCMString(r)
+}
+
+// Caches returns the names of the user's caches.
+func (k *KCM) Caches() ([]string, error) {
+	r, err := k.call(kcmOpGetCacheUUIDList, nil)
+	if err != nil {
+		return nil, err
+	}
+	uuids, err := splitKCMUUIDs(r)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(uuids))
+	for _, id := range uuids {
+		r, err := k.call(kcmOpGetCacheByUUID, id)
+		if err != nil {
+			if errors.Is(err, ErrKCMCacheNotFound) {
+				// The cache was destroyed since it was listed.
+				continue
+			}
+			return nil, err
+		}
+		name, err := readKCMString(r)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Load returns the credentials of the named cache, or of the user's default cache if the name is empty.
+func (k *KCM) Load(name string) (*CCache, error) {
+	var err error
+	if name == "" {
+		if name, err = k.DefaultCache(); err != nil {
+			return nil, err
+		}
+	}
+	c := &CCache{Version: 4}
+	endian := binary.ByteOrder(binary.BigEndian)
+	r, err := k.call(kcmOpGetPrincipal, kcmString(name))
+	if err != nil {
+		return nil, fmt.Errorf("could not get the principal of KCM credential cache %s: %w", name, err)
+	}
+	var p int
+	if c.DefaultPrincipal, err = parsePrincipal(r, &p, c, &endian); err != nil {
+		return nil, fmt.Errorf("error parsing principal of KCM credential cache %s: %w", name, err)
+	}
+	r, err = k.call(kcmOpGetCredUUIDList, kcmString(name))
+	if err != nil {
+		return nil, fmt.Errorf("could not list the credentials of KCM credential cache %s: %w", name, err)
+	}
+	uuids, err := splitKCMUUIDs(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range uuids {
+		r, err := k.call(kcmOpGetCredByUUID, append(kcmString(name), id...))
+		if err != nil {
+			var kerr KCMError
+			if errors.As(err, &kerr) && kerr.Code == kcmErrCCacheEnd {
+				// The credential was removed since it was listed.
+				continue
+			}
+			return nil, fmt.Errorf("could not get credential of KCM credential cache %s: %w", name, err)
+		}
+		p = 0
+		cred, err := parseCredential(r, &p, c, &endian)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing credential of KCM credential cache %s: %w", name, err)
+		}
+		c.Credentials = append(c.Credentials, cred)
+	}
+	return c, nil
+}
+
+// Save replaces the contents of the named cache, or the user's default cache if the name is empty, with the
+// credentials of the CCache.
+func (k *KCM) Save(name string, c *CCache) error {
+	var err error
+	if name == "" {
+		if name, err = k.DefaultCache(); err != nil {
+			return err
+		}
+	}
+	endian := binary.ByteOrder(binary.BigEndian)
+	// The credentials are marshaled as in version 4 of the file format whatever the version of the CCache.
+	v4 := &CCache{Version: 4}
+	if _, err := k.call(kcmOpInitialize, append(kcmString(name), c.DefaultPrincipal.marshal(&endian)...)); err != nil {
+		return fmt.Errorf("could not initialize KCM credential cache %s: %w", name, err)
+	}
+	for _, cred := range c.Credentials {
+		if _, err := k.call(kcmOpStore, append(kcmString(name), cred.marshal(v4, &endian)...)); err != nil {
+			return fmt.Errorf("could not store credential in KCM credential cache %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Destroy removes the named cache.
+func (k *KCM) Destroy(name string) error {
+	_, err := k.call(kcmOpDestroy, kcmString(name))
+	return err
+}
+
+// call sends the request of the operation with its arguments to the KCM daemon and returns the data of the reply.
+func (k *KCM) call(op uint16, args []byte) ([]byte, error) {
+	timeout := k.Timeout
+	if timeout <= 0 {
+		timeout = kcmDefaultTimeout
+	}
+	conn, err := net.DialTimeout("unix", k.Socket, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to KCM daemon: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	req := make([]byte, 8, 8+len(args))
+	binary.BigEndian.PutUint32(req, uint32(4+len(args)))
+	req[4], req[5] = kcmProtocolVersionMajor, kcmProtocolVersionMinor
+	binary.BigEndian.PutUint16(req[6:], op)
+	if _, err := conn.Write(append(req, args...)); err != nil {
+		return nil, fmt.Errorf("error sending request to KCM daemon: %w", err)
+	}
+	lb := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lb); err != nil {
+		return nil, fmt.Errorf("error reading reply from KCM daemon: %w", err)
+	}
+	l := binary.BigEndian.Uint32(lb)
+	if l < 4 || l > kcmMaxReplySize {
+		return nil, fmt.Errorf("invalid KCM reply length %d", l)
+	}
+	r := make([]byte, l)
+	if _, err := io.ReadFull(conn, r); err != nil {
+		return nil, fmt.Errorf("error reading reply from KCM daemon: %w", err)
+	}
+	if code := int32(binary.BigEndian.Uint32(r)); code != 0 {
+		return nil, KCMError{Code: code}
+	}
+	return r[4:], nil
+}
+
+// kcmString returns the null terminated string of a KCM request.
+func kcmString(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// readKCMString returns the null terminated string of a KCM reply.
+func readKCMString(b []byte) (string, error) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", errors.New("KCM reply string is not null terminated")
+	}
+	return string(b[:i]), nil
+}
+
+// splitKCMUUIDs returns the UUIDs of a KCM reply listing caches or credentials.
+func splitKCMUUIDs(b []byte) ([][]byte, error) {
+	if len(b)%kcmUUIDLength != 0 {
+		return nil, fmt.Errorf("invalid KCM UUID list length %d", len(b))
+	}
+	var uuids [][]byte
+	for len(b) > 0 {
+		uuids = append(uuids, b[:kcmUUIDLength])
+		b = b[kcmUUIDLength:]
+	}
+	return uuids, nil
+}
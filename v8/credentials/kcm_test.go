@@ -0,0 +1,222 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testKCMCache is a cache held by the test KCM daemon, its principal and credentials in their wire encoding.
+type testKCMCache struct {
+	uuid  []byte
+	princ []byte
+	creds [][]byte
+}
+
+// testKCMDaemon is an in memory KCM daemon serving the operations used by the KCM client.
+type testKCMDaemon struct {
+	mux    sync.Mutex
+	caches map[string]*testKCMCache
+	def    string
+	n      int
+}
+
+func testKCMServer(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gokrb5-kcm")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	socket := filepath.Join(dir, "kcm.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("error listening on unix socket: %v", err)
+	}
+	d := &testKCMDaemon{caches: make(map[string]*testKCMCache), def: "1000"}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return socket, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func (d *testKCMDaemon) serve(conn net.Conn) {
+	defer conn.Close()
+	lb := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lb); err != nil {
+		return
+	}
+	req := make([]byte, binary.BigEndian.Uint32(lb))
+	if _, err := io.ReadFull(conn, req); err != nil || len(req) < 4 || req[0] != kcmProtocolVersionMajor {
+		return
+	}
+	code, reply := d.handle(binary.BigEndian.Uint16(req[2:]), req[4:])
+	b := make([]byte, 8, 8+len(reply))
+	binary.BigEndian.PutUint32(b, uint32(4+len(reply)))
+	binary.BigEndian.PutUint32(b[4:], uint32(code))
+	conn.Write(append(b, reply...))
+}
+
+func (d *testKCMDaemon) handle(op uint16, args []byte) (int32, []byte) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	name, rest := "", args
+	if i := bytes.IndexByte(args, 0); i >= 0 {
+		name, rest = string(args[:i]), args[i+1:]
+	}
+	switch op {
+	case kcmOpGetDefaultCache:
+		return 0, kcmString(d.def)
+	case kcmOpSetDefaultCache:
+		if _, ok := d.caches[name]; !ok {
+			return kcmErrCCacheNoFile, nil
+		}
+		d.def = name
+		return 0, nil
+	case kcmOpGenNew:
+		d.n++
+		name := fmt.Sprintf("1000:%d", d.n)
+		d.caches[name] = &testKCMCache{uuid: d.uuid()}
+		return 0, kcmString(name)
+	case kcmOpGetCacheUUIDList:
+		var b []byte
+		for _, c := range d.caches {
+			b = append(b, c.uuid...)
+		}
+		return 0, b
+	case kcmOpGetCacheByUUID:
+		for n, c := range d.caches {
+			if string(c.uuid) == string(args) {
+				return 0, kcmString(n)
+			}
+		}
+		return kcmErrCCacheNotFound, nil
+	case kcmOpInitialize:
+		d.caches[name] = &testKCMCache{uuid: d.uuid(), princ: rest}
+		return 0, nil
+	case kcmOpDestroy:
+		if _, ok := d.caches[name]; !ok {
+			return kcmErrCCacheNoFile, nil
+		}
+		delete(d.caches, name)
+		return 0, nil
+	}
+	c, ok := d.caches[name]
+	if !ok {
+		return kcmErrCCacheNoFile, nil
+	}
+	switch op {
+	case kcmOpStore:
+		c.creds = append(c.creds, rest)
+		return 0, nil
+	case kcmOpGetPrincipal:
+		return 0, c.princ
+	case kcmOpGetCredUUIDList:
+		var b []byte
+		for i := range c.creds {
+			id := make([]byte, kcmUUIDLength)
+			binary.BigEndian.PutUint32(id, uint32(i))
+			b = append(b, id...)
+		}
+		return 0, b
+	case kcmOpGetCredByUUID:
+		if len(rest) != kcmUUIDLength || int(binary.BigEndian.Uint32(rest)) >= len(c.creds) {
+			return kcmErrCCacheEnd, nil
+		}
+		return 0, c.creds[binary.BigEndian.Uint32(rest)]
+	}
+	return -1, nil
+}
+
+func (d *testKCMDaemon) uuid() []byte {
+	d.n++
+	id := make([]byte, kcmUUIDLength)
+	binary.BigEndian.PutUint64(id[8:], uint64(d.n))
+	return id
+}
+
+func TestKCM(t *testing.T) {
+	t.Parallel()
+	socket, stop := testKCMServer(t)
+	defer stop()
+	k := NewKCM(socket)
+
+	_, err := k.Load("")
+	assert.True(t, errors.Is(err, ErrKCMCacheNotFound), "loading a cache that does not exist should fail: %v", err)
+
+	c := testCollectionCCache("testuser1")
+	c.Credentials[0].Key = types.EncryptionKey{KeyType: 18, KeyValue: []byte{1, 2, 3, 4}}
+	svc := NewCredential(c.DefaultPrincipal.PrincipalName, "TEST.GOKRB5",
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"), "TEST.GOKRB5")
+	svc.Ticket = []byte{4, 5, 6}
+	c.AddCredential(svc)
+	if err := k.Save("", c); err != nil {
+		t.Fatalf("error saving to default cache: %v", err)
+	}
+	l, err := k.Load("")
+	if err != nil {
+		t.Fatalf("error loading default cache: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, l.DefaultPrincipal, "default principal not as expected")
+	if assert.Equal(t, 2, len(l.Credentials), "number of credentials not as expected") {
+		assert.Equal(t, c.Credentials[0].Key, l.Credentials[0].Key, "key not as expected")
+		assert.Equal(t, c.Credentials[0].EndTime, l.Credentials[0].EndTime, "end time not as expected")
+		assert.Equal(t, []byte{4, 5, 6}, l.Credentials[1].Ticket, "ticket not as expected")
+	}
+
+	// Saving replaces the credentials of the cache.
+	if err := k.Save("1000", testCollectionCCache("testuser1")); err != nil {
+		t.Fatalf("error saving cache: %v", err)
+	}
+	l, err = k.Load("1000")
+	if err != nil {
+		t.Fatalf("error loading cache: %v", err)
+	}
+	assert.Equal(t, 1, len(l.Credentials), "credentials should be replaced")
+
+	name, err := k.NewCache()
+	if err != nil {
+		t.Fatalf("error creating cache: %v", err)
+	}
+	if err := k.Save(name, testCollectionCCache("testuser2")); err != nil {
+		t.Fatalf("error saving new cache: %v", err)
+	}
+	names, err := k.Caches()
+	if err != nil {
+		t.Fatalf("error listing caches: %v", err)
+	}
+	assert.ElementsMatch(t, []string{"1000", name}, names, "caches not as expected")
+	if err := k.SetDefaultCache(name); err != nil {
+		t.Fatalf("error setting default cache: %v", err)
+	}
+	l, err = k.Load("")
+	if err != nil {
+		t.Fatalf("error loading default cache: %v", err)
+	}
+	assert.Equal(t, "testuser2", l.DefaultPrincipal.PrincipalName.PrincipalNameString(), "default cache not switched")
+
+	assert.NoError(t, k.Destroy(name), "error destroying cache")
+	assert.True(t, errors.Is(k.Destroy(name), ErrKCMCacheNotFound), "destroying a cache twice should fail")
+	_, err = NewKCM(filepath.Join(filepath.Dir(socket), "none.sock")).DefaultCache()
+	assert.Error(t, err, "connecting to a socket that does not exist should fail")
+}
@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"strings"
+)
+
+// Active Directory derives the salt for an account's keys from its sAMAccountName and the realm rather than from the
+// principal name used to authenticate, so the default salt of the principal name is often wrong.
+// See MS-KILE section 3.1.1.2 Cryptographic Material.
+
+// ADUserSalt returns the salt Active Directory uses for the keys of a user account.
+//
+// The salt is formed from the upper case realm and the sAMAccountName, which is case sensitive and must be provided in
+// the case it was set on the account. This is the salt even when the user authenticates using their UPN.
+func ADUserSalt(realm, sAMAccountName string) string {
+	return strings.ToUpper(realm) + sAMAccountName
+}
+
+// ADComputerSalt returns the salt Active Directory uses for the keys of a computer account.
+//
+// The salt is formed from the upper case realm, "host" and the lower case host name qualified with the lower case
+// realm. The trailing "$" of the computer's sAMAccountName is removed, e.g. for the account "WS01$" in the realm
+// EXAMPLE.COM the salt is "EXAMPLE.COMhostws01.example.com".
+func ADComputerSalt(realm, sAMAccountName string) string {
+	h := strings.ToLower(strings.TrimSuffix(sAMAccountName, "$"))
+	return strings.ToUpper(realm) + "host" + h + "." + strings.ToLower(realm)
+}
+
+// ADTrustSalt returns the salt Active Directory uses for the keys of an interdomain trust account.
+//
+// Trust accounts are named after the NetBIOS name of the trusted domain with a trailing "$". The salt is formed from
+// the upper case realm, "krbtgt" and the upper case trusted domain NetBIOS name.
+func ADTrustSalt(realm, sAMAccountName string) string {
+	return strings.ToUpper(realm) + "krbtgt" + strings.ToUpper(strings.TrimSuffix(sAMAccountName, "$"))
+}
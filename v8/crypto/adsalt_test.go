@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestADSalts(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		salt string
+		want string
+	}{
+		{ADUserSalt("example.com", "Administrator"), "EXAMPLE.COMAdministrator"},
+		{ADComputerSalt("example.com", "WS01$"), "EXAMPLE.COMhostws01.example.com"},
+		{ADComputerSalt("EXAMPLE.COM", "ws01"), "EXAMPLE.COMhostws01.example.com"},
+		{ADTrustSalt("example.com", "partner$"), "EXAMPLE.COMkrbtgtPARTNER"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, test.salt, "salt not as expected")
+	}
+}
+
+func TestGetKeyFromPasswordAndSalt(t *testing.T) {
+	t.Parallel()
+	// For a user account whose sAMAccountName is the principal name the AD salt is the same as the default salt.
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	want, _, err := GetKeyFromPassword("passwordvalue", cname, "TEST.GOKRB5", etypeID.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		t.Fatalf("error getting key from password: %v", err)
+	}
+	key, err := GetKeyFromPasswordAndSalt("passwordvalue", ADUserSalt("test.gokrb5", "testuser1"), etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key from password and salt: %v", err)
+	}
+	assert.Equal(t, want, key, "key not as expected")
+	other, err := GetKeyFromPasswordAndSalt("passwordvalue", ADComputerSalt("test.gokrb5", "testuser1$"), etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key from password and salt: %v", err)
+	}
+	assert.NotEqual(t, want.KeyValue, other.KeyValue, "keys with different salts should differ")
+}
+
+func TestGetKeyFromPasswordAndSalt_Zero(t *testing.T) {
+	t.Parallel()
+	key, err := GetKeyFromPasswordAndSalt("passwordvalue", "TEST.GOKRB5zerouser", etypeID.AES128_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key from password and salt: %v", err)
+	}
+	want := append([]byte(nil), key.KeyValue...)
+	key.Zero()
+	// Zeroing the key must not affect the keys derived from the password later.
+	key, err = GetKeyFromPasswordAndSalt("passwordvalue", "TEST.GOKRB5zerouser", etypeID.AES128_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key from password and salt: %v", err)
+	}
+	assert.Equal(t, want, key.KeyValue, "key not as expected after an earlier key was zeroed")
+}
@@ -43,3 +43,10 @@ func TestAes256CtsHmacSha196_StringToKey(t *testing.T) {
 
 	}
 }
+
+func TestAes256CtsHmacSha196_DecryptMessage_Short(t *testing.T) {
+	t.Parallel()
+	var e Aes256CtsHmacSha96
+	_, err := e.DecryptMessage(make([]byte, e.GetKeyByteSize()), make([]byte, e.GetHMACBitLength()/8), 2)
+	assert.Error(t, err, "expected error for ciphertext that is too short")
+}
@@ -0,0 +1,139 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+)
+
+// DerivedKeyCacheSize is the maximum number of derived keys held in the cache. When the limit is reached the cache is
+// zeroed and emptied.
+const DerivedKeyCacheSize = 4096
+
+// protocolKeyID identifies a protocol key by its keyed hash so that the cache does not hold the protocol keys
+// themselves.
+type protocolKeyID [sha256.Size]byte
+
+// derivedKeyID identifies a key derived from a protocol key. Fixed size arrays are used so that looking up a key does
+// not allocate.
+type derivedKeyID struct {
+	etypeID  int32
+	usageLen uint8
+	usage    [8]byte
+}
+
+// derivedKeys caches keys derived from a protocol key for a usage.
+// Verifying an AP_REQ requires keys to be derived for decryption and integrity checking of both the ticket and the
+// authenticator. As the same service key is used for every request caching these avoids repeating the derivation.
+// The cache holds its own copies of the derived keys, which are zeroed when the protocol key is forgotten.
+var derivedKeys = struct {
+	sync.RWMutex
+	secret []byte
+	m      map[protocolKeyID]map[derivedKeyID][]byte
+	n      int
+}{m: make(map[protocolKeyID]map[derivedKeyID][]byte)}
+
+func init() {
+	derivedKeys.secret = make([]byte, sha256.Size)
+	if _, err := rand.Read(derivedKeys.secret); err != nil {
+		panic("could not generate the derived key cache secret: " + err.Error())
+	}
+}
+
+func newProtocolKeyID(protocolKey []byte) protocolKeyID {
+	var id protocolKeyID
+	h := hmac.New(sha256.New, derivedKeys.secret)
+	h.Write(protocolKey)
+	h.Sum(id[:0])
+	return id
+}
+
+func newDerivedKeyID(etypeID int32, usage []byte) (derivedKeyID, bool) {
+	var id derivedKeyID
+	if len(usage) > len(id.usage) {
+		return id, false
+	}
+	id.etypeID = etypeID
+	id.usageLen = uint8(len(usage))
+	copy(id.usage[:], usage)
+	return id, true
+}
+
+// GetDerivedKey returns a copy of the cached key derived from the protocol key for the usage.
+func GetDerivedKey(etypeID int32, protocolKey, usage []byte) ([]byte, bool) {
+	id, ok := newDerivedKeyID(etypeID, usage)
+	if !ok {
+		return nil, false
+	}
+	pid := newProtocolKeyID(protocolKey)
+	derivedKeys.RLock()
+	defer derivedKeys.RUnlock()
+	k, ok := derivedKeys.m[pid][id]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), k...), true
+}
+
+// SetDerivedKey caches a copy of the key derived from the protocol key for the usage.
+func SetDerivedKey(etypeID int32, protocolKey, usage, key []byte) {
+	id, ok := newDerivedKeyID(etypeID, usage)
+	if !ok {
+		return
+	}
+	pid := newProtocolKeyID(protocolKey)
+	derivedKeys.Lock()
+	defer derivedKeys.Unlock()
+	if derivedKeys.n >= DerivedKeyCacheSize {
+		clearDerivedKeys()
+	}
+	keys, ok := derivedKeys.m[pid]
+	if !ok {
+		keys = make(map[derivedKeyID][]byte)
+		derivedKeys.m[pid] = keys
+	}
+	if old, ok := keys[id]; ok {
+		zero(old)
+		derivedKeys.n--
+	}
+	keys[id] = append([]byte(nil), key...)
+	derivedKeys.n++
+}
+
+// ForgetDerivedKeys zeroes and removes the keys derived from the protocol key from the cache, such as when the
+// protocol key itself is zeroed.
+func ForgetDerivedKeys(protocolKey []byte) {
+	pid := newProtocolKeyID(protocolKey)
+	derivedKeys.Lock()
+	defer derivedKeys.Unlock()
+	for _, k := range derivedKeys.m[pid] {
+		zero(k)
+		derivedKeys.n--
+	}
+	delete(derivedKeys.m, pid)
+}
+
+// ClearDerivedKeys zeroes and removes all keys from the derived key cache.
+func ClearDerivedKeys() {
+	derivedKeys.Lock()
+	defer derivedKeys.Unlock()
+	clearDerivedKeys()
+}
+
+// clearDerivedKeys zeroes and removes all keys from the derived key cache, which must be locked.
+func clearDerivedKeys() {
+	for _, keys := range derivedKeys.m {
+		for _, k := range keys {
+			zero(k)
+		}
+	}
+	derivedKeys.m = make(map[protocolKeyID]map[derivedKeyID][]byte)
+	derivedKeys.n = 0
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,54 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDerivedKeys(t *testing.T) {
+	pk := []byte("0123456789abcdef")
+	ClearDerivedKeys()
+	_, ok := GetDerivedKey(18, pk, GetUsageKe(2))
+	assert.False(t, ok, "key should not be cached")
+	dk := []byte("derived")
+	SetDerivedKey(18, pk, GetUsageKe(2), dk)
+	k, ok := GetDerivedKey(18, pk, GetUsageKe(2))
+	assert.True(t, ok, "key should be cached")
+	assert.Equal(t, []byte("derived"), k, "cached key not as expected")
+	_, ok = GetDerivedKey(17, pk, GetUsageKe(2))
+	assert.False(t, ok, "key should not be cached for another etype")
+	_, ok = GetDerivedKey(18, pk, GetUsageKi(2))
+	assert.False(t, ok, "key should not be cached for another usage")
+	_, ok = GetDerivedKey(18, pk[:8], GetUsageKe(2))
+	assert.False(t, ok, "key should not be cached for another protocol key")
+
+	// The cache holds its own copies of the keys.
+	k[0] = 'D'
+	dk[1] = 'E'
+	k, _ = GetDerivedKey(18, pk, GetUsageKe(2))
+	assert.Equal(t, []byte("derived"), k, "cached key should not be modified through the keys passed or returned")
+
+	// The cache does not hold the protocol keys.
+	for id := range derivedKeys.m {
+		assert.NotContains(t, string(id[:]), string(pk), "protocol key should not be held by the cache")
+	}
+
+	// Forgetting a protocol key zeroes its derived keys.
+	SetDerivedKey(18, pk, GetUsageKi(2), []byte("derived"))
+	SetDerivedKey(18, pk[:8], GetUsageKe(2), []byte("other"))
+	held := derivedKeys.m[newProtocolKeyID(pk)]
+	ForgetDerivedKeys(pk)
+	for _, k := range held {
+		assert.Equal(t, make([]byte, len(k)), k, "forgotten key should be zeroed")
+	}
+	_, ok = GetDerivedKey(18, pk, GetUsageKe(2))
+	assert.False(t, ok, "keys of the forgotten protocol key should be removed")
+	_, ok = GetDerivedKey(18, pk[:8], GetUsageKe(2))
+	assert.True(t, ok, "keys of other protocol keys should not be removed")
+
+	ClearDerivedKeys()
+	_, ok = GetDerivedKey(18, pk[:8], GetUsageKe(2))
+	assert.False(t, ok, "cache should have been cleared")
+	assert.Equal(t, 0, derivedKeys.n, "cache should be empty")
+}
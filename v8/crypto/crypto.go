@@ -27,6 +27,12 @@ func GetEtype(id int32) (etype.EType, error) {
 	case etypeID.AES256_CTS_HMAC_SHA384_192:
 		var et Aes256CtsHmacSha384192
 		return et, nil
+	case etypeID.CAMELLIA128_CTS_CMAC:
+		var et Camellia128CtsCmac
+		return et, nil
+	case etypeID.CAMELLIA256_CTS_CMAC:
+		var et Camellia256CtsCmac
+		return et, nil
 	case etypeID.DES3_CBC_SHA1_KD:
 		var et Des3CbcSha1Kd
 		return et, nil
@@ -53,6 +59,12 @@ func GetChksumEtype(id int32) (etype.EType, error) {
 	case chksumtype.HMAC_SHA384_192_AES256:
 		var et Aes256CtsHmacSha384192
 		return et, nil
+	case chksumtype.CMAC_CAMELLIA128:
+		var et Camellia128CtsCmac
+		return et, nil
+	case chksumtype.CMAC_CAMELLIA256:
+		var et Camellia256CtsCmac
+		return et, nil
 	case chksumtype.HMAC_SHA1_DES3_KD:
 		var et Des3CbcSha1Kd
 		return et, nil
@@ -72,7 +84,7 @@ func GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string,
 	var key types.EncryptionKey
 	et, err := GetEtype(etypeID)
 	if err != nil {
-		return key, et, fmt.Errorf("error getting encryption type: %v", err)
+		return key, et, fmt.Errorf("error getting encryption type: %w", err)
 	}
 	sk2p := et.GetDefaultStringToKeyParams()
 	var salt string
@@ -91,12 +103,12 @@ func GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string,
 			var eti types.ETypeInfo
 			err := eti.Unmarshal(pa.PADataValue)
 			if err != nil {
-				return key, et, fmt.Errorf("error unmashaling PA Data to PA-ETYPE-INFO2: %v", err)
+				return key, et, fmt.Errorf("error unmashaling PA Data to PA-ETYPE-INFO2: %w", err)
 			}
 			if etypeID != eti[0].EType {
 				et, err = GetEtype(eti[0].EType)
 				if err != nil {
-					return key, et, fmt.Errorf("error getting encryption type: %v", err)
+					return key, et, fmt.Errorf("error getting encryption type: %w", err)
 				}
 			}
 			salt = string(eti[0].Salt)
@@ -107,12 +119,12 @@ func GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string,
 			var et2 types.ETypeInfo2
 			err := et2.Unmarshal(pa.PADataValue)
 			if err != nil {
-				return key, et, fmt.Errorf("error unmashalling PA Data to PA-ETYPE-INFO2: %v", err)
+				return key, et, fmt.Errorf("error unmashalling PA Data to PA-ETYPE-INFO2: %w", err)
 			}
 			if etypeID != et2[0].EType {
 				et, err = GetEtype(et2[0].EType)
 				if err != nil {
-					return key, et, fmt.Errorf("error getting encryption type: %v", err)
+					return key, et, fmt.Errorf("error getting encryption type: %w", err)
 				}
 			}
 			if len(et2[0].S2KParams) == 4 {
@@ -130,18 +142,43 @@ func GetKeyFromPassword(passwd string, cname types.PrincipalName, realm string,
 	}
 	key = types.EncryptionKey{
 		KeyType:  etypeID,
-		KeyValue: k,
+		KeyValue: ownKey(k),
 	}
 	return key, et, nil
 }
 
+// GetKeyFromPasswordAndSalt derives the key for the encryption type from the password using the salt provided,
+// for example one returned by ADUserSalt, and the encryption type's default string to key parameters.
+func GetKeyFromPasswordAndSalt(passwd, salt string, etypeID int32) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	et, err := GetEtype(etypeID)
+	if err != nil {
+		return key, fmt.Errorf("error getting encryption type: %w", err)
+	}
+	k, err := et.StringToKey(passwd, salt, et.GetDefaultStringToKeyParams())
+	if err != nil {
+		return key, fmt.Errorf("error deriving key from string: %+v", err)
+	}
+	key = types.EncryptionKey{
+		KeyType:  etypeID,
+		KeyValue: ownKey(k),
+	}
+	return key, nil
+}
+
+// ownKey returns a copy of a key returned by an etype's StringToKey. The final derivation may return a key held by
+// the derived key cache so a copy is returned that the caller can zero once it is no longer needed.
+func ownKey(k []byte) []byte {
+	return append([]byte(nil), k...)
+}
+
 // GetEncryptedData encrypts the data provided and returns and EncryptedData type.
 // Pass a usage value of zero to use the key provided directly rather than deriving one.
 func GetEncryptedData(plainBytes []byte, key types.EncryptionKey, usage uint32, kvno int) (types.EncryptedData, error) {
 	var ed types.EncryptedData
 	et, err := GetEtype(key.KeyType)
 	if err != nil {
-		return ed, fmt.Errorf("error getting etype: %v", err)
+		return ed, fmt.Errorf("error getting etype: %w", err)
 	}
 	_, b, err := et.EncryptMessage(key.KeyValue, plainBytes, usage)
 	if err != nil {
@@ -165,11 +202,11 @@ func DecryptEncPart(ed types.EncryptedData, key types.EncryptionKey, usage uint3
 func DecryptMessage(ciphertext []byte, key types.EncryptionKey, usage uint32) ([]byte, error) {
 	et, err := GetEtype(key.KeyType)
 	if err != nil {
-		return []byte{}, fmt.Errorf("error decrypting: %v", err)
+		return []byte{}, fmt.Errorf("error decrypting: %w", err)
 	}
 	b, err := et.DecryptMessage(key.KeyValue, ciphertext, usage)
 	if err != nil {
-		return nil, fmt.Errorf("error decrypting: %v", err)
+		return nil, fmt.Errorf("error decrypting: %w", err)
 	}
 	return b, nil
 }
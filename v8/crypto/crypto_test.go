@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+var benchmarkETypes = []struct {
+	name string
+	id   int32
+}{
+	{"aes128-cts-hmac-sha1-96", etypeID.AES128_CTS_HMAC_SHA1_96},
+	{"aes256-cts-hmac-sha1-96", etypeID.AES256_CTS_HMAC_SHA1_96},
+	{"aes128-cts-hmac-sha256-128", etypeID.AES128_CTS_HMAC_SHA256_128},
+	{"aes256-cts-hmac-sha384-192", etypeID.AES256_CTS_HMAC_SHA384_192},
+	{"des3-cbc-sha1-kd", etypeID.DES3_CBC_SHA1_KD},
+	{"rc4-hmac", etypeID.RC4_HMAC},
+}
+
+func benchmarkKey(b *testing.B, id int32) types.EncryptionKey {
+	key, err := GetKeyFromPasswordAndSalt("passwordvalue", "TEST.GOKRB5testuser1", id)
+	if err != nil {
+		b.Fatalf("error getting key: %v", err)
+	}
+	return key
+}
+
+func BenchmarkGetEncryptedData(b *testing.B) {
+	pt := make([]byte, 512)
+	for _, et := range benchmarkETypes {
+		b.Run(et.name, func(b *testing.B) {
+			key := benchmarkKey(b, et.id)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := GetEncryptedData(pt, key, keyusage.KDC_REP_TICKET, 1)
+				if err != nil {
+					b.Fatalf("error encrypting: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecryptEncPart(b *testing.B) {
+	pt := make([]byte, 512)
+	for _, et := range benchmarkETypes {
+		b.Run(et.name, func(b *testing.B) {
+			key := benchmarkKey(b, et.id)
+			ed, err := GetEncryptedData(pt, key, keyusage.KDC_REP_TICKET, 1)
+			if err != nil {
+				b.Fatalf("error encrypting: %v", err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := DecryptEncPart(ed, key, keyusage.KDC_REP_TICKET)
+				if err != nil {
+					b.Fatalf("error decrypting: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGetChecksumHash(b *testing.B) {
+	msg := make([]byte, 512)
+	for _, et := range benchmarkETypes {
+		b.Run(et.name, func(b *testing.B) {
+			key := benchmarkKey(b, et.id)
+			e, err := GetEtype(et.id)
+			if err != nil {
+				b.Fatalf("error getting etype: %v", err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := e.GetChecksumHash(key.KeyValue, msg, keyusage.KERB_NON_KERB_CKSUM_SALT)
+				if err != nil {
+					b.Fatalf("error generating checksum: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+// Package cryptotest provides the published Kerberos cryptography test vectors and a conformance runner, so that
+// implementations of the etype.EType interface, such as those backed by an HSM or a FIPS validated module, can be
+// verified against the known answers of RFCs 3961, 3962, 4757, 6803 and 8009.
+package cryptotest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/common"
+	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+)
+
+// Run runs the test vectors for the encryption type of e as subtests of t, failing t if there are no vectors for
+// it. Each vector is run as a subtest named after its kind, index and source so that failures can be traced to the
+// RFC.
+func Run(t *testing.T, e etype.EType) {
+	id := e.GetETypeID()
+	var n int
+	for i, v := range StringToKeyVectors {
+		if v.EType != id {
+			continue
+		}
+		n++
+		t.Run(name("StringToKey", i, v.Source), func(t *testing.T) {
+			if err := CheckStringToKey(e, v); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	for i, v := range DeriveKeyVectors {
+		if v.EType != id {
+			continue
+		}
+		n++
+		t.Run(name("DeriveKey", i, v.Source), func(t *testing.T) {
+			if err := CheckDeriveKey(e, v); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	for i, v := range ChecksumVectors {
+		if v.EType != id {
+			continue
+		}
+		n++
+		t.Run(name("Checksum", i, v.Source), func(t *testing.T) {
+			if err := CheckChecksum(e, v); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	for i, v := range EncryptionVectors {
+		if v.EType != id {
+			continue
+		}
+		n++
+		t.Run(name("Encryption", i, v.Source), func(t *testing.T) {
+			if err := CheckEncryption(e, v); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	if n < 1 {
+		t.Errorf("no test vectors for encryption type %d", id)
+	}
+}
+
+func name(kind string, i int, source string) string {
+	return fmt.Sprintf("%s/%d/%s", kind, i, source)
+}
+
+// CheckStringToKey checks the key e derives from the password and salt of the vector.
+func CheckStringToKey(e etype.EType, v StringToKeyVector) error {
+	s2kp := v.S2KParams
+	if s2kp == "" {
+		s2kp = e.GetDefaultStringToKeyParams()
+	}
+	k, err := e.StringToKey(v.Password, v.Salt, s2kp)
+	if err != nil {
+		return fmt.Errorf("error in string to key: %w", err)
+	}
+	return compare("key", v.Key, k)
+}
+
+// CheckDeriveKey checks the outputs of the DR, if the vector has one, and DK functions of e.
+func CheckDeriveKey(e etype.EType, v DeriveKeyVector) error {
+	key, err := decode("key", v.Key)
+	if err != nil {
+		return err
+	}
+	c, err := decode("constant", v.Constant)
+	if err != nil {
+		return err
+	}
+	if v.DerivedRandom != "" {
+		dr, err := e.DeriveRandom(key, c)
+		if err != nil {
+			return fmt.Errorf("error in derive random: %w", err)
+		}
+		if err := compare("derived random", v.DerivedRandom, dr); err != nil {
+			return err
+		}
+	}
+	dk, err := e.DeriveKey(key, c)
+	if err != nil {
+		return fmt.Errorf("error in derive key: %w", err)
+	}
+	return compare("derived key", v.DerivedKey, dk)
+}
+
+// CheckChecksum checks the checksum e generates for the data of the vector and that e verifies it.
+func CheckChecksum(e etype.EType, v ChecksumVector) error {
+	key, err := decode("key", v.Key)
+	if err != nil {
+		return err
+	}
+	data, err := decode("data", v.Data)
+	if err != nil {
+		return err
+	}
+	cksum, err := e.GetChecksumHash(key, data, v.Usage)
+	if err != nil {
+		return fmt.Errorf("error generating checksum: %w", err)
+	}
+	if err := compare("checksum", v.Checksum, cksum); err != nil {
+		return err
+	}
+	if !e.VerifyChecksum(key, data, cksum, v.Usage) {
+		return fmt.Errorf("checksum %s not verified", v.Checksum)
+	}
+	return nil
+}
+
+// CheckEncryption checks that e decrypts the ciphertext of the vector to its plaintext and verifies its integrity,
+// and that encrypting the confounder and plaintext with the derived encryption key produces the ciphertext.
+func CheckEncryption(e etype.EType, v EncryptionVector) error {
+	key, err := decode("key", v.Key)
+	if err != nil {
+		return err
+	}
+	pt, err := decode("plaintext", v.Plaintext)
+	if err != nil {
+		return err
+	}
+	cf, err := decode("confounder", v.Confounder)
+	if err != nil {
+		return err
+	}
+	ct, err := decode("ciphertext", v.Ciphertext)
+	if err != nil {
+		return err
+	}
+	// The integrity hash of the RFC 3961 simplified profile and RFC 6803 is over the plaintext including the confounder.
+	plain := append(append([]byte{}, cf...), pt...)
+	if !e.VerifyIntegrity(key, ct, plain, v.Usage) {
+		return fmt.Errorf("integrity of ciphertext not verified")
+	}
+	m, err := e.DecryptMessage(key, ct, v.Usage)
+	if err != nil {
+		return fmt.Errorf("error decrypting message: %w", err)
+	}
+	if err := compare("decrypted message", v.Plaintext, m); err != nil {
+		return err
+	}
+	ke, err := e.DeriveKey(key, common.GetUsageKe(v.Usage))
+	if err != nil {
+		return fmt.Errorf("error deriving encryption key: %w", err)
+	}
+	_, b, err := e.EncryptData(ke, plain)
+	if err != nil {
+		return fmt.Errorf("error encrypting data: %w", err)
+	}
+	if l := len(ct) - e.GetHMACBitLength()/8; l < 0 || !bytes.Equal(b, ct[:l]) {
+		return fmt.Errorf("encrypted data %x does not match ciphertext %s", b, v.Ciphertext)
+	}
+	return nil
+}
+
+func decode(field, s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s of test vector: %w", field, err)
+	}
+	return b, nil
+}
+
+func compare(field, expected string, b []byte) error {
+	if hex.EncodeToString(b) != expected {
+		return fmt.Errorf("%s %x not as expected %s", field, b, expected)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package cryptotest
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	for _, id := range []int32{
+		etypeID.DES3_CBC_SHA1_KD,
+		etypeID.AES128_CTS_HMAC_SHA1_96,
+		etypeID.AES256_CTS_HMAC_SHA1_96,
+		etypeID.AES128_CTS_HMAC_SHA256_128,
+		etypeID.AES256_CTS_HMAC_SHA384_192,
+		etypeID.CAMELLIA128_CTS_CMAC,
+		etypeID.CAMELLIA256_CTS_CMAC,
+		etypeID.RC4_HMAC,
+	} {
+		e, err := crypto.GetEtype(id)
+		if err != nil {
+			t.Fatalf("error getting etype %d: %v", id, err)
+		}
+		t.Run(etypeID.Name(id), func(t *testing.T) {
+			Run(t, e)
+		})
+	}
+}
+
+// brokenEType returns the wrong derived keys.
+type brokenEType struct {
+	etype.EType
+}
+
+func (e brokenEType) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
+	k, err := e.EType.DeriveKey(protocolKey, usage)
+	if err == nil {
+		k[0] ^= 0xff
+	}
+	return k, err
+}
+
+// recordingEType records the plaintext its integrity is verified over.
+type recordingEType struct {
+	etype.EType
+	pt *[]byte
+}
+
+func (e recordingEType) VerifyIntegrity(protocolKey, ct, pt []byte, usage uint32) bool {
+	*e.pt = append([]byte(nil), pt...)
+	return e.EType.VerifyIntegrity(protocolKey, ct, pt, usage)
+}
+
+func TestCheckEncryption_IntegrityPlaintext(t *testing.T) {
+	t.Parallel()
+	e, _ := crypto.GetEtype(etypeID.AES128_CTS_HMAC_SHA256_128)
+	for _, v := range EncryptionVectors {
+		if v.EType != etypeID.AES128_CTS_HMAC_SHA256_128 {
+			continue
+		}
+		var pt []byte
+		assert.NoError(t, CheckEncryption(recordingEType{EType: e, pt: &pt}, v), "vector should pass")
+		assert.Equal(t, v.Confounder+v.Plaintext, hex.EncodeToString(pt), "integrity should be verified over the confounder and plaintext")
+	}
+}
+
+func TestCheckDeriveKey(t *testing.T) {
+	t.Parallel()
+	e, _ := crypto.GetEtype(etypeID.AES128_CTS_HMAC_SHA256_128)
+	for _, v := range DeriveKeyVectors {
+		if v.EType == etypeID.AES128_CTS_HMAC_SHA256_128 {
+			assert.NoError(t, CheckDeriveKey(e, v), "vector should pass")
+			assert.Error(t, CheckDeriveKey(brokenEType{e}, v), "vector should fail for an incorrect implementation")
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package cryptotest
+
+import (
+	"encoding/hex"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/common"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+)
+
+// StringToKeyVector is a known answer for the string-to-key function of an encryption type.
+type StringToKeyVector struct {
+	// EType is the encryption type ID.
+	EType int32
+	// Source is the RFC and section the vector is taken from.
+	Source string
+	// Password is the password, which may not be valid UTF-8.
+	Password string
+	// Salt is the salt, which may not be valid UTF-8.
+	Salt string
+	// S2KParams are the hex encoded string-to-key parameters, or empty for the encryption type's default.
+	S2KParams string
+	// Key is the hex encoded key expected.
+	Key string
+}
+
+// DeriveKeyVector is a known answer for the key derivation functions of an encryption type.
+type DeriveKeyVector struct {
+	// EType is the encryption type ID.
+	EType int32
+	// Source is the RFC and section the vector is taken from.
+	Source string
+	// Key is the hex encoded protocol key.
+	Key string
+	// Constant is the hex encoded well-known constant, such as the usage constant of common.GetUsageKe.
+	Constant string
+	// DerivedRandom is the hex encoded output of the DR function expected, or empty if the vector has none.
+	DerivedRandom string
+	// DerivedKey is the hex encoded output of the DK function expected.
+	DerivedKey string
+}
+
+// ChecksumVector is a known answer for the keyed checksum of an encryption type.
+type ChecksumVector struct {
+	// EType is the encryption type ID.
+	EType int32
+	// Source is the RFC and section the vector is taken from.
+	Source string
+	// Key is the hex encoded protocol key.
+	Key string
+	// Usage is the key usage number.
+	Usage uint32
+	// Data is the hex encoded data checksummed.
+	Data string
+	// Checksum is the hex encoded checksum expected.
+	Checksum string
+}
+
+// EncryptionVector is a known answer for the encryption of a message with an encryption type.
+type EncryptionVector struct {
+	// EType is the encryption type ID.
+	EType int32
+	// Source is the RFC and section the vector is taken from.
+	Source string
+	// Key is the hex encoded protocol key.
+	Key string
+	// Usage is the key usage number.
+	Usage uint32
+	// Plaintext is the hex encoded message.
+	Plaintext string
+	// Confounder is the hex encoded random confounder prepended to the message.
+	Confounder string
+	// Ciphertext is the hex encoded ciphertext expected, including the integrity checksum.
+	Ciphertext string
+}
+
+func h(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+func s2kIterations(i uint32) string {
+	return common.IterationsToS2Kparams(i)
+}
+
+// StringToKeyVectors are the string-to-key test vectors of RFCs 3961, 3962, 6803 and 8009 and a known NT hash for the
+// RC4-HMAC encryption type of RFC 4757.
+var StringToKeyVectors = []StringToKeyVector{
+	// DES3 string-to-key
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.4", "password", "ATHENA.MIT.EDUraeburn", "", "850bb51358548cd05e86768c313e3bfef7511937dcf72c3e"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.4", "potatoe", "WHITEHOUSE.GOVdanny", "", "dfcd233dd0a43204ea6dc437fb15e061b02979c1f74f377a"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.4", "penny", "EXAMPLE.COMbuckaroo", "", "6d2fcdf2d6fbbc3ddcadb5da5710a23489b0d3b69d5d9d4a"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.4", "ß", "ATHENA.MIT.EDUJurišić", "", "16d5a40e1ce3bacb61b9dce00470324c831973a7b952feb0"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.4", "\U0001D11E", "EXAMPLE.COMpianist", "", "85763726585dbc1cce6ec43e1f751f07f1c4cbb098f40b19"},
+
+	// AES string-to-key
+	{etypeID.AES128_CTS_HMAC_SHA1_96, "RFC 3962 B", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(1), "42263c6e89f4fc28b8df68ee09799f15"},
+	{etypeID.AES256_CTS_HMAC_SHA1_96, "RFC 3962 B", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(1), "fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161"},
+	{etypeID.AES128_CTS_HMAC_SHA1_96, "RFC 3962 B", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(2), "c651bf29e2300ac27fa469d693bdda13"},
+	{etypeID.AES256_CTS_HMAC_SHA1_96, "RFC 3962 B", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(2), "a2e16d16b36069c135d5e9d2e25f896102685618b95914b467c67622225824ff"},
+	{etypeID.AES128_CTS_HMAC_SHA1_96, "RFC 3962 B", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(1200), "4c01cd46d632d01e6dbe230a01ed642a"},
+	{etypeID.AES256_CTS_HMAC_SHA1_96, "RFC 3962 B", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(1200), "55a6ac740ad17b4846941051e1e8b0a7548d93b0ab30a8bc3ff16280382b8c2a"},
+	{etypeID.AES128_CTS_HMAC_SHA1_96, "RFC 3962 B", "password", h("1234567878563412"), s2kIterations(5), "e9b23d52273747dd5c35cb55be619d8e"},
+	{etypeID.AES256_CTS_HMAC_SHA1_96, "RFC 3962 B", "password", h("1234567878563412"), s2kIterations(5), "97a4e786be20d81a382d5ebc96d5909cabcdadc87ca48f574504159f16c36e31"},
+	{etypeID.AES128_CTS_HMAC_SHA1_96, "RFC 3962 B", "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "pass phrase equals block size", s2kIterations(1200), "59d1bb789a828b1aa54ef9c2883f69ed"},
+	{etypeID.AES256_CTS_HMAC_SHA1_96, "RFC 3962 B", "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "pass phrase equals block size", s2kIterations(1200), "89adee3608db8bc71f1bfbfe459486b05618b70cbae22092534e56c553ba4b34"},
+	{etypeID.AES128_CTS_HMAC_SHA1_96, "RFC 3962 B", "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "pass phrase exceeds block size", s2kIterations(1200), "cb8005dc5f90179a7f02104c0018751d"},
+	{etypeID.AES256_CTS_HMAC_SHA1_96, "RFC 3962 B", "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "pass phrase exceeds block size", s2kIterations(1200), "d78c5c9cb872a8c9dad4697f0bb5b2d21496c82beb2caeda2112fceea057401b"},
+	{etypeID.AES128_CTS_HMAC_SHA1_96, "RFC 3962 B", h("f09d849e"), "EXAMPLE.COMpianist", s2kIterations(50), "f149c1f2e154a73452d43e7fe62a56e5"},
+	{etypeID.AES256_CTS_HMAC_SHA1_96, "RFC 3962 B", h("f09d849e"), "EXAMPLE.COMpianist", s2kIterations(50), "4b6d9839f84406df1f09cc166db4b83c571848b784a3d6bdc346589a3e393f9e"},
+
+	// RC4 string-to-key, the NT hash of the password as RFC 4757 does not include test vectors
+	{etypeID.RC4_HMAC, "RFC 4757 2 (NT hash)", "foo", "", "", "ac8e657f83df82beea5d43bdaf7800cc"},
+
+	// AES SHA-2 string-to-key
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "password", h("10df9dd783e5bc8acea1730e74355f61") + "ATHENA.MIT.EDUraeburn", s2kIterations(32768), "089bca48b105ea6ea77ca5d2f39dc5e7"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "password", h("10df9dd783e5bc8acea1730e74355f61") + "ATHENA.MIT.EDUraeburn", s2kIterations(32768), "45bd806dbf6a833a9cffc1c94589a222367a79bc21c413718906e9f578a78467"},
+
+	// Camellia string-to-key
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(1), "57d0297298ffd9d35de5a47fb4bde24b"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(1), "b9d6828b2056b7be656d88a123b1fac68214ac2b727ecf5f69afe0c4df2a6d2c"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(2), "73f1b53aa0f310f93b1de8ccaa0cb152"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(2), "83fc5866e5f8f4c6f38663c65c87549f342bc47ed394dc9d3cd4d163ade375e3"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(1200), "8e571145452855575fd916e7b04487aa"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "password", "ATHENA.MIT.EDUraeburn", s2kIterations(1200), "77f421a6f25e138395e837e5d85d385b4c1bfd772e112cd9208ce72a530b15e6"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "password", h("1234567878563412"), s2kIterations(5), "00498fd916bfc1c2b1031c170801b381"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "password", h("1234567878563412"), s2kIterations(5), "11083a00bdfe6a41b2f19716d6202f0afa94289afe8b27a049bd28b1d76c389a"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "pass phrase equals block size", s2kIterations(1200), "8bf6c3ef709b981dbb585d086843be05"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "pass phrase equals block size", s2kIterations(1200), "119fe2a1cb0b1be010b9067a73db63ed4665b4e53a98d178035dcfe843a6b9b0"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "pass phrase exceeds block size", s2kIterations(1200), "5752ac8d6ad1ccfe8430b312871c2f74"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "XXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXXX", "pass phrase exceeds block size", s2kIterations(1200), "614d5dfc0ba6d390b412b89ae4d5b088b612b316510994679ddb4383c7126ddf"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", h("f09d849e"), "EXAMPLE.COMpianist", s2kIterations(50), "cc75c7fd260f1c1658011fcc0d560616"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", h("f09d849e"), "EXAMPLE.COMpianist", s2kIterations(50), "163b768c6db148b4eec7163df5aed70e206b68cec078bc069ed68a7ed36b1ecc"},
+}
+
+// DeriveKeyVectors are the key derivation test vectors of RFCs 3961, 6803 and 8009.
+var DeriveKeyVectors = []DeriveKeyVector{
+	// DES3 DR and DK
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "dce06b1f64c857a11c3db57c51899b2cc1791008ce973b92", "0000000155", "935079d14490a75c3093c4a6e8c3b049c71e6ee705", "925179d04591a79b5d3192c4a7e9c289b049c71f6ee604cd"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "5e13d31c70ef765746578531cb51c15bf11ca82c97cee9f2", "00000001aa", "9f58e5a047d894101c469845d67ae3c5249ed812f2", "9e58e5a146d9942a101c469845d67a20e3c4259ed913f207"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "98e6fd8a04a4b6859b75a176540b9752bad3ecd610a252bc", "0000000155", "12fff90c773f956d13fc2ca0d0840349dbd39908eb", "13fef80d763e94ec6d13fd2ca1d085070249dad39808eabf"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "622aec25a2fe2cad7094680b7c64940280084c1a7cec92b5", "00000001aa", "f8debf05b097e7dc0603686aca35d91fd9a5516a70", "f8dfbf04b097e6d9dc0702686bcb3489d91fd9a4516b703e"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "d3f8298ccb166438dcb9b93ee5a7629286a491f838f802fb", "6b65726265726f73", "2270db565d2a3d64cfbfdc5305d4f778a6de42d9da", "2370da575d2a3da864cebfdc5204d56df779a7df43d9da43"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "c1081649ada74362e6a1459d01dfd30d67c2234c940704da", "0000000155", "348056ec98fcc517171d2b4d7a9493af482d999175", "348057ec98fdc48016161c2a4c7a943e92ae492c989175f7"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "5d154af238f46713155719d55e2f1f790dd661f279a7917c", "00000001aa", "a8818bc367dadacbe9a6c84627fb60c294b01215e5", "a8808ac267dada3dcbe9a7c84626fbc761c294b01315e5c1"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "798562e049852f57dc8c343ba17f2ca1d97394efc8adc443", "0000000155", "c813f88b3be2b2f75424ce9175fbc8483b88c8713a", "c813f88a3be3b334f75425ce9175fbe3c8493b89c8703b49"},
+	{etypeID.DES3_CBC_SHA1_KD, "RFC 3961 A.3", "26dce334b545292f2feab9a8701a89a4b99eb9942cecd016", "00000001aa", "f58efc6f83f93e55e695fd252cf8fe59f7d5ba37ec", "f48ffd6e83f83e7354e694fd252cf83bfe58f7d5ba37ec5d"},
+
+	// AES SHA-2 Kc, Ke and Ki for usage 2
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "3705d96080c17728a0e800eab6e0d23c", "0000000299", "", "b31a018a48f54776f403e9a396325dc3"},
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "3705d96080c17728a0e800eab6e0d23c", "00000002aa", "", "9b197dd1e8c5609d6e67c3e37c62c72e"},
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "3705d96080c17728a0e800eab6e0d23c", "0000000255", "", "9fda0e56ab2d85e1569a688696c26a6c"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", "0000000299", "", "ef5718be86cc84963d8bbb5031e9f5c4ba41f28faf69e73d"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", "00000002aa", "", "56ab22bee63d82d7bc5227f6773f8ea7a5eb1c825160c38312980c442e5c7e49"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", "0000000255", "", "69b16514e3cd8e56b82010d5c73012b622c4d00ffc23ed1f"},
+
+	// Camellia Kc, Ke and Ki for usage 2
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "57d0297298ffd9d35de5a47fb4bde24b", "0000000299", "", "d155775a209d05f02b38d42a389e5a56"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "57d0297298ffd9d35de5a47fb4bde24b", "00000002aa", "", "64df83f85a532f17577d8c37035796ab"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "57d0297298ffd9d35de5a47fb4bde24b", "0000000255", "", "3e4fbdf30fb8259c425cb6c96f1f4635"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "b9d6828b2056b7be656d88a123b1fac68214ac2b727ecf5f69afe0c4df2a6d2c", "0000000299", "", "e467f9a9552bc7d3155a6220af9c19220eeed4ff78b0d1e6a1544991461a9e50"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "b9d6828b2056b7be656d88a123b1fac68214ac2b727ecf5f69afe0c4df2a6d2c", "00000002aa", "", "412aefc362a7285fc3966c6a5181e7605ae675235b6d549fbfc9ab6630a4c604"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "b9d6828b2056b7be656d88a123b1fac68214ac2b727ecf5f69afe0c4df2a6d2c", "0000000255", "", "fa624fa0e523993fa388aefdc67e67ebcd8c08e8a0246b1d73b0d1dd9fc582b0"},
+}
+
+// ChecksumVectors are the checksum test vectors of RFCs 6803 and 8009.
+var ChecksumVectors = []ChecksumVector{
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "3705d96080c17728a0e800eab6e0d23c", 2, "000102030405060708090a0b0c0d0e0f1011121314", "d78367186643d67b411cba9139fc1dee"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", 2, "000102030405060708090a0b0c0d0e0f1011121314", "45ee791567eefca37f4ac1e0222de80d43c3bfa06699672a"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "1dc46a8d763f4f93742bcba3387576c3", 7, hex.EncodeToString([]byte("abcdefghijk")), "1178e6c5c47a8c1ae0c4b9c7d4eb7b6b"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "5027bc231d0f3a9d23333f1ca6fdbe7c", 8, hex.EncodeToString([]byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ")), "d1b34f7004a731f23a0c00bf6c3f753a"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "b61c86cc4e5d2757545ad423399fb7031ecab913cbb900bd7a3c6dd8bf92015b", 9, hex.EncodeToString([]byte("123456789")), "87a12cfd2b96214810f01c826e7744b1"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "32164c5b434d1d1538e4cfd9be8040fe8c4ac7acc4b93d3314d2133668147a05", 10, hex.EncodeToString([]byte("!@#$%^&*()!@#$%^&*()!@#$%^&*()")), "3fa0b42355e52b189187294aa252ab64"},
+}
+
+// EncryptionVectors are the encryption test vectors of RFCs 6803 and 8009.
+var EncryptionVectors = []EncryptionVector{
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "3705d96080c17728a0e800eab6e0d23c", 2, "", "7e5895eaf2672435bad817f545a37148", "ef85fb890bb8472f4dab20394dca781dad877eda39d50c870c0d5a0a8e48c718"},
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "3705d96080c17728a0e800eab6e0d23c", 2, "000102030405", "7bca285e2fd4130fb55b1a5c83bc5b24", "84d7f30754ed987bab0bf3506beb09cfb55402cef7e6877ce99e247e52d16ed4421dfdf8976c"},
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "3705d96080c17728a0e800eab6e0d23c", 2, "000102030405060708090a0b0c0d0e0f", "56ab21713ff62c0a1457200f6fa9948f", "3517d640f50ddc8ad3628722b3569d2ae07493fa8263254080ea65c1008e8fc295fb4852e7d83e1e7c48c37eebe6b0d3"},
+	{etypeID.AES128_CTS_HMAC_SHA256_128, "RFC 8009 A", "3705d96080c17728a0e800eab6e0d23c", 2, "000102030405060708090a0b0c0d0e0f1011121314", "a7a4e29a4728ce10664fb64e49ad3fac", "720f73b18d9859cd6ccb4346115cd336c70f58edc0c4437c5573544c31c813bce1e6d072c186b39a413c2f92ca9b8334a287ffcbfc"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", 2, "", "f764e9fa15c276478b2c7d0c4e5f58e4", "41f53fa5bfe7026d91faf9be959195a058707273a96a40f0a01960621ac612748b9bbfbe7eb4ce3c"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", 2, "000102030405", "b80d3251c1f6471494256ffe712d0b9a", "4ed7b37c2bcac8f74f23c1cf07e62bc7b75fb3f637b9f559c7f664f69eab7b6092237526ea0d1f61cb20d69d10f2"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", 2, "000102030405060708090a0b0c0d0e0f", "53bf8a0d105265d4e276428624ce5e63", "bc47ffec7998eb91e8115cf8d19dac4bbbe2e163e87dd37f49beca92027764f68cf51f14d798c2273f35df574d1f932e40c4ff255b36a266"},
+	{etypeID.AES256_CTS_HMAC_SHA384_192, "RFC 8009 A", "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", 2, "000102030405060708090a0b0c0d0e0f1011121314", "763e65367e864f02f55153c7e3b58af1", "40013e2df58e8751957d2878bcd2d6fe101ccfd556cb1eae79db3c3ee86429f2b2a602ac86fef6ecb647d6295fae077a1feb517508d2c16b4192e01f62"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "1dc46a8d763f4f93742bcba3387576c3", 0, "", "b69822a19a6b09c0ebc8557d1f1b6c0a", "c466f1871069921edb7c6fde244a52db0ba10edc197bdb8006658ca3ccce6eb8"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "5027bc231d0f3a9d23333f1ca6fdbe7c", 1, "31", "6f2fc3c2a166fd8898967a83de9596d9", "842d21fd950311c0dd464a3f4be8d6da88a56d559c9b47d3f9a85067af661559b8"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "a1bb61e805f9ba6dde8fdbddc05cdea0", 2, "392062797465737373", "a5b4a71e077aeef93c8763c18fdb1f10", "619ff072e36286ff0a28deb3a352ec0d0edf5c5160d663c901758ccf9d1ed33d71db8f23aabf8348a0"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "2ca27a5faf5532244506434e1cef6676", 3, "31332062797465732062797465", "19fee40d810c524b5b22f01874c693da", "b8eca3167ae6315512e59f98a7c500205e5f63ff3bb389af1c41a21d640d8615c9ed3fbeb05ab6acb67689b5ea"},
+	{etypeID.CAMELLIA128_CTS_CMAC, "RFC 6803 10", "7824f8c16f83ff354c6bf7515b973f43", 4, "333020627974657320627974657320627974657320627974657320627974", "ca7a7ab4be192dabd603506db19c39e2", "a26a3905a4ffd5816b7b1e27380d08090c8ec1f304496e1abdcd2bdcd1dffc660989e117a713ddbb57a4146c1587cba4356665591d2240282f5842b105a5"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "b61c86cc4e5d2757545ad423399fb7031ecab913cbb900bd7a3c6dd8bf92015b", 0, "", "3cbbd2b45917941067f96599bb98926c", "03886d03310b47a6d8f06d7b94d1dd837ecce315ef652aff620859d94a259266"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "1b97fe0a190e2021eb30753e1b6e1e77b0754b1d684610355864104963463833", 1, "31", "def487fcebe6de6346d4da4521bba2d2", "2c9c1570133c99bf6a34bc1b0212002fd194338749db4135497a347cfcd9d18a12"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "b038b132cd8e06612267fab7170066d88aeccba0b744bfc60dc89bca182d0715", 3, "31332062797465732062797465", "cf9bca6df1144e0c0af9b8f34c90d514", "eeec85a9813cdc536772ab9b42defc5706f726e975dde05a87eb5406ea324ca185c9986b42aabe794b84821bee"},
+	{etypeID.CAMELLIA256_CTS_CMAC, "RFC 6803 10", "ccfcd349bf4c6677e86e4b02b8eab924a546ac731cf9bf6989b996e7d6bfbba7", 4, "333020627974657320627974657320627974657320627974657320627974", "644def38da35007275878d216855e228", "0e44680985855f2d1f1812529ca83bfd8e349de6fd9ada0baaa048d68e265febf34ad1255a344999ad37146887a6c6845731ac7f46376a0504cd06571474"},
+}
@@ -92,11 +92,7 @@ func (e Des3CbcSha1Kd) DeriveRandom(protocolKey, usage []byte) ([]byte, error) {
 
 // DeriveKey derives a key from the protocol key based on the usage value.
 func (e Des3CbcSha1Kd) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
-	r, err := e.DeriveRandom(protocolKey, usage)
-	if err != nil {
-		return nil, err
-	}
-	return e.RandomToKey(r), nil
+	return rfc3961.DeriveKey(protocolKey, usage, e)
 }
 
 // EncryptData encrypts the data provided.
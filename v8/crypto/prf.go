@@ -0,0 +1,74 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc3961"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc8009"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// PseudoRandom implements the pseudo-random function of the key's encryption type.
+func PseudoRandom(key types.EncryptionKey, b []byte) ([]byte, error) {
+	et, err := GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	switch key.KeyType {
+	case etypeID.AES128_CTS_HMAC_SHA256_128, etypeID.AES256_CTS_HMAC_SHA384_192:
+		// RFC 8009 section 5
+		return rfc8009.KDF_HMAC_SHA2(key.KeyValue, []byte("prf"), b, et.GetHashFunc()().Size()*8, et), nil
+	case etypeID.RC4_HMAC:
+		// The PRF of RC4-HMAC is HMAC-SHA1 as implemented by MIT and Heimdal.
+		mac := hmac.New(sha1.New, key.KeyValue)
+		mac.Write(b)
+		return mac.Sum(nil), nil
+	default:
+		return rfc3961.PseudoRandom(key.KeyValue, b, et)
+	}
+}
+
+// PRFPlus implements the RFC 6113 PRF+ function returning n bytes from the key's pseudo-random function.
+func PRFPlus(key types.EncryptionKey, shared []byte, n int) ([]byte, error) {
+	var out []byte
+	for i := 1; len(out) < n; i++ {
+		if i > 255 {
+			return nil, fmt.Errorf("PRF+ output of %d bytes is too long", n)
+		}
+		p, err := PseudoRandom(key, append([]byte{byte(i)}, shared...))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p...)
+	}
+	return out[:n], nil
+}
+
+// KrbFxCf2 implements the RFC 6113 KRB-FX-CF2 function combining two keys. The key returned is of the encryption
+// type of the first key.
+func KrbFxCf2(key1, key2 types.EncryptionKey, pepper1, pepper2 string) (types.EncryptionKey, error) {
+	et, err := GetEtype(key1.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	n := et.GetKeySeedBitLength() / 8
+	b1, err := PRFPlus(key1, []byte(pepper1), n)
+	if err != nil {
+		return types.EncryptionKey{}, fmt.Errorf("error calculating PRF+ of the first key: %w", err)
+	}
+	b2, err := PRFPlus(key2, []byte(pepper2), n)
+	if err != nil {
+		return types.EncryptionKey{}, fmt.Errorf("error calculating PRF+ of the second key: %w", err)
+	}
+	for i := range b1 {
+		b1[i] ^= b2[i]
+	}
+	// random-to-key is the identity function for RC4-HMAC, RFC 4757 section 5.
+	if key1.KeyType != etypeID.RC4_HMAC {
+		b1 = et.RandomToKey(b1)
+	}
+	return types.EncryptionKey{KeyType: key1.KeyType, KeyValue: b1}, nil
+}
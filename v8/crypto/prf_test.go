@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPseudoRandom(t *testing.T) {
+	t.Parallel()
+	// Test vectors from RFC 8009 Appendix A
+	var tests = []struct {
+		etype int32
+		key   string
+		prf   string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA256_128, "3705d96080c17728a0e800eab6e0d23c", "9d188616f63852fe86915bb840b4a886ff3e6bb0f819b49b893393d393854295"},
+		{etypeID.AES256_CTS_HMAC_SHA384_192, "6d404d37faf79f9df0d33568d320669800eb4836472ea8a026d16b7182460c52", "9801f69a368c2bf675e59521e177d9a07f67efe1cfde8d3c8d6f6a0256e3b17db3c1b62ad1b8553360d17367eb1514d2"},
+	}
+	for _, test := range tests {
+		k, _ := hex.DecodeString(test.key)
+		b, err := PseudoRandom(types.EncryptionKey{KeyType: test.etype, KeyValue: k}, []byte("test"))
+		if err != nil {
+			t.Fatalf("error calculating PRF for etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.prf, hex.EncodeToString(b), "PRF not as expected for etype %d", test.etype)
+	}
+}
+
+func TestKrbFxCf2(t *testing.T) {
+	t.Parallel()
+	// Test vectors from MIT krb5 t_cf2 with the keys derived from the passwords "key1" and "key2", each salted with
+	// itself, and the peppers "a" and "b".
+	var tests = []struct {
+		etype int32
+		key   string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA1_96, "97df97e4b798b29eb31ed7280287a92a"},
+		{etypeID.AES256_CTS_HMAC_SHA1_96, "4d6ca4e629785c1f01baf55e2e548566b9617ae3a96868c337cb93b5e72b1c7b"},
+		{etypeID.DES3_CBC_SHA1_KD, "e58f9eb643862c13ad38e529313462a7f73e62834fe54a01"},
+		{etypeID.RC4_HMAC, "24d7f6b6bae4e5c00d2082c5ebab3672"},
+	}
+	for _, test := range tests {
+		k1, err := GetKeyFromPasswordAndSalt("key1", "key1", test.etype)
+		if err != nil {
+			t.Fatalf("error getting key for etype %d: %v", test.etype, err)
+		}
+		k2, err := GetKeyFromPasswordAndSalt("key2", "key2", test.etype)
+		if err != nil {
+			t.Fatalf("error getting key for etype %d: %v", test.etype, err)
+		}
+		k, err := KrbFxCf2(k1, k2, "a", "b")
+		if err != nil {
+			t.Fatalf("error calculating KRB-FX-CF2 for etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.etype, k.KeyType, "key type not as expected")
+		assert.Equal(t, test.key, hex.EncodeToString(k.KeyValue), "KRB-FX-CF2 not as expected for etype %d", test.etype)
+	}
+}
@@ -5,12 +5,12 @@ import (
 	"crypto/cipher"
 	"crypto/des"
 	"crypto/hmac"
-	"crypto/rand"
 	"errors"
 	"fmt"
 
 	"github.com/jcmturner/gokrb5/v8/crypto/common"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/internal/random"
 )
 
 // DES3EncryptData encrypts the data provided using DES3 and methods specific to the etype provided.
@@ -22,7 +22,7 @@ func DES3EncryptData(key, data []byte, e etype.EType) ([]byte, []byte, error) {
 
 	block, err := des.NewTripleDESCipher(key)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating cipher: %v", err)
+		return nil, nil, fmt.Errorf("error creating cipher: %w", err)
 	}
 
 	//RFC 3961: initial cipher state      All bits zero
@@ -39,9 +39,9 @@ func DES3EncryptData(key, data []byte, e etype.EType) ([]byte, []byte, error) {
 func DES3EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, []byte, error) {
 	//confounder
 	c := make([]byte, e.GetConfounderByteSize())
-	_, err := rand.Read(c)
+	_, err := random.Read(c)
 	if err != nil {
-		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %v", err)
+		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %w", err)
 	}
 	plainBytes := append(c, message...)
 	plainBytes, _ = common.ZeroPad(plainBytes, e.GetMessageBlockByteSize())
@@ -51,19 +51,19 @@ func DES3EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byt
 	if usage != 0 {
 		k, err = e.DeriveKey(key, common.GetUsageKe(usage))
 		if err != nil {
-			return []byte{}, []byte{}, fmt.Errorf("error deriving key for encryption: %v", err)
+			return []byte{}, []byte{}, fmt.Errorf("error deriving key for encryption: %w", err)
 		}
 	}
 
 	iv, b, err := e.EncryptData(k, plainBytes)
 	if err != nil {
-		return iv, b, fmt.Errorf("error encrypting data: %v", err)
+		return iv, b, fmt.Errorf("error encrypting data: %w", err)
 	}
 
 	// Generate and append integrity hash
 	ih, err := common.GetIntegrityHash(plainBytes, key, usage, e)
 	if err != nil {
-		return iv, b, fmt.Errorf("error encrypting data: %v", err)
+		return iv, b, fmt.Errorf("error encrypting data: %w", err)
 	}
 	b = append(b, ih...)
 	return iv, b, nil
@@ -80,7 +80,7 @@ func DES3DecryptData(key, data []byte, e etype.EType) ([]byte, error) {
 	}
 	block, err := des.NewTripleDESCipher(key)
 	if err != nil {
-		return []byte{}, fmt.Errorf("error creating cipher: %v", err)
+		return []byte{}, fmt.Errorf("error creating cipher: %w", err)
 	}
 	pt := make([]byte, len(data))
 	ivz := make([]byte, des.BlockSize)
@@ -95,12 +95,12 @@ func DES3DecryptMessage(key, ciphertext []byte, usage uint32, e etype.EType) ([]
 	//Derive the key
 	k, err := e.DeriveKey(key, common.GetUsageKe(usage))
 	if err != nil {
-		return nil, fmt.Errorf("error deriving key: %v", err)
+		return nil, fmt.Errorf("error deriving key: %w", err)
 	}
 	// Strip off the checksum from the end
 	b, err := e.DecryptData(k, ciphertext[:len(ciphertext)-e.GetHMACBitLength()/8])
 	if err != nil {
-		return nil, fmt.Errorf("error decrypting: %v", err)
+		return nil, fmt.Errorf("error decrypting: %w", err)
 	}
 	//Verify checksum
 	if !e.VerifyIntegrity(key, ciphertext, b, usage) {
@@ -112,8 +112,7 @@ func DES3DecryptMessage(key, ciphertext []byte, usage uint32, e etype.EType) ([]
 
 // VerifyIntegrity verifies the integrity of cipertext bytes ct.
 func VerifyIntegrity(key, ct, pt []byte, usage uint32, etype etype.EType) bool {
-	h := make([]byte, etype.GetHMACBitLength()/8)
-	copy(h, ct[len(ct)-etype.GetHMACBitLength()/8:])
+	h := ct[len(ct)-etype.GetHMACBitLength()/8:]
 	expectedMAC, _ := common.GetIntegrityHash(pt, key, usage, etype)
 	return hmac.Equal(h, expectedMAC)
 }
@@ -3,6 +3,7 @@ package rfc3961
 import (
 	"bytes"
 
+	"github.com/jcmturner/gokrb5/v8/crypto/common"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
 )
 
@@ -42,11 +43,16 @@ func DeriveRandom(key, usage []byte, e etype.EType) ([]byte, error) {
 
 // DeriveKey derives a key from the protocol key based on the usage and the etype's specific methods.
 func DeriveKey(protocolKey, usage []byte, e etype.EType) ([]byte, error) {
+	if k, ok := common.GetDerivedKey(e.GetETypeID(), protocolKey, usage); ok {
+		return k, nil
+	}
 	r, err := e.DeriveRandom(protocolKey, usage)
 	if err != nil {
 		return nil, err
 	}
-	return e.RandomToKey(r), nil
+	k := e.RandomToKey(r)
+	common.SetDerivedKey(e.GetETypeID(), protocolKey, usage, k)
+	return k, nil
 }
 
 // RandomToKey returns a key from the bytes provided according to the definition in RFC 3961.
@@ -75,7 +81,9 @@ func DES3StringToKey(secret, salt string, e etype.EType) ([]byte, error) {
 func PseudoRandom(key, b []byte, e etype.EType) ([]byte, error) {
 	h := e.GetHashFunc()()
 	h.Write(b)
-	tmp := h.Sum(nil)[:e.GetMessageBlockByteSize()]
+	tmp := h.Sum(nil)
+	// Truncate the hash to a multiple of the cipher block size
+	tmp = tmp[:len(tmp)-len(tmp)%(e.GetCypherBlockBitLength()/8)]
 	k, err := e.DeriveKey(key, []byte(prfconstant))
 	if err != nil {
 		return []byte{}, err
@@ -2,13 +2,13 @@
 package rfc3962
 
 import (
-	"crypto/rand"
 	"errors"
 	"fmt"
 
 	"github.com/jcmturner/aescts/v2"
 	"github.com/jcmturner/gokrb5/v8/crypto/common"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/internal/random"
 )
 
 // EncryptData encrypts the data provided using methods specific to the etype provided as defined in RFC 3962.
@@ -28,9 +28,9 @@ func EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, [
 	}
 	//confounder
 	c := make([]byte, e.GetConfounderByteSize())
-	_, err := rand.Read(c)
+	_, err := random.Read(c)
 	if err != nil {
-		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %v", err)
+		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %w", err)
 	}
 	plainBytes := append(c, message...)
 
@@ -39,20 +39,20 @@ func EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, [
 	if usage != 0 {
 		k, err = e.DeriveKey(key, common.GetUsageKe(usage))
 		if err != nil {
-			return []byte{}, []byte{}, fmt.Errorf("error deriving key for encryption: %v", err)
+			return []byte{}, []byte{}, fmt.Errorf("error deriving key for encryption: %w", err)
 		}
 	}
 
 	// Encrypt the data
 	iv, b, err := e.EncryptData(k, plainBytes)
 	if err != nil {
-		return iv, b, fmt.Errorf("error encrypting data: %v", err)
+		return iv, b, fmt.Errorf("error encrypting data: %w", err)
 	}
 
 	// Generate and append integrity hash
 	ih, err := common.GetIntegrityHash(plainBytes, key, usage, e)
 	if err != nil {
-		return iv, b, fmt.Errorf("error encrypting data: %v", err)
+		return iv, b, fmt.Errorf("error encrypting data: %w", err)
 	}
 	b = append(b, ih...)
 	return iv, b, nil
@@ -70,10 +70,13 @@ func DecryptData(key, data []byte, e etype.EType) ([]byte, error) {
 // DecryptMessage decrypts the message provided using the methods specific to the etype provided as defined in RFC 3962.
 // The integrity of the message is also verified.
 func DecryptMessage(key, ciphertext []byte, usage uint32, e etype.EType) ([]byte, error) {
+	if len(ciphertext) < e.GetConfounderByteSize()+e.GetHMACBitLength()/8 {
+		return nil, errors.New("ciphertext is too short")
+	}
 	//Derive the key
 	k, err := e.DeriveKey(key, common.GetUsageKe(usage))
 	if err != nil {
-		return nil, fmt.Errorf("error deriving key: %v", err)
+		return nil, fmt.Errorf("error deriving key: %w", err)
 	}
 	// Strip off the checksum from the end
 	b, err := e.DecryptData(k, ciphertext[:len(ciphertext)-e.GetHMACBitLength()/8])
@@ -0,0 +1,248 @@
+// Package rfc6803 provides encryption and checksum methods as specified in RFC 6803
+package rfc6803
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/common"
+	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/internal/camellia"
+	"github.com/jcmturner/gokrb5/v8/internal/random"
+)
+
+// EncryptData encrypts the data provided with Camellia in CBC mode with ciphertext stealing and a zero initial vector
+// as defined in RFC 6803.
+func EncryptData(key, data []byte, e etype.EType) ([]byte, []byte, error) {
+	if len(key) != e.GetKeyByteSize() {
+		return []byte{}, []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
+	}
+	block, err := camellia.NewCipher(key)
+	if err != nil {
+		return []byte{}, []byte{}, fmt.Errorf("error creating cipher: %w", err)
+	}
+	ivz := make([]byte, camellia.BlockSize)
+	return ctsEncrypt(block, ivz, data)
+}
+
+// EncryptMessage encrypts the message provided using the methods specific to the etype provided as defined in RFC 6803.
+// The encrypted data is concatenated with its integrity hash, the CMAC of the confounder and message, to create an
+// encrypted message.
+func EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, []byte, error) {
+	if len(key) != e.GetKeyByteSize() {
+		return []byte{}, []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
+	}
+	//confounder
+	c := make([]byte, e.GetConfounderByteSize())
+	_, err := random.Read(c)
+	if err != nil {
+		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %w", err)
+	}
+	plainBytes := append(c, message...)
+
+	// Derive key for encryption from usage
+	k, err := e.DeriveKey(key, common.GetUsageKe(usage))
+	if err != nil {
+		return []byte{}, []byte{}, fmt.Errorf("error deriving key for encryption: %w", err)
+	}
+
+	// Encrypt the data
+	iv, b, err := e.EncryptData(k, plainBytes)
+	if err != nil {
+		return iv, b, fmt.Errorf("error encrypting data: %w", err)
+	}
+
+	ih, err := GetIntegrityHash(plainBytes, key, usage, e)
+	if err != nil {
+		return iv, b, fmt.Errorf("error encrypting data: %w", err)
+	}
+	b = append(b, ih...)
+	return iv, b, nil
+}
+
+// DecryptData decrypts the data provided using the methods specific to the etype provided as defined in RFC 6803.
+func DecryptData(key, data []byte, e etype.EType) ([]byte, error) {
+	if len(key) != e.GetKeyByteSize() {
+		return []byte{}, fmt.Errorf("incorrect keysize: expected: %v actual: %v", e.GetKeyByteSize(), len(key))
+	}
+	block, err := camellia.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	ivz := make([]byte, camellia.BlockSize)
+	return ctsDecrypt(block, ivz, data)
+}
+
+// DecryptMessage decrypts the message provided using the methods specific to the etype provided as defined in RFC 6803.
+// The integrity of the message is also verified.
+func DecryptMessage(key, ciphertext []byte, usage uint32, e etype.EType) ([]byte, error) {
+	hl := e.GetHMACBitLength() / 8
+	if len(ciphertext) < e.GetConfounderByteSize()+hl {
+		return nil, errors.New("ciphertext is too short")
+	}
+	//Derive the key
+	k, err := e.DeriveKey(key, common.GetUsageKe(usage))
+	if err != nil {
+		return nil, fmt.Errorf("error deriving key: %w", err)
+	}
+	// Strip off the checksum from the end
+	b, err := e.DecryptData(k, ciphertext[:len(ciphertext)-hl])
+	if err != nil {
+		return nil, err
+	}
+	//Verify checksum
+	if !e.VerifyIntegrity(key, ciphertext, b, usage) {
+		return nil, errors.New("integrity verification failed")
+	}
+	//Remove the confounder bytes
+	return b[e.GetConfounderByteSize():], nil
+}
+
+// GetIntegrityHash returns the integrity hash of the confounder and plaintext bytes provided: their CMAC with the
+// integrity key of the usage.
+func GetIntegrityHash(pt, key []byte, usage uint32, e etype.EType) ([]byte, error) {
+	return GetHash(pt, key, common.GetUsageKi(usage), e)
+}
+
+// VerifyIntegrity verifies the integrity hash at the end of the ciphertext ct against the decrypted confounder and
+// plaintext pt.
+func VerifyIntegrity(key, ct, pt []byte, usage uint32, e etype.EType) bool {
+	hl := e.GetHMACBitLength() / 8
+	if len(ct) < hl {
+		return false
+	}
+	expectedMAC, err := GetIntegrityHash(pt, key, usage, e)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(ct[len(ct)-hl:], expectedMAC)
+}
+
+// GetChecksumHash returns the keyed checksum of the bytes provided: their CMAC with the checksum key of the usage.
+func GetChecksumHash(b, key []byte, usage uint32, e etype.EType) ([]byte, error) {
+	return GetHash(b, key, common.GetUsageKc(usage), e)
+}
+
+// GetHash returns the CMAC of the bytes with the key derived from the protocol key for the usage.
+func GetHash(b, key, usage []byte, e etype.EType) ([]byte, error) {
+	k, err := e.DeriveKey(key, usage)
+	if err != nil {
+		return nil, fmt.Errorf("unable to derive key for checksum: %w", err)
+	}
+	block, err := camellia.NewCipher(k)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return cmac(block, b)[:e.GetHMACBitLength()/8], nil
+}
+
+// ctsEncrypt encrypts the data in CBC mode with ciphertext stealing, swapping the last two blocks as RFC 3962 does,
+// returning the next initial vector and the ciphertext.
+func ctsEncrypt(block cipher.Block, iv, data []byte) ([]byte, []byte, error) {
+	bs := block.BlockSize()
+	if len(data) < 1 {
+		return []byte{}, []byte{}, errors.New("data not valid to encrypt: zero size")
+	}
+	n := len(data)
+	m := make([]byte, ((n+bs-1)/bs)*bs)
+	copy(m, data)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(m, m)
+	if len(m) == bs {
+		return m, m, nil
+	}
+	// The last ciphertext block is that of the zero padded last plaintext block, so the last two blocks are swapped
+	// and the output truncated to the length of the plaintext.
+	// The next initial vector is the last block of the CBC output, which is the next-to-last block once swapped.
+	l := len(m)
+	next := make([]byte, bs)
+	copy(next, m[l-bs:])
+	pb := make([]byte, bs)
+	copy(pb, m[l-2*bs:l-bs])
+	copy(m[l-2*bs:], m[l-bs:])
+	copy(m[l-bs:], pb)
+	return next, m[:n], nil
+}
+
+// ctsDecrypt decrypts the data encrypted by ctsEncrypt.
+func ctsDecrypt(block cipher.Block, iv, ct []byte) ([]byte, error) {
+	bs := block.BlockSize()
+	n := len(ct)
+	if n < bs {
+		return nil, fmt.Errorf("ciphertext is not large enough. It is less that one block size. Blocksize:%v; Ciphertext:%v", bs, n)
+	}
+	if n == bs {
+		pt := make([]byte, bs)
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(pt, ct)
+		return pt, nil
+	}
+	nb := (n + bs - 1) / bs
+	d := n - (nb-1)*bs
+	// The penultimate ciphertext block is the encryption of the zero padded last plaintext block, its decryption
+	// recovers the tail of the last ciphertext block which was truncated.
+	z := make([]byte, bs)
+	block.Decrypt(z, ct[(nb-2)*bs:(nb-1)*bs])
+	c := make([]byte, nb*bs)
+	copy(c, ct[:(nb-2)*bs])
+	copy(c[(nb-2)*bs:], ct[(nb-1)*bs:])
+	copy(c[(nb-2)*bs+d:], z[d:])
+	copy(c[(nb-1)*bs:], ct[(nb-2)*bs:(nb-1)*bs])
+	pt := make([]byte, nb*bs)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(pt[:(nb-1)*bs], c[:(nb-1)*bs])
+	for i := 0; i < d; i++ {
+		pt[(nb-1)*bs+i] = z[i] ^ c[(nb-2)*bs+i]
+	}
+	return pt[:n], nil
+}
+
+// cmac returns the CMAC, RFC 4493, of the message with the 128 bit block cipher.
+func cmac(block cipher.Block, msg []byte) []byte {
+	bs := block.BlockSize()
+	k1 := make([]byte, bs)
+	block.Encrypt(k1, k1)
+	k1 = cmacDouble(k1)
+	k2 := cmacDouble(k1)
+	nb := (len(msg) + bs - 1) / bs
+	last := make([]byte, bs)
+	if nb > 0 && len(msg)%bs == 0 {
+		copy(last, msg[(nb-1)*bs:])
+		xorBytes(last, k1)
+	} else {
+		if nb == 0 {
+			nb = 1
+		}
+		r := msg[(nb-1)*bs:]
+		copy(last, r)
+		last[len(r)] = 0x80
+		xorBytes(last, k2)
+	}
+	x := make([]byte, bs)
+	for i := 0; i < nb-1; i++ {
+		xorBytes(x, msg[i*bs:(i+1)*bs])
+		block.Encrypt(x, x)
+	}
+	xorBytes(x, last)
+	block.Encrypt(x, x)
+	return x
+}
+
+// cmacDouble multiplies the block by x in GF(2^128) to generate the CMAC subkeys.
+func cmacDouble(b []byte) []byte {
+	d := make([]byte, len(b))
+	var carry byte
+	for i := len(b) - 1; i >= 0; i-- {
+		d[i] = b[i]<<1 | carry
+		carry = b[i] >> 7
+	}
+	if carry != 0 {
+		d[len(d)-1] ^= 0x87
+	}
+	return d
+}
+
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
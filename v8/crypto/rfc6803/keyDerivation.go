@@ -0,0 +1,102 @@
+package rfc6803
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/common"
+	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/internal/camellia"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	s2kParamsZero = 32768
+)
+
+// DeriveRandom generates data needed for key generation with the KDF-FEEDBACK-CMAC function as defined in RFC 6803
+// section 3.
+func DeriveRandom(protocolKey, constant []byte, e etype.EType) ([]byte, error) {
+	block, err := camellia.NewCipher(protocolKey)
+	if err != nil {
+		return nil, err
+	}
+	k := e.GetKeySeedBitLength()
+	n := (k + 127) / 128
+	var kb [4]byte
+	binary.BigEndian.PutUint32(kb[:], uint32(k))
+	ki := make([]byte, camellia.BlockSize)
+	out := make([]byte, 0, n*camellia.BlockSize)
+	for i := 1; i <= n; i++ {
+		// K(i) = CMAC(key, K(i-1) | i | constant | 0x00 | k)
+		msg := make([]byte, 0, len(ki)+4+len(constant)+1+4)
+		msg = append(msg, ki...)
+		var ib [4]byte
+		binary.BigEndian.PutUint32(ib[:], uint32(i))
+		msg = append(msg, ib[:]...)
+		msg = append(msg, constant...)
+		msg = append(msg, 0x00)
+		msg = append(msg, kb[:]...)
+		ki = cmac(block, msg)
+		out = append(out, ki...)
+	}
+	return out[:k/8], nil
+}
+
+// DeriveKey derives a key from the protocol key based on the usage and the etype's specific methods.
+//
+// https://tools.ietf.org/html/rfc6803#section-3
+func DeriveKey(protocolKey, usage []byte, e etype.EType) ([]byte, error) {
+	if k, ok := common.GetDerivedKey(e.GetETypeID(), protocolKey, usage); ok {
+		return k, nil
+	}
+	r, err := e.DeriveRandom(protocolKey, usage)
+	if err != nil {
+		return nil, err
+	}
+	k := e.RandomToKey(r)
+	common.SetDerivedKey(e.GetETypeID(), protocolKey, usage, k)
+	return k, nil
+}
+
+// RandomToKey returns a key from the bytes provided according to the definition in RFC 6803.
+func RandomToKey(b []byte) []byte {
+	return b
+}
+
+// StringToKey returns a key derived from the string provided according to the definition in RFC 6803.
+func StringToKey(secret, salt, s2kparams string, e etype.EType) ([]byte, error) {
+	i, err := S2KparamsToItertions(s2kparams)
+	if err != nil {
+		return nil, err
+	}
+	return StringToKeyIter(secret, salt, i, e)
+}
+
+// StringToKeyIter returns a key derived from the string provided according to the definition in RFC 6803.
+func StringToKeyIter(secret, salt string, iterations int, e etype.EType) ([]byte, error) {
+	// PBKDF2 uses HMAC-SHA1 as in RFC 3962.
+	tkey := e.RandomToKey(pbkdf2.Key([]byte(secret), []byte(salt), iterations, e.GetKeyByteSize(), e.GetHashFunc()))
+	return e.DeriveKey(tkey, []byte("kerberos"))
+}
+
+// S2KparamsToItertions converts the string representation of iterations to an integer for RFC 6803.
+func S2KparamsToItertions(s2kparams string) (int, error) {
+	if len(s2kparams) != 8 {
+		return s2kParamsZero, errors.New("Invalid s2kparams length")
+	}
+	b, err := hex.DecodeString(s2kparams)
+	if err != nil {
+		return s2kParamsZero, errors.New("Invalid s2kparams, cannot decode string to bytes")
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+// GetSaltP returns the salt value based on the etype name: https://tools.ietf.org/html/rfc6803#section-4
+func GetSaltP(salt, ename string) string {
+	b := []byte(ename)
+	b = append(b, byte(0))
+	b = append(b, []byte(salt)...)
+	return string(b)
+}
@@ -4,7 +4,6 @@ package rfc8009
 import (
 	"crypto/aes"
 	"crypto/hmac"
-	"crypto/rand"
 	"errors"
 	"fmt"
 
@@ -12,6 +11,7 @@ import (
 	"github.com/jcmturner/gokrb5/v8/crypto/common"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
 	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/internal/random"
 )
 
 // EncryptData encrypts the data provided using methods specific to the etype provided as defined in RFC 8009.
@@ -41,9 +41,9 @@ func EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, [
 	}
 	//confounder
 	c := make([]byte, e.GetConfounderByteSize())
-	_, err := rand.Read(c)
+	_, err := random.Read(c)
 	if err != nil {
-		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %v", err)
+		return []byte{}, []byte{}, fmt.Errorf("could not generate random confounder: %w", err)
 	}
 	plainBytes := append(c, message...)
 
@@ -52,20 +52,20 @@ func EncryptMessage(key, message []byte, usage uint32, e etype.EType) ([]byte, [
 	if usage != 0 {
 		k, err = e.DeriveKey(key, common.GetUsageKe(usage))
 		if err != nil {
-			return []byte{}, []byte{}, fmt.Errorf("error deriving key for encryption: %v", err)
+			return []byte{}, []byte{}, fmt.Errorf("error deriving key for encryption: %w", err)
 		}
 	}
 
 	// Encrypt the data
 	iv, b, err := e.EncryptData(k, plainBytes)
 	if err != nil {
-		return iv, b, fmt.Errorf("error encrypting data: %v", err)
+		return iv, b, fmt.Errorf("error encrypting data: %w", err)
 	}
 
 	ivz := make([]byte, e.GetConfounderByteSize())
 	ih, err := GetIntegityHash(ivz, b, key, usage, e)
 	if err != nil {
-		return iv, b, fmt.Errorf("error encrypting data: %v", err)
+		return iv, b, fmt.Errorf("error encrypting data: %w", err)
 	}
 	b = append(b, ih...)
 	return iv, b, nil
@@ -90,7 +90,7 @@ func DecryptMessage(key, ciphertext []byte, usage uint32, e etype.EType) ([]byte
 	//Derive the key
 	k, err := e.DeriveKey(key, common.GetUsageKe(usage))
 	if err != nil {
-		return nil, fmt.Errorf("error deriving key: %v", err)
+		return nil, fmt.Errorf("error deriving key: %w", err)
 	}
 	// Strip off the checksum from the end
 	b, err := e.DecryptData(k, ciphertext[:len(ciphertext)-e.GetHMACBitLength()/8])
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"errors"
 
+	"github.com/jcmturner/gokrb5/v8/crypto/common"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
 	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
 	"golang.org/x/crypto/pbkdf2"
@@ -25,6 +26,9 @@ func DeriveRandom(protocolKey, usage []byte, e etype.EType) ([]byte, error) {
 //
 // https://tools.ietf.org/html/rfc8009#section-5
 func DeriveKey(protocolKey, label []byte, e etype.EType) []byte {
+	if k, ok := common.GetDerivedKey(e.GetETypeID(), protocolKey, label); ok {
+		return k
+	}
 	var context []byte
 	var kl int
 	// Key length is longer for aes256-cts-hmac-sha384-192 is it is a Ke or from StringToKey (where label is "kerberos")
@@ -55,7 +59,9 @@ func DeriveKey(protocolKey, label []byte, e etype.EType) []byte {
 	if kl == 0 {
 		kl = e.GetKeySeedBitLength()
 	}
-	return e.RandomToKey(KDF_HMAC_SHA2(protocolKey, label, context, kl, e))
+	k := e.RandomToKey(KDF_HMAC_SHA2(protocolKey, label, context, kl, e))
+	common.SetDerivedKey(e.GetETypeID(), protocolKey, label, k)
+	return k
 }
 
 // RandomToKey returns a key from the bytes provided according to the definition in RFC 8009.
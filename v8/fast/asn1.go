@@ -0,0 +1,138 @@
+package fast
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ArmorAPRequest is the RFC 6113 FX_FAST_ARMOR_AP_REQUEST armor type, an AP_REQ for an armor TGT.
+const ArmorAPRequest int32 = 1
+
+// PA-FX-FAST-REQUEST and PA-FX-FAST-REPLY are CHOICEs with the armored data as the only alternative.
+const armoredDataTag = 0
+
+// KrbFastArmor implements RFC 6113 KrbFastArmor.
+type KrbFastArmor struct {
+	ArmorType  int32  `asn1:"explicit,tag:0"`
+	ArmorValue []byte `asn1:"explicit,tag:1"`
+}
+
+// KrbFastArmoredReq implements RFC 6113 KrbFastArmoredReq, the armored-data choice of PA-FX-FAST-REQUEST.
+type KrbFastArmoredReq struct {
+	Armor       KrbFastArmor        `asn1:"explicit,optional,tag:0"`
+	ReqChecksum types.Checksum      `asn1:"explicit,tag:1"`
+	EncFastReq  types.EncryptedData `asn1:"explicit,tag:2"`
+}
+
+type marshalKrbFastReq struct {
+	FastOptions asn1.BitString       `asn1:"explicit,tag:0"`
+	PAData      types.PADataSequence `asn1:"explicit,tag:1"`
+	ReqBody     asn1.RawValue        `asn1:"explicit,tag:2"`
+}
+
+// KrbFastReq implements RFC 6113 KrbFastReq, the content of the encrypted part of KrbFastArmoredReq.
+type KrbFastReq struct {
+	FastOptions asn1.BitString
+	PAData      types.PADataSequence
+	ReqBody     messages.KDCReqBody
+}
+
+// KrbFastArmoredRep implements RFC 6113 KrbFastArmoredRep, the armored-data choice of PA-FX-FAST-REPLY.
+type KrbFastArmoredRep struct {
+	EncFastRep types.EncryptedData `asn1:"explicit,tag:0"`
+}
+
+// KrbFastResponse implements RFC 6113 KrbFastResponse, the content of the encrypted part of KrbFastArmoredRep.
+type KrbFastResponse struct {
+	PAData        types.PADataSequence `asn1:"explicit,tag:0"`
+	StrengthenKey types.EncryptionKey  `asn1:"explicit,optional,tag:1"`
+	Finished      KrbFastFinished      `asn1:"explicit,optional,tag:2"`
+	Nonce         int                  `asn1:"explicit,tag:3"`
+}
+
+// KrbFastFinished implements RFC 6113 KrbFastFinished.
+type KrbFastFinished struct {
+	Timestamp      time.Time           `asn1:"generalized,explicit,tag:0"`
+	Usec           int                 `asn1:"explicit,tag:1"`
+	CRealm         string              `asn1:"generalstring,explicit,tag:2"`
+	CName          types.PrincipalName `asn1:"explicit,tag:3"`
+	TicketChecksum types.Checksum      `asn1:"explicit,tag:4"`
+}
+
+// Marshal the KrbFastReq.
+func (k *KrbFastReq) Marshal() ([]byte, error) {
+	b, err := k.ReqBody.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	m := marshalKrbFastReq{
+		FastOptions: k.FastOptions,
+		PAData:      k.PAData,
+		ReqBody: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			IsCompound: true,
+			Tag:        2,
+			Bytes:      b,
+		},
+	}
+	if m.PAData == nil {
+		m.PAData = types.PADataSequence{}
+	}
+	b, err = asn1.Marshal(m)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastReq")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the KrbFastReq.
+func (k *KrbFastReq) Unmarshal(b []byte) error {
+	var m marshalKrbFastReq
+	_, err := asn1.Unmarshal(b, &m)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastReq")
+	}
+	var body messages.KDCReqBody
+	err = body.Unmarshal(m.ReqBody.Bytes)
+	if err != nil {
+		return err
+	}
+	k.FastOptions = m.FastOptions
+	k.PAData = m.PAData
+	k.ReqBody = body
+	return nil
+}
+
+// marshalArmoredData marshals the armored data v as the armored-data choice of PA-FX-FAST-REQUEST or
+// PA-FX-FAST-REPLY.
+func marshalArmoredData(v interface{}) ([]byte, error) {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        armoredDataTag,
+		Bytes:      b,
+	})
+}
+
+// unmarshalArmoredData unmarshals the armored-data choice of PA-FX-FAST-REQUEST or PA-FX-FAST-REPLY into v.
+func unmarshalArmoredData(b []byte, v interface{}) error {
+	var choice asn1.RawValue
+	_, err := asn1.Unmarshal(b, &choice)
+	if err != nil {
+		return err
+	}
+	if choice.Class != asn1.ClassContextSpecific || choice.Tag != armoredDataTag {
+		return krberror.WithKind(fmt.Errorf("unexpected PA-FX-FAST choice %d", choice.Tag), krberror.KindProtocol)
+	}
+	_, err = asn1.Unmarshal(choice.Bytes, v)
+	return err
+}
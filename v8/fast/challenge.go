@@ -0,0 +1,88 @@
+package fast
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// EncryptedChallenge returns the PA-ENCRYPTED-CHALLENGE pre-authentication data for the client's long-term key, RFC
+// 6113 section 5.4.6. The timestamp is encrypted with the client challenge key, derived from both the armor key and the
+// client's key, so that it cannot be used for an offline dictionary attack on the client's password.
+func (a *Armor) EncryptedChallenge(key types.EncryptionKey) (types.PAData, error) {
+	return a.EncryptedChallengeAt(key, time.Now())
+}
+
+// EncryptedChallengeAt returns the PA-ENCRYPTED-CHALLENGE pre-authentication data for the client's long-term key with
+// the timestamp given, such as one corrected for the skew of the client's clock from the KDC's.
+func (a *Armor) EncryptedChallengeAt(key types.EncryptionKey, t time.Time) (types.PAData, error) {
+	ck, err := crypto.KrbFxCf2(a.key, key, "clientchallengearmor", "challengelongterm")
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error deriving client challenge key")
+	}
+	tsb, err := types.GetPAEncTSEncAsnMarshalledAt(t)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for encrypted challenge")
+	}
+	ed, err := crypto.GetEncryptedData(tsb, ck, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT, 0)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error encrypting encrypted challenge timestamp")
+	}
+	b, err := ed.Marshal()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling encrypted challenge")
+	}
+	a.challengeKey = key
+	return types.PAData{
+		PADataType:  patype.PA_ENCRYPTED_CHALLENGE,
+		PADataValue: b,
+	}, nil
+}
+
+// ChallengeReplyKey verifies the KDC's PA-ENCRYPTED-CHALLENGE in the PA data of the reply to a request
+// pre-authenticated with EncryptedChallenge and returns the key the reply is encrypted with. The KDC's timestamp must
+// be within the clock skew of the time now. As the KDC replaces the reply key with the armor key, RFC 6113 section
+// 5.4.6, the armor key is returned.
+func (a *Armor) ChallengeReplyKey(pas types.PADataSequence, now time.Time, skew time.Duration) (types.EncryptionKey, error) {
+	if len(a.challengeKey.KeyValue) < 1 {
+		return types.EncryptionKey{}, errors.New("request was not pre-authenticated with an encrypted challenge")
+	}
+	var b []byte
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_ENCRYPTED_CHALLENGE {
+			b = pa.PADataValue
+			break
+		}
+	}
+	if b == nil {
+		return types.EncryptionKey{}, krberror.WithKind(errors.New("KDC reply does not contain PA-ENCRYPTED-CHALLENGE"), krberror.KindProtocol)
+	}
+	var ed types.EncryptedData
+	err := ed.Unmarshal(b)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC PA-ENCRYPTED-CHALLENGE")
+	}
+	kk, err := crypto.KrbFxCf2(a.key, a.challengeKey, "kdcchallengearmor", "challengelongterm")
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error deriving KDC challenge key")
+	}
+	db, err := crypto.DecryptEncPart(ed, kk, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.DecryptingError, "error decrypting KDC PA-ENCRYPTED-CHALLENGE")
+	}
+	var ts types.PAEncTSEnc
+	_, err = asn1.Unmarshal(db, &ts)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC PA-ENCRYPTED-CHALLENGE timestamp")
+	}
+	if d := now.Sub(ts.PATimestamp); d > skew || d < -skew {
+		return types.EncryptionKey{}, krberror.WithKind(errors.New("KDC PA-ENCRYPTED-CHALLENGE timestamp is outside the clock skew"), krberror.KindProtocol)
+	}
+	return a.key, nil
+}
@@ -0,0 +1,88 @@
+package fast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testKDCChallenge returns the KDC's PA-ENCRYPTED-CHALLENGE with the timestamp provided.
+func testKDCChallenge(t *testing.T, armorKey, key types.EncryptionKey, ts time.Time) types.PAData {
+	kk, err := crypto.KrbFxCf2(armorKey, key, "kdcchallengearmor", "challengelongterm")
+	if err != nil {
+		t.Fatalf("error deriving KDC challenge key: %v", err)
+	}
+	b, _ := asn1.Marshal(types.PAEncTSEnc{PATimestamp: ts})
+	ed, err := crypto.GetEncryptedData(b, kk, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC, 0)
+	if err != nil {
+		t.Fatalf("error encrypting KDC challenge: %v", err)
+	}
+	eb, _ := ed.Marshal()
+	return types.PAData{PADataType: patype.PA_ENCRYPTED_CHALLENGE, PADataValue: eb}
+}
+
+func TestArmor_EncryptedChallenge(t *testing.T) {
+	t.Parallel()
+	tgt, sessionKey := testTicket(t)
+	a, err := NewASArmor(tgt, sessionKey, "TEST.GOKRB5", testCName)
+	if err != nil {
+		t.Fatalf("error creating armor: %v", err)
+	}
+	key, err := crypto.GetKeyFromPasswordAndSalt("passwordvalue", "TEST.GOKRB5testuser1", etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting client key: %v", err)
+	}
+
+	_, err = a.ChallengeReplyKey(types.PADataSequence{}, time.Now(), time.Minute)
+	assert.Error(t, err, "reply key should not be returned without an encrypted challenge")
+
+	pa, err := a.EncryptedChallenge(key)
+	if err != nil {
+		t.Fatalf("error creating encrypted challenge: %v", err)
+	}
+	assert.Equal(t, patype.PA_ENCRYPTED_CHALLENGE, pa.PADataType, "PA data type not as expected")
+
+	// KDC processing of the client's challenge
+	var ed types.EncryptedData
+	err = ed.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling encrypted challenge: %v", err)
+	}
+	ck, _ := crypto.KrbFxCf2(a.key, key, "clientchallengearmor", "challengelongterm")
+	b, err := crypto.DecryptEncPart(ed, ck, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT)
+	if err != nil {
+		t.Fatalf("error decrypting encrypted challenge: %v", err)
+	}
+	var ts types.PAEncTSEnc
+	_, err = asn1.Unmarshal(b, &ts)
+	if err != nil {
+		t.Fatalf("error unmarshaling encrypted challenge timestamp: %v", err)
+	}
+	assert.WithinDuration(t, time.Now(), ts.PATimestamp, time.Minute, "encrypted challenge timestamp not as expected")
+	_, err = crypto.DecryptEncPart(ed, key, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT)
+	assert.Error(t, err, "encrypted challenge should not be decryptable with the client's key alone")
+
+	now := time.Now().UTC()
+	rk, err := a.ChallengeReplyKey(types.PADataSequence{testKDCChallenge(t, a.key, key, now)}, now, time.Minute)
+	if err != nil {
+		t.Fatalf("error verifying KDC challenge: %v", err)
+	}
+	assert.Equal(t, a.key, rk, "reply key should be the armor key")
+
+	_, err = a.ChallengeReplyKey(types.PADataSequence{testKDCChallenge(t, a.key, key, now.Add(-time.Hour))}, now, time.Minute)
+	assert.Equal(t, krberror.KindProtocol, krberror.ErrorKind(err), "KDC challenge outside the clock skew should be a protocol error: %v", err)
+
+	_, err = a.ChallengeReplyKey(types.PADataSequence{testKDCChallenge(t, sessionKey, key, now)}, now, time.Minute)
+	assert.Error(t, err, "KDC challenge with the wrong armor key should not verify")
+
+	_, err = a.ChallengeReplyKey(types.PADataSequence{}, now, time.Minute)
+	assert.Equal(t, krberror.KindProtocol, krberror.ErrorKind(err), "missing KDC challenge should be a protocol error: %v", err)
+}
@@ -0,0 +1,302 @@
+// Package fast implements the client side of RFC 6113 Flexible Authentication Secure Tunneling (FAST) so that the
+// pre-authentication data and body of AS and TGS requests, and the KDC's replies and errors, are protected by an
+// armor key.
+//
+// AS exchanges are armored with an AP_REQ for an armor TGT, such as one obtained with the host's keytab. TGS
+// exchanges are armored with the TGT the request is made with.
+package fast
+
+import (
+	"errors"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Armor holds the armor key and state of a FAST armored exchange with the KDC.
+type Armor struct {
+	key           types.EncryptionKey
+	armor         KrbFastArmor
+	subKey        types.EncryptionKey
+	nonce         int
+	cookie        []byte
+	strengthenKey types.EncryptionKey
+	challengeKey  types.EncryptionKey
+	otp           bool
+}
+
+// NewASArmor returns the armor for an AS exchange from the armor TGT and its session key. The client name and realm
+// are those of the principal the armor TGT was issued to.
+func NewASArmor(tgt messages.Ticket, sessionKey types.EncryptionKey, crealm string, cname types.PrincipalName) (*Armor, error) {
+	et, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error getting etype of armor TGT session key")
+	}
+	auth, err := types.NewAuthenticator(crealm, cname)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error generating armor authenticator")
+	}
+	err = auth.GenerateSeqNumberAndSubKey(sessionKey.KeyType, et.GetKeyByteSize())
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error generating armor authenticator subkey")
+	}
+	ab, err := auth.Marshal()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling armor authenticator")
+	}
+	// The KDC verifies the armor as an AP_REQ rather than a PA-TGS-REQ so the AP_REQ authenticator key usage applies
+	// even though the ticket is a TGT.
+	ed, err := crypto.GetEncryptedData(ab, sessionKey, keyusage.AP_REQ_AUTHENTICATOR, tgt.EncPart.KVNO)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error encrypting armor authenticator")
+	}
+	apReq := messages.APReq{
+		PVNO:                   iana.PVNO,
+		MsgType:                msgtype.KRB_AP_REQ,
+		APOptions:              types.NewKrbFlags(),
+		Ticket:                 tgt,
+		EncryptedAuthenticator: ed,
+	}
+	b, err := apReq.Marshal()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling armor AP_REQ")
+	}
+	key, err := armorKey(auth.SubKey, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Armor{
+		key:   key,
+		armor: KrbFastArmor{ArmorType: ArmorAPRequest, ArmorValue: b},
+	}, nil
+}
+
+// NewTGSArmor returns the armor for a TGS exchange with the TGT the TGS_REQ is made with. A new subkey is set in the
+// authenticator of the TGS_REQ's PA-TGS-REQ, from which the armor key is derived.
+func NewTGSArmor(tgsReq *messages.TGSReq, tgt messages.Ticket, sessionKey types.EncryptionKey) (*Armor, error) {
+	subKey, err := tgsReq.SetSubKey(tgt, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := armorKey(subKey, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Armor{
+		key:    key,
+		subKey: subKey,
+	}, nil
+}
+
+// armorKey derives the armor key from the authenticator subkey and ticket session key, RFC 6113 section 5.4.1.1.
+func armorKey(subKey, sessionKey types.EncryptionKey) (types.EncryptionKey, error) {
+	key, err := crypto.KrbFxCf2(subKey, sessionKey, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncryptingError, "error deriving FAST armor key")
+	}
+	return key, nil
+}
+
+// SubKey returns the subkey set in the authenticator of a TGS_REQ armored with NewTGSArmor.
+func (a *Armor) SubKey() types.EncryptionKey {
+	return a.subKey
+}
+
+// Request returns the request with its pre-authentication data and body encrypted in PA-FX-FAST. The request
+// provided is not changed so that its pre-authentication data can be updated for a following attempt. Any
+// PA-FX-COOKIE the KDC returned in an error is included.
+func (a *Armor) Request(req messages.KDCReqFields) (messages.KDCReqFields, error) {
+	var tgsPA *types.PAData
+	inner := types.PADataSequence{}
+	for i, pa := range req.PAData {
+		switch pa.PADataType {
+		case patype.PA_TGS_REQ:
+			// The PA-TGS-REQ carries the armor of a TGS_REQ so stays in the outer request
+			tgsPA = &req.PAData[i]
+		case patype.PA_FX_FAST, patype.PA_FX_COOKIE:
+		default:
+			inner = append(inner, pa)
+		}
+	}
+	if len(a.cookie) > 0 {
+		inner = append(inner, types.PAData{PADataType: patype.PA_FX_COOKIE, PADataValue: a.cookie})
+	}
+	fr := KrbFastReq{
+		FastOptions: types.NewKrbFlags(),
+		PAData:      inner,
+		ReqBody:     req.ReqBody,
+	}
+	frb, err := fr.Marshal()
+	if err != nil {
+		return req, err
+	}
+	ed, err := crypto.GetEncryptedData(frb, a.key, keyusage.KEY_USAGE_FAST_ENC, 0)
+	if err != nil {
+		return req, krberror.Errorf(err, krberror.EncryptingError, "error encrypting KrbFastReq")
+	}
+	// The checksum of a TGS_REQ is over the AP_REQ of its PA-TGS-REQ, otherwise it is over the request body.
+	var cb []byte
+	if req.MsgType == msgtype.KRB_TGS_REQ {
+		if tgsPA == nil {
+			return req, krberror.NewErrorf(krberror.KRBMsgError, "TGS_REQ to armor does not contain PA-TGS-REQ")
+		}
+		cb = tgsPA.PADataValue
+	} else {
+		cb, err = req.ReqBody.Marshal()
+		if err != nil {
+			return req, err
+		}
+	}
+	et, err := crypto.GetEtype(a.key.KeyType)
+	if err != nil {
+		return req, krberror.Errorf(err, krberror.ChksumError, "error getting etype of armor key")
+	}
+	chksum, err := et.GetChecksumHash(a.key.KeyValue, cb, keyusage.KEY_USAGE_FAST_REQ_CHKSUM)
+	if err != nil {
+		return req, krberror.Errorf(err, krberror.ChksumError, "error calculating FAST request checksum")
+	}
+	b, err := marshalArmoredData(KrbFastArmoredReq{
+		Armor:       a.armor,
+		ReqChecksum: types.Checksum{CksumType: et.GetHashID(), Checksum: chksum},
+		EncFastReq:  ed,
+	})
+	if err != nil {
+		return req, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-FX-FAST-REQUEST")
+	}
+	var outer types.PADataSequence
+	if tgsPA != nil {
+		outer = append(outer, *tgsPA)
+	}
+	outer = append(outer, types.PAData{PADataType: patype.PA_FX_FAST, PADataValue: b})
+	a.nonce = req.ReqBody.Nonce
+	req.PAData = outer
+	return req, nil
+}
+
+// response decrypts the KrbFastResponse from the PA-FX-FAST-REPLY provided.
+func (a *Armor) response(b []byte) (KrbFastResponse, error) {
+	var resp KrbFastResponse
+	var rep KrbFastArmoredRep
+	err := unmarshalArmoredData(b, &rep)
+	if err != nil {
+		return resp, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FX-FAST-REPLY")
+	}
+	db, err := crypto.DecryptEncPart(rep.EncFastRep, a.key, keyusage.KEY_USAGE_FAST_REP)
+	if err != nil {
+		return resp, krberror.Errorf(err, krberror.DecryptingError, "error decrypting KrbFastResponse")
+	}
+	_, err = asn1.Unmarshal(db, &resp)
+	if err != nil {
+		return resp, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastResponse")
+	}
+	if resp.Nonce != a.nonce {
+		return resp, krberror.WithKind(errors.New("nonce in KDC FAST response does not match that in the request"), krberror.KindProtocol)
+	}
+	return resp, nil
+}
+
+// Reply verifies the KDC's KrbFastResponse in the reply's PA data. The reply's PA data is replaced with that of the
+// response and its client name and realm with those the KDC has authenticated.
+func (a *Armor) Reply(rep *messages.KDCRepFields) error {
+	var b []byte
+	for _, pa := range rep.PAData {
+		if pa.PADataType == patype.PA_FX_FAST {
+			b = pa.PADataValue
+			break
+		}
+	}
+	if b == nil {
+		return krberror.WithKind(errors.New("KDC reply to FAST armored request does not contain PA-FX-FAST"), krberror.KindProtocol)
+	}
+	resp, err := a.response(b)
+	if err != nil {
+		return err
+	}
+	fin := resp.Finished
+	if len(fin.TicketChecksum.Checksum) < 1 {
+		return krberror.WithKind(errors.New("KDC FAST response does not contain KrbFastFinished"), krberror.KindProtocol)
+	}
+	tb, err := rep.Ticket.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling ticket in KDC reply")
+	}
+	et, err := crypto.GetChksumEtype(fin.TicketChecksum.CksumType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "error getting etype of FAST ticket checksum")
+	}
+	if !et.VerifyChecksum(a.key.KeyValue, tb, fin.TicketChecksum.Checksum, keyusage.KEY_USAGE_FAST_FINISHED) {
+		return krberror.WithKind(krberror.NewErrorf(krberror.ChksumError, "FAST ticket checksum invalid"), krberror.KindProtocol)
+	}
+	rep.PAData = resp.PAData
+	rep.CRealm = fin.CRealm
+	rep.CName = fin.CName
+	a.strengthenKey = resp.StrengthenKey
+	return nil
+}
+
+// ReplyKey returns the key the encrypted part of the reply is encrypted with from the key it would be encrypted with
+// without FAST. This is strengthened if the KDC's response contained a strengthen key.
+func (a *Armor) ReplyKey(key types.EncryptionKey) (types.EncryptionKey, error) {
+	if len(a.strengthenKey.KeyValue) < 1 {
+		return key, nil
+	}
+	k, err := crypto.KrbFxCf2(a.strengthenKey, key, "strengthenkey", "replykey")
+	if err != nil {
+		return k, krberror.Errorf(err, krberror.EncryptingError, "error deriving strengthened reply key")
+	}
+	return k, nil
+}
+
+// Error returns the KRB_ERROR within the KDC's FAST response in the e-data of the KRB_ERROR with its e-data set to the
+// PA data of the response, such as the ETYPE-INFO2 for pre-authentication. A KRB_ERROR without a FAST response is
+// returned unchanged. Any PA-FX-COOKIE in the response is returned to the KDC in the following request.
+func (a *Armor) Error(e messages.KRBError) (messages.KRBError, error) {
+	var pas types.PADataSequence
+	if pas.Unmarshal(e.EData) != nil || !pas.Contains(patype.PA_FX_FAST) {
+		return e, nil
+	}
+	var b []byte
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_FX_FAST {
+			b = pa.PADataValue
+			break
+		}
+	}
+	resp, err := a.response(b)
+	if err != nil {
+		return e, err
+	}
+	var inner messages.KRBError
+	var found bool
+	epas := types.PADataSequence{}
+	for _, pa := range resp.PAData {
+		switch pa.PADataType {
+		case patype.PA_FX_ERROR:
+			err = inner.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return e, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FX-ERROR")
+			}
+			found = true
+		case patype.PA_FX_COOKIE:
+			a.cookie = pa.PADataValue
+			epas = append(epas, pa)
+		default:
+			epas = append(epas, pa)
+		}
+	}
+	if !found {
+		return e, krberror.WithKind(errors.New("KDC FAST error response does not contain PA-FX-ERROR"), krberror.KindProtocol)
+	}
+	inner.EData, err = asn1.Marshal(epas)
+	if err != nil {
+		return e, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA data of KDC FAST error response")
+	}
+	return inner, nil
+}
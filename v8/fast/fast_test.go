@@ -0,0 +1,256 @@
+package fast
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCName = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+
+func testTicket(t *testing.T) (messages.Ticket, types.EncryptionKey) {
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(testCName, "TEST.GOKRB5", sname, "TEST.GOKRB5", types.NewKrbFlags(), kt,
+		etypeID.AES256_CTS_HMAC_SHA1_96, 1, st, st, st.Add(time.Hour), st.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error getting test ticket: %v", err)
+	}
+	return tkt, sessionKey
+}
+
+// testKDCArmorKey performs the KDC's processing of the armor AP_REQ returning the armor key.
+func testKDCArmorKey(t *testing.T, fr KrbFastArmoredReq, sessionKey types.EncryptionKey) types.EncryptionKey {
+	assert.Equal(t, ArmorAPRequest, fr.Armor.ArmorType, "armor type not as expected")
+	var apReq messages.APReq
+	err := apReq.Unmarshal(fr.Armor.ArmorValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling armor AP_REQ: %v", err)
+	}
+	ab, err := crypto.DecryptEncPart(apReq.EncryptedAuthenticator, sessionKey, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		t.Fatalf("error decrypting armor authenticator: %v", err)
+	}
+	var auth types.Authenticator
+	err = auth.Unmarshal(ab)
+	if err != nil {
+		t.Fatalf("error unmarshaling armor authenticator: %v", err)
+	}
+	key, err := armorKey(auth.SubKey, sessionKey)
+	if err != nil {
+		t.Fatalf("error deriving armor key: %v", err)
+	}
+	return key
+}
+
+// testKDCRequest verifies and decrypts the armored request.
+func testKDCRequest(t *testing.T, pa types.PAData, key types.EncryptionKey, cb []byte) (KrbFastArmoredReq, KrbFastReq) {
+	assert.Equal(t, patype.PA_FX_FAST, pa.PADataType, "PA data type not as expected")
+	var fr KrbFastArmoredReq
+	err := unmarshalArmoredData(pa.PADataValue, &fr)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-FX-FAST-REQUEST: %v", err)
+	}
+	if len(key.KeyValue) < 1 {
+		return fr, KrbFastReq{}
+	}
+	et, _ := crypto.GetChksumEtype(fr.ReqChecksum.CksumType)
+	assert.True(t, et.VerifyChecksum(key.KeyValue, cb, fr.ReqChecksum.Checksum, keyusage.KEY_USAGE_FAST_REQ_CHKSUM), "request checksum not valid")
+	b, err := crypto.DecryptEncPart(fr.EncFastReq, key, keyusage.KEY_USAGE_FAST_ENC)
+	if err != nil {
+		t.Fatalf("error decrypting KrbFastReq: %v", err)
+	}
+	var req KrbFastReq
+	err = req.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling KrbFastReq: %v", err)
+	}
+	return fr, req
+}
+
+// testKDCResponse returns the PA-FX-FAST-REPLY for the response.
+func testKDCResponse(t *testing.T, resp KrbFastResponse, key types.EncryptionKey) types.PAData {
+	b, _ := asn1.Marshal(resp)
+	ed, err := crypto.GetEncryptedData(b, key, keyusage.KEY_USAGE_FAST_REP, 0)
+	if err != nil {
+		t.Fatalf("error encrypting KrbFastResponse: %v", err)
+	}
+	b, err = marshalArmoredData(KrbFastArmoredRep{EncFastRep: ed})
+	if err != nil {
+		t.Fatalf("error marshaling PA-FX-FAST-REPLY: %v", err)
+	}
+	return types.PAData{PADataType: patype.PA_FX_FAST, PADataValue: b}
+}
+
+func testFinished(t *testing.T, tkt messages.Ticket, key types.EncryptionKey) KrbFastFinished {
+	tb, _ := tkt.Marshal()
+	et, _ := crypto.GetEtype(key.KeyType)
+	cb, err := et.GetChecksumHash(key.KeyValue, tb, keyusage.KEY_USAGE_FAST_FINISHED)
+	if err != nil {
+		t.Fatalf("error calculating ticket checksum: %v", err)
+	}
+	return KrbFastFinished{
+		Timestamp:      time.Now().UTC().Truncate(time.Second),
+		CRealm:         "TEST.GOKRB5",
+		CName:          testCName,
+		TicketChecksum: types.Checksum{CksumType: et.GetHashID(), Checksum: cb},
+	}
+}
+
+func TestArmor_AS(t *testing.T) {
+	t.Parallel()
+	tgt, sessionKey := testTicket(t)
+	a, err := NewASArmor(tgt, sessionKey, "TEST.GOKRB5", testCName)
+	if err != nil {
+		t.Fatalf("error creating armor: %v", err)
+	}
+	asReq, err := messages.NewASReqForTGT("TEST.GOKRB5", config.New(), testCName)
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	asReq.PAData = types.PADataSequence{{PADataType: patype.PA_ENC_TIMESTAMP, PADataValue: []byte("timestamp")}}
+	req, err := a.Request(asReq.KDCReqFields)
+	if err != nil {
+		t.Fatalf("error armoring AS_REQ: %v", err)
+	}
+	assert.Equal(t, 1, len(req.PAData), "outer PA data should only be PA-FX-FAST")
+	assert.Equal(t, patype.PA_ENC_TIMESTAMP, asReq.PAData[0].PADataType, "request provided should not be changed")
+
+	// KDC side
+	fr, _ := testKDCRequest(t, req.PAData[0], types.EncryptionKey{}, nil)
+	key := testKDCArmorKey(t, fr, sessionKey)
+	body, _ := asReq.ReqBody.Marshal()
+	_, freq := testKDCRequest(t, req.PAData[0], key, body)
+	assert.Equal(t, asReq.PAData, freq.PAData, "inner PA data not as expected")
+	assert.Equal(t, asReq.ReqBody.Nonce, freq.ReqBody.Nonce, "inner request body not as expected")
+
+	// The KDC's error with the PA data for pre-authentication
+	cookie := []byte("cookie")
+	ke := messages.NewKRBError(asReq.ReqBody.SName, "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_REQUIRED, "")
+	keb, _ := ke.Marshal()
+	pa := testKDCResponse(t, KrbFastResponse{
+		PAData: types.PADataSequence{
+			{PADataType: patype.PA_FX_ERROR, PADataValue: keb},
+			{PADataType: patype.PA_FX_COOKIE, PADataValue: cookie},
+			{PADataType: patype.PA_ENCRYPTED_CHALLENGE},
+		},
+		Nonce: asReq.ReqBody.Nonce,
+	}, key)
+	outer := messages.NewKRBError(asReq.ReqBody.SName, "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_FAILED, "")
+	outer.EData, _ = asn1.Marshal(types.PADataSequence{pa})
+	e, err := a.Error(outer)
+	if err != nil {
+		t.Fatalf("error processing KDC error: %v", err)
+	}
+	assert.Equal(t, errorcode.KDC_ERR_PREAUTH_REQUIRED, e.ErrorCode, "inner error not returned")
+	var epas types.PADataSequence
+	epas.Unmarshal(e.EData)
+	assert.True(t, epas.Contains(patype.PA_ENCRYPTED_CHALLENGE), "e-data should contain the response's PA data")
+	assert.False(t, epas.Contains(patype.PA_FX_ERROR), "e-data should not contain PA-FX-ERROR")
+
+	// The cookie is returned in the following request
+	req, err = a.Request(asReq.KDCReqFields)
+	if err != nil {
+		t.Fatalf("error armoring AS_REQ: %v", err)
+	}
+	_, freq = testKDCRequest(t, req.PAData[0], key, body)
+	assert.True(t, freq.PAData.Contains(patype.PA_FX_COOKIE), "cookie not returned to the KDC")
+
+	// The KDC's reply with a strengthen key
+	strengthen, _ := types.GenerateEncryptionKey(crypto.Aes256CtsHmacSha96{})
+	replyKey, _ := crypto.GetKeyFromPasswordAndSalt("passwordvalue", "TEST.GOKRB5testuser1", etypeID.AES256_CTS_HMAC_SHA1_96)
+	rep := messages.KDCRepFields{
+		CRealm: "TEST.GOKRB5",
+		CName:  types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "alias"),
+		Ticket: tgt,
+		PAData: []types.PAData{testKDCResponse(t, KrbFastResponse{
+			PAData:        types.PADataSequence{{PADataType: patype.PA_ETYPE_INFO2}},
+			StrengthenKey: strengthen,
+			Finished:      testFinished(t, tgt, key),
+			Nonce:         asReq.ReqBody.Nonce,
+		}, key)},
+	}
+	err = a.Reply(&rep)
+	if err != nil {
+		t.Fatalf("error processing KDC reply: %v", err)
+	}
+	assert.Equal(t, patype.PA_ETYPE_INFO2, rep.PAData[0].PADataType, "reply PA data not replaced with the response's")
+	assert.True(t, rep.CName.Equal(testCName), "client name not replaced with the authenticated name")
+	k, err := a.ReplyKey(replyKey)
+	if err != nil {
+		t.Fatalf("error getting reply key: %v", err)
+	}
+	want, _ := crypto.KrbFxCf2(strengthen, replyKey, "strengthenkey", "replykey")
+	assert.Equal(t, want, k, "reply key not strengthened")
+
+	// A reply with a ticket other than that of the finished checksum is rejected
+	other, _ := testTicket(t)
+	rep.Ticket = other
+	rep.PAData = []types.PAData{testKDCResponse(t, KrbFastResponse{Finished: testFinished(t, tgt, key), Nonce: asReq.ReqBody.Nonce}, key)}
+	err = a.Reply(&rep)
+	assert.Equal(t, krberror.KindProtocol, krberror.ErrorKind(err), "reply with an invalid ticket checksum should be rejected: %v", err)
+
+	// A reply for another request is rejected
+	rep.Ticket = tgt
+	rep.PAData = []types.PAData{testKDCResponse(t, KrbFastResponse{Finished: testFinished(t, tgt, key), Nonce: asReq.ReqBody.Nonce + 1}, key)}
+	err = a.Reply(&rep)
+	assert.Equal(t, krberror.KindProtocol, krberror.ErrorKind(err), "reply for another nonce should be rejected: %v", err)
+
+	rep.PAData = nil
+	err = a.Reply(&rep)
+	assert.Equal(t, krberror.KindProtocol, krberror.ErrorKind(err), "reply without PA-FX-FAST should be rejected: %v", err)
+}
+
+func TestArmor_TGS(t *testing.T) {
+	t.Parallel()
+	tgt, sessionKey := testTicket(t)
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	tgsReq, err := messages.NewTGSReq(testCName, "TEST.GOKRB5", config.New(), tgt, sessionKey, sname, false)
+	if err != nil {
+		t.Fatalf("error creating TGS_REQ: %v", err)
+	}
+	a, err := NewTGSArmor(&tgsReq, tgt, sessionKey)
+	if err != nil {
+		t.Fatalf("error creating armor: %v", err)
+	}
+	var apReq messages.APReq
+	err = apReq.Unmarshal(tgsReq.PAData[0].PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-TGS-REQ: %v", err)
+	}
+	err = apReq.DecryptAuthenticator(sessionKey)
+	if err != nil {
+		t.Fatalf("error decrypting PA-TGS-REQ authenticator: %v", err)
+	}
+	assert.Equal(t, a.SubKey(), apReq.Authenticator.SubKey, "subkey not set in the authenticator")
+
+	req, err := a.Request(tgsReq.KDCReqFields)
+	if err != nil {
+		t.Fatalf("error armoring TGS_REQ: %v", err)
+	}
+	if assert.Equal(t, 2, len(req.PAData), "outer PA data not as expected") {
+		assert.Equal(t, patype.PA_TGS_REQ, req.PAData[0].PADataType, "PA-TGS-REQ should remain in the outer request")
+	}
+	key, _ := armorKey(a.SubKey(), sessionKey)
+	fr, freq := testKDCRequest(t, req.PAData[1], key, tgsReq.PAData[0].PADataValue)
+	assert.Equal(t, int32(0), fr.Armor.ArmorType, "TGS_REQ should not have explicit armor")
+	assert.Equal(t, 0, len(freq.PAData), "inner PA data should be empty")
+}
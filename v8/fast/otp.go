@@ -0,0 +1,174 @@
+package fast
+
+import (
+	"errors"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// OTP pre-authentication, RFC 6560, is a FAST factor so is only offered by KDCs for armored requests.
+
+// OTPFlags bits of OTP-TOKENINFO and PA-OTP-REQUEST, RFC 6560 section 4.1.
+const (
+	OTPFlagNextOTP             = 1
+	OTPFlagCombine             = 2
+	OTPFlagCollectPIN          = 3
+	OTPFlagDoNotCollectPIN     = 4
+	OTPFlagMustEncryptNonce    = 5
+	OTPFlagSeparatePINRequired = 6
+	OTPFlagCheckDigit          = 7
+)
+
+// OTPFormat values of the format of a one-time password, RFC 6560 section 4.1.
+const (
+	OTPFormatDecimal int32 = iota
+	OTPFormatHexadecimal
+	OTPFormatAlphanumeric
+	OTPFormatBinary
+	OTPFormatBase64
+)
+
+// OTPChallenge implements the PA-OTP-CHALLENGE the KDC returns in the PA data of its KDC_ERR_PREAUTH_REQUIRED error to
+// offer OTP pre-authentication with the tokens described, RFC 6560 section 4.1.
+type OTPChallenge struct {
+	Nonce     []byte         `asn1:"explicit,tag:0"`
+	Service   string         `asn1:"utf8,explicit,optional,tag:1"`
+	TokenInfo []OTPTokenInfo `asn1:"explicit,tag:2"`
+	Salt      string         `asn1:"generalstring,explicit,optional,tag:3"`
+	S2KParams []byte         `asn1:"explicit,optional,tag:4"`
+}
+
+// OTPTokenInfo implements OTP-TOKENINFO, the description of a token the one-time password may be from.
+type OTPTokenInfo struct {
+	Flags            asn1.BitString  `asn1:"explicit,tag:0"`
+	Vendor           string          `asn1:"utf8,explicit,optional,tag:1"`
+	Challenge        []byte          `asn1:"explicit,optional,tag:2"`
+	Length           int32           `asn1:"explicit,optional,tag:3"`
+	Format           int32           `asn1:"explicit,optional,tag:4"`
+	TokenID          []byte          `asn1:"explicit,optional,tag:5"`
+	AlgID            string          `asn1:"utf8,explicit,optional,tag:6"`
+	SupportedHashAlg []asn1.RawValue `asn1:"explicit,optional,tag:7"`
+	IterationCount   int32           `asn1:"explicit,optional,tag:8"`
+}
+
+// HasFlag indicates if the OTPFlags bit, one of the OTPFlag constants, is set for the token.
+func (t OTPTokenInfo) HasFlag(flag int) bool {
+	return len(t.Flags.Bytes) > flag/8 && types.IsFlagSet(&t.Flags, flag)
+}
+
+// OTPRequest implements the PA-OTP-REQUEST with which the client sends the one-time password of a token to the KDC,
+// RFC 6560 section 4.2. The hash algorithm, iteration count, time and counter of hashed or locally generated
+// one-time passwords are not used.
+type OTPRequest struct {
+	Flags     asn1.BitString      `asn1:"explicit,tag:0"`
+	Nonce     []byte              `asn1:"explicit,optional,tag:1"`
+	EncData   types.EncryptedData `asn1:"explicit,tag:2"`
+	Value     []byte              `asn1:"explicit,optional,tag:5"`
+	PIN       string              `asn1:"utf8,explicit,optional,tag:6"`
+	Challenge []byte              `asn1:"explicit,optional,tag:7"`
+	Format    int32               `asn1:"explicit,optional,tag:10"`
+	TokenID   []byte              `asn1:"explicit,optional,tag:11"`
+	AlgID     string              `asn1:"utf8,explicit,optional,tag:12"`
+	Vendor    string              `asn1:"utf8,explicit,optional,tag:13"`
+}
+
+// otpEncRequest implements PA-OTP-ENC-REQUEST, the nonce of the KDC's challenge encrypted in the PA-OTP-REQUEST.
+type otpEncRequest struct {
+	Nonce []byte `asn1:"explicit,tag:0"`
+}
+
+// Marshal the OTPChallenge.
+func (c *OTPChallenge) Marshal() ([]byte, error) {
+	return asn1.Marshal(*c)
+}
+
+// Unmarshal bytes b into the OTPChallenge.
+func (c *OTPChallenge) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, c)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-CHALLENGE")
+	}
+	if len(c.TokenInfo) < 1 {
+		return krberror.WithKind(errors.New("PA-OTP-CHALLENGE does not describe any tokens"), krberror.KindProtocol)
+	}
+	return nil
+}
+
+// Marshal the OTPRequest.
+func (r *OTPRequest) Marshal() ([]byte, error) {
+	return asn1.Marshal(*r)
+}
+
+// Unmarshal bytes b into the OTPRequest.
+func (r *OTPRequest) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, r)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-REQUEST")
+	}
+	return nil
+}
+
+// OTPChallengeFromPAData returns the KDC's PA-OTP-CHALLENGE from the PA data of its error and whether there is one.
+func OTPChallengeFromPAData(pas types.PADataSequence) (OTPChallenge, bool, error) {
+	var c OTPChallenge
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_OTP_CHALLENGE {
+			return c, true, c.Unmarshal(pa.PADataValue)
+		}
+	}
+	return c, false, nil
+}
+
+// OTPRequest returns the PA-OTP-REQUEST pre-authentication data with the one-time password, and the PIN if it is
+// collected separately, of the token of the KDC's challenge. The challenge's nonce is encrypted with the armor key,
+// as MIT Kerberos does, and is also sent in the clear unless the token requires it to be encrypted.
+func (a *Armor) OTPRequest(c OTPChallenge, token OTPTokenInfo, value []byte, pin string) (types.PAData, error) {
+	b, err := asn1.Marshal(otpEncRequest{Nonce: c.Nonce})
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-ENC-REQUEST")
+	}
+	ed, err := crypto.GetEncryptedData(b, a.key, keyusage.KEY_USAGE_PA_OTP_REQUEST, 0)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error encrypting PA-OTP-ENC-REQUEST")
+	}
+	r := OTPRequest{
+		Flags:     types.NewKrbFlags(),
+		EncData:   ed,
+		Value:     value,
+		PIN:       pin,
+		Challenge: token.Challenge,
+		Format:    token.Format,
+		TokenID:   token.TokenID,
+		AlgID:     token.AlgID,
+		Vendor:    token.Vendor,
+	}
+	if !token.HasFlag(OTPFlagMustEncryptNonce) {
+		r.Nonce = c.Nonce
+	}
+	if token.HasFlag(OTPFlagNextOTP) {
+		types.SetFlag(&r.Flags, OTPFlagNextOTP)
+	}
+	rb, err := r.Marshal()
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-REQUEST")
+	}
+	a.otp = true
+	return types.PAData{
+		PADataType:  patype.PA_OTP_REQUEST,
+		PADataValue: rb,
+	}, nil
+}
+
+// OTPReplyKey returns the key the KDC's reply to a request pre-authenticated with OTPRequest is encrypted with. As
+// RFC 6560 has the KDC replace the reply key with the armor key, the armor key is returned.
+func (a *Armor) OTPReplyKey() (types.EncryptionKey, error) {
+	if !a.otp {
+		return types.EncryptionKey{}, errors.New("request was not pre-authenticated with a one-time password")
+	}
+	return a.key, nil
+}
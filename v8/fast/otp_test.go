@@ -0,0 +1,108 @@
+package fast
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testOTPChallenge returns the KDC's PA-OTP-CHALLENGE for a token with the flags provided.
+func testOTPChallenge(t *testing.T, flags ...int) types.PAData {
+	token := OTPTokenInfo{Flags: types.NewKrbFlags(), Vendor: "FreeIPA", Length: 6, TokenID: []byte("token1")}
+	for _, f := range flags {
+		types.SetFlag(&token.Flags, f)
+	}
+	c := OTPChallenge{Nonce: []byte("kdcnonce"), Service: "FreeIPA Authentication", TokenInfo: []OTPTokenInfo{token}}
+	b, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling OTP challenge: %v", err)
+	}
+	return types.PAData{PADataType: patype.PA_OTP_CHALLENGE, PADataValue: b}
+}
+
+func TestOTPChallengeFromPAData(t *testing.T) {
+	t.Parallel()
+	_, ok, err := OTPChallengeFromPAData(types.PADataSequence{{PADataType: patype.PA_ENCRYPTED_CHALLENGE}})
+	assert.NoError(t, err)
+	assert.False(t, ok, "there should be no OTP challenge")
+
+	c, ok, err := OTPChallengeFromPAData(types.PADataSequence{testOTPChallenge(t, OTPFlagCollectPIN)})
+	if err != nil {
+		t.Fatalf("error getting OTP challenge: %v", err)
+	}
+	assert.True(t, ok, "there should be an OTP challenge")
+	assert.Equal(t, []byte("kdcnonce"), c.Nonce, "nonce not as expected")
+	assert.Equal(t, "FreeIPA Authentication", c.Service, "service not as expected")
+	if assert.Len(t, c.TokenInfo, 1, "tokens not as expected") {
+		assert.Equal(t, []byte("token1"), c.TokenInfo[0].TokenID, "token ID not as expected")
+		assert.Equal(t, int32(6), c.TokenInfo[0].Length, "token length not as expected")
+		assert.True(t, c.TokenInfo[0].HasFlag(OTPFlagCollectPIN), "collect PIN flag should be set")
+		assert.False(t, c.TokenInfo[0].HasFlag(OTPFlagNextOTP), "next OTP flag should not be set")
+	}
+
+	b, _ := asn1.Marshal(OTPChallenge{Nonce: []byte("kdcnonce")})
+	_, _, err = OTPChallengeFromPAData(types.PADataSequence{{PADataType: patype.PA_OTP_CHALLENGE, PADataValue: b}})
+	assert.Error(t, err, "a challenge without tokens should be rejected")
+}
+
+func TestArmor_OTPRequest(t *testing.T) {
+	t.Parallel()
+	tgt, sessionKey := testTicket(t)
+	a, err := NewASArmor(tgt, sessionKey, "TEST.GOKRB5", testCName)
+	if err != nil {
+		t.Fatalf("error creating armor: %v", err)
+	}
+	_, err = a.OTPReplyKey()
+	assert.Error(t, err, "reply key should not be returned before an OTP request")
+
+	for _, encrypt := range []bool{false, true} {
+		var flags []int
+		if encrypt {
+			flags = append(flags, OTPFlagMustEncryptNonce)
+		}
+		c, _, err := OTPChallengeFromPAData(types.PADataSequence{testOTPChallenge(t, flags...)})
+		if err != nil {
+			t.Fatalf("error getting OTP challenge: %v", err)
+		}
+		pa, err := a.OTPRequest(c, c.TokenInfo[0], []byte("123456"), "")
+		if err != nil {
+			t.Fatalf("error creating OTP request: %v", err)
+		}
+		assert.Equal(t, patype.PA_OTP_REQUEST, pa.PADataType, "PA data type not as expected")
+
+		// KDC processing of the client's request
+		var r OTPRequest
+		err = r.Unmarshal(pa.PADataValue)
+		if err != nil {
+			t.Fatalf("error unmarshaling OTP request: %v", err)
+		}
+		assert.Equal(t, []byte("123456"), r.Value, "one-time password not as expected")
+		assert.Equal(t, []byte("token1"), r.TokenID, "token ID not as expected")
+		if encrypt {
+			assert.Empty(t, r.Nonce, "nonce should not be sent in the clear")
+		} else {
+			assert.Equal(t, c.Nonce, r.Nonce, "nonce not as expected")
+		}
+		b, err := crypto.DecryptEncPart(r.EncData, a.key, keyusage.KEY_USAGE_PA_OTP_REQUEST)
+		if err != nil {
+			t.Fatalf("error decrypting PA-OTP-ENC-REQUEST: %v", err)
+		}
+		var er otpEncRequest
+		_, err = asn1.Unmarshal(b, &er)
+		if err != nil {
+			t.Fatalf("error unmarshaling PA-OTP-ENC-REQUEST: %v", err)
+		}
+		assert.Equal(t, c.Nonce, er.Nonce, "encrypted nonce not as expected")
+	}
+
+	rk, err := a.OTPReplyKey()
+	if err != nil {
+		t.Fatalf("error getting OTP reply key: %v", err)
+	}
+	assert.Equal(t, a.key, rk, "reply key should be the armor key")
+}
@@ -6,10 +6,10 @@ require (
 	github.com/gorilla/sessions v1.2.1
 	github.com/hashicorp/go-uuid v1.0.2
 	github.com/jcmturner/aescts/v2 v2.0.0
-	github.com/jcmturner/dnsutils/v2 v2.0.0
 	github.com/jcmturner/gofork v1.0.0
 	github.com/jcmturner/goidentity/v6 v6.0.1
 	github.com/jcmturner/rpc/v2 v2.0.3
 	github.com/stretchr/testify v1.6.1
 	golang.org/x/crypto v0.0.0-20201112155050-0c6587e931a9
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
 )
@@ -0,0 +1,52 @@
+package grpcgss
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/test/krbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+	k, err := krbtest.NewKDC("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	defer k.Close()
+	if err := k.AddPrincipal("HTTP/grpc.test.gokrb5", "servicepassword"); err != nil {
+		t.Fatalf("error adding service principal: %v", err)
+	}
+	kt, err := k.Keytab("HTTP/grpc.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	cl, err := k.NewClient("testuser1")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	creds := NewPerRPCCredentials(cl, "", true)
+	assert.True(t, creds.RequireTransportSecurity(), "transport security should be required")
+	m, err := creds.GetRequestMetadata(context.Background(), "https://grpc.test.gokrb5:8443/pkg.Service")
+	if err != nil {
+		t.Fatalf("error getting request metadata: %v", err)
+	}
+	md := map[string][]string{MetadataKey: {m[MetadataKey]}}
+	a := NewAuthenticator(kt, service.DecodePAC(false))
+	ctx, err := a.Authenticate(context.Background(), md)
+	if err != nil {
+		t.Fatalf("error authenticating call: %v", err)
+	}
+	if assert.NotNil(t, Credentials(ctx), "credentials should be in the context") {
+		assert.Equal(t, "testuser1", Credentials(ctx).UserName(), "authenticated user not as expected")
+	}
+
+	_, err = a.Authenticate(context.Background(), md)
+	assert.Error(t, err, "replayed token should be rejected")
+	ctx, err = a.Authenticate(context.Background(), map[string][]string{})
+	assert.Error(t, err, "call without authorization should be rejected")
+	assert.Nil(t, Credentials(ctx), "unauthenticated call should not have credentials")
+}
@@ -0,0 +1,74 @@
+package gssapi
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+
+	// Register the hashes used for the tls-server-end-point channel binding.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// TLSServerEndPointPrefix is the prefix of the tls-server-end-point channel binding's application data, RFC 5929
+// section 4.
+const TLSServerEndPointPrefix = "tls-server-end-point:"
+
+// ChannelBindings binds a security context to the channel it is established over, RFC 2744 section 3.11.
+// Protocols carried over TLS bind to the TLS channel with only the application data set.
+type ChannelBindings struct {
+	InitiatorAddrType int32
+	InitiatorAddress  []byte
+	AcceptorAddrType  int32
+	AcceptorAddress   []byte
+	ApplicationData   []byte
+}
+
+// TLSServerEndPoint returns the tls-server-end-point channel bindings, RFC 5929 section 4, of the TLS server's
+// certificate. The certificate is hashed with the hash of its signature algorithm, except that SHA-256 is used
+// instead of MD5 and SHA-1.
+func TLSServerEndPoint(cert *x509.Certificate) (*ChannelBindings, error) {
+	if cert == nil || len(cert.Raw) < 1 {
+		return nil, errors.New("no TLS server certificate to bind to")
+	}
+	h := crypto.SHA256
+	switch cert.SignatureAlgorithm {
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		h = crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		h = crypto.SHA512
+	}
+	d := h.New()
+	d.Write(cert.Raw)
+	return &ChannelBindings{
+		ApplicationData: append([]byte(TLSServerEndPointPrefix), d.Sum(nil)...),
+	}, nil
+}
+
+// Hash returns the MD5 hash of the channel bindings carried in the Bnd field of the authenticator checksum, RFC 4121
+// section 4.1.1.2. Nil channel bindings hash to zero bytes, which indicate that no channel bindings are used.
+func (c *ChannelBindings) Hash() []byte {
+	if c == nil {
+		return make([]byte, md5.Size)
+	}
+	var b []byte
+	b = appendUint32(b, uint32(c.InitiatorAddrType))
+	b = appendUint32(b, uint32(len(c.InitiatorAddress)))
+	b = append(b, c.InitiatorAddress...)
+	b = appendUint32(b, uint32(c.AcceptorAddrType))
+	b = appendUint32(b, uint32(len(c.AcceptorAddress)))
+	b = append(b, c.AcceptorAddress...)
+	b = appendUint32(b, uint32(len(c.ApplicationData)))
+	b = append(b, c.ApplicationData...)
+	h := md5.Sum(b)
+	return h[:]
+}
+
+// appendUint32 appends the little endian encoding of the integer.
+func appendUint32(b []byte, i uint32) []byte {
+	var x [4]byte
+	binary.LittleEndian.PutUint32(x[:], i)
+	return append(b, x[:]...)
+}
@@ -0,0 +1,67 @@
+package gssapi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelBindings_Hash(t *testing.T) {
+	t.Parallel()
+	var cb *ChannelBindings
+	assert.Equal(t, make([]byte, 16), cb.Hash(), "nil channel bindings should hash to zero bytes")
+
+	cb = &ChannelBindings{
+		InitiatorAddrType: 2,
+		InitiatorAddress:  []byte{10, 0, 0, 1},
+		ApplicationData:   []byte("data"),
+	}
+	// The little endian encoding of the channel bindings is hashed.
+	b, _ := hex.DecodeString("02000000" + "04000000" + "0a000001" + "00000000" + "00000000" + "04000000" + hex.EncodeToString([]byte("data")))
+	h := md5.Sum(b)
+	assert.Equal(t, h[:], cb.Hash(), "channel bindings hash not as expected")
+}
+
+func TestTLSServerEndPoint(t *testing.T) {
+	t.Parallel()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:       big.NewInt(1),
+		Subject:            pkix.Name{CommonName: "host.test.gokrb5"},
+		NotBefore:          time.Now(),
+		NotAfter:           time.Now().Add(time.Hour),
+		SignatureAlgorithm: x509.ECDSAWithSHA256,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &k.PublicKey, k)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	cb, err := TLSServerEndPoint(cert)
+	if err != nil {
+		t.Fatalf("error getting channel bindings: %v", err)
+	}
+	h := sha256.Sum256(der)
+	assert.Equal(t, append([]byte(TLSServerEndPointPrefix), h[:]...), cb.ApplicationData, "application data not as expected")
+	assert.Nil(t, cb.InitiatorAddress, "initiator address should not be set")
+	assert.Nil(t, cb.AcceptorAddress, "acceptor address should not be set")
+
+	_, err = TLSServerEndPoint(nil)
+	assert.Error(t, err, "nil certificate should be an error")
+}
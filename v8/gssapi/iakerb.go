@@ -0,0 +1,206 @@
+package gssapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// IAKERB, draft-ietf-kitten-iakerb, as implemented by MIT Kerberos.
+
+const (
+	// IAKERBChecksumExtension is the type of the authenticator checksum extension holding the IAKERB-FINISHED message
+	// of a security context established with IAKERB exchanges.
+	IAKERBChecksumExtension = 1
+)
+
+// iakerbTokenID is the TOK_ID of the IAKERB tokens carrying the messages exchanged with the KDC.
+var iakerbTokenID = []byte{0x05, 0x01}
+
+// IAKERBHeader implements the IAKERB-HEADER preceding the KDC message of an IAKERB token. As MIT Kerberos encodes it
+// the target realm is an OCTET STRING.
+type IAKERBHeader struct {
+	TargetRealm string
+	Cookie      []byte
+}
+
+type marshalIAKERBHeader struct {
+	TargetRealm []byte `asn1:"explicit,tag:1"`
+	Cookie      []byte `asn1:"optional,explicit,tag:2"`
+}
+
+// Marshal the IAKERBHeader.
+func (h *IAKERBHeader) Marshal() ([]byte, error) {
+	return asn1.Marshal(marshalIAKERBHeader{
+		TargetRealm: []byte(h.TargetRealm),
+		Cookie:      h.Cookie,
+	})
+}
+
+// Unmarshal bytes into the IAKERBHeader, returning the bytes that follow it.
+func (h *IAKERBHeader) Unmarshal(b []byte) ([]byte, error) {
+	var m marshalIAKERBHeader
+	r, err := asn1.Unmarshal(b, &m)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling IAKERB header: %w", err)
+	}
+	h.TargetRealm = string(m.TargetRealm)
+	h.Cookie = m.Cookie
+	return r, nil
+}
+
+// IAKERBToken is the context token carrying a KDC message between the initiator and the acceptor, which exchanges
+// it with a KDC of the target realm on the initiator's behalf.
+type IAKERBToken struct {
+	// Initial indicates the token is the initiator's first, which alone is framed with the IAKERB mechanism OID,
+	// RFC 2743 section 3.1.
+	Initial bool
+	Header  IAKERBHeader
+	Message []byte
+}
+
+// Marshal the IAKERBToken.
+func (t *IAKERBToken) Marshal() ([]byte, error) {
+	h, err := t.Header.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	if t.Initial {
+		b, _ = asn1.Marshal(OIDGSSIAKerb.OID())
+	}
+	b = append(b, iakerbTokenID...)
+	b = append(b, h...)
+	b = append(b, t.Message...)
+	if t.Initial {
+		return asn1tools.AddASNAppTag(b, 0), nil
+	}
+	return b, nil
+}
+
+// Unmarshal bytes into the IAKERBToken.
+func (t *IAKERBToken) Unmarshal(b []byte) error {
+	r, initial, ok := iakerbTokenBody(b)
+	if !ok {
+		return errors.New("token is not an IAKERB token")
+	}
+	msg, err := t.Header.Unmarshal(r[len(iakerbTokenID):])
+	if err != nil {
+		return err
+	}
+	if len(msg) < 1 {
+		return errors.New("IAKERB token does not contain a KDC message")
+	}
+	t.Initial = initial
+	t.Message = msg
+	return nil
+}
+
+// IsIAKERBToken indicates if the context token is an IAKERB token carrying a KDC message, rather than a KRB5 token
+// framed with the IAKERB mechanism OID, such as the AP_REQ that follows the KDC exchanges.
+func IsIAKERBToken(b []byte) bool {
+	_, _, ok := iakerbTokenBody(b)
+	return ok
+}
+
+// iakerbTokenBody returns the IAKERB token without its framing, starting with its TOK_ID, and whether it is framed as
+// the initiator's first token.
+func iakerbTokenBody(b []byte) ([]byte, bool, bool) {
+	if bytes.HasPrefix(b, iakerbTokenID) {
+		return b, false, true
+	}
+	var oid asn1.ObjectIdentifier
+	r, err := asn1.UnmarshalWithParams(b, &oid, "application,explicit,tag:0")
+	if err != nil || !oid.Equal(OIDGSSIAKerb.OID()) || !bytes.HasPrefix(r, iakerbTokenID) {
+		return nil, false, false
+	}
+	return r, true, true
+}
+
+// IAKERBFinished implements the IAKERB-FINISHED message, the checksum of the IAKERB tokens exchanged before the
+// AP_REQ with the key of the authenticator's subkey, which binds them to the security context.
+type IAKERBFinished struct {
+	Checksum types.Checksum `asn1:"explicit,tag:1"`
+}
+
+// NewIAKERBFinished returns the IAKERB-FINISHED message for the IAKERB tokens exchanged, concatenated in the order
+// they were sent and received.
+func NewIAKERBFinished(key types.EncryptionKey, tokens []byte) (IAKERBFinished, error) {
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return IAKERBFinished{}, err
+	}
+	c, err := et.GetChecksumHash(key.KeyValue, tokens, keyusage.KEY_USAGE_IAKERB_FINISHED)
+	if err != nil {
+		return IAKERBFinished{}, fmt.Errorf("error computing IAKERB finished checksum: %w", err)
+	}
+	return IAKERBFinished{Checksum: types.Checksum{CksumType: et.GetHashID(), Checksum: c}}, nil
+}
+
+// Verify the IAKERB-FINISHED message's checksum of the IAKERB tokens exchanged.
+func (f *IAKERBFinished) Verify(key types.EncryptionKey, tokens []byte) error {
+	et, err := crypto.GetChksumEtype(f.Checksum.CksumType)
+	if err != nil {
+		return err
+	}
+	if et.GetETypeID() != key.KeyType || !et.VerifyChecksum(key.KeyValue, tokens, f.Checksum.Checksum, keyusage.KEY_USAGE_IAKERB_FINISHED) {
+		return errors.New("IAKERB finished checksum not valid")
+	}
+	return nil
+}
+
+// Marshal the IAKERBFinished.
+func (f *IAKERBFinished) Marshal() ([]byte, error) {
+	return asn1.Marshal(*f)
+}
+
+// Unmarshal bytes into the IAKERBFinished.
+func (f *IAKERBFinished) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, f)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling IAKERB finished: %w", err)
+	}
+	return nil
+}
+
+// AppendChecksumExtension appends the extension to the authenticator checksum, RFC 4121 section 4.1.1, after the
+// delegated credentials if there are any.
+func AppendChecksumExtension(cksum []byte, typ uint32, data []byte) []byte {
+	e := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(e[:4], typ)
+	binary.BigEndian.PutUint32(e[4:], uint32(len(data)))
+	return append(cksum, append(e, data...)...)
+}
+
+// ChecksumExtension returns the data of the extension of the type in the authenticator checksum, RFC 4121 section
+// 4.1.1, and whether the checksum has it.
+func ChecksumExtension(cksum []byte, typ uint32) ([]byte, bool) {
+	if len(cksum) < 24 {
+		return nil, false
+	}
+	b := cksum[24:]
+	if binary.LittleEndian.Uint32(cksum[20:24])&ContextFlagDeleg != 0 {
+		if len(b) < 4 || len(b) < 4+int(binary.LittleEndian.Uint16(b[2:4])) {
+			return nil, false
+		}
+		b = b[4+int(binary.LittleEndian.Uint16(b[2:4])):]
+	}
+	for len(b) >= 8 {
+		n := binary.BigEndian.Uint32(b[4:8])
+		if uint64(n) > uint64(len(b)-8) {
+			return nil, false
+		}
+		if binary.BigEndian.Uint32(b[:4]) == typ {
+			return b[8 : 8+n], true
+		}
+		b = b[8+n:]
+	}
+	return nil, false
+}
@@ -0,0 +1,120 @@
+package gssapi
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIAKERBHeader_Unmarshal(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.MarshaledKRB5iakerb_header)
+	var h IAKERBHeader
+	r, err := h.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshalling IAKERB header: %v", err)
+	}
+	assert.Empty(t, r, "no bytes should follow the header")
+	assert.Equal(t, "krb5data", h.TargetRealm, "target realm not as expected")
+	assert.Equal(t, []byte("krb5data"), h.Cookie, "cookie not as expected")
+	m, err := h.Marshal()
+	if err != nil {
+		t.Fatalf("error marshalling IAKERB header: %v", err)
+	}
+	assert.Equal(t, b, m, "marshalled IAKERB header not as expected")
+}
+
+func TestIAKERBFinished_Unmarshal(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.MarshaledKRB5iakerb_finished)
+	var f IAKERBFinished
+	if err := f.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshalling IAKERB finished: %v", err)
+	}
+	assert.Equal(t, int32(chksumtype.CRC32), f.Checksum.CksumType, "checksum type not as expected")
+	assert.Equal(t, []byte("1234"), f.Checksum.Checksum, "checksum not as expected")
+	m, err := f.Marshal()
+	if err != nil {
+		t.Fatalf("error marshalling IAKERB finished: %v", err)
+	}
+	assert.Equal(t, b, m, "marshalled IAKERB finished not as expected")
+}
+
+func TestIAKERBToken(t *testing.T) {
+	t.Parallel()
+	for _, initial := range []bool{true, false} {
+		tok := IAKERBToken{Initial: initial, Header: IAKERBHeader{TargetRealm: "TEST.GOKRB5"}, Message: []byte{0x6a, 0x01, 0x00}}
+		b, err := tok.Marshal()
+		if err != nil {
+			t.Fatalf("error marshalling IAKERB token: %v", err)
+		}
+		assert.Equal(t, initial, b[0] == 0x60, "only the initial token should be framed")
+		assert.True(t, IsIAKERBToken(b), "token should be an IAKERB token")
+		var u IAKERBToken
+		if err := u.Unmarshal(b); err != nil {
+			t.Fatalf("error unmarshalling IAKERB token: %v", err)
+		}
+		assert.Equal(t, tok, u, "unmarshalled IAKERB token not as expected")
+	}
+	// A reply to the token as sent by an MIT Kerberos acceptor
+	b, _ := hex.DecodeString("0501300fa10d040b544553542e474f4b524235" + "6b00")
+	var mit IAKERBToken
+	if assert.NoError(t, mit.Unmarshal(b), "error unmarshalling MIT IAKERB token") {
+		assert.Equal(t, "TEST.GOKRB5", mit.Header.TargetRealm, "target realm not as expected")
+		assert.Equal(t, []byte{0x6b, 0x00}, mit.Message, "message not as expected")
+	}
+	apReq, _ := hex.DecodeString("600a06062b06010502050100")
+	assert.False(t, IsIAKERBToken(apReq), "AP_REQ token framed with the IAKERB OID should not be an IAKERB token")
+}
+
+func TestIAKERBFinished_Verify(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	key, _ := types.GenerateEncryptionKey(et)
+	f, err := NewIAKERBFinished(key, []byte("tokens"))
+	if err != nil {
+		t.Fatalf("error creating IAKERB finished: %v", err)
+	}
+	assert.NoError(t, f.Verify(key, []byte("tokens")), "IAKERB finished should verify")
+	assert.Error(t, f.Verify(key, []byte("other tokens")), "IAKERB finished of other tokens should not verify")
+	other, _ := types.GenerateEncryptionKey(et)
+	assert.Error(t, f.Verify(other, []byte("tokens")), "IAKERB finished with another key should not verify")
+}
+
+func TestChecksumExtension(t *testing.T) {
+	t.Parallel()
+	cksum := make([]byte, 24)
+	cksum = AppendChecksumExtension(cksum, 3, []byte("three"))
+	cksum = AppendChecksumExtension(cksum, IAKERBChecksumExtension, []byte("finished"))
+	b, ok := ChecksumExtension(cksum, IAKERBChecksumExtension)
+	assert.True(t, ok, "extension should be found")
+	assert.Equal(t, []byte("finished"), b, "extension data not as expected")
+	_, ok = ChecksumExtension(cksum, 4)
+	assert.False(t, ok, "extension should not be found")
+
+	deleg := make([]byte, 24)
+	deleg[20] = byte(ContextFlagDeleg)
+	deleg = append(deleg, 1, 0, 3, 0, 'k', 'r', 'b')
+	deleg = AppendChecksumExtension(deleg, IAKERBChecksumExtension, []byte("finished"))
+	b, ok = ChecksumExtension(deleg, IAKERBChecksumExtension)
+	assert.True(t, ok, "extension after delegated credentials should be found")
+	assert.Equal(t, []byte("finished"), b, "extension data not as expected")
+	_, ok = ChecksumExtension(deleg[:len(deleg)-1], IAKERBChecksumExtension)
+	assert.False(t, ok, "truncated extension should not be found")
+
+	// The authenticator checksum of an MIT Kerberos IAKERB initiator
+	mit, _ := hex.DecodeString("10000000000000000000000000000000000000003e010000000000010000001b3019a1173015a003020110a10e040c288785670535f248ad2f3780")
+	b, ok = ChecksumExtension(mit, IAKERBChecksumExtension)
+	if assert.True(t, ok, "MIT IAKERB finished extension should be found") {
+		var f IAKERBFinished
+		if assert.NoError(t, f.Unmarshal(b), "error unmarshalling MIT IAKERB finished") {
+			assert.Equal(t, chksumtype.HMAC_SHA1_96_AES256, f.Checksum.CksumType, "checksum type not as expected")
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package gssapi
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// RFC 4402
+
+// PseudoRandom implements GSS_Pseudo_random for the Kerberos V5 mechanism, RFC 4402, returning n bytes derived from
+// the key and input with the PRF+ function over the pseudo-random function of the key's encryption type. The counter
+// of each iteration of PRF+ starts at zero, as implemented by MIT Kerberos and Heimdal.
+func PseudoRandom(key types.EncryptionKey, input []byte, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errors.New("pseudo-random output length cannot be negative")
+	}
+	out := make([]byte, 0, n)
+	b := make([]byte, 4+len(input))
+	copy(b[4:], input)
+	for i := uint32(0); len(out) < n; i++ {
+		binary.BigEndian.PutUint32(b[:4], i)
+		t, err := crypto.PseudoRandom(key, b)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t...)
+	}
+	return out[:n], nil
+}
+
+// PseudoRandom returns n bytes derived from the key of the security context and the input, RFC 4402
+// GSS_Pseudo_random with GSS_C_PRF_KEY_FULL, such as to derive the keys of an application protocol. The key is the
+// acceptor's subkey if it asserted one, otherwise the initiator's subkey or the ticket's session key.
+func (c *SecurityContext) PseudoRandom(input []byte, n int) ([]byte, error) {
+	return PseudoRandom(c.key, input, n)
+}
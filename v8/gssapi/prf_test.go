@@ -0,0 +1,42 @@
+package gssapi
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPseudoRandom(t *testing.T) {
+	t.Parallel()
+	for _, et := range []int32{etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA384_192} {
+		e, _ := crypto.GetEtype(et)
+		key := types.EncryptionKey{KeyType: et, KeyValue: make([]byte, e.GetKeyByteSize())}
+		copy(key.KeyValue, "0123456789abcdef0123456789abcdef")
+		b, err := PseudoRandom(key, []byte("input"), 100)
+		if err != nil {
+			t.Fatalf("error calculating pseudo-random output for etype %d: %v", et, err)
+		}
+		assert.Len(t, b, 100, "output length not as expected for etype %d", et)
+		// The output is that of the encryption type's pseudo-random function with a four byte counter from zero.
+		t0, _ := crypto.PseudoRandom(key, append([]byte{0, 0, 0, 0}, "input"...))
+		t1, _ := crypto.PseudoRandom(key, append([]byte{0, 0, 0, 1}, "input"...))
+		assert.Equal(t, append(t0, t1...)[:len(t0)+1], b[:len(t0)+1], "output not as expected for etype %d", et)
+		s, _ := PseudoRandom(key, []byte("input"), 10)
+		assert.Equal(t, b[:10], s, "shorter output should be a prefix for etype %d", et)
+		o, _ := PseudoRandom(key, []byte("other"), 10)
+		assert.NotEqual(t, s, o, "output for different input should differ for etype %d", et)
+	}
+	_, err := PseudoRandom(types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}, nil, -1)
+	assert.Error(t, err, "negative output length should be rejected")
+
+	initiator, acceptor := testSecurityContexts(true)
+	ib, err := initiator.PseudoRandom([]byte("channel key"), 32)
+	if err != nil {
+		t.Fatalf("error calculating pseudo-random output: %v", err)
+	}
+	ab, _ := acceptor.PseudoRandom([]byte("channel key"), 32)
+	assert.Equal(t, ib, ab, "initiator and acceptor should derive the same output")
+}
@@ -0,0 +1,268 @@
+package gssapi
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rc4"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4757"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/internal/random"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// RFC 4757, section 7
+
+const (
+	// rc4MICTokenLen is the length of a MIC token, without its framing: the header, SND_SEQ and SGN_CKSUM.
+	rc4MICTokenLen = 24
+	// rc4WrapHdrLen is the length of a Wrap token preceding its data, without its framing: the header, SND_SEQ,
+	// SGN_CKSUM and the confounder.
+	rc4WrapHdrLen = 32
+	// rc4SignUsage and rc4SealUsage are the Microsoft message types of the checksums of MIC and Wrap tokens.
+	rc4SignUsage = 15
+	rc4SealUsage = 13
+)
+
+var (
+	// rc4MICHeader is the header of MIC tokens: TOK_ID, SGN_ALG HMAC and the filler.
+	rc4MICHeader = []byte{0x01, 0x01, 0x11, 0x00, 0xff, 0xff, 0xff, 0xff}
+	// rc4MechOID is the DER encoded Kerberos V5 mechanism OID of the tokens' framing.
+	rc4MechOID = []byte{0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x12, 0x01, 0x02, 0x02}
+)
+
+// isRC4 indicates if the key is of the RC4-HMAC encryption type, which protects messages with the tokens of RFC 4757.
+func isRC4(key types.EncryptionKey) bool {
+	return key.KeyType == etypeID.RC4_HMAC
+}
+
+// rc4WrapHeader returns the header of a Wrap token: TOK_ID, SGN_ALG HMAC, SEAL_ALG RC4 if sealed or none, and the
+// filler.
+func rc4WrapHeader(sealed bool) []byte {
+	if sealed {
+		return []byte{0x02, 0x01, 0x11, 0x00, 0x10, 0x00, 0xff, 0xff}
+	}
+	return []byte{0x02, 0x01, 0x11, 0x00, 0xff, 0xff, 0xff, 0xff}
+}
+
+// rc4Key returns the RC4 key derived from the key and data, HMAC(HMAC(key, (int32)0), data).
+func rc4Key(key types.EncryptionKey, data []byte) []byte {
+	return rfc4757.HMAC(rfc4757.HMAC(key.KeyValue, make([]byte, 4)), data)
+}
+
+// rc4LocalKey returns the key that encrypts the data of sealed Wrap tokens, the key with each byte XORed with 0xF0.
+func rc4LocalKey(key types.EncryptionKey) types.EncryptionKey {
+	k := types.EncryptionKey{KeyType: key.KeyType, KeyValue: make([]byte, len(key.KeyValue))}
+	for i, b := range key.KeyValue {
+		k.KeyValue[i] = b ^ 0xf0
+	}
+	return k
+}
+
+// rc4XOR returns the data encrypted, or decrypted, with RC4 and the key.
+func rc4XOR(key, data []byte) ([]byte, error) {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating RC4 cipher: %w", err)
+	}
+	b := make([]byte, len(data))
+	c.XORKeyStream(b, data)
+	return b, nil
+}
+
+// rc4Checksum returns SGN_CKSUM, the first eight bytes of the HMAC-MD5 checksum of RFC 4757 of the data.
+func rc4Checksum(key types.EncryptionKey, usage uint32, data ...[]byte) ([]byte, error) {
+	c, err := rfc4757.Checksum(key.KeyValue, usage, bytes.Join(data, nil))
+	if err != nil {
+		return nil, err
+	}
+	return c[:8], nil
+}
+
+// rc4Sequence returns the plaintext SND_SEQ: the big-endian sequence number followed by the direction, zero bytes if
+// sent by the initiator and 0xFF bytes if sent by the acceptor.
+func rc4Sequence(seq uint32, acceptor bool) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, seq)
+	if acceptor {
+		copy(b[4:], []byte{0xff, 0xff, 0xff, 0xff})
+	}
+	return b
+}
+
+// rc4ReadSequence decrypts SND_SEQ with the key derived from SGN_CKSUM and returns the sequence number, checking the
+// direction is as expected.
+func rc4ReadSequence(key types.EncryptionKey, sndSeq, cksum []byte, fromAcceptor bool) ([]byte, uint32, error) {
+	b, err := rc4XOR(rc4Key(key, cksum), sndSeq)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(b[4:], rc4Sequence(0, fromAcceptor)[4:]) {
+		return nil, 0, errors.New("token direction not as expected")
+	}
+	return b, binary.BigEndian.Uint32(b), nil
+}
+
+// frameRC4Token returns the token framed as the InitialContextToken of RFC 2743 section 3.1, with the Kerberos V5
+// mechanism OID, as the tokens of RFC 1964 are.
+func frameRC4Token(b []byte) []byte {
+	return append(rc4Framing(len(b)), b...)
+}
+
+// rc4Framing returns the framing of a token of n bytes: the tag, the DER encoded length and the mechanism OID.
+func rc4Framing(n int) []byte {
+	n += len(rc4MechOID)
+	f := []byte{0x60}
+	switch {
+	case n < 0x80:
+		f = append(f, byte(n))
+	case n < 0x100:
+		f = append(f, 0x81, byte(n))
+	case n < 0x10000:
+		f = append(f, 0x82, byte(n>>8), byte(n))
+	case n < 0x1000000:
+		f = append(f, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	default:
+		f = append(f, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(f, rc4MechOID...)
+}
+
+// unframeRC4Token returns the token within its framing, checking it is framed with the Kerberos V5 mechanism OID.
+func unframeRC4Token(b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != 0x60 {
+		return nil, errors.New("token is not framed as a GSS-API token")
+	}
+	n, l := int(b[1]), 2
+	if n >= 0x80 {
+		c := n & 0x7f
+		if c < 1 || c > 4 || len(b) < 2+c {
+			return nil, errors.New("token framing length not valid")
+		}
+		n = 0
+		for _, x := range b[2 : 2+c] {
+			n = n<<8 | int(x)
+		}
+		l += c
+	}
+	if n != len(b)-l {
+		return nil, errors.New("token framing length does not match the token length")
+	}
+	if !bytes.HasPrefix(b[l:], rc4MechOID) {
+		return nil, errors.New("token is not a Kerberos V5 mechanism token")
+	}
+	return b[l+len(rc4MechOID):], nil
+}
+
+// rc4GetMIC returns the MIC token of RFC 4757 section 7.2 for the message.
+func rc4GetMIC(key types.EncryptionKey, seq uint32, acceptor bool, msg []byte) ([]byte, error) {
+	cksum, err := rc4Checksum(key, rc4SignUsage, rc4MICHeader, msg)
+	if err != nil {
+		return nil, fmt.Errorf("error computing MIC token checksum: %w", err)
+	}
+	sndSeq, err := rc4XOR(rc4Key(key, cksum), rc4Sequence(seq, acceptor))
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, rc4MICTokenLen)
+	b = append(b, rc4MICHeader...)
+	b = append(b, sndSeq...)
+	return frameRC4Token(append(b, cksum...)), nil
+}
+
+// rc4VerifyMIC verifies the MIC token of RFC 4757 section 7.2 for the message and returns its sequence number.
+func rc4VerifyMIC(key types.EncryptionKey, fromAcceptor bool, msg, token []byte) (uint32, error) {
+	b, err := unframeRC4Token(token)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) != rc4MICTokenLen || !bytes.Equal(b[:8], rc4MICHeader) {
+		return 0, errors.New("invalid MIC token header")
+	}
+	cksum, err := rc4Checksum(key, rc4SignUsage, rc4MICHeader, msg)
+	if err != nil {
+		return 0, fmt.Errorf("error computing MIC token checksum: %w", err)
+	}
+	if !hmac.Equal(cksum, b[16:24]) {
+		return 0, errors.New("MIC token checksum not valid")
+	}
+	_, seq, err := rc4ReadSequence(key, b[8:16], b[16:24], fromAcceptor)
+	return seq, err
+}
+
+// rc4Wrap returns the Wrap token of RFC 4757 section 7.3 for the payload, encrypting it if confidential. The payload is
+// padded with a single byte as RC4 is a stream cipher.
+func rc4Wrap(key types.EncryptionKey, seq uint32, acceptor bool, payload []byte, confidential bool) ([]byte, error) {
+	h := rc4WrapHeader(confidential)
+	confounder := make([]byte, 8)
+	if _, err := random.Read(confounder); err != nil {
+		return nil, fmt.Errorf("error generating confounder: %w", err)
+	}
+	data := make([]byte, 0, len(confounder)+len(payload)+1)
+	data = append(data, confounder...)
+	data = append(data, payload...)
+	data = append(data, 0x01)
+	cksum, err := rc4Checksum(key, rc4SealUsage, h, data)
+	if err != nil {
+		return nil, fmt.Errorf("error computing wrap token checksum: %w", err)
+	}
+	s := rc4Sequence(seq, acceptor)
+	if confidential {
+		if data, err = rc4XOR(rc4Key(rc4LocalKey(key), s[:4]), data); err != nil {
+			return nil, err
+		}
+	}
+	sndSeq, err := rc4XOR(rc4Key(key, cksum), s)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, rc4WrapHdrLen-len(confounder)+len(data))
+	b = append(b, h...)
+	b = append(b, sndSeq...)
+	b = append(b, cksum...)
+	return frameRC4Token(append(b, data...)), nil
+}
+
+// rc4Unwrap verifies, and decrypts if it is sealed, the Wrap token of RFC 4757 section 7.3, returning its payload,
+// whether it was sealed and its sequence number.
+func rc4Unwrap(key types.EncryptionKey, fromAcceptor bool, token []byte) ([]byte, bool, uint32, error) {
+	b, err := unframeRC4Token(token)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	if len(b) < rc4WrapHdrLen+1 {
+		return nil, false, 0, errors.New("wrap token shorter than header length")
+	}
+	var sealed bool
+	switch {
+	case bytes.Equal(b[:8], rc4WrapHeader(true)):
+		sealed = true
+	case !bytes.Equal(b[:8], rc4WrapHeader(false)):
+		return nil, false, 0, errors.New("invalid wrap token header")
+	}
+	s, seq, err := rc4ReadSequence(key, b[8:16], b[16:24], fromAcceptor)
+	if err != nil {
+		return nil, sealed, 0, err
+	}
+	data := b[24:]
+	if sealed {
+		if data, err = rc4XOR(rc4Key(rc4LocalKey(key), s[:4]), data); err != nil {
+			return nil, sealed, 0, err
+		}
+	}
+	cksum, err := rc4Checksum(key, rc4SealUsage, b[:8], data)
+	if err != nil {
+		return nil, sealed, 0, fmt.Errorf("error computing wrap token checksum: %w", err)
+	}
+	if !hmac.Equal(cksum, b[16:24]) {
+		return nil, sealed, 0, errors.New("wrap token checksum not valid")
+	}
+	pad := int(data[len(data)-1])
+	if pad < 1 || pad > len(data)-8 || !bytes.Equal(data[len(data)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, sealed, 0, errors.New("wrap token padding not valid")
+	}
+	return data[8 : len(data)-pad], sealed, seq, nil
+}
@@ -0,0 +1,105 @@
+package gssapi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tokens sent by an MIT Kerberos acceptor of a context with an RC4-HMAC session key.
+const (
+	testRC4Key        = "562a2ef840ae00fb9d5b9bf2467207c9"
+	testRC4SealedWrap = "603606092a864886f712010202020111001000ffffcc38ef4bdb4e27e1b384f701319f6b75a93537fa13501a447d43eb09f76ed3b4e2cdbf"
+	testRC4SignedWrap = "603606092a864886f71201020202011100ffffffff5084ffe555ccb467d65858e097f88f103266c826be4f50c86d6974207369676e656401"
+	testRC4MIC        = "602306092a864886f71201020201011100ffffffffada0dbc7e2936441e330719d104f4827"
+)
+
+func testRC4SecurityContexts() (*SecurityContext, *SecurityContext) {
+	k, _ := hex.DecodeString(testRC4Key)
+	key := types.EncryptionKey{KeyType: etypeID.RC4_HMAC, KeyValue: k}
+	return NewSecurityContext(key, false, false, 1), NewSecurityContext(key, true, false, 100)
+}
+
+func TestRC4_MITTokens(t *testing.T) {
+	t.Parallel()
+	initiator, _ := testRC4SecurityContexts()
+	for _, test := range []struct {
+		token   string
+		payload string
+		sealed  bool
+	}{
+		{testRC4SealedWrap, "mit sealed", true},
+		{testRC4SignedWrap, "mit signed", false},
+	} {
+		b, _ := hex.DecodeString(test.token)
+		p, sealed, err := initiator.Unwrap(b)
+		if err != nil {
+			t.Fatalf("error unwrapping MIT token: %v", err)
+		}
+		assert.Equal(t, test.payload, string(p), "payload not as expected")
+		assert.Equal(t, test.sealed, sealed, "sealed not as expected")
+	}
+	b, _ := hex.DecodeString(testRC4MIC)
+	assert.NoError(t, initiator.VerifyMIC([]byte("mit mic"), b), "MIT MIC token should verify")
+	assert.Error(t, initiator.VerifyMIC([]byte("modified"), b), "MIC of a modified message should not verify")
+}
+
+func TestRC4_Wrap_Unwrap(t *testing.T) {
+	t.Parallel()
+	initiator, acceptor := testRC4SecurityContexts()
+	acceptor.ExpectSequence(1)
+	for _, confidential := range []bool{false, true} {
+		for _, payload := range [][]byte{[]byte("payload"), bytes.Repeat([]byte{1}, 300)} {
+			b, err := initiator.Wrap(payload, confidential)
+			if err != nil {
+				t.Fatalf("error wrapping: %v", err)
+			}
+			assert.Equal(t, confidential, !bytes.Contains(b, payload), "payload should only be encrypted if confidential")
+			n, err := initiator.WrapSizeLimit(len(b), confidential)
+			if err != nil {
+				t.Fatalf("error getting wrap size limit: %v", err)
+			}
+			assert.Equal(t, len(payload), n, "wrap size limit not as expected")
+
+			p, sealed, err := acceptor.Unwrap(b)
+			if err != nil {
+				t.Fatalf("error unwrapping (confidential %t): %v", confidential, err)
+			}
+			assert.Equal(t, payload, p, "payload not as expected")
+			assert.Equal(t, confidential, sealed, "sealed not as expected")
+			_, _, err = initiator.Unwrap(b)
+			assert.Error(t, err, "token from the initiator should not be accepted by the initiator")
+			_, _, err = acceptor.Unwrap(b)
+			assert.Equal(t, StatusDuplicateToken, err.(Status).Code, "replayed token should be detected: %v", err)
+
+			b[len(b)-2] ^= 0xFF
+			_, _, err = NewSecurityContext(acceptor.key, true, false, 0).Unwrap(b)
+			assert.Error(t, err, "modified token should not be accepted")
+		}
+	}
+	b, err := acceptor.Wrap([]byte("reply"), true)
+	if err != nil {
+		t.Fatalf("error wrapping: %v", err)
+	}
+	p, _, err := initiator.Unwrap(b)
+	if err != nil {
+		t.Fatalf("error unwrapping reply: %v", err)
+	}
+	assert.Equal(t, "reply", string(p), "reply not as expected")
+}
+
+func TestRC4_MIC(t *testing.T) {
+	t.Parallel()
+	initiator, acceptor := testRC4SecurityContexts()
+	b, err := initiator.GetMIC([]byte("message"))
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	assert.NoError(t, acceptor.VerifyMIC([]byte("message"), b), "MIC should verify")
+	assert.Error(t, acceptor.VerifyMIC([]byte("modified"), b), "MIC of a modified message should not verify")
+	assert.Error(t, initiator.VerifyMIC([]byte("message"), b), "MIC from the initiator should not be accepted by the initiator")
+}
@@ -0,0 +1,378 @@
+package gssapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// RFC 4121, section 4.2.2
+
+const (
+	// WrapTokenFlagSentByAcceptor - this flag indicates the sender is the context acceptor.  When not set, it indicates the sender is the context initiator
+	WrapTokenFlagSentByAcceptor byte = 1 << iota
+	// WrapTokenFlagSealed - this flag indicates confidentiality is provided for, the payload of the token is encrypted
+	WrapTokenFlagSealed
+	// WrapTokenFlagAcceptorSubkey - a subkey asserted by the context acceptor is used to protect the message
+	WrapTokenFlagAcceptorSubkey
+)
+
+// SecurityContext provides the per-message protection of RFC 4121 for an established Kerberos V5 security context.
+// Wrap tokens protect the integrity, and optionally the confidentiality, of messages and MIC tokens protect the
+// integrity of messages sent separately. The tokens sent are given increasing sequence numbers, and those received can
+// be checked for replays and for being out of sequence with ExpectSequence.
+//
+// Keys of the RC4-HMAC encryption type, still negotiated as session keys by legacy Windows and NetApp endpoints, protect
+// messages with the Wrap and MIC tokens of RFC 4757 section 7 instead, which have 32-bit sequence numbers and no
+// acceptor subkey flag or RRC. A SecurityContext is safe for concurrent use.
+type SecurityContext struct {
+	key     types.EncryptionKey
+	flags   byte // flags of the tokens sent
+	rrc     uint16
+	sendSeq uint64
+	recvSeq uint64 // sequence number of the next token expected from the peer
+	checked bool   // whether the sequence numbers of tokens received are checked
+	mux     sync.Mutex
+}
+
+// NewSecurityContext returns the security context for the key of an established context. The key is the subkey
+// asserted by the acceptor in its AP_REP if there is one, in which case acceptorSubkey is true, otherwise the
+// initiator's subkey or the ticket's session key. Acceptor indicates whether the messages are sent by the context
+// acceptor and seqNum is the sequence number of the first message sent, from the authenticator of the AP_REQ for the
+// initiator or the AP_REP for the acceptor.
+func NewSecurityContext(key types.EncryptionKey, acceptor, acceptorSubkey bool, seqNum uint64) *SecurityContext {
+	var f byte
+	if acceptor {
+		f |= WrapTokenFlagSentByAcceptor
+	}
+	if acceptorSubkey {
+		f |= WrapTokenFlagAcceptorSubkey
+	}
+	return &SecurityContext{
+		key:     key,
+		flags:   f,
+		sendSeq: seqNum,
+	}
+}
+
+// SetRRC sets the right rotation count (RRC) of the Wrap tokens sent. Tokens are not rotated by default, though Wrap
+// tokens received are rotated back whatever their RRC. The RC4 tokens of RFC 4757 are not rotated.
+func (c *SecurityContext) SetRRC(rrc uint16) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.rrc = rrc
+}
+
+// ExpectSequence enables the detection of replayed and out of sequence tokens from the peer, RFC 2743 section 1.2.3,
+// where seq is the sequence number of the next token expected. It is the sequence number of the AP_REP for the
+// initiator or of the authenticator of the AP_REQ for the acceptor.
+//
+// The tokens received must then have consecutive sequence numbers. Once a token has been verified, Unwrap and
+// VerifyMIC return a Status with the code StatusDuplicateToken if the token's sequence number has already been
+// received, so it may be a replay, and its payload must not be used. If tokens have been skipped the code is
+// StatusGapToken, which is informational, and the payload of the token is returned.
+func (c *SecurityContext) ExpectSequence(seq uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.recvSeq = seq
+	c.checked = true
+}
+
+// received checks the sequence number of a verified token from the peer, if enabled by ExpectSequence.
+func (c *SecurityContext) received(seq uint64) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.checked {
+		return nil
+	}
+	switch {
+	case seq == c.recvSeq:
+		c.recvSeq++
+		return nil
+	case seq < c.recvSeq:
+		return Status{Code: StatusDuplicateToken, Message: fmt.Sprintf("sequence number %d, expecting %d", seq, c.recvSeq)}
+	default:
+		exp := c.recvSeq
+		c.recvSeq = seq + 1
+		return Status{Code: StatusGapToken, Message: fmt.Sprintf("sequence number %d, expecting %d", seq, exp)}
+	}
+}
+
+// Wrap returns a Wrap token for the payload. The payload is encrypted if confidential, otherwise only its integrity
+// is protected.
+func (c *SecurityContext) Wrap(payload []byte, confidential bool) ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if isRC4(c.key) {
+		b, err := rc4Wrap(c.key, uint32(c.sendSeq), c.flags&WrapTokenFlagSentByAcceptor != 0, payload, confidential)
+		if err != nil {
+			return nil, err
+		}
+		c.sendSeq++
+		return b, nil
+	}
+	f := c.flags
+	if confidential {
+		f |= WrapTokenFlagSealed
+	}
+	b, err := wrap(payload, c.key, c.sendSeq, f, c.rrc)
+	if err != nil {
+		return nil, err
+	}
+	c.sendSeq++
+	return b, nil
+}
+
+// Unwrap verifies, and decrypts if it is sealed, the Wrap token from the peer and returns its payload and whether it
+// was sealed.
+func (c *SecurityContext) Unwrap(token []byte) ([]byte, bool, error) {
+	if isRC4(c.key) {
+		p, sealed, seq, err := rc4Unwrap(c.key, c.flags&WrapTokenFlagSentByAcceptor == 0, token)
+		if err != nil {
+			return nil, sealed, err
+		}
+		return c.receivedPayload(p, sealed, uint64(seq))
+	}
+	if len(token) < HdrLen {
+		return nil, false, errors.New("wrap token shorter than header length")
+	}
+	if token[2]&WrapTokenFlagAcceptorSubkey != c.flags&WrapTokenFlagAcceptorSubkey {
+		return nil, false, errors.New("wrap token acceptor subkey flag not as expected")
+	}
+	sealed := token[2]&WrapTokenFlagSealed != 0
+	p, err := unwrap(token, c.key, c.flags&WrapTokenFlagSentByAcceptor == 0)
+	if err != nil {
+		return nil, sealed, err
+	}
+	return c.receivedPayload(p, sealed, binary.BigEndian.Uint64(token[8:16]))
+}
+
+// receivedPayload checks the sequence number of a verified Wrap token from the peer and returns its payload unless
+// the token may be a replay.
+func (c *SecurityContext) receivedPayload(p []byte, sealed bool, seq uint64) ([]byte, bool, error) {
+	if err := c.received(seq); err != nil {
+		if s, ok := err.(Status); ok && s.Code == StatusGapToken {
+			return p, sealed, err
+		}
+		return nil, sealed, err
+	}
+	return p, sealed, nil
+}
+
+// GetMIC returns a MIC token for the message.
+func (c *SecurityContext) GetMIC(msg []byte) ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if isRC4(c.key) {
+		b, err := rc4GetMIC(c.key, uint32(c.sendSeq), c.flags&WrapTokenFlagSentByAcceptor != 0, msg)
+		if err != nil {
+			return nil, err
+		}
+		c.sendSeq++
+		return b, nil
+	}
+	mt := MICToken{
+		Flags:     c.flags,
+		SndSeqNum: c.sendSeq,
+		Payload:   msg,
+	}
+	if err := mt.SetChecksum(c.key, signUsage(c.flags)); err != nil {
+		return nil, fmt.Errorf("error computing MIC token checksum: %w", err)
+	}
+	b, err := mt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	c.sendSeq++
+	return b, nil
+}
+
+// VerifyMIC verifies the MIC token from the peer for the message.
+func (c *SecurityContext) VerifyMIC(msg, token []byte) error {
+	if isRC4(c.key) {
+		seq, err := rc4VerifyMIC(c.key, c.flags&WrapTokenFlagSentByAcceptor == 0, msg, token)
+		if err != nil {
+			return err
+		}
+		return c.received(uint64(seq))
+	}
+	var mt MICToken
+	if err := mt.Unmarshal(token, c.flags&WrapTokenFlagSentByAcceptor == 0); err != nil {
+		return err
+	}
+	if mt.Flags&MICTokenFlagAcceptorSubkey != c.flags&WrapTokenFlagAcceptorSubkey {
+		return errors.New("MIC token acceptor subkey flag not as expected")
+	}
+	mt.Payload = msg
+	if _, err := mt.Verify(c.key, signUsage(mt.Flags)); err != nil {
+		return err
+	}
+	return c.received(mt.SndSeqNum)
+}
+
+// WrapSizeLimit returns the largest payload for which Wrap returns a token no longer than the size, RFC 2743
+// GSS_Wrap_size_limit. The limit is less than one if the size is too small for any payload.
+func (c *SecurityContext) WrapSizeLimit(size int, confidential bool) (int, error) {
+	if isRC4(c.key) {
+		// The token is the framing, the header and confounder, the payload and the padding byte.
+		n := size - len(rc4Framing(0)) - rc4WrapHdrLen - 1
+		for n > 0 && len(rc4Framing(rc4WrapHdrLen+n+1))+rc4WrapHdrLen+n+1 > size {
+			n--
+		}
+		return n, nil
+	}
+	et, err := wrapEType(c.key)
+	if err != nil {
+		return 0, err
+	}
+	return size - WrapOverhead(et, confidential), nil
+}
+
+// WrapOverhead returns the number of bytes a Wrap token with a key of the encryption type adds to its payload.
+func WrapOverhead(et etype.EType, confidential bool) int {
+	if confidential {
+		// The header, the confounder, the encrypted copy of the header and the checksum.
+		return HdrLen + et.GetConfounderByteSize() + HdrLen + et.GetHMACBitLength()/8
+	}
+	return HdrLen + et.GetHMACBitLength()/8
+}
+
+// wrapEType returns the encryption type of the key if it can be used for RFC 4121 Wrap tokens.
+func wrapEType(key types.EncryptionKey) (etype.EType, error) {
+	if key.KeyType == etypeID.RC4_HMAC || key.KeyType == etypeID.RC4_HMAC_EXP {
+		return nil, fmt.Errorf("wrap tokens are not supported with encryption type %d", key.KeyType)
+	}
+	return crypto.GetEtype(key.KeyType)
+}
+
+// sealUsage returns the key usage of Wrap tokens with the flags.
+func sealUsage(flags byte) uint32 {
+	if flags&WrapTokenFlagSentByAcceptor != 0 {
+		return keyusage.GSSAPI_ACCEPTOR_SEAL
+	}
+	return keyusage.GSSAPI_INITIATOR_SEAL
+}
+
+// signUsage returns the key usage of MIC tokens with the flags.
+func signUsage(flags byte) uint32 {
+	if flags&MICTokenFlagSentByAcceptor != 0 {
+		return keyusage.GSSAPI_ACCEPTOR_SIGN
+	}
+	return keyusage.GSSAPI_INITIATOR_SIGN
+}
+
+// wrapHeader returns the header of a Wrap token.
+func wrapHeader(flags byte, ec, rrc uint16, seq uint64) []byte {
+	h := make([]byte, HdrLen)
+	copy(h, getGssWrapTokenId()[:])
+	h[2], h[3] = flags, FillerByte
+	binary.BigEndian.PutUint16(h[4:6], ec)
+	binary.BigEndian.PutUint16(h[6:8], rrc)
+	binary.BigEndian.PutUint64(h[8:16], seq)
+	return h
+}
+
+// wrap returns a Wrap token protecting the payload with the key, with the data following the header rotated right by
+// the RRC. The payload is encrypted if the flags indicate the token is sealed, otherwise it is only integrity
+// protected.
+func wrap(payload []byte, key types.EncryptionKey, seq uint64, flags byte, rrc uint16) ([]byte, error) {
+	et, err := wrapEType(key)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	if flags&WrapTokenFlagSealed == 0 {
+		wt := WrapToken{
+			Flags:     flags,
+			EC:        uint16(et.GetHMACBitLength() / 8),
+			SndSeqNum: seq,
+			Payload:   payload,
+		}
+		if err := wt.SetCheckSum(key, sealUsage(flags)); err != nil {
+			return nil, fmt.Errorf("error computing wrap token checksum: %w", err)
+		}
+		if b, err = wt.Marshal(); err != nil {
+			return nil, err
+		}
+	} else {
+		// The encrypted data is the payload followed by a copy of the header, without filler so EC is zero, and with
+		// an RRC of zero.
+		h := wrapHeader(flags, 0, 0, seq)
+		pt := make([]byte, 0, len(payload)+len(h))
+		pt = append(pt, payload...)
+		pt = append(pt, h...)
+		_, ct, err := et.EncryptMessage(key.KeyValue, pt, sealUsage(flags))
+		if err != nil {
+			return nil, fmt.Errorf("error encrypting wrap token: %w", err)
+		}
+		b = append(h, ct...)
+	}
+	if rrc > 0 {
+		data := b[HdrLen:]
+		n := int(rrc) % len(data)
+		r := make([]byte, 0, len(b))
+		r = append(r, b[:HdrLen]...)
+		r = append(r, data[len(data)-n:]...)
+		b = append(r, data[:len(data)-n]...)
+		binary.BigEndian.PutUint16(b[6:8], rrc)
+	}
+	return b, nil
+}
+
+// unwrap verifies or decrypts the Wrap token with the key and returns its payload. The data of the token is rotated
+// back by the token's right rotation count (RRC) first, as acceptors such as Active Directory rotate it.
+func unwrap(b []byte, key types.EncryptionKey, fromAcceptor bool) ([]byte, error) {
+	if len(b) < HdrLen {
+		return nil, errors.New("wrap token shorter than header length")
+	}
+	et, err := wrapEType(key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b[0:2], getGssWrapTokenId()[:]) || b[3] != FillerByte {
+		return nil, errors.New("invalid wrap token header")
+	}
+	flags := b[2]
+	rrc := int(binary.BigEndian.Uint16(b[6:8]))
+	data := b[HdrLen:]
+	if len(data) > 0 && rrc > 0 {
+		rrc %= len(data)
+		d := make([]byte, 0, len(data))
+		d = append(d, data[rrc:]...)
+		data = append(d, data[:rrc]...)
+	}
+	h := wrapHeader(flags, binary.BigEndian.Uint16(b[4:6]), 0, binary.BigEndian.Uint64(b[8:16]))
+	if flags&WrapTokenFlagSealed == 0 {
+		var wt WrapToken
+		if err := wt.Unmarshal(append(h, data...), fromAcceptor); err != nil {
+			return nil, err
+		}
+		if ok, err := wt.Verify(key, sealUsage(flags)); !ok {
+			return nil, err
+		}
+		return wt.Payload, nil
+	}
+	if (flags&WrapTokenFlagSentByAcceptor != 0) != fromAcceptor {
+		return nil, errors.New("wrap token acceptor flag not as expected")
+	}
+	pt, err := et.DecryptMessage(key.KeyValue, data, sealUsage(flags))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting wrap token: %w", err)
+	}
+	ec := int(binary.BigEndian.Uint16(h[4:6]))
+	if len(pt) < ec+HdrLen {
+		return nil, errors.New("decrypted wrap token too short")
+	}
+	if !bytes.Equal(pt[len(pt)-HdrLen:], h) {
+		return nil, errors.New("encrypted wrap token header does not match the token header")
+	}
+	return pt[:len(pt)-HdrLen-ec], nil
+}
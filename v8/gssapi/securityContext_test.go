@@ -0,0 +1,130 @@
+package gssapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSecurityContexts(subkey bool) (*SecurityContext, *SecurityContext) {
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("12345678901234567890123456789012")}
+	return NewSecurityContext(key, false, subkey, 1), NewSecurityContext(key, true, subkey, 100)
+}
+
+func TestSecurityContext_Wrap_Unwrap(t *testing.T) {
+	t.Parallel()
+	for _, subkey := range []bool{false, true} {
+		initiator, acceptor := testSecurityContexts(subkey)
+		seq := uint64(100)
+		for _, confidential := range []bool{false, true} {
+			b, err := initiator.Wrap([]byte("payload"), confidential)
+			if err != nil {
+				t.Fatalf("error wrapping: %v", err)
+			}
+			assert.Equal(t, confidential, b[2]&WrapTokenFlagSealed != 0, "sealed flag not as expected")
+			assert.Equal(t, subkey, b[2]&WrapTokenFlagAcceptorSubkey != 0, "acceptor subkey flag not as expected")
+			assert.Equal(t, confidential, !bytes.Contains(b, []byte("payload")), "payload should only be encrypted if confidential")
+			n, err := initiator.WrapSizeLimit(len(b), confidential)
+			if err != nil {
+				t.Fatalf("error getting wrap size limit: %v", err)
+			}
+			assert.Equal(t, len("payload"), n, "wrap size limit not as expected")
+
+			p, sealed, err := acceptor.Unwrap(b)
+			if err != nil {
+				t.Fatalf("error unwrapping (confidential %t): %v", confidential, err)
+			}
+			assert.Equal(t, "payload", string(p), "payload not as expected")
+			assert.Equal(t, confidential, sealed, "sealed not as expected")
+			_, _, err = initiator.Unwrap(b)
+			assert.Error(t, err, "token from the initiator should not be accepted by the initiator")
+
+			b, err = acceptor.Wrap([]byte("reply"), confidential)
+			if err != nil {
+				t.Fatalf("error wrapping: %v", err)
+			}
+			assert.Equal(t, seq, binary.BigEndian.Uint64(b[8:16]), "sequence number not as expected")
+			seq++
+			p, _, err = initiator.Unwrap(b)
+			if err != nil {
+				t.Fatalf("error unwrapping reply: %v", err)
+			}
+			assert.Equal(t, "reply", string(p), "reply not as expected")
+		}
+	}
+	initiator, _ := testSecurityContexts(false)
+	_, acceptor := testSecurityContexts(true)
+	b, _ := initiator.Wrap([]byte("payload"), true)
+	_, _, err := acceptor.Unwrap(b)
+	assert.Error(t, err, "token without the expected acceptor subkey flag should not be accepted")
+
+}
+
+func TestSecurityContext_RRC(t *testing.T) {
+	t.Parallel()
+	initiator, acceptor := testSecurityContexts(false)
+	acceptor.SetRRC(28)
+	for _, sealed := range []bool{false, true} {
+		b, err := acceptor.Wrap([]byte("payload"), sealed)
+		if err != nil {
+			t.Fatalf("error wrapping: %v", err)
+		}
+		assert.Equal(t, uint16(28), binary.BigEndian.Uint16(b[6:8]), "RRC not as expected")
+		p, _, err := initiator.Unwrap(b)
+		if err != nil {
+			t.Fatalf("error unwrapping rotated token (sealed %t): %v", sealed, err)
+		}
+		assert.Equal(t, "payload", string(p), "payload not as expected")
+		_, err = unwrap(b, initiator.key, false)
+		assert.Error(t, err, "token from the acceptor should not be accepted as from the initiator")
+		b[len(b)-1] ^= 0xFF
+		_, _, err = initiator.Unwrap(b)
+		assert.Error(t, err, "modified token should not be accepted")
+	}
+}
+
+func TestSecurityContext_MIC(t *testing.T) {
+	t.Parallel()
+	initiator, acceptor := testSecurityContexts(true)
+	b, err := initiator.GetMIC([]byte("message"))
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	assert.NoError(t, acceptor.VerifyMIC([]byte("message"), b), "MIC should verify")
+	assert.Error(t, acceptor.VerifyMIC([]byte("modified"), b), "MIC of a modified message should not verify")
+	assert.Error(t, initiator.VerifyMIC([]byte("message"), b), "MIC from the initiator should not be accepted by the initiator")
+}
+
+func TestSecurityContext_ExpectSequence(t *testing.T) {
+	t.Parallel()
+	initiator, acceptor := testSecurityContexts(false)
+	acceptor.ExpectSequence(1)
+	b1, _ := initiator.Wrap([]byte("one"), true)
+	m2, _ := initiator.GetMIC([]byte("two"))
+	initiator.Wrap([]byte("three"), false)
+	b4, _ := initiator.Wrap([]byte("four"), false)
+
+	p, _, err := acceptor.Unwrap(b1)
+	assert.NoError(t, err, "token in sequence should be accepted")
+	assert.Equal(t, "one", string(p), "payload not as expected")
+	assert.NoError(t, acceptor.VerifyMIC([]byte("two"), m2), "MIC in sequence should be accepted")
+	p, _, err = acceptor.Unwrap(b1)
+	assert.Nil(t, p, "payload of a replayed token should not be returned")
+	assert.Equal(t, StatusDuplicateToken, err.(Status).Code, "replayed token should be detected: %v", err)
+	err = acceptor.VerifyMIC([]byte("two"), m2)
+	assert.Equal(t, StatusDuplicateToken, err.(Status).Code, "replayed MIC should be detected: %v", err)
+	p, _, err = acceptor.Unwrap(b4)
+	assert.Equal(t, StatusGapToken, err.(Status).Code, "skipped token should be detected: %v", err)
+	assert.Equal(t, "four", string(p), "payload of a token after a gap should be returned")
+
+	// Without the expected sequence tokens are not checked.
+	_, acceptor = testSecurityContexts(false)
+	for i := 0; i < 2; i++ {
+		_, _, err = acceptor.Unwrap(b1)
+		assert.NoError(t, err, "sequence numbers should not be checked unless expected")
+	}
+}
@@ -189,3 +189,38 @@ func TestNewInitiatorTokenSignatureAndMarshalling(t *testing.T) {
 	assert.Nil(t, tErr, "Unexpected error.")
 	assert.Equal(t, getResponseReference(), token, "Token failed to be marshalled to the expected bytes.")
 }
+
+func BenchmarkWrapToken_Wrap(b *testing.B) {
+	key := getSessionKey()
+	payload := make([]byte, 1024)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		token, err := NewInitiatorWrapToken(payload, key)
+		if err != nil {
+			b.Fatalf("Error creating token: %v", err)
+		}
+		_, err = token.Marshal()
+		if err != nil {
+			b.Fatalf("Error marshaling token: %v", err)
+		}
+	}
+}
+
+func BenchmarkWrapToken_Unwrap(b *testing.B) {
+	key := getSessionKey()
+	challenge, _ := hex.DecodeString(testChallengeFromAcceptor)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var wt WrapToken
+		err := wt.Unmarshal(challenge, true)
+		if err != nil {
+			b.Fatalf("Error unmarshaling token: %v", err)
+		}
+		ok, err := wt.Verify(key, acceptorSeal)
+		if !ok {
+			b.Fatalf("Token not verified: %v", err)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+// Package gssframework provides a SPNEGO initiator backed by the macOS GSS framework.
+//
+// Context establishment is performed by the system so that tickets obtained by the system, for example via the
+// Kerberos single sign on extension, are used. It is only available on darwin and requires cgo: the initiator of
+// programs built without cgo returns an error so that they can fall back to another initiator.
+//
+//	init := gssframework.NewInitiator()
+//	cl := spnego.NewInitiatorClient(init, nil, "")
+package gssframework
@@ -0,0 +1,125 @@
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package gssframework
+
+/*
+#cgo LDFLAGS: -framework GSS
+#include <GSS/GSS.h>
+#include <stdlib.h>
+#include <string.h>
+
+static OM_uint32 gokrb5_init_sec_context(OM_uint32 *minor, const char *target, OM_uint32 flags, void **out, size_t *outlen) {
+	OM_uint32 major, m;
+	gss_buffer_desc nameBuf;
+	gss_name_t name = GSS_C_NO_NAME;
+	gss_ctx_id_t ctx = GSS_C_NO_CONTEXT;
+	gss_buffer_desc outBuf = GSS_C_EMPTY_BUFFER;
+
+	*out = NULL;
+	*outlen = 0;
+	nameBuf.value = (void *)target;
+	nameBuf.length = strlen(target);
+	major = gss_import_name(minor, &nameBuf, GSS_C_NT_HOSTBASED_SERVICE, &name);
+	if (GSS_ERROR(major)) {
+		return major;
+	}
+	major = gss_init_sec_context(minor, GSS_C_NO_CREDENTIAL, &ctx, name, GSS_SPNEGO_MECHANISM, flags,
+		GSS_C_INDEFINITE, GSS_C_NO_CHANNEL_BINDINGS, GSS_C_NO_BUFFER, NULL, &outBuf, NULL, NULL);
+	gss_release_name(&m, &name);
+	if (ctx != GSS_C_NO_CONTEXT) {
+		gss_delete_sec_context(&m, &ctx, GSS_C_NO_BUFFER);
+	}
+	if (!GSS_ERROR(major) && outBuf.length > 0) {
+		*out = malloc(outBuf.length);
+		if (*out != NULL) {
+			memcpy(*out, outBuf.value, outBuf.length);
+			*outlen = outBuf.length;
+		}
+	}
+	gss_release_buffer(&m, &outBuf);
+	return major;
+}
+
+static int gokrb5_gss_error(OM_uint32 major) {
+	return GSS_ERROR(major) ? 1 : 0;
+}
+
+static char *gokrb5_display_status(OM_uint32 status, int type) {
+	OM_uint32 m, msgCtx = 0;
+	gss_buffer_desc buf = GSS_C_EMPTY_BUFFER;
+	char *s;
+
+	gss_display_status(&m, status, type, GSS_C_NO_OID, &msgCtx, &buf);
+	s = strndup(buf.value, buf.length);
+	gss_release_buffer(&m, &buf);
+	return s;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Initiator generates SPNEGO tokens via the macOS GSS framework using the credentials held by the system.
+// It implements the spnego.Initiator interface, which only sends the initiator's token, so mutual authentication is not
+// requested and the service's reply is not verified.
+type Initiator struct {
+	flags C.OM_uint32
+}
+
+// NewInitiator creates a new Initiator.
+func NewInitiator(settings ...func(*Initiator)) *Initiator {
+	i := &Initiator{}
+	for _, set := range settings {
+		set(i)
+	}
+	return i
+}
+
+// Delegate used to configure the Initiator to request that the user's credentials are delegated to the service.
+//
+// i := NewInitiator(Delegate(true))
+func Delegate(b bool) func(*Initiator) {
+	return func(i *Initiator) {
+		if b {
+			i.flags |= C.GSS_C_DELEG_FLAG
+		} else {
+			i.flags &^= C.GSS_C_DELEG_FLAG
+		}
+	}
+}
+
+// InitSecContext returns the SPNEGO token for the service with the SPN provided, e.g. "HTTP/host.example.com".
+func (i *Initiator) InitSecContext(spn string) ([]byte, error) {
+	// The GSS framework expects host based service names in the form service@host
+	target := C.CString(strings.Replace(spn, "/", "@", 1))
+	defer C.free(unsafe.Pointer(target))
+	var minor C.OM_uint32
+	var out unsafe.Pointer
+	var outlen C.size_t
+	major := C.gokrb5_init_sec_context(&minor, target, i.flags, &out, &outlen)
+	if out != nil {
+		defer C.free(out)
+	}
+	if C.gokrb5_gss_error(major) != 0 {
+		return nil, statusError(major, minor)
+	}
+	if out == nil || outlen == 0 {
+		return nil, errors.New("GSS framework did not return a token")
+	}
+	return C.GoBytes(out, C.int(outlen)), nil
+}
+
+// statusError returns an error describing the GSS major and minor status codes.
+func statusError(major, minor C.OM_uint32) error {
+	mj := C.gokrb5_display_status(major, C.GSS_C_GSS_CODE)
+	defer C.free(unsafe.Pointer(mj))
+	mn := C.gokrb5_display_status(minor, C.GSS_C_MECH_CODE)
+	defer C.free(unsafe.Pointer(mn))
+	return fmt.Errorf("gss_init_sec_context failed: %s: %s", C.GoString(mj), C.GoString(mn))
+}
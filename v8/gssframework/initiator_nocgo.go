@@ -0,0 +1,34 @@
+//go:build darwin && !cgo
+// +build darwin,!cgo
+
+package gssframework
+
+import "errors"
+
+// errNoCgo is returned by the Initiator of programs built without cgo, which the GSS framework requires.
+var errNoCgo = errors.New("the GSS framework initiator requires cgo")
+
+// Initiator generates SPNEGO tokens via the macOS GSS framework. Without cgo the framework cannot be called, so its
+// InitSecContext always returns an error, allowing programs to fall back to another initiator.
+type Initiator struct{}
+
+// NewInitiator creates a new Initiator.
+func NewInitiator(settings ...func(*Initiator)) *Initiator {
+	i := &Initiator{}
+	for _, set := range settings {
+		set(i)
+	}
+	return i
+}
+
+// Delegate used to configure the Initiator to request that the user's credentials are delegated to the service.
+//
+// i := NewInitiator(Delegate(true))
+func Delegate(b bool) func(*Initiator) {
+	return func(i *Initiator) {}
+}
+
+// InitSecContext returns an error as the GSS framework requires cgo.
+func (i *Initiator) InitSecContext(spn string) ([]byte, error) {
+	return nil, errNoCgo
+}
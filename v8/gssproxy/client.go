@@ -0,0 +1,356 @@
+// Package gssproxy implements a client of the gss-proxy daemon's protocol so that GSSAPI credentials and security
+// contexts can be used on hosts where the keytabs and credential caches are only accessible to gss-proxy, as is
+// common on hardened RHEL hosts running NFS and HTTP services.
+//
+// gss-proxy performs the Kerberos operations itself; the client receives the tokens to exchange with the peer and
+// opaque handles to the credentials and contexts held by the daemon:
+//
+//	c, err := gssproxy.Dial(gssproxy.DefaultSocket)
+//	...
+//	defer c.Close()
+//	cl := spnego.NewInitiatorClient(gssproxy.NewInitiator(c), nil, "")
+package gssproxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+)
+
+// DefaultSocket is the path of the Unix socket gss-proxy listens on by default.
+const DefaultSocket = "/var/lib/gssproxy/default.sock"
+
+// ONC RPC program, version and procedures of the gss-proxy protocol.
+const (
+	program uint32 = 400112
+	version uint32 = 1
+
+	procAcquireCred      uint32 = 6
+	procInitSecContext   uint32 = 8
+	procAcceptSecContext uint32 = 9
+	procReleaseHandle    uint32 = 10
+)
+
+// handleSecCtx is the type of the security context handles released by the release_handle procedure.
+const handleSecCtx uint32 = 0
+
+// ONC RPC message constants, RFC 5531.
+const (
+	rpcVersion     uint32 = 2
+	msgCall        uint32 = 0
+	msgReply       uint32 = 1
+	replyAccepted  uint32 = 0
+	acceptSuccess  uint32 = 0
+	lastFragment   uint32 = 0x80000000
+	maxRecordBytes        = 1 << 24
+)
+
+// GSS major status values.
+const (
+	StatusContinueNeeded uint64 = 1
+	statusErrorMask      uint64 = 0xffff0000
+)
+
+// GSS context flags requested when initiating a security context.
+const (
+	FlagDeleg    uint64 = 1
+	FlagMutual   uint64 = 2
+	FlagReplay   uint64 = 4
+	FlagSequence uint64 = 8
+	FlagConf     uint64 = 16
+	FlagInteg    uint64 = 32
+)
+
+// GSS name type for host based service names of the form service@host.
+var oidHostBasedService = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 1, 4}
+
+// Mechanism OIDs in the form used by gss-proxy, the DER encoded content without the tag and length.
+var (
+	MechKRB5   = oidBytes(gssapi.OIDKRB5.OID())
+	MechSPNEGO = oidBytes(gssapi.OIDSPNEGO.OID())
+)
+
+// StatusError is returned when gss-proxy reports a GSS error for a call.
+type StatusError struct {
+	Status Status
+}
+
+// Error implements the error interface.
+func (e StatusError) Error() string {
+	return fmt.Sprintf("gss-proxy error (major: %#x, minor: %d): %s: %s", e.Status.MajorStatus, e.Status.MinorStatus,
+		e.Status.MajorStatusString, e.Status.MinorStatusString)
+}
+
+// Client is a connection to gss-proxy. It is safe for concurrent use; calls are made one at a time.
+type Client struct {
+	conn net.Conn
+	mux  sync.Mutex
+	xid  uint32
+}
+
+// Dial connects to gss-proxy on the Unix socket at the path.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to gss-proxy at %s: %w", path, err)
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a Client using the connection to gss-proxy.
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn}
+}
+
+// Close closes the connection to gss-proxy.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// HostBasedServiceName returns the name of a service in the form service@host. An SPN of the form service/host is
+// also accepted.
+func HostBasedServiceName(service string) Name {
+	return Name{
+		DisplayName: []byte(strings.Replace(service, "/", "@", 1)),
+		NameType:    oidBytes(oidHostBasedService),
+	}
+}
+
+// AcquireCred acquires a credential for the name, or the default credential of the calling user or service if the
+// name is nil, for the usage and mechanism.
+func (c *Client) AcquireCred(name *Name, usage int32, mech []byte) (*Cred, error) {
+	w := new(xdrWriter)
+	callCtx{}.encode(w)
+	w.bool(false) // input_cred_handle
+	w.bool(false) // add_cred_to_input_handle
+	encodeOptional(w, name != nil, func(w *xdrWriter) { name.encode(w) })
+	w.uint64(0) // time_req
+	w.uint32(1) // desired_mechs
+	w.opaque(mech)
+	w.uint32(uint32(usage))
+	w.uint64(0) // initiator_time_req
+	w.uint64(0) // acceptor_time_req
+	encodeOptions(w, nil)
+	r, err := c.call(procAcquireCred, w.b)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeStatus(r); err != nil {
+		return nil, err
+	}
+	cred := new(Cred)
+	ok, err := decodeOptional(r, cred.decode)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode acquire_cred result: %w", err)
+	}
+	if !ok {
+		return nil, errors.New("gss-proxy did not return a credential")
+	}
+	return cred, nil
+}
+
+// InitSecContext initiates, or continues with the input token returned by the peer, the establishment of a security
+// context with the target for the mechanism. A nil context and input token start the establishment and a nil credential
+// uses the default credential. The context returned is passed to subsequent calls while the boolean returned indicates
+// that the context is not yet established.
+func (c *Client) InitSecContext(ctx *Context, cred *Cred, target Name, mech []byte, flags uint64, input []byte) (*Context, []byte, bool, error) {
+	w := new(xdrWriter)
+	callCtx{}.encode(w)
+	encodeOptional(w, ctx != nil, func(w *xdrWriter) { ctx.encode(w) })
+	encodeOptional(w, cred != nil, func(w *xdrWriter) { cred.encode(w) })
+	encodeOptional(w, true, target.encode)
+	w.opaque(mech)
+	w.uint64(flags)
+	w.uint64(0)   // time_req
+	w.bool(false) // input_cb
+	encodeOptional(w, input != nil, func(w *xdrWriter) { w.opaque(input) })
+	encodeOptions(w, nil)
+	r, err := c.call(procInitSecContext, w.b)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return decodeSecContextResult(r, ctx)
+}
+
+// AcceptSecContext accepts the input token from an initiator using the credential, or the default acceptor credential
+// if nil. The context returned is passed to subsequent calls while the boolean returned indicates that the context
+// is not yet established. The output token, if not empty, is to be returned to the initiator.
+func (c *Client) AcceptSecContext(ctx *Context, cred *Cred, input []byte) (*Context, []byte, bool, error) {
+	w := new(xdrWriter)
+	callCtx{}.encode(w)
+	encodeOptional(w, ctx != nil, func(w *xdrWriter) { ctx.encode(w) })
+	encodeOptional(w, cred != nil, func(w *xdrWriter) { cred.encode(w) })
+	w.opaque(input)
+	w.bool(false) // input_cb
+	w.bool(false) // ret_deleg_cred
+	encodeOptions(w, nil)
+	r, err := c.call(procAcceptSecContext, w.b)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return decodeSecContextResult(r, ctx)
+}
+
+// ReleaseSecContext releases the security context held by gss-proxy for the handle, which should be done once the
+// context is no longer needed.
+func (c *Client) ReleaseSecContext(ctx *Context) error {
+	w := new(xdrWriter)
+	callCtx{}.encode(w)
+	w.uint32(handleSecCtx)
+	ctx.encode(w)
+	r, err := c.call(procReleaseHandle, w.b)
+	if err != nil {
+		return err
+	}
+	return decodeStatus(r)
+}
+
+// decodeSecContextResult decodes the start of an init or accept security context result, which share the layout of
+// the status, context handle and output token. The context passed is returned if no new handle is in the result.
+func decodeSecContextResult(r *xdrReader, ctx *Context) (*Context, []byte, bool, error) {
+	var s Status
+	if err := s.decode(r); err != nil {
+		return nil, nil, false, fmt.Errorf("could not decode status: %w", err)
+	}
+	if s.MajorStatus&statusErrorMask != 0 {
+		return nil, nil, false, StatusError{Status: s}
+	}
+	nctx := new(Context)
+	ok, err := decodeOptional(r, nctx.decode)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("could not decode context handle: %w", err)
+	}
+	if ok {
+		ctx = nctx
+	}
+	var out []byte
+	if _, err := decodeOptional(r, func(r *xdrReader) (err error) {
+		out, err = r.opaque()
+		return
+	}); err != nil {
+		return nil, nil, false, fmt.Errorf("could not decode output token: %w", err)
+	}
+	return ctx, out, s.MajorStatus&StatusContinueNeeded != 0, nil
+}
+
+// decodeStatus decodes the status at the start of a result, returning a StatusError if it reports a GSS error.
+func decodeStatus(r *xdrReader) error {
+	var s Status
+	if err := s.decode(r); err != nil {
+		return fmt.Errorf("could not decode status: %w", err)
+	}
+	if s.MajorStatus&statusErrorMask != 0 {
+		return StatusError{Status: s}
+	}
+	return nil
+}
+
+// call makes the ONC RPC call of the procedure with the encoded arguments and returns a reader of the results.
+func (c *Client) call(proc uint32, args []byte) (*xdrReader, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.xid++
+	w := new(xdrWriter)
+	w.uint32(c.xid)
+	w.uint32(msgCall)
+	w.uint32(rpcVersion)
+	w.uint32(program)
+	w.uint32(version)
+	w.uint32(proc)
+	// AUTH_NONE credential and verifier, gss-proxy identifies the caller from the socket.
+	w.uint32(0)
+	w.opaque(nil)
+	w.uint32(0)
+	w.opaque(nil)
+	w.b = append(w.b, args...)
+	if err := writeRecord(c.conn, w.b); err != nil {
+		return nil, fmt.Errorf("could not send call to gss-proxy: %w", err)
+	}
+	b, err := readRecord(c.conn)
+	if err != nil {
+		return nil, fmt.Errorf("could not read reply from gss-proxy: %w", err)
+	}
+	r := &xdrReader{b: b}
+	if err := readReplyHeader(r, c.xid); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readReplyHeader reads the ONC RPC reply header, returning an error if the call was not successful.
+func readReplyHeader(r *xdrReader, xid uint32) error {
+	var h [3]uint32
+	for i := range h {
+		v, err := r.uint32()
+		if err != nil {
+			return fmt.Errorf("could not decode reply header: %w", err)
+		}
+		h[i] = v
+	}
+	if h[0] != xid || h[1] != msgReply {
+		return errors.New("reply from gss-proxy does not match the call")
+	}
+	if h[2] != replyAccepted {
+		return errors.New("call denied by gss-proxy")
+	}
+	// Verifier
+	if _, err := r.uint32(); err != nil {
+		return err
+	}
+	if _, err := r.opaque(); err != nil {
+		return err
+	}
+	stat, err := r.uint32()
+	if err != nil {
+		return err
+	}
+	if stat != acceptSuccess {
+		return fmt.Errorf("call not executed by gss-proxy (accept status %d)", stat)
+	}
+	return nil
+}
+
+// writeRecord writes the message as a single record marked fragment, RFC 5531 section 11.
+func writeRecord(w io.Writer, b []byte) error {
+	m := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(m, lastFragment|uint32(len(b)))
+	_, err := w.Write(append(m, b...))
+	return err
+}
+
+// readRecord reads a record, reassembling its fragments.
+func readRecord(rd io.Reader) ([]byte, error) {
+	var b []byte
+	for {
+		var m [4]byte
+		if _, err := io.ReadFull(rd, m[:]); err != nil {
+			return nil, err
+		}
+		h := binary.BigEndian.Uint32(m[:])
+		n := int(h &^ lastFragment)
+		if len(b)+n > maxRecordBytes {
+			return nil, errors.New("record exceeds maximum size")
+		}
+		f := make([]byte, n)
+		if _, err := io.ReadFull(rd, f); err != nil {
+			return nil, err
+		}
+		b = append(b, f...)
+		if h&lastFragment != 0 {
+			return b, nil
+		}
+	}
+}
+
+// oidBytes returns the DER encoded content of the OID.
+func oidBytes(oid asn1.ObjectIdentifier) []byte {
+	b, _ := asn1.Marshal(oid)
+	return b[2:]
+}
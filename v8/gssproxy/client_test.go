@@ -0,0 +1,171 @@
+package gssproxy
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testServer answers the calls on the connection with the handler's result until the client closes it.
+func testServer(t *testing.T, conn net.Conn, handler func(proc uint32, r *xdrReader) []byte) {
+	t.Helper()
+	go func() {
+		defer conn.Close()
+		for {
+			if !testServeCall(t, conn, handler) {
+				return
+			}
+		}
+	}()
+}
+
+// testServeCall answers a call on the connection, returning false once the connection is closed.
+func testServeCall(t *testing.T, conn net.Conn, handler func(proc uint32, r *xdrReader) []byte) bool {
+	b, err := readRecord(conn)
+	if err != nil {
+		return false
+	}
+	r := &xdrReader{b: b}
+	var h [6]uint32
+	for i := range h {
+		h[i], _ = r.uint32()
+	}
+	assert.Equal(t, [6]uint32{h[0], msgCall, rpcVersion, program, version, h[5]}, h, "call header not as expected")
+	for i := 0; i < 2; i++ {
+		r.uint32()
+		r.opaque()
+	}
+	w := new(xdrWriter)
+	w.uint32(h[0])
+	w.uint32(msgReply)
+	w.uint32(replyAccepted)
+	w.uint32(0)
+	w.opaque(nil)
+	w.uint32(acceptSuccess)
+	w.b = append(w.b, handler(h[5], r)...)
+	return writeRecord(conn, w.b) == nil
+}
+
+func TestClient_InitSecContext(t *testing.T) {
+	t.Parallel()
+	cc, sc := net.Pipe()
+	c := NewClient(cc)
+	defer c.Close()
+	var released []byte
+	testServer(t, sc, func(proc uint32, r *xdrReader) []byte {
+		if proc == procReleaseHandle {
+			var cctx callCtx
+			assert.NoError(t, cctx.decode(r), "error decoding call context")
+			typ, _ := r.uint32()
+			assert.Equal(t, handleSecCtx, typ, "handle type not as expected")
+			var ctx Context
+			assert.NoError(t, ctx.decode(r), "error decoding context handle")
+			released = ctx.State
+			w := new(xdrWriter)
+			Status{}.encode(w)
+			return w.b
+		}
+		assert.Equal(t, procInitSecContext, proc, "procedure not as expected")
+		var cctx callCtx
+		assert.NoError(t, cctx.decode(r), "error decoding call context")
+		ok, _ := r.bool()
+		assert.False(t, ok, "no context handle should be sent")
+		ok, _ = r.bool()
+		assert.False(t, ok, "no credential handle should be sent")
+		var n Name
+		ok, err := decodeOptional(r, n.decode)
+		assert.True(t, ok && err == nil, "target name not sent")
+		assert.Equal(t, "HTTP@host.test.gokrb5", string(n.DisplayName), "target name not as expected")
+		mech, _ := r.opaque()
+		assert.Equal(t, MechSPNEGO, mech, "mechanism not as expected")
+		flags, _ := r.uint64()
+		assert.Equal(t, uint64(0), flags, "mutual authentication should not be requested")
+
+		w := new(xdrWriter)
+		Status{MajorStatus: 0}.encode(w)
+		encodeOptional(w, true, Context{State: []byte("state"), Mech: MechSPNEGO}.encode)
+		encodeOptional(w, true, func(w *xdrWriter) { w.opaque([]byte("token")) })
+		encodeOptions(w, nil)
+		return w.b
+	})
+	b, err := NewInitiator(c).InitSecContext("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	assert.Equal(t, []byte("token"), b, "token not as expected")
+	assert.Equal(t, []byte("state"), released, "security context not released")
+}
+
+func TestClient_AcceptSecContext(t *testing.T) {
+	t.Parallel()
+	cc, sc := net.Pipe()
+	c := NewClient(cc)
+	defer c.Close()
+	testServer(t, sc, func(proc uint32, r *xdrReader) []byte {
+		assert.Equal(t, procAcceptSecContext, proc, "procedure not as expected")
+		var cctx callCtx
+		cctx.decode(r)
+		r.bool()
+		r.bool()
+		in, _ := r.opaque()
+		assert.Equal(t, []byte("client token"), in, "input token not as expected")
+
+		w := new(xdrWriter)
+		Status{MajorStatus: 0}.encode(w)
+		ctx := Context{
+			Mech:    MechKRB5,
+			SrcName: Name{DisplayName: []byte("testuser1@TEST.GOKRB5")},
+			Open:    true,
+		}
+		encodeOptional(w, true, ctx.encode)
+		encodeOptional(w, true, func(w *xdrWriter) { w.opaque([]byte("server token")) })
+		w.bool(false)
+		encodeOptions(w, nil)
+		return w.b
+	})
+	ctx, out, cont, err := c.AcceptSecContext(nil, nil, []byte("client token"))
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	assert.False(t, cont, "context should be established")
+	assert.True(t, ctx.Open, "context should be open")
+	assert.Equal(t, "testuser1@TEST.GOKRB5", string(ctx.SrcName.DisplayName), "initiator name not as expected")
+	assert.Equal(t, []byte("server token"), out, "output token not as expected")
+}
+
+func TestClient_AcquireCred_Error(t *testing.T) {
+	t.Parallel()
+	cc, sc := net.Pipe()
+	c := NewClient(cc)
+	defer c.Close()
+	testServer(t, sc, func(proc uint32, r *xdrReader) []byte {
+		assert.Equal(t, procAcquireCred, proc, "procedure not as expected")
+		w := new(xdrWriter)
+		Status{MajorStatus: 0x70000, MajorStatusString: "No credentials were supplied"}.encode(w)
+		w.bool(false)
+		encodeOptions(w, nil)
+		return w.b
+	})
+	_, err := c.AcquireCred(nil, CredUsageInitiate, MechKRB5)
+	if _, ok := err.(StatusError); !ok {
+		t.Fatalf("error not a StatusError: %v", err)
+	}
+	assert.Contains(t, err.Error(), "No credentials were supplied", "error message not as expected")
+}
+
+func TestXDR_Opaque(t *testing.T) {
+	t.Parallel()
+	w := new(xdrWriter)
+	w.opaque([]byte{1, 2, 3, 4, 5})
+	w.uint32(7)
+	assert.Equal(t, 16, len(w.b), "opaque data not padded")
+	r := &xdrReader{b: w.b}
+	b, err := r.opaque()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4, 5}, b, "opaque data not as expected")
+	v, _ := r.uint32()
+	assert.Equal(t, uint32(7), v, "value after opaque data not as expected")
+	_, err = (&xdrReader{b: []byte{0xff, 0xff, 0xff, 0xff}}).opaque()
+	assert.Error(t, err, "excessive length should be rejected")
+}
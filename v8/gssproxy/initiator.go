@@ -0,0 +1,66 @@
+package gssproxy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Initiator generates SPNEGO tokens via gss-proxy using the credentials gss-proxy holds for the calling user or
+// service. It implements the spnego.Initiator interface, which only sends the initiator's token, so mutual
+// authentication is not requested and the service's reply is not verified. The security context is released once the
+// token is generated.
+type Initiator struct {
+	client *Client
+	cred   *Cred
+	flags  uint64
+}
+
+// NewInitiator creates a new Initiator using the gss-proxy client.
+func NewInitiator(c *Client, settings ...func(*Initiator)) *Initiator {
+	i := &Initiator{
+		client: c,
+	}
+	for _, set := range settings {
+		set(i)
+	}
+	return i
+}
+
+// Credential used to configure the Initiator to use a credential acquired from gss-proxy rather than the default.
+//
+// i := NewInitiator(c, Credential(cred))
+func Credential(cred *Cred) func(*Initiator) {
+	return func(i *Initiator) {
+		i.cred = cred
+	}
+}
+
+// Delegate used to configure the Initiator to request that the credentials are delegated to the service.
+//
+// i := NewInitiator(c, Delegate(true))
+func Delegate(b bool) func(*Initiator) {
+	return func(i *Initiator) {
+		if b {
+			i.flags |= FlagDeleg
+		} else {
+			i.flags &^= FlagDeleg
+		}
+	}
+}
+
+// InitSecContext returns the SPNEGO token for the service with the SPN provided, e.g. "HTTP/host.example.com".
+func (i *Initiator) InitSecContext(spn string) ([]byte, error) {
+	ctx, b, _, err := i.client.InitSecContext(nil, i.cred, HostBasedServiceName(spn), MechSPNEGO, i.flags, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ctx != nil {
+		if err := i.client.ReleaseSecContext(ctx); err != nil {
+			return nil, fmt.Errorf("could not release the security context: %w", err)
+		}
+	}
+	if len(b) < 1 {
+		return nil, errors.New("gss-proxy did not return a token")
+	}
+	return b, nil
+}
@@ -0,0 +1,365 @@
+package gssproxy
+
+// Types of the gss-proxy protocol, as defined by gss_proxy.x of the gssproxy project.
+
+// Credential usage.
+const (
+	CredUsageInitiate int32 = 1
+	CredUsageAccept   int32 = 2
+	CredUsageBoth     int32 = 3
+)
+
+// Option is an extension option passed with many of the protocol's structures.
+type Option struct {
+	Option []byte
+	Value  []byte
+}
+
+// Status is the outcome of a call as reported by gss-proxy.
+type Status struct {
+	MajorStatus       uint64
+	Mech              []byte
+	MinorStatus       uint64
+	MajorStatusString string
+	MinorStatusString string
+	ServerCtx         []byte
+	Options           []Option
+}
+
+// NameAttr is an attribute of a name.
+type NameAttr struct {
+	Attr       []byte
+	Value      []byte
+	Extensions []Option
+}
+
+// Name is a GSS name.
+type Name struct {
+	DisplayName           []byte
+	NameType              []byte
+	ExportedName          []byte
+	ExportedCompositeName []byte
+	NameAttributes        []NameAttr
+	Extensions            []Option
+}
+
+// CredElement describes the credential held for a single mechanism.
+type CredElement struct {
+	MN               Name
+	Mech             []byte
+	CredUsage        int32
+	InitiatorTimeRec int64
+	AcceptorTimeRec  int64
+	Options          []Option
+}
+
+// Cred is a credential handle. The credential itself remains with gss-proxy, which returns an encrypted reference
+// to it that is passed back in later calls.
+type Cred struct {
+	DesiredName         Name
+	Elements            []CredElement
+	CredHandleReference []byte
+	NeedsRelease        bool
+}
+
+// Context is a security context handle held on behalf of the client by gss-proxy.
+type Context struct {
+	ExportedContextToken []byte
+	State                []byte
+	NeedsRelease         bool
+	Mech                 []byte
+	SrcName              Name
+	TargName             Name
+	Lifetime             int64
+	CtxFlags             uint64
+	LocallyInitiated     bool
+	Open                 bool
+	ContextOptions       []Option
+}
+
+// callCtx is passed with each call.
+type callCtx struct {
+	Locale    []byte
+	ServerCtx []byte
+	Options   []Option
+}
+
+func (o Option) encode(w *xdrWriter) {
+	w.opaque(o.Option)
+	w.opaque(o.Value)
+}
+
+func (o *Option) decode(r *xdrReader) (err error) {
+	if o.Option, err = r.opaque(); err != nil {
+		return
+	}
+	o.Value, err = r.opaque()
+	return
+}
+
+func encodeOptions(w *xdrWriter, opts []Option) {
+	w.uint32(uint32(len(opts)))
+	for _, o := range opts {
+		o.encode(w)
+	}
+}
+
+func decodeOptions(r *xdrReader) ([]Option, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	var opts []Option
+	for i := 0; i < n; i++ {
+		var o Option
+		if err := o.decode(r); err != nil {
+			return nil, err
+		}
+		opts = append(opts, o)
+	}
+	return opts, nil
+}
+
+func (s Status) encode(w *xdrWriter) {
+	w.uint64(s.MajorStatus)
+	w.opaque(s.Mech)
+	w.uint64(s.MinorStatus)
+	w.opaque([]byte(s.MajorStatusString))
+	w.opaque([]byte(s.MinorStatusString))
+	w.opaque(s.ServerCtx)
+	encodeOptions(w, s.Options)
+}
+
+func (s *Status) decode(r *xdrReader) (err error) {
+	if s.MajorStatus, err = r.uint64(); err != nil {
+		return
+	}
+	if s.Mech, err = r.opaque(); err != nil {
+		return
+	}
+	if s.MinorStatus, err = r.uint64(); err != nil {
+		return
+	}
+	var b []byte
+	if b, err = r.opaque(); err != nil {
+		return
+	}
+	s.MajorStatusString = string(b)
+	if b, err = r.opaque(); err != nil {
+		return
+	}
+	s.MinorStatusString = string(b)
+	if s.ServerCtx, err = r.opaque(); err != nil {
+		return
+	}
+	s.Options, err = decodeOptions(r)
+	return
+}
+
+func (c callCtx) encode(w *xdrWriter) {
+	w.opaque(c.Locale)
+	w.opaque(c.ServerCtx)
+	encodeOptions(w, c.Options)
+}
+
+func (c *callCtx) decode(r *xdrReader) (err error) {
+	if c.Locale, err = r.opaque(); err != nil {
+		return
+	}
+	if c.ServerCtx, err = r.opaque(); err != nil {
+		return
+	}
+	c.Options, err = decodeOptions(r)
+	return
+}
+
+func (a NameAttr) encode(w *xdrWriter) {
+	w.opaque(a.Attr)
+	w.opaque(a.Value)
+	encodeOptions(w, a.Extensions)
+}
+
+func (a *NameAttr) decode(r *xdrReader) (err error) {
+	if a.Attr, err = r.opaque(); err != nil {
+		return
+	}
+	if a.Value, err = r.opaque(); err != nil {
+		return
+	}
+	a.Extensions, err = decodeOptions(r)
+	return
+}
+
+func (n Name) encode(w *xdrWriter) {
+	w.opaque(n.DisplayName)
+	w.opaque(n.NameType)
+	w.opaque(n.ExportedName)
+	w.opaque(n.ExportedCompositeName)
+	w.uint32(uint32(len(n.NameAttributes)))
+	for _, a := range n.NameAttributes {
+		a.encode(w)
+	}
+	encodeOptions(w, n.Extensions)
+}
+
+func (n *Name) decode(r *xdrReader) (err error) {
+	if n.DisplayName, err = r.opaque(); err != nil {
+		return
+	}
+	if n.NameType, err = r.opaque(); err != nil {
+		return
+	}
+	if n.ExportedName, err = r.opaque(); err != nil {
+		return
+	}
+	if n.ExportedCompositeName, err = r.opaque(); err != nil {
+		return
+	}
+	var l int
+	if l, err = r.length(); err != nil {
+		return
+	}
+	for i := 0; i < l; i++ {
+		var a NameAttr
+		if err = a.decode(r); err != nil {
+			return
+		}
+		n.NameAttributes = append(n.NameAttributes, a)
+	}
+	n.Extensions, err = decodeOptions(r)
+	return
+}
+
+func (e CredElement) encode(w *xdrWriter) {
+	e.MN.encode(w)
+	w.opaque(e.Mech)
+	w.uint32(uint32(e.CredUsage))
+	w.uint64(uint64(e.InitiatorTimeRec))
+	w.uint64(uint64(e.AcceptorTimeRec))
+	encodeOptions(w, e.Options)
+}
+
+func (e *CredElement) decode(r *xdrReader) (err error) {
+	if err = e.MN.decode(r); err != nil {
+		return
+	}
+	if e.Mech, err = r.opaque(); err != nil {
+		return
+	}
+	var u uint32
+	if u, err = r.uint32(); err != nil {
+		return
+	}
+	e.CredUsage = int32(u)
+	var t uint64
+	if t, err = r.uint64(); err != nil {
+		return
+	}
+	e.InitiatorTimeRec = int64(t)
+	if t, err = r.uint64(); err != nil {
+		return
+	}
+	e.AcceptorTimeRec = int64(t)
+	e.Options, err = decodeOptions(r)
+	return
+}
+
+func (c Cred) encode(w *xdrWriter) {
+	c.DesiredName.encode(w)
+	w.uint32(uint32(len(c.Elements)))
+	for _, e := range c.Elements {
+		e.encode(w)
+	}
+	w.opaque(c.CredHandleReference)
+	w.bool(c.NeedsRelease)
+}
+
+func (c *Cred) decode(r *xdrReader) (err error) {
+	if err = c.DesiredName.decode(r); err != nil {
+		return
+	}
+	var l int
+	if l, err = r.length(); err != nil {
+		return
+	}
+	for i := 0; i < l; i++ {
+		var e CredElement
+		if err = e.decode(r); err != nil {
+			return
+		}
+		c.Elements = append(c.Elements, e)
+	}
+	if c.CredHandleReference, err = r.opaque(); err != nil {
+		return
+	}
+	c.NeedsRelease, err = r.bool()
+	return
+}
+
+func (c Context) encode(w *xdrWriter) {
+	w.opaque(c.ExportedContextToken)
+	w.opaque(c.State)
+	w.bool(c.NeedsRelease)
+	w.opaque(c.Mech)
+	c.SrcName.encode(w)
+	c.TargName.encode(w)
+	w.uint64(uint64(c.Lifetime))
+	w.uint64(c.CtxFlags)
+	w.bool(c.LocallyInitiated)
+	w.bool(c.Open)
+	encodeOptions(w, c.ContextOptions)
+}
+
+func (c *Context) decode(r *xdrReader) (err error) {
+	if c.ExportedContextToken, err = r.opaque(); err != nil {
+		return
+	}
+	if c.State, err = r.opaque(); err != nil {
+		return
+	}
+	if c.NeedsRelease, err = r.bool(); err != nil {
+		return
+	}
+	if c.Mech, err = r.opaque(); err != nil {
+		return
+	}
+	if err = c.SrcName.decode(r); err != nil {
+		return
+	}
+	if err = c.TargName.decode(r); err != nil {
+		return
+	}
+	var t uint64
+	if t, err = r.uint64(); err != nil {
+		return
+	}
+	c.Lifetime = int64(t)
+	if c.CtxFlags, err = r.uint64(); err != nil {
+		return
+	}
+	if c.LocallyInitiated, err = r.bool(); err != nil {
+		return
+	}
+	if c.Open, err = r.bool(); err != nil {
+		return
+	}
+	c.ContextOptions, err = decodeOptions(r)
+	return
+}
+
+// encodeOptional writes an XDR optional value, present if the value is not nil.
+func encodeOptional(w *xdrWriter, present bool, encode func(*xdrWriter)) {
+	w.bool(present)
+	if present {
+		encode(w)
+	}
+}
+
+// decodeOptional reads an XDR optional value, calling decode if it is present.
+func decodeOptional(r *xdrReader, decode func(*xdrReader) error) (bool, error) {
+	present, err := r.bool()
+	if err != nil || !present {
+		return false, err
+	}
+	return true, decode(r)
+}
@@ -0,0 +1,101 @@
+package gssproxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxXDRLength limits the length of variable length data decoded, protecting against corrupt messages.
+const maxXDRLength = 1 << 24
+
+// xdrWriter encodes values in XDR, RFC 4506.
+type xdrWriter struct {
+	b []byte
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.b = append(w.b, b[:]...)
+}
+
+func (w *xdrWriter) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.b = append(w.b, b[:]...)
+}
+
+func (w *xdrWriter) bool(v bool) {
+	if v {
+		w.uint32(1)
+		return
+	}
+	w.uint32(0)
+}
+
+// opaque writes variable length opaque data padded to a multiple of four bytes.
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.b = append(w.b, b...)
+	if p := len(b) % 4; p != 0 {
+		w.b = append(w.b, make([]byte, 4-p)...)
+	}
+}
+
+// xdrReader decodes values encoded in XDR, RFC 4506.
+type xdrReader struct {
+	b []byte
+}
+
+var errXDRShort = errors.New("XDR data too short")
+
+func (r *xdrReader) uint32() (uint32, error) {
+	if len(r.b) < 4 {
+		return 0, errXDRShort
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v, nil
+}
+
+func (r *xdrReader) uint64() (uint64, error) {
+	if len(r.b) < 8 {
+		return 0, errXDRShort
+	}
+	v := binary.BigEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v, nil
+}
+
+func (r *xdrReader) bool() (bool, error) {
+	v, err := r.uint32()
+	return v != 0, err
+}
+
+func (r *xdrReader) opaque() ([]byte, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	p := (4 - n%4) % 4
+	if len(r.b) < n+p {
+		return nil, errXDRShort
+	}
+	b := make([]byte, n)
+	copy(b, r.b)
+	r.b = r.b[n+p:]
+	return b, nil
+}
+
+// length reads the length of an array or opaque data.
+func (r *xdrReader) length() (int, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	if n > maxXDRLength {
+		return 0, fmt.Errorf("XDR length %d exceeds limit", n)
+	}
+	return int(n), nil
+}
@@ -17,6 +17,8 @@ const (
 	ADAuthenticationStrength      int32 = 70
 	ADFXFastArmor                 int32 = 71
 	ADFXFastUsed                  int32 = 72
+	ADCAMMAC                      int32 = 96
+	ADAuthenticationIndicator     int32 = 97
 	ADWin2KPAC                    int32 = 128
 	ADEtypeNegotiation            int32 = 129
 	//Reserved values                   9-63
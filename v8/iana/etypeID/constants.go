@@ -1,6 +1,11 @@
 // Package etypeID provides Kerberos 5 encryption type assigned numbers.
 package etypeID
 
+import (
+	"fmt"
+	"sort"
+)
+
 // Kerberos encryption type assigned numbers.
 const (
 	//RESERVED : 0
@@ -99,3 +104,47 @@ func EtypeSupported(etype string) int32 {
 	}
 	return 0
 }
+
+// Name returns the canonical name of the etype ID.
+func Name(id int32) string {
+	switch id {
+	case AES128_CTS_HMAC_SHA1_96:
+		return "aes128-cts-hmac-sha1-96"
+	case AES256_CTS_HMAC_SHA1_96:
+		return "aes256-cts-hmac-sha1-96"
+	case AES128_CTS_HMAC_SHA256_128:
+		return "aes128-cts-hmac-sha256-128"
+	case AES256_CTS_HMAC_SHA384_192:
+		return "aes256-cts-hmac-sha384-192"
+	case CAMELLIA128_CTS_CMAC:
+		return "camellia128-cts-cmac"
+	case CAMELLIA256_CTS_CMAC:
+		return "camellia256-cts-cmac"
+	case DES3_CBC_SHA1_KD:
+		return "des3-cbc-sha1"
+	case RC4_HMAC:
+		return "arcfour-hmac"
+	}
+	var names []string
+	for n, i := range ETypesByName {
+		if i == id {
+			names = append(names, n)
+		}
+	}
+	if len(names) < 1 {
+		return fmt.Sprintf("etype %d", id)
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// Deprecated indicates if the etype ID is one deprecated by RFC 6649 and RFC 8429, such as the DES, DES3 and RC4
+// encryption types. Only the AES and Camellia encryption types are not deprecated.
+func Deprecated(id int32) bool {
+	switch id {
+	case AES128_CTS_HMAC_SHA1_96, AES256_CTS_HMAC_SHA1_96, AES128_CTS_HMAC_SHA256_128, AES256_CTS_HMAC_SHA384_192,
+		CAMELLIA128_CTS_CMAC, CAMELLIA256_CTS_CMAC:
+		return false
+	}
+	return true
+}
@@ -17,11 +17,13 @@ const (
 	PreAuthent             = 10
 	HWAuthent              = 11
 	OptHardwareAuth        = 11
-	RequestAnonymous       = 12
 	TransitedPolicyChecked = 12
 	OKAsDelegate           = 13
+	Anonymous              = 14
+	CNameInAddlTkt         = 14 // MS-SFU section 2.2.3
 	EncPARep               = 15
 	Canonicalize           = 15
+	RequestAnonymous       = 16 // RFC 8062 section 3
 	DisableTransitedCheck  = 26
 	RenewableOK            = 27
 	EncTktInSkey           = 28
@@ -1,6 +1,8 @@
 // Package patype provides Kerberos 5 pre-authentication type assigned numbers.
 package patype
 
+import "fmt"
+
 // Kerberos pre-authentication type assigned numbers.
 const (
 	PA_TGS_REQ       int32 = 1
@@ -74,4 +76,45 @@ const (
 	//UNASSIGNED : 151-164
 	PA_SUPPORTED_ETYPES int32 = 165
 	PA_EXTENDED_ERROR   int32 = 166
+	PA_PAC_OPTIONS      int32 = 167
 )
+
+// Name returns a display name for the pre-authentication type, for example "PA-ENC-TIMESTAMP".
+func Name(i int32) string {
+	if s, ok := patypeNames[i]; ok {
+		return s
+	}
+	return fmt.Sprintf("PA-DATA %d", i)
+}
+
+var patypeNames = map[int32]string{
+	PA_TGS_REQ:             "PA-TGS-REQ",
+	PA_ENC_TIMESTAMP:       "PA-ENC-TIMESTAMP",
+	PA_PW_SALT:             "PA-PW-SALT",
+	PA_ETYPE_INFO:          "PA-ETYPE-INFO",
+	PA_PK_AS_REQ_OLD:       "PA-PK-AS-REQ_OLD",
+	PA_PK_AS_REP_OLD:       "PA-PK-AS-REP_OLD",
+	PA_PK_AS_REQ:           "PA-PK-AS-REQ",
+	PA_PK_AS_REP:           "PA-PK-AS-REP",
+	PA_ETYPE_INFO2:         "PA-ETYPE-INFO2",
+	PA_SVR_REFERRAL_INFO:   "PA-SVR-REFERRAL-INFO",
+	PA_GET_FROM_TYPED_DATA: "PA-GET-FROM-TYPED-DATA",
+	PA_SERVER_REFERRAL:     "PA-SERVER-REFERRAL",
+	PA_PAC_REQUEST:         "PA-PAC-REQUEST",
+	PA_FOR_USER:            "PA-FOR-USER",
+	PA_FOR_X509_USER:       "PA-FOR-X509-USER",
+	PA_AS_CHECKSUM:         "PA-AS-CHECKSUM",
+	PA_FX_COOKIE:           "PA-FX-COOKIE",
+	PA_AUTHENTICATION_SET:  "PA-AUTHENTICATION-SET",
+	PA_AUTH_SET_SELECTED:   "PA-AUTH-SET-SELECTED",
+	PA_FX_FAST:             "PA-FX-FAST",
+	PA_FX_ERROR:            "PA-FX-ERROR",
+	PA_ENCRYPTED_CHALLENGE: "PA-ENCRYPTED-CHALLENGE",
+	PA_OTP_CHALLENGE:       "PA-OTP-CHALLENGE",
+	PA_OTP_REQUEST:         "PA-OTP-REQUEST",
+	PA_REQ_ENC_PA_REP:      "PA-REQ-ENC-PA-REP",
+	PA_AS_FRESHNESS:        "PA-AS-FRESHNESS",
+	PA_SUPPORTED_ETYPES:    "PA-SUPPORTED-ETYPES",
+	PA_EXTENDED_ERROR:      "PA-EXTENDED-ERROR",
+	PA_PAC_OPTIONS:         "PA-PAC-OPTIONS",
+}
@@ -0,0 +1,450 @@
+// Package inspect decodes raw Kerberos 5 and SPNEGO messages, for example taken from packet captures or HTTP
+// Negotiate headers, into annotated values for troubleshooting.
+//
+// Encrypted parts of messages cannot be decoded without keys and are left as they are.
+package inspect
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Message type names.
+const (
+	TypeASReq        = "AS-REQ"
+	TypeASRep        = "AS-REP"
+	TypeTGSReq       = "TGS-REQ"
+	TypeTGSRep       = "TGS-REP"
+	TypeAPReq        = "AP-REQ"
+	TypeAPRep        = "AP-REP"
+	TypeKRBSafe      = "KRB-SAFE"
+	TypeKRBPriv      = "KRB-PRIV"
+	TypeKRBCred      = "KRB-CRED"
+	TypeKRBError     = "KRB-ERROR"
+	TypeTicket       = "Ticket"
+	TypeKRB5Token    = "GSS-API KRB5 token"
+	TypeNegTokenInit = "SPNEGO NegTokenInit"
+	TypeNegTokenResp = "SPNEGO NegTokenResp"
+)
+
+// Message is a decoded message.
+type Message struct {
+	// Type of the message, one of the Type constants.
+	Type string `json:"type"`
+	// Notes are human readable annotations of the message's fields, such as the names of encryption types.
+	Notes []string `json:"notes,omitempty"`
+	// Value is the message decoded into this library's type, for example a messages.ASReq.
+	Value interface{} `json:"value"`
+	// Inner holds messages carried within this message, such as the AP-REQ within a SPNEGO token.
+	Inner []*Message `json:"inner,omitempty"`
+}
+
+// JSON returns the message as indented JSON.
+func (m *Message) JSON() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+func (m *Message) note(format string, v ...interface{}) {
+	m.Notes = append(m.Notes, fmt.Sprintf(format, v...))
+}
+
+// Decode a raw Kerberos or SPNEGO message.
+//
+// The type of message is detected from its encoding. The four byte length prefix used when Kerberos messages are
+// sent over TCP is removed if present, so the payload of a captured TCP segment can be passed directly.
+func Decode(b []byte) (*Message, error) {
+	if len(b) < 2 {
+		return nil, errors.New("message too short to decode")
+	}
+	if len(b) > 4 && int(binary.BigEndian.Uint32(b[:4])) == len(b)-4 {
+		b = b[4:]
+	}
+	switch {
+	case b[0] == 0x60:
+		return decodeGSS(b)
+	case b[0] == 0xa0 || b[0] == 0xa1:
+		return decodeNegToken(b)
+	case b[0]&0xe0 == 0x60:
+		return decodeKRB(b)
+	}
+	return nil, fmt.Errorf("unrecognised message, leading byte 0x%02x", b[0])
+}
+
+// DecodeString decodes a message provided as hex or base64 encoded text.
+func DecodeString(s string) (*Message, error) {
+	s = strings.TrimSpace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		b, err = base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.New("message is neither hex nor base64 encoded")
+		}
+	}
+	return Decode(b)
+}
+
+// DecodeHTTPHeader decodes the SPNEGO token in the value of an HTTP Authorization or WWW-Authenticate header.
+// The value may include the "Negotiate" scheme prefix.
+func DecodeHTTPHeader(v string) (*Message, error) {
+	v = strings.TrimSpace(v)
+	if i := strings.IndexByte(v, ' '); i > 0 && strings.EqualFold(v[:i], spnego.HTTPHeaderAuthResponseValueKey) {
+		v = strings.TrimSpace(v[i+1:])
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("could not base64 decode header value: %w", err)
+	}
+	return Decode(b)
+}
+
+func decodeGSS(b []byte) (*Message, error) {
+	var oid asn1.ObjectIdentifier
+	_, err := asn1.UnmarshalWithParams(b, &oid, fmt.Sprintf("application,explicit,tag:%v", 0))
+	if err != nil {
+		return nil, fmt.Errorf("not a valid GSS-API token: %w", err)
+	}
+	switch {
+	case oid.Equal(gssapi.OIDSPNEGO.OID()):
+		var t spnego.SPNEGOToken
+		err = t.Unmarshal(b)
+		if err != nil {
+			return nil, err
+		}
+		if t.Init {
+			return negTokenInit(t.NegTokenInit), nil
+		}
+		return negTokenResp(t.NegTokenResp), nil
+	case oid.Equal(gssapi.OIDKRB5.OID()), oid.Equal(gssapi.OIDMSLegacyKRB5.OID()):
+		return decodeKRB5Token(b)
+	}
+	return nil, fmt.Errorf("unsupported GSS-API mechanism %s", oid.String())
+}
+
+func decodeNegToken(b []byte) (*Message, error) {
+	init, nt, err := spnego.UnmarshalNegToken(b)
+	if err != nil {
+		return nil, err
+	}
+	if init {
+		return negTokenInit(nt.(spnego.NegTokenInit)), nil
+	}
+	return negTokenResp(nt.(spnego.NegTokenResp)), nil
+}
+
+func negTokenInit(n spnego.NegTokenInit) *Message {
+	m := &Message{Type: TypeNegTokenInit, Value: n}
+	for _, oid := range n.MechTypes {
+		m.note("mechanism offered: %s", mechName(oid))
+	}
+	m.inner(n.MechTokenBytes)
+	return m
+}
+
+func negTokenResp(n spnego.NegTokenResp) *Message {
+	m := &Message{Type: TypeNegTokenResp, Value: n}
+	m.note("negotiation state: %s", negStateName(n.NegState))
+	if len(n.SupportedMech) > 0 {
+		m.note("mechanism selected: %s", mechName(n.SupportedMech))
+	}
+	m.inner(n.ResponseToken)
+	return m
+}
+
+// inner decodes a token carried within m. A token that cannot be decoded is noted rather than failing the outer
+// message as it may be for a mechanism other than Kerberos.
+func (m *Message) inner(b []byte) {
+	if len(b) < 1 {
+		return
+	}
+	i, err := Decode(b)
+	if err != nil {
+		m.note("could not decode mechanism token: %v", err)
+		return
+	}
+	m.Inner = append(m.Inner, i)
+}
+
+func decodeKRB5Token(b []byte) (*Message, error) {
+	var t spnego.KRB5Token
+	err := t.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	m := &Message{Type: TypeKRB5Token, Value: t}
+	switch {
+	case t.IsAPReq():
+		m.Inner = append(m.Inner, apReq(t.APReq))
+	case t.IsAPRep():
+		m.Inner = append(m.Inner, apRep(t.APRep))
+	case t.IsKRBError():
+		m.Inner = append(m.Inner, krbError(t.KRBError))
+	default:
+		m.note("unsupported KRB5 token type")
+	}
+	return m, nil
+}
+
+func decodeKRB(b []byte) (*Message, error) {
+	var err error
+	switch int(b[0] & 0x1f) {
+	case asnAppTag.ASREQ:
+		var k messages.ASReq
+		if err = k.Unmarshal(b); err == nil {
+			return kdcReq(TypeASReq, k, k.KDCReqFields), nil
+		}
+	case asnAppTag.TGSREQ:
+		var k messages.TGSReq
+		if err = k.Unmarshal(b); err == nil {
+			return kdcReq(TypeTGSReq, k, k.KDCReqFields), nil
+		}
+	case asnAppTag.ASREP:
+		var k messages.ASRep
+		if err = k.Unmarshal(b); err == nil {
+			return kdcRep(TypeASRep, k, k.KDCRepFields), nil
+		}
+	case asnAppTag.TGSREP:
+		var k messages.TGSRep
+		if err = k.Unmarshal(b); err == nil {
+			return kdcRep(TypeTGSRep, k, k.KDCRepFields), nil
+		}
+	case asnAppTag.APREQ:
+		var k messages.APReq
+		if err = k.Unmarshal(b); err == nil {
+			return apReq(k), nil
+		}
+	case asnAppTag.APREP:
+		var k messages.APRep
+		if err = k.Unmarshal(b); err == nil {
+			return apRep(k), nil
+		}
+	case asnAppTag.KRBSafe:
+		var k messages.KRBSafe
+		if err = k.Unmarshal(b); err == nil {
+			return &Message{Type: TypeKRBSafe, Value: k}, nil
+		}
+	case asnAppTag.KRBPriv:
+		var k messages.KRBPriv
+		if err = k.Unmarshal(b); err == nil {
+			m := &Message{Type: TypeKRBPriv, Value: k}
+			m.encPart("enc-part", k.EncPart)
+			return m, nil
+		}
+	case asnAppTag.KRBCred:
+		var k messages.KRBCred
+		if err = k.Unmarshal(b); err == nil {
+			m := &Message{Type: TypeKRBCred, Value: k}
+			for _, t := range k.Tickets {
+				m.ticket(t)
+			}
+			m.encPart("enc-part", k.EncPart)
+			return m, nil
+		}
+	case asnAppTag.KRBError:
+		var k messages.KRBError
+		if err = k.Unmarshal(b); err == nil {
+			return krbError(k), nil
+		}
+	case asnAppTag.Ticket:
+		var k messages.Ticket
+		if err = k.Unmarshal(b); err == nil {
+			m := &Message{Type: TypeTicket, Value: k}
+			m.ticket(k)
+			return m, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ASN.1 application tag %d", b[0]&0x1f)
+	}
+	return nil, err
+}
+
+func kdcReq(typ string, v interface{}, k messages.KDCReqFields) *Message {
+	m := &Message{Type: typ, Value: v}
+	m.paData(k.PAData)
+	if opts := bitNames(k.ReqBody.KDCOptions, kdcOptionNames); len(opts) > 0 {
+		m.note("kdc-options: %s", strings.Join(opts, ", "))
+	}
+	if len(k.ReqBody.CName.NameString) > 0 {
+		m.note("client: %s@%s", k.ReqBody.CName.PrincipalNameString(), k.ReqBody.Realm)
+	}
+	if len(k.ReqBody.SName.NameString) > 0 {
+		m.note("server: %s@%s", k.ReqBody.SName.PrincipalNameString(), k.ReqBody.Realm)
+	}
+	for _, e := range k.ReqBody.EType {
+		m.note("etype requested: %s", etypeName(e))
+	}
+	for _, t := range k.ReqBody.AdditionalTickets {
+		m.ticket(t)
+	}
+	return m
+}
+
+func kdcRep(typ string, v interface{}, k messages.KDCRepFields) *Message {
+	m := &Message{Type: typ, Value: v}
+	m.paData(k.PAData)
+	m.note("client: %s@%s", k.CName.PrincipalNameString(), k.CRealm)
+	m.ticket(k.Ticket)
+	m.encPart("enc-part", k.EncPart)
+	return m
+}
+
+func apReq(k messages.APReq) *Message {
+	m := &Message{Type: TypeAPReq, Value: k}
+	if opts := bitNames(k.APOptions, apOptionNames); len(opts) > 0 {
+		m.note("ap-options: %s", strings.Join(opts, ", "))
+	}
+	m.ticket(k.Ticket)
+	m.encPart("authenticator", k.EncryptedAuthenticator)
+	return m
+}
+
+func apRep(k messages.APRep) *Message {
+	m := &Message{Type: TypeAPRep, Value: k}
+	m.encPart("enc-part", k.EncPart)
+	return m
+}
+
+func krbError(k messages.KRBError) *Message {
+	m := &Message{Type: TypeKRBError, Value: k}
+	m.note("error: %s", errorcode.Lookup(k.ErrorCode))
+	if k.EText != "" {
+		m.note("e-text: %s", k.EText)
+	}
+	m.note("server: %s@%s", k.SName.PrincipalNameString(), k.Realm)
+	if len(k.EData) > 0 {
+		// KDC_ERR_PREAUTH_REQUIRED and similar errors carry METHOD-DATA describing the pre-authentication expected.
+		if md, err := k.MethodData(); err == nil {
+			m.paData(md)
+		}
+	}
+	return m
+}
+
+func (m *Message) ticket(t messages.Ticket) {
+	m.note("ticket: %s@%s", t.SName.PrincipalNameString(), t.Realm)
+	m.encPart("ticket enc-part", t.EncPart)
+}
+
+func (m *Message) encPart(name string, e types.EncryptedData) {
+	if e.KVNO != 0 {
+		m.note("%s: %s kvno %d", name, etypeName(e.EType), e.KVNO)
+		return
+	}
+	m.note("%s: %s", name, etypeName(e.EType))
+}
+
+func (m *Message) paData(pas []types.PAData) {
+	for _, pa := range pas {
+		m.note("padata: %s (%d)", patype.Name(pa.PADataType), pa.PADataType)
+		switch pa.PADataType {
+		case patype.PA_ETYPE_INFO2:
+			var et2 types.ETypeInfo2
+			if et2.Unmarshal(pa.PADataValue) == nil {
+				for _, e := range et2 {
+					m.note("etype-info2: %s salt %q", etypeName(e.EType), e.Salt)
+				}
+			}
+		case patype.PA_ETYPE_INFO:
+			var et types.ETypeInfo
+			if et.Unmarshal(pa.PADataValue) == nil {
+				for _, e := range et {
+					m.note("etype-info: %s salt %q", etypeName(e.EType), e.Salt)
+				}
+			}
+		case patype.PA_ENC_TIMESTAMP:
+			var ts types.PAEncTimestamp
+			if _, err := asn1.Unmarshal(pa.PADataValue, &ts); err == nil {
+				m.encPart("encrypted timestamp", types.EncryptedData(ts))
+			}
+		case patype.PA_TGS_REQ:
+			var a messages.APReq
+			if a.Unmarshal(pa.PADataValue) == nil {
+				m.Inner = append(m.Inner, apReq(a))
+			}
+		}
+	}
+}
+
+var kdcOptionNames = map[int]string{
+	1:  "forwardable",
+	2:  "forwarded",
+	3:  "proxiable",
+	4:  "proxy",
+	5:  "allow-postdate",
+	6:  "postdated",
+	8:  "renewable",
+	11: "opt-hardware-auth",
+	14: "constrained-delegation",
+	15: "canonicalize",
+	16: "request-anonymous",
+	26: "disable-transited-check",
+	27: "renewable-ok",
+	28: "enc-tkt-in-skey",
+	30: "renew",
+	31: "validate",
+}
+
+var apOptionNames = map[int]string{
+	1: "use-session-key",
+	2: "mutual-required",
+}
+
+func bitNames(b asn1.BitString, names map[int]string) []string {
+	var s []string
+	for i := 0; i < b.BitLength; i++ {
+		if b.At(i) != 1 {
+			continue
+		}
+		if n, ok := names[i]; ok {
+			s = append(s, n)
+		} else {
+			s = append(s, fmt.Sprintf("bit %d", i))
+		}
+	}
+	return s
+}
+
+func etypeName(id int32) string {
+	n := etypeID.Name(id)
+	if n == fmt.Sprintf("etype %d", id) {
+		return n
+	}
+	return fmt.Sprintf("%s (%d)", n, id)
+}
+
+func mechName(oid asn1.ObjectIdentifier) string {
+	for _, n := range []gssapi.OIDName{gssapi.OIDKRB5, gssapi.OIDMSLegacyKRB5, gssapi.OIDSPNEGO, gssapi.OIDGSSIAKerb} {
+		if oid.Equal(n.OID()) {
+			return fmt.Sprintf("%s (%s)", n, oid.String())
+		}
+	}
+	return oid.String()
+}
+
+func negStateName(s asn1.Enumerated) string {
+	switch spnego.NegState(s) {
+	case spnego.NegStateAcceptCompleted:
+		return "accept-completed"
+	case spnego.NegStateAcceptIncomplete:
+		return "accept-incomplete"
+	case spnego.NegStateReject:
+		return "reject"
+	case spnego.NegStateRequestMIC:
+		return "request-mic"
+	}
+	return fmt.Sprintf("unknown (%d)", s)
+}
@@ -0,0 +1,140 @@
+package inspect
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+const testGSSAPIResp = "a1143012a0030a0100a10b06092a864886f712010202"
+
+func testSPNEGOInit(t *testing.T) []byte {
+	apreq, err := hex.DecodeString(testdata.MarshaledKRB5ap_req)
+	if err != nil {
+		t.Fatalf("Error converting hex string test data to bytes: %v", err)
+	}
+	oid, _ := asn1.Marshal(gssapi.OIDKRB5.OID())
+	mt := append(oid, 0x01, 0x00)
+	mt = asn1tools.AddASNAppTag(append(mt, apreq...), 0)
+	tkn := spnego.SPNEGOToken{
+		Init: true,
+		NegTokenInit: spnego.NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
+			MechTokenBytes: mt,
+		},
+	}
+	b, err := tkn.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling SPNEGO token: %v", err)
+	}
+	return b
+}
+
+func TestDecode_KRB(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		vector string
+		typ    string
+		note   string
+	}{
+		{testdata.MarshaledKRB5as_req, TypeASReq, "padata: PA-DATA 13 (13)"},
+		{testdata.MarshaledKRB5as_rep, TypeASRep, "client: hftsai/extra@ATHENA.MIT.EDU"},
+		{testdata.MarshaledKRB5tgs_req, TypeTGSReq, "server: hftsai/extra@ATHENA.MIT.EDU"},
+		{testdata.MarshaledKRB5tgs_rep, TypeTGSRep, "ticket: hftsai/extra@ATHENA.MIT.EDU"},
+		{testdata.MarshaledKRB5ap_req, TypeAPReq, "ticket enc-part: etype 0 kvno 5"},
+		{testdata.MarshaledKRB5ap_rep, TypeAPRep, "enc-part: etype 0 kvno 5"},
+		{testdata.MarshaledKRB5error, TypeKRBError, "error: (60) KRB_ERR_GENERIC Generic error (description in e-text)"},
+		{testdata.MarshaledKRB5ticket, TypeTicket, "ticket: hftsai/extra@ATHENA.MIT.EDU"},
+		{testdata.MarshaledKRB5priv, TypeKRBPriv, "enc-part: etype 0 kvno 5"},
+		{testdata.MarshaledKRB5cred, TypeKRBCred, "ticket: hftsai/extra@ATHENA.MIT.EDU"},
+		{testdata.MarshaledKRB5safe, TypeKRBSafe, ""},
+	}
+	for _, test := range tests {
+		b, err := hex.DecodeString(test.vector)
+		if err != nil {
+			t.Fatalf("Error converting hex string test data to bytes: %v", err)
+		}
+		m, err := Decode(b)
+		if err != nil {
+			t.Errorf("Error decoding %s: %v", test.typ, err)
+			continue
+		}
+		assert.Equal(t, test.typ, m.Type, "message type not as expected")
+		if test.note != "" {
+			assert.Contains(t, m.Notes, test.note, "%s notes not as expected", test.typ)
+		}
+		_, err = m.JSON()
+		assert.NoError(t, err, "%s could not be marshaled to JSON", test.typ)
+	}
+}
+
+func TestDecode_TCPLengthPrefix(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.MarshaledKRB5as_req)
+	l := make([]byte, 4)
+	binary.BigEndian.PutUint32(l, uint32(len(b)))
+	m, err := Decode(append(l, b...))
+	if err != nil {
+		t.Fatalf("Error decoding: %v", err)
+	}
+	assert.Equal(t, TypeASReq, m.Type, "message type not as expected")
+	assert.IsType(t, messages.ASReq{}, m.Value, "value type not as expected")
+}
+
+func TestDecodeHTTPHeader(t *testing.T) {
+	t.Parallel()
+	b := testSPNEGOInit(t)
+	m, err := DecodeHTTPHeader("Negotiate " + base64.StdEncoding.EncodeToString(b))
+	if err != nil {
+		t.Fatalf("Error decoding header: %v", err)
+	}
+	assert.Equal(t, TypeNegTokenInit, m.Type, "message type not as expected")
+	assert.Contains(t, m.Notes, "mechanism offered: KRB5 (1.2.840.113554.1.2.2)")
+	if assert.Len(t, m.Inner, 1, "mechanism token not decoded") {
+		assert.Equal(t, TypeKRB5Token, m.Inner[0].Type, "mechanism token type not as expected")
+		if assert.Len(t, m.Inner[0].Inner, 1, "AP_REQ not decoded") {
+			assert.Equal(t, TypeAPReq, m.Inner[0].Inner[0].Type, "inner message type not as expected")
+		}
+	}
+	_, err = m.JSON()
+	assert.NoError(t, err, "could not be marshaled to JSON")
+
+	b, _ = hex.DecodeString(testGSSAPIResp)
+	m, err = DecodeHTTPHeader(base64.StdEncoding.EncodeToString(b))
+	if err != nil {
+		t.Fatalf("Error decoding header: %v", err)
+	}
+	assert.Equal(t, TypeNegTokenResp, m.Type, "message type not as expected")
+	assert.Contains(t, m.Notes, "negotiation state: accept-completed")
+
+	_, err = DecodeHTTPHeader("Negotiate !!!")
+	assert.Error(t, err, "expected error for invalid base64")
+}
+
+func TestDecodeString(t *testing.T) {
+	t.Parallel()
+	m, err := DecodeString(testdata.MarshaledKRB5error)
+	if err != nil {
+		t.Fatalf("Error decoding hex: %v", err)
+	}
+	assert.Equal(t, TypeKRBError, m.Type, "message type not as expected")
+	b, _ := hex.DecodeString(testdata.MarshaledKRB5ap_rep)
+	m, err = DecodeString(base64.StdEncoding.EncodeToString(b))
+	if err != nil {
+		t.Fatalf("Error decoding base64: %v", err)
+	}
+	assert.Equal(t, TypeAPRep, m.Type, "message type not as expected")
+	_, err = DecodeString("not a message")
+	assert.Error(t, err, "expected error")
+	_, err = Decode([]byte{0x30, 0x00})
+	assert.Error(t, err, "expected error for unrecognised message")
+}
@@ -0,0 +1,40 @@
+package camellia
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCipher(t *testing.T) {
+	t.Parallel()
+	// RFC 3713 Appendix A
+	var tests = []struct {
+		key string
+		ct  string
+	}{
+		{"0123456789abcdeffedcba9876543210", "67673138549669730857065648eabe43"},
+		{"0123456789abcdeffedcba98765432100011223344556677", "b4993401b3e996f84ee5cee7d79b09b9"},
+		{"0123456789abcdeffedcba987654321000112233445566778899aabbccddeeff", "9acc237dff16d76c20ef7c919e3a7509"},
+	}
+	pt, _ := hex.DecodeString("0123456789abcdeffedcba9876543210")
+	for _, test := range tests {
+		key, _ := hex.DecodeString(test.key)
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatalf("error creating cipher: %v", err)
+		}
+		b := make([]byte, BlockSize)
+		c.Encrypt(b, pt)
+		assert.Equal(t, test.ct, hex.EncodeToString(b), "ciphertext not as expected for %d byte key", len(key))
+		c.Decrypt(b, b)
+		assert.Equal(t, pt, b, "decrypted block not as expected for %d byte key", len(key))
+	}
+}
+
+func TestNewCipher_KeySize(t *testing.T) {
+	t.Parallel()
+	_, err := NewCipher(make([]byte, 20))
+	assert.Equal(t, KeySizeError(20), err, "key size error expected")
+}
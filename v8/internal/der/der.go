@@ -0,0 +1,425 @@
+// Package der encodes and decodes the ASN.1 DER of the Kerberos structures on the hot paths of the exchanges without
+// the reflection of the asn1 package.
+//
+// A Builder writes an encoding from its end backwards into a pooled buffer, so that the length of each value is known
+// when its header is written and the encoding is copied out with a single allocation. A Parser accepts only the
+// strict DER forms a Builder produces. When it reports false the caller falls back to the asn1 package, which decodes
+// the other forms it accepts and reports the errors, so the results are the same as if the asn1 package were used.
+package der
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+const (
+	initialBufferSize = 1024
+	// Builders whose buffers have grown beyond this size are not returned to the pool.
+	maxPooledBufferSize   = 64 * 1024
+	generalizedTimeFormat = "20060102150405Z0700"
+)
+
+// Builder encodes a DER value from its end backwards. The value's last element is added first and each constructed
+// value is wrapped with its header once its contents have been added.
+type Builder struct {
+	buf []byte
+	off int
+}
+
+var builders = sync.Pool{
+	New: func() interface{} {
+		return &Builder{buf: make([]byte, initialBufferSize)}
+	},
+}
+
+// NewBuilder returns an empty Builder from the pool. Release should be called once the encoding has been copied out.
+func NewBuilder() *Builder {
+	b := builders.Get().(*Builder)
+	b.off = len(b.buf)
+	return b
+}
+
+// Release returns the Builder to the pool.
+func (b *Builder) Release() {
+	if len(b.buf) <= maxPooledBufferSize {
+		builders.Put(b)
+	}
+}
+
+// Len returns the number of bytes added. It marks the end of a value whose contents are to be added before it is
+// wrapped with Wrap.
+func (b *Builder) Len() int {
+	return len(b.buf) - b.off
+}
+
+// Truncate discards the bytes added since Len returned n.
+func (b *Builder) Truncate(n int) {
+	b.off = len(b.buf) - n
+}
+
+// Bytes returns a copy of the encoding.
+func (b *Builder) Bytes() []byte {
+	out := make([]byte, b.Len())
+	copy(out, b.buf[b.off:])
+	return out
+}
+
+// reserve makes room for n bytes in front of the encoding and returns the slice to write them to.
+func (b *Builder) reserve(n int) []byte {
+	if b.off < n {
+		l := b.Len()
+		size := 2 * len(b.buf)
+		if size < l+n {
+			size = l + n
+		}
+		buf := make([]byte, size)
+		copy(buf[size-l:], b.buf[b.off:])
+		b.buf = buf
+		b.off = size - l
+	}
+	b.off -= n
+	return b.buf[b.off : b.off+n]
+}
+
+// AddBytes adds the bytes to the front of the encoding.
+func (b *Builder) AddBytes(p []byte) {
+	copy(b.reserve(len(p)), p)
+}
+
+// addString adds the string's bytes to the front of the encoding.
+func (b *Builder) addString(s string) {
+	copy(b.reserve(len(s)), s)
+}
+
+// Wrap adds the header of a value of the class and tag whose contents are the bytes added since mark.
+func (b *Builder) Wrap(class, tag int, compound bool, mark int) {
+	l := b.Len() - mark
+	if l < 128 {
+		b.reserve(1)[0] = byte(l)
+	} else {
+		var n int
+		for i := l; i > 0; i >>= 8 {
+			n++
+		}
+		p := b.reserve(n + 1)
+		p[0] = 0x80 | byte(n)
+		for i := n; i > 0; i-- {
+			p[i] = byte(l)
+			l >>= 8
+		}
+	}
+	id := byte(class) << 6
+	if compound {
+		id |= 0x20
+	}
+	if tag < 31 {
+		b.reserve(1)[0] = id | byte(tag)
+		return
+	}
+	var n int
+	for i := tag; i > 0; i >>= 7 {
+		n++
+	}
+	p := b.reserve(n + 1)
+	p[0] = id | 0x1f
+	for i := n; i > 0; i-- {
+		p[i] = byte(tag & 0x7f)
+		if i < n {
+			p[i] |= 0x80
+		}
+		tag >>= 7
+	}
+}
+
+// Explicit wraps the bytes added since mark in an explicit context specific tag.
+func (b *Builder) Explicit(tag, mark int) {
+	b.Wrap(asn1.ClassContextSpecific, tag, true, mark)
+}
+
+// Sequence wraps the bytes added since mark in a SEQUENCE.
+func (b *Builder) Sequence(mark int) {
+	b.Wrap(asn1.ClassUniversal, asn1.TagSequence, true, mark)
+}
+
+// AddInteger adds an INTEGER.
+func (b *Builder) AddInteger(v int64) {
+	n := 1
+	for i := v; i > 127 || i < -128; i >>= 8 {
+		n++
+	}
+	p := b.reserve(n)
+	for i := n - 1; i >= 0; i-- {
+		p[i] = byte(v)
+		v >>= 8
+	}
+	b.Wrap(asn1.ClassUniversal, asn1.TagInteger, false, b.Len()-n)
+}
+
+// AddOctetString adds an OCTET STRING.
+func (b *Builder) AddOctetString(p []byte) {
+	m := b.Len()
+	b.AddBytes(p)
+	b.Wrap(asn1.ClassUniversal, asn1.TagOctetString, false, m)
+}
+
+// AddGeneralString adds a GeneralString.
+func (b *Builder) AddGeneralString(s string) {
+	m := b.Len()
+	b.addString(s)
+	b.Wrap(asn1.ClassUniversal, asn1.TagGeneralString, false, m)
+}
+
+// AddBitString adds a BIT STRING.
+func (b *Builder) AddBitString(s asn1.BitString) {
+	m := b.Len()
+	b.AddBytes(s.Bytes)
+	b.reserve(1)[0] = byte((8 - s.BitLength%8) % 8)
+	b.Wrap(asn1.ClassUniversal, asn1.TagBitString, false, m)
+}
+
+// AddGeneralizedTime adds a GeneralizedTime, returning false if the time is not in UTC or its year cannot be
+// represented.
+func (b *Builder) AddGeneralizedTime(t time.Time) bool {
+	if _, offset := t.Zone(); offset/60 != 0 || t.Year() < 0 || t.Year() > 9999 {
+		return false
+	}
+	m := b.Len()
+	p := b.reserve(len(generalizedTimeFormat) - 4)
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	for i, v := range [...]int{year / 100, year % 100, int(month), day, hour, min, sec} {
+		p[2*i] = byte('0' + v/10)
+		p[2*i+1] = byte('0' + v%10)
+	}
+	p[14] = 'Z'
+	b.Wrap(asn1.ClassUniversal, asn1.TagGeneralizedTime, false, m)
+	return true
+}
+
+// Parser decodes the DER elements of its bytes in turn. Once a method has reported false the elements that remain are
+// undefined and the bytes should be decoded with the asn1 package instead.
+type Parser []byte
+
+// Empty reports whether all of the elements have been read.
+func (p Parser) Empty() bool {
+	return len(p) == 0
+}
+
+// header returns the identifier and length of the next element and the length of its header. Only single byte
+// identifiers and minimally encoded definite lengths are accepted.
+func (p Parser) header() (id byte, l, hl int, ok bool) {
+	if len(p) < 2 || p[0]&0x1f == 0x1f {
+		return
+	}
+	id = p[0]
+	if p[1] < 0x80 {
+		l, hl = int(p[1]), 2
+	} else {
+		n := int(p[1] & 0x7f)
+		if n < 1 || n > 4 || len(p) < 2+n || p[2] == 0 {
+			return
+		}
+		for _, c := range p[2 : 2+n] {
+			l = l<<8 | int(c)
+		}
+		if l < 128 {
+			return
+		}
+		hl = 2 + n
+	}
+	if l > len(p)-hl {
+		return
+	}
+	return id, l, hl, true
+}
+
+// Count returns the number of elements, reporting false if the header of one of them cannot be read.
+func (p Parser) Count() (int, bool) {
+	var n int
+	for ; !p.Empty(); n++ {
+		_, l, hl, ok := p.header()
+		if !ok {
+			return 0, false
+		}
+		p = p[hl+l:]
+	}
+	return n, true
+}
+
+// Peek reports whether the next element is of the class and tag.
+func (p Parser) Peek(class, tag int) bool {
+	return len(p) > 0 && p[0]&0xdf == byte(class)<<6|byte(tag)
+}
+
+// ReadFull reads the next element, which must be of the class and tag, returning the whole element and its contents.
+func (p *Parser) ReadFull(class, tag int, compound bool) (full []byte, contents Parser, ok bool) {
+	id, l, hl, ok := p.header()
+	want := byte(class)<<6 | byte(tag)
+	if compound {
+		want |= 0x20
+	}
+	if !ok || tag >= 31 || id != want {
+		return nil, nil, false
+	}
+	full = (*p)[:hl+l]
+	contents = (*p)[hl : hl+l]
+	*p = (*p)[hl+l:]
+	return full, contents, true
+}
+
+// Read reads the next element, which must be of the class and tag, returning its contents.
+func (p *Parser) Read(class, tag int, compound bool) (Parser, bool) {
+	_, c, ok := p.ReadFull(class, tag, compound)
+	return c, ok
+}
+
+// Explicit reads the contents of the next element, which must have the explicit context specific tag.
+func (p *Parser) Explicit(tag int) (Parser, bool) {
+	return p.Read(asn1.ClassContextSpecific, tag, true)
+}
+
+// Sequence reads the contents of the next element, which must be a SEQUENCE.
+func (p *Parser) Sequence() (Parser, bool) {
+	return p.Read(asn1.ClassUniversal, asn1.TagSequence, true)
+}
+
+// ReadInt64 reads a minimally encoded INTEGER that fits in an int64.
+func (p *Parser) ReadInt64() (int64, bool) {
+	c, ok := p.Read(asn1.ClassUniversal, asn1.TagInteger, false)
+	if !ok || len(c) < 1 || len(c) > 8 {
+		return 0, false
+	}
+	if len(c) > 1 && (c[0] == 0 && c[1]&0x80 == 0 || c[0] == 0xff && c[1]&0x80 == 0x80) {
+		return 0, false
+	}
+	v := int64(int8(c[0]))
+	for _, b := range c[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, true
+}
+
+// ReadInt32 reads an INTEGER that fits in an int32.
+func (p *Parser) ReadInt32() (int32, bool) {
+	v, ok := p.ReadInt64()
+	if !ok || v != int64(int32(v)) {
+		return 0, false
+	}
+	return int32(v), true
+}
+
+// ReadInt reads an INTEGER that fits in an int.
+func (p *Parser) ReadInt() (int, bool) {
+	v, ok := p.ReadInt64()
+	if !ok || strconv.IntSize == 32 && v != int64(int32(v)) {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// ReadOctetString reads an OCTET STRING, returning a copy of its bytes.
+func (p *Parser) ReadOctetString() ([]byte, bool) {
+	c, ok := p.Read(asn1.ClassUniversal, asn1.TagOctetString, false)
+	if !ok {
+		return nil, false
+	}
+	return append(make([]byte, 0, len(c)), c...), true
+}
+
+// ReadGeneralString reads a GeneralString.
+func (p *Parser) ReadGeneralString() (string, bool) {
+	c, ok := p.Read(asn1.ClassUniversal, asn1.TagGeneralString, false)
+	if !ok {
+		return "", false
+	}
+	return string(c), true
+}
+
+// ReadBitString reads a BIT STRING. The bytes of the BitString returned share those of the Parser.
+func (p *Parser) ReadBitString() (asn1.BitString, bool) {
+	c, ok := p.Read(asn1.ClassUniversal, asn1.TagBitString, false)
+	if !ok || len(c) < 1 {
+		return asn1.BitString{}, false
+	}
+	pad := int(c[0])
+	if pad > 7 || len(c) == 1 && pad > 0 || c[len(c)-1]&(1<<uint(pad)-1) != 0 {
+		return asn1.BitString{}, false
+	}
+	return asn1.BitString{Bytes: c[1:], BitLength: (len(c)-1)*8 - pad}, true
+}
+
+// ReadGeneralizedTime reads a GeneralizedTime.
+func (p *Parser) ReadGeneralizedTime() (time.Time, bool) {
+	c, ok := p.Read(asn1.ClassUniversal, asn1.TagGeneralizedTime, false)
+	if !ok {
+		return time.Time{}, false
+	}
+	s := string(c)
+	t, err := time.Parse(generalizedTimeFormat, s)
+	if err != nil || t.Format(generalizedTimeFormat) != s {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ExplicitInt64 reads an INTEGER with the explicit context specific tag.
+func (p *Parser) ExplicitInt64(tag int) (int64, bool) {
+	c, ok := p.Explicit(tag)
+	if !ok {
+		return 0, false
+	}
+	v, ok := c.ReadInt64()
+	return v, ok && c.Empty()
+}
+
+// ExplicitInt32 reads an INTEGER that fits in an int32 with the explicit context specific tag.
+func (p *Parser) ExplicitInt32(tag int) (int32, bool) {
+	v, ok := p.ExplicitInt64(tag)
+	if !ok || v != int64(int32(v)) {
+		return 0, false
+	}
+	return int32(v), true
+}
+
+// ExplicitInt reads an INTEGER that fits in an int with the explicit context specific tag.
+func (p *Parser) ExplicitInt(tag int) (int, bool) {
+	c, ok := p.Explicit(tag)
+	if !ok {
+		return 0, false
+	}
+	v, ok := c.ReadInt()
+	return v, ok && c.Empty()
+}
+
+// ExplicitGeneralString reads a GeneralString with the explicit context specific tag.
+func (p *Parser) ExplicitGeneralString(tag int) (string, bool) {
+	c, ok := p.Explicit(tag)
+	if !ok {
+		return "", false
+	}
+	v, ok := c.ReadGeneralString()
+	return v, ok && c.Empty()
+}
+
+// ExplicitBitString reads a BIT STRING with the explicit context specific tag.
+func (p *Parser) ExplicitBitString(tag int) (asn1.BitString, bool) {
+	c, ok := p.Explicit(tag)
+	if !ok {
+		return asn1.BitString{}, false
+	}
+	v, ok := c.ReadBitString()
+	return v, ok && c.Empty()
+}
+
+// ExplicitGeneralizedTime reads a GeneralizedTime with the explicit context specific tag.
+func (p *Parser) ExplicitGeneralizedTime(tag int) (time.Time, bool) {
+	c, ok := p.Explicit(tag)
+	if !ok {
+		return time.Time{}, false
+	}
+	v, ok := c.ReadGeneralizedTime()
+	return v, ok && c.Empty()
+}
@@ -0,0 +1,188 @@
+package der
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+func build(f func(b *Builder)) []byte {
+	b := NewBuilder()
+	defer b.Release()
+	f(b)
+	return b.Bytes()
+}
+
+func TestBuilder_Integer(t *testing.T) {
+	t.Parallel()
+	for _, v := range []int64{0, 1, -1, 127, 128, -128, -129, 255, 256, 32767, 32768, -32769, math.MaxInt32, math.MinInt32,
+		math.MaxInt64, math.MinInt64} {
+		want, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatalf("error marshaling %d: %v", v, err)
+		}
+		b := build(func(b *Builder) { b.AddInteger(v) })
+		assert.Equal(t, want, b, "encoding of %d not as expected", v)
+		p := Parser(b)
+		i, ok := p.ReadInt64()
+		assert.True(t, ok, "integer %d not read", v)
+		assert.Equal(t, v, i, "integer read not as expected")
+		assert.True(t, p.Empty(), "bytes remain after reading integer")
+	}
+}
+
+func TestBuilder_Lengths(t *testing.T) {
+	t.Parallel()
+	for _, l := range []int{0, 1, 127, 128, 255, 256, 65535, 65536, 70000} {
+		v := bytes.Repeat([]byte{0x5a}, l)
+		want, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatalf("error marshaling octet string of length %d: %v", l, err)
+		}
+		b := build(func(b *Builder) { b.AddOctetString(v) })
+		assert.Equal(t, want, b, "encoding of octet string of length %d not as expected", l)
+		p := Parser(b)
+		o, ok := p.ReadOctetString()
+		assert.True(t, ok, "octet string of length %d not read", l)
+		assert.Equal(t, v, o, "octet string read not as expected")
+	}
+}
+
+func TestBuilder_Strings(t *testing.T) {
+	t.Parallel()
+	v := struct {
+		S  string   `asn1:"generalstring"`
+		N  []string `asn1:"generalstring"`
+		B  asn1.BitString
+		T  time.Time `asn1:"generalized"`
+		B2 asn1.BitString
+	}{
+		S:  "EXAMPLE.COM",
+		N:  []string{"HTTP", "host.example.com"},
+		B:  asn1.BitString{Bytes: []byte{0x50, 0x80, 0x00, 0x00}, BitLength: 32},
+		T:  time.Date(2026, 10, 14, 9, 5, 1, 0, time.UTC),
+		B2: asn1.BitString{Bytes: []byte{0xe0}, BitLength: 3},
+	}
+	want, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatalf("error marshaling: %v", err)
+	}
+	b := build(func(b *Builder) {
+		m := b.Len()
+		b.AddBitString(v.B2)
+		assert.True(t, b.AddGeneralizedTime(v.T), "time not added")
+		b.AddBitString(v.B)
+		e := b.Len()
+		for i := len(v.N) - 1; i >= 0; i-- {
+			b.AddGeneralString(v.N[i])
+		}
+		b.Sequence(e)
+		b.AddGeneralString(v.S)
+		b.Sequence(m)
+	})
+	assert.Equal(t, want, b, "encoding not as expected")
+
+	p := Parser(b)
+	s, ok := p.Sequence()
+	assert.True(t, ok, "sequence not read")
+	str, ok := s.ReadGeneralString()
+	assert.True(t, ok, "general string not read")
+	assert.Equal(t, v.S, str, "general string not as expected")
+	n, ok := s.Sequence()
+	assert.True(t, ok, "sequence of strings not read")
+	c, ok := n.Count()
+	assert.True(t, ok, "elements not counted")
+	assert.Equal(t, 2, c, "count not as expected")
+	bs, ok := s.ReadBitString()
+	assert.True(t, ok, "bit string not read")
+	assert.Equal(t, v.B, bs, "bit string not as expected")
+	tm, ok := s.ReadGeneralizedTime()
+	assert.True(t, ok, "time not read")
+	assert.True(t, v.T.Equal(tm), "time not as expected")
+	bs, ok = s.ReadBitString()
+	assert.True(t, ok, "bit string not read")
+	assert.Equal(t, v.B2, bs, "bit string not as expected")
+	assert.True(t, s.Empty(), "bytes remain after reading sequence")
+}
+
+func TestBuilder_GeneralizedTimeNotUTC(t *testing.T) {
+	t.Parallel()
+	b := NewBuilder()
+	defer b.Release()
+	assert.False(t, b.AddGeneralizedTime(time.Date(2026, 10, 14, 9, 5, 1, 0, time.FixedZone("", 3600))),
+		"time not in UTC should not be added")
+	assert.False(t, b.AddGeneralizedTime(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)),
+		"time with a year beyond 9999 should not be added")
+}
+
+func TestBuilder_Wrap(t *testing.T) {
+	t.Parallel()
+	for _, tag := range []int{0, 30, 31, 127, 128, 20000} {
+		want, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: tag, IsCompound: true, Bytes: []byte{0x05, 0x00}})
+		if err != nil {
+			t.Fatalf("error marshaling raw value: %v", err)
+		}
+		b := build(func(b *Builder) {
+			m := b.Len()
+			b.AddBytes([]byte{0x05, 0x00})
+			b.Wrap(asn1.ClassApplication, tag, true, m)
+		})
+		assert.Equal(t, want, b, "encoding with tag %d not as expected", tag)
+	}
+}
+
+func TestBuilder_Truncate(t *testing.T) {
+	t.Parallel()
+	b := build(func(b *Builder) {
+		b.AddInteger(1)
+		m := b.Len()
+		// Grow the buffer so that the truncation is across a reallocation.
+		b.AddOctetString(make([]byte, 2*initialBufferSize))
+		b.Truncate(m)
+	})
+	assert.Equal(t, []byte{0x02, 0x01, 0x01}, b, "encoding not as expected after truncation")
+}
+
+func TestParser_NotDER(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		name string
+		hex  string
+	}{
+		{"non-minimal integer", "02020001"},
+		{"non-minimal negative integer", "0202ff80"},
+		{"integer too large", "0209010000000000000000"},
+		{"empty integer", "0200"},
+		{"non-minimal length", "0281010a"},
+		{"non-minimal long length", "028200010a"},
+		{"indefinite length", "0280020101"},
+		{"truncated", "0205010203"},
+		{"high tag identifier", "1f2001aa"},
+		{"wrong tag", "0401aa"},
+	} {
+		b, _ := hex.DecodeString(test.hex)
+		p := Parser(b)
+		_, ok := p.ReadInt64()
+		assert.False(t, ok, "%s should not be read", test.name)
+	}
+	b, _ := hex.DecodeString("03020101")
+	p := Parser(b)
+	_, ok := p.ReadBitString()
+	assert.False(t, ok, "bit string with non-zero padding bits should not be read")
+}
+
+func BenchmarkBuilder(b *testing.B) {
+	cipher := make([]byte, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		db := NewBuilder()
+		db.AddEncryptedData(18, 2, cipher)
+		db.Bytes()
+		db.Release()
+	}
+}
@@ -0,0 +1,90 @@
+package der
+
+import "github.com/jcmturner/gofork/encoding/asn1"
+
+// AddEncryptedData adds an EncryptedData. The kvno is omitted if it is zero.
+func (b *Builder) AddEncryptedData(etype int32, kvno int, cipher []byte) {
+	m := b.Len()
+	e := b.Len()
+	b.AddOctetString(cipher)
+	b.Explicit(2, e)
+	if kvno != 0 {
+		e = b.Len()
+		b.AddInteger(int64(kvno))
+		b.Explicit(1, e)
+	}
+	e = b.Len()
+	b.AddInteger(int64(etype))
+	b.Explicit(0, e)
+	b.Sequence(m)
+}
+
+// ReadEncryptedData reads an EncryptedData. hasKVNO reports whether the optional kvno is present.
+func (p *Parser) ReadEncryptedData() (etype int32, kvno int, hasKVNO bool, cipher []byte, ok bool) {
+	s, ok := p.Sequence()
+	if !ok {
+		return
+	}
+	if etype, ok = s.ExplicitInt32(0); !ok {
+		return
+	}
+	if s.Peek(asn1.ClassContextSpecific, 1) {
+		if kvno, ok = s.ExplicitInt(1); !ok {
+			return
+		}
+		hasKVNO = true
+	}
+	c, ok := s.Explicit(2)
+	if !ok {
+		return
+	}
+	if cipher, ok = c.ReadOctetString(); !ok || !c.Empty() || !s.Empty() {
+		return 0, 0, false, nil, false
+	}
+	return etype, kvno, hasKVNO, cipher, true
+}
+
+// AddPrincipalName adds a PrincipalName.
+func (b *Builder) AddPrincipalName(nameType int32, names []string) {
+	m := b.Len()
+	e := b.Len()
+	for i := len(names) - 1; i >= 0; i-- {
+		b.AddGeneralString(names[i])
+	}
+	b.Sequence(e)
+	b.Explicit(1, e)
+	e = b.Len()
+	b.AddInteger(int64(nameType))
+	b.Explicit(0, e)
+	b.Sequence(m)
+}
+
+// ReadPrincipalName reads a PrincipalName.
+func (p *Parser) ReadPrincipalName() (nameType int32, names []string, ok bool) {
+	s, ok := p.Sequence()
+	if !ok {
+		return
+	}
+	if nameType, ok = s.ExplicitInt32(0); !ok {
+		return
+	}
+	c, ok := s.Explicit(1)
+	if !ok || !s.Empty() {
+		return 0, nil, false
+	}
+	seq, ok := c.Sequence()
+	if !ok || !c.Empty() {
+		return 0, nil, false
+	}
+	n, ok := seq.Count()
+	if !ok {
+		return 0, nil, false
+	}
+	names = make([]string, n)
+	for i := range names {
+		if names[i], ok = seq.ReadGeneralString(); !ok {
+			return 0, nil, false
+		}
+	}
+	return nameType, names, true
+}
@@ -0,0 +1,50 @@
+//go:build gokrb5_deterministic
+// +build gokrb5_deterministic
+
+package random
+
+import (
+	"crypto/rand"
+	"io"
+	mrand "math/rand"
+	"sync"
+)
+
+var (
+	mux    sync.RWMutex
+	reader io.Reader = rand.Reader
+)
+
+// lockedReader serialises reads from a math/rand source, which is not safe for concurrent use.
+type lockedReader struct {
+	mux sync.Mutex
+	r   *mrand.Rand
+}
+
+func (l *lockedReader) Read(b []byte) (int, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.r.Read(b)
+}
+
+// source returns the current source of randomness.
+func source() io.Reader {
+	mux.RLock()
+	defer mux.RUnlock()
+	return reader
+}
+
+// SetSeed replaces the source of randomness with a deterministic one seeded with the value provided.
+// It is only available with the gokrb5_deterministic build tag, which must only be used for tests.
+func SetSeed(seed int64) {
+	mux.Lock()
+	defer mux.Unlock()
+	reader = &lockedReader{r: mrand.New(mrand.NewSource(seed))}
+}
+
+// Reset restores crypto/rand as the source of randomness.
+func Reset() {
+	mux.Lock()
+	defer mux.Unlock()
+	reader = rand.Reader
+}
@@ -0,0 +1,25 @@
+// Package random provides the source of randomness for the keys, nonces, sequence numbers and confounders generated
+// by the library. The source is crypto/rand unless built with the gokrb5_deterministic build tag, with which the krbtest
+// package can make it deterministic for tests.
+package random
+
+import (
+	"crypto/rand"
+	"io"
+	"math/big"
+)
+
+// Reader returns the current source of randomness.
+func Reader() io.Reader {
+	return source()
+}
+
+// Read fills b from the current source of randomness.
+func Read(b []byte) (int, error) {
+	return io.ReadFull(Reader(), b)
+}
+
+// Int returns a uniform random value in [0, max) from the current source of randomness.
+func Int(max *big.Int) (*big.Int, error) {
+	return rand.Int(Reader(), max)
+}
@@ -0,0 +1,14 @@
+//go:build !gokrb5_deterministic
+// +build !gokrb5_deterministic
+
+package random
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// source returns crypto/rand, which cannot be replaced without the gokrb5_deterministic build tag.
+func source() io.Reader {
+	return rand.Reader
+}
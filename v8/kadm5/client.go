@@ -0,0 +1,272 @@
+package kadm5
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/seccontext"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// dialTimeout is how long connecting to a kadmin server is waited for.
+const dialTimeout = 10 * time.Second
+
+// Client is an authenticated connection to kadmind. It is safe for concurrent use; calls are made one at a time.
+type Client struct {
+	conn  *gssConn
+	realm string
+}
+
+// Dial connects to a kadmin server of the gokrb5 client's realm, from the admin_server entries of its configuration or
+// the realm's SRV records, and authenticates to it as the client's principal.
+func Dial(cl *client.Client, settings ...func(*Settings)) (*Client, error) {
+	realm := cl.Credentials.Domain()
+	_, servers, err := cl.Config.GetAdminServers(realm)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= len(servers); i++ {
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", servers[i], dialTimeout)
+		if err != nil {
+			continue
+		}
+		c, err := NewClient(cl, conn, settings...)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("could not connect to a kadmin server of realm %s: %w", realm, err)
+}
+
+// NewClient returns a Client authenticated as the gokrb5 client's principal over the connection to kadmind. The
+// ticket for the kadmind service is obtained with an AS exchange if the client has a password or keytab, as kadmind
+// only accepts initial tickets for kadmin/admin, otherwise with the client's TGT.
+func NewClient(cl *client.Client, conn net.Conn, settings ...func(*Settings)) (*Client, error) {
+	s := NewSettings(settings...)
+	var tkt messages.Ticket
+	var key types.EncryptionKey
+	var err error
+	if cl.Credentials.HasPassword() || cl.Credentials.HasKeytab() {
+		tkt, key, err = cl.GetInitialServiceTicket(s.Service())
+	} else {
+		tkt, key, err = cl.GetServiceTicket(s.Service())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get ticket for %s: %w", s.Service(), err)
+	}
+	ini := seccontext.NewInitiator(cl, s.Service(), seccontext.ServiceTicket(tkt, key),
+		seccontext.ContextFlags(gssapi.ContextFlagMutual, gssapi.ContextFlagReplay, gssapi.ContextFlagInteg, gssapi.ContextFlagConf))
+	c := &Client{
+		conn:  &gssConn{conn: conn, service: serviceIntegrity},
+		realm: cl.Credentials.Domain(),
+	}
+	if s.Privacy() {
+		c.conn.service = servicePrivacy
+	}
+	if err := c.conn.establish(ini); err != nil {
+		return nil, fmt.Errorf("could not establish RPCSEC_GSS context with kadmind: %w", err)
+	}
+	w := new(xdrWriter)
+	w.uint32(apiVersion)
+	if err := c.genericCall(procInit, w.b); err != nil {
+		return nil, fmt.Errorf("could not initialise kadm5 session: %w", err)
+	}
+	return c, nil
+}
+
+// Close destroys the RPCSEC_GSS context and closes the connection to kadmind.
+func (c *Client) Close() error {
+	c.conn.destroy()
+	return c.conn.conn.Close()
+}
+
+// CreatePrincipal creates the principal named by p with the fields of p selected by the mask, from the Mask
+// constants, and keys derived from the password. Fields not selected take the defaults of kadmind. With an empty
+// password the principal is created with random keys, as kadmin's addprinc -randkey does: it is created with a random
+// password and the AttrDisallowAllTix attribute, given random keys and then given the attributes of p.
+func (c *Client) CreatePrincipal(p Principal, mask uint32, password string) error {
+	if password != "" {
+		return c.createPrincipal(p, mask, password)
+	}
+	pw, err := randomPassword()
+	if err != nil {
+		return err
+	}
+	attrs := p.Attributes
+	p.Attributes |= AttrDisallowAllTix
+	if err := c.createPrincipal(p, mask|MaskAttributes, pw); err != nil {
+		return err
+	}
+	if _, err := c.RandKey(p.Name); err != nil {
+		return err
+	}
+	return c.ModifyPrincipal(Principal{Name: p.Name, Attributes: attrs}, MaskAttributes)
+}
+
+func (c *Client) createPrincipal(p Principal, mask uint32, password string) error {
+	w := new(xdrWriter)
+	w.uint32(apiVersion)
+	p.encode(w)
+	w.uint32(mask | MaskPrincipal)
+	w.nullString(password)
+	if err := c.genericCall(procCreatePrincipal, w.b); err != nil {
+		return fmt.Errorf("could not create principal %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// DeletePrincipal deletes the principal.
+func (c *Client) DeletePrincipal(name string) error {
+	w := new(xdrWriter)
+	w.uint32(apiVersion)
+	w.nullString(name)
+	if err := c.genericCall(procDeletePrincipal, w.b); err != nil {
+		return fmt.Errorf("could not delete principal %s: %w", name, err)
+	}
+	return nil
+}
+
+// ModifyPrincipal sets the fields of the principal named by p selected by the mask, from the Mask constants, to
+// those of p.
+func (c *Client) ModifyPrincipal(p Principal, mask uint32) error {
+	w := new(xdrWriter)
+	w.uint32(apiVersion)
+	p.encode(w)
+	w.uint32(mask)
+	if err := c.genericCall(procModifyPrincipal, w.b); err != nil {
+		return fmt.Errorf("could not modify principal %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// GetPrincipal returns the principal, including the descriptions of its keys.
+func (c *Client) GetPrincipal(name string) (Principal, error) {
+	w := new(xdrWriter)
+	w.uint32(apiVersion)
+	w.nullString(name)
+	w.uint32(getPrincipalMask)
+	var p Principal
+	r, err := c.call(procGetPrincipal, w.b)
+	if err == nil {
+		err = p.decode(r)
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("could not get principal %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// ChangePassword sets the keys of the principal to those derived from the password, as kadmin's cpw does.
+func (c *Client) ChangePassword(name, password string) error {
+	w := new(xdrWriter)
+	w.uint32(apiVersion)
+	w.nullString(name)
+	w.nullString(password)
+	if err := c.genericCall(procChpassPrincipal, w.b); err != nil {
+		return fmt.Errorf("could not change password of principal %s: %w", name, err)
+	}
+	return nil
+}
+
+// RandKey sets the keys of the principal to random keys, as kadmin's cpw -randkey does, and returns the new keys.
+func (c *Client) RandKey(name string) ([]types.EncryptionKey, error) {
+	w := new(xdrWriter)
+	w.uint32(apiVersion)
+	w.nullString(name)
+	r, err := c.call(procChrandPrincipal, w.b)
+	var keys []types.EncryptionKey
+	if err == nil {
+		keys, err = decodeKeys(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not randomize keys of principal %s: %w", name, err)
+	}
+	return keys, nil
+}
+
+// decodeKeys decodes an array of krb5_keyblock.
+func decodeKeys(r *xdrReader) ([]types.EncryptionKey, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	var keys []types.EncryptionKey
+	for i := 0; i < n; i++ {
+		et, err := r.int32()
+		if err != nil {
+			return nil, err
+		}
+		k, err := r.opaque()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, types.EncryptionKey{KeyType: et, KeyValue: k})
+	}
+	return keys, nil
+}
+
+// ExportKeytab sets the keys of the principal to random keys and adds them to the keytab with the principal's new key
+// version, as kadmin's ktadd does. Principals named without a realm are in the realm of the gokrb5 client.
+func (c *Client) ExportKeytab(kt *keytab.Keytab, name string) error {
+	keys, err := c.RandKey(name)
+	if err != nil {
+		return err
+	}
+	p, err := c.GetPrincipal(name)
+	if err != nil {
+		return err
+	}
+	pn, realm := types.ParseSPNString(name)
+	if realm == "" {
+		realm = c.realm
+	}
+	for _, k := range keys {
+		kt.AddKey(pn.PrincipalNameString(), realm, k, p.KVNO)
+	}
+	return nil
+}
+
+// genericCall makes the call of the procedure with the arguments and checks the code of its generic_ret result.
+func (c *Client) genericCall(proc uint32, args []byte) error {
+	_, err := c.call(proc, args)
+	return err
+}
+
+// call makes the call of the procedure with the arguments and returns a reader of its result following the API
+// version and code, returning an Error if the code is not KADM5_OK.
+func (c *Client) call(proc uint32, args []byte) (*xdrReader, error) {
+	r, err := c.conn.call(proc, args)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.uint32(); err != nil {
+		return nil, fmt.Errorf("could not decode result: %w", err)
+	}
+	code, err := r.int32()
+	if err != nil {
+		return nil, fmt.Errorf("could not decode result: %w", err)
+	}
+	if code != KADM5_OK {
+		return nil, Error{Code: code}
+	}
+	return r, nil
+}
+
+// randomPassword returns a random password for a principal created with random keys.
+func randomPassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating password: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,423 @@
+package kadm5
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/seccontext"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/test/krbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRealm = "TEST.GOKRB5"
+
+// testKadmind is a fake kadmind serving the kadm5 calls of an administrator for the principals of a fake KDC.
+type testKadmind struct {
+	t          *testing.T
+	kdc        *krbtest.KDC
+	kt         *keytab.Keytab
+	admin      string
+	service    uint32
+	ln         net.Listener
+	mux        sync.Mutex
+	principals map[string]Principal
+}
+
+// testSetup starts a KDC with the principals admin/admin and testuser1, and a kadmind for it, returning the
+// configuration of clients of the realm.
+func testSetup(t *testing.T, service uint32) (*testKadmind, *config.Config) {
+	t.Helper()
+	k, err := krbtest.NewKDC(testRealm)
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	t.Cleanup(func() { k.Close() })
+	for _, p := range []string{"admin/admin", "testuser1", DefaultService} {
+		if err := k.AddPrincipal(p, "passwordvalue"); err != nil {
+			t.Fatalf("error adding principal: %v", err)
+		}
+	}
+	kt, err := k.Keytab(DefaultService)
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &testKadmind{
+		t:          t,
+		kdc:        k,
+		kt:         kt,
+		admin:      "admin/admin",
+		service:    service,
+		ln:         ln,
+		principals: map[string]Principal{"testuser1": {Name: "testuser1", KVNO: 1}},
+	}
+	go s.serve()
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	for i := range c.Realms {
+		if c.Realms[i].Realm == testRealm {
+			c.Realms[i].AdminServer = []string{ln.Addr().String()}
+		}
+	}
+	return s, c
+}
+
+func (s *testKadmind) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn serves the RPCSEC_GSS context creation and the calls made over the connection.
+func (s *testKadmind) serveConn(conn net.Conn) {
+	defer conn.Close()
+	acc := seccontext.NewAcceptor(s.kt, service.DecodePAC(false))
+	var sc *gssapi.SecurityContext
+	for {
+		b, err := readRecord(conn)
+		if err != nil {
+			return
+		}
+		r := &xdrReader{b: b}
+		var h [7]uint32
+		for i := range h {
+			h[i], _ = r.uint32()
+		}
+		assert.Equal(s.t, [7]uint32{h[0], msgCall, rpcVersion, program, version, h[5], flavorGSS}, h, "call header not as expected")
+		cred, _ := r.opaque()
+		header := b[:len(b)-len(r.b)]
+		r.uint32()
+		verf, _ := r.opaque()
+		cr := &xdrReader{b: cred}
+		var c [4]uint32
+		for i := range c {
+			c[i], _ = cr.uint32()
+		}
+		gssProc, seq, svc := c[1], c[2], c[3]
+		assert.Equal(s.t, s.service, svc, "RPCSEC_GSS service not as expected")
+		w := new(xdrWriter)
+		w.uint32(h[0])
+		w.uint32(msgReply)
+		w.uint32(replyAccepted)
+		if gssProc == gssProcInit {
+			token, _ := r.opaque()
+			out, err := acc.AcceptSecContext(token)
+			if err != nil {
+				s.t.Errorf("error accepting security context: %v", err)
+				return
+			}
+			sc = acc.SecurityContext()
+			mic, _ := sc.GetMIC(uint32Bytes(16))
+			w.uint32(flavorGSS)
+			w.opaque(mic)
+			w.uint32(acceptSuccess)
+			w.opaque([]byte("handle"))
+			w.uint32(gssComplete)
+			w.uint32(0)
+			w.uint32(16)
+			w.opaque(out)
+			writeRecord(conn, w.b)
+			continue
+		}
+		assert.NoError(s.t, sc.VerifyMIC(header, verf), "call verifier should be verified")
+		var data []byte
+		if svc == servicePrivacy {
+			tok, _ := r.opaque()
+			data, _, err = sc.Unwrap(tok)
+		} else {
+			data, _ = r.opaque()
+			mic, _ := r.opaque()
+			err = sc.VerifyMIC(data, mic)
+		}
+		if err != nil {
+			s.t.Errorf("error verifying arguments: %v", err)
+			return
+		}
+		ar := &xdrReader{b: data}
+		aseq, _ := ar.uint32()
+		assert.Equal(s.t, seq, aseq, "sequence number of the arguments not as expected")
+		mic, _ := sc.GetMIC(uint32Bytes(seq))
+		w.uint32(flavorGSS)
+		w.opaque(mic)
+		w.uint32(acceptSuccess)
+		if gssProc == gssProcDestroy {
+			writeRecord(conn, w.b)
+			return
+		}
+		res := new(xdrWriter)
+		res.uint32(seq)
+		res.uint32(apiVersion)
+		code, ret := s.dispatch(acc.Credentials().CName().PrincipalNameString(), h[5], ar)
+		res.int32(code)
+		res.b = append(res.b, ret...)
+		if svc == servicePrivacy {
+			tok, _ := sc.Wrap(res.b, true)
+			w.opaque(tok)
+		} else {
+			mic, _ := sc.GetMIC(res.b)
+			w.opaque(res.b)
+			w.opaque(mic)
+		}
+		writeRecord(conn, w.b)
+	}
+}
+
+// dispatch performs the kadm5 call of the procedure for the user, changing the principals of the KDC, and returns the
+// code and the rest of its result.
+func (s *testKadmind) dispatch(user string, proc uint32, r *xdrReader) (int32, []byte) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	v, _ := r.uint32()
+	assert.Equal(s.t, apiVersion, v, "API version not as expected")
+	if proc == procInit {
+		return KADM5_OK, nil
+	}
+	if user != s.admin {
+		return KADM5_AUTH_INSUFFICIENT, nil
+	}
+	w := new(xdrWriter)
+	var p Principal
+	var name string
+	if proc == procCreatePrincipal || proc == procModifyPrincipal {
+		if err := p.decode(r); err != nil {
+			s.t.Errorf("error decoding principal: %v", err)
+			return KADM5_FAILURE, nil
+		}
+		name = p.Name
+	} else {
+		name, _ = r.nullString()
+	}
+	existing, ok := s.principals[name]
+	if proc == procCreatePrincipal {
+		if ok {
+			return KADM5_DUP, nil
+		}
+		mask, _ := r.uint32()
+		assert.NotZero(s.t, mask&MaskPrincipal, "mask should select the principal")
+		password, _ := r.nullString()
+		return s.setKeys(p, password), nil
+	}
+	if !ok {
+		return KADM5_UNK_PRINC, nil
+	}
+	switch proc {
+	case procDeletePrincipal:
+		delete(s.principals, name)
+		s.kdc.RemovePrincipal(name)
+	case procModifyPrincipal:
+		mask, _ := r.uint32()
+		if mask&MaskMaxLife != 0 {
+			existing.MaxLife = p.MaxLife
+		}
+		if mask&MaskAttributes != 0 {
+			existing.Attributes = p.Attributes
+		}
+		s.principals[name] = existing
+	case procGetPrincipal:
+		existing.encode(w)
+	case procChpassPrincipal:
+		password, _ := r.nullString()
+		return s.setKeys(existing, password), nil
+	case procChrandPrincipal:
+		password, _ := randomPassword()
+		if code := s.setKeys(existing, password); code != KADM5_OK {
+			return code, nil
+		}
+		kt, _ := s.kdc.Keytab(name)
+		w.uint32(uint32(len(kt.Entries)))
+		for _, e := range kt.Entries {
+			w.int32(e.Key.KeyType)
+			w.opaque(e.Key.KeyValue)
+		}
+	}
+	return KADM5_OK, w.b
+}
+
+// setKeys sets the keys of the principal in the KDC to those of the password.
+func (s *testKadmind) setKeys(p Principal, password string) int32 {
+	if err := s.kdc.AddPrincipal(p.Name, password); err != nil {
+		s.t.Errorf("error adding principal: %v", err)
+		return KADM5_FAILURE
+	}
+	kt, _ := s.kdc.Keytab(p.Name)
+	p.KVNO = kt.Entries[0].KVNO
+	s.principals[p.Name] = p
+	return KADM5_OK
+}
+
+func TestClient_PrincipalLifecycle(t *testing.T) {
+	t.Parallel()
+	_, c := testSetup(t, servicePrivacy)
+	admin := client.NewWithPassword("admin/admin", testRealm, "passwordvalue", c)
+	kc, err := Dial(admin)
+	if err != nil {
+		t.Fatalf("error connecting to kadmind: %v", err)
+	}
+	defer kc.Close()
+
+	err = kc.CreatePrincipal(Principal{Name: "testuser2", MaxLife: 8 * time.Hour}, MaskMaxLife, "newpassword")
+	if err != nil {
+		t.Fatalf("error creating principal: %v", err)
+	}
+	if err := client.NewWithPassword("testuser2", testRealm, "newpassword", c).Login(); err != nil {
+		t.Fatalf("error logging in as the principal created: %v", err)
+	}
+	err = kc.CreatePrincipal(Principal{Name: "testuser2"}, 0, "newpassword")
+	var kerr Error
+	if assert.True(t, errors.As(err, &kerr), "error should be a kadm5 error: %v", err) {
+		assert.Equal(t, KADM5_DUP, kerr.Code, "error code not as expected")
+	}
+
+	err = kc.ModifyPrincipal(Principal{Name: "testuser2", MaxLife: 4 * time.Hour, Attributes: AttrRequiresPreAuth}, MaskMaxLife|MaskAttributes)
+	if err != nil {
+		t.Fatalf("error modifying principal: %v", err)
+	}
+	p, err := kc.GetPrincipal("testuser2")
+	if err != nil {
+		t.Fatalf("error getting principal: %v", err)
+	}
+	assert.Equal(t, "testuser2", p.Name, "name not as expected")
+	assert.Equal(t, 4*time.Hour, p.MaxLife, "maximum ticket life not as expected")
+	assert.Equal(t, AttrRequiresPreAuth, p.Attributes, "attributes not as expected")
+	assert.Equal(t, uint32(1), p.KVNO, "key version not as expected")
+
+	if err := kc.ChangePassword("testuser2", "otherpassword"); err != nil {
+		t.Fatalf("error changing password: %v", err)
+	}
+	if err := client.NewWithPassword("testuser2", testRealm, "otherpassword", c).Login(); err != nil {
+		t.Fatalf("error logging in with the changed password: %v", err)
+	}
+
+	if err := kc.DeletePrincipal("testuser2"); err != nil {
+		t.Fatalf("error deleting principal: %v", err)
+	}
+	assert.Error(t, client.NewWithPassword("testuser2", testRealm, "otherpassword", c).Login(),
+		"deleted principal should not log in")
+	_, err = kc.GetPrincipal("testuser2")
+	if assert.True(t, errors.As(err, &kerr), "error should be a kadm5 error: %v", err) {
+		assert.Equal(t, KADM5_UNK_PRINC, kerr.Code, "error code not as expected")
+	}
+}
+
+func TestClient_ExportKeytab(t *testing.T) {
+	t.Parallel()
+	_, c := testSetup(t, servicePrivacy)
+	admin := client.NewWithPassword("admin/admin", testRealm, "passwordvalue", c)
+	kc, err := Dial(admin)
+	if err != nil {
+		t.Fatalf("error connecting to kadmind: %v", err)
+	}
+	defer kc.Close()
+
+	spn := "HTTP/host.test.gokrb5"
+	if err := kc.CreatePrincipal(Principal{Name: spn}, 0, ""); err != nil {
+		t.Fatalf("error creating principal with random keys: %v", err)
+	}
+	p, err := kc.GetPrincipal(spn)
+	if err != nil {
+		t.Fatalf("error getting principal: %v", err)
+	}
+	assert.Equal(t, uint32(0), p.Attributes, "attributes should be restored after the keys are randomized")
+	assert.Equal(t, uint32(2), p.KVNO, "keys should be randomized after the principal is created")
+
+	kt := keytab.New()
+	if err := kc.ExportKeytab(kt, spn); err != nil {
+		t.Fatalf("error exporting keytab: %v", err)
+	}
+	assert.Len(t, kt.Entries, len(krbtest.DefaultETypes), "keytab should have an entry for each key")
+	for _, e := range kt.Entries {
+		assert.Equal(t, uint32(3), e.KVNO, "entry should have the new key version")
+		assert.Equal(t, testRealm, e.Principal.Realm, "entry realm not as expected")
+	}
+	if err := client.NewWithKeytab(spn, testRealm, kt, c).Login(); err != nil {
+		t.Fatalf("error logging in with the exported keytab: %v", err)
+	}
+}
+
+func TestClient_Integrity(t *testing.T) {
+	t.Parallel()
+	_, c := testSetup(t, serviceIntegrity)
+	admin := client.NewWithPassword("admin/admin", testRealm, "passwordvalue", c)
+	kc, err := Dial(admin, Privacy(false))
+	if err != nil {
+		t.Fatalf("error connecting to kadmind: %v", err)
+	}
+	defer kc.Close()
+	p, err := kc.GetPrincipal("testuser1")
+	if err != nil {
+		t.Fatalf("error getting principal: %v", err)
+	}
+	assert.Equal(t, "testuser1", p.Name, "name not as expected")
+}
+
+func TestClient_Unauthorized(t *testing.T) {
+	t.Parallel()
+	_, c := testSetup(t, servicePrivacy)
+	cl := client.NewWithPassword("testuser1", testRealm, "passwordvalue", c)
+	kc, err := Dial(cl)
+	if err != nil {
+		t.Fatalf("error connecting to kadmind: %v", err)
+	}
+	defer kc.Close()
+	err = kc.DeletePrincipal("admin/admin")
+	var kerr Error
+	if assert.True(t, errors.As(err, &kerr), "error should be a kadm5 error: %v", err) {
+		assert.Equal(t, KADM5_AUTH_INSUFFICIENT, kerr.Code, "error code not as expected")
+	}
+
+	_, err = Dial(client.NewWithPassword("testuser1", testRealm, "wrongpassword", c))
+	assert.Error(t, err, "client should not authenticate with the wrong password")
+}
+
+func TestPrincipal_Encode(t *testing.T) {
+	t.Parallel()
+	p := Principal{
+		Name:             "testuser1@TEST.GOKRB5",
+		PrincExpireTime:  time.Unix(3000000000, 0).UTC(),
+		MaxLife:          10 * time.Hour,
+		ModName:          "admin/admin@TEST.GOKRB5",
+		ModDate:          time.Unix(1600000000, 0).UTC(),
+		Attributes:       AttrRequiresPreAuth | AttrOKAsDelegate,
+		KVNO:             2,
+		Policy:           "default",
+		MaxRenewableLife: 7 * 24 * time.Hour,
+		FailAuthCount:    1,
+		TLData:           []TLData{{Type: 1, Contents: []byte("data")}, {Type: 2, Contents: []byte{}}},
+		Keys:             []KeyData{{KVNO: 2, EncType: 18, SaltType: 0}, {KVNO: 2, EncType: 17}},
+	}
+	w := new(xdrWriter)
+	p.encode(w)
+	var d Principal
+	if err := d.decode(&xdrReader{b: w.b}); err != nil {
+		t.Fatalf("error decoding principal: %v", err)
+	}
+	assert.Equal(t, p, d, "decoded principal not as expected")
+
+	// Empty strings are NULL strings and the time not set is zero.
+	w = new(xdrWriter)
+	Principal{Name: "testuser1"}.encode(w)
+	assert.Equal(t, []byte{0, 0, 0, 10, 't', 'e', 's', 't', 'u', 's', 'e', 'r', '1', 0, 0, 0}, w.b[:16], "name not encoded as a nullstring")
+	d = Principal{}
+	if err := d.decode(&xdrReader{b: w.b}); err != nil {
+		t.Fatalf("error decoding principal: %v", err)
+	}
+	assert.Equal(t, Principal{Name: "testuser1"}, d, "decoded principal not as expected")
+}
@@ -0,0 +1,126 @@
+// Package kadm5 implements a client of the MIT Kerberos kadmin protocol so that principals can be created, modified,
+// deleted and given random keys, and their keys exported to keytabs, without wrapping the kadmin command line tool.
+//
+// The protocol is the kadm5 ONC RPC program of kadmind, RFC 5531, over TCP with the calls authenticated and protected
+// by RPCSEC_GSS, RFC 2203, using a Kerberos V5 security context with the kadmin/admin service of the client's realm:
+//
+//	cl := client.NewWithPassword("admin/admin", "EXAMPLE.COM", "password", cfg)
+//	c, err := kadm5.Dial(cl)
+//	...
+//	defer c.Close()
+//	err = c.CreatePrincipal(kadm5.Principal{Name: "user1"}, 0, "userpassword")
+//	...
+//	kt := keytab.New()
+//	err = c.ExportKeytab(kt, "HTTP/www.example.com")
+//
+// Errors returned by kadmind for a call, such as for a principal that does not exist, are of type Error.
+//
+// Only the RFC 4121 token formats of the Kerberos V5 mechanism are supported, so the session key of the kadmin/admin
+// ticket must be of an AES encryption type.
+package kadm5
+
+import "fmt"
+
+// DefaultService is the service principal of kadmind that clients authenticate to by default.
+const DefaultService = "kadmin/admin"
+
+// ONC RPC program, version and procedures of the kadm5 protocol.
+const (
+	program uint32 = 2112
+	version uint32 = 2
+
+	procCreatePrincipal uint32 = 1
+	procDeletePrincipal uint32 = 2
+	procModifyPrincipal uint32 = 3
+	procGetPrincipal    uint32 = 5
+	procChpassPrincipal uint32 = 6
+	procChrandPrincipal uint32 = 7
+	procInit            uint32 = 13
+)
+
+// apiVersion is the kadm5 API version of the calls, KADM5_API_VERSION_2.
+const apiVersion uint32 = 0x12345702
+
+// kadm5 error codes returned by kadmind, from the MIT kadm5 error table.
+const (
+	KADM5_OK      int32 = 0
+	KADM5_FAILURE int32 = 43787520 + iota - 1
+	KADM5_AUTH_GET
+	KADM5_AUTH_ADD
+	KADM5_AUTH_MODIFY
+	KADM5_AUTH_DELETE
+	KADM5_AUTH_INSUFFICIENT
+	KADM5_BAD_DB
+	KADM5_DUP
+	KADM5_RPC_ERROR
+	KADM5_NO_SRV
+	KADM5_BAD_HIST_KEY
+	KADM5_NOT_INIT
+	KADM5_UNK_PRINC
+	KADM5_UNK_POLICY
+	KADM5_BAD_MASK
+	KADM5_BAD_CLASS
+	KADM5_BAD_LENGTH
+	KADM5_BAD_POLICY
+	KADM5_BAD_PRINCIPAL
+	KADM5_BAD_AUX_ATTR
+	KADM5_BAD_HISTORY
+	KADM5_BAD_MIN_PASS_LIFE
+	KADM5_PASS_Q_TOOSHORT
+	KADM5_PASS_Q_CLASS
+	KADM5_PASS_Q_DICT
+	KADM5_PASS_REUSE
+	KADM5_PASS_TOOSOON
+	KADM5_POLICY_REF
+	KADM5_INIT
+	KADM5_BAD_PASSWORD
+	KADM5_PROTECT_PRINCIPAL
+)
+
+// errorText holds the messages of the kadm5 error codes.
+var errorText = map[int32]string{
+	KADM5_FAILURE:           "operation failed for unspecified reason",
+	KADM5_AUTH_GET:          "operation requires get privilege",
+	KADM5_AUTH_ADD:          "operation requires add privilege",
+	KADM5_AUTH_MODIFY:       "operation requires modify privilege",
+	KADM5_AUTH_DELETE:       "operation requires delete privilege",
+	KADM5_AUTH_INSUFFICIENT: "insufficient authorization for operation",
+	KADM5_BAD_DB:            "database inconsistency detected",
+	KADM5_DUP:               "principal or policy already exists",
+	KADM5_RPC_ERROR:         "communication failure with server",
+	KADM5_NO_SRV:            "no administration server found for realm",
+	KADM5_BAD_HIST_KEY:      "password history principal key version mismatch",
+	KADM5_NOT_INIT:          "connection to server not initialized",
+	KADM5_UNK_PRINC:         "principal does not exist",
+	KADM5_UNK_POLICY:        "policy does not exist",
+	KADM5_BAD_MASK:          "invalid field mask for operation",
+	KADM5_BAD_CLASS:         "invalid number of character classes",
+	KADM5_BAD_LENGTH:        "invalid password length",
+	KADM5_BAD_POLICY:        "illegal policy name",
+	KADM5_BAD_PRINCIPAL:     "illegal principal name",
+	KADM5_BAD_AUX_ATTR:      "invalid auxiliary attributes",
+	KADM5_BAD_HISTORY:       "invalid password history count",
+	KADM5_BAD_MIN_PASS_LIFE: "password minimum life is greater than password maximum life",
+	KADM5_PASS_Q_TOOSHORT:   "password is too short",
+	KADM5_PASS_Q_CLASS:      "password does not contain enough character classes",
+	KADM5_PASS_Q_DICT:       "password is in the password dictionary",
+	KADM5_PASS_REUSE:        "cannot reuse password",
+	KADM5_PASS_TOOSOON:      "current password's minimum life has not expired",
+	KADM5_POLICY_REF:        "policy is in use",
+	KADM5_INIT:              "connection to server already initialized",
+	KADM5_BAD_PASSWORD:      "incorrect password",
+	KADM5_PROTECT_PRINCIPAL: "cannot change protected principal",
+}
+
+// Error is a kadm5 error returned by kadmind for a call.
+type Error struct {
+	Code int32
+}
+
+// Error implements the error interface.
+func (e Error) Error() string {
+	if s, ok := errorText[e.Code]; ok {
+		return fmt.Sprintf("kadm5 error %d: %s", e.Code, s)
+	}
+	return fmt.Sprintf("kadm5 error %d", e.Code)
+}
@@ -0,0 +1,249 @@
+package kadm5
+
+import "time"
+
+// Mask bits selecting the fields of a Principal set by CreatePrincipal and ModifyPrincipal.
+const (
+	MaskPrincipal        uint32 = 0x000001
+	MaskPrincExpireTime  uint32 = 0x000002
+	MaskPwExpiration     uint32 = 0x000004
+	MaskLastPwdChange    uint32 = 0x000008
+	MaskAttributes       uint32 = 0x000010
+	MaskMaxLife          uint32 = 0x000020
+	MaskModTime          uint32 = 0x000040
+	MaskModName          uint32 = 0x000080
+	MaskKVNO             uint32 = 0x000100
+	MaskMKVNO            uint32 = 0x000200
+	MaskAuxAttributes    uint32 = 0x000400
+	MaskPolicy           uint32 = 0x000800
+	MaskPolicyClear      uint32 = 0x001000
+	MaskMaxRenewableLife uint32 = 0x002000
+	MaskLastSuccess      uint32 = 0x004000
+	MaskLastFailed       uint32 = 0x008000
+	MaskFailAuthCount    uint32 = 0x010000
+	MaskKeyData          uint32 = 0x020000
+	MaskTLData           uint32 = 0x040000
+)
+
+// getPrincipalMask selects the fields returned by GetPrincipal, all those of the principal and its key data.
+const getPrincipalMask = 0x01ffff | MaskKeyData
+
+// Attribute bits of a principal, the KRB5_KDB flags of the KDC's database.
+const (
+	AttrDisallowPostdated   uint32 = 0x00000001
+	AttrDisallowForwardable uint32 = 0x00000002
+	AttrDisallowTGTBased    uint32 = 0x00000004
+	AttrDisallowRenewable   uint32 = 0x00000008
+	AttrDisallowProxiable   uint32 = 0x00000010
+	AttrDisallowDupSKey     uint32 = 0x00000020
+	AttrDisallowAllTix      uint32 = 0x00000040
+	AttrRequiresPreAuth     uint32 = 0x00000080
+	AttrRequiresHWAuth      uint32 = 0x00000100
+	AttrRequiresPwChange    uint32 = 0x00000200
+	AttrDisallowSvr         uint32 = 0x00001000
+	AttrPwChangeService     uint32 = 0x00002000
+	AttrOKAsDelegate        uint32 = 0x00100000
+	AttrOKToAuthAsDelegate  uint32 = 0x00200000
+	AttrNoAuthDataRequired  uint32 = 0x00400000
+	AttrLockdownKeys        uint32 = 0x00800000
+)
+
+// Principal is an entry of the KDC's database, the kadm5_principal_ent_rec of the kadm5 API. The name is that of the
+// principal with its realm, or without to use the realm of kadmind. Times that are not set are zero, as are the expiry
+// times of principals and passwords that do not expire.
+type Principal struct {
+	Name             string
+	PrincExpireTime  time.Time
+	LastPwdChange    time.Time
+	PwExpiration     time.Time
+	MaxLife          time.Duration
+	ModName          string
+	ModDate          time.Time
+	Attributes       uint32
+	KVNO             uint32
+	MKVNO            uint32
+	Policy           string
+	AuxAttributes    int32
+	MaxRenewableLife time.Duration
+	LastSuccess      time.Time
+	LastFailed       time.Time
+	FailAuthCount    uint32
+	TLData           []TLData
+	Keys             []KeyData
+}
+
+// TLData is an item of the typed data of a principal.
+type TLData struct {
+	Type     int16
+	Contents []byte
+}
+
+// KeyData describes a key of a principal. The key itself is not returned by kadmind.
+type KeyData struct {
+	KVNO     uint32
+	EncType  int32
+	SaltType int32
+}
+
+// encode writes the principal as the kadm5 protocol's _xdr_kadm5_principal_ent_rec does for API version 2.
+func (p Principal) encode(w *xdrWriter) {
+	w.nullString(p.Name)
+	encodeTime(w, p.PrincExpireTime)
+	encodeTime(w, p.LastPwdChange)
+	encodeTime(w, p.PwExpiration)
+	w.int32(int32(p.MaxLife / time.Second))
+	// mod_name is a pointer to a principal, NULL if the name is empty.
+	w.bool(p.ModName == "")
+	if p.ModName != "" {
+		w.nullString(p.ModName)
+	}
+	encodeTime(w, p.ModDate)
+	w.uint32(p.Attributes)
+	w.uint32(p.KVNO)
+	w.uint32(p.MKVNO)
+	w.nullString(p.Policy)
+	w.int32(p.AuxAttributes)
+	w.int32(int32(p.MaxRenewableLife / time.Second))
+	encodeTime(w, p.LastSuccess)
+	encodeTime(w, p.LastFailed)
+	w.uint32(p.FailAuthCount)
+	w.int32(int32(len(p.Keys)))
+	w.int32(int32(len(p.TLData)))
+	// tl_data is a pointer to a linked list, NULL if there are no items.
+	w.bool(len(p.TLData) == 0)
+	if len(p.TLData) > 0 {
+		for _, tl := range p.TLData {
+			w.bool(true)
+			w.int32(int32(tl.Type))
+			w.opaque(tl.Contents)
+		}
+		w.bool(false)
+	}
+	w.uint32(uint32(len(p.Keys)))
+	for _, k := range p.Keys {
+		w.int32(1) // key_data_ver
+		w.uint32(k.KVNO)
+		w.int32(k.EncType)
+		w.int32(k.SaltType)
+		w.uint32(0) // key_data_length of the key, not sent
+		w.uint32(0) // key_data_length of the salt, not sent
+	}
+}
+
+// decode reads the principal written by _xdr_kadm5_principal_ent_rec for API version 2.
+func (p *Principal) decode(r *xdrReader) error {
+	var err error
+	if p.Name, err = r.nullString(); err != nil {
+		return err
+	}
+	for _, t := range []*time.Time{&p.PrincExpireTime, &p.LastPwdChange, &p.PwExpiration} {
+		if *t, err = decodeTime(r); err != nil {
+			return err
+		}
+	}
+	if p.MaxLife, err = decodeDuration(r); err != nil {
+		return err
+	}
+	null, err := r.bool()
+	if err != nil {
+		return err
+	}
+	if !null {
+		if p.ModName, err = r.nullString(); err != nil {
+			return err
+		}
+	}
+	if p.ModDate, err = decodeTime(r); err != nil {
+		return err
+	}
+	for _, v := range []*uint32{&p.Attributes, &p.KVNO, &p.MKVNO} {
+		if *v, err = r.uint32(); err != nil {
+			return err
+		}
+	}
+	if p.Policy, err = r.nullString(); err != nil {
+		return err
+	}
+	if p.AuxAttributes, err = r.int32(); err != nil {
+		return err
+	}
+	if p.MaxRenewableLife, err = decodeDuration(r); err != nil {
+		return err
+	}
+	for _, t := range []*time.Time{&p.LastSuccess, &p.LastFailed} {
+		if *t, err = decodeTime(r); err != nil {
+			return err
+		}
+	}
+	if p.FailAuthCount, err = r.uint32(); err != nil {
+		return err
+	}
+	// The counts of key data and typed data items, which the list and array are decoded without.
+	for i := 0; i < 2; i++ {
+		if _, err := r.int32(); err != nil {
+			return err
+		}
+	}
+	if null, err = r.bool(); err != nil {
+		return err
+	}
+	p.TLData = nil
+	for !null {
+		more, err := r.bool()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		typ, err := r.int32()
+		if err != nil {
+			return err
+		}
+		b, err := r.opaque()
+		if err != nil {
+			return err
+		}
+		p.TLData = append(p.TLData, TLData{Type: int16(typ), Contents: b})
+	}
+	n, err := r.length()
+	if err != nil {
+		return err
+	}
+	p.Keys = nil
+	for i := 0; i < n; i++ {
+		var v [6]uint32
+		for j := range v {
+			if v[j], err = r.uint32(); err != nil {
+				return err
+			}
+		}
+		p.Keys = append(p.Keys, KeyData{KVNO: v[1], EncType: int32(v[2]), SaltType: int32(v[3])})
+	}
+	return nil
+}
+
+// encodeTime writes the time as a krb5_timestamp, the zero time as zero.
+func encodeTime(w *xdrWriter, t time.Time) {
+	if t.IsZero() {
+		w.uint32(0)
+		return
+	}
+	w.uint32(uint32(t.Unix()))
+}
+
+// decodeTime reads a krb5_timestamp, zero being read as the zero time. Timestamps are unsigned so that those after
+// 2038 are read correctly.
+func decodeTime(r *xdrReader) (time.Time, error) {
+	v, err := r.uint32()
+	if err != nil || v == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(v), 0).UTC(), nil
+}
+
+// decodeDuration reads a krb5_deltat, a duration in seconds.
+func decodeDuration(r *xdrReader) (time.Duration, error) {
+	v, err := r.int32()
+	return time.Duration(v) * time.Second, err
+}
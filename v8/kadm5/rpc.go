@@ -0,0 +1,342 @@
+package kadm5
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/seccontext"
+)
+
+// ONC RPC message constants, RFC 5531.
+const (
+	rpcVersion      uint32 = 2
+	msgCall         uint32 = 0
+	msgReply        uint32 = 1
+	replyAccepted   uint32 = 0
+	acceptSuccess   uint32 = 0
+	rejectAuthError uint32 = 1
+	flavorNone      uint32 = 0
+	procNull        uint32 = 0
+	lastFragment    uint32 = 0x80000000
+	maxRecordBytes         = 1 << 24
+)
+
+// RPCSEC_GSS constants, RFC 2203.
+const (
+	flavorGSS           uint32 = 6
+	gssVersion          uint32 = 1
+	gssProcData         uint32 = 0
+	gssProcInit         uint32 = 1
+	gssProcContinueInit uint32 = 2
+	gssProcDestroy      uint32 = 3
+	serviceIntegrity    uint32 = 2
+	servicePrivacy      uint32 = 3
+	gssComplete         uint32 = 0
+	gssContinueNeeded   uint32 = 1
+)
+
+// gssConn is an ONC RPC connection whose calls are authenticated and protected with an RPCSEC_GSS context. Calls are
+// made one at a time.
+type gssConn struct {
+	conn    net.Conn
+	service uint32
+	mux     sync.Mutex
+	xid     uint32
+	seq     uint32
+	handle  []byte
+	sc      *gssapi.SecurityContext
+}
+
+// establish creates the RPCSEC_GSS context, RFC 2203 section 5.2.2, exchanging the initiator's tokens with the server
+// in calls of the NULL procedure until the security context is established.
+func (c *gssConn) establish(ini *seccontext.Initiator) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	token, cont, err := ini.InitSecContext(nil)
+	if err != nil {
+		return err
+	}
+	proc := gssProcInit
+	for {
+		w := new(xdrWriter)
+		w.opaque(token)
+		flavor, verf, r, err := c.roundTrip(c.header(procNull, c.cred(proc, 0)), flavorNone, nil, w.b)
+		if err != nil {
+			return err
+		}
+		handle, err := r.opaque()
+		if err != nil {
+			return fmt.Errorf("could not decode context creation result: %w", err)
+		}
+		var res [3]uint32
+		for i := range res {
+			if res[i], err = r.uint32(); err != nil {
+				return fmt.Errorf("could not decode context creation result: %w", err)
+			}
+		}
+		major, minor, window := res[0], res[1], res[2]
+		out, err := r.opaque()
+		if err != nil {
+			return fmt.Errorf("could not decode context creation result: %w", err)
+		}
+		if major != gssComplete && major != gssContinueNeeded {
+			return fmt.Errorf("server could not establish the security context (major: %#x, minor: %d)", major, minor)
+		}
+		c.handle = handle
+		token = nil
+		if len(out) > 0 {
+			if !cont {
+				return errors.New("server returned a token after the security context was established")
+			}
+			if token, cont, err = ini.InitSecContext(out); err != nil {
+				return err
+			}
+		}
+		if major == gssComplete {
+			if !ini.Established() {
+				return errors.New("server completed the context creation before the security context was established")
+			}
+			c.sc = ini.SecurityContext()
+			// The server's verifier of the completed context creation is the MIC of the sequence window.
+			if flavor != flavorGSS {
+				return errors.New("context creation reply does not have an RPCSEC_GSS verifier")
+			}
+			if err := verifyMIC(c.sc, uint32Bytes(window), verf); err != nil {
+				return fmt.Errorf("could not verify the context creation reply: %w", err)
+			}
+			return nil
+		}
+		if token == nil {
+			return errors.New("server expects a token the initiator did not produce")
+		}
+		proc = gssProcContinueInit
+	}
+}
+
+// call makes the call of the procedure with the arguments protected by the security context and returns a reader of
+// its verified results.
+func (c *gssConn) call(proc uint32, args []byte) (*xdrReader, error) {
+	return c.protectedCall(gssProcData, proc, args)
+}
+
+// destroy destroys the RPCSEC_GSS context on the server, RFC 2203 section 5.4.
+func (c *gssConn) destroy() error {
+	if c.sc == nil {
+		return nil
+	}
+	_, err := c.protectedCall(gssProcDestroy, procNull, nil)
+	return err
+}
+
+// protectedCall makes the call of the procedure with the RPCSEC_GSS credential of the control procedure, protecting
+// its arguments and verifying its results with the security context, RFC 2203 section 5.3.
+func (c *gssConn) protectedCall(gssProc, proc uint32, args []byte) (*xdrReader, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.seq++
+	seq := c.seq
+	h := c.header(proc, c.cred(gssProc, seq))
+	// The verifier is computed before the arguments are protected so that the server, which verifies it first,
+	// receives the tokens in sequence.
+	verf, err := c.sc.GetMIC(h)
+	if err != nil {
+		return nil, err
+	}
+	data := append(uint32Bytes(seq), args...)
+	w := new(xdrWriter)
+	if c.service == servicePrivacy {
+		b, err := c.sc.Wrap(data, true)
+		if err != nil {
+			return nil, err
+		}
+		w.opaque(b)
+	} else {
+		mic, err := c.sc.GetMIC(data)
+		if err != nil {
+			return nil, err
+		}
+		w.opaque(data)
+		w.opaque(mic)
+	}
+	flavor, rverf, r, err := c.roundTrip(h, flavorGSS, verf, w.b)
+	if err != nil {
+		return nil, err
+	}
+	if flavor != flavorGSS {
+		return nil, errors.New("reply does not have an RPCSEC_GSS verifier")
+	}
+	if err := verifyMIC(c.sc, uint32Bytes(seq), rverf); err != nil {
+		return nil, fmt.Errorf("could not verify the reply verifier: %w", err)
+	}
+	if gssProc == gssProcDestroy {
+		return r, nil
+	}
+	if c.service == servicePrivacy {
+		b, err := r.opaque()
+		if err != nil {
+			return nil, fmt.Errorf("could not decode results: %w", err)
+		}
+		data, sealed, err := c.sc.Unwrap(b)
+		if s, ok := err.(gssapi.Status); ok && s.Code == gssapi.StatusGapToken {
+			err = nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not unwrap results: %w", err)
+		}
+		if !sealed {
+			return nil, errors.New("results are not encrypted")
+		}
+		r = &xdrReader{b: data}
+	} else {
+		data, err := r.opaque()
+		if err != nil {
+			return nil, fmt.Errorf("could not decode results: %w", err)
+		}
+		mic, err := r.opaque()
+		if err != nil {
+			return nil, fmt.Errorf("could not decode results: %w", err)
+		}
+		if err := verifyMIC(c.sc, data, mic); err != nil {
+			return nil, fmt.Errorf("could not verify results: %w", err)
+		}
+		r = &xdrReader{b: data}
+	}
+	if s, err := r.uint32(); err != nil || s != seq {
+		return nil, errors.New("sequence number of the results does not match the call")
+	}
+	return r, nil
+}
+
+// cred returns the RPCSEC_GSS credential of a call of the control procedure with the sequence number.
+func (c *gssConn) cred(gssProc, seq uint32) []byte {
+	w := new(xdrWriter)
+	w.uint32(gssVersion)
+	w.uint32(gssProc)
+	w.uint32(seq)
+	w.uint32(c.service)
+	w.opaque(c.handle)
+	return w.b
+}
+
+// header returns the header of a new call of the procedure, from its transaction ID to its credential.
+func (c *gssConn) header(proc uint32, cred []byte) []byte {
+	c.xid++
+	w := new(xdrWriter)
+	w.uint32(c.xid)
+	w.uint32(msgCall)
+	w.uint32(rpcVersion)
+	w.uint32(program)
+	w.uint32(version)
+	w.uint32(proc)
+	w.uint32(flavorGSS)
+	w.opaque(cred)
+	return w.b
+}
+
+// roundTrip sends the call with the header, verifier and body, and returns the verifier of the reply and a reader of
+// its results.
+func (c *gssConn) roundTrip(header []byte, flavor uint32, verf, body []byte) (uint32, []byte, *xdrReader, error) {
+	w := &xdrWriter{b: header}
+	w.uint32(flavor)
+	w.opaque(verf)
+	w.b = append(w.b, body...)
+	if err := writeRecord(c.conn, w.b); err != nil {
+		return 0, nil, nil, fmt.Errorf("could not send call: %w", err)
+	}
+	b, err := readRecord(c.conn)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("could not read reply: %w", err)
+	}
+	r := &xdrReader{b: b}
+	flavor, verf, err = readReplyHeader(r, c.xid)
+	return flavor, verf, r, err
+}
+
+// readReplyHeader reads the ONC RPC reply header, returning its verifier or an error if the call was not successful.
+func readReplyHeader(r *xdrReader, xid uint32) (uint32, []byte, error) {
+	var h [4]uint32
+	for i := range h {
+		v, err := r.uint32()
+		if err != nil {
+			return 0, nil, fmt.Errorf("could not decode reply header: %w", err)
+		}
+		h[i] = v
+	}
+	if h[0] != xid || h[1] != msgReply {
+		return 0, nil, errors.New("reply does not match the call")
+	}
+	if h[2] != replyAccepted {
+		if h[3] == rejectAuthError {
+			stat, _ := r.uint32()
+			return 0, nil, fmt.Errorf("call rejected by the server (authentication status %d)", stat)
+		}
+		return 0, nil, errors.New("call rejected by the server")
+	}
+	flavor := h[3]
+	verf, err := r.opaque()
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not decode reply verifier: %w", err)
+	}
+	stat, err := r.uint32()
+	if err != nil {
+		return 0, nil, err
+	}
+	if stat != acceptSuccess {
+		return 0, nil, fmt.Errorf("call not executed by the server (accept status %d)", stat)
+	}
+	return flavor, verf, nil
+}
+
+// verifyMIC verifies the MIC token from the server for the message. Tokens skipped by the server, such as those of
+// calls it discarded, are not an error.
+func verifyMIC(sc *gssapi.SecurityContext, msg, token []byte) error {
+	err := sc.VerifyMIC(msg, token)
+	if s, ok := err.(gssapi.Status); ok && s.Code == gssapi.StatusGapToken {
+		return nil
+	}
+	return err
+}
+
+// uint32Bytes returns the XDR encoding of the value.
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// writeRecord writes the message as a single record marked fragment, RFC 5531 section 11.
+func writeRecord(w io.Writer, b []byte) error {
+	m := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(m, lastFragment|uint32(len(b)))
+	_, err := w.Write(append(m, b...))
+	return err
+}
+
+// readRecord reads a record, reassembling its fragments.
+func readRecord(rd io.Reader) ([]byte, error) {
+	var b []byte
+	for {
+		var m [4]byte
+		if _, err := io.ReadFull(rd, m[:]); err != nil {
+			return nil, err
+		}
+		h := binary.BigEndian.Uint32(m[:])
+		n := int(h &^ lastFragment)
+		if len(b)+n > maxRecordBytes {
+			return nil, errors.New("record exceeds maximum size")
+		}
+		f := make([]byte, n)
+		if _, err := io.ReadFull(rd, f); err != nil {
+			return nil, err
+		}
+		b = append(b, f...)
+		if h&lastFragment != 0 {
+			return b, nil
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package kadm5
+
+// Settings defines the configuration of a Client.
+type Settings struct {
+	service string
+	privacy bool
+}
+
+// NewSettings creates a new Settings. By default the client authenticates to DefaultService and the calls are
+// encrypted.
+func NewSettings(settings ...func(*Settings)) *Settings {
+	s := &Settings{
+		service: DefaultService,
+		privacy: true,
+	}
+	for _, set := range settings {
+		set(s)
+	}
+	return s
+}
+
+// Service used to configure the service principal of kadmind the client authenticates to, such as kadmin/<host> for
+// clients authenticating with a TGT from a credential cache.
+//
+// s := NewSettings(Service("kadmin/kdc.example.com"))
+func Service(spn string) func(*Settings) {
+	return func(s *Settings) {
+		s.service = spn
+	}
+}
+
+// Service returns the service principal of kadmind the client authenticates to.
+func (s *Settings) Service() string {
+	return s.service
+}
+
+// Privacy used to configure whether the calls are encrypted, the RPCSEC_GSS privacy service, or only integrity
+// protected. Passwords and keys are sent in the clear without privacy.
+//
+// s := NewSettings(Privacy(false))
+func Privacy(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.privacy = b
+	}
+}
+
+// Privacy returns whether the calls are encrypted.
+func (s *Settings) Privacy() bool {
+	return s.privacy
+}
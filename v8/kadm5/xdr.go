@@ -0,0 +1,117 @@
+package kadm5
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// maxXDRLength limits the length of variable length data decoded, protecting against corrupt messages.
+const maxXDRLength = 1 << 24
+
+// xdrWriter encodes values in XDR, RFC 4506.
+type xdrWriter struct {
+	b []byte
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.b = append(w.b, b[:]...)
+}
+
+func (w *xdrWriter) int32(v int32) {
+	w.uint32(uint32(v))
+}
+
+func (w *xdrWriter) bool(v bool) {
+	if v {
+		w.uint32(1)
+		return
+	}
+	w.uint32(0)
+}
+
+// opaque writes variable length opaque data padded to a multiple of four bytes.
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.b = append(w.b, b...)
+	if p := len(b) % 4; p != 0 {
+		w.b = append(w.b, make([]byte, 4-p)...)
+	}
+}
+
+// nullString writes a string as the kadm5 protocol's xdr_nullstring does, as opaque data including its terminating
+// NUL, with an empty string written as a NULL string of length zero.
+func (w *xdrWriter) nullString(s string) {
+	if s == "" {
+		w.uint32(0)
+		return
+	}
+	w.opaque(append([]byte(s), 0))
+}
+
+// xdrReader decodes values encoded in XDR, RFC 4506.
+type xdrReader struct {
+	b []byte
+}
+
+var errXDRShort = errors.New("XDR data too short")
+
+func (r *xdrReader) uint32() (uint32, error) {
+	if len(r.b) < 4 {
+		return 0, errXDRShort
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v, nil
+}
+
+func (r *xdrReader) int32() (int32, error) {
+	v, err := r.uint32()
+	return int32(v), err
+}
+
+func (r *xdrReader) bool() (bool, error) {
+	v, err := r.uint32()
+	return v != 0, err
+}
+
+func (r *xdrReader) opaque() ([]byte, error) {
+	n, err := r.length()
+	if err != nil {
+		return nil, err
+	}
+	p := (4 - n%4) % 4
+	if len(r.b) < n+p {
+		return nil, errXDRShort
+	}
+	b := make([]byte, n)
+	copy(b, r.b)
+	r.b = r.b[n+p:]
+	return b, nil
+}
+
+// nullString reads a string written by xdr_nullstring, a NULL string being read as an empty string.
+func (r *xdrReader) nullString() (string, error) {
+	b, err := r.opaque()
+	if err != nil {
+		return "", err
+	}
+	if len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return string(b), nil
+}
+
+// length reads the length of an array or opaque data.
+func (r *xdrReader) length() (int, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	if n > maxXDRLength {
+		return 0, fmt.Errorf("XDR length %d exceeds limit", n)
+	}
+	return int(n), nil
+}
@@ -21,3 +21,9 @@ func (c *ChangePasswdData) Marshal() ([]byte, error) {
 	//b = asn1tools.AddASNAppTag(b, asnAppTag.)
 	return b, nil
 }
+
+// Unmarshal bytes b into the ChangePasswdData struct.
+func (c *ChangePasswdData) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, c)
+	return err
+}
@@ -10,11 +10,18 @@ import (
 
 // ChangePasswdMsg generate a change password request and also return the key needed to decrypt the reply.
 func ChangePasswdMsg(cname types.PrincipalName, realm, password string, tkt messages.Ticket, sessionKey types.EncryptionKey) (r Request, k types.EncryptionKey, err error) {
+	return SetPasswdMsg(cname, realm, cname, realm, password, tkt, sessionKey)
+}
+
+// SetPasswdMsg generates a set password request, RFC 3244, for the password of the target principal of the target
+// realm to be set by the client principal, such as an administrator, with its kadmin/changepw ticket. The key needed
+// to decrypt the reply is also returned.
+func SetPasswdMsg(cname types.PrincipalName, realm string, targName types.PrincipalName, targRealm, password string, tkt messages.Ticket, sessionKey types.EncryptionKey) (r Request, k types.EncryptionKey, err error) {
 	// Create change password data struct and marshal to bytes
 	chgpasswd := ChangePasswdData{
 		NewPasswd: []byte(password),
-		TargName:  cname,
-		TargRealm: realm,
+		TargName:  targName,
+		TargRealm: targRealm,
 	}
 	chpwdb, err := chgpasswd.Marshal()
 	if err != nil {
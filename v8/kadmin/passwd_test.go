@@ -0,0 +1,42 @@
+package kadmin
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetPasswdMsg(t *testing.T) {
+	t.Parallel()
+	admin := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "admin")
+	target := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2")
+	tkt := messages.Ticket{
+		Realm: "TEST.GOKRB5",
+		SName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "kadmin/changepw"),
+	}
+	sessionKey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	r, k, err := SetPasswdMsg(admin, "TEST.GOKRB5", target, "OTHER.GOKRB5", "newpassword", tkt, sessionKey)
+	if err != nil {
+		t.Fatalf("error creating set password message: %v", err)
+	}
+	if err := r.APREQ.DecryptAuthenticator(sessionKey); err != nil {
+		t.Fatalf("error decrypting authenticator: %v", err)
+	}
+	assert.True(t, r.APREQ.Authenticator.CName.Equal(admin), "authenticator should be for the client principal")
+	assert.Equal(t, k, r.APREQ.Authenticator.SubKey, "reply key should be the authenticator's subkey")
+
+	if err := r.KRBPriv.DecryptEncPart(k); err != nil {
+		t.Fatalf("error decrypting KRB_PRIV: %v", err)
+	}
+	var d ChangePasswdData
+	if err := d.Unmarshal(r.KRBPriv.DecryptedEncPart.UserData); err != nil {
+		t.Fatalf("error unmarshaling change password data: %v", err)
+	}
+	assert.Equal(t, []byte("newpassword"), d.NewPasswd, "new password not as expected")
+	assert.True(t, d.TargName.Equal(target), "target principal not as expected")
+	assert.Equal(t, "OTHER.GOKRB5", d.TargRealm, "target realm not as expected")
+}
@@ -0,0 +1,182 @@
+package kdc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// asExchange processes an AS_REQ, RFC 4120 section 3.1.
+func (k *Server) asExchange(ctx context.Context, b []byte) ([]byte, error) {
+	var asReq messages.ASReq
+	if err := asReq.Unmarshal(b); err != nil {
+		return nil, k.krbError(types.PrincipalName{}, errorcode.KRB_AP_ERR_MSG_TYPE, fmt.Sprintf("could not unmarshal request: %v", err))
+	}
+	body := asReq.ReqBody
+	sname := body.SName
+	if body.Realm != k.realm {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_WRONG_REALM, fmt.Sprintf("KDC is for realm %s", k.realm))
+	}
+	if err := k.checkOptions(body); err != nil {
+		return nil, err
+	}
+	if types.IsFlagSet(&body.KDCOptions, flags.EncTktInSkey) || types.IsFlagSet(&body.KDCOptions, flags.Renew) {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_BADOPTION, "option not valid for an AS_REQ")
+	}
+	cp, err := k.principal(ctx, body.CName, sname, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN)
+	if err != nil {
+		return nil, err
+	}
+	sp, err := k.principal(ctx, sname, sname, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN)
+	if err != nil {
+		return nil, err
+	}
+	now := k.now()
+	if err := k.checkClient(cp, sname, now); err != nil {
+		return nil, err
+	}
+	if !cp.PasswordExpires.IsZero() && now.After(cp.PasswordExpires) && !sp.PasswordChangeService {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_KEY_EXPIRED, "password has expired")
+	}
+	if err := k.checkServer(sp, sname, now, false); err != nil {
+		return nil, err
+	}
+	et, ok := selectEType(body.EType, cp.etypes())
+	if !ok {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_ETYPE_NOSUPP, "client has no key of the encryption types requested")
+	}
+	ckey, _ := cp.key(et, 0)
+	preAuth, err := k.verifyPreAuth(asReq, cp, now)
+	if err != nil {
+		return nil, err
+	}
+	if types.IsFlagSet(&body.KDCOptions, flags.Forwardable) && cp.DisallowForwardable {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_POLICY, "client may not be issued forwardable tickets")
+	}
+	skey, ok := sp.ticketKey()
+	if !ok {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_ETYPE_NOSUPP, "server has no supported key")
+	}
+	g := &grant{
+		body:          body,
+		cname:         body.CName,
+		crealm:        k.realm,
+		sname:         sname,
+		flags:         types.NewKrbFlags(),
+		authTime:      now,
+		caddr:         body.Addresses,
+		keyExpiration: cp.PasswordExpires,
+	}
+	types.SetFlag(&g.flags, flags.Initial)
+	if preAuth {
+		types.SetFlag(&g.flags, flags.PreAuthent)
+	}
+	if types.IsFlagSet(&body.KDCOptions, flags.Forwardable) {
+		types.SetFlag(&g.flags, flags.Forwardable)
+	}
+	if sp.OKAsDelegate {
+		types.SetFlag(&g.flags, flags.OKAsDelegate)
+	}
+	if err := k.setTimes(g, now, cp, sp, time.Time{}, time.Time{}); err != nil {
+		return nil, err
+	}
+	tkt, ed, err := k.issue(g, skey, sp.etypes(), ckey.Key, keyusage.AS_REP_ENCPART, ckey.KVNO)
+	if err != nil {
+		return nil, err
+	}
+	asRep := messages.ASRep{
+		KDCRepFields: messages.KDCRepFields{
+			PVNO:    iana.PVNO,
+			MsgType: msgtype.KRB_AS_REP,
+			PAData:  types.PADataSequence{k.eTypeInfo2(cp, []int32{et})},
+			CRealm:  k.realm,
+			CName:   body.CName,
+			Ticket:  tkt,
+			EncPart: ed,
+		},
+	}
+	return asRep.Marshal()
+}
+
+// verifyPreAuth checks the encrypted timestamp pre-authentication of the AS_REQ, RFC 4120 section 5.2.7.2, returning
+// whether the client pre-authenticated. A KRB_ERROR requiring pre-authentication is returned if it is required but
+// not present.
+func (k *Server) verifyPreAuth(asReq messages.ASReq, cp Principal, now time.Time) (bool, error) {
+	sname := asReq.ReqBody.SName
+	for _, pa := range asReq.PAData {
+		if pa.PADataType != patype.PA_ENC_TIMESTAMP {
+			continue
+		}
+		var ed types.EncryptedData
+		if err := ed.Unmarshal(pa.PADataValue); err != nil {
+			return false, k.krbError(sname, errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal encrypted timestamp")
+		}
+		key, ok := cp.key(ed.EType, ed.KVNO)
+		if !ok {
+			return false, k.krbError(sname, errorcode.KDC_ERR_ETYPE_NOSUPP, "client has no key of the encrypted timestamp's encryption type")
+		}
+		tb, err := crypto.DecryptEncPart(ed, key.Key, keyusage.AS_REQ_PA_ENC_TIMESTAMP)
+		if err != nil {
+			return false, k.krbError(sname, errorcode.KDC_ERR_PREAUTH_FAILED, "could not decrypt encrypted timestamp")
+		}
+		var ts types.PAEncTSEnc
+		if err := ts.Unmarshal(tb); err != nil {
+			return false, k.krbError(sname, errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal timestamp")
+		}
+		if !k.withinSkew(ts.PATimestamp.Add(time.Duration(ts.PAUSec)*time.Microsecond), now) {
+			return false, k.krbError(sname, errorcode.KRB_AP_ERR_SKEW, "clock skew too great")
+		}
+		return true, nil
+	}
+	if !k.settings.RequirePreAuth() || cp.NoPreAuth {
+		return false, nil
+	}
+	e := k.krbError(sname, errorcode.KDC_ERR_PREAUTH_REQUIRED, "pre-authentication required")
+	e.CName = asReq.ReqBody.CName
+	e.CRealm = k.realm
+	e.EData, _ = asn1.Marshal(types.PADataSequence{
+		k.eTypeInfo2(cp, asReq.ReqBody.EType),
+		{PADataType: patype.PA_ENC_TIMESTAMP},
+	})
+	return false, e
+}
+
+// eTypeInfo2 returns the ETYPE-INFO2 PA data, RFC 4120 section 5.2.7.5, of the principal's latest keys of the etypes
+// requested, in the order requested.
+func (k *Server) eTypeInfo2(p Principal, etypes []int32) types.PAData {
+	var info types.ETypeInfo2
+	for _, et := range etypes {
+		key, ok := p.key(et, 0)
+		if !ok || containsETypeInfo(info, et) {
+			continue
+		}
+		salt := key.Salt
+		if salt == "" {
+			salt = p.Name.GetSalt(k.realm)
+		}
+		info = append(info, types.ETypeInfo2Entry{EType: et, Salt: salt})
+	}
+	b, _ := asn1.Marshal(info)
+	return types.PAData{PADataType: patype.PA_ETYPE_INFO2, PADataValue: b}
+}
+
+// containsETypeInfo indicates if the ETYPE-INFO2 has an entry for the etype.
+func containsETypeInfo(info types.ETypeInfo2, et int32) bool {
+	for _, e := range info {
+		if e.EType == et {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,351 @@
+// Package kdc implements a Kerberos V5 Key Distribution Center, RFC 4120, serving the AS and TGS exchanges of a
+// realm over UDP and TCP so that it can be embedded in appliances and development environments.
+//
+// The principals of the realm and their keys are read from a Store, which may be backed by any database. The
+// MemoryStore holds them in memory:
+//
+//	store := kdc.NewMemoryStore("EXAMPLE.COM")
+//	store.AddPrincipal("krbtgt/EXAMPLE.COM", "")
+//	store.AddPrincipal("user1", "password")
+//	store.AddPrincipal("HTTP/www.example.com", "")
+//	srv := kdc.NewServer("EXAMPLE.COM", store)
+//	err := srv.ListenAndServe(":88")
+//
+// Clients must pre-authenticate with an encrypted timestamp unless the KDC is configured otherwise. The KDC enforces
+// the principals' expiry, lifetime and ticket option policies, verifies the checksums of TGS_REQ bodies and rejects
+// replayed TGS_REQ authenticators. Tickets may be forwardable, renewable and user-to-user, ENC-TKT-IN-SKEY.
+//
+// The KDC does not issue PACs, implement FAST, PKINIT, S4U or postdated tickets, or issue cross-realm TGTs.
+package kdc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/logging"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const (
+	// maxTCPMessage is the maximum size of the requests read from TCP connections.
+	maxTCPMessage = 1 << 20
+	// maxUDPReply is the maximum size of the replies sent over UDP, larger replies being replaced by a
+	// KRB_ERR_RESPONSE_TOO_BIG error so that the client retries over TCP.
+	maxUDPReply = 4096
+	// tcpIdleTimeout is how long a TCP connection is kept open waiting for a request.
+	tcpIdleTimeout = 30 * time.Second
+)
+
+// Server is a KDC for a single realm. It is safe for concurrent use.
+type Server struct {
+	realm     string
+	store     Store
+	settings  *Settings
+	mux       sync.Mutex
+	listeners []io.Closer
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer returns a KDC for the realm with its principals in the store.
+func NewServer(realm string, store Store, settings ...func(*Settings)) *Server {
+	return &Server{
+		realm:    realm,
+		store:    store,
+		settings: NewSettings(settings...),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Realm returns the realm of the KDC.
+func (k *Server) Realm() string {
+	return k.realm
+}
+
+// ListenAndServe listens on the address for both UDP and TCP and serves requests until the KDC is closed.
+func (k *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on TCP: %w", err)
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		l.Close()
+		return fmt.Errorf("error listening on UDP: %w", err)
+	}
+	errs := make(chan error, 2)
+	go func() { errs <- k.ServeTCP(l) }()
+	go func() { errs <- k.ServeUDP(pc) }()
+	err = <-errs
+	k.Close()
+	if err2 := <-errs; err == nil {
+		err = err2
+	}
+	return err
+}
+
+// ServeTCP serves requests received on the listener's connections, RFC 4120 section 7.2.2, until the KDC is closed.
+// The listener is closed when the KDC is.
+func (k *Server) ServeTCP(l net.Listener) error {
+	if err := k.track(l); err != nil {
+		return err
+	}
+	defer k.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if k.isClosed() {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		if !k.trackConn(conn) {
+			conn.Close()
+			return nil
+		}
+		go func() {
+			defer k.wg.Done()
+			defer k.untrackConn(conn)
+			k.serveConn(conn)
+		}()
+	}
+}
+
+// serveConn serves the requests of the TCP connection until the client closes it or is idle.
+func (k *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		if !k.setIdleDeadline(conn) {
+			return
+		}
+		hb := make([]byte, 4)
+		if _, err := io.ReadFull(conn, hb); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(hb)
+		if n > maxTCPMessage {
+			// The high bit indicates an extension the KDC does not support, RFC 4120 section 7.2.2.
+			e := k.krbError(types.PrincipalName{}, errorcode.KRB_ERR_FIELD_TOOLONG, "request too long")
+			rb, _ := e.Marshal()
+			binary.BigEndian.PutUint32(hb, uint32(len(rb)))
+			conn.Write(append(hb, rb...))
+			return
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return
+		}
+		rb := k.Process(context.Background(), b, conn.RemoteAddr())
+		binary.BigEndian.PutUint32(hb, uint32(len(rb)))
+		if _, err := conn.Write(append(hb, rb...)); err != nil {
+			return
+		}
+	}
+}
+
+// ServeUDP serves the requests received on the packet connection, RFC 4120 section 7.2.1, until the KDC is closed.
+// The connection is closed when the KDC is.
+func (k *Server) ServeUDP(pc net.PacketConn) error {
+	if err := k.track(pc); err != nil {
+		return err
+	}
+	defer k.wg.Done()
+	for {
+		b := make([]byte, 65535)
+		n, addr, err := pc.ReadFrom(b)
+		if err != nil {
+			if k.isClosed() {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		k.wg.Add(1)
+		go func() {
+			defer k.wg.Done()
+			rb := k.Process(context.Background(), b[:n], addr)
+			if len(rb) > maxUDPReply {
+				e := k.krbError(types.PrincipalName{}, errorcode.KRB_ERR_RESPONSE_TOO_BIG, "response too big for UDP")
+				rb, _ = e.Marshal()
+			}
+			pc.WriteTo(rb, addr)
+		}()
+	}
+}
+
+// Close stops the KDC, closing its listeners and connections, and waits for the requests in progress to complete.
+func (k *Server) Close() error {
+	k.mux.Lock()
+	k.closed = true
+	ls := k.listeners
+	k.listeners = nil
+	for conn := range k.conns {
+		// Requests being processed are answered but connections waiting for a request are not kept open.
+		conn.SetReadDeadline(time.Now())
+	}
+	k.mux.Unlock()
+	var err error
+	for _, l := range ls {
+		if lerr := l.Close(); err == nil {
+			err = lerr
+		}
+	}
+	k.wg.Wait()
+	return err
+}
+
+// track adds the listener to those closed with the KDC.
+func (k *Server) track(l io.Closer) error {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if k.closed {
+		l.Close()
+		return errors.New("KDC is closed")
+	}
+	k.listeners = append(k.listeners, l)
+	k.wg.Add(1)
+	return nil
+}
+
+// trackConn adds the TCP connection to those closed with the KDC, returning false if it is closed.
+func (k *Server) trackConn(conn net.Conn) bool {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if k.closed {
+		return false
+	}
+	k.conns[conn] = struct{}{}
+	k.wg.Add(1)
+	return true
+}
+
+// setIdleDeadline sets the deadline of the TCP connection waiting for a request, returning false if the KDC is
+// closed.
+func (k *Server) setIdleDeadline(conn net.Conn) bool {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if k.closed {
+		return false
+	}
+	conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+	return true
+}
+
+// untrackConn removes the TCP connection from those closed with the KDC.
+func (k *Server) untrackConn(conn net.Conn) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	delete(k.conns, conn)
+}
+
+// isClosed indicates if the KDC has been closed.
+func (k *Server) isClosed() bool {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return k.closed
+}
+
+// Process returns the marshaled reply, a KRB_AS_REP, KRB_TGS_REP or KRB_ERROR, to the marshaled request from the
+// address, which may be nil if it is not known. It allows the KDC to serve requests received by other transports,
+// such as a KDC proxy.
+func (k *Server) Process(ctx context.Context, b []byte, addr net.Addr) []byte {
+	start := time.Now()
+	remote := "unknown"
+	if addr != nil {
+		remote = addr.String()
+	}
+	if k.settings.enabled(logging.LevelTrace) {
+		k.settings.log(logging.LevelTrace, "received from client", logging.F(logging.KeyRemoteAddr, remote),
+			logging.F(logging.KeyBytes, len(b)), logging.F(logging.KeyMessage, messages.Summary(b)))
+	}
+	var rb []byte
+	var err error
+	msgType := "unknown"
+	switch {
+	case len(b) > 0 && int(b[0]&0x1f) == asnAppTag.TGSREQ:
+		msgType = "TGS_REQ"
+		rb, err = k.tgsExchange(ctx, b, addr)
+	case len(b) > 0 && int(b[0]&0x1f) == asnAppTag.ASREQ:
+		msgType = "AS_REQ"
+		rb, err = k.asExchange(ctx, b)
+	default:
+		err = k.krbError(types.PrincipalName{}, errorcode.KRB_AP_ERR_MSG_TYPE, "request is not an AS_REQ or TGS_REQ")
+	}
+	fields := []logging.Field{
+		logging.F(logging.KeyRemoteAddr, remote),
+		logging.F(logging.KeyRealm, k.realm),
+		logging.F(logging.KeyMessageType, msgType),
+	}
+	if err != nil {
+		krberr, ok := err.(messages.KRBError)
+		if !ok {
+			k.settings.log(logging.LevelError, fmt.Sprintf("error processing request from %v: %v", addr, err),
+				append(fields, logging.F(logging.KeyError, err))...)
+			krberr = k.krbError(types.PrincipalName{}, errorcode.KRB_ERR_GENERIC, "internal error")
+		} else {
+			k.settings.log(logging.LevelInfo, fmt.Sprintf("request from %v rejected: %s", addr, krberr.Error()),
+				append(fields, logging.F(logging.KeyErrorCode, krberr.ErrorCode))...)
+		}
+		rb, _ = krberr.Marshal()
+		fields = append(fields, logging.F(logging.KeyErrorCode, krberr.ErrorCode))
+	}
+	if k.settings.enabled(logging.LevelDebug) {
+		k.settings.log(logging.LevelDebug, "request processed", append(fields, logging.F(logging.KeyDuration, time.Since(start)))...)
+	}
+	if k.settings.enabled(logging.LevelTrace) {
+		k.settings.log(logging.LevelTrace, "sent to client", logging.F(logging.KeyRemoteAddr, remote),
+			logging.F(logging.KeyBytes, len(rb)), logging.F(logging.KeyMessage, messages.Summary(rb)))
+	}
+	return rb
+}
+
+// krbError returns a KRB_ERROR with the time of the KDC's clock.
+func (k *Server) krbError(sname types.PrincipalName, code int32, etext string) messages.KRBError {
+	e := messages.NewKRBError(sname, k.realm, code, etext)
+	t := k.now()
+	e.STime = t
+	e.Susec = t.Nanosecond() / int(time.Microsecond)
+	return e
+}
+
+// now returns the time of the KDC's clock, truncated to the second as are the times of tickets.
+func (k *Server) now() time.Time {
+	return k.settings.Clock().Now().UTC().Truncate(time.Second)
+}
+
+// principal returns the principal from the store, answering with the error code if it does not exist.
+func (k *Server) principal(ctx context.Context, pn types.PrincipalName, sname types.PrincipalName, notFound int32) (Principal, error) {
+	p, err := k.store.Principal(ctx, pn)
+	if errors.Is(err, ErrPrincipalNotFound) {
+		return p, k.krbError(sname, notFound, fmt.Sprintf("principal %s not found", pn.PrincipalNameString()))
+	}
+	if err != nil {
+		return p, fmt.Errorf("error looking up principal %s: %w", pn.PrincipalNameString(), err)
+	}
+	return p, nil
+}
+
+// withinSkew indicates if the client's time is within the maximum clock skew of the KDC's.
+func (k *Server) withinSkew(t, now time.Time) bool {
+	d := now.Sub(t)
+	skew := k.settings.MaxClockSkew()
+	return d <= skew && d >= -skew
+}
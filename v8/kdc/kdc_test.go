@@ -0,0 +1,524 @@
+package kdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/logging"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRealm = "TEST.GOKRB5"
+	testSPN   = "HTTP/host.test.gokrb5"
+)
+
+// testServer starts a KDC with a TGS, user1 and testSPN principal, returning it with a client configuration for it.
+func testServer(t *testing.T, settings ...func(*Settings)) (*Server, *MemoryStore, *config.Config) {
+	store := NewMemoryStore(testRealm)
+	for _, p := range [][2]string{{"krbtgt/" + testRealm, ""}, {"user1", "password"}, {testSPN, ""}} {
+		if err := store.AddPrincipal(p[0], p[1]); err != nil {
+			t.Fatalf("error adding principal: %v", err)
+		}
+	}
+	srv := NewServer(testRealm, store, settings...)
+	var l net.Listener
+	var pc net.PacketConn
+	var err error
+	// The UDP port may already be in use so retry with another port.
+	for i := 0; i < 10; i++ {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("error listening on TCP: %v", err)
+		}
+		pc, err = net.ListenPacket("udp", l.Addr().String())
+		if err == nil {
+			break
+		}
+		l.Close()
+	}
+	if err != nil {
+		t.Fatalf("error listening on UDP: %v", err)
+	}
+	go srv.ServeTCP(l)
+	go srv.ServeUDP(pc)
+	c, err := config.NewFromString(fmt.Sprintf(`[libdefaults]
+  default_realm = %s
+  dns_lookup_kdc = false
+  dns_lookup_realm = false
+  renew_lifetime = 24h
+
+[realms]
+  %s = {
+    kdc = %s
+  }`, testRealm, testRealm, l.Addr().String()))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+	return srv, store, c
+}
+
+// testKeytab returns a keytab of the principal's keys in the store.
+func testKeytab(t *testing.T, store *MemoryStore, name string) *keytab.Keytab {
+	pn, _ := types.ParseSPNString(name)
+	p, err := store.Principal(context.Background(), pn)
+	if err != nil {
+		t.Fatalf("error getting principal: %v", err)
+	}
+	kt := keytab.New()
+	for _, k := range p.Keys {
+		kt.AddKey(name, testRealm, k.Key, uint32(k.KVNO))
+	}
+	return kt
+}
+
+// assertErrorCode asserts that the error is a KRBError with the code.
+func assertErrorCode(t *testing.T, err error, code int32, msg string) {
+	var krberr messages.KRBError
+	if assert.True(t, errors.As(err, &krberr), "error should be a KRBError: %v", err) {
+		assert.Equal(t, code, krberr.ErrorCode, msg)
+	}
+}
+
+func TestServer_ServiceTicket(t *testing.T) {
+	t.Parallel()
+	srv, store, c := testServer(t)
+	defer srv.Close()
+	cl := client.NewWithPassword("user1", testRealm, "password", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	tkt, key, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		t.Fatalf("error creating AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(testKeytab(t, store, testSPN), service.DecodePAC(false)))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted: %v", err)
+	}
+	assert.Equal(t, "user1", creds.UserName(), "client principal not as expected")
+
+	// The KDC serves TCP too.
+	c.LibDefaults.UDPPreferenceLimit = 1
+	cl = client.NewWithPassword("user1", testRealm, "password", c)
+	assert.NoError(t, cl.Login(), "error logging in over TCP")
+}
+
+func TestServer_PreAuth(t *testing.T) {
+	t.Parallel()
+	srv, store, c := testServer(t)
+	defer srv.Close()
+	err := client.NewWithPassword("user1", testRealm, "wrongpassword", c).Login()
+	assertErrorCode(t, err, errorcode.KDC_ERR_PREAUTH_FAILED, "error code for wrong password not as expected")
+
+	// A new password is effective immediately.
+	if err := store.AddPrincipal("user1", "newpassword"); err != nil {
+		t.Fatalf("error changing password: %v", err)
+	}
+	err = client.NewWithPassword("user1", testRealm, "password", c).Login()
+	assertErrorCode(t, err, errorcode.KDC_ERR_PREAUTH_FAILED, "old password should not be accepted")
+	assert.NoError(t, client.NewWithPassword("user1", testRealm, "newpassword", c).Login(), "error logging in with new password")
+
+	err = client.NewWithPassword("unknown", testRealm, "password", c).Login()
+	assertErrorCode(t, err, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, "error code for unknown client not as expected")
+}
+
+func TestServer_Policy(t *testing.T) {
+	t.Parallel()
+	srv, store, c := testServer(t)
+	defer srv.Close()
+	pn, _ := types.ParseSPNString("user1")
+	p, _ := store.Principal(context.Background(), pn)
+
+	var tests = []struct {
+		name string
+		set  func(p *Principal)
+		code int32
+	}{
+		{"disabled", func(p *Principal) { p.Disabled = true }, errorcode.KDC_ERR_CLIENT_REVOKED},
+		{"expired", func(p *Principal) { p.Expires = time.Now().Add(-time.Hour) }, errorcode.KDC_ERR_NAME_EXP},
+		{"password expired", func(p *Principal) { p.PasswordExpires = time.Now().Add(-time.Hour) }, errorcode.KDC_ERR_KEY_EXPIRED},
+	}
+	for _, test := range tests {
+		np := p
+		test.set(&np)
+		store.Put(np)
+		err := client.NewWithPassword("user1", testRealm, "password", c).Login()
+		assertErrorCode(t, err, test.code, fmt.Sprintf("error code for %s client not as expected", test.name))
+	}
+	store.Put(p)
+
+	cl := client.NewWithPassword("user1", testRealm, "password", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	spn, _ := types.ParseSPNString(testSPN)
+	sp, _ := store.Principal(context.Background(), spn)
+	sp.DisallowServer = true
+	store.Put(sp)
+	_, _, err := cl.GetServiceTicket(testSPN)
+	assertErrorCode(t, err, errorcode.KDC_ERR_MUST_USE_USER2USER, "error code for disallowed server not as expected")
+	_, _, err = cl.GetServiceTicket("HTTP/unknown.test.gokrb5")
+	assertErrorCode(t, err, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "error code for unknown server not as expected")
+}
+
+func TestServer_TGSReq(t *testing.T) {
+	t.Parallel()
+	srv, _, c := testServer(t)
+	defer srv.Close()
+	cl := client.NewWithPassword("user1", testRealm, "password", c)
+	tgt, key, err := cl.TGT()
+	if err != nil {
+		t.Fatalf("error getting TGT: %v", err)
+	}
+	assert.True(t, tgt.EncPart.KVNO > 0, "TGT should have the kvno of the TGS key")
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, testSPN)
+
+	tgsReq, err := messages.NewTGSReq(cl.Credentials.CName(), testRealm, c, tgt, key, sname, false)
+	if err != nil {
+		t.Fatalf("error creating TGS_REQ: %v", err)
+	}
+	b, err := tgsReq.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling TGS_REQ: %v", err)
+	}
+	var tgsRep messages.TGSRep
+	if err := tgsRep.Unmarshal(srv.Process(context.Background(), b, nil)); err != nil {
+		t.Fatalf("TGS_REQ not accepted: %v", err)
+	}
+	if err := tgsRep.DecryptEncPart(key); err != nil {
+		t.Fatalf("error decrypting TGS_REP: %v", err)
+	}
+	assert.Equal(t, tgsReq.ReqBody.Nonce, tgsRep.DecryptedEncPart.Nonce, "nonce not as expected")
+
+	// The same authenticator is rejected as a replay.
+	var krberr messages.KRBError
+	if assert.NoError(t, krberr.Unmarshal(srv.Process(context.Background(), b, nil)), "replay should be rejected with a KRB_ERROR") {
+		assert.Equal(t, errorcode.KRB_AP_ERR_REPEAT, krberr.ErrorCode, "error code for replay not as expected")
+	}
+
+	// A body that does not match the authenticator's checksum is rejected.
+	tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), testRealm, c, tgt, key, sname, false)
+	if err != nil {
+		t.Fatalf("error creating TGS_REQ: %v", err)
+	}
+	tgsReq.ReqBody.Till = tgsReq.ReqBody.Till.Add(time.Hour)
+	b, err = tgsReq.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling TGS_REQ: %v", err)
+	}
+	if assert.NoError(t, krberr.Unmarshal(srv.Process(context.Background(), b, nil)), "modified request should be rejected with a KRB_ERROR") {
+		assert.Equal(t, errorcode.KRB_AP_ERR_MODIFIED, krberr.ErrorCode, "error code for modified request not as expected")
+	}
+
+	if assert.NoError(t, krberr.Unmarshal(srv.Process(context.Background(), []byte{0x30, 0x00}, nil)), "invalid request should be rejected with a KRB_ERROR") {
+		assert.Equal(t, errorcode.KRB_AP_ERR_MSG_TYPE, krberr.ErrorCode, "error code for invalid request not as expected")
+	}
+}
+
+func TestServer_Renewal(t *testing.T) {
+	t.Parallel()
+	srv, _, c := testServer(t, MaxTicketLifetime(time.Hour), MaxRenewLifetime(2*time.Hour))
+	defer srv.Close()
+	cl := client.NewWithPassword("user1", testRealm, "password", c)
+	tgt, key, err := cl.TGT()
+	if err != nil {
+		t.Fatalf("error getting TGT: %v", err)
+	}
+	spn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testRealm)
+	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, testRealm, tgt, key, true)
+	if err != nil {
+		t.Fatalf("error renewing TGT: %v", err)
+	}
+	ep := tgsRep.DecryptedEncPart
+	assert.True(t, types.IsFlagSet(&ep.Flags, flags.Renewable), "renewed TGT should be renewable")
+	assert.False(t, types.IsFlagSet(&ep.Flags, flags.Initial), "renewed TGT should not be initial")
+	assert.Equal(t, key, ep.Key, "renewed TGT should have the same session key")
+	assert.True(t, ep.RenewTill.Sub(ep.AuthTime) <= 2*time.Hour, "renew till not limited by the KDC")
+}
+
+func TestServer_User2User(t *testing.T) {
+	t.Parallel()
+	srv, store, c := testServer(t)
+	defer srv.Close()
+	if err := store.AddPrincipal("peeruser", "peerpassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	peer := client.NewWithPassword("peeruser", testRealm, "peerpassword", c)
+	tgt, _, err := peer.TGT()
+	if err != nil {
+		t.Fatalf("error getting peer's TGT: %v", err)
+	}
+	cl := client.NewWithPassword("user1", testRealm, "password", c)
+	tkt, key, err := cl.GetUser2UserServiceTicket("peeruser", tgt)
+	if err != nil {
+		t.Fatalf("error getting user-to-user ticket: %v", err)
+	}
+	auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		t.Fatalf("error creating AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(nil, service.User2User(peer), service.DecodePAC(false)))
+	if !ok || err != nil {
+		t.Fatalf("user-to-user AP_REQ not accepted: %v", err)
+	}
+	assert.Equal(t, "user1", creds.UserName(), "client principal not as expected")
+
+	_, _, err = cl.GetUser2UserServiceTicket(testSPN, tgt)
+	assertErrorCode(t, err, errorcode.KDC_ERR_SERVER_NOMATCH, "error code for TGT of another principal not as expected")
+}
+
+func TestMemoryStore_AddPrincipal(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore(testRealm)
+	pn, _ := types.ParseSPNString("user1")
+	_, err := store.Principal(context.Background(), pn)
+	assert.True(t, errors.Is(err, ErrPrincipalNotFound), "error for missing principal not as expected: %v", err)
+
+	if err := store.AddPrincipal("user1", "password"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	p, _ := store.Principal(context.Background(), pn)
+	p.MaxLife = time.Hour
+	store.Put(p)
+	if err := store.AddPrincipal("user1", "newpassword"); err != nil {
+		t.Fatalf("error changing password: %v", err)
+	}
+	p, err = store.Principal(context.Background(), pn)
+	if err != nil {
+		t.Fatalf("error getting principal: %v", err)
+	}
+	assert.Equal(t, len(DefaultETypes), len(p.Keys), "number of keys not as expected")
+	for _, k := range p.Keys {
+		assert.Equal(t, 2, k.KVNO, "kvno not incremented")
+	}
+	assert.Equal(t, time.Hour, p.MaxLife, "attributes should be kept")
+
+	store.Delete("user1")
+	_, err = store.Principal(context.Background(), pn)
+	assert.True(t, errors.Is(err, ErrPrincipalNotFound), "principal not deleted")
+}
+
+func TestServer_StructuredLogger(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	l := logging.NewJSONLogger(&buf, logging.LevelTrace)
+	srv, _, c := testServer(t, StructuredLogger(l))
+	defer srv.Close()
+	err := client.NewWithPassword("user1", testRealm, "wrongpassword", c).Login()
+	assertErrorCode(t, err, errorcode.KDC_ERR_PREAUTH_FAILED, "error code for wrong password not as expected")
+
+	var processed, traced int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("log line is not valid JSON: %v: %s", err, line)
+		}
+		switch m["msg"] {
+		case "request processed":
+			processed++
+			assert.Equal(t, "DEBUG", m["level"], "level not as expected")
+			assert.Equal(t, "AS_REQ", m[logging.KeyMessageType], "message type not as expected")
+			assert.Equal(t, testRealm, m[logging.KeyRealm], "realm not as expected")
+			assert.NotEmpty(t, m[logging.KeyRemoteAddr], "remote address should be logged")
+			assert.Contains(t, m, logging.KeyDuration, "duration should be logged")
+		case "received from client", "sent to client":
+			traced++
+			assert.Equal(t, "TRACE", m["level"], "level not as expected")
+			assert.NotEmpty(t, m[logging.KeyMessage], "message summary should be logged")
+		}
+	}
+	assert.True(t, processed > 0, "requests processed not logged: %s", buf.String())
+	assert.Equal(t, 2*processed, traced, "requests and replies not traced")
+	assert.Contains(t, buf.String(), fmt.Sprintf(`"error_code":%d`, errorcode.KDC_ERR_PREAUTH_FAILED), "error code not logged")
+}
+
+func TestServer_LoginEvent(t *testing.T) {
+	t.Parallel()
+	srv, _, c := testServer(t)
+	defer srv.Close()
+	logins := make(chan client.TicketEvent, 1)
+	cl := client.NewWithPassword("user1", testRealm, "password", c, client.Events(client.LifecycleEvents{
+		OnLogin: func(e client.TicketEvent) {
+			logins <- e
+		},
+	}))
+	defer cl.Destroy()
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	select {
+	case e := <-logins:
+		assert.Equal(t, "krbtgt/"+testRealm, e.SPN, "SPN not as expected")
+		assert.Equal(t, testRealm, e.Realm, "realm not as expected")
+		assert.True(t, e.EndTime.After(e.AuthTime), "end time not as expected")
+	default:
+		t.Fatal("login callback not called")
+	}
+}
+
+func TestServer_TicketOptions(t *testing.T) {
+	t.Parallel()
+	srv, _, c := testServer(t)
+	defer srv.Close()
+	c.LibDefaults.Forwardable = true
+	cl := client.NewWithPassword("user1", testRealm, "password", c)
+	defer cl.Destroy()
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	if _, _, err := cl.GetServiceTicket(testSPN); err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	e, _ := cl.GetCachedEntry(testSPN)
+	assert.True(t, e.HasFlag(flags.Forwardable), "ticket should be forwardable by default")
+	assert.True(t, e.HasFlag(flags.Renewable), "ticket should be renewable by default")
+
+	_, _, err := cl.GetServiceTicketWithOptions(context.Background(), testSPN, client.TicketForwardable(false),
+		client.TicketRenewLifetime(0), client.TicketLifetime(10*time.Minute))
+	if err != nil {
+		t.Fatalf("error getting service ticket with options: %v", err)
+	}
+	e, ok := cl.GetCachedEntry(testSPN)
+	if !assert.True(t, ok, "ticket should be cached") {
+		return
+	}
+	assert.False(t, e.HasFlag(flags.Forwardable), "ticket should not be forwardable")
+	assert.False(t, e.HasFlag(flags.Renewable), "ticket should not be renewable")
+	assert.True(t, e.EndTime.Sub(e.StartTime) <= 10*time.Minute, "lifetime not as requested: %v", e.EndTime.Sub(e.StartTime))
+}
+
+func TestServer_AddressedTickets(t *testing.T) {
+	t.Parallel()
+	srv, store, c := testServer(t)
+	defer srv.Close()
+	c.LibDefaults.NoAddresses = false
+	c.LibDefaults.ExtraAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	cl := client.NewWithPassword("user1", testRealm, "password", c)
+	defer cl.Destroy()
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	// The TGS_REQ is sent from 127.0.0.1, one of the addresses of the TGT.
+	tkt, key, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	kt := testKeytab(t, store, testSPN)
+	verify := func(settings ...func(*service.Settings)) error {
+		auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+		apReq, err := messages.NewAPReq(tkt, key, auth)
+		if err != nil {
+			t.Fatalf("error creating AP_REQ: %v", err)
+		}
+		ok, _, err := service.VerifyAPREQ(&apReq, service.NewSettings(kt, append(settings, service.DecodePAC(false))...))
+		if err == nil && !ok {
+			err = errors.New("AP_REQ not accepted")
+		}
+		if err == nil {
+			assert.True(t, apReq.Ticket.DecryptedEncPart.CAddr.Contains(types.HostAddressFromNetIP(net.ParseIP("127.0.0.1"))),
+				"ticket should be issued for the client's addresses")
+		}
+		return err
+	}
+	local := types.HostAddressFromNetIP(net.ParseIP("127.0.0.1"))
+	other := types.HostAddressFromNetIP(net.ParseIP("192.0.2.1"))
+	assert.NoError(t, verify(service.ClientAddress(local), service.RequireHostAddr(true)), "ticket should be accepted from its address")
+	assertErrorCode(t, verify(service.ClientAddress(other)), errorcode.KRB_AP_ERR_BADADDR, "ticket should be rejected from another address")
+	assert.NoError(t, verify(service.ClientAddress(other), service.VerifyHostAddr(false)), "address should not be checked")
+}
+
+func TestClient_WithPrincipal(t *testing.T) {
+	t.Parallel()
+	srv, store, c := testServer(t)
+	defer srv.Close()
+	kt := keytab.New()
+	for _, name := range []string{"svc1", "svc2"} {
+		if err := store.AddPrincipal(name, name+"-password"); err != nil {
+			t.Fatalf("error adding principal: %v", err)
+		}
+		kt.Entries = append(kt.Entries, testKeytab(t, store, name).Entries...)
+	}
+	skt := testKeytab(t, store, testSPN)
+	authenticate := func(cl *client.Client) string {
+		if err := cl.Login(); err != nil {
+			t.Fatalf("error logging in %s: %v", cl.Credentials.UserName(), err)
+		}
+		tkt, key, err := cl.GetServiceTicket(testSPN)
+		if err != nil {
+			t.Fatalf("error getting service ticket: %v", err)
+		}
+		auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+		apReq, err := messages.NewAPReq(tkt, key, auth)
+		if err != nil {
+			t.Fatalf("error creating AP_REQ: %v", err)
+		}
+		ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(skt, service.DecodePAC(false)))
+		if !ok || err != nil {
+			t.Fatalf("AP_REQ not verified: %v", err)
+		}
+		return creds.UserName()
+	}
+
+	cl := client.NewWithKeytab("svc1", testRealm, kt, c)
+	defer cl.Destroy()
+	own, err := cl.WithPrincipal("svc1", "")
+	if err != nil {
+		t.Fatalf("error selecting the client's own principal: %v", err)
+	}
+	assert.True(t, own == cl, "the client should be returned for its own principal")
+	assert.Equal(t, "svc1", authenticate(cl), "service not authenticated as the client's principal")
+
+	svc2, err := cl.WithPrincipal("svc2", testRealm)
+	if err != nil {
+		t.Fatalf("error selecting principal from the keytab: %v", err)
+	}
+	assert.Equal(t, "svc2", authenticate(svc2), "service not authenticated as the principal selected")
+	again, err := cl.WithPrincipal("svc2", testRealm)
+	if err != nil {
+		t.Fatalf("error selecting principal again: %v", err)
+	}
+	assert.True(t, again == svc2, "the client of the collection should be reused")
+	_, ok := again.GetCachedEntry(testSPN)
+	assert.True(t, ok, "service ticket of the principal should be cached")
+
+	user1 := cl.AddPrincipal(credentials.New("user1", testRealm).WithPassword("password"))
+	assert.Equal(t, "user1", authenticate(user1), "service not authenticated as the principal added")
+	sel, err := svc2.WithPrincipal("user1", "")
+	if err != nil {
+		t.Fatalf("error selecting principal added from another client of the collection: %v", err)
+	}
+	assert.True(t, sel == user1, "client of the principal added not returned")
+	assert.Equal(t, 2, len(cl.Principals()), "principals of the collection not as expected")
+
+	_, err = cl.WithPrincipal("nobody", "")
+	assert.Error(t, err, "selecting a principal without credentials should fail")
+
+	cl.Close()
+	assert.Equal(t, 0, len(svc2.Principals()), "clients of the collection should be closed with its first principal")
+	_, ok = svc2.GetCachedEntry(testSPN)
+	assert.False(t, ok, "cache of the principal should be cleared")
+}
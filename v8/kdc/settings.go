@@ -0,0 +1,194 @@
+package kdc
+
+import (
+	"log"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/logging"
+	"github.com/jcmturner/gokrb5/v8/service"
+)
+
+// Default limits of the KDC.
+const (
+	// DefaultMaxTicketLifetime is the maximum lifetime of the tickets issued by default.
+	DefaultMaxTicketLifetime = 10 * time.Hour
+	// DefaultMaxRenewLifetime is the maximum period the tickets issued can be renewed for by default.
+	DefaultMaxRenewLifetime = 7 * 24 * time.Hour
+	// DefaultMaxClockSkew is the maximum clock skew of clients accepted by default.
+	DefaultMaxClockSkew = 5 * time.Minute
+)
+
+// Settings defines the configuration of a Server.
+type Settings struct {
+	maxTicketLifetime time.Duration
+	maxRenewLifetime  time.Duration
+	maxClockSkew      time.Duration
+	requirePreAuth    bool
+	replayCache       service.ReplayCache
+	logger            *log.Logger
+	structuredLogger  logging.Logger
+	clock             clock.Clock
+}
+
+// NewSettings creates a new Settings. By default pre-authentication is required and the limits are the Default
+// constants.
+func NewSettings(settings ...func(*Settings)) *Settings {
+	s := &Settings{
+		maxTicketLifetime: DefaultMaxTicketLifetime,
+		maxRenewLifetime:  DefaultMaxRenewLifetime,
+		maxClockSkew:      DefaultMaxClockSkew,
+		requirePreAuth:    true,
+	}
+	for _, set := range settings {
+		set(s)
+	}
+	if s.replayCache == nil && s.clock != nil {
+		s.replayCache = service.NewReplayCache(s.MaxClockSkew(), s.clock)
+	}
+	return s
+}
+
+// MaxTicketLifetime used to configure the maximum lifetime of the tickets issued, which the principals' MaxLife may
+// limit further.
+//
+// s := NewSettings(MaxTicketLifetime(time.Hour))
+func MaxTicketLifetime(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.maxTicketLifetime = d
+	}
+}
+
+// MaxTicketLifetime returns the maximum lifetime of the tickets issued.
+func (s *Settings) MaxTicketLifetime() time.Duration {
+	return s.maxTicketLifetime
+}
+
+// MaxRenewLifetime used to configure the maximum period the tickets issued can be renewed for, which the principals'
+// MaxRenewableLife may limit further.
+//
+// s := NewSettings(MaxRenewLifetime(24 * time.Hour))
+func MaxRenewLifetime(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.maxRenewLifetime = d
+	}
+}
+
+// MaxRenewLifetime returns the maximum period the tickets issued can be renewed for.
+func (s *Settings) MaxRenewLifetime() time.Duration {
+	return s.maxRenewLifetime
+}
+
+// MaxClockSkew used to configure the maximum difference between the KDC's clock and the times of clients'
+// pre-authentication timestamps and authenticators.
+//
+// s := NewSettings(MaxClockSkew(time.Minute))
+func MaxClockSkew(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.maxClockSkew = d
+	}
+}
+
+// MaxClockSkew returns the maximum difference between the KDC's clock and the clients' times.
+func (s *Settings) MaxClockSkew() time.Duration {
+	return s.maxClockSkew
+}
+
+// RequirePreAuth used to configure whether clients must authenticate with an encrypted timestamp before they are
+// issued tickets, other than the principals with NoPreAuth set. Without pre-authentication anyone can obtain
+// material encrypted with a principal's key to attack its password offline.
+//
+// s := NewSettings(RequirePreAuth(false))
+func RequirePreAuth(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.requirePreAuth = b
+	}
+}
+
+// RequirePreAuth returns whether clients must pre-authenticate.
+func (s *Settings) RequirePreAuth() bool {
+	return s.requirePreAuth
+}
+
+// ReplayCache used to configure the replay cache detecting replayed authenticators of TGS_REQs, such as one shared by
+// the KDCs of a realm.
+//
+// s := NewSettings(ReplayCache(rc))
+func ReplayCache(rc service.ReplayCache) func(*Settings) {
+	return func(s *Settings) {
+		s.replayCache = rc
+	}
+}
+
+// ReplayCache returns the replay cache of the KDC, which is the per process service.Cache if none is configured.
+func (s *Settings) ReplayCache() service.ReplayCache {
+	if s.replayCache == nil {
+		return service.GetReplayCache(s.MaxClockSkew())
+	}
+	return s.replayCache
+}
+
+// Logger used to configure the logger of the requests rejected by the KDC.
+//
+// s := NewSettings(Logger(l))
+func Logger(l *log.Logger) func(*Settings) {
+	return func(s *Settings) {
+		s.logger = l
+	}
+}
+
+// Logger returns the logger of the KDC, which may be nil.
+func (s *Settings) Logger() *log.Logger {
+	return s.logger
+}
+
+// StructuredLogger used to configure the KDC with a leveled logger of structured fields, such as the client address,
+// message type, error code and time taken of each request processed at logging.LevelDebug, and the summaries of the
+// requests and replies at logging.LevelTrace. It is used instead of the Logger if both are configured.
+//
+// s := NewSettings(StructuredLogger(l))
+func StructuredLogger(l logging.Logger) func(*Settings) {
+	return func(s *Settings) {
+		s.structuredLogger = l
+	}
+}
+
+// StructuredLogger returns the KDC's structured logger. If none is configured it is a logger writing the messages of
+// logging.LevelInfo and above to the Logger, or nil if there is no Logger either.
+func (s *Settings) StructuredLogger() logging.Logger {
+	if s.structuredLogger != nil {
+		return s.structuredLogger
+	}
+	if s.logger != nil {
+		return logging.NewTextLogger(s.logger, logging.LevelInfo)
+	}
+	return nil
+}
+
+// Clock used to configure the clock the KDC issues tickets and checks clients' times with, for example a fake clock
+// in tests. Unless a ReplayCache is configured the KDC then uses its own replay cache, timed with the clock.
+//
+// s := NewSettings(Clock(c))
+func Clock(c clock.Clock) func(*Settings) {
+	return func(s *Settings) {
+		s.clock = c
+	}
+}
+
+// Clock returns the clock of the KDC.
+func (s *Settings) Clock() clock.Clock {
+	return clock.OrReal(s.clock)
+}
+
+// log writes the message with the fields to the structured logger if one is configured and the level is enabled.
+func (s *Settings) log(level logging.Level, msg string, fields ...logging.Field) {
+	if l := s.StructuredLogger(); l != nil && l.Enabled(level) {
+		l.Log(level, msg, fields...)
+	}
+}
+
+// enabled indicates if messages of the level are logged.
+func (s *Settings) enabled(level logging.Level) bool {
+	l := s.StructuredLogger()
+	return l != nil && l.Enabled(level)
+}
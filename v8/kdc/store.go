@@ -0,0 +1,184 @@
+package kdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ErrPrincipalNotFound is returned by a Store for a principal that is not in the realm's database.
+var ErrPrincipalNotFound = errors.New("principal not found")
+
+// DefaultETypes are the encryption types of the keys MemoryStore.AddPrincipal creates if none are specified.
+var DefaultETypes = []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96}
+
+// Store is the database of the principals of the KDC's realm and their long-term keys. Implementations backed by a
+// file, SQL database or directory allow the principals to be managed outside of the KDC and must be safe for
+// concurrent use.
+type Store interface {
+	// Principal returns the principal with the name, such as "user1" or "HTTP/host.example.com", or an error wrapping
+	// ErrPrincipalNotFound if the realm has no such principal.
+	Principal(ctx context.Context, name types.PrincipalName) (Principal, error)
+}
+
+// Principal is an entry of the realm's database. The zero values of the times and lifetimes are not limits.
+type Principal struct {
+	Name types.PrincipalName
+	// Keys of the principal, of all the kvnos tickets may still be encrypted with.
+	Keys []Key
+	// Disabled principals are not issued tickets, nor tickets for them.
+	Disabled bool
+	// Expires is when the principal's entry expires.
+	Expires time.Time
+	// PasswordExpires is when the principal's password expires, after which it is only issued tickets to change it.
+	PasswordExpires time.Time
+	// MaxLife is the maximum lifetime of the tickets to or for the principal.
+	MaxLife time.Duration
+	// MaxRenewableLife is the maximum period the tickets to or for the principal can be renewed for.
+	MaxRenewableLife time.Duration
+	// NoPreAuth allows the principal to authenticate without pre-authentication even if the KDC requires it.
+	NoPreAuth bool
+	// DisallowForwardable prevents forwardable tickets being issued to the principal.
+	DisallowForwardable bool
+	// DisallowRenewable prevents renewable tickets being issued to or for the principal.
+	DisallowRenewable bool
+	// DisallowServer prevents tickets being issued for the principal other than user-to-user tickets.
+	DisallowServer bool
+	// OKAsDelegate sets the ok-as-delegate flag of the tickets issued for the principal.
+	OKAsDelegate bool
+	// PasswordChangeService marks the principal, such as kadmin/changepw, as the service that principals with
+	// expired passwords are issued tickets for.
+	PasswordChangeService bool
+}
+
+// Key is a long-term key of a principal.
+type Key struct {
+	KVNO int
+	Key  types.EncryptionKey
+	// Salt the key was derived from the password with, if not the default salt of the principal's name.
+	Salt string
+}
+
+// key returns the principal's key of the etype with the kvno, its latest of the etype if the kvno is zero.
+func (p Principal) key(etype int32, kvno int) (Key, bool) {
+	var k Key
+	var ok bool
+	for _, pk := range p.Keys {
+		if pk.Key.KeyType != etype {
+			continue
+		}
+		if kvno != 0 && pk.KVNO == kvno {
+			return pk, true
+		}
+		if kvno == 0 && (!ok || pk.KVNO > k.KVNO) {
+			k, ok = pk, true
+		}
+	}
+	return k, ok
+}
+
+// etypes returns the encryption types of the principal's keys.
+func (p Principal) etypes() []int32 {
+	var ets []int32
+	for _, k := range p.Keys {
+		if !containsEType(ets, k.Key.KeyType) {
+			ets = append(ets, k.Key.KeyType)
+		}
+	}
+	return ets
+}
+
+// MemoryStore is a Store holding the principals in memory, for development environments and tests.
+type MemoryStore struct {
+	realm      string
+	principals map[string]Principal
+	mux        sync.RWMutex
+}
+
+// NewMemoryStore returns an empty MemoryStore for the realm. The KDC's own principal, krbtgt/REALM, must be added
+// before it issues tickets.
+func NewMemoryStore(realm string) *MemoryStore {
+	return &MemoryStore{
+		realm:      realm,
+		principals: make(map[string]Principal),
+	}
+}
+
+// Principal implements Store.
+func (m *MemoryStore) Principal(ctx context.Context, name types.PrincipalName) (Principal, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	p, ok := m.principals[name.PrincipalNameString()]
+	if !ok {
+		return p, fmt.Errorf("%s: %w", name.PrincipalNameString(), ErrPrincipalNotFound)
+	}
+	return p, nil
+}
+
+// Put adds the principal, replacing any with the same name.
+func (m *MemoryStore) Put(p Principal) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.principals[p.Name.PrincipalNameString()] = p
+}
+
+// Delete removes the principal.
+func (m *MemoryStore) Delete(name string) {
+	pn, _ := types.ParseSPNString(name)
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.principals, pn.PrincipalNameString())
+}
+
+// AddPrincipal adds a principal, such as "user1" or "HTTP/host.example.com", with keys derived from the password for
+// the encryption types provided, or DefaultETypes if none are. Adding an existing principal replaces its keys with
+// those of the next kvno, keeping its other attributes. A random key is created for an empty password.
+func (m *MemoryStore) AddPrincipal(name, password string, etypes ...int32) error {
+	if len(etypes) < 1 {
+		etypes = DefaultETypes
+	}
+	pn, _ := types.ParseSPNString(name)
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	p, ok := m.principals[pn.PrincipalNameString()]
+	if !ok {
+		p = Principal{Name: pn}
+	}
+	kvno := 1
+	for _, k := range p.Keys {
+		if k.KVNO >= kvno {
+			kvno = k.KVNO + 1
+		}
+	}
+	keys := make([]Key, 0, len(etypes))
+	for _, et := range etypes {
+		key, err := newKey(pn, m.realm, password, et)
+		if err != nil {
+			return fmt.Errorf("error creating key for %s with etype %d: %w", name, et, err)
+		}
+		keys = append(keys, Key{KVNO: kvno, Key: key})
+	}
+	p.Keys = keys
+	m.principals[pn.PrincipalNameString()] = p
+	return nil
+}
+
+// newKey derives the key of the etype from the password with the principal's default salt, or generates a random
+// key if the password is empty.
+func newKey(pn types.PrincipalName, realm, password string, et int32) (types.EncryptionKey, error) {
+	if password == "" {
+		e, err := crypto.GetEtype(et)
+		if err != nil {
+			return types.EncryptionKey{}, err
+		}
+		return types.GenerateEncryptionKey(e)
+	}
+	key, _, err := crypto.GetKeyFromPassword(password, pn, realm, et, types.PADataSequence{})
+	return key, err
+}
@@ -0,0 +1,136 @@
+// Package testkdc provides an in-memory KDC, serving AS and TGS exchanges over loopback UDP and TCP, so that the
+// integration tests of projects using gokrb5 can log in and get service tickets without Docker or an MIT KDC.
+//
+//	k, err := testkdc.New("TEST.GOKRB5")
+//	defer k.Close()
+//	err = k.AddPrincipal("user1", "password")
+//	err = k.AddPrincipal("HTTP/host.test.gokrb5", "")
+//	cfg, err := k.Config()
+//	cl := client.NewWithPassword("user1", "TEST.GOKRB5", "password", cfg)
+//	kt, err := k.Keytab("HTTP/host.test.gokrb5")
+//
+// The KDC is a kdc.Server with a kdc.MemoryStore, so it enforces the same pre-authentication and policy checks. The
+// krbtest package provides a KDC that can also script errors, clock skew and latency.
+package testkdc
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/kdc"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// KDC is an in-memory KDC for a single realm listening on loopback.
+type KDC struct {
+	realm string
+	store *kdc.MemoryStore
+	srv   *kdc.Server
+	addr  string
+}
+
+// New starts a KDC for the realm listening on the same loopback port for UDP and TCP, configured with the kdc
+// settings provided. The KDC has the principal krbtgt/REALM with a random key and should be closed once the test is
+// complete.
+func New(realm string, settings ...func(*kdc.Settings)) (*KDC, error) {
+	store := kdc.NewMemoryStore(realm)
+	if err := store.AddPrincipal("krbtgt/"+realm, ""); err != nil {
+		return nil, err
+	}
+	var l net.Listener
+	var pc net.PacketConn
+	var err error
+	// The UDP port may already be in use so retry with another port.
+	for i := 0; i < 10; i++ {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("error listening on TCP: %w", err)
+		}
+		pc, err = net.ListenPacket("udp", l.Addr().String())
+		if err == nil {
+			break
+		}
+		l.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listening on UDP: %w", err)
+	}
+	k := &KDC{
+		realm: realm,
+		store: store,
+		srv:   kdc.NewServer(realm, store, settings...),
+		addr:  l.Addr().String(),
+	}
+	go k.srv.ServeTCP(l)
+	go k.srv.ServeUDP(pc)
+	return k, nil
+}
+
+// Realm returns the realm of the KDC.
+func (k *KDC) Realm() string {
+	return k.realm
+}
+
+// Addr returns the address the KDC is listening on for both UDP and TCP.
+func (k *KDC) Addr() string {
+	return k.addr
+}
+
+// Store returns the KDC's principal database, for example to set the policy attributes of a principal.
+func (k *KDC) Store() *kdc.MemoryStore {
+	return k.store
+}
+
+// Server returns the KDC's server.
+func (k *KDC) Server() *kdc.Server {
+	return k.srv
+}
+
+// Close stops the KDC and waits for the requests in progress to complete.
+func (k *KDC) Close() error {
+	return k.srv.Close()
+}
+
+// Config returns a client configuration for the KDC's realm with the KDC as its only KDC.
+func (k *KDC) Config() (*config.Config, error) {
+	return config.NewFromString(fmt.Sprintf(`[libdefaults]
+  default_realm = %s
+  dns_lookup_kdc = false
+  dns_lookup_realm = false
+
+[realms]
+  %s = {
+    kdc = %s
+  }
+`, k.realm, k.realm, k.addr))
+}
+
+// AddPrincipal adds a principal, such as "user1" or "HTTP/host.test.gokrb5", to the realm with keys derived from the
+// password for the encryption types provided, or kdc.DefaultETypes if none are. A random key is created for an empty
+// password. Adding an existing principal replaces its keys with those of the next kvno.
+func (k *KDC) AddPrincipal(name, password string, etypes ...int32) error {
+	return k.store.AddPrincipal(name, password, etypes...)
+}
+
+// RemovePrincipal removes the principal from the realm.
+func (k *KDC) RemovePrincipal(name string) {
+	k.store.Delete(name)
+}
+
+// Keytab returns a keytab holding the keys of the principal, for example for a service to verify the tickets issued
+// for it.
+func (k *KDC) Keytab(name string) (*keytab.Keytab, error) {
+	pn, _ := types.ParseSPNString(name)
+	p, err := k.store.Principal(context.Background(), pn)
+	if err != nil {
+		return nil, err
+	}
+	kt := keytab.New()
+	for _, key := range p.Keys {
+		kt.AddKey(name, k.realm, key.Key, uint32(key.KVNO))
+	}
+	return kt, nil
+}
@@ -0,0 +1,68 @@
+package testkdc
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRealm = "TEST.GOKRB5"
+	testSPN   = "HTTP/host.test.gokrb5"
+)
+
+func TestKDC(t *testing.T) {
+	t.Parallel()
+	k, err := New(testRealm)
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	defer k.Close()
+	for _, p := range [][2]string{{"user1", "password"}, {testSPN, ""}} {
+		if err := k.AddPrincipal(p[0], p[1]); err != nil {
+			t.Fatalf("error adding principal: %v", err)
+		}
+	}
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	cl := client.NewWithPassword("user1", testRealm, "password", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	tkt, key, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	kt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		t.Fatalf("error creating AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(kt, service.DecodePAC(false)))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted: %v", err)
+	}
+	assert.Equal(t, "user1", creds.UserName(), "client principal not as expected")
+
+	// The KDC serves TCP too.
+	c.LibDefaults.UDPPreferenceLimit = 1
+	assert.NoError(t, client.NewWithPassword("user1", testRealm, "password", c).Login(), "error logging in over TCP")
+
+	assert.Error(t, client.NewWithPassword("user1", testRealm, "wrongpassword", c).Login(),
+		"login with the wrong password should fail")
+	k.RemovePrincipal("user1")
+	assert.Error(t, client.NewWithPassword("user1", testRealm, "password", c).Login(),
+		"login of a removed principal should fail")
+	_, err = k.Keytab("user1")
+	assert.Error(t, err, "keytab of a removed principal should not be returned")
+}
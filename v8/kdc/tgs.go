@@ -0,0 +1,336 @@
+package kdc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// rawKDCReq is a KDC_REQ with the request body kept as the bytes received, to verify the checksum over them. The
+// Bytes of the ReqBody are the KDC-REQ-BODY, its FullBytes including the explicit tag.
+type rawKDCReq struct {
+	PVNO    int                  `asn1:"explicit,tag:1"`
+	MsgType int                  `asn1:"explicit,tag:2"`
+	PAData  types.PADataSequence `asn1:"explicit,optional,tag:3"`
+	ReqBody asn1.RawValue        `asn1:"explicit,tag:4"`
+}
+
+// tgsExchange processes a TGS_REQ, RFC 4120 section 3.3, from the address.
+func (k *Server) tgsExchange(ctx context.Context, b []byte, addr net.Addr) ([]byte, error) {
+	var tgsReq messages.TGSReq
+	if err := tgsReq.Unmarshal(b); err != nil {
+		return nil, k.krbError(types.PrincipalName{}, errorcode.KRB_AP_ERR_MSG_TYPE, fmt.Sprintf("could not unmarshal request: %v", err))
+	}
+	var raw rawKDCReq
+	if _, err := asn1.UnmarshalWithParams(b, &raw, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.TGSREQ)); err != nil {
+		return nil, k.krbError(types.PrincipalName{}, errorcode.KRB_AP_ERR_MSG_TYPE, fmt.Sprintf("could not unmarshal request: %v", err))
+	}
+	body := tgsReq.ReqBody
+	sname := body.SName
+	if err := k.checkOptions(body); err != nil {
+		return nil, err
+	}
+	apReq, err := k.tgsAPReq(tgsReq)
+	if err != nil {
+		return nil, err
+	}
+	renew := types.IsFlagSet(&body.KDCOptions, flags.Renew)
+	now := k.now()
+	tp, err := k.verifyTGSAPReq(ctx, &apReq, raw.ReqBody.Bytes, sname, addr, renew, now)
+	if err != nil {
+		return nil, err
+	}
+	tgt := apReq.Ticket.DecryptedEncPart
+	cp, err := k.principal(ctx, tgt.CName, sname, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN)
+	if err != nil {
+		return nil, err
+	}
+	if err := k.checkClient(cp, sname, now); err != nil {
+		return nil, err
+	}
+	var g *grant
+	var key Key
+	var sessionETypes []int32
+	if renew {
+		g, err = k.renewal(apReq.Ticket, body, tp, now)
+		key, _ = tp.ticketKey()
+	} else {
+		g, key, sessionETypes, err = k.newGrant(ctx, tgt, body, cp, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	replyKey, usage := tgt.Key, uint32(keyusage.TGS_REP_ENCPART_SESSION_KEY)
+	if len(apReq.Authenticator.SubKey.KeyValue) > 0 {
+		replyKey, usage = apReq.Authenticator.SubKey, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY
+	}
+	tkt, ed, err := k.issue(g, key, sessionETypes, replyKey, usage, 0)
+	if err != nil {
+		return nil, err
+	}
+	tgsRep := messages.TGSRep{
+		KDCRepFields: messages.KDCRepFields{
+			PVNO:    iana.PVNO,
+			MsgType: msgtype.KRB_TGS_REP,
+			CRealm:  tgt.CRealm,
+			CName:   tgt.CName,
+			Ticket:  tkt,
+			EncPart: ed,
+		},
+	}
+	return tgsRep.Marshal()
+}
+
+// tgsAPReq returns the AP_REQ of the PA-TGS-REQ of the request.
+func (k *Server) tgsAPReq(tgsReq messages.TGSReq) (messages.APReq, error) {
+	var apReq messages.APReq
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			if err := apReq.Unmarshal(pa.PADataValue); err != nil {
+				return apReq, k.krbError(tgsReq.ReqBody.SName, errorcode.KRB_AP_ERR_MSG_TYPE, "could not unmarshal AP_REQ")
+			}
+			return apReq, nil
+		}
+	}
+	return apReq, k.krbError(tgsReq.ReqBody.SName, errorcode.KDC_ERR_PADATA_TYPE_NOSUPP, "no PA-TGS-REQ")
+}
+
+// verifyTGSAPReq decrypts and verifies the AP_REQ of the TGS_REQ, RFC 4120 section 3.3.2, and returns the principal of
+// its ticket. The ticket must be a TGT for the KDC's realm unless it is to be renewed. The authenticator must be
+// fresh, not replayed and hold a checksum of the request body.
+func (k *Server) verifyTGSAPReq(ctx context.Context, apReq *messages.APReq, body []byte, sname types.PrincipalName, addr net.Addr, renew bool, now time.Time) (Principal, error) {
+	tkt := &apReq.Ticket
+	if tkt.Realm != k.realm {
+		return Principal{}, k.krbError(sname, errorcode.KRB_AP_ERR_NOT_US, fmt.Sprintf("ticket is for realm %s", tkt.Realm))
+	}
+	if !renew && !isTGT(tkt.SName, k.realm) {
+		return Principal{}, k.krbError(sname, errorcode.KRB_AP_ERR_NOT_US, "ticket is not a TGT")
+	}
+	tp, err := k.principal(ctx, tkt.SName, sname, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN)
+	if err != nil {
+		return tp, err
+	}
+	key, ok := tp.key(tkt.EncPart.EType, tkt.EncPart.KVNO)
+	if !ok {
+		return tp, k.krbError(sname, errorcode.KRB_AP_ERR_BADKEYVER, "no key of the ticket's kvno and encryption type")
+	}
+	if err := tkt.Decrypt(key.Key); err != nil {
+		return tp, k.krbError(sname, errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt ticket")
+	}
+	if err := apReq.DecryptAuthenticator(tkt.DecryptedEncPart.Key); err != nil {
+		return tp, k.krbError(sname, errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt authenticator")
+	}
+	tgt := tkt.DecryptedEncPart
+	a := apReq.Authenticator
+	if !a.CName.Equal(tgt.CName) || a.CRealm != tgt.CRealm {
+		return tp, k.krbError(sname, errorcode.KRB_AP_ERR_BADMATCH, "authenticator is not for the ticket's client")
+	}
+	skew := k.settings.MaxClockSkew()
+	if !tgt.StartTime.IsZero() && tgt.StartTime.After(now.Add(skew)) {
+		return tp, k.krbError(sname, errorcode.KRB_AP_ERR_TKT_NYV, "ticket not yet valid")
+	}
+	if now.After(tgt.EndTime.Add(skew)) {
+		return tp, k.krbError(sname, errorcode.KRB_AP_ERR_TKT_EXPIRED, "ticket has expired")
+	}
+	if !k.withinSkew(a.CTime.Add(time.Duration(a.Cusec)*time.Microsecond), now) {
+		return tp, k.krbError(sname, errorcode.KRB_AP_ERR_SKEW, "clock skew too great")
+	}
+	if err := k.verifyBodyChecksum(a.Cksum, tgt.Key, body, sname); err != nil {
+		return tp, err
+	}
+	if len(tgt.CAddr) > 0 && addr != nil {
+		if ip := addrIP(addr); ip != nil && !types.HostAddressesContains(tgt.CAddr, types.HostAddressFromNetIP(ip)) {
+			return tp, k.krbError(sname, errorcode.KRB_AP_ERR_BADADDR, "request is not from an address of the ticket")
+		}
+	}
+	if k.settings.ReplayCache().IsReplay(tkt.SName, a) {
+		return tp, k.krbError(sname, errorcode.KRB_AP_ERR_REPEAT, "replay detected")
+	}
+	return tp, nil
+}
+
+// verifyBodyChecksum verifies the checksum of the authenticator over the request body, keyed with the ticket's session
+// key, binding the request to the authenticator.
+func (k *Server) verifyBodyChecksum(cksum types.Checksum, key types.EncryptionKey, body []byte, sname types.PrincipalName) error {
+	e, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return k.krbError(sname, errorcode.KDC_ERR_ETYPE_NOSUPP, "session key encryption type not supported")
+	}
+	if len(cksum.Checksum) == 0 || cksum.CksumType != e.GetHashID() {
+		return k.krbError(sname, errorcode.KRB_AP_ERR_INAPP_CKSUM, "authenticator has no checksum of the request body")
+	}
+	if !e.VerifyChecksum(key.KeyValue, body, cksum.Checksum, keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR_CHKSUM) {
+		return k.krbError(sname, errorcode.KRB_AP_ERR_MODIFIED, "request body checksum is not valid")
+	}
+	return nil
+}
+
+// newGrant returns the grant of a new ticket for the service requested with the TGT, and the key it is encrypted
+// with and the etypes of its session key.
+func (k *Server) newGrant(ctx context.Context, tgt messages.EncTicketPart, body messages.KDCReqBody, cp Principal, now time.Time) (*grant, Key, []int32, error) {
+	sname := body.SName
+	user2User := types.IsFlagSet(&body.KDCOptions, flags.EncTktInSkey)
+	sp, err := k.principal(ctx, sname, sname, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN)
+	if err != nil {
+		return nil, Key{}, nil, err
+	}
+	if err := k.checkServer(sp, sname, now, user2User); err != nil {
+		return nil, Key{}, nil, err
+	}
+	g := &grant{
+		body:     body,
+		cname:    tgt.CName,
+		crealm:   tgt.CRealm,
+		sname:    sname,
+		flags:    types.NewKrbFlags(),
+		authTime: tgt.AuthTime,
+		caddr:    tgt.CAddr,
+		authData: tgt.AuthorizationData,
+	}
+	for _, f := range []int{flags.PreAuthent, flags.HWAuthent} {
+		if types.IsFlagSet(&tgt.Flags, f) {
+			types.SetFlag(&g.flags, f)
+		}
+	}
+	if sp.OKAsDelegate {
+		types.SetFlag(&g.flags, flags.OKAsDelegate)
+	}
+	forwarded := types.IsFlagSet(&body.KDCOptions, flags.Forwarded)
+	if forwarded || types.IsFlagSet(&body.KDCOptions, flags.Forwardable) {
+		if !types.IsFlagSet(&tgt.Flags, flags.Forwardable) {
+			return nil, Key{}, nil, k.krbError(sname, errorcode.KDC_ERR_BADOPTION, "TGT is not forwardable")
+		}
+		if cp.DisallowForwardable {
+			return nil, Key{}, nil, k.krbError(sname, errorcode.KDC_ERR_POLICY, "client may not be issued forwardable tickets")
+		}
+	}
+	if types.IsFlagSet(&body.KDCOptions, flags.Forwardable) {
+		types.SetFlag(&g.flags, flags.Forwardable)
+	}
+	if forwarded {
+		// A forwarded ticket is for the addresses requested, those of the host it is forwarded to.
+		types.SetFlag(&g.flags, flags.Forwarded)
+		g.caddr = body.Addresses
+	} else if types.IsFlagSet(&tgt.Flags, flags.Forwarded) {
+		types.SetFlag(&g.flags, flags.Forwarded)
+	}
+	var renewLimit time.Time
+	if types.IsFlagSet(&tgt.Flags, flags.Renewable) {
+		renewLimit = tgt.RenewTill
+	}
+	if err := k.setTimes(g, now, cp, sp, tgt.EndTime, renewLimit); err != nil {
+		return nil, Key{}, nil, err
+	}
+	if user2User {
+		key, err := k.user2UserKey(ctx, body, now)
+		return g, key, sp.etypes(), err
+	}
+	key, ok := sp.ticketKey()
+	if !ok {
+		return nil, Key{}, nil, k.krbError(sname, errorcode.KDC_ERR_ETYPE_NOSUPP, "server has no supported key")
+	}
+	return g, key, sp.etypes(), nil
+}
+
+// user2UserKey returns the session key of the additional ticket of a user-to-user request, RFC 4120 section 3.7,
+// which must be a TGT for the KDC's realm issued to the server requested.
+func (k *Server) user2UserKey(ctx context.Context, body messages.KDCReqBody, now time.Time) (Key, error) {
+	sname := body.SName
+	if len(body.AdditionalTickets) < 1 {
+		return Key{}, k.krbError(sname, errorcode.KDC_ERR_BADOPTION, "no additional ticket for ENC-TKT-IN-SKEY")
+	}
+	tkt := body.AdditionalTickets[0]
+	if tkt.Realm != k.realm || !isTGT(tkt.SName, k.realm) {
+		return Key{}, k.krbError(sname, errorcode.KDC_ERR_BADOPTION, "additional ticket is not a TGT")
+	}
+	tp, err := k.principal(ctx, tkt.SName, sname, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN)
+	if err != nil {
+		return Key{}, err
+	}
+	key, ok := tp.key(tkt.EncPart.EType, tkt.EncPart.KVNO)
+	if !ok {
+		return Key{}, k.krbError(sname, errorcode.KRB_AP_ERR_BADKEYVER, "no key of the additional ticket's kvno and encryption type")
+	}
+	if err := tkt.Decrypt(key.Key); err != nil {
+		return Key{}, k.krbError(sname, errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt additional ticket")
+	}
+	if !tkt.DecryptedEncPart.CName.Equal(sname) {
+		return Key{}, k.krbError(sname, errorcode.KDC_ERR_SERVER_NOMATCH, "additional ticket is not for the server")
+	}
+	if now.After(tkt.DecryptedEncPart.EndTime) {
+		return Key{}, k.krbError(sname, errorcode.KRB_AP_ERR_TKT_EXPIRED, "additional ticket has expired")
+	}
+	// User-to-user tickets have no kvno.
+	return Key{Key: tkt.DecryptedEncPart.Key}, nil
+}
+
+// renewal returns the grant of the renewal of the ticket, RFC 4120 section 3.3.3.1, which must be renewable and
+// within its renew till time. The renewed ticket has the same session key and lifetime.
+func (k *Server) renewal(tkt messages.Ticket, body messages.KDCReqBody, tp Principal, now time.Time) (*grant, error) {
+	etp := tkt.DecryptedEncPart
+	if !types.IsFlagSet(&etp.Flags, flags.Renewable) {
+		return nil, k.krbError(tkt.SName, errorcode.KDC_ERR_BADOPTION, "ticket is not renewable")
+	}
+	if now.After(etp.RenewTill) {
+		return nil, k.krbError(tkt.SName, errorcode.KRB_AP_ERR_TKT_EXPIRED, "ticket renew till time has passed")
+	}
+	if tp.Disabled {
+		return nil, k.krbError(tkt.SName, errorcode.KDC_ERR_SERVICE_REVOKED, "server is disabled")
+	}
+	start := etp.StartTime
+	if start.IsZero() {
+		start = etp.AuthTime
+	}
+	end := now.Add(etp.EndTime.Sub(start))
+	if end.After(etp.RenewTill) {
+		end = etp.RenewTill
+	}
+	// Tickets issued by the TGS are not initial tickets.
+	f := types.NewKrbFlags()
+	copy(f.Bytes, etp.Flags.Bytes)
+	types.UnsetFlag(&f, flags.Initial)
+	body.SName = tkt.SName
+	return &grant{
+		body:       body,
+		cname:      etp.CName,
+		crealm:     etp.CRealm,
+		sname:      tkt.SName,
+		flags:      f,
+		authTime:   etp.AuthTime,
+		startTime:  now,
+		endTime:    end,
+		renewTill:  etp.RenewTill,
+		caddr:      etp.CAddr,
+		authData:   etp.AuthorizationData,
+		sessionKey: etp.Key,
+	}, nil
+}
+
+// isTGT indicates if the principal is the TGS of the realm.
+func isTGT(pn types.PrincipalName, realm string) bool {
+	return len(pn.NameString) == 2 && pn.NameString[0] == "krbtgt" && pn.NameString[1] == realm
+}
+
+// addrIP returns the IP address of the network address, or nil if it does not have one.
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
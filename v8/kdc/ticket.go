@@ -0,0 +1,230 @@
+package kdc
+
+import (
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// grant is a ticket the KDC has decided to issue.
+type grant struct {
+	body      messages.KDCReqBody
+	cname     types.PrincipalName
+	crealm    string
+	sname     types.PrincipalName
+	flags     asn1.BitString
+	authTime  time.Time
+	startTime time.Time
+	endTime   time.Time
+	renewTill time.Time
+	caddr     types.HostAddresses
+	authData  types.AuthorizationData
+	// sessionKey is generated for the ticket if it is empty.
+	sessionKey types.EncryptionKey
+	// keyExpiration is the expiry of the client's password, reported in AS_REPs.
+	keyExpiration time.Time
+}
+
+// checkOptions rejects the KDC options of the request the KDC does not support.
+func (k *Server) checkOptions(body messages.KDCReqBody) error {
+	for _, o := range []int{flags.AllowPostDate, flags.PostDated, flags.Proxiable, flags.Proxy, flags.Validate} {
+		if types.IsFlagSet(&body.KDCOptions, o) {
+			return k.krbError(body.SName, errorcode.KDC_ERR_BADOPTION, "option not supported")
+		}
+	}
+	if !body.From.IsZero() && body.From.After(k.now().Add(k.settings.MaxClockSkew())) {
+		return k.krbError(body.SName, errorcode.KDC_ERR_CANNOT_POSTDATE, "postdated tickets not supported")
+	}
+	return nil
+}
+
+// checkClient applies the policy of the client principal's entry.
+func (k *Server) checkClient(cp Principal, sname types.PrincipalName, now time.Time) error {
+	if cp.Disabled {
+		return k.krbError(sname, errorcode.KDC_ERR_CLIENT_REVOKED, "client is disabled")
+	}
+	if !cp.Expires.IsZero() && now.After(cp.Expires) {
+		return k.krbError(sname, errorcode.KDC_ERR_NAME_EXP, "client has expired")
+	}
+	return nil
+}
+
+// checkServer applies the policy of the server principal's entry. Server principals that are disallowed may still be
+// issued user-to-user tickets.
+func (k *Server) checkServer(sp Principal, sname types.PrincipalName, now time.Time, user2User bool) error {
+	if sp.Disabled {
+		return k.krbError(sname, errorcode.KDC_ERR_SERVICE_REVOKED, "server is disabled")
+	}
+	if !sp.Expires.IsZero() && now.After(sp.Expires) {
+		return k.krbError(sname, errorcode.KDC_ERR_SERVICE_EXP, "server has expired")
+	}
+	if sp.DisallowServer && !user2User {
+		return k.krbError(sname, errorcode.KDC_ERR_MUST_USE_USER2USER, "server only accepts user-to-user tickets")
+	}
+	return nil
+}
+
+// setTimes sets the times of the ticket issued now for the request, within the KDC's and principals' lifetimes and
+// the end and renew till times of the ticket it is issued with if they are not zero. The ticket is renewable if
+// requested and permitted.
+func (k *Server) setTimes(g *grant, now time.Time, cp, sp Principal, endLimit, renewLimit time.Time) error {
+	g.startTime = now
+	life := minDuration(k.settings.MaxTicketLifetime(), cp.MaxLife, sp.MaxLife)
+	g.endTime = now.Add(life)
+	till := g.body.Till
+	if !till.IsZero() && till.Before(g.endTime) {
+		g.endTime = till
+	}
+	if !endLimit.IsZero() && endLimit.Before(g.endTime) {
+		g.endTime = endLimit
+	}
+	if !g.endTime.After(now) {
+		return k.krbError(g.sname, errorcode.KDC_ERR_NEVER_VALID, "requested end time is in the past")
+	}
+	renewable := types.IsFlagSet(&g.body.KDCOptions, flags.Renewable)
+	rtime := g.body.RTime
+	if !renewable && types.IsFlagSet(&g.body.KDCOptions, flags.RenewableOK) && !till.IsZero() && till.After(g.endTime) {
+		// The lifetime requested cannot be granted so a renewable ticket is issued instead, RFC 4120 section 2.3.
+		renewable = true
+		rtime = till
+	}
+	if !renewable || cp.DisallowRenewable || sp.DisallowRenewable {
+		return nil
+	}
+	// Tickets issued with another ticket, which has an end limit, are only renewable if that ticket is.
+	if !renewLimit.IsZero() || endLimit.IsZero() {
+		g.renewTill = now.Add(minDuration(k.settings.MaxRenewLifetime(), cp.MaxRenewableLife, sp.MaxRenewableLife))
+		if !rtime.IsZero() && rtime.Before(g.renewTill) {
+			g.renewTill = rtime
+		}
+		if !renewLimit.IsZero() && renewLimit.Before(g.renewTill) {
+			g.renewTill = renewLimit
+		}
+		if g.renewTill.After(g.endTime) {
+			types.SetFlag(&g.flags, flags.Renewable)
+		} else {
+			g.renewTill = time.Time{}
+		}
+	}
+	return nil
+}
+
+// minDuration returns the smallest of the durations that are not zero.
+func minDuration(d ...time.Duration) time.Duration {
+	var m time.Duration
+	for _, v := range d {
+		if v > 0 && (m == 0 || v < m) {
+			m = v
+		}
+	}
+	return m
+}
+
+// issue creates the ticket of the grant encrypted with the key of the server and returns it with the encrypted part
+// of the reply, encrypted with the reply key.
+func (k *Server) issue(g *grant, key Key, sessionETypes []int32, replyKey types.EncryptionKey, replyUsage uint32, replyKVNO int) (messages.Ticket, types.EncryptedData, error) {
+	if len(g.sessionKey.KeyValue) == 0 {
+		et, ok := selectEType(g.body.EType, sessionETypes)
+		if !ok {
+			return messages.Ticket{}, types.EncryptedData{}, k.krbError(g.sname, errorcode.KDC_ERR_ETYPE_NOSUPP, "no supported session key encryption type requested")
+		}
+		e, err := crypto.GetEtype(et)
+		if err != nil {
+			return messages.Ticket{}, types.EncryptedData{}, err
+		}
+		if g.sessionKey, err = types.GenerateEncryptionKey(e); err != nil {
+			return messages.Ticket{}, types.EncryptedData{}, err
+		}
+	}
+	etp := messages.EncTicketPart{
+		Flags:             g.flags,
+		Key:               g.sessionKey,
+		CRealm:            g.crealm,
+		CName:             g.cname,
+		Transited:         messages.TransitedEncoding{},
+		AuthTime:          g.authTime,
+		StartTime:         g.startTime,
+		EndTime:           g.endTime,
+		RenewTill:         g.renewTill,
+		CAddr:             g.caddr,
+		AuthorizationData: g.authData,
+	}
+	b, err := asn1.Marshal(etp)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptedData{}, err
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncTicketPart)
+	ed, err := crypto.GetEncryptedData(b, key.Key, keyusage.KDC_REP_TICKET, key.KVNO)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptedData{}, err
+	}
+	tkt := messages.Ticket{
+		TktVNO:  iana.PVNO,
+		Realm:   k.realm,
+		SName:   g.sname,
+		EncPart: ed,
+	}
+	encPart := messages.EncKDCRepPart{
+		Key:           g.sessionKey,
+		LastReqs:      []messages.LastReq{},
+		Nonce:         g.body.Nonce,
+		KeyExpiration: g.keyExpiration,
+		Flags:         g.flags,
+		AuthTime:      g.authTime,
+		StartTime:     g.startTime,
+		EndTime:       g.endTime,
+		RenewTill:     g.renewTill,
+		SRealm:        k.realm,
+		SName:         g.sname,
+		CAddr:         g.caddr,
+	}
+	if b, err = encPart.Marshal(); err != nil {
+		return messages.Ticket{}, types.EncryptedData{}, err
+	}
+	red, err := crypto.GetEncryptedData(b, replyKey, replyUsage, replyKVNO)
+	return tkt, red, err
+}
+
+// ticketKey returns the key of the principal tickets for it are encrypted with, its first key of the latest kvno.
+func (p Principal) ticketKey() (Key, bool) {
+	var k Key
+	var ok bool
+	for _, pk := range p.Keys {
+		if _, err := crypto.GetEtype(pk.Key.KeyType); err != nil {
+			continue
+		}
+		if !ok || pk.KVNO > k.KVNO {
+			k, ok = pk, true
+		}
+	}
+	return k, ok
+}
+
+// selectEType returns the first of the etypes requested that is one of those available.
+func selectEType(requested, available []int32) (int32, bool) {
+	for _, r := range requested {
+		if containsEType(available, r) {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// containsEType indicates if the etype is one of the etypes.
+func containsEType(etypes []int32, et int32) bool {
+	for _, e := range etypes {
+		if e == et {
+			return true
+		}
+	}
+	return false
+}
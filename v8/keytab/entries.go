@@ -0,0 +1,110 @@
+package keytab
+
+import (
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Entry describes an entry of a keytab.
+type Entry struct {
+	Principal types.PrincipalName
+	Realm     string
+	Timestamp time.Time
+	// KVNO is the key version, the 32-bit key version of the entry if it has one.
+	KVNO uint32
+	// Key is the entry's key. Its key value is that held by the keytab, not a copy.
+	Key types.EncryptionKey
+}
+
+// PrincipalString returns the principal of the entry in the form name@REALM.
+func (e Entry) PrincipalString() string {
+	return e.Principal.PrincipalNameString() + "@" + e.Realm
+}
+
+// info returns the description of the entry.
+func (e entry) info() Entry {
+	return Entry{
+		Principal: types.PrincipalName{NameType: e.Principal.NameType, NameString: e.Principal.Components},
+		Realm:     e.Principal.Realm,
+		Timestamp: e.Timestamp,
+		KVNO:      e.KVNO,
+		Key:       e.Key,
+	}
+}
+
+// Range calls the function with each entry of the keytab in turn, stopping if it returns false.
+func (kt *Keytab) Range(f func(e Entry) bool) {
+	for _, e := range kt.Entries {
+		if !f(e.info()) {
+			return
+		}
+	}
+}
+
+// Merge adds the entries of the other keytabs to the keytab, as ktutil's read_kt does, for example to combine the
+// keytabs of several services. An entry for the same principal, key version and encryption type as an entry already
+// in the keytab replaces it.
+func (kt *Keytab) Merge(others ...*Keytab) {
+	for _, o := range others {
+		for _, e := range o.Entries {
+			e.Principal.NumComponents = int16(len(e.Principal.Components))
+			if kt.version == 1 {
+				e.Principal.NumComponents++
+			}
+			replaced := false
+			for i, x := range kt.Entries {
+				if sameKey(x, e) {
+					kt.Entries[i] = e
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				kt.Entries = append(kt.Entries, e)
+			}
+		}
+	}
+	kt.resetIndex()
+}
+
+// sameKey indicates if the entries are for the same principal, key version and encryption type.
+func sameKey(a, b entry) bool {
+	return a.Principal.Realm == b.Principal.Realm && a.Principal.matches(b.info().Principal) &&
+		a.KVNO == b.KVNO && a.Key.KeyType == b.Key.KeyType
+}
+
+// RemoveFunc removes the entries of the keytab for which the function returns true and returns the number removed.
+func (kt *Keytab) RemoveFunc(f func(e Entry) bool) int {
+	var n int
+	entries := kt.Entries[:0]
+	for _, e := range kt.Entries {
+		if f(e.info()) {
+			n++
+			continue
+		}
+		entries = append(entries, e)
+	}
+	// Clear the tail so the removed entries' keys are not retained by the slice.
+	for i := len(entries); i < len(kt.Entries); i++ {
+		kt.Entries[i] = entry{}
+	}
+	kt.Entries = entries
+	return n
+}
+
+// RemoveBeforeKVNO removes the entries of the principal with a key version lower than kvno, such as the keys retired
+// by a key rotation once the tickets issued with them have expired, and returns the number removed.
+func (kt *Keytab) RemoveBeforeKVNO(principalName, realm string, kvno uint32) int {
+	princ, _ := types.ParseSPNString(principalName)
+	return kt.RemoveFunc(func(e Entry) bool {
+		return e.Realm == realm && e.Principal.Equal(princ) && e.KVNO < kvno
+	})
+}
+
+// RemoveBefore removes the entries of all principals timestamped before the time and returns the number removed.
+func (kt *Keytab) RemoveBefore(t time.Time) int {
+	return kt.RemoveFunc(func(e Entry) bool {
+		return e.Timestamp.Before(t)
+	})
+}
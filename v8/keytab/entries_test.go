@@ -0,0 +1,88 @@
+package keytab
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRotationKeytab() *Keytab {
+	kt := New()
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for kvno := uint32(1); kvno <= 3; kvno++ {
+		for _, et := range []int32{etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96} {
+			key := types.EncryptionKey{KeyType: et, KeyValue: []byte{byte(kvno), byte(et)}}
+			kt.addKeyEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", key, ts.AddDate(0, int(kvno), 0), kvno)
+		}
+	}
+	return kt
+}
+
+func TestKeytab_Range(t *testing.T) {
+	t.Parallel()
+	kt := testRotationKeytab()
+	var entries []Entry
+	kt.Range(func(e Entry) bool {
+		entries = append(entries, e)
+		return len(entries) < 3
+	})
+	if assert.Equal(t, 3, len(entries), "iteration should stop when the function returns false") {
+		assert.Equal(t, "HTTP/host.test.gokrb5@TEST.GOKRB5", entries[0].PrincipalString(), "principal not as expected")
+		assert.Equal(t, uint32(2), entries[2].KVNO, "KVNO not as expected")
+		assert.Equal(t, etypeID.AES128_CTS_HMAC_SHA1_96, entries[2].Key.KeyType, "key type not as expected")
+		assert.Equal(t, time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), entries[2].Timestamp, "timestamp not as expected")
+	}
+}
+
+func TestKeytab_Merge(t *testing.T) {
+	t.Parallel()
+	kt := testRotationKeytab()
+	other := New()
+	replacement := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte{9}}
+	other.AddKey("HTTP/host.test.gokrb5", "TEST.GOKRB5", replacement, 3)
+	other.AddKey("HTTP/other.test.gokrb5", "TEST.GOKRB5", replacement, 1)
+	kt.Merge(other)
+	assert.Equal(t, 7, len(kt.Entries), "number of entries not as expected")
+	k, _, err := kt.GetEncryptionKey(types.NewPrincipalName(1, "HTTP/host.test.gokrb5"), "TEST.GOKRB5", 3, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	assert.Equal(t, replacement, k, "key of the same principal, kvno and encryption type should be replaced")
+	_, _, err = kt.GetEncryptionKey(types.NewPrincipalName(1, "HTTP/other.test.gokrb5"), "TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.NoError(t, err, "key of the other keytab should be added")
+
+	// The merged keytab can be marshaled and read back.
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling keytab: %v", err)
+	}
+	kt2 := New()
+	if err := kt2.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling keytab: %v", err)
+	}
+	assert.Equal(t, 7, len(kt2.Entries), "number of entries read back not as expected")
+}
+
+func TestKeytab_Remove(t *testing.T) {
+	t.Parallel()
+	kt := testRotationKeytab()
+	kt.AddKey("HTTP/other.test.gokrb5", "TEST.GOKRB5", types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte{1}}, 1)
+	assert.Equal(t, 0, kt.RemoveBeforeKVNO("HTTP/host.test.gokrb5", "OTHER.GOKRB5", 3), "entries of another realm should not be removed")
+	assert.Equal(t, 4, kt.RemoveBeforeKVNO("HTTP/host.test.gokrb5", "TEST.GOKRB5", 3), "number of entries removed not as expected")
+	kt.Range(func(e Entry) bool {
+		if e.Principal.PrincipalNameString() == "HTTP/host.test.gokrb5" {
+			assert.Equal(t, uint32(3), e.KVNO, "only the current key version should remain")
+		}
+		return true
+	})
+	assert.Equal(t, 3, len(kt.Entries), "entries of other principals should be kept")
+
+	removed := kt.RemoveBefore(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 2, removed, "entries timestamped before the time should be removed")
+	assert.Equal(t, "HTTP/other.test.gokrb5@TEST.GOKRB5", kt.Entries[0].info().PrincipalString(), "entry remaining not as expected")
+	assert.Equal(t, 1, kt.RemoveFunc(func(e Entry) bool { return true }), "all entries should be removed")
+	assert.Equal(t, 0, len(kt.Entries), "keytab should be empty")
+}
@@ -0,0 +1,66 @@
+package keytab
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Environment variables of the names of the keytabs.
+const (
+	// KeytabEnvVar is the environment variable of the name of the keytab of services.
+	KeytabEnvVar = "KRB5_KTNAME"
+	// ClientKeytabEnvVar is the environment variable of the name of the keytab clients obtain initial credentials with.
+	ClientKeytabEnvVar = "KRB5_CLIENT_KTNAME"
+)
+
+// DefaultKeytabPath is the location of the keytab used if the KeytabEnvVar environment variable is not set.
+const DefaultKeytabPath = "/etc/krb5.keytab"
+
+// DefaultClientKeytabPath returns the location of the client keytab of the user used if the ClientKeytabEnvVar
+// environment variable is not set, the default of MIT krb5.
+func DefaultClientKeytabPath() string {
+	return fmt.Sprintf("/usr/local/var/krb5/user/%d/client.keytab", os.Geteuid())
+}
+
+// LoadName loads the keytab named, a path or a name of the FILE or WRFILE types.
+func LoadName(name string) (*Keytab, error) {
+	p, err := Path(name)
+	if err != nil {
+		return new(Keytab), err
+	}
+	return Load(p)
+}
+
+// Path returns the path of the file of the keytab named, a path or a name of the FILE or WRFILE types.
+func Path(name string) (string, error) {
+	for _, prefix := range []string{"FILE:", "WRFILE:"} {
+		if strings.HasPrefix(name, prefix) {
+			return strings.TrimPrefix(name, prefix), nil
+		}
+	}
+	if strings.Index(name, ":") > 0 && !filepath.IsAbs(name) {
+		return "", fmt.Errorf("only FILE keytab types are supported: %s", name)
+	}
+	return name, nil
+}
+
+// LoadDefault loads the keytab of the KRB5_KTNAME environment variable or, if it is not set, the default location.
+func LoadDefault() (*Keytab, error) {
+	name := os.Getenv(KeytabEnvVar)
+	if name == "" {
+		name = DefaultKeytabPath
+	}
+	return LoadName(name)
+}
+
+// LoadDefaultClient loads the client keytab of the KRB5_CLIENT_KTNAME environment variable or, if it is not set, the
+// default location.
+func LoadDefaultClient() (*Keytab, error) {
+	name := os.Getenv(ClientKeytabEnvVar)
+	if name == "" {
+		name = DefaultClientKeytabPath()
+	}
+	return LoadName(name)
+}
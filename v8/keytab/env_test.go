@@ -0,0 +1,64 @@
+package keytab
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPath(t *testing.T) {
+	t.Parallel()
+	for name, want := range map[string]string{
+		"/etc/krb5.keytab":        "/etc/krb5.keytab",
+		"FILE:/etc/krb5.keytab":   "/etc/krb5.keytab",
+		"WRFILE:/etc/krb5.keytab": "/etc/krb5.keytab",
+	} {
+		p, err := Path(name)
+		if err != nil {
+			t.Errorf("error getting path of %s: %v", name, err)
+			continue
+		}
+		assert.Equal(t, want, p, "path of %s not as expected", name)
+	}
+	_, err := Path("MEMORY:test")
+	assert.Error(t, err, "unsupported keytab type should be an error")
+}
+
+func TestLoadDefault(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TEST-gokrb5-env")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	kt := New()
+	if err := kt.AddEntry("testuser1", "TEST.GOKRB5", "passwordvalue", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error adding entry: %v", err)
+	}
+	ktPath := filepath.Join(dir, "client.keytab")
+	if err := kt.Save(ktPath); err != nil {
+		t.Fatalf("error saving keytab: %v", err)
+	}
+	defer os.Unsetenv(KeytabEnvVar)
+	defer os.Unsetenv(ClientKeytabEnvVar)
+
+	os.Setenv(KeytabEnvVar, "FILE:"+ktPath)
+	l, err := LoadDefault()
+	if err != nil {
+		t.Fatalf("error loading default keytab: %v", err)
+	}
+	assert.Len(t, l.Entries, 1, "entries of the keytab not as expected")
+	os.Setenv(ClientKeytabEnvVar, ktPath)
+	l, err = LoadDefaultClient()
+	if err != nil {
+		t.Fatalf("error loading default client keytab: %v", err)
+	}
+	assert.Equal(t, "testuser1@TEST.GOKRB5", l.Entries[0].Principal.String(), "principal of the client keytab not as expected")
+	os.Setenv(ClientKeytabEnvVar, filepath.Join(dir, "missing.keytab"))
+	_, err = LoadDefaultClient()
+	assert.Error(t, err, "missing client keytab should be an error")
+}
@@ -0,0 +1,103 @@
+package keytab
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ErrKeyNotExtractable is returned when the value of a long-term key is required but the key is held by a KeyHandle.
+var ErrKeyNotExtractable = errors.New("key value is not available as the key is held by a key handle")
+
+// KeyHandle is a long-term key whose value is held outside of the process, for example in an HSM or by a KMS. Only the
+// cryptographic operations the Kerberos exchanges perform with the key are exposed.
+type KeyHandle interface {
+	// KeyType returns the encryption type of the key.
+	KeyType() int32
+	// KVNO returns the version number of the key.
+	KVNO() int
+	// Encrypt encrypts the plaintext for the key usage, returning the ciphertext including its integrity hash.
+	Encrypt(plaintext []byte, usage uint32) ([]byte, error)
+	// Decrypt decrypts the ciphertext for the key usage, verifying its integrity hash.
+	Decrypt(ciphertext []byte, usage uint32) ([]byte, error)
+	// Checksum returns the keyed checksum of the data of the checksum type for the key usage.
+	Checksum(cksumType int32, data []byte, usage uint32) ([]byte, error)
+}
+
+// KeyHandleProvider is implemented by sources of long-term keys whose values are not available to the process.
+// If the kvno is zero the handle for the key with the latest kvno should be returned.
+type KeyHandleProvider interface {
+	GetKeyHandle(princName types.PrincipalName, realm string, kvno int, etype int32) (KeyHandle, error)
+}
+
+// KeyHandleProviderFunc is an adapter to allow the use of ordinary functions as a KeyHandleProvider.
+type KeyHandleProviderFunc func(princName types.PrincipalName, realm string, kvno int, etype int32) (KeyHandle, error)
+
+// GetKeyHandle calls f(princName, realm, kvno, etype).
+func (f KeyHandleProviderFunc) GetKeyHandle(princName types.PrincipalName, realm string, kvno int, etype int32) (KeyHandle, error) {
+	return f(princName, realm, kvno, etype)
+}
+
+// HandleKeyProvider adapts a KeyHandleProvider so that it can be used where a KeyProvider is required, for example
+// with the service.KeyProvider setting. Tickets are decrypted, and the server checksums of their PACs verified, with
+// the key handles. GetEncryptionKey returns ErrKeyNotExtractable with the kvno of the key.
+type HandleKeyProvider struct {
+	KeyHandleProvider
+}
+
+// GetEncryptionKey returns the kvno of the key for the principal with the required kvno and etype, and
+// ErrKeyNotExtractable as the key value is not available.
+func (p HandleKeyProvider) GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+	h, err := p.GetKeyHandle(princName, realm, kvno, etype)
+	if err != nil {
+		return types.EncryptionKey{}, 0, err
+	}
+	return types.EncryptionKey{}, h.KVNO(), ErrKeyNotExtractable
+}
+
+// keyHandle is a KeyHandle for a key whose value is held in memory.
+type keyHandle struct {
+	key  types.EncryptionKey
+	kvno int
+}
+
+// NewKeyHandle returns a KeyHandle that performs its operations with the key value provided. This allows a key held
+// in memory to be used where a KeyHandle is required, for example to test a KeyHandleProvider.
+func NewKeyHandle(key types.EncryptionKey, kvno int) KeyHandle {
+	return keyHandle{key: key, kvno: kvno}
+}
+
+// KeyType returns the encryption type of the key.
+func (h keyHandle) KeyType() int32 {
+	return h.key.KeyType
+}
+
+// KVNO returns the version number of the key.
+func (h keyHandle) KVNO() int {
+	return h.kvno
+}
+
+// Encrypt encrypts the plaintext for the key usage.
+func (h keyHandle) Encrypt(plaintext []byte, usage uint32) ([]byte, error) {
+	ed, err := crypto.GetEncryptedData(plaintext, h.key, usage, h.kvno)
+	if err != nil {
+		return nil, err
+	}
+	return ed.Cipher, nil
+}
+
+// Decrypt decrypts the ciphertext for the key usage.
+func (h keyHandle) Decrypt(ciphertext []byte, usage uint32) ([]byte, error) {
+	return crypto.DecryptMessage(ciphertext, h.key, usage)
+}
+
+// Checksum returns the keyed checksum of the data of the checksum type for the key usage.
+func (h keyHandle) Checksum(cksumType int32, data []byte, usage uint32) ([]byte, error) {
+	et, err := crypto.GetChksumEtype(cksumType)
+	if err != nil {
+		return nil, fmt.Errorf("error getting checksum etype: %w", err)
+	}
+	return et.GetChecksumHash(h.key.KeyValue, data, usage)
+}
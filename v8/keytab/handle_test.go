@@ -0,0 +1,75 @@
+package keytab
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKeyHandle(t *testing.T) {
+	t.Parallel()
+	kt := testMultiKeytab(t, "HTTP/host.test.gokrb5", "password", 3)
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	key, kvno, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	h := NewKeyHandle(key, kvno)
+	assert.Equal(t, etypeID.AES256_CTS_HMAC_SHA1_96, h.KeyType(), "key type not as expected")
+	assert.Equal(t, 3, h.KVNO(), "KVNO not as expected")
+
+	ct, err := h.Encrypt([]byte("plaintext"), keyusage.KDC_REP_TICKET)
+	if err != nil {
+		t.Fatalf("Error encrypting: %v", err)
+	}
+	b, err := crypto.DecryptMessage(ct, key, keyusage.KDC_REP_TICKET)
+	if err != nil {
+		t.Fatalf("Error decrypting with the key: %v", err)
+	}
+	assert.Equal(t, []byte("plaintext"), b, "decrypted plaintext not as expected")
+	b, err = h.Decrypt(ct, keyusage.KDC_REP_TICKET)
+	if err != nil {
+		t.Fatalf("Error decrypting with the key handle: %v", err)
+	}
+	assert.Equal(t, []byte("plaintext"), b, "decrypted plaintext not as expected")
+	_, err = h.Decrypt(ct, keyusage.AS_REP_ENCPART)
+	assert.Error(t, err, "decrypting for another usage should fail")
+
+	cksum, err := h.Checksum(chksumtype.HMAC_SHA1_96_AES256, []byte("data"), keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		t.Fatalf("Error generating checksum: %v", err)
+	}
+	et, _ := crypto.GetChksumEtype(chksumtype.HMAC_SHA1_96_AES256)
+	assert.True(t, et.VerifyChecksum(key.KeyValue, []byte("data"), cksum, keyusage.KERB_NON_KERB_CKSUM_SALT), "checksum not verified")
+	_, err = h.Checksum(9999, []byte("data"), keyusage.KERB_NON_KERB_CKSUM_SALT)
+	assert.Error(t, err, "unknown checksum type should fail")
+}
+
+func TestHandleKeyProvider(t *testing.T) {
+	t.Parallel()
+	kt := testMultiKeytab(t, "HTTP/host.test.gokrb5", "password", 2)
+	hp := KeyHandleProviderFunc(func(pn types.PrincipalName, realm string, kvno int, etype int32) (KeyHandle, error) {
+		key, kvno, err := kt.GetEncryptionKey(pn, realm, kvno, etype)
+		if err != nil {
+			return nil, err
+		}
+		return NewKeyHandle(key, kvno), nil
+	})
+	var kp KeyProvider = HandleKeyProvider{KeyHandleProvider: hp}
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	key, kvno, err := kp.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.True(t, errors.Is(err, ErrKeyNotExtractable), "key value should not be available")
+	assert.Equal(t, 2, kvno, "KVNO not as expected")
+	assert.Empty(t, key.KeyValue, "key value should be empty")
+	_, _, err = kp.GetEncryptionKey(pn, "TEST.GOKRB5", 5, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.False(t, errors.Is(err, ErrKeyNotExtractable), "missing key should return the provider's error")
+	_, ok := kp.(KeyHandleProvider)
+	assert.True(t, ok, "adapter should provide the key handles")
+}
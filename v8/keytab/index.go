@@ -0,0 +1,76 @@
+package keytab
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// keytabIndex indexes the entries of a keytab on their principal, realm and encryption type so that the keys of a
+// principal are found without scanning every entry, as matters for keytabs with thousands of entries.
+type keytabIndex struct {
+	// entries is the slice of entries the index was built from. The index is rebuilt when the keytab's Entries are no
+	// longer the same slice, as when entries are added or removed.
+	entries []entry
+	keys    map[indexKey][]int
+}
+
+// indexKey is the key of the entries of a principal, realm and encryption type in the index.
+type indexKey struct {
+	realm string
+	name  string
+	etype int32
+}
+
+// newIndexKey returns the key of the index for the principal name components, realm and encryption type.
+func newIndexKey(components []string, realm string, etype int32) indexKey {
+	return indexKey{realm: realm, name: strings.Join(components, "/"), etype: etype}
+}
+
+// buildIndex indexes the entries, each list of the index holding the positions of the entries newest first.
+func buildIndex(entries []entry) *keytabIndex {
+	idx := &keytabIndex{entries: entries, keys: make(map[indexKey][]int)}
+	for i, e := range entries {
+		k := newIndexKey(e.Principal.Components, e.Principal.Realm, e.Key.KeyType)
+		idx.keys[k] = append(idx.keys[k], i)
+	}
+	for _, l := range idx.keys {
+		sort.SliceStable(l, func(i, j int) bool {
+			return entries[l[i]].Timestamp.After(entries[l[j]].Timestamp)
+		})
+	}
+	return idx
+}
+
+// current indicates if the index was built from the entries.
+func (idx *keytabIndex) current(entries []entry) bool {
+	if len(idx.entries) != len(entries) || cap(idx.entries) != cap(entries) {
+		return false
+	}
+	return len(entries) == 0 || &idx.entries[0] == &entries[0]
+}
+
+// lookup returns the entries of the keytab for the principal, realm and encryption type, newest first.
+func (kt *Keytab) lookup(princName types.PrincipalName, realm string, etype int32) []entry {
+	entries := kt.Entries
+	idx, _ := kt.index.Load().(*keytabIndex)
+	if idx == nil || !idx.current(entries) {
+		idx = buildIndex(entries)
+		kt.index.Store(idx)
+	}
+	l := idx.keys[newIndexKey(princName.NameString, realm, etype)]
+	es := make([]entry, 0, len(l))
+	for _, i := range l {
+		// Components containing a "/" could share a key of the index with other principals.
+		if entries[i].Principal.matches(princName) {
+			es = append(es, entries[i])
+		}
+	}
+	return es
+}
+
+// resetIndex discards the index of the keytab, which must be done when entries are replaced in place.
+func (kt *Keytab) resetIndex() {
+	kt.index.Store((*keytabIndex)(nil))
+}
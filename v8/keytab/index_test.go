@@ -0,0 +1,68 @@
+package keytab
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeytab_Index(t *testing.T) {
+	t.Parallel()
+	kt := New()
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 1000; i++ {
+		for kvno := uint32(1); kvno <= 2; kvno++ {
+			key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte(fmt.Sprintf("%d-%d", i, kvno))}
+			kt.addKeyEntry(fmt.Sprintf("hdfs/node%d.test.gokrb5", i), "TEST.GOKRB5", key, ts.Add(time.Duration(kvno)*time.Hour), kvno)
+		}
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling keytab: %v", err)
+	}
+	kt = New()
+	if err := kt.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling keytab: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, fmt.Sprintf("hdfs/node%d.test.gokrb5", i*100))
+			k, kvno, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+			if assert.NoError(t, err, "error getting key") {
+				assert.Equal(t, 2, kvno, "newest key should be returned")
+				assert.Equal(t, fmt.Sprintf("%d-2", i*100), string(k.KeyValue), "key not as expected")
+			}
+			k, _, err = kt.GetEncryptionKey(pn, "TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+			if assert.NoError(t, err, "error getting key") {
+				assert.Equal(t, fmt.Sprintf("%d-1", i*100), string(k.KeyValue), "key of the kvno not as expected")
+			}
+		}(i)
+	}
+	wg.Wait()
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "hdfs/node0.test.gokrb5")
+	_, _, err = kt.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES128_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "key of another encryption type should not be found")
+
+	// The index follows entries added to or removed from the keytab, including directly to its Entries.
+	kt.AddKey("hdfs/node0.test.gokrb5", "TEST.GOKRB5", types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("new")}, 3)
+	_, kvno, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.NoError(t, err, "error getting key")
+	assert.Equal(t, 3, kvno, "key added should be found")
+	kt.RemoveBeforeKVNO("hdfs/node0.test.gokrb5", "TEST.GOKRB5", 3)
+	_, _, err = kt.GetEncryptionKey(pn, "TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "key removed should not be found")
+	kt.Entries = append(kt.Entries[:0:0], testRotationKeytab().Entries...)
+	_, kvno, err = kt.GetEncryptionKey(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5"), "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.NoError(t, err, "key of the entries set should be found")
+	assert.Equal(t, 3, kvno, "KVNO not as expected")
+}
@@ -9,11 +9,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
 
@@ -25,6 +30,10 @@ const (
 type Keytab struct {
 	version uint8
 	Entries []entry
+	// omitKVNO32 omits the 32-bit key version from entries whose key version fits in the 8-bit field.
+	omitKVNO32 bool
+	// index holds the *keytabIndex of the entries used by the key lookups.
+	index atomic.Value
 }
 
 // Keytab entry struct.
@@ -36,13 +45,27 @@ type entry struct {
 	KVNO      uint32
 }
 
+// String returns a description of the entry with the key value redacted so that it can be logged safely.
 func (e entry) String() string {
-	return fmt.Sprintf("% 4d %s %-56s %2d %-64x",
+	return e.format(fmt.Sprintf("[%d bytes redacted]", len(e.Key.KeyValue)))
+}
+
+// DebugDump returns a description of the entry including the key value if the types.DebugDumpEnvVar environment
+// variable is set to "1". Otherwise the key value is redacted as for String.
+func (e entry) DebugDump() string {
+	if !types.DebugDumpEnabled() {
+		return e.String()
+	}
+	return e.format(fmt.Sprintf("%x", e.Key.KeyValue))
+}
+
+func (e entry) format(key string) string {
+	return fmt.Sprintf("% 4d %s %-56s %2d %-64s",
 		e.KVNO8,
 		e.Timestamp.Format("02/01/06 15:04:05"),
 		e.Principal.String(),
 		e.Key.KeyType,
-		e.Key.KeyValue,
+		key,
 	)
 }
 
@@ -71,33 +94,68 @@ func New() *Keytab {
 // If the kvno is zero then the latest kvno will be returned. The kvno is also returned for
 func (kt *Keytab) GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
 	var key types.EncryptionKey
-	var t time.Time
 	var kv int
-	for _, k := range kt.Entries {
-		if k.Principal.Realm == realm && len(k.Principal.Components) == len(princName.NameString) &&
-			k.Key.KeyType == etype &&
-			(k.KVNO == uint32(kvno) || kvno == 0) &&
-			k.Timestamp.After(t) {
-			p := true
-			for i, n := range k.Principal.Components {
-				if princName.NameString[i] != n {
-					p = false
-					break
-				}
-			}
-			if p {
-				key = k.Key
-				kv = int(k.KVNO)
-				t = k.Timestamp
-			}
+	for _, k := range kt.lookup(princName, realm, etype) {
+		if k.KVNO == uint32(kvno) || kvno == 0 {
+			key = k.Key
+			kv = int(k.KVNO)
+			break
 		}
 	}
 	if len(key.KeyValue) < 1 {
-		return key, 0, fmt.Errorf("matching key not found in keytab. Looking for %v realm: %v kvno: %v etype: %v", princName.NameString, realm, kvno, etype)
+		return key, 0, krberror.WithKind(fmt.Errorf("matching key not found in keytab. Looking for %v realm: %v kvno: %v etype: %v", princName.NameString, realm, kvno, etype), krberror.KindCredentials)
 	}
 	return key, kv, nil
 }
 
+// GetEncryptionKeyCandidates returns the keys from the Keytab with the required etype that may be used to decrypt a ticket
+// for the principal.
+// The key with the required kvno is returned first, followed by the keys with other kvnos, newest first.
+func (kt *Keytab) GetEncryptionKeyCandidates(princName types.PrincipalName, realm string, kvno int, etype int32) ([]types.EncryptionKey, error) {
+	var es []entry
+	for _, k := range kt.lookup(princName, realm, etype) {
+		if len(k.Key.KeyValue) > 0 {
+			es = append(es, k)
+		}
+	}
+	if len(es) < 1 {
+		return nil, krberror.WithKind(fmt.Errorf("matching key not found in keytab. Looking for %v realm: %v kvno: %v etype: %v", princName.NameString, realm, kvno, etype), krberror.KindCredentials)
+	}
+	sort.SliceStable(es, func(i, j int) bool {
+		if (es[i].KVNO == uint32(kvno)) != (es[j].KVNO == uint32(kvno)) {
+			return es[i].KVNO == uint32(kvno)
+		}
+		return es[i].Timestamp.After(es[j].Timestamp)
+	})
+	keys := make([]types.EncryptionKey, 0, len(es))
+	for _, e := range es {
+		dup := false
+		for _, k := range keys {
+			if bytes.Equal(k.KeyValue, e.Key.KeyValue) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			keys = append(keys, e.Key)
+		}
+	}
+	return keys, nil
+}
+
+// matches indicates if the keytab principal's components are those of the principal name provided.
+func (p principal) matches(princName types.PrincipalName) bool {
+	if len(p.Components) != len(princName.NameString) {
+		return false
+	}
+	for i, n := range p.Components {
+		if princName.NameString[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
 // Create a new Keytab entry.
 func newEntry() entry {
 	var b []byte
@@ -113,17 +171,29 @@ func newEntry() entry {
 	}
 }
 
+// String returns a table of the keytab entries with the key values redacted.
 func (kt Keytab) String() string {
-	var s string
-	s = `KVNO Timestamp         Principal                                                ET Key
----- ----------------- -------------------------------------------------------- -- ----------------------------------------------------------------
-`
+	s := keytabTableHeader
 	for _, entry := range kt.Entries {
 		s += entry.String() + "\n"
 	}
 	return s
 }
 
+// DebugDump returns a table of the keytab entries including the key values if the types.DebugDumpEnvVar environment
+// variable is set to "1". Otherwise the key values are redacted as for String.
+func (kt Keytab) DebugDump() string {
+	s := keytabTableHeader
+	for _, entry := range kt.Entries {
+		s += entry.DebugDump() + "\n"
+	}
+	return s
+}
+
+const keytabTableHeader = `KVNO Timestamp         Principal                                                ET Key
+---- ----------------- -------------------------------------------------------- -- ----------------------------------------------------------------
+`
+
 // AddEntry adds an entry to the keytab. The password should be provided in plain text and it will be converted using the defined enctype to be stored.
 func (kt *Keytab) AddEntry(principalName, realm, password string, ts time.Time, KVNO uint8, encType int32) error {
 	// Generate a key from the password
@@ -137,9 +207,46 @@ func (kt *Keytab) AddEntry(principalName, realm, password string, ts time.Time,
 	return nil
 }
 
+// AddEntryWithSalt adds an entry to the keytab using the salt provided to convert the password rather than the
+// default salt derived from the principal name. This is required for Active Directory accounts whose salt is
+// derived from the sAMAccountName, see crypto.ADUserSalt, crypto.ADComputerSalt and crypto.ADTrustSalt.
+func (kt *Keytab) AddEntryWithSalt(principalName, realm, password, salt string, ts time.Time, KVNO uint8, encType int32) error {
+	key, err := crypto.GetKeyFromPasswordAndSalt(password, salt, encType)
+	if err != nil {
+		return err
+	}
+	kt.AddKeyEntry(principalName, realm, key, ts, KVNO)
+	return nil
+}
+
+// AddEntryFromPassword adds an entry to the keytab for the password, as ktutil's addent -password does. The key is
+// derived using the encryption type's string2key function with the default salt of the realm followed by the
+// components of the principal name. The entry is timestamped with the current time and key versions greater than
+// 255 are retained in the entry's 32-bit key version.
+//
+// Use AddEntryWithSalt for accounts, such as Active Directory accounts, whose salt is not the default.
+func (kt *Keytab) AddEntryFromPassword(principalName, realm, password string, kvno uint32, encType int32) error {
+	princ, _ := types.ParseSPNString(principalName)
+	key, err := crypto.GetKeyFromPasswordAndSalt(password, princ.GetSalt(realm), encType)
+	if err != nil {
+		return fmt.Errorf("error deriving key for %s@%s: %w", principalName, realm, err)
+	}
+	kt.addKeyEntry(principalName, realm, key, time.Now().UTC(), kvno)
+	return nil
+}
+
 // AddKeyEntry adds an entry to the keytab.
 func (kt *Keytab) AddKeyEntry(principalName, realm string, key types.EncryptionKey, ts time.Time, KVNO uint8) {
-	// Generate a key from the password
+	kt.addKeyEntry(principalName, realm, key, ts, uint32(KVNO))
+}
+
+// AddKey adds an entry to the keytab for the key, such as a key exported from the KDC's database. The entry is
+// timestamped with the current time and key versions greater than 255 are retained in the entry's 32-bit key version.
+func (kt *Keytab) AddKey(principalName, realm string, key types.EncryptionKey, kvno uint32) {
+	kt.addKeyEntry(principalName, realm, key, time.Now().UTC(), kvno)
+}
+
+func (kt *Keytab) addKeyEntry(principalName, realm string, key types.EncryptionKey, ts time.Time, kvno uint32) {
 	princ, _ := types.ParseSPNString(principalName)
 
 	// Populate the keytab entry principal
@@ -157,8 +264,8 @@ func (kt *Keytab) AddKeyEntry(principalName, realm string, key types.EncryptionK
 	e := newEntry()
 	e.Principal = ktep
 	e.Timestamp = ts
-	e.KVNO8 = KVNO
-	e.KVNO = uint32(KVNO)
+	e.KVNO8 = uint8(kvno)
+	e.KVNO = kvno
 	e.Key = key
 
 	kt.Entries = append(kt.Entries, e)
@@ -190,7 +297,7 @@ func Load(ktPath string) (*Keytab, error) {
 func (kt *Keytab) Marshal() ([]byte, error) {
 	b := []byte{keytabFirstByte, kt.version}
 	for _, e := range kt.Entries {
-		eb, err := e.marshal(int(kt.version))
+		eb, err := e.marshal(int(kt.version), kt.omitKVNO32)
 		if err != nil {
 			return b, err
 		}
@@ -199,16 +306,57 @@ func (kt *Keytab) Marshal() ([]byte, error) {
 	return b, nil
 }
 
+// JavaCompatible returns a copy of the keytab that marshals entries in the form written by Java's ktab tool,
+// without the 32-bit key version unless the key version does not fit in the 8-bit field.
+func (kt *Keytab) JavaCompatible() *Keytab {
+	return &Keytab{
+		version:    2,
+		Entries:    append([]entry{}, kt.Entries...),
+		omitKVNO32: true,
+	}
+}
+
 // Write the keytab bytes to io.Writer.
 // Returns the number of bytes written
 func (kt *Keytab) Write(w io.Writer) (int, error) {
 	b, err := kt.Marshal()
 	if err != nil {
-		return 0, fmt.Errorf("error marshaling keytab: %v", err)
+		return 0, fmt.Errorf("error marshaling keytab: %w", err)
 	}
 	return w.Write(b)
 }
 
+// Save writes the keytab to the file path provided, which is created with permissions that only allow access by the
+// current user. The data is written to a temporary file in the same directory which then replaces ktPath, so a
+// process reading the keytab never sees a partially written file.
+func (kt *Keytab) Save(ktPath string) error {
+	b, err := kt.Marshal()
+	if err != nil {
+		return fmt.Errorf("error marshaling keytab: %w", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(ktPath), "."+filepath.Base(ktPath)+".")
+	if err != nil {
+		return fmt.Errorf("error creating temporary keytab file: %w", err)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if err = f.Chmod(0600); err == nil {
+		if _, err = f.Write(b); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing keytab: %w", err)
+	}
+	if err = os.Rename(tmp, ktPath); err != nil {
+		return fmt.Errorf("error replacing keytab file: %w", err)
+	}
+	return nil
+}
+
 // Unmarshal byte slice of Keytab data into Keytab type.
 func (kt *Keytab) Unmarshal(b []byte) error {
 	if len(b) < 2 {
@@ -308,10 +456,11 @@ func (kt *Keytab) Unmarshal(b []byte) error {
 			return err
 		}
 	}
+	kt.index.Store(buildIndex(kt.Entries))
 	return nil
 }
 
-func (e entry) marshal(v int) ([]byte, error) {
+func (e entry) marshal(v int, omitKVNO32 bool) ([]byte, error) {
 	var b []byte
 	pb, err := e.Principal.marshal(v)
 	if err != nil {
@@ -339,9 +488,11 @@ func (e entry) marshal(v int) ([]byte, error) {
 	}
 	b = append(b, buf.Bytes()...)
 
-	t = make([]byte, 4)
-	endian.PutUint32(t, e.KVNO)
-	b = append(b, t...)
+	if !omitKVNO32 || e.KVNO > 255 {
+		t = make([]byte, 4)
+		endian.PutUint32(t, e.KVNO)
+		b = append(b, t...)
+	}
 
 	// Add the length header
 	t = make([]byte, 4)
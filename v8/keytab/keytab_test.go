@@ -4,6 +4,8 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
@@ -249,3 +251,205 @@ func TestKeytab_GetEncryptionKey(t *testing.T) {
 	}
 	assert.Equal(t, 3, kvno)
 }
+
+func TestKeytab_GetEncryptionKeyCandidates(t *testing.T) {
+	t.Parallel()
+	princ := "HTTP/princ.test.gokrb5"
+	realm := "TEST.GOKRB5"
+
+	kt := New()
+	kt.AddEntry(princ, realm, "kvno1", time.Unix(100, 0), 1, 18)
+	kt.AddEntry(princ, realm, "kvno2", time.Unix(300, 0), 2, 18)
+	kt.AddEntry(princ, realm, "kvno3", time.Unix(200, 0), 3, 18)
+	kt.AddEntry(princ, realm, "kvno3", time.Unix(200, 0), 3, 17)
+	kt.AddEntry("HTTP/other.test.gokrb5", realm, "other", time.Unix(500, 0), 1, 18)
+
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, princ)
+	keys, err := kt.GetEncryptionKeyCandidates(pn, realm, 3, 18)
+	if err != nil {
+		t.Fatalf("error getting candidate keys: %v", err)
+	}
+	assert.Equal(t, []types.EncryptionKey{kt.Entries[2].Key, kt.Entries[1].Key, kt.Entries[0].Key}, keys, "candidate keys not as expected")
+
+	// The kvno in the ticket may not match any of the keytab entries
+	keys, err = kt.GetEncryptionKeyCandidates(pn, realm, 259, 18)
+	if err != nil {
+		t.Fatalf("error getting candidate keys: %v", err)
+	}
+	assert.Equal(t, kt.Entries[1].Key, keys[0], "newest key should be tried first")
+
+	keys, err = kt.GetEncryptionKeyCandidates(pn, realm, 3, 17)
+	if err != nil {
+		t.Fatalf("error getting candidate keys: %v", err)
+	}
+	assert.Equal(t, []types.EncryptionKey{kt.Entries[3].Key}, keys, "candidate keys not as expected")
+
+	_, err = kt.GetEncryptionKeyCandidates(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/alias.test.gokrb5"), realm, 1, 18)
+	assert.Error(t, err, "expected error for a principal without keys")
+	_, err = kt.GetEncryptionKeyCandidates(pn, "OTHER.GOKRB5", 0, 18)
+	assert.Error(t, err, "expected error for a realm without keys")
+}
+
+func TestKeytab_AddEntryWithSalt(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	ref := New()
+	err := ref.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing keytab data: %v\n", err)
+	}
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	want, _, err := ref.GetEncryptionKey(pn, "TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+
+	// The key for a UPN style principal is derived using the salt of the account rather than the principal.
+	kt := New()
+	err = kt.AddEntryWithSalt("user.one", "TEST.GOKRB5", "passwordvalue", "TEST.GOKRB5testuser1", time.Unix(100, 0), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+	key, kvno, err := kt.GetEncryptionKey(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user.one"), "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 1, kvno, "KVNO not as expected")
+	assert.Equal(t, want.KeyValue, key.KeyValue, "Key not as expected")
+}
+
+func TestKeytab_AddEntryFromPassword(t *testing.T) {
+	t.Parallel()
+	ref := New()
+	for _, et := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC} {
+		err := ref.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Unix(100, 0), 2, et)
+		if err != nil {
+			t.Fatalf("Error adding entry: %v", err)
+		}
+	}
+	kt := New()
+	for _, et := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC} {
+		err := kt.AddEntryFromPassword("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", 2, et)
+		if err != nil {
+			t.Fatalf("Error adding entry: %v", err)
+		}
+	}
+	err := kt.AddEntryFromPassword("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", 300, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+	err = kt.AddEntryFromPassword("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", 1, 999)
+	assert.Error(t, err, "an unsupported encryption type should return an error")
+
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	for _, et := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC} {
+		want, _, err := ref.GetEncryptionKey(pn, "TEST.GOKRB5", 2, et)
+		if err != nil {
+			t.Fatalf("Error getting key: %v", err)
+		}
+		key, kvno, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 2, et)
+		if err != nil {
+			t.Fatalf("Error getting key: %v", err)
+		}
+		assert.Equal(t, 2, kvno, "KVNO not as expected")
+		assert.Equal(t, want, key, "Key not as expected")
+	}
+
+	// Write the keytab to file and load it back.
+	dir, err := ioutil.TempDir("", "keytab")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ktPath := filepath.Join(dir, "krb5.keytab")
+	err = kt.Save(ktPath)
+	if err != nil {
+		t.Fatalf("Error saving keytab: %v", err)
+	}
+	fi, err := os.Stat(ktPath)
+	if err != nil {
+		t.Fatalf("Error getting file info: %v", err)
+	}
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "File permissions not as expected")
+	l, err := Load(ktPath)
+	if err != nil {
+		t.Fatalf("Error loading saved keytab: %v", err)
+	}
+	assert.Equal(t, len(kt.Entries), len(l.Entries), "Number of entries not as expected")
+	_, kvno, err := l.GetEncryptionKey(pn, "TEST.GOKRB5", 300, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 300, kvno, "KVNO greater than 255 not retained")
+}
+
+func TestKeytab_JavaCompatible(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	kt := New()
+	err := kt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing keytab data: %v\n", err)
+	}
+	jkt := kt.JavaCompatible()
+	jb, err := jkt.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling: %v", err)
+	}
+	assert.Equal(t, len(b)-4*len(kt.Entries), len(jb), "32-bit key versions should have been omitted")
+	kt2 := New()
+	err = kt2.Unmarshal(jb)
+	if err != nil {
+		t.Fatalf("Error parsing marshaled bytes: %v", err)
+	}
+	assert.Equal(t, kt.Entries, kt2.Entries, "Entries not as expected")
+
+	// A key version too large for the 8-bit field must still be written in the 32-bit field.
+	jkt.Entries[0].KVNO8 = 44
+	jkt.Entries[0].KVNO = 300
+	jb, err = jkt.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling: %v", err)
+	}
+	kt2 = New()
+	err = kt2.Unmarshal(jb)
+	if err != nil {
+		t.Fatalf("Error parsing marshaled bytes: %v", err)
+	}
+	assert.Equal(t, uint32(300), kt2.Entries[0].KVNO, "KVNO not as expected")
+	assert.Equal(t, uint32(1), kt.Entries[0].KVNO, "Original keytab should not be modified")
+}
+
+func TestKeytab_String_Redacted(t *testing.T) {
+	kt := New()
+	err := kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Unix(1600000000, 0), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error adding entry: %v", err)
+	}
+	key := fmt.Sprintf("%x", kt.Entries[0].Key.KeyValue)
+	for _, s := range []string{kt.String(), fmt.Sprintf("%v", kt.Entries), fmt.Sprintf("%+v", *kt), fmt.Sprintf("%#v", kt.Entries)} {
+		assert.NotContains(t, s, key, "key value should be redacted")
+	}
+	assert.Contains(t, kt.String(), "HTTP/host.test.gokrb5@TEST.GOKRB5", "principal not in output")
+	assert.Contains(t, kt.String(), "[32 bytes redacted]", "redaction not in output")
+
+	os.Unsetenv(types.DebugDumpEnvVar)
+	assert.Equal(t, kt.String(), kt.DebugDump(), "key value should be redacted unless enabled")
+	os.Setenv(types.DebugDumpEnvVar, "1")
+	defer os.Unsetenv(types.DebugDumpEnvVar)
+	assert.Contains(t, kt.DebugDump(), key, "key value not in debug dump")
+}
+
+func TestKeytab_AddKey(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	kt := New()
+	kt.AddKey("HTTP/host.test.gokrb5", "TEST.GOKRB5", key, 300)
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	k, kvno, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 300, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 300, kvno, "KVNO greater than 255 should be retained")
+	assert.Equal(t, key, k, "Key not as expected")
+}
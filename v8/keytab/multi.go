@@ -0,0 +1,154 @@
+package keytab
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// MultiKeyProvider is a CandidateKeyProvider serving the keys of several keytabs or other key providers, so that a
+// single service can accept tickets for several service principals, for example the virtual hosts served by one
+// listener. Service principals can be mapped to the key providers holding their keys and grouped as aliases of the same
+// account, whose keys are then tried for a ticket issued to any of the aliases.
+//
+//	kp := keytab.NewMultiKeyProvider(kt)
+//	kp.AddSPN("HTTP/b.example.com", ktB)
+//	kp.AddAliases("HTTP/a.example.com", "HTTP/alias.example.com", "host/x.example.com")
+//	s := service.NewSettings(nil, service.KeyProvider(kp))
+type MultiKeyProvider struct {
+	mux       sync.RWMutex
+	providers []KeyProvider
+	spns      map[string][]KeyProvider
+	aliases   map[string][]string
+}
+
+// NewMultiKeyProvider returns a MultiKeyProvider looking up the keys of the service principals not mapped with AddSPN
+// in the key providers, in the order provided.
+func NewMultiKeyProvider(kps ...KeyProvider) *MultiKeyProvider {
+	return &MultiKeyProvider{
+		providers: kps,
+		spns:      make(map[string][]KeyProvider),
+		aliases:   make(map[string][]string),
+	}
+}
+
+// AddSPN maps the service principal, such as "HTTP/host.example.com", to the key provider so that its keys are only
+// looked up in the key providers mapped to it.
+func (m *MultiKeyProvider) AddSPN(spn string, kp KeyProvider) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.spns[spn] = append(m.spns[spn], kp)
+}
+
+// AddAliases groups the service principals as aliases of the same account, such as the SPNs registered on an Active
+// Directory service account, so that the keys of any of them can decrypt a ticket issued to another.
+func (m *MultiKeyProvider) AddAliases(spns ...string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for _, spn := range spns {
+		for _, a := range spns {
+			if a != spn && !containsString(m.aliases[spn], a) {
+				m.aliases[spn] = append(m.aliases[spn], a)
+			}
+		}
+	}
+}
+
+// GetEncryptionKey returns the key for the principal, or else for its aliases, from the first key provider holding
+// one. If the kvno is zero then the key with the latest kvno in that key provider is returned.
+func (m *MultiKeyProvider) GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+	for _, pn := range m.names(princName) {
+		for _, kp := range m.keyProviders(pn) {
+			if key, kv, err := kp.GetEncryptionKey(pn, realm, kvno, etype); err == nil {
+				return key, kv, nil
+			}
+		}
+	}
+	return types.EncryptionKey{}, 0, errKeyNotFound(princName, realm, kvno, etype)
+}
+
+// GetEncryptionKeyCandidates returns the keys that may be used to decrypt a ticket for the principal: those of the
+// principal and then of its aliases. The candidates of key providers that are not CandidateKeyProviders are the keys
+// with the kvno, the adjacent kvnos and the latest kvno.
+func (m *MultiKeyProvider) GetEncryptionKeyCandidates(princName types.PrincipalName, realm string, kvno int, etype int32) ([]types.EncryptionKey, error) {
+	var keys []types.EncryptionKey
+	for _, pn := range m.names(princName) {
+		for _, kp := range m.keyProviders(pn) {
+			for _, key := range providerCandidates(kp, pn, realm, kvno, etype) {
+				if !containsKey(keys, key) {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	if len(keys) < 1 {
+		return nil, errKeyNotFound(princName, realm, kvno, etype)
+	}
+	return keys, nil
+}
+
+// names returns the principal followed by its aliases.
+func (m *MultiKeyProvider) names(princName types.PrincipalName) []types.PrincipalName {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	names := []types.PrincipalName{princName}
+	for _, a := range m.aliases[princName.PrincipalNameString()] {
+		names = append(names, types.NewPrincipalName(princName.NameType, a))
+	}
+	return names
+}
+
+// keyProviders returns the key providers mapped to the principal, or all the key providers if none are.
+func (m *MultiKeyProvider) keyProviders(princName types.PrincipalName) []KeyProvider {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if kps, ok := m.spns[princName.PrincipalNameString()]; ok {
+		return kps
+	}
+	return m.providers
+}
+
+// providerCandidates returns the candidate keys of the key provider for the principal.
+func providerCandidates(kp KeyProvider, princName types.PrincipalName, realm string, kvno int, etype int32) []types.EncryptionKey {
+	if ckp, ok := kp.(CandidateKeyProvider); ok {
+		keys, _ := ckp.GetEncryptionKeyCandidates(princName, realm, kvno, etype)
+		return keys
+	}
+	kvnos := []int{kvno}
+	if kvno > 0 {
+		// A kvno of zero looks up the latest key.
+		kvnos = append(kvnos, kvno+1, kvno-1, 0)
+	}
+	var keys []types.EncryptionKey
+	for _, kv := range kvnos {
+		if key, _, err := kp.GetEncryptionKey(princName, realm, kv, etype); err == nil && !containsKey(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func containsKey(keys []types.EncryptionKey, key types.EncryptionKey) bool {
+	for _, k := range keys {
+		if k.KeyType == key.KeyType && bytes.Equal(k.KeyValue, key.KeyValue) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+func errKeyNotFound(princName types.PrincipalName, realm string, kvno int, etype int32) error {
+	return krberror.WithKind(fmt.Errorf("matching key not found in key providers. Looking for %v realm: %v kvno: %v etype: %v", princName.NameString, realm, kvno, etype), krberror.KindCredentials)
+}
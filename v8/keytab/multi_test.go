@@ -0,0 +1,77 @@
+package keytab
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMultiKeytab(t *testing.T, spn, password string, kvno uint32) *Keytab {
+	kt := New()
+	if err := kt.AddEntryFromPassword(spn, "TEST.GOKRB5", password, kvno, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("Error adding keytab entry: %v", err)
+	}
+	return kt
+}
+
+func TestMultiKeyProvider_GetEncryptionKey(t *testing.T) {
+	t.Parallel()
+	ktA := testMultiKeytab(t, "HTTP/a.test.gokrb5", "passwordA", 1)
+	ktB := testMultiKeytab(t, "HTTP/b.test.gokrb5", "passwordB", 2)
+	ktC := testMultiKeytab(t, "HTTP/c.test.gokrb5", "passwordC", 3)
+	kp := NewMultiKeyProvider(ktA, ktB)
+	kp.AddSPN("HTTP/c.test.gokrb5", ktC)
+	kp.AddAliases("HTTP/a.test.gokrb5", "HTTP/alias.test.gokrb5")
+
+	b := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/b.test.gokrb5")
+	key, kvno, err := kp.GetEncryptionKey(b, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 2, kvno, "KVNO not as expected")
+	want, _, _ := ktB.GetEncryptionKey(b, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Equal(t, want, key, "key not from the keytab holding it")
+
+	c := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/c.test.gokrb5")
+	_, kvno, err = kp.GetEncryptionKey(c, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key of mapped SPN: %v", err)
+	}
+	assert.Equal(t, 3, kvno, "KVNO not as expected")
+
+	alias := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/alias.test.gokrb5")
+	_, kvno, err = kp.GetEncryptionKey(alias, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key of alias: %v", err)
+	}
+	assert.Equal(t, 1, kvno, "KVNO not as expected")
+
+	_, _, err = kp.GetEncryptionKey(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/d.test.gokrb5"), "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "key should not be found for an unknown SPN")
+}
+
+func TestMultiKeyProvider_GetEncryptionKeyCandidates(t *testing.T) {
+	t.Parallel()
+	ktA := testMultiKeytab(t, "HTTP/a.test.gokrb5", "passwordA", 1)
+	// A key provider that is not a CandidateKeyProvider is tried with adjacent kvnos.
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/b.test.gokrb5")
+	ktB := testMultiKeytab(t, "HTTP/b.test.gokrb5", "passwordB", 4)
+	kpB := KeyProviderFunc(ktB.GetEncryptionKey)
+	kp := NewMultiKeyProvider(ktA)
+	kp.AddSPN("HTTP/b.test.gokrb5", kpB)
+	kp.AddAliases("HTTP/a.test.gokrb5", "HTTP/b.test.gokrb5")
+
+	keys, err := kp.GetEncryptionKeyCandidates(pn, "TEST.GOKRB5", 5, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting candidate keys: %v", err)
+	}
+	wantB, _, _ := ktB.GetEncryptionKey(pn, "TEST.GOKRB5", 4, etypeID.AES256_CTS_HMAC_SHA1_96)
+	wantA, _, _ := ktA.GetEncryptionKey(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/a.test.gokrb5"), "TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Equal(t, []types.EncryptionKey{wantB, wantA}, keys, "candidate keys not as expected")
+
+	_, err = kp.GetEncryptionKeyCandidates(pn, "OTHER.GOKRB5", 5, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "keys should not be found for another realm")
+}
@@ -0,0 +1,118 @@
+package keytab
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// KeyProvider is implemented by sources of long-term keys.
+//
+// A Keytab is a KeyProvider. Other implementations allow services to obtain their keys on demand, for example from
+// a KMS, so that a keytab file never has to be written to disk.
+// If the kvno is zero the key with the latest kvno should be returned. The kvno of the key returned is also returned.
+type KeyProvider interface {
+	GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error)
+}
+
+// CandidateKeyProvider is a KeyProvider that can return all of the keys that may have been used to encrypt a ticket.
+// This allows a ticket to be decrypted when the kvno in the ticket does not match that of the key, for example when
+// it has been truncated to 8 bits, or when the ticket was issued for an alias of the principal.
+// The keys should be returned in order of preference.
+type CandidateKeyProvider interface {
+	KeyProvider
+	GetEncryptionKeyCandidates(princName types.PrincipalName, realm string, kvno int, etype int32) ([]types.EncryptionKey, error)
+}
+
+// KeyProviderFunc is an adapter to allow the use of ordinary functions as a KeyProvider.
+type KeyProviderFunc func(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error)
+
+// GetEncryptionKey calls f(princName, realm, kvno, etype).
+func (f KeyProviderFunc) GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+	return f(princName, realm, kvno, etype)
+}
+
+// Unwrapper returns the plain key bytes for wrapped key material, for example by calling a KMS decrypt operation.
+type Unwrapper func(wrapped []byte) ([]byte, error)
+
+// WrappedKey is a long-term key whose value is held wrapped (encrypted) by an external key management service.
+type WrappedKey struct {
+	Principal types.PrincipalName
+	Realm     string
+	KVNO      int
+	KeyType   int32
+	Wrapped   []byte
+}
+
+// WrappedKeyProvider is a KeyProvider that unwraps keys on first use and holds them only in memory.
+type WrappedKeyProvider struct {
+	unwrap Unwrapper
+	keys   []WrappedKey
+	plain  map[int]types.EncryptionKey
+	mux    sync.Mutex
+}
+
+// NewWrappedKeyProvider creates a new WrappedKeyProvider for the wrapped keys provided.
+func NewWrappedKeyProvider(unwrap Unwrapper, keys ...WrappedKey) *WrappedKeyProvider {
+	return &WrappedKeyProvider{
+		unwrap: unwrap,
+		keys:   keys,
+		plain:  make(map[int]types.EncryptionKey),
+	}
+}
+
+// Unwrap unwraps all the keys held by the provider so that subsequent lookups do not call the Unwrapper.
+// This can be used to fetch the keys at service start up.
+func (p *WrappedKeyProvider) Unwrap() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for i := range p.keys {
+		if _, err := p.unwrapKey(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEncryptionKey returns the key for the principal with the required kvno and etype.
+// If the kvno is zero then the key with the latest kvno will be returned.
+func (p *WrappedKeyProvider) GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	idx := -1
+	for i, k := range p.keys {
+		if k.Realm == realm && k.KeyType == etype && k.Principal.Equal(princName) &&
+			(k.KVNO == kvno || kvno == 0) {
+			if idx < 0 || k.KVNO > p.keys[idx].KVNO {
+				idx = i
+			}
+		}
+	}
+	if idx < 0 {
+		return types.EncryptionKey{}, 0, fmt.Errorf("matching key not found in key provider. Looking for %v realm: %v kvno: %v etype: %v", princName.NameString, realm, kvno, etype)
+	}
+	key, err := p.unwrapKey(idx)
+	if err != nil {
+		return types.EncryptionKey{}, 0, err
+	}
+	return key, p.keys[idx].KVNO, nil
+}
+
+// unwrapKey returns the plain key at index i, unwrapping it if it has not been already.
+// The caller must hold the lock.
+func (p *WrappedKeyProvider) unwrapKey(i int) (types.EncryptionKey, error) {
+	if key, ok := p.plain[i]; ok {
+		return key, nil
+	}
+	b, err := p.unwrap(p.keys[i].Wrapped)
+	if err != nil {
+		return types.EncryptionKey{}, fmt.Errorf("error unwrapping key for %s@%s kvno %d: %w", p.keys[i].Principal.PrincipalNameString(), p.keys[i].Realm, p.keys[i].KVNO, err)
+	}
+	key := types.EncryptionKey{
+		KeyType:  p.keys[i].KeyType,
+		KeyValue: b,
+	}
+	p.plain[i] = key
+	return key, nil
+}
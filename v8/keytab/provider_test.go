@@ -0,0 +1,125 @@
+package keytab
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testWrappedKeys() (types.PrincipalName, []WrappedKey) {
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	return pn, []WrappedKey{
+		{Principal: pn, Realm: "TEST.GOKRB5", KVNO: 1, KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, Wrapped: []byte("kvno1")},
+		{Principal: pn, Realm: "TEST.GOKRB5", KVNO: 3, KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, Wrapped: []byte("kvno3")},
+		{Principal: pn, Realm: "TEST.GOKRB5", KVNO: 2, KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, Wrapped: []byte("kvno2")},
+	}
+}
+
+func TestKeytab_IsKeyProvider(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	kt := New()
+	err := kt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing keytab data: %v\n", err)
+	}
+	var kp KeyProvider = kt
+	pn := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	_, kvno, err := kp.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES128_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 1, kvno, "KVNO not as expected")
+}
+
+func TestKeyProviderFunc(t *testing.T) {
+	t.Parallel()
+	var called bool
+	kp := KeyProviderFunc(func(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+		called = true
+		return types.EncryptionKey{KeyType: etype, KeyValue: []byte{1, 2, 3}}, 5, nil
+	})
+	key, kvno, err := kp.GetEncryptionKey(types.PrincipalName{}, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.True(t, called, "function not called")
+	assert.Equal(t, 5, kvno, "KVNO not as expected")
+	assert.Equal(t, []byte{1, 2, 3}, key.KeyValue, "key value not as expected")
+}
+
+func TestWrappedKeyProvider_GetEncryptionKey(t *testing.T) {
+	t.Parallel()
+	pn, keys := testWrappedKeys()
+	var calls int
+	unwrap := func(b []byte) ([]byte, error) {
+		calls++
+		return append([]byte("plain-"), b...), nil
+	}
+	kp := NewWrappedKeyProvider(unwrap, keys...)
+
+	// kvno of zero should select the latest key
+	key, kvno, err := kp.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 3, kvno, "KVNO not as expected")
+	assert.Equal(t, "plain-kvno3", string(key.KeyValue), "key value not as expected")
+	assert.Equal(t, etypeID.AES256_CTS_HMAC_SHA1_96, key.KeyType, "key type not as expected")
+
+	key, kvno, err = kp.GetEncryptionKey(pn, "TEST.GOKRB5", 2, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 2, kvno, "KVNO not as expected")
+	assert.Equal(t, "plain-kvno2", string(key.KeyValue), "key value not as expected")
+
+	// Repeat lookups should use the already unwrapped key
+	kp.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Equal(t, 2, calls, "number of unwrap calls not as expected")
+
+	_, _, err = kp.GetEncryptionKey(pn, "TEST.GOKRB5", 4, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "expected error for missing kvno")
+	_, _, err = kp.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES128_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "expected error for missing etype")
+	_, _, err = kp.GetEncryptionKey(pn, "OTHER.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "expected error for missing realm")
+}
+
+func TestWrappedKeyProvider_Unwrap(t *testing.T) {
+	t.Parallel()
+	pn, keys := testWrappedKeys()
+	var calls int
+	unwrap := func(b []byte) ([]byte, error) {
+		calls++
+		return b, nil
+	}
+	kp := NewWrappedKeyProvider(unwrap, keys...)
+	err := kp.Unwrap()
+	if err != nil {
+		t.Fatalf("Error unwrapping keys: %v", err)
+	}
+	assert.Equal(t, 3, calls, "number of unwrap calls not as expected")
+	_, _, err = kp.GetEncryptionKey(pn, "TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 3, calls, "key should not have been unwrapped again")
+}
+
+func TestWrappedKeyProvider_UnwrapError(t *testing.T) {
+	t.Parallel()
+	pn, keys := testWrappedKeys()
+	kp := NewWrappedKeyProvider(func(b []byte) ([]byte, error) {
+		return nil, errors.New("kms unavailable")
+	}, keys...)
+	_, _, err := kp.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "expected error when unwrap fails")
+	assert.Error(t, kp.Unwrap(), "expected error when unwrap fails")
+}
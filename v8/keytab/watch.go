@@ -0,0 +1,158 @@
+package keytab
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Watcher is a CandidateKeyProvider serving the keys of a keytab file that is reloaded when the file changes, so that
+// services pick up rotated keys without being restarted. The keys of the keytab replaced remain available for a grace
+// period, during which tickets issued with the previous keys can still be decrypted.
+//
+// The Watcher can be passed to the service's KeyProvider setting:
+//
+//	w, err := keytab.Watch("/etc/krb5.keytab", 30*time.Second, time.Hour, nil)
+//	s := service.NewSettings(nil, service.KeyProvider(w))
+type Watcher struct {
+	path     string
+	grace    time.Duration
+	onError  func(error)
+	mux      sync.RWMutex
+	current  *Keytab
+	previous *Keytab
+	expires  time.Time
+	loaded   []byte
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// Watch loads the keytab file at the path and checks it for changes at the interval, reloading it when its content
+// changes. The keys of the keytab replaced remain available for the grace period. If the
+// reloaded file cannot be read or parsed the keytab being served is kept and onError, if not nil, is called with the
+// error. The Watcher must be closed to stop checking the file.
+func Watch(path string, interval, grace time.Duration, onError func(error)) (*Watcher, error) {
+	w := &Watcher{
+		path:    path,
+		grace:   grace,
+		onError: onError,
+		stop:    make(chan struct{}),
+	}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	go w.watch(interval)
+	return w, nil
+}
+
+// Keytab returns the keytab currently loaded.
+func (w *Watcher) Keytab() *Keytab {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	return w.current
+}
+
+// Reload loads the keytab file, replacing the keytab currently loaded whose keys remain available for the grace
+// period. The keytab currently loaded is kept if the file cannot be read or parsed.
+func (w *Watcher) Reload() error {
+	b, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return fmt.Errorf("could not read keytab file: %w", err)
+	}
+	kt := New()
+	if err := kt.Unmarshal(b); err != nil {
+		return fmt.Errorf("could not load keytab file %s: %w", w.path, err)
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.current != nil {
+		w.previous = w.current
+		w.expires = time.Now().Add(w.grace)
+	}
+	w.current = kt
+	w.loaded = b
+	return nil
+}
+
+// Close stops checking the keytab file for changes. The keys loaded are still served.
+func (w *Watcher) Close() error {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	return nil
+}
+
+// GetEncryptionKey returns the key from the keytab currently loaded or, during the grace period, from the keytab it
+// replaced.
+func (w *Watcher) GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+	cur, prev := w.keytabs()
+	key, kv, err := cur.GetEncryptionKey(princName, realm, kvno, etype)
+	if err != nil && prev != nil {
+		if pkey, pkv, perr := prev.GetEncryptionKey(princName, realm, kvno, etype); perr == nil {
+			return pkey, pkv, nil
+		}
+	}
+	return key, kv, err
+}
+
+// GetEncryptionKeyCandidates returns the candidate keys from the keytab currently loaded followed, during the grace
+// period, by those from the keytab it replaced.
+func (w *Watcher) GetEncryptionKeyCandidates(princName types.PrincipalName, realm string, kvno int, etype int32) ([]types.EncryptionKey, error) {
+	cur, prev := w.keytabs()
+	keys, err := cur.GetEncryptionKeyCandidates(princName, realm, kvno, etype)
+	if prev == nil {
+		return keys, err
+	}
+	pkeys, perr := prev.GetEncryptionKeyCandidates(princName, realm, kvno, etype)
+	if perr != nil {
+		return keys, err
+	}
+	return append(keys, pkeys...), nil
+}
+
+// keytabs returns the keytab currently loaded and the keytab it replaced if still within the grace period.
+func (w *Watcher) keytabs() (*Keytab, *Keytab) {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	if w.previous != nil && time.Now().Before(w.expires) {
+		return w.current, w.previous
+	}
+	return w.current, nil
+}
+
+// watch checks the keytab file for changes at the interval until the Watcher is closed.
+func (w *Watcher) watch(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C:
+			if !w.changed() {
+				continue
+			}
+			if err := w.Reload(); err != nil && w.onError != nil {
+				w.onError(err)
+			}
+		}
+	}
+}
+
+// changed returns whether the content of the keytab file differs from that of the file loaded. Keytab files are small
+// and replaced keys may have the same size, so the content is compared rather than the file's size and modification
+// time, whose resolution may not distinguish successive writes.
+func (w *Watcher) changed() bool {
+	b, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		// The file may be being replaced, it is checked again at the next interval.
+		return false
+	}
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	return !bytes.Equal(b, w.loaded)
+}
@@ -0,0 +1,102 @@
+package keytab
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func saveTestKeytab(t *testing.T, path, password string, kvno uint32) {
+	kt := New()
+	if err := kt.AddEntryFromPassword("HTTP/host.test.gokrb5", "TEST.GOKRB5", password, kvno, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("Error adding keytab entry: %v", err)
+	}
+	if err := kt.Save(path); err != nil {
+		t.Fatalf("Error saving keytab: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "keytab")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	path := filepath.Join(d, "http.keytab")
+	saveTestKeytab(t, path, "old", 1)
+	errs := make(chan error, 10)
+	w, err := Watch(path, 10*time.Millisecond, 200*time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatalf("Error watching keytab: %v", err)
+	}
+	defer w.Close()
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	old, kvno, err := w.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 1, kvno, "KVNO not as expected")
+
+	// Rotate the key
+	kt := w.Keytab()
+	saveTestKeytab(t, path, "new-password", 2)
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Keytab() == kt && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if w.Keytab() == kt {
+		t.Fatal("keytab not reloaded")
+	}
+	_, kvno, err = w.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, 2, kvno, "KVNO of the reloaded keytab not as expected")
+	key, kvno, err := w.GetEncryptionKey(pn, "TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting previous key in grace period: %v", err)
+	}
+	assert.Equal(t, 1, kvno, "KVNO of the previous key not as expected")
+	assert.Equal(t, old, key, "previous key not as expected")
+	keys, err := w.GetEncryptionKeyCandidates(pn, "TEST.GOKRB5", 2, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting candidate keys: %v", err)
+	}
+	assert.Len(t, keys, 2, "candidate keys should include the previous key in the grace period")
+
+	time.Sleep(250 * time.Millisecond)
+	_, _, err = w.GetEncryptionKey(pn, "TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Error(t, err, "previous key should not be available after the grace period")
+
+	// A keytab that cannot be parsed is not loaded
+	kt = w.Keytab()
+	if err := ioutil.WriteFile(path, []byte("not a keytab"), 0600); err != nil {
+		t.Fatalf("Error writing keytab: %v", err)
+	}
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("error handler not called")
+	}
+	assert.True(t, kt == w.Keytab(), "keytab should not have been replaced")
+}
+
+func TestWatch_NoFile(t *testing.T) {
+	t.Parallel()
+	_, err := Watch(filepath.Join(os.TempDir(), "gokrb5-does-not-exist.keytab"), time.Second, time.Hour, nil)
+	assert.Error(t, err, "watching a missing keytab should fail")
+}
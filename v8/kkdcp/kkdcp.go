@@ -0,0 +1,116 @@
+// Package kkdcp implements the client side of the MS-KKDCP Kerberos Key Distribution Center Proxy Protocol so that
+// Kerberos and kpasswd messages can be sent over HTTPS to a KDC proxy, such as the Windows KDC Proxy Server or MIT's
+// kdcproxy, by clients that cannot reach the KDC directly.
+//
+// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kkdcp/
+package kkdcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// ContentType is the media type of the KDC proxy messages in HTTP requests and responses.
+const ContentType = "application/kerberos"
+
+// maxResponseSize is the largest response that will be accepted from a KDC proxy.
+const maxResponseSize = 16 << 20
+
+// KDCProxyMessage implements MS-KKDCP KDC-PROXY-MESSAGE, MS-KKDCP section 2.2.2.
+type KDCProxyMessage struct {
+	KerbMessage   []byte `asn1:"explicit,tag:0"`
+	TargetDomain  string `asn1:"generalstring,optional,explicit,tag:1"`
+	DCLocatorHint int    `asn1:"optional,explicit,tag:2"`
+}
+
+// NewKDCProxyMessage returns the KDC proxy message carrying the message b for a KDC of the realm.
+// The message is framed with its length as it would be sent to the KDC over TCP.
+func NewKDCProxyMessage(realm string, b []byte) KDCProxyMessage {
+	kb := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(kb, uint32(len(b)))
+	return KDCProxyMessage{
+		KerbMessage:  append(kb, b...),
+		TargetDomain: realm,
+	}
+}
+
+// Message returns the Kerberos message carried without the length it is framed with.
+func (m *KDCProxyMessage) Message() ([]byte, error) {
+	if len(m.KerbMessage) < 4 {
+		return nil, errors.New("KDC proxy message is too short to hold a Kerberos message")
+	}
+	l := binary.BigEndian.Uint32(m.KerbMessage)
+	if int64(l) != int64(len(m.KerbMessage)-4) {
+		return nil, fmt.Errorf("length of the Kerberos message of %d bytes does not match the %d bytes carried", l, len(m.KerbMessage)-4)
+	}
+	return m.KerbMessage[4:], nil
+}
+
+// Marshal the KDCProxyMessage.
+func (m *KDCProxyMessage) Marshal() ([]byte, error) {
+	return asn1.Marshal(*m)
+}
+
+// Unmarshal bytes into the KDCProxyMessage.
+func (m *KDCProxyMessage) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, m)
+	return err
+}
+
+// Send sends the message b for a KDC of the realm to the KDC proxy at the URL and returns the reply.
+// If c is nil http.DefaultClient is used.
+func Send(c *http.Client, url, realm string, b []byte) ([]byte, error) {
+	return SendContext(context.Background(), c, url, realm, b)
+}
+
+// SendContext sends the message b for a KDC of the realm to the KDC proxy at the URL and returns the reply, as Send
+// does. The request is abandoned if the context is done before the reply is received.
+func SendContext(ctx context.Context, c *http.Client, url, realm string, b []byte) ([]byte, error) {
+	if !strings.HasPrefix(strings.ToLower(url), "https://") {
+		return nil, fmt.Errorf("KDC proxy URL %s is not an HTTPS URL", url)
+	}
+	if c == nil {
+		c = http.DefaultClient
+	}
+	m := NewKDCProxyMessage(realm, b)
+	mb, err := m.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling KDC proxy message: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(mb))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request to KDC proxy %s: %w", url, err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", ContentType)
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending to KDC proxy %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KDC proxy %s responded with status %s", url, resp.Status)
+	}
+	rb, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from KDC proxy %s: %w", url, err)
+	}
+	if len(rb) > maxResponseSize {
+		return nil, fmt.Errorf("response from KDC proxy %s is greater than the maximum of %d bytes", url, maxResponseSize)
+	}
+	var r KDCProxyMessage
+	err = r.Unmarshal(rb)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling response from KDC proxy %s: %w", url, err)
+	}
+	return r.Message()
+}
@@ -0,0 +1,110 @@
+package kkdcp
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testProxy returns a KDC proxy that replies to each message with the reply function's response.
+func testProxy(t *testing.T, reply func(realm string, b []byte) []byte) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != ContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		var m KDCProxyMessage
+		if err := m.Unmarshal(b); err != nil {
+			t.Errorf("error unmarshaling KDC proxy message: %v", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		kb, err := m.Message()
+		if err != nil {
+			t.Errorf("error getting Kerberos message: %v", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		rm := NewKDCProxyMessage("", reply(m.TargetDomain, kb))
+		rb, _ := rm.Marshal()
+		w.Header().Set("Content-Type", ContentType)
+		w.Write(rb)
+	}))
+}
+
+func TestKDCProxyMessage(t *testing.T) {
+	t.Parallel()
+	m := NewKDCProxyMessage("TEST.GOKRB5", []byte{1, 2, 3})
+	assert.Equal(t, []byte{0, 0, 0, 3, 1, 2, 3}, m.KerbMessage, "message should be framed with its length")
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling: %v", err)
+	}
+	var u KDCProxyMessage
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", u.TargetDomain, "target domain not as expected")
+	kb, err := u.Message()
+	if err != nil {
+		t.Fatalf("error getting message: %v", err)
+	}
+	assert.Equal(t, []byte{1, 2, 3}, kb, "message not as expected")
+
+	u.KerbMessage = []byte{0, 0, 0, 4, 1, 2, 3}
+	_, err = u.Message()
+	assert.Error(t, err, "message with the wrong length should be rejected")
+	u.KerbMessage = []byte{0, 0}
+	_, err = u.Message()
+	assert.Error(t, err, "message without a length should be rejected")
+}
+
+func TestSend(t *testing.T) {
+	t.Parallel()
+	s := testProxy(t, func(realm string, b []byte) []byte {
+		return append([]byte(realm+":"), b...)
+	})
+	defer s.Close()
+
+	rb, err := Send(s.Client(), s.URL+"/KdcProxy", "TEST.GOKRB5", []byte("request"))
+	if err != nil {
+		t.Fatalf("error sending to KDC proxy: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5:request", string(rb), "reply not as expected")
+
+	_, err = Send(s.Client(), "http://"+s.Listener.Addr().String()+"/KdcProxy", "TEST.GOKRB5", []byte("request"))
+	assert.Error(t, err, "a KDC proxy URL that is not HTTPS should be rejected")
+
+	// The KDC proxy's certificate must be trusted.
+	_, err = Send(nil, s.URL+"/KdcProxy", "TEST.GOKRB5", []byte("request"))
+	assert.Error(t, err, "a KDC proxy with an untrusted certificate should be rejected")
+
+	e := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer e.Close()
+	_, err = Send(e.Client(), e.URL+"/KdcProxy", "TEST.GOKRB5", []byte("request"))
+	assert.Error(t, err, "an error status from the KDC proxy should be an error")
+}
+
+func TestSendContext(t *testing.T) {
+	t.Parallel()
+	done := make(chan struct{})
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer s.Close()
+	defer close(done)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := SendContext(ctx, s.Client(), s.URL+"/KdcProxy", "TEST.GOKRB5", []byte("request"))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "deadline exceeded error should be returned: %v", err)
+}
@@ -0,0 +1,111 @@
+package krberror
+
+import (
+	"errors"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+)
+
+// Code is a KRB_ERROR error code, RFC 4120 section 7.5.9. KRB_ERRORs returned by a KDC or service match the Code of
+// their error code with errors.Is, however they were wrapped, for example errors.Is(err, krberror.ErrPreAuthFailed).
+type Code int32
+
+// Error returns the name and description of the error code.
+func (c Code) Error() string {
+	return errorcode.Lookup(int32(c))
+}
+
+// Codes of the KRB_ERRORs programs commonly act on.
+var (
+	// ErrPreAuthFailed is the error of a wrong password or key.
+	ErrPreAuthFailed = Code(errorcode.KDC_ERR_PREAUTH_FAILED)
+	// ErrPreAuthRequired is the error of a KDC requiring pre-authentication.
+	ErrPreAuthRequired = Code(errorcode.KDC_ERR_PREAUTH_REQUIRED)
+	// ErrClientUnknown is the error of a client principal not known to the KDC.
+	ErrClientUnknown = Code(errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN)
+	// ErrServiceUnknown is the error of a service principal not known to the KDC.
+	ErrServiceUnknown = Code(errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN)
+	// ErrClientRevoked is the error of a client that is disabled or locked out.
+	ErrClientRevoked = Code(errorcode.KDC_ERR_CLIENT_REVOKED)
+	// ErrKeyExpired is the error of a client whose password has expired.
+	ErrKeyExpired = Code(errorcode.KDC_ERR_KEY_EXPIRED)
+	// ErrPolicy is the error of a request rejected by the KDC's or service's policy.
+	ErrPolicy = Code(errorcode.KDC_ERR_POLICY)
+	// ErrETypeNotSupported is the error of none of the encryption types requested being supported.
+	ErrETypeNotSupported = Code(errorcode.KDC_ERR_ETYPE_NOSUPP)
+	// ErrTicketExpired is the error of a ticket that has expired.
+	ErrTicketExpired = Code(errorcode.KRB_AP_ERR_TKT_EXPIRED)
+	// ErrTicketNotYetValid is the error of a ticket that is not yet valid.
+	ErrTicketNotYetValid = Code(errorcode.KRB_AP_ERR_TKT_NYV)
+	// ErrClockSkew is the error of the clocks of the parties differing by more than the maximum skew.
+	ErrClockSkew = Code(errorcode.KRB_AP_ERR_SKEW)
+	// ErrReplay is the error of an authenticator that has already been accepted.
+	ErrReplay = Code(errorcode.KRB_AP_ERR_REPEAT)
+	// ErrModified is the error of a message that failed its integrity check, such as a ticket that the service's key
+	// does not decrypt.
+	ErrModified = Code(errorcode.KRB_AP_ERR_MODIFIED)
+)
+
+// ErrKDCUnreachable is matched with errors.Is by the errors of failing to communicate with any of the KDCs of a realm,
+// which may succeed if retried, so that they can be told apart from the KDCs rejecting a request.
+var ErrKDCUnreachable = errors.New("KDC unreachable")
+
+// Is reports whether the error, or any error it wraps, is a KRB_ERROR with the error code.
+func Is(err error, code int32) bool {
+	return errors.Is(err, Code(code))
+}
+
+// ErrorCode returns the error code of the first KRB_ERROR in the chain of wrapped errors, and whether there is one.
+func ErrorCode(err error) (int32, bool) {
+	var c interface{ KRBErrorCode() int32 }
+	if errors.As(err, &c) {
+		return c.KRBErrorCode(), true
+	}
+	var code Code
+	if errors.As(err, &code) {
+		return int32(code), true
+	}
+	return 0, false
+}
+
+// ErrorKind returns the kind of error indicated by the error code.
+func (c Code) ErrorKind() Kind {
+	if k, ok := codeKinds[int32(c)]; ok {
+		return k
+	}
+	return KindProtocol
+}
+
+// unreachableError annotates the error of failing to communicate with the KDCs of a realm.
+type unreachableError struct {
+	err error
+}
+
+// Error function to implement the error interface.
+func (e unreachableError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error communicating with the KDCs.
+func (e unreachableError) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether the target is ErrKDCUnreachable.
+func (e unreachableError) Is(target error) bool {
+	return target == ErrKDCUnreachable
+}
+
+// ErrorKind returns KindNetwork.
+func (e unreachableError) ErrorKind() Kind {
+	return KindNetwork
+}
+
+// KDCUnreachable annotates the error of failing to communicate with the KDCs of a realm so that it matches
+// ErrKDCUnreachable with errors.Is, without changing its message.
+func KDCUnreachable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return unreachableError{err: err}
+}
@@ -0,0 +1,54 @@
+package krberror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/stretchr/testify/assert"
+)
+
+// codeTestError is a KRB_ERROR of the error code.
+type codeTestError int32
+
+func (e codeTestError) Error() string {
+	return "KRB Error"
+}
+
+func (e codeTestError) KRBErrorCode() int32 {
+	return int32(e)
+}
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, errorcode.Lookup(errorcode.KRB_AP_ERR_SKEW), ErrClockSkew.Error(), "error message not as expected")
+	assert.Equal(t, KindClock, ErrClockSkew.ErrorKind(), "kind not as expected")
+	assert.Equal(t, KindProtocol, Code(errorcode.KRB_ERR_GENERIC).ErrorKind(), "kind not as expected")
+
+	err := Errorf(fmt.Errorf("outer: %w", ErrTicketExpired), KRBMsgError, "verifying ticket")
+	assert.True(t, Is(err, errorcode.KRB_AP_ERR_TKT_EXPIRED), "wrapped code not matched")
+	assert.True(t, errors.Is(err, ErrTicketExpired), "wrapped code not matched with errors.Is")
+	assert.False(t, Is(err, errorcode.KRB_AP_ERR_SKEW), "different code matched")
+	code, ok := ErrorCode(err)
+	assert.True(t, ok, "error code not found")
+	assert.Equal(t, errorcode.KRB_AP_ERR_TKT_EXPIRED, code, "error code not as expected")
+
+	code, ok = ErrorCode(fmt.Errorf("outer: %w", codeTestError(errorcode.KDC_ERR_PREAUTH_FAILED)))
+	assert.True(t, ok, "error code not found")
+	assert.Equal(t, errorcode.KDC_ERR_PREAUTH_FAILED, code, "error code not as expected")
+	_, ok = ErrorCode(errors.New("not a KRB_ERROR"))
+	assert.False(t, ok, "error code found")
+}
+
+func TestKDCUnreachable(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, KDCUnreachable(nil), "nil error annotated")
+	cause := errors.New("connection refused")
+	err := Errorf(KDCUnreachable(cause), NetworkingError, "sending AS_REQ")
+	assert.True(t, errors.Is(err, ErrKDCUnreachable), "ErrKDCUnreachable not matched")
+	assert.True(t, errors.Is(err, cause), "cause not matched")
+	assert.Equal(t, KindNetwork, ErrorKind(err), "kind not as expected")
+	assert.Equal(t, "connection refused", KDCUnreachable(cause).Error(), "message changed")
+	assert.False(t, errors.Is(cause, ErrKDCUnreachable), "cause should not match ErrKDCUnreachable")
+}
@@ -0,0 +1,41 @@
+package krberror
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CorrelatedError is an error annotated with the correlation ID of the authentication attempt in which it occurred so
+// that failures across the AS, TGS and AP steps of an attempt can be matched in aggregated logs.
+type CorrelatedError struct {
+	CorrelationID string
+	Err           error
+}
+
+// Error function to implement the error interface.
+func (e CorrelatedError) Error() string {
+	return fmt.Sprintf("[Correlation ID: %s] %s", e.CorrelationID, e.Err.Error())
+}
+
+// Unwrap returns the error annotated with the correlation ID.
+func (e CorrelatedError) Unwrap() error {
+	return e.Err
+}
+
+// WithCorrelationID annotates the error with the correlation ID provided. The error is returned unchanged if it is nil,
+// the ID is empty or the error is already annotated with the same ID.
+func WithCorrelationID(err error, id string) error {
+	if err == nil || id == "" || CorrelationID(err) == id {
+		return err
+	}
+	return CorrelatedError{CorrelationID: id, Err: err}
+}
+
+// CorrelationID returns the correlation ID the error is annotated with or an empty string if it is not annotated.
+func CorrelationID(err error) string {
+	var e CorrelatedError
+	if errors.As(err, &e) {
+		return e.CorrelationID
+	}
+	return ""
+}
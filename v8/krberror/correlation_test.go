@@ -0,0 +1,22 @@
+package krberror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithCorrelationID(t *testing.T) {
+	cause := Errorf(errors.New("root"), "cause", "some text")
+	err := WithCorrelationID(cause, "abc")
+	assert.Equal(t, "[Correlation ID: abc] [Root cause: cause] cause: some text: root", err.Error())
+	assert.Equal(t, "abc", CorrelationID(fmt.Errorf("outer: %w", err)), "correlation ID not found")
+	var ke Krberror
+	assert.True(t, errors.As(err, &ke), "Krberror should be found with errors.As")
+	assert.Equal(t, err, WithCorrelationID(err, "abc"), "error should not be annotated twice with the same ID")
+	assert.Equal(t, cause, WithCorrelationID(cause, ""), "error should not be annotated with an empty ID")
+	assert.Nil(t, WithCorrelationID(nil, "abc"), "nil error should not be annotated")
+	assert.Equal(t, "", CorrelationID(cause), "error without correlation ID")
+}
@@ -1,6 +1,7 @@
 package krberror
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -21,3 +22,17 @@ func TestErrorf(t *testing.T) {
 	a = Errorf(err, "cause", "arg1=%d arg2=%s", 123, "arg")
 	assert.Equal(t, "[Root cause: another error] cause: arg1=123 arg2=arg < another error: some text", a.Error())
 }
+
+func TestErrorf_Unwrap(t *testing.T) {
+	cause := errors.New("root")
+	err := fmt.Errorf("wrapped: %w", cause)
+	a := Errorf(err, "cause", "some text")
+	assert.True(t, errors.Is(a, cause), "cause should be found with errors.Is")
+	a = Errorf(a, "another cause", "more text")
+	assert.True(t, errors.Is(a, cause), "cause should be preserved when adding to the error")
+	assert.Equal(t, "[Root cause: cause] another cause: more text < cause: some text: wrapped: root", a.Error())
+
+	var ke Krberror
+	assert.True(t, errors.As(fmt.Errorf("outer: %w", a), &ke), "Krberror should be found with errors.As")
+	assert.Nil(t, NewErrorf("cause", "some text").Unwrap(), "error without a cause should not unwrap")
+}
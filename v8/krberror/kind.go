@@ -0,0 +1,137 @@
+package krberror
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+)
+
+// Kind is a stable category of error that callers can map to behaviour such as retrying, alerting or the message shown
+// to a user.
+type Kind string
+
+// Error kinds.
+const (
+	// KindUnknown is the kind of errors that could not be classified.
+	KindUnknown Kind = "unknown"
+	// KindConfig is the kind of errors caused by missing or invalid configuration, such as no KDCs for a realm or an
+	// SPN that is not known to the KDC.
+	KindConfig Kind = "config"
+	// KindNetwork is the kind of errors communicating with a KDC, which may succeed if retried.
+	KindNetwork Kind = "network"
+	// KindCredentials is the kind of errors caused by wrong, missing or expired passwords, keys and tickets.
+	KindCredentials Kind = "credentials"
+	// KindClock is the kind of errors caused by the clocks of the parties not being synchronised.
+	KindClock Kind = "clock"
+	// KindCryptoPolicy is the kind of errors caused by the encryption or checksum types permitted not being supported
+	// by the other party.
+	KindCryptoPolicy Kind = "crypto-policy"
+	// KindProtocol is the kind of errors caused by malformed, unexpected or replayed messages.
+	KindProtocol Kind = "protocol"
+	// KindAuthorization is the kind of errors caused by policy rejecting an authenticated principal.
+	KindAuthorization Kind = "authorization"
+)
+
+// rootCauseKinds are the kinds of the Krberror root causes.
+var rootCauseKinds = map[string]Kind{
+	EncodingError:   KindProtocol,
+	NetworkingError: KindNetwork,
+	DecryptingError: KindCredentials,
+	EncryptingError: KindCryptoPolicy,
+	ChksumError:     KindCredentials,
+	KRBMsgError:     KindProtocol,
+	ConfigError:     KindConfig,
+	KDCError:        KindProtocol,
+}
+
+// codeKinds are the kinds of the KRB_ERROR error codes, the codes not listed being KindProtocol.
+var codeKinds = kindsOfCodes(map[Kind][]int32{
+	KindConfig: {errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, errorcode.KDC_ERR_PRINCIPAL_NOT_UNIQUE, errorcode.KDC_ERR_NULL_KEY,
+		errorcode.KDC_ERR_WRONG_REALM, errorcode.KDC_ERR_SERVER_NOMATCH, errorcode.KDC_ERR_MUST_USE_USER2USER,
+		errorcode.KRB_AP_ERR_NOT_US, errorcode.KRB_AP_ERR_USER_TO_USER_REQUIRED, errorcode.KRB_AP_ERR_METHOD},
+	KindNetwork: {errorcode.KDC_ERR_SVC_UNAVAILABLE, errorcode.KRB_ERR_RESPONSE_TOO_BIG},
+	KindCredentials: {errorcode.KDC_ERR_NAME_EXP, errorcode.KDC_ERR_SERVICE_EXP, errorcode.KDC_ERR_C_OLD_MAST_KVNO,
+		errorcode.KDC_ERR_S_OLD_MAST_KVNO, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, errorcode.KDC_ERR_KEY_EXPIRED,
+		errorcode.KDC_ERR_PREAUTH_FAILED, errorcode.KRB_AP_ERR_BAD_INTEGRITY, errorcode.KRB_AP_ERR_MODIFIED,
+		errorcode.KRB_AP_ERR_BADKEYVER, errorcode.KRB_AP_ERR_NOKEY, errorcode.KRB_AP_ERR_MUT_FAIL,
+		errorcode.KRB_AP_ERR_NO_TGT},
+	KindClock: {errorcode.KDC_ERR_NEVER_VALID, errorcode.KDC_ERR_CLIENT_NOTYET, errorcode.KDC_ERR_SERVICE_NOTYET,
+		errorcode.KRB_AP_ERR_TKT_EXPIRED, errorcode.KRB_AP_ERR_TKT_NYV, errorcode.KRB_AP_ERR_SKEW},
+	KindCryptoPolicy: {errorcode.KDC_ERR_ETYPE_NOSUPP, errorcode.KDC_ERR_SUMTYPE_NOSUPP, errorcode.KDC_ERR_PADATA_TYPE_NOSUPP,
+		errorcode.KDC_ERR_TRTYPE_NOSUPP, errorcode.KRB_AP_ERR_INAPP_CKSUM, errorcode.KDC_ERR_KEY_TOO_WEAK},
+	KindAuthorization: {errorcode.KDC_ERR_POLICY, errorcode.KDC_ERR_BADOPTION, errorcode.KDC_ERR_CANNOT_POSTDATE,
+		errorcode.KDC_ERR_CLIENT_REVOKED, errorcode.KDC_ERR_SERVICE_REVOKED, errorcode.KDC_ERR_TGT_REVOKED,
+		errorcode.KDC_ERR_PATH_NOT_ACCEPTED, errorcode.KRB_AP_PATH_NOT_ACCEPTED, errorcode.KRB_AP_ERR_BADADDR},
+})
+
+// kindsOfCodes returns the kinds of the error codes listed for each kind.
+func kindsOfCodes(codes map[Kind][]int32) map[int32]Kind {
+	m := make(map[int32]Kind)
+	for k, cs := range codes {
+		for _, c := range cs {
+			m[c] = k
+		}
+	}
+	return m
+}
+
+// ErrorKind returns the kind of the Krberror. The kind of the underlying error is used if it can be classified,
+// otherwise the kind is derived from the root cause.
+func (e Krberror) ErrorKind() Kind {
+	if k := ErrorKind(e.cause); k != KindUnknown {
+		return k
+	}
+	if k, ok := rootCauseKinds[e.RootCause]; ok {
+		return k
+	}
+	return KindUnknown
+}
+
+// kindError annotates an error with its kind.
+type kindError struct {
+	kind Kind
+	err  error
+}
+
+// Error function to implement the error interface.
+func (e kindError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error annotated with the kind.
+func (e kindError) Unwrap() error {
+	return e.err
+}
+
+// ErrorKind returns the kind the error is annotated with.
+func (e kindError) ErrorKind() Kind {
+	return e.kind
+}
+
+// WithKind annotates the error with the kind provided without changing its message.
+func WithKind(err error, k Kind) error {
+	if err == nil {
+		return nil
+	}
+	return kindError{kind: k, err: err}
+}
+
+// ErrorKind classifies the error. The first error in the chain of wrapped errors that has an ErrorKind method
+// returning a kind other than KindUnknown determines the kind. Network errors and context deadlines are KindNetwork.
+// KindUnknown is returned if the error cannot be classified.
+func ErrorKind(err error) Kind {
+	for err != nil {
+		if k, ok := err.(interface{ ErrorKind() Kind }); ok {
+			if kind := k.ErrorKind(); kind != KindUnknown {
+				return kind
+			}
+		}
+		if _, ok := err.(net.Error); ok || err == context.DeadlineExceeded {
+			return KindNetwork
+		}
+		err = errors.Unwrap(err)
+	}
+	return KindUnknown
+}
@@ -0,0 +1,51 @@
+package krberror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type kindTestError Kind
+
+func (e kindTestError) Error() string {
+	return string(e)
+}
+
+func (e kindTestError) ErrorKind() Kind {
+	return Kind(e)
+}
+
+func TestErrorKind(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		err  error
+		kind Kind
+	}{
+		{nil, KindUnknown},
+		{errors.New("an error"), KindUnknown},
+		{New(ConfigError, "some text"), KindConfig},
+		{New(NetworkingError, "some text"), KindNetwork},
+		{New(DecryptingError, "some text"), KindCredentials},
+		{New(EncryptingError, "some text"), KindCryptoPolicy},
+		{New(EncodingError, "some text"), KindProtocol},
+		{New("Other_Error", "some text"), KindUnknown},
+		{Errorf(errors.New("an error"), KDCError, "some text"), KindProtocol},
+		{Errorf(kindTestError(KindClock), KDCError, "some text"), KindClock},
+		{Errorf(kindTestError(KindUnknown), KDCError, "some text"), KindProtocol},
+		{fmt.Errorf("outer: %w", Errorf(kindTestError(KindClock), KDCError, "some text")), KindClock},
+		{Errorf(&net.OpError{Op: "dial", Err: errors.New("refused")}, KRBMsgError, "some text"), KindNetwork},
+		{fmt.Errorf("outer: %w", context.DeadlineExceeded), KindNetwork},
+		{WithKind(errors.New("an error"), KindAuthorization), KindAuthorization},
+		{WithCorrelationID(WithKind(errors.New("an error"), KindConfig), "abc"), KindConfig},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.kind, ErrorKind(test.err), "kind not as expected for test %d: %v", i, test.err)
+	}
+	assert.Equal(t, "an error", WithKind(errors.New("an error"), KindConfig).Error(), "message should not change")
+	assert.Nil(t, WithKind(nil, KindConfig), "nil error should not be annotated")
+}
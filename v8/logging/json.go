@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// jsonLogger writes messages as JSON lines.
+type jsonLogger struct {
+	w   io.Writer
+	min Level
+	mux sync.Mutex
+}
+
+// NewJSONLogger returns a Logger writing the messages of the level and above to the writer as JSON objects, one per
+// line, with the time, level and message under the "time", "level" and "msg" keys followed by the fields. Writes are
+// serialised so the logger can be shared. Write errors are ignored.
+func NewJSONLogger(w io.Writer, min Level) Logger {
+	return &jsonLogger{w: w, min: min}
+}
+
+// Enabled reports whether messages of the level are written.
+func (j *jsonLogger) Enabled(level Level) bool {
+	return level >= j.min
+}
+
+// Log writes the message if its level is enabled.
+func (j *jsonLogger) Log(level Level, msg string, fields ...Field) {
+	if !j.Enabled(level) {
+		return
+	}
+	// The object is built by hand so that the keys are in a stable order.
+	b := []byte(`{"time":`)
+	b = appendJSON(b, time.Now().UTC().Format(time.RFC3339Nano))
+	b = append(b, `,"level":`...)
+	b = appendJSON(b, level.String())
+	b = append(b, `,"msg":`...)
+	b = appendJSON(b, msg)
+	for _, f := range fields {
+		b = append(b, ',')
+		b = appendJSON(b, f.Key)
+		b = append(b, ':')
+		v := f.Value
+		if d, ok := v.(time.Duration); ok {
+			// Durations are logged in milliseconds so that they can be aggregated.
+			v = float64(d) / float64(time.Millisecond)
+		} else {
+			v = value(v)
+		}
+		b = appendJSON(b, v)
+	}
+	b = append(b, '}', '\n')
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	j.w.Write(b)
+}
+
+// appendJSON appends the JSON encoding of the value, or of its string form if it cannot be encoded.
+func appendJSON(b []byte, v interface{}) []byte {
+	vb, err := json.Marshal(v)
+	if err != nil {
+		vb, _ = json.Marshal(value(v))
+		if vb == nil {
+			vb = []byte(`null`)
+		}
+	}
+	return append(b, vb...)
+}
@@ -0,0 +1,173 @@
+// Package logging provides a leveled logger interface carrying structured fields, such as the realm, SPN and KDC
+// address of a message and the duration of an exchange, and loggers writing them as text or JSON lines.
+//
+// Clients, services and KDCs log their actions at LevelInfo, their exchanges at LevelDebug and summaries of each
+// Kerberos message sent and received at LevelTrace, similar to the traces of MIT Kerberos' KRB5_TRACE:
+//
+//	l := logging.NewJSONLogger(os.Stderr, logging.LevelDebug)
+//	cl := client.NewWithPassword("user", "EXAMPLE.COM", "password", cfg, client.StructuredLogger(l))
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+// Log levels, from the most verbose.
+const (
+	// LevelTrace is the level of the summaries of the Kerberos messages sent and received.
+	LevelTrace Level = iota - 2
+	// LevelDebug is the level of the exchanges with KDCs and requests processed.
+	LevelDebug
+	// LevelInfo is the level of the actions taken, such as tickets obtained and renewed.
+	LevelInfo
+	// LevelWarn is the level of conditions that may need attention, such as KDCs not responding.
+	LevelWarn
+	// LevelError is the level of failures.
+	LevelError
+)
+
+// String returns the name of the level.
+func (l Level) String() string {
+	switch l {
+	case LevelTrace:
+		return "TRACE"
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Keys of the fields logged.
+const (
+	KeyRealm         = "realm"
+	KeySPN           = "spn"
+	KeyPrincipal     = "principal"
+	KeyKDC           = "kdc"
+	KeyTransport     = "transport"
+	KeyDuration      = "duration"
+	KeyError         = "error"
+	KeyErrorCode     = "error_code"
+	KeyMessageType   = "msg_type"
+	KeyCorrelationID = "correlation_id"
+	KeyMessage       = "krb_message"
+	KeyBytes         = "bytes"
+	KeyRemoteAddr    = "remote_addr"
+)
+
+// Field is a key and value logged with a message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns the field of the key and value.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger writes leveled messages with structured fields. Implementations must be safe for concurrent use.
+//
+// Enabled reports whether messages of the level are written, so that callers can avoid building costly messages, such
+// as the summaries of Kerberos messages, that would be discarded.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+	Enabled(level Level) bool
+}
+
+// textLogger writes messages as lines of text to a log.Logger.
+type textLogger struct {
+	l   *log.Logger
+	min Level
+}
+
+// NewTextLogger returns a Logger writing the messages of the level and above as lines of text to the log.Logger. A
+// line holds the level, unless it is LevelInfo, the message and the fields as key=value pairs. The correlation ID field
+// prefixes the line as it does errors and warnings.
+func NewTextLogger(l *log.Logger, min Level) Logger {
+	return textLogger{l: l, min: min}
+}
+
+// Enabled reports whether messages of the level are written.
+func (t textLogger) Enabled(level Level) bool {
+	return level >= t.min
+}
+
+// Log writes the message if its level is enabled.
+func (t textLogger) Log(level Level, msg string, fields ...Field) {
+	if !t.Enabled(level) {
+		return
+	}
+	var sb strings.Builder
+	for _, f := range fields {
+		if f.Key == KeyCorrelationID {
+			fmt.Fprintf(&sb, "[Correlation ID: %v] ", f.Value)
+		}
+	}
+	if level != LevelInfo {
+		sb.WriteString(level.String())
+		sb.WriteString(": ")
+	}
+	sb.WriteString(msg)
+	for _, f := range fields {
+		if f.Key == KeyCorrelationID {
+			continue
+		}
+		v := fmt.Sprint(value(f.Value))
+		if strings.ContainsAny(v, " \"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&sb, " %s=%s", f.Key, v)
+	}
+	t.l.Output(2, sb.String())
+}
+
+// value returns the value of the field to log, errors as their message and times in RFC 3339 format.
+func value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case time.Duration:
+		return t.String()
+	case fmt.Stringer:
+		return t.String()
+	}
+	return v
+}
+
+// With returns a Logger adding the fields to those of each message, or nil if the logger is nil.
+func With(l Logger, fields ...Field) Logger {
+	if l == nil || len(fields) == 0 {
+		return l
+	}
+	return withLogger{l: l, fields: fields}
+}
+
+// withLogger adds fields to the messages of a Logger.
+type withLogger struct {
+	l      Logger
+	fields []Field
+}
+
+// Enabled reports whether messages of the level are written.
+func (w withLogger) Enabled(level Level) bool {
+	return w.l.Enabled(level)
+}
+
+// Log writes the message with the logger's fields followed by the message's.
+func (w withLogger) Log(level Level, msg string, fields ...Field) {
+	w.l.Log(level, msg, append(append(make([]Field, 0, len(w.fields)+len(fields)), w.fields...), fields...)...)
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextLogger(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	l := NewTextLogger(log.New(&buf, "", 0), LevelDebug)
+	assert.False(t, l.Enabled(LevelTrace), "trace should not be enabled")
+	assert.True(t, l.Enabled(LevelDebug), "debug should be enabled")
+	assert.True(t, l.Enabled(LevelError), "error should be enabled")
+
+	l.Log(LevelTrace, "discarded")
+	l.Log(LevelInfo, "ticket obtained", F(KeySPN, "HTTP/host.test.gokrb5"), F(KeyCorrelationID, "attempt-1"))
+	l.Log(LevelDebug, "KDC exchange failed", F(KeyKDC, "127.0.0.1:88"), F(KeyDuration, 1500*time.Millisecond),
+		F(KeyError, errors.New("connection refused")))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(t, lines, 2, "lines not as expected") {
+		return
+	}
+	assert.Equal(t, "[Correlation ID: attempt-1] ticket obtained spn=HTTP/host.test.gokrb5", lines[0], "info line not as expected")
+	assert.Equal(t, `DEBUG: KDC exchange failed kdc=127.0.0.1:88 duration=1.5s error="connection refused"`, lines[1], "debug line not as expected")
+}
+
+func TestJSONLogger(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	l := NewJSONLogger(&buf, LevelInfo)
+	assert.False(t, l.Enabled(LevelDebug), "debug should not be enabled")
+	l.Log(LevelDebug, "discarded")
+	l.Log(LevelWarn, "KDC not responding", F(KeyRealm, "TEST.GOKRB5"), F(KeyDuration, 250*time.Millisecond),
+		F(KeyError, errors.New("timeout")), F(KeyBytes, 42))
+
+	line := strings.TrimSpace(buf.String())
+	assert.NotContains(t, line, "\n", "only one line should be written")
+	assert.True(t, strings.HasPrefix(line, `{"time":"`), "time should be first: %s", line)
+	assert.Contains(t, line, `"level":"WARN","msg":"KDC not responding","realm":"TEST.GOKRB5","duration":250,"error":"timeout","bytes":42}`, "fields not in order")
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		t.Fatalf("line is not valid JSON: %v", err)
+	}
+	_, err := time.Parse(time.RFC3339Nano, m["time"].(string))
+	assert.NoError(t, err, "time not valid")
+}
+
+func TestWith(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	l := With(NewTextLogger(log.New(&buf, "", 0), LevelInfo), F(KeyRealm, "TEST.GOKRB5"))
+	l.Log(LevelInfo, "ticket renewed", F(KeyPrincipal, "testuser1"))
+	assert.Equal(t, "ticket renewed realm=TEST.GOKRB5 principal=testuser1\n", buf.String(), "fields not added")
+	assert.False(t, l.Enabled(LevelDebug), "enabled should be that of the wrapped logger")
+	assert.Nil(t, With(nil, F(KeyRealm, "TEST.GOKRB5")), "nil logger should stay nil")
+	assert.Equal(t, "LEVEL(5)", Level(5).String(), "unknown level name not as expected")
+}
@@ -5,7 +5,11 @@ import (
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -47,3 +51,63 @@ func (a *EncAPRepPart) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// Marshal the APRep struct.
+func (a *APRep) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "marshaling error of AP_REP")
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.APREP), nil
+}
+
+// Marshal the APRep encrypted part struct.
+func (a *EncAPRepPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "marshaling error of AP_REP encrypted part")
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.EncAPRepPart), nil
+}
+
+// NewAPRep creates a new KRB_AP_REP replying to the authenticator of a verified AP_REQ, with an encrypted part
+// echoing the authenticator's time and asserting the subkey and sequence number, which may be zero values, encrypted
+// with the ticket's session key.
+func NewAPRep(auth types.Authenticator, sessionKey, subkey types.EncryptionKey, seq int64) (APRep, error) {
+	a := APRep{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_AP_REP,
+	}
+	ep := EncAPRepPart{
+		CTime:          auth.CTime,
+		Cusec:          auth.Cusec,
+		Subkey:         subkey,
+		SequenceNumber: seq,
+	}
+	b, err := ep.Marshal()
+	if err != nil {
+		return a, err
+	}
+	a.EncPart, err = crypto.GetEncryptedData(b, sessionKey, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error encrypting AP_REP encrypted part")
+	}
+	return a, nil
+}
+
+// DecryptEncPart decrypts and returns the encrypted part of the AP_REP using the session key of the ticket sent in the
+// AP_REQ it replies to, verifying that it echoes the time of the authenticator sent.
+func (a *APRep) DecryptEncPart(sessionKey types.EncryptionKey, auth types.Authenticator) (EncAPRepPart, error) {
+	var ep EncAPRepPart
+	b, err := crypto.DecryptEncPart(a.EncPart, sessionKey, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return ep, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AP_REP encrypted part")
+	}
+	if err := ep.Unmarshal(b); err != nil {
+		return ep, err
+	}
+	if !ep.CTime.Equal(auth.CTime) || ep.Cusec != auth.Cusec {
+		return ep, krberror.NewErrorf(krberror.KRBMsgError, "AP_REP does not match the authenticator sent")
+	}
+	return ep, nil
+}
@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -67,3 +69,34 @@ func TestUnmarshalEncAPRepPart_optionalsNULL(t *testing.T) {
 	assert.Equal(t, tt, a.CTime, "CTime not as expected")
 	assert.Equal(t, 123456, a.Cusec, "Client microseconds not as expected")
 }
+
+func TestNewAPRep(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("0123456789abcdef0123456789abcdef")}
+	subkey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("fedcba9876543210fedcba9876543210")}
+	auth := types.Authenticator{CTime: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), Cusec: 123}
+	a, err := NewAPRep(auth, key, subkey, 42)
+	if err != nil {
+		t.Fatalf("error creating AP_REP: %v", err)
+	}
+	b, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling AP_REP: %v", err)
+	}
+	var u APRep
+	if err := u.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling AP_REP: %v", err)
+	}
+	ep, err := u.DecryptEncPart(key, auth)
+	if err != nil {
+		t.Fatalf("error decrypting AP_REP: %v", err)
+	}
+	assert.Equal(t, subkey, ep.Subkey, "subkey not as expected")
+	assert.Equal(t, int64(42), ep.SequenceNumber, "sequence number not as expected")
+
+	auth.Cusec++
+	_, err = u.DecryptEncPart(key, auth)
+	assert.Error(t, err, "AP_REP for another authenticator should be rejected")
+	_, err = u.DecryptEncPart(subkey, auth)
+	assert.Error(t, err, "AP_REP should not decrypt with another key")
+}
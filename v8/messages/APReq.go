@@ -5,13 +5,14 @@ import (
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
-	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/internal/der"
 	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -74,11 +75,11 @@ func (a *APReq) DecryptAuthenticator(sessionKey types.EncryptionKey) error {
 	usage := authenticatorKeyUsage(a.Ticket.SName)
 	ab, e := crypto.DecryptEncPart(a.EncryptedAuthenticator, sessionKey, uint32(usage))
 	if e != nil {
-		return fmt.Errorf("error decrypting authenticator: %v", e)
+		return fmt.Errorf("error decrypting authenticator: %w", e)
 	}
 	err := a.Authenticator.Unmarshal(ab)
 	if err != nil {
-		return fmt.Errorf("error unmarshaling authenticator: %v", err)
+		return fmt.Errorf("error unmarshaling authenticator: %w", err)
 	}
 	return nil
 }
@@ -93,9 +94,11 @@ func authenticatorKeyUsage(pn types.PrincipalName) int {
 // Unmarshal bytes b into the APReq struct.
 func (a *APReq) Unmarshal(b []byte) error {
 	var m marshalAPReq
-	_, err := asn1.UnmarshalWithParams(b, &m, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.APREQ))
-	if err != nil {
-		return krberror.Errorf(err, krberror.EncodingError, "unmarshal error of AP_REQ")
+	if !readAPReq(b, &m) {
+		_, err := asn1.UnmarshalWithParams(b, &m, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.APREQ))
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "unmarshal error of AP_REQ")
+		}
 	}
 	if m.MsgType != msgtype.KRB_AP_REQ {
 		return NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_MSG_TYPE, errorcode.Lookup(errorcode.KRB_AP_ERR_MSG_TYPE))
@@ -104,6 +107,7 @@ func (a *APReq) Unmarshal(b []byte) error {
 	a.MsgType = m.MsgType
 	a.APOptions = m.APOptions
 	a.EncryptedAuthenticator = m.EncryptedAuthenticator
+	var err error
 	a.Ticket, err = unmarshalTicket(m.Ticket.Bytes)
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "unmarshaling error of Ticket within AP_REQ")
@@ -113,34 +117,103 @@ func (a *APReq) Unmarshal(b []byte) error {
 
 // Marshal APReq struct.
 func (a *APReq) Marshal() ([]byte, error) {
-	m := marshalAPReq{
-		PVNO:                   a.PVNO,
-		MsgType:                a.MsgType,
-		APOptions:              a.APOptions,
-		EncryptedAuthenticator: a.EncryptedAuthenticator,
-	}
-	var b []byte
-	b, err := a.Ticket.Marshal()
-	if err != nil {
-		return b, err
+	db := der.NewBuilder()
+	defer db.Release()
+	m := db.Len()
+	e := db.Len()
+	db.AddEncryptedData(a.EncryptedAuthenticator.EType, a.EncryptedAuthenticator.KVNO, a.EncryptedAuthenticator.Cipher)
+	db.Explicit(4, e)
+	e = db.Len()
+	addTicket(db, &a.Ticket)
+	db.Explicit(3, e)
+	e = db.Len()
+	db.AddBitString(a.APOptions)
+	db.Explicit(2, e)
+	e = db.Len()
+	db.AddInteger(int64(a.MsgType))
+	db.Explicit(1, e)
+	e = db.Len()
+	db.AddInteger(int64(a.PVNO))
+	db.Explicit(0, e)
+	db.Sequence(m)
+	db.Wrap(asn1.ClassApplication, asnAppTag.APREQ, true, m)
+	return db.Bytes(), nil
+}
+
+// readAPReq reads the DER of an AP_REQ into m. If the DER is not in the form expected false is returned so that the
+// asn1 package can be used to unmarshal it instead.
+func readAPReq(b []byte, m *marshalAPReq) bool {
+	p := der.Parser(b)
+	a, ok := p.Read(asn1.ClassApplication, asnAppTag.APREQ, true)
+	if !ok {
+		return false
+	}
+	s, ok := a.Sequence()
+	if !ok || !a.Empty() {
+		return false
+	}
+	pvno, ok := s.ExplicitInt(0)
+	if !ok {
+		return false
+	}
+	msgType, ok := s.ExplicitInt(1)
+	if !ok {
+		return false
+	}
+	opts, ok := s.ExplicitBitString(2)
+	if !ok {
+		return false
+	}
+	full, tkt, ok := s.ReadFull(asn1.ClassContextSpecific, 3, true)
+	if !ok {
+		return false
 	}
+	c, ok := s.Explicit(4)
+	if !ok {
+		return false
+	}
+	et, kvno, _, cipher, ok := c.ReadEncryptedData()
+	if !ok || !c.Empty() || !s.Empty() {
+		return false
+	}
+	m.PVNO = pvno
+	m.MsgType = msgType
+	m.APOptions = opts
 	m.Ticket = asn1.RawValue{
 		Class:      asn1.ClassContextSpecific,
 		IsCompound: true,
 		Tag:        3,
-		Bytes:      b,
+		Bytes:      tkt,
+		FullBytes:  full,
 	}
-	mk, err := asn1.Marshal(m)
-	if err != nil {
-		return mk, krberror.Errorf(err, krberror.EncodingError, "marshaling error of AP_REQ")
+	m.EncryptedAuthenticator = types.EncryptedData{
+		EType:  et,
+		KVNO:   kvno,
+		Cipher: cipher,
 	}
-	mk = asn1tools.AddASNAppTag(mk, asnAppTag.APREQ)
-	return mk, nil
+	return true
 }
 
 // Verify an AP_REQ using service's keytab, spn and max acceptable clock skew duration.
 // The service ticket encrypted part and authenticator will be decrypted as part of this operation.
-func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddress, snameOverride *types.PrincipalName) (bool, error) {
+func (a *APReq) Verify(kt keytab.KeyProvider, d time.Duration, cAddr types.HostAddress, snameOverride *types.PrincipalName) (bool, error) {
+	return a.VerifyWithClock(kt, d, cAddr, snameOverride, clock.Real)
+}
+
+// VerifyWithClock verifies an AP_REQ as Verify does using the clock provided to check the validity of the ticket and
+// the clock skew with the client.
+func (a *APReq) VerifyWithClock(kt keytab.KeyProvider, d time.Duration, cAddr types.HostAddress, snameOverride *types.PrincipalName, c clock.Clock) (bool, error) {
+	return a.verify(kt, d, &cAddr, snameOverride, c)
+}
+
+// VerifyAnyAddress verifies an AP_REQ as VerifyWithClock does without checking the client's address against those
+// the ticket was issued for, for services that cannot know the client's address, such as those behind a proxy or NAT.
+func (a *APReq) VerifyAnyAddress(kt keytab.KeyProvider, d time.Duration, snameOverride *types.PrincipalName, c clock.Clock) (bool, error) {
+	return a.verify(kt, d, nil, snameOverride, c)
+}
+
+// verify verifies the AP_REQ, checking the client's address against the ticket's if it is not nil.
+func (a *APReq) verify(kt keytab.KeyProvider, d time.Duration, cAddr *types.HostAddress, snameOverride *types.PrincipalName, c clock.Clock) (bool, error) {
 	// Decrypt ticket's encrypted part with service key
 	//TODO decrypt with service's session key from its TGT is use-to-user. Need to figure out how to get TGT.
 	//if types.IsFlagSet(&a.APOptions, flags.APOptionUseSessionKey) {
@@ -164,16 +237,16 @@ func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddre
 	}
 
 	// Check time validity of ticket
-	ok, err := a.Ticket.Valid(d)
+	ok, err := a.Ticket.ValidWithClock(d, c)
 	if err != nil || !ok {
 		return ok, err
 	}
 
 	// Check client's address is listed in the client addresses in the ticket
-	if len(a.Ticket.DecryptedEncPart.CAddr) > 0 {
+	if cAddr != nil && len(a.Ticket.DecryptedEncPart.CAddr) > 0 {
 		//If client addresses are present check if any of them match the source IP that sent the APReq
 		//If there is no match return KRB_AP_ERR_BADADDR error.
-		if !types.HostAddressesContains(a.Ticket.DecryptedEncPart.CAddr, cAddr) {
+		if !types.HostAddressesContains(a.Ticket.DecryptedEncPart.CAddr, *cAddr) {
 			return false, NewKRBError(a.Ticket.SName, a.Ticket.Realm, errorcode.KRB_AP_ERR_BADADDR, "client address not within the list contained in the service ticket")
 		}
 	}
@@ -191,7 +264,7 @@ func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddre
 
 	// Check the clock skew between the client and the service server
 	ct := a.Authenticator.CTime.Add(time.Duration(a.Authenticator.Cusec) * time.Microsecond)
-	t := time.Now().UTC()
+	t := c.Now().UTC()
 	if t.Sub(ct) > d || ct.Sub(t) > d {
 		return false, NewKRBError(a.Ticket.SName, a.Ticket.Realm, errorcode.KRB_AP_ERR_SKEW, fmt.Sprintf("clock skew with client too large. greater than %v seconds", d))
 	}
@@ -2,9 +2,13 @@ package messages
 
 import (
 	"encoding/hex"
+	"fmt"
 	"testing"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
 	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
@@ -52,3 +56,74 @@ func TestMarshalAPReq(t *testing.T) {
 	}
 	assert.Equal(t, b, mb, "Marshal bytes of Authenticator not as expected")
 }
+
+func TestAPReq_MarshalAsASN1(t *testing.T) {
+	t.Parallel()
+	var a APReq
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5ap_req)
+	err := a.Unmarshal(v)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	a.EncryptedAuthenticator.Cipher = make([]byte, 500)
+	tb, err := a.Ticket.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling ticket: %v", err)
+	}
+	b, err := asn1.Marshal(marshalAPReq{
+		PVNO:                   a.PVNO,
+		MsgType:                a.MsgType,
+		APOptions:              a.APOptions,
+		Ticket:                 asn1.RawValue{Class: asn1.ClassContextSpecific, IsCompound: true, Tag: 3, Bytes: tb},
+		EncryptedAuthenticator: a.EncryptedAuthenticator,
+	})
+	if err != nil {
+		t.Fatalf("error marshaling with asn1: %v", err)
+	}
+	want := asn1tools.AddASNAppTag(b, asnAppTag.APREQ)
+	b, err = a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	assert.Equal(t, want, b, "encoding not as the asn1 package's")
+
+	for _, b := range [][]byte{v, b} {
+		var m, ma marshalAPReq
+		assert.True(t, readAPReq(b, &m), "AP_REQ not read")
+		_, err = asn1.UnmarshalWithParams(b, &ma, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.APREQ))
+		if err != nil {
+			t.Fatalf("error unmarshaling with asn1: %v", err)
+		}
+		assert.Equal(t, ma, m, "AP_REQ read not as the asn1 package's")
+	}
+}
+
+func BenchmarkAPReq_Marshal(b *testing.B) {
+	var a APReq
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5ap_req)
+	err := a.Unmarshal(v)
+	if err != nil {
+		b.Fatalf("Unmarshal error: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := a.Marshal()
+		if err != nil {
+			b.Fatalf("Marshal error: %v", err)
+		}
+	}
+}
+
+func BenchmarkAPReq_Unmarshal(b *testing.B) {
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5ap_req)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var a APReq
+		err := a.Unmarshal(v)
+		if err != nil {
+			b.Fatalf("Unmarshal error: %v", err)
+		}
+	}
+}
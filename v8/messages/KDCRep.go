@@ -4,12 +4,14 @@ package messages
 // Section: 5.4.2
 
 import (
+	"crypto/hmac"
 	"encoding/hex"
 	"fmt"
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/credentials"
 	"github.com/jcmturner/gokrb5/v8/crypto"
@@ -18,6 +20,7 @@ import (
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
@@ -213,10 +216,13 @@ func (e *EncKDCRepPart) Marshal() ([]byte, error) {
 	return b, nil
 }
 
-// DecryptEncPart decrypts the encrypted part of an AS_REP.
-func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey, error) {
+// ClientKey returns the client's key from the credentials for the encryption type of the AS_REP's encrypted part.
+func (k *ASRep) ClientKey(c *credentials.Credentials) (types.EncryptionKey, error) {
 	var key types.EncryptionKey
 	var err error
+	if c.HasKeyHandles() {
+		return key, krberror.Errorf(keytab.ErrKeyNotExtractable, krberror.DecryptingError, "error getting the client's key for the AS_REP encrypted part")
+	}
 	if c.HasKeytab() {
 		key, _, err = c.Keytab().GetEncryptionKey(k.CName, k.CRealm, k.EncPart.KVNO, k.EncPart.EType)
 		if err != nil {
@@ -242,6 +248,28 @@ func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey,
 	if !c.HasKeytab() && !c.HasPassword() && !c.HasNTHash() {
 		return key, krberror.NewErrorf(krberror.DecryptingError, "no secret available in credentials to perform decryption of AS_REP encrypted part")
 	}
+	return key, nil
+}
+
+// ClientKeyHandle returns the handle to the client's key from the credentials for the encryption type of the AS_REP's
+// encrypted part.
+func (k *ASRep) ClientKeyHandle(c *credentials.Credentials) (keytab.KeyHandle, error) {
+	if !c.HasKeyHandles() {
+		return nil, krberror.NewErrorf(krberror.DecryptingError, "no key handles available in credentials to perform decryption of AS_REP encrypted part")
+	}
+	h, err := c.KeyHandles().GetKeyHandle(k.CName, k.CRealm, k.EncPart.KVNO, k.EncPart.EType)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.DecryptingError, "error getting the client's key handle for the AS_REP encrypted part")
+	}
+	return h, nil
+}
+
+// DecryptEncPart decrypts the encrypted part of an AS_REP.
+func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey, error) {
+	key, err := k.ClientKey(c)
+	if err != nil {
+		return key, err
+	}
 	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.AS_REP_ENCPART)
 	if err != nil {
 		return key, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
@@ -257,6 +285,11 @@ func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey,
 
 // Verify checks the validity of AS_REP message.
 func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq ASReq) (bool, error) {
+	return k.VerifyWithClock(cfg, creds, asReq, clock.Real)
+}
+
+// VerifyWithClock checks the validity of AS_REP message using the clock provided to check the clock skew with the KDC.
+func (k *ASRep) VerifyWithClock(cfg *config.Config, creds *credentials.Credentials, asReq ASReq, c clock.Clock) (bool, error) {
 	//Ref RFC 4120 Section 3.1.5
 	if !k.CName.Equal(asReq.ReqBody.CName) {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
@@ -264,10 +297,70 @@ func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq
 	if k.CRealm != asReq.ReqBody.Realm {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
 	}
+	if creds.HasKeyHandles() {
+		h, err := k.ClientKeyHandle(creds)
+		if err != nil {
+			return false, err
+		}
+		return k.VerifyWithKeyHandle(cfg, h, asReq, c)
+	}
 	key, err := k.DecryptEncPart(creds)
+	if !creds.HasKeytab() {
+		// The key was derived from the client's password or password hash and is no longer needed.
+		defer key.Zero()
+	}
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
+	}
+	return k.verifyDecrypted(cfg, keytab.NewKeyHandle(key, 0), asReq, c)
+}
+
+// VerifyWithKeyHandle checks the validity of AS_REP message using the handle to the client's key provided to decrypt
+// the encrypted part, for clients whose keys are held outside of the process.
+func (k *ASRep) VerifyWithKeyHandle(cfg *config.Config, h keytab.KeyHandle, asReq ASReq, c clock.Clock) (bool, error) {
+	if !k.CName.Equal(asReq.ReqBody.CName) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
+	}
+	if k.CRealm != asReq.ReqBody.Realm {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+	}
+	b, err := h.Decrypt(k.EncPart.Cipher, keyusage.AS_REP_ENCPART)
 	if err != nil {
 		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
 	}
+	var denc EncKDCRepPart
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
+	}
+	k.DecryptedEncPart = denc
+	return k.verifyDecrypted(cfg, h, asReq, c)
+}
+
+// VerifyWithReplyKey checks the validity of AS_REP message using the reply key provided, such as one agreed by PKINIT
+// pre-authentication, to decrypt the encrypted part rather than a key derived from the client's credentials.
+func (k *ASRep) VerifyWithReplyKey(cfg *config.Config, key types.EncryptionKey, asReq ASReq, c clock.Clock) (bool, error) {
+	if !k.CName.Equal(asReq.ReqBody.CName) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
+	}
+	if k.CRealm != asReq.ReqBody.Realm {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+	}
+	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.AS_REP_ENCPART)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
+	}
+	var denc EncKDCRepPart
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
+	}
+	k.DecryptedEncPart = denc
+	return k.verifyDecrypted(cfg, keytab.NewKeyHandle(key, 0), asReq, c)
+}
+
+// verifyDecrypted checks the validity of the AS_REP once its encrypted part has been decrypted with the key.
+func (k *ASRep) verifyDecrypted(cfg *config.Config, h keytab.KeyHandle, asReq ASReq, c clock.Clock) (bool, error) {
 	if k.DecryptedEncPart.Nonce != asReq.ReqBody.Nonce {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in response does not match that in request")
 	}
@@ -282,7 +375,7 @@ func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq
 			return false, krberror.NewErrorf(krberror.KRBMsgError, "addresses listed in the AS_REP does not match those listed in the AS_REQ")
 		}
 	}
-	t := time.Now().UTC()
+	t := c.Now().UTC()
 	if t.Sub(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.AuthTime.Sub(t) > cfg.LibDefaults.Clockskew {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "clock skew with KDC too large. Greater than %v seconds", cfg.LibDefaults.Clockskew.Seconds())
 	}
@@ -298,12 +391,12 @@ func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq
 				if err != nil {
 					return false, krberror.Errorf(err, krberror.EncodingError, "KDC FAST negotiation response error, could not unmarshal PA_REQ_ENC_PA_REP")
 				}
-				etype, err := crypto.GetChksumEtype(pafast.ChksumType)
+				ab, _ := asReq.Marshal()
+				cksum, err := h.Checksum(pafast.ChksumType, ab, keyusage.KEY_USAGE_AS_REQ)
 				if err != nil {
 					return false, krberror.Errorf(err, krberror.ChksumError, "KDC FAST negotiation response error")
 				}
-				ab, _ := asReq.Marshal()
-				if !etype.VerifyChecksum(key.KeyValue, ab, pafast.Chksum, keyusage.KEY_USAGE_AS_REQ) {
+				if !hmac.Equal(cksum, pafast.Chksum) {
 					return false, krberror.Errorf(err, krberror.ChksumError, "KDC FAST negotiation response checksum invalid")
 				}
 			}
@@ -327,8 +420,30 @@ func (k *TGSRep) DecryptEncPart(key types.EncryptionKey) error {
 	return nil
 }
 
+// DecryptEncPartWithSubKey decrypts the encrypted part of a TGS_REP to a TGS_REQ that included a subkey in its
+// authenticator.
+func (k *TGSRep) DecryptEncPartWithSubKey(key types.EncryptionKey) error {
+	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting TGS_REP EncPart")
+	}
+	var denc EncKDCRepPart
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling encrypted part")
+	}
+	k.DecryptedEncPart = denc
+	return nil
+}
+
 // Verify checks the validity of the TGS_REP message.
 func (k *TGSRep) Verify(cfg *config.Config, tgsReq TGSReq) (bool, error) {
+	return k.VerifyWithClock(cfg, tgsReq, clock.Real)
+}
+
+// VerifyWithClock checks the validity of the TGS_REP message using the clock provided to check the clock skew with
+// the KDC.
+func (k *TGSRep) VerifyWithClock(cfg *config.Config, tgsReq TGSReq, c clock.Clock) (bool, error) {
 	if !k.CName.Equal(tgsReq.ReqBody.CName) {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", tgsReq.ReqBody.CName, k.CName)
 	}
@@ -362,8 +477,13 @@ func (k *TGSRep) Verify(cfg *config.Config, tgsReq TGSReq) (bool, error) {
 			return false, krberror.NewErrorf(krberror.KRBMsgError, "addresses listed in the TGS_REP does not match those listed in the TGS_REQ")
 		}
 	}
-	if time.Since(k.DecryptedEncPart.StartTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.StartTime.Sub(time.Now().UTC()) > cfg.LibDefaults.Clockskew {
-		if time.Since(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.AuthTime.Sub(time.Now().UTC()) > cfg.LibDefaults.Clockskew {
+	// The start time of a postdated ticket, or of a validated one, is not the time it is issued.
+	if o := tgsReq.ReqBody.KDCOptions; len(o.Bytes) > 0 && (types.IsFlagSet(&o, flags.PostDated) || types.IsFlagSet(&o, flags.Validate)) {
+		return true, nil
+	}
+	t := c.Now().UTC()
+	if t.Sub(k.DecryptedEncPart.StartTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.StartTime.Sub(t) > cfg.LibDefaults.Clockskew {
+		if t.Sub(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.AuthTime.Sub(t) > cfg.LibDefaults.Clockskew {
 			return false, krberror.NewErrorf(krberror.KRBMsgError, "clock skew with KDC too large. Greater than %v seconds.", cfg.LibDefaults.Clockskew.Seconds())
 		}
 	}
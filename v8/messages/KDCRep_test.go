@@ -349,3 +349,27 @@ func TestUnmarshalASRepDecodeAndDecrypt_withPassword(t *testing.T) {
 	assert.Equal(t, nametype.KRB_NT_SRV_INST, asRep.DecryptedEncPart.SName.NameType, "Name type for AS_REP not as expected")
 	assert.Equal(t, []string{"krbtgt", testRealm}, asRep.DecryptedEncPart.SName.NameString, "Service name string not as expected")
 }
+
+func BenchmarkASRep_DecryptEncPart(b *testing.B) {
+	v, _ := hex.DecodeString(testuser1EType18ASREP)
+	ktb, _ := hex.DecodeString(testuser1EType18Keytab)
+	kt := keytab.New()
+	err := kt.Unmarshal(ktb)
+	if err != nil {
+		b.Fatalf("keytab parse error: %v\n", err)
+	}
+	cred := credentials.New(testUser, testRealm).WithKeytab(kt)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var asRep ASRep
+		err := asRep.Unmarshal(v)
+		if err != nil {
+			b.Fatalf("AS REP Unmarshal error: %v\n", err)
+		}
+		_, err = asRep.DecryptEncPart(cred)
+		if err != nil {
+			b.Fatalf("Decryption of AS_REP EncPart failed: %v", err)
+		}
+	}
+}
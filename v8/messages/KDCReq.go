@@ -4,23 +4,26 @@ package messages
 // Section: 5.4.1
 
 import (
-	"crypto/rand"
 	"fmt"
 	"math"
 	"math/big"
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
-	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4757"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
 	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/internal/der"
+	"github.com/jcmturner/gokrb5/v8/internal/random"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
@@ -39,6 +42,7 @@ type KDCReqFields struct {
 	PAData  types.PADataSequence
 	ReqBody KDCReqBody
 	Renewal bool
+	clock   clock.Clock
 }
 
 // ASReq implements RFC 4120 KRB_AS_REQ: https://tools.ietf.org/html/rfc4120#section-5.4.1.
@@ -103,7 +107,7 @@ func NewASReqForChgPasswd(realm string, c *config.Config, cname types.PrincipalN
 
 // NewASReq generates a new KRB_AS_REQ struct for a given SNAME.
 func NewASReq(realm string, c *config.Config, cname, sname types.PrincipalName) (ASReq, error) {
-	nonce, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt32))
+	nonce, err := random.Int(big.NewInt(math.MaxInt32))
 	if err != nil {
 		return ASReq{}, err
 	}
@@ -122,7 +126,6 @@ func NewASReq(realm string, c *config.Config, cname, sname types.PrincipalName)
 				Realm:      realm,
 				CName:      cname,
 				SName:      sname,
-				Till:       t.Add(c.LibDefaults.TicketLifetime),
 				Nonce:      int(nonce.Int64()),
 				EType:      c.LibDefaults.DefaultTktEnctypeIDs,
 			},
@@ -137,15 +140,14 @@ func NewASReq(realm string, c *config.Config, cname, sname types.PrincipalName)
 	if c.LibDefaults.Proxiable {
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Proxiable)
 	}
-	if c.LibDefaults.RenewLifetime != 0 {
+	if c.LibDefaults.RenewLifetime > time.Duration(0) {
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Renewable)
-		a.ReqBody.RTime = t.Add(c.LibDefaults.RenewLifetime)
-		a.ReqBody.RTime = t.Add(time.Duration(48) * time.Hour)
 	}
+	a.ReqBody.SetTimes(t, c)
 	if !c.LibDefaults.NoAddresses {
 		ha, err := types.LocalHostAddresses()
 		if err != nil {
-			return a, fmt.Errorf("could not get local addresses: %v", err)
+			return a, fmt.Errorf("could not get local addresses: %w", err)
 		}
 		ha = append(ha, types.HostAddressesFromNetIPs(c.LibDefaults.ExtraAddresses)...)
 		a.ReqBody.Addresses = ha
@@ -159,7 +161,7 @@ func NewTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt
 	if err != nil {
 		return a, err
 	}
-	err = a.setPAData(tgt, sessionKey)
+	err = a.setPAData(tgt, sessionKey, types.EncryptionKey{})
 	return a, err
 }
 
@@ -171,13 +173,82 @@ func NewUser2UserTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Co
 	}
 	a.ReqBody.AdditionalTickets = []Ticket{verifyingTGT}
 	types.SetFlag(&a.ReqBody.KDCOptions, flags.EncTktInSkey)
-	err = a.setPAData(clientTGT, sessionKey)
+	err = a.setPAData(clientTGT, sessionKey, types.EncryptionKey{})
+	return a, err
+}
+
+// NewForwardTGSReq returns a TGS_REQ for a forwarded TGT for the realm of the TGT, RFC 4120 section 2.6, to be handed
+// to a service in a KRB_CRED. The TGT must be forwardable. The forwarded TGT is issued for the addresses, which should
+// be those of the service it is forwarded to, or with no addresses, so that it can be used from any host, if there are
+// none.
+func NewForwardTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey, addresses types.HostAddresses) (TGSReq, error) {
+	a, err := tgsReq(cname, tgt.SName, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.Forwarded)
+	a.ReqBody.Addresses = addresses
+	err = a.setPAData(tgt, sessionKey, types.EncryptionKey{})
+	return a, err
+}
+
+// NewS4U2SelfTGSReq returns a TGS_REQ for a ticket to the service sname, the client itself, on behalf of the user
+// using the MS-SFU S4U2Self extension: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-sfu/
+func NewS4U2SelfTGSReq(user types.PrincipalName, userRealm, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey, sname types.PrincipalName) (TGSReq, error) {
+	// The ticket is issued to the user so the user's name is used to validate the reply.
+	a, err := tgsReq(user, sname, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	pa := types.PAForUser{
+		UserName:    user,
+		UserRealm:   userRealm,
+		AuthPackage: "Kerberos",
+	}
+	// The checksum is always the HMAC-MD5 keyed with the TGT session key whatever its encryption type.
+	cb, err := rfc4757.Checksum(sessionKey.KeyValue, keyusage.KERB_NON_KERB_CKSUM_SALT, pa.ChecksumData())
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.ChksumError, "error calculating PA-FOR-USER checksum")
+	}
+	pa.Cksum = types.Checksum{
+		CksumType: chksumtype.KERB_CHECKSUM_HMAC_MD5,
+		Checksum:  cb,
+	}
+	b, err := pa.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-FOR-USER")
+	}
+	a.PAData = types.PADataSequence{{PADataType: patype.PA_FOR_USER, PADataValue: b}}
+	err = a.setPAData(tgt, sessionKey, types.EncryptionKey{})
+	return a, err
+}
+
+// NewS4U2ProxyTGSReq returns a TGS_REQ for a ticket to the service sname on behalf of the user using the MS-SFU
+// S4U2Proxy extension. The evidence ticket is the user's ticket to the client, such as one obtained with S4U2Self.
+// The PA-PAC-OPTIONS requests resource-based constrained delegation so that the KDC falls back to the target's
+// msDS-AllowedToActOnBehalfOfOtherIdentity if the client is not permitted classic constrained delegation.
+func NewS4U2ProxyTGSReq(user types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey, sname types.PrincipalName, evidence Ticket) (TGSReq, error) {
+	// The ticket is issued to the user so the user's name is used to validate the reply.
+	a, err := tgsReq(user, sname, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	a.ReqBody.AdditionalTickets = []Ticket{evidence}
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.CNameInAddlTkt)
+	pa := types.PAPACOptions{KerberosFlags: types.NewKrbFlags()}
+	types.SetFlag(&pa.KerberosFlags, types.PACOptionResourceBasedConstrainedDelegation)
+	b, err := pa.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PAC-OPTIONS")
+	}
+	a.PAData = types.PADataSequence{{PADataType: patype.PA_PAC_OPTIONS, PADataValue: b}}
+	err = a.setPAData(tgt, sessionKey, types.EncryptionKey{})
 	return a, err
 }
 
 // tgsReq populates the fields for a TGS_REQ
 func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *config.Config) (TGSReq, error) {
-	nonce, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt32))
+	nonce, err := random.Int(big.NewInt(math.MaxInt32))
 	if err != nil {
 		return TGSReq{}, err
 	}
@@ -190,7 +261,6 @@ func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *
 			Realm:      kdcRealm,
 			CName:      cname, // Add the CName to make validation of the reply easier
 			SName:      sname,
-			Till:       t.Add(c.LibDefaults.TicketLifetime),
 			Nonce:      int(nonce.Int64()),
 			EType:      c.LibDefaults.DefaultTGSEnctypeIDs,
 		},
@@ -207,12 +277,12 @@ func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *
 	}
 	if c.LibDefaults.RenewLifetime > time.Duration(0) {
 		types.SetFlag(&k.ReqBody.KDCOptions, flags.Renewable)
-		k.ReqBody.RTime = t.Add(c.LibDefaults.RenewLifetime)
 	}
+	k.ReqBody.SetTimes(t, c)
 	if !c.LibDefaults.NoAddresses {
 		ha, err := types.LocalHostAddresses()
 		if err != nil {
-			return TGSReq{}, fmt.Errorf("could not get local addresses: %v", err)
+			return TGSReq{}, fmt.Errorf("could not get local addresses: %w", err)
 		}
 		ha = append(ha, types.HostAddressesFromNetIPs(c.LibDefaults.ExtraAddresses)...)
 		k.ReqBody.Addresses = ha
@@ -226,7 +296,37 @@ func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *
 	}, nil
 }
 
-func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
+// UpdateBody applies the function to the body of the TGS_REQ, for example to change its KDC options or requested
+// times, and regenerates its PA-TGS-REQ as the authenticator holds a checksum of the body.
+func (k *TGSReq) UpdateBody(f func(*KDCReqBody), tgt Ticket, sessionKey types.EncryptionKey) error {
+	f(&k.ReqBody)
+	return k.setPAData(tgt, sessionKey, types.EncryptionKey{})
+}
+
+// SetSubKey regenerates the PA-TGS-REQ of the TGS_REQ with a new subkey in its authenticator, as is required to armor
+// the request with FAST. The KDC encrypts the TGS_REP with the subkey returned.
+func (k *TGSReq) SetSubKey(tgt Ticket, sessionKey types.EncryptionKey) (types.EncryptionKey, error) {
+	etype, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting etype of subkey")
+	}
+	subKey, err := types.GenerateEncryptionKey(etype)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error generating subkey")
+	}
+	return subKey, k.setPAData(tgt, sessionKey, subKey)
+}
+
+// SetClock regenerates the PA-TGS-REQ of the TGS_REQ with the time of its authenticator, and of those of the
+// PA-TGS-REQs it is later regenerated with, taken from the clock provided rather than the system clock. This allows the
+// time to be corrected for the skew of the local clock from that of the KDC.
+func (k *TGSReq) SetClock(c clock.Clock, tgt Ticket, sessionKey types.EncryptionKey) error {
+	k.clock = c
+	return k.setPAData(tgt, sessionKey, types.EncryptionKey{})
+}
+
+// setPAData sets the PA-TGS-REQ with the TGT. The subkey is included in the authenticator if it has a value.
+func (k *TGSReq) setPAData(tgt Ticket, sessionKey, subKey types.EncryptionKey) error {
 	// Marshal the request and calculate checksum
 	b, err := k.ReqBody.Marshal()
 	if err != nil {
@@ -247,10 +347,18 @@ func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator")
 	}
+	if k.clock != nil {
+		t := k.clock.Now().UTC()
+		auth.CTime = t
+		auth.Cusec = int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6))
+	}
 	auth.Cksum = types.Checksum{
 		CksumType: etype.GetHashID(),
 		Checksum:  cb,
 	}
+	if len(subKey.KeyValue) > 0 {
+		auth.SubKey = subKey
+	}
 	// Create AP_REQ
 	apReq, err := NewAPReq(tgt, sessionKey, auth)
 	if err != nil {
@@ -260,28 +368,37 @@ func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "error marshaling AP_REQ for pre-authentication data")
 	}
-	k.PAData = types.PADataSequence{
+	// Replace any existing PA-TGS-REQ keeping the other PA data, such as a PA-FOR-USER
+	pas := types.PADataSequence{
 		types.PAData{
 			PADataType:  patype.PA_TGS_REQ,
 			PADataValue: apb,
 		},
 	}
+	for _, pa := range k.PAData {
+		if pa.PADataType != patype.PA_TGS_REQ {
+			pas = append(pas, pa)
+		}
+	}
+	k.PAData = pas
 	return nil
 }
 
 // Unmarshal bytes b into the ASReq struct.
 func (k *ASReq) Unmarshal(b []byte) error {
 	var m marshalKDCReq
-	_, err := asn1.UnmarshalWithParams(b, &m, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.ASREQ))
-	if err != nil {
-		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling AS_REQ")
+	if !readKDCReq(b, asnAppTag.ASREQ, &m) {
+		_, err := asn1.UnmarshalWithParams(b, &m, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.ASREQ))
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling AS_REQ")
+		}
 	}
 	expectedMsgType := msgtype.KRB_AS_REQ
 	if m.MsgType != expectedMsgType {
 		return krberror.NewErrorf(krberror.KRBMsgError, "message ID does not indicate a AS_REQ. Expected: %v; Actual: %v", expectedMsgType, m.MsgType)
 	}
 	var reqb KDCReqBody
-	err = reqb.Unmarshal(m.ReqBody.Bytes)
+	err := reqb.Unmarshal(m.ReqBody.Bytes)
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "error processing AS_REQ body")
 	}
@@ -295,16 +412,18 @@ func (k *ASReq) Unmarshal(b []byte) error {
 // Unmarshal bytes b into the TGSReq struct.
 func (k *TGSReq) Unmarshal(b []byte) error {
 	var m marshalKDCReq
-	_, err := asn1.UnmarshalWithParams(b, &m, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.TGSREQ))
-	if err != nil {
-		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling TGS_REQ")
+	if !readKDCReq(b, asnAppTag.TGSREQ, &m) {
+		_, err := asn1.UnmarshalWithParams(b, &m, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.TGSREQ))
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling TGS_REQ")
+		}
 	}
 	expectedMsgType := msgtype.KRB_TGS_REQ
 	if m.MsgType != expectedMsgType {
 		return krberror.NewErrorf(krberror.KRBMsgError, "message ID does not indicate a TGS_REQ. Expected: %v; Actual: %v", expectedMsgType, m.MsgType)
 	}
 	var reqb KDCReqBody
-	err = reqb.Unmarshal(m.ReqBody.Bytes)
+	err := reqb.Unmarshal(m.ReqBody.Bytes)
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "error processing TGS_REQ body")
 	}
@@ -315,12 +434,27 @@ func (k *TGSReq) Unmarshal(b []byte) error {
 	return nil
 }
 
+// SetTimes sets the end time, and the renew till time of a request for a renewable ticket, requested to those of the
+// ticket lifetimes of the configuration from the time provided, for example the time of a client's clock rather than
+// the system clock the request was generated with. The PA-TGS-REQ of a TGS_REQ must be regenerated once its body is
+// changed, as with UpdateBody.
+func (k *KDCReqBody) SetTimes(t time.Time, c *config.Config) {
+	t = t.UTC()
+	k.Till = t.Add(c.LibDefaults.TicketLifetime)
+	k.RTime = time.Time{}
+	if c.LibDefaults.RenewLifetime > time.Duration(0) && types.IsFlagSet(&k.KDCOptions, flags.Renewable) {
+		k.RTime = t.Add(c.LibDefaults.RenewLifetime)
+	}
+}
+
 // Unmarshal bytes b into the KRB_KDC_REQ body struct.
 func (k *KDCReqBody) Unmarshal(b []byte) error {
 	var m marshalKDCReqBody
-	_, err := asn1.Unmarshal(b, &m)
-	if err != nil {
-		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC_REQ body")
+	if !readKDCReqBody(b, &m) {
+		_, err := asn1.Unmarshal(b, &m)
+		if err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC_REQ body")
+		}
 	}
 	k.KDCOptions = m.KDCOptions
 	if len(k.KDCOptions.Bytes) < 4 {
@@ -339,6 +473,7 @@ func (k *KDCReqBody) Unmarshal(b []byte) error {
 	k.Addresses = m.Addresses
 	k.EncAuthData = m.EncAuthData
 	if len(m.AdditionalTickets.Bytes) > 0 {
+		var err error
 		k.AdditionalTickets, err = unmarshalTicketsSequence(m.AdditionalTickets)
 		if err != nil {
 			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling additional tickets")
@@ -349,58 +484,26 @@ func (k *KDCReqBody) Unmarshal(b []byte) error {
 
 // Marshal ASReq struct.
 func (k *ASReq) Marshal() ([]byte, error) {
-	m := marshalKDCReq{
-		PVNO:    k.PVNO,
-		MsgType: k.MsgType,
-		PAData:  k.PAData,
-	}
-	b, err := k.ReqBody.Marshal()
-	if err != nil {
-		var mk []byte
-		return mk, err
-	}
-	m.ReqBody = asn1.RawValue{
-		Class:      asn1.ClassContextSpecific,
-		IsCompound: true,
-		Tag:        4,
-		Bytes:      b,
-	}
-	mk, err := asn1.Marshal(m)
-	if err != nil {
-		return mk, krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ")
-	}
-	mk = asn1tools.AddASNAppTag(mk, asnAppTag.ASREQ)
-	return mk, nil
+	return k.KDCReqFields.marshal(asnAppTag.ASREQ)
 }
 
 // Marshal TGSReq struct.
 func (k *TGSReq) Marshal() ([]byte, error) {
-	m := marshalKDCReq{
-		PVNO:    k.PVNO,
-		MsgType: k.MsgType,
-		PAData:  k.PAData,
-	}
-	b, err := k.ReqBody.Marshal()
-	if err != nil {
-		var mk []byte
-		return mk, err
-	}
-	m.ReqBody = asn1.RawValue{
-		Class:      asn1.ClassContextSpecific,
-		IsCompound: true,
-		Tag:        4,
-		Bytes:      b,
-	}
-	mk, err := asn1.Marshal(m)
-	if err != nil {
-		return mk, krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ")
-	}
-	mk = asn1tools.AddASNAppTag(mk, asnAppTag.TGSREQ)
-	return mk, nil
+	return k.KDCReqFields.marshal(asnAppTag.TGSREQ)
 }
 
 // Marshal KRB_KDC_REQ body struct.
 func (k *KDCReqBody) Marshal() ([]byte, error) {
+	db := der.NewBuilder()
+	defer db.Release()
+	if k.addTo(db) {
+		return db.Bytes(), nil
+	}
+	return k.marshalASN1()
+}
+
+// marshalASN1 marshals the body with the asn1 package.
+func (k *KDCReqBody) marshalASN1() ([]byte, error) {
 	var b []byte
 	m := marshalKDCReqBody{
 		KDCOptions:  k.KDCOptions,
@@ -430,3 +533,322 @@ func (k *KDCReqBody) Marshal() ([]byte, error) {
 	}
 	return b, nil
 }
+
+// marshal returns the DER of the KDC_REQ wrapped in the application tag provided.
+func (k *KDCReqFields) marshal(tag int) ([]byte, error) {
+	db := der.NewBuilder()
+	defer db.Release()
+	m := db.Len()
+	e := db.Len()
+	if !k.ReqBody.addTo(db) {
+		b, err := k.ReqBody.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		db.AddBytes(b)
+	}
+	db.Explicit(4, e)
+	if k.PAData != nil {
+		e = db.Len()
+		for i := len(k.PAData) - 1; i >= 0; i-- {
+			s := db.Len()
+			f := db.Len()
+			db.AddOctetString(k.PAData[i].PADataValue)
+			db.Explicit(2, f)
+			f = db.Len()
+			db.AddInteger(int64(k.PAData[i].PADataType))
+			db.Explicit(1, f)
+			db.Sequence(s)
+		}
+		db.Sequence(e)
+		db.Explicit(3, e)
+	}
+	e = db.Len()
+	db.AddInteger(int64(k.MsgType))
+	db.Explicit(2, e)
+	e = db.Len()
+	db.AddInteger(int64(k.PVNO))
+	db.Explicit(1, e)
+	db.Sequence(m)
+	db.Wrap(asn1.ClassApplication, tag, true, m)
+	return db.Bytes(), nil
+}
+
+// addTo adds the DER of the body to the builder. If the body cannot be encoded without the asn1 package, as one of
+// its times is not in UTC, nothing is added and false is returned.
+func (k *KDCReqBody) addTo(db *der.Builder) bool {
+	m := db.Len()
+	if len(k.AdditionalTickets) > 0 {
+		e := db.Len()
+		for i := len(k.AdditionalTickets) - 1; i >= 0; i-- {
+			addTicket(db, &k.AdditionalTickets[i])
+		}
+		db.Sequence(e)
+		db.Explicit(11, e)
+	}
+	if k.EncAuthData.EType != 0 || k.EncAuthData.KVNO != 0 || k.EncAuthData.Cipher != nil {
+		e := db.Len()
+		db.AddEncryptedData(k.EncAuthData.EType, k.EncAuthData.KVNO, k.EncAuthData.Cipher)
+		db.Explicit(10, e)
+	}
+	if k.Addresses != nil {
+		e := db.Len()
+		for i := len(k.Addresses) - 1; i >= 0; i-- {
+			s := db.Len()
+			f := db.Len()
+			db.AddOctetString(k.Addresses[i].Address)
+			db.Explicit(1, f)
+			f = db.Len()
+			db.AddInteger(int64(k.Addresses[i].AddrType))
+			db.Explicit(0, f)
+			db.Sequence(s)
+		}
+		db.Sequence(e)
+		db.Explicit(9, e)
+	}
+	e := db.Len()
+	for i := len(k.EType) - 1; i >= 0; i-- {
+		db.AddInteger(int64(k.EType[i]))
+	}
+	db.Sequence(e)
+	db.Explicit(8, e)
+	e = db.Len()
+	db.AddInteger(int64(k.Nonce))
+	db.Explicit(7, e)
+	for _, t := range [...]struct {
+		tag      int
+		t        time.Time
+		optional bool
+	}{{6, k.RTime, true}, {5, k.Till, false}, {4, k.From, true}} {
+		if t.optional && t.t == (time.Time{}) {
+			continue
+		}
+		e = db.Len()
+		if !db.AddGeneralizedTime(t.t) {
+			db.Truncate(m)
+			return false
+		}
+		db.Explicit(t.tag, e)
+	}
+	if k.SName.NameType != 0 || k.SName.NameString != nil {
+		e = db.Len()
+		db.AddPrincipalName(k.SName.NameType, k.SName.NameString)
+		db.Explicit(3, e)
+	}
+	e = db.Len()
+	db.AddGeneralString(k.Realm)
+	db.Explicit(2, e)
+	if k.CName.NameType != 0 || k.CName.NameString != nil {
+		e = db.Len()
+		db.AddPrincipalName(k.CName.NameType, k.CName.NameString)
+		db.Explicit(1, e)
+	}
+	e = db.Len()
+	db.AddBitString(k.KDCOptions)
+	db.Explicit(0, e)
+	db.Sequence(m)
+	return true
+}
+
+// readKDCReq reads the DER of a KDC_REQ wrapped in the application tag provided into m. If the DER is not in the form
+// expected false is returned so that the asn1 package can be used to unmarshal it instead.
+func readKDCReq(b []byte, tag int, m *marshalKDCReq) bool {
+	p := der.Parser(b)
+	a, ok := p.Read(asn1.ClassApplication, tag, true)
+	if !ok {
+		return false
+	}
+	s, ok := a.Sequence()
+	if !ok || !a.Empty() {
+		return false
+	}
+	pvno, ok := s.ExplicitInt(1)
+	if !ok {
+		return false
+	}
+	msgType, ok := s.ExplicitInt(2)
+	if !ok {
+		return false
+	}
+	var pas types.PADataSequence
+	if s.Peek(asn1.ClassContextSpecific, 3) {
+		c, ok := s.Explicit(3)
+		if !ok {
+			return false
+		}
+		seq, ok := c.Sequence()
+		if !ok || !c.Empty() {
+			return false
+		}
+		n, ok := seq.Count()
+		if !ok {
+			return false
+		}
+		pas = make(types.PADataSequence, n)
+		for i := range pas {
+			pa, ok := seq.Sequence()
+			if !ok {
+				return false
+			}
+			if pas[i].PADataType, ok = pa.ExplicitInt32(1); !ok {
+				return false
+			}
+			v, ok := pa.Explicit(2)
+			if !ok {
+				return false
+			}
+			if pas[i].PADataValue, ok = v.ReadOctetString(); !ok || !v.Empty() || !pa.Empty() {
+				return false
+			}
+		}
+	}
+	full, body, ok := s.ReadFull(asn1.ClassContextSpecific, 4, true)
+	if !ok || !s.Empty() {
+		return false
+	}
+	m.PVNO = pvno
+	m.MsgType = msgType
+	m.PAData = pas
+	m.ReqBody = asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        4,
+		Bytes:      body,
+		FullBytes:  full,
+	}
+	return true
+}
+
+// readKDCReqBody reads the DER of a KDC_REQ body into m. If the DER is not in the form expected false is returned so
+// that the asn1 package can be used to unmarshal it instead.
+func readKDCReqBody(b []byte, m *marshalKDCReqBody) bool {
+	p := der.Parser(b)
+	s, ok := p.Sequence()
+	if !ok {
+		return false
+	}
+	var r marshalKDCReqBody
+	if r.KDCOptions, ok = s.ExplicitBitString(0); !ok {
+		return false
+	}
+	if s.Peek(asn1.ClassContextSpecific, 1) {
+		if r.CName, ok = explicitPrincipalName(&s, 1); !ok {
+			return false
+		}
+	}
+	if r.Realm, ok = s.ExplicitGeneralString(2); !ok {
+		return false
+	}
+	if s.Peek(asn1.ClassContextSpecific, 3) {
+		if r.SName, ok = explicitPrincipalName(&s, 3); !ok {
+			return false
+		}
+	}
+	if s.Peek(asn1.ClassContextSpecific, 4) {
+		if r.From, ok = s.ExplicitGeneralizedTime(4); !ok {
+			return false
+		}
+	}
+	if r.Till, ok = s.ExplicitGeneralizedTime(5); !ok {
+		return false
+	}
+	if s.Peek(asn1.ClassContextSpecific, 6) {
+		if r.RTime, ok = s.ExplicitGeneralizedTime(6); !ok {
+			return false
+		}
+	}
+	if r.Nonce, ok = s.ExplicitInt(7); !ok {
+		return false
+	}
+	c, ok := s.Explicit(8)
+	if !ok {
+		return false
+	}
+	seq, ok := c.Sequence()
+	if !ok || !c.Empty() {
+		return false
+	}
+	n, ok := seq.Count()
+	if !ok {
+		return false
+	}
+	r.EType = make([]int32, n)
+	for i := range r.EType {
+		if r.EType[i], ok = seq.ReadInt32(); !ok {
+			return false
+		}
+	}
+	if s.Peek(asn1.ClassContextSpecific, 9) {
+		c, ok := s.Explicit(9)
+		if !ok {
+			return false
+		}
+		seq, ok := c.Sequence()
+		if !ok || !c.Empty() {
+			return false
+		}
+		n, ok := seq.Count()
+		if !ok {
+			return false
+		}
+		r.Addresses = make([]types.HostAddress, n)
+		for i := range r.Addresses {
+			ha, ok := seq.Sequence()
+			if !ok {
+				return false
+			}
+			if r.Addresses[i].AddrType, ok = ha.ExplicitInt32(0); !ok {
+				return false
+			}
+			v, ok := ha.Explicit(1)
+			if !ok {
+				return false
+			}
+			if r.Addresses[i].Address, ok = v.ReadOctetString(); !ok || !v.Empty() || !ha.Empty() {
+				return false
+			}
+		}
+	}
+	if s.Peek(asn1.ClassContextSpecific, 10) {
+		c, ok := s.Explicit(10)
+		if !ok {
+			return false
+		}
+		et, kvno, _, cipher, ok := c.ReadEncryptedData()
+		if !ok || !c.Empty() {
+			return false
+		}
+		r.EncAuthData = types.EncryptedData{EType: et, KVNO: kvno, Cipher: cipher}
+	}
+	if s.Peek(asn1.ClassContextSpecific, 11) {
+		full, tkts, ok := s.ReadFull(asn1.ClassContextSpecific, 11, true)
+		if !ok {
+			return false
+		}
+		r.AdditionalTickets = asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			IsCompound: true,
+			Tag:        11,
+			Bytes:      tkts,
+			FullBytes:  full,
+		}
+	}
+	if !s.Empty() {
+		return false
+	}
+	*m = r
+	return true
+}
+
+// explicitPrincipalName reads a PrincipalName with the explicit context specific tag.
+func explicitPrincipalName(p *der.Parser, tag int) (types.PrincipalName, bool) {
+	c, ok := p.Explicit(tag)
+	if !ok {
+		return types.PrincipalName{}, false
+	}
+	nt, ns, ok := c.ReadPrincipalName()
+	if !ok || !c.Empty() {
+		return types.PrincipalName{}, false
+	}
+	return types.PrincipalName{NameType: nt, NameString: ns}, true
+}
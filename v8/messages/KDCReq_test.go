@@ -6,12 +6,21 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto/rfc4757"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/iana/patype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -424,3 +433,245 @@ func TestMarshalTGSReq(t *testing.T) {
 	}
 	assert.Equal(t, b, mb, "Marshal bytes of TGSReq not as expected")
 }
+
+func TestNewS4U2SelfTGSReq(t *testing.T) {
+	t.Parallel()
+	sessionKey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	tgt := Ticket{
+		TktVNO: iana.PVNO,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		EncPart: types.EncryptedData{
+			EType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+			Cipher: []byte{1, 2, 3, 4},
+		},
+	}
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user1")
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	a, err := NewS4U2SelfTGSReq(user, "TEST.GOKRB5", "TEST.GOKRB5", config.New(), tgt, sessionKey, sname)
+	if err != nil {
+		t.Fatalf("error creating S4U2Self TGS_REQ: %v", err)
+	}
+	assert.Equal(t, user, a.ReqBody.CName, "CName should be the user")
+	assert.Equal(t, sname, a.ReqBody.SName, "SName should be the service")
+	if !assert.Len(t, a.PAData, 2, "PA data not as expected") {
+		return
+	}
+	assert.Equal(t, patype.PA_TGS_REQ, a.PAData[0].PADataType, "first PA data should be the PA-TGS-REQ")
+	assert.Equal(t, patype.PA_FOR_USER, a.PAData[1].PADataType, "second PA data should be the PA-FOR-USER")
+
+	var pa types.PAForUser
+	err = pa.Unmarshal(a.PAData[1].PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-FOR-USER: %v", err)
+	}
+	assert.Equal(t, user, pa.UserName, "PA-FOR-USER user name not as expected")
+	assert.Equal(t, "TEST.GOKRB5", pa.UserRealm, "PA-FOR-USER user realm not as expected")
+	assert.Equal(t, "Kerberos", pa.AuthPackage, "PA-FOR-USER auth package not as expected")
+	assert.Equal(t, chksumtype.KERB_CHECKSUM_HMAC_MD5, pa.Cksum.CksumType, "PA-FOR-USER checksum type not as expected")
+	cb, err := rfc4757.Checksum(sessionKey.KeyValue, keyusage.KERB_NON_KERB_CKSUM_SALT, pa.ChecksumData())
+	if err != nil {
+		t.Fatalf("error calculating checksum: %v", err)
+	}
+	assert.Equal(t, cb, pa.Cksum.Checksum, "PA-FOR-USER checksum not as expected")
+}
+
+func TestNewS4U2ProxyTGSReq(t *testing.T) {
+	t.Parallel()
+	sessionKey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	tgt := Ticket{
+		TktVNO: iana.PVNO,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		EncPart: types.EncryptedData{
+			EType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+			Cipher: []byte{1, 2, 3, 4},
+		},
+	}
+	evidence := Ticket{
+		TktVNO: iana.PVNO,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "gateway"),
+		EncPart: types.EncryptedData{
+			EType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+			Cipher: []byte{5, 6, 7, 8},
+		},
+	}
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user1")
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	a, err := NewS4U2ProxyTGSReq(user, "TEST.GOKRB5", config.New(), tgt, sessionKey, sname, evidence)
+	if err != nil {
+		t.Fatalf("error creating S4U2Proxy TGS_REQ: %v", err)
+	}
+	assert.Equal(t, sname, a.ReqBody.SName, "SName should be the target service")
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, flags.CNameInAddlTkt), "cname-in-addl-tkt option should be set")
+	if assert.Len(t, a.ReqBody.AdditionalTickets, 1, "additional tickets not as expected") {
+		assert.Equal(t, evidence.EncPart.Cipher, a.ReqBody.AdditionalTickets[0].EncPart.Cipher, "additional ticket should be the evidence ticket")
+	}
+	if !assert.Len(t, a.PAData, 2, "PA data not as expected") {
+		return
+	}
+	assert.Equal(t, patype.PA_TGS_REQ, a.PAData[0].PADataType, "first PA data should be the PA-TGS-REQ")
+	assert.Equal(t, patype.PA_PAC_OPTIONS, a.PAData[1].PADataType, "second PA data should be the PA-PAC-OPTIONS")
+	var pa types.PAPACOptions
+	err = pa.Unmarshal(a.PAData[1].PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-PAC-OPTIONS: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&pa.KerberosFlags, types.PACOptionResourceBasedConstrainedDelegation), "resource-based constrained delegation should be requested")
+
+	// The request must survive the round trip to the KDC.
+	b, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling S4U2Proxy TGS_REQ: %v", err)
+	}
+	var u TGSReq
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling S4U2Proxy TGS_REQ: %v", err)
+	}
+	assert.Len(t, u.ReqBody.AdditionalTickets, 1, "additional tickets not as expected after unmarshaling")
+}
+
+func TestKDCReq_MarshalAsASN1(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		hex string
+		tag int
+	}{
+		{testdata.MarshaledKRB5as_req, asnAppTag.ASREQ},
+		{testdata.MarshaledKRB5as_reqOptionalsNULLexceptsecond_ticket, asnAppTag.ASREQ},
+		{testdata.MarshaledKRB5as_reqOptionalsNULLexceptserver, asnAppTag.ASREQ},
+		{testdata.MarshaledKRB5tgs_req, asnAppTag.TGSREQ},
+		{testdata.MarshaledKRB5tgs_reqOptionalsNULLexceptsecond_ticket, asnAppTag.TGSREQ},
+		{testdata.MarshaledKRB5tgs_reqOptionalsNULLexceptserver, asnAppTag.TGSREQ},
+	} {
+		v, _ := hex.DecodeString(test.hex)
+		var m, ma marshalKDCReq
+		assert.True(t, readKDCReq(v, test.tag, &m), "KDC_REQ not read")
+		_, err := asn1.UnmarshalWithParams(v, &ma, fmt.Sprintf("application,explicit,tag:%v", test.tag))
+		if err != nil {
+			t.Fatalf("error unmarshaling with asn1: %v", err)
+		}
+		assert.Equal(t, ma, m, "KDC_REQ read not as the asn1 package's")
+
+		var mb, mba marshalKDCReqBody
+		assert.True(t, readKDCReqBody(m.ReqBody.Bytes, &mb), "KDC_REQ body not read")
+		_, err = asn1.Unmarshal(m.ReqBody.Bytes, &mba)
+		if err != nil {
+			t.Fatalf("error unmarshaling body with asn1: %v", err)
+		}
+		assert.Equal(t, mba, mb, "KDC_REQ body read not as the asn1 package's")
+
+		var body KDCReqBody
+		err = body.Unmarshal(m.ReqBody.Bytes)
+		if err != nil {
+			t.Fatalf("error unmarshaling body: %v", err)
+		}
+		body.EncAuthData.Cipher = make([]byte, 300)
+		body.Addresses = append(body.Addresses, types.HostAddress{AddrType: addrtype.IPv4, Address: []byte{10, 0, 0, 1}})
+		want, err := body.marshalASN1()
+		if err != nil {
+			t.Fatalf("error marshaling body with asn1: %v", err)
+		}
+		b, err := body.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling body: %v", err)
+		}
+		assert.Equal(t, want, b, "encoding of body not as the asn1 package's")
+	}
+}
+
+func TestKDCReqBody_MarshalNotUTC(t *testing.T) {
+	t.Parallel()
+	var a TGSReq
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5tgs_req)
+	err := a.Unmarshal(v)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	// A time that is not in UTC is encoded by the asn1 package with its offset.
+	a.ReqBody.Till = a.ReqBody.Till.In(time.FixedZone("", -5*3600))
+	want, err := a.ReqBody.marshalASN1()
+	if err != nil {
+		t.Fatalf("error marshaling body with asn1: %v", err)
+	}
+	b, err := a.ReqBody.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling body: %v", err)
+	}
+	assert.Equal(t, want, b, "encoding of body not as the asn1 package's")
+	b, err = a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var u TGSReq
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	assert.True(t, a.ReqBody.Till.Equal(u.ReqBody.Till), "till time not as expected")
+}
+
+func TestKDCReqBody_SetTimes(t *testing.T) {
+	t.Parallel()
+	c := config.New()
+	c.LibDefaults.TicketLifetime = 10 * time.Hour
+	c.LibDefaults.RenewLifetime = 7 * 24 * time.Hour
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := KDCReqBody{KDCOptions: types.NewKrbFlags()}
+	b.SetTimes(now, c)
+	assert.Equal(t, now.Add(10*time.Hour), b.Till, "till time not as expected")
+	assert.True(t, b.RTime.IsZero(), "renew till time should not be set for a ticket that is not renewable")
+	types.SetFlag(&b.KDCOptions, flags.Renewable)
+	b.SetTimes(now.In(time.FixedZone("", -5*3600)), c)
+	assert.Equal(t, now.Add(7*24*time.Hour), b.RTime, "renew till time not as expected")
+	assert.Equal(t, time.UTC, b.Till.Location(), "times should be in UTC")
+}
+
+func BenchmarkASReq_Marshal(b *testing.B) {
+	var a ASReq
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5as_req)
+	err := a.Unmarshal(v)
+	if err != nil {
+		b.Fatalf("Unmarshal error: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := a.Marshal()
+		if err != nil {
+			b.Fatalf("Marshal error: %v", err)
+		}
+	}
+}
+
+func BenchmarkTGSReq_Marshal(b *testing.B) {
+	var a TGSReq
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5tgs_req)
+	err := a.Unmarshal(v)
+	if err != nil {
+		b.Fatalf("Unmarshal error: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := a.Marshal()
+		if err != nil {
+			b.Fatalf("Marshal error: %v", err)
+		}
+	}
+}
+
+func BenchmarkTGSReq_Unmarshal(b *testing.B) {
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5tgs_req)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var a TGSReq
+		err := a.Unmarshal(v)
+		if err != nil {
+			b.Fatalf("Unmarshal error: %v", err)
+		}
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/credentials"
 	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
@@ -49,11 +52,42 @@ type KrbCredInfo struct {
 	StartTime time.Time           `asn1:"generalized,optional,explicit,tag:5"`
 	EndTime   time.Time           `asn1:"generalized,optional,explicit,tag:6"`
 	RenewTill time.Time           `asn1:"generalized,optional,explicit,tag:7"`
-	SRealm    string              `asn1:"optional,explicit,ia5,tag:8"`
+	SRealm    string              `asn1:"generalstring,optional,explicit,tag:8"`
 	SName     types.PrincipalName `asn1:"optional,explicit,tag:9"`
 	CAddr     types.HostAddresses `asn1:"optional,explicit,tag:10"`
 }
 
+// NewKRBCred returns a new KRB_CRED for the tickets with the credential information of each in the same order.
+// The encrypted part must be produced with EncryptEncPart before the KRB_CRED is marshaled.
+func NewKRBCred(tickets []Ticket, info []KrbCredInfo) KRBCred {
+	return KRBCred{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_CRED,
+		Tickets: tickets,
+		DecryptedEncPart: EncKrbCredPart{
+			TicketInfo: info,
+		},
+	}
+}
+
+// NewKrbCredInfo returns the credential information of a KRB_CRED for a ticket issued to the principal cname of the
+// realm crealm, taken from the decrypted encrypted part of the KDC reply the ticket was issued in.
+func NewKrbCredInfo(cname types.PrincipalName, crealm string, dep EncKDCRepPart) KrbCredInfo {
+	return KrbCredInfo{
+		Key:       dep.Key,
+		PRealm:    crealm,
+		PName:     cname,
+		Flags:     dep.Flags,
+		AuthTime:  dep.AuthTime,
+		StartTime: dep.StartTime,
+		EndTime:   dep.EndTime,
+		RenewTill: dep.RenewTill,
+		SRealm:    dep.SRealm,
+		SName:     dep.SName,
+		CAddr:     dep.CAddr,
+	}
+}
+
 // Unmarshal bytes b into the KRBCred struct.
 func (k *KRBCred) Unmarshal(b []byte) error {
 	var m marshalKRBCred
@@ -77,14 +111,63 @@ func (k *KRBCred) Unmarshal(b []byte) error {
 	return nil
 }
 
+// Marshal the KRBCred.
+func (k *KRBCred) Marshal() ([]byte, error) {
+	m := marshalKRBCred{
+		PVNO:    k.PVNO,
+		MsgType: k.MsgType,
+		EncPart: k.EncPart,
+	}
+	rawtkts, err := MarshalTicketSequence(k.Tickets)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling tickets within KRB_CRED")
+	}
+	//The asn1.rawValue needs the tag setting on it for where it is in the KRBCred
+	rawtkts.Tag = 2
+	m.Tickets = rawtkts
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_CRED")
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.KRBCred)
+	return b, nil
+}
+
+// EncryptEncPart encrypts the DecryptedEncPart within the KRBCred with the key. Use to prepare for marshaling.
+//
+// If the key has no encryption type the encrypted part holds the DecryptedEncPart unencrypted with an etype of zero,
+// as MIT Kerberos does when credentials are exported without a key shared with the recipient. The credentials' session
+// keys are then readable by anyone with access to the KRB_CRED.
+func (k *KRBCred) EncryptEncPart(key types.EncryptionKey) error {
+	b, err := asn1.Marshal(k.DecryptedEncPart)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling encrypted part of KRB_CRED")
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncKrbCredPart)
+	if key.KeyType == 0 {
+		k.EncPart = types.EncryptedData{Cipher: b}
+		return nil
+	}
+	k.EncPart, err = crypto.GetEncryptedData(b, key, keyusage.KRB_CRED_ENCPART, 0)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error encrypting KRB_CRED EncPart")
+	}
+	return nil
+}
+
 // DecryptEncPart decrypts the encrypted part of a KRB_CRED.
+// An encrypted part with an etype of zero is not encrypted and the key is not used.
 func (k *KRBCred) DecryptEncPart(key types.EncryptionKey) error {
-	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.KRB_CRED_ENCPART)
-	if err != nil {
-		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KRB_CRED EncPart")
+	b := k.EncPart.Cipher
+	if k.EncPart.EType != 0 {
+		var err error
+		b, err = crypto.DecryptEncPart(k.EncPart, key, keyusage.KRB_CRED_ENCPART)
+		if err != nil {
+			return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KRB_CRED EncPart")
+		}
 	}
 	var denc EncKrbCredPart
-	err = denc.Unmarshal(b)
+	err := denc.Unmarshal(b)
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling encrypted part of KRB_CRED")
 	}
@@ -100,3 +183,38 @@ func (k *EncKrbCredPart) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// CCache returns a credential cache holding the tickets of the decrypted KRB_CRED, such as a forwarded TGT, so that
+// they can be used by a client or saved for other Kerberos applications. The default principal of the credential cache
+// is the principal the first ticket was issued to, which its credential information must identify.
+func (k *KRBCred) CCache() (*credentials.CCache, error) {
+	info := k.DecryptedEncPart.TicketInfo
+	if len(k.Tickets) < 1 || len(k.Tickets) != len(info) {
+		return nil, krberror.New(krberror.KRBMsgError, "KRB_CRED does not hold credential information for each of its tickets")
+	}
+	if len(info[0].PName.NameString) < 1 || info[0].PRealm == "" {
+		return nil, krberror.New(krberror.KRBMsgError, "KRB_CRED does not identify the principal the tickets were issued to")
+	}
+	c := credentials.NewCCache(info[0].PName, info[0].PRealm)
+	for i, tkt := range k.Tickets {
+		b, err := tkt.Marshal()
+		if err != nil {
+			return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling ticket within KRB_CRED")
+		}
+		cname, crealm := info[i].PName, info[i].PRealm
+		if len(cname.NameString) < 1 || crealm == "" {
+			cname, crealm = info[0].PName, info[0].PRealm
+		}
+		cred := credentials.NewCredential(cname, crealm, tkt.SName, tkt.Realm)
+		cred.Key = info[i].Key
+		cred.AuthTime = info[i].AuthTime
+		cred.StartTime = info[i].StartTime
+		cred.EndTime = info[i].EndTime
+		cred.RenewTill = info[i].RenewTill
+		cred.TicketFlags = info[i].Flags
+		cred.Addresses = info[i].CAddr
+		cred.Ticket = b
+		c.AddCredential(cred)
+	}
+	return c, nil
+}
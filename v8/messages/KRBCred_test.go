@@ -11,6 +11,7 @@ import (
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -130,3 +131,123 @@ func TestUnmarshalEncCredPart_optionalsNULL(t *testing.T) {
 		assert.Equal(t, "12d00023", hex.EncodeToString(addr.Address), fmt.Sprintf("Host address not as expected for address item %d within ticket info %d", j+1, i+1))
 	}
 }
+
+func TestMarshalKRBCred(t *testing.T) {
+	t.Parallel()
+	var a KRBCred
+	b, err := hex.DecodeString(testdata.MarshaledKRB5cred)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBCred: %v", err)
+	}
+	assert.Equal(t, b, mb, "marshaled bytes not as expected")
+}
+
+func TestKRBCred_EncryptEncPart(t *testing.T) {
+	t.Parallel()
+	var a KRBCred
+	b, err := hex.DecodeString(testdata.MarshaledKRB5cred)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	b, err = hex.DecodeString(testdata.MarshaledKRB5enc_cred_part)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = a.DecryptedEncPart.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	keys := []types.EncryptionKey{
+		{},
+		{
+			KeyType:  int32(18),
+			KeyValue: []byte("12345678901234567890123456789012"),
+		},
+	}
+	for _, key := range keys {
+		err = a.EncryptEncPart(key)
+		if err != nil {
+			t.Fatalf("error encrypting encpart with etype %d: %v", key.KeyType, err)
+		}
+		assert.Equal(t, key.KeyType, a.EncPart.EType, "encpart etype not as expected")
+		if key.KeyType == 0 {
+			assert.Equal(t, b, a.EncPart.Cipher, "unencrypted encpart not as expected")
+		}
+		mb, err := a.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling KRBCred: %v", err)
+		}
+		var c KRBCred
+		err = c.Unmarshal(mb)
+		if err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		err = c.DecryptEncPart(key)
+		if err != nil {
+			t.Fatalf("error decrypting encpart with etype %d: %v", key.KeyType, err)
+		}
+		assert.Equal(t, a.DecryptedEncPart, c.DecryptedEncPart, "decrypted encpart with etype %d not as expected", key.KeyType)
+	}
+}
+
+func TestKRBCred_CCache(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 14, 9, 5, 1, 0, time.UTC)
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5")
+	tkt := Ticket{
+		TktVNO: iana.PVNO,
+		Realm:  "TEST.GOKRB5",
+		SName:  sname,
+		EncPart: types.EncryptedData{
+			EType:  18,
+			KVNO:   1,
+			Cipher: []byte{1, 2, 3, 4},
+		},
+	}
+	key := types.EncryptionKey{
+		KeyType:  18,
+		KeyValue: []byte("12345678901234567890123456789012"),
+	}
+	info := NewKrbCredInfo(cname, "TEST.GOKRB5", EncKDCRepPart{
+		Key:       key,
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(2 * time.Hour),
+		SRealm:    "TEST.GOKRB5",
+		SName:     sname,
+	})
+	k := NewKRBCred([]Ticket{tkt}, []KrbCredInfo{info})
+	c, err := k.CCache()
+	if err != nil {
+		t.Fatalf("error getting credential cache: %v", err)
+	}
+	assert.Equal(t, "testuser1", c.DefaultPrincipal.PrincipalName.PrincipalNameString(), "default principal not as expected")
+	assert.Equal(t, "TEST.GOKRB5", c.DefaultPrincipal.Realm, "default principal realm not as expected")
+	if assert.Len(t, c.Credentials, 1, "number of credentials not as expected") {
+		cred := c.Credentials[0]
+		assert.Equal(t, key, cred.Key, "session key not as expected")
+		assert.True(t, now.Add(time.Hour).Equal(cred.EndTime), "end time not as expected")
+		assert.Equal(t, "krbtgt/TEST.GOKRB5", cred.Server.PrincipalName.PrincipalNameString(), "server not as expected")
+		b, _ := tkt.Marshal()
+		assert.Equal(t, b, cred.Ticket, "ticket not as expected")
+	}
+
+	k.DecryptedEncPart.TicketInfo[0].PName = types.PrincipalName{}
+	_, err = k.CCache()
+	assert.Error(t, err, "KRB_CRED that does not identify the principal should fail")
+}
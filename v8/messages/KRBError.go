@@ -11,6 +11,7 @@ import (
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/types"
 )
@@ -79,6 +80,102 @@ func (k KRBError) Error() string {
 	return etxt
 }
 
+// Is reports whether the target is a KRBError or krberror.Code with the same error code so that KDC errors can be
+// matched with errors.Is, for example errors.Is(err, krberror.ErrPreAuthFailed) or
+// errors.Is(err, messages.KRBError{ErrorCode: errorcode.KDC_ERR_PREAUTH_FAILED}).
+func (k KRBError) Is(target error) bool {
+	switch t := target.(type) {
+	case KRBError:
+		return k.ErrorCode == t.ErrorCode
+	case *KRBError:
+		return t != nil && k.ErrorCode == t.ErrorCode
+	case krberror.Code:
+		return k.ErrorCode == int32(t)
+	}
+	return false
+}
+
+// KRBErrorCode returns the error code of the KRBError so that it can be retrieved with krberror.ErrorCode.
+func (k KRBError) KRBErrorCode() int32 {
+	return k.ErrorCode
+}
+
+// ErrorKind returns the kind of error indicated by the KRBError's error code.
+func (k KRBError) ErrorKind() krberror.Kind {
+	return krberror.Code(k.ErrorCode).ErrorKind()
+}
+
+// MethodData returns the METHOD-DATA of the KRBError's e-data with which the KDC describes the pre-authentication it
+// accepts, such as the PA types offered, the ETYPE-INFO2 salts and PA-FX-FAST when FAST is required, for example in
+// a KDC_ERR_PREAUTH_REQUIRED or KDC_ERR_PREAUTH_FAILED error. METHOD-DATA wrapped in TYPED-DATA, as Samba and Heimdal
+// KDCs may send, is also returned. Nil is returned if the error has no e-data.
+func (k KRBError) MethodData() (types.MethodData, error) {
+	if len(k.EData) < 1 {
+		return nil, nil
+	}
+	var md types.MethodData
+	_, err := asn1.Unmarshal(k.EData, &md)
+	if err == nil {
+		return md, nil
+	}
+	var tds types.TypedDataSequence
+	if tds.Unmarshal(k.EData) != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KRB_ERROR e-data as METHOD-DATA")
+	}
+	md = types.MethodData{}
+	for _, td := range tds {
+		if td.DataType != patype.TD_PADATA {
+			continue
+		}
+		var pas types.PADataSequence
+		if pas.Unmarshal(td.DataValue) != nil {
+			return nil, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KRB_ERROR e-data as METHOD-DATA")
+		}
+		md = append(md, pas...)
+	}
+	return md, nil
+}
+
+// PreAuthTypes returns the PA types of the METHOD-DATA of the KRBError's e-data, in the order the KDC sent them, or
+// nil if the e-data is not METHOD-DATA.
+func (k KRBError) PreAuthTypes() []int32 {
+	md, err := k.MethodData()
+	if err != nil {
+		return nil
+	}
+	var pt []int32
+	for _, pa := range md {
+		pt = append(pt, pa.PADataType)
+	}
+	return pt
+}
+
+// ETypeInfo2 returns the encryption types and salts of the PA-ETYPE-INFO2 in the METHOD-DATA of the KRBError's
+// e-data, or nil if there is none.
+func (k KRBError) ETypeInfo2() (types.ETypeInfo2, error) {
+	md, err := k.MethodData()
+	if err != nil {
+		return nil, err
+	}
+	for _, pa := range md {
+		if pa.PADataType == patype.PA_ETYPE_INFO2 {
+			return pa.GetETypeInfo2()
+		}
+	}
+	return nil, nil
+}
+
+// RequiresFAST reports if the METHOD-DATA of the KRBError's e-data includes PA-FX-FAST, with which the KDC indicates
+// that it supports FAST and, for principals requiring it, that the request must be armored.
+func (k KRBError) RequiresFAST() bool {
+	for _, t := range k.PreAuthTypes() {
+		if t == patype.PA_FX_FAST {
+			return true
+		}
+	}
+	return false
+}
+
 func processUnmarshalReplyError(b []byte, err error) error {
 	switch err.(type) {
 	case asn1.StructuralError:
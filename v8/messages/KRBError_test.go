@@ -2,14 +2,21 @@ package messages
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -83,3 +90,87 @@ func TestUnmarshalMarshalKRBError_optionalsNULL(t *testing.T) {
 	}
 	assert.Equal(t, b, b2, "marshalled bytes not as expected")
 }
+
+func TestKRBError_Is(t *testing.T) {
+	t.Parallel()
+	krberr := NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_FAILED, "")
+	err := krberror.Errorf(krberr, krberror.KDCError, "error in AS exchange")
+	assert.True(t, errors.Is(err, KRBError{ErrorCode: errorcode.KDC_ERR_PREAUTH_FAILED}), "error code should match")
+	assert.True(t, errors.Is(err, &KRBError{ErrorCode: errorcode.KDC_ERR_PREAUTH_FAILED}), "error code should match pointer target")
+	assert.False(t, errors.Is(err, KRBError{ErrorCode: errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN}), "different error code should not match")
+	var e KRBError
+	if assert.True(t, errors.As(err, &e), "KRBError not found with errors.As") {
+		assert.Equal(t, errorcode.KDC_ERR_PREAUTH_FAILED, e.ErrorCode, "error code not as expected")
+	}
+	assert.True(t, errors.Is(err, krberror.ErrPreAuthFailed), "error code should match krberror.Code")
+	assert.True(t, krberror.Is(fmt.Errorf("login: %w", err), errorcode.KDC_ERR_PREAUTH_FAILED), "error code should match through wrapping")
+	assert.False(t, errors.Is(err, krberror.ErrClientUnknown), "different krberror.Code should not match")
+	code, ok := krberror.ErrorCode(fmt.Errorf("login: %w", err))
+	assert.True(t, ok, "error code not found")
+	assert.Equal(t, errorcode.KDC_ERR_PREAUTH_FAILED, code, "error code not as expected")
+}
+
+func TestKRBError_ErrorKind(t *testing.T) {
+	t.Parallel()
+	var tests = map[int32]krberror.Kind{
+		errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN: krberror.KindConfig,
+		errorcode.KDC_ERR_PREAUTH_FAILED:      krberror.KindCredentials,
+		errorcode.KRB_AP_ERR_SKEW:             krberror.KindClock,
+		errorcode.KDC_ERR_ETYPE_NOSUPP:        krberror.KindCryptoPolicy,
+		errorcode.KDC_ERR_POLICY:              krberror.KindAuthorization,
+		errorcode.KRB_ERR_RESPONSE_TOO_BIG:    krberror.KindNetwork,
+		errorcode.KRB_AP_ERR_REPEAT:           krberror.KindProtocol,
+		errorcode.KRB_ERR_GENERIC:             krberror.KindProtocol,
+	}
+	for code, kind := range tests {
+		krberr := NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", code, "")
+		assert.Equal(t, kind, krberr.ErrorKind(), "kind not as expected for %s", errorcode.Lookup(code))
+		err := krberror.Errorf(krberr, krberror.KDCError, "error in AS exchange")
+		assert.Equal(t, kind, krberror.ErrorKind(err), "kind of wrapped error not as expected for %s", errorcode.Lookup(code))
+	}
+}
+
+func TestKRBError_MethodData(t *testing.T) {
+	t.Parallel()
+	info, _ := asn1.Marshal(types.ETypeInfo2{{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: "TEST.GOKRB5testuser1"}})
+	md := types.MethodData{
+		{PADataType: patype.PA_ETYPE_INFO2, PADataValue: info},
+		{PADataType: patype.PA_ENC_TIMESTAMP},
+		{PADataType: patype.PA_FX_FAST},
+	}
+	mdb, _ := asn1.Marshal(md)
+	tdb, _ := asn1.Marshal(types.TypedDataSequence{{DataType: patype.TD_PADATA, DataValue: mdb}})
+	for name, edata := range map[string][]byte{"METHOD-DATA": mdb, "TYPED-DATA": tdb} {
+		krberr := NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_REQUIRED, "")
+		krberr.EData = edata
+		// The e-data is available from the error returned by the client.
+		var e KRBError
+		if !assert.True(t, errors.As(krberror.Errorf(krberr, krberror.KDCError, "AS Exchange Error"), &e), "KRBError not found with errors.As") {
+			continue
+		}
+		got, err := e.MethodData()
+		if err != nil {
+			t.Fatalf("error getting METHOD-DATA from %s: %v", name, err)
+		}
+		assert.Len(t, got, len(md), "METHOD-DATA from %s not as expected", name)
+		assert.Equal(t, []int32{patype.PA_ETYPE_INFO2, patype.PA_ENC_TIMESTAMP, patype.PA_FX_FAST}, e.PreAuthTypes(), "PA types from %s not as expected", name)
+		assert.True(t, e.RequiresFAST(), "FAST should be indicated in %s", name)
+		ei, err := e.ETypeInfo2()
+		if err != nil {
+			t.Fatalf("error getting ETYPE-INFO2 from %s: %v", name, err)
+		}
+		if assert.Len(t, ei, 1, "ETYPE-INFO2 from %s not as expected", name) {
+			assert.Equal(t, "TEST.GOKRB5testuser1", ei[0].Salt, "salt from %s not as expected", name)
+		}
+	}
+
+	krberr := NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_FAILED, "")
+	got, err := krberr.MethodData()
+	assert.NoError(t, err)
+	assert.Nil(t, got, "error without e-data should have no METHOD-DATA")
+	assert.False(t, krberr.RequiresFAST(), "FAST should not be indicated without e-data")
+	krberr.EData = []byte("krb5data")
+	_, err = krberr.MethodData()
+	assert.Error(t, err, "e-data that is not METHOD-DATA should be rejected")
+	assert.Nil(t, krberr.PreAuthTypes(), "there should be no PA types")
+}
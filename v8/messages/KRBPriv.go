@@ -6,9 +6,11 @@ import (
 
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
@@ -79,14 +81,23 @@ func (k *KRBPriv) Marshal() ([]byte, error) {
 	return b, nil
 }
 
+// Marshal the EncKrbPrivPart.
+func (k *EncKrbPrivPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return []byte{}, err
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncKrbPrivPart)
+	return b, nil
+}
+
 // EncryptEncPart encrypts the DecryptedEncPart within the KRBPriv.
 // Use to prepare for marshaling.
 func (k *KRBPriv) EncryptEncPart(key types.EncryptionKey) error {
-	b, err := asn1.Marshal(k.DecryptedEncPart)
+	b, err := k.DecryptedEncPart.Marshal()
 	if err != nil {
 		return err
 	}
-	b = asn1tools.AddASNAppTag(b, asnAppTag.EncKrbPrivPart)
 	k.EncPart, err = crypto.GetEncryptedData(b, key, keyusage.KRB_PRIV_ENCPART, 1)
 	if err != nil {
 		return err
@@ -98,11 +109,42 @@ func (k *KRBPriv) EncryptEncPart(key types.EncryptionKey) error {
 func (k *KRBPriv) DecryptEncPart(key types.EncryptionKey) error {
 	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.KRB_PRIV_ENCPART)
 	if err != nil {
-		return fmt.Errorf("error decrypting KRBPriv EncPart: %v", err)
+		return fmt.Errorf("error decrypting KRBPriv EncPart: %w", err)
 	}
 	err = k.DecryptedEncPart.Unmarshal(b)
 	if err != nil {
-		return fmt.Errorf("error unmarshaling encrypted part: %v", err)
+		return fmt.Errorf("error unmarshaling encrypted part: %w", err)
 	}
 	return nil
 }
+
+// Verify a KRB_PRIV received, RFC 4120 section 3.5.2, using the key and max acceptable clock skew duration. The
+// encrypted part is decrypted as part of this operation and its timestamp, if there is one, must be within the clock
+// skew and its addresses must match sAddr, the address of the sender, and rAddr, that of the recipient, when these
+// are known, that is have an address. The errors returned for invalid messages are KRBErrors with the error code of
+// RFC 4120.
+//
+// Replays and messages out of order are not detected; SafePrivContext checks the sequence numbers of the messages.
+func (k *KRBPriv) Verify(key types.EncryptionKey, d time.Duration, sAddr, rAddr types.HostAddress) (bool, error) {
+	return k.VerifyWithClock(key, d, sAddr, rAddr, clock.Real)
+}
+
+// VerifyWithClock verifies a KRB_PRIV as Verify does using the clock provided to check the clock skew with the sender.
+func (k *KRBPriv) VerifyWithClock(key types.EncryptionKey, d time.Duration, sAddr, rAddr types.HostAddress, c clock.Clock) (bool, error) {
+	if k.PVNO != iana.PVNO {
+		return false, NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_BADVERSION, fmt.Sprintf("protocol version %d not supported", k.PVNO))
+	}
+	if k.MsgType != msgtype.KRB_PRIV {
+		return false, NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_MSG_TYPE, fmt.Sprintf("message type %d not a KRB_PRIV", k.MsgType))
+	}
+	err := k.DecryptEncPart(key)
+	if err != nil {
+		return false, NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt KRB_PRIV encrypted part")
+	}
+	p := k.DecryptedEncPart
+	err = verifyProtectedData(p.Timestamp, p.Usec, p.SAddress, p.RAddress, d, sAddr, rAddr, c)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -2,11 +2,15 @@ package messages
 
 import (
 	"encoding/hex"
+	"errors"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -131,3 +135,53 @@ func TestKRBPriv_EncryptEncPart(t *testing.T) {
 		t.Fatalf("error encrypting encpart: %v", err)
 	}
 }
+
+func TestKRBPriv_Verify(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{
+		KeyType:  int32(18),
+		KeyValue: []byte("12345678901234567890123456789012"),
+	}
+	now := time.Date(2026, 10, 14, 9, 5, 1, 0, time.UTC)
+	sAddr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.1"))
+	rAddr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.2"))
+	p := NewKRBPriv(EncKrbPrivPart{
+		UserData:       []byte("application data"),
+		Timestamp:      now,
+		SequenceNumber: 7,
+		SAddress:       sAddr,
+	})
+	err := p.EncryptEncPart(key)
+	if err != nil {
+		t.Fatalf("error encrypting encpart: %v", err)
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBPriv: %v", err)
+	}
+	c := clock.NewFake(now)
+	var a KRBPriv
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	ok, err := a.VerifyWithClock(key, 5*time.Minute, sAddr, rAddr, c)
+	assert.NoError(t, err, "KRB_PRIV not verified")
+	assert.True(t, ok, "KRB_PRIV not valid")
+	assert.Equal(t, []byte("application data"), a.DecryptedEncPart.UserData, "user data not as expected")
+	assert.Equal(t, int64(7), a.DecryptedEncPart.SequenceNumber, "sequence number not as expected")
+
+	var krberr KRBError
+	_, err = a.VerifyWithClock(key, 5*time.Minute, rAddr, sAddr, c)
+	if assert.True(t, errors.As(err, &krberr), "error not a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KRB_AP_ERR_BADADDR, krberr.ErrorCode, "error code not as expected for the wrong sender")
+	}
+	wrongKey := types.EncryptionKey{
+		KeyType:  int32(18),
+		KeyValue: []byte("abcdefghijklmnopqrstuvwxyz123456"),
+	}
+	_, err = a.VerifyWithClock(wrongKey, 5*time.Minute, sAddr, rAddr, c)
+	if assert.True(t, errors.As(err, &krberr), "error not a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KRB_AP_ERR_BAD_INTEGRITY, krberr.ErrorCode, "error code not as expected for the wrong key")
+	}
+}
@@ -5,7 +5,13 @@ import (
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -41,3 +47,115 @@ func (s *KRBSafe) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// NewKRBSafe returns a new KRBSafe type for the body. Its checksum is set with GenerateChecksum.
+func NewKRBSafe(body KRBSafeBody) KRBSafe {
+	return KRBSafe{
+		PVNO:     iana.PVNO,
+		MsgType:  msgtype.KRB_SAFE,
+		SafeBody: body,
+	}
+}
+
+// Marshal the KRBSafe.
+func (s *KRBSafe) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*s)
+	if err != nil {
+		return []byte{}, err
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.KRBSafe)
+	return b, nil
+}
+
+// Marshal the KRBSafeBody. This is the encoding the checksum of the KRBSafe is calculated over.
+func (b *KRBSafeBody) Marshal() ([]byte, error) {
+	return asn1.Marshal(*b)
+}
+
+// GenerateChecksum sets the checksum of the KRBSafe over its body with the key, using the keyed checksum type of the
+// key's encryption type. Use to prepare for marshaling.
+func (s *KRBSafe) GenerateChecksum(key types.EncryptionKey) error {
+	b, err := s.SafeBody.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_SAFE body")
+	}
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "error getting etype for KRB_SAFE checksum")
+	}
+	cb, err := et.GetChecksumHash(key.KeyValue, b, keyusage.KRB_SAFE_CHKSUM)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "error calculating KRB_SAFE checksum")
+	}
+	s.Cksum = types.Checksum{
+		CksumType: et.GetHashID(),
+		Checksum:  cb,
+	}
+	return nil
+}
+
+// VerifyChecksum verifies the checksum of the KRBSafe with the key. The checksum must be of the keyed checksum type of
+// the key's encryption type, otherwise an error with the code KRB_AP_ERR_INAPP_CKSUM is returned.
+func (s *KRBSafe) VerifyChecksum(key types.EncryptionKey) (bool, error) {
+	et, err := crypto.GetChksumEtype(s.Cksum.CksumType)
+	if err != nil || et.GetETypeID() != key.KeyType {
+		return false, NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_INAPP_CKSUM,
+			fmt.Sprintf("checksum type %d not a keyed checksum of the key's encryption type %d", s.Cksum.CksumType, key.KeyType))
+	}
+	b, err := s.SafeBody.Marshal()
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_SAFE body")
+	}
+	return et.VerifyChecksum(key.KeyValue, b, s.Cksum.Checksum, keyusage.KRB_SAFE_CHKSUM), nil
+}
+
+// Verify a KRB_SAFE received, RFC 4120 section 3.4.2, using the key and max acceptable clock skew duration. The
+// checksum must be valid, the timestamp, if there is one, must be within the clock skew and the addresses of the
+// message must match sAddr, the address of the sender, and rAddr, that of the recipient, when these are known, that is
+// have an address. The errors returned for invalid messages are KRBErrors with the error code of RFC 4120.
+//
+// Replays and messages out of order are not detected; SafePrivContext checks the sequence numbers of the messages.
+func (s *KRBSafe) Verify(key types.EncryptionKey, d time.Duration, sAddr, rAddr types.HostAddress) (bool, error) {
+	return s.VerifyWithClock(key, d, sAddr, rAddr, clock.Real)
+}
+
+// VerifyWithClock verifies a KRB_SAFE as Verify does using the clock provided to check the clock skew with the sender.
+func (s *KRBSafe) VerifyWithClock(key types.EncryptionKey, d time.Duration, sAddr, rAddr types.HostAddress, c clock.Clock) (bool, error) {
+	if s.PVNO != iana.PVNO {
+		return false, NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_BADVERSION, fmt.Sprintf("protocol version %d not supported", s.PVNO))
+	}
+	if s.MsgType != msgtype.KRB_SAFE {
+		return false, NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_MSG_TYPE, fmt.Sprintf("message type %d not a KRB_SAFE", s.MsgType))
+	}
+	ok, err := s.VerifyChecksum(key)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_MODIFIED, "KRB_SAFE checksum invalid")
+	}
+	b := s.SafeBody
+	err = verifyProtectedData(b.Timestamp, b.Usec, b.SAddress, b.RAddress, d, sAddr, rAddr, c)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// verifyProtectedData checks the timestamp and addresses of a KRB_SAFE or KRB_PRIV received.
+func verifyProtectedData(ts time.Time, usec int, msgSAddr, msgRAddr types.HostAddress, d time.Duration, sAddr, rAddr types.HostAddress, c clock.Clock) error {
+	if len(sAddr.Address) > 0 && !msgSAddr.Equal(sAddr) {
+		return NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_BADADDR, "sender address does not match that of the message")
+	}
+	if len(rAddr.Address) > 0 && len(msgRAddr.Address) > 0 && !msgRAddr.Equal(rAddr) {
+		return NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_BADADDR, "recipient address does not match that of the message")
+	}
+	if !ts.IsZero() {
+		mt := ts.Add(time.Duration(usec) * time.Microsecond)
+		t := c.Now().UTC()
+		if t.Sub(mt) > d || mt.Sub(t) > d {
+			return NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_SKEW, fmt.Sprintf("clock skew with sender too large. greater than %v", d))
+		}
+	}
+	return nil
+}
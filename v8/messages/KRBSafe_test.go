@@ -2,13 +2,19 @@ package messages
 
 import (
 	"encoding/hex"
+	"errors"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -60,3 +66,84 @@ func TestUnmarshalKRBSafe_optionalsNULL(t *testing.T) {
 	assert.Equal(t, int32(1), a.Cksum.CksumType, "Checksum type not as expected")
 	assert.Equal(t, []byte("1234"), a.Cksum.Checksum, "Checksum not as expected")
 }
+
+func TestMarshalKRBSafe(t *testing.T) {
+	t.Parallel()
+	for _, v := range []string{testdata.MarshaledKRB5safe, testdata.MarshaledKRB5safeOptionalsNULL} {
+		var a KRBSafe
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			t.Fatalf("Test vector read error: %v", err)
+		}
+		err = a.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		mb, err := a.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling KRBSafe: %v", err)
+		}
+		assert.Equal(t, b, mb, "marshaled bytes not as expected")
+	}
+}
+
+func TestKRBSafe_Verify(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{
+		KeyType:  int32(18),
+		KeyValue: []byte("12345678901234567890123456789012"),
+	}
+	now := time.Date(2026, 10, 14, 9, 5, 1, 0, time.UTC)
+	sAddr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.1"))
+	rAddr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.2"))
+	s := NewKRBSafe(KRBSafeBody{
+		UserData:       []byte("application data"),
+		Timestamp:      now,
+		Usec:           1234,
+		SequenceNumber: 7,
+		SAddress:       sAddr,
+		RAddress:       rAddr,
+	})
+	err := s.GenerateChecksum(key)
+	if err != nil {
+		t.Fatalf("error generating checksum: %v", err)
+	}
+	b, err := s.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBSafe: %v", err)
+	}
+	var a KRBSafe
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	c := clock.NewFake(now.Add(time.Minute))
+	ok, err := a.VerifyWithClock(key, 5*time.Minute, sAddr, rAddr, c)
+	assert.NoError(t, err, "KRB_SAFE not verified")
+	assert.True(t, ok, "KRB_SAFE not valid")
+	ok, err = a.VerifyWithClock(key, 5*time.Minute, types.HostAddress{}, types.HostAddress{}, c)
+	assert.NoError(t, err, "KRB_SAFE not verified without known addresses")
+	assert.True(t, ok, "KRB_SAFE not valid without known addresses")
+
+	for _, test := range []struct {
+		name   string
+		modify func(s *KRBSafe)
+		sAddr  types.HostAddress
+		clock  clock.Clock
+		code   int32
+	}{
+		{"modified data", func(s *KRBSafe) { s.SafeBody.UserData = []byte("modified data") }, sAddr, c, errorcode.KRB_AP_ERR_MODIFIED},
+		{"unkeyed checksum", func(s *KRBSafe) { s.Cksum.CksumType = chksumtype.RSA_MD5 }, sAddr, c, errorcode.KRB_AP_ERR_INAPP_CKSUM},
+		{"wrong sender", func(s *KRBSafe) {}, rAddr, c, errorcode.KRB_AP_ERR_BADADDR},
+		{"clock skew", func(s *KRBSafe) {}, sAddr, clock.NewFake(now.Add(time.Hour)), errorcode.KRB_AP_ERR_SKEW},
+	} {
+		m := a
+		test.modify(&m)
+		ok, err := m.VerifyWithClock(key, 5*time.Minute, test.sAddr, rAddr, test.clock)
+		assert.False(t, ok, "%s should not be valid", test.name)
+		var krberr KRBError
+		if assert.True(t, errors.As(err, &krberr), "%s error not a KRBError: %v", test.name, err) {
+			assert.Equal(t, test.code, krberr.ErrorCode, "%s error code not as expected", test.name)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package messages
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+const (
+	// DefaultSafePrivClockSkew is the max acceptable clock skew of the KRB_SAFE and KRB_PRIV messages received by a
+	// SafePrivContext unless set with SetMaxClockSkew.
+	DefaultSafePrivClockSkew = 5 * time.Minute
+	maxSeqNumber             = 1<<32 - 1
+)
+
+// SafePrivContext protects the application data exchanged by the parties to an AP exchange outside of GSSAPI with
+// KRB_SAFE messages, RFC 4120 section 3.4, which protect its integrity, and KRB_PRIV messages, RFC 4120 section 3.5,
+// which also protect its confidentiality. The messages sent carry a timestamp, the next sequence number and the local
+// and remote addresses, and the messages received are verified as KRBSafe.Verify and KRBPriv.Verify do and, once
+// enabled with ExpectSequence, must have consecutive sequence numbers.
+// A SafePrivContext is safe for concurrent use.
+type SafePrivContext struct {
+	key        types.EncryptionKey
+	localAddr  types.HostAddress
+	remoteAddr types.HostAddress
+	sendSeq    int64
+	recvSeq    int64 // sequence number of the next message expected from the peer
+	checked    bool  // whether the sequence numbers of messages received are checked
+	maxSkew    time.Duration
+	clock      clock.Clock
+	mux        sync.Mutex
+}
+
+// NewSafePrivContext returns the context for the key of the AP exchange, the subkey of the AP_REP or of the
+// authenticator of the AP_REQ if there is one otherwise the ticket's session key. seqNum is the sequence number of the
+// first message sent, from the authenticator of the AP_REQ for the client or the AP_REP for the service. localAddr is
+// the sender address of the messages sent and remoteAddr the address of the peer, which is the recipient address of
+// the messages sent and must be the sender address of the messages received. An address without a value is not
+// included in the messages sent, nor checked in those received.
+func NewSafePrivContext(key types.EncryptionKey, seqNum int64, localAddr, remoteAddr types.HostAddress) *SafePrivContext {
+	return &SafePrivContext{
+		key:        key,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		sendSeq:    seqNum,
+		maxSkew:    DefaultSafePrivClockSkew,
+		clock:      clock.Real,
+	}
+}
+
+// ExpectSequence enables the detection of replayed and out of order messages from the peer, where seq is the sequence
+// number of the next message expected. It is the sequence number of the AP_REP for the client or of the authenticator
+// of the AP_REQ for the service. A message received with any other sequence number is rejected with an error with the
+// code KRB_AP_ERR_BADORDER.
+func (c *SafePrivContext) ExpectSequence(seq int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.recvSeq = seq
+	c.checked = true
+}
+
+// SetMaxClockSkew sets the max acceptable clock skew of the messages received.
+func (c *SafePrivContext) SetMaxClockSkew(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.maxSkew = d
+}
+
+// SetClock sets the clock used for the timestamps of the messages sent and to check the clock skew of those received.
+func (c *SafePrivContext) SetClock(clk clock.Clock) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.clock = clock.OrReal(clk)
+}
+
+// Safe returns the marshaled KRB_SAFE protecting the integrity of the data.
+func (c *SafePrivContext) Safe(data []byte) ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ts, usec := c.timestamp()
+	s := NewKRBSafe(KRBSafeBody{
+		UserData:       data,
+		Timestamp:      ts,
+		Usec:           usec,
+		SequenceNumber: c.sendSeq,
+		SAddress:       c.localAddr,
+		RAddress:       c.optionalRemoteAddr(),
+	})
+	err := s.GenerateChecksum(c.key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling KRB_SAFE: %w", err)
+	}
+	c.sendSeq = nextSeqNumber(c.sendSeq)
+	return b, nil
+}
+
+// Priv returns the marshaled KRB_PRIV protecting the integrity and confidentiality of the data.
+func (c *SafePrivContext) Priv(data []byte) ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ts, usec := c.timestamp()
+	p := NewKRBPriv(EncKrbPrivPart{
+		UserData:       data,
+		Timestamp:      ts,
+		Usec:           usec,
+		SequenceNumber: c.sendSeq,
+		SAddress:       c.localAddr,
+		RAddress:       c.optionalRemoteAddr(),
+	})
+	err := p.EncryptEncPart(c.key)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting KRB_PRIV: %w", err)
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling KRB_PRIV: %w", err)
+	}
+	c.sendSeq = nextSeqNumber(c.sendSeq)
+	return b, nil
+}
+
+// ReadSafe verifies the marshaled KRB_SAFE from the peer and returns its data.
+func (c *SafePrivContext) ReadSafe(b []byte) ([]byte, error) {
+	var s KRBSafe
+	err := s.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	_, err = s.VerifyWithClock(c.key, c.maxSkew, c.remoteAddr, c.localAddr, c.clock)
+	if err != nil {
+		return nil, err
+	}
+	err = c.received(s.SafeBody.SequenceNumber)
+	if err != nil {
+		return nil, err
+	}
+	return s.SafeBody.UserData, nil
+}
+
+// ReadPriv decrypts and verifies the marshaled KRB_PRIV from the peer and returns its data.
+func (c *SafePrivContext) ReadPriv(b []byte) ([]byte, error) {
+	var p KRBPriv
+	err := p.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	_, err = p.VerifyWithClock(c.key, c.maxSkew, c.remoteAddr, c.localAddr, c.clock)
+	if err != nil {
+		return nil, err
+	}
+	err = c.received(p.DecryptedEncPart.SequenceNumber)
+	if err != nil {
+		return nil, err
+	}
+	return p.DecryptedEncPart.UserData, nil
+}
+
+// timestamp returns the timestamp and microseconds of a message sent. The mutex must be held.
+func (c *SafePrivContext) timestamp() (time.Time, int) {
+	t := c.clock.Now().UTC()
+	return t.Truncate(time.Second), t.Nanosecond() / int(time.Microsecond)
+}
+
+// optionalRemoteAddr returns the recipient address of a message sent. The mutex must be held.
+func (c *SafePrivContext) optionalRemoteAddr() types.HostAddress {
+	if len(c.remoteAddr.Address) < 1 {
+		return types.HostAddress{}
+	}
+	return c.remoteAddr
+}
+
+// received checks the sequence number of a verified message from the peer, if enabled by ExpectSequence. The mutex
+// must be held.
+func (c *SafePrivContext) received(seq int64) error {
+	if !c.checked {
+		return nil
+	}
+	if seq != c.recvSeq {
+		return NewKRBError(types.PrincipalName{}, "", errorcode.KRB_AP_ERR_BADORDER, fmt.Sprintf("sequence number %d, expecting %d", seq, c.recvSeq))
+	}
+	c.recvSeq = nextSeqNumber(seq)
+	return nil
+}
+
+// nextSeqNumber returns the sequence number following seq, which wraps around as sequence numbers are 32 bit unsigned
+// integers, RFC 4120 section 5.3.
+func nextSeqNumber(seq int64) int64 {
+	if seq >= maxSeqNumber {
+		return 0
+	}
+	return seq + 1
+}
@@ -0,0 +1,88 @@
+package messages
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func safePrivContexts() (*SafePrivContext, *SafePrivContext) {
+	key := types.EncryptionKey{
+		KeyType:  int32(18),
+		KeyValue: []byte("12345678901234567890123456789012"),
+	}
+	cAddr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.1"))
+	sAddr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.2"))
+	client := NewSafePrivContext(key, 100, cAddr, sAddr)
+	client.ExpectSequence(200)
+	service := NewSafePrivContext(key, 200, sAddr, cAddr)
+	service.ExpectSequence(100)
+	return client, service
+}
+
+func TestSafePrivContext(t *testing.T) {
+	t.Parallel()
+	client, service := safePrivContexts()
+	for i := 0; i < 3; i++ {
+		b, err := client.Priv([]byte("request"))
+		if err != nil {
+			t.Fatalf("error creating KRB_PRIV: %v", err)
+		}
+		d, err := service.ReadPriv(b)
+		assert.NoError(t, err, "KRB_PRIV %d not read", i)
+		assert.Equal(t, []byte("request"), d, "KRB_PRIV data not as expected")
+		b, err = service.Safe([]byte("reply"))
+		if err != nil {
+			t.Fatalf("error creating KRB_SAFE: %v", err)
+		}
+		d, err = client.ReadSafe(b)
+		assert.NoError(t, err, "KRB_SAFE %d not read", i)
+		assert.Equal(t, []byte("reply"), d, "KRB_SAFE data not as expected")
+	}
+}
+
+func TestSafePrivContext_Replay(t *testing.T) {
+	t.Parallel()
+	client, service := safePrivContexts()
+	b, err := client.Safe([]byte("request"))
+	if err != nil {
+		t.Fatalf("error creating KRB_SAFE: %v", err)
+	}
+	_, err = service.ReadSafe(b)
+	assert.NoError(t, err, "KRB_SAFE not read")
+	_, err = service.ReadSafe(b)
+	var krberr KRBError
+	if assert.True(t, errors.As(err, &krberr), "error not a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KRB_AP_ERR_BADORDER, krberr.ErrorCode, "error code not as expected for a replay")
+	}
+}
+
+func TestSafePrivContext_ClockSkew(t *testing.T) {
+	t.Parallel()
+	client, service := safePrivContexts()
+	client.SetClock(clock.NewFake(time.Now().Add(-time.Hour)))
+	b, err := client.Priv([]byte("request"))
+	if err != nil {
+		t.Fatalf("error creating KRB_PRIV: %v", err)
+	}
+	_, err = service.ReadPriv(b)
+	var krberr KRBError
+	if assert.True(t, errors.As(err, &krberr), "error not a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KRB_AP_ERR_SKEW, krberr.ErrorCode, "error code not as expected for the clock skew")
+	}
+	service.SetMaxClockSkew(2 * time.Hour)
+	_, err = service.ReadPriv(b)
+	assert.NoError(t, err, "KRB_PRIV not read within the max clock skew")
+}
+
+func TestNextSeqNumber(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, int64(1), nextSeqNumber(0), "sequence number not as expected")
+	assert.Equal(t, int64(0), nextSeqNumber(maxSeqNumber), "sequence number does not wrap around")
+}
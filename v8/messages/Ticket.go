@@ -1,12 +1,14 @@
 package messages
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/adtype"
@@ -14,6 +16,7 @@ import (
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/internal/der"
 	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/pac"
@@ -99,18 +102,86 @@ func NewTicket(cname types.PrincipalName, crealm string, sname types.PrincipalNa
 
 // Unmarshal bytes b into a Ticket struct.
 func (t *Ticket) Unmarshal(b []byte) error {
+	p := der.Parser(b)
+	if readTicket(&p, t) {
+		return nil
+	}
 	_, err := asn1.UnmarshalWithParams(b, t, fmt.Sprintf("application,explicit,tag:%d", asnAppTag.Ticket))
 	return err
 }
 
-// Marshal the Ticket.
+// Marshal the Ticket. The DecryptedEncPart is not part of the encoding.
 func (t *Ticket) Marshal() ([]byte, error) {
-	b, err := asn1.Marshal(*t)
-	if err != nil {
-		return nil, err
+	db := der.NewBuilder()
+	defer db.Release()
+	addTicket(db, t)
+	return db.Bytes(), nil
+}
+
+// addTicket adds the DER of the ticket, wrapped in its application tag, to the builder.
+func addTicket(db *der.Builder, t *Ticket) {
+	m := db.Len()
+	e := db.Len()
+	db.AddEncryptedData(t.EncPart.EType, t.EncPart.KVNO, t.EncPart.Cipher)
+	db.Explicit(3, e)
+	e = db.Len()
+	db.AddPrincipalName(t.SName.NameType, t.SName.NameString)
+	db.Explicit(2, e)
+	e = db.Len()
+	db.AddGeneralString(t.Realm)
+	db.Explicit(1, e)
+	e = db.Len()
+	db.AddInteger(int64(t.TktVNO))
+	db.Explicit(0, e)
+	db.Sequence(m)
+	db.Wrap(asn1.ClassApplication, asnAppTag.Ticket, true, m)
+}
+
+// readTicket reads a ticket wrapped in its application tag into t. If the DER is not in the form expected false is
+// returned and t is not modified, so that the asn1 package can be used to unmarshal it instead.
+func readTicket(p *der.Parser, t *Ticket) bool {
+	a, ok := p.Read(asn1.ClassApplication, asnAppTag.Ticket, true)
+	if !ok {
+		return false
+	}
+	s, ok := a.Sequence()
+	if !ok || !a.Empty() {
+		return false
+	}
+	vno, ok := s.ExplicitInt(0)
+	if !ok {
+		return false
+	}
+	realm, ok := s.ExplicitGeneralString(1)
+	if !ok {
+		return false
+	}
+	c, ok := s.Explicit(2)
+	if !ok {
+		return false
+	}
+	nt, ns, ok := c.ReadPrincipalName()
+	if !ok || !c.Empty() {
+		return false
+	}
+	c, ok = s.Explicit(3)
+	if !ok {
+		return false
 	}
-	b = asn1tools.AddASNAppTag(b, asnAppTag.Ticket)
-	return b, nil
+	et, kvno, hasKVNO, cipher, ok := c.ReadEncryptedData()
+	if !ok || !c.Empty() || !s.Empty() {
+		return false
+	}
+	t.TktVNO = vno
+	t.Realm = realm
+	t.SName.NameType = nt
+	t.SName.NameString = ns
+	t.EncPart.EType = et
+	if hasKVNO {
+		t.EncPart.KVNO = kvno
+	}
+	t.EncPart.Cipher = cipher
+	return true
 }
 
 // Unmarshal bytes b into the EncTicketPart struct.
@@ -137,16 +208,15 @@ func unmarshalTicketsSequence(in asn1.RawValue) ([]Ticket, error) {
 	for p < (len(b)) {
 		_, err := asn1.UnmarshalWithParams(b[p:], &raw, fmt.Sprintf("application,tag:%d", asnAppTag.Ticket))
 		if err != nil {
-			return nil, fmt.Errorf("unmarshaling sequence of tickets failed getting length of ticket: %v", err)
+			return nil, fmt.Errorf("unmarshaling sequence of tickets failed getting length of ticket: %w", err)
 		}
 		t, err := unmarshalTicket(b[p:])
 		if err != nil {
-			return nil, fmt.Errorf("unmarshaling sequence of tickets failed: %v", err)
+			return nil, fmt.Errorf("unmarshaling sequence of tickets failed: %w", err)
 		}
 		p += len(raw.FullBytes)
 		tkts = append(tkts, t)
 	}
-	MarshalTicketSequence(tkts)
 	return tkts, nil
 }
 
@@ -186,34 +256,122 @@ func MarshalTicketSequence(tkts []Ticket) (asn1.RawValue, error) {
 // DecryptEncPart decrypts the encrypted part of the ticket.
 // The sname argument can be used to specify which service principal's key should be used to decrypt the ticket.
 // If nil is passed as the sname then the service principal specified within the ticket it used.
-func (t *Ticket) DecryptEncPart(keytab *keytab.Keytab, sname *types.PrincipalName) error {
+func (t *Ticket) DecryptEncPart(kt keytab.KeyProvider, sname *types.PrincipalName) error {
 	if sname == nil {
 		sname = &t.SName
 	}
-	key, _, err := keytab.GetEncryptionKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+	if hp, ok := kt.(keytab.KeyHandleProvider); ok {
+		h, err := hp.GetKeyHandle(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+		if err != nil {
+			return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key handle: %v", err))
+		}
+		return t.DecryptWithKeyHandle(h)
+	}
+	keys, err := ticketKeys(kt, *sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
 	if err != nil {
 		return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
 	}
-	return t.Decrypt(key)
+	if len(keys) == 1 {
+		return t.Decrypt(keys[0])
+	}
+	return t.decryptCandidates(keys)
+}
+
+// ticketKeys returns the keys that may be used to decrypt a ticket for the service principal.
+// If the KeyProvider is a keytab.CandidateKeyProvider all the candidate keys are returned.
+func ticketKeys(kt keytab.KeyProvider, sname types.PrincipalName, realm string, kvno int, etype int32) ([]types.EncryptionKey, error) {
+	if ckp, ok := kt.(keytab.CandidateKeyProvider); ok {
+		return ckp.GetEncryptionKeyCandidates(sname, realm, kvno, etype)
+	}
+	key, _, err := kt.GetEncryptionKey(sname, realm, kvno, etype)
+	if err != nil {
+		return nil, err
+	}
+	return []types.EncryptionKey{key}, nil
+}
+
+// decryptCandidates tries to decrypt the encrypted part of the ticket with each of the keys concurrently.
+// Once a key succeeds the trials that have not yet started are cancelled. If all the keys fail the error for the
+// first key, the most preferred, is returned.
+func (t *Ticket) decryptCandidates(keys []types.EncryptionKey) error {
+	type result struct {
+		i    int
+		denc EncTicketPart
+		err  error
+	}
+	done := make(chan struct{})
+	defer close(done)
+	results := make(chan result, len(keys))
+	for i, key := range keys {
+		go func(i int, key types.EncryptionKey) {
+			select {
+			case <-done:
+				results <- result{i: i, err: errors.New("cancelled")}
+				return
+			default:
+			}
+			var r result
+			r.i = i
+			r.denc, r.err = decryptEncTicketPart(t.EncPart, key)
+			results <- r
+		}(i, key)
+	}
+	errs := make([]error, len(keys))
+	for range keys {
+		r := <-results
+		if r.err == nil {
+			t.DecryptedEncPart = r.denc
+			return nil
+		}
+		errs[r.i] = r.err
+	}
+	return errs[0]
+}
+
+// decryptEncTicketPart decrypts and unmarshals the encrypted part of a ticket using the key provided.
+func decryptEncTicketPart(ed types.EncryptedData, key types.EncryptionKey) (EncTicketPart, error) {
+	var denc EncTicketPart
+	b, err := crypto.DecryptEncPart(ed, key, keyusage.KDC_REP_TICKET)
+	if err != nil {
+		return denc, fmt.Errorf("error decrypting Ticket EncPart: %w", err)
+	}
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return denc, fmt.Errorf("error unmarshaling encrypted part: %w", err)
+	}
+	return denc, nil
 }
 
 // Decrypt decrypts the encrypted part of the ticket using the key provided.
 func (t *Ticket) Decrypt(key types.EncryptionKey) error {
-	b, err := crypto.DecryptEncPart(t.EncPart, key, keyusage.KDC_REP_TICKET)
+	denc, err := decryptEncTicketPart(t.EncPart, key)
 	if err != nil {
-		return fmt.Errorf("error decrypting Ticket EncPart: %v", err)
+		return err
+	}
+	t.DecryptedEncPart = denc
+	return nil
+}
+
+// DecryptWithKeyHandle decrypts the encrypted part of the ticket using the key handle provided.
+func (t *Ticket) DecryptWithKeyHandle(h keytab.KeyHandle) error {
+	if h.KeyType() != t.EncPart.EType {
+		return fmt.Errorf("error decrypting Ticket EncPart: key handle etype %d does not match the ticket's etype %d", h.KeyType(), t.EncPart.EType)
+	}
+	b, err := h.Decrypt(t.EncPart.Cipher, keyusage.KDC_REP_TICKET)
+	if err != nil {
+		return fmt.Errorf("error decrypting Ticket EncPart: %w", err)
 	}
 	var denc EncTicketPart
 	err = denc.Unmarshal(b)
 	if err != nil {
-		return fmt.Errorf("error unmarshaling encrypted part: %v", err)
+		return fmt.Errorf("error unmarshaling encrypted part: %w", err)
 	}
 	t.DecryptedEncPart = denc
 	return nil
 }
 
 // GetPACType returns a Microsoft PAC that has been extracted from the ticket and processed.
-func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l *log.Logger) (bool, pac.PACType, error) {
+func (t *Ticket) GetPACType(kt keytab.KeyProvider, sname *types.PrincipalName, l *log.Logger) (bool, pac.PACType, error) {
 	var isPAC bool
 	for _, ad := range t.DecryptedEncPart.AuthorizationData {
 		if ad.ADType == adtype.ADIfRelevant {
@@ -223,22 +381,52 @@ func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l
 				l.Printf("PAC authorization data could not be unmarshaled: %v", err)
 				continue
 			}
-			if ad2[0].ADType == adtype.ADWin2KPAC {
+			// The AD-IF-RELEVANT element may contain other authorization data before the PAC,
+			// for example FreeIPA authentication indicators, so check all the entries.
+			for _, e := range ad2 {
+				if e.ADType != adtype.ADWin2KPAC {
+					continue
+				}
 				isPAC = true
 				var p pac.PACType
-				err = p.Unmarshal(ad2[0].ADData)
+				err = p.Unmarshal(e.ADData)
 				if err != nil {
-					return isPAC, p, fmt.Errorf("error unmarshaling PAC: %v", err)
+					return isPAC, p, fmt.Errorf("error unmarshaling PAC: %w", err)
 				}
 				if sname == nil {
 					sname = &t.SName
 				}
-				key, _, err := keytab.GetEncryptionKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+				if hp, ok := kt.(keytab.KeyHandleProvider); ok {
+					h, err := hp.GetKeyHandle(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+					if err != nil {
+						return isPAC, p, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key handle: %v", err))
+					}
+					return isPAC, p, p.ProcessPACInfoBuffersWithKeyHandle(h, l)
+				}
+				keys, err := ticketKeys(kt, *sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
 				if err != nil {
 					return isPAC, p, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
 				}
-				err = p.ProcessPACInfoBuffers(key, l)
-				return isPAC, p, err
+				// The server signature is verified with the key that decrypted the ticket which, when there are
+				// several candidates, is not known here so each is tried in order of preference.
+				var perr error
+				for i, key := range keys {
+					pk := p
+					if i > 0 {
+						pk = pac.PACType{}
+						if err := pk.Unmarshal(e.ADData); err != nil {
+							return isPAC, p, fmt.Errorf("error unmarshaling PAC: %w", err)
+						}
+					}
+					err := pk.ProcessPACInfoBuffers(key, l)
+					if err == nil {
+						return isPAC, pk, nil
+					}
+					if i == 0 {
+						perr = err
+					}
+				}
+				return isPAC, p, perr
 			}
 		}
 	}
@@ -247,8 +435,14 @@ func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l
 
 // Valid checks it the ticket is currently valid. Max duration passed endtime passed in as argument.
 func (t *Ticket) Valid(d time.Duration) (bool, error) {
+	return t.ValidWithClock(d, clock.Real)
+}
+
+// ValidWithClock checks if the ticket is valid at the current time of the clock provided. Max duration passed endtime
+// passed in as argument.
+func (t *Ticket) ValidWithClock(d time.Duration, c clock.Clock) (bool, error) {
 	// Check for future tickets or invalid tickets
-	time := time.Now().UTC()
+	time := c.Now().UTC()
 	if t.DecryptedEncPart.StartTime.Sub(time) > d || types.IsFlagSet(&t.DecryptedEncPart.Flags, flags.Invalid) {
 		return false, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_TKT_NYV, "service ticket provided is not yet valid")
 	}
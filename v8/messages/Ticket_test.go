@@ -8,9 +8,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
 	"github.com/jcmturner/gokrb5/v8/iana/adtype"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/iana/trtype"
 	"github.com/jcmturner/gokrb5/v8/keytab"
@@ -122,6 +127,57 @@ func TestMarshalTicket(t *testing.T) {
 	assert.Equal(t, b, mb, "Marshalled bytes not as expected")
 }
 
+// aliasKeyProvider returns the candidate keys of the principal for any of its aliases.
+type aliasKeyProvider struct {
+	*keytab.Keytab
+	princName types.PrincipalName
+}
+
+func (p aliasKeyProvider) GetEncryptionKeyCandidates(princName types.PrincipalName, realm string, kvno int, etype int32) ([]types.EncryptionKey, error) {
+	return p.Keytab.GetEncryptionKeyCandidates(p.princName, realm, kvno, etype)
+}
+
+func TestTicket_DecryptEncPart_Candidates(t *testing.T) {
+	t.Parallel()
+	kt := keytab.New()
+	for i, p := range []string{"kvno1", "kvno2", "kvno3"} {
+		kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", p, time.Unix(int64(100*(i+1)), 0), uint8(i+1), 18)
+	}
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	now := time.Now().UTC()
+	tkt, _, err := NewTicket(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"), "TEST.GOKRB5",
+		sname, "TEST.GOKRB5", types.NewKrbFlags(), kt, 18, 2, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating ticket: %v", err)
+	}
+	// Key versions above 255 are truncated in keytabs that only hold the 8 bit kvno
+	tkt.EncPart.KVNO = 258
+	single := keytab.KeyProviderFunc(kt.GetEncryptionKey)
+	err = tkt.DecryptEncPart(single, nil)
+	assert.Error(t, err, "ticket should not decrypt without trying the candidate keys")
+	err = tkt.DecryptEncPart(kt, nil)
+	if err != nil {
+		t.Fatalf("error decrypting ticket with candidate keys: %v", err)
+	}
+	assert.Equal(t, "testuser1", tkt.DecryptedEncPart.CName.PrincipalNameString(), "decrypted ticket not as expected")
+
+	// Ticket issued for an alias of the principal whose keys are provided by a CandidateKeyProvider
+	tkt.SName = types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/alias.test.gokrb5")
+	tkt.DecryptedEncPart = EncTicketPart{}
+	err = tkt.DecryptEncPart(aliasKeyProvider{kt, sname}, nil)
+	if err != nil {
+		t.Fatalf("error decrypting ticket for alias: %v", err)
+	}
+	assert.Equal(t, "testuser1", tkt.DecryptedEncPart.CName.PrincipalNameString(), "decrypted ticket not as expected")
+
+	// None of the candidates can decrypt the ticket
+	other := keytab.New()
+	other.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "other1", time.Unix(100, 0), 1, 18)
+	other.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "other2", time.Unix(200, 0), 2, 18)
+	err = tkt.DecryptEncPart(other, &sname)
+	assert.Error(t, err, "ticket should not decrypt with the wrong keys")
+}
+
 func TestAuthorizationData_GetPACType_GOKRB5TestData(t *testing.T) {
 	t.Parallel()
 	b, err := hex.DecodeString(testdata.MarshaledPAC_AuthorizationData_GOKRB5)
@@ -164,3 +220,193 @@ func TestAuthorizationData_GetPACType_GOKRB5TestData(t *testing.T) {
 	assert.NotNil(t, pac.KDCChecksum, "PAC KDC Checksum info is nil")
 	assert.NotNil(t, pac.ServerChecksum, "PAC Server checksum info is nil")
 }
+
+func TestAuthorizationData_GetPACType_AuthIndicator(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_AuthorizationData_GOKRB5)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	var a types.AuthorizationData
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	var ifRelevant types.AuthorizationData
+	err = ifRelevant.Unmarshal(a[0].ADData)
+	if err != nil {
+		t.Fatalf("Error unmarshaling AD-IF-RELEVANT test data: %v", err)
+	}
+	// Put an authentication indicator before the PAC as FreeIPA KDCs can and add an empty AD-IF-RELEVANT element.
+	ind, _ := asn1.Marshal([]string{"otp"})
+	ifRelevant = append(types.AuthorizationData{{ADType: adtype.ADAuthenticationIndicator, ADData: ind}}, ifRelevant...)
+	irb, err := asn1.Marshal(ifRelevant)
+	if err != nil {
+		t.Fatalf("Error marshaling AD-IF-RELEVANT: %v", err)
+	}
+	empty, _ := asn1.Marshal(types.AuthorizationData{})
+	tkt := Ticket{
+		Realm: "TEST.GOKRB5",
+		EncPart: types.EncryptedData{
+			EType: 18,
+			KVNO:  2,
+		},
+		DecryptedEncPart: EncTicketPart{
+			AuthorizationData: types.AuthorizationData{
+				{ADType: adtype.ADIfRelevant, ADData: empty},
+				{ADType: adtype.ADIfRelevant, ADData: irb},
+			},
+		},
+	}
+	b, _ = hex.DecodeString(testdata.KEYTAB_SYSHTTP_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	sname := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"sysHTTP"}}
+	w := bytes.NewBufferString("")
+	l := log.New(w, "", 0)
+	isPAC, pac, err := tkt.GetPACType(kt, &sname, l)
+	if err != nil {
+		t.Log(w.String())
+		t.Errorf("error getting PAC: %v", err)
+	}
+	assert.True(t, isPAC, "PAC should be present")
+	assert.NotNil(t, pac.KerbValidationInfo, "PAC Kerb Validation info is nil")
+}
+
+func TestTicket_ValidWithClock(t *testing.T) {
+	t.Parallel()
+	st := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tkt := Ticket{
+		SName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5"),
+		Realm: "TEST.GOKRB5",
+		DecryptedEncPart: EncTicketPart{
+			Flags:     types.NewKrbFlags(),
+			StartTime: st,
+			EndTime:   st.Add(time.Hour),
+		},
+	}
+	c := clock.NewFake(st.Add(time.Minute))
+	ok, err := tkt.ValidWithClock(time.Minute, c)
+	assert.True(t, ok, "ticket should be valid: %v", err)
+
+	c.Set(st.Add(-time.Hour))
+	ok, err = tkt.ValidWithClock(time.Minute, c)
+	assert.False(t, ok, "ticket should not yet be valid")
+	if assert.IsType(t, KRBError{}, err, "error should be a KRBError") {
+		assert.Equal(t, errorcode.KRB_AP_ERR_TKT_NYV, err.(KRBError).ErrorCode, "error code not as expected")
+	}
+
+	c.Set(st.Add(2 * time.Hour))
+	ok, err = tkt.ValidWithClock(time.Minute, c)
+	assert.False(t, ok, "ticket should have expired")
+	if assert.IsType(t, KRBError{}, err, "error should be a KRBError") {
+		assert.Equal(t, errorcode.KRB_AP_ERR_TKT_EXPIRED, err.(KRBError).ErrorCode, "error code not as expected")
+	}
+}
+
+func BenchmarkTicket_Marshal(b *testing.B) {
+	var a Ticket
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5ticket)
+	err := a.Unmarshal(v)
+	if err != nil {
+		b.Fatalf("Unmarshal error: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := a.Marshal()
+		if err != nil {
+			b.Fatalf("Marshal error: %v", err)
+		}
+	}
+}
+
+func BenchmarkTicket_Unmarshal(b *testing.B) {
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5ticket)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var a Ticket
+		err := a.Unmarshal(v)
+		if err != nil {
+			b.Fatalf("Unmarshal error: %v", err)
+		}
+	}
+}
+
+func TestTicket_MarshalAsASN1(t *testing.T) {
+	t.Parallel()
+	for _, tkt := range []Ticket{
+		{},
+		{
+			TktVNO:  iana.PVNO,
+			Realm:   "TEST.GOKRB5",
+			SName:   types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", "TEST.GOKRB5"}},
+			EncPart: types.EncryptedData{EType: 18, KVNO: 2, Cipher: make([]byte, 1200)},
+		},
+		{
+			Realm:   "TEST.GOKRB5",
+			SName:   types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{}},
+			EncPart: types.EncryptedData{EType: 23, Cipher: []byte{}},
+		},
+	} {
+		b, err := asn1.Marshal(tkt)
+		if err != nil {
+			t.Fatalf("error marshaling with asn1: %v", err)
+		}
+		want := asn1tools.AddASNAppTag(b, asnAppTag.Ticket)
+		b, err = tkt.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		assert.Equal(t, want, b, "encoding not as the asn1 package's")
+		var u, ua Ticket
+		err = u.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		_, err = asn1.UnmarshalWithParams(b, &ua, fmt.Sprintf("application,explicit,tag:%d", asnAppTag.Ticket))
+		if err != nil {
+			t.Fatalf("error unmarshaling with asn1: %v", err)
+		}
+		assert.Equal(t, ua, u, "unmarshaled ticket not as the asn1 package's")
+	}
+}
+
+func TestTicket_MarshalExcludesDecryptedEncPart(t *testing.T) {
+	t.Parallel()
+	var tkt Ticket
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5ticket)
+	err := tkt.Unmarshal(v)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	tkt.DecryptedEncPart.CRealm = "TEST.GOKRB5"
+	b, err := tkt.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	assert.Equal(t, v, b, "decrypted part of the ticket should not be marshaled")
+}
+
+func TestTicket_UnmarshalNotDER(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		name string
+		hex  string
+	}{
+		// The realm is a UTF8String rather than a GeneralString, which the asn1 package accepts.
+		{"realm type", "615C305AA003020105A1100C0E415448454E412E4D49542E454455A21A3018A003020101A111300F1B066866" +
+			"747361691B056578747261A3253023A003020100A103020105A21704156B726241534E2E312074657374206D657373616765"},
+		{"truncated", "615C305AA003020105A1101B0E415448454E412E4D49542E454455A21A3018A003020101A111300F1B066866"},
+		{"application tag", "625C305AA003020105A1101B0E415448454E412E4D49542E454455A21A3018A003020101A111300F1B066866" +
+			"747361691B056578747261A3253023A003020100A103020105A21704156B726241534E2E312074657374206D657373616765"},
+	} {
+		b, _ := hex.DecodeString(test.hex)
+		var u, ua Ticket
+		_, erra := asn1.UnmarshalWithParams(b, &ua, fmt.Sprintf("application,explicit,tag:%d", asnAppTag.Ticket))
+		err := u.Unmarshal(b)
+		assert.Equal(t, erra, err, "%s: error not as the asn1 package's", test.name)
+		assert.Equal(t, ua, u, "%s: unmarshaled ticket not as the asn1 package's", test.name)
+	}
+}
@@ -0,0 +1,107 @@
+package messages
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Summary returns a one line description of the marshaled Kerberos message, such as its type, principals and
+// encryption types, for troubleshooting. Encrypted parts of the message are not described.
+func Summary(b []byte) string {
+	if len(b) < 1 || b[0]&0xe0 != 0x60 {
+		return "unrecognised message"
+	}
+	switch int(b[0] & 0x1f) {
+	case asnAppTag.ASREQ:
+		var m ASReq
+		if err := m.Unmarshal(b); err != nil {
+			return fmt.Sprintf("AS-REQ (%v)", err)
+		}
+		return "AS-REQ " + kdcReqSummary(m.KDCReqFields)
+	case asnAppTag.TGSREQ:
+		var m TGSReq
+		if err := m.Unmarshal(b); err != nil {
+			return fmt.Sprintf("TGS-REQ (%v)", err)
+		}
+		return "TGS-REQ " + kdcReqSummary(m.KDCReqFields)
+	case asnAppTag.ASREP:
+		var m ASRep
+		if err := m.Unmarshal(b); err != nil {
+			return fmt.Sprintf("AS-REP (%v)", err)
+		}
+		return "AS-REP " + kdcRepSummary(m.KDCRepFields)
+	case asnAppTag.TGSREP:
+		var m TGSRep
+		if err := m.Unmarshal(b); err != nil {
+			return fmt.Sprintf("TGS-REP (%v)", err)
+		}
+		return "TGS-REP " + kdcRepSummary(m.KDCRepFields)
+	case asnAppTag.APREQ:
+		var m APReq
+		if err := m.Unmarshal(b); err != nil {
+			return fmt.Sprintf("AP-REQ (%v)", err)
+		}
+		return fmt.Sprintf("AP-REQ sname=%s realm=%s ticket-etype=%d ticket-kvno=%d authenticator-etype=%d",
+			m.Ticket.SName.PrincipalNameString(), m.Ticket.Realm, m.Ticket.EncPart.EType, m.Ticket.EncPart.KVNO, m.EncryptedAuthenticator.EType)
+	case asnAppTag.APREP:
+		var m APRep
+		if err := m.Unmarshal(b); err != nil {
+			return fmt.Sprintf("AP-REP (%v)", err)
+		}
+		return fmt.Sprintf("AP-REP etype=%d", m.EncPart.EType)
+	case asnAppTag.KRBError:
+		var m KRBError
+		if err := m.Unmarshal(b); err != nil {
+			return fmt.Sprintf("KRB-ERROR (%v)", err)
+		}
+		return fmt.Sprintf("KRB-ERROR %s etext=%q sname=%s realm=%s",
+			errorcode.Lookup(m.ErrorCode), m.EText, m.SName.PrincipalNameString(), m.Realm)
+	case asnAppTag.KRBSafe:
+		return "KRB-SAFE"
+	case asnAppTag.KRBPriv:
+		return "KRB-PRIV"
+	case asnAppTag.KRBCred:
+		return "KRB-CRED"
+	}
+	return fmt.Sprintf("unrecognised message, application tag %d", b[0]&0x1f)
+}
+
+func kdcReqSummary(m KDCReqFields) string {
+	return fmt.Sprintf("cname=%s realm=%s sname=%s etypes=%v padata=%s",
+		m.ReqBody.CName.PrincipalNameString(), m.ReqBody.Realm, m.ReqBody.SName.PrincipalNameString(), m.ReqBody.EType, paDataTypes(m.PAData))
+}
+
+func kdcRepSummary(m KDCRepFields) string {
+	return fmt.Sprintf("cname=%s crealm=%s sname=%s ticket-etype=%d ticket-kvno=%d enc-part-etype=%d padata=%s",
+		m.CName.PrincipalNameString(), m.CRealm, m.Ticket.SName.PrincipalNameString(), m.Ticket.EncPart.EType, m.Ticket.EncPart.KVNO, m.EncPart.EType, paDataTypes(m.PAData))
+}
+
+func paDataTypes(pas types.PADataSequence) string {
+	s := make([]string, len(pas))
+	for i, pa := range pas {
+		s[i] = fmt.Sprintf("%d", pa.PADataType)
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+// WriteDump writes the header provided followed by the Summary, the base64 encoding and a hex dump of the marshaled
+// Kerberos message to w. The base64 encoding can be decoded with the inspect package or the krbdecode command.
+//
+// The dump is written with a single call to w so that dumps written concurrently are not interleaved.
+// Note that the dump of a message is not redacted and messages such as AS-REQs using encrypted timestamp
+// pre-authentication can be used in offline attacks on the password, so dumps should be handled with care.
+func WriteDump(w io.Writer, header string, b []byte) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%d bytes): %s\n", header, len(b), Summary(b))
+	fmt.Fprintf(&sb, "base64: %s\n", base64.StdEncoding.EncodeToString(b))
+	sb.WriteString(hex.Dump(b))
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,51 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummary(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		msg    string
+		prefix string
+	}{
+		{testdata.MarshaledKRB5as_req, "AS-REQ cname=hftsai/extra realm=ATHENA.MIT.EDU sname=hftsai/extra etypes=[0 1] padata=[13 13]"},
+		{testdata.MarshaledKRB5tgs_rep, "TGS-REP cname=hftsai/extra crealm=ATHENA.MIT.EDU sname=hftsai/extra"},
+		{testdata.MarshaledKRB5ap_req, "AP-REQ sname=hftsai/extra realm=ATHENA.MIT.EDU"},
+		{testdata.MarshaledKRB5error, "KRB-ERROR (60) KRB_ERR_GENERIC"},
+	}
+	for _, test := range tests {
+		b, err := hex.DecodeString(test.msg)
+		if err != nil {
+			t.Fatalf("Test vector read error: %v", err)
+		}
+		s := Summary(b)
+		assert.True(t, strings.HasPrefix(s, test.prefix), "summary not as expected: %s", s)
+	}
+	assert.Equal(t, "unrecognised message", Summary([]byte{0x30, 0x00}), "summary of unrecognised message not as expected")
+}
+
+func TestWriteDump(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledKRB5error)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	var buf bytes.Buffer
+	err = WriteDump(&buf, "--> sent", b)
+	if err != nil {
+		t.Fatalf("error writing dump: %v", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "--> sent (189 bytes): "+Summary(b), lines[0], "header line not as expected")
+	assert.Equal(t, "base64: "+base64.StdEncoding.EncodeToString(b), lines[1], "base64 line not as expected")
+	assert.Equal(t, hex.Dump(b), strings.Join(lines[2:], "\n"), "hex dump not as expected")
+}
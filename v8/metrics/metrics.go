@@ -0,0 +1,108 @@
+// Package metrics provides hooks reporting the AS and TGS exchanges, the requests to each KDC, the ticket cache
+// lookups and the ticket renewals of a client, from which counters and histograms can be maintained in a metrics
+// system such as Prometheus:
+//
+//	cl := client.NewWithKeytab("user", "EXAMPLE.COM", kt, cfg, client.Metrics(metrics.Hooks{
+//		Exchange: func(e metrics.Exchange) {
+//			exchanges.WithLabelValues(string(e.Type), e.Realm, metrics.Result(e.Err)).Observe(e.Duration.Seconds())
+//		},
+//	}))
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/krberror"
+)
+
+// ExchangeType is the type of an exchange with the KDCs.
+type ExchangeType string
+
+// Exchange types.
+const (
+	// AS is the type of the AS exchanges that obtain TGTs.
+	AS ExchangeType = "AS"
+	// TGS is the type of the TGS exchanges that obtain service tickets, referrals and renewed TGTs.
+	TGS ExchangeType = "TGS"
+)
+
+// Exchange reports an AS_REQ or TGS_REQ sent to the KDCs of a realm and the KDC's reply, including any retries of the
+// KDCs of the realm that did not respond.
+type Exchange struct {
+	Type     ExchangeType
+	Realm    string
+	Duration time.Duration
+	// Err is the error of the exchange, which is a KRB_ERROR if the KDC rejected the request.
+	Err error
+	// ErrorCode is the error code of the KRB_ERROR the KDC replied with, or zero.
+	ErrorCode int32
+	// CorrelationID of the client's authentication attempt, if it has one.
+	CorrelationID string
+}
+
+// KDCRequest reports an attempt to exchange a message with one of the KDCs of a realm.
+type KDCRequest struct {
+	Realm string
+	// KDC is the address of the KDC.
+	KDC string
+	// Transport is the protocol used, "UDP" or "TCP".
+	Transport string
+	Duration  time.Duration
+	// Err is the error of communicating with the KDC, or nil if it replied.
+	Err error
+	// CorrelationID of the client's authentication attempt, if it has one.
+	CorrelationID string
+}
+
+// CacheLookup reports a lookup of the client's ticket cache for a service ticket.
+type CacheLookup struct {
+	SPN string
+	// Hit indicates if a valid ticket was found in the cache.
+	Hit bool
+}
+
+// Renewal reports the renewal of a TGT session or, in the background, of a cached service ticket.
+type Renewal struct {
+	// SPN is the name of the ticket renewed, krbtgt/REALM for a TGT.
+	SPN      string
+	Realm    string
+	Duration time.Duration
+	Err      error
+}
+
+// Hooks are the functions called with the events of a client. Any of them may be nil. They are called synchronously
+// on the goroutine performing the exchange, including the client's renewal goroutines, so must be safe for concurrent
+// use and should not block.
+type Hooks struct {
+	Exchange    func(Exchange)
+	KDCRequest  func(KDCRequest)
+	CacheLookup func(CacheLookup)
+	Renewal     func(Renewal)
+}
+
+// Results of exchanges returned by Result.
+const (
+	ResultOK          = "ok"
+	ResultKRBError    = "krb_error"
+	ResultUnreachable = "unreachable"
+	ResultCanceled    = "canceled"
+	ResultError       = "error"
+)
+
+// Result returns a label of the outcome of the error of an event, of few enough values to be used as a metric's label.
+func Result(err error) string {
+	switch {
+	case err == nil:
+		return ResultOK
+	case errors.Is(err, krberror.ErrKDCUnreachable):
+		return ResultUnreachable
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ResultCanceled
+	}
+	if _, ok := krberror.ErrorCode(err); ok {
+		return ResultKRBError
+	}
+	return ResultError
+}
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResult(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		err    error
+		result string
+	}{
+		{nil, ResultOK},
+		{fmt.Errorf("login failed: %w", krberror.ErrPreAuthFailed), ResultKRBError},
+		{krberror.Code(errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN), ResultKRBError},
+		{krberror.KDCUnreachable(errors.New("connection refused")), ResultUnreachable},
+		{fmt.Errorf("exchange abandoned: %w", context.DeadlineExceeded), ResultCanceled},
+		{context.Canceled, ResultCanceled},
+		{errors.New("malformed reply"), ResultError},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.result, Result(test.err), "result of %v not as expected", test.err)
+	}
+}
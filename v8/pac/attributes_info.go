@@ -0,0 +1,58 @@
+package pac
+
+import (
+	"errors"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+// AttributesInfo implements the PAC_ATTRIBUTES_INFO, [MS-PAC] section 2.14, added by the November 2021 Windows
+// updates to record whether the client requested the PAC.
+type AttributesInfo struct {
+	FlagsLength uint32   // An unsigned 32-bit integer in little-endian format that specifies the number of bits of the Flags that are defined.
+	Flags       []uint32 // The attribute flags, of which the PAC_WAS_REQUESTED and PAC_WAS_GIVEN_IMPLICITLY bits are defined.
+}
+
+const (
+	pacWasRequested       uint32 = 0x00000001 // The client requested the PAC with the PA-PAC-REQUEST pre-authentication data.
+	pacWasGivenImplicitly uint32 = 0x00000002 // The client did not request the PAC but the KDC included it by default.
+)
+
+// Unmarshal bytes into the AttributesInfo struct
+func (k *AttributesInfo) Unmarshal(b []byte) (err error) {
+	//The PAC_ATTRIBUTES_INFO structure is a simple structure that is not NDR-encoded.
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	r := mstypes.NewReader(buf.reader())
+	k.FlagsLength, err = r.Uint32()
+	if err != nil {
+		return
+	}
+	n := (uint64(k.FlagsLength) + 31) / 32
+	if n > uint64(len(b)-4)/4 {
+		return errors.New("PAC_ATTRIBUTES_INFO flags exceed the length of the buffer")
+	}
+	k.Flags = make([]uint32, n)
+	for i := range k.Flags {
+		k.Flags[i], err = r.Uint32()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// PACWasRequested indicates if the client explicitly requested the PAC.
+func (k *AttributesInfo) PACWasRequested() bool {
+	return k.flag(pacWasRequested)
+}
+
+// PACWasGivenImplicitly indicates if the KDC included the PAC without the client requesting it.
+func (k *AttributesInfo) PACWasGivenImplicitly() bool {
+	return k.flag(pacWasGivenImplicitly)
+}
+
+// flag indicates if the flag of the first 32 bits is set.
+func (k *AttributesInfo) flag(f uint32) bool {
+	return len(k.Flags) > 0 && k.Flags[0]&f != 0
+}
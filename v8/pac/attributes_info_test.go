@@ -0,0 +1,22 @@
+package pac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttributesInfo_Unmarshal(t *testing.T) {
+	t.Parallel()
+	var k AttributesInfo
+	err := k.Unmarshal([]byte{0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00})
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	assert.Equal(t, uint32(2), k.FlagsLength, "flags length not as expected")
+	assert.True(t, k.PACWasRequested(), "PAC should have been requested")
+	assert.False(t, k.PACWasGivenImplicitly(), "PAC should not have been given implicitly")
+
+	err = k.Unmarshal([]byte{0xff, 0xff, 0xff, 0xff, 0x01, 0x00, 0x00, 0x00})
+	assert.Error(t, err, "flags exceeding the buffer should be rejected")
+}
@@ -0,0 +1,411 @@
+package pac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+// DefaultPrimaryGroupID is the relative ID of the Domain Users group, the primary group of a Builder's user if none
+// is specified.
+const DefaultPrimaryGroupID uint32 = 513
+
+// groupAttributes are the attributes of the groups in the PAC: SE_GROUP_MANDATORY, SE_GROUP_ENABLED_BY_DEFAULT and
+// SE_GROUP_ENABLED.
+const groupAttributes uint32 = 7
+
+// pacBuffer is the type and data of a PAC info buffer.
+type pacBuffer struct {
+	ulType uint32
+	data   []byte
+}
+
+// Builder describes the PAC of a user, built and signed by Sign for a KDC to include in the tickets it issues or for
+// test fixtures.
+//
+// The PAC holds a KERB_VALIDATION_INFO, a PAC_CLIENT_INFO, an S4U_DELEGATION_INFO if an S4U2Proxy target is set, a
+// UPN_DNS_INFO if a UPN, DNS domain or SAM name is set, a PAC_REQUESTOR if a SAM name is set and the server and KDC
+// signatures.
+type Builder struct {
+	// UserName is the account name of the client, used for the effective name and the client info. It must match
+	// the client name of the ticket.
+	UserName string
+	// FullName of the user.
+	FullName string
+	// UPN is the user principal name in the UPN_DNS_INFO.
+	UPN string
+	// DNSDomain is the DNS domain name in the UPN_DNS_INFO.
+	DNSDomain string
+	// SAMName is the sAMAccountName the UPN_DNS_INFO is extended with, along with the user's SID which the
+	// PAC_REQUESTOR holds too, as KDCs with the November 2021 Windows updates do.
+	SAMName string
+	// LogonServer is the NetBIOS name of the domain controller that authenticated the user.
+	LogonServer string
+	// LogonDomainName is the NetBIOS name of the domain of the user.
+	LogonDomainName string
+	// DomainSID is the SID of the logon domain, which is required.
+	DomainSID string
+	// UserID is the relative ID of the user in the domain.
+	UserID uint32
+	// PrimaryGroupID is the relative ID of the user's primary group. DefaultPrimaryGroupID is used if it is zero.
+	PrimaryGroupID uint32
+	// GroupIDs are the relative IDs of the domain groups the user is a member of.
+	GroupIDs []uint32
+	// ExtraSIDs are the string forms of additional SIDs of the user, such as S-1-18-1.
+	ExtraSIDs []string
+	// ResourceGroupDomainSID is the SID of the domain of the resource groups.
+	ResourceGroupDomainSID string
+	// ResourceGroupIDs are the relative IDs of the resource domain groups the user is a member of.
+	ResourceGroupIDs []uint32
+	// LogOnTime is the time the user authenticated, also used as the client info time. It must be the
+	// authentication time of the ticket.
+	LogOnTime time.Time
+	// S4U2ProxyTarget is the name of the service the ticket was obtained for with S4U2Proxy, in the
+	// S4U_DELEGATION_INFO.
+	S4U2ProxyTarget string
+	// S4UTransitedServices are the names of the services that delegated through S4U2Proxy, in the
+	// S4U_DELEGATION_INFO.
+	S4UTransitedServices []string
+}
+
+// UserSID returns the SID of the user, of the user's ID in the domain.
+func (p Builder) UserSID() string {
+	return fmt.Sprintf("%s-%d", p.DomainSID, p.UserID)
+}
+
+// GroupMembershipSIDs returns the SIDs of the groups that the PAC asserts, in the form and order that a service
+// reports them in the credentials' ADCredentials.
+func (p Builder) GroupMembershipSIDs() []string {
+	var g []string
+	seen := make(map[string]bool)
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			g = append(g, s)
+		}
+	}
+	for _, r := range p.GroupIDs {
+		add(fmt.Sprintf("%s-%d", p.DomainSID, r))
+	}
+	for _, s := range p.ExtraSIDs {
+		add(s)
+	}
+	for _, r := range p.ResourceGroupIDs {
+		add(fmt.Sprintf("%s-%d", p.ResourceGroupDomainSID, r))
+	}
+	return g
+}
+
+// Sign builds the PAC signed with the key of the service the ticket holding it is for and the key of the KDC's
+// krbtgt principal.
+func (p Builder) Sign(serverKey, kdcKey types.EncryptionKey) ([]byte, error) {
+	return p.SignWithKeyHandles(keytab.NewKeyHandle(serverKey, 0), keytab.NewKeyHandle(kdcKey, 0))
+}
+
+// SignWithKeyHandles builds the PAC as Sign does with handles of the service's and KDC's keys, so that the key
+// values are not required.
+func (p Builder) SignWithKeyHandles(server, kdc keytab.KeyHandle) ([]byte, error) {
+	srvType, srvLen, err := signatureType(server)
+	if err != nil {
+		return nil, err
+	}
+	kdcType, kdcLen, err := signatureType(kdc)
+	if err != nil {
+		return nil, err
+	}
+	kvi, err := p.kerbValidationInfo()
+	if err != nil {
+		return nil, err
+	}
+	buffers := []pacBuffer{
+		{infoTypeKerbValidationInfo, kvi},
+		{infoTypePACClientInfo, p.clientInfo()},
+	}
+	if p.S4U2ProxyTarget != "" {
+		buffers = append(buffers, pacBuffer{infoTypeS4UDelegationInfo, p.s4uDelegationInfo()})
+	}
+	if p.UPN != "" || p.DNSDomain != "" || p.SAMName != "" {
+		upn, err := p.upnDNSInfo()
+		if err != nil {
+			return nil, err
+		}
+		buffers = append(buffers, pacBuffer{infoTypeUPNDNSInfo, upn})
+	}
+	if p.SAMName != "" {
+		sid, err := parseSID(p.UserSID())
+		if err != nil {
+			return nil, err
+		}
+		buffers = append(buffers, pacBuffer{infoTypePACRequestor, sidBytes(sid)})
+	}
+	srvSig := make([]byte, 4+srvLen)
+	binary.LittleEndian.PutUint32(srvSig, uint32(srvType))
+	kdcSig := make([]byte, 4+kdcLen)
+	binary.LittleEndian.PutUint32(kdcSig, uint32(kdcType))
+	buffers = append(buffers, pacBuffer{infoTypePACServerSignatureData, srvSig}, pacBuffer{infoTypePACKDCSignatureData, kdcSig})
+
+	b := make([]byte, 8+16*len(buffers))
+	binary.LittleEndian.PutUint32(b, uint32(len(buffers)))
+	offsets := make([]int, len(buffers))
+	for i, buf := range buffers {
+		offsets[i] = len(b)
+		h := b[8+16*i:]
+		binary.LittleEndian.PutUint32(h, buf.ulType)
+		binary.LittleEndian.PutUint32(h[4:], uint32(len(buf.data)))
+		binary.LittleEndian.PutUint64(h[8:], uint64(len(b)))
+		b = append(b, buf.data...)
+		// The offset of each buffer must be a multiple of eight.
+		for len(b)%8 != 0 {
+			b = append(b, 0)
+		}
+	}
+	// The server signature is calculated over the PAC with both signatures zeroed and the KDC signature over the
+	// server signature.
+	srv, kdcOff := offsets[len(offsets)-2]+4, offsets[len(offsets)-1]+4
+	cksum, err := server.Checksum(srvType, b, keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		return nil, fmt.Errorf("error calculating PAC server signature: %w", err)
+	}
+	copy(b[srv:srv+srvLen], cksum)
+	cksum, err = kdc.Checksum(kdcType, b[srv:srv+srvLen], keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		return nil, fmt.Errorf("error calculating PAC KDC signature: %w", err)
+	}
+	copy(b[kdcOff:kdcOff+kdcLen], cksum)
+	return b, nil
+}
+
+// signatureType returns the checksum type of the PAC signatures of the key and their length.
+func signatureType(h keytab.KeyHandle) (int32, int, error) {
+	et, err := crypto.GetEtype(h.KeyType())
+	if err != nil {
+		return 0, 0, fmt.Errorf("error getting etype of PAC signing key: %w", err)
+	}
+	switch et.GetHashID() {
+	case chksumtype.HMAC_SHA1_96_AES128, chksumtype.HMAC_SHA1_96_AES256:
+		return et.GetHashID(), 12, nil
+	case chksumtype.KERB_CHECKSUM_HMAC_MD5:
+		return et.GetHashID(), 16, nil
+	}
+	return 0, 0, fmt.Errorf("PAC signatures with keys of etype %d are not supported", h.KeyType())
+}
+
+// kerbValidationInfo returns the NDR encoded KERB_VALIDATION_INFO.
+func (p Builder) kerbValidationInfo() ([]byte, error) {
+	if p.DomainSID == "" {
+		return nil, errors.New("domain SID required")
+	}
+	domainSID, err := parseSID(p.DomainSID)
+	if err != nil {
+		return nil, err
+	}
+	extraSIDs := make([]mstypes.RPCSID, len(p.ExtraSIDs))
+	for i, s := range p.ExtraSIDs {
+		if extraSIDs[i], err = parseSID(s); err != nil {
+			return nil, err
+		}
+	}
+	var resourceSID mstypes.RPCSID
+	if len(p.ResourceGroupIDs) > 0 {
+		if p.ResourceGroupDomainSID == "" {
+			return nil, errors.New("resource group domain SID required for resource groups")
+		}
+		if resourceSID, err = parseSID(p.ResourceGroupDomainSID); err != nil {
+			return nil, err
+		}
+	}
+	primary := p.PrimaryGroupID
+	if primary == 0 {
+		primary = DefaultPrimaryGroupID
+	}
+	var flags uint32
+	if len(extraSIDs) > 0 {
+		mstypes.SetFlag(&flags, USERFLAG_EXTRA_SIDS)
+	}
+	if len(p.ResourceGroupIDs) > 0 {
+		mstypes.SetFlag(&flags, USERFLAG_RESOURCE_GROUPIDS)
+	}
+	// Times that do not apply are set to the maximum FILETIME.
+	never := mstypes.FileTime{LowDateTime: 0xffffffff, HighDateTime: 0x7fffffff}
+	logon := mstypes.GetFileTime(p.LogOnTime)
+	names := [][]uint16{
+		utf16String(p.UserName),
+		utf16String(p.FullName),
+		nil, // LogonScript
+		nil, // ProfilePath
+		nil, // HomeDirectory
+		nil, // HomeDirectoryDrive
+	}
+	logonServer, logonDomain := utf16String(p.LogonServer), utf16String(p.LogonDomainName)
+
+	w := newNDRWriter()
+	w.fileTime(logon)
+	w.fileTime(never) // LogOffTime
+	w.fileTime(never) // KickOffTime
+	w.fileTime(logon) // PasswordLastSet
+	w.fileTime(logon) // PasswordCanChange
+	w.fileTime(never) // PasswordMustChange
+	for _, n := range names {
+		w.unicodeString(n)
+	}
+	w.uint16(0) // LogonCount
+	w.uint16(0) // BadPasswordCount
+	w.uint32(p.UserID)
+	w.uint32(primary)
+	w.uint32(uint32(len(p.GroupIDs)))
+	w.pointer(len(p.GroupIDs) > 0)
+	w.uint32(flags)
+	for i := 0; i < 16; i++ {
+		w.uint8(0) // UserSessionKey
+	}
+	w.unicodeString(logonServer)
+	w.unicodeString(logonDomain)
+	w.pointer(true) // LogonDomainID
+	w.uint32(0)     // Reserved1
+	w.uint32(0)
+	w.uint32(0x00000010) // UserAccountControl: USER_NORMAL_ACCOUNT
+	w.uint32(0)          // SubAuthStatus
+	w.fileTime(mstypes.FileTime{})
+	w.fileTime(mstypes.FileTime{})
+	w.uint32(0) // FailedILogonCount
+	w.uint32(0) // Reserved3
+	w.uint32(uint32(len(extraSIDs)))
+	w.pointer(len(extraSIDs) > 0)
+	w.pointer(len(p.ResourceGroupIDs) > 0)
+	w.uint32(uint32(len(p.ResourceGroupIDs)))
+	w.pointer(len(p.ResourceGroupIDs) > 0)
+
+	// The referents of the pointers follow in the order of the pointers.
+	for _, n := range names {
+		w.unicodeStringValue(n)
+	}
+	w.groupMemberships(p.GroupIDs, groupAttributes)
+	w.unicodeStringValue(logonServer)
+	w.unicodeStringValue(logonDomain)
+	w.sid(domainSID)
+	if len(extraSIDs) > 0 {
+		w.uint32(uint32(len(extraSIDs)))
+		for range extraSIDs {
+			w.pointer(true)
+			w.uint32(groupAttributes)
+		}
+		for _, s := range extraSIDs {
+			w.sid(s)
+		}
+	}
+	if len(p.ResourceGroupIDs) > 0 {
+		w.sid(resourceSID)
+		w.groupMemberships(p.ResourceGroupIDs, groupAttributes)
+	}
+	return w.bytes(), nil
+}
+
+// s4uDelegationInfo returns the NDR encoded S4U_DELEGATION_INFO.
+func (p Builder) s4uDelegationInfo() []byte {
+	target := utf16String(p.S4U2ProxyTarget)
+	transited := make([][]uint16, len(p.S4UTransitedServices))
+	for i, s := range p.S4UTransitedServices {
+		transited[i] = utf16String(s)
+	}
+	w := newNDRWriter()
+	w.unicodeString(target)
+	w.uint32(uint32(len(transited)))
+	w.pointer(len(transited) > 0)
+
+	// The referents of the pointers follow in the order of the pointers.
+	w.unicodeStringValue(target)
+	if len(transited) > 0 {
+		w.uint32(uint32(len(transited)))
+		for _, s := range transited {
+			w.unicodeString(s)
+		}
+		for _, s := range transited {
+			w.unicodeStringValue(s)
+		}
+	}
+	return w.bytes()
+}
+
+// clientInfo returns the PAC_CLIENT_INFO, which is not NDR encoded.
+func (p Builder) clientInfo() []byte {
+	n := utf16String(p.UserName)
+	ft := mstypes.GetFileTime(p.LogOnTime)
+	b := make([]byte, 10+2*len(n))
+	binary.LittleEndian.PutUint32(b, ft.LowDateTime)
+	binary.LittleEndian.PutUint32(b[4:], ft.HighDateTime)
+	binary.LittleEndian.PutUint16(b[8:], uint16(2*len(n)))
+	for i, c := range n {
+		binary.LittleEndian.PutUint16(b[10+2*i:], c)
+	}
+	return b
+}
+
+// upnDNSInfo returns the UPN_DNS_INFO, which is not NDR encoded. It is extended with the SAM name and SID of the user
+// if the SAM name is set.
+func (p Builder) upnDNSInfo() ([]byte, error) {
+	upn, dns, sam := utf16String(p.UPN), utf16String(p.DNSDomain), utf16String(p.SAMName)
+	// The names follow the 12 byte structure, or 20 byte extended structure, each starting on a multiple of eight
+	// bytes.
+	upnOffset := 16
+	if p.SAMName != "" {
+		upnOffset = 24
+	}
+	dnsOffset := upnOffset + (2*len(upn)+7)/8*8
+	end := dnsOffset + 2*len(dns)
+	var sid []byte
+	var samOffset, sidOffset int
+	if p.SAMName != "" {
+		s, err := parseSID(p.UserSID())
+		if err != nil {
+			return nil, err
+		}
+		sid = sidBytes(s)
+		samOffset = (end + 7) / 8 * 8
+		sidOffset = samOffset + (2*len(sam)+7)/8*8
+		end = sidOffset + len(sid)
+	}
+	b := make([]byte, end)
+	binary.LittleEndian.PutUint16(b, uint16(2*len(upn)))
+	binary.LittleEndian.PutUint16(b[2:], uint16(upnOffset))
+	binary.LittleEndian.PutUint16(b[4:], uint16(2*len(dns)))
+	binary.LittleEndian.PutUint16(b[6:], uint16(dnsOffset))
+	for i, c := range upn {
+		binary.LittleEndian.PutUint16(b[upnOffset+2*i:], c)
+	}
+	for i, c := range dns {
+		binary.LittleEndian.PutUint16(b[dnsOffset+2*i:], c)
+	}
+	if p.SAMName != "" {
+		// The S flag indicates the structure is extended.
+		binary.LittleEndian.PutUint32(b[8:], 2)
+		binary.LittleEndian.PutUint16(b[12:], uint16(2*len(sam)))
+		binary.LittleEndian.PutUint16(b[14:], uint16(samOffset))
+		binary.LittleEndian.PutUint16(b[16:], uint16(len(sid)))
+		binary.LittleEndian.PutUint16(b[18:], uint16(sidOffset))
+		for i, c := range sam {
+			binary.LittleEndian.PutUint16(b[samOffset+2*i:], c)
+		}
+		copy(b[sidOffset:], sid)
+	}
+	return b, nil
+}
+
+// sidBytes returns the SID in the form that is not NDR encoded.
+func sidBytes(s mstypes.RPCSID) []byte {
+	b := make([]byte, 8+4*len(s.SubAuthority))
+	b[0] = s.Revision
+	b[1] = s.SubAuthorityCount
+	copy(b[2:8], s.IdentifierAuthority[:])
+	for i, a := range s.SubAuthority {
+		binary.LittleEndian.PutUint32(b[8+4*i:], a)
+	}
+	return b
+}
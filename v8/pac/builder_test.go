@@ -0,0 +1,86 @@
+package pac
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testBuilder() Builder {
+	return Builder{
+		UserName:               "testuser1",
+		FullName:               "Test User1",
+		UPN:                    "testuser1@test.gokrb5",
+		DNSDomain:              "TEST.GOKRB5",
+		SAMName:                "testuser1",
+		LogonServer:            "DC1",
+		LogonDomainName:        "TEST",
+		DomainSID:              "S-1-5-21-3167651404-3865080224-2280184895",
+		UserID:                 1105,
+		GroupIDs:               []uint32{513, 1108},
+		ExtraSIDs:              []string{"S-1-18-1"},
+		ResourceGroupDomainSID: "S-1-5-21-4-5-6",
+		ResourceGroupIDs:       []uint32{1200},
+		LogOnTime:              time.Date(2017, 3, 13, 11, 20, 1, 0, time.UTC),
+		S4U2ProxyTarget:        "HTTP/host.test.gokrb5",
+	}
+}
+
+func TestBuilder_Sign(t *testing.T) {
+	t.Parallel()
+	for _, et := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC} {
+		e, _ := crypto.GetEtype(et)
+		srvKey, _ := types.GenerateEncryptionKey(e)
+		kdcKey, _ := types.GenerateEncryptionKey(e)
+		p := testBuilder()
+		b, err := p.Sign(srvKey, kdcKey)
+		if err != nil {
+			t.Fatalf("Error signing PAC with etype %d: %v", et, err)
+		}
+		var pac PACType
+		if err := pac.Unmarshal(b); err != nil {
+			t.Fatalf("Error unmarshaling PAC with etype %d: %v", et, err)
+		}
+		if err := pac.ProcessPACInfoBuffers(srvKey, nil); err != nil {
+			t.Fatalf("Error processing PAC with etype %d: %v", et, err)
+		}
+		assert.NoError(t, pac.VerifyKDCChecksum(kdcKey), "KDC checksum not verified for etype %d", et)
+		assert.Error(t, pac.VerifyKDCChecksum(srvKey), "KDC checksum verified with the service key for etype %d", et)
+		assert.NoError(t, pac.VerifyClientInfo(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"), p.LogOnTime),
+			"client info not valid for etype %d", et)
+
+		kvi := pac.KerbValidationInfo
+		assert.Equal(t, "testuser1", kvi.EffectiveName.Value, "effective name not as expected")
+		assert.Equal(t, "Test User1", kvi.FullName.Value, "full name not as expected")
+		assert.Equal(t, uint32(1105), kvi.UserID, "user ID not as expected")
+		assert.Equal(t, DefaultPrimaryGroupID, kvi.PrimaryGroupID, "primary group ID not as expected")
+		assert.Equal(t, p.GroupMembershipSIDs(), kvi.GetGroupMembershipSIDs(), "group membership SIDs not as expected")
+		assert.Equal(t, "HTTP/host.test.gokrb5", pac.S4UDelegationInfo.S4U2proxyTarget.Value, "S4U2proxy target not as expected")
+		assert.Equal(t, "testuser1", pac.UPNDNSInfo.SamName, "SAM name not as expected")
+		assert.Equal(t, p.UserSID(), pac.UPNDNSInfo.SID.String(), "UPN_DNS_INFO SID not as expected")
+		assert.Equal(t, p.UserSID(), pac.Requestor.SID.String(), "requestor SID not as expected")
+	}
+}
+
+func TestBuilder_Sign_Errors(t *testing.T) {
+	t.Parallel()
+	e, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	key, _ := types.GenerateEncryptionKey(e)
+	p := testBuilder()
+	p.DomainSID = ""
+	_, err := p.Sign(key, key)
+	assert.Error(t, err, "a PAC without a domain SID should not be built")
+
+	p = testBuilder()
+	p.ExtraSIDs = []string{"not a SID"}
+	_, err = p.Sign(key, key)
+	assert.Error(t, err, "a PAC with an invalid SID should not be built")
+
+	_, err = testBuilder().Sign(key, types.EncryptionKey{KeyType: 1})
+	assert.Error(t, err, "a PAC should not be signed with an unsupported key")
+}
@@ -127,17 +127,35 @@ func TestPAC_ClientClaimsInfoMultiEntry_Unmarshal(t *testing.T) {
 	assert.Equal(t, mstypes.CompressionFormatNone, k.ClaimsSetMetadata.CompressionFormat, "compression format not as expected")
 }
 
-// Compressed claims not yet supported.
-//func TestPAC_ClientClaimsInfo_Unmarshal_UnsupportedCompression(t *testing.T) {
-//	t.Parallel()
-//	b, err := hex.DecodeString(testdata.MarshaledPAC_ClientClaimsInfo_XPRESS_HUFF)
-//	if err != nil {
-//		t.Fatal("Could not decode test data hex string")
-//	}
-//	var k ClientClaimsInfo
-//	err = k.Unmarshal(b)
-//	if err != nil {
-//		t.Fatalf("Error unmarshaling test data: %v", err)
-//	}
-//	assert.Equal(t, mstypes.CompressionFormatXPressHuff, k.ClaimsSetMetadata.CompressionFormat, "compression format not as expected")
-//}
+func TestPAC_ClientClaimsInfo_Unmarshal_XPressHuff(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_ClientClaimsInfo_XPRESS_HUFF)
+	if err != nil {
+		t.Fatal("Could not decode test data hex string")
+	}
+	var k ClientClaimsInfo
+	err = k.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	assert.Equal(t, mstypes.CompressionFormatXPressHuff, k.ClaimsSetMetadata.CompressionFormat, "compression format not as expected")
+	assert.Equal(t, uint32(1), k.ClaimsSet.ClaimsArrayCount, "claims array count not as expected")
+	assert.Equal(t, mstypes.ClaimsSourceTypeAD, k.ClaimsSet.ClaimsArrays[0].ClaimsSourceType, "claims source type not as expected")
+	assert.Equal(t, uint32(3), k.ClaimsSet.ClaimsArrays[0].ClaimsCount, "claims count not as expected")
+	assert.Equal(t, "ad://ext/objectClass:88d5de791e7b27e6", k.ClaimsSet.ClaimsArrays[0].ClaimEntries[0].ID, "claims entry ID not as expected")
+	assert.Equal(t, []uint64{655369, 65543, 65542, 65536}, k.ClaimsSet.ClaimsArrays[0].ClaimEntries[0].TypeUInt64.Value, "claims value not as expected")
+	assert.Equal(t, "ad://ext/sAMAccountName:88d5d9085ea5c0c0", k.ClaimsSet.ClaimsArrays[0].ClaimEntries[1].ID, "claims entry ID not as expected")
+	assert.Equal(t, []mstypes.LPWSTR{{Value: "testuser1"}}, k.ClaimsSet.ClaimsArrays[0].ClaimEntries[1].TypeString.Value, "claims value not as expected")
+	assert.Equal(t, "ad://ext/sAMAccountType:88d5de79a7ecf8c7", k.ClaimsSet.ClaimsArrays[0].ClaimEntries[2].ID, "claims entry ID not as expected")
+	assert.Equal(t, []int64{805306368}, k.ClaimsSet.ClaimsArrays[0].ClaimEntries[2].TypeInt64.Value, "claims value not as expected")
+}
+
+func TestDecompressXPressHuff_Errors(t *testing.T) {
+	t.Parallel()
+	_, err := decompressXPressHuff(make([]byte, 10), 20)
+	assert.Error(t, err, "expected error for data shorter than the Huffman table")
+	_, err = decompressXPressHuff(make([]byte, 300), 20)
+	assert.Error(t, err, "expected error for empty Huffman table")
+	_, err = decompressXPressHuff(nil, maxUncompressedClaimsSize+1)
+	assert.Error(t, err, "expected error for uncompressed size too large")
+}
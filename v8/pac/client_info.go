@@ -1,8 +1,6 @@
 package pac
 
 import (
-	"bytes"
-
 	"github.com/jcmturner/rpc/v2/mstypes"
 )
 
@@ -16,7 +14,9 @@ type ClientInfo struct {
 // Unmarshal bytes into the ClientInfo struct
 func (k *ClientInfo) Unmarshal(b []byte) (err error) {
 	//The PAC_CLIENT_INFO structure is a simple structure that is not NDR-encoded.
-	r := mstypes.NewReader(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	r := mstypes.NewReader(buf.reader())
 
 	k.ClientID, err = r.FileTime()
 	if err != nil {
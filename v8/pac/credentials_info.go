@@ -1,7 +1,6 @@
 package pac
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 
@@ -25,7 +24,9 @@ type CredentialsInfo struct {
 // Unmarshal bytes into the CredentialsInfo struct
 func (c *CredentialsInfo) Unmarshal(b []byte, k types.EncryptionKey) (err error) {
 	//The CredentialsInfo structure is a simple structure that is not NDR-encoded.
-	r := mstypes.NewReader(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	r := mstypes.NewReader(buf.reader())
 
 	c.Version, err = r.Uint32()
 	if err != nil {
@@ -41,13 +42,13 @@ func (c *CredentialsInfo) Unmarshal(b []byte, k types.EncryptionKey) (err error)
 	}
 	c.PACCredentialDataEncrypted, err = r.ReadBytes(len(b) - 8)
 	if err != nil {
-		err = fmt.Errorf("error reading PAC Credetials Data: %v", err)
+		err = fmt.Errorf("error reading PAC Credetials Data: %w", err)
 		return
 	}
 
 	err = c.DecryptEncPart(k)
 	if err != nil {
-		err = fmt.Errorf("error decrypting PAC Credentials Data: %v", err)
+		err = fmt.Errorf("error decrypting PAC Credentials Data: %w", err)
 		return
 	}
 	return
@@ -77,10 +78,12 @@ type CredentialData struct {
 
 // Unmarshal converts the bytes provided into a CredentialData type.
 func (c *CredentialData) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	dec := ndr.NewDecoder(buf.reader())
 	err = dec.Decode(c)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling KerbValidationInfo: %v", err)
+		err = fmt.Errorf("error unmarshaling KerbValidationInfo: %w", err)
 	}
 	return
 }
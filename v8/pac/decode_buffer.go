@@ -0,0 +1,42 @@
+package pac
+
+import (
+	"bufio"
+	"bytes"
+	"sync"
+)
+
+// decodeBuffer is a reusable reader over the bytes of a PAC info buffer.
+// The NDR decoder and mstypes reader wrap their input in a bufio.Reader which allocates a new read buffer for every
+// structure decoded. They use a bufio.Reader passed to them as is so pooling these avoids the allocation.
+type decodeBuffer struct {
+	b  bytes.Reader
+	br *bufio.Reader
+}
+
+var decodeBuffers = sync.Pool{
+	New: func() interface{} {
+		return &decodeBuffer{br: bufio.NewReader(nil)}
+	},
+}
+
+// newDecodeBuffer returns a decodeBuffer from the pool reading the bytes provided.
+// The buffer must be released once decoding is complete and the reader must not be used after.
+func newDecodeBuffer(b []byte) *decodeBuffer {
+	d := decodeBuffers.Get().(*decodeBuffer)
+	d.b.Reset(b)
+	d.br.Reset(&d.b)
+	return d
+}
+
+// reader returns the reader to pass to the NDR decoder or mstypes reader.
+func (d *decodeBuffer) reader() *bufio.Reader {
+	return d.br
+}
+
+// release returns the decodeBuffer to the pool.
+func (d *decodeBuffer) release() {
+	d.b.Reset(nil)
+	d.br.Reset(&d.b)
+	decodeBuffers.Put(d)
+}
@@ -0,0 +1,70 @@
+package pac
+
+import (
+	"encoding/hex"
+	"sync"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeBuffer_Reuse(t *testing.T) {
+	t.Parallel()
+	d := newDecodeBuffer([]byte{1, 2, 3})
+	b := make([]byte, 3)
+	d.reader().Read(b)
+	assert.Equal(t, []byte{1, 2, 3}, b, "bytes read not as expected")
+	d.release()
+
+	// A reused buffer must not return bytes from its previous use
+	d = newDecodeBuffer([]byte{4})
+	defer d.release()
+	n, _ := d.reader().Read(b)
+	assert.Equal(t, 1, n, "number of bytes read not as expected")
+	assert.Equal(t, byte(4), b[0], "bytes read not as expected")
+}
+
+func TestPACType_ProcessPACInfoBuffers_Concurrent(t *testing.T) {
+	t.Parallel()
+	v, err := hex.DecodeString(testdata.MarshaledPAC_AD_WIN2K_PAC)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	kb, _ := hex.DecodeString(testdata.KEYTAB_SYSHTTP_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(kb)
+	pn, _ := types.ParseSPNString("sysHTTP")
+	key, _, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 2, 18)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	var ref PACType
+	ref.Unmarshal(v)
+	err = ref.ProcessPACInfoBuffers(key, nil)
+	if err != nil {
+		t.Fatalf("Processing reference pac error: %v", err)
+	}
+
+	// Values decoded with pooled buffers must not be affected by their reuse
+	pacs := make([]PACType, 20)
+	var wg sync.WaitGroup
+	for i := range pacs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pacs[i].Unmarshal(v)
+			if err := pacs[i].ProcessPACInfoBuffers(key, nil); err != nil {
+				t.Errorf("Processing pac error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, p := range pacs {
+		assert.Equal(t, ref.KerbValidationInfo, p.KerbValidationInfo, "KerbValidationInfo not as expected")
+		assert.Equal(t, ref.UPNDNSInfo, p.UPNDNSInfo, "UPNDNSInfo not as expected")
+		assert.Equal(t, ref.ClientInfo, p.ClientInfo, "ClientInfo not as expected")
+	}
+}
@@ -1,7 +1,6 @@
 package pac
 
 import (
-	"bytes"
 	"fmt"
 
 	"github.com/jcmturner/rpc/v2/mstypes"
@@ -18,17 +17,19 @@ type DeviceClaimsInfo struct {
 
 // Unmarshal bytes into the ClientClaimsInfo struct
 func (k *DeviceClaimsInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	dec := ndr.NewDecoder(buf.reader())
 	m := new(mstypes.ClaimsSetMetadata)
 	err = dec.Decode(m)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling ClientClaimsInfo ClaimsSetMetadata: %v", err)
+		err = fmt.Errorf("error unmarshaling ClientClaimsInfo ClaimsSetMetadata: %w", err)
 		return
 	}
 	k.ClaimsSetMetadata = *m
-	k.ClaimsSet, err = k.ClaimsSetMetadata.ClaimsSet()
+	k.ClaimsSet, err = claimsSet(k.ClaimsSetMetadata)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling ClientClaimsInfo ClaimsSet: %v", err)
+		err = fmt.Errorf("error unmarshaling ClientClaimsInfo ClaimsSet: %w", err)
 	}
 	return
 }
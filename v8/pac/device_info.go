@@ -1,7 +1,6 @@
 package pac
 
 import (
-	"bytes"
 	"fmt"
 
 	"github.com/jcmturner/rpc/v2/mstypes"
@@ -23,10 +22,12 @@ type DeviceInfo struct {
 
 // Unmarshal bytes into the DeviceInfo struct
 func (k *DeviceInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	dec := ndr.NewDecoder(buf.reader())
 	err = dec.Decode(k)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling DeviceInfo: %v", err)
+		err = fmt.Errorf("error unmarshaling DeviceInfo: %w", err)
 	}
 	return
 }
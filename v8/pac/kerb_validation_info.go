@@ -2,7 +2,6 @@
 package pac
 
 import (
-	"bytes"
 	"fmt"
 
 	"github.com/jcmturner/rpc/v2/mstypes"
@@ -66,10 +65,12 @@ type KerbValidationInfo struct {
 
 // Unmarshal bytes into the DeviceInfo struct
 func (k *KerbValidationInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	dec := ndr.NewDecoder(buf.reader())
 	err = dec.Decode(k)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling KerbValidationInfo: %v", err)
+		err = fmt.Errorf("error unmarshaling KerbValidationInfo: %w", err)
 	}
 	return
 }
@@ -0,0 +1,151 @@
+package pac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+// ndrWriter encodes the little-endian NDR stream of a type serialization version 1 object as it is decoded by the
+// github.com/jcmturner/rpc/v2/ndr package. Only the constructs needed for a KERB_VALIDATION_INFO and an
+// S4U_DELEGATION_INFO are supported.
+type ndrWriter struct {
+	b   []byte
+	ref uint32
+}
+
+// newNDRWriter returns a writer that has written the common and private headers and the top level referent.
+func newNDRWriter() *ndrWriter {
+	w := &ndrWriter{ref: 0x00020000}
+	w.b = append(w.b, 0x01, 0x10, 0x08, 0x00, 0xcc, 0xcc, 0xcc, 0xcc)
+	// The object buffer length is set once the object has been written.
+	w.b = append(w.b, make([]byte, 8)...)
+	w.pointer(true)
+	return w
+}
+
+// bytes returns the stream padded to a multiple of eight bytes with the object buffer length set.
+func (w *ndrWriter) bytes() []byte {
+	w.align(8)
+	binary.LittleEndian.PutUint32(w.b[8:12], uint32(len(w.b)-16))
+	return w.b
+}
+
+// align pads the stream so that the next primitive starts on a multiple of n bytes.
+func (w *ndrWriter) align(n int) {
+	for len(w.b)%n != 0 {
+		w.b = append(w.b, 0)
+	}
+}
+
+func (w *ndrWriter) uint8(v uint8) {
+	w.b = append(w.b, v)
+}
+
+func (w *ndrWriter) uint16(v uint16) {
+	w.align(2)
+	w.b = append(w.b, 0, 0)
+	binary.LittleEndian.PutUint16(w.b[len(w.b)-2:], v)
+}
+
+func (w *ndrWriter) uint32(v uint32) {
+	w.align(4)
+	w.b = append(w.b, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(w.b[len(w.b)-4:], v)
+}
+
+// pointer writes a unique referent ID, or zero for a null pointer.
+func (w *ndrWriter) pointer(present bool) {
+	if !present {
+		w.uint32(0)
+		return
+	}
+	w.uint32(w.ref)
+	w.ref += 4
+}
+
+func (w *ndrWriter) fileTime(ft mstypes.FileTime) {
+	w.uint32(ft.LowDateTime)
+	w.uint32(ft.HighDateTime)
+}
+
+// unicodeString writes the fixed part of an RPC_UNICODE_STRING. The characters are written by unicodeStringValue
+// once the structure holding the string has been written.
+func (w *ndrWriter) unicodeString(s []uint16) {
+	w.uint16(uint16(2 * len(s)))
+	w.uint16(uint16(2 * len(s)))
+	w.pointer(len(s) > 0)
+}
+
+// unicodeStringValue writes the deferred conformant varying array of characters of an RPC_UNICODE_STRING.
+func (w *ndrWriter) unicodeStringValue(s []uint16) {
+	if len(s) < 1 {
+		return
+	}
+	w.uint32(uint32(len(s)))
+	w.uint32(0)
+	w.uint32(uint32(len(s)))
+	for _, c := range s {
+		w.uint16(c)
+	}
+}
+
+// groupMemberships writes the deferred conformant array of GROUP_MEMBERSHIP structures.
+func (w *ndrWriter) groupMemberships(rids []uint32, attrs uint32) {
+	if len(rids) < 1 {
+		return
+	}
+	w.uint32(uint32(len(rids)))
+	for _, r := range rids {
+		w.uint32(r)
+		w.uint32(attrs)
+	}
+}
+
+// sid writes the deferred referent of a pointer to an RPC_SID.
+func (w *ndrWriter) sid(s mstypes.RPCSID) {
+	w.uint32(uint32(len(s.SubAuthority)))
+	w.uint8(s.Revision)
+	w.uint8(s.SubAuthorityCount)
+	for _, b := range s.IdentifierAuthority {
+		w.uint8(b)
+	}
+	for _, a := range s.SubAuthority {
+		w.uint32(a)
+	}
+}
+
+// utf16String returns the UTF-16 encoding of the string.
+func utf16String(s string) []uint16 {
+	return utf16.Encode([]rune(s))
+}
+
+// parseSID parses the string form of a SID, such as S-1-5-21-1-2-3, into an RPC_SID.
+func parseSID(s string) (mstypes.RPCSID, error) {
+	var sid mstypes.RPCSID
+	p := strings.Split(s, "-")
+	if len(p) < 3 || p[0] != "S" || p[1] != "1" || len(p) > 18 {
+		return sid, fmt.Errorf("invalid SID %q", s)
+	}
+	a, err := strconv.ParseUint(p[2], 10, 48)
+	if err != nil {
+		return sid, fmt.Errorf("invalid identifier authority in SID %q: %w", s, err)
+	}
+	sid.Revision = 1
+	for i := range sid.IdentifierAuthority {
+		sid.IdentifierAuthority[i] = byte(a >> uint(8*(5-i)))
+	}
+	for _, sa := range p[3:] {
+		v, err := strconv.ParseUint(sa, 10, 32)
+		if err != nil {
+			return sid, fmt.Errorf("invalid sub-authority in SID %q: %w", s, err)
+		}
+		sid.SubAuthority = append(sid.SubAuthority, uint32(v))
+	}
+	sid.SubAuthorityCount = uint8(len(sid.SubAuthority))
+	return sid, nil
+}
@@ -1,13 +1,15 @@
 package pac
 
 import (
-	"bytes"
+	"crypto/hmac"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
-	"github.com/jcmturner/gokrb5/v8/crypto"
 	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/jcmturner/rpc/v2/mstypes"
 )
@@ -23,6 +25,8 @@ const (
 	infoTypePACClientClaimsInfo    uint32 = 13
 	infoTypePACDeviceInfo          uint32 = 14
 	infoTypePACDeviceClaimsInfo    uint32 = 15
+	infoTypePACAttributesInfo      uint32 = 17
+	infoTypePACRequestor           uint32 = 18
 )
 
 // PACType implements: https://msdn.microsoft.com/en-us/library/cc237950.aspx
@@ -41,6 +45,8 @@ type PACType struct {
 	ClientClaimsInfo   *ClientClaimsInfo
 	DeviceInfo         *DeviceInfo
 	DeviceClaimsInfo   *DeviceClaimsInfo
+	AttributesInfo     *AttributesInfo
+	Requestor          *Requestor
 	ZeroSigData        []byte
 }
 
@@ -57,7 +63,9 @@ func (pac *PACType) Unmarshal(b []byte) (err error) {
 	zb := make([]byte, len(b), len(b))
 	copy(zb, b)
 	pac.ZeroSigData = zb
-	r := mstypes.NewReader(bytes.NewReader(b))
+	d := newDecodeBuffer(b)
+	defer d.release()
+	r := mstypes.NewReader(d.reader())
 	pac.CBuffers, err = r.Uint32()
 	if err != nil {
 		return
@@ -66,6 +74,10 @@ func (pac *PACType) Unmarshal(b []byte) (err error) {
 	if err != nil {
 		return
 	}
+	// Each Info Buffer is 16 bytes so the count cannot exceed what the data can hold.
+	if uint64(pac.CBuffers) > uint64(len(b)-8)/16 {
+		return fmt.Errorf("PAC count of %d Info Buffers exceeds the length of the PAC", pac.CBuffers)
+	}
 	buf := make([]InfoBuffer, pac.CBuffers, pac.CBuffers)
 	for i := range buf {
 		buf[i].ULType, err = r.Uint32()
@@ -88,9 +100,19 @@ func (pac *PACType) Unmarshal(b []byte) (err error) {
 // ProcessPACInfoBuffers processes the PAC Info Buffers.
 // https://msdn.microsoft.com/en-us/library/cc237954.aspx
 func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger) error {
+	return pac.ProcessPACInfoBuffersWithKeyHandle(keytab.NewKeyHandle(key, 0), l)
+}
+
+// ProcessPACInfoBuffersWithKeyHandle processes the PAC Info Buffers as ProcessPACInfoBuffers does, verifying the
+// server checksum with the service's key handle so that the service's key value is not required.
+func (pac *PACType) ProcessPACInfoBuffersWithKeyHandle(h keytab.KeyHandle, l *log.Logger) error {
 	for _, buf := range pac.Buffers {
-		p := make([]byte, buf.CBBufferSize, buf.CBBufferSize)
-		copy(p, pac.Data[int(buf.Offset):int(buf.Offset)+int(buf.CBBufferSize)])
+		// The order of the buffers is not significant. Samba and Heimdal KDCs order them differently to Active Directory.
+		if buf.Offset > uint64(len(pac.Data)) || uint64(buf.CBBufferSize) > uint64(len(pac.Data))-buf.Offset {
+			return fmt.Errorf("PAC Info Buffer of type %d exceeds the length of the PAC", buf.ULType)
+		}
+		// The buffers are decoded into new values so the PAC data does not need to be copied.
+		p := pac.Data[int(buf.Offset) : int(buf.Offset)+int(buf.CBBufferSize)]
 		switch buf.ULType {
 		case infoTypeKerbValidationInfo:
 			if pac.KerbValidationInfo != nil {
@@ -100,7 +122,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			var k KerbValidationInfo
 			err := k.Unmarshal(p)
 			if err != nil {
-				return fmt.Errorf("error processing KerbValidationInfo: %v", err)
+				return fmt.Errorf("error processing KerbValidationInfo: %w", err)
 			}
 			pac.KerbValidationInfo = &k
 		case infoTypeCredentials:
@@ -115,7 +137,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			//var k CredentialsInfo
 			//err := k.Unmarshal(p, key) // The encryption key used is the AS reply key only available to the client.
 			//if err != nil {
-			//	return fmt.Errorf("error processing CredentialsInfo: %v", err)
+			//	return fmt.Errorf("error processing CredentialsInfo: %w", err)
 			//}
 			//pac.CredentialsInfo = &k
 		case infoTypePACServerSignatureData:
@@ -127,7 +149,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			zb, err := k.Unmarshal(p)
 			copy(pac.ZeroSigData[int(buf.Offset):int(buf.Offset)+int(buf.CBBufferSize)], zb)
 			if err != nil {
-				return fmt.Errorf("error processing ServerChecksum: %v", err)
+				return fmt.Errorf("error processing ServerChecksum: %w", err)
 			}
 			pac.ServerChecksum = &k
 		case infoTypePACKDCSignatureData:
@@ -139,7 +161,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			zb, err := k.Unmarshal(p)
 			copy(pac.ZeroSigData[int(buf.Offset):int(buf.Offset)+int(buf.CBBufferSize)], zb)
 			if err != nil {
-				return fmt.Errorf("error processing KDCChecksum: %v", err)
+				return fmt.Errorf("error processing KDCChecksum: %w", err)
 			}
 			pac.KDCChecksum = &k
 		case infoTypePACClientInfo:
@@ -150,7 +172,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			var k ClientInfo
 			err := k.Unmarshal(p)
 			if err != nil {
-				return fmt.Errorf("error processing ClientInfo: %v", err)
+				return fmt.Errorf("error processing ClientInfo: %w", err)
 			}
 			pac.ClientInfo = &k
 		case infoTypeS4UDelegationInfo:
@@ -161,7 +183,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			var k S4UDelegationInfo
 			err := k.Unmarshal(p)
 			if err != nil {
-				l.Printf("could not process S4U_DelegationInfo: %v", err)
+				logf(l, "could not process S4U_DelegationInfo: %v", err)
 				continue
 			}
 			pac.S4UDelegationInfo = &k
@@ -173,7 +195,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			var k UPNDNSInfo
 			err := k.Unmarshal(p)
 			if err != nil {
-				l.Printf("could not process UPN_DNSInfo: %v", err)
+				logf(l, "could not process UPN_DNSInfo: %v", err)
 				continue
 			}
 			pac.UPNDNSInfo = &k
@@ -185,7 +207,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			var k ClientClaimsInfo
 			err := k.Unmarshal(p)
 			if err != nil {
-				l.Printf("could not process ClientClaimsInfo: %v", err)
+				logf(l, "could not process ClientClaimsInfo: %v", err)
 				continue
 			}
 			pac.ClientClaimsInfo = &k
@@ -197,7 +219,7 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			var k DeviceInfo
 			err := k.Unmarshal(p)
 			if err != nil {
-				l.Printf("could not process DeviceInfo: %v", err)
+				logf(l, "could not process DeviceInfo: %v", err)
 				continue
 			}
 			pac.DeviceInfo = &k
@@ -209,21 +231,117 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 			var k DeviceClaimsInfo
 			err := k.Unmarshal(p)
 			if err != nil {
-				l.Printf("could not process DeviceClaimsInfo: %v", err)
+				logf(l, "could not process DeviceClaimsInfo: %v", err)
 				continue
 			}
 			pac.DeviceClaimsInfo = &k
+		case infoTypePACAttributesInfo:
+			if pac.AttributesInfo != nil {
+				//Must ignore subsequent buffers of this type
+				continue
+			}
+			var k AttributesInfo
+			err := k.Unmarshal(p)
+			if err != nil {
+				logf(l, "could not process AttributesInfo: %v", err)
+				continue
+			}
+			pac.AttributesInfo = &k
+		case infoTypePACRequestor:
+			if pac.Requestor != nil {
+				//Must ignore subsequent buffers of this type
+				continue
+			}
+			var k Requestor
+			err := k.Unmarshal(p)
+			if err != nil {
+				return fmt.Errorf("error processing Requestor: %w", err)
+			}
+			pac.Requestor = &k
 		}
 	}
 
-	if ok, err := pac.verify(key); !ok {
+	if ok, err := pac.verifyWithKeyHandle(h); !ok {
 		return err
 	}
 
+	return pac.verifySIDs()
+}
+
+// VerifyKDCChecksum verifies the KDC checksum of the PAC, over its server checksum, with the key of the KDC's
+// krbtgt principal. Only holders of the KDC's key, such as a KDC or a service sharing the krbtgt keytab, can verify
+// it; other services rely on the server checksum verified by ProcessPACInfoBuffers.
+func (pac *PACType) VerifyKDCChecksum(key types.EncryptionKey) error {
+	return pac.VerifyKDCChecksumWithKeyHandle(keytab.NewKeyHandle(key, 0))
+}
+
+// VerifyKDCChecksumWithKeyHandle verifies the KDC checksum of the PAC as VerifyKDCChecksum does with a key handle of
+// the KDC's key. The PAC's info buffers must have been processed.
+func (pac *PACType) VerifyKDCChecksumWithKeyHandle(h keytab.KeyHandle) error {
+	if pac.ServerChecksum == nil {
+		return errors.New("PAC Info Buffers does not contain a ServerChecksum")
+	}
+	if pac.KDCChecksum == nil {
+		return errors.New("PAC Info Buffers does not contain a KDCChecksum")
+	}
+	cksum, err := h.Checksum(int32(pac.KDCChecksum.SignatureType), pac.ServerChecksum.Signature, keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(cksum, pac.KDCChecksum.Signature) {
+		return errors.New("PAC KDC checksum verification failed")
+	}
+	return nil
+}
+
+// VerifyClientInfo checks that the PAC was issued for the client of the ticket it is in, when the client
+// authenticated, so that a PAC copied from another ticket is rejected. The PAC's info buffers must have been
+// processed.
+func (pac *PACType) VerifyClientInfo(cname types.PrincipalName, authTime time.Time) error {
+	if pac.ClientInfo == nil {
+		return errors.New("PAC Info Buffers does not contain a ClientInfo")
+	}
+	if !pac.ClientInfo.ClientID.Time().Truncate(time.Second).Equal(authTime.Truncate(time.Second)) {
+		return fmt.Errorf("PAC client info time %v does not match the ticket's authentication time %v",
+			pac.ClientInfo.ClientID.Time(), authTime)
+	}
+	name := cname.PrincipalNameString()
+	// The client info of an enterprise principal's PAC may contain its account name alone.
+	if !strings.EqualFold(pac.ClientInfo.Name, name) &&
+		!(strings.Contains(name, "@") && strings.EqualFold(pac.ClientInfo.Name, name[:strings.Index(name, "@")])) {
+		return fmt.Errorf("PAC client info name %s does not match the ticket's client %s", pac.ClientInfo.Name, name)
+	}
 	return nil
 }
 
+// verifySIDs checks that the SIDs of the client in the PAC_REQUESTOR and extended UPN_DNS_INFO match the user of the
+// KERB_VALIDATION_INFO.
+func (pac *PACType) verifySIDs() error {
+	if pac.KerbValidationInfo == nil || (pac.Requestor == nil && (pac.UPNDNSInfo == nil || !pac.UPNDNSInfo.Extended())) {
+		return nil
+	}
+	sid := fmt.Sprintf("%s-%d", pac.KerbValidationInfo.LogonDomainID.String(), pac.KerbValidationInfo.UserID)
+	if pac.Requestor != nil && pac.Requestor.SID.String() != sid {
+		return fmt.Errorf("PAC requestor SID %s does not match the user's SID %s", pac.Requestor.SID.String(), sid)
+	}
+	if pac.UPNDNSInfo != nil && pac.UPNDNSInfo.Extended() && pac.UPNDNSInfo.SID.String() != sid {
+		return fmt.Errorf("PAC UPN_DNS_INFO SID %s does not match the user's SID %s", pac.UPNDNSInfo.SID.String(), sid)
+	}
+	return nil
+}
+
+// logf writes to the logger if one is provided.
+func logf(l *log.Logger, format string, v ...interface{}) {
+	if l != nil {
+		l.Printf(format, v...)
+	}
+}
+
 func (pac *PACType) verify(key types.EncryptionKey) (bool, error) {
+	return pac.verifyWithKeyHandle(keytab.NewKeyHandle(key, 0))
+}
+
+func (pac *PACType) verifyWithKeyHandle(h keytab.KeyHandle) (bool, error) {
 	if pac.KerbValidationInfo == nil {
 		return false, errors.New("PAC Info Buffers does not contain a KerbValidationInfo")
 	}
@@ -236,14 +354,11 @@ func (pac *PACType) verify(key types.EncryptionKey) (bool, error) {
 	if pac.ClientInfo == nil {
 		return false, errors.New("PAC Info Buffers does not contain a ClientInfo")
 	}
-	etype, err := crypto.GetChksumEtype(int32(pac.ServerChecksum.SignatureType))
+	cksum, err := h.Checksum(int32(pac.ServerChecksum.SignatureType), pac.ZeroSigData, keyusage.KERB_NON_KERB_CKSUM_SALT)
 	if err != nil {
 		return false, err
 	}
-	if ok := etype.VerifyChecksum(key.KeyValue,
-		pac.ZeroSigData,
-		pac.ServerChecksum.Signature,
-		keyusage.KERB_NON_KERB_CKSUM_SALT); !ok {
+	if !hmac.Equal(cksum, pac.ServerChecksum.Signature) {
 		return false, errors.New("PAC service checksum verification failed")
 	}
 
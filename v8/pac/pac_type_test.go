@@ -6,7 +6,12 @@ import (
 	"fmt"
 	"log"
 	"testing"
+	"time"
 
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -67,3 +72,212 @@ func TestPACTypeVerify(t *testing.T) {
 	}
 
 }
+
+func TestPACType_BufferOrder(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_AD_WIN2K_PAC)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	kb, _ := hex.DecodeString(testdata.KEYTAB_SYSHTTP_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(kb)
+	pn, _ := types.ParseSPNString("sysHTTP")
+	key, _, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 2, 18)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	var ref PACType
+	err = ref.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	err = ref.ProcessPACInfoBuffers(key, nil)
+	if err != nil {
+		t.Fatalf("Processing reference pac error: %v", err)
+	}
+
+	// Reverse the order of the info buffer headers, as a Samba KDC may order them, and re-sign the PAC.
+	n := int(ref.CBuffers)
+	hdr := make([]byte, 8+n*16)
+	copy(hdr, b)
+	for i := 0; i < n; i++ {
+		copy(b[8+i*16:8+(i+1)*16], hdr[8+(n-1-i)*16:8+(n-i)*16])
+	}
+	var pac PACType
+	err = pac.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling reordered PAC: %v", err)
+	}
+	assert.Equal(t, ref.Buffers[0], pac.Buffers[n-1], "Buffers not reordered")
+	zb := make([]byte, len(b))
+	copy(zb, b)
+	var sigOffset int
+	for _, buf := range pac.Buffers {
+		switch buf.ULType {
+		case infoTypePACServerSignatureData:
+			sigOffset = int(buf.Offset) + 4
+			copy(zb[sigOffset:], make([]byte, len(ref.ServerChecksum.Signature)))
+		case infoTypePACKDCSignatureData:
+			copy(zb[buf.Offset+4:], make([]byte, len(ref.KDCChecksum.Signature)))
+		}
+	}
+	et, err := crypto.GetChksumEtype(int32(ref.ServerChecksum.SignatureType))
+	if err != nil {
+		t.Fatalf("Error getting checksum etype: %v", err)
+	}
+	sig, err := et.GetChecksumHash(key.KeyValue, zb, keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		t.Fatalf("Error signing PAC: %v", err)
+	}
+	copy(b[sigOffset:], sig[:len(ref.ServerChecksum.Signature)])
+
+	err = pac.ProcessPACInfoBuffers(key, nil)
+	if err != nil {
+		t.Fatalf("Processing reordered pac error: %v", err)
+	}
+	assert.Equal(t, ref.KerbValidationInfo.EffectiveName, pac.KerbValidationInfo.EffectiveName, "KerbValidationInfo not as expected")
+	assert.Equal(t, ref.UPNDNSInfo, pac.UPNDNSInfo, "UPNDNSInfo not as expected")
+}
+
+func TestPACType_BufferBounds(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_AD_WIN2K_PAC)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	var pac PACType
+	err = pac.Unmarshal(b[:len(b)-8])
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	err = pac.ProcessPACInfoBuffers(types.EncryptionKey{}, nil)
+	assert.Error(t, err, "expected error for a truncated PAC")
+}
+
+func TestPACType_Unmarshal_BufferCount(t *testing.T) {
+	t.Parallel()
+	// A count of Info Buffers that cannot fit in the data is rejected rather than allocated.
+	b := []byte{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00}
+	var pac PACType
+	err := pac.Unmarshal(b)
+	assert.Error(t, err, "expected error for a count of Info Buffers exceeding the PAC")
+}
+
+func BenchmarkPACType_ProcessPACInfoBuffers(b *testing.B) {
+	v, err := hex.DecodeString(testdata.MarshaledPAC_AD_WIN2K_PAC)
+	if err != nil {
+		b.Fatalf("Test vector read error: %v", err)
+	}
+	kb, _ := hex.DecodeString(testdata.KEYTAB_SYSHTTP_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(kb)
+	pn, _ := types.ParseSPNString("sysHTTP")
+	key, _, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 2, 18)
+	if err != nil {
+		b.Fatalf("Error getting key: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var pac PACType
+		err = pac.Unmarshal(v)
+		if err != nil {
+			b.Fatalf("Error unmarshaling test data: %v", err)
+		}
+		err = pac.ProcessPACInfoBuffers(key, nil)
+		if err != nil {
+			b.Fatalf("Processing reference pac error: %v", err)
+		}
+	}
+}
+
+func TestPACType_VerifyKDCChecksum(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_AD_WIN2K_PAC)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	var pac PACType
+	err = pac.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	b, _ = hex.DecodeString(testdata.KEYTAB_SYSHTTP_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	pn, _ := types.ParseSPNString("sysHTTP")
+	key, _, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 2, 18)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	err = pac.ProcessPACInfoBuffers(key, nil)
+	if err != nil {
+		t.Fatalf("Processing reference pac error: %v", err)
+	}
+	// The key of the test data's KDC is not known so the KDC signature is replaced with one of another KDC key.
+	et, err := pac.KDCChecksum.EType()
+	if err != nil {
+		t.Fatalf("Error getting KDC signature etype: %v", err)
+	}
+	assert.Equal(t, etypeID.RC4_HMAC, et, "KDC signature etype not as expected")
+	e, _ := crypto.GetEtype(et)
+	kdcKey, err := types.GenerateEncryptionKey(e)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	assert.Error(t, pac.VerifyKDCChecksum(kdcKey), "KDC checksum should not verify with another key")
+	sig, err := keytab.NewKeyHandle(kdcKey, 0).Checksum(int32(pac.KDCChecksum.SignatureType), pac.ServerChecksum.Signature, keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		t.Fatalf("Error signing server checksum: %v", err)
+	}
+	pac.KDCChecksum.Signature = sig
+	assert.NoError(t, pac.VerifyKDCChecksum(kdcKey), "KDC checksum should verify with the KDC key")
+	pac.ServerChecksum.Signature[0] ^= 0xFF
+	assert.Error(t, pac.VerifyKDCChecksum(kdcKey), "KDC checksum should not verify for a modified server checksum")
+}
+
+func TestPACType_VerifyClientInfo(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_AD_WIN2K_PAC)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	var pac PACType
+	err = pac.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	b, _ = hex.DecodeString(testdata.KEYTAB_SYSHTTP_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	pn, _ := types.ParseSPNString("sysHTTP")
+	key, _, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 2, 18)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	err = pac.ProcessPACInfoBuffers(key, nil)
+	if err != nil {
+		t.Fatalf("Processing reference pac error: %v", err)
+	}
+	authTime := time.Date(2017, 5, 6, 15, 53, 11, 0, time.UTC)
+	var tests = []struct {
+		cname    types.PrincipalName
+		authTime time.Time
+		valid    bool
+	}{
+		{types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"), authTime, true},
+		{types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "TestUser1"), authTime, true},
+		{types.NewPrincipalName(nametype.KRB_NT_ENTERPRISE, "testuser1@test.gokrb5"), authTime, true},
+		{types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), authTime, false},
+		{types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"), authTime.Add(time.Hour), false},
+	}
+	for i, test := range tests {
+		err := pac.VerifyClientInfo(test.cname, test.authTime)
+		if test.valid {
+			assert.NoError(t, err, "client info should be valid for test %d", i)
+		} else {
+			assert.Error(t, err, "client info should not be valid for test %d", i)
+		}
+	}
+}
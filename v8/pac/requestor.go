@@ -0,0 +1,41 @@
+package pac
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+// Requestor implements the PAC_REQUESTOR, [MS-PAC] section 2.15, holding the SID of the client the ticket's PAC was
+// issued to. It was added to the PACs of TGTs by the November 2021 Windows updates so that a KDC can detect a TGT
+// issued to a different account than the one the PAC describes.
+type Requestor struct {
+	SID mstypes.RPCSID // The SID of the client that requested the ticket.
+}
+
+// Unmarshal bytes into the Requestor struct
+func (k *Requestor) Unmarshal(b []byte) (err error) {
+	//The PAC_REQUESTOR structure is a SID that is not NDR-encoded.
+	k.SID, err = unmarshalSID(b)
+	return
+}
+
+// unmarshalSID decodes a SID, [MS-DTYP] section 2.4.2.2, that is not NDR-encoded.
+func unmarshalSID(b []byte) (s mstypes.RPCSID, err error) {
+	if len(b) < 8 {
+		return s, errors.New("SID too short")
+	}
+	s.Revision = b[0]
+	s.SubAuthorityCount = b[1]
+	copy(s.IdentifierAuthority[:], b[2:8])
+	if len(b) < 8+4*int(s.SubAuthorityCount) {
+		return s, errors.New("SID sub authorities exceed the length of the buffer")
+	}
+	s.SubAuthority = make([]uint32, s.SubAuthorityCount)
+	for i := range s.SubAuthority {
+		// The sub authorities are little-endian, unlike the identifier authority.
+		s.SubAuthority[i] = binary.LittleEndian.Uint32(b[8+4*i:])
+	}
+	return
+}
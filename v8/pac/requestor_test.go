@@ -0,0 +1,26 @@
+package pac
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestor_Unmarshal(t *testing.T) {
+	t.Parallel()
+	// S-1-5-21-3167651404-3865080224-2280184895-1105
+	b, err := hex.DecodeString("010500000000000515000000" + "4c86cebca07160e63fdce88751040000")
+	if err != nil {
+		t.Fatal("Could not decode test data hex string")
+	}
+	var k Requestor
+	err = k.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	assert.Equal(t, "S-1-5-21-3167651404-3865080224-2280184895-1105", k.SID.String(), "SID not as expected")
+
+	err = k.Unmarshal(b[:len(b)-4])
+	assert.Error(t, err, "a truncated SID should be rejected")
+}
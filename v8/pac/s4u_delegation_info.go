@@ -1,7 +1,6 @@
 package pac
 
 import (
-	"bytes"
 	"fmt"
 
 	"github.com/jcmturner/rpc/v2/mstypes"
@@ -15,12 +14,23 @@ type S4UDelegationInfo struct {
 	S4UTransitedServices []mstypes.RPCUnicodeString `ndr:"pointer,conformant"` // List of all services that have been delegated through by this client and subsequent services or servers.. Size is value of TransitedListSize
 }
 
+// GetTransitedServices returns the names of the services that have delegated through S4U2Proxy.
+func (k *S4UDelegationInfo) GetTransitedServices() []string {
+	var s []string
+	for _, t := range k.S4UTransitedServices {
+		s = append(s, t.Value)
+	}
+	return s
+}
+
 // Unmarshal bytes into the S4UDelegationInfo struct
 func (k *S4UDelegationInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	dec := ndr.NewDecoder(buf.reader())
 	err = dec.Decode(k)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling S4UDelegationInfo: %v", err)
+		err = fmt.Errorf("error unmarshaling S4UDelegationInfo: %w", err)
 	}
 	return
 }
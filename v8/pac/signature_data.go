@@ -1,9 +1,10 @@
 package pac
 
 import (
-	"bytes"
+	"fmt"
 
 	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
 	"github.com/jcmturner/rpc/v2/mstypes"
 )
 
@@ -28,7 +29,9 @@ type SignatureData struct {
 
 // Unmarshal bytes into the SignatureData struct
 func (k *SignatureData) Unmarshal(b []byte) (rb []byte, err error) {
-	r := mstypes.NewReader(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	r := mstypes.NewReader(buf.reader())
 
 	k.SignatureType, err = r.Uint32()
 	if err != nil {
@@ -60,8 +63,22 @@ func (k *SignatureData) Unmarshal(b []byte) (rb []byte, err error) {
 	// Create bytes with zeroed signature needed for checksum verification
 	rb = make([]byte, len(b), len(b))
 	copy(rb, b)
-	z := make([]byte, len(b), len(b))
-	copy(rb[4:4+c], z)
+	for i := 4; i < 4+c; i++ {
+		rb[i] = 0
+	}
 
 	return
 }
+
+// EType returns the encryption type of the keys that create signatures of the SignatureType.
+func (k *SignatureData) EType() (int32, error) {
+	switch k.SignatureType {
+	case chksumtype.KERB_CHECKSUM_HMAC_MD5_UNSIGNED:
+		return etypeID.RC4_HMAC, nil
+	case uint32(chksumtype.HMAC_SHA1_96_AES128):
+		return etypeID.AES128_CTS_HMAC_SHA1_96, nil
+	case uint32(chksumtype.HMAC_SHA1_96_AES256):
+		return etypeID.AES256_CTS_HMAC_SHA1_96, nil
+	}
+	return 0, fmt.Errorf("PAC signature type %d not supported", int32(k.SignatureType))
+}
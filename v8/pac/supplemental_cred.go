@@ -1,7 +1,6 @@
 package pac
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -27,7 +26,9 @@ type NTLMSupplementalCred struct {
 
 // Unmarshal converts the bytes provided into a NTLMSupplementalCred.
 func (c *NTLMSupplementalCred) Unmarshal(b []byte) (err error) {
-	r := mstypes.NewReader(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	r := mstypes.NewReader(buf.reader())
 	c.Version, err = r.Uint32()
 	if err != nil {
 		return
@@ -78,10 +79,12 @@ type SECPKGSupplementalCred struct {
 
 // Unmarshal converts the bytes provided into a SECPKGSupplementalCred.
 func (c *SECPKGSupplementalCred) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	dec := ndr.NewDecoder(buf.reader())
 	err = dec.Decode(c)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling SECPKGSupplementalCred: %v", err)
+		err = fmt.Errorf("error unmarshaling SECPKGSupplementalCred: %w", err)
 	}
 	return
 }
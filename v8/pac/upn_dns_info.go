@@ -1,7 +1,7 @@
 package pac
 
 import (
-	"bytes"
+	"errors"
 
 	"github.com/jcmturner/rpc/v2/mstypes"
 )
@@ -13,18 +13,38 @@ type UPNDNSInfo struct {
 	DNSDomainNameLength uint16
 	DNSDomainNameOffset uint16
 	Flags               uint32
+	SamNameLength       uint16 // An unsigned 16-bit integer in little-endian format that specifies the length, in bytes, of the SamName field. Only present if the structure is extended.
+	SamNameOffset       uint16 // An unsigned 16-bit integer in little-endian format that contains the offset to the beginning of the SamName, in bytes, from the beginning of the UPN_DNS_INFO structure.
+	SIDLength           uint16 // An unsigned 16-bit integer in little-endian format that specifies the length, in bytes, of the SID field. Only present if the structure is extended.
+	SIDOffset           uint16 // An unsigned 16-bit integer in little-endian format that contains the offset to the beginning of the SID, in bytes, from the beginning of the UPN_DNS_INFO structure.
 	UPN                 string
 	DNSDomain           string
+	SamName             string         // The sAMAccountName of the client, set by KDCs with the November 2021 Windows updates.
+	SID                 mstypes.RPCSID // The SID of the client, set by KDCs with the November 2021 Windows updates.
 }
 
 const (
-	upnNoUPNAttr = 31 // The user account object does not have the userPrincipalName attribute ([MS-ADA3] section 2.349) set. A UPN constructed by concatenating the user name with the DNS domain name of the account domain is provided.
+	upnNoUPNAttr uint32 = 0x00000001 // The user account object does not have the userPrincipalName attribute ([MS-ADA3] section 2.349) set. A UPN constructed by concatenating the user name with the DNS domain name of the account domain is provided.
+	upnExtended  uint32 = 0x00000002 // The structure is extended with the sAMAccountName and SID of the client.
 )
 
+// HasUPNAttr indicates if the UPN is the userPrincipalName attribute of the user account rather than one constructed
+// from its name and domain.
+func (k *UPNDNSInfo) HasUPNAttr() bool {
+	return k.Flags&upnNoUPNAttr == 0
+}
+
+// Extended indicates if the structure includes the SamName and SID of the client.
+func (k *UPNDNSInfo) Extended() bool {
+	return k.Flags&upnExtended != 0
+}
+
 // Unmarshal bytes into the UPN_DNSInfo struct
 func (k *UPNDNSInfo) Unmarshal(b []byte) (err error) {
 	//The UPN_DNS_INFO structure is a simple structure that is not NDR-encoded.
-	r := mstypes.NewReader(bytes.NewReader(b))
+	buf := newDecodeBuffer(b)
+	defer buf.release()
+	r := mstypes.NewReader(buf.reader())
 	k.UPNLength, err = r.Uint16()
 	if err != nil {
 		return
@@ -45,29 +65,54 @@ func (k *UPNDNSInfo) Unmarshal(b []byte) (err error) {
 	if err != nil {
 		return
 	}
-	ub := mstypes.NewReader(bytes.NewReader(b[k.UPNOffset : k.UPNOffset+k.UPNLength]))
-	db := mstypes.NewReader(bytes.NewReader(b[k.DNSDomainNameOffset : k.DNSDomainNameOffset+k.DNSDomainNameLength]))
+	if k.Extended() {
+		if err = k.unmarshalExtended(r, b); err != nil {
+			return
+		}
+	}
+	if int(k.UPNOffset)+int(k.UPNLength) > len(b) || int(k.DNSDomainNameOffset)+int(k.DNSDomainNameLength) > len(b) {
+		return errors.New("UPN_DNS_INFO names exceed the length of the buffer")
+	}
+	k.UPN, err = utf16Field(b, k.UPNOffset, k.UPNLength)
+	if err != nil {
+		return
+	}
+	k.DNSDomain, err = utf16Field(b, k.DNSDomainNameOffset, k.DNSDomainNameLength)
+	return
+}
 
-	u := make([]rune, k.UPNLength/2, k.UPNLength/2)
-	for i := 0; i < len(u); i++ {
-		var r uint16
-		r, err = ub.Uint16()
+// unmarshalExtended reads the SamName and SID of an extended structure.
+func (k *UPNDNSInfo) unmarshalExtended(r *mstypes.Reader, b []byte) (err error) {
+	for _, v := range []*uint16{&k.SamNameLength, &k.SamNameOffset, &k.SIDLength, &k.SIDOffset} {
+		*v, err = r.Uint16()
 		if err != nil {
 			return
 		}
-		u[i] = rune(r)
 	}
-	k.UPN = string(u)
-	d := make([]rune, k.DNSDomainNameLength/2, k.DNSDomainNameLength/2)
-	for i := 0; i < len(d); i++ {
-		var r uint16
-		r, err = db.Uint16()
+	if int(k.SamNameOffset)+int(k.SamNameLength) > len(b) || int(k.SIDOffset)+int(k.SIDLength) > len(b) {
+		return errors.New("UPN_DNS_INFO SamName and SID exceed the length of the buffer")
+	}
+	k.SamName, err = utf16Field(b, k.SamNameOffset, k.SamNameLength)
+	if err != nil {
+		return
+	}
+	k.SID, err = unmarshalSID(b[k.SIDOffset : int(k.SIDOffset)+int(k.SIDLength)])
+	return
+}
+
+// utf16Field returns the little-endian UTF-16 string of the length, in bytes, at the offset of the buffer.
+func utf16Field(b []byte, offset, length uint16) (s string, err error) {
+	buf := newDecodeBuffer(b[offset : int(offset)+int(length)])
+	defer buf.release()
+	r := mstypes.NewReader(buf.reader())
+	u := make([]rune, length/2, length/2)
+	for i := 0; i < len(u); i++ {
+		var c uint16
+		c, err = r.Uint16()
 		if err != nil {
 			return
 		}
-		d[i] = rune(r)
+		u[i] = rune(c)
 	}
-	k.DNSDomain = string(d)
-
-	return
+	return string(u), nil
 }
@@ -27,3 +27,25 @@ func TestUPN_DNSInfo_Unmarshal(t *testing.T) {
 	assert.Equal(t, "TEST.GOKRB5", k.DNSDomain, "DNS Domain not as expected")
 	assert.Equal(t, uint32(0), k.Flags, "DNS Domain not as expected")
 }
+
+func TestUPN_DNSInfo_Unmarshal_Extended(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString("2a0018001600480002000000120060001c00780000000000740065007300740075007300650072003100400074006500730074002e0067006f006b0072006200350000000000000054004500530054002e0047004f004b0052004200350000007400650073007400750073006500720031000000000000000105000000000005150000004c86cebca07160e63fdce88751040000")
+	if err != nil {
+		t.Fatal("Could not decode test data hex string")
+	}
+	var k UPNDNSInfo
+	err = k.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	assert.True(t, k.Extended(), "UPN_DNS_INFO should be extended")
+	assert.True(t, k.HasUPNAttr(), "UPN should be the userPrincipalName attribute")
+	assert.Equal(t, "testuser1@test.gokrb5", k.UPN, "UPN not as expected")
+	assert.Equal(t, "TEST.GOKRB5", k.DNSDomain, "DNS Domain not as expected")
+	assert.Equal(t, "testuser1", k.SamName, "SAM name not as expected")
+	assert.Equal(t, "S-1-5-21-3167651404-3865080224-2280184895-1105", k.SID.String(), "SID not as expected")
+
+	err = k.Unmarshal(b[:len(b)-8])
+	assert.Error(t, err, "a SID exceeding the buffer should be rejected")
+}
@@ -0,0 +1,184 @@
+package pac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+const (
+	// xpressHuffSymbols is the number of symbols of the Huffman code, the 256 literals and 256 match symbols.
+	xpressHuffSymbols = 512
+	// xpressHuffMaxBits is the maximum length of a Huffman code.
+	xpressHuffMaxBits = 15
+	// xpressHuffBlockSize is the number of bytes decompressed with each Huffman table.
+	xpressHuffBlockSize = 65536
+	// maxUncompressedClaimsSize limits the size of the decompressed claims.
+	maxUncompressedClaimsSize = 1 << 24
+)
+
+// claimsSet returns the CLAIMS_SET of the metadata, decompressing it if it is compressed with the LZ77+Huffman
+// format that Active Directory uses for large claims sets. The mstypes package does not decompress this format.
+func claimsSet(m mstypes.ClaimsSetMetadata) (mstypes.ClaimsSet, error) {
+	if m.CompressionFormat == mstypes.CompressionFormatXPressHuff {
+		b, err := decompressXPressHuff(m.ClaimsSetBytes, int(m.UncompressedClaimsSetSize))
+		if err != nil {
+			return mstypes.ClaimsSet{}, fmt.Errorf("error decompressing ClaimsSet: %w", err)
+		}
+		m.ClaimsSetBytes = b
+		m.CompressionFormat = mstypes.CompressionFormatNone
+	}
+	return m.ClaimsSet()
+}
+
+// xpressHuffReader reads the bit stream and bytes of LZ77+Huffman compressed data, [MS-XCA] section 2.2.
+type xpressHuffReader struct {
+	b        []byte
+	pos      int
+	bits     uint32
+	bitCount int
+}
+
+// uint16 returns the next little-endian 16 bits of the input, or zero past its end as the bit stream may be read
+// beyond the last symbol.
+func (r *xpressHuffReader) uint16() uint32 {
+	if r.pos+2 > len(r.b) {
+		r.pos = len(r.b)
+		return 0
+	}
+	v := binary.LittleEndian.Uint16(r.b[r.pos:])
+	r.pos += 2
+	return uint32(v)
+}
+
+// byte returns the next byte of the input.
+func (r *xpressHuffReader) byte() (int, error) {
+	if r.pos >= len(r.b) {
+		return 0, errors.New("unexpected end of compressed data")
+	}
+	v := r.b[r.pos]
+	r.pos++
+	return int(v), nil
+}
+
+// reset starts the bit stream at the current position.
+func (r *xpressHuffReader) reset() {
+	r.bits = r.uint16()<<16 | r.uint16()
+	r.bitCount = 16
+}
+
+// peek returns the next n bits of the bit stream.
+func (r *xpressHuffReader) peek(n int) uint32 {
+	if n == 0 {
+		return 0
+	}
+	return r.bits >> uint(32-n)
+}
+
+// consume removes n bits from the bit stream.
+func (r *xpressHuffReader) consume(n int) {
+	r.bits <<= uint(n)
+	r.bitCount -= n
+	if r.bitCount < 0 {
+		r.bits |= r.uint16() << uint(-r.bitCount)
+		r.bitCount += 16
+	}
+}
+
+// decompressXPressHuff decompresses the LZ77+Huffman compressed data, [MS-XCA] section 2.2.4, of the uncompressed
+// size.
+func decompressXPressHuff(b []byte, size int) ([]byte, error) {
+	if size < 0 || size > maxUncompressedClaimsSize {
+		return nil, fmt.Errorf("uncompressed size %d not valid", size)
+	}
+	out := make([]byte, 0, size)
+	r := &xpressHuffReader{b: b}
+	for len(out) < size {
+		if len(b)-r.pos < xpressHuffSymbols/2 {
+			return nil, errors.New("compressed data too short for Huffman table")
+		}
+		lengths, table, err := xpressHuffTable(b[r.pos : r.pos+xpressHuffSymbols/2])
+		if err != nil {
+			return nil, err
+		}
+		r.pos += xpressHuffSymbols / 2
+		r.reset()
+		blockEnd := len(out) + xpressHuffBlockSize
+		for len(out) < blockEnd && len(out) < size {
+			sym := int(table[r.peek(xpressHuffMaxBits)])
+			r.consume(int(lengths[sym]))
+			if sym < 256 {
+				out = append(out, byte(sym))
+				continue
+			}
+			sym -= 256
+			length := sym & 0xf
+			offsetBits := sym >> 4
+			if length == 15 {
+				if length, err = r.byte(); err != nil {
+					return nil, err
+				}
+				if length == 255 {
+					lo, err := r.byte()
+					if err != nil {
+						return nil, err
+					}
+					hi, err := r.byte()
+					if err != nil {
+						return nil, err
+					}
+					length = hi<<8 | lo
+					if length < 15 {
+						return nil, errors.New("invalid match length")
+					}
+					length -= 15
+				}
+				length += 15
+			}
+			length += 3
+			offset := int(r.peek(offsetBits)) + 1<<uint(offsetBits)
+			r.consume(offsetBits)
+			if offset > len(out) {
+				return nil, errors.New("match offset before the start of the data")
+			}
+			// The match may overlap the bytes it copies so they are copied one at a time.
+			for i := 0; i < length && len(out) < size; i++ {
+				out = append(out, out[len(out)-offset])
+			}
+		}
+	}
+	return out, nil
+}
+
+// xpressHuffTable returns the code lengths of the symbols of the 256 byte Huffman table and the table decoding the
+// next 15 bits of the bit stream into a symbol.
+func xpressHuffTable(b []byte) ([]uint8, []uint16, error) {
+	lengths := make([]uint8, xpressHuffSymbols)
+	for i := range lengths {
+		lengths[i] = b[i/2] >> uint(4*(i%2)) & 0xf
+	}
+	table := make([]uint16, 1<<xpressHuffMaxBits)
+	pos := 0
+	// Canonical codes are assigned in order of length and then of symbol.
+	for l := 1; l <= xpressHuffMaxBits; l++ {
+		for sym, sl := range lengths {
+			if int(sl) != l {
+				continue
+			}
+			n := 1 << uint(xpressHuffMaxBits-l)
+			if pos+n > len(table) {
+				return nil, nil, errors.New("invalid Huffman table")
+			}
+			for i := pos; i < pos+n; i++ {
+				table[i] = uint16(sym)
+			}
+			pos += n
+		}
+	}
+	if pos == 0 {
+		return nil, nil, errors.New("empty Huffman table")
+	}
+	return lengths, table, nil
+}
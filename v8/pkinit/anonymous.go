@@ -0,0 +1,84 @@
+package pkinit
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"math/big"
+
+	krbcrypto "github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// AnonymousRealm is the RFC 8062 anonymous realm the KDC issues anonymous tickets for.
+const AnonymousRealm = "WELLKNOWN:ANONYMOUS"
+
+// AnonymousPrincipalName returns the RFC 8062 anonymous principal name WELLKNOWN/ANONYMOUS.
+func AnonymousPrincipalName() types.PrincipalName {
+	return types.PrincipalName{
+		NameType:   nametype.KRB_NT_WELLKNOWN,
+		NameString: []string{"WELLKNOWN", "ANONYMOUS"},
+	}
+}
+
+// NewAnonymousRequest returns a PKINIT request for an anonymous AS exchange, RFC 8062. The client has no certificate
+// so the KDC is authenticated by its certificate, which must chain to one of the roots provided; if roots is nil the
+// system's trust anchors are used.
+func NewAnonymousRequest(roots *x509.CertPool) *Request {
+	return &Request{
+		roots:     roots,
+		anonymous: true,
+		p:         modp2048,
+		g:         big.NewInt(2),
+	}
+}
+
+// Anonymous reports if the request is for an anonymous AS exchange.
+func (r *Request) Anonymous() bool {
+	return r.anonymous
+}
+
+// VerifyKeyExchange verifies the KDC's PA-PKINIT-KX in the PA data of the AS_REP to an anonymous request, RFC 8062
+// section 7. The AS_REP's encrypted part must have been decrypted with the reply key provided. The session key of the
+// ticket must be derived from both the reply key and the KDC's contribution so that it is not solely determined by
+// the anonymous client.
+func VerifyKeyExchange(asRep *messages.ASRep, replyKey types.EncryptionKey) error {
+	var b []byte
+	for _, pa := range asRep.PAData {
+		if pa.PADataType == patype.PA_PKINIT_KX {
+			b = pa.PADataValue
+			break
+		}
+	}
+	if b == nil {
+		return krberror.WithKind(errors.New("AS_REP to anonymous request does not contain PA-PKINIT-KX"), krberror.KindProtocol)
+	}
+	var ed types.EncryptedData
+	err := ed.Unmarshal(b)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PKINIT-KX")
+	}
+	db, err := krbcrypto.DecryptEncPart(ed, replyKey, keyusage.KEY_USAGE_PA_PKINIT_KX)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting PA-PKINIT-KX")
+	}
+	var kdcKey types.EncryptionKey
+	err = kdcKey.Unmarshal(db)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PKINIT-KX key")
+	}
+	sk, err := krbcrypto.KrbFxCf2(kdcKey, replyKey, "PKINIT", "KeyExchange")
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error deriving anonymous PKINIT session key")
+	}
+	key := asRep.DecryptedEncPart.Key
+	if sk.KeyType != key.KeyType || !bytes.Equal(sk.KeyValue, key.KeyValue) {
+		return krberror.WithKind(errors.New("session key is not derived from the KDC's PA-PKINIT-KX contribution"), krberror.KindProtocol)
+	}
+	return nil
+}
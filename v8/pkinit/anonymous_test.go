@@ -0,0 +1,105 @@
+package pkinit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testKeyExchange returns the KDC's PA-PKINIT-KX for its contribution to the session key and the session key derived.
+func testKeyExchange(t *testing.T, replyKey types.EncryptionKey) (types.PAData, types.EncryptionKey) {
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	kdcKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("error generating KDC contribution key: %v", err)
+	}
+	sk, err := crypto.KrbFxCf2(kdcKey, replyKey, "PKINIT", "KeyExchange")
+	if err != nil {
+		t.Fatalf("error deriving session key: %v", err)
+	}
+	kb, _ := asn1.Marshal(kdcKey)
+	ed, err := crypto.GetEncryptedData(kb, replyKey, keyusage.KEY_USAGE_PA_PKINIT_KX, 0)
+	if err != nil {
+		t.Fatalf("error encrypting PA-PKINIT-KX: %v", err)
+	}
+	b, _ := ed.Marshal()
+	return types.PAData{PADataType: patype.PA_PKINIT_KX, PADataValue: b}, sk
+}
+
+func TestAnonymousRequest(t *testing.T) {
+	t.Parallel()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := testCertificate(t, "Test CA", caKey, nil, nil)
+	kdcKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	kdcCert := testCertificate(t, "kdc.test.gokrb5", kdcKey, ca, caKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	asReq, err := messages.NewASReqForTGT("TEST.GOKRB5", config.New(), AnonymousPrincipalName())
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	r := NewAnonymousRequest(roots)
+	assert.True(t, r.Anonymous(), "request should be anonymous")
+	pa, err := r.PAData(&asReq)
+	if err != nil {
+		t.Fatalf("error generating PKINIT PA data: %v", err)
+	}
+	asReq.PAData = types.PADataSequence{pa}
+
+	// The AuthPack is sent without signers or certificates.
+	var pkReq PAPKASReq
+	_, err = asn1.Unmarshal(pa.PADataValue, &pkReq)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-PK-AS-REQ: %v", err)
+	}
+	var ci contentInfo
+	_, err = asn1.Unmarshal(pkReq.SignedAuthPack, &ci)
+	if err != nil {
+		t.Fatalf("error unmarshaling content info: %v", err)
+	}
+	sd, err := parseSignedData(ci.Content.Bytes)
+	if err != nil {
+		t.Fatalf("error unmarshaling signed data: %v", err)
+	}
+	assert.Len(t, sd.SignerInfos.Bytes, 0, "anonymous AuthPack should not have signers")
+	assert.Len(t, sd.Certificates.Bytes, 0, "anonymous AuthPack should not have certificates")
+
+	rep, replyKey := testKDC(t, asReq, kdcCert, kdcKey, asReq.ReqBody.Nonce)
+	asRep := messages.ASRep{KDCRepFields: messages.KDCRepFields{
+		PAData:  types.PADataSequence{rep},
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96},
+	}}
+	key, err := r.ReplyKey(&asRep)
+	if err != nil {
+		t.Fatalf("error getting reply key: %v", err)
+	}
+	assert.Equal(t, replyKey, key, "reply key not as expected")
+
+	kx, sk := testKeyExchange(t, replyKey)
+	asRep.PAData = append(asRep.PAData, kx)
+	asRep.DecryptedEncPart.Key = sk
+	assert.NoError(t, VerifyKeyExchange(&asRep, key), "key exchange should verify")
+
+	// The session key must include the KDC's contribution.
+	asRep.DecryptedEncPart.Key = replyKey
+	err = VerifyKeyExchange(&asRep, key)
+	assert.Equal(t, krberror.KindProtocol, krberror.ErrorKind(err), "session key without the KDC's contribution should be rejected: %v", err)
+
+	asRep.PAData = types.PADataSequence{rep}
+	err = VerifyKeyExchange(&asRep, key)
+	assert.Equal(t, krberror.KindProtocol, krberror.ErrorKind(err), "AS_REP without PA-PKINIT-KX should be rejected: %v", err)
+}
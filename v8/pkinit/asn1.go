@@ -0,0 +1,76 @@
+package pkinit
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// Object identifiers used by PKINIT.
+var (
+	oidAuthData       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 1}
+	oidDHKeyData      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 2}
+	oidKPKdc          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 5}
+	oidDHPublicNumber = asn1.ObjectIdentifier{1, 2, 840, 10046, 2, 1}
+)
+
+// PAPKASReq implements RFC 4556 PA-PK-AS-REQ.
+type PAPKASReq struct {
+	SignedAuthPack    []byte          `asn1:"tag:0"`
+	TrustedCertifiers []asn1.RawValue `asn1:"explicit,optional,tag:1"`
+	KDCPkID           []byte          `asn1:"optional,tag:2"`
+}
+
+// AuthPack implements RFC 4556 AuthPack, the content signed by the client.
+type AuthPack struct {
+	PKAuthenticator   PKAuthenticator       `asn1:"explicit,tag:0"`
+	ClientPublicValue subjectPublicKeyInfo  `asn1:"explicit,optional,tag:1"`
+	SupportedCMSTypes []algorithmIdentifier `asn1:"explicit,optional,tag:2"`
+	ClientDHNonce     []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// PKAuthenticator implements RFC 4556 PKAuthenticator.
+type PKAuthenticator struct {
+	Cusec      int       `asn1:"explicit,tag:0"`
+	CTime      time.Time `asn1:"generalized,explicit,tag:1"`
+	Nonce      int       `asn1:"explicit,tag:2"`
+	PAChecksum []byte    `asn1:"explicit,optional,tag:3"`
+}
+
+// DHRepInfo implements RFC 4556 DHRepInfo, returned in the dhInfo choice of PA-PK-AS-REP.
+type DHRepInfo struct {
+	DHSignedData  []byte        `asn1:"tag:0"`
+	ServerDHNonce []byte        `asn1:"explicit,optional,tag:1"`
+	KDFID         asn1.RawValue `asn1:"explicit,optional,tag:2"`
+}
+
+// KDCDHKeyInfo implements RFC 4556 KDCDHKeyInfo, the content signed by the KDC.
+type KDCDHKeyInfo struct {
+	SubjectPublicKey asn1.BitString `asn1:"explicit,tag:0"`
+	Nonce            int            `asn1:"explicit,tag:1"`
+	DHKeyExpiration  time.Time      `asn1:"generalized,explicit,optional,tag:2"`
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm        algorithmIdentifier
+	SubjectPublicKey asn1.BitString
+}
+
+// domainParameters are the X9.42 Diffie-Hellman domain parameters of RFC 3279.
+type domainParameters struct {
+	P *big.Int
+	G *big.Int
+	Q *big.Int
+}
+
+// PA-PK-AS-REP is a CHOICE so the tag of the value identifies the form of the reply.
+const (
+	paPKASRepDHInfoTag     = 0
+	paPKASRepEncKeyPackTag = 1
+)
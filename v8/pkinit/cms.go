@@ -0,0 +1,432 @@
+package pkinit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// The subset of RFC 5652 Cryptographic Message Syntax used by PKINIT to carry signed data.
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1WithRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// The SET OF and explicitly tagged fields are held as raw values as the asn1 package does not marshal them as
+// required.
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    algorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm algorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// set returns the raw value of a SET OF the DER encoded elements, sorted as DER requires.
+func set(elements ...[]byte) asn1.RawValue {
+	sort.Slice(elements, func(i, j int) bool { return bytes.Compare(elements[i], elements[j]) < 0 })
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(elements, nil)}
+}
+
+// signData returns the DER encoding of a CMS ContentInfo holding the content signed with the key of the certificate.
+func signData(content []byte, contentType asn1.ObjectIdentifier, cert *x509.Certificate, key crypto.Signer) ([]byte, error) {
+	var sigAlg asn1.ObjectIdentifier
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = oidSHA256WithRSA
+	case *ecdsa.PublicKey:
+		sigAlg = oidECDSAWithSHA256
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key.Public())
+	}
+	if !samePublicKey(key.Public(), cert.PublicKey) {
+		return nil, errors.New("signing key is not the private key of the certificate")
+	}
+	h := crypto.SHA256.New()
+	h.Write(content)
+	attrs, err := signedAttributes(contentType, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	h = crypto.SHA256.New()
+	h.Write(attrs.set)
+	sig, err := key.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error signing content: %w", err)
+	}
+	digestAlg := algorithmIdentifier{Algorithm: oidSHA256}
+	dab, err := asn1.Marshal(digestAlg)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling digest algorithm: %w", err)
+	}
+	sib, err := asn1.Marshal(signerInfo{
+		Version: 1,
+		SID: issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+			SerialNumber: cert.SerialNumber,
+		},
+		DigestAlgorithm:    digestAlg,
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs.content},
+		SignatureAlgorithm: algorithmIdentifier{Algorithm: sigAlg},
+		Signature:          sig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling signer info: %w", err)
+	}
+	return marshalSignedData(signedData{
+		Version:          3,
+		DigestAlgorithms: set(dab),
+		EncapContentInfo: encapsulatedContentInfo{EContentType: contentType, EContent: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos:      set(sib),
+	})
+}
+
+// samePublicKey reports if the RSA or ECDSA public keys are the same, such as those of a token's signer and the
+// certificate it was loaded with.
+func samePublicKey(a, b crypto.PublicKey) bool {
+	switch a := a.(type) {
+	case *rsa.PublicKey:
+		b, ok := b.(*rsa.PublicKey)
+		return ok && a.N.Cmp(b.N) == 0 && a.E == b.E
+	case *ecdsa.PublicKey:
+		b, ok := b.(*ecdsa.PublicKey)
+		return ok && a.Curve == b.Curve && a.X.Cmp(b.X) == 0 && a.Y.Cmp(b.Y) == 0
+	}
+	return false
+}
+
+// unsignedData returns the DER encoding of a CMS ContentInfo holding the content as signed data without any signers
+// or certificates, as sent by an anonymous client, RFC 8062 section 4.1.
+func unsignedData(content []byte, contentType asn1.ObjectIdentifier) ([]byte, error) {
+	return marshalSignedData(signedData{
+		Version:          3,
+		DigestAlgorithms: set(),
+		EncapContentInfo: encapsulatedContentInfo{EContentType: contentType, EContent: content},
+		SignerInfos:      set(),
+	})
+}
+
+// marshalSignedData returns the DER encoding of a CMS ContentInfo holding the signed data.
+func marshalSignedData(sd signedData) ([]byte, error) {
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling signed data: %w", err)
+	}
+	b, err = asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling content info: %w", err)
+	}
+	return b, nil
+}
+
+// encodedAttributes holds signed attributes both as the contents of the SET, as carried in the SignerInfo, and as
+// the DER encoded SET, over which the signature is calculated.
+type encodedAttributes struct {
+	content []byte
+	set     []byte
+}
+
+// signedAttributes returns the content type and message digest signed attributes.
+func signedAttributes(contentType asn1.ObjectIdentifier, digest []byte) (encodedAttributes, error) {
+	var ea encodedAttributes
+	ct, err := asn1.Marshal(contentType)
+	if err != nil {
+		return ea, fmt.Errorf("error marshaling content type attribute: %w", err)
+	}
+	md, err := asn1.Marshal(digest)
+	if err != nil {
+		return ea, fmt.Errorf("error marshaling message digest attribute: %w", err)
+	}
+	var encoded [][]byte
+	for _, a := range []attribute{
+		{Type: oidContentType, Values: set(ct)},
+		{Type: oidMessageDigest, Values: set(md)},
+	} {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return ea, fmt.Errorf("error marshaling signed attribute: %w", err)
+		}
+		encoded = append(encoded, b)
+	}
+	attrs := set(encoded...)
+	ea.content = attrs.Bytes
+	ea.set, err = asn1.Marshal(attrs)
+	if err != nil {
+		return ea, fmt.Errorf("error marshaling signed attributes: %w", err)
+	}
+	return ea, nil
+}
+
+// verifiedData is the content of CMS signed data whose signature has been verified.
+type verifiedData struct {
+	contentType  asn1.ObjectIdentifier
+	content      []byte
+	signer       *x509.Certificate
+	certificates []*x509.Certificate
+}
+
+// verifySignedData verifies the signature of the CMS ContentInfo holding signed data and returns the content. The
+// signer's certificate must be included in the signed data. The certificate is not verified against any trust
+// anchors.
+func verifySignedData(b []byte) (verifiedData, error) {
+	var vd verifiedData
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(b, &ci)
+	if err != nil {
+		return vd, fmt.Errorf("error unmarshaling content info: %w", err)
+	}
+	if len(rest) > 0 {
+		return vd, errors.New("trailing data after content info")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return vd, fmt.Errorf("content info is not signed data: %v", ci.ContentType)
+	}
+	if ci.Content.Class != asn1.ClassContextSpecific || ci.Content.Tag != 0 {
+		return vd, errors.New("content info does not have content")
+	}
+	sd, err := parseSignedData(ci.Content.Bytes)
+	if err != nil {
+		return vd, fmt.Errorf("error unmarshaling signed data: %w", err)
+	}
+	vd.contentType = sd.EncapContentInfo.EContentType
+	vd.content = sd.EncapContentInfo.EContent
+	if len(sd.Certificates.Bytes) > 0 {
+		vd.certificates, err = x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return vd, fmt.Errorf("error parsing signed data certificates: %w", err)
+		}
+	}
+	var si signerInfo
+	rest, err = asn1.Unmarshal(sd.SignerInfos.Bytes, &si)
+	if err != nil {
+		return vd, fmt.Errorf("error unmarshaling signer info: %w", err)
+	}
+	if len(rest) > 0 {
+		return vd, errors.New("signed data has more than one signer")
+	}
+	if si.SignedAttrs.Class != asn1.ClassContextSpecific || si.SignedAttrs.Tag != 0 {
+		return vd, errors.New("signer info does not have signed attributes")
+	}
+	for _, c := range vd.certificates {
+		if bytes.Equal(c.RawIssuer, si.SID.Issuer.FullBytes) && c.SerialNumber.Cmp(si.SID.SerialNumber) == 0 {
+			vd.signer = c
+			break
+		}
+	}
+	if vd.signer == nil {
+		return vd, errors.New("certificate of the signer is not included in the signed data")
+	}
+	hash, err := digestHash(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return vd, err
+	}
+	signed := vd.content
+	if len(si.SignedAttrs.Bytes) > 0 {
+		if err := checkSignedAttributes(si.SignedAttrs.Bytes, vd.contentType, hash, vd.content); err != nil {
+			return vd, err
+		}
+		signed, err = asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: si.SignedAttrs.Bytes})
+		if err != nil {
+			return vd, fmt.Errorf("error marshaling signed attributes: %w", err)
+		}
+	}
+	alg, err := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, hash)
+	if err != nil {
+		return vd, err
+	}
+	if err := vd.signer.CheckSignature(alg, signed, si.Signature); err != nil {
+		return vd, fmt.Errorf("signature of signed data is not valid: %w", err)
+	}
+	return vd, nil
+}
+
+// parseSignedData unmarshals the DER encoding of SignedData. The optional certificates and CRLs precede the signer
+// infos, and are identified by their tags, so the elements of the sequence are unmarshaled individually.
+func parseSignedData(b []byte) (signedData, error) {
+	var sd signedData
+	var seq asn1.RawValue
+	_, err := asn1.Unmarshal(b, &seq)
+	if err != nil {
+		return sd, err
+	}
+	var elements []asn1.RawValue
+	for rest := seq.Bytes; len(rest) > 0; {
+		var e asn1.RawValue
+		rest, err = asn1.Unmarshal(rest, &e)
+		if err != nil {
+			return sd, err
+		}
+		elements = append(elements, e)
+	}
+	if len(elements) < 4 {
+		return sd, errors.New("signed data does not have the required fields")
+	}
+	if _, err := asn1.Unmarshal(elements[0].FullBytes, &sd.Version); err != nil {
+		return sd, err
+	}
+	sd.DigestAlgorithms = elements[1]
+	if _, err := asn1.Unmarshal(elements[2].FullBytes, &sd.EncapContentInfo); err != nil {
+		return sd, err
+	}
+	for _, e := range elements[3:] {
+		switch {
+		case e.Class == asn1.ClassContextSpecific && e.Tag == 0:
+			sd.Certificates = e
+		case e.Class == asn1.ClassContextSpecific && e.Tag == 1:
+			sd.CRLs = e
+		case e.Class == asn1.ClassUniversal && e.Tag == asn1.TagSet:
+			sd.SignerInfos = e
+		default:
+			return sd, fmt.Errorf("unexpected element in signed data with tag %d", e.Tag)
+		}
+	}
+	return sd, nil
+}
+
+// checkSignedAttributes checks the content type and message digest signed attributes match the content.
+func checkSignedAttributes(b []byte, contentType asn1.ObjectIdentifier, hash crypto.Hash, content []byte) error {
+	var ct, md bool
+	for len(b) > 0 {
+		var a attribute
+		var err error
+		b, err = asn1.Unmarshal(b, &a)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling signed attribute: %w", err)
+		}
+		switch {
+		case a.Type.Equal(oidContentType):
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &oid); err != nil || !oid.Equal(contentType) {
+				return errors.New("content type signed attribute does not match the content")
+			}
+			ct = true
+		case a.Type.Equal(oidMessageDigest):
+			var d []byte
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &d); err != nil {
+				return fmt.Errorf("error unmarshaling message digest signed attribute: %w", err)
+			}
+			h := hash.New()
+			h.Write(content)
+			if !bytes.Equal(h.Sum(nil), d) {
+				return errors.New("message digest signed attribute does not match the content")
+			}
+			md = true
+		}
+	}
+	if !ct || !md {
+		return errors.New("signed data does not have the content type and message digest signed attributes")
+	}
+	return nil
+}
+
+// digestHash returns the hash for the digest algorithm.
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %v", oid)
+}
+
+// signatureAlgorithm returns the x509 signature algorithm for the signature algorithm identifier of a SignerInfo.
+// The rsaEncryption identifier is permitted with the digest algorithm determining the hash.
+func signatureAlgorithm(oid asn1.ObjectIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch {
+	case oid.Equal(oidRSAEncryption):
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case oid.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA, nil
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case oid.Equal(oidECDSAWithSHA1):
+		return x509.ECDSAWithSHA1, nil
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %v", oid)
+}
@@ -0,0 +1,252 @@
+// Package pkinit implements the client side of RFC 4556 Public Key Cryptography for Initial Authentication in
+// Kerberos (PKINIT) so that an AS exchange can be authenticated with an X.509 certificate and its private key, such
+// as those held on a smartcard or issued by AD CS, rather than a password or keytab.
+//
+// The reply key is agreed using Diffie-Hellman with the 2048-bit MODP group of RFC 3526. The KDC's signature over
+// its Diffie-Hellman public value is verified and its certificate must chain to the trust anchors provided.
+//
+// Anonymous PKINIT, RFC 8062, is supported with NewAnonymousRequest so that a client without any credentials can
+// obtain an anonymous TGT, such as for use as a FAST armor ticket.
+package pkinit
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	krbcrypto "github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// modp2048 is the RFC 3526 2048-bit MODP group, which is a safe prime with a generator of 2.
+var modp2048, _ = new(big.Int).SetString(
+	"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"+
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B"+
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510"+
+		"15728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+
+// Request holds the client's certificate and the Diffie-Hellman state of a PKINIT AS exchange.
+type Request struct {
+	cert      *x509.Certificate
+	key       crypto.Signer
+	roots     *x509.CertPool
+	anonymous bool
+	p         *big.Int
+	g         *big.Int
+	x         *big.Int
+	nonce     int
+}
+
+// NewRequest returns a PKINIT request for the client certificate and its private key. The KDC's certificate must
+// chain to one of the roots provided; if roots is nil the system's trust anchors are used.
+func NewRequest(cert *x509.Certificate, key crypto.Signer, roots *x509.CertPool) *Request {
+	return &Request{
+		cert:  cert,
+		key:   key,
+		roots: roots,
+		p:     modp2048,
+		g:     big.NewInt(2),
+	}
+}
+
+// PAData returns the PA-PK-AS-REQ pre-authentication data for the AS_REQ. A new Diffie-Hellman key is generated
+// each time so the PA data must be generated once the request body is final, and the reply key is derived from the
+// PA data generated last.
+func (r *Request) PAData(asReq *messages.ASReq) (types.PAData, error) {
+	var pa types.PAData
+	rb, err := asReq.ReqBody.Marshal()
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ body for PKINIT checksum")
+	}
+	q := new(big.Int).Rsh(r.p, 1)
+	x, err := rand.Int(rand.Reader, q)
+	if err != nil {
+		return pa, fmt.Errorf("error generating Diffie-Hellman private key: %w", err)
+	}
+	x.Add(x, big.NewInt(2))
+	y := new(big.Int).Exp(r.g, x, r.p)
+	pub, err := asn1.Marshal(y)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error marshaling Diffie-Hellman public value")
+	}
+	params, err := asn1.Marshal(domainParameters{P: r.p, G: r.g, Q: q})
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error marshaling Diffie-Hellman domain parameters")
+	}
+	now := time.Now().UTC()
+	sum := sha1.Sum(rb)
+	ap := AuthPack{
+		PKAuthenticator: PKAuthenticator{
+			Cusec:      now.Nanosecond() / 1000,
+			CTime:      now.Truncate(time.Second),
+			Nonce:      asReq.ReqBody.Nonce,
+			PAChecksum: sum[:],
+		},
+		ClientPublicValue: subjectPublicKeyInfo{
+			Algorithm: algorithmIdentifier{
+				Algorithm:  oidDHPublicNumber,
+				Parameters: asn1.RawValue{FullBytes: params},
+			},
+			SubjectPublicKey: asn1.BitString{Bytes: pub, BitLength: len(pub) * 8},
+		},
+	}
+	apb, err := asn1.Marshal(ap)
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error marshaling PKINIT AuthPack")
+	}
+	var sd []byte
+	if r.anonymous {
+		sd, err = unsignedData(apb, oidAuthData)
+	} else {
+		sd, err = signData(apb, oidAuthData, r.cert, r.key)
+	}
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncryptingError, "error signing PKINIT AuthPack")
+	}
+	b, err := asn1.Marshal(PAPKASReq{SignedAuthPack: sd})
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REQ")
+	}
+	r.x = x
+	r.nonce = asReq.ReqBody.Nonce
+	return types.PAData{PADataType: patype.PA_PK_AS_REQ, PADataValue: b}, nil
+}
+
+// ReplyKey verifies the KDC's PA-PK-AS-REP in the AS_REP's PA data and returns the key the AS_REP's encrypted part
+// is encrypted with.
+func (r *Request) ReplyKey(asRep *messages.ASRep) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	if r.x == nil {
+		return key, errors.New("PKINIT PA data has not been generated for the request")
+	}
+	var rep []byte
+	for _, pa := range asRep.PAData {
+		if pa.PADataType == patype.PA_PK_AS_REP {
+			rep = pa.PADataValue
+			break
+		}
+	}
+	if rep == nil {
+		return key, krberror.WithKind(errors.New("AS_REP does not contain PA-PK-AS-REP"), krberror.KindProtocol)
+	}
+	var choice asn1.RawValue
+	_, err := asn1.Unmarshal(rep, &choice)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PK-AS-REP")
+	}
+	if choice.Class != asn1.ClassContextSpecific || choice.Tag != paPKASRepDHInfoTag {
+		if choice.Tag == paPKASRepEncKeyPackTag {
+			return key, krberror.WithKind(errors.New("KDC replied using RSA key transport which is not supported"), krberror.KindCryptoPolicy)
+		}
+		return key, krberror.WithKind(fmt.Errorf("unexpected PA-PK-AS-REP choice %d", choice.Tag), krberror.KindProtocol)
+	}
+	var dh DHRepInfo
+	_, err = asn1.Unmarshal(choice.Bytes, &dh)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PKINIT DHRepInfo")
+	}
+	if len(dh.KDFID.FullBytes) > 0 {
+		return key, krberror.WithKind(errors.New("KDC replied using a key derivation function that was not requested"), krberror.KindProtocol)
+	}
+	vd, err := verifySignedData(dh.DHSignedData)
+	if err != nil {
+		return key, krberror.WithKind(fmt.Errorf("error verifying KDC signed data: %w", err), krberror.KindCredentials)
+	}
+	if err := r.verifyKDCCertificate(vd); err != nil {
+		return key, krberror.WithKind(err, krberror.KindCredentials)
+	}
+	if !vd.contentType.Equal(oidDHKeyData) {
+		return key, krberror.WithKind(fmt.Errorf("KDC signed data content is not DH key data: %v", vd.contentType), krberror.KindProtocol)
+	}
+	var ki KDCDHKeyInfo
+	_, err = asn1.Unmarshal(vd.content, &ki)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PKINIT KDCDHKeyInfo")
+	}
+	if ki.Nonce != r.nonce {
+		return key, krberror.WithKind(errors.New("nonce in KDC DH key info does not match that in the request"), krberror.KindProtocol)
+	}
+	y := new(big.Int)
+	_, err = asn1.Unmarshal(ki.SubjectPublicKey.Bytes, &y)
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC Diffie-Hellman public value")
+	}
+	pm1 := new(big.Int).Sub(r.p, big.NewInt(1))
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(pm1) >= 0 {
+		return key, krberror.WithKind(errors.New("KDC Diffie-Hellman public value is not valid"), krberror.KindProtocol)
+	}
+	// The shared secret is represented as an octet string of the length of the prime.
+	zz := make([]byte, (r.p.BitLen()+7)/8)
+	z := new(big.Int).Exp(y, r.x, r.p).Bytes()
+	copy(zz[len(zz)-len(z):], z)
+	if len(dh.ServerDHNonce) > 0 {
+		return key, krberror.WithKind(errors.New("KDC replied with a DH nonce but none was requested"), krberror.KindProtocol)
+	}
+	return OctetString2Key(zz, asRep.EncPart.EType)
+}
+
+// verifyKDCCertificate verifies the certificate that signed the KDC's reply chains to the trust anchors.
+func (r *Request) verifyKDCCertificate(vd verifiedData) error {
+	inter := x509.NewCertPool()
+	for _, c := range vd.certificates {
+		if c != vd.signer {
+			inter.AddCert(c)
+		}
+	}
+	_, err := vd.signer.Verify(x509.VerifyOptions{
+		Roots:         r.roots,
+		Intermediates: inter,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("KDC certificate is not trusted: %w", err)
+	}
+	return nil
+}
+
+// IsKDCCertificate reports if the certificate has the id-pkinit-KPKdc extended key usage of RFC 4556 that identifies
+// a KDC's certificate. KDCs, such as Active Directory domain controllers, may instead use certificates with the
+// extended key usages for server authentication so this is not required by ReplyKey.
+func IsKDCCertificate(cert *x509.Certificate) bool {
+	for _, oid := range cert.UnknownExtKeyUsage {
+		if asn1.ObjectIdentifier(oid).Equal(oidKPKdc) {
+			return true
+		}
+	}
+	return false
+}
+
+// OctetString2Key implements the RFC 4556 octetstring2key function deriving a key of the encryption type from the
+// Diffie-Hellman shared secret.
+func OctetString2Key(x []byte, id int32) (types.EncryptionKey, error) {
+	et, err := krbcrypto.GetEtype(id)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.WithKind(fmt.Errorf("error getting etype of reply key: %w", err), krberror.KindCryptoPolicy)
+	}
+	n := et.GetKeySeedBitLength() / 8
+	var seed []byte
+	for i := 0; len(seed) < n; i++ {
+		h := sha1.New()
+		h.Write([]byte{byte(i)})
+		h.Write(x)
+		seed = h.Sum(seed)
+	}
+	seed = seed[:n]
+	// random-to-key is the identity function for RC4-HMAC, RFC 4757 section 5.
+	if id != etypeID.RC4_HMAC {
+		seed = et.RandomToKey(seed)
+	}
+	return types.EncryptionKey{KeyType: id, KeyValue: seed}, nil
+}
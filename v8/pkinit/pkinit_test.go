@@ -0,0 +1,219 @@
+package pkinit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCertificate(t *testing.T, cn string, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return cert
+}
+
+// testClientContent returns the content type and content of the client's signed data, verifying the signature
+// unless the signed data has no signers as sent by an anonymous client.
+func testClientContent(t *testing.T, b []byte) (asn1.ObjectIdentifier, []byte) {
+	var ci contentInfo
+	_, err := asn1.Unmarshal(b, &ci)
+	if err != nil {
+		t.Fatalf("error unmarshaling client content info: %v", err)
+	}
+	sd, err := parseSignedData(ci.Content.Bytes)
+	if err != nil {
+		t.Fatalf("error unmarshaling client signed data: %v", err)
+	}
+	if len(sd.SignerInfos.Bytes) < 1 {
+		return sd.EncapContentInfo.EContentType, sd.EncapContentInfo.EContent
+	}
+	vd, err := verifySignedData(b)
+	if err != nil {
+		t.Fatalf("error verifying client signed data: %v", err)
+	}
+	return vd.contentType, vd.content
+}
+
+// testKDC performs the KDC's side of the Diffie-Hellman exchange, returning the PA-PK-AS-REP and the reply key.
+func testKDC(t *testing.T, asReq messages.ASReq, cert *x509.Certificate, key crypto.Signer, nonce int) (types.PAData, types.EncryptionKey) {
+	var pkReq PAPKASReq
+	_, err := asn1.Unmarshal(asReq.PAData[0].PADataValue, &pkReq)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-PK-AS-REQ: %v", err)
+	}
+	ct, content := testClientContent(t, pkReq.SignedAuthPack)
+	assert.True(t, ct.Equal(oidAuthData), "signed content type not as expected")
+	var ap AuthPack
+	_, err = asn1.Unmarshal(content, &ap)
+	if err != nil {
+		t.Fatalf("error unmarshaling AuthPack: %v", err)
+	}
+	rb, _ := asReq.ReqBody.Marshal()
+	sum := sha1.Sum(rb)
+	assert.Equal(t, sum[:], ap.PKAuthenticator.PAChecksum, "paChecksum not as expected")
+	assert.Equal(t, asReq.ReqBody.Nonce, ap.PKAuthenticator.Nonce, "nonce not as expected")
+	assert.True(t, ap.ClientPublicValue.Algorithm.Algorithm.Equal(oidDHPublicNumber), "public value algorithm not as expected")
+	var params domainParameters
+	_, err = asn1.Unmarshal(ap.ClientPublicValue.Algorithm.Parameters.FullBytes, &params)
+	if err != nil {
+		t.Fatalf("error unmarshaling domain parameters: %v", err)
+	}
+	cy := new(big.Int)
+	_, err = asn1.Unmarshal(ap.ClientPublicValue.SubjectPublicKey.Bytes, &cy)
+	if err != nil {
+		t.Fatalf("error unmarshaling client public value: %v", err)
+	}
+	x, _ := rand.Int(rand.Reader, params.Q)
+	y, _ := asn1.Marshal(new(big.Int).Exp(params.G, x, params.P))
+	zz := make([]byte, (params.P.BitLen()+7)/8)
+	z := new(big.Int).Exp(cy, x, params.P).Bytes()
+	copy(zz[len(zz)-len(z):], z)
+	replyKey, err := OctetString2Key(zz, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error deriving reply key: %v", err)
+	}
+	kib, _ := asn1.Marshal(KDCDHKeyInfo{SubjectPublicKey: asn1.BitString{Bytes: y, BitLength: len(y) * 8}, Nonce: nonce})
+	sd, err := signData(kib, oidDHKeyData, cert, key)
+	if err != nil {
+		t.Fatalf("error signing KDC DH key info: %v", err)
+	}
+	dhb, _ := asn1.Marshal(DHRepInfo{DHSignedData: sd})
+	b, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: paPKASRepDHInfoTag, IsCompound: true, Bytes: dhb})
+	return types.PAData{PADataType: patype.PA_PK_AS_REP, PADataValue: b}, replyKey
+}
+
+func TestRequest_ReplyKey(t *testing.T) {
+	t.Parallel()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := testCertificate(t, "Test CA", caKey, nil, nil)
+	kdcKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	kdcCert := testCertificate(t, "kdc.test.gokrb5", kdcKey, ca, caKey)
+	clKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	clCert := testCertificate(t, "testuser1", clKey, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	asReq, err := messages.NewASReqForTGT("TEST.GOKRB5", config.New(), types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"))
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	r := NewRequest(clCert, clKey, roots)
+	pa, err := r.PAData(&asReq)
+	if err != nil {
+		t.Fatalf("error generating PKINIT PA data: %v", err)
+	}
+	assert.Equal(t, patype.PA_PK_AS_REQ, pa.PADataType, "PA data type not as expected")
+	asReq.PAData = types.PADataSequence{pa}
+
+	rep, want := testKDC(t, asReq, kdcCert, kdcKey, asReq.ReqBody.Nonce)
+	asRep := messages.ASRep{KDCRepFields: messages.KDCRepFields{
+		PAData:  types.PADataSequence{rep},
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96},
+	}}
+	key, err := r.ReplyKey(&asRep)
+	if err != nil {
+		t.Fatalf("error getting reply key: %v", err)
+	}
+	assert.Equal(t, want, key, "reply key not as expected")
+
+	// The KDC's reply must be for the request's nonce.
+	asRep.PAData[0], _ = testKDC(t, asReq, kdcCert, kdcKey, asReq.ReqBody.Nonce+1)
+	_, err = r.ReplyKey(&asRep)
+	assert.Equal(t, krberror.KindProtocol, krberror.ErrorKind(err), "reply for another nonce should be rejected: %v", err)
+
+	// The KDC's certificate must chain to the trust anchors.
+	other := x509.NewCertPool()
+	other.AddCert(clCert)
+	r.roots = other
+	asRep.PAData[0], _ = testKDC(t, asReq, kdcCert, kdcKey, asReq.ReqBody.Nonce)
+	_, err = r.ReplyKey(&asRep)
+	assert.Equal(t, krberror.KindCredentials, krberror.ErrorKind(err), "untrusted KDC certificate should be rejected: %v", err)
+
+	asRep.PAData = nil
+	_, err = r.ReplyKey(&asRep)
+	assert.Error(t, err, "AS_REP without PA-PK-AS-REP should be rejected")
+}
+
+func TestVerifySignedData_Tampered(t *testing.T) {
+	t.Parallel()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cert := testCertificate(t, "testuser1", key, nil, nil)
+	sd, err := signData([]byte("content"), oidAuthData, cert, key)
+	if err != nil {
+		t.Fatalf("error signing data: %v", err)
+	}
+	vd, err := verifySignedData(sd)
+	if err != nil {
+		t.Fatalf("error verifying signed data: %v", err)
+	}
+	assert.Equal(t, []byte("content"), vd.content, "content not as expected")
+	assert.Equal(t, cert.Raw, vd.signer.Raw, "signer not as expected")
+
+	i := len(sd) - len(cert.Raw)
+	for j := 0; j < len(sd); j++ {
+		if string(sd[j:j+7]) == "content" {
+			i = j
+			break
+		}
+	}
+	sd[i] = 'C'
+	_, err = verifySignedData(sd)
+	assert.Error(t, err, "tampered content should not verify")
+}
+
+func TestOctetString2Key(t *testing.T) {
+	t.Parallel()
+	x := []byte("shared secret")
+	for _, et := range []int32{etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA384_192, etypeID.DES3_CBC_SHA1_KD, etypeID.RC4_HMAC} {
+		k, err := OctetString2Key(x, et)
+		if err != nil {
+			t.Fatalf("error deriving key for etype %d: %v", et, err)
+		}
+		assert.Equal(t, et, k.KeyType, "key type not as expected")
+	}
+	k, _ := OctetString2Key(x, etypeID.AES256_CTS_HMAC_SHA1_96)
+	h0 := sha1.Sum(append([]byte{0}, x...))
+	h1 := sha1.Sum(append([]byte{1}, x...))
+	assert.Equal(t, append(h0[:], h1[:12]...), k.KeyValue, "AES256 key not the truncated SHA1 output")
+	_, err := OctetString2Key(x, 999)
+	assert.Equal(t, krberror.KindCryptoPolicy, krberror.ErrorKind(err), "unsupported etype error kind not as expected")
+}
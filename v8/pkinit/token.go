@@ -0,0 +1,95 @@
+package pkinit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// digestInfoPrefixes are the DER encodings of the DigestInfo of RFC 8017 section 9.2 preceding the digest, which RSA
+// PKCS #1 v1.5 signatures are over.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// TokenSignFunc signs with a private key held on a PKCS #11 token, smartcard or TPM as the raw CKM_RSA_PKCS and
+// CKM_ECDSA mechanisms of PKCS #11 do. For RSA keys the data is the DER encoded DigestInfo, to be padded and signed,
+// and for ECDSA keys the data is the digest and the signature is the concatenation of its r and s values.
+type TokenSignFunc func(data []byte) ([]byte, error)
+
+// tokenSigner is a crypto.Signer for a private key held on a token.
+type tokenSigner struct {
+	pub  crypto.PublicKey
+	sign TokenSignFunc
+}
+
+// NewTokenSigner returns a crypto.Signer, for use with NewRequest and client.NewWithCertificate, for the private key
+// of the certificate that is held on a PKCS #11 token, smartcard or TPM and signs with the sign function, such as one
+// calling C_Sign of a PKCS #11 binding on a session logged in with the user's PIN. Tokens already providing a
+// crypto.Signer can be used directly.
+func NewTokenSigner(cert *x509.Certificate, sign TokenSignFunc) (crypto.Signer, error) {
+	if cert == nil || sign == nil {
+		return nil, errors.New("a token signer requires the certificate and a sign function")
+	}
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported token key type %T", cert.PublicKey)
+	}
+	return &tokenSigner{pub: cert.PublicKey, sign: sign}, nil
+}
+
+// Public returns the public key of the certificate of the token's private key.
+func (s *tokenSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign the digest with the token's private key, returning a PKCS #1 v1.5 signature for RSA keys and an ASN.1 encoded
+// signature for ECDSA keys as crypto.Signer requires. RSA-PSS is not supported.
+func (s *tokenSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("RSA-PSS signatures are not supported by the token signer")
+	}
+	hash := opts.HashFunc()
+	if hash != 0 && len(digest) != hash.Size() {
+		return nil, fmt.Errorf("digest length %d is not that of the hash function", len(digest))
+	}
+	switch pub := s.pub.(type) {
+	case *rsa.PublicKey:
+		prefix, ok := digestInfoPrefixes[hash]
+		if !ok {
+			return nil, fmt.Errorf("unsupported hash function %v for the token signer", hash)
+		}
+		sig, err := s.sign(append(append([]byte(nil), prefix...), digest...))
+		if err != nil {
+			return nil, fmt.Errorf("error signing with token: %w", err)
+		}
+		return sig, nil
+	case *ecdsa.PublicKey:
+		sig, err := s.sign(digest)
+		if err != nil {
+			return nil, fmt.Errorf("error signing with token: %w", err)
+		}
+		n := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*n {
+			return nil, fmt.Errorf("token ECDSA signature length %d is not that of the curve", len(sig))
+		}
+		return asn1.Marshal(struct {
+			R, S *big.Int
+		}{
+			R: new(big.Int).SetBytes(sig[:n]),
+			S: new(big.Int).SetBytes(sig[n:]),
+		})
+	}
+	return nil, fmt.Errorf("unsupported token key type %T", s.pub)
+}
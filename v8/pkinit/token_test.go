@@ -0,0 +1,82 @@
+package pkinit
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testTokenSign returns a sign function performing the raw CKM_RSA_PKCS and CKM_ECDSA mechanisms with the key.
+func testTokenSign(key crypto.Signer) TokenSignFunc {
+	return func(data []byte) ([]byte, error) {
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			return rsa.SignPKCS1v15(rand.Reader, k, 0, data)
+		case *ecdsa.PrivateKey:
+			r, s, err := ecdsa.Sign(rand.Reader, k, data)
+			if err != nil {
+				return nil, err
+			}
+			n := (k.Curve.Params().BitSize + 7) / 8
+			sig := make([]byte, 2*n)
+			rb, sb := r.Bytes(), s.Bytes()
+			copy(sig[n-len(rb):n], rb)
+			copy(sig[2*n-len(sb):], sb)
+			return sig, nil
+		}
+		return nil, nil
+	}
+}
+
+func TestNewTokenSigner(t *testing.T) {
+	t.Parallel()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		cert := testCertificate(t, "testuser1", key, nil, nil)
+		signer, err := NewTokenSigner(cert, testTokenSign(key))
+		if err != nil {
+			t.Fatalf("error creating token signer: %v", err)
+		}
+		sd, err := signData([]byte("content"), oidAuthData, cert, signer)
+		if err != nil {
+			t.Fatalf("error signing data with %T token: %v", key, err)
+		}
+		vd, err := verifySignedData(sd)
+		if err != nil {
+			t.Fatalf("error verifying data signed with %T token: %v", key, err)
+		}
+		assert.Equal(t, []byte("content"), vd.content, "content not as expected")
+
+		_, err = signer.Sign(rand.Reader, make([]byte, 32), &rsa.PSSOptions{Hash: crypto.SHA256})
+		assert.Error(t, err, "RSA-PSS should not be supported")
+		_, err = signer.Sign(rand.Reader, make([]byte, 20), crypto.SHA256)
+		assert.Error(t, err, "digest of the wrong length should be rejected")
+	}
+
+	// The token's key must be that of the certificate.
+	other, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	cert := testCertificate(t, "testuser1", ecKey, nil, nil)
+	signer, err := NewTokenSigner(cert, testTokenSign(other))
+	if err != nil {
+		t.Fatalf("error creating token signer: %v", err)
+	}
+	sd, err := signData([]byte("content"), oidAuthData, cert, signer)
+	if err == nil {
+		_, err = verifySignedData(sd)
+	}
+	assert.Error(t, err, "signature by another key should not verify")
+	_, err = signData([]byte("content"), oidAuthData, cert, other)
+	assert.Error(t, err, "signing key that is not the certificate's should be rejected")
+
+	_, err = NewTokenSigner(cert, nil)
+	assert.Error(t, err, "token signer without a sign function should be rejected")
+}
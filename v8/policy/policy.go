@@ -0,0 +1,213 @@
+// Package policy evaluates issued tickets and their PACs against rules for ticket hygiene, such as the maximum
+// lifetime and the encryption types permitted, returning a structured verdict for each rule.
+//
+// A Policy can be enforced by a service with the service.TicketPolicy setting or used to audit tickets:
+//
+//	p := &policy.Policy{
+//		MaxLifetime: 10 * time.Hour,
+//		ETypes:      []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96},
+//		RequirePAC:  true,
+//	}
+//	r := p.Evaluate(tkt, pac)
+//	for _, v := range r.Failures() {
+//		log.Println(v)
+//	}
+package policy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/pac"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Rule names identifying the rule a Verdict is for.
+const (
+	RuleMaxLifetime      = "max-lifetime"
+	RuleMaxRenewLifetime = "max-renew-lifetime"
+	RuleMaxAuthAge       = "max-auth-age"
+	RuleTicketEType      = "ticket-etype"
+	RuleSessionKeyEType  = "session-key-etype"
+	RuleRealm            = "realm"
+	RuleFlag             = "flag"
+	RulePAC              = "pac"
+	RulePACBuffer        = "pac-buffer"
+)
+
+// PACBuffer identifies a PAC info buffer by its type, MS-PAC section 2.4.
+type PACBuffer uint32
+
+// PAC info buffer types.
+const (
+	PACKerbValidationInfo PACBuffer = 1
+	PACCredentialsInfo    PACBuffer = 2
+	PACServerChecksum     PACBuffer = 6
+	PACKDCChecksum        PACBuffer = 7
+	PACClientInfo         PACBuffer = 10
+	PACS4UDelegationInfo  PACBuffer = 11
+	PACUPNDNSInfo         PACBuffer = 12
+	PACClientClaimsInfo   PACBuffer = 13
+	PACDeviceInfo         PACBuffer = 14
+	PACDeviceClaimsInfo   PACBuffer = 15
+)
+
+// Policy defines the rules an issued ticket is evaluated against. Rules with a zero value are not evaluated.
+type Policy struct {
+	// MaxLifetime is the longest permitted period from the start of the ticket's validity to its end time.
+	MaxLifetime time.Duration
+	// MaxRenewLifetime is the longest permitted period from the start of a renewable ticket's validity to its
+	// renew till time.
+	MaxRenewLifetime time.Duration
+	// MaxAuthAge is the longest permitted period since the client authenticated to the KDC to obtain the ticket's
+	// TGT, bounding how long renewed tickets can be used without the client authenticating again.
+	MaxAuthAge time.Duration
+	// ETypes are the encryption types permitted for the ticket and its session key.
+	ETypes []int32
+	// DisallowedETypes are the encryption types not permitted for the ticket and its session key, for example
+	// etypeID.RC4_HMAC, whether or not ETypes are specified.
+	DisallowedETypes []int32
+	// Realms are the client realms permitted.
+	Realms []string
+	// RequiredFlags are the ticket flags that must be set, for example flags.PreAuthent.
+	RequiredFlags []int
+	// RequirePAC requires the ticket to contain a PAC.
+	RequirePAC bool
+	// PACBuffers are the info buffers the PAC must contain. The PAC is required if any are specified.
+	PACBuffers []PACBuffer
+}
+
+// Verdict is the outcome of evaluating a rule.
+type Verdict struct {
+	Rule    string
+	Passed  bool
+	Message string
+}
+
+// String returns a one line description of the verdict.
+func (v Verdict) String() string {
+	s := "pass"
+	if !v.Passed {
+		s = "fail"
+	}
+	return fmt.Sprintf("[%s] %s: %s", v.Rule, s, v.Message)
+}
+
+// Result holds the verdicts of evaluating a ticket against a Policy.
+type Result struct {
+	Verdicts []Verdict
+}
+
+// Passed indicates if the ticket passed all the rules evaluated.
+func (r Result) Passed() bool {
+	return len(r.Failures()) < 1
+}
+
+// Failures returns the verdicts of the rules the ticket failed.
+func (r Result) Failures() []Verdict {
+	var f []Verdict
+	for _, v := range r.Verdicts {
+		if !v.Passed {
+			f = append(f, v)
+		}
+	}
+	return f
+}
+
+// Error returns an error describing the first rule failed, or nil if the ticket passed.
+func (r Result) Error() error {
+	f := r.Failures()
+	if len(f) < 1 {
+		return nil
+	}
+	if len(f) > 1 {
+		return fmt.Errorf("ticket fails policy: %s (and %d more)", f[0].Message, len(f)-1)
+	}
+	return fmt.Errorf("ticket fails policy: %s", f[0].Message)
+}
+
+func (r *Result) add(rule string, passed bool, format string, v ...interface{}) {
+	r.Verdicts = append(r.Verdicts, Verdict{Rule: rule, Passed: passed, Message: fmt.Sprintf(format, v...)})
+}
+
+// Evaluate the ticket, which must have been decrypted, and its PAC against the policy. The PAC is nil if the ticket
+// does not contain one.
+func (p *Policy) Evaluate(tkt messages.Ticket, pt *pac.PACType) Result {
+	return p.EvaluateAt(tkt, pt, time.Now().UTC())
+}
+
+// EvaluateAt evaluates the ticket and its PAC against the policy, as Evaluate does, at the time provided.
+func (p *Policy) EvaluateAt(tkt messages.Ticket, pt *pac.PACType, now time.Time) Result {
+	var r Result
+	ep := tkt.DecryptedEncPart
+	start := ep.StartTime
+	if start.IsZero() {
+		start = ep.AuthTime
+	}
+	if p.MaxLifetime > 0 {
+		l := ep.EndTime.Sub(start)
+		r.add(RuleMaxLifetime, l <= p.MaxLifetime, "ticket lifetime of %v, maximum %v", l, p.MaxLifetime)
+	}
+	if p.MaxRenewLifetime > 0 && !ep.RenewTill.IsZero() {
+		l := ep.RenewTill.Sub(start)
+		r.add(RuleMaxRenewLifetime, l <= p.MaxRenewLifetime, "ticket renewable lifetime of %v, maximum %v", l, p.MaxRenewLifetime)
+	}
+	if p.MaxAuthAge > 0 {
+		a := now.Sub(ep.AuthTime)
+		r.add(RuleMaxAuthAge, a <= p.MaxAuthAge, "ticket auth time %v ago, maximum %v", a.Round(time.Second), p.MaxAuthAge)
+	}
+	if len(p.ETypes) > 0 || len(p.DisallowedETypes) > 0 {
+		r.add(RuleTicketEType, p.etypePermitted(tkt.EncPart.EType),
+			"ticket encryption type %s", etypeID.Name(tkt.EncPart.EType))
+		r.add(RuleSessionKeyEType, p.etypePermitted(ep.Key.KeyType),
+			"session key encryption type %s", etypeID.Name(ep.Key.KeyType))
+	}
+	if len(p.Realms) > 0 {
+		var ok bool
+		for _, realm := range p.Realms {
+			if realm == ep.CRealm {
+				ok = true
+				break
+			}
+		}
+		r.add(RuleRealm, ok, "client realm %s", ep.CRealm)
+	}
+	for _, f := range p.RequiredFlags {
+		r.add(RuleFlag, types.IsFlagSet(&ep.Flags, f), "ticket flag %d required", f)
+	}
+	if p.RequirePAC || len(p.PACBuffers) > 0 {
+		r.add(RulePAC, pt != nil, "ticket PAC required")
+	}
+	for _, b := range p.PACBuffers {
+		var ok bool
+		if pt != nil {
+			for _, ib := range pt.Buffers {
+				if PACBuffer(ib.ULType) == b {
+					ok = true
+					break
+				}
+			}
+		}
+		r.add(RulePACBuffer, ok, "PAC info buffer type %d required", b)
+	}
+	return r
+}
+
+// etypePermitted returns whether the encryption type is permitted by the ETypes and DisallowedETypes rules.
+func (p *Policy) etypePermitted(etype int32) bool {
+	if len(p.ETypes) > 0 && !containsInt32(p.ETypes, etype) {
+		return false
+	}
+	return !containsInt32(p.DisallowedETypes, etype)
+}
+
+func containsInt32(s []int32, v int32) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
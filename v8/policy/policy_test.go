@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/pac"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTicket() messages.Ticket {
+	st := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := types.NewKrbFlags()
+	types.SetFlag(&f, flags.PreAuthent)
+	types.SetFlag(&f, flags.Renewable)
+	return messages.Ticket{
+		EncPart: types.EncryptedData{EType: etypeID.RC4_HMAC},
+		DecryptedEncPart: messages.EncTicketPart{
+			Flags:     f,
+			Key:       types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96},
+			CRealm:    "TEST.GOKRB5",
+			AuthTime:  st,
+			StartTime: st,
+			EndTime:   st.Add(10 * time.Hour),
+			RenewTill: st.Add(7 * 24 * time.Hour),
+		},
+	}
+}
+
+func TestPolicy_Evaluate(t *testing.T) {
+	t.Parallel()
+	tkt := testTicket()
+	pt := &pac.PACType{Buffers: []pac.InfoBuffer{{ULType: uint32(PACKerbValidationInfo)}}}
+	var tests = []struct {
+		name     string
+		policy   Policy
+		pac      *pac.PACType
+		failures []string
+	}{
+		{"empty", Policy{}, nil, nil},
+		{"lifetime", Policy{MaxLifetime: 10 * time.Hour, MaxRenewLifetime: 24 * time.Hour}, nil, []string{RuleMaxRenewLifetime}},
+		{"etypes", Policy{ETypes: []int32{etypeID.AES256_CTS_HMAC_SHA1_96}}, nil, []string{RuleTicketEType}},
+		{"disallowed etypes", Policy{DisallowedETypes: []int32{etypeID.RC4_HMAC}}, nil, []string{RuleTicketEType}},
+		{"allowed and disallowed etypes", Policy{ETypes: []int32{etypeID.RC4_HMAC, etypeID.AES256_CTS_HMAC_SHA1_96}, DisallowedETypes: []int32{etypeID.AES256_CTS_HMAC_SHA1_96}}, nil, []string{RuleSessionKeyEType}},
+		{"auth age", Policy{MaxAuthAge: 12 * time.Hour}, nil, []string{RuleMaxAuthAge}},
+		{"auth age within", Policy{MaxAuthAge: 48 * time.Hour}, nil, nil},
+		{"realms", Policy{Realms: []string{"OTHER.GOKRB5"}}, nil, []string{RuleRealm}},
+		{"flags", Policy{RequiredFlags: []int{flags.PreAuthent, flags.Initial}}, nil, []string{RuleFlag}},
+		{"no pac", Policy{RequirePAC: true}, nil, []string{RulePAC}},
+		{"pac buffers", Policy{PACBuffers: []PACBuffer{PACKerbValidationInfo, PACUPNDNSInfo}}, pt, []string{RulePACBuffer}},
+	}
+	for _, test := range tests {
+		r := test.policy.EvaluateAt(tkt, test.pac, tkt.DecryptedEncPart.AuthTime.Add(24*time.Hour))
+		var failed []string
+		for _, v := range r.Failures() {
+			failed = append(failed, v.Rule)
+		}
+		assert.Equal(t, test.failures, failed, "%s: failed rules not as expected", test.name)
+		assert.Equal(t, len(test.failures) == 0, r.Passed(), "%s: passed not as expected", test.name)
+		if len(test.failures) > 0 {
+			assert.Error(t, r.Error(), "%s: an error should be returned", test.name)
+		} else {
+			assert.NoError(t, r.Error(), "%s: no error should be returned", test.name)
+		}
+	}
+}
+
+func TestPolicy_Evaluate_Now(t *testing.T) {
+	t.Parallel()
+	tkt := testTicket()
+	p := Policy{MaxAuthAge: time.Hour}
+	assert.False(t, p.Evaluate(tkt, nil).Passed(), "ticket authenticated in the past should fail")
+	tkt.DecryptedEncPart.AuthTime = time.Now().UTC()
+	assert.True(t, p.Evaluate(tkt, nil).Passed(), "ticket authenticated now should pass")
+}
+
+func TestVerdict_String(t *testing.T) {
+	t.Parallel()
+	v := Verdict{Rule: RuleRealm, Message: "client realm TEST.GOKRB5"}
+	assert.Equal(t, "[realm] fail: client realm TEST.GOKRB5", v.String(), "verdict string not as expected")
+}
@@ -0,0 +1,214 @@
+package rcache
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// File is a replay cache persisting the authenticators presented to the service to a file, similarly to MIT Kerberos'
+// replay cache, so that they are still detected as replays once the service is restarted. Each authenticator is
+// synced to the file before it is accepted and kept for the cache's window. Expired entries are pruned by rewriting
+// the file once per window.
+type File struct {
+	path      string
+	window    time.Duration
+	mux       sync.Mutex
+	f         *os.File
+	entries   map[string]time.Time
+	lastPrune time.Time
+	// ErrorHandler, if not nil, is called with the errors writing the file. As the authenticator cannot be recorded it
+	// is then treated as a replay and rejected.
+	ErrorHandler func(error)
+}
+
+// NewFile returns a replay cache persisted to the file at the path, which is created if it does not exist, loading the
+// entries that have not expired. The entries expire after the window, which should be at least twice the service's
+// maximum clock skew as authenticators are accepted up to the clock skew either side of the service's time. The file
+// must not be shared by concurrently running processes.
+func NewFile(path string, window time.Duration) (*File, error) {
+	c := &File{
+		path:    path,
+		window:  window,
+		entries: make(map[string]time.Time),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if err := c.prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// IsReplay returns whether the authenticator has already been presented to the service principal within the window,
+// recording it in the file otherwise. If it cannot be recorded the authenticator is treated as a replay.
+func (c *File) IsReplay(sname types.PrincipalName, a types.Authenticator) bool {
+	k := entryKey(sname, a)
+	now := time.Now()
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if exp, ok := c.entries[k]; ok && now.Before(exp) {
+		return true
+	}
+	if now.Sub(c.lastPrune) > c.window {
+		if err := c.prune(now); err != nil {
+			c.error(err)
+			return true
+		}
+	}
+	exp := now.Add(c.window)
+	if err := c.append(k, exp); err != nil {
+		c.error(err)
+		return true
+	}
+	c.entries[k] = exp
+	return false
+}
+
+// Len returns the number of entries in the cache that have not expired.
+func (c *File) Len() int {
+	now := time.Now()
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var n int
+	for _, exp := range c.entries {
+		if now.Before(exp) {
+			n++
+		}
+	}
+	return n
+}
+
+// Close closes the file. The cache must not be used afterwards.
+func (c *File) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	c.f = nil
+	return err
+}
+
+// load reads the entries of the file, if it exists.
+func (c *File) load() error {
+	f, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not open replay cache file: %w", err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// A line not written completely, as the process stopped while appending it, is ignored.
+		e := strings.SplitN(s.Text(), " ", 2)
+		if len(e) != 2 {
+			continue
+		}
+		ns, err := strconv.ParseInt(e[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		k, err := strconv.Unquote(e[1])
+		if err != nil {
+			continue
+		}
+		c.entries[k] = time.Unix(0, ns)
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("could not read replay cache file: %w", err)
+	}
+	return nil
+}
+
+// prune removes the expired entries and rewrites the file with the remaining ones. The file is replaced atomically so
+// that the entries are not lost should the process stop while it is written.
+func (c *File) prune(now time.Time) error {
+	for k, exp := range c.entries {
+		if !now.Before(exp) {
+			delete(c.entries, k)
+		}
+	}
+	tmp, err := os.OpenFile(c.path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not create replay cache file: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	for k, exp := range c.entries {
+		w.WriteString(entryLine(k, exp))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("could not write replay cache file: %w", err)
+	}
+	if c.f != nil {
+		c.f.Close()
+		c.f = nil
+	}
+	c.lastPrune = now
+	syncDir(c.path)
+	return nil
+}
+
+// append records the entry at the end of the file, syncing it to disk.
+func (c *File) append(k string, exp time.Time) error {
+	if c.f == nil {
+		f, err := os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("could not open replay cache file: %w", err)
+		}
+		c.f = f
+	}
+	if _, err := c.f.WriteString(entryLine(k, exp)); err != nil {
+		return fmt.Errorf("could not write replay cache file: %w", err)
+	}
+	if err := c.f.Sync(); err != nil {
+		return fmt.Errorf("could not sync replay cache file: %w", err)
+	}
+	return nil
+}
+
+func (c *File) error(err error) {
+	if c.ErrorHandler != nil {
+		c.ErrorHandler(err)
+	}
+}
+
+// entryLine returns the line of the file recording the entry: its expiry time in nanoseconds since the epoch followed
+// by the quoted key.
+func entryLine(k string, exp time.Time) string {
+	return strconv.FormatInt(exp.UnixNano(), 10) + " " + strconv.Quote(k) + "\n"
+}
+
+// syncDir syncs the directory of the file so that its rename is persisted, where the platform supports it.
+func syncDir(path string) {
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
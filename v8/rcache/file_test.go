@@ -0,0 +1,84 @@
+package rcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile_IsReplay(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "rcache")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	path := filepath.Join(d, "rcache")
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	now := time.Now().UTC()
+	a := testAuthenticator(now)
+
+	rc, err := NewFile(path, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("could not create replay cache: %v", err)
+	}
+	assert.False(t, rc.IsReplay(sname, a), "first authenticator presented should not be a replay")
+	assert.True(t, rc.IsReplay(sname, a), "authenticator presented again should be a replay")
+	assert.False(t, rc.IsReplay(sname, testAuthenticator(now.Add(time.Millisecond))), "authenticator with a different time should not be a replay")
+	assert.NoError(t, rc.Close())
+
+	// Restart
+	rc, err = NewFile(path, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("could not load replay cache: %v", err)
+	}
+	defer rc.Close()
+	assert.Equal(t, 2, rc.Len(), "entries not loaded from the file")
+	assert.True(t, rc.IsReplay(sname, a), "authenticator presented before the restart should be a replay")
+}
+
+func TestFile_Prune(t *testing.T) {
+	t.Parallel()
+	d, err := ioutil.TempDir("", "rcache")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(d)
+	path := filepath.Join(d, "rcache")
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	now := time.Now().UTC()
+	a := testAuthenticator(now)
+
+	rc, err := NewFile(path, time.Second/4)
+	if err != nil {
+		t.Fatalf("could not create replay cache: %v", err)
+	}
+	assert.False(t, rc.IsReplay(sname, a), "first authenticator presented should not be a replay")
+	time.Sleep(time.Second / 2)
+	assert.Equal(t, 0, rc.Len(), "entry should have expired")
+	assert.False(t, rc.IsReplay(sname, testAuthenticator(now.Add(time.Millisecond))), "authenticator should not be a replay")
+	assert.NoError(t, rc.Close())
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read replay cache file: %v", err)
+	}
+	assert.Equal(t, 1, strings.Count(string(b), "\n"), "expired entries should have been pruned")
+
+	// A partially written line is ignored.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString("1234")
+	f.Close()
+	rc, err = NewFile(path, time.Second/4)
+	if err != nil {
+		t.Fatalf("could not load replay cache: %v", err)
+	}
+	defer rc.Close()
+	assert.Equal(t, 1, rc.Len(), "entries not loaded from the file")
+}
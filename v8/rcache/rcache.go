@@ -0,0 +1,22 @@
+// Package rcache provides replay caches for services, implementing the service.ReplayCache interface, that detect
+// authenticators replayed across the instances of a load balanced service.
+//
+// The cache is configured in the service settings:
+//
+//	rc := rcache.NewRedis("redis.example.com:6379", 10*time.Minute)
+//	h := spnego.SPNEGOKRB5Authenticate(inner, kt, service.ReplayCacheBackend(rc))
+package rcache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// entryKey returns the key identifying the authenticator presented to the service principal: the service and client
+// principals and the authenticator's time to the microsecond.
+func entryKey(sname types.PrincipalName, a types.Authenticator) string {
+	ct := a.CTime.Truncate(time.Second).Add(time.Duration(a.Cusec) * time.Microsecond)
+	return fmt.Sprintf("%s|%s@%s|%d", sname.PrincipalNameString(), a.CName.PrincipalNameString(), a.CRealm, ct.UnixNano()/int64(time.Microsecond))
+}
@@ -0,0 +1,180 @@
+package rcache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Redis is a replay cache keeping the authenticators presented to the service in a Redis server shared by the
+// instances of the service. Each authenticator is recorded with SET NX, so only the first instance it is presented to
+// accepts it, and expires once it is outside of the service's clock skew.
+type Redis struct {
+	addr string
+	ttl  time.Duration
+	pool chan *redisConn
+	// Password, if not empty, is used to authenticate to the server with AUTH.
+	Password string
+	// DB is the database selected with SELECT, if not 0.
+	DB int
+	// KeyPrefix prefixes the keys of the entries. It defaults to "gokrb5:rcache:".
+	KeyPrefix string
+	// Timeout bounds connecting to the server and each command. It defaults to 5 seconds.
+	Timeout time.Duration
+	// ErrorHandler, if not nil, is called with the errors communicating with the server. As the replay cannot be
+	// checked the authenticator is then treated as a replay and rejected.
+	ErrorHandler func(error)
+}
+
+// NewRedis returns a replay cache using the Redis server at the address, in host:port form. The entries expire after
+// the TTL, which should be at least twice the service's maximum clock skew as authenticators are accepted up to the
+// clock skew either side of the service's time.
+func NewRedis(addr string, ttl time.Duration) *Redis {
+	return &Redis{
+		addr:      addr,
+		ttl:       ttl,
+		pool:      make(chan *redisConn, 8),
+		KeyPrefix: "gokrb5:rcache:",
+		Timeout:   5 * time.Second,
+	}
+}
+
+// IsReplay returns whether the authenticator has already been presented to the service principal, recording it in
+// the Redis server otherwise. If the server cannot be reached the authenticator is treated as a replay.
+func (r *Redis) IsReplay(sname types.PrincipalName, a types.Authenticator) bool {
+	ok, err := r.setNX(r.KeyPrefix + entryKey(sname, a))
+	if err != nil {
+		if r.ErrorHandler != nil {
+			r.ErrorHandler(fmt.Errorf("could not check replay with redis server %s: %w", r.addr, err))
+		}
+		return true
+	}
+	return !ok
+}
+
+// Close closes the idle connections to the server.
+func (r *Redis) Close() error {
+	for {
+		select {
+		case c := <-r.pool:
+			c.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// setNX sets the key if it does not exist, returning whether it was set.
+func (r *Redis) setNX(key string) (bool, error) {
+	c, err := r.get()
+	if err != nil {
+		return false, err
+	}
+	ms := strconv.FormatInt(int64(r.ttl/time.Millisecond), 10)
+	reply, err := c.do("SET", key, "1", "NX", "PX", ms)
+	if err != nil {
+		c.conn.Close()
+		return false, err
+	}
+	r.put(c)
+	return reply == "OK", nil
+}
+
+// get returns an idle connection to the server or a new one.
+func (r *Redis) get() (*redisConn, error) {
+	select {
+	case c := <-r.pool:
+		return c, nil
+	default:
+	}
+	conn, err := net.DialTimeout("tcp", r.addr, r.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), timeout: r.Timeout}
+	if r.Password != "" {
+		if _, err := c.do("AUTH", r.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not authenticate: %w", err)
+		}
+	}
+	if r.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(r.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not select database %d: %w", r.DB, err)
+		}
+	}
+	return c, nil
+}
+
+// put returns the connection to the idle connections, closing it if there are enough.
+func (r *Redis) put(c *redisConn) {
+	select {
+	case r.pool <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+// redisConn is a connection to a Redis server speaking RESP.
+type redisConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// do sends the command and returns its simple string or bulk string reply, which is empty for a nil reply.
+func (c *redisConn) do(args ...string) (string, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+	l, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	if len(l) < 1 {
+		return "", errors.New("empty reply")
+	}
+	switch l[0] {
+	case '+', ':':
+		return l[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis error: %s", l[1:])
+	case '$':
+		n, err := strconv.Atoi(l[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid bulk string length: %w", err)
+		}
+		if n < 0 {
+			return "", nil
+		}
+		v := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, v); err != nil {
+			return "", err
+		}
+		return string(v[:n]), nil
+	}
+	return "", fmt.Errorf("unexpected reply %q", l)
+}
+
+// readLine reads a reply line without its CRLF terminator.
+func (c *redisConn) readLine() (string, error) {
+	l, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(l, "\r\n"), nil
+}
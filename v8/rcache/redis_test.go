@@ -0,0 +1,147 @@
+package rcache
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is a Redis server supporting the AUTH, SELECT and SET NX commands used by the replay cache.
+type fakeRedis struct {
+	l    net.Listener
+	mux  sync.Mutex
+	keys map[string]bool
+	cmds []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	s := &fakeRedis{l: l, keys: make(map[string]bool)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mux.Lock()
+		s.cmds = append(s.cmds, args[0])
+		reply := "+OK\r\n"
+		switch args[0] {
+		case "AUTH":
+			if args[1] != "secret" {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case "SET":
+			if s.keys[args[1]] {
+				reply = "$-1\r\n"
+			}
+			s.keys[args[1]] = true
+		}
+		s.mux.Unlock()
+		c.Write([]byte(reply))
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	l, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(l[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		a, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(a, "\r\n")
+	}
+	return args, nil
+}
+
+func testAuthenticator(t time.Time) types.Authenticator {
+	return types.Authenticator{
+		CRealm: "TEST.GOKRB5",
+		CName:  types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"),
+		CTime:  t,
+		Cusec:  t.Nanosecond() / 1000,
+	}
+}
+
+func TestRedis_IsReplay(t *testing.T) {
+	t.Parallel()
+	s := newFakeRedis(t)
+	defer s.l.Close()
+	rc := NewRedis(s.l.Addr().String(), 10*time.Minute)
+	rc.Password = "secret"
+	rc.DB = 2
+	defer rc.Close()
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	now := time.Now().UTC()
+	a := testAuthenticator(now)
+	assert.False(t, rc.IsReplay(sname, a), "first authenticator presented should not be a replay")
+	assert.True(t, rc.IsReplay(sname, a), "authenticator presented again should be a replay")
+	assert.False(t, rc.IsReplay(sname, testAuthenticator(now.Add(time.Millisecond))), "authenticator with a different time should not be a replay")
+	other := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/other.test.gokrb5")
+	assert.False(t, rc.IsReplay(other, a), "authenticator presented to another service should not be a replay")
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	assert.Equal(t, []string{"AUTH", "SELECT", "SET", "SET", "SET", "SET"}, s.cmds, "connection should be reused")
+	for k := range s.keys {
+		assert.True(t, strings.HasPrefix(k, "gokrb5:rcache:"), "key should have the prefix")
+	}
+}
+
+func TestRedis_IsReplay_Error(t *testing.T) {
+	t.Parallel()
+	s := newFakeRedis(t)
+	defer s.l.Close()
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	a := testAuthenticator(time.Now().UTC())
+
+	rc := NewRedis(s.l.Addr().String(), 10*time.Minute)
+	rc.Password = "wrong"
+	var errs []error
+	rc.ErrorHandler = func(err error) {
+		errs = append(errs, err)
+	}
+	assert.True(t, rc.IsReplay(sname, a), "authenticator should be treated as a replay when the check fails")
+	assert.Len(t, errs, 1, "error handler should be called")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	rc = NewRedis(addr, 10*time.Minute)
+	assert.True(t, rc.IsReplay(sname, a), "authenticator should be treated as a replay when the server is unreachable")
+}
@@ -0,0 +1,280 @@
+// Package sasl implements the client side of the SASL GSSAPI (RFC 4752) and GSS-SPNEGO mechanisms with Kerberos so
+// that LDAP binds, and those of other SASL protocols, can be authenticated with a gokrb5 client.
+//
+// Client satisfies the GSSAPIClient interface of github.com/go-ldap/ldap/v3 so it can be passed to GSSAPIBind:
+//
+//	sc := sasl.NewClient(cl)
+//	l, err := ldap.DialURL("ldap://dc1.example.com")
+//	...
+//	err = l.GSSAPIBind(sc, "ldap/dc1.example.com", "")
+//
+// A security layer protecting the messages exchanged after the bind can be negotiated. The connection must then be
+// wrapped with the client's Conn before the LDAP connection is created over it so that messages are signed or sealed
+// once the bind completes:
+//
+//	sc := sasl.NewClient(cl, sasl.SecurityLayers(sasl.LayerIntegrity|sasl.LayerConfidentiality))
+//	c, err := net.Dial("tcp", "dc1.example.com:389")
+//	...
+//	l := ldap.NewConn(sc.Conn(c), false)
+//	l.Start()
+//	err = l.GSSAPIBind(sc, "ldap/dc1.example.com", "")
+//
+// Security layers require an RFC 4121 encryption type (AES) for the service ticket's session key.
+package sasl
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// SASL mechanism names.
+const (
+	MechanismGSSAPI    = "GSSAPI"
+	MechanismGSSSPNEGO = "GSS-SPNEGO"
+)
+
+// Security layers of the GSSAPI mechanism, RFC 4752 section 3.3.
+const (
+	LayerNone            byte = 0x01
+	LayerIntegrity       byte = 0x02
+	LayerConfidentiality byte = 0x04
+)
+
+const (
+	defaultMaxBufferSize uint32 = 65536
+	maxBufferSizeLimit   uint32 = 0xFFFFFF
+)
+
+// Client performs the client side of a SASL GSSAPI or GSS-SPNEGO authentication with a gokrb5 client.
+// A Client is used for a single authentication.
+type Client struct {
+	client   *client.Client
+	settings *Settings
+	mux      sync.Mutex
+	spnego   bool
+	key      types.EncryptionKey
+	auth     types.Authenticator
+	seq      uint64
+	sc       *gssapi.SecurityContext
+	conn     *Conn
+}
+
+// NewClient returns a SASL client authenticating with the gokrb5 client.
+func NewClient(cl *client.Client, settings ...func(*Settings)) *Client {
+	s := NewSettings(settings...)
+	return &Client{
+		client:   cl,
+		settings: s,
+		spnego:   s.mechanism == MechanismGSSSPNEGO,
+	}
+}
+
+// Mechanism returns the name of the SASL mechanism the client is configured for.
+func (c *Client) Mechanism() string {
+	return c.settings.mechanism
+}
+
+// Conn wraps the connection so that the security layer negotiated is applied to it once authentication completes.
+// Until then data is passed through unchanged. Conn must be called before authentication starts.
+func (c *Client) Conn(conn net.Conn) *Conn {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.conn = &Conn{Conn: conn, maxRecv: c.settings.maxBufferSize}
+	return c.conn
+}
+
+// InitSecContext initiates the establishment of a security context with the service principal named by the target,
+// RFC 4752 section 3.1. It is first called with a nil token and returns the token to send to the server. It is called
+// again with the server's reply token while the returned boolean indicates that another call is needed.
+func (c *Client) InitSecContext(target string, token []byte) ([]byte, bool, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if token == nil {
+		return c.initSecContext(target)
+	}
+	if c.key.KeyType == 0 {
+		return nil, false, errors.New("security context has not been initiated")
+	}
+	if err := c.completeSecContext(token); err != nil {
+		return nil, false, err
+	}
+	return []byte{}, false, nil
+}
+
+// initSecContext returns the initial token containing an AP_REQ for the target requesting mutual authentication.
+func (c *Client) initSecContext(target string) ([]byte, bool, error) {
+	tkt, key, err := c.client.GetServiceTicket(target)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not get service ticket for %s: %w", target, err)
+	}
+	gssFlags := []int{gssapi.ContextFlagMutual, gssapi.ContextFlagSequence}
+	if c.settings.layers&(LayerIntegrity|LayerConfidentiality) != 0 {
+		gssFlags = append(gssFlags, gssapi.ContextFlagInteg)
+	}
+	if c.settings.layers&LayerConfidentiality != 0 {
+		gssFlags = append(gssFlags, gssapi.ContextFlagConf)
+	}
+	mt, err := spnego.NewKRB5TokenAPREQ(c.client, tkt, key, gssFlags, []int{flags.APOptionMutualRequired})
+	if err != nil {
+		return nil, false, fmt.Errorf("could not create AP_REQ: %w", err)
+	}
+	// The authenticator's time is needed to verify the AP_REP and its sequence number for the security layer.
+	if err := mt.APReq.DecryptAuthenticator(key); err != nil {
+		return nil, false, err
+	}
+	b, err := mt.Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	if c.spnego {
+		st := spnego.SPNEGOToken{
+			Init: true,
+			NegTokenInit: spnego.NegTokenInit{
+				MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
+				MechTokenBytes: b,
+			},
+		}
+		if b, err = st.Marshal(); err != nil {
+			return nil, false, err
+		}
+	}
+	c.key = key
+	c.auth = mt.APReq.Authenticator
+	c.seq = uint64(mt.APReq.Authenticator.SeqNumber)
+	return b, true, nil
+}
+
+// completeSecContext verifies the server's AP_REP, establishing the security context.
+func (c *Client) completeSecContext(token []byte) error {
+	if c.spnego {
+		init, nt, err := spnego.UnmarshalNegToken(token)
+		if err != nil {
+			return err
+		}
+		resp, ok := nt.(spnego.NegTokenResp)
+		if init || !ok {
+			return errors.New("server token is not a NegTokenResp")
+		}
+		if resp.State() == spnego.NegStateReject {
+			return errors.New("authentication rejected by the server")
+		}
+		token = resp.ResponseToken
+	}
+	var mt spnego.KRB5Token
+	if err := mt.Unmarshal(token); err != nil {
+		return err
+	}
+	if mt.IsKRBError() {
+		return mt.KRBError
+	}
+	if !mt.IsAPRep() {
+		return errors.New("server token does not contain an AP_REP")
+	}
+	ep, err := mt.APRep.DecryptEncPart(c.key, c.auth)
+	if err != nil {
+		return fmt.Errorf("could not verify AP_REP: %w", err)
+	}
+	if ep.Subkey.KeyType != 0 {
+		c.sc = gssapi.NewSecurityContext(ep.Subkey, false, true, c.seq)
+	} else {
+		c.sc = gssapi.NewSecurityContext(c.key, false, false, c.seq)
+	}
+	if c.spnego {
+		// With GSS-SPNEGO the security layer applies as soon as the context is established.
+		return c.startLayer(strongestLayer(c.settings.layers), defaultMaxBufferSize, false)
+	}
+	return nil
+}
+
+// NegotiateSaslAuth performs the security layer negotiation of the GSSAPI mechanism, RFC 4752 section 3.1. The token
+// is the server's wrapped offer of the security layers it supports and the maximum size of message it accepts. The
+// returned token selects the strongest layer supported by both the client and server and includes the authorization
+// identity, which may be empty.
+func (c *Client) NegotiateSaslAuth(token []byte, authzid string) ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.sc == nil {
+		return nil, errors.New("security context has not been established")
+	}
+	if c.spnego {
+		return nil, errors.New("security layer negotiation is not used by the GSS-SPNEGO mechanism")
+	}
+	p, _, err := c.sc.Unwrap(token)
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap security layer offer: %w", err)
+	}
+	if len(p) != 4 {
+		return nil, fmt.Errorf("security layer offer has length %d rather than 4", len(p))
+	}
+	layer := strongestLayer(c.settings.layers & p[0])
+	if layer == 0 {
+		return nil, fmt.Errorf("no security layer accepted by the client is offered by the server (offered: %#x)", p[0])
+	}
+	p[0] = 0
+	maxSend := binary.BigEndian.Uint32(p)
+	r := make([]byte, 4, 4+len(authzid))
+	if layer != LayerNone {
+		binary.BigEndian.PutUint32(r, c.settings.maxBufferSize)
+	}
+	r[0] = layer
+	r = append(r, authzid...)
+	b, err := c.sc.Wrap(r, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.startLayer(layer, maxSend, true); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// startLayer applies the security layer to the client's Conn. If pending the layer applies after the next message is
+// sent and its response received.
+func (c *Client) startLayer(layer byte, maxSend uint32, pending bool) error {
+	if layer == LayerNone || layer == 0 {
+		return nil
+	}
+	if c.conn == nil {
+		return errors.New("a security layer requires the connection to be wrapped with the client's Conn")
+	}
+	return c.conn.start(c.sc, layer == LayerConfidentiality, maxSend, pending)
+}
+
+// SecurityContext returns the per-message protection of the established security context, or nil if it has not been
+// established, so that application messages can be wrapped and unwrapped outside of the client's Conn. Messages
+// wrapped share the sequence numbers of those sent by the Conn.
+func (c *Client) SecurityContext() *gssapi.SecurityContext {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.sc
+}
+
+// DeleteSecContext destroys the security context of the authentication. A security layer applied to the client's
+// Conn remains in use.
+func (c *Client) DeleteSecContext() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.key = types.EncryptionKey{}
+	c.sc = nil
+	return nil
+}
+
+// strongestLayer returns the strongest security layer in the bit mask, or zero if there is none.
+func strongestLayer(l byte) byte {
+	for _, layer := range []byte{LayerConfidentiality, LayerIntegrity, LayerNone} {
+		if l&layer != 0 {
+			return layer
+		}
+	}
+	return 0
+}
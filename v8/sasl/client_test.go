@@ -0,0 +1,272 @@
+package sasl
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/test/krbtest"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSPN = "ldap/ldap.test.gokrb5"
+
+// testAcceptor is the server side of the GSSAPI mechanism.
+type testAcceptor struct {
+	settings *service.Settings
+	sc       *gssapi.SecurityContext
+}
+
+func testSetup(t *testing.T) (*client.Client, *testAcceptor) {
+	t.Helper()
+	k, err := krbtest.NewKDC("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	t.Cleanup(func() { k.Close() })
+	if err := k.AddPrincipal(testSPN, "servicepassword"); err != nil {
+		t.Fatalf("error adding service principal: %v", err)
+	}
+	kt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	cl, err := k.NewClient("testuser1")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	return cl, &testAcceptor{settings: service.NewSettings(kt, service.DecodePAC(false))}
+}
+
+// accept verifies the AP_REQ within the token and returns a token containing the AP_REP, with an acceptor subkey
+// if requested.
+func (a *testAcceptor) accept(t *testing.T, token []byte, subkey bool) []byte {
+	t.Helper()
+	var mt spnego.KRB5Token
+	if err := mt.Unmarshal(token); err != nil {
+		t.Fatalf("error unmarshaling AP_REQ token: %v", err)
+	}
+	ok, _, err := service.VerifyAPREQ(&mt.APReq, a.settings)
+	if !ok {
+		t.Fatalf("AP_REQ not verified: %v", err)
+	}
+	key := mt.APReq.Ticket.DecryptedEncPart.Key
+	ep := messages.EncAPRepPart{
+		CTime: mt.APReq.Authenticator.CTime,
+		Cusec: mt.APReq.Authenticator.Cusec,
+	}
+	if subkey {
+		ep.Subkey = types.EncryptionKey{KeyType: key.KeyType, KeyValue: make([]byte, len(key.KeyValue))}
+		copy(ep.Subkey.KeyValue, "acceptor subkey value for the test")
+		ep.SequenceNumber = 42
+	}
+	b, err := asn1.Marshal(ep)
+	if err != nil {
+		t.Fatalf("error marshaling AP_REP encrypted part: %v", err)
+	}
+	encPart, err := crypto.GetEncryptedData(asn1tools.AddASNAppTag(b, asnAppTag.EncAPRepPart), key, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		t.Fatalf("error encrypting AP_REP: %v", err)
+	}
+	if subkey {
+		a.sc = gssapi.NewSecurityContext(ep.Subkey, true, true, uint64(ep.SequenceNumber))
+	} else {
+		a.sc = gssapi.NewSecurityContext(key, true, false, 0)
+	}
+	rep := messages.APRep{PVNO: 5, MsgType: msgtype.KRB_AP_REP, EncPart: encPart}
+	b, err = asn1.Marshal(rep)
+	if err != nil {
+		t.Fatalf("error marshaling AP_REP: %v", err)
+	}
+	oid, _ := asn1.Marshal(gssapi.OIDKRB5.OID())
+	tb := append(oid, 0x02, 0x00)
+	tb = append(tb, asn1tools.AddASNAppTag(b, asnAppTag.APREP)...)
+	return asn1tools.AddASNAppTag(tb, 0)
+}
+
+func (a *testAcceptor) wrap(t *testing.T, payload []byte, sealed bool) []byte {
+	t.Helper()
+	b, err := a.sc.Wrap(payload, sealed)
+	if err != nil {
+		t.Fatalf("error wrapping: %v", err)
+	}
+	return b
+}
+
+func TestClient_GSSAPI(t *testing.T) {
+	t.Parallel()
+	cl, a := testSetup(t)
+	for _, subkey := range []bool{false, true} {
+		sc := NewClient(cl)
+		b, cont, err := sc.InitSecContext(testSPN, nil)
+		if err != nil {
+			t.Fatalf("error initiating security context: %v", err)
+		}
+		assert.True(t, cont, "mutual authentication should need another call")
+		b, cont, err = sc.InitSecContext(testSPN, a.accept(t, b, subkey))
+		if err != nil {
+			t.Fatalf("error completing security context: %v", err)
+		}
+		assert.False(t, cont, "no further call should be needed")
+		assert.Equal(t, 0, len(b), "no token should be returned")
+
+		b, err = sc.NegotiateSaslAuth(a.wrap(t, []byte{LayerNone | LayerIntegrity, 0, 0, 0}, false), "u:testuser1")
+		if err != nil {
+			t.Fatalf("error negotiating security layer: %v", err)
+		}
+		p, _, err := a.sc.Unwrap(b)
+		if err != nil {
+			t.Fatalf("error unwrapping security layer selection: %v", err)
+		}
+		assert.Equal(t, append([]byte{LayerNone, 0, 0, 0}, "u:testuser1"...), p, "security layer selection not as expected")
+		assert.NotNil(t, sc.SecurityContext(), "established security context should be returned")
+		assert.NoError(t, sc.DeleteSecContext(), "error deleting security context")
+		assert.Nil(t, sc.SecurityContext(), "deleted security context should not be returned")
+	}
+
+	sc := NewClient(cl, SecurityLayers(LayerConfidentiality))
+	b, _, err := sc.InitSecContext(testSPN, nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	if _, _, err = sc.InitSecContext(testSPN, a.accept(t, b, false)); err != nil {
+		t.Fatalf("error completing security context: %v", err)
+	}
+	_, err = sc.NegotiateSaslAuth(a.wrap(t, []byte{LayerNone | LayerIntegrity, 0, 0, 0}, false), "")
+	assert.Error(t, err, "negotiation should fail when the server does not offer an accepted layer")
+	_, err = sc.NegotiateSaslAuth(a.wrap(t, []byte{LayerConfidentiality, 0, 0x10, 0}, false), "")
+	assert.Error(t, err, "negotiating a security layer without a wrapped connection should fail")
+}
+
+func TestConn_SecurityLayer(t *testing.T) {
+	t.Parallel()
+	cl, a := testSetup(t)
+	for _, layer := range []byte{LayerIntegrity, LayerConfidentiality} {
+		c, s := net.Pipe()
+		sc := NewClient(cl, SecurityLayers(LayerIntegrity|LayerConfidentiality))
+		conn := sc.Conn(c)
+		b, _, err := sc.InitSecContext(testSPN, nil)
+		if err != nil {
+			t.Fatalf("error initiating security context: %v", err)
+		}
+		if _, _, err = sc.InitSecContext(testSPN, a.accept(t, b, true)); err != nil {
+			t.Fatalf("error completing security context: %v", err)
+		}
+		b, err = sc.NegotiateSaslAuth(a.wrap(t, []byte{LayerNone | layer, 0, 0x01, 0}, false), "")
+		if err != nil {
+			t.Fatalf("error negotiating security layer: %v", err)
+		}
+		p, _, err := a.sc.Unwrap(b)
+		if err != nil {
+			t.Fatalf("error unwrapping security layer selection: %v", err)
+		}
+		assert.Equal(t, layer, p[0], "security layer selected not as expected")
+		assert.Equal(t, uint32(defaultMaxBufferSize), binary.BigEndian.Uint32(append([]byte{0}, p[1:]...)), "maximum buffer size not as expected")
+		sc.DeleteSecContext()
+
+		// The last bind request and its response are not wrapped.
+		bindReq := []byte{0x30, 0x03, 0x02, 0x01, 0x01}
+		bindRep := []byte{0x30, 0x03, 0x02, 0x01, 0x02}
+		go func() {
+			conn.Write(bindReq)
+		}()
+		rb := make([]byte, len(bindReq))
+		io.ReadFull(s, rb)
+		assert.Equal(t, bindReq, rb, "bind request should not be wrapped")
+		go func() {
+			s.Write(bindRep)
+		}()
+		rb = make([]byte, len(bindRep))
+		io.ReadFull(conn, rb)
+		assert.Equal(t, bindRep, rb, "bind response should not be wrapped")
+
+		// Messages are then wrapped and split to the server's maximum buffer size.
+		msg := make([]byte, 600)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+		go func() {
+			conn.Write(msg)
+		}()
+		var got []byte
+		for len(got) < len(msg) {
+			var l [4]byte
+			io.ReadFull(s, l[:])
+			n := binary.BigEndian.Uint32(l[:])
+			assert.True(t, n <= 256, "buffer exceeds the server's maximum size")
+			tb := make([]byte, n)
+			io.ReadFull(s, tb)
+			p, sealed, err := a.sc.Unwrap(tb)
+			if err != nil {
+				t.Fatalf("error unwrapping message from client: %v", err)
+			}
+			assert.Equal(t, layer == LayerConfidentiality, sealed, "sealed flag not as expected")
+			got = append(got, p...)
+		}
+		assert.Equal(t, msg, got, "message from client not as expected")
+
+		tb := a.wrap(t, msg, layer == LayerConfidentiality)
+		frame := make([]byte, 4, 4+len(tb))
+		binary.BigEndian.PutUint32(frame, uint32(len(tb)))
+		frame = append(frame, tb...)
+		go func() {
+			s.Write(frame)
+		}()
+		got = make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, got); err != nil {
+			t.Fatalf("error reading wrapped message: %v", err)
+		}
+		assert.Equal(t, msg, got, "message from server not as expected")
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestClient_GSSSPNEGO(t *testing.T) {
+	t.Parallel()
+	cl, a := testSetup(t)
+	sc := NewClient(cl, Mechanism(MechanismGSSSPNEGO))
+	assert.Equal(t, MechanismGSSSPNEGO, sc.Mechanism(), "mechanism not as expected")
+	b, cont, err := sc.InitSecContext(testSPN, nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	assert.True(t, cont, "mutual authentication should need another call")
+	var st spnego.SPNEGOToken
+	if err := st.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling SPNEGO token: %v", err)
+	}
+	assert.True(t, st.Init, "initial token should be a NegTokenInit")
+	resp := spnego.SPNEGOToken{
+		Resp: true,
+		NegTokenResp: spnego.NegTokenResp{
+			NegState:      asn1.Enumerated(spnego.NegStateAcceptCompleted),
+			SupportedMech: gssapi.OIDKRB5.OID(),
+			ResponseToken: a.accept(t, st.NegTokenInit.MechTokenBytes, false),
+		},
+	}
+	rb, err := resp.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling NegTokenResp: %v", err)
+	}
+	_, cont, err = sc.InitSecContext(testSPN, rb)
+	if err != nil {
+		t.Fatalf("error completing security context: %v", err)
+	}
+	assert.False(t, cont, "no further call should be needed")
+	_, err = sc.NegotiateSaslAuth(nil, "")
+	assert.Error(t, err, "security layer negotiation should not be used with GSS-SPNEGO")
+}
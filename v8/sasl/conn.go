@@ -0,0 +1,183 @@
+package sasl
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+)
+
+// Conn is a connection to which the security layer negotiated by a Client is applied once authentication completes.
+// Messages are then framed as SASL buffers, each a four byte big endian length followed by a Wrap token.
+//
+// Before the security layer applies, data read is passed through on the boundaries of BER encoded messages, as used by
+// LDAP, so that the first message protected by the security layer can be identified.
+type Conn struct {
+	net.Conn
+	maxRecv uint32
+	mux     sync.Mutex
+	sc      *gssapi.SecurityContext
+	sealed  bool
+	maxSend int
+	// wpending indicates the security layer applies after the next write, rpending after the next message read.
+	wpending bool
+	rpending bool
+	wactive  bool
+	ractive  bool
+	rmux     sync.Mutex
+	rbuf     []byte
+	wmux     sync.Mutex
+}
+
+// start applies the security layer to the connection.
+func (c *Conn) start(sc *gssapi.SecurityContext, sealed bool, maxSend uint32, pending bool) error {
+	if maxSend == 0 || maxSend > maxBufferSizeLimit {
+		maxSend = maxBufferSizeLimit
+	}
+	n, err := sc.WrapSizeLimit(int(maxSend), sealed)
+	if err != nil {
+		return err
+	}
+	if n < 1 {
+		return fmt.Errorf("server's maximum buffer size of %d is too small for the security layer", maxSend)
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.sc = sc
+	c.sealed = sealed
+	c.maxSend = n
+	c.wpending = pending
+	c.wactive = !pending
+	c.ractive = !pending
+	return nil
+}
+
+// Write writes the data to the connection, wrapped if the security layer applies.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wmux.Lock()
+	defer c.wmux.Unlock()
+	c.mux.Lock()
+	active, sc, sealed, n := c.wactive, c.sc, c.sealed, c.maxSend
+	if c.wpending {
+		// This is the last message of the authentication. The response to it is the last message read unwrapped.
+		c.wpending = false
+		c.wactive = true
+		c.rpending = true
+	}
+	c.mux.Unlock()
+	if !active {
+		return c.Conn.Write(b)
+	}
+	for i := 0; i < len(b); i += n {
+		j := i + n
+		if j > len(b) {
+			j = len(b)
+		}
+		t, err := sc.Wrap(b[i:j], sealed)
+		if err != nil {
+			return i, err
+		}
+		f := make([]byte, 4, 4+len(t))
+		binary.BigEndian.PutUint32(f, uint32(len(t)))
+		if _, err := c.Conn.Write(append(f, t...)); err != nil {
+			return i, err
+		}
+	}
+	return len(b), nil
+}
+
+// Read reads data from the connection, unwrapping it if the security layer applies.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.rmux.Lock()
+	defer c.rmux.Unlock()
+	for len(c.rbuf) < 1 {
+		c.mux.Lock()
+		active, sc, sealed := c.ractive, c.sc, c.sealed
+		c.mux.Unlock()
+		if active {
+			p, err := c.readWrapped(sc, sealed)
+			if err != nil {
+				return 0, err
+			}
+			c.rbuf = p
+			continue
+		}
+		m, err := readBER(c.Conn)
+		if err != nil {
+			return 0, err
+		}
+		c.rbuf = m
+		c.mux.Lock()
+		if c.rpending {
+			c.rpending = false
+			c.ractive = true
+		}
+		c.mux.Unlock()
+	}
+	n := copy(b, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+// readWrapped reads a SASL buffer from the connection and returns the payload of its Wrap token.
+func (c *Conn) readWrapped(sc *gssapi.SecurityContext, sealed bool) ([]byte, error) {
+	var l [4]byte
+	if _, err := io.ReadFull(c.Conn, l[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(l[:])
+	if n > c.maxRecv {
+		return nil, fmt.Errorf("SASL buffer of %d bytes exceeds the maximum of %d", n, c.maxRecv)
+	}
+	t := make([]byte, n)
+	if _, err := io.ReadFull(c.Conn, t); err != nil {
+		return nil, err
+	}
+	p, s, err := sc.Unwrap(t)
+	if err != nil {
+		return nil, err
+	}
+	if sealed && !s {
+		return nil, errors.New("unsealed message received when confidentiality was negotiated")
+	}
+	return p, nil
+}
+
+// readBER reads a single BER encoded element, such as an LDAP message, from the reader.
+func readBER(r io.Reader) ([]byte, error) {
+	h := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, err
+	}
+	if h[0]&0x1F == 0x1F {
+		return nil, errors.New("BER elements with multi-byte tags are not supported")
+	}
+	l := int(h[1])
+	if l&0x80 != 0 {
+		nl := l & 0x7F
+		if nl == 0 || nl > 4 {
+			return nil, fmt.Errorf("unsupported BER length encoding %#x", h[1])
+		}
+		h = h[:2+nl]
+		if _, err := io.ReadFull(r, h[2:]); err != nil {
+			return nil, err
+		}
+		l = 0
+		for _, b := range h[2:] {
+			l = l<<8 | int(b)
+		}
+	}
+	if l < 0 || l > int(maxBufferSizeLimit) {
+		return nil, fmt.Errorf("BER element length %d too large", l)
+	}
+	m := make([]byte, len(h)+l)
+	copy(m, h)
+	if _, err := io.ReadFull(r, m[len(h):]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
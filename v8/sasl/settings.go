@@ -0,0 +1,69 @@
+package sasl
+
+// Settings defines the configuration of a SASL GSSAPI client.
+type Settings struct {
+	mechanism     string
+	layers        byte
+	maxBufferSize uint32
+}
+
+// NewSettings creates a new Settings. By default the GSSAPI mechanism is used without a security layer.
+func NewSettings(settings ...func(*Settings)) *Settings {
+	s := &Settings{
+		mechanism:     MechanismGSSAPI,
+		layers:        LayerNone,
+		maxBufferSize: defaultMaxBufferSize,
+	}
+	for _, set := range settings {
+		set(s)
+	}
+	return s
+}
+
+// Mechanism used to configure the SASL mechanism the client's tokens are for, either MechanismGSSAPI or
+// MechanismGSSSPNEGO.
+//
+// s := NewSettings(Mechanism(MechanismGSSSPNEGO))
+func Mechanism(m string) func(*Settings) {
+	return func(s *Settings) {
+		s.mechanism = m
+	}
+}
+
+// Mechanism returns the SASL mechanism the client's tokens are for.
+func (s *Settings) Mechanism() string {
+	return s.mechanism
+}
+
+// SecurityLayers used to configure the security layers the client accepts, as a bit mask of the Layer constants.
+// The strongest layer accepted by both the client and the server is used.
+//
+// s := NewSettings(SecurityLayers(LayerIntegrity|LayerConfidentiality))
+func SecurityLayers(l byte) func(*Settings) {
+	return func(s *Settings) {
+		s.layers = l
+	}
+}
+
+// SecurityLayers returns the bit mask of the security layers the client accepts.
+func (s *Settings) SecurityLayers() byte {
+	return s.layers
+}
+
+// MaxBufferSize used to configure the maximum size of a wrapped message the client accepts when a security layer
+// is used. The size cannot exceed 16MB.
+//
+// s := NewSettings(MaxBufferSize(1 << 20))
+func MaxBufferSize(n uint32) func(*Settings) {
+	return func(s *Settings) {
+		if n > maxBufferSizeLimit {
+			n = maxBufferSizeLimit
+		}
+		s.maxBufferSize = n
+	}
+}
+
+// MaxBufferSize returns the maximum size of a wrapped message the client accepts.
+func (s *Settings) MaxBufferSize() uint32 {
+	return s.maxBufferSize
+}
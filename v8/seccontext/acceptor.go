@@ -0,0 +1,365 @@
+package seccontext
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Acceptor accepts a security context from a client as the GSS-API context acceptor, verifying the AP_REQ with the
+// service's keytab. An Acceptor is used for a single security context.
+type Acceptor struct {
+	settings  *service.Settings
+	mux       sync.Mutex
+	creds     *credentials.Credentials
+	flags     int
+	keys      Keys
+	sc        *gssapi.SecurityContext
+	exchanges int
+	tokens    []byte
+	// The state of a SPNEGO negotiation taking more than one token from the initiator: the mechanisms it offered,
+	// the Kerberos mechanism selected if it did not send a token for it, whether the mechListMIC exchange is
+	// required and whether the acceptor is waiting for the initiator's mechListMIC to complete the context.
+	mechs       []asn1.ObjectIdentifier
+	mech        asn1.ObjectIdentifier
+	micRequired bool
+	awaitMIC    bool
+}
+
+// NewAcceptor returns an acceptor of security contexts for the service with the keytab. The service settings
+// configure the verification of the AP_REQ as they do for the HTTP handlers of the spnego package.
+func NewAcceptor(kt *keytab.Keytab, settings ...func(*service.Settings)) *Acceptor {
+	return &Acceptor{
+		settings: service.NewSettings(kt, settings...),
+	}
+}
+
+// AcceptSecContext verifies the initiator's token, RFC 2743 section 2.2.2, which is either a KRB5 token containing an
+// AP_REQ or a SPNEGO NegTokenInit with one as its mechanism token, establishing the security context. The token
+// returned is to be sent to the initiator in the same form as the token received. It contains an AP_REP asserting an
+// acceptor subkey and sequence number if mutual authentication is requested and is otherwise nil, except that a SPNEGO
+// NegTokenResp is always returned. If the AP_REQ is rejected the token returned, if not nil, informs the initiator of
+// the error.
+//
+// A SPNEGO initiator offering Kerberos V5 without a token for it, as it sends none or its optimistic token is for a
+// mechanism it prefers such as NEGOEX, is replied to with a NegTokenResp selecting Kerberos and continues with its
+// Kerberos token in a NegTokenResp. If Kerberos is not the initiator's preferred mechanism the mechListMICs must then
+// be exchanged, RFC 4178 section 5, and an initiator that does not send its mechListMIC with its Kerberos token is
+// sent the acceptor's and its reply with its own completes the context. The context is only established, as
+// Established reports, once the negotiation is complete.
+//
+// If the service is configured with service.IAKERBProxy the initiator can also use the IAKERB mechanism, sending IAKERB
+// tokens with its messages for the KDCs before the AP_REQ. Each is proxied to a KDC and the token returned holds the
+// KDC's reply, the security context not being established, as Established reports, until the AP_REQ is accepted.
+func (a *Acceptor) AcceptSecContext(token []byte) ([]byte, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.established() {
+		return nil, errors.New("security context has already been established")
+	}
+	if len(token) > 0 && token[0] == 0xa1 {
+		// A NegTokenResp continuing a SPNEGO negotiation, which is not framed with the SPNEGO OID.
+		return a.continueSPNEGO(token)
+	}
+	if gssapi.IsIAKERBToken(token) {
+		return a.proxyIAKERB(token)
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.UnmarshalWithParams(token, &oid, "application,explicit,tag:0"); err != nil {
+		return nil, fmt.Errorf("initiator token is not a GSS-API token: %w", err)
+	}
+	if !oid.Equal(gssapi.OIDSPNEGO.OID()) {
+		return a.acceptKRB5(token)
+	}
+	var st spnego.SPNEGOToken
+	if err := st.Unmarshal(token); err != nil {
+		return nil, err
+	}
+	if !st.Init || len(st.NegTokenInit.MechTypes) < 1 {
+		return rejectSPNEGO(errors.New("SPNEGO token is not a NegTokenInit"))
+	}
+	if a.mechs != nil {
+		return rejectSPNEGO(errors.New("SPNEGO negotiation has already been started"))
+	}
+	mech, i, ok := spnego.KRB5Mech(st.NegTokenInit.MechTypes)
+	if !ok {
+		return rejectSPNEGO(fmt.Errorf("SPNEGO mechanisms %v do not include KRB5", st.NegTokenInit.MechTypes))
+	}
+	a.mechs = st.NegTokenInit.MechTypes
+	// The mechListMIC exchange is required if the initiator's preferred mechanism is not the one selected.
+	a.micRequired = i > 0
+	if i > 0 || len(st.NegTokenInit.MechTokenBytes) < 1 {
+		// The initiator's optimistic token, if any, is for another mechanism so it is asked for a Kerberos token.
+		a.mech = mech
+		state := spnego.NegStateAcceptIncomplete
+		if a.micRequired {
+			state = spnego.NegStateRequestMIC
+		}
+		resp := spnego.SPNEGOToken{
+			Resp: true,
+			NegTokenResp: spnego.NegTokenResp{
+				NegState:      asn1.Enumerated(state),
+				SupportedMech: mech,
+			},
+		}
+		return resp.Marshal()
+	}
+	b, err := a.acceptKRB5(st.NegTokenInit.MechTokenBytes)
+	if err != nil {
+		return rejectSPNEGO(err)
+	}
+	return a.completeSPNEGO(mech, b, st.NegTokenInit.MechListMIC)
+}
+
+// continueSPNEGO continues the SPNEGO negotiation with the initiator's NegTokenResp, which has either its Kerberos
+// token for the mechanism selected or its mechListMIC completing the context.
+func (a *Acceptor) continueSPNEGO(token []byte) ([]byte, error) {
+	var st spnego.SPNEGOToken
+	if err := st.Unmarshal(token); err != nil {
+		return nil, err
+	}
+	resp := st.NegTokenResp
+	switch {
+	case a.awaitMIC:
+		if len(resp.MechListMIC) < 1 {
+			a.resetSPNEGO()
+			return rejectSPNEGO(errors.New("initiator did not send the mechListMIC required"))
+		}
+		if err := spnego.VerifyMechListMIC(a.sc, a.mechs, resp.MechListMIC); err != nil {
+			a.resetSPNEGO()
+			return rejectSPNEGO(err)
+		}
+		a.awaitMIC = false
+		return nil, nil
+	case a.mech != nil && a.sc == nil:
+		if len(resp.ResponseToken) < 1 {
+			return rejectSPNEGO(errors.New("SPNEGO NegTokenResp does not contain a mechanism token"))
+		}
+		b, err := a.acceptKRB5(resp.ResponseToken)
+		if err != nil {
+			return rejectSPNEGO(err)
+		}
+		return a.completeSPNEGO(nil, b, resp.MechListMIC)
+	default:
+		return nil, errors.New("SPNEGO NegTokenResp does not continue a negotiation")
+	}
+}
+
+// completeSPNEGO returns the NegTokenResp replying to the initiator's accepted Kerberos token with the acceptor's
+// token, if any, naming the mechanism if it is the acceptor's first reply. The mechListMICs are exchanged if the
+// initiator sent its MIC or if the exchange is required, in which case the acceptor waits for the initiator's MIC.
+func (a *Acceptor) completeSPNEGO(mech asn1.ObjectIdentifier, b, mic []byte) ([]byte, error) {
+	resp := spnego.SPNEGOToken{
+		Resp: true,
+		NegTokenResp: spnego.NegTokenResp{
+			NegState:      asn1.Enumerated(spnego.NegStateAcceptCompleted),
+			SupportedMech: mech,
+			ResponseToken: b,
+		},
+	}
+	if len(mic) > 0 || a.micRequired {
+		var err error
+		if len(mic) > 0 {
+			err = spnego.VerifyMechListMIC(a.sc, a.mechs, mic)
+		} else {
+			resp.NegTokenResp.NegState = asn1.Enumerated(spnego.NegStateAcceptIncomplete)
+			a.awaitMIC = true
+		}
+		if err == nil {
+			resp.NegTokenResp.MechListMIC, err = spnego.MechListMIC(a.sc, a.mechs)
+		}
+		if err != nil {
+			a.resetSPNEGO()
+			return rejectSPNEGO(err)
+		}
+	}
+	return resp.Marshal()
+}
+
+// resetSPNEGO abandons the security context of a SPNEGO negotiation that failed.
+func (a *Acceptor) resetSPNEGO() {
+	a.creds = nil
+	a.keys = Keys{}
+	a.sc = nil
+	a.awaitMIC = false
+}
+
+// established returns whether the security context has been established.
+func (a *Acceptor) established() bool {
+	return a.sc != nil && !a.awaitMIC
+}
+
+// acceptKRB5 verifies the AP_REQ of the KRB5 token and returns the KRB5 token with the AP_REP replying to it if mutual
+// authentication is requested. If the AP_REQ is rejected with a KRB_ERROR a KRB5 token containing it is returned. The
+// tokens returned are framed with the mechanism OID of the AP_REQ's token, which may be that of IAKERB.
+func (a *Acceptor) acceptKRB5(token []byte) ([]byte, error) {
+	var mt spnego.KRB5Token
+	if err := mt.Unmarshal(token); err != nil {
+		return nil, err
+	}
+	if !mt.IsAPReq() {
+		return nil, errors.New("initiator token does not contain an AP_REQ")
+	}
+	if len(a.tokens) > 0 && !mt.OID.Equal(gssapi.OIDGSSIAKerb.OID()) {
+		return nil, errors.New("AP_REQ following IAKERB exchanges is not an IAKERB token")
+	}
+	ok, creds, err := service.VerifyAPREQ(&mt.APReq, a.settings)
+	if !ok {
+		if err == nil {
+			err = errors.New("AP_REQ not valid")
+		}
+		var e messages.KRBError
+		if errors.As(err, &e) {
+			et := spnego.NewKRB5TokenKRBError(e)
+			et.OID = mt.OID
+			if b, merr := et.Marshal(); merr == nil {
+				return b, err
+			}
+		}
+		return nil, err
+	}
+	auth := mt.APReq.Authenticator
+	if len(a.tokens) > 0 {
+		if err := verifyIAKERBFinished(auth, a.tokens); err != nil {
+			return nil, err
+		}
+	}
+	f := checksumFlags(auth.Cksum)
+	if f&gssapi.ContextFlagMutual == 0 && !types.IsFlagSet(&mt.APReq.APOptions, flags.APOptionMutualRequired) {
+		a.creds = creds
+		a.flags = f
+		a.keys = apReqKeys(mt.APReq.Ticket.DecryptedEncPart.Key, auth)
+		a.sc = service.SecurityContext(&mt.APReq)
+		return nil, nil
+	}
+	f |= gssapi.ContextFlagMutual
+	key := mt.APReq.Ticket.DecryptedEncPart.Key
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	subkey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate acceptor subkey: %w", err)
+	}
+	seq, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
+	if err != nil {
+		return nil, fmt.Errorf("could not generate sequence number: %w", err)
+	}
+	rep, err := messages.NewAPRep(auth, key, subkey, seq.Int64())
+	if err != nil {
+		return nil, err
+	}
+	rt := spnego.NewKRB5TokenAPREP(rep)
+	rt.OID = mt.OID
+	b, err := rt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	a.creds = creds
+	a.flags = f
+	a.keys = apReqKeys(key, auth)
+	a.keys.AcceptorSubkey = subkey
+	a.keys.AcceptorSeqNumber = seq.Uint64()
+	a.sc = gssapi.NewSecurityContext(subkey, true, true, seq.Uint64())
+	a.sc.ExpectSequence(uint64(auth.SeqNumber))
+	return b, nil
+}
+
+// rejectSPNEGO returns the SPNEGO NegTokenResp rejecting the security context with the error.
+func rejectSPNEGO(err error) ([]byte, error) {
+	resp := spnego.SPNEGOToken{
+		Resp:         true,
+		NegTokenResp: spnego.NegTokenResp{NegState: asn1.Enumerated(spnego.NegStateReject)},
+	}
+	b, merr := resp.Marshal()
+	if merr != nil {
+		return nil, err
+	}
+	return b, err
+}
+
+// checksumFlags returns the context flags requested by the initiator in the authenticator checksum, RFC 4121 section
+// 4.1.1.
+func checksumFlags(cksum types.Checksum) int {
+	if cksum.CksumType != chksumtype.GSSAPI || len(cksum.Checksum) < 24 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(cksum.Checksum[20:24]))
+}
+
+// Established returns whether the security context has been established.
+func (a *Acceptor) Established() bool {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.established()
+}
+
+// Credentials returns the credentials of the client authenticated by the AP_REQ, or nil if the security context has
+// not been established.
+func (a *Acceptor) Credentials() *credentials.Credentials {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if !a.established() {
+		return nil
+	}
+	return a.creds
+}
+
+// Flags returns the context flags requested by the initiator, as a bit mask of the gssapi.ContextFlag constants.
+func (a *Acceptor) Flags() int {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.flags
+}
+
+// SecurityContext returns the per-message protection of the established security context, or nil if it has not been
+// established.
+func (a *Acceptor) SecurityContext() *gssapi.SecurityContext {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if !a.established() {
+		return nil
+	}
+	return a.sc
+}
+
+// Keys returns the keys and initial sequence numbers of the established security context and whether it has been
+// established.
+func (a *Acceptor) Keys() (Keys, bool) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.keys, a.established()
+}
+
+// DeleteSecContext destroys the security context.
+func (a *Acceptor) DeleteSecContext() error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.creds = nil
+	a.keys = Keys{}
+	a.sc = nil
+	a.exchanges = 0
+	a.tokens = nil
+	a.mechs = nil
+	a.mech = nil
+	a.micRequired = false
+	a.awaitMIC = false
+	return nil
+}
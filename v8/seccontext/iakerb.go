@@ -0,0 +1,227 @@
+package seccontext
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// maxIAKERBExchanges is the most KDC exchanges an acceptor proxies for a security context, which is enough for an AS
+// exchange with pre-authentication followed by TGS exchanges across several referrals.
+const maxIAKERBExchanges = 16
+
+// iakerbExchange runs the client's exchanges with the KDCs for a service ticket in the background, passing each
+// message for a KDC to the initiator to tunnel through the context tokens and the replies the acceptor returns back.
+type iakerbExchange struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	reqs   chan iakerbRequest
+	reps   chan []byte
+	done   chan iakerbResult
+}
+
+// iakerbRequest is a message for a KDC of the realm.
+type iakerbRequest struct {
+	realm string
+	b     []byte
+}
+
+// iakerbResult is the outcome of the client's exchanges for the service ticket.
+type iakerbResult struct {
+	tkt messages.Ticket
+	key types.EncryptionKey
+	err error
+}
+
+// newIAKERBExchange starts the client's exchanges for a service ticket for the SPN.
+func newIAKERBExchange(cl *client.Client, spn string) *iakerbExchange {
+	ctx, cancel := context.WithCancel(context.Background())
+	x := &iakerbExchange{
+		ctx:    ctx,
+		cancel: cancel,
+		reqs:   make(chan iakerbRequest),
+		reps:   make(chan []byte),
+		done:   make(chan iakerbResult, 1),
+	}
+	go func() {
+		tkt, key, err := cl.GetServiceTicketContext(client.WithKDCExchange(ctx, x.exchange), spn)
+		x.done <- iakerbResult{tkt: tkt, key: key, err: err}
+	}()
+	return x
+}
+
+// exchange is the client's KDC exchange function, which passes the message for a KDC of the realm to the initiator
+// and waits for the KDC's reply.
+func (x *iakerbExchange) exchange(ctx context.Context, realm string, b []byte) ([]byte, error) {
+	select {
+	case x.reqs <- iakerbRequest{realm: realm, b: b}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case rb := <-x.reps:
+		return rb, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// next returns the client's next message for a KDC, or the result of the exchanges once the client has the service
+// ticket or has failed to get it.
+func (x *iakerbExchange) next() (*iakerbRequest, *iakerbResult) {
+	select {
+	case r := <-x.reqs:
+		return &r, nil
+	case res := <-x.done:
+		x.cancel()
+		return nil, &res
+	}
+}
+
+// reply passes the KDC's reply to the client's last message.
+func (x *iakerbExchange) reply(b []byte) {
+	select {
+	case x.reps <- b:
+	case <-x.ctx.Done():
+	}
+}
+
+// initIAKERB initiates the security context with IAKERB, returning the IAKERB token with the client's first message
+// for a KDC, or the AP_REQ if the client needs no exchanges with the KDCs for the service ticket.
+func (i *Initiator) initIAKERB() ([]byte, bool, error) {
+	if i.settings.SPNEGO() {
+		return nil, false, errors.New("IAKERB tokens are not negotiated with SPNEGO")
+	}
+	i.tokens = nil
+	i.cookie = nil
+	if tkt, key, ok := i.settings.ServiceTicket(); ok {
+		return i.initAPREQ(tkt, key)
+	}
+	i.exchange = newIAKERBExchange(i.client, i.spn)
+	return i.stepIAKERB()
+}
+
+// continueIAKERB passes the KDC's reply in the acceptor's IAKERB token to the client and returns the next token.
+func (i *Initiator) continueIAKERB(token []byte) ([]byte, bool, error) {
+	var t gssapi.IAKERBToken
+	if err := t.Unmarshal(token); err != nil {
+		i.abortIAKERB()
+		return nil, false, err
+	}
+	i.tokens = append(i.tokens, token...)
+	i.cookie = t.Header.Cookie
+	i.exchange.reply(t.Message)
+	return i.stepIAKERB()
+}
+
+// stepIAKERB returns the IAKERB token with the client's next message for a KDC or, once the client has the service
+// ticket, the AP_REQ.
+func (i *Initiator) stepIAKERB() ([]byte, bool, error) {
+	req, res := i.exchange.next()
+	if res != nil {
+		i.exchange = nil
+		if res.err != nil {
+			i.tokens = nil
+			return nil, false, fmt.Errorf("could not get service ticket for %s via IAKERB: %w", i.spn, res.err)
+		}
+		return i.initAPREQ(res.tkt, res.key)
+	}
+	t := gssapi.IAKERBToken{
+		Initial: len(i.tokens) == 0,
+		Header:  gssapi.IAKERBHeader{TargetRealm: req.realm, Cookie: i.cookie},
+		Message: req.b,
+	}
+	b, err := t.Marshal()
+	if err != nil {
+		i.abortIAKERB()
+		return nil, false, err
+	}
+	i.tokens = append(i.tokens, b...)
+	return b, true, nil
+}
+
+// abortIAKERB abandons the client's exchanges with the KDCs.
+func (i *Initiator) abortIAKERB() {
+	if i.exchange != nil {
+		i.exchange.cancel()
+		i.exchange = nil
+	}
+	i.tokens = nil
+	i.cookie = nil
+}
+
+// iakerbFinished adds the IAKERB-FINISHED message binding the IAKERB tokens exchanged to the security context to the
+// authenticator checksum, keyed with the authenticator's subkey.
+func iakerbFinished(auth *types.Authenticator, tokens []byte) error {
+	f, err := gssapi.NewIAKERBFinished(auth.SubKey, tokens)
+	if err != nil {
+		return err
+	}
+	b, err := f.Marshal()
+	if err != nil {
+		return err
+	}
+	auth.Cksum.Checksum = gssapi.AppendChecksumExtension(auth.Cksum.Checksum, gssapi.IAKERBChecksumExtension, b)
+	return nil
+}
+
+// proxyIAKERB exchanges the KDC message of the initiator's IAKERB token with a KDC of the target realm and returns
+// the IAKERB token with the KDC's reply.
+func (a *Acceptor) proxyIAKERB(token []byte) ([]byte, error) {
+	cl := a.settings.IAKERBProxy()
+	if cl == nil {
+		return nil, errors.New("IAKERB security contexts are not accepted")
+	}
+	if a.exchanges >= maxIAKERBExchanges {
+		return nil, fmt.Errorf("more than %d IAKERB exchanges for the security context", maxIAKERBExchanges)
+	}
+	var t gssapi.IAKERBToken
+	if err := t.Unmarshal(token); err != nil {
+		return nil, err
+	}
+	if t.Initial != (a.exchanges == 0) {
+		return nil, errors.New("only the initiator's first IAKERB token is framed with the mechanism OID")
+	}
+	realm := t.Header.TargetRealm
+	if realm == "" {
+		return nil, errors.New("IAKERB token does not name the target realm")
+	}
+	rb, err := cl.ProxyToKDC(context.Background(), realm, t.Message)
+	if err != nil {
+		return nil, fmt.Errorf("could not proxy IAKERB message to a KDC of %s: %w", realm, err)
+	}
+	rt := gssapi.IAKERBToken{
+		Header:  gssapi.IAKERBHeader{TargetRealm: realm},
+		Message: rb,
+	}
+	b, err := rt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	a.exchanges++
+	a.tokens = append(append(a.tokens, token...), b...)
+	return b, nil
+}
+
+// verifyIAKERBFinished verifies the IAKERB-FINISHED message of the authenticator checksum binding the IAKERB tokens
+// exchanged to the security context.
+func verifyIAKERBFinished(auth types.Authenticator, tokens []byte) error {
+	b, ok := gssapi.ChecksumExtension(auth.Cksum.Checksum, gssapi.IAKERBChecksumExtension)
+	if auth.Cksum.CksumType != chksumtype.GSSAPI || !ok {
+		return errors.New("authenticator checksum does not contain the IAKERB finished message")
+	}
+	if auth.SubKey.KeyType == 0 {
+		return errors.New("authenticator does not have the subkey of the IAKERB finished message")
+	}
+	var f gssapi.IAKERBFinished
+	if err := f.Unmarshal(b); err != nil {
+		return err
+	}
+	return f.Verify(auth.SubKey, tokens)
+}
@@ -0,0 +1,305 @@
+// Package seccontext establishes GSS-API security contexts with the Kerberos V5 mechanism (RFC 4121), or SPNEGO
+// (RFC 4178) negotiating it, independently of the protocol carrying the context tokens. It provides the
+// GSS_Init_sec_context and GSS_Accept_sec_context calls for protocols other than HTTP, such as LDAP, the PostgreSQL
+// GSSAPI authentication or custom RPC, without using the messages and types packages directly.
+//
+// The initiator creates the first token with a gokrb5 client and sends it to the acceptor, which replies with a token
+// if mutual authentication is requested:
+//
+//	ini := seccontext.NewInitiator(cl, "postgres/db.example.com")
+//	token, cont, err := ini.InitSecContext(nil)
+//	... send token, receive reply while cont is true ...
+//	token, cont, err = ini.InitSecContext(reply)
+//
+//	acc := seccontext.NewAcceptor(kt)
+//	reply, err := acc.AcceptSecContext(token)
+//
+// Once established, both sides protect messages with the returned gssapi.SecurityContext, which uses the subkeys and
+// sequence numbers agreed during establishment. Protocols that use the keys directly get them with Keys.
+package seccontext
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Initiator establishes a security context with a service as the GSS-API context initiator.
+// An Initiator is used for a single security context.
+type Initiator struct {
+	client   *client.Client
+	spn      string
+	settings *Settings
+	mux      sync.Mutex
+	key      types.EncryptionKey
+	auth     types.Authenticator
+	flags    int
+	keys     Keys
+	mechs    []asn1.ObjectIdentifier
+	resent   bool
+	sc       *gssapi.SecurityContext
+	exchange *iakerbExchange
+	tokens   []byte
+	cookie   []byte
+}
+
+// NewInitiator returns an initiator of a security context with the service principal named by the SPN using the
+// gokrb5 client.
+func NewInitiator(cl *client.Client, spn string, settings ...func(*Settings)) *Initiator {
+	return &Initiator{
+		client:   cl,
+		spn:      spn,
+		settings: NewSettings(settings...),
+	}
+}
+
+// InitSecContext initiates the establishment of the security context, RFC 2743 section 2.2.1. It is first called with
+// a nil token and returns the token to send to the acceptor. If the returned boolean indicates that another call is
+// needed, as it does when mutual authentication is requested, it is called again with the acceptor's reply, after
+// which no further token is returned unless a SPNEGO acceptor requires the initiator's mechListMIC. A SPNEGO acceptor
+// that selects Kerberos without accepting the initiator's first token, replying with no mechanism token, is sent a new
+// AP_REQ in a NegTokenResp when mutual authentication is requested. With IAKERB each of the client's exchanges with
+// the KDCs takes a further round trip with the acceptor before the AP_REQ is returned.
+func (i *Initiator) InitSecContext(token []byte) ([]byte, bool, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if token == nil {
+		if i.key.KeyType != 0 || i.exchange != nil {
+			return nil, false, errors.New("security context has already been initiated")
+		}
+		if i.settings.IAKERB() {
+			return i.initIAKERB()
+		}
+		return i.initSecContext()
+	}
+	if i.exchange != nil {
+		return i.continueIAKERB(token)
+	}
+	if i.key.KeyType == 0 {
+		return nil, false, errors.New("security context has not been initiated")
+	}
+	if i.sc != nil {
+		return nil, false, errors.New("security context has already been established")
+	}
+	return i.completeSecContext(token)
+}
+
+// initSecContext returns the initial token containing an AP_REQ for the SPN with the context flags requested.
+func (i *Initiator) initSecContext() ([]byte, bool, error) {
+	tkt, key, ok := i.settings.ServiceTicket()
+	if !ok {
+		var err error
+		if tkt, key, err = i.client.GetServiceTicket(i.spn); err != nil {
+			return nil, false, fmt.Errorf("could not get service ticket for %s: %w", i.spn, err)
+		}
+	}
+	return i.initAPREQ(tkt, key)
+}
+
+// initAPREQ returns the token containing an AP_REQ with the service ticket and the context flags requested. Without
+// mutual authentication the context is established once the token is created.
+func (i *Initiator) initAPREQ(tkt messages.Ticket, key types.EncryptionKey) ([]byte, bool, error) {
+	gssFlags := i.settings.ContextFlags()
+	if i.client.ShouldDelegate(i.spn) {
+		gssFlags = append(append([]int{}, gssFlags...), gssapi.ContextFlagDeleg)
+	}
+	var apOptions []int
+	var f int
+	for _, fl := range gssFlags {
+		f |= fl
+	}
+	mutual := f&gssapi.ContextFlagMutual != 0
+	if mutual {
+		apOptions = append(apOptions, flags.APOptionMutualRequired)
+	}
+	mt, err := spnego.NewKRB5TokenAPREQChannelBindings(i.client, tkt, key, gssFlags, apOptions, i.settings.ChannelBindings())
+	if err != nil {
+		return nil, false, fmt.Errorf("could not create AP_REQ: %w", err)
+	}
+	// The authenticator's time is needed to verify the AP_REP and its sequence number for the security context.
+	if err := mt.APReq.DecryptAuthenticator(key); err != nil {
+		return nil, false, err
+	}
+	if err := subkeyAPReq(&mt, tkt, key, i.tokens); err != nil {
+		return nil, false, fmt.Errorf("could not create AP_REQ: %w", err)
+	}
+	if i.settings.IAKERB() {
+		// The AP_REQ is framed with the IAKERB mechanism OID, as MIT Kerberos does.
+		mt.OID = gssapi.OIDGSSIAKerb.OID()
+	}
+	// The delegation flag is cleared from the checksum if the credentials could not be delegated.
+	if c := mt.APReq.Authenticator.Cksum.Checksum; len(c) >= 24 && binary.LittleEndian.Uint32(c[20:24])&gssapi.ContextFlagDeleg == 0 {
+		f &^= gssapi.ContextFlagDeleg
+	}
+	b, err := mt.Marshal()
+	if err != nil {
+		return nil, false, err
+	}
+	if i.settings.SPNEGO() {
+		st := spnego.SPNEGOToken{
+			Resp: true,
+			NegTokenResp: spnego.NegTokenResp{
+				NegState:      asn1.Enumerated(spnego.NegStateAcceptIncomplete),
+				ResponseToken: b,
+			},
+		}
+		if !i.resent {
+			i.mechs = []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()}
+			st = spnego.SPNEGOToken{
+				Init: true,
+				NegTokenInit: spnego.NegTokenInit{
+					MechTypes:      i.mechs,
+					MechTokenBytes: b,
+				},
+			}
+		}
+		if b, err = st.Marshal(); err != nil {
+			return nil, false, err
+		}
+	}
+	i.key = key
+	i.auth = mt.APReq.Authenticator
+	i.flags = f
+	if !mutual {
+		i.keys = apReqKeys(key, i.auth)
+		seq := i.keys.InitiatorSeqNumber
+		i.sc = gssapi.NewSecurityContext(i.keys.Key(), false, false, seq)
+		i.sc.ExpectSequence(seq)
+	}
+	return b, mutual, nil
+}
+
+// completeSecContext verifies the acceptor's AP_REP, establishing the security context with the acceptor's subkey and
+// sequence number if it asserts them. With SPNEGO the acceptor's mechListMIC is verified if it sent one, in which case,
+// or if the acceptor requests it, the token returned contains the initiator's mechListMIC. A SPNEGO acceptor's reply
+// selecting Kerberos without a mechanism token is answered with a new AP_REQ, to which it replies with its AP_REP.
+func (i *Initiator) completeSecContext(token []byte) ([]byte, bool, error) {
+	var resp *spnego.NegTokenResp
+	if i.settings.SPNEGO() {
+		var st spnego.SPNEGOToken
+		if err := st.Unmarshal(token); err != nil {
+			return nil, false, err
+		}
+		if !st.Resp {
+			return nil, false, errors.New("acceptor token is not a NegTokenResp")
+		}
+		if st.NegTokenResp.State() == spnego.NegStateReject {
+			return nil, false, errors.New("security context rejected by the acceptor")
+		}
+		resp = &st.NegTokenResp
+		if len(resp.ResponseToken) < 1 && resp.State() != spnego.NegStateAcceptCompleted {
+			return i.resendAPREQ(resp.SupportedMech)
+		}
+		token = resp.ResponseToken
+	}
+	var mt spnego.KRB5Token
+	if err := mt.Unmarshal(token); err != nil {
+		return nil, false, err
+	}
+	if mt.IsKRBError() {
+		return nil, false, mt.KRBError
+	}
+	if !mt.IsAPRep() {
+		return nil, false, errors.New("acceptor token does not contain an AP_REP")
+	}
+	ep, err := mt.APRep.DecryptEncPart(i.key, i.auth)
+	if err != nil {
+		return nil, false, err
+	}
+	keys := apReqKeys(i.key, i.auth)
+	keys.AcceptorSubkey = ep.Subkey
+	keys.AcceptorSeqNumber = uint64(ep.SequenceNumber)
+	sc := gssapi.NewSecurityContext(keys.Key(), false, ep.Subkey.KeyType != 0, keys.InitiatorSeqNumber)
+	sc.ExpectSequence(keys.AcceptorSeqNumber)
+	var b []byte
+	if resp != nil && (len(resp.MechListMIC) > 0 || resp.State() == spnego.NegStateRequestMIC) {
+		if len(resp.MechListMIC) > 0 {
+			if err := spnego.VerifyMechListMIC(sc, i.mechs, resp.MechListMIC); err != nil {
+				return nil, false, err
+			}
+		}
+		mic, err := spnego.MechListMIC(sc, i.mechs)
+		if err != nil {
+			return nil, false, err
+		}
+		st := spnego.SPNEGOToken{
+			Resp: true,
+			NegTokenResp: spnego.NegTokenResp{
+				NegState:    asn1.Enumerated(spnego.NegStateAcceptCompleted),
+				MechListMIC: mic,
+			},
+		}
+		if b, err = st.Marshal(); err != nil {
+			return nil, false, err
+		}
+	}
+	i.keys = keys
+	i.sc = sc
+	return b, false, nil
+}
+
+// resendAPREQ returns the NegTokenResp with a new AP_REQ for the SPNEGO acceptor that selected the Kerberos mechanism
+// without accepting the initiator's first token. It is only sent once.
+func (i *Initiator) resendAPREQ(mech asn1.ObjectIdentifier) ([]byte, bool, error) {
+	if len(mech) > 0 && !spnego.IsKRB5Mech(mech) {
+		return nil, false, fmt.Errorf("acceptor selected mechanism %s which is not KRB5", mech.String())
+	}
+	if i.resent {
+		return nil, false, errors.New("acceptor did not accept the initiator's AP_REQ")
+	}
+	i.resent = true
+	return i.initSecContext()
+}
+
+// Established returns whether the security context has been established.
+func (i *Initiator) Established() bool {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.sc != nil
+}
+
+// Flags returns the context flags requested by the initiator, as a bit mask of the gssapi.ContextFlag constants.
+func (i *Initiator) Flags() int {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.flags
+}
+
+// SecurityContext returns the per-message protection of the established security context, or nil if it has not been
+// established.
+func (i *Initiator) SecurityContext() *gssapi.SecurityContext {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.sc
+}
+
+// Keys returns the keys and initial sequence numbers of the established security context and whether it has been
+// established.
+func (i *Initiator) Keys() (Keys, bool) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	return i.keys, i.sc != nil
+}
+
+// DeleteSecContext destroys the security context.
+func (i *Initiator) DeleteSecContext() error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.abortIAKERB()
+	i.key = types.EncryptionKey{}
+	i.auth = types.Authenticator{}
+	i.keys = Keys{}
+	i.mechs = nil
+	i.resent = false
+	i.sc = nil
+	return nil
+}
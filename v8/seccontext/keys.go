@@ -0,0 +1,80 @@
+package seccontext
+
+import (
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Keys are the keys and initial sequence numbers agreed in the AP exchange establishing a security context, RFC 4121
+// section 2, for application protocols that use them directly rather than through the gssapi.SecurityContext, such as
+// DNS GSS-TSIG or MS-RPC.
+type Keys struct {
+	// SessionKey is the session key of the service ticket.
+	SessionKey types.EncryptionKey
+	// InitiatorSubkey is the subkey of the initiator's authenticator.
+	InitiatorSubkey types.EncryptionKey
+	// AcceptorSubkey is the subkey asserted in the acceptor's AP_REP, which has a zero key type without mutual
+	// authentication.
+	AcceptorSubkey types.EncryptionKey
+	// InitiatorSeqNumber is the sequence number of the initiator's authenticator, from which its tokens are numbered.
+	InitiatorSeqNumber uint64
+	// AcceptorSeqNumber is the sequence number of the acceptor's AP_REP or, without mutual authentication, that of the
+	// initiator's authenticator, from which the acceptor's tokens are numbered.
+	AcceptorSeqNumber uint64
+}
+
+// Key returns the key protecting the messages of the security context, the acceptor's subkey if it asserted one,
+// otherwise the initiator's subkey if there is one, otherwise the session key. It is the session key of the context as
+// SSPI and MS-RPC define it.
+func (k Keys) Key() types.EncryptionKey {
+	if k.AcceptorSubkey.KeyType != 0 {
+		return k.AcceptorSubkey
+	}
+	if k.InitiatorSubkey.KeyType != 0 {
+		return k.InitiatorSubkey
+	}
+	return k.SessionKey
+}
+
+// apReqKeys returns the keys of the security context established by the AP_REQ, before any AP_REP.
+func apReqKeys(key types.EncryptionKey, auth types.Authenticator) Keys {
+	seq := uint64(auth.SeqNumber)
+	return Keys{
+		SessionKey:         key,
+		InitiatorSubkey:    auth.SubKey,
+		InitiatorSeqNumber: seq,
+		AcceptorSeqNumber:  seq,
+	}
+}
+
+// subkeyAPReq replaces the AP_REQ of the token with one whose authenticator asserts a new subkey of the session key's
+// encryption type, as MIT Kerberos and Windows initiators do, so that the messages of the security context are not
+// protected with the ticket's session key. The IAKERB-FINISHED message is added to the authenticator checksum first if
+// the AP_REQ follows IAKERB exchanges.
+func subkeyAPReq(mt *spnego.KRB5Token, tkt messages.Ticket, key types.EncryptionKey, iakerbTokens []byte) error {
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return err
+	}
+	auth := mt.APReq.Authenticator
+	if auth.SubKey, err = types.GenerateEncryptionKey(et); err != nil {
+		return fmt.Errorf("could not generate authenticator subkey: %w", err)
+	}
+	if len(iakerbTokens) > 0 {
+		if err := iakerbFinished(&auth, iakerbTokens); err != nil {
+			return err
+		}
+	}
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		return err
+	}
+	apReq.APOptions = mt.APReq.APOptions
+	apReq.Authenticator = auth
+	mt.APReq = apReq
+	return nil
+}
@@ -0,0 +1,543 @@
+package seccontext
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/test/krbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSPN = "postgres/db.test.gokrb5"
+
+func testSetup(t *testing.T) (*client.Client, *keytab.Keytab) {
+	t.Helper()
+	k, err := krbtest.NewKDC("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	t.Cleanup(func() { k.Close() })
+	if err := k.AddPrincipal(testSPN, "servicepassword"); err != nil {
+		t.Fatalf("error adding service principal: %v", err)
+	}
+	kt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	cl, err := k.NewClient("testuser1")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	return cl, kt
+}
+
+// testProtection checks that messages protected by each side of the security context are accepted by the other.
+func testProtection(t *testing.T, ini, acc *gssapi.SecurityContext) {
+	t.Helper()
+	for _, sealed := range []bool{false, true} {
+		b, err := ini.Wrap([]byte("from initiator"), sealed)
+		if err != nil {
+			t.Fatalf("error wrapping: %v", err)
+		}
+		p, s, err := acc.Unwrap(b)
+		if err != nil {
+			t.Fatalf("error unwrapping initiator token: %v", err)
+		}
+		assert.Equal(t, "from initiator", string(p), "payload not as expected")
+		assert.Equal(t, sealed, s, "sealed not as expected")
+		b, err = acc.Wrap([]byte("from acceptor"), sealed)
+		if err != nil {
+			t.Fatalf("error wrapping: %v", err)
+		}
+		p, _, err = ini.Unwrap(b)
+		if err != nil {
+			t.Fatalf("error unwrapping acceptor token: %v", err)
+		}
+		assert.Equal(t, "from acceptor", string(p), "payload not as expected")
+	}
+	mic, err := ini.GetMIC([]byte("message"))
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	assert.NoError(t, acc.VerifyMIC([]byte("message"), mic), "MIC should be verified")
+}
+
+func TestSecContext_Mutual(t *testing.T) {
+	t.Parallel()
+	cl, kt := testSetup(t)
+	for _, useSPNEGO := range []bool{false, true} {
+		ini := NewInitiator(cl, testSPN, SPNEGO(useSPNEGO))
+		acc := NewAcceptor(kt, service.DecodePAC(false))
+		b, cont, err := ini.InitSecContext(nil)
+		if err != nil {
+			t.Fatalf("error initiating security context: %v", err)
+		}
+		assert.True(t, cont, "mutual authentication should need another call")
+		assert.False(t, ini.Established(), "context should not be established before the reply")
+		_, ok := ini.Keys()
+		assert.False(t, ok, "keys should not be returned before the reply")
+		r, err := acc.AcceptSecContext(b)
+		if err != nil {
+			t.Fatalf("error accepting security context: %v", err)
+		}
+		assert.True(t, acc.Established(), "acceptor context should be established")
+		assert.Equal(t, "testuser1", acc.Credentials().UserName(), "client not as expected")
+		assert.Equal(t, ini.Flags(), acc.Flags(), "flags should be those requested")
+		b, cont, err = ini.InitSecContext(r)
+		if err != nil {
+			t.Fatalf("error completing security context: %v", err)
+		}
+		assert.False(t, cont, "no further call should be needed")
+		assert.Nil(t, b, "no token should be returned")
+		assert.True(t, ini.Established(), "initiator context should be established")
+		testProtection(t, ini.SecurityContext(), acc.SecurityContext())
+		ik, ok := ini.Keys()
+		assert.True(t, ok, "initiator keys should be returned once established")
+		ak, _ := acc.Keys()
+		assert.Equal(t, ik, ak, "keys of both sides should be the same")
+		assert.NotZero(t, ik.InitiatorSubkey.KeyType, "authenticator should assert a subkey")
+		assert.NotZero(t, ik.AcceptorSubkey.KeyType, "AP_REP should assert a subkey")
+		assert.Equal(t, ik.AcceptorSubkey, ik.Key(), "acceptor subkey should protect the messages")
+
+		_, _, err = ini.InitSecContext(r)
+		assert.Error(t, err, "established context should not accept another token")
+		assert.NoError(t, ini.DeleteSecContext(), "error deleting security context")
+		assert.Nil(t, ini.SecurityContext(), "deleted security context should not be returned")
+	}
+}
+
+func TestSecContext_NoMutual(t *testing.T) {
+	t.Parallel()
+	cl, kt := testSetup(t)
+	ini := NewInitiator(cl, testSPN, ContextFlags(gssapi.ContextFlagInteg, gssapi.ContextFlagConf))
+	acc := NewAcceptor(kt, service.DecodePAC(false))
+	b, cont, err := ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	assert.False(t, cont, "no further call should be needed without mutual authentication")
+	assert.True(t, ini.Established(), "initiator context should be established")
+	r, err := acc.AcceptSecContext(b)
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	assert.Nil(t, r, "no token should be returned without mutual authentication")
+	assert.Equal(t, gssapi.ContextFlagInteg|gssapi.ContextFlagConf, acc.Flags(), "flags not as expected")
+	testProtection(t, ini.SecurityContext(), acc.SecurityContext())
+	ik, _ := ini.Keys()
+	ak, ok := acc.Keys()
+	assert.True(t, ok, "acceptor keys should be returned once established")
+	assert.Equal(t, ik, ak, "keys of both sides should be the same")
+	assert.Zero(t, ak.AcceptorSubkey.KeyType, "no acceptor subkey should be asserted")
+	assert.Equal(t, ak.InitiatorSubkey, ak.Key(), "authenticator subkey should protect the messages")
+	assert.Equal(t, ak.InitiatorSeqNumber, ak.AcceptorSeqNumber, "acceptor sequence numbers should start from the authenticator's")
+}
+
+func TestSecContext_Reject(t *testing.T) {
+	t.Parallel()
+	cl, kt := testSetup(t)
+	ini := NewInitiator(cl, testSPN)
+	b, _, err := ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	if _, err := NewAcceptor(kt, service.DecodePAC(false)).AcceptSecContext(b); err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	// The replayed AP_REQ is rejected with a KRB_ERROR token that the initiator returns as the error.
+	acc := NewAcceptor(kt, service.DecodePAC(false))
+	r, err := acc.AcceptSecContext(b)
+	assert.Error(t, err, "replayed AP_REQ should be rejected")
+	assert.False(t, acc.Established(), "rejected context should not be established")
+	if assert.NotNil(t, r, "KRB_ERROR token should be returned") {
+		_, _, err = ini.InitSecContext(r)
+		_, ok := err.(messages.KRBError)
+		assert.True(t, ok, "KRB_ERROR should be returned: %v", err)
+	}
+
+	ini = NewInitiator(cl, testSPN, SPNEGO(true))
+	b, _, err = ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	b[len(b)-1] ^= 0xff
+	r, err = NewAcceptor(kt, service.DecodePAC(false)).AcceptSecContext(b)
+	assert.Error(t, err, "corrupt AP_REQ should be rejected")
+	_, _, err = ini.InitSecContext(r)
+	assert.Error(t, err, "SPNEGO rejection should be an error")
+
+	_, err = NewAcceptor(kt).AcceptSecContext([]byte("not a token"))
+	assert.Error(t, err, "token that is not a GSS-API token should be rejected")
+}
+
+func TestSecContext_MechListMIC(t *testing.T) {
+	t.Parallel()
+	cl, kt := testSetup(t)
+	mechs := []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()}
+
+	// An initiator whose context is established by its first token sends its mechListMIC, which the acceptor verifies
+	// and answers with its own.
+	ini := NewInitiator(cl, testSPN, SPNEGO(true), ContextFlags(gssapi.ContextFlagInteg))
+	b, _, err := ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	var st spnego.SPNEGOToken
+	if err := st.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling SPNEGO token: %v", err)
+	}
+	st.NegTokenInit.MechListMIC, err = spnego.MechListMIC(ini.SecurityContext(), mechs)
+	if err != nil {
+		t.Fatalf("error getting mechListMIC: %v", err)
+	}
+	b, err = st.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling SPNEGO token: %v", err)
+	}
+	acc := NewAcceptor(kt, service.DecodePAC(false))
+	r, err := acc.AcceptSecContext(b)
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	var rt spnego.SPNEGOToken
+	if err := rt.Unmarshal(r); err != nil {
+		t.Fatalf("error unmarshaling SPNEGO token: %v", err)
+	}
+	assert.NoError(t, spnego.VerifyMechListMIC(ini.SecurityContext(), mechs, rt.NegTokenResp.MechListMIC), "acceptor's mechListMIC should verify")
+
+	// A mechListMIC for another mechanism list is rejected.
+	ini = NewInitiator(cl, testSPN, SPNEGO(true), ContextFlags(gssapi.ContextFlagInteg))
+	b, _, err = ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	st = spnego.SPNEGOToken{}
+	if err := st.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling SPNEGO token: %v", err)
+	}
+	st.NegTokenInit.MechListMIC, _ = spnego.MechListMIC(ini.SecurityContext(), []asn1.ObjectIdentifier{gssapi.OIDMSLegacyKRB5.OID()})
+	b, _ = st.Marshal()
+	acc = NewAcceptor(kt, service.DecodePAC(false))
+	_, err = acc.AcceptSecContext(b)
+	assert.Error(t, err, "mechListMIC for another mechanism list should be rejected")
+	assert.False(t, acc.Established(), "context should not be established with an invalid mechListMIC")
+
+	// An acceptor requesting the mechListMIC is sent the initiator's.
+	ini = NewInitiator(cl, testSPN, SPNEGO(true))
+	b, _, err = ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	acc = NewAcceptor(kt, service.DecodePAC(false))
+	r, err = acc.AcceptSecContext(b)
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	rt = spnego.SPNEGOToken{}
+	if err := rt.Unmarshal(r); err != nil {
+		t.Fatalf("error unmarshaling SPNEGO token: %v", err)
+	}
+	rt.NegTokenResp.NegState = asn1.Enumerated(spnego.NegStateRequestMIC)
+	r, _ = rt.Marshal()
+	b, cont, err := ini.InitSecContext(r)
+	if err != nil {
+		t.Fatalf("error completing security context: %v", err)
+	}
+	assert.False(t, cont, "no further call should be needed")
+	rt = spnego.SPNEGOToken{}
+	if err := rt.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling SPNEGO token: %v", err)
+	}
+	assert.NoError(t, spnego.VerifyMechListMIC(acc.SecurityContext(), mechs, rt.NegTokenResp.MechListMIC), "initiator's mechListMIC should verify")
+}
+
+// testNegTokenInit returns the SPNEGO NegTokenInit offering the mechanisms with the optimistic token.
+func testNegTokenInit(t *testing.T, mechs []asn1.ObjectIdentifier, token []byte) []byte {
+	t.Helper()
+	st := spnego.SPNEGOToken{
+		Init: true,
+		NegTokenInit: spnego.NegTokenInit{
+			MechTypes:      mechs,
+			MechTokenBytes: token,
+		},
+	}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling SPNEGO token: %v", err)
+	}
+	return b
+}
+
+// testNegTokenResp returns the NegTokenResp of the SPNEGO token.
+func testNegTokenResp(t *testing.T, b []byte) spnego.NegTokenResp {
+	t.Helper()
+	var st spnego.SPNEGOToken
+	if err := st.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling SPNEGO token: %v", err)
+	}
+	if !st.Resp {
+		t.Fatal("SPNEGO token is not a NegTokenResp")
+	}
+	return st.NegTokenResp
+}
+
+func TestSecContext_MultiLeg(t *testing.T) {
+	t.Parallel()
+	cl, kt := testSetup(t)
+
+	// An initiator offering Kerberos without an optimistic token is asked for one and continues with its AP_REQ.
+	acc := NewAcceptor(kt, service.DecodePAC(false))
+	r, err := acc.AcceptSecContext(testNegTokenInit(t, []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()}, nil))
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	rt := testNegTokenResp(t, r)
+	assert.Equal(t, spnego.NegStateAcceptIncomplete, rt.State(), "negState not as expected")
+	assert.True(t, rt.SupportedMech.Equal(gssapi.OIDKRB5.OID()), "supportedMech not as expected")
+	assert.Empty(t, rt.ResponseToken, "no response token should be returned")
+	assert.False(t, acc.Established(), "context should not be established without a mechanism token")
+
+	ini := NewInitiator(cl, testSPN, SPNEGO(true))
+	if _, _, err := ini.InitSecContext(nil); err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	b, cont, err := ini.InitSecContext(r)
+	if err != nil {
+		t.Fatalf("error continuing security context: %v", err)
+	}
+	assert.True(t, cont, "the acceptor's AP_REP should be needed")
+	assert.NotEmpty(t, testNegTokenResp(t, b).ResponseToken, "initiator's NegTokenResp should contain its AP_REQ")
+	r, err = acc.AcceptSecContext(b)
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	assert.True(t, acc.Established(), "context should be established")
+	if b, _, err = ini.InitSecContext(r); err != nil {
+		t.Fatalf("error completing security context: %v", err)
+	}
+	assert.Nil(t, b, "no further token should be returned")
+	testProtection(t, ini.SecurityContext(), acc.SecurityContext())
+
+	// An initiator preferring another mechanism must exchange the mechListMICs once Kerberos is selected.
+	mechs := []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 311, 2, 2, 30}, gssapi.OIDKRB5.OID()}
+	acc = NewAcceptor(kt, service.DecodePAC(false))
+	r, err = acc.AcceptSecContext(testNegTokenInit(t, mechs, []byte{0x01}))
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	rt = testNegTokenResp(t, r)
+	assert.Equal(t, spnego.NegStateRequestMIC, rt.State(), "negState not as expected")
+	assert.True(t, rt.SupportedMech.Equal(gssapi.OIDKRB5.OID()), "supportedMech not as expected")
+
+	ini = NewInitiator(cl, testSPN, SPNEGO(true))
+	if _, _, err := ini.InitSecContext(nil); err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	// The mechanisms the initiator offered are those its mechListMIC is computed over.
+	ini.mechs = mechs
+	if b, _, err = ini.InitSecContext(r); err != nil {
+		t.Fatalf("error continuing security context: %v", err)
+	}
+	r, err = acc.AcceptSecContext(b)
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	rt = testNegTokenResp(t, r)
+	assert.Equal(t, spnego.NegStateAcceptIncomplete, rt.State(), "negState not as expected")
+	assert.NotEmpty(t, rt.MechListMIC, "acceptor's mechListMIC should be sent")
+	assert.False(t, acc.Established(), "context should not be established before the initiator's mechListMIC")
+	assert.Nil(t, acc.SecurityContext(), "security context should not be returned before it is established")
+	b, cont, err = ini.InitSecContext(r)
+	if err != nil {
+		t.Fatalf("error completing security context: %v", err)
+	}
+	assert.False(t, cont, "no further call should be needed")
+	r, err = acc.AcceptSecContext(b)
+	if err != nil {
+		t.Fatalf("error accepting initiator's mechListMIC: %v", err)
+	}
+	assert.Nil(t, r, "no token should be returned once the context is established")
+	assert.True(t, acc.Established(), "context should be established")
+	testProtection(t, ini.SecurityContext(), acc.SecurityContext())
+
+	// The context is not established if the initiator does not send the mechListMIC required.
+	acc = NewAcceptor(kt, service.DecodePAC(false))
+	r, _ = acc.AcceptSecContext(testNegTokenInit(t, mechs, nil))
+	ini = NewInitiator(cl, testSPN, SPNEGO(true))
+	if _, _, err := ini.InitSecContext(nil); err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	b, _, _ = ini.InitSecContext(r)
+	if _, err := acc.AcceptSecContext(b); err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	st := spnego.SPNEGOToken{Resp: true, NegTokenResp: spnego.NegTokenResp{NegState: asn1.Enumerated(spnego.NegStateAcceptCompleted)}}
+	b, _ = st.Marshal()
+	_, err = acc.AcceptSecContext(b)
+	assert.Error(t, err, "NegTokenResp without the mechListMIC required should be rejected")
+	assert.False(t, acc.Established(), "context should not be established without the mechListMIC")
+}
+
+func TestSecContext_ServiceTicket(t *testing.T) {
+	t.Parallel()
+	cl, kt := testSetup(t)
+	tkt, key, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	// The SPN is not known to the KDC so the context can only be established with the ticket given.
+	ini := NewInitiator(cl, "postgres/unknown.test.gokrb5", ServiceTicket(tkt, key))
+	acc := NewAcceptor(kt, service.DecodePAC(false))
+	b, _, err := ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context with the service ticket: %v", err)
+	}
+	r, err := acc.AcceptSecContext(b)
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	if _, _, err := ini.InitSecContext(r); err != nil {
+		t.Fatalf("error completing security context: %v", err)
+	}
+	testProtection(t, ini.SecurityContext(), acc.SecurityContext())
+}
+
+// testEstablish exchanges the tokens of the initiator and acceptor until the security context is established,
+// returning the number of tokens the initiator sent.
+func testEstablish(t *testing.T, ini *Initiator, acc *Acceptor) int {
+	t.Helper()
+	b, cont, err := ini.InitSecContext(nil)
+	n := 1
+	for {
+		if err != nil {
+			t.Fatalf("error initiating security context: %v", err)
+		}
+		r, err := acc.AcceptSecContext(b)
+		if err != nil {
+			t.Fatalf("error accepting security context: %v", err)
+		}
+		if !cont {
+			return n
+		}
+		if b, cont, err = ini.InitSecContext(r); b == nil || err != nil {
+			assert.NoError(t, err, "error completing security context")
+			return n
+		}
+		n++
+	}
+}
+
+func TestSecContext_IAKERB(t *testing.T) {
+	t.Parallel()
+	k, err := krbtest.NewKDC("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	defer k.Close()
+	if err := k.AddPrincipal(testSPN, "servicepassword"); err != nil {
+		t.Fatalf("error adding service principal: %v", err)
+	}
+	kt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	proxy, err := k.NewClient("proxy")
+	if err != nil {
+		t.Fatalf("error creating proxy client: %v", err)
+	}
+	if err := k.AddPrincipal("isolated", "isolatedpassword"); err != nil {
+		t.Fatalf("error adding client principal: %v", err)
+	}
+	// The client has no KDCs configured so can only reach them through the acceptor.
+	c, _ := config.NewFromString("[libdefaults]\n  default_realm = TEST.GOKRB5\n  dns_lookup_kdc = false\n")
+	cl := client.NewWithPassword("isolated", "TEST.GOKRB5", "isolatedpassword", c)
+	_, _, err = cl.GetServiceTicket(testSPN)
+	assert.Error(t, err, "client should not reach the KDC directly")
+
+	ini := NewInitiator(cl, testSPN, IAKERB(true))
+	acc := NewAcceptor(kt, service.DecodePAC(false), service.IAKERBProxy(proxy))
+	n := testEstablish(t, ini, acc)
+	assert.True(t, n > 2, "AS and TGS exchanges should have been tunnelled before the AP_REQ, %d tokens sent", n)
+	assert.True(t, ini.Established(), "initiator context should be established")
+	assert.True(t, acc.Established(), "acceptor context should be established")
+	assert.Equal(t, "isolated", acc.Credentials().UserName(), "client not as expected")
+	testProtection(t, ini.SecurityContext(), acc.SecurityContext())
+
+	// With the service ticket cached the AP_REQ is sent straight away.
+	ini = NewInitiator(cl, testSPN, IAKERB(true))
+	acc = NewAcceptor(kt, service.DecodePAC(false), service.IAKERBProxy(proxy))
+	b, _, err := ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	assert.False(t, gssapi.IsIAKERBToken(b), "AP_REQ should be sent without KDC exchanges")
+	var mt spnego.KRB5Token
+	if assert.NoError(t, mt.Unmarshal(b), "error unmarshalling AP_REQ token") {
+		assert.Equal(t, gssapi.OIDGSSIAKerb.OID(), mt.OID, "AP_REQ should be framed with the IAKERB OID")
+	}
+	r, err := acc.AcceptSecContext(b)
+	if err != nil {
+		t.Fatalf("error accepting security context: %v", err)
+	}
+	if _, _, err := ini.InitSecContext(r); err != nil {
+		t.Fatalf("error completing security context: %v", err)
+	}
+	testProtection(t, ini.SecurityContext(), acc.SecurityContext())
+
+	// An AP_REQ not bound to the IAKERB exchanges preceding it is rejected.
+	other := client.NewWithPassword("isolated", "TEST.GOKRB5", "isolatedpassword", c)
+	tok, _, err := NewInitiator(other, testSPN, IAKERB(true)).InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	acc = NewAcceptor(kt, service.DecodePAC(false), service.IAKERBProxy(proxy))
+	if _, err := acc.AcceptSecContext(tok); err != nil {
+		t.Fatalf("error proxying IAKERB token: %v", err)
+	}
+	b, _, err = NewInitiator(cl, testSPN, IAKERB(true)).InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	_, err = acc.AcceptSecContext(b)
+	assert.Error(t, err, "AP_REQ without the IAKERB finished message should be rejected")
+	assert.False(t, acc.Established(), "acceptor context should not be established")
+
+	// Services must be configured to proxy IAKERB exchanges.
+	_, err = NewAcceptor(kt, service.DecodePAC(false)).AcceptSecContext(tok)
+	assert.Error(t, err, "IAKERB token should be rejected without a proxy")
+
+	ini = NewInitiator(cl, testSPN, IAKERB(true), SPNEGO(true))
+	_, _, err = ini.InitSecContext(nil)
+	assert.Error(t, err, "IAKERB should not be negotiated with SPNEGO")
+}
+
+func TestSecContext_IAKERBDelete(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString("[libdefaults]\n  default_realm = TEST.GOKRB5\n  dns_lookup_kdc = false\n")
+	cl := client.NewWithPassword("isolated", "TEST.GOKRB5", "isolatedpassword", c)
+	ini := NewInitiator(cl, testSPN, IAKERB(true))
+	b, cont, err := ini.InitSecContext(nil)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	assert.True(t, cont, "KDC reply should be needed")
+	var tok gssapi.IAKERBToken
+	if assert.NoError(t, tok.Unmarshal(b), "first token should be an IAKERB token") {
+		assert.Equal(t, "TEST.GOKRB5", tok.Header.TargetRealm, "target realm not as expected")
+	}
+	_, _, err = ini.InitSecContext(nil)
+	assert.Error(t, err, "security context should already be initiated")
+	assert.NoError(t, ini.DeleteSecContext(), "error deleting security context")
+	// Once deleted the exchanges are abandoned and another context can be initiated.
+	_, cont, err = ini.InitSecContext(nil)
+	assert.NoError(t, err, "error initiating security context again")
+	assert.True(t, cont, "KDC reply should be needed")
+	ini.DeleteSecContext()
+}
@@ -0,0 +1,113 @@
+package seccontext
+
+import (
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Settings defines the configuration of an Initiator.
+type Settings struct {
+	flags           []int
+	spnego          bool
+	channelBindings *gssapi.ChannelBindings
+	ticket          *messages.Ticket
+	sessionKey      types.EncryptionKey
+	iakerb          bool
+}
+
+// NewSettings creates a new Settings. By default raw KRB5 tokens are used and mutual authentication, replay and
+// sequence detection, integrity and confidentiality are requested.
+func NewSettings(settings ...func(*Settings)) *Settings {
+	s := &Settings{
+		flags: []int{gssapi.ContextFlagMutual, gssapi.ContextFlagReplay, gssapi.ContextFlagSequence,
+			gssapi.ContextFlagInteg, gssapi.ContextFlagConf},
+	}
+	for _, set := range settings {
+		set(s)
+	}
+	return s
+}
+
+// ContextFlags used to configure the GSS-API context flags requested by the initiator, from the gssapi.ContextFlag
+// constants. Mutual authentication is only performed if gssapi.ContextFlagMutual is requested.
+//
+// s := NewSettings(ContextFlags(gssapi.ContextFlagInteg, gssapi.ContextFlagConf))
+func ContextFlags(flags ...int) func(*Settings) {
+	return func(s *Settings) {
+		s.flags = flags
+	}
+}
+
+// ContextFlags returns the GSS-API context flags requested by the initiator.
+func (s *Settings) ContextFlags() []int {
+	return s.flags
+}
+
+// SPNEGO used to configure the initiator's tokens to be SPNEGO tokens negotiating the Kerberos V5 mechanism rather
+// than raw KRB5 tokens.
+//
+// s := NewSettings(SPNEGO(true))
+func SPNEGO(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.spnego = b
+	}
+}
+
+// SPNEGO returns whether the initiator's tokens are SPNEGO tokens.
+func (s *Settings) SPNEGO() bool {
+	return s.spnego
+}
+
+// ChannelBindings used to configure the channel bindings the initiator binds the security context to, such as the
+// gssapi.TLSServerEndPoint bindings of the TLS connection carrying the context tokens.
+//
+// s := NewSettings(ChannelBindings(cb))
+func ChannelBindings(cb *gssapi.ChannelBindings) func(*Settings) {
+	return func(s *Settings) {
+		s.channelBindings = cb
+	}
+}
+
+// ChannelBindings returns the channel bindings the initiator binds the security context to, or nil if none are
+// configured.
+func (s *Settings) ChannelBindings() *gssapi.ChannelBindings {
+	return s.channelBindings
+}
+
+// ServiceTicket used to configure the initiator to use the service ticket and its session key rather than getting one
+// from the client, such as a ticket obtained with an AS exchange for a service that does not accept tickets issued
+// with the client's TGT.
+//
+// s := NewSettings(ServiceTicket(tkt, key))
+func ServiceTicket(tkt messages.Ticket, key types.EncryptionKey) func(*Settings) {
+	return func(s *Settings) {
+		s.ticket = &tkt
+		s.sessionKey = key
+	}
+}
+
+// ServiceTicket returns the service ticket and session key the initiator uses, and whether one is configured.
+func (s *Settings) ServiceTicket() (messages.Ticket, types.EncryptionKey, bool) {
+	if s.ticket == nil {
+		return messages.Ticket{}, types.EncryptionKey{}, false
+	}
+	return *s.ticket, s.sessionKey, true
+}
+
+// IAKERB used to configure the initiator to use the IAKERB mechanism, for clients without a route to the KDCs. The
+// client's exchanges with the KDCs for the service ticket, including any AS exchange to log in, are tunnelled through
+// the context tokens to the acceptor, which proxies them to the KDCs, before the AP_REQ is sent. IAKERB tokens are not
+// negotiated with SPNEGO.
+//
+// s := NewSettings(IAKERB(true))
+func IAKERB(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.iakerb = b
+	}
+}
+
+// IAKERB returns whether the initiator uses the IAKERB mechanism.
+func (s *Settings) IAKERB() bool {
+	return s.iakerb
+}
@@ -1,17 +1,91 @@
 package service
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
 	"time"
 
+	"github.com/jcmturner/gokrb5/v8/audit"
 	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/logging"
 	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/pac"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/jcmturner/gokrb5/v8/warning"
+	"github.com/jcmturner/rpc/v2/mstypes"
 )
 
+// SecurityContext returns the per-message protection of the security context established by the AP_REQ, for the
+// service as the context acceptor, once the AP_REQ has been verified. The key is the subkey of the authenticator if it
+// has one, otherwise the ticket's session key. As the service does not reply with an AP_REP asserting a subkey or
+// sequence number, the sequence numbers of the tokens it sends start from that of the authenticator. The sequence
+// numbers of the tokens received from the client are checked from it too.
+func SecurityContext(APReq *messages.APReq) *gssapi.SecurityContext {
+	key := APReq.Ticket.DecryptedEncPart.Key
+	if APReq.Authenticator.SubKey.KeyType != 0 {
+		key = APReq.Authenticator.SubKey
+	}
+	seq := uint64(APReq.Authenticator.SeqNumber)
+	sc := gssapi.NewSecurityContext(key, true, false, seq)
+	sc.ExpectSequence(seq)
+	return sc
+}
+
 // VerifyAPREQ verifies an AP_REQ sent to the service. Returns a boolean for if the AP_REQ is valid and the client's principal name and realm.
 func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credentials, error) {
+	start := time.Now()
+	ok, creds, err := verifyAPREQ(APReq, s)
+	err = krberror.WithCorrelationID(err, s.CorrelationID())
+	s.audit(APReq, ok, err)
+	s.logAPReq(APReq, ok, err, time.Since(start))
+	return ok, creds, err
+}
+
+// logAPReq logs the outcome of verifying the AP_REQ at logging.LevelDebug.
+func (s *Settings) logAPReq(APReq *messages.APReq, ok bool, err error, d time.Duration) {
+	l := s.StructuredLogger()
+	if l == nil || !l.Enabled(logging.LevelDebug) {
+		return
+	}
+	fields := []logging.Field{
+		logging.F(logging.KeySPN, APReq.Ticket.SName.PrincipalNameString()),
+		logging.F(logging.KeyRealm, APReq.Ticket.Realm),
+	}
+	if len(APReq.Authenticator.CName.NameString) > 0 {
+		fields = append(fields, logging.F(logging.KeyPrincipal, APReq.Authenticator.CName.PrincipalNameString()+"@"+APReq.Authenticator.CRealm))
+	}
+	fields = append(fields, logging.F(logging.KeyDuration, d))
+	if id := s.correlationIDOf(err); id != "" {
+		fields = append(fields, logging.F(logging.KeyCorrelationID, id))
+	}
+	if !ok {
+		if err != nil {
+			fields = append(fields, logging.F(logging.KeyError, err))
+		}
+		l.Log(logging.LevelDebug, "AP_REQ rejected", fields...)
+		return
+	}
+	l.Log(logging.LevelDebug, "AP_REQ verified", fields...)
+}
+
+func verifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credentials, error) {
 	var creds *credentials.Credentials
-	ok, err := APReq.Verify(s.Keytab, s.MaxClockSkew(), s.ClientAddress(), s.KeytabPrincipal())
+	var ok bool
+	var err error
+	if s.VerifyHostAddr() {
+		ok, err = APReq.VerifyWithClock(s.KeyProvider(), s.MaxClockSkew(), s.ClientAddress(), s.KeytabPrincipal(), s.Clock())
+	} else {
+		ok, err = APReq.VerifyAnyAddress(s.KeyProvider(), s.MaxClockSkew(), s.KeytabPrincipal(), s.Clock())
+	}
 	if err != nil || !ok {
 		return false, creds, err
 	}
@@ -21,41 +95,320 @@ func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credent
 			messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_BADADDR, "ticket does not contain HostAddress values required")
 	}
 
+	if err := verifyChannelBindings(APReq, s); err != nil {
+		return false, creds, err
+	}
+
 	// Check for replay
-	rc := GetReplayCache(s.MaxClockSkew())
+	rc := s.ReplayCacheBackend()
 	if rc.IsReplay(APReq.Ticket.SName, APReq.Authenticator) {
 		return false, creds,
 			messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_REPEAT, "replay detected")
 	}
 
+	s.warnAPReq(APReq)
+
 	c := credentials.NewFromPrincipalName(APReq.Authenticator.CName, APReq.Authenticator.CRealm)
 	creds = c
-	creds.SetAuthTime(time.Now().UTC())
+	creds.SetAuthTime(s.Clock().Now().UTC())
 	creds.SetAuthenticated(true)
 	creds.SetValidUntil(APReq.Ticket.DecryptedEncPart.EndTime)
+	d, ok, err := delegatedCredentials(APReq)
+	if err != nil {
+		return false, creds, err
+	}
+	if ok {
+		creds.SetDelegatedCredentials(d)
+	}
 
 	//PAC decoding
+	var tktPAC *pac.PACType
 	if !s.disablePACDecoding {
-		isPAC, pac, err := APReq.Ticket.GetPACType(s.Keytab, s.KeytabPrincipal(), s.Logger())
+		isPAC, pac, err := APReq.Ticket.GetPACType(s.KeyProvider(), s.KeytabPrincipal(), s.Logger())
 		if isPAC && err != nil {
 			return false, creds, err
 		}
+		if !isPAC {
+			s.warn(warning.NoPAC, APReq, "ticket for %s does not contain a PAC", APReq.Ticket.SName.PrincipalNameString())
+		}
 		if isPAC {
+			tktPAC = &pac
+			if err := verifyPAC(APReq.Ticket, &pac, s); err != nil {
+				return false, creds, err
+			}
 			// There is a valid PAC. Adding attributes to creds
-			creds.SetADCredentials(credentials.ADCredentials{
-				GroupMembershipSIDs: pac.KerbValidationInfo.GetGroupMembershipSIDs(),
-				LogOnTime:           pac.KerbValidationInfo.LogOnTime.Time(),
-				LogOffTime:          pac.KerbValidationInfo.LogOffTime.Time(),
-				PasswordLastSet:     pac.KerbValidationInfo.PasswordLastSet.Time(),
-				EffectiveName:       pac.KerbValidationInfo.EffectiveName.Value,
-				FullName:            pac.KerbValidationInfo.FullName.Value,
-				UserID:              int(pac.KerbValidationInfo.UserID),
-				PrimaryGroupID:      int(pac.KerbValidationInfo.PrimaryGroupID),
-				LogonServer:         pac.KerbValidationInfo.LogonServer.Value,
-				LogonDomainName:     pac.KerbValidationInfo.LogonDomainName.Value,
-				LogonDomainID:       pac.KerbValidationInfo.LogonDomainID.String(),
-			})
+			ad := adCredentials(&pac, s)
+			creds.SetADCredentials(ad)
+		}
+	}
+
+	if p := s.TicketPolicy(); p != nil {
+		if err := p.EvaluateAt(APReq.Ticket, tktPAC, s.Clock().Now().UTC()).Error(); err != nil {
+			return false, creds,
+				messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KDC_ERR_POLICY, err.Error())
 		}
 	}
 	return true, creds, nil
 }
+
+// verifyPAC applies the checks of the PAC the service is configured with beyond its server checksum, which has been
+// verified: that it is the PAC of the ticket's client and that it was signed by the KDC.
+func verifyPAC(tkt messages.Ticket, p *pac.PACType, s *Settings) error {
+	if s.VerifyPACClient() {
+		if err := p.VerifyClientInfo(tkt.DecryptedEncPart.CName, tkt.DecryptedEncPart.AuthTime); err != nil {
+			return messages.NewKRBError(tkt.SName, tkt.Realm, errorcode.KRB_AP_ERR_MODIFIED, err.Error())
+		}
+	}
+	kp := s.PACKDCKeyProvider()
+	if kp == nil {
+		return nil
+	}
+	et, err := p.KDCChecksum.EType()
+	if err != nil {
+		return messages.NewKRBError(tkt.SName, tkt.Realm, errorcode.KRB_AP_ERR_INAPP_CKSUM, err.Error())
+	}
+	krbtgt := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+tkt.Realm)
+	key, _, err := kp.GetEncryptionKey(krbtgt, tkt.Realm, 0, et)
+	if err != nil {
+		return messages.NewKRBError(tkt.SName, tkt.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("could not get KDC key to verify PAC: %v", err))
+	}
+	if err := p.VerifyKDCChecksum(key); err != nil {
+		return messages.NewKRBError(tkt.SName, tkt.Realm, errorcode.KRB_AP_ERR_MODIFIED, err.Error())
+	}
+	return nil
+}
+
+// adCredentials returns the details of the user from the PAC, with the names of the SIDs if the service is configured
+// with a SID resolver.
+func adCredentials(p *pac.PACType, s *Settings) credentials.ADCredentials {
+	ad := credentials.ADCredentials{
+		GroupMembershipSIDs: p.KerbValidationInfo.GetGroupMembershipSIDs(),
+		LogOnTime:           p.KerbValidationInfo.LogOnTime.Time(),
+		LogOffTime:          p.KerbValidationInfo.LogOffTime.Time(),
+		PasswordLastSet:     p.KerbValidationInfo.PasswordLastSet.Time(),
+		EffectiveName:       p.KerbValidationInfo.EffectiveName.Value,
+		FullName:            p.KerbValidationInfo.FullName.Value,
+		UserID:              int(p.KerbValidationInfo.UserID),
+		PrimaryGroupID:      int(p.KerbValidationInfo.PrimaryGroupID),
+		LogonServer:         p.KerbValidationInfo.LogonServer.Value,
+		LogonDomainName:     p.KerbValidationInfo.LogonDomainName.Value,
+		LogonDomainID:       p.KerbValidationInfo.LogonDomainID.String(),
+	}
+	if p.S4UDelegationInfo != nil {
+		ad.S4U2ProxyTarget = p.S4UDelegationInfo.S4U2proxyTarget.Value
+		ad.S4UTransitedServices = p.S4UDelegationInfo.GetTransitedServices()
+	}
+	if p.UPNDNSInfo != nil {
+		ad.UPN = p.UPNDNSInfo.UPN
+		ad.DNSDomainName = p.UPNDNSInfo.DNSDomain
+		if p.UPNDNSInfo.Extended() {
+			ad.SAMAccountName = p.UPNDNSInfo.SamName
+			ad.UserSID = p.UPNDNSInfo.SID.String()
+		}
+	}
+	if p.ClientClaimsInfo != nil {
+		ad.UserClaims = adClaims(p.ClientClaimsInfo.ClaimsSet)
+	}
+	if p.DeviceClaimsInfo != nil {
+		ad.DeviceClaims = adClaims(p.DeviceClaimsInfo.ClaimsSet)
+	}
+	if r := s.SIDResolver(); r != nil {
+		if err := ad.ResolveSIDs(r); err != nil {
+			s.logf(logging.LevelWarn, fmt.Sprintf("could not resolve the SIDs of %s: %v", ad.EffectiveName, err),
+				logging.F(logging.KeyPrincipal, ad.EffectiveName), logging.F(logging.KeyError, err))
+		}
+	}
+	return ad
+}
+
+// adClaims returns the claims of the claims set's arrays.
+func adClaims(cs mstypes.ClaimsSet) []credentials.ADClaim {
+	var claims []credentials.ADClaim
+	for _, a := range cs.ClaimsArrays {
+		for _, e := range a.ClaimEntries {
+			c := credentials.ADClaim{ID: e.ID}
+			switch e.Type {
+			case mstypes.ClaimTypeIDInt64:
+				c.Int64Values = e.TypeInt64.Value
+			case mstypes.ClaimTypeIDUInt64:
+				c.Uint64Values = e.TypeUInt64.Value
+			case mstypes.ClaimTypeIDString:
+				for _, v := range e.TypeString.Value {
+					c.StringValues = append(c.StringValues, v.Value)
+				}
+			case mstypes.ClaimsTypeIDBoolean:
+				c.BoolValues = e.TypeBool.Value
+			}
+			claims = append(claims, c)
+		}
+	}
+	return claims
+}
+
+// verifyChannelBindings validates the channel bindings hash in the authenticator checksum, RFC 4121 section 4.1.1.2,
+// against the channel bindings configured for the service. A zero hash indicates the client used no channel bindings.
+func verifyChannelBindings(APReq *messages.APReq, s *Settings) error {
+	cb := s.ChannelBindings()
+	if cb == nil {
+		return nil
+	}
+	var bnd []byte
+	if cksum := APReq.Authenticator.Cksum; cksum.CksumType == chksumtype.GSSAPI && len(cksum.Checksum) >= 24 {
+		bnd = cksum.Checksum[4:20]
+	}
+	if bnd == nil || bytes.Equal(bnd, make([]byte, len(bnd))) {
+		if s.RequireChannelBindings() {
+			return messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_INAPP_CKSUM, "authenticator does not contain the channel bindings required")
+		}
+		return nil
+	}
+	if !bytes.Equal(bnd, cb.Hash()) {
+		return messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_MODIFIED, "channel bindings do not match")
+	}
+	return nil
+}
+
+// delegatedCredentials returns the credentials delegated in the authenticator checksum, RFC 4121 section 4.1.1, if
+// its delegation flag is set. The KRB_CRED is decrypted with the ticket's session key or the subkey of the
+// authenticator, to check it holds tickets issued to the client, and returned with the key that decrypted it.
+func delegatedCredentials(APReq *messages.APReq) (credentials.DelegatedCredentials, bool, error) {
+	var d credentials.DelegatedCredentials
+	cksum := APReq.Authenticator.Cksum
+	if cksum.CksumType != chksumtype.GSSAPI || len(cksum.Checksum) < 24 ||
+		binary.LittleEndian.Uint32(cksum.Checksum[20:24])&gssapi.ContextFlagDeleg == 0 {
+		return d, false, nil
+	}
+	b := cksum.Checksum[24:]
+	if len(b) < 4 || binary.LittleEndian.Uint16(b[0:2]) != 1 || len(b) < 4+int(binary.LittleEndian.Uint16(b[2:4])) {
+		return d, false, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_INAPP_CKSUM, "authenticator checksum does not contain the delegated credentials")
+	}
+	d.KRBCred = b[4 : 4+int(binary.LittleEndian.Uint16(b[2:4]))]
+	keys := []types.EncryptionKey{APReq.Ticket.DecryptedEncPart.Key}
+	if APReq.Authenticator.SubKey.KeyType != 0 {
+		keys = append(keys, APReq.Authenticator.SubKey)
+	}
+	var k messages.KRBCred
+	if err := k.Unmarshal(d.KRBCred); err != nil {
+		return d, false, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_MSG_TYPE, fmt.Sprintf("delegated credentials are not a valid KRB_CRED: %v", err))
+	}
+	var err error
+	for _, key := range keys {
+		if err = k.DecryptEncPart(key); err == nil {
+			d.Key = key
+			break
+		}
+	}
+	if err != nil {
+		return d, false, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_BAD_INTEGRITY, fmt.Sprintf("could not decrypt the delegated credentials: %v", err))
+	}
+	if len(k.Tickets) < 1 || len(k.Tickets) != len(k.DecryptedEncPart.TicketInfo) {
+		return d, false, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_MSG_TYPE, "delegated credentials do not hold credential information for each of their tickets")
+	}
+	for _, info := range k.DecryptedEncPart.TicketInfo {
+		if info.PRealm != APReq.Authenticator.CRealm || !info.PName.Equal(APReq.Authenticator.CName) {
+			return d, false, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_BADMATCH, "delegated credentials were not issued to the client")
+		}
+	}
+	return d, true, nil
+}
+
+// warn calls the warning hook if one is configured with a warning about the client presenting the AP_REQ.
+func (s *Settings) warn(code warning.Code, APReq *messages.APReq, format string, v ...interface{}) {
+	h := s.WarningHook()
+	if h == nil {
+		return
+	}
+	h(warning.Warning{
+		Code:          code,
+		Principal:     APReq.Authenticator.CName.PrincipalNameString(),
+		Realm:         APReq.Authenticator.CRealm,
+		Message:       fmt.Sprintf(format, v...),
+		CorrelationID: s.CorrelationID(),
+	})
+}
+
+// warnAPReq emits warnings for the weak or deprecated usage in a verified AP_REQ.
+func (s *Settings) warnAPReq(APReq *messages.APReq) {
+	if s.WarningHook() == nil {
+		return
+	}
+	tkt := APReq.Ticket
+	if etypeID.Deprecated(tkt.EncPart.EType) {
+		s.warn(warning.WeakEType, APReq, "ticket uses deprecated encryption type %s", etypeID.Name(tkt.EncPart.EType))
+	}
+	if etypeID.Deprecated(tkt.DecryptedEncPart.Key.KeyType) {
+		s.warn(warning.WeakEType, APReq, "session key uses deprecated encryption type %s", etypeID.Name(tkt.DecryptedEncPart.Key.KeyType))
+	}
+
+	// The clock skew is near the limit once it exceeds three quarters of the maximum permitted.
+	ct := APReq.Authenticator.CTime.Add(time.Duration(APReq.Authenticator.Cusec) * time.Microsecond)
+	skew := s.Clock().Now().UTC().Sub(ct)
+	if skew < 0 {
+		skew = -skew
+	}
+	if d := s.MaxClockSkew(); skew > d/4*3 {
+		s.warn(warning.ClockSkew, APReq, "clock skew with client of %v is near the maximum of %v", skew.Round(time.Second), d)
+	}
+
+	sname := tkt.SName
+	if s.KeytabPrincipal() != nil {
+		sname = *s.KeytabPrincipal()
+	}
+	// Where there is no key with the ticket's kvno it was decrypted with a candidate key of another kvno.
+	if _, err := s.keyKVNO(sname, tkt.Realm, tkt.EncPart.KVNO, tkt.EncPart.EType); err == nil {
+		return
+	}
+	if kvno, err := s.keyKVNO(sname, tkt.Realm, 0, tkt.EncPart.EType); err == nil && kvno < tkt.EncPart.KVNO {
+		s.warn(warning.KeytabKVNO, APReq, "newest key for %s has kvno %d which is older than the ticket's kvno %d",
+			sname.PrincipalNameString(), kvno, tkt.EncPart.KVNO)
+	}
+}
+
+// keyKVNO returns the kvno of the service's key with the kvno and etype, or of its latest key if the kvno is zero.
+func (s *Settings) keyKVNO(sname types.PrincipalName, realm string, kvno int, etype int32) (int, error) {
+	if hp := s.KeyHandleProvider(); hp != nil {
+		h, err := hp.GetKeyHandle(sname, realm, kvno, etype)
+		if err != nil {
+			return 0, err
+		}
+		return h.KVNO(), nil
+	}
+	_, kvno, err := s.KeyProvider().GetEncryptionKey(sname, realm, kvno, etype)
+	return kvno, err
+}
+
+// audit calls the audit hook if one is configured with the outcome of verifying the AP_REQ.
+func (s *Settings) audit(APReq *messages.APReq, ok bool, err error) {
+	h := s.AuditHook()
+	if h == nil {
+		return
+	}
+	e := audit.Event{
+		Time:             s.Clock().Now().UTC(),
+		Type:             audit.EventAuthentication,
+		Outcome:          audit.Success,
+		ServicePrincipal: APReq.Ticket.SName.PrincipalNameString(),
+		ServiceRealm:     APReq.Ticket.Realm,
+		EType:            etypeID.Name(APReq.Ticket.EncPart.EType),
+		CorrelationID:    s.correlationIDOf(err),
+	}
+	// The client's name is only known once the ticket or authenticator has been decrypted.
+	if len(APReq.Authenticator.CName.NameString) > 0 {
+		e.ClientPrincipal = APReq.Authenticator.CName.PrincipalNameString()
+		e.ClientRealm = APReq.Authenticator.CRealm
+	} else if len(APReq.Ticket.DecryptedEncPart.CName.NameString) > 0 {
+		e.ClientPrincipal = APReq.Ticket.DecryptedEncPart.CName.PrincipalNameString()
+		e.ClientRealm = APReq.Ticket.DecryptedEncPart.CRealm
+	}
+	if a := s.ClientAddress(); a.AddrType == addrtype.IPv4 || a.AddrType == addrtype.IPv6 {
+		e.ClientAddress = net.IP(a.Address).String()
+	}
+	if !ok {
+		e.Outcome = audit.Failure
+		e.Reason = "AP_REQ not valid"
+		if err != nil {
+			e.Reason = err.Error()
+		}
+	}
+	h(e)
+}
@@ -1,21 +1,33 @@
 package service
 
 import (
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/jcmturner/gokrb5/v8/audit"
 	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/clock"
 	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
 	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
 	"github.com/jcmturner/gokrb5/v8/iana/flags"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/krberror"
 	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/pac"
+	"github.com/jcmturner/gokrb5/v8/policy"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
 	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/jcmturner/gokrb5/v8/warning"
+	"github.com/jcmturner/rpc/v2/mstypes"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -61,6 +73,212 @@ func TestVerifyAPREQ(t *testing.T) {
 	}
 }
 
+func TestVerifyAPREQ_Warnings(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	kt := keytab.New()
+	err := kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Now(), 1, etypeID.RC4_HMAC)
+	if err != nil {
+		t.Fatalf("Error creating keytab: %v", err)
+	}
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		etypeID.RC4_HMAC,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	a := newTestAuthenticator(*cl.Credentials)
+	a.CTime = a.CTime.Add(-4 * time.Minute)
+	APReq, err := messages.NewAPReq(tkt, sessionKey, a)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	// The ticket is decrypted with the candidate key of kvno 1
+	APReq.Ticket.EncPart.KVNO = 3
+
+	var ws []warning.Warning
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(kt, ClientAddress(h), WarningHook(func(w warning.Warning) {
+		ws = append(ws, w)
+	}))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	var codes []warning.Code
+	for _, w := range ws {
+		codes = append(codes, w.Code)
+		assert.Equal(t, "testuser1", w.Principal, "warning principal not as expected")
+		assert.Equal(t, "TEST.GOKRB5", w.Realm, "warning realm not as expected")
+	}
+	assert.Equal(t, []warning.Code{warning.WeakEType, warning.WeakEType, warning.ClockSkew, warning.KeytabKVNO, warning.NoPAC}, codes, "warnings not as expected: %v", ws)
+
+	// No warnings are emitted for a ticket that follows current practice
+	ws = nil
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt = keytab.New()
+	kt.Unmarshal(b)
+	tkt, sessionKey, err = messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		etypeID.AES256_CTS_HMAC_SHA1_96,
+		2,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err = messages.NewAPReq(tkt, sessionKey, newTestAuthenticator(*cl.Credentials))
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	s = NewSettings(kt, ClientAddress(h), DecodePAC(false), WarningHook(func(w warning.Warning) {
+		ws = append(ws, w)
+	}))
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	assert.Len(t, ws, 0, "no warnings should have been emitted: %v", ws)
+}
+
+func TestVerifyAPREQ_KeyProvider(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	// Hold the service key only in wrapped form, as it would be if held by a KMS.
+	key, kvno, err := kt.GetEncryptionKey(sname, "TEST.GOKRB5", 1, 18)
+	if err != nil {
+		t.Fatalf("Error getting key from keytab: %v", err)
+	}
+	xor := func(b []byte) ([]byte, error) {
+		o := make([]byte, len(b))
+		for i := range b {
+			o[i] = b[i] ^ 0x5c
+		}
+		return o, nil
+	}
+	wrapped, _ := xor(key.KeyValue)
+	kp := keytab.NewWrappedKeyProvider(xor, keytab.WrappedKey{
+		Principal: sname,
+		Realm:     "TEST.GOKRB5",
+		KVNO:      kvno,
+		KeyType:   18,
+		Wrapped:   wrapped,
+	})
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(nil, KeyProvider(kp), ClientAddress(h))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+}
+
+func TestVerifyAPREQ_MultiKeyProvider(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	alias := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "alias.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	// The KDC issues the ticket for the alias with the key of the service account.
+	key, _, err := kt.GetEncryptionKey(sname, "TEST.GOKRB5", 1, 18)
+	if err != nil {
+		t.Fatalf("Error getting key from keytab: %v", err)
+	}
+	kdcKt := keytab.New()
+	kdcKt.AddKeyEntry("HTTP/alias.test.gokrb5", "TEST.GOKRB5", key, time.Now(), 1)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		alias, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kdcKt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	other := keytab.New()
+	other.AddEntryFromPassword("HTTP/other.test.gokrb5", "TEST.GOKRB5", "password", 1, 18)
+	kp := keytab.NewMultiKeyProvider(other, kt)
+	kp.AddAliases("HTTP/host.test.gokrb5", "HTTP/alias.test.gokrb5")
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(nil, KeyProvider(kp), ClientAddress(h))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+}
+
 func TestVerifyAPREQWithPrincipalOverride(t *testing.T) {
 	t.Parallel()
 	cl := getClient()
@@ -255,6 +473,62 @@ func TestVerifyAPREQ_Replay(t *testing.T) {
 	assert.Equal(t, errorcode.KRB_AP_ERR_REPEAT, err.(messages.KRBError).ErrorCode, "Error code not as expected")
 }
 
+// testReplayCache is a ReplayCache recording the authenticators checked and reporting them all as replays.
+type testReplayCache struct {
+	checked int
+}
+
+func (c *testReplayCache) IsReplay(sname types.PrincipalName, a types.Authenticator) bool {
+	c.checked++
+	return true
+}
+
+func TestVerifyAPREQ_ReplayCacheBackend(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	rc := new(testReplayCache)
+	s := NewSettings(kt, ClientAddress(h), ReplayCacheBackend(rc))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if ok || err == nil {
+		t.Fatal("Validation of AP_REQ passed when it should not have")
+	}
+	assert.Equal(t, 1, rc.checked, "replay cache configured not used")
+	assert.IsType(t, messages.KRBError{}, err, "Error is not a KRBError")
+	assert.Equal(t, errorcode.KRB_AP_ERR_REPEAT, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+}
+
 func TestVerifyAPREQ_FutureTicket(t *testing.T) {
 	t.Parallel()
 	cl := getClient()
@@ -418,3 +692,309 @@ func getClient() *client.Client {
 	cl := client.NewWithKeytab("testuser1", "TEST.GOKRB5", kt, c)
 	return cl
 }
+
+func BenchmarkVerifyAPREQ(b *testing.B) {
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	kb, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(kb)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		b.Fatalf("Error getting test ticket: %v", err)
+	}
+	// Each AP_REQ needs a distinct authenticator to avoid replay detection
+	auth := newTestAuthenticator(*cl.Credentials)
+	reqs := make([][]byte, b.N)
+	for i := range reqs {
+		auth.CTime = st.Add(time.Duration(i) * time.Second).Truncate(time.Second)
+		APReq, err := messages.NewAPReq(tkt, sessionKey, auth)
+		if err != nil {
+			b.Fatalf("Error getting test AP_REQ: %v", err)
+		}
+		reqs[i], err = APReq.Marshal()
+		if err != nil {
+			b.Fatalf("Error marshaling test AP_REQ: %v", err)
+		}
+	}
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(kt, ClientAddress(h), MaxClockSkew(time.Duration(b.N+1)*time.Second))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var APReq messages.APReq
+		err := APReq.Unmarshal(reqs[i])
+		if err != nil {
+			b.Fatalf("Error unmarshaling AP_REQ: %v", err)
+		}
+		ok, _, err := VerifyAPREQ(&APReq, s)
+		if !ok || err != nil {
+			b.Fatalf("Validation of AP_REQ failed: %v", err)
+		}
+	}
+}
+
+func TestVerifyAPREQ_Clock(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	// The ticket has expired according to the service's clock.
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(kt, ClientAddress(h), Clock(clock.NewFake(st.Add(time.Duration(48)*time.Hour))))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if ok || err == nil {
+		t.Fatal("Validation of AP_REQ passed when it should not have")
+	}
+	if _, ok := err.(messages.KRBError); ok {
+		assert.Equal(t, errorcode.KRB_AP_ERR_TKT_EXPIRED, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+	} else {
+		t.Fatalf("Error is not a KRBError: %v", err)
+	}
+}
+
+func TestVerifyAPREQ_TicketPolicy(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+
+	for _, test := range []struct {
+		policy policy.Policy
+		ok     bool
+	}{
+		{policy.Policy{MaxLifetime: time.Duration(10) * time.Hour}, false},
+		{policy.Policy{MaxLifetime: time.Duration(24) * time.Hour}, true},
+		{policy.Policy{DisallowedETypes: []int32{etypeID.AES256_CTS_HMAC_SHA1_96}}, false},
+		{policy.Policy{DisallowedETypes: []int32{etypeID.RC4_HMAC}, MaxAuthAge: time.Hour}, true},
+	} {
+		APReq, err := messages.NewAPReq(
+			tkt,
+			sessionKey,
+			newTestAuthenticator(*cl.Credentials),
+		)
+		if err != nil {
+			t.Fatalf("Error getting test AP_REQ: %v", err)
+		}
+		p := test.policy
+		s := NewSettings(kt, ClientAddress(h), TicketPolicy(&p))
+		ok, _, err := VerifyAPREQ(&APReq, s)
+		assert.Equal(t, test.ok, ok, "verification with policy %+v not as expected: %v", test.policy, err)
+		if !test.ok {
+			if e, ok := err.(messages.KRBError); ok {
+				assert.Equal(t, errorcode.KDC_ERR_POLICY, e.ErrorCode, "Error code not as expected")
+			} else {
+				t.Fatalf("Error is not a KRBError: %v", err)
+			}
+		}
+	}
+}
+
+func TestVerifyAPREQ_AuditHook(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	var events []audit.Event
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(kt, ClientAddress(h), CorrelationID("attempt-1"), AuditHook(func(e audit.Event) { events = append(events, e) }))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	// The same AP_REQ again is a replay.
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	assert.False(t, ok, "replayed AP_REQ should not be valid")
+	assert.Equal(t, "attempt-1", krberror.CorrelationID(err), "error not annotated")
+	if len(events) != 2 {
+		t.Fatalf("expected 2 audit events, got %d", len(events))
+	}
+	assert.Equal(t, audit.Success, events[0].Outcome, "outcome of first event not as expected")
+	assert.Equal(t, "testuser1", events[0].ClientPrincipal, "client principal not as expected")
+	assert.Equal(t, "TEST.GOKRB5", events[0].ClientRealm, "client realm not as expected")
+	assert.Equal(t, "HTTP/host.test.gokrb5", events[0].ServicePrincipal, "service principal not as expected")
+	assert.Equal(t, "127.0.0.1", events[0].ClientAddress, "client address not as expected")
+	assert.Equal(t, "attempt-1", events[0].CorrelationID, "correlation ID not as expected")
+	assert.Equal(t, audit.Failure, events[1].Outcome, "outcome of replay event not as expected")
+	assert.Contains(t, events[1].Reason, "replay", "reason not as expected")
+}
+
+func TestDelegatedCredentials_Malformed(t *testing.T) {
+	t.Parallel()
+	cksum := func(dlg []byte) []byte {
+		b := make([]byte, 24, 24+len(dlg))
+		binary.LittleEndian.PutUint32(b[:4], 16)
+		binary.LittleEndian.PutUint32(b[20:24], gssapi.ContextFlagDeleg)
+		return append(b, dlg...)
+	}
+	var tests = []struct {
+		name string
+		dlg  []byte
+		code int32
+	}{
+		{"no delegation field", nil, errorcode.KRB_AP_ERR_INAPP_CKSUM},
+		{"wrong delegation option", []byte{2, 0, 1, 0, 0}, errorcode.KRB_AP_ERR_INAPP_CKSUM},
+		{"truncated KRB_CRED", []byte{1, 0, 10, 0, 0}, errorcode.KRB_AP_ERR_INAPP_CKSUM},
+		{"invalid KRB_CRED", []byte{1, 0, 2, 0, 5, 0}, errorcode.KRB_AP_ERR_MSG_TYPE},
+	}
+	for _, test := range tests {
+		var APReq messages.APReq
+		APReq.Authenticator.Cksum = types.Checksum{CksumType: chksumtype.GSSAPI, Checksum: cksum(test.dlg)}
+		_, ok, err := delegatedCredentials(&APReq)
+		assert.False(t, ok, "%s: delegated credentials should not be returned", test.name)
+		var krberr messages.KRBError
+		if assert.True(t, errors.As(err, &krberr), "%s: error not a KRBError: %v", test.name, err) {
+			assert.Equal(t, test.code, krberr.ErrorCode, "%s: error code not as expected", test.name)
+		}
+	}
+
+	// Without the delegation flag there are no delegated credentials.
+	var APReq messages.APReq
+	APReq.Authenticator.Cksum = types.Checksum{CksumType: chksumtype.GSSAPI, Checksum: make([]byte, 24)}
+	_, ok, err := delegatedCredentials(&APReq)
+	assert.False(t, ok, "delegated credentials should not be returned without the delegation flag")
+	assert.NoError(t, err, "error without the delegation flag")
+}
+
+func TestADCredentials_Claims(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_ClientClaimsInfo_XPRESS_HUFF)
+	if err != nil {
+		t.Fatal("Could not decode test data hex string")
+	}
+	var k pac.ClientClaimsInfo
+	if err := k.Unmarshal(b); err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	ad := adCredentials(&pac.PACType{KerbValidationInfo: &pac.KerbValidationInfo{}, ClientClaimsInfo: &k}, NewSettings(nil))
+	assert.Equal(t, []credentials.ADClaim{
+		{ID: "ad://ext/objectClass:88d5de791e7b27e6", Uint64Values: []uint64{655369, 65543, 65542, 65536}},
+		{ID: "ad://ext/sAMAccountName:88d5d9085ea5c0c0", StringValues: []string{"testuser1"}},
+		{ID: "ad://ext/sAMAccountType:88d5de79a7ecf8c7", Int64Values: []int64{805306368}},
+	}, ad.UserClaims, "user claims not as expected")
+	assert.Nil(t, ad.DeviceClaims, "device claims not expected")
+	c, ok := credentials.Claim(ad.UserClaims, "ad://ext/sAMAccountName:88d5d9085ea5c0c0")
+	assert.True(t, ok, "claim not found")
+	assert.Equal(t, []string{"testuser1"}, c.StringValues, "claim values not as expected")
+	_, ok = credentials.Claim(ad.UserClaims, "ad://ext/unknown")
+	assert.False(t, ok, "unknown claim found")
+}
+
+func TestADCredentials_SIDResolver(t *testing.T) {
+	t.Parallel()
+	p := &pac.PACType{KerbValidationInfo: &pac.KerbValidationInfo{
+		UserID:     1105,
+		GroupCount: 1,
+		GroupIDs:   []mstypes.GroupMembership{{RelativeID: 1108}},
+	}}
+	p.KerbValidationInfo.LogonDomainID.SubAuthority = []uint32{21, 1, 2, 3}
+	ad := adCredentials(p, NewSettings(nil))
+	assert.Nil(t, ad.SIDNames, "SIDs resolved without a resolver")
+	r := func(sids []string) (map[string]string, error) {
+		names := make(map[string]string)
+		for _, sid := range sids {
+			names[sid] = "name of " + sid
+		}
+		return names, nil
+	}
+	ad = adCredentials(p, NewSettings(nil, SIDResolver(r)))
+	assert.Equal(t, []string{"name of " + ad.GroupMembershipSIDs[0]}, ad.GroupNames(), "group names not as expected")
+	assert.Equal(t, "name of "+ad.SID(), ad.SIDNames[ad.SID()], "user name not as expected")
+	ad = adCredentials(p, NewSettings(nil, SIDResolver(func(sids []string) (map[string]string, error) {
+		return nil, errors.New("directory unavailable")
+	})))
+	assert.Nil(t, ad.SIDNames, "SID names set when resolution failed")
+}
@@ -4,12 +4,10 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strings"
-	"time"
 
 	goidentity "github.com/jcmturner/goidentity/v6"
 	"github.com/jcmturner/gokrb5/v8/client"
 	"github.com/jcmturner/gokrb5/v8/config"
-	"github.com/jcmturner/gokrb5/v8/credentials"
 )
 
 // NewKRB5BasicAuthenticator creates a new NewKRB5BasicAuthenticator
@@ -38,48 +36,41 @@ type KRB5BasicAuthenticator struct {
 func (a KRB5BasicAuthenticator) Authenticate() (i goidentity.Identity, ok bool, err error) {
 	a.realm, a.username, a.password, err = parseBasicHeaderValue(a.BasicHeaderValue)
 	if err != nil {
-		err = fmt.Errorf("could not parse basic authentication header: %v", err)
+		err = fmt.Errorf("could not parse basic authentication header: %w", err)
 		return
 	}
 	cl := client.NewWithPassword(a.username, a.realm, a.password, a.clientConfig)
 	err = cl.Login()
 	if err != nil {
 		// Username and/or password could be wrong
-		err = fmt.Errorf("error with user credentials during login: %v", err)
+		err = fmt.Errorf("error with user credentials during login: %w", err)
 		return
 	}
 	tkt, _, err := cl.GetServiceTicket(a.serviceSettings.SName())
 	if err != nil {
-		err = fmt.Errorf("could not get service ticket: %v", err)
+		err = fmt.Errorf("could not get service ticket: %w", err)
 		return
 	}
-	err = tkt.DecryptEncPart(a.serviceSettings.Keytab, a.serviceSettings.KeytabPrincipal())
+	err = tkt.DecryptEncPart(a.serviceSettings.KeyProvider(), a.serviceSettings.KeytabPrincipal())
 	if err != nil {
-		err = fmt.Errorf("could not decrypt service ticket: %v", err)
+		err = fmt.Errorf("could not decrypt service ticket: %w", err)
 		return
 	}
-	cl.Credentials.SetAuthTime(time.Now().UTC())
+	cl.Credentials.SetAuthTime(a.serviceSettings.Clock().Now().UTC())
 	cl.Credentials.SetAuthenticated(true)
-	isPAC, pac, err := tkt.GetPACType(a.serviceSettings.Keytab, a.serviceSettings.KeytabPrincipal(), a.serviceSettings.Logger())
+	isPAC, pac, err := tkt.GetPACType(a.serviceSettings.KeyProvider(), a.serviceSettings.KeytabPrincipal(), a.serviceSettings.Logger())
 	if isPAC && err != nil {
-		err = fmt.Errorf("error processing PAC: %v", err)
+		err = fmt.Errorf("error processing PAC: %w", err)
 		return
 	}
 	if isPAC {
+		if err = verifyPAC(tkt, &pac, a.serviceSettings); err != nil {
+			err = fmt.Errorf("error processing PAC: %w", err)
+			return
+		}
 		// There is a valid PAC. Adding attributes to creds
-		cl.Credentials.SetADCredentials(credentials.ADCredentials{
-			GroupMembershipSIDs: pac.KerbValidationInfo.GetGroupMembershipSIDs(),
-			LogOnTime:           pac.KerbValidationInfo.LogOnTime.Time(),
-			LogOffTime:          pac.KerbValidationInfo.LogOffTime.Time(),
-			PasswordLastSet:     pac.KerbValidationInfo.PasswordLastSet.Time(),
-			EffectiveName:       pac.KerbValidationInfo.EffectiveName.Value,
-			FullName:            pac.KerbValidationInfo.FullName.Value,
-			UserID:              int(pac.KerbValidationInfo.UserID),
-			PrimaryGroupID:      int(pac.KerbValidationInfo.PrimaryGroupID),
-			LogonServer:         pac.KerbValidationInfo.LogonServer.Value,
-			LogonDomainName:     pac.KerbValidationInfo.LogonDomainName.Value,
-			LogonDomainID:       pac.KerbValidationInfo.LogonDomainID.String(),
-		})
+		ad := adCredentials(&pac, a.serviceSettings)
+		cl.Credentials.SetADCredentials(ad)
 	}
 	ok = true
 	i = cl.Credentials
@@ -2,17 +2,36 @@
 package service
 
 import (
-	"github.com/jcmturner/gokrb5/v8/types"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/types"
 )
 
 // Replay cache is required as specified in RFC 4120 section 3.2.3
 
+// ReplayCache detects replayed authenticators, RFC 4120 section 3.2.3. Implementations shared by the instances of a
+// service, such as those of the rcache package, detect an authenticator replayed to another instance. The Cache
+// returned by GetReplayCache, used by default, only detects replays to the same process.
+//
+// IsReplay returns whether the authenticator has already been presented to the service principal and otherwise
+// records it. As the check is the only protection against replays, implementations that cannot complete it, for
+// example as a shared cache cannot be reached, should return true.
+type ReplayCache interface {
+	IsReplay(sname types.PrincipalName, a types.Authenticator) bool
+}
+
 // Cache for tickets received from clients keyed by fully qualified client name. Used to track replay of tickets.
 type Cache struct {
 	entries map[string]clientEntries
 	mux     sync.RWMutex
+	running int32         // set while the background cleaning of old entries is running
+	stop    chan struct{} // closed to stop the background cleaning
+	clock   clock.Clock   // the clock entries are timed with, the system clock if nil
+	d       time.Duration // the age old entries are cleared at as the Cache is used, zero if cleaned in the background
+	cleared time.Time     // the time old entries were last cleared as the Cache was used
 }
 
 // clientEntries holds entries of client details sent to the service.
@@ -29,100 +48,164 @@ type replayCacheEntry struct {
 	cTime         time.Time // This combines the ticket's CTime and Cusec
 }
 
-func (c *Cache) getClientEntries(cname types.PrincipalName) (clientEntries, bool) {
-	c.mux.RLock()
-	defer c.mux.RUnlock()
-	ce, ok := c.entries[cname.PrincipalNameString()]
-	return ce, ok
-}
-
-func (c *Cache) getClientEntry(cname types.PrincipalName, t time.Time) (replayCacheEntry, bool) {
-	if ce, ok := c.getClientEntries(cname); ok {
-		c.mux.RLock()
-		defer c.mux.RUnlock()
-		if e, ok := ce.replayMap[t]; ok {
-			return e, true
-		}
-	}
-	return replayCacheEntry{}, false
-}
-
 // Instance of the ServiceCache. This needs to be a singleton.
 var replayCache Cache
-var once sync.Once
 
 // GetReplayCache returns a pointer to the Cache singleton.
 func GetReplayCache(d time.Duration) *Cache {
-	// Create a singleton of the ReplayCache and start a background thread to regularly clean out old entries
-	once.Do(func() {
-		replayCache = Cache{
-			entries: make(map[string]clientEntries),
-		}
-		go func() {
-			for {
-				// TODO consider using a context here.
-				time.Sleep(d)
+	if atomic.LoadInt32(&replayCache.running) == 1 {
+		return &replayCache
+	}
+	// Create the singleton of the ReplayCache and start a background thread to regularly clean out old entries.
+	// The entries are set under the lock as the cache may be read by GetDebugSnapshot before it is created.
+	replayCache.mux.Lock()
+	defer replayCache.mux.Unlock()
+	if replayCache.running == 1 {
+		return &replayCache
+	}
+	if replayCache.entries == nil {
+		replayCache.entries = make(map[string]clientEntries)
+	}
+	stop := make(chan struct{})
+	replayCache.stop = stop
+	atomic.StoreInt32(&replayCache.running, 1)
+	go func() {
+		t := time.NewTicker(d)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
 				replayCache.ClearOldEntries(d)
+			case <-stop:
+				return
 			}
-		}()
-	})
+		}
+	}()
 	return &replayCache
 }
 
+// NewReplayCache returns a Cache, separate from the Cache singleton, timing its entries with the clock provided, such
+// as the clock of a service's Settings. Entries older than the duration are cleared as the Cache is used rather than in
+// the background, so that a clock.Fake controls their expiry.
+func NewReplayCache(d time.Duration, c clock.Clock) *Cache {
+	return &Cache{
+		entries: make(map[string]clientEntries),
+		clock:   c,
+		d:       d,
+		cleared: clock.OrReal(c).Now().UTC(),
+	}
+}
+
+// now returns the time of the Cache's clock.
+func (c *Cache) now() time.Time {
+	return clock.OrReal(c.clock).Now().UTC()
+}
+
+// Close stops the background cleaning of old entries and clears the Cache, zeroing its copies of the session subkeys.
+// The cleaning is started again when the Cache is next used by a service.
+func (c *Cache) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.running == 1 {
+		close(c.stop)
+		atomic.StoreInt32(&c.running, 0)
+	}
+	for _, ce := range c.entries {
+		zero(ce.subKey.KeyValue)
+	}
+	c.entries = make(map[string]clientEntries)
+	return nil
+}
+
+// zero overwrites the bytes with zeros.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 // AddEntry adds an entry to the Cache.
 func (c *Cache) AddEntry(sname types.PrincipalName, a types.Authenticator) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.addEntry(a.CName.PrincipalNameString(), sname, a)
+}
+
+// addEntry adds an entry to the Cache for the client name provided. The caller must hold the write lock.
+func (c *Cache) addEntry(cname string, sname types.PrincipalName, a types.Authenticator) {
 	ct := a.CTime.Add(time.Duration(a.Cusec) * time.Microsecond)
-	if ce, ok := c.getClientEntries(a.CName); ok {
-		c.mux.Lock()
-		defer c.mux.Unlock()
-		ce.replayMap[ct] = replayCacheEntry{
-			presentedTime: time.Now().UTC(),
-			sName:         sname,
-			cTime:         ct,
-		}
-		ce.seqNumber = a.SeqNumber
-		ce.subKey = a.SubKey
-	} else {
-		c.mux.Lock()
-		defer c.mux.Unlock()
-		c.entries[a.CName.PrincipalNameString()] = clientEntries{
-			replayMap: map[time.Time]replayCacheEntry{
-				ct: {
-					presentedTime: time.Now().UTC(),
-					sName:         sname,
-					cTime:         ct,
-				},
-			},
-			seqNumber: a.SeqNumber,
-			subKey:    a.SubKey,
+	ce, ok := c.entries[cname]
+	if !ok {
+		ce = clientEntries{
+			replayMap: make(map[time.Time]replayCacheEntry),
 		}
 	}
+	ce.replayMap[ct] = replayCacheEntry{
+		presentedTime: c.now(),
+		sName:         sname,
+		cTime:         ct,
+	}
+	ce.seqNumber = a.SeqNumber
+	// The Cache holds its own copy of the subkey, which the security contexts established with the authenticator
+	// continue to use after the Cache zeroes it.
+	zero(ce.subKey.KeyValue)
+	ce.subKey = types.EncryptionKey{KeyType: a.SubKey.KeyType, KeyValue: append([]byte(nil), a.SubKey.KeyValue...)}
+	c.entries[cname] = ce
 }
 
 // ClearOldEntries clears entries from the Cache that are older than the duration provided.
 func (c *Cache) ClearOldEntries(d time.Duration) {
 	c.mux.Lock()
 	defer c.mux.Unlock()
+	c.clearOldEntries(d, c.now())
+}
+
+// clearOldEntries clears entries from the Cache that are older than the duration at the time provided. The caller must
+// hold the write lock.
+func (c *Cache) clearOldEntries(d time.Duration, now time.Time) {
 	for ke, ce := range c.entries {
 		for k, e := range ce.replayMap {
-			if time.Now().UTC().Sub(e.presentedTime) > d {
+			if now.Sub(e.presentedTime) > d {
 				delete(ce.replayMap, k)
 			}
 		}
 		if len(ce.replayMap) == 0 {
+			zero(ce.subKey.KeyValue)
 			delete(c.entries, ke)
 		}
 	}
 }
 
 // IsReplay tests if the Authenticator provided is a replay within the duration defined. If this is not a replay add the entry to the cache for tracking.
+//
+// The check and the addition of the entry are performed under a single lock so that concurrent presentations of the
+// same authenticator cannot both be accepted.
 func (c *Cache) IsReplay(sname types.PrincipalName, a types.Authenticator) bool {
 	ct := a.CTime.Add(time.Duration(a.Cusec) * time.Microsecond)
-	if e, ok := c.getClientEntry(a.CName, ct); ok {
-		if e.sName.Equal(sname) {
+	cname := a.CName.PrincipalNameString()
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.d > 0 {
+		if now := c.now(); now.Sub(c.cleared) >= c.d {
+			c.clearOldEntries(c.d, now)
+			c.cleared = now
+		}
+	}
+	if ce, ok := c.entries[cname]; ok {
+		if e, ok := ce.replayMap[ct]; ok && e.sName.Equal(sname) {
 			return true
 		}
 	}
-	c.AddEntry(sname, a)
+	c.addEntry(cname, sname, a)
 	return false
 }
+
+// Size returns the number of clients and the total number of authenticators tracked in the Cache.
+func (c *Cache) Size() (clients, authenticators int) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	for _, ce := range c.entries {
+		authenticators += len(ce.replayMap)
+	}
+	return len(c.entries), authenticators
+}
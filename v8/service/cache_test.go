@@ -0,0 +1,105 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_IsReplay(t *testing.T) {
+	t.Parallel()
+	c := Cache{entries: make(map[string]clientEntries)}
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	a := newTestAuthenticator(*getClient().Credentials)
+	assert.False(t, c.IsReplay(sname, a), "first presentation should not be a replay")
+	assert.True(t, c.IsReplay(sname, a), "second presentation should be a replay")
+	assert.False(t, c.IsReplay(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/other.test.gokrb5"), a),
+		"presentation to another service should not be a replay")
+
+	// Only one of concurrent presentations of the same authenticator is accepted
+	a.Cusec = (a.Cusec + 1) % 1000000
+	var wg sync.WaitGroup
+	var mux sync.Mutex
+	var accepted int
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !c.IsReplay(sname, a) {
+				mux.Lock()
+				accepted++
+				mux.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, accepted, "concurrent presentations accepted not as expected")
+	clients, auths := c.Size()
+	assert.Equal(t, 1, clients, "number of clients not as expected")
+	assert.Equal(t, 2, auths, "number of authenticators not as expected")
+
+	c.ClearOldEntries(-time.Second)
+	assert.Len(t, c.entries, 0, "entries should have been cleared")
+}
+
+func TestNewReplayCache_Clock(t *testing.T) {
+	t.Parallel()
+	c := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	rc := NewReplayCache(time.Minute, c)
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	a := newTestAuthenticator(*getClient().Credentials)
+	assert.False(t, rc.IsReplay(sname, a), "first presentation should not be a replay")
+	c.Advance(30 * time.Second)
+	assert.True(t, rc.IsReplay(sname, a), "presentation within the duration should be a replay")
+	c.Advance(2 * time.Minute)
+	b := newTestAuthenticator(*getClient().Credentials)
+	b.Cusec = (a.Cusec + 1) % 1000000
+	rc.IsReplay(sname, b)
+	_, auths := rc.Size()
+	assert.Equal(t, 1, auths, "entries older than the duration on the cache's clock should have been cleared")
+
+	s := NewSettings(nil, Clock(c))
+	assert.False(t, s.ReplayCacheBackend() == ReplayCache(GetReplayCache(s.MaxClockSkew())),
+		"a service with a clock should not use the process's cache")
+	rc = NewReplayCache(time.Minute, c)
+	s = NewSettings(nil, Clock(c), ReplayCacheBackend(rc))
+	assert.Equal(t, rc, s.ReplayCacheBackend(), "configured replay cache not used")
+}
+
+func BenchmarkCache_IsReplay(b *testing.B) {
+	c := Cache{entries: make(map[string]clientEntries)}
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5")
+	a := newTestAuthenticator(*getClient().Credentials)
+	st := a.CTime
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.CTime = st.Add(time.Duration(i) * time.Second)
+		if c.IsReplay(sname, a) {
+			b.Fatal("unexpected replay")
+		}
+	}
+}
+
+func TestCache_Close(t *testing.T) {
+	c := GetReplayCache(time.Minute)
+	a := types.Authenticator{
+		CName:  types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "closeuser"),
+		CTime:  time.Now().UTC(),
+		SubKey: types.EncryptionKey{KeyType: 18, KeyValue: []byte("subkey value")},
+	}
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	c.AddEntry(sname, a)
+	held := c.entries["closeuser"].subKey.KeyValue
+	assert.NoError(t, c.Close(), "error closing cache")
+	assert.Equal(t, make([]byte, 12), held, "subkey held by the cache should be zeroed")
+	assert.Equal(t, []byte("subkey value"), a.SubKey.KeyValue, "subkey of the authenticator should not be zeroed")
+	assert.False(t, c.IsReplay(sname, a), "entries should be cleared")
+	assert.Equal(t, c, GetReplayCache(time.Minute), "cache should be usable again")
+	assert.Equal(t, int32(1), c.running, "cleaning should be restarted")
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DebugSnapshot is a point in time view of the internal state of the service side for operators investigating a
+// service in production.
+type DebugSnapshot struct {
+	// ReplayCacheClients is the number of clients with authenticators tracked in the replay cache.
+	ReplayCacheClients int
+	// ReplayCacheAuthenticators is the total number of authenticators tracked in the replay cache.
+	ReplayCacheAuthenticators int
+}
+
+// GetDebugSnapshot returns a DebugSnapshot of the replay cache shared by the services of the process.
+func GetDebugSnapshot() DebugSnapshot {
+	// The cache singleton is read directly so that taking a snapshot does not create it.
+	clients, auths := replayCache.Size()
+	return DebugSnapshot{
+		ReplayCacheClients:        clients,
+		ReplayCacheAuthenticators: auths,
+	}
+}
+
+// DebugHandler returns a http.Handler that responds with the service side DebugSnapshot in a JSON format.
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := json.MarshalIndent(GetDebugSnapshot(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	DebugHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/kerberos", nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "content type not as expected")
+	var s map[string]int
+	err := json.Unmarshal(w.Body.Bytes(), &s)
+	if err != nil {
+		t.Fatalf("error unmarshaling snapshot: %v", err)
+	}
+	assert.Contains(t, s, "ReplayCacheClients", "snapshot should include the replay cache clients")
+	assert.Contains(t, s, "ReplayCacheAuthenticators", "snapshot should include the replay cache authenticators")
+}
@@ -0,0 +1,27 @@
+// Package serviceexpvar publishes the service side DebugSnapshot as an expvar variable.
+//
+// It is a separate package as importing expvar registers the /debug/vars endpoint, which includes the command line
+// and memory statistics of the process, with the default HTTP request multiplexer.
+package serviceexpvar
+
+import (
+	"expvar"
+
+	"github.com/jcmturner/gokrb5/v8/service"
+)
+
+// Var returns an expvar variable of the service side DebugSnapshot, to be set in an expvar.Map or published by the
+// caller.
+func Var() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return service.GetDebugSnapshot()
+	})
+}
+
+// Publish publishes the service side DebugSnapshot as an expvar variable with the name provided so that it is
+// included in the /debug/vars endpoint.
+//
+// As with expvar.Publish, this panics if a variable with the name is already published.
+func Publish(name string) {
+	expvar.Publish(name, Var())
+}
@@ -0,0 +1,22 @@
+package serviceexpvar
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVar(t *testing.T) {
+	t.Parallel()
+	var s service.DebugSnapshot
+	if err := json.Unmarshal([]byte(Var().String()), &s); err != nil {
+		t.Fatalf("error unmarshaling snapshot: %v", err)
+	}
+	assert.Equal(t, service.GetDebugSnapshot(), s, "snapshot not as expected")
+
+	Publish("gokrb5test.service")
+	assert.NotNil(t, expvar.Get("gokrb5test.service"), "snapshot not published")
+}
@@ -1,25 +1,53 @@
 package service
 
 import (
+	"io"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/jcmturner/gokrb5/v8/audit"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
 	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/logging"
+	"github.com/jcmturner/gokrb5/v8/policy"
 	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/jcmturner/gokrb5/v8/warning"
 )
 
 // Settings defines service side configuration settings.
 type Settings struct {
 	Keytab             *keytab.Keytab
+	keyProvider        keytab.KeyProvider
 	ktprinc            *types.PrincipalName
 	sname              string
 	requireHostAddr    bool
+	anyHostAddr        bool
 	disablePACDecoding bool
 	cAddr              types.HostAddress
 	maxClockSkew       time.Duration
 	logger             *log.Logger
+	structuredLogger   logging.Logger
 	sessionMgr         SessionMgr
+	packetDump         io.Writer
+	warningHook        warning.Hook
+	clock              clock.Clock
+	ticketPolicy       *policy.Policy
+	auditHook          audit.Hook
+	ntlm               NTLMAcceptor
+	channelBindings    *gssapi.ChannelBindings
+	requireBindings    bool
+	replayCache        ReplayCache
+	pacKDCKeys         keytab.KeyProvider
+	verifyPACClient    bool
+	authorizer         AuthorizeFunc
+	sidResolver        credentials.SIDResolver
+	iakerbProxy        *client.Client
+	correlationID      string
 }
 
 // NewSettings creates a new service Settings.
@@ -29,6 +57,9 @@ func NewSettings(kt *keytab.Keytab, settings ...func(*Settings)) *Settings {
 	for _, set := range settings {
 		set(s)
 	}
+	if s.replayCache == nil && s.clock != nil {
+		s.replayCache = NewReplayCache(s.MaxClockSkew(), s.clock)
+	}
 	return s
 }
 
@@ -46,6 +77,23 @@ func (s *Settings) RequireHostAddr() bool {
 	return s.requireHostAddr
 }
 
+// VerifyHostAddr used to configure service side to enable/disable checking that the client's address, set with
+// ClientAddress, is one of the addresses a ticket was issued for when the ticket has addresses. Defaults to enabled if
+// not specified. Disable it when the client's address is translated, such as by a proxy or NAT, so that addressed
+// tickets can still be accepted.
+//
+// s := NewSettings(kt, VerifyHostAddr(false))
+func VerifyHostAddr(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.anyHostAddr = !b
+	}
+}
+
+// VerifyHostAddr indicates whether the service should check the client's address against the addresses of the ticket.
+func (s *Settings) VerifyHostAddr() bool {
+	return !s.anyHostAddr
+}
+
 // DecodePAC used to configure service side to enable/disable PAC decoding if the PAC is present.
 // Defaults to enabled if not specified.
 //
@@ -89,6 +137,69 @@ func (s *Settings) Logger() *log.Logger {
 	return s.logger
 }
 
+// StructuredLogger used to configure the service with a leveled logger of structured fields, such as the client and
+// service principals of each AP_REQ verified and the time taken at logging.LevelDebug, and the summaries of the
+// messages received at logging.LevelTrace. It is used instead of the Logger if both are configured.
+//
+// s := NewSettings(kt, StructuredLogger(logging.NewJSONLogger(os.Stderr, logging.LevelDebug)))
+func StructuredLogger(l logging.Logger) func(*Settings) {
+	return func(s *Settings) {
+		s.structuredLogger = l
+	}
+}
+
+// StructuredLogger returns the service's structured logger. If none is configured it is a logger writing the messages
+// of logging.LevelInfo and above to the Logger, or nil if there is no Logger either.
+func (s *Settings) StructuredLogger() logging.Logger {
+	if s.structuredLogger != nil {
+		return s.structuredLogger
+	}
+	if s.logger != nil {
+		return logging.NewTextLogger(s.logger, logging.LevelInfo)
+	}
+	return nil
+}
+
+// logf writes the message with the fields to the service's structured logger if it is configured.
+func (s *Settings) logf(level logging.Level, msg string, fields ...logging.Field) {
+	if l := s.StructuredLogger(); l != nil && l.Enabled(level) {
+		l.Log(level, msg, fields...)
+	}
+}
+
+// PACKDCKeyProvider used to configure the service with the keys of its realm's krbtgt principal to verify the KDC
+// checksums of the PACs of tickets with, as well as their server checksums, so that a PAC forged with the service's
+// key is rejected. Only services trusted with the KDC's keys, such as those running on a domain controller, can be
+// configured with them.
+//
+// s := NewSettings(kt, PACKDCKeyProvider(krbtgtKeytab))
+func PACKDCKeyProvider(kp keytab.KeyProvider) func(*Settings) {
+	return func(s *Settings) {
+		s.pacKDCKeys = kp
+	}
+}
+
+// PACKDCKeyProvider returns the source of the krbtgt keys the KDC checksums of PACs are verified with, or nil if
+// they are not verified.
+func (s *Settings) PACKDCKeyProvider() keytab.KeyProvider {
+	return s.pacKDCKeys
+}
+
+// VerifyPACClient used to configure the service to reject PACs whose PAC_CLIENT_INFO does not match the client and
+// authentication time of the ticket they are in, as a PAC copied from another or an earlier ticket would not.
+//
+// s := NewSettings(kt, VerifyPACClient(true))
+func VerifyPACClient(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.verifyPACClient = b
+	}
+}
+
+// VerifyPACClient indicates if the client info of PACs is checked against their ticket.
+func (s *Settings) VerifyPACClient() bool {
+	return s.verifyPACClient
+}
+
 // KeytabPrincipal used to override the principal name used to find the key in the keytab.
 //
 // s := NewSettings(kt, KeytabPrincipal("someaccount"))
@@ -104,6 +215,60 @@ func (s *Settings) KeytabPrincipal() *types.PrincipalName {
 	return s.ktprinc
 }
 
+// KeyProvider used to configure the service with a source of its long-term keys other than a keytab,
+// for example keys unwrapped from a KMS, so that no keytab file needs to be present on disk.
+// When set it is used in preference to the keytab.
+//
+// s := NewSettings(nil, KeyProvider(kp))
+func KeyProvider(kp keytab.KeyProvider) func(*Settings) {
+	return func(s *Settings) {
+		s.keyProvider = kp
+	}
+}
+
+// KeyProvider returns the source of the service's long-term keys.
+// If no key provider has been configured the keytab is returned.
+func (s *Settings) KeyProvider() keytab.KeyProvider {
+	if s.keyProvider != nil {
+		return s.keyProvider
+	}
+	if s.Keytab == nil {
+		// Avoid returning a non-nil interface holding a nil keytab pointer.
+		return keytab.New()
+	}
+	return s.Keytab
+}
+
+// KeyHandleProvider used to configure the service with long-term keys held outside of the process, for example in an
+// HSM, so that the key values are never in the service's memory. Tickets are decrypted, and the server checksums of
+// their PACs verified, with the key handles. When set it is used in preference to the keytab.
+//
+// s := NewSettings(nil, KeyHandleProvider(hp))
+func KeyHandleProvider(hp keytab.KeyHandleProvider) func(*Settings) {
+	return func(s *Settings) {
+		s.keyProvider = keytab.HandleKeyProvider{KeyHandleProvider: hp}
+	}
+}
+
+// User2User used to configure the service to accept user-to-user tickets, RFC 4120 section 3.7, encrypted with the
+// session key of the client's TGT rather than a service key, so that a peer-to-peer service can run without a key
+// registered with the KDC. Peers obtain tickets with GetUser2UserServiceTicket and the TGT the client's TGT method
+// returns. When set it is used in preference to the keytab.
+//
+// s := NewSettings(nil, User2User(cl))
+func User2User(cl *client.Client) func(*Settings) {
+	return func(s *Settings) {
+		s.keyProvider = user2UserKeyProvider{cl: cl}
+	}
+}
+
+// KeyHandleProvider returns the source of the service's long-term key handles, or nil if the service's keys are not
+// held by key handles.
+func (s *Settings) KeyHandleProvider() keytab.KeyHandleProvider {
+	hp, _ := s.KeyProvider().(keytab.KeyHandleProvider)
+	return hp
+}
+
 // MaxClockSkew used to configure service side with the maximum acceptable clock skew
 // between the service and the issue time of kerberos tickets
 //
@@ -161,3 +326,250 @@ type SessionMgr interface {
 	New(w http.ResponseWriter, r *http.Request, k string, v []byte) error
 	Get(r *http.Request, k string) ([]byte, error)
 }
+
+// PacketDump used to configure the service to write the Kerberos messages received from clients in SPNEGO tokens to
+// the writer provided, for example to provide the messages in an interoperability issue report. Each message is
+// written with a summary of its contents, its base64 encoding and a hex dump. The messages are not redacted.
+//
+// s := NewSettings(kt, PacketDump(os.Stderr))
+func PacketDump(w io.Writer) func(*Settings) {
+	return func(s *Settings) {
+		s.packetDump = w
+	}
+}
+
+// PacketDump returns the writer the service writes the Kerberos messages received from clients to, or nil if none is
+// configured.
+func (s *Settings) PacketDump() io.Writer {
+	return s.packetDump
+}
+
+// WarningHook used to configure the service with a hook called with warnings of weak or deprecated usage by the
+// tickets it accepts, such as tickets without a PAC or with a deprecated encryption type, so that hardening can be
+// monitored before it is enforced.
+//
+// s := NewSettings(kt, WarningHook(h))
+func WarningHook(h warning.Hook) func(*Settings) {
+	return func(s *Settings) {
+		s.warningHook = h
+	}
+}
+
+// WarningHook returns the hook the service calls with warnings, or nil if none is configured.
+func (s *Settings) WarningHook() warning.Hook {
+	return s.warningHook
+}
+
+// Clock used to configure the service with the clock used to check the validity of tickets and the clock skew with
+// clients, for example a clock.Fake to test expiry without sleeping. Unless a ReplayCacheBackend is configured the
+// service then uses its own replay cache, timed with the clock, rather than the Cache shared by the process.
+//
+// s := NewSettings(kt, Clock(c))
+func Clock(c clock.Clock) func(*Settings) {
+	return func(s *Settings) {
+		s.clock = c
+	}
+}
+
+// Clock returns the clock used by the service. If none is configured the system clock is returned.
+func (s *Settings) Clock() clock.Clock {
+	return clock.OrReal(s.clock)
+}
+
+// CorrelationID used to configure the service with the correlation ID of the authentication attempt whose AP_REQ it
+// verifies, such as the one a client sends with its request, which is then added to the log lines, audit events and
+// errors of the verification.
+//
+// s := NewSettings(kt, CorrelationID(id))
+func CorrelationID(id string) func(*Settings) {
+	return func(s *Settings) {
+		s.correlationID = id
+	}
+}
+
+// CorrelationID returns the correlation ID of the authentication attempt, or an empty string if it has none.
+func (s *Settings) CorrelationID() string {
+	return s.correlationID
+}
+
+// correlationIDOf returns the correlation ID of the authentication attempt, or otherwise that of the error.
+func (s *Settings) correlationIDOf(err error) string {
+	if s.correlationID != "" {
+		return s.correlationID
+	}
+	return krberror.CorrelationID(err)
+}
+
+// TicketPolicy used to configure the service to reject tickets that fail the policy, for example tickets with an
+// excessive lifetime or a deprecated encryption type. Rules on the PAC fail when PAC decoding is disabled.
+//
+// s := NewSettings(kt, TicketPolicy(p))
+func TicketPolicy(p *policy.Policy) func(*Settings) {
+	return func(s *Settings) {
+		s.ticketPolicy = p
+	}
+}
+
+// TicketPolicy returns the policy tickets are evaluated against, or nil if none is configured.
+func (s *Settings) TicketPolicy() *policy.Policy {
+	return s.ticketPolicy
+}
+
+// AuditHook used to configure the service with a hook called with an audit event for each AP_REQ verified, whether
+// the authentication succeeded or failed, for example a hook from audit.NewWriterHook.
+//
+// s := NewSettings(kt, AuditHook(audit.NewWriterHook(w, audit.CEF)))
+func AuditHook(h audit.Hook) func(*Settings) {
+	return func(s *Settings) {
+		s.auditHook = h
+	}
+}
+
+// AuditHook returns the hook the service calls with audit events, or nil if none is configured.
+func (s *Settings) AuditHook() audit.Hook {
+	return s.auditHook
+}
+
+// NTLMFallback used to configure the SPNEGO HTTP service to also accept the NTLMSSP mechanism, using the NTLM provider,
+// from clients that cannot use Kerberos, such as those that cannot reach the KDC or address the service by IP
+// address. gokrb5 does not implement NTLM itself.
+//
+// s := NewSettings(kt, NTLMFallback(a))
+func NTLMFallback(a NTLMAcceptor) func(*Settings) {
+	return func(s *Settings) {
+		s.ntlm = a
+	}
+}
+
+// NTLMFallback returns the NTLM provider the service accepts the NTLMSSP mechanism with, or nil if none is configured.
+func (s *Settings) NTLMFallback() NTLMAcceptor {
+	return s.ntlm
+}
+
+// NTLMAcceptor is implemented by NTLM providers performing the service side of the NTLMSSP mechanism ([MS-NLMP]).
+//
+// Accept processes an NTLM message from the client identified by its remote address, as the messages of an NTLM
+// authentication are sent over the same connection. It returns the CHALLENGE_MESSAGE answering a NEGOTIATE_MESSAGE.
+// Once an AUTHENTICATE_MESSAGE is verified it returns no message and the credentials of the authenticated user.
+type NTLMAcceptor interface {
+	Accept(remoteAddr string, msg []byte) ([]byte, *credentials.Credentials, error)
+}
+
+// ChannelBindings used to configure the channel bindings the service validates in the authenticator checksum of
+// AP_REQs, such as the gssapi.TLSServerEndPoint bindings of the service's TLS certificate. AP_REQs bound to other
+// channel bindings are rejected. AP_REQs without channel bindings are accepted unless RequireChannelBindings is set.
+//
+// s := NewSettings(kt, ChannelBindings(cb))
+func ChannelBindings(cb *gssapi.ChannelBindings) func(*Settings) {
+	return func(s *Settings) {
+		s.channelBindings = cb
+	}
+}
+
+// ChannelBindings returns the channel bindings the service validates, or nil if none are configured.
+func (s *Settings) ChannelBindings() *gssapi.ChannelBindings {
+	return s.channelBindings
+}
+
+// RequireChannelBindings used to configure the service to reject AP_REQs that are not bound to the channel bindings
+// configured with ChannelBindings, enforcing channel binding as Extended Protection for Authentication does.
+//
+// s := NewSettings(kt, ChannelBindings(cb), RequireChannelBindings(true))
+func RequireChannelBindings(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.requireBindings = b
+	}
+}
+
+// RequireChannelBindings indicates if the service requires AP_REQs to be bound to its channel bindings.
+func (s *Settings) RequireChannelBindings() bool {
+	return s.requireBindings
+}
+
+// ReplayCacheBackend used to configure the replay cache detecting replayed authenticators, such as a cache shared by
+// the instances of a load balanced service. By default the per process Cache returned by GetReplayCache is used.
+//
+// s := NewSettings(kt, ReplayCacheBackend(rc))
+func ReplayCacheBackend(rc ReplayCache) func(*Settings) {
+	return func(s *Settings) {
+		s.replayCache = rc
+	}
+}
+
+// ReplayCacheBackend returns the replay cache detecting replayed authenticators, which is the per process Cache if none
+// is configured.
+func (s *Settings) ReplayCacheBackend() ReplayCache {
+	if s.replayCache == nil {
+		return GetReplayCache(s.MaxClockSkew())
+	}
+	return s.replayCache
+}
+
+// Authorizer used to configure the SPNEGO HTTP service to authorize each request of an authenticated user before
+// serving the wrapped handler, for example by the group membership SIDs of the user's ADCredentials. Requests of users
+// that are not authorized are answered with the HTTP status returned by the function.
+//
+// s := NewSettings(kt, Authorizer(RequireAnyGroupSID("S-1-5-21-3167651404-3865080224-2280184895-1108")))
+func Authorizer(a AuthorizeFunc) func(*Settings) {
+	return func(s *Settings) {
+		s.authorizer = a
+	}
+}
+
+// Authorizer returns the function authorizing the requests of authenticated users, or nil if none is configured.
+func (s *Settings) Authorizer() AuthorizeFunc {
+	return s.authorizer
+}
+
+// SIDResolver used to configure the service to resolve the names of the user's SID and group membership SIDs from the
+// PAC, setting the SIDNames of the ADCredentials and adding the group names to the credentials' authorization
+// attributes. Authentication succeeds without the names if they cannot be resolved.
+//
+// s := NewSettings(kt, SIDResolver(r))
+func SIDResolver(r credentials.SIDResolver) func(*Settings) {
+	return func(s *Settings) {
+		s.sidResolver = r
+	}
+}
+
+// SIDResolver returns the resolver of the names of users' SIDs, or nil if none is configured.
+func (s *Settings) SIDResolver() credentials.SIDResolver {
+	return s.sidResolver
+}
+
+// IAKERBProxy used to configure the service to accept security contexts established with the IAKERB mechanism, proxying
+// the KDC exchanges that clients without a route to the KDCs tunnel through the context tokens to the KDCs of the realm
+// each names. The messages are sent with the client's configuration and settings, such as its KDC proxies, but not its
+// credentials.
+//
+// s := NewSettings(kt, IAKERBProxy(cl))
+func IAKERBProxy(cl *client.Client) func(*Settings) {
+	return func(s *Settings) {
+		s.iakerbProxy = cl
+	}
+}
+
+// IAKERBProxy returns the client proxying the KDC exchanges of IAKERB security contexts, or nil if the service does not
+// accept them.
+func (s *Settings) IAKERBProxy() *client.Client {
+	return s.iakerbProxy
+}
+
+// AuthorizeFunc authorizes the request of the authenticated user, returning whether it is allowed and, if it is not,
+// the HTTP status to answer it with. http.StatusForbidden is used if the status is zero.
+type AuthorizeFunc func(r *http.Request, id *credentials.Credentials) (allow bool, status int)
+
+// RequireAnyGroupSID returns an AuthorizeFunc allowing the requests of users that are members of any of the groups with
+// the SIDs, as listed in the GroupMembershipSIDs of their ADCredentials. Other requests are forbidden.
+func RequireAnyGroupSID(sids ...string) AuthorizeFunc {
+	return func(r *http.Request, id *credentials.Credentials) (bool, int) {
+		for _, g := range id.GetADCredentials().GroupMembershipSIDs {
+			for _, sid := range sids {
+				if g == sid {
+					return true, 0
+				}
+			}
+		}
+		return false, http.StatusForbidden
+	}
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireAnyGroupSID(t *testing.T) {
+	t.Parallel()
+	a := RequireAnyGroupSID("S-1-5-21-1-2-3-1108", "S-1-5-21-1-2-3-1109")
+	r, _ := http.NewRequest("GET", "http://www.example.com/", nil)
+	id := credentials.New("user1", "EXAMPLE.COM")
+	id.SetADCredentials(credentials.ADCredentials{GroupMembershipSIDs: []string{"S-1-5-21-1-2-3-513", "S-1-5-21-1-2-3-1109"}})
+	allow, _ := a(r, id)
+	assert.True(t, allow, "member of a group not allowed")
+	id.SetADCredentials(credentials.ADCredentials{GroupMembershipSIDs: []string{"S-1-5-21-1-2-3-513"}})
+	allow, status := a(r, id)
+	assert.False(t, allow, "user not a member of the groups allowed")
+	assert.Equal(t, http.StatusForbidden, status, "status not as expected")
+	allow, _ = a(r, credentials.New("user2", "EXAMPLE.COM"))
+	assert.False(t, allow, "user without AD credentials allowed")
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// user2UserKeyProvider provides the session key of the client's TGT to decrypt the user-to-user tickets issued to the
+// client's principal.
+type user2UserKeyProvider struct {
+	cl *client.Client
+}
+
+// GetEncryptionKey returns the session key of the client's current TGT if the ticket is for the client's principal
+// and of the session key's encryption type. The kvno of user-to-user tickets is always zero.
+func (p user2UserKeyProvider) GetEncryptionKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+	if !princName.Equal(p.cl.Credentials.CName()) || realm != p.cl.Credentials.Domain() {
+		return types.EncryptionKey{}, 0, fmt.Errorf("user-to-user ticket for %s@%s is not for the client %s@%s",
+			princName.PrincipalNameString(), realm, p.cl.Credentials.CName().PrincipalNameString(), p.cl.Credentials.Domain())
+	}
+	_, key, err := p.cl.TGT()
+	if err != nil {
+		return key, 0, fmt.Errorf("could not get the TGT of %s: %w", princName.PrincipalNameString(), err)
+	}
+	if key.KeyType != etype {
+		return types.EncryptionKey{}, 0, fmt.Errorf("TGT session key of %s has encryption type %d not %d", princName.PrincipalNameString(), key.KeyType, etype)
+	}
+	return key, 0, nil
+}
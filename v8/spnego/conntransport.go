@@ -0,0 +1,287 @@
+package spnego
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+)
+
+// hostAuth is how a host authenticates the requests of the ConnTransport.
+type hostAuth int
+
+const (
+	// hostAuthUnknown hosts have not challenged a request.
+	hostAuthUnknown hostAuth = iota
+	// hostAuthConn hosts keep the authentication of a connection for its subsequent requests.
+	hostAuthConn
+	// hostAuthRequest hosts challenge requests on authenticated connections so every request is authenticated.
+	hostAuthRequest
+)
+
+// ConnTransport is a SPNEGO enabled http.RoundTripper for services that authenticate the connection rather than each
+// request, as IIS does with authPersistNonNTLM, for use as the Transport of an http.Client. Once a host has challenged
+// a request, the first request on each new connection to it is sent with a token and the subsequent requests on the
+// connection are sent without one, so that an AP_REQ is only created once per connection. A host that challenges a
+// request on an authenticated connection does not keep its authentication and has a token sent with every request.
+//
+// The ConnTransport dials its own connections to track their authentication and only uses HTTP/1.1, as HTTP/2
+// multiplexes the requests of a connection.
+type ConnTransport struct {
+	client *client.Client
+	base   *http.Transport
+	dial   func(ctx context.Context, network, addr string) (net.Conn, error)
+	spn    string
+	mux    sync.Mutex
+	conns  map[net.Conn]bool
+	hosts  map[string]hostAuth
+}
+
+// NewConnTransport returns a SPNEGO enabled http.RoundTripper authenticating each connection once with the gokrb5
+// client, sending the requests with a copy of the base http.Transport, or http.DefaultTransport if nil. To auto
+// generate the SPN from each request pass a null string "", as with NewTransport.
+func NewConnTransport(cl *client.Client, base *http.Transport, spn string) *ConnTransport {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t := &ConnTransport{
+		client: cl,
+		base:   base.Clone(),
+		dial:   base.DialContext,
+		spn:    spn,
+		conns:  make(map[net.Conn]bool),
+		hosts:  make(map[string]hostAuth),
+	}
+	if t.dial == nil {
+		d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		t.dial = d.DialContext
+	}
+	t.base.DialContext = t.dialConn
+	t.base.DialTLSContext = t.dialTLSConn
+	if base.DialTLSContext != nil {
+		dialTLS := base.DialTLSContext
+		t.base.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			c, err := dialTLS(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return t.trackConn(c, nil), nil
+		}
+	}
+	t.base.ForceAttemptHTTP2 = false
+	t.base.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	return t
+}
+
+// RoundTrip implements the http.RoundTripper interface. The request is sent with a token if its connection has not
+// been authenticated by an earlier request to a host that has challenged the transport's requests, and otherwise
+// without one. If the service challenges the request, the request is sent again on a copy of the request with a
+// token. The request body is sent again as with Transport.
+func (t *ConnTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	req, err := replayableRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	resp, conn, authenticated, err := t.roundTrip(req, false)
+	if err != nil || !respUnauthorizedNegotiate(resp) || authenticated {
+		return resp, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	t.challenged(req.URL.Host, conn)
+	resp, _, _, err = t.roundTrip(req, true)
+	return resp, err
+}
+
+// roundTrip sends a copy of the request, setting a token once the connection it is sent on is known if the
+// connection needs authenticating or authenticate is true. It returns the response, the connection and whether the
+// request was sent with a token, in which case a connection that was not challenged is recorded as authenticated.
+func (t *ConnTransport) roundTrip(req *http.Request, authenticate bool) (*http.Response, net.Conn, bool, error) {
+	ar := req.Clone(req.Context())
+	if req.GetBody != nil {
+		var err error
+		if ar.Body, err = req.GetBody(); err != nil {
+			return nil, nil, false, fmt.Errorf("could not get request body to send again: %w", err)
+		}
+	}
+	var conn net.Conn
+	var authenticated bool
+	var terr error
+	trace := &httptrace.ClientTrace{
+		// GotConn is called for each connection the request is sent on, before the request is written.
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn = info.Conn
+			authenticated = false
+			ar.Header.Del(HTTPHeaderAuthRequest)
+			if !authenticate && !t.needsToken(ar.URL.Host, conn) {
+				return
+			}
+			terr = SetSPNEGOHeaderChannelBindings(ar.Context(), t.client, ar, redirectedSPN(ar, t.spn), connChannelBindings(conn))
+			authenticated = terr == nil
+		},
+	}
+	ar = ar.WithContext(httptrace.WithClientTrace(ar.Context(), trace))
+	resp, err := t.base.RoundTrip(ar)
+	if terr != nil {
+		if err == nil {
+			resp.Body.Close()
+		}
+		return nil, nil, false, terr
+	}
+	if err != nil {
+		return resp, nil, false, err
+	}
+	if authenticated && resp.StatusCode != http.StatusUnauthorized {
+		t.mux.Lock()
+		if _, ok := t.conns[conn]; ok {
+			t.conns[conn] = true
+		}
+		t.mux.Unlock()
+	}
+	return resp, conn, authenticated, nil
+}
+
+// needsToken returns whether a request to the host on the connection is to be sent with a token.
+func (t *ConnTransport) needsToken(host string, conn net.Conn) bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	switch t.hosts[host] {
+	case hostAuthConn:
+		return !t.conns[conn]
+	case hostAuthRequest:
+		return true
+	}
+	return false
+}
+
+// challenged records that the host challenged a request sent without a token on the connection. A host challenging a
+// request on an authenticated connection does not keep the authentication of its connections.
+func (t *ConnTransport) challenged(host string, conn net.Conn) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.conns[conn] {
+		t.hosts[host] = hostAuthRequest
+		t.conns[conn] = false
+		t.client.Log("%s does not keep the authentication of connections, authenticating every request", host)
+		return
+	}
+	if t.hosts[host] == hostAuthUnknown {
+		t.hosts[host] = hostAuthConn
+	}
+}
+
+// dialConn dials a connection with the base transport's dialer and tracks its authentication.
+func (t *ConnTransport) dialConn(ctx context.Context, network, addr string) (net.Conn, error) {
+	c, err := t.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.trackConn(c, nil), nil
+}
+
+// dialTLSConn dials a TLS connection with the base transport's dialer and TLS client configuration and tracks its
+// authentication. The TLS connection itself is returned so that responses have its connection state.
+func (t *ConnTransport) dialTLSConn(ctx context.Context, network, addr string) (net.Conn, error) {
+	raw, err := t.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{}
+	if t.base.TLSClientConfig != nil {
+		cfg = t.base.TLSClientConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		cfg.ServerName = host
+	}
+	tc := &trackedConn{Conn: raw, t: t}
+	c := tls.Client(tc, cfg)
+	deadline, _ := ctx.Deadline()
+	if d := t.base.TLSHandshakeTimeout; d > 0 && (deadline.IsZero() || time.Now().Add(d).Before(deadline)) {
+		deadline = time.Now().Add(d)
+	}
+	raw.SetDeadline(deadline)
+	if err := c.Handshake(); err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("TLS handshake with %s failed: %w", addr, err)
+	}
+	raw.SetDeadline(time.Time{})
+	t.trackConn(c, tc)
+	return c, nil
+}
+
+// trackConn records the connection as not authenticated until a request authenticates it. The connection is forgotten
+// once the tracked connection carrying it, which is created if nil, is closed.
+func (t *ConnTransport) trackConn(c net.Conn, tc *trackedConn) net.Conn {
+	if tc == nil {
+		tc = &trackedConn{Conn: c, t: t}
+		c = tc
+	}
+	tc.key = c
+	t.mux.Lock()
+	t.conns[c] = false
+	t.mux.Unlock()
+	return c
+}
+
+// forget removes the closed connection from those tracked.
+func (t *ConnTransport) forget(c net.Conn) {
+	t.mux.Lock()
+	delete(t.conns, c)
+	t.mux.Unlock()
+}
+
+// CloseIdleConnections closes the idle connections of the transport.
+func (t *ConnTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+// trackedConn is a connection dialed by the ConnTransport, which forgets the authentication of the connection it
+// carries once closed.
+type trackedConn struct {
+	net.Conn
+	t    *ConnTransport
+	key  net.Conn
+	once sync.Once
+}
+
+// Close the connection.
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.t.forget(c.key)
+	})
+	return c.Conn.Close()
+}
+
+// connChannelBindings returns the tls-server-end-point channel bindings of the TLS certificate of the connection, or
+// nil if it is not a TLS connection.
+func connChannelBindings(c net.Conn) *gssapi.ChannelBindings {
+	if tc, ok := c.(*trackedConn); ok {
+		c = tc.Conn
+	}
+	tc, ok := c.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	cs := tc.ConnectionState()
+	if len(cs.PeerCertificates) < 1 {
+		return nil
+	}
+	cb, err := gssapi.TLSServerEndPoint(cs.PeerCertificates[0])
+	if err != nil {
+		return nil
+	}
+	return cb
+}
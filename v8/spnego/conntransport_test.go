@@ -0,0 +1,105 @@
+package spnego
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConnAuthHandler returns a handler authenticating requests with SPNEGO, which keeps the authentication of a
+// connection for its subsequent requests if persist is true, counting the tokens accepted and the challenges sent.
+func testConnAuthHandler(kt *keytab.Keytab, persist bool, tokens, challenges *int32) http.Handler {
+	var mux sync.Mutex
+	authenticated := make(map[string]bool)
+	h := SPNEGOKRB5Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(tokens, 1)
+		mux.Lock()
+		authenticated[r.RemoteAddr] = persist
+		mux.Unlock()
+	}), kt, service.DecodePAC(false))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HTTPHeaderAuthRequest) == "" {
+			mux.Lock()
+			ok := authenticated[r.RemoteAddr]
+			mux.Unlock()
+			if ok {
+				return
+			}
+			atomic.AddInt32(challenges, 1)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// testGet sends a GET request to the URL, expecting it to succeed, and reads the response body so that the connection
+// is reused.
+func testGet(t *testing.T, httpCl *http.Client, url string) {
+	t.Helper()
+	resp, err := httpCl.Get(url)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+}
+
+func TestConnTransport(t *testing.T) {
+	t.Parallel()
+	kt, cl := testCCacheClient(t)
+	for _, useTLS := range []bool{false, true} {
+		var tokens, challenges int32
+		h := testConnAuthHandler(kt, true, &tokens, &challenges)
+		s := httptest.NewServer(h)
+		var base *http.Transport
+		if useTLS {
+			s.Close()
+			s = httptest.NewTLSServer(h)
+			base = s.Client().Transport.(*http.Transport)
+		}
+		tr := NewConnTransport(cl, base, "HTTP/host.test.gokrb5")
+		httpCl := &http.Client{Transport: tr}
+
+		// The connection is authenticated once, after the host's first challenge.
+		for i := 0; i < 3; i++ {
+			testGet(t, httpCl, s.URL)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&tokens), "the connection should be authenticated once")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&challenges), "only the first request should be challenged")
+
+		// A new connection is authenticated by its first request without a challenge.
+		tr.CloseIdleConnections()
+		tr.mux.Lock()
+		assert.Empty(t, tr.conns, "closed connections should be forgotten")
+		tr.mux.Unlock()
+		testGet(t, httpCl, s.URL)
+		testGet(t, httpCl, s.URL)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&tokens), "the new connection should be authenticated once")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&challenges), "the new connection should not be challenged")
+		s.Close()
+	}
+}
+
+func TestConnTransport_RequestAuth(t *testing.T) {
+	t.Parallel()
+	kt, cl := testCCacheClient(t)
+	var tokens, challenges int32
+	s := httptest.NewServer(testConnAuthHandler(kt, false, &tokens, &challenges))
+	defer s.Close()
+	httpCl := &http.Client{Transport: NewConnTransport(cl, nil, "HTTP/host.test.gokrb5")}
+
+	// The second request is challenged on the authenticated connection, after which every request has a token.
+	for i := 0; i < 3; i++ {
+		testGet(t, httpCl, s.URL)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&tokens), "every request should be authenticated")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&challenges), "requests should not be challenged once sent with a token")
+}
@@ -2,6 +2,7 @@ package spnego
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -31,6 +32,9 @@ import (
 type Client struct {
 	*http.Client
 	krb5Client *client.Client
+	initiator  Initiator
+	ntlm       NTLMInitiator
+	mutual     bool
 	spn        string
 	reqs       []*http.Request
 }
@@ -43,17 +47,39 @@ func (e redirectErr) Error() string {
 	return fmt.Sprintf("redirect to %v", e.reqTarget.URL)
 }
 
-type teeReadCloser struct {
-	io.Reader
-	io.Closer
-}
-
 // NewClient returns a SPNEGO enabled HTTP client.
 // Be careful when passing in the *http.Client if it is beginning reused in multiple calls to this function.
 // Ensure reuse of the provided *http.Client is for the same user as a session cookie may have been added to
 // http.Client's cookie jar.
 // Incorrect reuse of the provided *http.Client could lead to access to the wrong user's session.
 func NewClient(krb5Cl *client.Client, httpCl *http.Client, spn string) *Client {
+	return &Client{
+		Client:     prepareHTTPClient(httpCl),
+		krb5Client: krb5Cl,
+		spn:        spn,
+	}
+}
+
+// Initiator is implemented by sources of SPNEGO initiator tokens other than a gokrb5 client,
+// for example the Windows SSPI using the logged on user's credentials.
+//
+// InitSecContext returns the marshaled SPNEGO token to send to the service with the SPN provided.
+type Initiator interface {
+	InitSecContext(spn string) ([]byte, error)
+}
+
+// NewInitiatorClient returns a SPNEGO enabled HTTP client that obtains its tokens from the Initiator provided.
+// The same care should be taken when reusing the *http.Client as described for NewClient.
+func NewInitiatorClient(init Initiator, httpCl *http.Client, spn string) *Client {
+	return &Client{
+		Client:    prepareHTTPClient(httpCl),
+		initiator: init,
+		spn:       spn,
+	}
+}
+
+// prepareHTTPClient adds the cookie jar and redirect handling needed by the SPNEGO client.
+func prepareHTTPClient(httpCl *http.Client) *http.Client {
 	if httpCl == nil {
 		httpCl = &http.Client{}
 	}
@@ -72,21 +98,23 @@ func NewClient(krb5Cl *client.Client, httpCl *http.Client, spn string) *Client {
 		}
 		return redirectErr{reqTarget: req}
 	}
-	return &Client{
-		Client:     httpCl,
-		krb5Client: krb5Cl,
-		spn:        spn,
-	}
+	return httpCl
 }
 
 // Do is the SPNEGO enabled HTTP client's equivalent of the http.Client's Do method.
+//
+// A request challenged by the service is authenticated by sending it again with a token that completes the context in
+// that single request, so that the authentication does not depend on the connection the request is sent on, as with
+// HTTP/2 where a connection's requests are multiplexed. The request is only authenticated once: if the service
+// challenges the authenticated request again its response is returned, unless the service continues the negotiation
+// with an accept-incomplete NegTokenResp for Kerberos, as some gateways do. The request is then sent again with the
+// client's next token: a new Kerberos token if the service did not accept the client's and, for a client requesting
+// mutual authentication, its mechListMIC once the service's AP_REP has been verified. Tokens from an Initiator are not
+// continued.
 func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
-	var body bytes.Buffer
-	if req.Body != nil {
-		// Use a tee reader to capture any body sent in case we have to replay it again
-		teeR := io.TeeReader(req.Body, &body)
-		teeRC := teeReadCloser{teeR, req.Body}
-		req.Body = teeRC
+	// Capture any body sent in case we have to replay it again
+	if err := bufferBody(req); err != nil {
+		return nil, err
 	}
 	resp, err = c.Client.Do(req)
 	if err != nil {
@@ -100,27 +128,199 @@ func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
 				}
 				if req.Body != nil {
 					// Refresh the body reader so the body can be sent again
-					e.reqTarget.Body = ioutil.NopCloser(&body)
+					if e.reqTarget.Body, err = req.GetBody(); err != nil {
+						return nil, fmt.Errorf("could not get request body to send again: %w", err)
+					}
+					e.reqTarget.GetBody = req.GetBody
 				}
 				return c.Do(e.reqTarget)
 			}
 		}
 		return resp, err
 	}
-	if respUnauthorizedNegotiate(resp) {
-		err := SetSPNEGOHeader(c.krb5Client, req, c.spn)
+	if respUnauthorizedNegotiate(resp) && !negotiateRequest(req) {
+		var authenticate func([]byte) ([]byte, error)
+		var m *mutualAuth
+		cb := tlsChannelBindings(resp)
+		if c.initiator != nil {
+			err = SetInitiatorSPNEGOHeader(c.initiator, req, c.spn)
+		} else if c.mutual {
+			m, err = c.setMutualNegotiateHeader(req, cb)
+		} else {
+			authenticate, err = c.setNegotiateHeader(req, cb)
+		}
 		if err != nil {
 			return resp, err
 		}
+		if authenticate != nil && resp.ProtoMajor >= 2 {
+			return resp, ErrNTLMRequiresHTTP1
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
 		if req.Body != nil {
 			// Refresh the body reader so the body can be sent again
-			req.Body = ioutil.NopCloser(&body)
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("could not get request body to send again: %w", err)
+			}
+		}
+		if authenticate != nil {
+			return c.doNTLM(req, authenticate)
+		}
+		if m != nil {
+			resp, err = c.doNegotiate(req, m.next)
+			if err != nil {
+				return resp, err
+			}
+			if err := m.verify(resp); err != nil {
+				resp.Body.Close()
+				return nil, fmt.Errorf("mutual authentication failed: %w", err)
+			}
+			return resp, nil
+		}
+		if c.initiator != nil {
+			return c.Do(req)
+		}
+		return c.doNegotiate(req, c.krb5Continuation(req, cb))
+	}
+	return resp, err
+}
+
+// maxNegotiateLegs is the most times the client sends a request with its tokens, which is enough for a service to ask
+// for a new Kerberos token and then exchange the mechListMICs.
+const maxNegotiateLegs = 3
+
+// doNegotiate sends the request with the client's SPNEGO token and, while the service continues the negotiation in
+// an unauthorized response, sends it again with the client's next token until the next function returns none. The
+// body is sent again using the request's GetBody function.
+func (c *Client) doNegotiate(req *http.Request, next func(*NegTokenResp) (*SPNEGOToken, error)) (*http.Response, error) {
+	for legs := 1; ; legs++ {
+		resp, err := c.Do(req)
+		if err != nil || legs >= maxNegotiateLegs {
+			return resp, err
+		}
+		rt, ok := negotiateContinued(resp)
+		if !ok {
+			return resp, nil
+		}
+		st, err := next(rt)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if st == nil {
+			return resp, nil
 		}
 		io.Copy(ioutil.Discard, resp.Body)
 		resp.Body.Close()
-		return c.Do(req)
+		if err := setNegotiateToken(req, st); err != nil {
+			return nil, err
+		}
+		if req.Body != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("could not get request body to send again: %w", err)
+			}
+		}
 	}
-	return resp, err
+}
+
+// negotiateContinued returns the service's NegTokenResp if its response continues the negotiation of the Kerberos
+// mechanism, which it does with an unauthorized response that is accept-incomplete or requests the mechListMIC.
+func negotiateContinued(resp *http.Response) (*NegTokenResp, bool) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, false
+	}
+	s := strings.SplitN(resp.Header.Get(HTTPHeaderAuthResponse), " ", 2)
+	if len(s) != 2 || s[0] != HTTPHeaderAuthResponseValueKey {
+		return nil, false
+	}
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return nil, false
+	}
+	var st SPNEGOToken
+	if err := st.Unmarshal(b); err != nil || !st.Resp {
+		return nil, false
+	}
+	rt := st.NegTokenResp
+	if state := rt.State(); state != NegStateAcceptIncomplete && state != NegStateRequestMIC {
+		return nil, false
+	}
+	if len(rt.SupportedMech) > 0 && !IsKRB5Mech(rt.SupportedMech) {
+		return nil, false
+	}
+	return &rt, true
+}
+
+// krb5Continuation returns the function continuing the negotiation of the client's Kerberos token for the request,
+// which sends a new token, bound to the channel bindings if not nil, were the service to select Kerberos without
+// accepting the first. The client sends it once.
+func (c *Client) krb5Continuation(req *http.Request, cb *gssapi.ChannelBindings) func(*NegTokenResp) (*SPNEGOToken, error) {
+	var resent bool
+	return func(rt *NegTokenResp) (*SPNEGOToken, error) {
+		if resent || len(rt.ResponseToken) > 0 {
+			return nil, nil
+		}
+		resent = true
+		cl := c.krb5Client
+		spn := c.spn
+		if spn == "" {
+			var err error
+			if spn, err = requestSPN(req.Context(), cl, req); err != nil {
+				return nil, err
+			}
+		}
+		s := SPNEGOClient(cl, spn)
+		s.channelBindings = cb
+		ct, err := s.initSecContext(req.Context())
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize context: %w", err)
+		}
+		return &SPNEGOToken{
+			Resp: true,
+			NegTokenResp: NegTokenResp{
+				NegState:      asn1.Enumerated(NegStateAcceptIncomplete),
+				ResponseToken: ct.(*SPNEGOToken).NegTokenInit.MechTokenBytes,
+			},
+		}, nil
+	}
+}
+
+// bufferBody reads the body of the request into memory, unless it can be obtained again with the request's GetBody
+// function, and sets GetBody so that the body can be sent again once the request is authenticated. It is read up front
+// as a service may answer the request with its challenge before reading the body, and so that the HTTP/2 transport
+// can also retry the request on another connection.
+func bufferBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody != nil {
+		return nil
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return fmt.Errorf("could not read request body: %w", err)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	return nil
+}
+
+// negotiateRequest indicates if the request was sent with a SPNEGO authorization header.
+func negotiateRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get(HTTPHeaderAuthRequest), HTTPHeaderAuthResponseValueKey+" ")
+}
+
+// tlsChannelBindings returns the tls-server-end-point channel bindings of the TLS certificate the response was received
+// with, or nil if it was not received over TLS.
+func tlsChannelBindings(resp *http.Response) *gssapi.ChannelBindings {
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) < 1 {
+		return nil
+	}
+	cb, err := gssapi.TLSServerEndPoint(resp.TLS.PeerCertificates[0])
+	if err != nil {
+		return nil
+	}
+	return cb
 }
 
 // Get is the SPNEGO enabled HTTP client's equivalent of the http.Client's Get method.
@@ -156,10 +356,16 @@ func (c *Client) Head(url string) (resp *http.Response, err error) {
 	return c.Do(req)
 }
 
+// respUnauthorizedNegotiate indicates if the service challenged the request to authenticate with SPNEGO, which it may
+// do alongside challenges for other schemes as IIS does with NTLM.
 func respUnauthorizedNegotiate(resp *http.Response) bool {
 	if resp.StatusCode == http.StatusUnauthorized {
-		if resp.Header.Get(HTTPHeaderAuthResponse) == HTTPHeaderAuthResponseValueKey {
-			return true
+		for _, v := range resp.Header.Values(HTTPHeaderAuthResponse) {
+			for _, c := range strings.Split(v, ",") {
+				if strings.TrimSpace(c) == HTTPHeaderAuthResponseValueKey {
+					return true
+				}
+			}
 		}
 	}
 	return false
@@ -193,29 +399,99 @@ func setRequestSPN(r *http.Request) (types.PrincipalName, error) {
 	return types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/"+h), nil
 }
 
+// requestSPN returns the SPN of the service of the request. If the client has an SPNDiscovery resolver the candidate
+// SPNs it returns for the request's host are tried in turn, obtaining the ticket for the first the KDC knows. Otherwise
+// the SPN is formed from the canonical name of the host.
+func requestSPN(ctx context.Context, cl *client.Client, r *http.Request) (string, error) {
+	if cl.SPNDiscovery() == nil {
+		pn, err := setRequestSPN(r)
+		if err != nil {
+			return "", err
+		}
+		return pn.PrincipalNameString(), nil
+	}
+	if err := cl.AffirmLoginContext(ctx); err != nil {
+		return "", fmt.Errorf("could not acquire client credential: %w", err)
+	}
+	_, _, spn, err := cl.GetServiceTicketForHost(ctx, "HTTP", strings.TrimSuffix(r.URL.Hostname(), "."))
+	if err != nil {
+		return "", fmt.Errorf("could not get service ticket for host %s: %w", r.URL.Hostname(), err)
+	}
+	return spn, nil
+}
+
 // SetSPNEGOHeader gets the service ticket and sets it as the SPNEGO authorization header on HTTP request object.
 // To auto generate the SPN from the request object pass a null string "".
 func SetSPNEGOHeader(cl *client.Client, r *http.Request, spn string) error {
+	return SetSPNEGOHeaderContext(context.Background(), cl, r, spn)
+}
+
+// SetSPNEGOHeaderContext gets the service ticket and sets it as the SPNEGO authorization header on HTTP request
+// object, as SetSPNEGOHeader does. The exchanges with the KDC to get the ticket are abandoned if the context is done
+// before they complete.
+func SetSPNEGOHeaderContext(ctx context.Context, cl *client.Client, r *http.Request, spn string) error {
+	return SetSPNEGOHeaderChannelBindings(ctx, cl, r, spn, nil)
+}
+
+// SetSPNEGOHeaderChannelBindings gets the service ticket and sets it as the SPNEGO authorization header on HTTP request
+// object, as SetSPNEGOHeaderContext does, binding the security context to the channel bindings provided, such as the
+// gssapi.TLSServerEndPoint bindings of the service's TLS certificate. Nil channel bindings bind to no channel.
+func SetSPNEGOHeaderChannelBindings(ctx context.Context, cl *client.Client, r *http.Request, spn string, cb *gssapi.ChannelBindings) error {
+	return krberror.WithCorrelationID(setSPNEGOHeader(ctx, cl, r, spn, cb), cl.CorrelationID())
+}
+
+func setSPNEGOHeader(ctx context.Context, cl *client.Client, r *http.Request, spn string, cb *gssapi.ChannelBindings) error {
 	if spn == "" {
-		pn, err := setRequestSPN(r)
-		if err != nil {
+		var err error
+		if spn, err = requestSPN(ctx, cl, r); err != nil {
 			return err
 		}
-		spn = pn.PrincipalNameString()
 	}
 	cl.Log("using SPN %s", spn)
+	nb, err := clientToken(ctx, cl, spn, cb)
+	if err != nil {
+		return err
+	}
+	hs := "Negotiate " + base64.StdEncoding.EncodeToString(nb)
+	r.Header.Set(HTTPHeaderAuthRequest, hs)
+	if id := cl.CorrelationID(); id != "" {
+		r.Header.Set(HTTPHeaderCorrelationID, id)
+	}
+	return nil
+}
+
+// clientToken returns the marshaled SPNEGO token for the SPN from the client, bound to the channel bindings if not nil.
+func clientToken(ctx context.Context, cl *client.Client, spn string, cb *gssapi.ChannelBindings) ([]byte, error) {
 	s := SPNEGOClient(cl, spn)
-	err := s.AcquireCred()
+	s.channelBindings = cb
+	err := s.acquireCred(ctx)
 	if err != nil {
-		return fmt.Errorf("could not acquire client credential: %v", err)
+		return nil, fmt.Errorf("could not acquire client credential: %w", err)
 	}
-	st, err := s.InitSecContext()
+	st, err := s.initSecContext(ctx)
 	if err != nil {
-		return fmt.Errorf("could not initialize context: %v", err)
+		return nil, fmt.Errorf("could not initialize context: %w", err)
 	}
 	nb, err := st.Marshal()
 	if err != nil {
-		return krberror.Errorf(err, krberror.EncodingError, "could not marshal SPNEGO")
+		return nil, krberror.Errorf(err, krberror.EncodingError, "could not marshal SPNEGO")
+	}
+	return nb, nil
+}
+
+// SetInitiatorSPNEGOHeader sets the token from the Initiator as the SPNEGO authorization header on HTTP request object.
+// To auto generate the SPN from the request object pass a null string "".
+func SetInitiatorSPNEGOHeader(init Initiator, r *http.Request, spn string) error {
+	if spn == "" {
+		pn, err := setRequestSPN(r)
+		if err != nil {
+			return err
+		}
+		spn = pn.PrincipalNameString()
+	}
+	nb, err := init.InitSecContext(spn)
+	if err != nil {
+		return fmt.Errorf("could not initialize context: %w", err)
 	}
 	hs := "Negotiate " + base64.StdEncoding.EncodeToString(nb)
 	r.Header.Set(HTTPHeaderAuthRequest, hs)
@@ -241,29 +517,49 @@ const (
 	HTTPHeaderAuthResponse = "WWW-Authenticate"
 	// HTTPHeaderAuthResponseValueKey is the key in the auth header for SPNEGO.
 	HTTPHeaderAuthResponseValueKey = "Negotiate"
+	// HTTPHeaderCorrelationID is the header holding the correlation ID of the client's authentication attempt.
+	HTTPHeaderCorrelationID = "X-Correlation-ID"
 	// UnauthorizedMsg is the message returned in the body when authentication fails.
 	UnauthorizedMsg = "Unauthorised.\n"
 )
 
 // SPNEGOKRB5Authenticate is a Kerberos SPNEGO authentication HTTP handler wrapper.
+//
+// A client offering Kerberos V5 without a token for it, as it sends none or its optimistic token is for a mechanism it
+// prefers such as NEGOEX, is answered with an accept-incomplete NegTokenResp selecting Kerberos and authenticated by
+// the request it sends next with its Kerberos token in a NegTokenResp. As the handler keeps no state between requests
+// the mechListMIC RFC 4178 then requires is not exchanged.
+//
+// Each request is authenticated on its own, by its SPNEGO token or the session of the session manager, never by the
+// connection it is received on, so the handler can be served over HTTP/2 where the requests of one or, behind a proxy,
+// several clients are multiplexed on a connection. A Kerberos token completes the context in the request it is sent
+// with. As the authenticator of each token is checked against the replay cache, clients sending concurrent requests
+// must send each with its own token, or use a session, rather than the same token on several requests. NTLM fallback,
+// which authenticates the connection, is refused over HTTP/2.
 func SPNEGOKRB5Authenticate(inner http.Handler, kt *keytab.Keytab, settings ...func(*service.Settings)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set up the SPNEGO GSS-API mechanism
-		var spnego *SPNEGO
+		var o []func(*service.Settings)
+		if id := requestCorrelationID(r); id != "" {
+			o = append(o, service.CorrelationID(id))
+		}
 		h, err := types.GetHostAddress(r.RemoteAddr)
 		if err == nil {
-			// put in this order so that if the user provides a ClientAddress it will override the one here.
-			o := append([]func(*service.Settings){service.ClientAddress(h)}, settings...)
-			spnego = SPNEGOService(kt, o...)
-		} else {
-			spnego = SPNEGOService(kt, settings...)
+			o = append(o, service.ClientAddress(h))
+		}
+		// put in this order so that if the user provides a ClientAddress it will override the one here.
+		spnego := SPNEGOService(kt, append(o, settings...)...)
+		if err != nil {
 			spnego.Log("%s - SPNEGO could not parse client address: %v", r.RemoteAddr, err)
 		}
 
 		// Check if there is a session manager and if there is an already established session for this client
 		id, err := getSessionCredentials(spnego, r)
-		if err == nil && id.Authenticated() {
+		if err == nil && id.Authenticated() && !id.Expired() {
 			// There is an established session so bypass auth and serve
+			if !authorize(spnego, w, r, &id) {
+				return
+			}
 			spnego.Log("%s - SPNEGO request served under session %s", r.RemoteAddr, id.SessionID())
 			inner.ServeHTTP(w, goidentity.AddToHTTPRequestContext(&id, r))
 			return
@@ -275,6 +571,14 @@ func SPNEGOKRB5Authenticate(inner http.Handler, kt *keytab.Keytab, settings ...f
 			return
 		}
 
+		// Hand NTLM tokens to the NTLM provider if NTLM fallback is configured
+		if a := spnego.serviceSettings.NTLMFallback(); a != nil {
+			if msg, ok := ntlmToken(st); ok {
+				acceptNTLM(spnego, a, inner, w, r, msg)
+				return
+			}
+		}
+
 		// Validate the context token
 		authed, ctx, status := spnego.AcceptSecContext(st)
 		if status.Code != gssapi.StatusComplete && status.Code != gssapi.StatusContinueNeeded {
@@ -282,19 +586,33 @@ func SPNEGOKRB5Authenticate(inner http.Handler, kt *keytab.Keytab, settings ...f
 			return
 		}
 		if status.Code == gssapi.StatusContinueNeeded {
-			spnegoNegotiateKRB5MechType(spnego, w, "%s - SPNEGO GSS-API continue needed", r.RemoteAddr)
+			spnegoNegotiateKRB5Mech(spnego, w, st, "%s - SPNEGO GSS-API continue needed", r.RemoteAddr)
 			return
 		}
 
 		if authed {
 			// Authentication successful; get user's credentials from the context
 			id := ctx.Value(ctxCredentials).(*credentials.Credentials)
+			if !authorize(spnego, w, r, id) {
+				return
+			}
 			// Create a new session if a session manager has been configured
 			err = newSession(spnego, r, w, id)
 			if err != nil {
 				return
 			}
-			spnegoResponseAcceptCompleted(spnego, w, "%s %s@%s - SPNEGO authentication succeeded", r.RemoteAddr, id.UserName(), id.Domain())
+			// Authenticate the service to the client with an AP_REP if mutual authentication was requested
+			hs, err := mutualAuthResponse(st)
+			if err != nil {
+				spnegoInternalServerError(spnego, w, "SPNEGO could not create AP_REP: %v", err)
+				return
+			}
+			if hs != "" {
+				w.Header().Set(HTTPHeaderAuthResponse, hs)
+				spnego.Log("%s %s@%s - SPNEGO mutual authentication succeeded", r.RemoteAddr, id.UserName(), id.Domain())
+			} else {
+				spnegoResponseAcceptCompleted(spnego, w, "%s %s@%s - SPNEGO authentication succeeded", r.RemoteAddr, id.UserName(), id.Domain())
+			}
 			// Add the identity to the context and serve the inner/wrapped handler
 			inner.ServeHTTP(w, goidentity.AddToHTTPRequestContext(id, r))
 			return
@@ -317,7 +635,7 @@ func getAuthorizationNegotiationHeaderAsSPNEGOToken(spnego *SPNEGO, r *http.Requ
 	// Decode the header into an SPNEGO context token
 	b, err := base64.StdEncoding.DecodeString(s[1])
 	if err != nil {
-		err = fmt.Errorf("error in base64 decoding negotiation header: %v", err)
+		err = fmt.Errorf("error in base64 decoding negotiation header: %w", err)
 		spnegoNegotiateKRB5MechType(spnego, w, "%s - SPNEGO %v", r.RemoteAddr, err)
 		return nil, err
 	}
@@ -327,12 +645,13 @@ func getAuthorizationNegotiationHeaderAsSPNEGOToken(spnego *SPNEGO, r *http.Requ
 		// Check if this is a raw KRB5 context token - issue #347.
 		var k5t KRB5Token
 		if k5t.Unmarshal(b) != nil {
-			err = fmt.Errorf("error in unmarshaling SPNEGO token: %v", err)
+			err = fmt.Errorf("error in unmarshaling SPNEGO token: %w", err)
 			spnegoNegotiateKRB5MechType(spnego, w, "%s - SPNEGO %v", r.RemoteAddr, err)
 			return nil, err
 		}
 		// Wrap it into an SPNEGO context token
 		st.Init = true
+		st.rawKRB5 = true
 		st.NegTokenInit = NegTokenInit{
 			MechTypes:      []asn1.ObjectIdentifier{k5t.OID},
 			MechTokenBytes: b,
@@ -341,17 +660,36 @@ func getAuthorizationNegotiationHeaderAsSPNEGOToken(spnego *SPNEGO, r *http.Requ
 	return &st, nil
 }
 
+// maxCorrelationIDLen is the longest correlation ID accepted from a request.
+const maxCorrelationIDLen = 128
+
+// requestCorrelationID returns the correlation ID the client sent with the request in the HTTPHeaderCorrelationID
+// header. IDs that are too long or hold characters other than printable ASCII are ignored so that a client cannot
+// forge the log lines and audit events they are added to.
+func requestCorrelationID(r *http.Request) string {
+	id := r.Header.Get(HTTPHeaderCorrelationID)
+	if len(id) > maxCorrelationIDLen {
+		return ""
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return ""
+		}
+	}
+	return id
+}
+
 func getSessionCredentials(spnego *SPNEGO, r *http.Request) (credentials.Credentials, error) {
 	var creds credentials.Credentials
 	// Check if there is a session manager and if there is an already established session for this client
 	if sm := spnego.serviceSettings.SessionManager(); sm != nil {
 		cb, err := sm.Get(r, sessionCredentials)
 		if err != nil || cb == nil || len(cb) < 1 {
-			return creds, fmt.Errorf("%s - SPNEGO error getting session and credentials for request: %v", r.RemoteAddr, err)
+			return creds, fmt.Errorf("%s - SPNEGO error getting session and credentials for request: %w", r.RemoteAddr, err)
 		}
 		err = creds.Unmarshal(cb)
 		if err != nil {
-			return creds, fmt.Errorf("%s - SPNEGO credentials malformed in session: %v", r.RemoteAddr, err)
+			return creds, fmt.Errorf("%s - SPNEGO credentials malformed in session: %w", r.RemoteAddr, err)
 		}
 		return creds, nil
 	}
@@ -376,6 +714,25 @@ func newSession(spnego *SPNEGO, r *http.Request, w http.ResponseWriter, id *cred
 	return nil
 }
 
+// authorize authorizes the request of the authenticated user with the authorizer configured, answering it with the
+// status returned if it is not allowed.
+func authorize(spnego *SPNEGO, w http.ResponseWriter, r *http.Request, id *credentials.Credentials) bool {
+	a := spnego.serviceSettings.Authorizer()
+	if a == nil {
+		return true
+	}
+	allow, status := a(r, id)
+	if allow {
+		return true
+	}
+	if status == 0 {
+		status = http.StatusForbidden
+	}
+	spnego.Log("%s %s@%s - SPNEGO request not authorized", r.RemoteAddr, id.UserName(), id.Domain())
+	http.Error(w, http.StatusText(status), status)
+	return false
+}
+
 // Log and respond to client for error conditions
 
 func spnegoNegotiateKRB5MechType(s *SPNEGO, w http.ResponseWriter, format string, v ...interface{}) {
@@ -384,6 +741,24 @@ func spnegoNegotiateKRB5MechType(s *SPNEGO, w http.ResponseWriter, format string
 	http.Error(w, UnauthorizedMsg, http.StatusUnauthorized)
 }
 
+// spnegoNegotiateKRB5Mech responds to the client to continue the negotiation with a Kerberos token for the Kerberos V5
+// mechanism OID selected from those its NegTokenInit offers.
+func spnegoNegotiateKRB5Mech(s *SPNEGO, w http.ResponseWriter, st *SPNEGOToken, format string, v ...interface{}) {
+	mech, _, ok := KRB5Mech(st.NegTokenInit.MechTypes)
+	if !st.Init || !ok || mech.Equal(gssapi.OIDKRB5.OID()) {
+		spnegoNegotiateKRB5MechType(s, w, format, v...)
+		return
+	}
+	h, err := negTokenRespHeader(NegStateAcceptIncomplete, mech, nil)
+	if err != nil {
+		spnegoInternalServerError(s, w, "SPNEGO could not marshal response: %v", err)
+		return
+	}
+	s.Log(format, v...)
+	w.Header().Set(HTTPHeaderAuthResponse, h)
+	http.Error(w, UnauthorizedMsg, http.StatusUnauthorized)
+}
+
 func spnegoResponseReject(s *SPNEGO, w http.ResponseWriter, format string, v ...interface{}) {
 	s.Log(format, v...)
 	w.Header().Set(HTTPHeaderAuthResponse, spnegoNegTokenRespReject)
@@ -15,17 +15,26 @@ import (
 	"net/http/cookiejar"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gorilla/sessions"
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/goidentity/v6"
 	"github.com/jcmturner/gokrb5/v8/client"
 	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/service"
 	"github.com/jcmturner/gokrb5/v8/test"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -124,6 +133,129 @@ func TestSPNEGOHTTPClient(t *testing.T) {
 	}
 }
 
+type testInitiator struct {
+	spn string
+}
+
+func (i *testInitiator) InitSecContext(spn string) ([]byte, error) {
+	i.spn = spn
+	return []byte("token"), nil
+}
+
+func TestNewInitiatorClient(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HTTPHeaderAuthRequest) != "Negotiate "+base64.StdEncoding.EncodeToString([]byte("token")) {
+			w.Header().Set(HTTPHeaderAuthResponse, HTTPHeaderAuthResponseValueKey)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "authenticated")
+	}))
+	defer s.Close()
+	init := new(testInitiator)
+	cl := NewInitiatorClient(init, nil, "HTTP/host.test.gokrb5")
+	resp, err := cl.Get(s.URL)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	assert.Equal(t, "HTTP/host.test.gokrb5", init.spn, "SPN passed to initiator not as expected")
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "authenticated", string(b), "response body not as expected")
+}
+
+func TestInitiatorClient_HTTP2(t *testing.T) {
+	t.Parallel()
+	var reqs int32
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reqs, 1)
+		if r.ProtoMajor != 2 {
+			http.Error(w, "not HTTP/2", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		// Challenge without reading the body, as services may do.
+		if r.Header.Get(HTTPHeaderAuthRequest) != "Negotiate "+base64.StdEncoding.EncodeToString([]byte("token")) ||
+			r.URL.Path == "/always" {
+			w.Header().Add(HTTPHeaderAuthResponse, "NTLM")
+			w.Header().Add(HTTPHeaderAuthResponse, HTTPHeaderAuthResponseValueKey)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "authenticated %s", b)
+	}))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	defer s.Close()
+
+	cl := NewInitiatorClient(new(testInitiator), s.Client(), "HTTP/host.test.gokrb5")
+	// A body that cannot be obtained again with GetBody.
+	req, _ := http.NewRequest("POST", s.URL, ioutil.NopCloser(strings.NewReader("body")))
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "authenticated body", string(b), "request body not sent again")
+
+	// A service challenging the authenticated request again is not sent the request a third time.
+	atomic.StoreInt32(&reqs, 0)
+	resp, err = cl.Get(s.URL + "/always")
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "status code not as expected")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&reqs), "number of requests sent not as expected")
+}
+
+func TestRespUnauthorizedNegotiate(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		status    int
+		headers   []string
+		negotiate bool
+	}{
+		{http.StatusUnauthorized, []string{"Negotiate"}, true},
+		{http.StatusUnauthorized, []string{"NTLM", "Negotiate"}, true},
+		{http.StatusUnauthorized, []string{"Basic realm=\"test\", Negotiate"}, true},
+		{http.StatusUnauthorized, []string{spnegoNegTokenRespReject}, false},
+		{http.StatusUnauthorized, []string{"NTLM"}, false},
+		{http.StatusForbidden, []string{"Negotiate"}, false},
+	}
+	for i, test := range tests {
+		resp := &http.Response{StatusCode: test.status, Header: make(http.Header)}
+		for _, h := range test.headers {
+			resp.Header.Add(HTTPHeaderAuthResponse, h)
+		}
+		assert.Equal(t, test.negotiate, respUnauthorizedNegotiate(resp), "test %d: challenge not detected as expected", i)
+	}
+}
+
+func TestRequestCorrelationID(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		header string
+		id     string
+	}{
+		{"", ""},
+		{"attempt-1", "attempt-1"},
+		{strings.Repeat("a", maxCorrelationIDLen), strings.Repeat("a", maxCorrelationIDLen)},
+		{strings.Repeat("a", maxCorrelationIDLen+1), ""},
+		{"attempt 1", ""},
+		{"attempt-1\nforged", ""},
+		{"attempt-\u00e9", ""},
+	}
+	for i, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.header != "" {
+			r.Header.Set(HTTPHeaderCorrelationID, test.header)
+		}
+		assert.Equal(t, test.id, requestCorrelationID(r), "test %d: correlation ID not as expected", i)
+	}
+}
+
 func TestService_SPNEGOKRB_NoAuthHeader(t *testing.T) {
 	s := httpServer()
 	defer s.Close()
@@ -439,3 +571,210 @@ func (smgr SessionMgr) New(w http.ResponseWriter, r *http.Request, k string, v [
 	s.Values[k] = v
 	return s.Save(r, w)
 }
+
+// testCCacheClient returns the service keytab and a client holding the service ticket for HTTP/host.test.gokrb5 in its
+// cache, so that it creates its tokens without a KDC.
+func testCCacheClient(t *testing.T) (*keytab.Keytab, *client.Client) {
+	t.Helper()
+	kt, cl, tkt, key := testTemplateTicket(t)
+	b, err := tkt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling ticket: %v", err)
+	}
+	now := time.Now().UTC()
+	cname := cl.Credentials.CName()
+	cc := credentials.NewCCache(cname, "TEST.GOKRB5")
+	for _, sname := range []types.PrincipalName{
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		tkt.SName,
+	} {
+		cred := credentials.NewCredential(cname, "TEST.GOKRB5", sname, "TEST.GOKRB5")
+		cred.Key = key
+		cred.AuthTime = now
+		cred.StartTime = now
+		cred.EndTime = now.Add(time.Hour)
+		cred.Ticket = b
+		cc.AddCredential(cred)
+	}
+	ccl, err := client.NewFromCCache(cc, config.New())
+	if err != nil {
+		t.Fatalf("error creating client from ccache: %v", err)
+	}
+	return kt, ccl
+}
+
+// testNegotiateHeader returns the Negotiate header value of the SPNEGO token.
+func testNegotiateHeader(t *testing.T, st SPNEGOToken) string {
+	t.Helper()
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling SPNEGO token: %v", err)
+	}
+	return HTTPHeaderAuthResponseValueKey + " " + base64.StdEncoding.EncodeToString(b)
+}
+
+// testRequestToken returns the SPNEGO token of the request's authorization header, if it has one.
+func testRequestToken(r *http.Request) (SPNEGOToken, bool) {
+	var st SPNEGOToken
+	s := strings.SplitN(r.Header.Get(HTTPHeaderAuthRequest), " ", 2)
+	if len(s) != 2 || s[0] != HTTPHeaderAuthResponseValueKey {
+		return st, false
+	}
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return st, false
+	}
+	return st, st.Unmarshal(b) == nil
+}
+
+func TestService_SPNEGOKRB_MultiLeg(t *testing.T) {
+	t.Parallel()
+	kt, cl, tkt, key := testTemplateTicket(t)
+	s := httptest.NewServer(SPNEGOKRB5Authenticate(http.HandlerFunc(testAppHandler), kt, service.DecodePAC(false)))
+	defer s.Close()
+
+	// The client prefers another mechanism so the service selects Kerberos and asks for its token.
+	negoex := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 30}
+	r, _ := http.NewRequest("GET", s.URL, nil)
+	r.Header.Set(HTTPHeaderAuthRequest, testNegotiateHeader(t, SPNEGOToken{
+		Init: true,
+		NegTokenInit: NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{negoex, gssapi.OIDMSLegacyKRB5.OID(), gssapi.OIDKRB5.OID()},
+			MechTokenBytes: []byte{0x01},
+		},
+	}))
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "status code not as expected")
+	rt, ok := negotiateContinued(resp)
+	if !ok {
+		t.Fatalf("service did not continue the negotiation: %q", resp.Header.Get(HTTPHeaderAuthResponse))
+	}
+	assert.True(t, rt.SupportedMech.Equal(gssapi.OIDMSLegacyKRB5.OID()), "supportedMech not as expected")
+	assert.Empty(t, rt.ResponseToken, "no response token should be returned")
+
+	// The client continues with its Kerberos token in a NegTokenResp that does not name the mechanism.
+	mt, err := NewKRB5TokenAPREQ(cl, tkt, key, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, []int{})
+	if err != nil {
+		t.Fatalf("error creating KRB5 token: %v", err)
+	}
+	mtb, err := mt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB5 token: %v", err)
+	}
+	r, _ = http.NewRequest("GET", s.URL, nil)
+	r.Header.Set(HTTPHeaderAuthRequest, testNegotiateHeader(t, SPNEGOToken{
+		Resp: true,
+		NegTokenResp: NegTokenResp{
+			NegState:      asn1.Enumerated(NegStateAcceptIncomplete),
+			ResponseToken: mtb,
+		},
+	}))
+	resp, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code of continued negotiation not as expected")
+}
+
+func TestClient_MultiLeg(t *testing.T) {
+	t.Parallel()
+	kt, cl := testCCacheClient(t)
+	h := SPNEGOKRB5Authenticate(http.HandlerFunc(testAppHandler), kt, service.DecodePAC(false))
+	var continued int32
+	// The gateway does not accept the client's first token and asks it for another.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if st, ok := testRequestToken(r); ok && st.Init {
+			atomic.AddInt32(&continued, 1)
+			w.Header().Set(HTTPHeaderAuthResponse, testNegotiateHeader(t, SPNEGOToken{
+				Resp: true,
+				NegTokenResp: NegTokenResp{
+					NegState:      asn1.Enumerated(NegStateAcceptIncomplete),
+					SupportedMech: gssapi.OIDKRB5.OID(),
+				},
+			}))
+			http.Error(w, UnauthorizedMsg, http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	for _, c := range []*Client{
+		NewClient(cl, nil, "HTTP/host.test.gokrb5"),
+		NewMutualAuthClient(cl, nil, "HTTP/host.test.gokrb5"),
+	} {
+		resp, err := c.Get(s.URL)
+		if err != nil {
+			t.Fatalf("request error: %v", err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&continued), "each client should have been asked for another token")
+}
+
+func TestMutualAuthClient_MechListMIC(t *testing.T) {
+	t.Parallel()
+	kt, cl := testCCacheClient(t)
+	mechs := []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()}
+	var sc *gssapi.SecurityContext
+	// The gateway replies to the client's AP_REQ with its AP_REP and mechListMIC and waits for the client's.
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st, ok := testRequestToken(r)
+		switch {
+		case ok && st.Init:
+			var mt KRB5Token
+			if err := mt.Unmarshal(st.NegTokenInit.MechTokenBytes); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if ok, _, err := service.VerifyAPREQ(&mt.APReq, service.NewSettings(kt, service.DecodePAC(false))); !ok {
+				http.Error(w, fmt.Sprintf("AP_REQ not valid: %v", err), http.StatusBadRequest)
+				return
+			}
+			auth := mt.APReq.Authenticator
+			rep, err := messages.NewAPRep(auth, mt.APReq.Ticket.DecryptedEncPart.Key, types.EncryptionKey{}, auth.SeqNumber)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			rt := NewKRB5TokenAPREP(rep)
+			rb, _ := rt.Marshal()
+			key := mt.APReq.Ticket.DecryptedEncPart.Key
+			if auth.SubKey.KeyType != 0 {
+				key = auth.SubKey
+			}
+			sc = gssapi.NewSecurityContext(key, true, false, uint64(auth.SeqNumber))
+			sc.ExpectSequence(uint64(auth.SeqNumber))
+			mic, _ := MechListMIC(sc, mechs)
+			w.Header().Set(HTTPHeaderAuthResponse, testNegotiateHeader(t, SPNEGOToken{
+				Resp: true,
+				NegTokenResp: NegTokenResp{
+					NegState:      asn1.Enumerated(NegStateAcceptIncomplete),
+					SupportedMech: gssapi.OIDKRB5.OID(),
+					ResponseToken: rb,
+					MechListMIC:   mic,
+				},
+			}))
+			http.Error(w, UnauthorizedMsg, http.StatusUnauthorized)
+		case ok && st.Resp && sc != nil && VerifyMechListMIC(sc, mechs, st.NegTokenResp.MechListMIC) == nil:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set(HTTPHeaderAuthResponse, HTTPHeaderAuthResponseValueKey)
+			http.Error(w, UnauthorizedMsg, http.StatusUnauthorized)
+		}
+	}))
+	defer s.Close()
+
+	resp, err := NewMutualAuthClient(cl, nil, "HTTP/host.test.gokrb5").Get(s.URL)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+}
@@ -6,15 +6,19 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/asn1tools"
 	"github.com/jcmturner/gokrb5/v8/client"
 	"github.com/jcmturner/gokrb5/v8/credentials"
 	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
 	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/logging"
 	"github.com/jcmturner/gokrb5/v8/messages"
 	"github.com/jcmturner/gokrb5/v8/service"
 	"github.com/jcmturner/gokrb5/v8/types"
@@ -36,6 +40,8 @@ type KRB5Token struct {
 	KRBError messages.KRBError
 	settings *service.Settings
 	context  context.Context
+	// msg is the marshaled Kerberos message of a token that has been unmarshaled
+	msg []byte
 }
 
 // Marshal a KRB5Token into a slice of bytes.
@@ -49,28 +55,35 @@ func (m *KRB5Token) Marshal() ([]byte, error) {
 	case TOK_ID_KRB_AP_REQ:
 		tb, err = m.APReq.Marshal()
 		if err != nil {
-			return []byte{}, fmt.Errorf("error marshalling AP_REQ for MechToken: %v", err)
+			return []byte{}, fmt.Errorf("error marshalling AP_REQ for MechToken: %w", err)
 		}
 	case TOK_ID_KRB_AP_REP:
-		return []byte{}, errors.New("marshal of AP_REP GSSAPI MechToken not supported by gokrb5")
+		tb, err = m.APRep.Marshal()
+		if err != nil {
+			return []byte{}, fmt.Errorf("error marshalling AP_REP for MechToken: %w", err)
+		}
 	case TOK_ID_KRB_ERROR:
-		return []byte{}, errors.New("marshal of KRB_ERROR GSSAPI MechToken not supported by gokrb5")
+		tb, err = m.KRBError.Marshal()
+		if err != nil {
+			return []byte{}, fmt.Errorf("error marshalling KRB_ERROR for MechToken: %w", err)
+		}
 	}
 	if err != nil {
-		return []byte{}, fmt.Errorf("error mashalling kerberos message within mech token: %v", err)
+		return []byte{}, fmt.Errorf("error mashalling kerberos message within mech token: %w", err)
 	}
 	b = append(b, tb...)
 	return asn1tools.AddASNAppTag(b, 0), nil
 }
 
-// Unmarshal a KRB5Token.
+// Unmarshal a KRB5Token. Tokens framed with the IAKERB mechanism OID, as the AP_REQ and AP_REP of security contexts
+// established with IAKERB are, are also unmarshalled.
 func (m *KRB5Token) Unmarshal(b []byte) error {
 	var oid asn1.ObjectIdentifier
 	r, err := asn1.UnmarshalWithParams(b, &oid, fmt.Sprintf("application,explicit,tag:%v", 0))
 	if err != nil {
-		return fmt.Errorf("error unmarshalling KRB5Token OID: %v", err)
+		return fmt.Errorf("error unmarshalling KRB5Token OID: %w", err)
 	}
-	if !oid.Equal(gssapi.OIDKRB5.OID()) {
+	if !oid.Equal(gssapi.OIDKRB5.OID()) && !oid.Equal(gssapi.OIDGSSIAKerb.OID()) {
 		return fmt.Errorf("error unmarshalling KRB5Token, OID is %s not %s", oid.String(), gssapi.OIDKRB5.OID().String())
 	}
 	m.OID = oid
@@ -78,26 +91,27 @@ func (m *KRB5Token) Unmarshal(b []byte) error {
 		return fmt.Errorf("krb5token too short")
 	}
 	m.tokID = r[0:2]
+	m.msg = r[2:]
 	switch hex.EncodeToString(m.tokID) {
 	case TOK_ID_KRB_AP_REQ:
 		var a messages.APReq
 		err = a.Unmarshal(r[2:])
 		if err != nil {
-			return fmt.Errorf("error unmarshalling KRB5Token AP_REQ: %v", err)
+			return fmt.Errorf("error unmarshalling KRB5Token AP_REQ: %w", err)
 		}
 		m.APReq = a
 	case TOK_ID_KRB_AP_REP:
 		var a messages.APRep
 		err = a.Unmarshal(r[2:])
 		if err != nil {
-			return fmt.Errorf("error unmarshalling KRB5Token AP_REP: %v", err)
+			return fmt.Errorf("error unmarshalling KRB5Token AP_REP: %w", err)
 		}
 		m.APRep = a
 	case TOK_ID_KRB_ERROR:
 		var a messages.KRBError
 		err = a.Unmarshal(r[2:])
 		if err != nil {
-			return fmt.Errorf("error unmarshalling KRB5Token KRBError: %v", err)
+			return fmt.Errorf("error unmarshalling KRB5Token KRBError: %w", err)
 		}
 		m.KRBError = a
 	}
@@ -106,6 +120,7 @@ func (m *KRB5Token) Unmarshal(b []byte) error {
 
 // Verify a KRB5Token.
 func (m *KRB5Token) Verify() (bool, gssapi.Status) {
+	m.dump()
 	switch hex.EncodeToString(m.tokID) {
 	case TOK_ID_KRB_AP_REQ:
 		ok, creds, err := service.VerifyAPREQ(&m.APReq, m.settings)
@@ -131,6 +146,33 @@ func (m *KRB5Token) Verify() (bool, gssapi.Status) {
 	return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "unknown TOK_ID in KRB5 token"}
 }
 
+// dump writes the message received in the token to the service's packet dump writer if one is configured and logs its
+// summary at logging.LevelTrace.
+func (m *KRB5Token) dump() {
+	if m.settings == nil || len(m.msg) < 1 {
+		return
+	}
+	var addr string
+	if a := m.settings.ClientAddress(); a.AddrType == addrtype.IPv4 || a.AddrType == addrtype.IPv6 {
+		addr = net.IP(a.Address).String()
+	}
+	l := m.settings.StructuredLogger()
+	if l != nil && l.Enabled(logging.LevelTrace) {
+		l.Log(logging.LevelTrace, "received from client", logging.F(logging.KeyRemoteAddr, addr),
+			logging.F(logging.KeyBytes, len(m.msg)), logging.F(logging.KeyMessage, messages.Summary(m.msg)))
+	}
+	if m.settings.PacketDump() == nil {
+		return
+	}
+	h := "<-- received from client"
+	if addr != "" {
+		h += " " + addr
+	}
+	if err := messages.WriteDump(m.settings.PacketDump(), h, m.msg); err != nil && l != nil {
+		l.Log(logging.LevelError, "error writing packet dump", logging.F(logging.KeyError, err))
+	}
+}
+
 // IsAPReq tests if the MechToken contains an AP_REQ.
 func (m *KRB5Token) IsAPReq() bool {
 	if hex.EncodeToString(m.tokID) == TOK_ID_KRB_AP_REQ {
@@ -139,6 +181,28 @@ func (m *KRB5Token) IsAPReq() bool {
 	return false
 }
 
+// SecurityContext returns the per-message protection of the security context initiated by the token's AP_REQ, for
+// the client as the context initiator, once the service has accepted it without replying with an AP_REP. The session
+// key is that of the service ticket the AP_REQ was created with. The key of the context is the authenticator's subkey
+// if it has one, otherwise the session key, and the sequence numbers of the tokens sent and received start from that
+// of the authenticator.
+func (m *KRB5Token) SecurityContext(sessionKey types.EncryptionKey) (*gssapi.SecurityContext, error) {
+	if !m.IsAPReq() {
+		return nil, errors.New("token does not contain an AP_REQ")
+	}
+	if err := m.APReq.DecryptAuthenticator(sessionKey); err != nil {
+		return nil, err
+	}
+	key := sessionKey
+	if m.APReq.Authenticator.SubKey.KeyType != 0 {
+		key = m.APReq.Authenticator.SubKey
+	}
+	seq := uint64(m.APReq.Authenticator.SeqNumber)
+	sc := gssapi.NewSecurityContext(key, false, false, seq)
+	sc.ExpectSequence(seq)
+	return sc, nil
+}
+
 // IsAPRep tests if the MechToken contains an AP_REP.
 func (m *KRB5Token) IsAPRep() bool {
 	if hex.EncodeToString(m.tokID) == TOK_ID_KRB_AP_REP {
@@ -162,6 +226,12 @@ func (m *KRB5Token) Context() context.Context {
 
 // NewKRB5TokenAPREQ creates a new KRB5 token with AP_REQ
 func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, GSSAPIFlags []int, APOptions []int) (KRB5Token, error) {
+	return NewKRB5TokenAPREQChannelBindings(cl, tkt, sessionKey, GSSAPIFlags, APOptions, nil)
+}
+
+// NewKRB5TokenAPREQChannelBindings creates a new KRB5 token with AP_REQ, as NewKRB5TokenAPREQ does, binding the
+// security context to the channel with the channel bindings' hash in the authenticator checksum.
+func NewKRB5TokenAPREQChannelBindings(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, GSSAPIFlags []int, APOptions []int, cb *gssapi.ChannelBindings) (KRB5Token, error) {
 	// TODO consider providing the SPN rather than the specific tkt and key and get these from the krb client.
 	var m KRB5Token
 	m.OID = gssapi.OIDKRB5.OID()
@@ -172,6 +242,10 @@ func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.
 	if err != nil {
 		return m, err
 	}
+	copy(auth.Cksum.Checksum[4:20], cb.Hash())
+	if binary.LittleEndian.Uint32(auth.Cksum.Checksum[20:24])&gssapi.ContextFlagDeleg != 0 {
+		auth.Cksum.Checksum = delegate(cl, tkt, sessionKey, auth.Cksum.Checksum)
+	}
 	APReq, err := messages.NewAPReq(
 		tkt,
 		sessionKey,
@@ -187,6 +261,26 @@ func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.
 	return m, nil
 }
 
+// NewKRB5TokenAPREP creates a new KRB5 token with the AP_REP replying to an AP_REQ.
+func NewKRB5TokenAPREP(APRep messages.APRep) KRB5Token {
+	tb, _ := hex.DecodeString(TOK_ID_KRB_AP_REP)
+	return KRB5Token{
+		OID:   gssapi.OIDKRB5.OID(),
+		tokID: tb,
+		APRep: APRep,
+	}
+}
+
+// NewKRB5TokenKRBError creates a new KRB5 token with the KRB_ERROR rejecting an AP_REQ.
+func NewKRB5TokenKRBError(KRBError messages.KRBError) KRB5Token {
+	tb, _ := hex.DecodeString(TOK_ID_KRB_ERROR)
+	return KRB5Token{
+		OID:      gssapi.OIDKRB5.OID(),
+		tokID:    tb,
+		KRBError: KRBError,
+	}
+}
+
 // krb5TokenAuthenticator creates a new kerberos authenticator for kerberos MechToken
 func krb5TokenAuthenticator(creds *credentials.Credentials, flags []int) (types.Authenticator, error) {
 	//RFC 4121 Section 4.1.1
@@ -205,14 +299,30 @@ func krb5TokenAuthenticator(creds *credentials.Credentials, flags []int) (types.
 func newAuthenticatorChksum(flags []int) []byte {
 	a := make([]byte, 24)
 	binary.LittleEndian.PutUint32(a[:4], 16)
+	var f uint32
 	for _, i := range flags {
-		if i == gssapi.ContextFlagDeleg {
-			x := make([]byte, 28-len(a))
-			a = append(a, x...)
-		}
-		f := binary.LittleEndian.Uint32(a[20:24])
 		f |= uint32(i)
-		binary.LittleEndian.PutUint32(a[20:24], f)
 	}
+	binary.LittleEndian.PutUint32(a[20:24], f)
 	return a
 }
+
+// delegate appends the client's delegated credentials, a KRB_CRED holding a forwarded TGT encrypted with the session
+// key, to the authenticator checksum, RFC 4121 section 4.1.1. As other GSS-API implementations do, the context is
+// established without delegation, clearing the delegation flag of the checksum, if the TGT cannot be forwarded.
+func delegate(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, cksum []byte) []byte {
+	b, err := cl.ForwardTGT(sessionKey, nil)
+	if err == nil && len(b) > math.MaxUint16 {
+		err = errors.New("KRB_CRED too large for the authenticator checksum")
+	}
+	if err != nil {
+		cl.Log("credentials not delegated to %s: %v", tkt.SName.PrincipalNameString(), err)
+		f := binary.LittleEndian.Uint32(cksum[20:24]) &^ gssapi.ContextFlagDeleg
+		binary.LittleEndian.PutUint32(cksum[20:24], f)
+		return cksum
+	}
+	d := make([]byte, 4, 4+len(b))
+	binary.LittleEndian.PutUint16(d[:2], 1)
+	binary.LittleEndian.PutUint16(d[2:], uint16(len(b)))
+	return append(cksum, append(d, b...)...)
+}
@@ -1,9 +1,12 @@
 package spnego
 
 import (
+	"bytes"
 	"encoding/hex"
 	"math"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/client"
@@ -11,7 +14,9 @@ import (
 	"github.com/jcmturner/gokrb5/v8/gssapi"
 	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
 	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
 	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
@@ -144,3 +149,79 @@ func TestNewAPREQKRB5Token_and_Marshal(t *testing.T) {
 	assert.Equal(t, testdata.TEST_PRINCIPALNAME_NAMESTRING, mt.APReq.Ticket.SName.NameString, "SName in ticket within the AP_REQ of the KRB5Token not as expected.")
 	assert.Equal(t, int32(18), mt.APReq.EncryptedAuthenticator.EType, "Authenticator within AP_REQ does not have the etype expected.")
 }
+
+func TestKRB5Token_Verify_PacketDump(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(KRB5TokenHex)
+	if err != nil {
+		t.Fatalf("Error decoding KRB5Token hex: %v", err)
+	}
+	var mt KRB5Token
+	err = mt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling KRB5Token: %v", err)
+	}
+	var buf bytes.Buffer
+	mt.settings = service.NewSettings(keytab.New(), service.PacketDump(&buf), service.ClientAddress(types.HostAddressFromNetIP(net.ParseIP("10.1.2.3"))))
+	ok, _ := mt.Verify()
+	assert.False(t, ok, "token should not verify without the service key")
+	assert.Contains(t, buf.String(), "<-- received from client 10.1.2.3", "received message not dumped")
+	assert.Contains(t, buf.String(), "AP-REQ sname=HTTP/host.test.gokrb5 realm=TEST.GOKRB5", "summary not as expected")
+}
+
+func TestKRB5Token_SecurityContext(t *testing.T) {
+	t.Parallel()
+	creds := credentials.New("testuser1", "TEST.GOKRB5")
+	cl := client.Client{
+		Credentials: creds,
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(creds.CName(), creds.Domain(), sname, "TEST.GOKRB5", types.NewKrbFlags(), kt, 18, 1,
+		st, st, st.Add(time.Hour), st.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error getting test ticket: %v", err)
+	}
+	mt, err := NewKRB5TokenAPREQ(&cl, tkt, sessionKey, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagSequence}, []int{})
+	if err != nil {
+		t.Fatalf("error creating KRB5Token: %v", err)
+	}
+	mb, err := mt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB5Token: %v", err)
+	}
+	csc, err := mt.SecurityContext(sessionKey)
+	if err != nil {
+		t.Fatalf("error getting client security context: %v", err)
+	}
+
+	var st2 KRB5Token
+	if err := st2.Unmarshal(mb); err != nil {
+		t.Fatalf("error unmarshaling KRB5Token: %v", err)
+	}
+	if ok, _, err := service.VerifyAPREQ(&st2.APReq, service.NewSettings(kt)); !ok {
+		t.Fatalf("AP_REQ not verified: %v", err)
+	}
+	ssc := service.SecurityContext(&st2.APReq)
+
+	mic, err := csc.GetMIC([]byte("request"))
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	assert.NoError(t, ssc.VerifyMIC([]byte("request"), mic), "client's MIC should verify")
+	err = ssc.VerifyMIC([]byte("request"), mic)
+	assert.Equal(t, gssapi.StatusDuplicateToken, err.(gssapi.Status).Code, "replayed MIC should be detected: %v", err)
+	mic, err = ssc.GetMIC([]byte("response"))
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	assert.NoError(t, csc.VerifyMIC([]byte("response"), mic), "service's MIC should verify")
+	assert.Error(t, csc.VerifyMIC([]byte("modified"), mic), "MIC for a modified message should not verify")
+
+	var e KRB5Token
+	_, err = e.SecurityContext(sessionKey)
+	assert.Error(t, err, "security context should require an AP_REQ")
+}
@@ -0,0 +1,281 @@
+package spnego
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// NewMutualAuthClient returns a SPNEGO enabled HTTP client, as NewClient does, that requests mutual authentication.
+// The service must then authenticate itself to the client by replying with an AP_REP in the WWW-Authenticate header of
+// its response, which the client verifies before returning the response. A response that does not authenticate the
+// service is closed and returned as an error, except for an unauthorized response rejecting the client.
+func NewMutualAuthClient(krb5Cl *client.Client, httpCl *http.Client, spn string) *Client {
+	c := NewClient(krb5Cl, httpCl, spn)
+	c.mutual = true
+	return c
+}
+
+// mutualAuth is the client's mutual authentication of the service: the session key and authenticator of the AP_REQ it
+// sent, needed to verify the AP_REP, and whether the AP_REP has been verified in a response continuing the negotiation.
+type mutualAuth struct {
+	cl       *client.Client
+	spn      string
+	cb       *gssapi.ChannelBindings
+	key      types.EncryptionKey
+	auth     types.Authenticator
+	resent   bool
+	verified bool
+}
+
+// setMutualNegotiateHeader sets the SPNEGO authorization header on the request with a Kerberos token requesting mutual
+// authentication, bound to the channel bindings if not nil, and returns the mutual authentication verifying the
+// service's response.
+func (c *Client) setMutualNegotiateHeader(req *http.Request, cb *gssapi.ChannelBindings) (*mutualAuth, error) {
+	m, err := c.mutualNegotiateHeader(req, cb)
+	return m, krberror.WithCorrelationID(err, c.krb5Client.CorrelationID())
+}
+
+func (c *Client) mutualNegotiateHeader(req *http.Request, cb *gssapi.ChannelBindings) (*mutualAuth, error) {
+	spn := c.spn
+	cl := c.krb5Client
+	if spn == "" {
+		var err error
+		if spn, err = requestSPN(req.Context(), cl, req); err != nil {
+			return nil, err
+		}
+	}
+	cl.Log("using SPN %s with mutual authentication", spn)
+	if err := cl.AffirmLoginContext(req.Context()); err != nil {
+		return nil, fmt.Errorf("could not acquire client credential: %w", err)
+	}
+	m := &mutualAuth{cl: cl, spn: spn, cb: cb}
+	mtb, err := m.token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	st := SPNEGOToken{
+		Init: true,
+		NegTokenInit: NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
+			MechTokenBytes: mtb,
+		},
+	}
+	if err := setNegotiateToken(req, &st); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// token returns the marshaled Kerberos token with an AP_REQ requesting mutual authentication, keeping its session key
+// and authenticator to verify the AP_REP.
+func (m *mutualAuth) token(ctx context.Context) ([]byte, error) {
+	tkt, key, err := m.cl.GetServiceTicketContext(ctx, m.spn)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize context: %w", err)
+	}
+	gssFlags := []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf, gssapi.ContextFlagMutual}
+	if m.cl.ShouldDelegate(m.spn) {
+		gssFlags = append(gssFlags, gssapi.ContextFlagDeleg)
+	}
+	mt, err := NewKRB5TokenAPREQChannelBindings(m.cl, tkt, key, gssFlags, []int{flags.APOptionMutualRequired}, m.cb)
+	if err != nil {
+		return nil, fmt.Errorf("could not create AP_REQ: %w", err)
+	}
+	// The authenticator's time is needed to verify the AP_REP.
+	if err := mt.APReq.DecryptAuthenticator(key); err != nil {
+		return nil, err
+	}
+	mtb, err := mt.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling KRB5 token; %w", err)
+	}
+	m.key = key
+	m.auth = mt.APReq.Authenticator
+	return mtb, nil
+}
+
+// next returns the client's next token for the service continuing the negotiation: a new AP_REQ if the service did not
+// accept the first, which is only sent once, or the client's mechListMIC once the service's AP_REP is verified if the
+// service sent its mechListMIC or requested the client's.
+func (m *mutualAuth) next(rt *NegTokenResp) (*SPNEGOToken, error) {
+	if len(rt.ResponseToken) < 1 {
+		if m.resent || m.verified {
+			return nil, nil
+		}
+		m.resent = true
+		mtb, err := m.token(context.Background())
+		if err != nil {
+			return nil, krberror.WithCorrelationID(err, m.cl.CorrelationID())
+		}
+		return &SPNEGOToken{
+			Resp: true,
+			NegTokenResp: NegTokenResp{
+				NegState:      asn1.Enumerated(NegStateAcceptIncomplete),
+				ResponseToken: mtb,
+			},
+		}, nil
+	}
+	if m.verified {
+		return nil, nil
+	}
+	ep, err := verifyAPRep(rt.ResponseToken, m.key, m.auth)
+	if err != nil {
+		return nil, fmt.Errorf("mutual authentication failed: %w", err)
+	}
+	m.verified = true
+	if len(rt.MechListMIC) < 1 && rt.State() != NegStateRequestMIC {
+		return nil, nil
+	}
+	key := m.key
+	if ep.Subkey.KeyType != 0 {
+		key = ep.Subkey
+	} else if m.auth.SubKey.KeyType != 0 {
+		key = m.auth.SubKey
+	}
+	sc := gssapi.NewSecurityContext(key, false, ep.Subkey.KeyType != 0, uint64(m.auth.SeqNumber))
+	sc.ExpectSequence(uint64(ep.SequenceNumber))
+	mechs := []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()}
+	if len(rt.MechListMIC) > 0 {
+		if err := VerifyMechListMIC(sc, mechs, rt.MechListMIC); err != nil {
+			return nil, fmt.Errorf("mutual authentication failed: %w", err)
+		}
+	}
+	mic, err := MechListMIC(sc, mechs)
+	if err != nil {
+		return nil, err
+	}
+	return &SPNEGOToken{
+		Resp: true,
+		NegTokenResp: NegTokenResp{
+			NegState:    asn1.Enumerated(NegStateAcceptCompleted),
+			MechListMIC: mic,
+		},
+	}, nil
+}
+
+// verify verifies the AP_REP in the service's response, unless it was verified while continuing the negotiation.
+func (m *mutualAuth) verify(resp *http.Response) error {
+	if m.verified {
+		return nil
+	}
+	return verifyMutualAuth(resp, m.key, m.auth)
+}
+
+// verifyMutualAuth verifies the AP_REP in the service's response, which must echo the time of the authenticator sent
+// and be encrypted with the session key. Unauthorized responses are not verified as they reject the client.
+func verifyMutualAuth(resp *http.Response, key types.EncryptionKey, auth types.Authenticator) error {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil
+	}
+	s := strings.SplitN(resp.Header.Get(HTTPHeaderAuthResponse), " ", 2)
+	if len(s) != 2 || s[0] != HTTPHeaderAuthResponseValueKey {
+		return errors.New("service did not authenticate itself with an AP_REP")
+	}
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return fmt.Errorf("error in base64 decoding negotiation header: %w", err)
+	}
+	var st SPNEGOToken
+	if err := st.Unmarshal(b); err != nil {
+		return fmt.Errorf("error in unmarshaling SPNEGO token: %w", err)
+	}
+	if !st.Resp || st.NegTokenResp.State() != NegStateAcceptCompleted {
+		return errors.New("service's SPNEGO token is not a completed NegTokenResp")
+	}
+	_, err = verifyAPRep(st.NegTokenResp.ResponseToken, key, auth)
+	return err
+}
+
+// verifyAPRep verifies the AP_REP of the service's response token, returning its decrypted encrypted part.
+func verifyAPRep(token []byte, key types.EncryptionKey, auth types.Authenticator) (messages.EncAPRepPart, error) {
+	var mt KRB5Token
+	if err := mt.Unmarshal(token); err != nil {
+		return messages.EncAPRepPart{}, err
+	}
+	if !mt.IsAPRep() {
+		return messages.EncAPRepPart{}, errors.New("service's response token does not contain an AP_REP")
+	}
+	ep, err := mt.APRep.DecryptEncPart(key, auth)
+	if err != nil {
+		return messages.EncAPRepPart{}, err
+	}
+	if ep.Subkey.KeyType != 0 {
+		et, err := crypto.GetEtype(ep.Subkey.KeyType)
+		if err != nil {
+			return messages.EncAPRepPart{}, fmt.Errorf("AP_REP subkey not valid: %w", err)
+		}
+		if len(ep.Subkey.KeyValue) != et.GetKeyByteSize() {
+			return messages.EncAPRepPart{}, errors.New("AP_REP subkey not valid: key length does not match its encryption type")
+		}
+	}
+	return ep, nil
+}
+
+// mutualAuthRequested returns whether the client requested mutual authentication in the verified AP_REQ, with either
+// the AP option or the context flag of the authenticator checksum, RFC 4121 section 4.1.1.
+func mutualAuthRequested(APReq *messages.APReq) bool {
+	if types.IsFlagSet(&APReq.APOptions, flags.APOptionMutualRequired) {
+		return true
+	}
+	cksum := APReq.Authenticator.Cksum
+	return cksum.CksumType == chksumtype.GSSAPI && len(cksum.Checksum) >= 24 &&
+		binary.LittleEndian.Uint32(cksum.Checksum[20:24])&gssapi.ContextFlagMutual != 0
+}
+
+// mutualAuthResponse returns the WWW-Authenticate header value of the completed NegTokenResp with the AP_REP replying
+// to the verified AP_REQ of the token, which is a NegTokenInit or, continuing the negotiation, a NegTokenResp, or an
+// empty string if the client did not request mutual authentication. Clients that sent a raw KRB5 token are replied to
+// with a raw KRB5 token.
+func mutualAuthResponse(st *SPNEGOToken) (string, error) {
+	token := st.NegTokenInit.mechToken
+	if st.Resp {
+		token = st.NegTokenResp.mechToken
+	}
+	mt, ok := token.(*KRB5Token)
+	if !ok || !mt.IsAPReq() || !mutualAuthRequested(&mt.APReq) {
+		return "", nil
+	}
+	auth := mt.APReq.Authenticator
+	rep, err := messages.NewAPRep(auth, mt.APReq.Ticket.DecryptedEncPart.Key, types.EncryptionKey{}, auth.SeqNumber)
+	if err != nil {
+		return "", err
+	}
+	rt := NewKRB5TokenAPREP(rep)
+	b, err := rt.Marshal()
+	if err != nil {
+		return "", err
+	}
+	if st.rawKRB5 {
+		return HTTPHeaderAuthResponseValueKey + " " + base64.StdEncoding.EncodeToString(b), nil
+	}
+	resp := SPNEGOToken{
+		Resp: true,
+		NegTokenResp: NegTokenResp{
+			NegState:      asn1.Enumerated(NegStateAcceptCompleted),
+			ResponseToken: b,
+		},
+	}
+	// The mechanism is named in the acceptor's first reply, which does not continue a negotiation.
+	if st.Init {
+		resp.NegTokenResp.SupportedMech = st.NegTokenInit.MechTypes[0]
+	}
+	if b, err = resp.Marshal(); err != nil {
+		return "", err
+	}
+	return HTTPHeaderAuthResponseValueKey + " " + base64.StdEncoding.EncodeToString(b), nil
+}
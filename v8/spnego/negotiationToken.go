@@ -40,7 +40,7 @@ type marshalNegTokenInit struct {
 	MechTypes      []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
 	ReqFlags       asn1.BitString          `asn1:"explicit,optional,tag:1"`
 	MechTokenBytes []byte                  `asn1:"explicit,optional,omitempty,tag:2"`
-	MechListMIC    []byte                  `asn1:"explicit,optional,omitempty,tag:3"` // This field is not used when negotiating Kerberos tokens
+	MechListMIC    []byte                  `asn1:"explicit,optional,omitempty,tag:3"`
 }
 
 // NegTokenResp implements Negotiation Token of type Resp/Targ
@@ -57,7 +57,16 @@ type marshalNegTokenResp struct {
 	NegState      asn1.Enumerated       `asn1:"explicit,tag:0"`
 	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
 	ResponseToken []byte                `asn1:"explicit,optional,omitempty,tag:2"`
-	MechListMIC   []byte                `asn1:"explicit,optional,omitempty,tag:3"` // This field is not used when negotiating Kerberos tokens
+	MechListMIC   []byte                `asn1:"explicit,optional,omitempty,tag:3"`
+}
+
+// unmarshalNegTokenResp is the NegTokenResp as received, in which the negState is optional as initiators, continuing
+// the negotiation after the acceptor's first reply, may omit it, RFC 4178 section 4.2.2.
+type unmarshalNegTokenResp struct {
+	NegState      asn1.Enumerated       `asn1:"explicit,optional,tag:0"`
+	SupportedMech asn1.ObjectIdentifier `asn1:"explicit,optional,tag:1"`
+	ResponseToken []byte                `asn1:"explicit,optional,omitempty,tag:2"`
+	MechListMIC   []byte                `asn1:"explicit,optional,omitempty,tag:3"`
 }
 
 // NegTokenTarg implements Negotiation Token of type Resp/Targ
@@ -105,22 +114,18 @@ func (n *NegTokenInit) Unmarshal(b []byte) error {
 	return nil
 }
 
-// Verify an Init negotiation token
+// Verify an Init negotiation token. If the initiator offers Kerberos V5 without a token for it, as it sends none or
+// its optimistic token is for a mechanism it prefers, the status is gssapi.StatusContinueNeeded and the negotiation
+// continues with the initiator's Kerberos token in a NegTokenResp.
 func (n *NegTokenInit) Verify() (bool, gssapi.Status) {
 	// Check if supported mechanisms are in the MechTypeList
-	var mtSupported bool
-	for _, m := range n.MechTypes {
-		if m.Equal(gssapi.OIDKRB5.OID()) || m.Equal(gssapi.OIDMSLegacyKRB5.OID()) {
-			if n.mechToken == nil && n.MechTokenBytes == nil {
-				return false, gssapi.Status{Code: gssapi.StatusContinueNeeded}
-			}
-			mtSupported = true
-			break
-		}
-	}
+	_, i, mtSupported := KRB5Mech(n.MechTypes)
 	if !mtSupported {
 		return false, gssapi.Status{Code: gssapi.StatusBadMech, Message: "no supported mechanism specified in negotiation"}
 	}
+	if i > 0 || (n.mechToken == nil && n.MechTokenBytes == nil) {
+		return false, gssapi.Status{Code: gssapi.StatusContinueNeeded}
+	}
 	// There should be some mechtoken bytes for a KRB5Token (other mech types are not supported)
 	mt := new(KRB5Token)
 	mt.settings = n.settings
@@ -138,7 +143,15 @@ func (n *NegTokenInit) Verify() (bool, gssapi.Status) {
 		}
 	}
 	// Verify the mechtoken
-	return n.mechToken.Verify()
+	ok, status := n.mechToken.Verify()
+	if !ok || len(n.MechListMIC) < 1 || !mt.IsAPReq() {
+		return ok, status
+	}
+	// An initiator whose context is established by the AP_REQ alone may protect the mechanism list with a MIC.
+	if err := VerifyMechListMIC(service.SecurityContext(&mt.APReq), n.MechTypes, n.MechListMIC); err != nil {
+		return false, gssapi.Status{Code: gssapi.StatusBadMIC, Message: err.Error()}
+	}
+	return ok, status
 }
 
 // Context returns the SPNEGO context which will contain any verify user identity information.
@@ -195,9 +208,10 @@ func (n *NegTokenResp) Unmarshal(b []byte) error {
 	return nil
 }
 
-// Verify a Resp/Targ negotiation token
+// Verify a Resp/Targ negotiation token. The initiator's NegTokenResp continuing the negotiation with its Kerberos token
+// may omit the supported mechanism, which only the acceptor's first reply has to name.
 func (n *NegTokenResp) Verify() (bool, gssapi.Status) {
-	if n.SupportedMech.Equal(gssapi.OIDKRB5.OID()) || n.SupportedMech.Equal(gssapi.OIDMSLegacyKRB5.OID()) {
+	if len(n.SupportedMech) == 0 || IsKRB5Mech(n.SupportedMech) {
 		if n.mechToken == nil && n.ResponseToken == nil {
 			return false, gssapi.Status{Code: gssapi.StatusContinueNeeded}
 		}
@@ -242,6 +256,45 @@ func (n *NegTokenResp) Context() context.Context {
 	return nil
 }
 
+// IsKRB5Mech indicates if the mechanism OID is that of Kerberos V5, RFC 4121, or Microsoft's legacy OID for it.
+func IsKRB5Mech(oid asn1.ObjectIdentifier) bool {
+	return oid.Equal(gssapi.OIDKRB5.OID()) || oid.Equal(gssapi.OIDMSLegacyKRB5.OID())
+}
+
+// KRB5Mech returns the first Kerberos V5 mechanism OID of the initiator's mechanism list, which the acceptor selects,
+// its position in the list and whether the list has one.
+func KRB5Mech(mechTypes []asn1.ObjectIdentifier) (asn1.ObjectIdentifier, int, bool) {
+	for i, m := range mechTypes {
+		if IsKRB5Mech(m) {
+			return m, i, true
+		}
+	}
+	return nil, 0, false
+}
+
+// MechListMIC returns the mechListMIC protecting the list of mechanisms offered by the initiator from being altered,
+// RFC 4178 section 5, created with the security context established by the mechanism negotiated.
+func MechListMIC(sc *gssapi.SecurityContext, mechTypes []asn1.ObjectIdentifier) ([]byte, error) {
+	b, err := asn1.Marshal(mechTypes)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling MechTypeList: %w", err)
+	}
+	return sc.GetMIC(b)
+}
+
+// VerifyMechListMIC verifies the mechListMIC received from the peer for the list of mechanisms offered by the
+// initiator using the security context established by the mechanism negotiated.
+func VerifyMechListMIC(sc *gssapi.SecurityContext, mechTypes []asn1.ObjectIdentifier, mic []byte) error {
+	b, err := asn1.Marshal(mechTypes)
+	if err != nil {
+		return fmt.Errorf("error marshalling MechTypeList: %w", err)
+	}
+	if err := sc.VerifyMIC(b, mic); err != nil {
+		return fmt.Errorf("mechListMIC not valid: %w", err)
+	}
+	return nil
+}
+
 // UnmarshalNegToken umarshals and returns either a NegTokenInit or a NegTokenResp.
 //
 // The boolean indicates if the response is a NegTokenInit.
@@ -250,14 +303,14 @@ func UnmarshalNegToken(b []byte) (bool, interface{}, error) {
 	var a asn1.RawValue
 	_, err := asn1.Unmarshal(b, &a)
 	if err != nil {
-		return false, nil, fmt.Errorf("error unmarshalling NegotiationToken: %v", err)
+		return false, nil, fmt.Errorf("error unmarshalling NegotiationToken: %w", err)
 	}
 	switch a.Tag {
 	case 0:
 		var n marshalNegTokenInit
 		_, err = asn1.Unmarshal(a.Bytes, &n)
 		if err != nil {
-			return false, nil, fmt.Errorf("error unmarshalling NegotiationToken type %d (Init): %v", a.Tag, err)
+			return false, nil, fmt.Errorf("error unmarshalling NegotiationToken type %d (Init): %w", a.Tag, err)
 		}
 		nt := NegTokenInit{
 			MechTypes:      n.MechTypes,
@@ -267,10 +320,10 @@ func UnmarshalNegToken(b []byte) (bool, interface{}, error) {
 		}
 		return true, nt, nil
 	case 1:
-		var n marshalNegTokenResp
+		var n unmarshalNegTokenResp
 		_, err = asn1.Unmarshal(a.Bytes, &n)
 		if err != nil {
-			return false, nil, fmt.Errorf("error unmarshalling NegotiationToken type %d (Resp/Targ): %v", a.Tag, err)
+			return false, nil, fmt.Errorf("error unmarshalling NegotiationToken type %d (Resp/Targ): %w", a.Tag, err)
 		}
 		nt := NegTokenResp{
 			NegState:      n.NegState,
@@ -287,13 +340,22 @@ func UnmarshalNegToken(b []byte) (bool, interface{}, error) {
 
 // NewNegTokenInitKRB5 creates new Init negotiation token for Kerberos 5
 func NewNegTokenInitKRB5(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey) (NegTokenInit, error) {
-	mt, err := NewKRB5TokenAPREQ(cl, tkt, sessionKey, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, []int{})
+	return newNegTokenInitKRB5(cl, tkt, sessionKey, nil, false)
+}
+
+// newNegTokenInitKRB5 creates the Init negotiation token, delegating the client's credentials if deleg is true.
+func newNegTokenInitKRB5(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, cb *gssapi.ChannelBindings, deleg bool) (NegTokenInit, error) {
+	gssFlags := []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}
+	if deleg {
+		gssFlags = append(gssFlags, gssapi.ContextFlagDeleg)
+	}
+	mt, err := NewKRB5TokenAPREQChannelBindings(cl, tkt, sessionKey, gssFlags, []int{}, cb)
 	if err != nil {
-		return NegTokenInit{}, fmt.Errorf("error getting KRB5 token; %v", err)
+		return NegTokenInit{}, fmt.Errorf("error getting KRB5 token; %w", err)
 	}
 	mtb, err := mt.Marshal()
 	if err != nil {
-		return NegTokenInit{}, fmt.Errorf("error marshalling KRB5 token; %v", err)
+		return NegTokenInit{}, fmt.Errorf("error marshalling KRB5 token; %w", err)
 	}
 	return NegTokenInit{
 		MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
@@ -3,8 +3,18 @@ package spnego
 import (
 	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -71,6 +81,20 @@ func TestUnmarshal_negTokenResp(t *testing.T) {
 	assert.Equal(t, asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}, nResp.SupportedMech, "SupportedMech type not as expected.")
 }
 
+func TestUnmarshal_negTokenResp_NoNegState(t *testing.T) {
+	t.Parallel()
+	// An initiator's NegTokenResp continuing the negotiation with only its mechanism token.
+	b, _ := hex.DecodeString("a1083006a20404020102")
+	isInit, nt, err := UnmarshalNegToken(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling negotiation token: %v", err)
+	}
+	assert.False(t, isInit, "Boolean indicating type is negTokenInit is not false")
+	nResp := nt.(NegTokenResp)
+	assert.Equal(t, []byte{0x01, 0x02}, nResp.ResponseToken, "ResponseToken not as expected")
+	assert.Empty(t, nResp.SupportedMech, "SupportedMech should be empty")
+}
+
 func TestMarshal_negTokenResp(t *testing.T) {
 	t.Parallel()
 	b, err := hex.DecodeString(testNegTokenResp)
@@ -105,3 +129,56 @@ func TestUnmarshal_negTokenInitWithReqFlags(t *testing.T) {
 		t.Errorf("unmarshal did not return the correct number of mechToken bytes")
 	}
 }
+
+func TestNegTokenInit_Verify_MechListMIC(t *testing.T) {
+	t.Parallel()
+	creds := credentials.New("testuser1", "TEST.GOKRB5")
+	cl := client.Client{
+		Credentials: creds,
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(creds.CName(), creds.Domain(), sname, "TEST.GOKRB5", types.NewKrbFlags(), kt, 18, 1,
+		st, st, st.Add(time.Hour), st.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error getting test ticket: %v", err)
+	}
+	mechs := []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID(), gssapi.OIDMSLegacyKRB5.OID()}
+	// negTokenInit returns a NegTokenInit with a new AP_REQ and its mechListMIC over the mechanism list.
+	negTokenInit := func(micMechs []asn1.ObjectIdentifier) NegTokenInit {
+		mt, err := NewKRB5TokenAPREQ(&cl, tkt, sessionKey, []int{gssapi.ContextFlagInteg}, []int{})
+		if err != nil {
+			t.Fatalf("error creating KRB5Token: %v", err)
+		}
+		mb, err := mt.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling KRB5Token: %v", err)
+		}
+		sc, err := mt.SecurityContext(sessionKey)
+		if err != nil {
+			t.Fatalf("error getting client security context: %v", err)
+		}
+		mic, err := MechListMIC(sc, micMechs)
+		if err != nil {
+			t.Fatalf("error getting mechListMIC: %v", err)
+		}
+		return NegTokenInit{
+			MechTypes:      mechs,
+			MechTokenBytes: mb,
+			MechListMIC:    mic,
+			settings:       service.NewSettings(kt),
+		}
+	}
+
+	n := negTokenInit(mechs)
+	ok, status := n.Verify()
+	assert.True(t, ok, "NegTokenInit with a valid mechListMIC should verify: %v", status)
+
+	n = negTokenInit(mechs[:1])
+	ok, status = n.Verify()
+	assert.False(t, ok, "NegTokenInit with a mechListMIC for another mechanism list should not verify")
+	assert.Equal(t, gssapi.StatusBadMIC, status.Code, "status not as expected")
+}
@@ -0,0 +1,263 @@
+package spnego
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/service"
+)
+
+// ntlmSignature starts each NTLM message.
+const ntlmSignature = "NTLMSSP\x00"
+
+// NTLMInitiator is implemented by NTLM providers performing the client side of the NTLMSSP mechanism ([MS-NLMP]),
+// which gokrb5 does not implement itself.
+//
+// Negotiate returns the NEGOTIATE_MESSAGE starting an authentication and the function answering the server's
+// CHALLENGE_MESSAGE with the AUTHENTICATE_MESSAGE of the same authentication.
+type NTLMInitiator interface {
+	Negotiate() ([]byte, func(challenge []byte) ([]byte, error), error)
+}
+
+// NewNTLMFallbackClient returns a SPNEGO enabled HTTP client, as NewClient does, that falls back to the NTLMSSP
+// mechanism using the NTLM provider when Kerberos cannot be used: when a service ticket cannot be obtained, for
+// example as the KDC cannot be reached, or the service is addressed by IP address. The gokrb5 client may be nil to
+// only use NTLM. As the NTLM messages must be sent over the same connection the HTTP client's transport must keep
+// connections alive and use HTTP/1.1, as NTLM cannot be used over HTTP/2.
+func NewNTLMFallbackClient(krb5Cl *client.Client, ntlm NTLMInitiator, httpCl *http.Client, spn string) *Client {
+	return &Client{
+		Client:     prepareHTTPClient(httpCl),
+		krb5Client: krb5Cl,
+		ntlm:       ntlm,
+		spn:        spn,
+	}
+}
+
+// setNegotiateHeader sets the SPNEGO authorization header on the request with a Kerberos token or, if Kerberos cannot
+// be used and NTLM fallback is configured, with an NTLM NEGOTIATE_MESSAGE, in which case the function answering the
+// server's CHALLENGE_MESSAGE is returned. The Kerberos token is bound to the channel bindings if not nil.
+func (c *Client) setNegotiateHeader(req *http.Request, cb *gssapi.ChannelBindings) (func([]byte) ([]byte, error), error) {
+	if c.ntlm == nil {
+		return nil, SetSPNEGOHeaderChannelBindings(req.Context(), c.krb5Client, req, c.spn, cb)
+	}
+	if c.krb5Client != nil && !ipSPN(req, c.spn) {
+		err := SetSPNEGOHeaderChannelBindings(req.Context(), c.krb5Client, req, c.spn, cb)
+		if err == nil {
+			return nil, nil
+		}
+		c.krb5Client.Log("falling back to NTLM as Kerberos cannot be used: %v", err)
+	}
+	msg, authenticate, err := c.ntlm.Negotiate()
+	if err != nil {
+		return nil, fmt.Errorf("could not create NTLM NEGOTIATE_MESSAGE: %w", err)
+	}
+	st := SPNEGOToken{
+		Init: true,
+		NegTokenInit: NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDNTLMSSP.OID()},
+			MechTokenBytes: msg,
+		},
+	}
+	if err := setNegotiateToken(req, &st); err != nil {
+		return nil, err
+	}
+	return authenticate, nil
+}
+
+// ErrNTLMRequiresHTTP1 is returned by the SPNEGO client when the service can only be authenticated with NTLM over an
+// HTTP/2 connection. NTLM authenticates the connection its messages are sent over, which HTTP/2 does not allow as the
+// requests of a connection are multiplexed, so services such as IIS reset the request with HTTP_1_1_REQUIRED. The
+// HTTP client's transport should be limited to HTTP/1.1 to fall back to NTLM.
+var ErrNTLMRequiresHTTP1 = errors.New("NTLM authentication requires HTTP/1.1 as it is bound to the connection")
+
+// doNTLM sends the request with the NTLM NEGOTIATE_MESSAGE and, if the server answers with a CHALLENGE_MESSAGE,
+// sends the request again with the AUTHENTICATE_MESSAGE. The body is sent again using the request's GetBody function.
+func (c *Client) doNTLM(req *http.Request, authenticate func([]byte) ([]byte, error)) (*http.Response, error) {
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		if strings.Contains(err.Error(), "HTTP_1_1_REQUIRED") {
+			return nil, fmt.Errorf("%w: %v", ErrNTLMRequiresHTTP1, err)
+		}
+		return resp, err
+	}
+	challenge, ok := ntlmChallenge(resp)
+	if !ok {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	msg, err := authenticate(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("could not create NTLM AUTHENTICATE_MESSAGE: %w", err)
+	}
+	st := SPNEGOToken{
+		Resp: true,
+		NegTokenResp: NegTokenResp{
+			NegState:      asn1.Enumerated(NegStateAcceptIncomplete),
+			ResponseToken: msg,
+		},
+	}
+	if err := setNegotiateToken(req, &st); err != nil {
+		return nil, err
+	}
+	if req.Body != nil {
+		if req.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("could not get request body to send again: %w", err)
+		}
+	}
+	return c.Do(req)
+}
+
+// setNegotiateToken sets the SPNEGO token as the authorization header on the request.
+func setNegotiateToken(req *http.Request, st *SPNEGOToken) error {
+	b, err := st.Marshal()
+	if err != nil {
+		return fmt.Errorf("could not marshal SPNEGO: %w", err)
+	}
+	req.Header.Set(HTTPHeaderAuthRequest, HTTPHeaderAuthResponseValueKey+" "+base64.StdEncoding.EncodeToString(b))
+	return nil
+}
+
+// ntlmChallenge returns the NTLM CHALLENGE_MESSAGE from the server's response if it continues the negotiation with one.
+func ntlmChallenge(resp *http.Response) ([]byte, bool) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return nil, false
+	}
+	s := strings.SplitN(resp.Header.Get(HTTPHeaderAuthResponse), " ", 2)
+	if len(s) != 2 || s[0] != HTTPHeaderAuthResponseValueKey {
+		return nil, false
+	}
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return nil, false
+	}
+	var st SPNEGOToken
+	if err := st.Unmarshal(b); err != nil || !st.Resp || st.NegTokenResp.State() != NegStateAcceptIncomplete {
+		return nil, false
+	}
+	return st.NegTokenResp.ResponseToken, isNTLMMessage(st.NegTokenResp.ResponseToken)
+}
+
+// ipSPN returns whether the service is addressed by IP address, in which case Kerberos cannot be used.
+func ipSPN(req *http.Request, spn string) bool {
+	h := req.URL.Hostname()
+	if spn != "" {
+		h = spn[strings.Index(spn, "/")+1:]
+		if i := strings.Index(h, "@"); i >= 0 {
+			h = h[:i]
+		}
+		if sh, _, err := net.SplitHostPort(h); err == nil {
+			h = sh
+		}
+		h = strings.Trim(h, "[]")
+	}
+	return net.ParseIP(h) != nil
+}
+
+// isNTLMMessage returns whether the token is an NTLM message.
+func isNTLMMessage(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(ntlmSignature))
+}
+
+// ntlmToken returns the NTLM message within the client's SPNEGO token and whether the client is using the NTLMSSP
+// mechanism. The message is nil if the client offers NTLMSSP, and not Kerberos, without an initial NTLM message.
+func ntlmToken(st *SPNEGOToken) ([]byte, bool) {
+	if st.Resp {
+		return st.NegTokenResp.ResponseToken, isNTLMMessage(st.NegTokenResp.ResponseToken)
+	}
+	mechs := st.NegTokenInit.MechTypes
+	if len(mechs) < 1 {
+		return nil, false
+	}
+	if mechs[0].Equal(gssapi.OIDNTLMSSP.OID()) {
+		if isNTLMMessage(st.NegTokenInit.MechTokenBytes) {
+			return st.NegTokenInit.MechTokenBytes, true
+		}
+		return nil, true
+	}
+	var ntlm bool
+	for _, m := range mechs {
+		if m.Equal(gssapi.OIDKRB5.OID()) || m.Equal(gssapi.OIDMSLegacyKRB5.OID()) {
+			return nil, false
+		}
+		if m.Equal(gssapi.OIDNTLMSSP.OID()) {
+			ntlm = true
+		}
+	}
+	return nil, ntlm
+}
+
+// acceptNTLM authenticates the client with the NTLM provider, continuing the negotiation with the provider's
+// CHALLENGE_MESSAGE until the client is authenticated, when the inner handler is served. NTLM is refused over HTTP/2,
+// where the requests of a connection, which the NTLM provider identifies the client by, are multiplexed and may be
+// those of several clients behind a proxy, and the client is asked to use Kerberos instead.
+func acceptNTLM(s *SPNEGO, a service.NTLMAcceptor, inner http.Handler, w http.ResponseWriter, r *http.Request, msg []byte) {
+	if r.ProtoMajor >= 2 {
+		spnegoNegotiateKRB5MechType(s, w, "%s - SPNEGO NTLMSSP mechanism refused over %s", r.RemoteAddr, r.Proto)
+		return
+	}
+	if msg == nil {
+		spnegoNegotiateNTLM(s, w, nil, "%s - SPNEGO selected NTLMSSP mechanism", r.RemoteAddr)
+		return
+	}
+	reply, id, err := a.Accept(r.RemoteAddr, msg)
+	if err != nil {
+		spnegoResponseReject(s, w, "%s - SPNEGO NTLM validation error: %v", r.RemoteAddr, err)
+		return
+	}
+	if id == nil {
+		spnegoNegotiateNTLM(s, w, reply, "%s - SPNEGO NTLM continue needed", r.RemoteAddr)
+		return
+	}
+	if !authorize(s, w, r, id) {
+		return
+	}
+	if err := newSession(s, r, w, id); err != nil {
+		return
+	}
+	if h, err := negTokenRespHeader(NegStateAcceptCompleted, gssapi.OIDNTLMSSP.OID(), nil); err == nil {
+		w.Header().Set(HTTPHeaderAuthResponse, h)
+	}
+	s.Log("%s %s@%s - SPNEGO NTLM authentication succeeded", r.RemoteAddr, id.UserName(), id.Domain())
+	inner.ServeHTTP(w, goidentity.AddToHTTPRequestContext(id, r))
+}
+
+// spnegoNegotiateNTLM responds to the client to continue the NTLMSSP mechanism with the NTLM message.
+func spnegoNegotiateNTLM(s *SPNEGO, w http.ResponseWriter, msg []byte, format string, v ...interface{}) {
+	h, err := negTokenRespHeader(NegStateAcceptIncomplete, gssapi.OIDNTLMSSP.OID(), msg)
+	if err != nil {
+		spnegoInternalServerError(s, w, "SPNEGO could not marshal NTLM response: %v", err)
+		return
+	}
+	s.Log(format, v...)
+	w.Header().Set(HTTPHeaderAuthResponse, h)
+	http.Error(w, UnauthorizedMsg, http.StatusUnauthorized)
+}
+
+// negTokenRespHeader returns the WWW-Authenticate header value of a NegTokenResp for the mechanism.
+func negTokenRespHeader(state NegState, mech asn1.ObjectIdentifier, msg []byte) (string, error) {
+	st := SPNEGOToken{
+		Resp: true,
+		NegTokenResp: NegTokenResp{
+			NegState:      asn1.Enumerated(state),
+			SupportedMech: mech,
+			ResponseToken: msg,
+		},
+	}
+	b, err := st.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return HTTPHeaderAuthResponseValueKey + " " + base64.StdEncoding.EncodeToString(b), nil
+}
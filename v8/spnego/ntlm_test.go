@@ -0,0 +1,162 @@
+package spnego
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNTLM fakes the NTLM messages exchanged by an NTLM provider.
+type testNTLM struct {
+	password string
+}
+
+func (n testNTLM) Negotiate() ([]byte, func([]byte) ([]byte, error), error) {
+	return []byte(ntlmSignature + "negotiate"), func(challenge []byte) ([]byte, error) {
+		if !bytes.Equal(challenge, []byte(ntlmSignature+"challenge")) {
+			return nil, errors.New("unexpected challenge")
+		}
+		return []byte(ntlmSignature + "authenticate:" + n.password), nil
+	}, nil
+}
+
+func (n testNTLM) Accept(remoteAddr string, msg []byte) ([]byte, *credentials.Credentials, error) {
+	switch string(msg) {
+	case ntlmSignature + "negotiate":
+		return []byte(ntlmSignature + "challenge"), nil, nil
+	case ntlmSignature + "authenticate:" + n.password:
+		return nil, credentials.New("ntlmuser", "TEST"), nil
+	}
+	return nil, nil, errors.New("authentication failed")
+}
+
+func TestNTLMFallback(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(SPNEGOKRB5Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := goidentity.FromHTTPRequestContext(r)
+		b, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s@%s %s", id.UserName(), id.Domain(), b)
+	}), nil, service.NTLMFallback(testNTLM{password: "passwd"})))
+	defer s.Close()
+
+	cl := NewNTLMFallbackClient(nil, testNTLM{password: "passwd"}, nil, "HTTP/127.0.0.1")
+	resp, err := cl.Post(s.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "ntlmuser@TEST body", string(b), "response body not as expected")
+
+	cl = NewNTLMFallbackClient(nil, testNTLM{password: "wrong"}, nil, "HTTP/127.0.0.1")
+	resp, err = cl.Get(s.URL)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "status code not as expected")
+	assert.Equal(t, spnegoNegTokenRespReject, resp.Header.Get(HTTPHeaderAuthResponse), "rejection header not as expected")
+}
+
+func TestNTLMToken(t *testing.T) {
+	t.Parallel()
+	ntlm := gssapi.OIDNTLMSSP.OID()
+	krb5 := gssapi.OIDKRB5.OID()
+	msg := []byte(ntlmSignature + "negotiate")
+	var tests = []struct {
+		st   SPNEGOToken
+		msg  []byte
+		ntlm bool
+	}{
+		{SPNEGOToken{Init: true, NegTokenInit: NegTokenInit{MechTypes: []asn1.ObjectIdentifier{ntlm}, MechTokenBytes: msg}}, msg, true},
+		{SPNEGOToken{Init: true, NegTokenInit: NegTokenInit{MechTypes: []asn1.ObjectIdentifier{ntlm}}}, nil, true},
+		{SPNEGOToken{Init: true, NegTokenInit: NegTokenInit{MechTypes: []asn1.ObjectIdentifier{krb5, ntlm}, MechTokenBytes: []byte("krb5")}}, nil, false},
+		{SPNEGOToken{Init: true, NegTokenInit: NegTokenInit{MechTypes: []asn1.ObjectIdentifier{gssapi.OIDGSSIAKerb.OID(), ntlm}}}, nil, true},
+		{SPNEGOToken{Resp: true, NegTokenResp: NegTokenResp{ResponseToken: msg}}, msg, true},
+		{SPNEGOToken{Resp: true, NegTokenResp: NegTokenResp{ResponseToken: []byte("krb5")}}, []byte("krb5"), false},
+	}
+	for i, test := range tests {
+		m, ok := ntlmToken(&test.st)
+		assert.Equal(t, test.ntlm, ok, "test %d: NTLM not detected as expected", i)
+		if ok {
+			assert.Equal(t, test.msg, m, "test %d: NTLM message not as expected", i)
+		}
+	}
+}
+
+func TestIPSPN(t *testing.T) {
+	t.Parallel()
+	r, _ := http.NewRequest("GET", "http://10.0.0.1:8080/", nil)
+	assert.True(t, ipSPN(r, ""), "IP address host should be detected")
+	assert.True(t, ipSPN(r, "HTTP/10.0.0.1"), "IP address SPN should be detected")
+	assert.True(t, ipSPN(r, "HTTP/[::1]:8080@TEST.GOKRB5"), "IPv6 address SPN should be detected")
+	assert.False(t, ipSPN(r, "HTTP/host.test.gokrb5"), "host name SPN should not be detected")
+}
+
+func TestNTLMFallback_Authorizer(t *testing.T) {
+	t.Parallel()
+	a := func(r *http.Request, id *credentials.Credentials) (bool, int) {
+		return id.UserName() == "ntlmuser" && r.Method == http.MethodGet, http.StatusForbidden
+	}
+	s := httptest.NewServer(SPNEGOKRB5Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, goidentity.FromHTTPRequestContext(r).UserName())
+	}), nil, service.NTLMFallback(testNTLM{password: "passwd"}), service.Authorizer(a)))
+	defer s.Close()
+
+	cl := NewNTLMFallbackClient(nil, testNTLM{password: "passwd"}, nil, "HTTP/127.0.0.1")
+	resp, err := cl.Get(s.URL)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	resp, err = cl.Post(s.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "status code not as expected")
+}
+
+func TestNTLMFallback_HTTP2(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewUnstartedServer(SPNEGOKRB5Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, goidentity.FromHTTPRequestContext(r).UserName())
+	}), nil, service.NTLMFallback(testNTLM{password: "passwd"})))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	defer s.Close()
+
+	cl := NewNTLMFallbackClient(nil, testNTLM{password: "passwd"}, s.Client(), "HTTP/127.0.0.1")
+	_, err := cl.Get(s.URL)
+	assert.True(t, errors.Is(err, ErrNTLMRequiresHTTP1), "NTLM over HTTP/2 should fail: %v", err)
+
+	// The service asks for Kerberos rather than accept NTLM over HTTP/2.
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	st := SPNEGOToken{
+		Init: true,
+		NegTokenInit: NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDNTLMSSP.OID()},
+			MechTokenBytes: []byte(ntlmSignature + "negotiate"),
+		},
+	}
+	if err := setNegotiateToken(req, &st); err != nil {
+		t.Fatalf("error setting token: %v", err)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, 2, resp.ProtoMajor, "request not sent over HTTP/2")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "status code not as expected")
+	assert.Equal(t, spnegoNegTokenRespIncompleteKRB5, resp.Header.Get(HTTPHeaderAuthResponse), "header not as expected")
+}
@@ -0,0 +1,81 @@
+package spnego
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+)
+
+// BackendClientFunc returns the Kerberos client to use when re-authenticating a proxied request to the backend.
+//
+// The identity is that of the user authenticated on the inbound request.
+// Implementations typically return a client built from the user's delegated credentials or one that obtains
+// tickets on behalf of the user via S4U2Proxy. Returning the gateway's own client authenticates to the backend
+// as the gateway rather than the user.
+type BackendClientFunc func(id goidentity.Identity, r *http.Request) (*client.Client, error)
+
+// NewReverseProxy returns a reverse proxy to the target URL that authenticates each outbound request to the backend
+// with SPNEGO using the client returned by the BackendClientFunc.
+//
+// The inbound request must already have been authenticated so that its identity is in the request context,
+// for example by wrapping the proxy with SPNEGOKRB5Authenticate. Use SPNEGOReverseProxy to do both.
+// To auto generate the backend SPN from the target URL pass a null string "".
+func NewReverseProxy(target *url.URL, spn string, backend BackendClientFunc) *httputil.ReverseProxy {
+	p := httputil.NewSingleHostReverseProxy(target)
+	d := p.Director
+	p.Director = func(r *http.Request) {
+		d(r)
+		// Never forward the client's own authorization header to the backend.
+		r.Header.Del(HTTPHeaderAuthRequest)
+	}
+	p.Transport = &proxyTransport{
+		spn:     spn,
+		backend: backend,
+		next:    http.DefaultTransport,
+	}
+	p.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}
+	return p
+}
+
+// SPNEGOReverseProxy returns a handler that authenticates inbound requests via SPNEGO using the keytab provided
+// and then proxies them to the target URL, re-authenticating to the backend with the client returned by the
+// BackendClientFunc.
+func SPNEGOReverseProxy(target *url.URL, spn string, backend BackendClientFunc, kt *keytab.Keytab, settings ...func(*service.Settings)) http.Handler {
+	return SPNEGOKRB5Authenticate(NewReverseProxy(target, spn, backend), kt, settings...)
+}
+
+// proxyTransport sets the SPNEGO header for the backend on outbound proxied requests.
+type proxyTransport struct {
+	spn     string
+	backend BackendClientFunc
+	next    http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *proxyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	id := goidentity.FromHTTPRequestContext(r)
+	if id == nil || !id.Authenticated() {
+		return nil, errors.New("no authenticated identity in the proxied request context")
+	}
+	cl, err := t.backend(id, r)
+	if err != nil {
+		return nil, fmt.Errorf("could not get backend client for %s@%s: %w", id.UserName(), id.Domain(), err)
+	}
+	if cl == nil {
+		return nil, fmt.Errorf("no backend client for %s@%s", id.UserName(), id.Domain())
+	}
+	err = SetSPNEGOHeader(cl, r, t.spn)
+	if err != nil {
+		return nil, fmt.Errorf("could not set SPNEGO header for backend request: %w", err)
+	}
+	return t.next.RoundTrip(r)
+}
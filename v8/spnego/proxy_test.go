@@ -0,0 +1,81 @@
+package spnego
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSPNEGOReverseProxy_NoAuthHeader(t *testing.T) {
+	t.Parallel()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("backend should not be reached without inbound authentication")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	f := func(id goidentity.Identity, r *http.Request) (*client.Client, error) {
+		return nil, errors.New("not expected to be called")
+	}
+	s := httptest.NewServer(SPNEGOReverseProxy(u, "HTTP/backend.test.gokrb5", f, kt))
+	defer s.Close()
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "status code not as expected")
+	assert.Equal(t, HTTPHeaderAuthResponseValueKey, resp.Header.Get(HTTPHeaderAuthResponse), "negotiation header not set by proxy")
+}
+
+func TestNewReverseProxy_BackendClientError(t *testing.T) {
+	t.Parallel()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("backend should not be reached when the backend client cannot be obtained")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	var called bool
+	f := func(id goidentity.Identity, r *http.Request) (*client.Client, error) {
+		called = true
+		assert.Equal(t, "testuser1", id.UserName(), "identity passed to backend client func not as expected")
+		return nil, errors.New("no delegated credentials")
+	}
+	p := NewReverseProxy(u, "HTTP/backend.test.gokrb5", f)
+	id := credentials.New("testuser1", "TEST.GOKRB5")
+	id.SetAuthenticated(true)
+	r := httptest.NewRequest("GET", "http://gateway.test.gokrb5/", nil)
+	r.Header.Set(HTTPHeaderAuthRequest, "Negotiate abc")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, goidentity.AddToHTTPRequestContext(id, r))
+	assert.True(t, called, "backend client func not called")
+	assert.Equal(t, http.StatusBadGateway, w.Code, "status code not as expected")
+}
+
+func TestNewReverseProxy_NoIdentity(t *testing.T) {
+	t.Parallel()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("backend should not be reached without an identity")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	f := func(id goidentity.Identity, r *http.Request) (*client.Client, error) {
+		t.Error("backend client func should not be called without an identity")
+		return nil, nil
+	}
+	p := NewReverseProxy(u, "", f)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "http://gateway.test.gokrb5/", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code, "status code not as expected")
+}
@@ -0,0 +1,99 @@
+package spnego
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// CookieSessionManager is a service.SessionMgr keeping the session in a cookie sealed with AES-GCM, so that clients
+// only perform the Kerberos handshake once per session without the service having to store the sessions. The cookie
+// can neither be read nor modified by the client and expires after the maximum age configured.
+type CookieSessionManager struct {
+	name   string
+	aead   cipher.AEAD
+	maxAge time.Duration
+	// Secure marks the cookie to only be sent over HTTPS. It defaults to true.
+	Secure bool
+}
+
+// NewCookieSessionManager returns a session manager keeping sessions in the cookie of the name provided, sealed with the
+// key, which must be 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256. Services sharing sessions must use
+// the same key, which should be loaded from a secure location. Sessions expire after the maximum age and, as the
+// handler does not serve sessions whose credentials have expired, no later than the client's service ticket.
+//
+//	sm, err := spnego.NewCookieSessionManager("gokrb5", key, 8*time.Hour)
+//	h := spnego.SPNEGOKRB5Authenticate(inner, kt, service.SessionManager(sm))
+func NewCookieSessionManager(name string, key []byte, maxAge time.Duration) (*CookieSessionManager, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create session cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(b)
+	if err != nil {
+		return nil, fmt.Errorf("could not create session cipher: %w", err)
+	}
+	return &CookieSessionManager{
+		name:   name,
+		aead:   aead,
+		maxAge: maxAge,
+		Secure: true,
+	}, nil
+}
+
+// New creates a new session holding the value under the key by setting the session cookie on the response.
+func (m *CookieSessionManager) New(w http.ResponseWriter, r *http.Request, k string, v []byte) error {
+	exp := time.Now().Add(m.maxAge)
+	// The payload is the expiry time followed by the value, sealed with the key of the value as additional data.
+	p := make([]byte, 8, 8+len(v))
+	binary.BigEndian.PutUint64(p, uint64(exp.Unix()))
+	p = append(p, v...)
+	nonce := make([]byte, m.aead.NonceSize(), m.aead.NonceSize()+len(p)+m.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("could not generate session nonce: %w", err)
+	}
+	b := m.aead.Seal(nonce, nonce, p, []byte(m.name+"|"+k))
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.name,
+		Value:    base64.RawURLEncoding.EncodeToString(b),
+		Path:     "/",
+		Expires:  exp,
+		MaxAge:   int(m.maxAge / time.Second),
+		Secure:   m.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Get returns the value under the key in the request's session cookie, or an error if the request does not have a
+// session cookie that is valid and has not expired.
+func (m *CookieSessionManager) Get(r *http.Request, k string) ([]byte, error) {
+	c, err := r.Cookie(m.name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("session cookie not valid: %w", err)
+	}
+	ns := m.aead.NonceSize()
+	if len(b) < ns {
+		return nil, errors.New("session cookie not valid: too short")
+	}
+	p, err := m.aead.Open(nil, b[:ns], b[ns:], []byte(m.name+"|"+k))
+	if err != nil || len(p) < 8 {
+		return nil, errors.New("session cookie not valid")
+	}
+	if time.Now().Unix() > int64(binary.BigEndian.Uint64(p[:8])) {
+		return nil, errors.New("session has expired")
+	}
+	return p[8:], nil
+}
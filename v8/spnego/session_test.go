@@ -0,0 +1,67 @@
+package spnego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCookieSessionManager(t *testing.T) {
+	t.Parallel()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	sm, err := NewCookieSessionManager("gokrb5", key, time.Hour)
+	if err != nil {
+		t.Fatalf("error creating session manager: %v", err)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := sm.New(w, r, "k", []byte("value")); err != nil {
+		t.Fatalf("error creating session: %v", err)
+	}
+	c := w.Result().Cookies()
+	if len(c) != 1 {
+		t.Fatalf("session cookie not set")
+	}
+	assert.True(t, c[0].HttpOnly, "cookie should be HTTP only")
+	assert.True(t, c[0].Secure, "cookie should be secure by default")
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c[0])
+	v, err := sm.Get(r, "k")
+	if err != nil {
+		t.Fatalf("error getting session: %v", err)
+	}
+	assert.Equal(t, []byte("value"), v, "session value not as expected")
+	_, err = sm.Get(r, "other")
+	assert.Error(t, err, "value should only be returned for its key")
+
+	other, _ := NewCookieSessionManager("gokrb5", []byte("fedcba9876543210fedcba9876543210"), time.Hour)
+	_, err = other.Get(r, "k")
+	assert.Error(t, err, "cookie sealed with another key should not be valid")
+
+	tampered := *c[0]
+	tampered.Value = "A" + tampered.Value[1:]
+	if tampered.Value == c[0].Value {
+		tampered.Value = "B" + tampered.Value[1:]
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&tampered)
+	_, err = sm.Get(r, "k")
+	assert.Error(t, err, "modified cookie should not be valid")
+
+	expired, _ := NewCookieSessionManager("gokrb5", key, -time.Minute)
+	w = httptest.NewRecorder()
+	expired.New(w, r, "k", []byte("value"))
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "gokrb5", Value: w.Result().Cookies()[0].Value})
+	_, err = sm.Get(r, "k")
+	assert.Error(t, err, "expired session should not be valid")
+
+	_, err = sm.Get(httptest.NewRequest(http.MethodGet, "/", nil), "k")
+	assert.Error(t, err, "request without a session cookie should not have a session")
+	_, err = NewCookieSessionManager("gokrb5", []byte("short"), time.Hour)
+	assert.Error(t, err, "key of an invalid length should be an error")
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/jcmturner/gokrb5/v8/client"
 	"github.com/jcmturner/gokrb5/v8/gssapi"
 	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/logging"
 	"github.com/jcmturner/gokrb5/v8/service"
 )
 
@@ -19,6 +21,7 @@ type SPNEGO struct {
 	serviceSettings *service.Settings
 	client          *client.Client
 	spn             string
+	channelBindings *gssapi.ChannelBindings
 }
 
 // SPNEGOClient configures the SPNEGO mechanism suitable for client side use.
@@ -44,18 +47,26 @@ func (s *SPNEGO) OID() asn1.ObjectIdentifier {
 
 // AcquireCred is the GSS-API method to acquire a client credential via Kerberos for SPNEGO.
 func (s *SPNEGO) AcquireCred() error {
-	return s.client.AffirmLogin()
+	return s.acquireCred(context.Background())
+}
+
+func (s *SPNEGO) acquireCred(ctx context.Context) error {
+	return s.client.AffirmLoginContext(ctx)
 }
 
 // InitSecContext is the GSS-API method for the client to a generate a context token to the service via Kerberos.
 func (s *SPNEGO) InitSecContext() (gssapi.ContextToken, error) {
-	tkt, key, err := s.client.GetServiceTicket(s.spn)
+	return s.initSecContext(context.Background())
+}
+
+func (s *SPNEGO) initSecContext(ctx context.Context) (gssapi.ContextToken, error) {
+	tkt, key, err := s.client.GetServiceTicketContext(ctx, s.spn)
 	if err != nil {
 		return &SPNEGOToken{}, err
 	}
-	negTokenInit, err := NewNegTokenInitKRB5(s.client, tkt, key)
+	negTokenInit, err := newNegTokenInitKRB5(s.client, tkt, key, s.channelBindings, s.client.ShouldDelegate(s.spn))
 	if err != nil {
-		return &SPNEGOToken{}, fmt.Errorf("could not create NegTokenInit: %v", err)
+		return &SPNEGOToken{}, krberror.WithCorrelationID(fmt.Errorf("could not create NegTokenInit: %w", err), s.client.CorrelationID())
 	}
 	return &SPNEGOToken{
 		Init:         true,
@@ -73,14 +84,15 @@ func (s *SPNEGO) AcceptSecContext(ct gssapi.ContextToken) (bool, context.Context
 		return false, ctx, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "context token provided was not an SPNEGO token"}
 	}
 	t.settings = s.serviceSettings
-	var oid asn1.ObjectIdentifier
+	var krb5 bool
 	if t.Init {
-		oid = t.NegTokenInit.MechTypes[0]
+		_, _, krb5 = KRB5Mech(t.NegTokenInit.MechTypes)
 	}
 	if t.Resp {
-		oid = t.NegTokenResp.SupportedMech
+		// The initiator's NegTokenResp continues the negotiation of the Kerberos mechanism selected.
+		krb5 = len(t.NegTokenResp.SupportedMech) == 0 || IsKRB5Mech(t.NegTokenResp.SupportedMech)
 	}
-	if !(oid.Equal(gssapi.OIDKRB5.OID()) || oid.Equal(gssapi.OIDMSLegacyKRB5.OID())) {
+	if !krb5 {
 		return false, ctx, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "SPNEGO OID of MechToken is not of type KRB5"}
 	}
 	// Flags in the NegInit must be used 	t.NegTokenInit.ReqFlags
@@ -89,10 +101,15 @@ func (s *SPNEGO) AcceptSecContext(ct gssapi.ContextToken) (bool, context.Context
 	return ok, ctx, status
 }
 
-// Log will write to the service's logger if it is configured.
+// Log will write to the service's logger, at logging.LevelInfo, if it is configured. The line holds the correlation ID
+// of the authentication attempt if the service has one.
 func (s *SPNEGO) Log(format string, v ...interface{}) {
-	if s.serviceSettings.Logger() != nil {
-		s.serviceSettings.Logger().Output(2, fmt.Sprintf(format, v...))
+	if l := s.serviceSettings.StructuredLogger(); l != nil {
+		if id := s.serviceSettings.CorrelationID(); id != "" {
+			l.Log(logging.LevelInfo, fmt.Sprintf(format, v...), logging.F(logging.KeyCorrelationID, id))
+			return
+		}
+		l.Log(logging.LevelInfo, fmt.Sprintf(format, v...))
 	}
 }
 
@@ -104,6 +121,8 @@ type SPNEGOToken struct {
 	NegTokenResp NegTokenResp
 	settings     *service.Settings
 	context      context.Context
+	// rawKRB5 indicates the client sent a raw KRB5 token, RFC 4121 section 4.1, wrapped into the NegTokenInit.
+	rawKRB5 bool
 }
 
 // Marshal SPNEGO context token
@@ -113,7 +132,7 @@ func (s *SPNEGOToken) Marshal() ([]byte, error) {
 		hb, _ := asn1.Marshal(gssapi.OIDSPNEGO.OID())
 		tb, err := s.NegTokenInit.Marshal()
 		if err != nil {
-			return b, fmt.Errorf("could not marshal NegTokenInit: %v", err)
+			return b, fmt.Errorf("could not marshal NegTokenInit: %w", err)
 		}
 		b = append(hb, tb...)
 		return asn1tools.AddASNAppTag(b, 0), nil
@@ -121,7 +140,7 @@ func (s *SPNEGOToken) Marshal() ([]byte, error) {
 	if s.Resp {
 		b, err := s.NegTokenResp.Marshal()
 		if err != nil {
-			return b, fmt.Errorf("could not marshal NegTokenResp: %v", err)
+			return b, fmt.Errorf("could not marshal NegTokenResp: %w", err)
 		}
 		return b, nil
 	}
@@ -141,7 +160,7 @@ func (s *SPNEGOToken) Unmarshal(b []byte) error {
 		var oid asn1.ObjectIdentifier
 		r, err = asn1.UnmarshalWithParams(b, &oid, fmt.Sprintf("application,explicit,tag:%v", 0))
 		if err != nil {
-			return fmt.Errorf("not a valid SPNEGO token: %v", err)
+			return fmt.Errorf("not a valid SPNEGO token: %w", err)
 		}
 		// Check the OID is the SPNEGO OID value
 		SPNEGOOID := gssapi.OIDSPNEGO.OID()
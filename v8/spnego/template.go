@@ -0,0 +1,200 @@
+package spnego
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/chksumtype"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// TemplateInitiator is an Initiator that generates SPNEGO tokens using a gokrb5 client for clients that send many
+// requests to the same services, for example queue consumers.
+//
+// The marshaled service ticket and the other parts of the token that do not change between requests are computed
+// once for each SPN so that only the authenticator is generated and encrypted for each token. The template for an
+// SPN is computed again when the client obtains a new ticket for it.
+// The tokens generated are the same as those of SetSPNEGOHeader.
+type TemplateInitiator struct {
+	cl        *client.Client
+	templates atomic.Value // map[string]*tokenTemplate
+	mux       sync.Mutex
+}
+
+// tokenTemplate holds the parts of the SPNEGO token for a service ticket that do not change between requests.
+type tokenTemplate struct {
+	tkt        messages.Ticket
+	sessionKey types.EncryptionKey
+	usage      uint32
+	cksum      types.Checksum
+	// apReqPrefix is the marshaled AP_REQ fields preceding the encrypted authenticator
+	apReqPrefix []byte
+}
+
+// NewTemplateInitiator returns a TemplateInitiator generating tokens with the client provided.
+func NewTemplateInitiator(cl *client.Client) *TemplateInitiator {
+	t := &TemplateInitiator{cl: cl}
+	t.templates.Store(make(map[string]*tokenTemplate))
+	return t
+}
+
+// Close discards the token templates held. The client is not closed.
+func (t *TemplateInitiator) Close() error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.templates.Store(make(map[string]*tokenTemplate))
+	return nil
+}
+
+// InitSecContext returns the marshaled SPNEGO token to send to the service with the SPN provided.
+func (t *TemplateInitiator) InitSecContext(spn string) ([]byte, error) {
+	b, err := t.initSecContext(spn)
+	return b, krberror.WithCorrelationID(err, t.cl.CorrelationID())
+}
+
+func (t *TemplateInitiator) initSecContext(spn string) ([]byte, error) {
+	tkt, key, err := t.cl.GetServiceTicket(spn)
+	if err != nil {
+		return nil, err
+	}
+	tt, err := t.template(spn, tkt, key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create token template: %w", err)
+	}
+	auth, err := types.NewAuthenticator(t.cl.Credentials.Domain(), t.cl.Credentials.CName())
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator")
+	}
+	auth.Cksum = tt.cksum
+	return tt.token(auth)
+}
+
+// template returns the template for the SPN, computing it if the ticket has changed.
+func (t *TemplateInitiator) template(spn string, tkt messages.Ticket, key types.EncryptionKey) (*tokenTemplate, error) {
+	if tt, ok := t.templates.Load().(map[string]*tokenTemplate)[spn]; ok && tt.matches(tkt, key) {
+		return tt, nil
+	}
+	tt, err := newTokenTemplate(tkt, key, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf})
+	if err != nil {
+		return nil, err
+	}
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	old := t.templates.Load().(map[string]*tokenTemplate)
+	m := make(map[string]*tokenTemplate, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	m[spn] = tt
+	t.templates.Store(m)
+	return tt, nil
+}
+
+// newTokenTemplate computes the template for the service ticket and session key.
+func newTokenTemplate(tkt messages.Ticket, sessionKey types.EncryptionKey, gssFlags []int) (*tokenTemplate, error) {
+	tb, err := tkt.Marshal()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling ticket")
+	}
+	var fields [][]byte
+	for i, v := range []interface{}{iana.PVNO, msgtype.KRB_AP_REQ, types.NewKrbFlags()} {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling AP_REQ")
+		}
+		fields = append(fields, derExplicit(i, b))
+	}
+	fields = append(fields, derExplicit(3, tb))
+	usage := uint32(keyusage.AP_REQ_AUTHENTICATOR)
+	if tkt.SName.NameString[0] == "krbtgt" {
+		usage = keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR
+	}
+	return &tokenTemplate{
+		tkt:        tkt,
+		sessionKey: sessionKey,
+		usage:      usage,
+		cksum: types.Checksum{
+			CksumType: chksumtype.GSSAPI,
+			Checksum:  newAuthenticatorChksum(gssFlags),
+		},
+		apReqPrefix: bytes.Join(fields, nil),
+	}, nil
+}
+
+// matches indicates if the template is for the ticket and session key provided.
+func (tt *tokenTemplate) matches(tkt messages.Ticket, key types.EncryptionKey) bool {
+	return tt.tkt.EncPart.KVNO == tkt.EncPart.KVNO &&
+		bytes.Equal(tt.tkt.EncPart.Cipher, tkt.EncPart.Cipher) &&
+		bytes.Equal(tt.sessionKey.KeyValue, key.KeyValue)
+}
+
+// token returns the marshaled SPNEGO NegTokenInit with the authenticator provided.
+func (tt *tokenTemplate) token(auth types.Authenticator) ([]byte, error) {
+	ab, err := auth.Marshal()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "marshaling error of EncryptedData form of Authenticator")
+	}
+	ed, err := crypto.GetEncryptedData(ab, tt.sessionKey, tt.usage, tt.tkt.EncPart.KVNO)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error encrypting Authenticator")
+	}
+	return tt.marshal(ed)
+}
+
+// marshal assembles the SPNEGO NegTokenInit from the template and encrypted authenticator.
+func (tt *tokenTemplate) marshal(ed types.EncryptedData) ([]byte, error) {
+	edb, err := ed.Marshal()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling encrypted authenticator")
+	}
+	apReq := asn1tools.AddASNAppTag(derTLV(0x30, tt.apReqPrefix, derExplicit(4, edb)), asnAppTag.APREQ)
+	krb5Tkn := asn1tools.AddASNAppTag(append(append(append([]byte{}, templateKRB5OID...), templateTokID...), apReq...), 0)
+	negTokenInit := derExplicit(0, derTLV(0x30, templateMechTypes, derExplicit(2, derTLV(0x04, krb5Tkn))))
+	return asn1tools.AddASNAppTag(append(append([]byte{}, templateSPNEGOOID...), negTokenInit...), 0), nil
+}
+
+// The marshaled OIDs, token ID and mechanism types list that are the same in all tokens.
+var (
+	templateKRB5OID, _   = asn1.Marshal(gssapi.OIDKRB5.OID())
+	templateSPNEGOOID, _ = asn1.Marshal(gssapi.OIDSPNEGO.OID())
+	templateTokID, _     = hex.DecodeString(TOK_ID_KRB_AP_REQ)
+	templateMechTypes    = func() []byte {
+		b, _ := asn1.Marshal([]asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()})
+		return derExplicit(0, b)
+	}()
+)
+
+// derExplicit wraps the bytes in an explicit context specific tag.
+func derExplicit(tag int, b []byte) []byte {
+	return derTLV(byte(0xa0|tag), b)
+}
+
+// derTLV returns the DER encoding of the concatenated values with the tag provided.
+func derTLV(tag byte, vs ...[]byte) []byte {
+	var l int
+	for _, v := range vs {
+		l += len(v)
+	}
+	lb := asn1tools.MarshalLengthBytes(l)
+	b := make([]byte, 0, 1+len(lb)+l)
+	b = append(b, tag)
+	b = append(b, lb...)
+	for _, v := range vs {
+		b = append(b, v...)
+	}
+	return b
+}
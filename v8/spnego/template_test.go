@@ -0,0 +1,168 @@
+package spnego
+
+import (
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/test"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testTemplateTicket(t testing.TB) (*keytab.Keytab, *client.Client, messages.Ticket, types.EncryptionKey) {
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	b, _ = hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	ckt := keytab.New()
+	ckt.Unmarshal(b)
+	cl := client.NewWithKeytab("testuser1", "TEST.GOKRB5", ckt, config.New())
+	now := time.Now().UTC()
+	tkt, key, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5"), "TEST.GOKRB5",
+		types.NewKrbFlags(), kt, 18, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating ticket: %v", err)
+	}
+	return kt, cl, tkt, key
+}
+
+func TestTokenTemplate_marshal(t *testing.T) {
+	t.Parallel()
+	_, cl, tkt, key := testTemplateTicket(t)
+	flags := []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}
+	tt, err := newTokenTemplate(tkt, key, flags)
+	if err != nil {
+		t.Fatalf("error creating template: %v", err)
+	}
+	auth, _ := krb5TokenAuthenticator(cl.Credentials, flags)
+	ab, _ := auth.Marshal()
+	ed, err := crypto.GetEncryptedData(ab, key, keyusage.AP_REQ_AUTHENTICATOR, tkt.EncPart.KVNO)
+	if err != nil {
+		t.Fatalf("error encrypting authenticator: %v", err)
+	}
+
+	// Reference token marshaled in full
+	mt, _ := NewKRB5TokenAPREQ(cl, tkt, key, flags, []int{})
+	mt.APReq.EncryptedAuthenticator = ed
+	mtb, err := mt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB5 token: %v", err)
+	}
+	st := SPNEGOToken{
+		Init: true,
+		NegTokenInit: NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
+			MechTokenBytes: mtb,
+		},
+	}
+	want, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling SPNEGO token: %v", err)
+	}
+	b, err := tt.marshal(ed)
+	if err != nil {
+		t.Fatalf("error marshaling token from template: %v", err)
+	}
+	assert.Equal(t, want, b, "token from template not as expected")
+}
+
+func TestTokenTemplate_token(t *testing.T) {
+	t.Parallel()
+	kt, cl, tkt, key := testTemplateTicket(t)
+	tt, err := newTokenTemplate(tkt, key, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf})
+	if err != nil {
+		t.Fatalf("error creating template: %v", err)
+	}
+	assert.True(t, tt.matches(tkt, key), "template should match its ticket")
+	_, _, otkt, okey := testTemplateTicket(t)
+	assert.False(t, tt.matches(otkt, okey), "template should not match a new ticket")
+
+	// Each token generated must be accepted by the service
+	for i := 0; i < 2; i++ {
+		auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+		auth.Cksum = tt.cksum
+		b, err := tt.token(auth)
+		if err != nil {
+			t.Fatalf("error generating token: %v", err)
+		}
+		var st SPNEGOToken
+		err = st.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("error unmarshaling token: %v", err)
+		}
+		var mt KRB5Token
+		err = mt.Unmarshal(st.NegTokenInit.MechTokenBytes)
+		if err != nil {
+			t.Fatalf("error unmarshaling KRB5 token: %v", err)
+		}
+		ok, _, err := service.VerifyAPREQ(&mt.APReq, service.NewSettings(kt, service.DecodePAC(false)))
+		if !ok || err != nil {
+			t.Fatalf("token %d not accepted: %v", i, err)
+		}
+	}
+}
+
+func TestTemplateInitiator(t *testing.T) {
+	test.Integration(t)
+
+	s := httpServer()
+	defer s.Close()
+	init := NewTemplateInitiator(getClient())
+	for i := 0; i < 3; i++ {
+		r, _ := http.NewRequest("GET", s.URL, nil)
+		err := SetInitiatorSPNEGOHeader(init, r, "HTTP/host.test.gokrb5")
+		if err != nil {
+			t.Fatalf("error setting client's SPNEGO header: %v", err)
+		}
+		httpResp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("Request error: %v\n", err)
+		}
+		assert.Equal(t, http.StatusOK, httpResp.StatusCode, "Status code in response to client SPNEGO request not as expected")
+	}
+}
+
+func BenchmarkTemplateInitiator_InitSecContext(b *testing.B) {
+	_, cl, tkt, key := testTemplateTicket(b)
+	tt, err := newTokenTemplate(tkt, key, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf})
+	if err != nil {
+		b.Fatalf("error creating template: %v", err)
+	}
+	b.Run("template", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+			auth.Cksum = tt.cksum
+			if _, err := tt.token(auth); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			nt, err := NewNegTokenInitKRB5(cl, tkt, key)
+			if err != nil {
+				b.Fatal(err)
+			}
+			st := SPNEGOToken{Init: true, NegTokenInit: nt}
+			if _, err := st.Marshal(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
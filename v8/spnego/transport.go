@@ -0,0 +1,101 @@
+package spnego
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+)
+
+// Transport is a SPNEGO enabled http.RoundTripper for use as the Transport of an http.Client. Unlike setting the
+// SPNEGO header on every request up front, the Transport only authenticates a request once the service challenges it
+// with a 401 Unauthorized response and a bare Negotiate WWW-Authenticate header, so service tickets are only obtained
+// for, and sent to, the services that require them.
+type Transport struct {
+	client *client.Client
+	base   http.RoundTripper
+	spn    string
+}
+
+// NewTransport returns a SPNEGO enabled http.RoundTripper authenticating with the gokrb5 client and sending the
+// requests with the base http.RoundTripper, or http.DefaultTransport if nil. To auto generate the SPN from each
+// request pass a null string "". The SPN provided is only used for the host of the request initially sent: when the
+// http.Client follows a redirect to another host the SPN is generated from the redirected request.
+func NewTransport(cl *client.Client, base http.RoundTripper, spn string) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		client: cl,
+		base:   base,
+		spn:    spn,
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface. The request is sent without authentication and, if the
+// service challenges it, sent again on a copy of the request with the SPNEGO header set. The request body is sent again
+// using the request's GetBody function, which http.NewRequest sets for in-memory bodies; other bodies are read into
+// memory before the request is first sent.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	req, err := replayableRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || !respUnauthorizedNegotiate(resp) {
+		return resp, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	ar := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if ar.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("could not get request body to send again: %w", err)
+		}
+	}
+	if err := SetSPNEGOHeaderChannelBindings(ar.Context(), t.client, ar, t.requestSPN(ar), tlsChannelBindings(resp)); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(ar)
+}
+
+// requestSPN returns the SPN to use for the request, which is generated from the request if the http.Client followed a
+// redirect to a host other than the one of the request initially sent.
+func (t *Transport) requestSPN(r *http.Request) string {
+	return redirectedSPN(r, t.spn)
+}
+
+// redirectedSPN returns the SPN provided for the request, or a null string to generate it from the request if the
+// http.Client followed a redirect to a host other than the one of the request initially sent.
+func redirectedSPN(r *http.Request, spn string) string {
+	first := r
+	for first.Response != nil && first.Response.Request != nil {
+		first = first.Response.Request
+	}
+	if first.URL.Host != r.URL.Host {
+		return ""
+	}
+	return spn
+}
+
+// replayableRequest returns the request, or a copy of it with its body read into memory if it cannot be obtained again
+// with the request's GetBody function, so that it can be sent again once authenticated.
+func replayableRequest(r *http.Request) (*http.Request, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.GetBody != nil {
+		return r, nil
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read request body: %w", err)
+	}
+	req := r.Clone(r.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	return req, nil
+}
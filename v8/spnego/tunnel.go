@@ -0,0 +1,190 @@
+package spnego
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+)
+
+// HTTP headers used to authenticate to a proxy.
+const (
+	// HTTPHeaderProxyAuthRequest is the header that will hold authn/z information for the proxy.
+	HTTPHeaderProxyAuthRequest = "Proxy-Authorization"
+	// HTTPHeaderProxyAuthResponse is the header that will hold SPNEGO data from the proxy.
+	HTTPHeaderProxyAuthResponse = "Proxy-Authenticate"
+)
+
+// TunnelDialer establishes TCP connections through an HTTP proxy using the CONNECT method, authenticating to the
+// proxy with SPNEGO. The connections returned carry arbitrary protocols, such as SSH or AMQP, to the target address.
+type TunnelDialer struct {
+	// Dialer is used to connect to the proxy. If nil a zero net.Dialer is used.
+	Dialer    *net.Dialer
+	proxy     string
+	spn       string
+	krb5Cl    *client.Client
+	initiator Initiator
+}
+
+// NewTunnelDialer returns a TunnelDialer connecting through the proxy at the address, in host:port form, and
+// authenticating with the gokrb5 client.
+// To auto generate the proxy's SPN, HTTP/<proxy host>, pass a null string "".
+func NewTunnelDialer(cl *client.Client, proxy, spn string) *TunnelDialer {
+	return &TunnelDialer{
+		proxy:  proxy,
+		spn:    spn,
+		krb5Cl: cl,
+	}
+}
+
+// NewInitiatorTunnelDialer returns a TunnelDialer connecting through the proxy at the address, in host:port form,
+// that obtains its tokens from the Initiator provided.
+// To auto generate the proxy's SPN, HTTP/<proxy host>, pass a null string "".
+func NewInitiatorTunnelDialer(init Initiator, proxy, spn string) *TunnelDialer {
+	return &TunnelDialer{
+		proxy:     proxy,
+		spn:       spn,
+		initiator: init,
+	}
+}
+
+// Dial connects to the address through the proxy. Only TCP networks are supported.
+func (d *TunnelDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address through the proxy using the context provided. Only TCP networks are
+// supported. The context bounds getting the ticket for the proxy, the connection to the proxy and the CONNECT exchange
+// but not the use of the connection returned.
+func (d *TunnelDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("network %s not supported for tunneling", network)
+	}
+	spn, err := d.proxySPN()
+	if err != nil {
+		return nil, err
+	}
+	tkn, err := d.token(ctx, spn)
+	if err != nil {
+		return nil, err
+	}
+	nd := d.Dialer
+	if nd == nil {
+		nd = new(net.Dialer)
+	}
+	conn, err := nd.DialContext(ctx, "tcp", d.proxy)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to proxy %s: %w", d.proxy, err)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	// Close the connection if the context is done before the CONNECT exchange completes.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	c, err := connect(conn, addr, tkn)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// Transport returns an http.Transport, with the settings of http.DefaultTransport, that sends the requests of an
+// http.Client to their servers through tunnels to the proxy established by the TunnelDialer, so each connection is
+// authenticated to the proxy on its CONNECT request. Requests to both HTTPS and HTTP servers are tunneled and the
+// environment's proxy settings are not used.
+func (d *TunnelDialer) Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = d.DialContext
+	return t
+}
+
+// proxySPN returns the SPN of the proxy.
+func (d *TunnelDialer) proxySPN() (string, error) {
+	if d.spn != "" {
+		return d.spn, nil
+	}
+	h, _, err := net.SplitHostPort(d.proxy)
+	if err != nil {
+		return "", fmt.Errorf("could not get host from proxy address %s: %w", d.proxy, err)
+	}
+	return "HTTP/" + h, nil
+}
+
+// token returns the SPNEGO token to authenticate to the proxy.
+func (d *TunnelDialer) token(ctx context.Context, spn string) ([]byte, error) {
+	if d.initiator != nil {
+		b, err := d.initiator.InitSecContext(spn)
+		if err != nil {
+			return nil, fmt.Errorf("could not initialize context: %w", err)
+		}
+		return b, nil
+	}
+	d.krb5Cl.Log("using SPN %s for proxy tunnel", spn)
+	b, err := clientToken(ctx, d.krb5Cl, spn, nil)
+	return b, krberror.WithCorrelationID(err, d.krb5Cl.CorrelationID())
+}
+
+// connect sends the CONNECT request for the address with the token over the connection to the proxy and reads the
+// response. The connection returned includes any data sent by the target that has already been read.
+func connect(conn net.Conn, addr string, tkn []byte) (net.Conn, error) {
+	r := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	r.Header.Set(HTTPHeaderProxyAuthRequest, "Negotiate "+base64.StdEncoding.EncodeToString(tkn))
+	if err := r.Write(conn); err != nil {
+		return nil, fmt.Errorf("could not send CONNECT request to proxy: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, r)
+	if err != nil {
+		return nil, fmt.Errorf("could not read CONNECT response from proxy: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return nil, fmt.Errorf("proxy authentication failed: %s", resp.Status)
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads are first satisfied by data already buffered.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read implements the io.Reader interface.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
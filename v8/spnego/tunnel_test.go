@@ -0,0 +1,134 @@
+package spnego
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tunnelProxy accepts a single CONNECT request, replying with the status provided, and then echoes data received.
+func tunnelProxy(t *testing.T, status int, greeting string) (string, chan *http.Request) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	reqs := make(chan *http.Request, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		r, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		reqs <- r
+		resp := &http.Response{StatusCode: status, ProtoMajor: 1, ProtoMinor: 1, Request: r}
+		resp.Write(c)
+		if status != http.StatusOK {
+			return
+		}
+		io.WriteString(c, greeting)
+		io.Copy(c, br)
+	}()
+	return l.Addr().String(), reqs
+}
+
+func TestTunnelDialer(t *testing.T) {
+	t.Parallel()
+	addr, reqs := tunnelProxy(t, http.StatusOK, "SSH-2.0-test\r\n")
+	init := new(testInitiator)
+	d := NewInitiatorTunnelDialer(init, addr, "")
+	c, err := d.Dial("tcp", "target.test.gokrb5:22")
+	if err != nil {
+		t.Fatalf("error dialing through proxy: %v", err)
+	}
+	defer c.Close()
+	r := <-reqs
+	assert.Equal(t, http.MethodConnect, r.Method, "request method not as expected")
+	assert.Equal(t, "target.test.gokrb5:22", r.Host, "CONNECT target not as expected")
+	assert.Equal(t, "Negotiate "+base64.StdEncoding.EncodeToString([]byte("token")), r.Header.Get(HTTPHeaderProxyAuthRequest), "proxy authorization header not as expected")
+	assert.Equal(t, "HTTP/127.0.0.1", init.spn, "proxy SPN not as expected")
+
+	br := bufio.NewReader(c)
+	l, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("error reading greeting: %v", err)
+	}
+	assert.Equal(t, "SSH-2.0-test\r\n", l, "data sent by the target not as expected")
+	io.WriteString(c, "ping\n")
+	l, err = br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("error reading echo: %v", err)
+	}
+	assert.Equal(t, "ping\n", l, "echoed data not as expected")
+}
+
+func TestTunnelDialer_Rejected(t *testing.T) {
+	t.Parallel()
+	addr, _ := tunnelProxy(t, http.StatusProxyAuthRequired, "")
+	d := NewInitiatorTunnelDialer(new(testInitiator), addr, "HTTP/proxy.test.gokrb5")
+	_, err := d.Dial("tcp", "target.test.gokrb5:22")
+	assert.Error(t, err, "dial should fail when proxy authentication fails")
+	_, err = d.Dial("udp", "target.test.gokrb5:53")
+	assert.Error(t, err, "dial should fail for a non TCP network")
+}
+
+func TestTunnelDialer_Transport(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer l.Close()
+	reqs := make(chan *http.Request, 2)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		br := bufio.NewReader(c)
+		// The CONNECT request and then the request tunneled to the target.
+		for _, body := range []string{"", "from target"} {
+			r, err := http.ReadRequest(br)
+			if err != nil {
+				return
+			}
+			reqs <- r
+			resp := &http.Response{StatusCode: http.StatusOK, ProtoMajor: 1, ProtoMinor: 1, Request: r, Header: make(http.Header)}
+			if body != "" {
+				resp.Body = ioutil.NopCloser(strings.NewReader(body))
+				resp.ContentLength = int64(len(body))
+			}
+			resp.Write(c)
+		}
+	}()
+	d := NewInitiatorTunnelDialer(new(testInitiator), l.Addr().String(), "")
+	httpCl := &http.Client{Transport: d.Transport()}
+	resp, err := httpCl.Get("http://target.test.gokrb5/path")
+	if err != nil {
+		t.Fatalf("error making request through proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "from target", string(b), "response not as expected")
+	r := <-reqs
+	assert.Equal(t, http.MethodConnect, r.Method, "request method not as expected")
+	assert.Equal(t, "target.test.gokrb5:80", r.Host, "CONNECT target not as expected")
+	assert.Equal(t, "Negotiate "+base64.StdEncoding.EncodeToString([]byte("token")), r.Header.Get(HTTPHeaderProxyAuthRequest), "proxy authorization header not as expected")
+	r = <-reqs
+	assert.Equal(t, "/path", r.URL.Path, "tunneled request not as expected")
+	assert.Empty(t, r.Header.Get(HTTPHeaderProxyAuthRequest), "proxy authorization should not be sent to the target")
+}
@@ -0,0 +1,62 @@
+package spnego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+)
+
+// WebSocketHeader returns the header to send with the WebSocket opening handshake to the ws or wss URL, authenticating
+// the gokrb5 client with a SPNEGO token requesting mutual authentication, and the function verifying the AP_REP in the
+// server's handshake response. To auto generate the SPN from the URL pass a null string "".
+//
+// The header is passed to the dialers of WebSocket libraries, such as the DialContext method of gorilla/websocket's
+// Dialer or the HTTPHeader of nhooyr.io/websocket's DialOptions, which return the handshake response to verify:
+//
+//	h, verify, err := spnego.WebSocketHeader(ctx, cl, "wss://host.example.com/stream", "")
+//	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, "wss://host.example.com/stream", h)
+//	if err == nil {
+//		err = verify(resp)
+//	}
+//
+// The server only authenticates itself if it sends its WWW-Authenticate header in the handshake response. As the TLS
+// certificate of the server is not known before dialing, the token is not bound to the TLS connection.
+func WebSocketHeader(ctx context.Context, cl *client.Client, rawurl, spn string) (http.Header, func(*http.Response) error, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not parse WebSocket URL: %w", err)
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, nil, fmt.Errorf("URL scheme %s is not a WebSocket scheme", u.Scheme)
+	}
+	r, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	r = r.WithContext(ctx)
+	c := &Client{krb5Client: cl, spn: spn, mutual: true}
+	m, err := c.setMutualNegotiateHeader(r, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := make(http.Header)
+	h.Set(HTTPHeaderAuthRequest, r.Header.Get(HTTPHeaderAuthRequest))
+	return h, func(resp *http.Response) error {
+		if resp == nil {
+			return errors.New("no handshake response to verify")
+		}
+		if err := m.verify(resp); err != nil {
+			return fmt.Errorf("mutual authentication failed: %w", err)
+		}
+		return nil
+	}, nil
+}
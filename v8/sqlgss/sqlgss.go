@@ -0,0 +1,119 @@
+// Package sqlgss provides the GSSAPI Kerberos handshake in the bytes in, bytes out form expected by database drivers
+// so that they can authenticate with a gokrb5 client without driver specific forks.
+//
+// GSS satisfies the pgconn.GSS interface of github.com/jackc/pgx/v5 and can be registered as its GSS provider:
+//
+//	pgconn.RegisterGSSProvider(func() pgconn.GSS { return sqlgss.NewGSS(cl) })
+//
+// Authenticator satisfies the integratedauth.IntegratedAuthenticator interface of github.com/microsoft/go-mssqldb:
+//
+//	integratedauth.SetIntegratedAuthenticationProvider("krb5", integratedauth.ProviderFunc(
+//		func(cfg msdsn.Config) (integratedauth.IntegratedAuthenticator, error) {
+//			return sqlgss.NewAuthenticator(cl, cfg.ServerSPN), nil
+//		}))
+//
+// Both request mutual authentication and verify the server's AP_REP when it is returned.
+package sqlgss
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/sasl"
+)
+
+// GSS performs the client side of a GSSAPI Kerberos handshake with a database server. A GSS is used for a single
+// authentication.
+type GSS struct {
+	client *client.Client
+	mux    sync.Mutex
+	sc     *sasl.Client
+	spn    string
+	done   bool
+}
+
+// NewGSS returns a GSS authenticating with the gokrb5 client.
+func NewGSS(cl *client.Client) *GSS {
+	return &GSS{client: cl}
+}
+
+// GetInitToken returns the initial token for the service running on the host. The service principal name is formed
+// as service/host, for example postgres/db1.example.com.
+func (g *GSS) GetInitToken(host, service string) ([]byte, error) {
+	return g.GetInitTokenFromSPN(service + "/" + host)
+}
+
+// GetInitTokenFromSPN returns the initial token for the service principal name.
+func (g *GSS) GetInitTokenFromSPN(spn string) ([]byte, error) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.sc != nil {
+		return nil, errors.New("handshake has already been initiated")
+	}
+	g.sc = sasl.NewClient(g.client)
+	g.spn = spn
+	b, _, err := g.sc.InitSecContext(spn, nil)
+	if err != nil {
+		g.sc = nil
+		return nil, err
+	}
+	return b, nil
+}
+
+// Continue processes the token returned by the server. It returns true once the handshake is complete, in which case
+// there is no token to send to the server.
+func (g *GSS) Continue(inToken []byte) (bool, []byte, error) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if g.sc == nil {
+		return false, nil, errors.New("handshake has not been initiated")
+	}
+	if g.done {
+		return false, nil, errors.New("handshake is already complete")
+	}
+	if len(inToken) < 1 {
+		// The server accepted the AP_REQ without returning an AP_REP.
+		g.done = true
+		return true, nil, nil
+	}
+	if _, _, err := g.sc.InitSecContext(g.spn, inToken); err != nil {
+		return false, nil, fmt.Errorf("could not verify server token: %w", err)
+	}
+	g.done = true
+	return true, nil, nil
+}
+
+// Authenticator performs the client side of a GSSAPI Kerberos handshake with a database server for a fixed service
+// principal name. An Authenticator is used for a single authentication.
+type Authenticator struct {
+	gss *GSS
+	spn string
+}
+
+// NewAuthenticator returns an Authenticator authenticating to the service principal name with the gokrb5 client.
+func NewAuthenticator(cl *client.Client, spn string) *Authenticator {
+	return &Authenticator{gss: NewGSS(cl), spn: spn}
+}
+
+// InitialBytes returns the initial token to send to the server.
+func (a *Authenticator) InitialBytes() ([]byte, error) {
+	return a.gss.GetInitTokenFromSPN(a.spn)
+}
+
+// NextBytes processes the token returned by the server and returns the token to send in reply, which is nil once
+// the handshake is complete.
+func (a *Authenticator) NextBytes(b []byte) ([]byte, error) {
+	_, out, err := a.gss.Continue(b)
+	return out, err
+}
+
+// Free releases the security context of the handshake.
+func (a *Authenticator) Free() {
+	a.gss.mux.Lock()
+	defer a.gss.mux.Unlock()
+	if a.gss.sc != nil {
+		a.gss.sc.DeleteSecContext()
+	}
+}
@@ -0,0 +1,121 @@
+package sqlgss
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/test/krbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSPN = "postgres/db.test.gokrb5"
+
+func testSetup(t *testing.T) (*client.Client, *service.Settings) {
+	t.Helper()
+	k, err := krbtest.NewKDC("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	t.Cleanup(func() { k.Close() })
+	if err := k.AddPrincipal(testSPN, "servicepassword"); err != nil {
+		t.Fatalf("error adding service principal: %v", err)
+	}
+	kt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	cl, err := k.NewClient("testuser1")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	return cl, service.NewSettings(kt, service.DecodePAC(false))
+}
+
+// accept verifies the AP_REQ within the token and returns a token containing the AP_REP.
+func accept(t *testing.T, s *service.Settings, token []byte) []byte {
+	t.Helper()
+	var mt spnego.KRB5Token
+	if err := mt.Unmarshal(token); err != nil {
+		t.Fatalf("error unmarshaling AP_REQ token: %v", err)
+	}
+	ok, _, err := service.VerifyAPREQ(&mt.APReq, s)
+	if !ok {
+		t.Fatalf("AP_REQ not verified: %v", err)
+	}
+	key := mt.APReq.Ticket.DecryptedEncPart.Key
+	b, err := asn1.Marshal(messages.EncAPRepPart{CTime: mt.APReq.Authenticator.CTime, Cusec: mt.APReq.Authenticator.Cusec})
+	if err != nil {
+		t.Fatalf("error marshaling AP_REP encrypted part: %v", err)
+	}
+	encPart, err := crypto.GetEncryptedData(asn1tools.AddASNAppTag(b, asnAppTag.EncAPRepPart), key, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		t.Fatalf("error encrypting AP_REP: %v", err)
+	}
+	b, err = asn1.Marshal(messages.APRep{PVNO: 5, MsgType: msgtype.KRB_AP_REP, EncPart: encPart})
+	if err != nil {
+		t.Fatalf("error marshaling AP_REP: %v", err)
+	}
+	oid, _ := asn1.Marshal(gssapi.OIDKRB5.OID())
+	tb := append(oid, 0x02, 0x00)
+	tb = append(tb, asn1tools.AddASNAppTag(b, asnAppTag.APREP)...)
+	return asn1tools.AddASNAppTag(tb, 0)
+}
+
+func TestGSS(t *testing.T) {
+	t.Parallel()
+	cl, s := testSetup(t)
+
+	g := NewGSS(cl)
+	_, _, err := g.Continue([]byte{1})
+	assert.Error(t, err, "continue before the initial token should fail")
+	b, err := g.GetInitToken("db.test.gokrb5", "postgres")
+	if err != nil {
+		t.Fatalf("error getting initial token: %v", err)
+	}
+	_, err = g.GetInitTokenFromSPN(testSPN)
+	assert.Error(t, err, "a second initial token should not be returned")
+	done, out, err := g.Continue(accept(t, s, b))
+	if err != nil {
+		t.Fatalf("error continuing handshake: %v", err)
+	}
+	assert.True(t, done, "handshake should be complete")
+	assert.Nil(t, out, "no token should be returned")
+	_, _, err = g.Continue(nil)
+	assert.Error(t, err, "continue after completion should fail")
+
+	g = NewGSS(cl)
+	b, err = g.GetInitTokenFromSPN(testSPN)
+	if err != nil {
+		t.Fatalf("error getting initial token: %v", err)
+	}
+	rep := accept(t, s, b)
+	rep[len(rep)-1] ^= 0xff
+	_, _, err = g.Continue(rep)
+	assert.Error(t, err, "a corrupted AP_REP should not be accepted")
+}
+
+func TestAuthenticator(t *testing.T) {
+	t.Parallel()
+	cl, s := testSetup(t)
+	a := NewAuthenticator(cl, testSPN)
+	defer a.Free()
+	b, err := a.InitialBytes()
+	if err != nil {
+		t.Fatalf("error getting initial bytes: %v", err)
+	}
+	out, err := a.NextBytes(accept(t, s, b))
+	if err != nil {
+		t.Fatalf("error processing server token: %v", err)
+	}
+	assert.Nil(t, out, "no token should be returned")
+}
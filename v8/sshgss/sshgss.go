@@ -0,0 +1,240 @@
+// Package sshgss implements the gssapi-with-mic SSH user authentication method of RFC 4462 with the Kerberos V5
+// mechanism, for Kerberos single sign-on with Go SSH clients and servers. It does not depend on golang.org/x/crypto/ssh:
+// Client satisfies the ssh.GSSAPIClient interface and Server the ssh.GSSAPIServer interface of that package.
+//
+// The client authenticates with a gokrb5 client to the host principal of the server, host/<host>:
+//
+//	auth := ssh.GSSAPIWithMICAuthMethod(sshgss.NewClient(cl), "server.example.com")
+//	conn, err := ssh.Dial("tcp", "server.example.com:22", &ssh.ClientConfig{User: "user", Auth: []ssh.AuthMethod{auth}, ...})
+//
+// The server verifies the client's AP_REQ with its keytab. A Server can be shared by the connections of a ServerConfig,
+// as the ssh package does, as it tells their security contexts apart by the SSH session ID:
+//
+//	gss := sshgss.NewServer(kt)
+//	cfg := &ssh.ServerConfig{GSSAPIWithMICConfig: &ssh.GSSAPIWithMICConfig{Server: gss, AllowLogin: allowLogin}}
+//	cfg.AddHostKey(hostKey)
+//	sconn, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+//
+// AllowLogin is passed the authenticated principal, as name@REALM, and can inspect the client's credentials, such as
+// its AD group SIDs, with the Server's Credentials method given the connection's session ID.
+package sshgss
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/seccontext"
+	"github.com/jcmturner/gokrb5/v8/service"
+)
+
+// Client performs the client side of gssapi-with-mic authentication with a gokrb5 client, satisfying the
+// ssh.GSSAPIClient interface. It requests the context flags of seccontext.NewSettings, including mutual authentication
+// and the integrity protection the MIC of the authentication request needs, unless configured otherwise.
+type Client struct {
+	client   *client.Client
+	settings []func(*seccontext.Settings)
+	mux      sync.Mutex
+	ini      *seccontext.Initiator
+}
+
+// NewClient returns the client side of gssapi-with-mic authentication using the gokrb5 client. The settings configure
+// the security contexts initiated, as they do for seccontext.NewInitiator.
+func NewClient(cl *client.Client, settings ...func(*seccontext.Settings)) *Client {
+	return &Client{
+		client:   cl,
+		settings: settings,
+	}
+}
+
+// InitSecContext initiates the security context with the target, the host based service name service@host the ssh
+// package passes, RFC 4462 section 3.4. It is first called with a nil token and returns the token with the AP_REQ, then
+// called with the server's AP_REP. The credentials are delegated to the server if isGSSDelegCreds is set, or the
+// gokrb5 client's delegation policy allows it, and the TGT can be forwarded.
+func (c *Client) InitSecContext(target string, token []byte, isGSSDelegCreds bool) ([]byte, bool, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if token == nil {
+		s := c.settings
+		if isGSSDelegCreds {
+			f := append(seccontext.NewSettings(s...).ContextFlags(), gssapi.ContextFlagDeleg)
+			s = append(append([]func(*seccontext.Settings){}, s...), seccontext.ContextFlags(f...))
+		}
+		c.ini = seccontext.NewInitiator(c.client, TargetSPN(target), s...)
+	} else if c.ini == nil {
+		return nil, false, errors.New("security context has not been initiated")
+	}
+	return c.ini.InitSecContext(token)
+}
+
+// GetMIC returns the MIC token of the SSH_MSG_USERAUTH_REQUEST fields the ssh package passes, RFC 4462 section 3.5.
+func (c *Client) GetMIC(micField []byte) ([]byte, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.ini == nil || !c.ini.Established() {
+		return nil, errors.New("security context has not been established")
+	}
+	return c.ini.SecurityContext().GetMIC(micField)
+}
+
+// DeleteSecContext destroys the security context, after which another can be initiated.
+func (c *Client) DeleteSecContext() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.ini == nil {
+		return nil
+	}
+	err := c.ini.DeleteSecContext()
+	c.ini = nil
+	return err
+}
+
+// TargetSPN returns the SPN of the host based service name service@host, as host/server.example.com for the target
+// host@server.example.com. A target without a service is that of the host service, and a target that is already an
+// SPN is returned as is.
+func TargetSPN(target string) string {
+	if strings.Contains(target, "/") {
+		return target
+	}
+	i := strings.Index(target, "@")
+	if i < 0 {
+		return "host/" + target
+	}
+	return target[:i] + "/" + target[i+1:]
+}
+
+// contextTimeout is how long a Server keeps a security context for its MIC to be verified and the client's credentials
+// to be read, as the ssh package does not identify the authentication whose security context it deletes.
+const contextTimeout = time.Minute
+
+// Server performs the server side of gssapi-with-mic authentication with the service's keytab, satisfying the
+// ssh.GSSAPIServer interface. The ssh package uses the GSSAPIServer of a ServerConfig for the authentications of all
+// its connections without identifying them, so a Server keeps each security context established until the MIC of an
+// authentication request verifies with it, and then keys the context by the SSH session ID the MIC covers.
+type Server struct {
+	kt       *keytab.Keytab
+	settings []func(*service.Settings)
+	mux      sync.Mutex
+	pending  []*serverContext          // established contexts awaiting the MIC of their authentication request
+	verified map[string]*serverContext // contexts whose MIC has been verified keyed by SSH session ID
+}
+
+// serverContext is a security context established by a Server.
+type serverContext struct {
+	acc     *seccontext.Acceptor
+	created time.Time
+	read    bool // set once the client's credentials have been read
+}
+
+// NewServer returns the server side of gssapi-with-mic authentication with the keytab. The service settings configure
+// the verification of the client's AP_REQ as they do for seccontext.NewAcceptor.
+func NewServer(kt *keytab.Keytab, settings ...func(*service.Settings)) *Server {
+	return &Server{
+		kt:       kt,
+		settings: settings,
+		verified: make(map[string]*serverContext),
+	}
+}
+
+// AcceptSecContext verifies the client's token, RFC 4462 section 3.4, establishing the security context in a single
+// exchange. The token returned holds the AP_REP if the client requested mutual authentication and the name returned is
+// the client's principal in the form name@REALM.
+func (s *Server) AcceptSecContext(token []byte) ([]byte, string, bool, error) {
+	acc := seccontext.NewAcceptor(s.kt, s.settings...)
+	b, err := acc.AcceptSecContext(token)
+	if err != nil {
+		return nil, "", false, err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.pending = append(s.pending, &serverContext{acc: acc, created: time.Now()})
+	creds := acc.Credentials()
+	return b, creds.UserName() + "@" + creds.Domain(), false, nil
+}
+
+// VerifyMIC verifies the MIC token the client sent for the SSH_MSG_USERAUTH_REQUEST fields the ssh package passes,
+// RFC 4462 section 3.5. The MIC only verifies with the security context established with the same client, which is
+// then that of the SSH session whose ID begins the fields.
+func (s *Server) VerifyMIC(micField []byte, micToken []byte) error {
+	sid, ok := sessionID(micField)
+	if !ok {
+		return errors.New("MIC fields do not begin with the SSH session ID")
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if len(s.pending) == 0 {
+		return errors.New("security context has not been established")
+	}
+	for i, c := range s.pending {
+		if c.acc.SecurityContext().VerifyMIC(micField, micToken) != nil {
+			continue
+		}
+		s.pending = append(s.pending[:i], s.pending[i+1:]...)
+		if old, ok := s.verified[sid]; ok {
+			old.acc.DeleteSecContext()
+		}
+		s.verified[sid] = c
+		return nil
+	}
+	return errors.New("MIC does not verify with an established security context")
+}
+
+// sessionID returns the SSH session ID, an SSH string, that begins the MIC fields.
+func sessionID(micField []byte) (string, bool) {
+	if len(micField) < 4 {
+		return "", false
+	}
+	n := binary.BigEndian.Uint32(micField)
+	if uint64(n) > uint64(len(micField)-4) {
+		return "", false
+	}
+	return string(micField[4 : 4+n]), true
+}
+
+// Credentials returns the credentials of the client authenticated by the security context of the SSH session, as the
+// SessionID of the ssh.ConnMetadata passed to AllowLogin, or nil if no security context has been verified for it. They
+// are available to the AllowLogin function of the ssh package, which is called before the security context is deleted.
+func (s *Server) Credentials(sessionID []byte) *credentials.Credentials {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	c, ok := s.verified[string(sessionID)]
+	if !ok {
+		return nil
+	}
+	c.read = true
+	return c.acc.Credentials()
+}
+
+// DeleteSecContext destroys the security contexts whose authentication is complete, as the client's credentials have
+// been read, and those established longer than a minute ago. The ssh package calls it once an authentication
+// completes, or fails, without identifying the authentication.
+func (s *Server) DeleteSecContext() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	expired := time.Now().Add(-contextTimeout)
+	pending := s.pending[:0]
+	for _, c := range s.pending {
+		if c.created.Before(expired) {
+			c.acc.DeleteSecContext()
+			continue
+		}
+		pending = append(pending, c)
+	}
+	for i := len(pending); i < len(s.pending); i++ {
+		s.pending[i] = nil
+	}
+	s.pending = pending
+	for sid, c := range s.verified {
+		if c.read || c.created.Before(expired) {
+			c.acc.DeleteSecContext()
+			delete(s.verified, sid)
+		}
+	}
+	return nil
+}
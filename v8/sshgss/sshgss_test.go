@@ -0,0 +1,163 @@
+package sshgss
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/test/krbtest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	_ ssh.GSSAPIClient = (*Client)(nil)
+	_ ssh.GSSAPIServer = (*Server)(nil)
+)
+
+func TestTargetSPN(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "host/ssh.test.gokrb5", TargetSPN("host@ssh.test.gokrb5"), "SPN of host based service name not as expected")
+	assert.Equal(t, "host/ssh.test.gokrb5", TargetSPN("ssh.test.gokrb5"), "SPN of host name not as expected")
+	assert.Equal(t, "host/ssh.test.gokrb5@TEST.GOKRB5", TargetSPN("host/ssh.test.gokrb5@TEST.GOKRB5"), "SPN not returned as is")
+}
+
+func TestGSSAPIWithMIC(t *testing.T) {
+	t.Parallel()
+	k, err := krbtest.NewKDC("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	defer k.Close()
+	if err := k.AddPrincipal("host/ssh.test.gokrb5", "servicepassword"); err != nil {
+		t.Fatalf("error adding service principal: %v", err)
+	}
+	kt, err := k.Keytab("host/ssh.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	cl, err := k.NewClient("testuser1")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating host key: %v", err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("error creating host key signer: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer l.Close()
+
+	type result struct {
+		perms *ssh.Permissions
+		err   error
+	}
+	results := make(chan result, 10)
+	// The server and configuration are shared by the connections, as is usual with the ssh package.
+	gss := NewServer(kt, service.DecodePAC(false))
+	cfg := &ssh.ServerConfig{GSSAPIWithMICConfig: &ssh.GSSAPIWithMICConfig{
+		Server: gss,
+		AllowLogin: func(conn ssh.ConnMetadata, srcName string) (*ssh.Permissions, error) {
+			creds := gss.Credentials(conn.SessionID())
+			if creds == nil || creds.UserName() != conn.User() {
+				return nil, errors.New("user not allowed")
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"principal": srcName, "user": conn.User()}}, nil
+		},
+	}}
+	cfg.AddHostKey(hostKey)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				sconn, _, _, err := ssh.NewServerConn(conn, cfg)
+				if err != nil {
+					conn.Close()
+					results <- result{err: err}
+					return
+				}
+				results <- result{perms: sconn.Permissions}
+				sconn.Close()
+			}()
+		}
+	}()
+
+	dial := func(user, target string) error {
+		cfg := &ssh.ClientConfig{
+			User:            user,
+			Auth:            []ssh.AuthMethod{ssh.GSSAPIWithMICAuthMethod(NewClient(cl), target)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		}
+		c, err := ssh.Dial("tcp", l.Addr().String(), cfg)
+		if err != nil {
+			return err
+		}
+		// The server closes the connection once authenticated.
+		c.Close()
+		return nil
+	}
+
+	if err := dial("testuser1", "ssh.test.gokrb5"); err != nil {
+		t.Fatalf("error authenticating: %v", err)
+	}
+	r := <-results
+	if assert.NoError(t, r.err, "server error authenticating") {
+		assert.Equal(t, "testuser1@TEST.GOKRB5", r.perms.Extensions["principal"], "authenticated principal not as expected")
+	}
+
+	assert.Error(t, dial("testuser2", "ssh.test.gokrb5"), "login as another user should be refused")
+	assert.Error(t, (<-results).err, "server should refuse login as another user")
+
+	// Concurrent logins through the shared server are each authorized with their own client's credentials.
+	users := []string{"testuser1", "testuser2", "testuser3"}
+	clients := map[string]*client.Client{"testuser1": cl}
+	for _, u := range users[1:] {
+		if clients[u], err = k.NewClient(u); err != nil {
+			t.Fatalf("error creating client %s: %v", u, err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		for _, u := range users {
+			wg.Add(1)
+			go func(u string) {
+				defer wg.Done()
+				cfg := &ssh.ClientConfig{
+					User:            u,
+					Auth:            []ssh.AuthMethod{ssh.GSSAPIWithMICAuthMethod(NewClient(clients[u]), "ssh.test.gokrb5")},
+					HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+				}
+				c, err := ssh.Dial("tcp", l.Addr().String(), cfg)
+				if assert.NoError(t, err, "error authenticating %s", u) {
+					c.Close()
+				}
+			}(u)
+		}
+	}
+	wg.Wait()
+	for i := 0; i < 3*len(users); i++ {
+		r := <-results
+		if assert.NoError(t, r.err, "server error authenticating concurrently") {
+			assert.Equal(t, r.perms.Extensions["user"]+"@TEST.GOKRB5", r.perms.Extensions["principal"],
+				"login authorized with another client's credentials")
+		}
+	}
+	gss.mux.Lock()
+	assert.Len(t, gss.pending, 0, "pending security contexts should be deleted")
+	assert.Len(t, gss.verified, 0, "verified security contexts should be deleted once read")
+	gss.mux.Unlock()
+}
@@ -0,0 +1,17 @@
+// Package sspi provides a SPNEGO initiator backed by the Windows Security Support Provider Interface (SSPI).
+//
+// The initiator uses the credentials of the logged on Windows user so that applications can authenticate to
+// Kerberos services with domain single sign on without a password or keytab. It is only available on Windows.
+//
+//	init, err := sspi.NewInitiator()
+//	if err != nil {
+//		...
+//	}
+//	defer init.Release()
+//	cl := spnego.NewInitiatorClient(init, nil, "")
+//
+// The tickets of the user's logon session can also be retrieved from the Local Security Authority for use by a gokrb5
+// client, which then obtains service tickets itself with the logon session's TGT:
+//
+//	cl, err := sspi.NewClient(cfg)
+package sspi
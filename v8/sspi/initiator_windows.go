@@ -0,0 +1,89 @@
+package sspi
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+)
+
+// Initiator generates SPNEGO tokens via SSPI using the credentials of the logged on Windows user.
+// It implements the spnego.Initiator interface, which only sends the initiator's token, so mutual authentication is not
+// requested and the service's reply is not verified.
+type Initiator struct {
+	cred     secHandle
+	flags    uint32
+	released bool
+	mux      sync.Mutex
+}
+
+// NewInitiator acquires an SSPI credentials handle for the logged on user.
+// Release should be called when the Initiator is no longer required.
+func NewInitiator(settings ...func(*Initiator)) (*Initiator, error) {
+	i := &Initiator{
+		flags: iscReqAllocateMemory | iscReqConnection,
+	}
+	for _, set := range settings {
+		set(i)
+	}
+	var expiry timeStamp
+	err := acquireCredentialsHandle(negotiatePackage, &i.cred, &expiry)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Delegate used to configure the Initiator to request that the user's credentials are delegated to the service.
+//
+// i, err := NewInitiator(Delegate(true))
+func Delegate(b bool) func(*Initiator) {
+	return func(i *Initiator) {
+		if b {
+			i.flags |= iscReqDelegate
+		} else {
+			i.flags &^= iscReqDelegate
+		}
+	}
+}
+
+// InitSecContext returns the SPNEGO token for the service with the SPN provided, e.g. "HTTP/host.example.com".
+func (i *Initiator) InitSecContext(spn string) ([]byte, error) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.released {
+		return nil, errors.New("SSPI credentials handle has been released")
+	}
+	var ctx secHandle
+	var attrs uint32
+	var expiry timeStamp
+	buf := secBuffer{typ: secBufferToken}
+	out := secBufferDesc{
+		version: secBufferVersion,
+		count:   1,
+		buffers: &buf,
+	}
+	_, err := initializeSecurityContext(&i.cred, spn, i.flags, &ctx, &out, &attrs, &expiry)
+	if err != nil {
+		return nil, err
+	}
+	// The HTTP Negotiate exchange is a single leg so the context is not needed once the token has been generated.
+	defer deleteSecurityContext(&ctx)
+	if buf.buffer == nil || buf.count == 0 {
+		return nil, errors.New("SSPI did not return a token")
+	}
+	defer freeContextBuffer(buf.buffer)
+	b := make([]byte, buf.count)
+	copy(b, (*[1 << 30]byte)(unsafe.Pointer(buf.buffer))[:buf.count:buf.count])
+	return b, nil
+}
+
+// Release frees the SSPI credentials handle held by the Initiator.
+func (i *Initiator) Release() {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	if i.released {
+		return
+	}
+	freeCredentialsHandle(&i.cred)
+	i.released = true
+}
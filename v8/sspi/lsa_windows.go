@@ -0,0 +1,137 @@
+package sspi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// ErrTGTSessionKeyUnavailable is returned when the LSA withholds the session key of the logon session's TGT, as it
+// does unless the AllowTgtSessionKey registry value of the Kerberos package is set, and always when Credential Guard
+// is enabled. Service tickets can still be retrieved with LSA.ServiceTicket.
+var ErrTGTSessionKeyUnavailable = errors.New("the LSA did not return the session key of the TGT")
+
+// LSA retrieves the Kerberos tickets of the logon session of the current Windows user from the Local Security
+// Authority, as KRB_CREDs that can be imported into a gokrb5 client. Close should be called when the LSA is no longer
+// required.
+type LSA struct {
+	handle uintptr
+	pkg    uint32
+	closed bool
+	mux    sync.Mutex
+}
+
+// NewLSA connects to the Local Security Authority's Kerberos package.
+func NewLSA() (*LSA, error) {
+	l := new(LSA)
+	if err := lsaConnectUntrusted(&l.handle); err != nil {
+		return nil, err
+	}
+	pkg, err := lsaLookupAuthenticationPackage(l.handle, kerberosPackage)
+	if err != nil {
+		lsaDeregisterLogonProcess(l.handle)
+		return nil, err
+	}
+	l.pkg = pkg
+	return l, nil
+}
+
+// TGT returns a KRB_CRED holding the logon session's TGT for the realm, e.g. the user's domain in upper case.
+// The session key of the TGT is zero if the LSA withholds it, see ErrTGTSessionKeyUnavailable.
+func (l *LSA) TGT(realm string) ([]byte, error) {
+	return l.retrieve("krbtgt/"+realm, kerbRetrieveTicketUseCacheOnly)
+}
+
+// ServiceTicket returns a KRB_CRED holding a ticket of the logon session for the service with the SPN provided,
+// e.g. "HTTP/host.example.com". The LSA obtains the ticket from the KDC if it has not cached one.
+func (l *LSA) ServiceTicket(spn string) ([]byte, error) {
+	return l.retrieve(spn, 0)
+}
+
+func (l *LSA) retrieve(target string, cacheOptions uint32) ([]byte, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return nil, errors.New("LSA connection has been closed")
+	}
+	b, err := lsaRetrieveEncodedTicket(l.handle, l.pkg, target, cacheOptions|kerbRetrieveTicketAsKerbCred)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve the ticket for %s from the LSA: %w", target, err)
+	}
+	return b, nil
+}
+
+// ImportTGT adds the logon session's TGT for the client's realm to the client's sessions, replacing any TGT the
+// client has, such as when the TGT of a client created with NewClient has expired and the user's logon session has
+// obtained a new one.
+func (l *LSA) ImportTGT(cl *client.Client) error {
+	b, err := l.TGT(cl.Credentials.Domain())
+	if err != nil {
+		return err
+	}
+	if err := checkTGTSessionKey(b); err != nil {
+		return err
+	}
+	return cl.ImportTicket(b, types.EncryptionKey{})
+}
+
+// Close closes the connection to the Local Security Authority.
+func (l *LSA) Close() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if l.closed {
+		return
+	}
+	lsaDeregisterLogonProcess(l.handle)
+	l.closed = true
+}
+
+// NewClient creates a gokrb5 client using the TGT of the logon session of the current Windows user, so that it
+// rides the user's domain logon without a password or keytab. The realm is that of the USERDNSDOMAIN environment
+// variable. The TGT is renewed by the client until it can no longer be renewed, after which LSA.ImportTGT imports
+// the logon session's new TGT.
+func NewClient(krb5conf *config.Config, settings ...func(*client.Settings)) (*client.Client, error) {
+	realm := strings.ToUpper(os.Getenv("USERDNSDOMAIN"))
+	if realm == "" {
+		return nil, errors.New("USERDNSDOMAIN is not set, the user is not logged on to a domain")
+	}
+	l, err := NewLSA()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+	b, err := l.TGT(realm)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTGTSessionKey(b); err != nil {
+		return nil, err
+	}
+	return client.NewFromKRBCred(b, types.EncryptionKey{}, krb5conf, settings...)
+}
+
+// checkTGTSessionKey returns ErrTGTSessionKeyUnavailable if the session key of the TGT in the KRB_CRED is zero.
+func checkTGTSessionKey(b []byte) error {
+	var k messages.KRBCred
+	if err := k.Unmarshal(b); err != nil {
+		return err
+	}
+	if err := k.DecryptEncPart(types.EncryptionKey{}); err != nil {
+		return err
+	}
+	for _, info := range k.DecryptedEncPart.TicketInfo {
+		for _, v := range info.Key.KeyValue {
+			if v != 0 {
+				return nil
+			}
+		}
+	}
+	return ErrTGTSessionKeyUnavailable
+}
@@ -0,0 +1,282 @@
+package sspi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// SSPI constants as defined in sspi.h
+const (
+	secEOK               = 0x00000000
+	secIContinueNeeded   = 0x00090312
+	secpkgCredOutbound   = 0x00000002
+	securityNativeDRep   = 0x00000010
+	secBufferVersion     = 0
+	secBufferToken       = 2
+	iscReqDelegate       = 0x00000001
+	iscReqAllocateMemory = 0x00000100
+	iscReqConnection     = 0x00000800
+	// negotiatePackage is the SSPI security package that produces SPNEGO tokens.
+	negotiatePackage = "Negotiate"
+)
+
+var (
+	secur32                        = syscall.NewLazyDLL("secur32.dll")
+	procAcquireCredentialsHandleW  = secur32.NewProc("AcquireCredentialsHandleW")
+	procInitializeSecurityContextW = secur32.NewProc("InitializeSecurityContextW")
+	procDeleteSecurityContext      = secur32.NewProc("DeleteSecurityContext")
+	procFreeCredentialsHandle      = secur32.NewProc("FreeCredentialsHandle")
+	procFreeContextBuffer          = secur32.NewProc("FreeContextBuffer")
+	procLsaConnectUntrusted        = secur32.NewProc("LsaConnectUntrusted")
+	procLsaLookupAuthPackage       = secur32.NewProc("LsaLookupAuthenticationPackage")
+	procLsaCallAuthPackage         = secur32.NewProc("LsaCallAuthenticationPackage")
+	procLsaFreeReturnBuffer        = secur32.NewProc("LsaFreeReturnBuffer")
+	procLsaDeregisterLogonProcess  = secur32.NewProc("LsaDeregisterLogonProcess")
+)
+
+// LSA constants as defined in ntsecapi.h
+const (
+	statusSuccess = 0x00000000
+	// kerbRetrieveEncodedTicketMessage is the KERB_PROTOCOL_MESSAGE_TYPE of a KERB_RETRIEVE_TKT_REQUEST.
+	kerbRetrieveEncodedTicketMessage = 8
+	kerbRetrieveTicketUseCacheOnly   = 0x00000002
+	kerbRetrieveTicketAsKerbCred     = 0x00000008
+	// kerberosPackage is the name of the LSA's Kerberos authentication package.
+	kerberosPackage = "Kerberos"
+)
+
+// secHandle is the SSPI CredHandle and CtxtHandle.
+type secHandle struct {
+	lower uintptr
+	upper uintptr
+}
+
+// timeStamp is the SSPI TimeStamp.
+type timeStamp struct {
+	lowPart  uint32
+	highPart int32
+}
+
+// secBuffer is the SSPI SecBuffer.
+type secBuffer struct {
+	count  uint32
+	typ    uint32
+	buffer *byte
+}
+
+// secBufferDesc is the SSPI SecBufferDesc.
+type secBufferDesc struct {
+	version uint32
+	count   uint32
+	buffers *secBuffer
+}
+
+// lsaString is the LSA_STRING.
+type lsaString struct {
+	length    uint16
+	maxLength uint16
+	buffer    *byte
+}
+
+// unicodeString is the UNICODE_STRING.
+type unicodeString struct {
+	length    uint16
+	maxLength uint16
+	buffer    *uint16
+}
+
+// luid is the LUID of a logon session.
+type luid struct {
+	lowPart  uint32
+	highPart int32
+}
+
+// kerbRetrieveTktRequest is the KERB_RETRIEVE_TKT_REQUEST.
+type kerbRetrieveTktRequest struct {
+	messageType    uint32
+	logonID        luid
+	targetName     unicodeString
+	ticketFlags    uint32
+	cacheOptions   uint32
+	encryptionType int32
+	credHandle     secHandle
+}
+
+// kerbCryptoKey is the KERB_CRYPTO_KEY.
+type kerbCryptoKey struct {
+	keyType int32
+	length  uint32
+	value   *byte
+}
+
+// kerbExternalTicket is the KERB_EXTERNAL_TICKET of a KERB_RETRIEVE_TKT_RESPONSE.
+type kerbExternalTicket struct {
+	serviceName         uintptr
+	targetName          uintptr
+	clientName          uintptr
+	domainName          unicodeString
+	targetDomainName    unicodeString
+	altTargetDomainName unicodeString
+	sessionKey          kerbCryptoKey
+	ticketFlags         uint32
+	flags               uint32
+	keyExpirationTime   int64
+	startTime           int64
+	endTime             int64
+	renewUntil          int64
+	timeSkew            int64
+	encodedTicketSize   uint32
+	encodedTicket       *byte
+}
+
+// statusError is a SSPI security status returned by a failed call.
+type statusError struct {
+	fn     string
+	status uintptr
+}
+
+// Error implements the error interface.
+func (e statusError) Error() string {
+	return fmt.Sprintf("%s failed with status 0x%08x", e.fn, uint32(e.status))
+}
+
+func acquireCredentialsHandle(pkg string, cred *secHandle, expiry *timeStamp) error {
+	p, err := syscall.UTF16PtrFromString(pkg)
+	if err != nil {
+		return err
+	}
+	r, _, _ := procAcquireCredentialsHandleW.Call(
+		0,
+		uintptr(unsafe.Pointer(p)),
+		secpkgCredOutbound,
+		0,
+		0,
+		0,
+		0,
+		uintptr(unsafe.Pointer(cred)),
+		uintptr(unsafe.Pointer(expiry)),
+	)
+	if r != secEOK {
+		return statusError{fn: "AcquireCredentialsHandle", status: r}
+	}
+	return nil
+}
+
+func initializeSecurityContext(cred *secHandle, target string, flags uint32, ctx *secHandle, out *secBufferDesc, attrs *uint32, expiry *timeStamp) (uintptr, error) {
+	t, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return 0, err
+	}
+	r, _, _ := procInitializeSecurityContextW.Call(
+		uintptr(unsafe.Pointer(cred)),
+		0,
+		uintptr(unsafe.Pointer(t)),
+		uintptr(flags),
+		0,
+		securityNativeDRep,
+		0,
+		0,
+		uintptr(unsafe.Pointer(ctx)),
+		uintptr(unsafe.Pointer(out)),
+		uintptr(unsafe.Pointer(attrs)),
+		uintptr(unsafe.Pointer(expiry)),
+	)
+	if r != secEOK && r != secIContinueNeeded {
+		return r, statusError{fn: "InitializeSecurityContext", status: r}
+	}
+	return r, nil
+}
+
+func deleteSecurityContext(ctx *secHandle) {
+	procDeleteSecurityContext.Call(uintptr(unsafe.Pointer(ctx)))
+}
+
+func freeCredentialsHandle(cred *secHandle) {
+	procFreeCredentialsHandle.Call(uintptr(unsafe.Pointer(cred)))
+}
+
+func freeContextBuffer(b *byte) {
+	procFreeContextBuffer.Call(uintptr(unsafe.Pointer(b)))
+}
+
+func lsaConnectUntrusted(h *uintptr) error {
+	r, _, _ := procLsaConnectUntrusted.Call(uintptr(unsafe.Pointer(h)))
+	if r != statusSuccess {
+		return statusError{fn: "LsaConnectUntrusted", status: r}
+	}
+	return nil
+}
+
+func lsaLookupAuthenticationPackage(h uintptr, name string) (uint32, error) {
+	b := []byte(name)
+	s := lsaString{length: uint16(len(b)), maxLength: uint16(len(b)), buffer: &b[0]}
+	var pkg uint32
+	r, _, _ := procLsaLookupAuthPackage.Call(h, uintptr(unsafe.Pointer(&s)), uintptr(unsafe.Pointer(&pkg)))
+	if r != statusSuccess {
+		return 0, statusError{fn: "LsaLookupAuthenticationPackage", status: r}
+	}
+	return pkg, nil
+}
+
+// lsaRetrieveEncodedTicket calls the Kerberos package with a KERB_RETRIEVE_TKT_REQUEST for the ticket of the target of
+// the caller's logon session and returns the encoded ticket of the response.
+func lsaRetrieveEncodedTicket(h uintptr, pkg uint32, target string, cacheOptions uint32) ([]byte, error) {
+	t, err := syscall.UTF16FromString(target)
+	if err != nil {
+		return nil, err
+	}
+	t = t[:len(t)-1]
+	// The target name must be within the buffer submitted, following the request.
+	size := unsafe.Sizeof(kerbRetrieveTktRequest{})
+	buf := make([]byte, size+uintptr(len(t))*2)
+	req := (*kerbRetrieveTktRequest)(unsafe.Pointer(&buf[0]))
+	req.messageType = kerbRetrieveEncodedTicketMessage
+	req.cacheOptions = cacheOptions
+	if len(t) > 0 {
+		for i, c := range t {
+			binary.LittleEndian.PutUint16(buf[size+uintptr(i)*2:], c)
+		}
+		req.targetName = unicodeString{
+			length:    uint16(len(t) * 2),
+			maxLength: uint16(len(t) * 2),
+			buffer:    (*uint16)(unsafe.Pointer(&buf[size])),
+		}
+	}
+	var resp unsafe.Pointer
+	var respLen uint32
+	var protocolStatus uintptr
+	r, _, _ := procLsaCallAuthPackage.Call(
+		h,
+		uintptr(pkg),
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(len(buf)),
+		uintptr(unsafe.Pointer(&resp)),
+		uintptr(unsafe.Pointer(&respLen)),
+		uintptr(unsafe.Pointer(&protocolStatus)),
+	)
+	if r != statusSuccess {
+		return nil, statusError{fn: "LsaCallAuthenticationPackage", status: r}
+	}
+	if resp != nil {
+		defer procLsaFreeReturnBuffer.Call(uintptr(resp))
+	}
+	if uint32(protocolStatus) != statusSuccess {
+		return nil, statusError{fn: "KerbRetrieveEncodedTicketMessage", status: uintptr(uint32(protocolStatus))}
+	}
+	if resp == nil || uintptr(respLen) < unsafe.Sizeof(kerbExternalTicket{}) {
+		return nil, fmt.Errorf("KerbRetrieveEncodedTicketMessage response of %d bytes is too short", respLen)
+	}
+	tkt := (*kerbExternalTicket)(resp)
+	if tkt.encodedTicket == nil || tkt.encodedTicketSize == 0 {
+		return nil, fmt.Errorf("KerbRetrieveEncodedTicketMessage response does not hold a ticket for %s", target)
+	}
+	b := make([]byte, tkt.encodedTicketSize)
+	copy(b, (*[1 << 30]byte)(unsafe.Pointer(tkt.encodedTicket))[:tkt.encodedTicketSize:tkt.encodedTicketSize])
+	return b, nil
+}
+
+func lsaDeregisterLogonProcess(h uintptr) {
+	procLsaDeregisterLogonProcess.Call(h)
+}
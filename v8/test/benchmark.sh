@@ -0,0 +1,32 @@
+#!/bin/sh
+# Runs the gokrb5 benchmarks and compares the results against the recorded baseline.
+#
+# Usage: test/benchmark.sh [output file]
+#
+# Environment variables:
+#   COUNT     number of times each benchmark is run (default 5)
+#   BENCH     regular expression selecting the benchmarks to run (default .)
+#   BASELINE  file of results to compare against (default test/testdata/benchmark_baseline.txt)
+#
+# The comparison requires benchstat: go install golang.org/x/perf/cmd/benchstat@latest
+# To record a new baseline run: test/benchmark.sh test/testdata/benchmark_baseline.txt
+set -e
+
+cd "$(dirname "$0")/.."
+COUNT=${COUNT:-5}
+BENCH=${BENCH:-.}
+BASELINE=${BASELINE:-test/testdata/benchmark_baseline.txt}
+OUT=${1:-$(mktemp)}
+
+go test -run '^$' -bench "${BENCH}" -benchmem -count "${COUNT}" ./... | grep -v '^ok\|no test files' > "${OUT}.tmp"
+mv "${OUT}.tmp" "${OUT}"
+echo "Benchmark results written to ${OUT}"
+
+if [ "${OUT}" = "${BASELINE}" ]; then
+  exit 0
+fi
+if command -v benchstat > /dev/null 2>&1; then
+  benchstat "${BASELINE}" "${OUT}"
+else
+  echo "benchstat not found, skipping comparison with ${BASELINE}"
+fi
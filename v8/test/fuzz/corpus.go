@@ -0,0 +1,154 @@
+package fuzz
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+)
+
+// Seed is an input for a fuzz target.
+type Seed struct {
+	// Target is the name of the target that unmarshals the seed.
+	Target string
+	// Name describes the seed.
+	Name string
+	// Source is where the seed was obtained from.
+	Source string
+	// Data is the marshaled data.
+	Data []byte
+}
+
+type hexSeed struct {
+	target, name, source, data string
+}
+
+// corpus holds the hex encoded seeds. The Kerberos messages are the encodings of the MIT krb5 ASN.1 tests and the
+// PACs those of Microsoft Active Directory held in the testdata package, while the tokens are those of the SPNEGO
+// and GSS-API unit tests.
+var corpus = []hexSeed{
+	{"messages.ASReq", "AS_REQ", "testdata.MarshaledKRB5as_req", testdata.MarshaledKRB5as_req},
+	{"messages.ASReq", "AS_REQ with only the optional second ticket", "testdata.MarshaledKRB5as_reqOptionalsNULLexceptsecond_ticket", testdata.MarshaledKRB5as_reqOptionalsNULLexceptsecond_ticket},
+	{"messages.TGSReq", "TGS_REQ", "testdata.MarshaledKRB5tgs_req", testdata.MarshaledKRB5tgs_req},
+	{"messages.TGSReq", "TGS_REQ with only the optional server", "testdata.MarshaledKRB5tgs_reqOptionalsNULLexceptserver", testdata.MarshaledKRB5tgs_reqOptionalsNULLexceptserver},
+	{"messages.KDCReqBody", "KDC_REQ_BODY", "testdata.MarshaledKRB5kdc_req_body", testdata.MarshaledKRB5kdc_req_body},
+	{"messages.ASRep", "AS_REP", "testdata.MarshaledKRB5as_rep", testdata.MarshaledKRB5as_rep},
+	{"messages.ASRep", "AS_REP without optionals", "testdata.MarshaledKRB5as_repOptionalsNULL", testdata.MarshaledKRB5as_repOptionalsNULL},
+	{"messages.TGSRep", "TGS_REP", "testdata.MarshaledKRB5tgs_rep", testdata.MarshaledKRB5tgs_rep},
+	{"messages.EncKDCRepPart", "EncKDCRepPart", "testdata.MarshaledKRB5enc_kdc_rep_part", testdata.MarshaledKRB5enc_kdc_rep_part},
+	{"messages.APReq", "AP_REQ", "testdata.MarshaledKRB5ap_req", testdata.MarshaledKRB5ap_req},
+	{"messages.APRep", "AP_REP", "testdata.MarshaledKRB5ap_rep", testdata.MarshaledKRB5ap_rep},
+	{"messages.EncAPRepPart", "EncAPRepPart", "testdata.MarshaledKRB5ap_rep_enc_part", testdata.MarshaledKRB5ap_rep_enc_part},
+	{"messages.Ticket", "Ticket", "testdata.MarshaledKRB5ticket", testdata.MarshaledKRB5ticket},
+	{"messages.EncTicketPart", "EncTicketPart", "testdata.MarshaledKRB5enc_tkt_part", testdata.MarshaledKRB5enc_tkt_part},
+	{"messages.EncTicketPart", "EncTicketPart without optionals", "testdata.MarshaledKRB5enc_tkt_partOptionalsNULL", testdata.MarshaledKRB5enc_tkt_partOptionalsNULL},
+	{"messages.KRBError", "KRB_ERROR", "testdata.MarshaledKRB5error", testdata.MarshaledKRB5error},
+	{"messages.KRBError", "KRB_ERROR without optionals", "testdata.MarshaledKRB5errorOptionalsNULL", testdata.MarshaledKRB5errorOptionalsNULL},
+	{"messages.KRBCred", "KRB_CRED", "testdata.MarshaledKRB5cred", testdata.MarshaledKRB5cred},
+	{"messages.EncKrbCredPart", "EncKrbCredPart", "testdata.MarshaledKRB5enc_cred_part", testdata.MarshaledKRB5enc_cred_part},
+	{"messages.KRBPriv", "KRB_PRIV", "testdata.MarshaledKRB5priv", testdata.MarshaledKRB5priv},
+	{"messages.EncKrbPrivPart", "EncKrbPrivPart", "testdata.MarshaledKRB5enc_priv_part", testdata.MarshaledKRB5enc_priv_part},
+	{"messages.KRBSafe", "KRB_SAFE", "testdata.MarshaledKRB5safe", testdata.MarshaledKRB5safe},
+	{"types.Authenticator", "Authenticator", "testdata.MarshaledKRB5authenticator", testdata.MarshaledKRB5authenticator},
+	{"types.AuthorizationData", "AuthorizationData", "testdata.MarshaledKRB5authorization_data", testdata.MarshaledKRB5authorization_data},
+	{"types.ADKDCIssued", "AD-KDCIssued", "testdata.MarshaledKRB5ad_kdcissued", testdata.MarshaledKRB5ad_kdcissued},
+	{"types.EncryptedData", "EncryptedData", "testdata.MarshaledKRB5enc_data", testdata.MarshaledKRB5enc_data},
+	{"types.EncryptedData", "EncryptedData with the MSB of the kvno set", "testdata.MarshaledKRB5enc_dataMSBSetkvno", testdata.MarshaledKRB5enc_dataMSBSetkvno},
+	{"types.EncryptionKey", "EncryptionKey", "testdata.MarshaledKRB5keyblock", testdata.MarshaledKRB5keyblock},
+	{"types.PADataSequence", "PA-DATA sequence", "testdata.MarshaledKRB5padata_sequence", testdata.MarshaledKRB5padata_sequence},
+	{"types.PAEncTSEnc", "PA-ENC-TS-ENC", "testdata.MarshaledKRB5pa_enc_ts", testdata.MarshaledKRB5pa_enc_ts},
+	{"types.ETypeInfo", "ETYPE-INFO", "testdata.MarshaledKRB5etype_info", testdata.MarshaledKRB5etype_info},
+	{"types.ETypeInfo2", "ETYPE-INFO2", "testdata.MarshaledKRB5etype_info2", testdata.MarshaledKRB5etype_info2},
+	{"types.TypedDataSequence", "TYPED-DATA", "testdata.MarshaledKRB5typed_data", testdata.MarshaledKRB5typed_data},
+	{"types.AuthorizationData", "AD-IF-RELEVANT holding a Microsoft PAC", "testdata.MarshaledPAC_AuthorizationData_MS", testdata.MarshaledPAC_AuthorizationData_MS},
+	{"types.AuthorizationData", "AD-IF-RELEVANT holding a PAC from the gokrb5 test domain", "testdata.MarshaledPAC_AuthorizationData_GOKRB5", testdata.MarshaledPAC_AuthorizationData_GOKRB5},
+	{"pac.PACType", "AD-WIN2K-PAC", "testdata.MarshaledPAC_AD_WIN2K_PAC", testdata.MarshaledPAC_AD_WIN2K_PAC},
+	{"pac.KerbValidationInfo", "KERB_VALIDATION_INFO", "testdata.MarshaledPAC_Kerb_Validation_Info_MS", testdata.MarshaledPAC_Kerb_Validation_Info_MS},
+	{"pac.KerbValidationInfo", "KERB_VALIDATION_INFO with trusted domain SIDs", "testdata.MarshaledPAC_Kerb_Validation_Info_Trust", testdata.MarshaledPAC_Kerb_Validation_Info_Trust},
+	{"pac.ClientInfo", "PAC_CLIENT_INFO", "testdata.MarshaledPAC_Client_Info", testdata.MarshaledPAC_Client_Info},
+	{"pac.UPNDNSInfo", "UPN_DNS_INFO", "testdata.MarshaledPAC_UPN_DNS_Info", testdata.MarshaledPAC_UPN_DNS_Info},
+	{"pac.ClientClaimsInfo", "client claims with a string claim", "testdata.MarshaledPAC_ClientClaimsInfoStr", testdata.MarshaledPAC_ClientClaimsInfoStr},
+	{"pac.ClientClaimsInfo", "client claims with multiple claims", "testdata.MarshaledPAC_ClientClaimsInfoMulti", testdata.MarshaledPAC_ClientClaimsInfoMulti},
+	{"pac.ClientClaimsInfo", "client claims with multiple unsigned integer claims", "testdata.MarshaledPAC_ClientClaimsInfoMultiUint", testdata.MarshaledPAC_ClientClaimsInfoMultiUint},
+	{"pac.SignatureData", "server signature", "testdata.MarshaledPAC_Server_Signature", testdata.MarshaledPAC_Server_Signature},
+	{"pac.SignatureData", "KDC signature", "testdata.MarshaledPAC_KDC_Signature", testdata.MarshaledPAC_KDC_Signature},
+	{"kadmin.Reply", "kpasswd reply", "testdata.MarshaledKpasswd_Rep", testdata.MarshaledKpasswd_Rep},
+	{"keytab.Keytab", "keytab", "testdata.KEYTAB_TESTUSER1_TEST_GOKRB5", testdata.KEYTAB_TESTUSER1_TEST_GOKRB5},
+	{"credentials.CCache", "credentials cache", "testdata.CCACHE_TEST", testdata.CCACHE_TEST},
+	{"spnego.SPNEGOToken", "GSS-API InitialContextToken with a NegTokenInit", "spnego/spnego_test.go testGSSAPIInit", "608202b606062b0601050502a08202aa308202a6a027302506092a864886f71201020206052b0501050206092a864882f71201020206062b0601050205a2820279048202756082027106092a864886f71201020201006e8202603082025ca003020105a10302010ea20703050000000000a38201706182016c30820168a003020105a10d1b0b544553542e474f4b524235a2233021a003020103a11a30181b04485454501b10686f73742e746573742e676f6b726235a382012b30820127a003020112a103020102a282011904820115d4bd890abc456f44e2e7a2e8111bd6767abf03266dfcda97c629af2ece450a5ae1f145e4a4d1bc2c848e66a6c6b31d9740b26b03cdbd2570bfcf126e90adf5f5ebce9e283ff5086da47b129b14fc0aabd4d1df9c1f3c72b80cc614dfc28783450b2c7b7749651f432b47aaa2ff158c0066b757f3fb00dd7b4f63d68276c76373ecdd3f19c66ebc43a81e577f3c263b878356f57e8d6c4eccd587b81538e70392cf7e73fc12a6f7c537a894a7bb5566c83ac4d69757aa320a51d8d690017aebf952add1889adfc3307b0e6cd8c9b57cf8589fbe52800acb6461c25473d49faa1bdceb8bce3f61db23f9cd6a09d5adceb411e1c4546b30b33331e570fd6bc50aa403557e75f488e759750ea038aab6454667d9b64f41a481d23081cfa003020112a281c70481c4eb593beb5afcb1a2a669d54cb85a3772231559f2d40c9f8f053f218ba6eb084ed7efc467d94b88bcd189dda920d6e675ec001a6a2bca11f0a1de37f2f7ae9929f94a86d625b2ec1b213a88cbae6099dda7b172cd3bd1802cb177ae4554d59277004bfd3435248f55044fe7af7b2c9c5a3c43763278c585395aebe2856cdff9f2569d8b823564ce6be2d19748b910ec06bd3c0a9bc5de51ddcf7d875f1108ca6ad935f52d90cb62a18197d9b8e796bef0fbe1463f61df61cfbce6008ae9e1a2d2314a986d"},
+	{"spnego.SPNEGOToken", "NegTokenResp accepting Kerberos", "spnego/spnego_test.go testGSSAPIResp", "a1143012a0030a0100a10b06092a864886f712010202"},
+	{"spnego.NegToken", "NegTokenInit with a KRB5 AP_REQ mechanism token", "spnego/negotiationToken_test.go testNegTokenInit", "a08202aa308202a6a027302506092a864886f71201020206052b0501050206092a864882f71201020206062b0601050205a2820279048202756082027106092a864886f71201020201006e8202603082025ca003020105a10302010ea20703050000000000a38201706182016c30820168a003020105a10d1b0b544553542e474f4b524235a2233021a003020103a11a30181b04485454501b10686f73742e746573742e676f6b726235a382012b30820127a003020112a103020102a282011904820115d4bd890abc456f44e2e7a2e8111bd6767abf03266dfcda97c629af2ece450a5ae1f145e4a4d1bc2c848e66a6c6b31d9740b26b03cdbd2570bfcf126e90adf5f5ebce9e283ff5086da47b129b14fc0aabd4d1df9c1f3c72b80cc614dfc28783450b2c7b7749651f432b47aaa2ff158c0066b757f3fb00dd7b4f63d68276c76373ecdd3f19c66ebc43a81e577f3c263b878356f57e8d6c4eccd587b81538e70392cf7e73fc12a6f7c537a894a7bb5566c83ac4d69757aa320a51d8d690017aebf952add1889adfc3307b0e6cd8c9b57cf8589fbe52800acb6461c25473d49faa1bdceb8bce3f61db23f9cd6a09d5adceb411e1c4546b30b33331e570fd6bc50aa403557e75f488e759750ea038aab6454667d9b64f41a481d23081cfa003020112a281c70481c4d67ba2ae4cf5d917caab1d863605249320e90482563662ed92408a543b6ad5edeb8f9375e9060a205491df082fd2a5fec93dfb76f41012bb60cae20f07adbb77a1aa56f0521f36e1ea10dc9fb762902b254dd7664d0bcc6f751f2003e41990af1b4330d10477bfad638b9f0b704ac80cc47731f8ec8d801762bad8884b8de90adb1dbe7fc7b0ffafd38fb5eb8b6547cee30d89873281ce63ad70042a13478b1a7c2bdde0f223ace62dbb84e2d06f1070f4265f66e0544449335e2fcc4d0aee5bf81c5999"},
+	{"spnego.NegToken", "NegTokenResp accepting Kerberos", "spnego/negotiationToken_test.go testNegTokenResp", "a1143012a0030a0100a10b06092a864886f712010202"},
+	{"spnego.KRB5Token", "KRB5 AP_REQ token", "spnego/krb5Token_test.go KRB5TokenHex", "6082026306092a864886f71201020201006e8202523082024ea003020105a10302010ea20703050000000000a382015d6182015930820155a003020105a10d1b0b544553542e474f4b524235a2233021a003020101a11a30181b04485454501b10686f73742e746573742e676f6b726235a382011830820114a003020112a103020103a28201060482010230621d868c97f30bf401e03bbffcd724bd9d067dce2afc31f71a356449b070cdafcc1ff372d0eb1e7a708b50c0152f3996c45b1ea312a803907fb97192d39f20cdcaea29876190f51de6e2b4a4df0460122ed97f363434e1e120b0e76c172b4424a536987152ac0b73013ab88af4b13a3fcdc63f739039dd46d839709cf5b51bb0ce6cb3af05fab3844caac280929955495235e9d0424f8a1fb9b4bd4f6bba971f40b97e9da60b9dabfcf0b1feebfca02c9a19b327a0004aa8e19192726cf347561fa8ac74afad5d6a264e50cf495b93aac86c77b2bc2d184234f6c2767dbea431485a25687b9044a20b601e968efaefffa1fc5283ff32aa6a53cb6c5cdd2eddcb26a481d73081d4a003020112a103020103a281c70481c4a1b29e420324f7edf9efae39df7bcaaf196a3160cf07e72f52a4ef8a965721b2f3343719c50699046e4fcc18ca26c2bfc7e4a9eddfc9d9cfc57ff2f6bdbbd1fc40ac442195bc669b9a0dbba12563b3e4cac9f4022fc01b8aa2d1ab84815bb078399ff7f4d5f9815eef896a0c7e3c049e6fd9932b97096cdb5861425b9d81753d0743212ded1a0fb55a00bf71a46be5ce5e1c8a5cc327b914347d9efcb6cb31ca363b1850d95c7b6c4c3cc6301615ad907318a0c5379d343610fab17eca9c7dc0a5a60658"},
+	{"gssapi.WrapToken", "wrap token from the acceptor", "gssapi/wrapToken_test.go testChallengeFromAcceptor", "050401ff000c000000000000575e85d601010000853b728d5268525a1386c19f"},
+	{"gssapi.WrapToken", "wrap token from the initiator", "gssapi/wrapToken_test.go testChallengeReplyFromInitiator", "050400ff000c000000000000000000000101000079a033510b6f127212242b97"},
+	{"gssapi.MICToken", "MIC token from the acceptor", "gssapi/MICToken_test.go testMICChallengeFromAcceptor", "040401ffffffffff00000000575e85d6c34d12ba3e5b1b1310cd9cb3"},
+	{"gssapi.MICToken", "MIC token from the initiator", "gssapi/MICToken_test.go testMICChallengeReplyFromInitiator", "040400ffffffffff00000000000000009649ca09d2f1bc51ff6e5ca3"},
+}
+
+// Corpus returns the seeds for the targets. A new slice is returned on each call so it can be extended with a
+// project's own captures.
+func Corpus() []Seed {
+	seeds := make([]Seed, len(corpus))
+	for i, s := range corpus {
+		b, err := hex.DecodeString(s.data)
+		if err != nil {
+			panic("invalid hex in seed " + s.name + ": " + err.Error())
+		}
+		seeds[i] = Seed{Target: s.target, Name: s.name, Source: s.source, Data: b}
+	}
+	return seeds
+}
+
+// ReadSeeds reads seeds from the subdirectories of dir, each named after the target that unmarshals the seeds within
+// it, such as dir/spnego.SPNEGOToken/negtokeninit. Files with the extension .b64 or .hex hold the base64 or
+// hex encoding of the data, such as that written by messages.WriteDump, and other files hold the raw data.
+func ReadSeeds(dir string) ([]Seed, error) {
+	ds, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading seed directory: %w", err)
+	}
+	var seeds []Seed
+	for _, d := range ds {
+		if !d.IsDir() {
+			continue
+		}
+		if _, ok := LookupTarget(d.Name()); !ok {
+			return nil, fmt.Errorf("seed directory %s is not named after a target", d.Name())
+		}
+		fs, err := ioutil.ReadDir(filepath.Join(dir, d.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading seed directory: %w", err)
+		}
+		for _, f := range fs {
+			if f.IsDir() {
+				continue
+			}
+			p := filepath.Join(dir, d.Name(), f.Name())
+			b, err := ioutil.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("error reading seed: %w", err)
+			}
+			switch filepath.Ext(p) {
+			case ".b64":
+				b, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+			case ".hex":
+				b, err = hex.DecodeString(strings.TrimSpace(string(b)))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error decoding seed %s: %w", p, err)
+			}
+			seeds = append(seeds, Seed{
+				Target: d.Name(),
+				Name:   strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())),
+				Source: p,
+				Data:   b,
+			})
+		}
+	}
+	return seeds, nil
+}
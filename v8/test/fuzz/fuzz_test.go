@@ -0,0 +1,67 @@
+package fuzz
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorpus(t *testing.T) {
+	t.Parallel()
+	for _, s := range Corpus() {
+		tgt, ok := LookupTarget(s.Target)
+		if !assert.True(t, ok, "target %s of seed %s not found", s.Target, s.Name) {
+			continue
+		}
+		assert.NoError(t, tgt.Unmarshal(s.Data), "seed %s from %s should unmarshal", s.Name, s.Source)
+		// No target should panic with the seeds of the others.
+		assert.Equal(t, 1, Fuzz(s.Data), "fuzz result for seed %s not as expected", s.Name)
+	}
+}
+
+func TestFuzz_Truncated(t *testing.T) {
+	t.Parallel()
+	for _, s := range Corpus() {
+		for i := 0; i < len(s.Data); i++ {
+			Fuzz(s.Data[:i])
+		}
+	}
+}
+
+func TestReadSeeds(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "gokrb5-fuzz")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	td := filepath.Join(dir, "messages.KRBError")
+	if err := os.Mkdir(td, 0700); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	var krbErr Seed
+	for _, s := range Corpus() {
+		if s.Target == "messages.KRBError" {
+			krbErr = s
+			break
+		}
+	}
+	ioutil.WriteFile(filepath.Join(td, "raw"), krbErr.Data, 0600)
+	ioutil.WriteFile(filepath.Join(td, "capture.hex"), []byte("7e0e"), 0600)
+	seeds, err := ReadSeeds(dir)
+	if err != nil {
+		t.Fatalf("error reading seeds: %v", err)
+	}
+	if assert.Len(t, seeds, 2, "number of seeds not as expected") {
+		assert.Equal(t, "capture", seeds[0].Name, "seed name not as expected")
+		assert.Equal(t, []byte{0x7e, 0x0e}, seeds[0].Data, "hex seed not decoded")
+		assert.Equal(t, krbErr.Data, seeds[1].Data, "raw seed not as expected")
+	}
+
+	os.Mkdir(filepath.Join(dir, "unknown"), 0700)
+	_, err = ReadSeeds(dir)
+	assert.Error(t, err, "directory not named after a target should error")
+}
@@ -0,0 +1,20 @@
+//go:build go1.18
+// +build go1.18
+
+package fuzz
+
+import (
+	"testing"
+)
+
+// FuzzTargets runs the targets with Go's native fuzzing, for example:
+//
+//	go test -fuzz FuzzTargets ./test/fuzz
+func FuzzTargets(f *testing.F) {
+	for _, s := range Corpus() {
+		f.Add(s.Data)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		Fuzz(b)
+	})
+}
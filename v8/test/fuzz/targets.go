@@ -0,0 +1,106 @@
+// Package fuzz provides fuzz targets for the unmarshaling of Kerberos messages, SPNEGO and GSS-API tokens, PACs,
+// keytabs and credential caches along with a seed corpus of marshaled data.
+//
+// The Fuzz function is a go-fuzz entry point running every target. The targets can also be wrapped in native fuzz
+// tests where Go 1.18 or later is used, seeded with the Corpus and any captures of a project's own read with
+// ReadSeeds.
+package fuzz
+
+import (
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/kadmin"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/pac"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Target is a fuzz target for one of the unmarshal paths of the library.
+type Target struct {
+	// Name of the target, such as "messages.ASReq".
+	Name string
+	// Unmarshal unmarshals the data, returning an error if it is not valid.
+	Unmarshal func(b []byte) error
+}
+
+// Targets are the fuzz targets for each of the unmarshal paths of the library.
+var Targets = []Target{
+	{"messages.ASReq", func(b []byte) error { var m messages.ASReq; return m.Unmarshal(b) }},
+	{"messages.TGSReq", func(b []byte) error { var m messages.TGSReq; return m.Unmarshal(b) }},
+	{"messages.KDCReqBody", func(b []byte) error { var m messages.KDCReqBody; return m.Unmarshal(b) }},
+	{"messages.ASRep", func(b []byte) error { var m messages.ASRep; return m.Unmarshal(b) }},
+	{"messages.TGSRep", func(b []byte) error { var m messages.TGSRep; return m.Unmarshal(b) }},
+	{"messages.EncKDCRepPart", func(b []byte) error { var m messages.EncKDCRepPart; return m.Unmarshal(b) }},
+	{"messages.APReq", func(b []byte) error { var m messages.APReq; return m.Unmarshal(b) }},
+	{"messages.APRep", func(b []byte) error { var m messages.APRep; return m.Unmarshal(b) }},
+	{"messages.EncAPRepPart", func(b []byte) error { var m messages.EncAPRepPart; return m.Unmarshal(b) }},
+	{"messages.Ticket", func(b []byte) error { var m messages.Ticket; return m.Unmarshal(b) }},
+	{"messages.EncTicketPart", func(b []byte) error { var m messages.EncTicketPart; return m.Unmarshal(b) }},
+	{"messages.KRBError", func(b []byte) error { var m messages.KRBError; return m.Unmarshal(b) }},
+	{"messages.KRBCred", func(b []byte) error { var m messages.KRBCred; return m.Unmarshal(b) }},
+	{"messages.EncKrbCredPart", func(b []byte) error { var m messages.EncKrbCredPart; return m.Unmarshal(b) }},
+	{"messages.KRBPriv", func(b []byte) error { var m messages.KRBPriv; return m.Unmarshal(b) }},
+	{"messages.EncKrbPrivPart", func(b []byte) error { var m messages.EncKrbPrivPart; return m.Unmarshal(b) }},
+	{"messages.KRBSafe", func(b []byte) error { var m messages.KRBSafe; return m.Unmarshal(b) }},
+	{"types.Authenticator", func(b []byte) error { var m types.Authenticator; return m.Unmarshal(b) }},
+	{"types.AuthorizationData", func(b []byte) error { var m types.AuthorizationData; return m.Unmarshal(b) }},
+	{"types.ADKDCIssued", func(b []byte) error { var m types.ADKDCIssued; return m.Unmarshal(b) }},
+	{"types.EncryptedData", func(b []byte) error { var m types.EncryptedData; return m.Unmarshal(b) }},
+	{"types.EncryptionKey", func(b []byte) error { var m types.EncryptionKey; return m.Unmarshal(b) }},
+	{"types.Checksum", func(b []byte) error { var m types.Checksum; return m.Unmarshal(b) }},
+	{"types.PADataSequence", func(b []byte) error { var m types.PADataSequence; return m.Unmarshal(b) }},
+	{"types.PAEncTSEnc", func(b []byte) error { var m types.PAEncTSEnc; return m.Unmarshal(b) }},
+	{"types.ETypeInfo", func(b []byte) error { var m types.ETypeInfo; return m.Unmarshal(b) }},
+	{"types.ETypeInfo2", func(b []byte) error { var m types.ETypeInfo2; return m.Unmarshal(b) }},
+	{"types.TypedDataSequence", func(b []byte) error { var m types.TypedDataSequence; return m.Unmarshal(b) }},
+	{"spnego.SPNEGOToken", func(b []byte) error { var m spnego.SPNEGOToken; return m.Unmarshal(b) }},
+	{"spnego.NegToken", func(b []byte) error { _, _, err := spnego.UnmarshalNegToken(b); return err }},
+	{"spnego.KRB5Token", func(b []byte) error { var m spnego.KRB5Token; return m.Unmarshal(b) }},
+	{"gssapi.WrapToken", func(b []byte) error {
+		var m gssapi.WrapToken
+		if err := m.Unmarshal(b, true); err != nil {
+			return m.Unmarshal(b, false)
+		}
+		return nil
+	}},
+	{"gssapi.MICToken", func(b []byte) error {
+		var m gssapi.MICToken
+		if err := m.Unmarshal(b, true); err != nil {
+			return m.Unmarshal(b, false)
+		}
+		return nil
+	}},
+	{"pac.PACType", func(b []byte) error { var m pac.PACType; return m.Unmarshal(b) }},
+	{"pac.KerbValidationInfo", func(b []byte) error { var m pac.KerbValidationInfo; return m.Unmarshal(b) }},
+	{"pac.ClientInfo", func(b []byte) error { var m pac.ClientInfo; return m.Unmarshal(b) }},
+	{"pac.UPNDNSInfo", func(b []byte) error { var m pac.UPNDNSInfo; return m.Unmarshal(b) }},
+	{"pac.ClientClaimsInfo", func(b []byte) error { var m pac.ClientClaimsInfo; return m.Unmarshal(b) }},
+	{"pac.SignatureData", func(b []byte) error { var m pac.SignatureData; _, err := m.Unmarshal(b); return err }},
+	{"kadmin.Reply", func(b []byte) error { var m kadmin.Reply; return m.Unmarshal(b) }},
+	{"keytab.Keytab", func(b []byte) error { return keytab.New().Unmarshal(b) }},
+	{"credentials.CCache", func(b []byte) error { var m credentials.CCache; return m.Unmarshal(b) }},
+}
+
+// LookupTarget returns the target with the name provided.
+func LookupTarget(name string) (Target, bool) {
+	for _, t := range Targets {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Target{}, false
+}
+
+// Fuzz is the go-fuzz entry point. The data is unmarshaled by every target and 1 is returned if any of them
+// unmarshaled it without error so that go-fuzz gives priority to the input, otherwise 0.
+func Fuzz(data []byte) int {
+	r := 0
+	for _, t := range Targets {
+		if t.Unmarshal(data) == nil {
+			r = 1
+		}
+	}
+	return r
+}
@@ -0,0 +1,245 @@
+// Package interop provides a harness for validating the acceptance of a corpus of SPNEGO tokens against a service's
+// keytab.
+//
+// A deployment can record a corpus from the Authorization headers sent by the HTTP clients it needs to support, such as
+// curl --negotiate, Java HttpClient and Windows (SSPI) clients, together with the keytab of the service, to confirm
+// that their tokens can be accepted without the clients being available to the test. The corpus in the testdata of
+// this package is synthetic: its tokens are generated by gokrb5 in the shape of those sent by each client, with the
+// mechanism types and flags they offer, and are not captures from the clients themselves.
+//
+// Recorded tokens are by definition replays so replay detection is not exercised. The tokens are verified as at the
+// time they were recorded, with the service's maximum clock skew.
+package interop
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/clock"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// Client names used in a corpus.
+const (
+	ClientCurl    = "curl"
+	ClientJava    = "java"
+	ClientWindows = "windows"
+)
+
+// Mechanism names reported in a Result.
+const (
+	MechSPNEGO = "SPNEGO"
+	MechKRB5   = "KRB5"
+)
+
+// Token is a token recorded from a client.
+type Token struct {
+	// Name describes the token, for example the client version and configuration used to record it.
+	Name string `json:"name"`
+	// Client that produced the token, for example "curl", "java" or "windows".
+	Client string `json:"client"`
+	// SPN the token was requested for.
+	SPN string `json:"spn,omitempty"`
+	// Header is the value of the Authorization header sent by the client.
+	// The "Negotiate" prefix is optional.
+	Header string `json:"header"`
+	// Recorded is the time the token was recorded, as at which it is verified. If zero the token is verified as at the
+	// time of the service's clock.
+	Recorded time.Time `json:"recorded"`
+	// Principal is the client principal expected to be authenticated in the form user@REALM. If empty the principal is not checked.
+	Principal string `json:"principal,omitempty"`
+}
+
+// Corpus is a collection of recorded tokens.
+type Corpus struct {
+	Description string  `json:"description,omitempty"`
+	Tokens      []Token `json:"tokens"`
+}
+
+// Result of the verification of a recorded token.
+type Result struct {
+	Token Token
+	// Mech is the mechanism the token was wrapped in, either SPNEGO or KRB5.
+	Mech string
+	// MechTypes offered by the client in a SPNEGO NegTokenInit.
+	MechTypes []string
+	// Principal authenticated in the form user@REALM.
+	Principal string
+	// PAC indicates if the ticket contained a PAC that was validated.
+	PAC bool
+	// Err is nil if the token was accepted.
+	Err error
+}
+
+// Passed indicates if the token was accepted.
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// LoadCorpus loads a JSON encoded corpus from the file at the path provided.
+func LoadCorpus(path string) (*Corpus, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read corpus file: %w", err)
+	}
+	c := new(Corpus)
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal corpus: %w", err)
+	}
+	return c, nil
+}
+
+// JSON returns the corpus as a JSON string.
+func (c *Corpus) JSON() (string, error) {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Verify each of the tokens in the corpus against the keytab provided.
+// Service settings may be provided to configure the verification, for example to specify the keytab principal.
+func (c *Corpus) Verify(kt *keytab.Keytab, settings ...func(*service.Settings)) []Result {
+	r := make([]Result, len(c.Tokens))
+	for i, tkn := range c.Tokens {
+		r[i] = Verify(tkn, kt, settings...)
+	}
+	return r
+}
+
+// Run verifies each of the tokens in the corpus as a subtest of the test provided.
+func (c *Corpus) Run(t *testing.T, kt *keytab.Keytab, settings ...func(*service.Settings)) {
+	t.Helper()
+	for _, tkn := range c.Tokens {
+		tkn := tkn
+		t.Run(tkn.Client+"/"+tkn.Name, func(t *testing.T) {
+			r := Verify(tkn, kt, settings...)
+			if !r.Passed() {
+				t.Errorf("token not accepted: %v", r.Err)
+			}
+		})
+	}
+}
+
+// Verify the recorded token against the keytab provided.
+func Verify(tkn Token, kt *keytab.Keytab, settings ...func(*service.Settings)) Result {
+	r := Result{Token: tkn}
+	mt, err := r.mechToken()
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if !mt.IsAPReq() {
+		r.Err = errors.New("mechanism token is not an AP_REQ")
+		return r
+	}
+	// The token is verified as at the time it was recorded, so that the clock skew and the ticket's validity are
+	// checked against that time.
+	if !tkn.Recorded.IsZero() {
+		settings = append(append([]func(*service.Settings){}, settings...), service.Clock(clock.NewFake(tkn.Recorded)))
+	}
+	s := service.NewSettings(kt, settings...)
+	APReq := &mt.APReq
+	ok, err := APReq.VerifyWithClock(s.KeyProvider(), s.MaxClockSkew(), s.ClientAddress(), s.KeytabPrincipal(), s.Clock())
+	if err != nil || !ok {
+		r.Err = fmt.Errorf("AP_REQ not valid: %w", err)
+		return r
+	}
+	if s.RequireHostAddr() && len(APReq.Ticket.DecryptedEncPart.CAddr) < 1 {
+		r.Err = messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_BADADDR, "ticket does not contain HostAddress values required")
+		return r
+	}
+	r.Principal = APReq.Authenticator.CName.PrincipalNameString() + "@" + APReq.Authenticator.CRealm
+	if tkn.Principal != "" && r.Principal != tkn.Principal {
+		r.Err = fmt.Errorf("authenticated principal %s does not match the expected principal %s", r.Principal, tkn.Principal)
+		return r
+	}
+	if s.DecodePAC() {
+		isPAC, _, err := APReq.Ticket.GetPACType(s.KeyProvider(), s.KeytabPrincipal(), s.Logger())
+		if isPAC && err != nil {
+			r.Err = fmt.Errorf("PAC not valid: %w", err)
+			return r
+		}
+		r.PAC = isPAC
+	}
+	return r
+}
+
+// mechToken decodes the Kerberos mechanism token from the recorded header value.
+func (r *Result) mechToken() (*spnego.KRB5Token, error) {
+	h := strings.TrimSpace(r.Token.Header)
+	if len(h) > len(spnego.HTTPHeaderAuthResponseValueKey) && strings.EqualFold(h[:len(spnego.HTTPHeaderAuthResponseValueKey)], spnego.HTTPHeaderAuthResponseValueKey) {
+		h = strings.TrimSpace(h[len(spnego.HTTPHeaderAuthResponseValueKey):])
+	}
+	b, err := base64.StdEncoding.DecodeString(h)
+	if err != nil {
+		return nil, fmt.Errorf("could not base64 decode token: %w", err)
+	}
+	mt := new(spnego.KRB5Token)
+	// Some clients, such as Java configured for the Kerberos scheme, send the KRB5 token without the SPNEGO wrapper.
+	if mt.Unmarshal(b) == nil {
+		r.Mech = MechKRB5
+		return mt, nil
+	}
+	var st spnego.SPNEGOToken
+	err = st.Unmarshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal token: %w", err)
+	}
+	if !st.Init {
+		return nil, errors.New("token is not a SPNEGO NegTokenInit")
+	}
+	r.Mech = MechSPNEGO
+	var supported bool
+	for _, oid := range st.NegTokenInit.MechTypes {
+		r.MechTypes = append(r.MechTypes, mechName(oid.String()))
+		if oid.Equal(gssapi.OIDKRB5.OID()) || oid.Equal(gssapi.OIDMSLegacyKRB5.OID()) {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, errors.New("no supported mechanism offered in the SPNEGO NegTokenInit")
+	}
+	if len(st.NegTokenInit.MechTokenBytes) < 1 {
+		return nil, errors.New("no optimistic mechanism token in the SPNEGO NegTokenInit")
+	}
+	err = mt.Unmarshal(st.NegTokenInit.MechTokenBytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal KRB5 mechanism token: %w", err)
+	}
+	return mt, nil
+}
+
+// mechName returns the name of the mechanism with the OID provided.
+func mechName(oid string) string {
+	switch oid {
+	case gssapi.OIDKRB5.OID().String():
+		return string(gssapi.OIDKRB5)
+	case gssapi.OIDMSLegacyKRB5.OID().String():
+		return string(gssapi.OIDMSLegacyKRB5)
+	case oidNEGOEX:
+		return "NEGOEX"
+	case oidNTLMSSP:
+		return "NTLMSSP"
+	}
+	return oid
+}
+
+// MechType OIDs offered by Windows clients alongside Kerberos.
+const (
+	oidNEGOEX  = "1.3.6.1.4.1.311.2.2.30"
+	oidNTLMSSP = "1.3.6.1.4.1.311.2.2.10"
+)
@@ -0,0 +1,150 @@
+package interop
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSPN = "HTTP/host.test.gokrb5"
+
+func testKeytab(t *testing.T, h string) *keytab.Keytab {
+	b, _ := hex.DecodeString(h)
+	kt := keytab.New()
+	err := kt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error loading keytab: %v", err)
+	}
+	return kt
+}
+
+// testToken synthesises a token in the shape sent by the client. The mechTypes are offered in a SPNEGO NegTokenInit
+// or if none are provided the KRB5 token is returned without the SPNEGO wrapper.
+func testToken(t *testing.T, clientName, name string, etype int32, gssFlags []int, mechTypes ...asn1.ObjectIdentifier) Token {
+	kt := testKeytab(t, testdata.HTTP_KEYTAB)
+	cl := client.NewWithKeytab("testuser1", "TEST.GOKRB5", testKeytab(t, testdata.KEYTAB_TESTUSER1_TEST_GOKRB5), config.New())
+	now := time.Now().UTC()
+	tkt, key, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, testSPN), "TEST.GOKRB5",
+		types.NewKrbFlags(), kt, etype, 2, now, now, now.Add(10*time.Hour), now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("error creating ticket: %v", err)
+	}
+	mt, err := spnego.NewKRB5TokenAPREQ(cl, tkt, key, gssFlags, []int{flags.APOptionMutualRequired})
+	if err != nil {
+		t.Fatalf("error creating KRB5 token: %v", err)
+	}
+	b, err := mt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB5 token: %v", err)
+	}
+	if len(mechTypes) > 0 {
+		st := spnego.SPNEGOToken{
+			Init: true,
+			NegTokenInit: spnego.NegTokenInit{
+				MechTypes:      mechTypes,
+				MechTokenBytes: b,
+			},
+		}
+		b, err = st.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling SPNEGO token: %v", err)
+		}
+	}
+	return Token{
+		Name:      name,
+		Client:    clientName,
+		SPN:       testSPN,
+		Header:    spnego.HTTPHeaderAuthResponseValueKey + " " + base64.StdEncoding.EncodeToString(b),
+		Recorded:  now,
+		Principal: "testuser1@TEST.GOKRB5",
+	}
+}
+
+// MechType OIDs offered by Windows clients alongside Kerberos.
+var (
+	testOIDNEGOEX  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 30}
+	testOIDNTLMSSP = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+)
+
+func testCorpus(t *testing.T) *Corpus {
+	mutual := []int{gssapi.ContextFlagMutual, gssapi.ContextFlagReplay}
+	sspi := []int{gssapi.ContextFlagMutual, gssapi.ContextFlagSequence, gssapi.ContextFlagConf, gssapi.ContextFlagInteg}
+	return &Corpus{
+		Description: "Synthetic tokens generated by gokrb5 in the shape sent by each client, not captures from the clients",
+		Tokens: []Token{
+			testToken(t, ClientCurl, "curl --negotiate (MIT krb5)", etypeID.AES256_CTS_HMAC_SHA1_96, mutual,
+				gssapi.OIDKRB5.OID()),
+			testToken(t, ClientJava, "Java HttpClient SPNEGO", etypeID.AES128_CTS_HMAC_SHA1_96, mutual,
+				gssapi.OIDKRB5.OID()),
+			testToken(t, ClientJava, "Java HttpClient Kerberos scheme", etypeID.AES128_CTS_HMAC_SHA1_96, mutual),
+			testToken(t, ClientWindows, "Windows SSPI (Edge)", etypeID.AES256_CTS_HMAC_SHA1_96, sspi,
+				gssapi.OIDMSLegacyKRB5.OID(), gssapi.OIDKRB5.OID(), testOIDNEGOEX, testOIDNTLMSSP),
+		},
+	}
+}
+
+func TestCorpus_Run(t *testing.T) {
+	t.Parallel()
+	c, err := LoadCorpus("testdata/corpus.json")
+	if err != nil {
+		t.Fatalf("error loading corpus: %v", err)
+	}
+	c.Run(t, testKeytab(t, testdata.HTTP_KEYTAB))
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	kt := testKeytab(t, testdata.HTTP_KEYTAB)
+	c := testCorpus(t)
+	// Verifying the corpus twice must not fail due to replay detection
+	c.Verify(kt)
+	for _, r := range c.Verify(kt, service.DecodePAC(false)) {
+		if !assert.True(t, r.Passed(), "%s token not accepted: %v", r.Token.Name, r.Err) {
+			continue
+		}
+		assert.Equal(t, "testuser1@TEST.GOKRB5", r.Principal, "%s principal not as expected", r.Token.Name)
+	}
+	r := Verify(c.Tokens[2], kt)
+	assert.Equal(t, MechKRB5, r.Mech, "mechanism not as expected")
+	r = Verify(c.Tokens[3], kt)
+	assert.Equal(t, MechSPNEGO, r.Mech, "mechanism not as expected")
+	assert.Equal(t, []string{"MSLegacyKRB5", "KRB5", "NEGOEX", "NTLMSSP"}, r.MechTypes, "mechanism types not as expected")
+
+	// Wrong keytab
+	r = Verify(c.Tokens[0], testKeytab(t, testdata.KEYTAB_TESTUSER1_TEST_GOKRB5))
+	assert.False(t, r.Passed(), "token should not be accepted with the wrong keytab")
+
+	// Unexpected principal
+	tkn := c.Tokens[0]
+	tkn.Principal = "testuser2@TEST.GOKRB5"
+	assert.False(t, Verify(tkn, kt).Passed(), "token should not be accepted for an unexpected principal")
+
+	// Recorded at a time beyond the clock skew of the authenticator
+	tkn = c.Tokens[0]
+	tkn.Recorded = tkn.Recorded.Add(time.Hour)
+	assert.False(t, Verify(tkn, kt).Passed(), "token should not be accepted beyond the clock skew of its recorded time")
+
+	// Only NTLM offered
+	tkn = testToken(t, ClientWindows, "NTLM", etypeID.AES256_CTS_HMAC_SHA1_96, nil, testOIDNTLMSSP)
+	assert.False(t, Verify(tkn, kt).Passed(), "token should not be accepted without a supported mechanism")
+
+	tkn.Header = "Negotiate !!!"
+	assert.False(t, Verify(tkn, kt).Passed(), "invalid token should not be accepted")
+}
@@ -0,0 +1,142 @@
+package krbtest
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// realmKDCs starts a KDC for each realm, each KDC trusting the next so that the clients of the first realm can
+// authenticate to the last. The first KDC has the principal testuser1 and the last has the service principal SPN.
+func realmKDCs(t *testing.T, spn string, realms ...string) []*KDC {
+	var kdcs []*KDC
+	for i, realm := range realms {
+		k, err := NewKDC(realm)
+		if err != nil {
+			t.Fatalf("error starting KDC: %v", err)
+		}
+		kdcs = append(kdcs, k)
+		if i > 0 {
+			if err := kdcs[i-1].AddTrust(k); err != nil {
+				t.Fatalf("error adding trust: %v", err)
+			}
+		}
+	}
+	if err := kdcs[0].AddPrincipal("testuser1", "passwordvalue"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	if err := kdcs[len(kdcs)-1].AddPrincipal(spn, "servicepassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	return kdcs
+}
+
+// verifyCrossRealmTicket checks the service accepts the ticket issued by the KDC to the client of another realm.
+func verifyCrossRealmTicket(t *testing.T, k *KDC, spn string, cl *client.Client, tkt messages.Ticket, key types.EncryptionKey) {
+	kt, err := k.Keytab(spn)
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		t.Fatalf("error creating AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(kt, service.DecodePAC(false)))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted: %v", err)
+	}
+	assert.Equal(t, "testuser1", creds.UserName(), "client principal not as expected")
+	assert.Equal(t, cl.Credentials.Domain(), creds.Domain(), "client realm not as expected")
+}
+
+func sessionRealms(cl *client.Client) []string {
+	var realms []string
+	for _, s := range cl.DebugSnapshot().Sessions {
+		realms = append(realms, s.Realm)
+	}
+	return realms
+}
+
+func TestKDC_CrossRealmCAPaths(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.res.gokrb5"
+	kdcs := realmKDCs(t, spn, "USERS.GOKRB5", "HUB.GOKRB5", "MID.GOKRB5", "RES.GOKRB5")
+	for _, k := range kdcs {
+		defer k.Close()
+	}
+	c, err := kdcs[0].Config(kdcs[1:]...)
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.DomainRealm[".res.gokrb5"] = "RES.GOKRB5"
+
+	// Without capaths the hierarchical path through GOKRB5 is not trusted.
+	cl := client.NewWithPassword("testuser1", "USERS.GOKRB5", "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	_, _, err = cl.GetServiceTicket(spn)
+	assert.Error(t, err, "service ticket should not be issued without a trusted path")
+
+	c.CAPaths = config.CAPaths{"USERS.GOKRB5": {"RES.GOKRB5": {"HUB.GOKRB5", "MID.GOKRB5"}}}
+	cl = client.NewWithPassword("testuser1", "USERS.GOKRB5", "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	tkt, key, err := cl.GetServiceTicket(spn)
+	if err != nil {
+		t.Fatalf("error getting service ticket across three trusts: %v", err)
+	}
+	assert.Equal(t, "RES.GOKRB5", tkt.Realm, "ticket realm not as expected")
+	verifyCrossRealmTicket(t, kdcs[3], spn, cl, tkt, key)
+	assert.Equal(t, []string{"HUB.GOKRB5", "MID.GOKRB5", "RES.GOKRB5", "USERS.GOKRB5"}, sessionRealms(cl),
+		"the cross-realm TGTs for the intermediate realms should be kept as sessions")
+
+	// Another service of the realm is reached with the cached cross-realm TGT without traversing the path again.
+	if err := kdcs[3].AddPrincipal("HTTP/other.res.gokrb5", "servicepassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	var requests []int
+	for _, k := range kdcs {
+		requests = append(requests, k.Requests())
+	}
+	_, _, err = cl.GetServiceTicket("HTTP/other.res.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	for i, k := range kdcs[:3] {
+		assert.Equal(t, requests[i], k.Requests(), "KDC for %s should not be sent requests", k.Realm)
+	}
+	assert.Equal(t, requests[3]+1, kdcs[3].Requests(), "requests to the KDC of the service's realm not as expected")
+}
+
+func TestKDC_CrossRealmHierarchical(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.other.test.gokrb5"
+	kdcs := realmKDCs(t, spn, "CHILD.TEST.GOKRB5", "TEST.GOKRB5", "OTHER.TEST.GOKRB5")
+	for _, k := range kdcs {
+		defer k.Close()
+	}
+	c, err := kdcs[0].Config(kdcs[1:]...)
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.DomainRealm[".other.test.gokrb5"] = "OTHER.TEST.GOKRB5"
+	cl := client.NewWithPassword("testuser1", "CHILD.TEST.GOKRB5", "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	tkt, key, err := cl.GetServiceTicket(spn)
+	if err != nil {
+		t.Fatalf("error getting service ticket through the parent realm: %v", err)
+	}
+	verifyCrossRealmTicket(t, kdcs[2], spn, cl, tkt, key)
+	assert.Equal(t, []string{"CHILD.TEST.GOKRB5", "OTHER.TEST.GOKRB5", "TEST.GOKRB5"}, sessionRealms(cl),
+		"sessions not as expected")
+}
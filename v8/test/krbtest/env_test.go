@@ -0,0 +1,76 @@
+package krbtest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKDC_NewFromEnvironment(t *testing.T) {
+	k := testKDC(t)
+	defer k.Close()
+	dir, err := ioutil.TempDir("", "TEST-gokrb5-env")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	conf := fmt.Sprintf("[libdefaults]\n default_realm = %s\n[realms]\n %s = {\n  kdc = %s\n }\n", k.Realm, k.Realm, k.Addr())
+	if err := ioutil.WriteFile(filepath.Join(dir, "krb5.conf"), []byte(conf), 0600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+	kt, err := k.Keytab("testuser1")
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	if err := kt.Save(filepath.Join(dir, "client.keytab")); err != nil {
+		t.Fatalf("error saving keytab: %v", err)
+	}
+	for v, p := range map[string]string{
+		config.ConfigEnvVar:       filepath.Join(dir, "krb5.conf"),
+		credentials.CCacheEnvVar:  "FILE:" + filepath.Join(dir, "krb5cc"),
+		keytab.ClientKeytabEnvVar: filepath.Join(dir, "client.keytab"),
+	} {
+		os.Setenv(v, p)
+		defer os.Unsetenv(v)
+	}
+
+	// Without a credential cache the client logs in with the client keytab.
+	cl, err := client.NewFromEnvironment()
+	if err != nil {
+		t.Fatalf("error creating client from the environment: %v", err)
+	}
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in with the client keytab: %v", err)
+	}
+	assert.Equal(t, "testuser1", cl.Credentials.UserName(), "client principal not as expected")
+	cc, err := cl.CCache()
+	if err != nil {
+		t.Fatalf("error getting credential cache: %v", err)
+	}
+	if err := cc.Save(filepath.Join(dir, "krb5cc")); err != nil {
+		t.Fatalf("error saving credential cache: %v", err)
+	}
+
+	// The credential cache is used once it holds a TGT.
+	os.Unsetenv(keytab.ClientKeytabEnvVar)
+	cl, err = client.NewFromEnvironment()
+	if err != nil {
+		t.Fatalf("error creating client from the credential cache of the environment: %v", err)
+	}
+	requests := k.Requests()
+	_, _, err = cl.GetServiceTicket(testSPN)
+	assert.NoError(t, err, "error getting service ticket with the TGT of the credential cache")
+	assert.Equal(t, requests+1, k.Requests(), "only a TGS exchange should be made")
+
+	os.Setenv(config.ConfigEnvVar, filepath.Join(dir, "missing.conf"))
+	_, err = client.NewFromEnvironment()
+	assert.Error(t, err, "client should not be created without a krb5.conf")
+}
@@ -0,0 +1,367 @@
+package krbtest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/msgtype"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/iana/patype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// process returns the marshaled response to the marshaled request.
+func (k *KDC) process(b []byte) []byte {
+	var rb []byte
+	var err error
+	if len(b) > 0 && int(b[0]&0x1f) == asnAppTag.TGSREQ {
+		rb, err = k.tgsExchange(b)
+	} else {
+		rb, err = k.asExchange(b)
+	}
+	if err != nil {
+		krberr, ok := err.(messages.KRBError)
+		if !ok {
+			krberr = k.krbError(types.PrincipalName{}, errorcode.KRB_ERR_GENERIC, err.Error())
+		}
+		rb, _ = krberr.Marshal()
+	}
+	return rb
+}
+
+// krbError returns a KRB_ERROR with the server time of the KDC's clock.
+func (k *KDC) krbError(sname types.PrincipalName, code int32, etext string) messages.KRBError {
+	e := messages.NewKRBError(sname, k.Realm, code, etext)
+	t := k.now()
+	e.STime = t
+	e.Susec = t.Nanosecond() / int(time.Microsecond)
+	return e
+}
+
+// asExchange processes an AS_REQ.
+func (k *KDC) asExchange(b []byte) ([]byte, error) {
+	var asReq messages.ASReq
+	if err := asReq.Unmarshal(b); err != nil {
+		return nil, k.krbError(types.PrincipalName{}, errorcode.KRB_AP_ERR_MSG_TYPE, fmt.Sprintf("could not unmarshal request: %v", err))
+	}
+	sname := asReq.ReqBody.SName
+	if r, ok := k.referral(asReq.ReqBody.CName); ok && canonicalize(asReq.ReqBody) {
+		// Client referral, RFC 6806 section 7.
+		e := k.krbError(sname, errorcode.KDC_ERR_WRONG_REALM, "client is in another realm")
+		e.CName = asReq.ReqBody.CName
+		e.CRealm = r
+		return nil, e
+	}
+	cname := k.canonicalName(asReq.ReqBody.CName)
+	cp, ok, code := k.principal(cname)
+	if code != 0 {
+		return nil, k.krbError(sname, code, "error forced for client")
+	}
+	if !ok {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, "client not found")
+	}
+	sp, ok, code := k.principal(sname)
+	if code != 0 {
+		return nil, k.krbError(sname, code, "error forced for service")
+	}
+	if !ok {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "server not found")
+	}
+	et, ok := selectEType(asReq.ReqBody.EType, cp.etypes)
+	if !ok {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_ETYPE_NOSUPP, "no supported encryption type requested")
+	}
+	salt := types.PADataSequence{k.eTypeInfo2(cp, et)}
+	if err := k.verifyPreAuth(asReq, cname, cp, salt); err != nil {
+		return nil, err
+	}
+	if canonicalize(asReq.ReqBody) {
+		asReq.ReqBody.CName = cname
+	}
+	now := k.now()
+	f := ticketFlags(asReq.ReqBody, true)
+	tkt, sessionKey, err := k.newTicket(asReq.ReqBody, k.Realm, sp, now, f)
+	if err != nil {
+		return nil, err
+	}
+	ckey, _, err := k.keytab().GetEncryptionKey(cname, k.Realm, int(cp.kvno), et)
+	if err != nil {
+		return nil, err
+	}
+	ed, err := k.encKDCRepPart(asReq.ReqBody, tkt, sessionKey, now, f, ckey, keyusage.AS_REP_ENCPART, int(cp.kvno))
+	if err != nil {
+		return nil, err
+	}
+	asRep := messages.ASRep{
+		KDCRepFields: messages.KDCRepFields{
+			PVNO:    iana.PVNO,
+			MsgType: msgtype.KRB_AS_REP,
+			PAData:  salt,
+			CRealm:  k.Realm,
+			CName:   asReq.ReqBody.CName,
+			Ticket:  tkt,
+			EncPart: ed,
+		},
+	}
+	return asRep.Marshal()
+}
+
+// verifyPreAuth checks the encrypted timestamp pre-authentication of the AS_REQ, returning a KRB_ERROR requiring
+// pre-authentication if it is not present.
+func (k *KDC) verifyPreAuth(asReq messages.ASReq, cname types.PrincipalName, cp principal, salt types.PADataSequence) error {
+	sname := asReq.ReqBody.SName
+	for _, pa := range asReq.PAData {
+		if pa.PADataType != patype.PA_ENC_TIMESTAMP {
+			continue
+		}
+		var ed types.EncryptedData
+		if err := ed.Unmarshal(pa.PADataValue); err != nil {
+			return k.krbError(sname, errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal encrypted timestamp")
+		}
+		key, _, err := k.keytab().GetEncryptionKey(cname, k.Realm, int(cp.kvno), ed.EType)
+		if err != nil {
+			return k.krbError(sname, errorcode.KDC_ERR_ETYPE_NOSUPP, "encrypted timestamp encryption type not supported")
+		}
+		tb, err := crypto.DecryptEncPart(ed, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP)
+		if err != nil {
+			return k.krbError(sname, errorcode.KDC_ERR_PREAUTH_FAILED, "could not decrypt encrypted timestamp")
+		}
+		var ts types.PAEncTSEnc
+		if err := ts.Unmarshal(tb); err != nil {
+			return k.krbError(sname, errorcode.KDC_ERR_PREAUTH_FAILED, "could not unmarshal timestamp")
+		}
+		if !withinSkew(ts.PATimestamp.Add(time.Duration(ts.PAUSec)*time.Microsecond), k.now()) {
+			return k.krbError(sname, errorcode.KRB_AP_ERR_SKEW, "clock skew too great")
+		}
+		return nil
+	}
+	e := k.krbError(sname, errorcode.KDC_ERR_PREAUTH_REQUIRED, "pre-authentication required")
+	e.CName = asReq.ReqBody.CName
+	e.CRealm = k.Realm
+	e.EData, _ = asn1.Marshal(append(salt, types.PAData{PADataType: patype.PA_ENC_TIMESTAMP}))
+	return e
+}
+
+// eTypeInfo2 returns the ETYPE-INFO2 PA data for the principal's key of the etype.
+func (k *KDC) eTypeInfo2(p principal, et int32) types.PAData {
+	pn, _ := types.ParseSPNString(p.name)
+	b, _ := asn1.Marshal(types.ETypeInfo2{{EType: et, Salt: pn.GetSalt(k.Realm)}})
+	return types.PAData{PADataType: patype.PA_ETYPE_INFO2, PADataValue: b}
+}
+
+// tgsExchange processes a TGS_REQ.
+func (k *KDC) tgsExchange(b []byte) ([]byte, error) {
+	var tgsReq messages.TGSReq
+	if err := tgsReq.Unmarshal(b); err != nil {
+		return nil, k.krbError(types.PrincipalName{}, errorcode.KRB_AP_ERR_MSG_TYPE, fmt.Sprintf("could not unmarshal request: %v", err))
+	}
+	sname := tgsReq.ReqBody.SName
+	var apReq messages.APReq
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			if err := apReq.Unmarshal(pa.PADataValue); err != nil {
+				return nil, k.krbError(sname, errorcode.KRB_AP_ERR_MSG_TYPE, "could not unmarshal AP_REQ")
+			}
+		}
+	}
+	if len(apReq.Ticket.SName.NameString) < 1 {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_PADATA_TYPE_NOSUPP, "no PA-TGS-REQ")
+	}
+	if err := apReq.Ticket.DecryptEncPart(k.keytab(), nil); err != nil {
+		return nil, k.krbError(sname, errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt TGT")
+	}
+	tgt := apReq.Ticket.DecryptedEncPart
+	if err := apReq.DecryptAuthenticator(tgt.Key); err != nil {
+		return nil, k.krbError(sname, errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt authenticator")
+	}
+	now := k.now()
+	if now.After(tgt.EndTime) {
+		return nil, k.krbError(sname, errorcode.KRB_AP_ERR_TKT_EXPIRED, "TGT has expired")
+	}
+	if !withinSkew(apReq.Authenticator.CTime.Add(time.Duration(apReq.Authenticator.Cusec)*time.Microsecond), now) {
+		return nil, k.krbError(sname, errorcode.KRB_AP_ERR_SKEW, "clock skew too great")
+	}
+	if _, _, code := k.principal(tgt.CName); code != 0 {
+		return nil, k.krbError(sname, code, "error forced for client")
+	}
+	if r, ok := k.referral(sname); ok && canonicalize(tgsReq.ReqBody) {
+		// Server referral, RFC 6806 section 8, with a TGT for the realm of the service.
+		sname = types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+r)
+		tgsReq.ReqBody.SName = sname
+	}
+	sp, ok, code := k.principal(sname)
+	if code != 0 {
+		return nil, k.krbError(sname, code, "error forced for service")
+	}
+	if !ok {
+		return nil, k.krbError(sname, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "server not found")
+	}
+	f := ticketFlags(tgsReq.ReqBody, false)
+	if sp.okAsDelegate {
+		types.SetFlag(&f, flags.OKAsDelegate)
+	}
+	if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.Forwarded) {
+		if !types.IsFlagSet(&tgt.Flags, flags.Forwardable) {
+			return nil, k.krbError(sname, errorcode.KDC_ERR_BADOPTION, "TGT is not forwardable")
+		}
+		types.SetFlag(&f, flags.Forwarded)
+	}
+	// The client principal name is taken from the TGT.
+	tgsReq.ReqBody.CName = tgt.CName
+	var tkt messages.Ticket
+	var sessionKey types.EncryptionKey
+	var err error
+	if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.EncTktInSkey) {
+		tkt, sessionKey, err = k.newUser2UserTicket(tgsReq.ReqBody, tgt.CRealm, now, f)
+	} else {
+		tkt, sessionKey, err = k.newTicket(tgsReq.ReqBody, tgt.CRealm, sp, now, f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ed, err := k.encKDCRepPart(tgsReq.ReqBody, tkt, sessionKey, now, f, tgt.Key, keyusage.TGS_REP_ENCPART_SESSION_KEY, 0)
+	if err != nil {
+		return nil, err
+	}
+	tgsRep := messages.TGSRep{
+		KDCRepFields: messages.KDCRepFields{
+			PVNO:    iana.PVNO,
+			MsgType: msgtype.KRB_TGS_REP,
+			CRealm:  tgt.CRealm,
+			CName:   tgt.CName,
+			Ticket:  tkt,
+			EncPart: ed,
+		},
+	}
+	return tgsRep.Marshal()
+}
+
+// canonicalize indicates if the request asks for the names to be canonicalized.
+func canonicalize(body messages.KDCReqBody) bool {
+	return len(body.KDCOptions.Bytes) > flags.Canonicalize/8 && types.IsFlagSet(&body.KDCOptions, flags.Canonicalize)
+}
+
+// ticketFlags returns the flags of a ticket issued for the request body, forwardable if requested.
+func ticketFlags(body messages.KDCReqBody, initial bool) asn1.BitString {
+	f := types.NewKrbFlags()
+	types.SetFlag(&f, flags.Renewable)
+	types.SetFlag(&f, flags.PreAuthent)
+	if initial {
+		types.SetFlag(&f, flags.Initial)
+	}
+	if types.IsFlagSet(&body.KDCOptions, flags.Forwardable) {
+		types.SetFlag(&f, flags.Forwardable)
+	}
+	return f
+}
+
+// newTicket issues a ticket with the flags for the service principal to the client named in the request body, of the
+// client realm.
+func (k *KDC) newTicket(body messages.KDCReqBody, crealm string, sp principal, now time.Time, f asn1.BitString) (messages.Ticket, types.EncryptionKey, error) {
+	et, ok := selectEType(body.EType, sp.etypes)
+	if !ok {
+		return messages.Ticket{}, types.EncryptionKey{}, k.krbError(body.SName, errorcode.KDC_ERR_ETYPE_NOSUPP, "no supported encryption type requested")
+	}
+	end, renew := k.ticketTimes(body, now)
+	tkt, sessionKey, err := messages.NewTicket(body.CName, crealm, body.SName, k.Realm, f, k.keytab(), et, int(sp.kvno), now, now, end, renew)
+	if err != nil {
+		return tkt, sessionKey, k.krbError(body.SName, errorcode.KRB_ERR_GENERIC, err.Error())
+	}
+	return tkt, sessionKey, nil
+}
+
+// newUser2UserTicket issues a user-to-user ticket with the flags to the client named in the request body, of the
+// client realm, encrypted with the session key of the additional ticket, RFC 4120 section 3.7. The additional ticket
+// must be a TGT of the KDC's realm issued to the service principal requested.
+func (k *KDC) newUser2UserTicket(body messages.KDCReqBody, crealm string, now time.Time, f asn1.BitString) (messages.Ticket, types.EncryptionKey, error) {
+	if len(body.AdditionalTickets) < 1 {
+		return messages.Ticket{}, types.EncryptionKey{}, k.krbError(body.SName, errorcode.KDC_ERR_BADOPTION, "no additional ticket for ENC-TKT-IN-SKEY")
+	}
+	tgt := body.AdditionalTickets[0]
+	if tgt.SName.PrincipalNameString() != "krbtgt/"+k.Realm {
+		return messages.Ticket{}, types.EncryptionKey{}, k.krbError(body.SName, errorcode.KDC_ERR_BADOPTION, "additional ticket is not a TGT")
+	}
+	if err := tgt.DecryptEncPart(k.keytab(), nil); err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, k.krbError(body.SName, errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt additional ticket")
+	}
+	if !tgt.DecryptedEncPart.CName.Equal(body.SName) {
+		return messages.Ticket{}, types.EncryptionKey{}, k.krbError(body.SName, errorcode.KDC_ERR_SERVER_NOMATCH, "additional ticket is not for the service")
+	}
+	if now.After(tgt.DecryptedEncPart.EndTime) {
+		return messages.Ticket{}, types.EncryptionKey{}, k.krbError(body.SName, errorcode.KRB_AP_ERR_TKT_EXPIRED, "additional ticket has expired")
+	}
+	key := tgt.DecryptedEncPart.Key
+	kt := keytab.New()
+	kt.AddKey(body.SName.PrincipalNameString(), k.Realm, key, 0)
+	end, renew := k.ticketTimes(body, now)
+	tkt, sessionKey, err := messages.NewTicket(body.CName, crealm, body.SName, k.Realm, f, kt, key.KeyType, 0, now, now, end, renew)
+	if err != nil {
+		return tkt, sessionKey, k.krbError(body.SName, errorcode.KRB_ERR_GENERIC, err.Error())
+	}
+	return tkt, sessionKey, nil
+}
+
+// ticketTimes returns the end and renew till times of a ticket issued now for the request body.
+func (k *KDC) ticketTimes(body messages.KDCReqBody, now time.Time) (time.Time, time.Time) {
+	end := now.Add(DefaultTicketLifetime)
+	if !body.Till.IsZero() && body.Till.Before(end) {
+		end = body.Till
+	}
+	renew := now.Add(DefaultRenewLifetime)
+	if !body.RTime.IsZero() && body.RTime.Before(renew) {
+		renew = body.RTime
+	}
+	if renew.Before(end) {
+		renew = end
+	}
+	return end, renew
+}
+
+// encKDCRepPart returns the encrypted part of a KDC_REP for the ticket issued in response to the request body.
+func (k *KDC) encKDCRepPart(body messages.KDCReqBody, tkt messages.Ticket, sessionKey types.EncryptionKey, now time.Time, f asn1.BitString, key types.EncryptionKey, usage uint32, kvno int) (types.EncryptedData, error) {
+	end, renew := k.ticketTimes(body, now)
+	encPart := messages.EncKDCRepPart{
+		Key:       sessionKey,
+		LastReqs:  []messages.LastReq{},
+		Nonce:     body.Nonce,
+		Flags:     f,
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   end,
+		RenewTill: renew,
+		SRealm:    k.Realm,
+		SName:     tkt.SName,
+	}
+	b, err := encPart.Marshal()
+	if err != nil {
+		return types.EncryptedData{}, err
+	}
+	return crypto.GetEncryptedData(b, key, usage, kvno)
+}
+
+// selectEType returns the first of the etypes requested that the principal has a key for.
+func selectEType(requested, keys []int32) (int32, bool) {
+	for _, r := range requested {
+		for _, et := range keys {
+			if r == et {
+				return et, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// withinSkew indicates if the client's time is within MaxClockSkew of the KDC's.
+func withinSkew(t, now time.Time) bool {
+	d := now.Sub(t)
+	return d <= MaxClockSkew && d >= -MaxClockSkew
+}
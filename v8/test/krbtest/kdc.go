@@ -0,0 +1,460 @@
+// Package krbtest provides a scriptable fake KDC listening on loopback UDP and TCP ports so that Kerberos clients and
+// services, including those of projects using gokrb5, can be unit tested without a real KDC.
+//
+// The KDC issues TGTs and service tickets for the principals added to it. Pre-authentication with an encrypted
+// timestamp is required. Failures can be scripted deterministically by forcing the error code returned for a
+// principal, offsetting the KDC's clock to introduce clock skew and delaying the responses to introduce latency.
+// Cross-realm authentication is tested with the KDCs of several realms and trusts between them.
+// Password changes are tested with the kpasswd server of a KDC started with NewKpasswdServer.
+//
+// The KDC is intended for tests only. It does not implement FAST, PACs, constrained delegation or the validation of
+// the checksums of TGS_REQ bodies, and only makes the referrals configured with SetReferral. Tickets holding PACs can instead be minted with a TicketBuilder.
+package krbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Default values used by the KDC.
+const (
+	// DefaultTicketLifetime is the lifetime of the tickets issued.
+	DefaultTicketLifetime = 10 * time.Hour
+	// DefaultRenewLifetime is the period for which the tickets issued can be renewed.
+	DefaultRenewLifetime = 7 * 24 * time.Hour
+	// MaxClockSkew is the maximum clock skew the KDC accepts in pre-authentication timestamps and authenticators.
+	MaxClockSkew = 5 * time.Minute
+)
+
+// DefaultETypes are the encryption types of the keys created for a principal if none are specified.
+var DefaultETypes = []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96}
+
+// principal holds the details of a principal known to the KDC.
+type principal struct {
+	name     string
+	realm    string // the realm of the principal if it is not the KDC's
+	password string
+	kvno     uint8
+	etypes   []int32
+	created  time.Time
+	// okAsDelegate sets the ok-as-delegate flag of the tickets issued for the principal.
+	okAsDelegate bool
+}
+
+// KDC is a fake KDC for a single realm listening on a loopback address. Trusts with the KDCs of other realms are added
+// with AddTrust.
+type KDC struct {
+	requests   int64 // accessed atomically so must be 64-bit aligned
+	Realm      string
+	tcp        net.Listener
+	udp        *net.UDPConn
+	principals map[string]principal
+	kt         *keytab.Keytab
+	errs       map[string]int32
+	referrals  map[string]string
+	aliases    map[string]string
+	skew       time.Duration
+	latency    time.Duration
+	mux        sync.RWMutex
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewKDC starts a KDC for the realm listening on the same loopback port for UDP and TCP.
+// The KDC has the principal krbtgt/REALM and should be closed once the test is complete.
+func NewKDC(realm string) (*KDC, error) {
+	k := &KDC{
+		Realm:      realm,
+		principals: make(map[string]principal),
+		kt:         keytab.New(),
+		errs:       make(map[string]int32),
+		referrals:  make(map[string]string),
+		aliases:    make(map[string]string),
+	}
+	password, err := randomPassword()
+	if err != nil {
+		return nil, err
+	}
+	if err := k.AddPrincipal("krbtgt/"+realm, password); err != nil {
+		return nil, err
+	}
+	// The UDP port may already be in use so retry with another port.
+	for i := 0; i < 10; i++ {
+		k.tcp, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("error listening on TCP: %w", err)
+		}
+		k.udp, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: k.tcp.Addr().(*net.TCPAddr).Port})
+		if err == nil {
+			break
+		}
+		k.tcp.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listening on UDP: %w", err)
+	}
+	k.ctx, k.cancel = context.WithCancel(context.Background())
+	k.wg.Add(2)
+	go k.serveTCP()
+	go k.serveUDP()
+	return k, nil
+}
+
+// Addr returns the address the KDC is listening on for both UDP and TCP.
+func (k *KDC) Addr() string {
+	return k.tcp.Addr().String()
+}
+
+// Close stops the KDC and waits for the responses in progress to complete.
+func (k *KDC) Close() error {
+	k.cancel()
+	err := k.tcp.Close()
+	if uerr := k.udp.Close(); err == nil {
+		err = uerr
+	}
+	k.wg.Wait()
+	return err
+}
+
+// Config returns a client configuration for the KDC's realm with the KDC as its only KDC. The realms of the other KDCs
+// provided are configured too, for clients of the KDC's realm to authenticate to services in them across trusts.
+func (k *KDC) Config(others ...*KDC) (*config.Config, error) {
+	var realms strings.Builder
+	for _, kdc := range append([]*KDC{k}, others...) {
+		fmt.Fprintf(&realms, "  %s = {\n    kdc = %s\n  }\n", kdc.Realm, kdc.Addr())
+	}
+	return config.NewFromString(fmt.Sprintf(`[libdefaults]
+  default_realm = %s
+  dns_lookup_kdc = false
+  dns_lookup_realm = false
+
+[realms]
+%s`, k.Realm, realms.String()))
+}
+
+// AddPrincipal adds a principal, such as "testuser1" or "HTTP/host.test.gokrb5", to the realm with keys derived from
+// the password for the encryption types provided, or DefaultETypes if none are. Adding an existing principal
+// replaces its keys with those of the next kvno.
+func (k *KDC) AddPrincipal(name, password string, etypes ...int32) error {
+	if len(etypes) < 1 {
+		etypes = DefaultETypes
+	}
+	return k.addPrincipal(name, "", password, etypes)
+}
+
+// AddTrust adds a trust between the KDC's realm and the realm of the other KDC, so that the KDC issues TGTs for the
+// other realm, krbtgt/OTHER@REALM, to its clients which the other KDC accepts to issue them tickets. A trust is one
+// way, clients of the other realm cannot get TGTs for the KDC's realm unless the other KDC trusts it too.
+func (k *KDC) AddTrust(other *KDC) error {
+	password, err := randomPassword()
+	if err != nil {
+		return err
+	}
+	name := "krbtgt/" + other.Realm
+	if err := k.AddPrincipal(name, password); err != nil {
+		return err
+	}
+	return other.addPrincipal(name, k.Realm, password, DefaultETypes)
+}
+
+// addPrincipal adds a principal with keys derived from the password. If the realm is not empty the keys are those of
+// the principal in that realm, such as those shared with another realm's KDC for the cross-realm TGTs it issues.
+func (k *KDC) addPrincipal(name, realm, password string, etypes []int32) error {
+	key := name
+	if realm != "" {
+		key = name + "@" + realm
+	}
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	p := principal{
+		name:     name,
+		realm:    realm,
+		password: password,
+		kvno:     k.principals[key].kvno + 1,
+		etypes:   etypes,
+		created:  time.Now().UTC(),
+	}
+	// The keytab is replaced rather than modified so that it can be read without holding the lock.
+	kt := keytab.New()
+	for n, e := range k.principals {
+		if n == key {
+			continue
+		}
+		if err := e.addEntries(kt, k.Realm); err != nil {
+			return err
+		}
+	}
+	if err := p.addEntries(kt, k.Realm); err != nil {
+		return err
+	}
+	k.principals[key] = p
+	k.kt = kt
+	return nil
+}
+
+// RemovePrincipal removes the principal from the realm, so that the KDC no longer issues tickets to or for it.
+func (k *KDC) RemovePrincipal(name string) error {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if _, ok := k.principals[name]; !ok {
+		return fmt.Errorf("principal %s not found in realm %s", name, k.Realm)
+	}
+	kt := keytab.New()
+	for n, e := range k.principals {
+		if n == name {
+			continue
+		}
+		if err := e.addEntries(kt, k.Realm); err != nil {
+			return err
+		}
+	}
+	delete(k.principals, name)
+	k.kt = kt
+	return nil
+}
+
+// randomPassword returns a random password for a principal.
+func randomPassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating password: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// addEntries adds the keys of the principal to the keytab, in the principal's realm if it has one otherwise in the
+// realm provided.
+func (p principal) addEntries(kt *keytab.Keytab, realm string) error {
+	if p.realm != "" {
+		realm = p.realm
+	}
+	for _, et := range p.etypes {
+		if err := kt.AddEntry(p.name, realm, p.password, p.created, p.kvno, et); err != nil {
+			return fmt.Errorf("error creating key for %s with etype %d: %w", p.name, et, err)
+		}
+	}
+	return nil
+}
+
+// Keytab returns a keytab holding the current keys of the principal, for example for a service to verify the tickets
+// issued for it.
+func (k *KDC) Keytab(name string) (*keytab.Keytab, error) {
+	k.mux.RLock()
+	p, ok := k.principals[name]
+	k.mux.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("principal %s not found in realm %s", name, k.Realm)
+	}
+	kt := keytab.New()
+	if err := p.addEntries(kt, k.Realm); err != nil {
+		return nil, err
+	}
+	return kt, nil
+}
+
+// ForceError configures the KDC to respond with a KRB_ERROR with the error code provided, such as
+// errorcode.KDC_ERR_CLIENT_REVOKED, to requests from or for the principal. A code of zero clears the error.
+func (k *KDC) ForceError(name string, code int32) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if code == 0 {
+		delete(k.errs, name)
+		return
+	}
+	k.errs[name] = code
+}
+
+// SetOKAsDelegate configures whether the tickets issued for the service principal have the ok-as-delegate flag,
+// indicating the service is trusted for delegation.
+func (k *KDC) SetOKAsDelegate(name string, b bool) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if p, ok := k.principals[name]; ok {
+		p.okAsDelegate = b
+		k.principals[name] = p
+	}
+}
+
+// SetReferral configures the KDC to refer requests from or for the principal, which is in another realm, to that
+// realm when the request asks for the names to be canonicalized, RFC 6806. An AS_REQ from the principal is answered
+// with a KDC_ERR_WRONG_REALM error with the realm as the client realm and a TGS_REQ for the principal with a referral
+// TGT for the realm, which requires a trust with the realm added with AddTrust. An empty realm clears the referral.
+func (k *KDC) SetReferral(name, realm string) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if realm == "" {
+		delete(k.referrals, name)
+		return
+	}
+	k.referrals[name] = realm
+}
+
+// AddAlias adds an alias for the client principal, such as an enterprise name of the form user@domain. The KDC replies to an AS_REQ from the alias with the principal's
+// canonical name if the request asks for the names to be canonicalized, otherwise with the alias.
+func (k *KDC) AddAlias(alias, name string) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.aliases[alias] = name
+}
+
+// SetClockSkew offsets the KDC's clock, which is used for the times of tickets and the validation of clients'
+// timestamps, from the system clock by the duration provided.
+func (k *KDC) SetClockSkew(d time.Duration) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.skew = d
+}
+
+// SetLatency delays each response from the KDC by the duration provided.
+func (k *KDC) SetLatency(d time.Duration) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	k.latency = d
+}
+
+// Requests returns the number of requests the KDC has received.
+func (k *KDC) Requests() int {
+	return int(atomic.LoadInt64(&k.requests))
+}
+
+// now returns the time according to the KDC's clock.
+func (k *KDC) now() time.Time {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	return time.Now().UTC().Add(k.skew)
+}
+
+// keytab returns the keytab holding the keys of all the principals.
+func (k *KDC) keytab() *keytab.Keytab {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	return k.kt
+}
+
+// referral returns the realm requests from or for the principal are referred to, if any.
+func (k *KDC) referral(pn types.PrincipalName) (string, bool) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	r, ok := k.referrals[pn.PrincipalNameString()]
+	return r, ok
+}
+
+// canonicalName returns the name of the principal the name is an alias of, or the name if it is not an alias.
+func (k *KDC) canonicalName(pn types.PrincipalName) types.PrincipalName {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	if n, ok := k.aliases[pn.PrincipalNameString()]; ok {
+		if pn.NameType == nametype.KRB_NT_ENTERPRISE {
+			return types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, n)
+		}
+		return types.NewPrincipalName(pn.NameType, n)
+	}
+	return pn
+}
+
+// principal returns the principal, if it exists, and any error forced for it.
+func (k *KDC) principal(pn types.PrincipalName) (principal, bool, int32) {
+	k.mux.RLock()
+	defer k.mux.RUnlock()
+	name := pn.PrincipalNameString()
+	p, ok := k.principals[name]
+	return p, ok, k.errs[name]
+}
+
+// respond processes a request after the configured latency. Nil is returned if the KDC is closed while waiting.
+func (k *KDC) respond(b []byte) []byte {
+	atomic.AddInt64(&k.requests, 1)
+	k.mux.RLock()
+	d := k.latency
+	k.mux.RUnlock()
+	if d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-k.ctx.Done():
+			return nil
+		}
+	}
+	return k.process(b)
+}
+
+func (k *KDC) serveTCP() {
+	defer k.wg.Done()
+	for {
+		conn, err := k.tcp.Accept()
+		if err != nil {
+			return
+		}
+		k.wg.Add(1)
+		go func(conn net.Conn) {
+			defer k.wg.Done()
+			defer conn.Close()
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				// Unblock the read when the KDC is closed.
+				select {
+				case <-k.ctx.Done():
+					conn.Close()
+				case <-done:
+				}
+			}()
+			for {
+				hb := make([]byte, 4)
+				if _, err := io.ReadFull(conn, hb); err != nil {
+					return
+				}
+				b := make([]byte, binary.BigEndian.Uint32(hb))
+				if _, err := io.ReadFull(conn, b); err != nil {
+					return
+				}
+				rb := k.respond(b)
+				if rb == nil {
+					return
+				}
+				binary.BigEndian.PutUint32(hb, uint32(len(rb)))
+				if _, err := conn.Write(append(hb, rb...)); err != nil {
+					return
+				}
+			}
+		}(conn)
+	}
+}
+
+func (k *KDC) serveUDP() {
+	defer k.wg.Done()
+	for {
+		b := make([]byte, 65535)
+		n, addr, err := k.udp.ReadFromUDP(b)
+		if err != nil {
+			if k.ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		k.wg.Add(1)
+		go func() {
+			defer k.wg.Done()
+			if rb := k.respond(b[:n]); rb != nil {
+				k.udp.WriteToUDP(rb, addr)
+			}
+		}()
+	}
+}
@@ -0,0 +1,465 @@
+package krbtest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/krberror"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRealm = "TEST.GOKRB5"
+	testSPN   = "HTTP/host.test.gokrb5"
+)
+
+func testKDC(t *testing.T) *KDC {
+	k, err := NewKDC(testRealm)
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	if err := k.AddPrincipal("testuser1", "passwordvalue"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	if err := k.AddPrincipal(testSPN, "servicepassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	return k
+}
+
+func testClient(t *testing.T, k *KDC, password string, settings ...func(*client.Settings)) *client.Client {
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	return client.NewWithPassword("testuser1", testRealm, password, c, settings...)
+}
+
+func TestKDC_ServiceTicket(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	cl := testClient(t, k, "passwordvalue")
+	err := cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	tkt, key, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+
+	// The ticket is accepted by the service with the keytab from the KDC.
+	kt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		t.Fatalf("error creating AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(kt, service.DecodePAC(false)))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted: %v", err)
+	}
+	assert.Equal(t, "testuser1", creds.UserName(), "client principal not as expected")
+	assert.True(t, k.Requests() >= 3, "requests not counted")
+}
+
+func TestKDC_TCP(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	cl := testClient(t, k, "passwordvalue")
+	// Force the use of TCP
+	cl.Config.LibDefaults.UDPPreferenceLimit = 1
+	err := cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in over TCP: %v", err)
+	}
+}
+
+func TestKDC_Failover(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	// A KDC that closes each connection without responding.
+	dead, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer dead.Close()
+	var accepted int32
+	go func() {
+		for {
+			conn, err := dead.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			conn.Close()
+		}
+	}()
+	cl := testClient(t, k, "passwordvalue")
+	cl.Config.LibDefaults.UDPPreferenceLimit = 1
+	cl.Config.Realms[0].KDC = []string{dead.Addr().String(), k.Addr()}
+	for i := 0; i < 10; i++ {
+		if err := cl.Login(); err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+	}
+	assert.True(t, atomic.LoadInt32(&accepted) <= 1, "KDC that failed should be tried after the one that answered, was tried %d times",
+		atomic.LoadInt32(&accepted))
+}
+
+func TestKDC_Errors(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+
+	var krberr messages.KRBError
+	err := testClient(t, k, "wrongpassword").Login()
+	if assert.True(t, errors.As(err, &krberr), "error should be a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KDC_ERR_PREAUTH_FAILED, krberr.ErrorCode, "error code for wrong password not as expected")
+	}
+	assert.True(t, errors.Is(err, krberror.ErrPreAuthFailed), "wrong password should match ErrPreAuthFailed")
+
+	k.ForceError("testuser1", errorcode.KDC_ERR_CLIENT_REVOKED)
+	err = testClient(t, k, "passwordvalue").Login()
+	if assert.True(t, errors.As(err, &krberr), "error should be a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KDC_ERR_CLIENT_REVOKED, krberr.ErrorCode, "forced error code not as expected")
+	}
+	assert.True(t, krberror.Is(err, errorcode.KDC_ERR_CLIENT_REVOKED), "forced error code should match")
+	k.ForceError("testuser1", 0)
+
+	cl := testClient(t, k, "passwordvalue")
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in once forced error cleared: %v", err)
+	}
+	k.ForceError(testSPN, errorcode.KDC_ERR_SERVICE_REVOKED)
+	_, _, err = cl.GetServiceTicket(testSPN)
+	if assert.True(t, errors.As(err, &krberr), "error should be a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KDC_ERR_SERVICE_REVOKED, krberr.ErrorCode, "forced error code for service not as expected")
+	}
+	_, _, err = cl.GetServiceTicket("HTTP/unknown.test.gokrb5")
+	if assert.True(t, errors.As(err, &krberr), "error should be a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, krberr.ErrorCode, "error code for unknown service not as expected")
+	}
+}
+
+func TestKDC_ClockSkew(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	k.SetClockSkew(time.Hour)
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.LibDefaults.KDCTimeSync = 0
+	var krberr messages.KRBError
+	err = client.NewWithPassword("testuser1", testRealm, "passwordvalue", c).Login()
+	if assert.True(t, errors.As(err, &krberr), "error should be a KRBError: %v", err) {
+		assert.Equal(t, errorcode.KRB_AP_ERR_SKEW, krberr.ErrorCode, "error code not as expected")
+	}
+
+	// With kdc_timesync the client corrects its time from that of the KDC's error and retries.
+	cl := testClient(t, k, "passwordvalue")
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in with clock skew: %v", err)
+	}
+	_, _, err = cl.GetServiceTicket(testSPN)
+	assert.NoError(t, err, "error getting service ticket with clock skew")
+
+	// The skew changing after login is corrected for in the TGS exchange.
+	if err := k.AddPrincipal("HTTP/other.test.gokrb5", "servicepassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	k.SetClockSkew(time.Hour + 10*time.Minute)
+	_, _, err = cl.GetServiceTicket("HTTP/other.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket once the clock skew changed")
+}
+
+func TestKDC_Latency(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	k.SetLatency(100 * time.Millisecond)
+	start := time.Now()
+	err := testClient(t, k, "passwordvalue").Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	// Pre-authentication requires two round trips
+	assert.True(t, time.Since(start) >= 200*time.Millisecond, "latency not applied")
+}
+
+// countingHandles provides handles to the keys of a keytab, counting the requests for them.
+type countingHandles struct {
+	kt *keytab.Keytab
+	n  int32
+}
+
+func (c *countingHandles) GetKeyHandle(pn types.PrincipalName, realm string, kvno int, etype int32) (keytab.KeyHandle, error) {
+	atomic.AddInt32(&c.n, 1)
+	key, kvno, err := c.kt.GetEncryptionKey(pn, realm, kvno, etype)
+	if err != nil {
+		return nil, err
+	}
+	return keytab.NewKeyHandle(key, kvno), nil
+}
+
+func TestKDC_KeyHandles(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	ckt, err := k.Keytab("testuser1")
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	ch := &countingHandles{kt: ckt}
+	cl := client.NewWithKeyHandles("testuser1", testRealm, ch, c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in with key handles: %v", err)
+	}
+	assert.True(t, atomic.LoadInt32(&ch.n) > 0, "client key handles not used")
+	_, _, err = cl.Key(nil, 0, nil)
+	assert.True(t, errors.Is(err, keytab.ErrKeyNotExtractable), "client key value should not be available")
+	tkt, key, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+
+	kt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	sh := &countingHandles{kt: kt}
+	auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		t.Fatalf("error creating AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(nil, service.KeyHandleProvider(sh), service.DecodePAC(false)))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted with key handles: %v", err)
+	}
+	assert.Equal(t, "testuser1", creds.UserName(), "client principal not as expected")
+	assert.True(t, atomic.LoadInt32(&sh.n) > 0, "service key handles not used")
+}
+
+func TestKDC_ForwardTGT(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	cl := testClient(t, k, "passwordvalue")
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	_, key, err := cl.GetServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	_, err = cl.ForwardTGT(key, nil)
+	assert.Error(t, err, "forwarding a TGT that is not forwardable should fail")
+
+	c.LibDefaults.Forwardable = true
+	cl = client.NewWithPassword("testuser1", testRealm, "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	b, err := cl.ForwardTGT(key, nil)
+	if err != nil {
+		t.Fatalf("error forwarding TGT: %v", err)
+	}
+
+	// The service decrypts the KRB_CRED with the session key of the AP exchange.
+	var krbCred messages.KRBCred
+	if err := krbCred.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling KRB_CRED: %v", err)
+	}
+	if err := krbCred.DecryptEncPart(key); err != nil {
+		t.Fatalf("error decrypting KRB_CRED: %v", err)
+	}
+	ccache, err := krbCred.CCache()
+	if err != nil {
+		t.Fatalf("error getting credential cache from KRB_CRED: %v", err)
+	}
+	assert.Equal(t, "testuser1", ccache.DefaultPrincipal.PrincipalName.PrincipalNameString(), "credential cache principal not as expected")
+	assert.Len(t, ccache.Credentials, 1, "credential cache should hold the forwarded TGT")
+	assert.True(t, types.IsFlagSet(&ccache.Credentials[0].TicketFlags, flags.Forwarded), "TGT is not forwarded")
+
+	// A client created from the KRB_CRED can obtain service tickets on the user's behalf.
+	fcl, err := client.NewFromKRBCred(b, key, c)
+	if err != nil {
+		t.Fatalf("error creating client from KRB_CRED: %v", err)
+	}
+	defer fcl.Destroy()
+	assert.Equal(t, "testuser1", fcl.Credentials.UserName(), "forwarded client's user not as expected")
+	_, _, err = fcl.GetServiceTicket(testSPN)
+	assert.NoError(t, err, "forwarded client could not get a service ticket")
+
+	_, err = client.NewFromKRBCred(b, types.EncryptionKey{KeyType: key.KeyType, KeyValue: make([]byte, len(key.KeyValue))}, c)
+	assert.Error(t, err, "KRB_CRED decrypted with the wrong key should fail")
+}
+
+func TestKDC_InitialServiceTicket(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	cl := testClient(t, k, "passwordvalue")
+	tkt, _, err := cl.GetInitialServiceTicket(testSPN)
+	if err != nil {
+		t.Fatalf("error getting initial service ticket: %v", err)
+	}
+	kt, err := k.Keytab(testSPN)
+	if err != nil {
+		t.Fatalf("error getting keytab: %v", err)
+	}
+	if err := tkt.DecryptEncPart(kt, nil); err != nil {
+		t.Fatalf("error decrypting ticket: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&tkt.DecryptedEncPart.Flags, flags.Initial), "ticket should be initial")
+	_, _, ok := cl.GetCachedTicket(testSPN)
+	assert.False(t, ok, "initial ticket should not be cached")
+
+	// Without its password the client can only get tickets with its TGT.
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	c, err := cl.CCache()
+	if err != nil {
+		t.Fatalf("error exporting credential cache: %v", err)
+	}
+	cc, err := client.NewFromCCache(c, cl.Config)
+	if err != nil {
+		t.Fatalf("error creating client from credential cache: %v", err)
+	}
+	_, _, err = cc.GetInitialServiceTicket(testSPN)
+	assert.Error(t, err, "initial ticket should not be obtained without a secret")
+}
+
+func TestKDC_RemovePrincipal(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	if err := k.RemovePrincipal("testuser1"); err != nil {
+		t.Fatalf("error removing principal: %v", err)
+	}
+	assert.Error(t, testClient(t, k, "passwordvalue").Login(), "removed principal should not log in")
+	assert.Error(t, k.RemovePrincipal("testuser1"), "removing an unknown principal should return an error")
+	_, err := k.Keytab(testSPN)
+	assert.NoError(t, err, "other principals should be kept")
+}
+
+func TestKDC_NegativeCache(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	cl := testClient(t, k, "passwordvalue", client.NegativeCacheTTL(time.Minute))
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	spn := "HTTP/unknown.test.gokrb5"
+	_, _, err := cl.GetServiceTicket(spn)
+	var e messages.KRBError
+	if !errors.As(err, &e) || e.ErrorCode != errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN {
+		t.Fatalf("expected KDC_ERR_S_PRINCIPAL_UNKNOWN, got: %v", err)
+	}
+
+	// The failure is returned again without sending the request to the KDC.
+	requests := k.Requests()
+	_, _, err = cl.GetServiceTicket(spn)
+	assert.True(t, errors.As(err, &e) && e.ErrorCode == errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN, "cached failure not as expected: %v", err)
+	results := cl.GetServiceTickets(context.Background(), []string{spn})
+	assert.Error(t, results[spn].Err, "cached failure should be returned for requests of several tickets")
+	assert.Equal(t, requests, k.Requests(), "KDC should not be sent requests for an SPN with a cached failure")
+
+	// Once the service is registered the request bypassing the cache gets the ticket and replaces the failure.
+	if err := k.AddPrincipal(spn, "servicepassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	_, _, err = cl.GetServiceTicket(spn)
+	assert.Error(t, err, "failure should still be cached")
+	_, _, err = cl.GetServiceTicketContext(client.BypassNegativeCache(context.Background()), spn)
+	assert.NoError(t, err, "request bypassing the cache should be sent to the KDC")
+	assert.Equal(t, requests+1, k.Requests(), "requests to the KDC not as expected")
+
+	// An invalidated failure is requested from the KDC again.
+	_, _, err = cl.GetServiceTicket("HTTP/other.test.gokrb5")
+	assert.Error(t, err, "unknown SPN should fail")
+	if err := k.AddPrincipal("HTTP/other.test.gokrb5", "servicepassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	cl.InvalidateNegativeCache("HTTP/other.test.gokrb5")
+	_, _, err = cl.GetServiceTicket("HTTP/other.test.gokrb5")
+	assert.NoError(t, err, "invalidated failure should be requested from the KDC again")
+}
+
+func TestKDC_User2User(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	if err := k.AddPrincipal("peeruser", "peerpassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	peer := client.NewWithPassword("peeruser", testRealm, "peerpassword", c)
+	tgt, _, err := peer.TGT()
+	if err != nil {
+		t.Fatalf("error getting peer's TGT: %v", err)
+	}
+	cl := testClient(t, k, "passwordvalue")
+	tkt, key, err := cl.GetUser2UserServiceTicket("peeruser", tgt)
+	if err != nil {
+		t.Fatalf("error getting user-to-user ticket: %v", err)
+	}
+	assert.Equal(t, "peeruser", tkt.SName.PrincipalNameString(), "ticket not for the peer")
+	assert.Equal(t, 0, tkt.EncPart.KVNO, "user-to-user ticket should not have a kvno")
+	_, _, ok := cl.GetCachedTicket("peeruser")
+	assert.False(t, ok, "user-to-user ticket should not be cached")
+
+	auth, _ := types.NewAuthenticator(cl.Credentials.Domain(), cl.Credentials.CName())
+	apReq, err := messages.NewAPReq(tkt, key, auth)
+	if err != nil {
+		t.Fatalf("error creating AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(nil, service.User2User(peer), service.DecodePAC(false)))
+	if !ok || err != nil {
+		t.Fatalf("user-to-user AP_REQ not accepted: %v", err)
+	}
+	assert.Equal(t, "testuser1", creds.UserName(), "client principal not as expected")
+
+	// The ticket is not accepted by another principal's TGT.
+	ok, _, err = service.VerifyAPREQ(&apReq, service.NewSettings(nil, service.User2User(testClient(t, k, "passwordvalue")), service.DecodePAC(false)))
+	assert.False(t, ok, "user-to-user ticket accepted by another principal")
+	assert.Error(t, err, "expected error accepting ticket for another principal")
+
+	// The KDC refuses a TGT issued to a principal other than the one requested.
+	_, _, err = cl.GetUser2UserServiceTicket(testSPN, tgt)
+	assert.Error(t, err, "expected error requesting ticket for a principal other than the TGT's client")
+}
@@ -0,0 +1,225 @@
+package krbtest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/kadmin"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// kpasswdSPN is the principal of the tickets kpasswd requests are authenticated with.
+const kpasswdSPN = "kadmin/changepw"
+
+// Kpasswd result codes, RFC 3244 section 2.
+const (
+	kpasswdSuccess           = 0
+	kpasswdMalformed         = 1
+	kpasswdHardError         = 2
+	kpasswdAuthError         = 3
+	kpasswdSoftError         = 4
+	kpasswdAccessDenied      = 5
+	kpasswdInitialFlagNeeded = 7
+)
+
+// KpasswdServer is a fake kpasswd server for the realm of a KDC listening over UDP on a loopback address. It changes
+// the passwords of the KDC's principals with initial kadmin/changepw tickets, and sets the passwords of other
+// principals for the administrators added with AddAdmin, RFC 3244.
+type KpasswdServer struct {
+	kdc    *KDC
+	udp    *net.UDPConn
+	admins map[string]bool
+	mux    sync.RWMutex
+	wg     sync.WaitGroup
+}
+
+// NewKpasswdServer starts a kpasswd server for the KDC's realm, adding the kadmin/changepw principal to the KDC.
+// The server should be closed once the test is complete.
+func (k *KDC) NewKpasswdServer() (*KpasswdServer, error) {
+	password, err := randomPassword()
+	if err != nil {
+		return nil, err
+	}
+	if err := k.AddPrincipal(kpasswdSPN, password); err != nil {
+		return nil, err
+	}
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, fmt.Errorf("error listening on UDP: %w", err)
+	}
+	s := &KpasswdServer{
+		kdc:    k,
+		udp:    udp,
+		admins: make(map[string]bool),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the kpasswd server is listening on.
+func (s *KpasswdServer) Addr() string {
+	return s.udp.LocalAddr().String()
+}
+
+// AddAdmin allows the principal, such as "admin", to set the passwords of other principals.
+func (s *KpasswdServer) AddAdmin(name string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.admins[name] = true
+}
+
+// Close stops the kpasswd server.
+func (s *KpasswdServer) Close() error {
+	err := s.udp.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *KpasswdServer) serve() {
+	defer s.wg.Done()
+	for {
+		b := make([]byte, 65535)
+		n, addr, err := s.udp.ReadFromUDP(b)
+		if err != nil {
+			return
+		}
+		if rb := s.process(b[:n]); rb != nil {
+			s.udp.WriteToUDP(rb, addr)
+		}
+	}
+}
+
+// process returns the marshaled reply to the marshaled kpasswd request.
+func (s *KpasswdServer) process(b []byte) []byte {
+	if len(b) < 6 || int(binary.BigEndian.Uint16(b[0:2])) != len(b) {
+		return s.errorReply(kpasswdMalformed, "request length not as expected")
+	}
+	if v := binary.BigEndian.Uint16(b[2:4]); v != 1 && v != 0xff80 {
+		return s.errorReply(kpasswdMalformed, "protocol version not supported")
+	}
+	l := int(binary.BigEndian.Uint16(b[4:6]))
+	if len(b) < 6+l {
+		return s.errorReply(kpasswdMalformed, "AP_REQ length not as expected")
+	}
+	var apReq messages.APReq
+	if err := apReq.Unmarshal(b[6 : 6+l]); err != nil {
+		return s.errorReply(kpasswdMalformed, err.Error())
+	}
+	if ok, err := apReq.Verify(s.kdc.keytab(), MaxClockSkew, types.HostAddress{}, nil); !ok || err != nil {
+		return s.errorReply(kpasswdAuthError, fmt.Sprintf("AP_REQ not valid: %v", err))
+	}
+	if strings.Join(apReq.Ticket.SName.NameString, "/") != kpasswdSPN {
+		return s.errorReply(kpasswdAuthError, "ticket is not for "+kpasswdSPN)
+	}
+	var priv messages.KRBPriv
+	if err := priv.Unmarshal(b[6+l:]); err != nil {
+		return s.errorReply(kpasswdMalformed, err.Error())
+	}
+	subKey := apReq.Authenticator.SubKey
+	if err := priv.DecryptEncPart(subKey); err != nil {
+		return s.errorReply(kpasswdMalformed, err.Error())
+	}
+	var d kadmin.ChangePasswdData
+	if err := d.Unmarshal(priv.DecryptedEncPart.UserData); err != nil {
+		return s.errorReply(kpasswdMalformed, err.Error())
+	}
+	code, result := s.setPassword(apReq.Ticket, d)
+	return s.reply(apReq, subKey, code, result)
+}
+
+// setPassword sets the password of the target principal of the change password data from the client of the ticket,
+// returning the result code and string of the reply.
+func (s *KpasswdServer) setPassword(tkt messages.Ticket, d kadmin.ChangePasswdData) (uint16, string) {
+	client := tkt.DecryptedEncPart.CName.PrincipalNameString()
+	target, realm := client, tkt.DecryptedEncPart.CRealm
+	if len(d.TargName.NameString) > 0 {
+		target, realm = d.TargName.PrincipalNameString(), d.TargRealm
+	}
+	if realm != s.kdc.Realm {
+		return kpasswdSoftError, "target realm is not " + s.kdc.Realm
+	}
+	if target == client && realm == tkt.DecryptedEncPart.CRealm {
+		if !types.IsFlagSet(&tkt.DecryptedEncPart.Flags, flags.Initial) {
+			return kpasswdInitialFlagNeeded, "initial ticket required to change the password"
+		}
+	} else {
+		s.mux.RLock()
+		admin := s.admins[client] && tkt.DecryptedEncPart.CRealm == s.kdc.Realm
+		s.mux.RUnlock()
+		if !admin {
+			return kpasswdAccessDenied, client + " is not allowed to set the password of " + target
+		}
+	}
+	s.kdc.mux.RLock()
+	p, ok := s.kdc.principals[target]
+	s.kdc.mux.RUnlock()
+	if !ok {
+		return kpasswdSoftError, "principal " + target + " not found"
+	}
+	if err := s.kdc.AddPrincipal(target, string(d.NewPasswd), p.etypes...); err != nil {
+		return kpasswdHardError, err.Error()
+	}
+	return kpasswdSuccess, "password set"
+}
+
+// reply returns a reply with the result encrypted in a KRB_PRIV with the subkey of the authenticator of the request.
+func (s *KpasswdServer) reply(apReq messages.APReq, subKey types.EncryptionKey, code uint16, result string) []byte {
+	apRep, err := messages.NewAPRep(apReq.Authenticator, apReq.Ticket.DecryptedEncPart.Key, types.EncryptionKey{}, 0)
+	if err != nil {
+		return s.errorReply(kpasswdHardError, err.Error())
+	}
+	ab, err := apRep.Marshal()
+	if err != nil {
+		return s.errorReply(kpasswdHardError, err.Error())
+	}
+	priv := messages.NewKRBPriv(messages.EncKrbPrivPart{
+		UserData:       resultData(code, result),
+		Timestamp:      apReq.Authenticator.CTime,
+		Usec:           apReq.Authenticator.Cusec,
+		SequenceNumber: apReq.Authenticator.SeqNumber,
+	})
+	if err := priv.EncryptEncPart(subKey); err != nil {
+		return s.errorReply(kpasswdHardError, err.Error())
+	}
+	pb, err := priv.Marshal()
+	if err != nil {
+		return s.errorReply(kpasswdHardError, err.Error())
+	}
+	return replyMessage(ab, pb)
+}
+
+// errorReply returns a reply with the result in the e-data of a KRB_ERROR, for requests that cannot be replied to
+// with a KRB_PRIV.
+func (s *KpasswdServer) errorReply(code uint16, result string) []byte {
+	e := s.kdc.krbError(types.PrincipalName{}, errorcode.KRB_ERR_GENERIC, result)
+	e.EData = resultData(code, result)
+	b, err := e.Marshal()
+	if err != nil {
+		return nil
+	}
+	return replyMessage(nil, b)
+}
+
+// resultData returns the result code followed by the result string.
+func resultData(code uint16, result string) []byte {
+	b := make([]byte, 2, 2+len(result))
+	binary.BigEndian.PutUint16(b, code)
+	return append(b, result...)
+}
+
+// replyMessage returns the kpasswd reply message of the AP_REP, which is empty for a KRB_ERROR, and the KRB_PRIV or
+// KRB_ERROR.
+func replyMessage(apRep, msg []byte) []byte {
+	b := make([]byte, 6, 6+len(apRep)+len(msg))
+	binary.BigEndian.PutUint16(b[0:2], uint16(cap(b)))
+	binary.BigEndian.PutUint16(b[2:4], 1)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(apRep)))
+	return append(append(b, apRep...), msg...)
+}
@@ -0,0 +1,73 @@
+package krbtest
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKpasswdServer(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	for _, name := range []string{"admin", "testuser2"} {
+		if err := k.AddPrincipal(name, "passwordvalue"); err != nil {
+			t.Fatalf("error adding principal: %v", err)
+		}
+	}
+	s, err := k.NewKpasswdServer()
+	if err != nil {
+		t.Fatalf("error starting kpasswd server: %v", err)
+	}
+	defer s.Close()
+	s.AddAdmin("admin")
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.Realms[0].KPasswdServer = []string{s.Addr()}
+
+	// A client changes its own password.
+	cl := client.NewWithPassword("testuser1", testRealm, "passwordvalue", c)
+	ok, err := cl.ChangePasswd("newpassword")
+	if !ok || err != nil {
+		t.Fatalf("error changing password: %v", err)
+	}
+	assert.NoError(t, client.NewWithPassword("testuser1", testRealm, "newpassword", c).Login(), "error logging in with the new password")
+
+	// An administrator sets the password of another principal.
+	target := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2")
+	admin := client.NewWithPassword("admin", testRealm, "passwordvalue", c)
+	ok, err = admin.SetPasswd(target, "", "resetpassword")
+	if !ok || err != nil {
+		t.Fatalf("error setting password: %v", err)
+	}
+	assert.NoError(t, client.NewWithPassword("testuser2", testRealm, "resetpassword", c).Login(), "error logging in with the password set")
+	assert.Error(t, client.NewWithPassword("testuser2", testRealm, "passwordvalue", c).Login(), "old password should not be valid")
+
+	// An administrator with only a credential cache sets the password with a ticket from a TGS exchange.
+	if err := admin.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	cc, err := admin.CCache()
+	if err != nil {
+		t.Fatalf("error getting credential cache: %v", err)
+	}
+	ccl, err := client.NewFromCCache(cc, c)
+	if err != nil {
+		t.Fatalf("error creating client from credential cache: %v", err)
+	}
+	ok, err = ccl.SetPasswd(target, testRealm, "otherpassword")
+	if !ok || err != nil {
+		t.Fatalf("error setting password with a credential cache: %v", err)
+	}
+	assert.NoError(t, client.NewWithPassword("testuser2", testRealm, "otherpassword", c).Login(), "error logging in with the password set")
+
+	// Principals other than administrators cannot set the passwords of others.
+	ok, err = client.NewWithPassword("testuser1", testRealm, "newpassword", c).SetPasswd(target, "", "password")
+	assert.False(t, ok, "password should not be set")
+	assert.Error(t, err, "non-administrator should not set the password of another principal")
+}
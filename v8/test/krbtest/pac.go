@@ -0,0 +1,110 @@
+package krbtest
+
+import (
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/pac"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// Values used in a PAC if none are specified.
+const (
+	// DefaultDomainSID is the SID of the logon domain.
+	DefaultDomainSID = "S-1-5-21-3167651404-3865080224-2280184895"
+	// DefaultPrimaryGroupID is the relative ID of the Domain Users group.
+	DefaultPrimaryGroupID = pac.DefaultPrimaryGroupID
+)
+
+// PAC describes a Microsoft Privilege Attribute Certificate to include in a ticket minted by a TicketBuilder, or to
+// marshal directly.
+//
+// The PAC is built by a pac.Builder with its buffers. The KDC signature is created with the KDCKey, or the service's
+// key if it has no value.
+type PAC struct {
+	// UserName is the account name of the client, used for the effective name and the client info.
+	UserName string
+	// FullName of the user.
+	FullName string
+	// UPN is the user principal name in the UPN_DNS_INFO.
+	UPN string
+	// DNSDomain is the DNS domain name in the UPN_DNS_INFO.
+	DNSDomain string
+	// LogonServer is the NetBIOS name of the domain controller that authenticated the user.
+	LogonServer string
+	// LogonDomainName is the NetBIOS name of the domain of the user.
+	LogonDomainName string
+	// DomainSID is the SID of the logon domain. DefaultDomainSID is used if it is empty.
+	DomainSID string
+	// UserID is the relative ID of the user in the domain.
+	UserID uint32
+	// PrimaryGroupID is the relative ID of the user's primary group. DefaultPrimaryGroupID is used if it is zero.
+	PrimaryGroupID uint32
+	// GroupIDs are the relative IDs of the domain groups the user is a member of.
+	GroupIDs []uint32
+	// ExtraSIDs are the string forms of additional SIDs of the user, such as S-1-18-1.
+	ExtraSIDs []string
+	// ResourceGroupDomainSID is the SID of the domain of the resource groups.
+	ResourceGroupDomainSID string
+	// ResourceGroupIDs are the relative IDs of the resource domain groups the user is a member of.
+	ResourceGroupIDs []uint32
+	// LogOnTime is the time the user authenticated, also used as the client info time.
+	LogOnTime time.Time
+	// S4U2ProxyTarget is the name of the service the ticket was obtained for with S4U2Proxy, in the
+	// S4U_DELEGATION_INFO.
+	S4U2ProxyTarget string
+	// S4UTransitedServices are the names of the services that delegated through S4U2Proxy, in the
+	// S4U_DELEGATION_INFO.
+	S4UTransitedServices []string
+	// SAMName is the sAMAccountName the UPN_DNS_INFO is extended with, along with the user's SID which the
+	// PAC_REQUESTOR holds too, as KDCs with the November 2021 Windows updates do.
+	SAMName string
+	// KDCKey is the key of the KDC's krbtgt principal the KDC signature is created with.
+	KDCKey types.EncryptionKey
+}
+
+// UserSID returns the SID of the user, of the user's ID in the domain.
+func (p PAC) UserSID() string {
+	return p.builder().UserSID()
+}
+
+// GroupMembershipSIDs returns the SIDs of the groups that the PAC asserts, in the form and order that a service
+// reports them in the credentials' ADCredentials.
+func (p PAC) GroupMembershipSIDs() []string {
+	return p.builder().GroupMembershipSIDs()
+}
+
+// Marshal the PAC signing it with the key of the service the ticket holding it is for.
+func (p PAC) Marshal(key types.EncryptionKey) ([]byte, error) {
+	kdcKey := p.KDCKey
+	if len(kdcKey.KeyValue) == 0 {
+		kdcKey = key
+	}
+	return p.builder().Sign(key, kdcKey)
+}
+
+// builder returns the pac.Builder of the PAC, with the default domain SID if none is set.
+func (p PAC) builder() pac.Builder {
+	dsid := p.DomainSID
+	if dsid == "" {
+		dsid = DefaultDomainSID
+	}
+	return pac.Builder{
+		UserName:               p.UserName,
+		FullName:               p.FullName,
+		UPN:                    p.UPN,
+		DNSDomain:              p.DNSDomain,
+		SAMName:                p.SAMName,
+		LogonServer:            p.LogonServer,
+		LogonDomainName:        p.LogonDomainName,
+		DomainSID:              dsid,
+		UserID:                 p.UserID,
+		PrimaryGroupID:         p.PrimaryGroupID,
+		GroupIDs:               p.GroupIDs,
+		ExtraSIDs:              p.ExtraSIDs,
+		ResourceGroupDomainSID: p.ResourceGroupDomainSID,
+		ResourceGroupIDs:       p.ResourceGroupIDs,
+		LogOnTime:              p.LogOnTime,
+		S4U2ProxyTarget:        p.S4U2ProxyTarget,
+		S4UTransitedServices:   p.S4UTransitedServices,
+	}
+}
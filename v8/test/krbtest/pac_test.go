@@ -0,0 +1,291 @@
+package krbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/pac"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPAC() PAC {
+	return PAC{
+		UserName:               "testuser1",
+		FullName:               "Test User1",
+		UPN:                    "testuser1@test.gokrb5",
+		DNSDomain:              "TEST.GOKRB5",
+		LogonServer:            "DC1",
+		LogonDomainName:        "TEST",
+		UserID:                 1105,
+		GroupIDs:               []uint32{513, 1108, 1109},
+		ExtraSIDs:              []string{"S-1-18-1", "S-1-5-21-1-2-3-1000"},
+		ResourceGroupDomainSID: "S-1-5-21-4-5-6",
+		ResourceGroupIDs:       []uint32{1200},
+		LogOnTime:              time.Date(2017, 3, 13, 11, 20, 1, 0, time.UTC),
+	}
+}
+
+func TestPAC_Marshal(t *testing.T) {
+	t.Parallel()
+	p := testPAC()
+	for _, et := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.RC4_HMAC} {
+		kt := keytab.New()
+		if err := kt.AddEntry(testSPN, testRealm, "servicepassword", time.Now(), 1, et); err != nil {
+			t.Fatalf("error creating keytab: %v", err)
+		}
+		sname, _ := types.ParseSPNString(testSPN)
+		key, _, err := kt.GetEncryptionKey(sname, testRealm, 0, et)
+		if err != nil {
+			t.Fatalf("error getting key: %v", err)
+		}
+		b, err := p.Marshal(key)
+		if err != nil {
+			t.Fatalf("error marshaling PAC with etype %d: %v", et, err)
+		}
+		var pt pac.PACType
+		if err := pt.Unmarshal(b); err != nil {
+			t.Fatalf("error unmarshaling PAC with etype %d: %v", et, err)
+		}
+		if err := pt.ProcessPACInfoBuffers(key, nil); err != nil {
+			t.Fatalf("error processing PAC with etype %d: %v", et, err)
+		}
+		kvi := pt.KerbValidationInfo
+		assert.Equal(t, "testuser1", kvi.EffectiveName.Value, "effective name not as expected")
+		assert.Equal(t, "Test User1", kvi.FullName.Value, "full name not as expected")
+		assert.Equal(t, "DC1", kvi.LogonServer.Value, "logon server not as expected")
+		assert.Equal(t, "TEST", kvi.LogonDomainName.Value, "logon domain name not as expected")
+		assert.Equal(t, DefaultDomainSID, kvi.LogonDomainID.String(), "logon domain ID not as expected")
+		assert.Equal(t, uint32(1105), kvi.UserID, "user ID not as expected")
+		assert.Equal(t, DefaultPrimaryGroupID, kvi.PrimaryGroupID, "primary group ID not as expected")
+		assert.Equal(t, p.LogOnTime, kvi.LogOnTime.Time(), "logon time not as expected")
+		assert.Equal(t, p.GroupMembershipSIDs(), kvi.GetGroupMembershipSIDs(), "group membership SIDs not as expected")
+		assert.Equal(t, "testuser1", pt.ClientInfo.Name, "client info name not as expected")
+		if assert.NotNil(t, pt.UPNDNSInfo, "UPN_DNS_INFO not decoded") {
+			assert.Equal(t, "testuser1@test.gokrb5", pt.UPNDNSInfo.UPN, "UPN not as expected")
+			assert.Equal(t, "TEST.GOKRB5", pt.UPNDNSInfo.DNSDomain, "DNS domain not as expected")
+		}
+	}
+}
+
+func TestPAC_Marshal_Minimal(t *testing.T) {
+	t.Parallel()
+	kt := keytab.New()
+	if err := kt.AddEntry(testSPN, testRealm, "servicepassword", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error creating keytab: %v", err)
+	}
+	sname, _ := types.ParseSPNString(testSPN)
+	key, _, _ := kt.GetEncryptionKey(sname, testRealm, 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	b, err := PAC{}.Marshal(key)
+	if err != nil {
+		t.Fatalf("error marshaling PAC: %v", err)
+	}
+	var pt pac.PACType
+	if err := pt.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling PAC: %v", err)
+	}
+	if err := pt.ProcessPACInfoBuffers(key, nil); err != nil {
+		t.Fatalf("error processing PAC: %v", err)
+	}
+	assert.Nil(t, pt.UPNDNSInfo, "UPN_DNS_INFO should not be included")
+	assert.Equal(t, 0, len(pt.KerbValidationInfo.GetGroupMembershipSIDs()), "there should not be any groups")
+
+	_, err = PAC{ExtraSIDs: []string{"not a SID"}}.Marshal(key)
+	assert.Error(t, err, "marshaling a PAC with an invalid SID should fail")
+}
+
+func TestPAC_Marshal_S4UDelegationInfo(t *testing.T) {
+	t.Parallel()
+	kt := keytab.New()
+	if err := kt.AddEntry(testSPN, testRealm, "servicepassword", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error creating keytab: %v", err)
+	}
+	sname, _ := types.ParseSPNString(testSPN)
+	key, _, err := kt.GetEncryptionKey(sname, testRealm, 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	p := testPAC()
+	p.S4U2ProxyTarget = "HTTP/host.test.gokrb5"
+	p.S4UTransitedServices = []string{"gateway@TEST.GOKRB5", "app@TEST.GOKRB5"}
+	b, err := p.Marshal(key)
+	if err != nil {
+		t.Fatalf("error marshaling PAC: %v", err)
+	}
+	var pt pac.PACType
+	if err := pt.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling PAC: %v", err)
+	}
+	if err := pt.ProcessPACInfoBuffers(key, nil); err != nil {
+		t.Fatalf("error processing PAC: %v", err)
+	}
+	if assert.NotNil(t, pt.S4UDelegationInfo, "S4U_DELEGATION_INFO not decoded") {
+		assert.Equal(t, "HTTP/host.test.gokrb5", pt.S4UDelegationInfo.S4U2proxyTarget.Value, "S4U2proxy target not as expected")
+		if assert.Len(t, pt.S4UDelegationInfo.S4UTransitedServices, 2, "transited services not as expected") {
+			assert.Equal(t, "gateway@TEST.GOKRB5", pt.S4UDelegationInfo.S4UTransitedServices[0].Value, "first transited service not as expected")
+			assert.Equal(t, "app@TEST.GOKRB5", pt.S4UDelegationInfo.S4UTransitedServices[1].Value, "second transited service not as expected")
+		}
+	}
+
+	// The delegation info is reported in the credentials' ADCredentials.
+	apReq, err := TicketBuilder{SPN: testSPN, Realm: testRealm, Keytab: kt, PAC: &p}.APReq()
+	if err != nil {
+		t.Fatalf("error building AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(kt))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted: %v", err)
+	}
+	ad := creds.GetADCredentials()
+	assert.Equal(t, p.S4U2ProxyTarget, ad.S4U2ProxyTarget, "S4U2proxy target not as expected")
+	assert.Equal(t, p.S4UTransitedServices, ad.S4UTransitedServices, "transited services not as expected")
+}
+
+func TestTicketBuilder(t *testing.T) {
+	t.Parallel()
+	kt := keytab.New()
+	if err := kt.AddEntry(testSPN, testRealm, "servicepassword", time.Now(), 2, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error creating keytab: %v", err)
+	}
+	p := testPAC()
+	b := TicketBuilder{
+		SPN:    testSPN,
+		Realm:  testRealm,
+		Keytab: kt,
+		PAC:    &p,
+	}
+	apReq, err := b.APReq()
+	if err != nil {
+		t.Fatalf("error building AP_REQ: %v", err)
+	}
+	assert.Equal(t, 2, apReq.Ticket.EncPart.KVNO, "kvno of ticket not as expected")
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(kt))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted: %v", err)
+	}
+	assert.Equal(t, "testuser1", creds.UserName(), "client principal not as expected")
+	ad := creds.GetADCredentials()
+	assert.Equal(t, "testuser1", ad.EffectiveName, "effective name not as expected")
+	assert.Equal(t, "TEST", ad.LogonDomainName, "logon domain name not as expected")
+	assert.Equal(t, 1105, ad.UserID, "user ID not as expected")
+	assert.Equal(t, p.GroupMembershipSIDs(), ad.GroupMembershipSIDs, "group membership SIDs not as expected")
+	assert.Empty(t, ad.S4U2ProxyTarget, "there should not be an S4U2proxy target without an S4U_DELEGATION_INFO")
+
+	// A ticket without a PAC is accepted when PAC decoding is disabled.
+	b.PAC = nil
+	b.CName = "testuser2"
+	b.Lifetime = time.Minute
+	apReq, err = b.APReq()
+	if err != nil {
+		t.Fatalf("error building AP_REQ: %v", err)
+	}
+	ok, creds, err = service.VerifyAPREQ(&apReq, service.NewSettings(kt, service.DecodePAC(false)))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ without PAC not accepted: %v", err)
+	}
+	assert.Equal(t, "testuser2", creds.UserName(), "client principal not as expected")
+	assert.Equal(t, 0, len(creds.GetADCredentials().GroupMembershipSIDs), "there should not be AD credentials")
+
+	_, _, err = TicketBuilder{SPN: testSPN, Realm: testRealm, Keytab: keytab.New()}.Build()
+	assert.Error(t, err, "building a ticket without the service key should fail")
+}
+
+func TestPAC_KeyHandles(t *testing.T) {
+	t.Parallel()
+	kt := keytab.New()
+	if err := kt.AddEntry(testSPN, testRealm, "servicepassword", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error creating keytab: %v", err)
+	}
+	p := testPAC()
+	apReq, err := TicketBuilder{SPN: testSPN, Realm: testRealm, Keytab: kt, PAC: &p}.APReq()
+	if err != nil {
+		t.Fatalf("error building AP_REQ: %v", err)
+	}
+	// The ticket is decrypted and the PAC's server checksum verified with the service's key handle.
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(nil, service.KeyHandleProvider(&countingHandles{kt: kt})))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted with key handles: %v", err)
+	}
+	assert.Equal(t, "Test User1", creds.DisplayName(), "display name from the PAC not as expected")
+
+	other := keytab.New()
+	if err := other.AddEntry(testSPN, testRealm, "otherpassword", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error creating keytab: %v", err)
+	}
+	ok, _, err = service.VerifyAPREQ(&apReq, service.NewSettings(nil, service.KeyHandleProvider(&countingHandles{kt: other})))
+	assert.False(t, ok, "AP_REQ should not be accepted with the handle to another key")
+	assert.Error(t, err, "an error should be returned for the handle to another key")
+}
+
+func TestPAC_Validation(t *testing.T) {
+	t.Parallel()
+	kt := keytab.New()
+	if err := kt.AddEntry(testSPN, testRealm, "servicepassword", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error creating keytab: %v", err)
+	}
+	kdcKT := keytab.New()
+	if err := kdcKT.AddEntry("krbtgt/"+testRealm, testRealm, "kdcpassword", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error creating keytab: %v", err)
+	}
+	krbtgt, _ := types.ParseSPNString("krbtgt/" + testRealm)
+	kdcKey, _, err := kdcKT.GetEncryptionKey(krbtgt, testRealm, 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	p := testPAC()
+	p.SAMName = "testuser1"
+	p.KDCKey = kdcKey
+	authTime := time.Now().UTC().Truncate(time.Second)
+	p.LogOnTime = authTime
+	b := TicketBuilder{SPN: testSPN, Realm: testRealm, Keytab: kt, AuthTime: authTime, PAC: &p}
+	apReq, err := b.APReq()
+	if err != nil {
+		t.Fatalf("error building AP_REQ: %v", err)
+	}
+	ok, creds, err := service.VerifyAPREQ(&apReq, service.NewSettings(kt, service.PACKDCKeyProvider(kdcKT), service.VerifyPACClient(true)))
+	if !ok || err != nil {
+		t.Fatalf("AP_REQ not accepted: %v", err)
+	}
+	ad := creds.GetADCredentials()
+	assert.Equal(t, "testuser1@test.gokrb5", ad.UPN, "UPN not as expected")
+	assert.Equal(t, "TEST.GOKRB5", ad.DNSDomainName, "DNS domain name not as expected")
+	assert.Equal(t, "testuser1", ad.SAMAccountName, "SAM account name not as expected")
+	assert.Equal(t, p.UserSID(), ad.UserSID, "user SID not as expected")
+
+	_, pt, err := apReq.Ticket.GetPACType(kt, nil, nil)
+	if err != nil {
+		t.Fatalf("error getting PAC: %v", err)
+	}
+	if assert.NotNil(t, pt.Requestor, "PAC_REQUESTOR not decoded") {
+		assert.Equal(t, p.UserSID(), pt.Requestor.SID.String(), "requestor SID not as expected")
+	}
+
+	// A PAC whose KDC signature was not created with the KDC's key is rejected.
+	p.KDCKey = types.EncryptionKey{}
+	apReq, err = b.APReq()
+	if err != nil {
+		t.Fatalf("error building AP_REQ: %v", err)
+	}
+	ok, _, err = service.VerifyAPREQ(&apReq, service.NewSettings(kt, service.PACKDCKeyProvider(kdcKT)))
+	assert.False(t, ok, "PAC forged with the service's key should not be accepted")
+	assert.Error(t, err, "an error should be returned for a forged PAC")
+	apReq, err = b.APReq()
+	if err != nil {
+		t.Fatalf("error building AP_REQ: %v", err)
+	}
+	ok, _, err = service.VerifyAPREQ(&apReq, service.NewSettings(kt))
+	assert.True(t, ok && err == nil, "PAC should be accepted when its KDC signature is not verified: %v", err)
+
+	// A PAC of an earlier authentication is rejected.
+	p.LogOnTime = authTime.Add(-time.Hour)
+	apReq, err = b.APReq()
+	if err != nil {
+		t.Fatalf("error building AP_REQ: %v", err)
+	}
+	ok, _, err = service.VerifyAPREQ(&apReq, service.NewSettings(kt, service.VerifyPACClient(true)))
+	assert.False(t, ok, "stale PAC should not be accepted")
+	assert.Error(t, err, "an error should be returned for a stale PAC")
+}
@@ -0,0 +1,23 @@
+//go:build gokrb5_deterministic
+// +build gokrb5_deterministic
+
+package krbtest
+
+import (
+	"github.com/jcmturner/gokrb5/v8/internal/random"
+)
+
+// DeterministicRandom makes the session keys, subkeys, nonces, sequence numbers and encryption confounders generated
+// by gokrb5 deterministic from the seed provided, so that golden file tests of the tokens and messages produced are
+// possible. The function returned restores the use of crypto/rand and should be deferred.
+//
+// The source of randomness is global to the process so tests using DeterministicRandom must not run in parallel with
+// others generating keys or messages, and the values generated are only repeatable if they are generated in the same
+// order. DeterministicRandom is only available with the gokrb5_deterministic build tag, so that it cannot replace the
+// source of randomness of programs built without it, and the tag must never be used outside of tests:
+//
+//	go test -tags gokrb5_deterministic ./...
+func DeterministicRandom(seed int64) (restore func()) {
+	random.SetSeed(seed)
+	return random.Reset
+}
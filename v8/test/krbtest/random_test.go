@@ -0,0 +1,66 @@
+//go:build gokrb5_deterministic
+// +build gokrb5_deterministic
+
+package krbtest
+
+import (
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// generated holds the values produced with the random source.
+type generated struct {
+	nonce  int
+	seq    int64
+	subkey []byte
+	ct     []byte
+}
+
+func generate(t *testing.T) generated {
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	asReq, err := messages.NewASReqForTGT(testRealm, config.New(), cname)
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	a, err := types.NewAuthenticator(testRealm, cname)
+	if err != nil {
+		t.Fatalf("error creating authenticator: %v", err)
+	}
+	if err := a.GenerateSeqNumberAndSubKey(etypeID.AES256_CTS_HMAC_SHA1_96, 32); err != nil {
+		t.Fatalf("error generating subkey: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData([]byte("message"), a.SubKey, keyusage.AP_REQ_AUTHENTICATOR, 1)
+	if err != nil {
+		t.Fatalf("error encrypting: %v", err)
+	}
+	return generated{
+		nonce:  asReq.ReqBody.Nonce,
+		seq:    a.SeqNumber,
+		subkey: a.SubKey.KeyValue,
+		ct:     ed.Cipher,
+	}
+}
+
+// Not run in parallel as the source of randomness is global.
+func TestDeterministicRandom(t *testing.T) {
+	restore := DeterministicRandom(1)
+	g1 := generate(t)
+	DeterministicRandom(1)
+	g2 := generate(t)
+	DeterministicRandom(2)
+	g3 := generate(t)
+	restore()
+	g4 := generate(t)
+
+	assert.Equal(t, g1, g2, "values generated with the same seed should be equal")
+	assert.NotEqual(t, g1.subkey, g3.subkey, "values generated with different seeds should differ")
+	assert.NotEqual(t, g1.subkey, g4.subkey, "values generated after restoring crypto/rand should differ")
+}
@@ -0,0 +1,229 @@
+package krbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/iana/errorcode"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKDC_ClientReferral(t *testing.T) {
+	t.Parallel()
+	kdcs := realmKDCs(t, "HTTP/host.res.gokrb5", "USERS.GOKRB5", "RES.GOKRB5")
+	for _, k := range kdcs {
+		defer k.Close()
+	}
+	// The client is configured with the wrong realm and found by the KDC of RES.GOKRB5.
+	if err := kdcs[1].AddPrincipal("testuser2", "passwordvalue"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	kdcs[0].SetReferral("testuser2", "RES.GOKRB5")
+	c, err := kdcs[0].Config(kdcs[1:]...)
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.DomainRealm[".res.gokrb5"] = "RES.GOKRB5"
+
+	cl := client.NewWithPassword("testuser2", "USERS.GOKRB5", "passwordvalue", c)
+	assert.Error(t, cl.Login(), "client should not be referred without canonicalize")
+
+	c.LibDefaults.Canonicalize = true
+	cl = client.NewWithPassword("testuser2", "USERS.GOKRB5", "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in with a client referral: %v", err)
+	}
+	assert.Equal(t, "RES.GOKRB5", cl.Credentials.Domain(), "client realm should be the realm referred to")
+	assert.Equal(t, []string{"RES.GOKRB5"}, sessionRealms(cl), "sessions not as expected")
+	_, _, err = cl.GetServiceTicket("HTTP/host.res.gokrb5")
+	assert.NoError(t, err, "error getting service ticket in the realm referred to")
+}
+
+func TestKDC_ServerReferral(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.res.gokrb5"
+	kdcs := realmKDCs(t, spn, "USERS.GOKRB5", "RES.GOKRB5")
+	for _, k := range kdcs {
+		defer k.Close()
+	}
+	// There is no domain_realm mapping for the host so the client asks the KDC of its own realm.
+	kdcs[0].SetReferral(spn, "RES.GOKRB5")
+	c, err := kdcs[0].Config(kdcs[1:]...)
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+
+	cl := client.NewWithPassword("testuser1", "USERS.GOKRB5", "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	_, _, err = cl.GetServiceTicket(spn)
+	assert.Error(t, err, "request should not be referred without canonicalize")
+
+	c.LibDefaults.Canonicalize = true
+	cl = client.NewWithPassword("testuser1", "USERS.GOKRB5", "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	tkt, key, err := cl.GetServiceTicket(spn)
+	if err != nil {
+		t.Fatalf("error getting service ticket with a server referral: %v", err)
+	}
+	assert.Equal(t, "RES.GOKRB5", tkt.Realm, "ticket realm not as expected")
+	verifyCrossRealmTicket(t, kdcs[1], spn, cl, tkt, key)
+	assert.Equal(t, []string{"RES.GOKRB5", "USERS.GOKRB5"}, sessionRealms(cl),
+		"the referral TGT should be kept as a session")
+
+	// The ticket is cached so the referral is not followed again.
+	requests := kdcs[0].Requests()
+	_, _, err = cl.GetServiceTicket(spn)
+	assert.NoError(t, err, "error getting cached service ticket")
+	assert.Equal(t, requests, kdcs[0].Requests(), "KDC should not be sent requests for a cached ticket")
+}
+
+func TestKDC_ReferralSessions(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.res.gokrb5"
+	kdcs := realmKDCs(t, spn, "USERS.GOKRB5", "HUB.GOKRB5", "RES.GOKRB5")
+	for _, k := range kdcs {
+		defer k.Close()
+	}
+	// The service is in another forest reached through HUB.GOKRB5, which is not on the realms' authentication path.
+	kdcs[0].SetReferral(spn, "HUB.GOKRB5")
+	kdcs[1].SetReferral(spn, "RES.GOKRB5")
+	c, err := kdcs[0].Config(kdcs[1:]...)
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.LibDefaults.Canonicalize = true
+
+	store := client.NewCache()
+	cl := client.NewWithPassword("testuser1", "USERS.GOKRB5", "passwordvalue", c, client.ServiceTicketStore(store))
+	defer cl.Close()
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	tkt, key, err := cl.GetServiceTicket(spn)
+	if err != nil {
+		t.Fatalf("error getting service ticket with referrals: %v", err)
+	}
+	verifyCrossRealmTicket(t, kdcs[2], spn, cl, tkt, key)
+	assert.Equal(t, []string{"HUB.GOKRB5", "RES.GOKRB5", "USERS.GOKRB5"}, sessionRealms(cl),
+		"the referral TGTs should be kept as sessions")
+
+	// The next request for the service is sent to the KDC of its realm without following the referrals again.
+	store.Remove(spn)
+	var requests []int
+	for _, k := range kdcs {
+		requests = append(requests, k.Requests())
+	}
+	_, _, err = cl.GetServiceTicket(spn)
+	if err != nil {
+		t.Fatalf("error getting service ticket from the realm referred to: %v", err)
+	}
+	for i, k := range kdcs[:2] {
+		assert.Equal(t, requests[i], k.Requests(), "KDC for %s should not be sent requests", k.Realm)
+	}
+	assert.Equal(t, requests[2]+1, kdcs[2].Requests(), "requests to the KDC of the service's realm not as expected")
+
+	// A TGT for the realm that cannot be renewed expires without affecting the other sessions and is obtained again
+	// from the realm that referred the client.
+	c.LibDefaults.TicketLifetime = 2 * time.Second
+	c.LibDefaults.RenewLifetime = 2 * time.Second
+	cl = client.NewWithPassword("testuser1", "USERS.GOKRB5", "passwordvalue", c)
+	defer cl.Close()
+	if _, _, err := cl.GetServiceTicket(spn); err != nil {
+		t.Fatalf("error getting service ticket with referrals: %v", err)
+	}
+	kdcs[1].ForceError("krbtgt/RES.GOKRB5", errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN)
+	time.Sleep(2500 * time.Millisecond)
+	kdcs[1].ForceError("krbtgt/RES.GOKRB5", 0)
+	for _, s := range cl.DebugSnapshot().Sessions {
+		if s.Realm == "RES.GOKRB5" {
+			assert.True(t, s.EndTime.Before(time.Now()), "TGT for RES.GOKRB5 should have expired")
+		} else {
+			assert.True(t, s.EndTime.After(time.Now()), "TGT for %s should have been renewed", s.Realm)
+		}
+	}
+	tgt, _, err := cl.RealmTGT(context.Background(), "RES.GOKRB5")
+	if err != nil {
+		t.Fatalf("error getting TGT for the realm referred to: %v", err)
+	}
+	assert.Equal(t, "HUB.GOKRB5", tgt.Realm, "TGT should be issued by the realm that referred the client")
+}
+
+func TestKDC_Canonicalize(t *testing.T) {
+	t.Parallel()
+	k, err := NewKDC("TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error starting KDC: %v", err)
+	}
+	defer k.Close()
+	if err := k.AddPrincipal("testuser1", "passwordvalue"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	if err := k.AddPrincipal("HTTP/host.test.gokrb5", "servicepassword"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	k.AddAlias("alias1", "testuser1")
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+
+	cl := client.NewWithPassword("alias1", "TEST.GOKRB5", "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in with an alias: %v", err)
+	}
+
+	c.LibDefaults.Canonicalize = true
+	cl = client.NewWithPassword("alias1", "TEST.GOKRB5", "passwordvalue", c)
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in with an alias and canonicalize: %v", err)
+	}
+	_, _, err = cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "error getting service ticket with the canonical name of the client")
+}
+
+func TestKDC_EnterprisePrincipal(t *testing.T) {
+	t.Parallel()
+	kdcs := realmKDCs(t, "HTTP/host.res.gokrb5", "USERS.GOKRB5", "RES.GOKRB5")
+	for _, k := range kdcs {
+		defer k.Close()
+	}
+	// The user only knows their UPN, which the KDC of the default realm refers to the realm of the account.
+	upn := "user2@corp.gokrb5"
+	if err := kdcs[1].AddPrincipal("testuser2", "passwordvalue"); err != nil {
+		t.Fatalf("error adding principal: %v", err)
+	}
+	kdcs[1].AddAlias(upn, "testuser2")
+	kdcs[0].SetReferral(upn, "RES.GOKRB5")
+	c, err := kdcs[0].Config(kdcs[1:]...)
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.DomainRealm[".res.gokrb5"] = "RES.GOKRB5"
+
+	cl := client.NewWithPassword(upn, "USERS.GOKRB5", "passwordvalue", c)
+	assert.Error(t, cl.Login(), "UPN should not be resolved unless sent as an enterprise name")
+
+	cl = client.NewWithPassword(upn, "USERS.GOKRB5", "passwordvalue", c, client.EnterprisePrincipal(true))
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in with an enterprise principal name: %v", err)
+	}
+	assert.Equal(t, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser2"), cl.Credentials.CName(),
+		"client principal should be the canonical one")
+	assert.Equal(t, "testuser2", cl.Credentials.UserName(), "username should be the canonical one")
+	assert.Equal(t, "RES.GOKRB5", cl.Credentials.Domain(), "client realm should be that of the account")
+	_, _, err = cl.GetServiceTicket("HTTP/host.res.gokrb5")
+	assert.NoError(t, err, "error getting service ticket")
+
+	// Later logins are made with the canonical name directly to the realm of the account.
+	requests := kdcs[0].Requests()
+	assert.NoError(t, cl.Login(), "error logging in again")
+	assert.Equal(t, requests, kdcs[0].Requests(), "KDC of the default realm should not be sent requests")
+}
@@ -0,0 +1,73 @@
+package krbtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// SPNEGOServer is an httptest.Server running a handler protected by SPNEGO authentication that accepts tickets issued
+// by a KDC for its service principal.
+type SPNEGOServer struct {
+	*httptest.Server
+	// KDC issuing the tickets accepted by the server.
+	KDC *KDC
+	// SPN is the service principal name of the server.
+	SPN string
+	// Keytab is the keytab used by the server, generated for the SPN.
+	Keytab *keytab.Keytab
+}
+
+// NewSPNEGOServer adds the service principal HTTP/127.0.0.1 to the KDC with a generated password and starts an
+// httptest.Server running the handler wrapped with spnego.SPNEGOKRB5Authenticate using the principal's keytab.
+// As the KDC does not issue PACs, PAC decoding is disabled unless enabled by the settings provided.
+// The server should be closed once the test is complete.
+func NewSPNEGOServer(k *KDC, h http.Handler, settings ...func(*service.Settings)) (*SPNEGOServer, error) {
+	s := &SPNEGOServer{
+		KDC: k,
+		SPN: "HTTP/127.0.0.1",
+	}
+	password, err := randomPassword()
+	if err != nil {
+		return nil, err
+	}
+	if err := k.AddPrincipal(s.SPN, password); err != nil {
+		return nil, err
+	}
+	kt, err := k.Keytab(s.SPN)
+	if err != nil {
+		return nil, err
+	}
+	s.Keytab = kt
+	settings = append([]func(*service.Settings){service.DecodePAC(false)}, settings...)
+	s.Server = httptest.NewServer(spnego.SPNEGOKRB5Authenticate(h, kt, settings...))
+	return s, nil
+}
+
+// NewClient adds the user principal to the KDC with a generated password and returns a client for it configured to
+// use only the KDC. The client is not logged in.
+func (k *KDC) NewClient(username string, settings ...func(*client.Settings)) (*client.Client, error) {
+	password, err := randomPassword()
+	if err != nil {
+		return nil, err
+	}
+	if err := k.AddPrincipal(username, password); err != nil {
+		return nil, err
+	}
+	c, err := k.Config()
+	if err != nil {
+		return nil, fmt.Errorf("error creating client configuration: %w", err)
+	}
+	return client.NewWithPassword(username, k.Realm, password, c, settings...), nil
+}
+
+// SPNEGOClient returns a SPNEGO enabled HTTP client authenticating to the server with the client provided, which can be
+// created with the KDC's NewClient method.
+func (s *SPNEGOServer) SPNEGOClient(cl *client.Client) *spnego.Client {
+	return spnego.NewClient(cl, s.Server.Client(), s.SPN)
+}
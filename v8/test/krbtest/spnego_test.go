@@ -0,0 +1,611 @@
+package krbtest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/jcmturner/gokrb5/v8/audit"
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSPNEGOServer(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := goidentity.FromHTTPRequestContext(r)
+		fmt.Fprint(w, id.UserName())
+	})
+	s, err := NewSPNEGOServer(k, h)
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+
+	cl, err := k.NewClient("testuser2")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	resp, err := s.SPNEGOClient(cl).Get(s.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	assert.Equal(t, "testuser2", string(b), "authenticated user not as expected")
+
+	// Requests without SPNEGO are rejected.
+	resp, err = s.Client().Get(s.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "status code without SPNEGO not as expected")
+}
+
+func TestSPNEGOServer_CorrelationID(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	var mux sync.Mutex
+	var events []audit.Event
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	s, err := NewSPNEGOServer(k, h, service.AuditHook(func(e audit.Event) {
+		mux.Lock()
+		defer mux.Unlock()
+		events = append(events, e)
+	}))
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+
+	cl, err := k.NewClient("testuser2")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	for _, c := range []*client.Client{cl.WithCorrelationID("attempt-1"), cl} {
+		resp, err := s.SPNEGOClient(c).Get(s.URL)
+		if err != nil {
+			t.Fatalf("error making request: %v", err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if assert.Len(t, events, 2, "audit events not as expected") {
+		assert.Equal(t, "attempt-1", events[0].CorrelationID, "correlation ID sent by the client not audited")
+		assert.Equal(t, "", events[1].CorrelationID, "request without a correlation ID should not have one")
+	}
+}
+
+func TestSPNEGOServer_ChannelBindings(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	if err := k.AddPrincipal("HTTP/127.0.0.1", "servicepassword"); err != nil {
+		t.Fatalf("error adding service principal: %v", err)
+	}
+	kt, err := k.Keytab("HTTP/127.0.0.1")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	cl, err := k.NewClient("testuser2")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := goidentity.FromHTTPRequestContext(r)
+		fmt.Fprint(w, id.UserName())
+	})
+
+	// The handler requires the channel bindings of the server's certificate, which are only known once it has started.
+	var auth http.Handler
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.ServeHTTP(w, r)
+	}))
+	s.StartTLS()
+	defer s.Close()
+	cb, err := gssapi.TLSServerEndPoint(s.Certificate())
+	if err != nil {
+		t.Fatalf("error getting channel bindings: %v", err)
+	}
+	auth = spnego.SPNEGOKRB5Authenticate(h, kt, service.DecodePAC(false), service.ChannelBindings(cb), service.RequireChannelBindings(true))
+	resp, err := spnego.NewClient(cl, s.Client(), "HTTP/127.0.0.1").Get(s.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code with channel bindings not as expected")
+	assert.Equal(t, "testuser2", string(b), "authenticated user not as expected")
+
+	// Channel bindings other than those of the certificate the client connects to, as when a TLS proxy relays the
+	// client's token, are rejected.
+	other := &gssapi.ChannelBindings{ApplicationData: []byte(gssapi.TLSServerEndPointPrefix + "other")}
+	auth = spnego.SPNEGOKRB5Authenticate(h, kt, service.DecodePAC(false), service.ChannelBindings(other))
+	resp, err = spnego.NewClient(cl, s.Client(), "HTTP/127.0.0.1").Get(s.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "status code with other channel bindings not as expected")
+
+	// Without TLS the client sends no channel bindings, which are rejected when required.
+	ps := httptest.NewServer(spnego.SPNEGOKRB5Authenticate(h, kt, service.DecodePAC(false), service.ChannelBindings(other), service.RequireChannelBindings(true)))
+	defer ps.Close()
+	resp, err = spnego.NewClient(cl, ps.Client(), "HTTP/127.0.0.1").Get(ps.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "status code without channel bindings not as expected")
+}
+
+func TestSPNEGOServer_MutualAuth(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := goidentity.FromHTTPRequestContext(r)
+		fmt.Fprint(w, id.UserName())
+	})
+	s, err := NewSPNEGOServer(k, h)
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+	cl, err := k.NewClient("testuser2")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	resp, err := spnego.NewMutualAuthClient(cl, s.Client(), s.SPN).Get(s.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	assert.Equal(t, "testuser2", string(b), "authenticated user not as expected")
+
+	// A service that does not authenticate itself with an AP_REP is an error.
+	fs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(spnego.HTTPHeaderAuthRequest) == "" {
+			w.Header().Set(spnego.HTTPHeaderAuthResponse, spnego.HTTPHeaderAuthResponseValueKey)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "not authenticated")
+	}))
+	defer fs.Close()
+	_, err = spnego.NewMutualAuthClient(cl, fs.Client(), s.SPN).Get(fs.URL)
+	assert.Error(t, err, "response without an AP_REP should be an error")
+}
+
+func TestSPNEGOServer_Transport(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := goidentity.FromHTTPRequestContext(r)
+		b, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s", id.UserName(), b)
+	})
+	s, err := NewSPNEGOServer(k, h)
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+	cl, err := k.NewClient("testuser2")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+
+	// Only the service challenging the request is sent a token, with the SPN generated for the redirected request.
+	var redirectAuth string
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirectAuth = r.Header.Get(spnego.HTTPHeaderAuthRequest)
+		http.Redirect(w, r, s.URL, http.StatusTemporaryRedirect)
+	}))
+	defer rs.Close()
+	httpCl := &http.Client{Transport: spnego.NewTransport(cl, nil, "HTTP/redirect.test.gokrb5")}
+	resp, err := httpCl.Post(rs.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	assert.Equal(t, "testuser2 body", string(b), "response not as expected")
+	assert.Empty(t, redirectAuth, "service that does not challenge the request should not be sent a token")
+}
+
+func TestSPNEGOServer_WebSocketHeader(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	s, err := NewSPNEGOServer(k, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+	cl, err := k.NewClient("testuser2")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	h, verify, err := spnego.WebSocketHeader(context.Background(), cl, strings.Replace(s.URL, "http", "ws", 1), s.SPN)
+	if err != nil {
+		t.Fatalf("error getting WebSocket header: %v", err)
+	}
+	r, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	r.Header = h
+	resp, err := s.Client().Do(r)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+	assert.NoError(t, verify(resp), "server's AP_REP should verify")
+
+	resp.Header.Del(spnego.HTTPHeaderAuthResponse)
+	assert.Error(t, verify(resp), "response without an AP_REP should not verify")
+	_, _, err = spnego.WebSocketHeader(context.Background(), cl, s.URL, s.SPN)
+	assert.Error(t, err, "URL that is not a WebSocket URL should be an error")
+}
+
+func TestSPNEGOServer_CookieSession(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	sm, err := spnego.NewCookieSessionManager("gokrb5", []byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatalf("error creating session manager: %v", err)
+	}
+	sm.Secure = false
+	var authenticated int
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(spnego.HTTPHeaderAuthRequest) != "" {
+			authenticated++
+		}
+		fmt.Fprint(w, goidentity.FromHTTPRequestContext(r).UserName())
+	})
+	s, err := NewSPNEGOServer(k, h, service.SessionManager(sm))
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+	cl, err := k.NewClient("testuser2")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	c := s.SPNEGOClient(cl)
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(s.URL)
+		if err != nil {
+			t.Fatalf("error making request: %v", err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+		assert.Equal(t, "testuser2", string(b), "authenticated user not as expected")
+	}
+	assert.Equal(t, 1, authenticated, "only the first request should be authenticated with Kerberos")
+}
+
+func TestSPNEGOServer_RawKRB5MutualAuth(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	s, err := NewSPNEGOServer(k, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+	cl, err := k.NewClient("testuser2")
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	tkt, key, err := cl.GetServiceTicket(s.SPN)
+	if err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+	// A raw KRB5 token, as sent by curl and Java clients, requesting mutual authentication.
+	mt, err := spnego.NewKRB5TokenAPREQ(cl, tkt, key, []int{gssapi.ContextFlagMutual, gssapi.ContextFlagInteg}, []int{flags.APOptionMutualRequired})
+	if err != nil {
+		t.Fatalf("error creating KRB5 token: %v", err)
+	}
+	if err := mt.APReq.DecryptAuthenticator(key); err != nil {
+		t.Fatalf("error decrypting authenticator: %v", err)
+	}
+	b, err := mt.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB5 token: %v", err)
+	}
+	r, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	r.Header.Set(spnego.HTTPHeaderAuthRequest, "Negotiate "+base64.StdEncoding.EncodeToString(b))
+	resp, err := s.Client().Do(r)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+
+	// The AP_REP is replied as a raw KRB5 token too.
+	b, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(resp.Header.Get(spnego.HTTPHeaderAuthResponse), "Negotiate "))
+	if err != nil {
+		t.Fatalf("error decoding response header: %v", err)
+	}
+	var rt spnego.KRB5Token
+	if err := rt.Unmarshal(b); err != nil {
+		t.Fatalf("response token is not a raw KRB5 token: %v", err)
+	}
+	if assert.True(t, rt.IsAPRep(), "response token should contain an AP_REP") {
+		_, err = rt.APRep.DecryptEncPart(key, mt.APReq.Authenticator)
+		assert.NoError(t, err, "AP_REP should verify")
+	}
+}
+
+// authenticatorChecksum returns the authenticator checksum of the SPNEGO token the client creates for the SPN.
+func authenticatorChecksum(t *testing.T, cl *client.Client, spn string) ([]byte, types.EncryptionKey) {
+	ct, err := spnego.SPNEGOClient(cl, spn).InitSecContext()
+	if err != nil {
+		t.Fatalf("error creating SPNEGO token: %v", err)
+	}
+	var mt spnego.KRB5Token
+	if err := mt.Unmarshal(ct.(*spnego.SPNEGOToken).NegTokenInit.MechTokenBytes); err != nil {
+		t.Fatalf("error unmarshaling KRB5 token: %v", err)
+	}
+	_, key, ok := cl.GetCachedTicket(spn)
+	if !ok {
+		t.Fatalf("service ticket not cached")
+	}
+	if err := mt.APReq.DecryptAuthenticator(key); err != nil {
+		t.Fatalf("error decrypting authenticator: %v", err)
+	}
+	return mt.APReq.Authenticator.Cksum.Checksum, key
+}
+
+func TestSPNEGOServer_Delegation(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	s, err := NewSPNEGOServer(k, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.LibDefaults.Forwardable = true
+	newClient := func() *client.Client {
+		cl := client.NewWithPassword("testuser1", testRealm, "passwordvalue", c, client.Delegation(client.DelegateIfOKAsDelegate))
+		if err := cl.Login(); err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+		return cl
+	}
+
+	// Credentials are not delegated to a service that is not ok-as-delegate.
+	cl := newClient()
+	cksum, _ := authenticatorChecksum(t, cl, s.SPN)
+	assert.Len(t, cksum, 24, "checksum should not hold delegated credentials")
+	assert.Zero(t, binary.LittleEndian.Uint32(cksum[20:24])&gssapi.ContextFlagDeleg, "delegation flag should not be set")
+
+	k.SetOKAsDelegate(s.SPN, true)
+	cl = newClient()
+	cksum, key := authenticatorChecksum(t, cl, s.SPN)
+	assert.NotZero(t, binary.LittleEndian.Uint32(cksum[20:24])&gssapi.ContextFlagDeleg, "delegation flag not set")
+	if !assert.True(t, len(cksum) > 28, "checksum does not hold delegated credentials") {
+		return
+	}
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(cksum[24:26]), "delegation option not as expected")
+	assert.Equal(t, len(cksum)-28, int(binary.LittleEndian.Uint16(cksum[26:28])), "delegation length not as expected")
+	var krbCred messages.KRBCred
+	if err := krbCred.Unmarshal(cksum[28:]); err != nil {
+		t.Fatalf("error unmarshaling delegated KRB_CRED: %v", err)
+	}
+	if err := krbCred.DecryptEncPart(key); err != nil {
+		t.Fatalf("error decrypting delegated KRB_CRED with the session key: %v", err)
+	}
+	assert.Equal(t, "krbtgt/"+testRealm, krbCred.Tickets[0].SName.PrincipalNameString(), "delegated ticket is not a TGT")
+	assert.True(t, types.IsFlagSet(&krbCred.DecryptedEncPart.TicketInfo[0].Flags, flags.Forwarded), "delegated TGT is not forwarded")
+
+	// The service accepts the token with delegated credentials.
+	resp, err := s.SPNEGOClient(cl).Get(s.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+
+	// Without a forwardable TGT the context is established without delegation.
+	nc, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	cl = client.NewWithPassword("testuser1", testRealm, "passwordvalue", nc, client.Delegation(client.DelegateAlways))
+	if err := cl.Login(); err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	cksum, _ = authenticatorChecksum(t, cl, s.SPN)
+	assert.Len(t, cksum, 24, "checksum should not hold delegated credentials without a forwardable TGT")
+	assert.Zero(t, binary.LittleEndian.Uint32(cksum[20:24])&gssapi.ContextFlagDeleg, "delegation flag should be cleared")
+}
+
+func TestSPNEGOServer_DelegatedCredentials(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	c, err := k.Config()
+	if err != nil {
+		t.Fatalf("error getting config: %v", err)
+	}
+	c.LibDefaults.Forwardable = true
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		creds, ok := goidentity.FromHTTPRequestContext(r).(*credentials.Credentials)
+		if !ok {
+			http.Error(w, "identity is not Kerberos credentials", http.StatusInternalServerError)
+			return
+		}
+		if _, ok := creds.DelegatedCredentials(); !ok {
+			fmt.Fprint(w, "not delegated")
+			return
+		}
+		// The service acts as the user towards the backend service with the delegated TGT.
+		dcl, err := client.NewFromDelegatedCredentials(creds, c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer dcl.Destroy()
+		tkt, _, err := dcl.GetServiceTicket(testSPN)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "%s %s", tkt.SName.PrincipalNameString(), dcl.Credentials.CName().PrincipalNameString())
+	})
+	s, err := NewSPNEGOServer(k, h)
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+
+	get := func(cl *client.Client) string {
+		if err := cl.Login(); err != nil {
+			t.Fatalf("error logging in: %v", err)
+		}
+		resp, err := s.SPNEGOClient(cl).Get(s.URL)
+		if err != nil {
+			t.Fatalf("error making request: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected: %s", b)
+		return string(b)
+	}
+	assert.Equal(t, "not delegated", get(client.NewWithPassword("testuser1", testRealm, "passwordvalue", c)),
+		"credentials should not be delegated")
+	assert.Equal(t, testSPN+" testuser1",
+		get(client.NewWithPassword("testuser1", testRealm, "passwordvalue", c, client.Delegation(client.DelegateAlways))),
+		"delegated credentials not usable by the service")
+}
+
+func TestSPNEGOServer_Authorizer(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	sm, err := spnego.NewCookieSessionManager("gokrb5", []byte("0123456789abcdef"), time.Hour)
+	if err != nil {
+		t.Fatalf("error creating session manager: %v", err)
+	}
+	sm.Secure = false
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, goidentity.FromHTTPRequestContext(r).UserName())
+	})
+	a := func(r *http.Request, id *credentials.Credentials) (bool, int) {
+		if r.URL.Path == "/admin" {
+			return false, 0
+		}
+		if id.UserName() != "testuser2" {
+			return false, http.StatusNotFound
+		}
+		return true, 0
+	}
+	s, err := NewSPNEGOServer(k, h, service.Authorizer(a), service.SessionManager(sm))
+	if err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Close()
+	var tests = []struct {
+		user   string
+		path   string
+		status int
+	}{
+		// Users not authorized are not given a session.
+		{"testuser3", "/", http.StatusNotFound},
+		{"testuser2", "/", http.StatusOK},
+		// Requests served under the session are authorized too.
+		{"testuser2", "/admin", http.StatusForbidden},
+	}
+	clients := make(map[string]*spnego.Client)
+	for _, test := range tests {
+		c, ok := clients[test.user]
+		if !ok {
+			cl, err := k.NewClient(test.user)
+			if err != nil {
+				t.Fatalf("error creating client: %v", err)
+			}
+			c = s.SPNEGOClient(cl)
+			clients[test.user] = c
+		}
+		resp, err := c.Get(s.URL + test.path)
+		if err != nil {
+			t.Fatalf("error making request: %v", err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, test.status, resp.StatusCode, "status code not as expected for %s %s", test.user, test.path)
+	}
+}
+
+func TestSPNEGOServer_SPNDiscovery(t *testing.T) {
+	t.Parallel()
+	k := testKDC(t)
+	defer k.Close()
+	if err := k.AddPrincipal("HTTP/lb.test.gokrb5", "servicepassword"); err != nil {
+		t.Fatalf("error adding service principal: %v", err)
+	}
+	kt, err := k.Keytab("HTTP/lb.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service keytab: %v", err)
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := goidentity.FromHTTPRequestContext(r)
+		fmt.Fprint(w, id.UserName())
+	})
+	s := httptest.NewServer(spnego.SPNEGOKRB5Authenticate(h, kt, service.DecodePAC(false)))
+	defer s.Close()
+
+	// The SPN of the request's host is that of the resolver's override rather than HTTP/127.0.0.1.
+	r := &client.DNSSPNResolver{Overrides: map[string]string{"127.0.0.1": "HTTP/lb.test.gokrb5"}}
+	cl, err := k.NewClient("testuser2", client.SPNDiscovery(r))
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	resp, err := spnego.NewClient(cl, s.Client(), "").Get(s.URL)
+	if err != nil {
+		t.Fatalf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code with the SPN of the override not as expected")
+	assert.Equal(t, "testuser2", string(b), "authenticated user not as expected")
+	_, ok := cl.GetCachedEntry("HTTP/lb.test.gokrb5")
+	assert.True(t, ok, "ticket for the SPN of the override should be cached")
+}
@@ -0,0 +1,174 @@
+package krbtest
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/asn1tools"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/iana"
+	"github.com/jcmturner/gokrb5/v8/iana/adtype"
+	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// TicketBuilder mints service tickets, optionally holding a PAC, encrypted with a service's key from a keytab so that
+// services can be tested without a KDC, or with authorization data the KDC does not issue.
+//
+// Only SPN, Realm and Keytab are required. For example a ticket for a member of a domain group can be minted with:
+//
+//	b := krbtest.TicketBuilder{
+//		CName:  "testuser1",
+//		SPN:    "HTTP/host.test.gokrb5",
+//		Realm:  "TEST.GOKRB5",
+//		Keytab: kt,
+//		PAC:    &krbtest.PAC{UserID: 1105, GroupIDs: []uint32{1108}},
+//	}
+//	apReq, err := b.APReq()
+type TicketBuilder struct {
+	// CName is the client principal name. "testuser1" is used if it is empty.
+	CName string
+	// CRealm is the client's realm. Realm is used if it is empty.
+	CRealm string
+	// SPN is the service principal name the ticket is for.
+	SPN string
+	// Realm of the service.
+	Realm string
+	// Keytab holding the service's key.
+	Keytab *keytab.Keytab
+	// EType of the service key used to encrypt the ticket. AES256_CTS_HMAC_SHA1_96 is used if it is zero.
+	EType int32
+	// KVNO of the service key. The latest in the keytab is used if it is zero.
+	KVNO int
+	// AuthTime is the time the client authenticated and the start of the ticket's validity. The current time is used
+	// if it is zero.
+	AuthTime time.Time
+	// Lifetime of the ticket. DefaultTicketLifetime is used if it is zero.
+	Lifetime time.Duration
+	// Flags of the ticket. No flags are set if it is empty.
+	Flags asn1.BitString
+	// PAC to include in the ticket's authorization data, if not nil. The UserName, LogonDomainName and LogOnTime
+	// default to the client's name, realm and AuthTime respectively.
+	PAC *PAC
+}
+
+// Build mints the ticket and returns it with its session key.
+func (b TicketBuilder) Build() (messages.Ticket, types.EncryptionKey, error) {
+	if b.SPN == "" || b.Realm == "" || b.Keytab == nil {
+		return messages.Ticket{}, types.EncryptionKey{}, errors.New("SPN, realm and keytab required to build a ticket")
+	}
+	if b.CName == "" {
+		b.CName = "testuser1"
+	}
+	if b.CRealm == "" {
+		b.CRealm = b.Realm
+	}
+	if b.EType == 0 {
+		b.EType = etypeID.AES256_CTS_HMAC_SHA1_96
+	}
+	if b.AuthTime.IsZero() {
+		b.AuthTime = time.Now().UTC()
+	}
+	if b.Lifetime == 0 {
+		b.Lifetime = DefaultTicketLifetime
+	}
+	if len(b.Flags.Bytes) < 1 {
+		b.Flags = types.NewKrbFlags()
+	}
+	sname, _ := types.ParseSPNString(b.SPN)
+	skey, kvno, err := b.Keytab.GetEncryptionKey(sname, b.Realm, b.KVNO, b.EType)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, fmt.Errorf("error getting key for %s: %w", b.SPN, err)
+	}
+	et, err := crypto.GetEtype(b.EType)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, fmt.Errorf("error getting etype %d: %w", b.EType, err)
+	}
+	sessionKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, fmt.Errorf("error generating session key: %w", err)
+	}
+	etp := messages.EncTicketPart{
+		Flags:     b.Flags,
+		Key:       sessionKey,
+		CRealm:    b.CRealm,
+		CName:     types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, b.CName),
+		Transited: messages.TransitedEncoding{},
+		AuthTime:  b.AuthTime,
+		StartTime: b.AuthTime,
+		EndTime:   b.AuthTime.Add(b.Lifetime),
+	}
+	if b.PAC != nil {
+		ad, err := b.authorizationData(skey)
+		if err != nil {
+			return messages.Ticket{}, types.EncryptionKey{}, err
+		}
+		etp.AuthorizationData = ad
+	}
+	eb, err := asn1.Marshal(etp)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, fmt.Errorf("error marshaling ticket encpart: %w", err)
+	}
+	eb = asn1tools.AddASNAppTag(eb, asnAppTag.EncTicketPart)
+	ed, err := crypto.GetEncryptedData(eb, skey, keyusage.KDC_REP_TICKET, kvno)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, fmt.Errorf("error encrypting ticket encpart: %w", err)
+	}
+	tkt := messages.Ticket{
+		TktVNO:  iana.PVNO,
+		Realm:   b.Realm,
+		SName:   sname,
+		EncPart: ed,
+	}
+	return tkt, sessionKey, nil
+}
+
+// APReq mints the ticket and returns an AP_REQ for it with a new authenticator from the client.
+func (b TicketBuilder) APReq() (messages.APReq, error) {
+	tkt, key, err := b.Build()
+	if err != nil {
+		return messages.APReq{}, err
+	}
+	cname, crealm := b.CName, b.CRealm
+	if cname == "" {
+		cname = "testuser1"
+	}
+	if crealm == "" {
+		crealm = b.Realm
+	}
+	auth, err := types.NewAuthenticator(crealm, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, cname))
+	if err != nil {
+		return messages.APReq{}, fmt.Errorf("error creating authenticator: %w", err)
+	}
+	return messages.NewAPReq(tkt, key, auth)
+}
+
+// authorizationData returns the PAC wrapped in AD-IF-RELEVANT authorization data, as issued by Active Directory.
+func (b TicketBuilder) authorizationData(key types.EncryptionKey) (types.AuthorizationData, error) {
+	p := *b.PAC
+	if p.UserName == "" {
+		p.UserName = b.CName
+	}
+	if p.LogonDomainName == "" {
+		p.LogonDomainName = b.CRealm
+	}
+	if p.LogOnTime.IsZero() {
+		p.LogOnTime = b.AuthTime
+	}
+	pb, err := p.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling PAC: %w", err)
+	}
+	ab, err := asn1.Marshal(types.AuthorizationData{{ADType: adtype.ADWin2KPAC, ADData: pb}})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling PAC authorization data: %w", err)
+	}
+	return types.AuthorizationData{{ADType: adtype.ADIfRelevant, ADData: ab}}, nil
+}
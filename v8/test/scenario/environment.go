@@ -0,0 +1,194 @@
+package scenario
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/test/krbtest"
+	"github.com/jcmturner/gokrb5/v8/test/testdata"
+)
+
+// Environment selection environment variable key and values.
+const (
+	// KDCEnvVar selects the environment scenarios run against with FromEnv.
+	KDCEnvVar = "SCENARIO_KDC"
+	// KDCEmbedded selects the embedded krbtest KDC. This is the default.
+	KDCEmbedded = "embedded"
+	// KDCDocker selects the Docker KDCs from https://github.com/jcmturner/gokrb5-test at the address in the
+	// TEST_KDC_ADDR environment variable, or 127.0.0.1 if it is not set.
+	KDCDocker = "docker"
+)
+
+// Principals of the environments.
+const (
+	realm    = "TEST.GOKRB5"
+	username = "testuser1"
+	spn      = "HTTP/host.test.gokrb5"
+)
+
+// Environment provides the KDC, user and service that scenarios run against.
+type Environment interface {
+	// Name of the environment reported in test names.
+	Name() string
+	// Config returns the client configuration for the environment's KDC.
+	Config() *config.Config
+	// NewClient returns a new client for the user principal. The client is not logged in.
+	NewClient(settings ...func(*client.Settings)) *client.Client
+	// SPN of the service the user authenticates to.
+	SPN() string
+	// ServiceSettings returns the settings, including the keytab, with which the service verifies the user's tickets.
+	ServiceSettings() *service.Settings
+	// Close releases the resources of the environment.
+	Close() error
+}
+
+// FromEnv returns the environment selected by the KDCEnvVar environment variable. The environment is closed when the
+// test completes.
+func FromEnv(t *testing.T) Environment {
+	var env Environment
+	var err error
+	switch e := os.Getenv(KDCEnvVar); e {
+	case "", KDCEmbedded:
+		env, err = NewEmbedded()
+	case KDCDocker:
+		addr := os.Getenv("TEST_KDC_ADDR")
+		if addr == "" {
+			addr = testdata.KDC_IP_TEST_GOKRB5
+		}
+		env, err = NewDocker(addr)
+	default:
+		err = fmt.Errorf("unknown value %q of %s, must be %s or %s", e, KDCEnvVar, KDCEmbedded, KDCDocker)
+	}
+	if err != nil {
+		t.Fatalf("error creating scenario environment: %v", err)
+	}
+	t.Cleanup(func() { env.Close() })
+	return env
+}
+
+// embedded is an environment running the krbtest KDC in process.
+type embedded struct {
+	kdc    *krbtest.KDC
+	config *config.Config
+	kt     *keytab.Keytab
+}
+
+// NewEmbedded starts a krbtest KDC with the user testuser1 and the service HTTP/host.test.gokrb5 in the realm
+// TEST.GOKRB5. The KDC does not issue PACs so PAC decoding is disabled in the service settings.
+func NewEmbedded() (Environment, error) {
+	k, err := krbtest.NewKDC(realm)
+	if err != nil {
+		return nil, err
+	}
+	e := &embedded{kdc: k}
+	if err := k.AddPrincipal(username, "passwordvalue"); err != nil {
+		k.Close()
+		return nil, err
+	}
+	if err := k.AddPrincipal(spn, "servicepassword"); err != nil {
+		k.Close()
+		return nil, err
+	}
+	if e.kt, err = k.Keytab(spn); err != nil {
+		k.Close()
+		return nil, err
+	}
+	if e.config, err = k.Config(); err != nil {
+		k.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *embedded) Name() string {
+	return KDCEmbedded
+}
+
+func (e *embedded) Config() *config.Config {
+	return e.config
+}
+
+func (e *embedded) NewClient(settings ...func(*client.Settings)) *client.Client {
+	return client.NewWithPassword(username, realm, "passwordvalue", e.config, settings...)
+}
+
+func (e *embedded) SPN() string {
+	return spn
+}
+
+func (e *embedded) ServiceSettings() *service.Settings {
+	return service.NewSettings(e.kt, service.DecodePAC(false))
+}
+
+func (e *embedded) Close() error {
+	return e.kdc.Close()
+}
+
+// docker is an environment using the KDC of the gokrb5-test Docker images.
+type docker struct {
+	config *config.Config
+	userKT *keytab.Keytab
+	kt     *keytab.Keytab
+}
+
+// NewDocker returns an environment for the TEST.GOKRB5 KDC of the gokrb5-test Docker images running at the address
+// provided, using the testuser1 and HTTP/host.test.gokrb5 keytabs from the testdata package. The MIT KDC does not
+// issue PACs so PAC decoding is disabled in the service settings.
+func NewDocker(addr string) (Environment, error) {
+	c, err := config.NewFromString(testdata.KRB5_CONF)
+	if err != nil {
+		return nil, fmt.Errorf("error loading configuration: %w", err)
+	}
+	c.Realms[0].KDC = []string{addr + ":" + testdata.KDC_PORT_TEST_GOKRB5}
+	e := &docker{config: c}
+	if e.userKT, err = loadKeytab(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5); err != nil {
+		return nil, err
+	}
+	if e.kt, err = loadKeytab(testdata.HTTP_KEYTAB); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// loadKeytab loads a keytab from its hex encoding.
+func loadKeytab(s string) (*keytab.Keytab, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding keytab: %w", err)
+	}
+	kt := keytab.New()
+	if err := kt.Unmarshal(b); err != nil {
+		return nil, fmt.Errorf("error loading keytab: %w", err)
+	}
+	return kt, nil
+}
+
+func (e *docker) Name() string {
+	return KDCDocker
+}
+
+func (e *docker) Config() *config.Config {
+	return e.config
+}
+
+func (e *docker) NewClient(settings ...func(*client.Settings)) *client.Client {
+	return client.NewWithKeytab(username, realm, e.userKT, e.config, settings...)
+}
+
+func (e *docker) SPN() string {
+	return spn
+}
+
+func (e *docker) ServiceSettings() *service.Settings {
+	return service.NewSettings(e.kt, service.DecodePAC(false))
+}
+
+func (e *docker) Close() error {
+	return nil
+}
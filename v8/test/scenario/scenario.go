@@ -0,0 +1,232 @@
+// Package scenario provides a harness driving end-to-end Kerberos scenarios, such as login, service ticket caching,
+// renewal, delegation and acceptance by a service, so that complex flows can be validated reproducibly.
+//
+// Scenarios run against an Environment, either the embedded krbtest KDC or the KDCs of the gokrb5-test Docker images.
+// FromEnv selects the environment with the SCENARIO_KDC environment variable so that the same scenarios can be run
+// in-process by default and against the Docker KDCs in integration testing:
+//
+//	func TestLogin(t *testing.T) {
+//		scenario.Standard.Run(t, scenario.FromEnv(t))
+//	}
+//
+// Scenarios are sequences of steps sharing a State. Custom steps can be combined with those provided.
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// State is shared by the steps of a scenario.
+type State struct {
+	// Env is the environment the scenario is running against.
+	Env Environment
+	// Client of the user. Steps may replace it, for example with a client for delegated credentials.
+	Client *client.Client
+	// Ticket is the last service ticket obtained for the environment's SPN.
+	Ticket messages.Ticket
+	// SessionKey of the Ticket.
+	SessionKey types.EncryptionKey
+	// Credentials of the user as accepted by the service.
+	Credentials *credentials.Credentials
+}
+
+// Step is a named step of a scenario.
+type Step struct {
+	Name string
+	Run  func(s *State) error
+}
+
+// Scenario is a named sequence of steps.
+type Scenario struct {
+	Name string
+	// Client settings used for the user's client.
+	Client []func(*client.Settings)
+	Steps  []Step
+}
+
+// Standard is a scenario that logs in, obtains and caches a service ticket, renews it, delegates the user's
+// credentials to a new client and has the service accept a ticket from the delegated client.
+var Standard = Scenario{
+	Name:  "standard",
+	Steps: []Step{Login(), ServiceTicket(), Cache(), Renew(), Delegate(), Accept()},
+}
+
+// Run runs the scenario against the environment as a subtest, failing at the first step that returns an error.
+func (sc Scenario) Run(t *testing.T, env Environment) {
+	t.Run(env.Name()+"/"+sc.Name, func(t *testing.T) {
+		s := &State{
+			Env:    env,
+			Client: env.NewClient(sc.Client...),
+		}
+		defer func() { s.Client.Destroy() }()
+		for i, st := range sc.Steps {
+			if err := st.Run(s); err != nil {
+				t.Fatalf("step %d (%s) failed: %v", i+1, st.Name, err)
+			}
+			t.Logf("step %d (%s) passed", i+1, st.Name)
+		}
+	})
+}
+
+// Login logs the user's client in.
+func Login() Step {
+	return Step{
+		Name: "login",
+		Run: func(s *State) error {
+			return s.Client.Login()
+		},
+	}
+}
+
+// ServiceTicket obtains a service ticket for the environment's SPN.
+func ServiceTicket() Step {
+	return Step{
+		Name: "service ticket",
+		Run: func(s *State) error {
+			tkt, key, err := s.Client.GetServiceTicket(s.Env.SPN())
+			if err != nil {
+				return err
+			}
+			s.Ticket, s.SessionKey = tkt, key
+			return nil
+		},
+	}
+}
+
+// Cache checks that the service ticket last obtained is returned from the client's cache.
+func Cache() Step {
+	return Step{
+		Name: "cache",
+		Run: func(s *State) error {
+			if err := requireTicket(s); err != nil {
+				return err
+			}
+			tkt, _, ok := s.Client.GetCachedTicket(s.Env.SPN())
+			if !ok {
+				return fmt.Errorf("ticket for %s not found in the cache", s.Env.SPN())
+			}
+			if !sameTicket(tkt, s.Ticket) {
+				return errors.New("cached ticket is not the ticket last obtained")
+			}
+			tkt, _, err := s.Client.GetServiceTicket(s.Env.SPN())
+			if err != nil {
+				return err
+			}
+			if !sameTicket(tkt, s.Ticket) {
+				return errors.New("a new ticket was obtained rather than the cached ticket being used")
+			}
+			return nil
+		},
+	}
+}
+
+// Renew renews the service ticket last obtained with the KDC and checks the renewed ticket replaces it in the cache.
+func Renew() Step {
+	return Step{
+		Name: "renew",
+		Run: func(s *State) error {
+			if err := requireTicket(s); err != nil {
+				return err
+			}
+			_, tgsRep, err := s.Client.TGSREQGenerateAndExchange(s.Ticket.SName, s.Ticket.Realm, s.Ticket, s.SessionKey, true)
+			if err != nil {
+				return fmt.Errorf("error renewing ticket: %w", err)
+			}
+			if sameTicket(tgsRep.Ticket, s.Ticket) {
+				return errors.New("renewed ticket is the same as the original")
+			}
+			tkt, _, ok := s.Client.GetCachedTicket(s.Env.SPN())
+			if !ok || !sameTicket(tkt, tgsRep.Ticket) {
+				return errors.New("renewed ticket did not replace the original in the cache")
+			}
+			s.Ticket, s.SessionKey = tgsRep.Ticket, tgsRep.DecryptedEncPart.Key
+			return nil
+		},
+	}
+}
+
+// Delegate hands the user's TGT and service tickets to a new client through a credential cache, as when credentials
+// are delegated to another process, and replaces the scenario's client with it.
+func Delegate() Step {
+	return Step{
+		Name: "delegate",
+		Run: func(s *State) error {
+			cc, err := s.Client.CCache()
+			if err != nil {
+				return fmt.Errorf("error exporting credential cache: %w", err)
+			}
+			cl, err := client.NewFromCCache(cc, s.Env.Config())
+			if err != nil {
+				return fmt.Errorf("error creating client from credential cache: %w", err)
+			}
+			if cl.Credentials.UserName() != s.Client.Credentials.UserName() {
+				cl.Destroy()
+				return fmt.Errorf("delegated client is for %s rather than %s", cl.Credentials.UserName(), s.Client.Credentials.UserName())
+			}
+			s.Client.Destroy()
+			s.Client = cl
+			if len(s.Ticket.SName.NameString) > 0 {
+				s.Ticket, s.SessionKey, err = cl.GetServiceTicket(s.Env.SPN())
+				if err != nil {
+					return fmt.Errorf("error getting service ticket with delegated credentials: %w", err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Accept has the service verify an AP_REQ for the service ticket last obtained, or a new one if there is none, and
+// checks the user is authenticated.
+func Accept() Step {
+	return Step{
+		Name: "accept",
+		Run: func(s *State) error {
+			if len(s.Ticket.SName.NameString) < 1 {
+				if err := ServiceTicket().Run(s); err != nil {
+					return err
+				}
+			}
+			auth, err := types.NewAuthenticator(s.Client.Credentials.Domain(), s.Client.Credentials.CName())
+			if err != nil {
+				return fmt.Errorf("error creating authenticator: %w", err)
+			}
+			apReq, err := messages.NewAPReq(s.Ticket, s.SessionKey, auth)
+			if err != nil {
+				return fmt.Errorf("error creating AP_REQ: %w", err)
+			}
+			ok, creds, err := service.VerifyAPREQ(&apReq, s.Env.ServiceSettings())
+			if !ok {
+				return fmt.Errorf("AP_REQ not accepted: %w", err)
+			}
+			if creds.UserName() != s.Client.Credentials.UserName() || creds.Domain() != s.Client.Credentials.Domain() {
+				return fmt.Errorf("service authenticated %s@%s rather than %s@%s", creds.UserName(), creds.Domain(),
+					s.Client.Credentials.UserName(), s.Client.Credentials.Domain())
+			}
+			s.Credentials = creds
+			return nil
+		},
+	}
+}
+
+// requireTicket returns an error if a previous step has not obtained a service ticket.
+func requireTicket(s *State) error {
+	if len(s.Ticket.SName.NameString) < 1 {
+		return errors.New("no service ticket obtained by a previous step")
+	}
+	return nil
+}
+
+// sameTicket indicates if the tickets are the same by comparing their encrypted parts.
+func sameTicket(a, b messages.Ticket) bool {
+	return bytes.Equal(a.EncPart.Cipher, b.EncPart.Cipher)
+}
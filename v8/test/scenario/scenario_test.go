@@ -0,0 +1,43 @@
+package scenario
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandard(t *testing.T) {
+	Standard.Run(t, FromEnv(t))
+}
+
+func TestScenario_CustomStep(t *testing.T) {
+	env := FromEnv(t)
+	var user string
+	Scenario{
+		Name: "custom",
+		Steps: []Step{
+			Login(),
+			Accept(),
+			{
+				Name: "check credentials",
+				Run: func(s *State) error {
+					if s.Credentials == nil {
+						return errors.New("no credentials accepted")
+					}
+					user = s.Credentials.UserName()
+					return nil
+				},
+			},
+		},
+	}.Run(t, env)
+	assert.Equal(t, "testuser1", user, "user accepted by the service not as expected")
+}
+
+func TestSteps_RequireTicket(t *testing.T) {
+	env := FromEnv(t)
+	s := &State{Env: env, Client: env.NewClient()}
+	defer s.Client.Destroy()
+	assert.Error(t, Cache().Run(s), "cache step without a ticket should fail")
+	assert.Error(t, Renew().Run(s), "renew step without a ticket should fail")
+}
@@ -2,7 +2,6 @@
 package types
 
 import (
-	"crypto/rand"
 	"fmt"
 	"math"
 	"math/big"
@@ -12,6 +11,7 @@ import (
 	"github.com/jcmturner/gokrb5/v8/asn1tools"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/v8/internal/random"
 )
 
 // Authenticator - A record containing information that can be shown to have been recently generated using the session
@@ -31,7 +31,7 @@ type Authenticator struct {
 
 // NewAuthenticator creates a new Authenticator.
 func NewAuthenticator(realm string, cname PrincipalName) (Authenticator, error) {
-	seq, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
+	seq, err := random.Int(big.NewInt(math.MaxUint32))
 	if err != nil {
 		return Authenticator{}, err
 	}
@@ -49,14 +49,14 @@ func NewAuthenticator(realm string, cname PrincipalName) (Authenticator, error)
 
 // GenerateSeqNumberAndSubKey sets the Authenticator's sequence number and subkey.
 func (a *Authenticator) GenerateSeqNumberAndSubKey(keyType int32, keySize int) error {
-	seq, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
+	seq, err := random.Int(big.NewInt(math.MaxUint32))
 	if err != nil {
 		return err
 	}
 	a.SeqNumber = seq.Int64()
 	//Generate subkey value
 	sk := make([]byte, keySize, keySize)
-	rand.Read(sk)
+	random.Read(sk)
 	a.SubKey = EncryptionKey{
 		KeyType:  keyType,
 		KeyValue: sk,
@@ -1,10 +1,11 @@
 package types
 
 import (
-	"crypto/rand"
-
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/gokrb5/v8/crypto/common"
 	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/internal/der"
+	"github.com/jcmturner/gokrb5/v8/internal/random"
 )
 
 // Reference: https://www.ietf.org/rfc/rfc4120.txt
@@ -32,17 +33,25 @@ type Checksum struct {
 
 // Unmarshal bytes into the EncryptedData.
 func (a *EncryptedData) Unmarshal(b []byte) error {
+	p := der.Parser(b)
+	if et, kvno, hasKVNO, cipher, ok := p.ReadEncryptedData(); ok {
+		a.EType = et
+		if hasKVNO {
+			a.KVNO = kvno
+		}
+		a.Cipher = cipher
+		return nil
+	}
 	_, err := asn1.Unmarshal(b, a)
 	return err
 }
 
 // Marshal the EncryptedData.
 func (a *EncryptedData) Marshal() ([]byte, error) {
-	edb, err := asn1.Marshal(*a)
-	if err != nil {
-		return edb, err
-	}
-	return edb, nil
+	db := der.NewBuilder()
+	defer db.Release()
+	db.AddEncryptedData(a.EType, a.KVNO, a.Cipher)
+	return db.Bytes(), nil
 }
 
 // Unmarshal bytes into the EncryptionKey.
@@ -51,6 +60,18 @@ func (a *EncryptionKey) Unmarshal(b []byte) error {
 	return err
 }
 
+// Zero overwrites the key value with zeros so that the key does not remain in memory once it is no longer needed,
+// zeroing the keys derived from it in the derived key cache too. Copies of the EncryptionKey share its key value so
+// are zeroed as well.
+func (a EncryptionKey) Zero() {
+	if len(a.KeyValue) > 0 {
+		common.ForgetDerivedKeys(a.KeyValue)
+	}
+	for i := range a.KeyValue {
+		a.KeyValue[i] = 0
+	}
+}
+
 // Unmarshal bytes into the Checksum.
 func (a *Checksum) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, a)
@@ -63,7 +84,7 @@ func GenerateEncryptionKey(etype etype.EType) (EncryptionKey, error) {
 		KeyType: etype.GetETypeID(),
 	}
 	b := make([]byte, etype.GetKeyByteSize(), etype.GetKeyByteSize())
-	_, err := rand.Read(b)
+	_, err := random.Read(b)
 	if err != nil {
 		return k, err
 	}
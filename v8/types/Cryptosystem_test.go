@@ -4,6 +4,7 @@ import (
 	"encoding/hex"
 	"testing"
 
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/jcmturner/gokrb5/v8/iana"
 	"github.com/jcmturner/gokrb5/v8/test/testdata"
 	"github.com/stretchr/testify/assert"
@@ -89,3 +90,95 @@ func TestMarshalEncryptedData(t *testing.T) {
 	}
 	assert.Equal(t, b, mb, "Marshal bytes of Encrypted Data not as expected")
 }
+
+func TestEncryptedData_MarshalAsASN1(t *testing.T) {
+	t.Parallel()
+	for _, a := range []EncryptedData{
+		{},
+		{EType: 18, KVNO: 2, Cipher: []byte{}},
+		{EType: -128, KVNO: -1, Cipher: []byte{1, 2, 3}},
+		{EType: 23, KVNO: 0x7fffffff, Cipher: make([]byte, 300)},
+	} {
+		want, err := asn1.Marshal(a)
+		if err != nil {
+			t.Fatalf("error marshaling with asn1: %v", err)
+		}
+		b, err := a.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		assert.Equal(t, want, b, "encoding not as the asn1 package's")
+		var u, ua EncryptedData
+		err = u.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		_, err = asn1.Unmarshal(b, &ua)
+		if err != nil {
+			t.Fatalf("error unmarshaling with asn1: %v", err)
+		}
+		assert.Equal(t, ua, u, "unmarshaled value not as the asn1 package's")
+	}
+}
+
+func TestEncryptedData_UnmarshalNotDER(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		name string
+		hex  string
+	}{
+		{"non-minimal length", "3012a003020112a103020102a206048103010203"},
+		{"element after cipher", "3015a003020112a103020102a2050403010203a3020500"},
+		{"etype too large", "3013a007020500ffffffffa2080406aabbccddeeff"},
+		{"truncated", "300da003020112a2060404aabbcc"},
+		// The kvno is left as it was when it is absent.
+		{"no kvno", "300da003020112a2060404aabbccdd"},
+	} {
+		b, _ := hex.DecodeString(test.hex)
+		u, ua := EncryptedData{KVNO: 5}, EncryptedData{KVNO: 5}
+		_, erra := asn1.Unmarshal(b, &ua)
+		err := u.Unmarshal(b)
+		assert.Equal(t, erra, err, "%s: error not as the asn1 package's", test.name)
+		assert.Equal(t, ua, u, "%s: unmarshaled value not as the asn1 package's", test.name)
+	}
+}
+
+func TestEncryptionKey_Zero(t *testing.T) {
+	t.Parallel()
+	k := EncryptionKey{KeyType: 18, KeyValue: []byte{1, 2, 3, 4}}
+	c := k
+	k.Zero()
+	assert.Equal(t, []byte{0, 0, 0, 0}, k.KeyValue, "key value not zeroed")
+	assert.Equal(t, []byte{0, 0, 0, 0}, c.KeyValue, "key value of the copy not zeroed")
+	EncryptionKey{}.Zero()
+}
+
+func BenchmarkEncryptedData_Marshal(b *testing.B) {
+	var a EncryptedData
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5enc_data)
+	err := a.Unmarshal(v)
+	if err != nil {
+		b.Fatalf("Unmarshal error: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := a.Marshal()
+		if err != nil {
+			b.Fatalf("Marshal error: %v", err)
+		}
+	}
+}
+
+func BenchmarkEncryptedData_Unmarshal(b *testing.B) {
+	v, _ := hex.DecodeString(testdata.MarshaledKRB5enc_data)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var a EncryptedData
+		err := a.Unmarshal(v)
+		if err != nil {
+			b.Fatalf("Unmarshal error: %v", err)
+		}
+	}
+}
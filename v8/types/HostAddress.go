@@ -26,7 +26,7 @@ func GetHostAddress(s string) (HostAddress, error) {
 	var h HostAddress
 	cAddr, _, err := net.SplitHostPort(s)
 	if err != nil {
-		return h, fmt.Errorf("invalid format of client address: %v", err)
+		return h, fmt.Errorf("invalid format of client address: %w", err)
 	}
 	ip := net.ParseIP(cAddr)
 	var ht int32
@@ -37,7 +37,7 @@ func GetHostAddress(s string) (HostAddress, error) {
 		ht = addrtype.IPv6
 		ip = ip.To16()
 	} else {
-		return h, fmt.Errorf("could not determine client's address types: %v", err)
+		return h, fmt.Errorf("could not determine client's address types: %w", err)
 	}
 	h = HostAddress{
 		AddrType: ht,
@@ -54,6 +54,8 @@ func (h *HostAddress) GetAddress() (string, error) {
 }
 
 // LocalHostAddresses returns a HostAddresses struct for the local machines interface IP addresses.
+// The addresses of loopback interfaces and link-local IPv6 addresses, which do not identify the host to its peers, are
+// not included.
 func LocalHostAddresses() (ha HostAddresses, err error) {
 	ifs, err := net.Interfaces()
 	if err != nil {
@@ -76,25 +78,27 @@ func LocalHostAddresses() (ha HostAddresses, err error) {
 			case *net.IPAddr:
 				ip = v.IP
 			}
-			var a HostAddress
-			if ip.To16() == nil {
-				//neither IPv4 or IPv6
-				continue
+			if a, ok := localHostAddress(ip); ok {
+				ha = append(ha, a)
 			}
-			if ip.To4() != nil {
-				//Is IPv4
-				a.AddrType = addrtype.IPv4
-				a.Address = ip.To4()
-			} else {
-				a.AddrType = addrtype.IPv6
-				a.Address = ip.To16()
-			}
-			ha = append(ha, a)
 		}
 	}
 	return ha, nil
 }
 
+// localHostAddress returns the HostAddress of an interface's IP address and whether it is one to include in requests.
+func localHostAddress(ip net.IP) (HostAddress, bool) {
+	if ip.To16() == nil || ip.IsLoopback() {
+		// Neither IPv4 or IPv6, or a loopback address
+		return HostAddress{}, false
+	}
+	if ip.To4() == nil && ip.IsLinkLocalUnicast() {
+		// Link-local IPv6 addresses are only meaningful with the zone of the interface
+		return HostAddress{}, false
+	}
+	return HostAddressFromNetIP(ip), true
+}
+
 // HostAddressesFromNetIPs returns a HostAddresses type from a slice of net.IP
 func HostAddressesFromNetIPs(ips []net.IP) (ha HostAddresses) {
 	for _, ip := range ips {
@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/hex"
+	"net"
 	"testing"
 
 	"github.com/jcmturner/gokrb5/v8/iana/addrtype"
@@ -27,3 +28,25 @@ func TestGetHostAddress(t *testing.T) {
 		assert.Equal(t, test.hex, hex.EncodeToString(h.Address), "wrong address bytes for %s", test.str)
 	}
 }
+
+func TestLocalHostAddress(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		ip     string
+		ok     bool
+		ipType int32
+	}{
+		{"192.168.1.100", true, addrtype.IPv4},
+		{"2001:db8::1", true, addrtype.IPv6},
+		{"127.0.0.1", false, 0},
+		{"::1", false, 0},
+		{"fe80::1cf3:b43b:df29:d43e", false, 0},
+	}
+	for _, test := range tests {
+		h, ok := localHostAddress(net.ParseIP(test.ip))
+		assert.Equal(t, test.ok, ok, "inclusion of %s not as expected", test.ip)
+		assert.Equal(t, test.ipType, h.AddrType, "wrong address type for %s", test.ip)
+	}
+	_, ok := localHostAddress(nil)
+	assert.False(t, ok, "nil IP should not be included")
+}
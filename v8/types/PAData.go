@@ -3,6 +3,7 @@ package types
 // Reference: https://www.ietf.org/rfc/rfc4120.txt
 // Section: 5.2.7
 import (
+	"encoding/binary"
 	"fmt"
 	"time"
 
@@ -43,14 +44,19 @@ func (pas *PADataSequence) Contains(patype int32) bool {
 
 // GetPAEncTSEncAsnMarshalled returns the bytes of a PAEncTSEnc.
 func GetPAEncTSEncAsnMarshalled() ([]byte, error) {
-	t := time.Now().UTC()
+	return GetPAEncTSEncAsnMarshalledAt(time.Now())
+}
+
+// GetPAEncTSEncAsnMarshalledAt returns the bytes of a PAEncTSEnc for the time provided.
+func GetPAEncTSEncAsnMarshalledAt(t time.Time) ([]byte, error) {
+	t = t.UTC()
 	p := PAEncTSEnc{
 		PATimestamp: t,
 		PAUSec:      int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
 	}
 	b, err := asn1.Marshal(p)
 	if err != nil {
-		return b, fmt.Errorf("error mashaling PAEncTSEnc: %v", err)
+		return b, fmt.Errorf("error mashaling PAEncTSEnc: %w", err)
 	}
 	return b, nil
 }
@@ -80,6 +86,77 @@ type PAReqEncPARep struct {
 	Chksum     []byte `asn1:"explicit,tag:1"`
 }
 
+// PAForUser implements MS-SFU PA-FOR-USER: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-sfu/aceb70de-40f0-4409-87fa-df00ca145f5a
+type PAForUser struct {
+	UserName    PrincipalName `asn1:"explicit,tag:0"`
+	UserRealm   string        `asn1:"generalstring,explicit,tag:1"`
+	Cksum       Checksum      `asn1:"explicit,tag:2"`
+	AuthPackage string        `asn1:"generalstring,explicit,tag:3"`
+}
+
+// ChecksumData returns the bytes the PA-FOR-USER checksum is calculated over: the name type as a little-endian four
+// byte integer followed by the name strings, realm and authentication package.
+func (pa *PAForUser) ChecksumData() []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(pa.UserName.NameType))
+	for _, s := range pa.UserName.NameString {
+		b = append(b, s...)
+	}
+	b = append(b, pa.UserRealm...)
+	return append(b, pa.AuthPackage...)
+}
+
+// Marshal the PAForUser.
+func (pa *PAForUser) Marshal() ([]byte, error) {
+	return asn1.Marshal(*pa)
+}
+
+// Unmarshal bytes into the PAForUser
+func (pa *PAForUser) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	return err
+}
+
+// PAC options flags of the PA-PAC-OPTIONS, MS-KILE section 2.2.10.
+const (
+	PACOptionClaims                             = 0
+	PACOptionBranchAware                        = 1
+	PACOptionForwardToFullDC                    = 2
+	PACOptionResourceBasedConstrainedDelegation = 3
+)
+
+// PAPACOptions implements MS-KILE PA-PAC-OPTIONS: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kile/99721810-c931-4a6f-b708-f77c6ed01e8f
+type PAPACOptions struct {
+	KerberosFlags asn1.BitString `asn1:"explicit,tag:0"`
+}
+
+// Marshal the PAPACOptions.
+func (pa *PAPACOptions) Marshal() ([]byte, error) {
+	return asn1.Marshal(*pa)
+}
+
+// Unmarshal bytes into the PAPACOptions
+func (pa *PAPACOptions) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	return err
+}
+
+// PAPACRequest implements MS-KILE KERB-PA-PAC-REQUEST: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kile/765795ba-9e05-4220-9bd2-b34464e413a7
+type PAPACRequest struct {
+	IncludePAC bool `asn1:"explicit,tag:0"`
+}
+
+// Marshal the PAPACRequest.
+func (pa *PAPACRequest) Marshal() ([]byte, error) {
+	return asn1.Marshal(*pa)
+}
+
+// Unmarshal bytes into the PAPACRequest
+func (pa *PAPACRequest) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	return err
+}
+
 // Unmarshal bytes into the PAData
 func (pa *PAData) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, pa)
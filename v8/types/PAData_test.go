@@ -168,3 +168,19 @@ func TestUnmarshalETypeInfo2_only1(t *testing.T) {
 	assert.Equal(t, "Morton's #0", a[0].Salt, "Salt of first etype info2 entry not as expected")
 	assert.Equal(t, []byte("s2k: 0"), a[0].S2KParams, "String to key params of first etype info2 entry not as expected")
 }
+
+func TestMarshalPAPACRequest(t *testing.T) {
+	t.Parallel()
+	for include, h := range map[bool]string{false: "3005a003010100", true: "3005a0030101ff"} {
+		pa := PAPACRequest{IncludePAC: include}
+		b, err := pa.Marshal()
+		if err != nil {
+			t.Fatalf("error marshaling PA-PAC-REQUEST: %v", err)
+		}
+		assert.Equal(t, h, hex.EncodeToString(b), "encoding not as expected with include-pac %v", include)
+		var u PAPACRequest
+		if assert.NoError(t, u.Unmarshal(b), "error unmarshaling") {
+			assert.Equal(t, include, u.IncludePAC, "include-pac not as expected")
+		}
+	}
+}
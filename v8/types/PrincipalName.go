@@ -23,6 +23,15 @@ func NewPrincipalName(ntype int32, spn string) PrincipalName {
 	}
 }
 
+// NewEnterprisePrincipalName creates a new enterprise PrincipalName, RFC 6806 section 5, with the name, such as a
+// userPrincipalName of the form user@domain, as its single component.
+func NewEnterprisePrincipalName(name string) PrincipalName {
+	return PrincipalName{
+		NameType:   nametype.KRB_NT_ENTERPRISE,
+		NameString: []string{name},
+	}
+}
+
 // GetSalt returns a salt derived from the PrincipalName.
 func (pn PrincipalName) GetSalt(realm string) string {
 	var sb []byte
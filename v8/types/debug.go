@@ -0,0 +1,34 @@
+package types
+
+import (
+	"fmt"
+	"os"
+)
+
+// DebugDumpEnvVar is the environment variable that must be set to "1" for the DebugDump methods to include secret
+// values such as key bytes and passwords.
+const DebugDumpEnvVar = "GOKRB5_DEBUG_DUMP_SECRETS"
+
+// DebugDumpEnabled indicates if secret values should be included by the DebugDump methods.
+func DebugDumpEnabled() bool {
+	return os.Getenv(DebugDumpEnvVar) == "1"
+}
+
+// String returns a description of the EncryptionKey with the key value redacted so that it can be logged safely.
+func (k EncryptionKey) String() string {
+	return fmt.Sprintf("{KeyType: %d KeyValue: [%d bytes redacted]}", k.KeyType, len(k.KeyValue))
+}
+
+// GoString returns a Go syntax representation of the EncryptionKey with the key value redacted.
+func (k EncryptionKey) GoString() string {
+	return fmt.Sprintf("types.EncryptionKey{KeyType:%d, KeyValue:[]byte{ /* %d bytes redacted */ }}", k.KeyType, len(k.KeyValue))
+}
+
+// DebugDump returns a description of the EncryptionKey including the key value in hex if the DebugDumpEnvVar
+// environment variable is set to "1". Otherwise the key value is redacted as for String.
+func (k EncryptionKey) DebugDump() string {
+	if !DebugDumpEnabled() {
+		return k.String()
+	}
+	return fmt.Sprintf("{KeyType: %d KeyValue: %x}", k.KeyType, k.KeyValue)
+}
@@ -0,0 +1,34 @@
+package types
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptionKey_String(t *testing.T) {
+	t.Parallel()
+	k := EncryptionKey{KeyType: etypeID.AES128_CTS_HMAC_SHA1_96, KeyValue: []byte("secretkeybytes!!")}
+	for _, f := range []string{"%v", "%+v", "%#v", "%s"} {
+		s := fmt.Sprintf(f, k)
+		assert.NotContains(t, s, "secretkeybytes", "key value in %s output", f)
+		assert.NotContains(t, s, fmt.Sprintf("%x", k.KeyValue), "key value in %s output", f)
+		assert.Contains(t, s, "16 bytes redacted", "redaction not in %s output", f)
+	}
+	// Nested in other structs
+	s := fmt.Sprintf("%+v", Authenticator{SubKey: k})
+	assert.NotContains(t, s, fmt.Sprintf("%x", k.KeyValue), "key value in nested output")
+	assert.Contains(t, s, "16 bytes redacted", "redaction not in nested output")
+}
+
+func TestEncryptionKey_DebugDump(t *testing.T) {
+	k := EncryptionKey{KeyType: etypeID.AES128_CTS_HMAC_SHA1_96, KeyValue: []byte{0x01, 0x02, 0xab}}
+	os.Unsetenv(DebugDumpEnvVar)
+	assert.Equal(t, k.String(), k.DebugDump(), "key value should be redacted unless enabled")
+	os.Setenv(DebugDumpEnvVar, "1")
+	defer os.Unsetenv(DebugDumpEnvVar)
+	assert.Equal(t, "{KeyType: 17 KeyValue: 0102ab}", k.DebugDump(), "debug dump not as expected")
+}
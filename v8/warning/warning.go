@@ -0,0 +1,44 @@
+// Package warning provides structured warnings of weak or deprecated Kerberos usage so that the gradual hardening of
+// a deployment can be monitored before switching to enforcement.
+package warning
+
+import "fmt"
+
+// Code identifies the condition a Warning is emitted for.
+type Code string
+
+// Warning codes.
+const (
+	// WeakEType is emitted when a deprecated encryption type, such as RC4 or DES3, is used for a key or ticket.
+	WeakEType Code = "weak-etype"
+	// NoPAC is emitted when a service accepts a ticket that does not contain a PAC while PAC decoding is enabled.
+	NoPAC Code = "no-pac"
+	// ClockSkew is emitted when the clock skew with a client is near the maximum permitted.
+	ClockSkew Code = "clock-skew"
+	// KeytabKVNO is emitted when the newest key a service has for a ticket is older than the kvno of the ticket.
+	KeytabKVNO Code = "keytab-kvno"
+)
+
+// Warning describes a weak or deprecated usage that is currently permitted.
+type Warning struct {
+	Code Code
+	// Principal is the name of the principal the warning relates to, for example the client presenting a ticket.
+	Principal string
+	Realm     string
+	Message   string
+	// CorrelationID of the authentication attempt the warning is emitted in, by a client or a service, if it has one.
+	CorrelationID string
+}
+
+// String returns a one line description of the warning suitable for logging.
+func (w Warning) String() string {
+	s := fmt.Sprintf("[%s] %s (principal: %s realm: %s)", w.Code, w.Message, w.Principal, w.Realm)
+	if w.CorrelationID != "" {
+		s = "[Correlation ID: " + w.CorrelationID + "] " + s
+	}
+	return s
+}
+
+// Hook is called with each warning emitted. It is called synchronously on the goroutine performing the exchange so
+// it should not block.
+type Hook func(Warning)
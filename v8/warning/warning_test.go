@@ -0,0 +1,20 @@
+package warning
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarning_String(t *testing.T) {
+	t.Parallel()
+	w := Warning{
+		Code:      WeakEType,
+		Principal: "testuser1",
+		Realm:     "TEST.GOKRB5",
+		Message:   "session key uses deprecated encryption type arcfour-hmac",
+	}
+	assert.Equal(t, "[weak-etype] session key uses deprecated encryption type arcfour-hmac (principal: testuser1 realm: TEST.GOKRB5)", w.String(), "string not as expected")
+	w.CorrelationID = "abc"
+	assert.Equal(t, "[Correlation ID: abc] [weak-etype] session key uses deprecated encryption type arcfour-hmac (principal: testuser1 realm: TEST.GOKRB5)", w.String(), "string with correlation ID not as expected")
+}